@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Files in the config directory. The agent keeps its own certificate and
+// key, and the client certificate viewers pair with; the viewer keeps the
+// certificates it pinned.
+const (
+	CertFile       = "agent-cert.pem"
+	KeyFile        = "agent-key.pem"
+	ClientCertFile = "agent-client.pem" // certificate and key, handed to viewers that pair
+	PinsFile       = "known_agents.json"
+)
+
+// certValidity is how long a generated certificate is valid. Viewers pin
+// the certificate itself, so expiry only matters to tools that check it.
+const certValidity = 10 * 365 * 24 * time.Hour
+
+// Fingerprint is the SHA-256 of a DER certificate, as "sha256:" and hex.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// LoadOrCreateCert loads the agent's certificate from dir, generating a
+// self-signed one on first start. created reports a new one.
+func LoadOrCreateCert(dir string) (cert tls.Certificate, created bool, err error) {
+	certPath, keyPath := filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile)
+	cert, err = tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		return cert, false, nil
+	}
+	if _, statErr := os.Stat(certPath); !errors.Is(statErr, os.ErrNotExist) {
+		return tls.Certificate{}, false, err
+	}
+	certPEM, keyPEM, err := newCert("ping-tracker agent", x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return tls.Certificate{}, false, err
+	}
+	if err := writePrivate(keyPath, keyPEM); err != nil {
+		return tls.Certificate{}, false, err
+	}
+	if err := writePrivate(certPath, certPEM); err != nil {
+		return tls.Certificate{}, false, err
+	}
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	return cert, true, err
+}
+
+// loadOrCreateClientCert loads the client certificate paired viewers
+// present, as one PEM file holding certificate and key, generating it the
+// first time.
+func loadOrCreateClientCert(dir string) (pemData []byte, err error) {
+	path := filepath.Join(dir, ClientCertFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	certPEM, keyPEM, err := newCert("ping-tracker viewer", x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	data := append(certPEM, keyPEM...)
+	return data, writePrivate(path, data)
+}
+
+// newCert generates a self-signed ECDSA P-256 certificate for usage, and
+// returns it and its key PEM-encoded.
+func newCert(name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if usage == x509.ExtKeyUsageServerAuth {
+		tmpl.DNSNames = []string{"localhost"}
+		if host, err := os.Hostname(); err == nil {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// writePrivate writes data readable by the owner only, through a
+// temporary file renamed over path.
+func writePrivate(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
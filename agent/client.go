@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// fetchTimeout bounds a single request to one agent.
+const fetchTimeout = 2 * time.Second
+
+// maxSnapshotBody bounds the snapshot read from one agent, so an agent
+// cannot make the viewer buffer without end.
+const maxSnapshotBody = 64 << 20
+
+// SourceStatus describes the health of one remote agent.
+type SourceStatus struct {
+	Host    string
+	Healthy bool
+	LastOK  time.Time
+	LastErr error
+	Count   int
+}
+
+type source struct {
+	host   string
+	client *http.Client
+	status SourceStatus
+	conns  []*tracker.Connection // last good snapshot, kept while disconnected
+}
+
+// Multi polls several agents concurrently and merges their snapshots.
+type Multi struct {
+	mu       sync.RWMutex
+	sources  []*source
+	scheme   string // "http", or "https" after UseTLS
+	token    string // sent as the bearer token, if set
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewMulti creates a client for the given host:port agent addresses.
+func NewMulti(hosts []string, interval time.Duration) *Multi {
+	m := &Multi{
+		scheme:   "http",
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+	client := &http.Client{Timeout: fetchTimeout}
+	for _, h := range hosts {
+		m.sources = append(m.sources, &source{host: h, client: client, status: SourceStatus{Host: h}})
+	}
+	return m
+}
+
+// UseTLS fetches from the agents over TLS, checking each agent's
+// certificate against pins. Must be called before Start.
+func (m *Multi) UseTLS(pins *Pins) {
+	m.scheme = "https"
+	for _, s := range m.sources {
+		s.client = &http.Client{
+			Timeout:   fetchTimeout,
+			Transport: &http.Transport{TLSClientConfig: pins.TLSConfig(s.host)},
+		}
+	}
+}
+
+// UseToken sends token as the bearer token of every request, for agents
+// started with -serve-token-env. Must be called before Start.
+func (m *Multi) UseToken(token string) {
+	m.token = token
+}
+
+// Start fetches once and then polls every interval in the background.
+func (m *Multi) Start() {
+	m.fetchAll()
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.fetchAll()
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts polling.
+func (m *Multi) Stop() {
+	close(m.stopCh)
+}
+
+// fetchAll queries every source in parallel; a failing source does not
+// affect the others.
+func (m *Multi) fetchAll() {
+	var wg sync.WaitGroup
+	for _, s := range m.sources {
+		wg.Add(1)
+		go func(s *source) {
+			defer wg.Done()
+			conns, err := m.fetch(s)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if err != nil {
+				s.status.Healthy = false
+				s.status.LastErr = err
+				return
+			}
+			for _, c := range conns {
+				c.Host = s.host
+			}
+			s.conns = conns
+			s.status.Healthy = true
+			s.status.LastErr = nil
+			s.status.LastOK = time.Now()
+			s.status.Count = len(conns)
+		}(s)
+	}
+	wg.Wait()
+}
+
+func (m *Multi) fetch(s *source) ([]*tracker.Connection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.scheme+"://"+s.host+SnapshotPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", s.host, resp.Status)
+	}
+
+	var conns []*tracker.Connection
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSnapshotBody)).Decode(&conns); err != nil {
+		return nil, err
+	}
+	return conns, nil
+}
+
+// Snapshot returns the merged connections of all sources. Sources that are
+// currently unreachable contribute their last good snapshot.
+func (m *Multi) Snapshot() []*tracker.Connection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*tracker.Connection
+	for _, s := range m.sources {
+		for _, c := range s.conns {
+			cp := *c
+			result = append(result, &cp)
+		}
+	}
+	return result
+}
+
+// Status returns the health of every source, ordered by host.
+func (m *Multi) Status() []SourceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]SourceStatus, 0, len(m.sources))
+	for _, s := range m.sources {
+		result = append(result, s.status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+	return result
+}
+
+// Healthy reports whether the named source answered its last poll.
+func (m *Multi) Healthy(host string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.sources {
+		if s.host == host {
+			return s.status.Healthy
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// fakeAgent serves a fixed snapshot on SnapshotPath, or 503 while down.
+type fakeAgent struct {
+	*httptest.Server
+	conns []*tracker.Connection
+	down  atomic.Bool
+}
+
+func newFakeAgent(t *testing.T, conns ...*tracker.Connection) *fakeAgent {
+	a := &fakeAgent{conns: conns}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != SnapshotPath {
+			http.NotFound(w, r)
+			return
+		}
+		if a.down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(a.conns)
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeAgent) host() string {
+	return strings.TrimPrefix(a.URL, "http://")
+}
+
+func TestMultiPartialFailure(t *testing.T) {
+	good := newFakeAgent(t, &tracker.Connection{AppName: "web", RemotePort: 443})
+	bad := newFakeAgent(t)
+	bad.down.Store(true)
+
+	m := NewMulti([]string{good.host(), bad.host()}, time.Hour)
+	m.fetchAll()
+
+	snap := m.Snapshot()
+	if len(snap) != 1 || snap[0].AppName != "web" || snap[0].Host != good.host() {
+		t.Fatalf("snapshot %+v", snap)
+	}
+	if !m.Healthy(good.host()) || m.Healthy(bad.host()) {
+		t.Fatalf("health: good %v, bad %v", m.Healthy(good.host()), m.Healthy(bad.host()))
+	}
+	for _, s := range m.Status() {
+		if s.Host == bad.host() && s.LastErr == nil {
+			t.Fatal("failing source has no error")
+		}
+	}
+}
+
+func TestMultiReconnect(t *testing.T) {
+	a := newFakeAgent(t, &tracker.Connection{AppName: "db", RemotePort: 5432})
+	m := NewMulti([]string{a.host()}, time.Hour)
+	m.fetchAll()
+
+	// While the agent is down its last snapshot stays.
+	a.down.Store(true)
+	m.fetchAll()
+	if m.Healthy(a.host()) {
+		t.Fatal("healthy while down")
+	}
+	if snap := m.Snapshot(); len(snap) != 1 {
+		t.Fatalf("last good snapshot dropped: %d conns", len(snap))
+	}
+
+	// Back up: healthy again with the new data.
+	a.conns = append(a.conns, &tracker.Connection{AppName: "cache", RemotePort: 6379})
+	a.down.Store(false)
+	m.fetchAll()
+	if !m.Healthy(a.host()) {
+		t.Fatal("not healthy after reconnecting")
+	}
+	if snap := m.Snapshot(); len(snap) != 2 {
+		t.Fatalf("%d conns after reconnecting, want 2", len(snap))
+	}
+}
+
+func TestMultiTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := newFakeAgent(t, &tracker.Connection{AppName: "web"})
+
+	m := NewMulti([]string{strings.TrimPrefix(slow.URL, "http://"), fast.host()}, time.Hour)
+	start := time.Now()
+	m.fetchAll()
+	if d := time.Since(start); d > fetchTimeout+time.Second {
+		t.Fatalf("fetchAll took %v with a hung agent", d)
+	}
+	if !m.Healthy(fast.host()) || len(m.Snapshot()) != 1 {
+		t.Fatal("the hung agent held up the other one")
+	}
+}
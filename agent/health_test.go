@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/demo"
+	"ping-tracker/tracker"
+)
+
+func TestWriteHealth(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	interval := 2 * time.Second
+	tests := []struct {
+		name   string
+		h      tracker.Health
+		ready  bool
+		code   int
+		status string
+	}{
+		{"starting, live", tracker.Health{Started: now.Add(-time.Second), Interval: interval}, false, http.StatusOK, "ok"},
+		{"starting, not ready", tracker.Health{Started: now.Add(-time.Second), Interval: interval}, true, http.StatusServiceUnavailable, "starting"},
+		{"first scan never came", tracker.Health{Started: now.Add(-time.Minute), Interval: interval}, false, http.StatusServiceUnavailable, "stalled"},
+		{"scanning", tracker.Health{Started: now.Add(-time.Hour), LastScan: now.Add(-interval), Interval: interval}, false, http.StatusOK, "ok"},
+		{"scanning, ready", tracker.Health{Started: now.Add(-time.Hour), LastScan: now.Add(-interval), Interval: interval}, true, http.StatusOK, "ready"},
+		{"at the limit", tracker.Health{LastScan: now.Add(-3 * interval), Interval: interval}, false, http.StatusOK, "ok"},
+		{"stalled", tracker.Health{LastScan: now.Add(-3*interval - time.Millisecond), Interval: interval, Errors: 2, LastError: "netlink: EBUSY"}, false, http.StatusServiceUnavailable, "stalled"},
+		{"stalled but ready", tracker.Health{LastScan: now.Add(-time.Hour), Interval: interval}, true, http.StatusOK, "ready"},
+		{"never started", tracker.Health{Interval: interval}, false, http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeHealth(w, tt.h, now, tt.ready)
+		var body healthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v in %s", tt.name, err, w.Body)
+		}
+		if w.Code != tt.code || body.Status != tt.status {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, w.Code, body.Status, tt.code, tt.status)
+		}
+		if body.Interval != "2s" || body.ScanErrors != tt.h.Errors || body.LastError != tt.h.LastError {
+			t.Errorf("%s: body %+v", tt.name, body)
+		}
+	}
+}
+
+// TestHealthEndpoints runs a demo tracker and checks the probes and the
+// self-metrics against its perf records.
+func TestHealthEndpoints(t *testing.T) {
+	tr := tracker.NewTracker(20*time.Millisecond, true)
+	tr.SetSource(demo.New(1, 20*time.Millisecond))
+	h := Handler(tr, nil, "", "")
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	if w := get(ReadyzPath); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"starting"`) {
+		t.Errorf("readyz before start: %d %s", w.Code, w.Body)
+	}
+
+	tr.Start()
+	defer tr.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.Health().Scans < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("no scans")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, path := range []string{HealthzPath, ReadyzPath} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Errorf("%s: %d %s", path, w.Code, w.Body)
+		}
+	}
+
+	metrics := get(MetricsPath).Body.String()
+	values := map[string]float64{}
+	for _, line := range strings.Split(metrics, "\n") {
+		if name, v, ok := strings.Cut(line, " "); ok && !strings.HasPrefix(line, "#") {
+			values[name], _ = strconv.ParseFloat(v, 64)
+		}
+	}
+	count := values["ping_tracker_scan_duration_seconds_count"]
+	if count < 3 || values[`ping_tracker_scan_duration_seconds_bucket{le="+Inf"}`] != count {
+		t.Errorf("scan count %v, +Inf bucket %v", count, values[`ping_tracker_scan_duration_seconds_bucket{le="+Inf"}`])
+	}
+	prev := 0.0
+	for _, le := range tracker.ScanDurationBuckets {
+		v := values[`ping_tracker_scan_duration_seconds_bucket{le="`+strconv.FormatFloat(le.Seconds(), 'g', -1, 64)+`"}`]
+		if v < prev || v > count {
+			t.Errorf("bucket %s: %v after %v (count %v)", le, v, prev, count)
+		}
+		prev = v
+	}
+	probes := values[`ping_tracker_probes_total{outcome="ok"}`] + values[`ping_tracker_probes_total{outcome="lossy"}`] +
+		values[`ping_tracker_probes_total{outcome="failed"}`]
+	if probes == 0 || values["ping_tracker_connections"] == 0 || values["ping_tracker_goroutines"] == 0 {
+		t.Errorf("probes %v, connections %v, goroutines %v", probes, values["ping_tracker_connections"], values["ping_tracker_goroutines"])
+	}
+	if _, ok := values["ping_tracker_scan_errors_total"]; !ok {
+		t.Error("no scan error counter")
+	}
+}
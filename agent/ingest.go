@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// IngestPath accepts external latency measurements over HTTP POST.
+const IngestPath = "/ingest"
+
+const (
+	maxIngestBody    = 64 << 10 // bytes per request or datagram
+	maxIngestRecords = 100      // records per request or datagram
+
+	ingestRate  = 50  // records per second per sender
+	ingestBurst = 100 // records a sender may send at once
+	maxSenders  = 256 // senders tracked by the rate limiter
+)
+
+// Ingester is the part of the tracker that accepts external measurements.
+type Ingester interface {
+	IngestRTT(tracker.ExternalRTT) error
+}
+
+// ingestLimiter is a token bucket per sender address.
+type ingestLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newIngestLimiter() *ingestLimiter {
+	return &ingestLimiter{buckets: make(map[string]*bucket)}
+}
+
+// allow takes one token from sender's bucket.
+func (l *ingestLimiter) allow(sender string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[sender]
+	if !ok {
+		if len(l.buckets) >= maxSenders {
+			// Full buckets are equivalent to forgetting the sender.
+			for k, v := range l.buckets {
+				if now.Sub(v.last).Seconds()*ingestRate+v.tokens >= ingestBurst {
+					delete(l.buckets, k)
+				}
+			}
+			if len(l.buckets) >= maxSenders {
+				return false
+			}
+		}
+		b = &bucket{tokens: ingestBurst, last: now}
+		l.buckets[sender] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * ingestRate
+	if b.tokens > ingestBurst {
+		b.tokens = ingestBurst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// errRateLimited is returned for records dropped by the rate limiter.
+var errRateLimited = errors.New("rate limited")
+
+// ingest decodes a stream of ExternalRTT JSON objects (one per line or
+// concatenated) from data and passes them to t. It returns how many were
+// accepted and the first error.
+func ingest(t Ingester, l *ingestLimiter, sender string, data []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	accepted := 0
+	var firstErr error
+	for n := 0; ; n++ {
+		var r tracker.ExternalRTT
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("record %d: %v", n+1, err)
+			}
+			break // the decoder cannot resync after a syntax error
+		}
+		if n >= maxIngestRecords {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("more than %d records", maxIngestRecords)
+			}
+			break
+		}
+		if !l.allow(sender, time.Now()) {
+			err = errRateLimited
+		} else {
+			err = t.IngestRTT(r)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("record %d: %w", n+1, err)
+			}
+			continue
+		}
+		accepted++
+	}
+	return accepted, firstErr
+}
+
+// ingestHandler serves IngestPath to requests that carry token as a
+// bearer token. With no token the path is off: anyone who can reach the
+// agent could otherwise overwrite the latency of every connection.
+func ingestHandler(t Ingester, token string) http.HandlerFunc {
+	l := newIngestLimiter()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "ingest is off: start the agent with -ingest-token-env", http.StatusNotFound)
+			return
+		}
+		if !hasBearer(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or wrong ingest token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBody+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > maxIngestBody {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		sender, _, _ := net.SplitHostPort(r.RemoteAddr)
+		accepted, err := ingest(t, l, sender, data)
+		switch {
+		case errors.Is(err, errRateLimited):
+			http.Error(w, fmt.Sprintf("%d accepted; %v", accepted, err), http.StatusTooManyRequests)
+		case err != nil:
+			http.Error(w, fmt.Sprintf("%d accepted; %v", accepted, err), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// ListenIngest accepts external measurements as JSON datagrams on the UDP
+// address addr and feeds them to t until the returned listener is closed.
+// An empty host in addr listens on 127.0.0.1. With token set, a datagram
+// must start with the line "Bearer <token>"; an address other than a
+// loopback one is refused without it, since a sender's address is easily
+// forged. Datagrams without the token and invalid or rate-limited records
+// are dropped silently.
+func ListenIngest(addr string, t Ingester, token string) (io.Closer, error) {
+	addr, loopback, err := loopbackDefault(addr)
+	if err != nil {
+		return nil, fmt.Errorf("-ingest: %w", err)
+	}
+	if !loopback && token == "" {
+		return nil, fmt.Errorf("-ingest: %s is not a loopback address: set -ingest-token-env", addr)
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	l := newIngestLimiter()
+	go func() {
+		buf := make([]byte, maxIngestBody)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			data, ok := datagramBody(buf[:n], token)
+			if !ok {
+				continue
+			}
+			sender := from.String()
+			if ua, ok := from.(*net.UDPAddr); ok {
+				sender = ua.IP.String()
+			}
+			ingest(t, l, sender, data)
+		}
+	}()
+	return conn, nil
+}
+
+// datagramBody returns the records of a datagram, after the "Bearer
+// <token>" line it must start with when token is set. It reports false
+// when that line is missing or carries another token.
+func datagramBody(data []byte, token string) ([]byte, bool) {
+	if token == "" {
+		return data, true
+	}
+	line, rest, _ := bytes.Cut(data, []byte{'\n'})
+	got, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte{'\r'}), []byte("Bearer "))
+	return rest, ok && subtle.ConstantTimeCompare(got, []byte(token)) == 1
+}
@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// fakeIngester validates records like a tracker and keeps the accepted ones.
+type fakeIngester struct {
+	mu  sync.Mutex
+	t   *tracker.Tracker
+	got []tracker.ExternalRTT
+}
+
+func newFakeIngester() *fakeIngester {
+	return &fakeIngester{t: tracker.NewTracker(time.Hour, false)}
+}
+
+func (f *fakeIngester) IngestRTT(r tracker.ExternalRTT) error {
+	if err := f.t.IngestRTT(r); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.got = append(f.got, r)
+	return nil
+}
+
+func (f *fakeIngester) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.got)
+}
+
+func postIngest(h http.Handler, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, IngestPath, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func records(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, `{"remote":"192.0.2.%d:27015","rtt_ms":23.4,"source":"game"}`+"\n", i%250+1)
+	}
+	return b.String()
+}
+
+func TestIngestToken(t *testing.T) {
+	f := newFakeIngester()
+	tests := []struct {
+		name          string
+		handlerToken  string
+		requestToken  string
+		want, records int
+	}{
+		{"off without a token", "", "", http.StatusNotFound, 0},
+		{"off ignores tokens", "", "s3cret", http.StatusNotFound, 0},
+		{"missing", "s3cret", "", http.StatusUnauthorized, 0},
+		{"wrong", "s3cret", "guess", http.StatusUnauthorized, 0},
+		{"prefix", "s3cret", "s3c", http.StatusUnauthorized, 0},
+		{"right", "s3cret", "s3cret", http.StatusNoContent, 1},
+	}
+	for _, tt := range tests {
+		before := f.count()
+		w := postIngest(ingestHandler(f, tt.handlerToken), tt.requestToken, records(1))
+		if w.Code != tt.want || f.count()-before != tt.records {
+			t.Errorf("%s: status %d with %d records, want %d with %d", tt.name, w.Code, f.count()-before, tt.want, tt.records)
+		}
+	}
+
+	// Only a bearer token counts.
+	req := httptest.NewRequest(http.MethodPost, IngestPath, strings.NewReader(records(1)))
+	req.Header.Set("Authorization", "Basic s3cret")
+	w := httptest.NewRecorder()
+	ingestHandler(f, "s3cret").ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("basic auth: status %d, challenge %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestIngestValidation(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       int
+		accepted   int
+	}{
+		{"one", records(1), http.StatusNoContent, 1},
+		{"batch", records(100), http.StatusNoContent, 100},
+		{"too many", records(101), http.StatusBadRequest, 100},
+		{"zero rtt", `{"remote":"192.0.2.1:1","rtt_ms":0,"source":"game"}`, http.StatusBadRequest, 0},
+		{"huge rtt", `{"remote":"192.0.2.1:1","rtt_ms":60001,"source":"game"}`, http.StatusBadRequest, 0},
+		{"no source", `{"remote":"192.0.2.1:1","rtt_ms":5}`, http.StatusBadRequest, 0},
+		{"bad remote", `{"remote":"nowhere","rtt_ms":5,"source":"game"}`, http.StatusBadRequest, 0},
+		{"unknown field", `{"remote":"192.0.2.1:1","rtt_ms":5,"source":"game","loss":1}`, http.StatusBadRequest, 0},
+		{"syntax", `{"remote":`, http.StatusBadRequest, 0},
+		{"bad then good", `{"remote":"192.0.2.1:1","rtt_ms":-1,"source":"game"}` + "\n" + records(1), http.StatusBadRequest, 1},
+		{"too large", strings.Repeat(" ", maxIngestBody+1), http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tt := range tests {
+		f := newFakeIngester()
+		w := postIngest(ingestHandler(f, "s3cret"), "s3cret", tt.body)
+		if w.Code != tt.want || f.count() != tt.accepted {
+			t.Errorf("%s: status %d with %d accepted, want %d with %d (%s)", tt.name, w.Code, f.count(), tt.want, tt.accepted, w.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, IngestPath, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	ingestHandler(newFakeIngester(), "s3cret").ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", w.Code)
+	}
+}
+
+func TestIngestRateLimit(t *testing.T) {
+	f := newFakeIngester()
+	h := ingestHandler(f, "s3cret")
+	if w := postIngest(h, "s3cret", records(ingestBurst)); w.Code != http.StatusNoContent {
+		t.Fatalf("burst: status %d (%s)", w.Code, w.Body)
+	}
+	w := postIngest(h, "s3cret", records(10))
+	if w.Code != http.StatusTooManyRequests || f.count() > ingestBurst+1 {
+		t.Fatalf("over the burst: status %d with %d accepted", w.Code, f.count())
+	}
+}
+
+func TestIngestLimiter(t *testing.T) {
+	l := newIngestLimiter()
+	now := time.Unix(1000, 0)
+	for i := range ingestBurst {
+		if !l.allow("a", now) {
+			t.Fatalf("record %d of the burst refused", i+1)
+		}
+	}
+	if l.allow("a", now) {
+		t.Fatal("allowed past the burst")
+	}
+	if !l.allow("b", now) {
+		t.Fatal("one sender's burst limited another")
+	}
+	if !l.allow("a", now.Add(time.Second/ingestRate)) {
+		t.Fatal("no token after refilling one")
+	}
+
+	// A full table forgets senders whose buckets have refilled.
+	l = newIngestLimiter()
+	for i := range maxSenders {
+		l.allow(fmt.Sprint(i), now)
+	}
+	if l.allow("new", now) {
+		t.Fatal("sender added to a full table")
+	}
+	if !l.allow("new", now.Add(time.Minute)) || len(l.buckets) != 1 {
+		t.Fatalf("%d buckets after the others refilled", len(l.buckets))
+	}
+}
+
+func TestListenIngest(t *testing.T) {
+	f := newFakeIngester()
+	l, err := ListenIngest("127.0.0.1:0", f, "")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("udp", l.(net.PacketConn).LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte(records(3)))
+	c.Write([]byte(`{"remote":"192.0.2.1:1","rtt_ms":0,"source":"game"}`))
+	deadline := time.Now().Add(2 * time.Second)
+	for f.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if f.count() != 3 {
+		t.Fatalf("%d records from the datagrams, want 3", f.count())
+	}
+}
+
+// TestListenIngestToken checks that with a token, datagrams without it
+// are dropped, and that only a loopback address listens without one.
+func TestListenIngestToken(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:0"} {
+		if l, err := ListenIngest(addr, newFakeIngester(), ""); err == nil || !strings.Contains(err.Error(), "not a loopback address") {
+			if l != nil {
+				l.Close()
+			}
+			t.Errorf("%s without a token: %v", addr, err)
+		}
+	}
+
+	f := newFakeIngester()
+	l, err := ListenIngest(":0", f, "s3cret")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	addr := l.(net.PacketConn).LocalAddr().(*net.UDPAddr)
+	if !addr.IP.IsLoopback() {
+		t.Errorf("a bare port listens on %s", addr)
+	}
+	c, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte(records(2)))
+	c.Write([]byte("Bearer wrong\n" + records(2)))
+	c.Write([]byte("s3cret\n" + records(2)))
+	c.Write([]byte("Bearer s3cret\r\n" + records(1)))
+	deadline := time.Now().Add(2 * time.Second)
+	for f.count() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if f.count() != 1 {
+		t.Fatalf("%d records, want only the one sent with the token", f.count())
+	}
+}
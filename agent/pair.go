@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ping-tracker/flowexport"
+	"ping-tracker/tracker"
+)
+
+// PairPath hands the client certificate to a viewer that knows the
+// pairing code.
+const PairPath = "/pair"
+
+const (
+	// pairFile holds the pending pairing code, written by "agent pair"
+	// and read by the serving agent.
+	pairFile = "agent-pair.json"
+	// PairValidity is how long a pairing code can be used.
+	PairValidity = 10 * time.Minute
+	// maxPairFailures wrong codes end a pairing.
+	maxPairFailures = 5
+	// pairAlphabet leaves out the letters and digits easily mistaken for
+	// one another.
+	pairAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// pairing is the pending pairing in pairFile. Only the code's hash is
+// kept.
+type pairing struct {
+	CodeHash string    `json:"code_hash"`
+	Expires  time.Time `json:"expires"`
+	Failures int       `json:"failures"`
+}
+
+// NewPairing generates the client certificate of the agent in dir if it
+// has none yet, and a one-time code valid for PairValidity with which one
+// viewer can fetch it. It replaces any pending code.
+func NewPairing(dir string) (code string, err error) {
+	if _, err := loadOrCreateClientCert(dir); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = pairAlphabet[int(b)%len(pairAlphabet)]
+	}
+	code = string(buf[:4]) + "-" + string(buf[4:])
+	data, err := json.Marshal(pairing{CodeHash: hashCode(code), Expires: time.Now().Add(PairValidity)})
+	if err != nil {
+		return "", err
+	}
+	return code, writePrivate(filepath.Join(dir, pairFile), data)
+}
+
+// hashCode hashes a pairing code as typed: case, spaces and dashes do not
+// matter.
+func hashCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServerTLS is the agent's TLS setup: its certificate and, once a viewer
+// was paired, the client certificate every request but the health probes
+// must present. Until "agent pair" first runs there is no client
+// certificate to ask for, and any viewer is served: TLS then only keeps
+// the snapshots from being read or changed on the way.
+type ServerTLS struct {
+	dir     string
+	cert    tls.Certificate
+	Created bool // the certificate was generated on this start
+
+	mu        sync.Mutex // serializes pairing
+	clientFP  string     // "" until "agent pair" first ran
+	clientMod time.Time
+}
+
+// LoadServerTLS loads the agent's certificate from dir, generating it on
+// first start.
+func LoadServerTLS(dir string) (*ServerTLS, error) {
+	cert, created, err := LoadOrCreateCert(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerTLS{dir: dir, cert: cert, Created: created}, nil
+}
+
+// Fingerprint is the fingerprint of the agent's certificate, which viewers
+// pin.
+func (s *ServerTLS) Fingerprint() string {
+	return Fingerprint(s.cert.Certificate[0])
+}
+
+// clientFingerprint is the fingerprint of the paired client certificate,
+// "" while there is none. The file is read again when it changes, so
+// pairing does not need a restart.
+func (s *ServerTLS) clientFingerprint() string {
+	path := filepath.Join(s.dir, ClientCertFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !info.ModTime().Equal(s.clientMod) {
+		s.clientFP, s.clientMod = "", info.ModTime()
+		if data, err := os.ReadFile(path); err == nil {
+			if block, _ := pem.Decode(data); block != nil && block.Type == "CERTIFICATE" {
+				s.clientFP = Fingerprint(block.Bytes)
+			}
+		}
+	}
+	return s.clientFP
+}
+
+// Paired reports whether viewers must present the client certificate.
+func (s *ServerTLS) Paired() bool {
+	return s.clientFingerprint() != ""
+}
+
+// handler requires the paired client certificate before next, except on
+// the health probes and PairPath, which it serves. Before the first
+// pairing it passes every request on.
+func (s *ServerTLS) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PairPath:
+			s.pair(w, r)
+			return
+		case HealthzPath, ReadyzPath:
+			next.ServeHTTP(w, r)
+			return
+		}
+		want := s.clientFingerprint()
+		if want != "" && (r.TLS == nil || len(r.TLS.PeerCertificates) == 0 ||
+			Fingerprint(r.TLS.PeerCertificates[0].Raw) != want) {
+			http.Error(w, "client certificate required: pair with \"ping-tracker agent pair\"", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pair answers a pairing request: the client certificate and key for the
+// right code. The code works once; it is dropped once it expires or after
+// maxPairFailures wrong ones.
+func (s *ServerTLS) pair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, err := io.ReadAll(io.LimitReader(r.Body, 64))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, pairFile)
+	var p pairing
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &p)
+	}
+	if err != nil || time.Now().After(p.Expires) {
+		os.Remove(path)
+		http.Error(w, "no pairing code pending: run \"ping-tracker agent pair\" on the agent", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(hashCode(string(code))), []byte(p.CodeHash)) != 1 {
+		p.Failures++
+		if p.Failures >= maxPairFailures {
+			os.Remove(path)
+		} else if data, err := json.Marshal(p); err == nil {
+			writePrivate(path, data)
+		}
+		http.Error(w, "wrong pairing code", http.StatusForbidden)
+		return
+	}
+	os.Remove(path)
+	client, err := os.ReadFile(filepath.Join(s.dir, ClientCertFile))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(client)
+}
+
+// ServeTLS serves t like Serve, over TLS with the certificate in s. An
+// empty host in addr listens on 127.0.0.1; any address other than a
+// loopback one is refused until a viewer was paired or viewerToken is set,
+// since TLS alone lets anyone who reaches the port read the snapshots.
+func ServeTLS(addr string, t *tracker.Tracker, custom *flowexport.Profile, ingestToken, viewerToken string, s *ServerTLS) error {
+	addr, loopback, err := loopbackDefault(addr)
+	if err != nil {
+		return fmt.Errorf("-serve: %w", err)
+	}
+	if !loopback && viewerToken == "" && !s.Paired() {
+		return fmt.Errorf("-serve: %s is not a loopback address: pair a viewer with \"ping-tracker agent pair\" or set -serve-token-env", addr)
+	}
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   s.handler(Handler(t, custom, ingestToken, viewerToken)),
+		TLSConfig: s.config(),
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+// config is the server configuration: the agent's certificate, and a
+// request for the client one.
+func (s *ServerTLS) config() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{s.cert},
+		// The paired certificate is self-signed; handler checks its
+		// fingerprint.
+		ClientAuth: tls.RequestClientCert,
+	}
+}
+
+// Pair fetches the client certificate from the agent at host with the
+// code "agent pair" printed there, and keeps it in pins for the
+// connections that follow. The agent's certificate is pinned on the way,
+// if it was not yet; fingerprint is the one pinned.
+func Pair(host, code string, pins *Pins) (fingerprint string, err error) {
+	client := &http.Client{Timeout: fetchTimeout, Transport: &http.Transport{TLSClientConfig: pins.TLSConfig(host)}}
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+PairPath, strings.NewReader(code))
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s: %s", host, resp.Status, bytes.TrimSpace(body))
+	}
+	if _, err := tls.X509KeyPair(body, body); err != nil {
+		return "", errors.New(host + ": the agent sent no usable client certificate")
+	}
+	return pins.Fingerprint(host), pins.setClient(host, body)
+}
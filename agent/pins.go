@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertChangedError is the error of a connection to an agent whose
+// certificate is not the one pinned on first connect.
+type CertChangedError struct {
+	Host        string
+	Pinned, Got string
+}
+
+func (e *CertChangedError) Error() string {
+	return fmt.Sprintf("%s: certificate changed (pinned %s, got %s); if the agent's certificate was replaced, connect once with -accept-new-cert",
+		e.Host, e.Pinned, e.Got)
+}
+
+// pin is what a viewer keeps about one agent: the certificate fingerprint
+// trusted on first connect, and the client certificate from pairing.
+type pin struct {
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+	Client      string    `json:"client,omitempty"` // PEM certificate and key
+}
+
+// Pins are the agent certificates a viewer trusts, by host:port: the first
+// one each agent presented (trust on first use). It is safe for concurrent
+// use.
+type Pins struct {
+	path      string
+	acceptNew bool
+
+	mu    sync.Mutex
+	hosts map[string]*pin
+}
+
+// OpenPins loads the pins at path; a missing file is an empty set. With
+// acceptNew, a changed certificate replaces the pinned one instead of
+// failing the connection.
+func OpenPins(path string, acceptNew bool) (*Pins, error) {
+	p := &Pins{path: path, acceptNew: acceptNew, hosts: make(map[string]*pin)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p.hosts); err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Fingerprint returns the pinned fingerprint of host, "" when none is.
+func (p *Pins) Fingerprint(host string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e := p.hosts[host]; e != nil {
+		return e.Fingerprint
+	}
+	return ""
+}
+
+// check verifies the certificate host presented against its pin, pinning
+// it when host has none, or when it changed and acceptNew is set.
+func (p *Pins) check(host string, der []byte) error {
+	fp := Fingerprint(der)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.hosts[host]
+	switch {
+	case e != nil && e.Fingerprint == fp:
+		return nil
+	case e != nil && !p.acceptNew:
+		return &CertChangedError{Host: host, Pinned: e.Fingerprint, Got: fp}
+	case e != nil:
+		// A new certificate means a reinstalled agent: its pairing is gone too.
+		e.Fingerprint, e.FirstSeen, e.Client = fp, time.Now(), ""
+	default:
+		p.hosts[host] = &pin{Fingerprint: fp, FirstSeen: time.Now()}
+	}
+	return p.save()
+}
+
+// setClient stores the client certificate host handed over when pairing.
+func (p *Pins) setClient(host string, pemData []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.hosts[host]
+	if e == nil {
+		return fmt.Errorf("%s: no pinned certificate", host)
+	}
+	e.Client = string(pemData)
+	return p.save()
+}
+
+// client returns the client certificate paired with host, if any.
+func (p *Pins) client(host string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	e := p.hosts[host]
+	p.mu.Unlock()
+	if e == nil || e.Client == "" {
+		return &tls.Certificate{}, nil // no certificate: the agent refuses us if it wants one
+	}
+	cert, err := tls.X509KeyPair([]byte(e.Client), []byte(e.Client))
+	if err != nil {
+		return nil, fmt.Errorf("%s: client certificate: %w", host, err)
+	}
+	return &cert, nil
+}
+
+// TLSConfig is the client configuration for connecting to host: the
+// agent's self-signed certificate is checked against the pin instead of a
+// CA, and the paired client certificate, if any, is presented.
+func (p *Pins) TLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // verified by VerifyPeerCertificate against the pin
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 {
+				return fmt.Errorf("%s: no certificate", host)
+			}
+			return p.check(host, raw[0])
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return p.client(host)
+		},
+	}
+}
+
+// save writes the pins. Caller must hold the lock.
+func (p *Pins) save() error {
+	data, err := json.MarshalIndent(p.hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivate(p.path, data)
+}
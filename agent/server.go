@@ -0,0 +1,353 @@
+// Package agent exposes a tracker over HTTP and merges snapshots from
+// several remote agents into one view.
+package agent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"ping-tracker/flowexport"
+	"ping-tracker/tracker"
+)
+
+// SnapshotPath is the endpoint serving the tracker's current connections as JSON.
+const SnapshotPath = "/snapshot"
+
+// ChangesPath serves what changed in the connections since the scan a
+// client has, ?since=CURSOR, as JSON (see tracker.Changes). It answers 404
+// unless the tracker keeps a change journal.
+const ChangesPath = "/changes"
+
+// MetricsPath serves the tracker's cache sizes in the Prometheus text format.
+const MetricsPath = "/metrics"
+
+// HealthzPath is the liveness probe: 200 while scans keep completing, 503
+// once none has for three scan intervals.
+const HealthzPath = "/healthz"
+
+// ReadyzPath is the readiness probe: 503 until the first scan completes.
+const ReadyzPath = "/readyz"
+
+// OverflowPath serves the per-app and per-state counts of the sockets the
+// last scan found beyond -max-connections, as JSON.
+const OverflowPath = "/overflow"
+
+// ProbeTrafficPath serves the bytes probes sent and received this session
+// and today, and the daily budget's state, as JSON.
+const ProbeTrafficPath = "/probe-traffic"
+
+// Handler returns an http.Handler serving t's snapshots and metrics, and
+// accepting external latency measurements on IngestPath from requests that
+// carry ingestToken; with an empty ingestToken IngestPath is off. With
+// viewerToken set, the other paths but the health probes answer only
+// requests carrying it as a bearer token. custom is the -export-profile
+// mapping file, if any, served as ?profile=custom.
+func Handler(t *tracker.Tracker, custom *flowexport.Profile, ingestToken, viewerToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(SnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if name := r.URL.Query().Get("profile"); name != "" {
+			p := flowexport.FindProfile(name)
+			if p == nil && custom != nil && name == custom.Name {
+				p = custom
+			}
+			if p == nil {
+				http.Error(w, fmt.Sprintf("unknown profile %q", name), http.StatusBadRequest)
+				return
+			}
+			snap := getSnapshot(t)
+			defer putSnapshot(snap)
+			writeRecords(w, p, r.URL.Query().Get("format"), *snap)
+			return
+		}
+		snap := getSnapshot(t)
+		defer putSnapshot(snap)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(*snap)
+	})
+	mux.HandleFunc(ChangesPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		j := t.ChangeJournal()
+		if j == nil {
+			http.Error(w, "change journal is off", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j.Since(r.URL.Query().Get("since")))
+	})
+	mux.HandleFunc(MetricsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, t)
+	})
+	mux.HandleFunc(HealthzPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, t.Health(), time.Now(), false)
+	})
+	mux.HandleFunc(ReadyzPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, t.Health(), time.Now(), true)
+	})
+	mux.HandleFunc(OverflowPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Overflow())
+	})
+	mux.HandleFunc(ProbeTrafficPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.ProbeUsage())
+	})
+	mux.HandleFunc(IngestPath, ingestHandler(t, ingestToken))
+	if viewerToken == "" {
+		return mux
+	}
+	return requireToken(mux, viewerToken)
+}
+
+// requireToken passes on the requests carrying token as a bearer token,
+// and those to the health probes and to IngestPath, which checks its own.
+func requireToken(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case HealthzPath, ReadyzPath, IngestPath:
+		default:
+			if !hasBearer(r, token) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "missing or wrong viewer token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasBearer reports whether r carries token as its bearer token. The
+// comparison takes the same time wherever the two differ.
+func hasBearer(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// loopbackDefault returns addr with 127.0.0.1 for an empty host, and
+// whether its host is a loopback address.
+func loopbackDefault(addr string) (string, bool, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", false, err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	ip := net.ParseIP(host)
+	return net.JoinHostPort(host, port), host == "localhost" || ip != nil && ip.IsLoopback(), nil
+}
+
+// Serve listens on addr and serves t until the listener fails. An empty
+// host in addr listens on 127.0.0.1, and any address other than a loopback
+// one is refused without a viewerToken: plain HTTP hands the snapshots to
+// whoever asks.
+func Serve(addr string, t *tracker.Tracker, custom *flowexport.Profile, ingestToken, viewerToken string) error {
+	addr, loopback, err := loopbackDefault(addr)
+	if err != nil {
+		return fmt.Errorf("-serve: %w", err)
+	}
+	if !loopback && viewerToken == "" {
+		return fmt.Errorf("-serve: %s is not a loopback address: set -serve-token-env, or add -tls and pair a viewer", addr)
+	}
+	return http.ListenAndServe(addr, Handler(t, custom, ingestToken, viewerToken))
+}
+
+// writeRecords writes a snapshot as flow records named by p: a JSON array,
+// or CSV with a header row when format is "csv". Each record covers the
+// connection from when it was first seen to its last scan.
+func writeRecords(w http.ResponseWriter, p *flowexport.Profile, format string, snap []*tracker.Connection) {
+	records := make([]flowexport.Record, len(snap))
+	for i, c := range snap {
+		records[i] = flowexport.NewRecord(*c, c.FirstSeen, c.LastUpdated)
+	}
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		p.WriteCSV(w, records)
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte{'['})
+		for i, r := range records {
+			if i > 0 {
+				w.Write([]byte{','})
+			}
+			data, _ := p.MarshalRecord(r)
+			w.Write(data)
+		}
+		w.Write([]byte("]\n"))
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q (want json or csv)", format), http.StatusBadRequest)
+	}
+}
+
+// snapshots holds the buffers /snapshot copies the connections into, so
+// polling agents do not allocate a fresh copy of every connection per
+// request.
+var snapshots = sync.Pool{New: func() any { return new([]*tracker.Connection) }}
+
+// getSnapshot takes t's connections into a pooled buffer; hand it back
+// with putSnapshot once the response is written.
+func getSnapshot(t *tracker.Tracker) *[]*tracker.Connection {
+	buf := snapshots.Get().(*[]*tracker.Connection)
+	*buf = t.SnapshotInto(*buf)
+	return buf
+}
+
+func putSnapshot(buf *[]*tracker.Connection) {
+	snapshots.Put(buf)
+}
+
+// healthStatus is the JSON body of /healthz and /readyz.
+type healthStatus struct {
+	Status     string    `json:"status"` // ok, stalled, ready or starting
+	LastScan   time.Time `json:"last_scan,omitzero"`
+	SinceScan  string    `json:"since_scan"`
+	Interval   string    `json:"interval"`
+	ScanErrors uint64    `json:"scan_errors"`
+	LastError  string    `json:"last_error,omitempty"`
+
+	// Cycles outlasting the interval, the ticks they dropped, and the
+	// resulting time between scans
+	Overruns          uint64 `json:"overruns"`
+	SkippedTicks      uint64 `json:"skipped_ticks"`
+	EffectiveInterval string `json:"effective_interval,omitempty"`
+
+	// Alert notifications dropped by the rate limit or not delivered, and
+	// the last delivery error
+	NotifyDropped   uint64 `json:"notify_dropped,omitempty"`
+	NotifyFailures  uint64 `json:"notify_failures,omitempty"`
+	NotifyLastError string `json:"notify_last_error,omitempty"`
+}
+
+// writeHealth answers a liveness probe, or with ready set a readiness
+// probe, from h.
+func writeHealth(w http.ResponseWriter, h tracker.Health, now time.Time, ready bool) {
+	since, stalled := h.Stalled(now)
+	st := healthStatus{
+		LastScan:   h.LastScan,
+		SinceScan:  since.Round(time.Millisecond).String(),
+		Interval:   h.Interval.String(),
+		ScanErrors: h.Errors,
+		LastError:  h.LastError,
+
+		Overruns:     h.Overruns,
+		SkippedTicks: h.SkippedTicks,
+
+		NotifyDropped:   h.NotifyDropped,
+		NotifyFailures:  h.NotifyFailures,
+		NotifyLastError: h.NotifyLastError,
+	}
+	if h.EffectiveInterval > 0 {
+		st.EffectiveInterval = h.EffectiveInterval.Round(time.Millisecond).String()
+	}
+	code := http.StatusOK
+	switch {
+	case ready && h.Ready():
+		st.Status = "ready"
+	case ready:
+		st.Status, code = "starting", http.StatusServiceUnavailable
+	case stalled:
+		st.Status, code = "stalled", http.StatusServiceUnavailable
+	default:
+		st.Status = "ok"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(st)
+}
+
+// writeMetrics writes the entry count and cap of every tracked structure,
+// plus the Go heap size.
+func writeMetrics(w http.ResponseWriter, t *tracker.Tracker) {
+	entries := t.MemStats()
+	fmt.Fprintln(w, "# HELP ping_tracker_entries Entries held by an in-memory structure.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_entries gauge")
+	for _, e := range entries {
+		fmt.Fprintf(w, "ping_tracker_entries{structure=%q} %d\n", e.Name, e.Count)
+	}
+	fmt.Fprintln(w, "# HELP ping_tracker_entries_cap Maximum entries of a capped structure.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_entries_cap gauge")
+	for _, e := range entries {
+		if e.Cap > 0 {
+			fmt.Fprintf(w, "ping_tracker_entries_cap{structure=%q} %d\n", e.Name, e.Cap)
+		}
+	}
+	fmt.Fprintln(w, "# HELP ping_tracker_heap_bytes Go heap in use.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_heap_bytes gauge")
+	fmt.Fprintf(w, "ping_tracker_heap_bytes %d\n", tracker.HeapBytes())
+	fmt.Fprintln(w, "# HELP ping_tracker_goroutines Goroutines running.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_goroutines gauge")
+	fmt.Fprintf(w, "ping_tracker_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintln(w, "# HELP ping_tracker_connections Connections tracked.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_connections gauge")
+	fmt.Fprintf(w, "ping_tracker_connections %d\n", entries[0].Count) // MemStats lists connections first
+	fmt.Fprintln(w, "# HELP ping_tracker_connections_overflow Sockets of the last scan beyond -max-connections, not tracked.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_connections_overflow gauge")
+	fmt.Fprintf(w, "ping_tracker_connections_overflow %d\n", t.Overflow().Conns)
+
+	h := t.Health()
+	fmt.Fprintln(w, "# HELP ping_tracker_scan_duration_seconds Time per scan cycle, pings included.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_scan_duration_seconds histogram")
+	for i, le := range tracker.ScanDurationBuckets {
+		fmt.Fprintf(w, "ping_tracker_scan_duration_seconds_bucket{le=\"%g\"} %d\n", le.Seconds(), h.DurationBuckets[i])
+	}
+	fmt.Fprintf(w, "ping_tracker_scan_duration_seconds_bucket{le=\"+Inf\"} %d\n", h.Scans)
+	fmt.Fprintf(w, "ping_tracker_scan_duration_seconds_sum %g\n", h.DurationSum.Seconds())
+	fmt.Fprintf(w, "ping_tracker_scan_duration_seconds_count %d\n", h.Scans)
+	fmt.Fprintln(w, "# HELP ping_tracker_scan_errors_total Scans that could not read the socket tables.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_scan_errors_total counter")
+	fmt.Fprintf(w, "ping_tracker_scan_errors_total %d\n", h.Errors)
+	fmt.Fprintln(w, "# HELP ping_tracker_scan_overruns_total Scan cycles that took longer than the interval.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_scan_overruns_total counter")
+	fmt.Fprintf(w, "ping_tracker_scan_overruns_total %d\n", h.Overruns)
+	fmt.Fprintln(w, "# HELP ping_tracker_scan_skipped_ticks_total Scan ticks dropped while a cycle overran.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_scan_skipped_ticks_total counter")
+	fmt.Fprintf(w, "ping_tracker_scan_skipped_ticks_total %d\n", h.SkippedTicks)
+	fmt.Fprintln(w, "# HELP ping_tracker_probes_total Ping probes by outcome.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_probes_total counter")
+	for _, o := range []string{tracker.ProbeOK, tracker.ProbeLossy, tracker.ProbeFailed} {
+		fmt.Fprintf(w, "ping_tracker_probes_total{outcome=%q} %d\n", o, h.Probes[o])
+	}
+
+	u := t.ProbeUsage()
+	fmt.Fprintln(w, "# HELP ping_tracker_probe_bytes_total Estimated probe traffic this session, IP headers included.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_probe_bytes_total counter")
+	fmt.Fprintf(w, "ping_tracker_probe_bytes_total{direction=\"sent\"} %d\n", u.Session.Sent)
+	fmt.Fprintf(w, "ping_tracker_probe_bytes_total{direction=\"received\"} %d\n", u.Session.Received)
+	fmt.Fprintln(w, "# HELP ping_tracker_probe_bytes_today Estimated probe traffic since local midnight.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_probe_bytes_today gauge")
+	fmt.Fprintf(w, "ping_tracker_probe_bytes_today{direction=\"sent\"} %d\n", u.Today.Sent)
+	fmt.Fprintf(w, "ping_tracker_probe_bytes_today{direction=\"received\"} %d\n", u.Today.Received)
+	fmt.Fprintln(w, "# HELP ping_tracker_probe_budget_bytes Daily probe traffic budget (0 = none).")
+	fmt.Fprintln(w, "# TYPE ping_tracker_probe_budget_bytes gauge")
+	fmt.Fprintf(w, "ping_tracker_probe_budget_bytes %d\n", u.Budget)
+	exceeded := 0
+	if u.Exceeded {
+		exceeded = 1
+	}
+	fmt.Fprintln(w, "# HELP ping_tracker_probe_budget_exceeded 1 while active probes are off for the rest of the day.")
+	fmt.Fprintln(w, "# TYPE ping_tracker_probe_budget_exceeded gauge")
+	fmt.Fprintf(w, "ping_tracker_probe_budget_exceeded %d\n", exceeded)
+}
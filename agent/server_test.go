@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/flowexport"
+	"ping-tracker/tracker"
+)
+
+func TestSnapshotProfile(t *testing.T) {
+	custom, err := flowexport.NewProfile("custom", map[string]string{"src_addr": "source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(tracker.NewTracker(time.Hour, false), custom, "", "")
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"?profile=ntopng&format=csv", http.StatusOK, "PROTOCOL,IPV4_SRC_ADDR,L4_SRC_PORT"},
+		{"?profile=wireshark&format=csv", http.StatusOK, "ip.proto,ip.src,tcp.srcport"},
+		{"?profile=custom&format=csv", http.StatusOK, "protocol,source,src_port"},
+		{"?profile=netflow", http.StatusBadRequest, `unknown profile "netflow"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, SnapshotPath+tt.query, nil))
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: status %d, body %q", tt.query, w.Code, w.Body)
+		}
+	}
+}
+
+func TestChanges(t *testing.T) {
+	tr := tracker.NewTracker(time.Hour, false)
+	get := func(method, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		Handler(tr, nil, "", "").ServeHTTP(w, httptest.NewRequest(method, ChangesPath+query, nil))
+		return w
+	}
+	if w := get(http.MethodGet, ""); w.Code != http.StatusNotFound {
+		t.Errorf("without a journal: status %d", w.Code)
+	}
+
+	j := tracker.NewChangeJournal(10)
+	tr.SetChangeJournal(j)
+	a := &tracker.Connection{AppName: "web", Protocol: "tcp", RemoteAddr: "192.0.2.1", RemotePort: 443}
+	b := &tracker.Connection{AppName: "db", Protocol: "tcp", RemoteAddr: "192.0.2.2", RemotePort: 5432}
+	j.Record([]*tracker.Connection{a, b})
+	if w := get(http.MethodPost, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", w.Code)
+	}
+	decode := func(w *httptest.ResponseRecorder) tracker.Changes {
+		t.Helper()
+		var ch tracker.Changes
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("status %d, %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &ch); err != nil {
+			t.Fatal(err)
+		}
+		return ch
+	}
+	first := decode(get(http.MethodGet, ""))
+	if !first.Full || len(first.Added) != 2 {
+		t.Fatalf("first poll: %+v", first)
+	}
+
+	a2 := *a
+	a2.Ping = 20 * time.Millisecond
+	j.Record([]*tracker.Connection{&a2})
+	next := decode(get(http.MethodGet, "?since="+first.Cursor))
+	if next.Full || len(next.Added) != 0 || !slices.Equal(next.Removed, []string{b.Key()}) || string(next.Changed[a.Key()]["Ping"]) != "20000000" {
+		t.Errorf("delta %+v", next)
+	}
+	state := next.Apply(first.Apply(nil))
+	if len(state) != 1 || string(state[a.Key()]["Ping"]) != "20000000" {
+		t.Errorf("client state %v", state)
+	}
+}
+
+// TestServeLoopback checks that a plain HTTP agent without a viewer token
+// refuses to listen beyond the loopback interface.
+func TestServeLoopback(t *testing.T) {
+	tr := tracker.NewTracker(time.Hour, false)
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:0", "7777"} {
+		if err := Serve(addr, tr, nil, "", ""); err == nil {
+			t.Errorf("%s: served", addr)
+		} else if addr != "7777" && !strings.Contains(err.Error(), "not a loopback address") {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+}
+
+func TestViewerToken(t *testing.T) {
+	h := Handler(tracker.NewTracker(time.Hour, false), nil, "", "s3cret")
+	for _, tt := range []struct {
+		path, auth string
+		status     int
+	}{
+		{SnapshotPath, "", http.StatusUnauthorized},
+		{SnapshotPath, "Bearer wrong", http.StatusUnauthorized},
+		{SnapshotPath, "s3cret", http.StatusUnauthorized},
+		{SnapshotPath, "Bearer s3cret", http.StatusOK},
+		{MetricsPath, "", http.StatusUnauthorized},
+		{OverflowPath, "Bearer s3cret", http.StatusOK},
+		{HealthzPath, "", http.StatusOK},
+		{ReadyzPath, "", http.StatusServiceUnavailable}, // no scan yet, but not refused
+		{IngestPath, "", http.StatusNotFound},           // ingest is off without its own token
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s %q: %d, want %d", tt.path, tt.auth, w.Code, tt.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.path)
+		}
+	}
+}
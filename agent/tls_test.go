@@ -0,0 +1,319 @@
+package agent
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// tlsAgent serves conns over TLS with the certificate and pairing state in
+// dir, as ServeTLS does.
+func tlsAgent(t *testing.T, dir string, conns ...*tracker.Connection) (*httptest.Server, *ServerTLS) {
+	t.Helper()
+	s, err := LoadServerTLS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeAgent(t, conns...)
+	srv := httptest.NewUnstartedServer(s.handler(fake.Config.Handler))
+	srv.TLS = s.config()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+func tlsHost(srv *httptest.Server) string {
+	return strings.TrimPrefix(srv.URL, "https://")
+}
+
+// fetchTLS fetches a snapshot from host once, checking against pins.
+func fetchTLS(host string, pins *Pins) ([]*tracker.Connection, error) {
+	m := NewMulti([]string{host}, time.Hour)
+	m.UseTLS(pins)
+	return m.fetch(m.sources[0])
+}
+
+func TestLoadOrCreateCert(t *testing.T) {
+	dir := t.TempDir()
+	cert, created, err := LoadOrCreateCert(dir)
+	if err != nil || !created {
+		t.Fatalf("first start: created %v, %v", created, err)
+	}
+	for _, name := range []string{CertFile, KeyFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s mode %v", name, info.Mode().Perm())
+		}
+	}
+	x, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth || x.NotAfter.Before(time.Now().Add(365*24*time.Hour)) {
+		t.Errorf("usage %v, valid until %s", x.ExtKeyUsage, x.NotAfter)
+	}
+
+	again, created, err := LoadOrCreateCert(dir)
+	if err != nil || created || Fingerprint(again.Certificate[0]) != Fingerprint(cert.Certificate[0]) {
+		t.Errorf("second start: created %v, %v, same %v", created, err,
+			Fingerprint(again.Certificate[0]) == Fingerprint(cert.Certificate[0]))
+	}
+
+	// A damaged certificate is an error, not replaced: viewers pinned it.
+	os.WriteFile(filepath.Join(dir, CertFile), []byte("garbage"), 0o600)
+	if _, _, err := LoadOrCreateCert(dir); err == nil {
+		t.Error("no error for a damaged certificate")
+	}
+}
+
+func TestPins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PinsFile)
+	pins, err := OpenPins(path, false)
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	first, second := []byte("certificate one"), []byte("certificate two")
+	if err := pins.check("agent:7777", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.setClient("agent:7777", []byte("client pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.setClient("other:7777", []byte("client pem")); err == nil {
+		t.Error("paired with an agent never connected to")
+	}
+
+	// The pin is kept across runs.
+	pins, err = OpenPins(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pins.Fingerprint("agent:7777"); got != Fingerprint(first) {
+		t.Errorf("reloaded pin %q", got)
+	}
+	if err := pins.check("agent:7777", first); err != nil {
+		t.Errorf("same certificate: %v", err)
+	}
+	var changed *CertChangedError
+	if err := pins.check("agent:7777", second); !errors.As(err, &changed) || changed.Got != Fingerprint(second) {
+		t.Errorf("changed certificate: %v", err)
+	}
+	if err := pins.check("agent:8888", second); err != nil {
+		t.Errorf("pins are per host:port: %v", err)
+	}
+
+	// -accept-new-cert pins the new one and forgets the pairing.
+	pins, _ = OpenPins(path, true)
+	if err := pins.check("agent:7777", second); err != nil {
+		t.Fatal(err)
+	}
+	pins, _ = OpenPins(path, false)
+	if pins.Fingerprint("agent:7777") != Fingerprint(second) || pins.hosts["agent:7777"].Client != "" {
+		t.Errorf("after accepting: %+v", pins.hosts["agent:7777"])
+	}
+
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := OpenPins(path, false); err == nil {
+		t.Error("no error for a damaged pins file")
+	}
+}
+
+// TestTLSFirstUse connects to in-process agents: the first certificate is
+// pinned, a replaced one refused unless accepted.
+func TestTLSFirstUse(t *testing.T) {
+	srv, s := tlsAgent(t, t.TempDir(), &tracker.Connection{AppName: "web"})
+	pins, _ := OpenPins(filepath.Join(t.TempDir(), PinsFile), false)
+	conns, err := fetchTLS(tlsHost(srv), pins)
+	if err != nil || len(conns) != 1 || conns[0].AppName != "web" {
+		t.Fatalf("first connect: %v, %v", conns, err)
+	}
+	if pins.Fingerprint(tlsHost(srv)) != s.Fingerprint() {
+		t.Errorf("pinned %q, agent %q", pins.Fingerprint(tlsHost(srv)), s.Fingerprint())
+	}
+
+	// The agent is reinstalled: a new certificate on the same address.
+	srv.Close()
+	other, _ := tlsAgent(t, t.TempDir())
+	pins.hosts[tlsHost(other)] = pins.hosts[tlsHost(srv)]
+	var changed *CertChangedError
+	if _, err := fetchTLS(tlsHost(other), pins); !errors.As(err, &changed) {
+		t.Fatalf("replaced certificate: %v", err)
+	}
+	pins.acceptNew = true
+	if _, err := fetchTLS(tlsHost(other), pins); err != nil {
+		t.Errorf("accepting the new certificate: %v", err)
+	}
+
+	// Plain HTTP to a TLS agent fails the handshake, not silently.
+	m := NewMulti([]string{tlsHost(other)}, time.Hour)
+	if _, err := m.fetch(m.sources[0]); err == nil {
+		t.Error("plain HTTP to a TLS agent succeeded")
+	}
+}
+
+// TestTLSPairing pairs a viewer with an agent and checks the client
+// certificate is required from then on, and that an agent never paired
+// serves anyone.
+func TestTLSPairing(t *testing.T) {
+	dir := t.TempDir()
+	srv, s := tlsAgent(t, dir, &tracker.Connection{AppName: "web"})
+	host := tlsHost(srv)
+	pins, _ := OpenPins(filepath.Join(t.TempDir(), PinsFile), false)
+	if _, err := fetchTLS(host, pins); err != nil || s.Paired() {
+		t.Fatalf("before pairing: paired %v, %v", s.Paired(), err)
+	}
+
+	code, err := NewPairing(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Paired() {
+		t.Fatal("the running agent did not pick up the pairing")
+	}
+	if _, err := fetchTLS(host, pins); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("without the client certificate: %v", err)
+	}
+	for _, path := range []string{HealthzPath, ReadyzPath} {
+		resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: pins.TLSConfig(host)}}).Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			t.Errorf("%s refused without the client certificate", path)
+		}
+	}
+
+	if _, err := Pair(host, "AAAA-AAAA", pins); err == nil || !strings.Contains(err.Error(), "wrong pairing code") {
+		t.Errorf("wrong code: %v", err)
+	}
+	fp, err := Pair(host, strings.ToLower(code), pins)
+	if err != nil || fp != s.Fingerprint() {
+		t.Fatalf("pairing: %q, %v", fp, err)
+	}
+	if conns, err := fetchTLS(host, pins); err != nil || len(conns) != 1 {
+		t.Errorf("paired: %v, %v", conns, err)
+	}
+	if _, err := Pair(host, code, pins); err == nil || !strings.Contains(err.Error(), "no pairing code pending") {
+		t.Errorf("code used twice: %v", err)
+	}
+
+	// Another viewer's certificate is not the paired one.
+	stranger, _ := OpenPins(filepath.Join(t.TempDir(), PinsFile), false)
+	certPEM, keyPEM, err := newCert("ping-tracker viewer", x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger.hosts[host] = &pin{Fingerprint: s.Fingerprint(), Client: string(certPEM) + string(keyPEM)}
+	if _, err := fetchTLS(host, stranger); err == nil {
+		t.Error("served a viewer that did not pair")
+	}
+}
+
+func TestPairingVoided(t *testing.T) {
+	dir := t.TempDir()
+	srv, _ := tlsAgent(t, dir)
+	host := tlsHost(srv)
+	pins, _ := OpenPins(filepath.Join(t.TempDir(), PinsFile), false)
+	code, err := NewPairing(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range maxPairFailures {
+		Pair(host, "AAAA-AAAA", pins)
+	}
+	if _, err := Pair(host, code, pins); err == nil || !strings.Contains(err.Error(), "no pairing code pending") {
+		t.Errorf("right code after %d wrong ones: %v", maxPairFailures, err)
+	}
+
+	// An expired code is refused too.
+	code, _ = NewPairing(dir)
+	data, _ := os.ReadFile(filepath.Join(dir, pairFile))
+	os.WriteFile(filepath.Join(dir, pairFile), []byte(strings.Replace(string(data), `"expires":"2`, `"expires":"1`, 1)), 0o600)
+	if _, err := Pair(host, code, pins); err == nil || !strings.Contains(err.Error(), "no pairing code pending") {
+		t.Errorf("expired code: %v", err)
+	}
+}
+
+// TestTLSViewerToken serves a tracker over TLS with a viewer token: a
+// viewer without it is refused on every path but the health probes.
+func TestTLSViewerToken(t *testing.T) {
+	s, err := LoadServerTLS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(s.handler(Handler(tracker.NewTracker(time.Hour, false), nil, "", "s3cret")))
+	srv.TLS = s.config()
+	srv.StartTLS()
+	defer srv.Close()
+	host := tlsHost(srv)
+	pins, _ := OpenPins(filepath.Join(t.TempDir(), PinsFile), false)
+
+	if _, err := fetchTLS(host, pins); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("without the token: %v", err)
+	}
+	m := NewMulti([]string{host}, time.Hour)
+	m.UseTLS(pins)
+	m.UseToken("wrong")
+	if _, err := m.fetch(m.sources[0]); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong token: %v", err)
+	}
+	m.UseToken("s3cret")
+	if _, err := m.fetch(m.sources[0]); err != nil {
+		t.Errorf("with the token: %v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: pins.TLSConfig(host)}}
+	for path, open := range map[string]bool{HealthzPath: true, ReadyzPath: true, MetricsPath: false, ChangesPath: false} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if refused := resp.StatusCode == http.StatusUnauthorized; refused == open {
+			t.Errorf("%s without the token: %s", path, resp.Status)
+		}
+	}
+}
+
+// TestServeTLSLoopback checks that an agent neither paired nor given a
+// viewer token refuses to listen beyond the loopback interface.
+func TestServeTLSLoopback(t *testing.T) {
+	s, err := LoadServerTLS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tracker.NewTracker(time.Hour, false)
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:0", "agent.example.com:0"} {
+		if err := ServeTLS(addr, tr, nil, "", "", s); err == nil || !strings.Contains(err.Error(), "not a loopback address") {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		addr, want string
+		loopback   bool
+	}{
+		{":7777", "127.0.0.1:7777", true},
+		{"localhost:7777", "localhost:7777", true},
+		{"[::1]:7777", "[::1]:7777", true},
+		{"127.0.0.2:7777", "127.0.0.2:7777", true},
+		{"0.0.0.0:7777", "0.0.0.0:7777", false},
+	} {
+		got, loopback, err := loopbackDefault(tt.addr)
+		if err != nil || got != tt.want || loopback != tt.loopback {
+			t.Errorf("loopbackDefault(%q) = %q, %v, %v", tt.addr, got, loopback, err)
+		}
+	}
+}
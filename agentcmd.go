@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ping-tracker/agent"
+	"ping-tracker/config"
+)
+
+// runAgentCommand runs "ping-tracker agent <command>" and returns the exit
+// code. The only command is pair.
+func runAgentCommand(args []string) int {
+	if len(args) != 1 || args[0] != "pair" {
+		fmt.Fprintln(os.Stderr, "usage: ping-tracker agent pair")
+		return 2
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	s, err := agent.LoadServerTLS(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: agent certificate: %v\n", err)
+		return 1
+	}
+	code, err := agent.NewPairing(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Pairing code: %s (valid once, for %s)\n", code, agent.PairValidity)
+	fmt.Printf("Agent certificate: %s\n", s.Fingerprint())
+	fmt.Println("On the viewer, run: ping-tracker -tls -connect <this host>:<port> -pair " + code)
+	fmt.Println("and check that it pins the certificate above. From then on, this agent's -serve -tls")
+	fmt.Println("only answers viewers that paired.")
+	return 0
+}
+
+// serveTLS loads or generates the agent's certificate and says what
+// viewers will pin.
+func serveTLS() (*agent.ServerTLS, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	s, err := agent.LoadServerTLS(dir)
+	if err != nil {
+		return nil, fmt.Errorf("agent certificate: %w", err)
+	}
+	if s.Created {
+		fmt.Fprintf(os.Stderr, "Generated a self-signed certificate in %s\n", filepath.Join(dir, agent.CertFile))
+	}
+	fmt.Fprintf(os.Stderr, "Certificate fingerprint: %s\n", s.Fingerprint())
+	if s.Paired() {
+		fmt.Fprintln(os.Stderr, "Viewers must present the paired client certificate")
+	} else {
+		fmt.Fprintln(os.Stderr, "Any viewer is served: run \"ping-tracker agent pair\" to require a client certificate")
+	}
+	return s, nil
+}
+
+// connectTLS opens the viewer's pinned agent certificates and, with a
+// pairing code, pairs with the one agent given.
+func connectTLS(hosts []string, acceptNew bool, code string) (*agent.Pins, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := agent.OpenPins(filepath.Join(dir, agent.PinsFile), acceptNew)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return pins, nil
+	}
+	if len(hosts) != 1 {
+		return nil, fmt.Errorf("-pair: give exactly one -connect, the agent to pair with")
+	}
+	fp, err := agent.Pair(hosts[0], code, pins)
+	if err != nil {
+		return nil, fmt.Errorf("pairing with %s: %w", hosts[0], err)
+	}
+	fmt.Fprintf(os.Stderr, "Paired with %s, certificate %s\n", hosts[0], fp)
+	return pins, nil
+}
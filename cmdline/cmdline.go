@@ -0,0 +1,84 @@
+// Package cmdline builds the argv of the commands ping-tracker runs for
+// the user: open_cmd and trigger commands. A command line is split into
+// words once, when it is configured, and run directly, never through a
+// shell; each {placeholder} is filled in inside its own word, so a value
+// cannot add words, whatever characters it contains.
+package cmdline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var placeholderRe = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// Parse splits s into an argv template (see Split) and checks that every
+// placeholder in it is one known accepts.
+func Parse(s string, known func(name string) bool) ([]string, error) {
+	argv, err := Split(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("empty command")
+	}
+	for _, arg := range argv {
+		for _, p := range placeholderRe.FindAllString(arg, -1) {
+			if !known(strings.Trim(p, "{}")) {
+				return nil, fmt.Errorf("unknown placeholder %s", p)
+			}
+		}
+	}
+	return argv, nil
+}
+
+// Split splits a command line into words. Quotes group words and are
+// removed; there is no escaping, globbing or variable expansion.
+func Split(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// Expand substitutes value(name) for each {name} in each word of argv. A
+// value always stays inside the word it replaced a placeholder in.
+func Expand(argv []string, value func(name string) string) []string {
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		out[i] = placeholderRe.ReplaceAllStringFunc(arg, func(p string) string {
+			return value(strings.Trim(p, "{}"))
+		})
+	}
+	return out
+}
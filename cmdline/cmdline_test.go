@@ -0,0 +1,71 @@
+package cmdline
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"mtr {remote_addr}", []string{"mtr", "{remote_addr}"}},
+		{"  a\t b  ", []string{"a", "b"}},
+		{`open "https://x/{app} y" 'z w'`, []string{"open", "https://x/{app} y", "z w"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`say "it's"`, []string{"say", "it's"}},
+		{`""`, []string{""}},
+		{`a \b`, []string{"a", `\b`}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.in)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("Split(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`a "b`, `a 'b`} {
+		if _, err := Split(in); err == nil {
+			t.Errorf("Split(%q) accepted", in)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	known := func(name string) bool { return name == "app" || name == "pid" }
+	if argv, err := Parse("kill -0 {pid}", known); err != nil || len(argv) != 3 {
+		t.Errorf("valid command: %q, %v", argv, err)
+	}
+	for _, in := range []string{"", "   ", "echo {host}", "echo {app}{shell}"} {
+		if _, err := Parse(in, known); err == nil {
+			t.Errorf("Parse(%q) accepted", in)
+		}
+	}
+}
+
+// TestExpandHostile checks that a value stays one word, unchanged,
+// whatever shell syntax it holds.
+func TestExpandHostile(t *testing.T) {
+	hostile := []string{
+		`evil"; rm -rf ~; echo "`,
+		`it's'; reboot; '`,
+		"$(touch /tmp/pwned) `id` && true || false",
+		"a b\tc\nd",
+		"{pid}",
+		"",
+	}
+	argv := []string{"lookup", "--name={app}", "{app}", "at {pid}"}
+	for _, v := range hostile {
+		got := Expand(argv, func(name string) string {
+			if name == "pid" {
+				return "42"
+			}
+			return v
+		})
+		want := []string{"lookup", "--name=" + v, v, "at 42"}
+		if !slices.Equal(got, want) {
+			t.Errorf("value %q: argv %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Package config loads user settings from the ping-tracker config directory.
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Config holds user settings read from config.json. Missing fields keep
+// their zero value, so an absent file behaves like an empty one.
+type Config struct {
+	// Interval is the scan interval, e.g. "3s". The -interval flag wins.
+	Interval string `json:"interval,omitempty"`
+
+	// NoPing turns ping probes off, like -no-ping.
+	NoPing bool `json:"no_ping,omitempty"`
+
+	// EncryptionOverrides forces the encryption classification of a port:
+	// true = encrypted, false = plaintext.
+	EncryptionOverrides map[int]bool `json:"encryption_overrides,omitempty"`
+
+	// ConfirmQuit requires a second q (or y) within two seconds to quit.
+	ConfirmQuit bool `json:"confirm_quit,omitempty"`
+
+	// ReadOnly is the default of -read-only: no action that sends traffic
+	// other than probes, runs a program or changes the system.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// AbsoluteTimes shows wall-clock times instead of "3m ago" at startup.
+	AbsoluteTimes bool `json:"absolute_times,omitempty"`
+
+	// Clock12h formats wall-clock times as 2:32:07 PM instead of 14:32:07.
+	Clock12h bool `json:"clock_12h,omitempty"`
+
+	// FlowLinkGrace is how long after a socket closes a replacement to the
+	// same remote still inherits its history, e.g. "30s". "0" disables linking.
+	FlowLinkGrace string `json:"flow_link_grace,omitempty"`
+
+	// FlowLinkByApp links replacement sockets by app name instead of PID.
+	FlowLinkByApp bool `json:"flow_link_by_app,omitempty"`
+
+	// EphemeralPorts overrides the OS ephemeral port range, e.g. "32768-60999".
+	EphemeralPorts string `json:"ephemeral_ports,omitempty"`
+
+	// CompactPorts starts with ephemeral local ports abbreviated (toggle with e).
+	CompactPorts bool `json:"compact_ports,omitempty"`
+
+	// RestoreSession restores the UI state of the last run (see -restore-session).
+	RestoreSession bool `json:"restore_session,omitempty"`
+
+	// Alert thresholds, also editable in the TUI (F2). Durations are strings
+	// like "150ms"; loss is a percentage; the rate is bytes/sec (TX+RX);
+	// alert_stall is how long a transfer stall lasts before it alerts;
+	// alert_sendq is a send queue size in bytes that alerts once it has
+	// persisted for alert_sendq_scans scans (default 3).
+	AlertPingWarn string  `json:"alert_ping_warn,omitempty"`
+	AlertPing     string  `json:"alert_ping,omitempty"`
+	AlertLossWarn float64 `json:"alert_loss_warn,omitempty"`
+	AlertLoss     float64 `json:"alert_loss,omitempty"`
+	AlertRate     float64 `json:"alert_rate,omitempty"`
+	AlertStall    string  `json:"alert_stall,omitempty"`
+
+	AlertSendQ      uint64 `json:"alert_sendq,omitempty"`
+	AlertSendQScans int    `json:"alert_sendq_scans,omitempty"`
+
+	// AlertScore raises one "unhealthy" alert for a connection whose health
+	// score (0-100) stays below it for alert_score_scans scans (default 3).
+	AlertScore      int `json:"alert_score,omitempty"`
+	AlertScoreScans int `json:"alert_score_scans,omitempty"`
+
+	// AlertAppSockMem raises one alert for an app whose sockets hold at
+	// least this many bytes of kernel socket memory together (ss scanner).
+	AlertAppSockMem uint64 `json:"alert_app_sockmem,omitempty"`
+
+	// ScoreWeights overrides the weights of the health score components
+	// by name (rtt, loss, retrans, stall, reach), e.g. {"retrans": 40};
+	// 0 turns a component off.
+	ScoreWeights map[string]float64 `json:"score_weights,omitempty"`
+
+	// Delta view (z): a ping move of at least DeltaPingPct percent, or a
+	// TX+RX rate crossing DeltaRate bytes/sec, counts as a change.
+	DeltaPingPct float64 `json:"delta_ping_pct,omitempty"`
+	DeltaRate    float64 `json:"delta_rate,omitempty"`
+
+	// SortHysteresis is how many percent two rates must differ before a TX
+	// or RX sort swaps rows that were the other way round on the previous
+	// refresh (default 15; negative turns it off).
+	SortHysteresis float64 `json:"sort_hysteresis,omitempty"`
+
+	// KnownHostsMax caps known_hosts.json (default 50000); the least
+	// recently seen hosts are evicted.
+	KnownHostsMax int `json:"known_hosts_max,omitempty"`
+
+	// CalibrationHostsMax caps the hosts with a learned ping offset
+	// (default 4096).
+	CalibrationHostsMax int `json:"calibration_hosts_max,omitempty"`
+
+	// StateSaveInterval is how often state.json (ping calibration and
+	// per-app lifetime totals) is saved while running (default "5m"). It
+	// is also saved on exit; -no-state turns it off.
+	StateSaveInterval string `json:"state_save_interval,omitempty"`
+
+	// OpenCmd is the command o runs for the selected connection: "ipinfo"
+	// (the default), "mtr", or a command line with {remote_addr},
+	// {remote_port}, {local_addr}, {local_port}, {app}, {pid} or {proto}.
+	OpenCmd string `json:"open_cmd,omitempty"`
+
+	// StuckStates overrides how long a TCP state may last before the
+	// connection is flagged as stuck, e.g. {"CLOSE_WAIT": "10m"}; "0"
+	// turns a state off.
+	StuckStates map[string]string `json:"stuck_states,omitempty"`
+
+	// NoPingWarmUp keeps the first probe RTT of each host instead of
+	// dropping it as a warm-up sample. PingOutlierMAD rejects probe RTTs
+	// more than this many median absolute deviations from the host's
+	// median (default 5; negative turns rejection off).
+	NoPingWarmUp   bool    `json:"no_ping_warmup,omitempty"`
+	PingOutlierMAD float64 `json:"ping_outlier_mad,omitempty"`
+
+	// NoProbe lists CIDR prefixes or addresses that are never probed,
+	// besides multicast, broadcast, loopback and the other non-routable
+	// ranges, e.g. ["10.99.0.0/16"].
+	NoProbe []string `json:"no_probe,omitempty"`
+
+	// Palette is the TUI color palette: "default", "colorblind" (blue /
+	// orange / vermillion plus ·, !, !! markers) or "mono".
+	Palette string `json:"palette,omitempty"`
+
+	// ListenerSuppress exempts listeners from new-listener alerts, e.g. the
+	// ports a torrent client or passive FTP opens on the fly.
+	ListenerSuppress []ListenerSuppression `json:"listener_suppress,omitempty"`
+
+	// AuditRules replaces the built-in -audit rules when set.
+	AuditRules []AuditRule `json:"audit_rules,omitempty"`
+
+	// DualStackTargets are host:port services probed over IPv4 and IPv6
+	// separately, to compare the two paths (-dual-stack adds to them).
+	DualStackTargets []string `json:"dual_stack_targets,omitempty"`
+
+	// DerivedColumns are extra table columns computed from other fields,
+	// e.g. {"name": "lag", "expr": "ping_ms * (1 + loss / 100)"}.
+	DerivedColumns []DerivedColumn `json:"derived_columns,omitempty"`
+
+	// Schedule lists time windows that change behavior while they last,
+	// e.g. quiet hours with probes off. The first matching window applies.
+	Schedule []ScheduleWindow `json:"schedule,omitempty"`
+
+	// LoadHigh backs the tracker off while the machine is busy: from a
+	// 1-minute load average per CPU (Linux) or CPU busy share (Windows)
+	// of LoadHigh until it drops below LoadLow (default 80% of LoadHigh),
+	// the scan interval is multiplied by LoadIntervalFactor (default 2)
+	// and at most LoadProbeConcurrency probes (default 4) run at once.
+	// -load-high wins over LoadHigh; 0 turns it off.
+	LoadHigh             float64 `json:"load_high,omitempty"`
+	LoadLow              float64 `json:"load_low,omitempty"`
+	LoadIntervalFactor   float64 `json:"load_interval_factor,omitempty"`
+	LoadProbeConcurrency int     `json:"load_probe_concurrency,omitempty"`
+
+	// STUNServer is the host:port the F3 panel asks for the public
+	// address (default stun.l.google.com:19302); with STUNServer2 set too,
+	// the panel also tells how the NAT maps one socket to two servers.
+	STUNServer  string `json:"stun_server,omitempty"`
+	STUNServer2 string `json:"stun_server2,omitempty"`
+
+	// DeepDiveRate and DeepDiveDuration set an F7 deep-dive: probes a
+	// second (1-10, default 10) and how long it runs (up to 5m, default
+	// 1m).
+	DeepDiveRate     int    `json:"deep_dive_rate,omitempty"`
+	DeepDiveDuration string `json:"deep_dive_duration,omitempty"`
+
+	// FocusInterval is the cadence of the focus loop armed with F (100ms
+	// to 250ms, default 250ms).
+	FocusInterval string `json:"focus_interval,omitempty"`
+
+	// NameLookupsPerScan is how many processes a Windows scan opens at
+	// most to learn their names (default 16); the others show as
+	// "resolving…" until a later scan. Names are cached by PID.
+	NameLookupsPerScan int `json:"name_lookups_per_scan,omitempty"`
+
+	// UnreachableAlert is how long a remote host's probes must keep
+	// failing before the outage is logged as an alert (default 1m, "0"
+	// turns it off). Its recovery is logged with the outage's length.
+	UnreachableAlert string `json:"unreachable_alert,omitempty"`
+
+	// HalfOpenIdle and HalfOpenUnreachable tune the half-open check: an
+	// established connection whose byte counters have not moved for
+	// half_open_idle (default 3m) while its peer has been unreachable for
+	// half_open_unreachable (default 1m), or the kernel keeps
+	// retransmitting, is flagged. A half_open_idle of "0" turns it off.
+	HalfOpenIdle        string `json:"half_open_idle,omitempty"`
+	HalfOpenUnreachable string `json:"half_open_unreachable,omitempty"`
+
+	// ServiceChecks are application-layer health checks of the remotes of
+	// matching connections: a DNS query, an HTTP(S) GET or an SMTP
+	// greeting, every minute by default. None run unless configured.
+	ServiceChecks []ServiceCheck `json:"service_checks,omitempty"`
+
+	// Triggers run a command when a connection matching a filter opens,
+	// becomes established, closes, starts alerting or recovers.
+	Triggers []Trigger `json:"triggers,omitempty"`
+
+	// Notify sends alerts on as they are raised and cleared: to webhooks
+	// and by mail. Nothing is sent unless configured.
+	Notify *Notify `json:"notify,omitempty"`
+
+	// EventLog is a file alerts and notable events are appended to, one
+	// line each (-event-log wins). EventLogLevel is the lowest severity
+	// written: info (default), warn or crit. Connections of the apps in
+	// EventLogApps are logged as they open and close.
+	EventLog      string   `json:"event_log,omitempty"`
+	EventLogLevel string   `json:"event_log_level,omitempty"`
+	EventLogApps  []string `json:"event_log_apps,omitempty"`
+
+	// OnboardingDone is set once the first-run introduction was dismissed
+	// (-onboarding shows it again).
+	OnboardingDone bool `json:"onboarding_done,omitempty"`
+}
+
+// ListenerSuppression matches listeners by app name, port range
+// ("6881-6999") or both.
+type ListenerSuppression struct {
+	App   string `json:"app,omitempty"`
+	Ports string `json:"ports,omitempty"`
+}
+
+// ServiceCheck is one health check, bound to connections by remote port,
+// remote address or prefix, or both.
+type ServiceCheck struct {
+	Name    string `json:"name,omitempty"`
+	Proto   string `json:"proto"` // dns, http, https or smtp
+	Port    int    `json:"port,omitempty"`
+	Remote  string `json:"remote,omitempty"`  // address or CIDR prefix
+	Query   string `json:"query,omitempty"`   // dns: name asked for (default example.com)
+	Path    string `json:"path,omitempty"`    // http(s): path requested (default /)
+	Host    string `json:"host,omitempty"`    // http(s): Host and TLS server name
+	Every   string `json:"every,omitempty"`   // default 1m, at least 10s
+	Timeout string `json:"timeout,omitempty"` // default 5s, at most 10s
+}
+
+// Trigger is one trigger rule: the command Run is run, without a shell,
+// when a connection matching Filter reaches the event On.
+type Trigger struct {
+	Name        string `json:"name"`
+	Filter      string `json:"filter,omitempty"` // search query syntax; every connection when empty
+	On          string `json:"on"`               // opened, established, closed, alerting or recovered
+	Run         string `json:"run"`
+	MinInterval string `json:"min_interval,omitempty"` // default 10s
+	Timeout     string `json:"timeout,omitempty"`      // default 1m
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// Notify configures the alert notifications. RateLimit caps the
+// notifications an hour across every webhook and the mail (default 60);
+// the ones past it are dropped.
+type Notify struct {
+	RateLimit int          `json:"rate_limit,omitempty"`
+	Webhooks  []Webhook    `json:"webhooks,omitempty"`
+	Email     *EmailNotify `json:"email,omitempty"`
+}
+
+// Webhook is a URL each alert is posted to as JSON. The secret the body is
+// signed with is read from the environment variable SecretEnv, so it stays
+// out of the config file.
+type Webhook struct {
+	URL       string `json:"url"`
+	SecretEnv string `json:"secret_env,omitempty"`
+}
+
+// EmailNotify mails the alerts collected over Batch (default 1m) through
+// an SMTP server offering STARTTLS. The password is read from the
+// environment variable PasswordEnv.
+type EmailNotify struct {
+	Server      string   `json:"server"` // host:port, port 587 by default
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty"`
+	Batch       string   `json:"batch,omitempty"`
+}
+
+// DerivedColumn is a user-defined column: an arithmetic expression over
+// ping_ms, loss, tx_rate, rx_rate, age_s, idle_s and score.
+type DerivedColumn struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// ScheduleWindow is one schedule entry: when it applies and what it
+// changes.
+type ScheduleWindow struct {
+	Name           string  `json:"name"`
+	Days           string  `json:"days,omitempty"` // e.g. "mon-fri"; every day when empty
+	Time           string  `json:"time"`           // e.g. "22:00-08:00"
+	Probes         string  `json:"probes,omitempty"`
+	Silent         bool    `json:"silent,omitempty"`
+	IntervalFactor float64 `json:"interval_factor,omitempty"`
+}
+
+// AuditRule is one -audit heuristic. Every condition that is set must hold
+// for the rule to add its score.
+type AuditRule struct {
+	Name           string   `json:"name"`
+	Score          int      `json:"score"`
+	PathPrefixes   []string `json:"path_prefixes,omitempty"`
+	ModifiedWithin string   `json:"modified_within,omitempty"` // e.g. "24h"
+	WorldWritable  bool     `json:"world_writable,omitempty"`
+	Deleted        bool     `json:"deleted,omitempty"`
+}
+
+// Dir returns the ping-tracker config directory (e.g. ~/.config/ping-tracker).
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "ping-tracker"), nil
+}
+
+// Path returns the location of config.json.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// Load reads config.json. A missing file is not an error.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return &Config{}, err
+	}
+	return cfg, nil
+}
+
+// Save writes config.json atomically, creating the directory if needed.
+func Save(cfg *Config) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
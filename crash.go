@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"ping-tracker/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runProgram runs p with Bubble Tea's own panic handling disabled. If the
+// model panics, the terminal is restored first, the stack trace goes to a
+// crash file in the config directory, and the panic is re-raised.
+func runProgram(p *tea.Program) (final tea.Model, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		stack := debug.Stack()
+		p.ReleaseTerminal()
+
+		path, werr := writeCrashFile(r, stack)
+		if werr != nil {
+			fmt.Fprintf(os.Stderr, "ping-tracker crashed: %v (could not write crash file: %v)\n", r, werr)
+		} else {
+			fmt.Fprintf(os.Stderr, "ping-tracker crashed: %v\nStack trace written to %s\n", r, path)
+		}
+		panic(r)
+	}()
+
+	return p.Run()
+}
+
+// writeCrashFile writes the panic value and stack to crash-<timestamp>.log
+// in the config directory, falling back to the temp directory.
+func writeCrashFile(r interface{}, stack []byte) (string, error) {
+	dir, err := config.Dir()
+	if err != nil || os.MkdirAll(dir, 0o755) != nil {
+		dir = os.TempDir()
+	}
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s.log", time.Now().Format("20060102-150405")))
+	content := fmt.Sprintf("panic: %v\n\n%s", r, stack)
+	return path, os.WriteFile(path, []byte(content), 0o600)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCrashFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+
+	path, err := writeCrashFile("boom", []byte("goroutine 1 [running]:\nmain.main()"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, dir) || !strings.HasPrefix(filepath.Base(path), "crash-") {
+		t.Fatalf("crash file at %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); !strings.HasPrefix(s, "panic: boom\n") || !strings.Contains(s, "main.main()") {
+		t.Fatalf("crash file:\n%s", s)
+	}
+}
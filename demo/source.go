@@ -0,0 +1,436 @@
+// Package demo is a synthetic connection source for -demo: a few dozen
+// apps whose connections open, carry traffic and close, with latency on
+// random walks, occasional spikes and loss bursts, and a download that
+// ramps up until it saturates the link. The same seed always produces the
+// same sequence of scans, so a session can be reproduced.
+package demo
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// kind is how an app's connections behave.
+type kind int
+
+const (
+	kindBrowser  kind = iota // many short connections, a burst of traffic each
+	kindIdle                 // a few long-lived, mostly idle connections
+	kindStream               // steady download
+	kindDownload             // one download ramping up to the link capacity, then a pause
+	kindUpload               // steady upload that keeps its send queue full
+	kindRealtime             // UDP at a steady packet rate
+	kindServer               // a listening socket with inbound clients
+	kindLeaky                // like idle, but leaves closed sockets in CLOSE_WAIT
+)
+
+// appSpec describes one simulated app.
+type appSpec struct {
+	name  string
+	kind  kind
+	port  int           // remote port; the listening port for servers
+	hosts int           // distinct remote hosts
+	conns int           // typical open connections
+	rtt   time.Duration // typical latency to its hosts
+	udp   bool
+	v6    bool
+}
+
+var apps = []appSpec{
+	{name: "firefox", kind: kindBrowser, port: 443, hosts: 14, conns: 10, rtt: 25 * time.Millisecond},
+	{name: "chrome", kind: kindBrowser, port: 443, hosts: 10, conns: 8, rtt: 30 * time.Millisecond, v6: true},
+	{name: "curl", kind: kindBrowser, port: 443, hosts: 3, conns: 1, rtt: 40 * time.Millisecond},
+	{name: "git", kind: kindBrowser, port: 22, hosts: 2, conns: 1, rtt: 35 * time.Millisecond},
+	{name: "systemd-resolve", kind: kindBrowser, port: 53, hosts: 2, conns: 2, rtt: 12 * time.Millisecond, udp: true},
+	{name: "qbittorrent", kind: kindBrowser, port: 6881, hosts: 30, conns: 12, rtt: 140 * time.Millisecond},
+	{name: "slack", kind: kindIdle, port: 443, hosts: 3, conns: 3, rtt: 40 * time.Millisecond},
+	{name: "discord", kind: kindIdle, port: 443, hosts: 2, conns: 2, rtt: 35 * time.Millisecond},
+	{name: "telegram", kind: kindIdle, port: 443, hosts: 2, conns: 2, rtt: 60 * time.Millisecond, v6: true},
+	{name: "signal-desktop", kind: kindIdle, port: 443, hosts: 1, conns: 1, rtt: 45 * time.Millisecond},
+	{name: "thunderbird", kind: kindIdle, port: 993, hosts: 2, conns: 2, rtt: 50 * time.Millisecond},
+	{name: "code", kind: kindIdle, port: 443, hosts: 3, conns: 3, rtt: 40 * time.Millisecond},
+	{name: "ssh", kind: kindIdle, port: 22, hosts: 2, conns: 2, rtt: 12 * time.Millisecond},
+	{name: "dropbox", kind: kindIdle, port: 443, hosts: 2, conns: 2, rtt: 45 * time.Millisecond},
+	{name: "syncthing", kind: kindIdle, port: 22000, hosts: 3, conns: 3, rtt: 20 * time.Millisecond, v6: true},
+	{name: "chronyd", kind: kindIdle, port: 123, hosts: 3, conns: 1, rtt: 15 * time.Millisecond, udp: true},
+	{name: "spotify", kind: kindStream, port: 443, hosts: 2, conns: 1, rtt: 30 * time.Millisecond},
+	{name: "vlc", kind: kindStream, port: 8000, hosts: 1, conns: 1, rtt: 70 * time.Millisecond},
+	{name: "steam", kind: kindDownload, port: 443, hosts: 2, conns: 1, rtt: 20 * time.Millisecond},
+	{name: "restic", kind: kindUpload, port: 22, hosts: 1, conns: 1, rtt: 60 * time.Millisecond},
+	{name: "obs", kind: kindUpload, port: 1935, hosts: 1, conns: 1, rtt: 35 * time.Millisecond},
+	{name: "cs2", kind: kindRealtime, port: 27015, hosts: 1, conns: 1, rtt: 18 * time.Millisecond, udp: true},
+	{name: "zoom", kind: kindRealtime, port: 8801, hosts: 1, conns: 2, rtt: 35 * time.Millisecond, udp: true},
+	{name: "nginx", kind: kindServer, port: 443, hosts: 8, conns: 5, rtt: 55 * time.Millisecond},
+	{name: "sshd", kind: kindServer, port: 22, hosts: 2, conns: 1, rtt: 30 * time.Millisecond},
+	{name: "postgres", kind: kindServer, port: 5432, hosts: 2, conns: 3, rtt: time.Millisecond},
+	{name: "node", kind: kindLeaky, port: 443, hosts: 3, conns: 3, rtt: 50 * time.Millisecond},
+	{name: "java", kind: kindLeaky, port: 8080, hosts: 2, conns: 2, rtt: 8 * time.Millisecond},
+}
+
+const (
+	// linkCapacity is the download speed the saturating download reaches.
+	linkCapacity = 11.5 * 1024 * 1024
+	// bufferbloat is the latency added to every host at full link load.
+	bufferbloat = 40 * time.Millisecond
+	localV4     = "192.168.1.23"
+	localV6     = "2001:db8:1::23"
+)
+
+// host is one simulated remote host: its latency and loss this scan.
+type host struct {
+	addr  string
+	base  time.Duration
+	walk  float64 // random walk around base, as a fraction of it
+	spike int     // scans left in a latency spike
+	burst int     // scans left in a loss burst
+	loss  float64
+	rtt   time.Duration
+}
+
+// sock is one simulated socket.
+type sock struct {
+	app     *app
+	host    *host // nil for a listening socket
+	local   int
+	remote  int
+	inbound bool
+	state   tracker.ConnState
+	left    int // scans left in the current state; -1 for no limit
+	age     int
+	tx, rx  uint64
+	txRate  float64 // bytes/sec this scan
+	rxRate  float64
+	sendQ   uint64
+}
+
+type app struct {
+	spec  appSpec
+	pid   int
+	hosts []*host
+	socks []*sock
+	pause int // scans until a download starts again
+}
+
+// Source implements tracker.Source with a simulated network.
+type Source struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	interval time.Duration
+	apps     []*app
+	byAddr   map[string]*host
+	nextPort int
+	load     float64 // fraction of linkCapacity in use
+}
+
+// New creates a source that produces the same scans for the same seed.
+// interval is the tracker's scan interval, which turns the simulated rates
+// into byte counts.
+func New(seed int64, interval time.Duration) *Source {
+	s := &Source{
+		rng:      rand.New(rand.NewSource(seed)),
+		interval: interval,
+		byAddr:   make(map[string]*host),
+		nextPort: 40000,
+	}
+	n := 0
+	for i, spec := range apps {
+		a := &app{spec: spec, pid: 1200 + 37*i}
+		for j := 0; j < spec.hosts; j++ {
+			n++
+			h := &host{addr: hostAddr(n, spec.v6), base: time.Duration(float64(spec.rtt) * (0.7 + 0.6*s.rng.Float64()))}
+			if spec.name == "postgres" {
+				h.addr = fmt.Sprintf("10.0.0.%d", 10+j) // a local app server
+			}
+			h.rtt = h.base
+			a.hosts = append(a.hosts, h)
+			s.byAddr[h.addr] = h
+		}
+		if spec.kind == kindServer {
+			a.socks = append(a.socks, &sock{app: a, local: spec.port, state: tracker.StateListening, left: -1})
+		}
+		s.apps = append(s.apps, a)
+	}
+	return s
+}
+
+// hostAddr is the address of the nth simulated host, from the ranges
+// reserved for documentation so nothing real is ever named.
+func hostAddr(n int, v6 bool) string {
+	if v6 {
+		return fmt.Sprintf("2001:db8:%x::%x", n/200+2, n%200+1)
+	}
+	nets := []string{"198.51.100", "203.0.113", "192.0.2"}
+	return fmt.Sprintf("%s.%d", nets[(n/250)%len(nets)], n%250+1)
+}
+
+// Scan advances the simulation by one scan interval and returns its sockets.
+func (s *Source) Scan() ([]*tracker.Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.step()
+	var conns []*tracker.Connection
+	for _, a := range s.apps {
+		for _, k := range a.socks {
+			conns = append(conns, s.connection(k))
+		}
+	}
+	return conns, nil
+}
+
+// Ping returns the simulated latency and loss of addr. Unknown addresses
+// never answer.
+func (s *Source) Ping(addr string, port int) (time.Duration, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.byAddr[addr]
+	if !ok || h.loss >= 100 {
+		return 0, 100
+	}
+	return h.rtt, h.loss
+}
+
+func (s *Source) step() {
+	for _, a := range s.apps {
+		for _, h := range a.hosts {
+			s.stepHost(h)
+		}
+	}
+	var down float64
+	for _, a := range s.apps {
+		s.stepApp(a)
+		for _, k := range a.socks {
+			down += k.rxRate
+		}
+	}
+	s.load = math.Min(1, down/linkCapacity)
+}
+
+// stepHost moves a host's latency along its random walk, with rare spikes
+// of several times the base latency, loss bursts, and queueing delay when
+// the link is loaded.
+func (s *Source) stepHost(h *host) {
+	h.walk = 0.95*h.walk + 0.04*s.rng.NormFloat64()
+	h.walk = math.Max(-0.3, math.Min(1.5, h.walk))
+	if h.spike > 0 {
+		h.spike--
+	} else if s.rng.Float64() < 0.01 {
+		h.spike = 2 + s.rng.Intn(4)
+	}
+	if h.burst > 0 {
+		h.burst--
+		if h.burst == 0 {
+			h.loss = 0
+		}
+	} else if s.rng.Float64() < 0.004 {
+		h.burst = 3 + s.rng.Intn(8)
+		h.loss = []float64{33, 33, 67, 100}[s.rng.Intn(4)]
+	}
+	rtt := float64(h.base) * (1 + h.walk) * (1 + 0.05*s.rng.Float64())
+	if h.spike > 0 {
+		rtt *= 4
+	}
+	h.rtt = time.Duration(rtt) + time.Duration(s.load*s.load*float64(bufferbloat))
+}
+
+// stepApp ages, closes and opens an app's sockets and sets their traffic.
+func (s *Source) stepApp(a *app) {
+	spec := a.spec
+	keep := a.socks[:0]
+	open := 0
+	for _, k := range a.socks {
+		k.age++
+		if k.left > 0 {
+			k.left--
+		}
+		if k.left == 0 && !s.advance(k) {
+			continue
+		}
+		keep = append(keep, k)
+		if k.state == tracker.StateEstablished || k.state == tracker.StateSynSent {
+			open++
+		}
+	}
+	a.socks = keep
+
+	switch spec.kind {
+	case kindBrowser:
+		for n := s.rng.Intn(3); n > 0 && open < 2*spec.conns; n-- {
+			s.open(a)
+			open++
+		}
+	case kindDownload:
+		if open == 0 {
+			if a.pause > 0 {
+				a.pause--
+			} else {
+				s.open(a)
+			}
+		}
+	default:
+		for open < spec.conns {
+			s.open(a)
+			open++
+		}
+	}
+
+	for _, k := range a.socks {
+		s.traffic(k)
+	}
+}
+
+// open starts a connection to one of the app's hosts, or from one for a
+// server.
+func (s *Source) open(a *app) {
+	h := a.hosts[s.rng.Intn(len(a.hosts))]
+	k := &sock{app: a, host: h, state: tracker.StateSynSent, left: 1}
+	port := s.nextPort
+	s.nextPort++
+	if s.nextPort > 60999 {
+		s.nextPort = 40000
+	}
+	if a.spec.kind == kindServer {
+		k.inbound, k.local, k.remote = true, a.spec.port, port
+		k.state, k.left = tracker.StateEstablished, s.lifetime(a.spec.kind)
+	} else {
+		k.local, k.remote = port, a.spec.port
+	}
+	if a.spec.udp {
+		k.state, k.left = tracker.StateEstablished, s.lifetime(a.spec.kind)
+	}
+	a.socks = append(a.socks, k)
+}
+
+// lifetime is how many scans a connection of kind stays established.
+func (s *Source) lifetime(k kind) int {
+	switch k {
+	case kindBrowser:
+		return 2 + s.rng.Intn(10)
+	case kindDownload:
+		return 40 + s.rng.Intn(40)
+	case kindServer:
+		return 5 + s.rng.Intn(60)
+	case kindLeaky:
+		return 20 + s.rng.Intn(40)
+	}
+	return 100 + s.rng.Intn(400)
+}
+
+// advance moves a socket whose state has run out to the next one. It
+// returns false once the socket is gone.
+func (s *Source) advance(k *sock) bool {
+	if k.app.spec.udp && k.state == tracker.StateEstablished {
+		return false
+	}
+	switch k.state {
+	case tracker.StateSynSent:
+		k.state, k.left = tracker.StateEstablished, s.lifetime(k.app.spec.kind)
+	case tracker.StateEstablished:
+		if k.app.spec.kind == kindDownload {
+			k.app.pause = 60 + s.rng.Intn(120)
+		}
+		if k.app.spec.kind == kindLeaky && s.rng.Float64() < 0.15 {
+			// The peer closed and the app never does: stuck for a long time.
+			k.state, k.left = tracker.StateCloseWait, 60+s.rng.Intn(140)
+		} else if k.inbound {
+			k.state, k.left = tracker.StateLastAck, 1
+		} else {
+			k.state, k.left = tracker.StateFinWait2, 1
+		}
+	case tracker.StateFinWait2:
+		k.state, k.left = tracker.StateTimeWait, 2+s.rng.Intn(3)
+	case tracker.StateCloseWait:
+		k.state, k.left = tracker.StateLastAck, 1
+	default:
+		return false
+	}
+	return true
+}
+
+// traffic sets a socket's rates for this scan by its app's kind and adds
+// them to its byte counters.
+func (s *Source) traffic(k *sock) {
+	k.txRate, k.rxRate, k.sendQ = 0, 0, 0
+	if k.state != tracker.StateEstablished {
+		return
+	}
+	jitter := func(v float64) float64 { return v * (0.8 + 0.4*s.rng.Float64()) }
+	switch k.app.spec.kind {
+	case kindBrowser:
+		if k.age < 3 {
+			k.txRate, k.rxRate = jitter(4<<10), jitter(float64(50+s.rng.Intn(450))*1024)
+		}
+	case kindIdle, kindLeaky:
+		if s.rng.Float64() < 0.3 {
+			k.txRate, k.rxRate = jitter(300), jitter(1200)
+		}
+	case kindStream:
+		k.txRate, k.rxRate = jitter(2<<10), jitter(600<<10)
+	case kindDownload:
+		// Doubles every few scans until it saturates the link.
+		k.txRate = jitter(8 << 10)
+		k.rxRate = math.Min(linkCapacity, 256*1024*math.Pow(2, float64(k.age)/3)) * (0.95 + 0.05*s.rng.Float64())
+	case kindUpload:
+		k.txRate, k.rxRate = jitter(1500<<10), jitter(6<<10)
+		k.sendQ = uint64(jitter(2 << 20))
+	case kindRealtime:
+		k.txRate, k.rxRate = jitter(25<<10), jitter(60<<10)
+	case kindServer:
+		k.txRate, k.rxRate = jitter(40<<10), jitter(3<<10)
+	}
+	secs := s.interval.Seconds()
+	k.tx += uint64(k.txRate * secs)
+	k.rx += uint64(k.rxRate * secs)
+	if k.sendQ == 0 && k.txRate > 0 && !k.app.spec.udp {
+		k.sendQ = uint64(s.rng.Intn(16 << 10))
+	}
+}
+
+// connection is the socket as a scanner would report it.
+func (s *Source) connection(k *sock) *tracker.Connection {
+	a := k.app
+	proto, local := "tcp", localV4
+	if a.spec.udp {
+		proto = "udp"
+	}
+	if a.spec.v6 {
+		proto += "6"
+		local = localV6
+	}
+	c := &tracker.Connection{
+		PID:       a.pid,
+		AppName:   a.spec.name,
+		Protocol:  proto,
+		Direction: tracker.Outbound,
+		LocalAddr: local,
+		LocalPort: k.local,
+		State:     k.state,
+		HasQueues: true,
+		SendQ:     k.sendQ,
+	}
+	c.Provenance = []string{tracker.ProvenanceDemo}
+	if k.host == nil {
+		c.RemoteAddr = "0.0.0.0"
+		if a.spec.v6 {
+			c.RemoteAddr = "::"
+		}
+		c.Direction = tracker.Inbound
+		return c
+	}
+	c.RemoteAddr, c.RemotePort = k.host.addr, k.remote
+	if k.state == tracker.StateTimeWait {
+		// TIME_WAIT sockets belong to no process.
+		c.PID, c.AppName = 0, "unknown"
+	}
+	if !a.spec.udp {
+		c.TxBytes, c.RxBytes, c.HasByteCounts = k.tx, k.rx, true
+		if k.state == tracker.StateEstablished {
+			c.KernelRTT = max(0, k.host.rtt-300*time.Microsecond)
+		}
+	}
+	return c
+}
@@ -0,0 +1,84 @@
+package demo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// scanKeys renders a scan as one comparable line per socket.
+func scanKeys(conns []*tracker.Connection) []string {
+	out := make([]string, len(conns))
+	for i, c := range conns {
+		out[i] = fmt.Sprintf("%s %s tx=%d rx=%d", c.Key(), c.State, c.TxBytes, c.RxBytes)
+	}
+	return out
+}
+
+func TestSameSeedSameSession(t *testing.T) {
+	a, b, other := New(7, 2*time.Second), New(7, 2*time.Second), New(8, 2*time.Second)
+	differs := false
+	for scan := range 300 {
+		ca, _ := a.Scan()
+		cb, _ := b.Scan()
+		co, _ := other.Scan()
+		ka, kb := scanKeys(ca), scanKeys(cb)
+		if fmt.Sprint(ka) != fmt.Sprint(kb) {
+			t.Fatalf("scan %d differs for the same seed:\n%v\n%v", scan, ka, kb)
+		}
+		for _, c := range ca {
+			ra, la := a.Ping(c.RemoteAddr, c.RemotePort)
+			rb, lb := b.Ping(c.RemoteAddr, c.RemotePort)
+			if ra != rb || la != lb {
+				t.Fatalf("scan %d: ping of %s differs for the same seed", scan, c.RemoteAddr)
+			}
+		}
+		differs = differs || fmt.Sprint(ka) != fmt.Sprint(scanKeys(co))
+	}
+	if !differs {
+		t.Error("seeds 7 and 8 produced the same session")
+	}
+}
+
+// TestSessionEvolves checks the simulation does what -demo promises:
+// dozens of apps, connections that open and close, and only addresses
+// reserved for documentation.
+func TestSessionEvolves(t *testing.T) {
+	s := New(1, 2*time.Second)
+	apps := map[string]bool{}
+	seen := map[string]bool{}
+	opened, closed := 0, 0
+	var last map[string]bool
+	for range 150 { // five simulated minutes
+		conns, err := s.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := map[string]bool{}
+		for _, c := range conns {
+			apps[c.AppName] = true
+			now[c.Key()] = true
+			if !seen[c.Key()] {
+				seen[c.Key()] = true
+				opened++
+			}
+		}
+		for k := range last {
+			if !now[k] {
+				closed++
+			}
+		}
+		last = now
+	}
+	if len(apps) < 24 {
+		t.Errorf("%d apps, want a few dozen", len(apps))
+	}
+	if opened < 100 || closed < 50 {
+		t.Errorf("%d connections opened and %d closed in five minutes", opened, closed)
+	}
+	if rtt, loss := s.Ping("8.8.8.8", 53); rtt != 0 || loss != 100 {
+		t.Errorf("an address outside the simulation answered: %v %v%%", rtt, loss)
+	}
+}
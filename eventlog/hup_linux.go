@@ -0,0 +1,15 @@
+package eventlog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReopen delivers SIGHUP, which logrotate's postrotate scripts send
+// to have the file reopened.
+func notifyReopen() (<-chan os.Signal, func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c, func() { signal.Stop(c) }
+}
@@ -0,0 +1,8 @@
+package eventlog
+
+import "os"
+
+// notifyReopen returns a channel that never fires: Windows has no SIGHUP.
+func notifyReopen() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,64 @@
+// Package eventlog appends the tracker's alerts and notable events to a
+// plain-text file, one line per event, for grep, tail -f and log shippers.
+package eventlog
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ping-tracker/tracker"
+)
+
+// TimeFormat is the timestamp each line starts with: RFC 3339 in local
+// time, to the millisecond.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatLine renders e as one line, without the newline:
+//
+//	2026-01-02T15:04:05.123+01:00 level=warn event=alert_raised app=steam reason="ping 310ms"
+//
+// Values that are empty or hold spaces, quotes, '=' or anything unprintable
+// are quoted Go-style, so a line never breaks and always splits back into
+// the same fields.
+func FormatLine(e tracker.Event) string {
+	var b strings.Builder
+	b.WriteString(e.Time.Format(TimeFormat))
+	b.WriteString(" level=")
+	b.WriteString(e.Severity.String())
+	b.WriteString(" event=")
+	b.WriteString(value(e.Kind))
+	for _, f := range e.Fields {
+		b.WriteByte(' ')
+		b.WriteString(key(f.Key))
+		b.WriteByte('=')
+		b.WriteString(value(f.Value))
+	}
+	return b.String()
+}
+
+// key keeps a field key to letters, digits, '_', '-' and '.'; anything
+// else becomes '_'.
+func key(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func value(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == ' ' || r == '"' || r == '=' || r == '\\' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
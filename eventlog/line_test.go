@@ -0,0 +1,181 @@
+package eventlog
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// at is the time every test event happens, in a fixed zone so the lines
+// do not depend on the machine's.
+var at = time.Date(2026, 1, 2, 15, 4, 5, 123_456_789, time.FixedZone("", 3600))
+
+func TestValue(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"steam", "steam"},
+		{"10.0.0.1:443", "10.0.0.1:443"},
+		{"[2001:db8::1]:443", "[2001:db8::1]:443"},
+		{"Überweisung", "Überweisung"},
+		{"", `""`},
+		{"ping 310ms", `"ping 310ms"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"a=b", `"a=b"`},
+		{`C:\Games`, `"C:\\Games"`},
+		{"two\nlines", `"two\nlines"`},
+		{"tab\there", `"tab\there"`},
+		{"\x1b[31mred", `"\x1b[31mred"`},
+		{"no\u00a0break", `"no\u00a0break"`},
+	}
+	for _, tt := range tests {
+		if got := value(tt.in); got != tt.want {
+			t.Errorf("value(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"app", "app"},
+		{"tx_bytes", "tx_bytes"},
+		{"http.status-code", "http.status-code"},
+		{"", "_"},
+		{"two words", "two_words"},
+		{"a=b", "a_b"},
+		{"größe", "gr__e"},
+	}
+	for _, tt := range tests {
+		if got := key(tt.in); got != tt.want {
+			t.Errorf("key(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// splitLine splits a line back into its timestamp and key=value fields,
+// unquoting quoted values, the way a log shipper would.
+func splitLine(t *testing.T, line string) (string, []tracker.EventField) {
+	t.Helper()
+	stamp, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		t.Fatalf("no fields in %q", line)
+	}
+	var fields []tracker.EventField
+	for rest != "" {
+		k, v, ok := strings.Cut(rest, "=")
+		if !ok {
+			t.Fatalf("field without '=' in %q", rest)
+		}
+		if strings.HasPrefix(v, `"`) {
+			quoted, err := strconv.QuotedPrefix(v)
+			if err != nil {
+				t.Fatalf("bad quoting in %q: %v", v, err)
+			}
+			rest = v[len(quoted):]
+			v, _ = strconv.Unquote(quoted)
+		} else {
+			v, rest, _ = strings.Cut(v, " ")
+			rest = " " + rest
+		}
+		fields = append(fields, tracker.EventField{Key: k, Value: v})
+		rest = strings.TrimPrefix(rest, " ")
+	}
+	return stamp, fields
+}
+
+func TestFormatLineSplits(t *testing.T) {
+	values := []string{"plain", "", "two words", `"quoted"`, "k=v", `back\slash`, "new\nline", "\x00\x7f", "ünï code"}
+	e := tracker.Event{Time: at, Severity: tracker.SeverityWarn, Kind: tracker.EventMarker}
+	for i, v := range values {
+		e.Fields = append(e.Fields, tracker.EventField{Key: "f" + strconv.Itoa(i), Value: v})
+	}
+	line := FormatLine(e)
+	if strings.ContainsAny(line, "\n\r") {
+		t.Fatalf("line breaks: %q", line)
+	}
+	stamp, fields := splitLine(t, line)
+	if stamp != "2026-01-02T15:04:05.123+01:00" {
+		t.Errorf("timestamp = %s", stamp)
+	}
+	if got, err := time.Parse(TimeFormat, stamp); err != nil || !got.Equal(at.Truncate(time.Millisecond)) {
+		t.Errorf("timestamp parses to %v, %v", got, err)
+	}
+	want := append([]tracker.EventField{{Key: "level", Value: "warn"}, {Key: "event", Value: "marker"}}, e.Fields...)
+	if len(fields) != len(want) {
+		t.Fatalf("split into %d fields, want %d: %q", len(fields), len(want), line)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("field %d = %q, want %q", i, fields[i], want[i])
+		}
+	}
+}
+
+// eventsOfEachKind is one event of every kind the tracker, the UI and the
+// session summary write, with the fields they write.
+func eventsOfEachKind() []tracker.Event {
+	ev := func(sev tracker.Severity, kind string, kv ...string) tracker.Event {
+		e := tracker.Event{Time: at, Severity: sev, Kind: kind}
+		for i := 0; i+1 < len(kv); i += 2 {
+			e.Fields = append(e.Fields, tracker.EventField{Key: kv[i], Value: kv[i+1]})
+		}
+		return e
+	}
+	conn := []string{"app", "steam", "pid", "4242", "proto", "tcp", "local", "10.0.0.2:40001", "remote", "203.0.113.7:27015", "state", "ESTABLISHED"}
+	return []tracker.Event{
+		ev(tracker.SeverityInfo, tracker.EventConnOpened, conn...),
+		ev(tracker.SeverityInfo, tracker.EventConnClosed, append(conn, "duration", "1h2m3s", "tx_bytes", "1048576", "rx_bytes", "52428800")...),
+		ev(tracker.SeverityCrit, tracker.EventAlertRaised, "app", "steam", "remote", "203.0.113.7", "reason", "ping 310ms > 200ms", "key", "tcp|10.0.0.2:40001|203.0.113.7:27015"),
+		ev(tracker.SeverityInfo, tracker.EventAlertCleared, "app", "steam", "remote", "203.0.113.7", "key", "tcp|10.0.0.2:40001|203.0.113.7:27015"),
+		ev(tracker.SeverityWarn, tracker.EventNewListener, "app", "nc", "addr", "0.0.0.0:4444", "reason", "new listener on 0.0.0.0:4444"),
+		ev(tracker.SeverityInfo, tracker.EventSchedule, "window", "night", "state", "started"),
+		ev(tracker.SeverityWarn, tracker.EventLoadThrottle, "state", "started", "load", "1.52"),
+		ev(tracker.SeverityWarn, tracker.EventScansBehind, "state", "started", "interval", "1s", "effective", "1.4s"),
+		ev(tracker.SeverityWarn, tracker.EventClockJump, "kind", "resumed", "gap", "8h0m0s"),
+		ev(tracker.SeverityWarn, tracker.EventProbeBudget, "budget_bytes", "10485760"),
+		ev(tracker.SeverityInfo, tracker.EventPaused),
+		ev(tracker.SeverityInfo, tracker.EventResumed),
+		ev(tracker.SeverityInfo, tracker.EventMarker, "filter", "app:steam", "app", "steam", "remote", "203.0.113.7:27015"),
+		ev(tracker.SeverityWarn, tracker.EventInjection, "spec", "latency=+200ms,app=steam", "for", "30s"),
+		ev(tracker.SeverityInfo, tracker.EventInjectionDone, "spec", "latency=+200ms,app=steam"),
+		ev(tracker.SeverityCrit, tracker.EventUnreachable, "remote", "203.0.113.7", "since", "2026-01-02T15:03:05+01:00", "for", "1m0s"),
+		ev(tracker.SeverityInfo, tracker.EventReachable, "remote", "203.0.113.7", "outage", "1m0s"),
+		ev(tracker.SeverityWarn, tracker.EventHalfOpen, "state", "raised", "app", "ssh", "remote", "198.51.100.2:22", "reason", "no ACK for 2m"),
+		ev(tracker.SeverityInfo, tracker.EventHalfOpen, "state", "cleared", "app", "ssh", "remote", "198.51.100.2:22"),
+		ev(tracker.SeverityWarn, tracker.EventNotify, "state", "rate_limited", "limit", "10/h"),
+		ev(tracker.SeverityWarn, tracker.EventNotify, "sink", "webhook", "error", `Post "https://hooks.example/x": timeout`),
+		ev(tracker.SeverityInfo, tracker.EventTrigger, "rule", "restart-vpn", "event", "alerting", "app", "wireguard", "remote", "198.51.100.9:51820", "dry_run", "systemctl restart wg-quick@wg0"),
+		ev(tracker.SeverityInfo, tracker.EventSessionSummary, "duration", "2h0m0s", "scans", "7200", "peak_bps", "1250000",
+			"avg_bps", "40000", "top_apps", "steam:52428800,firefox:1048576", "worst_ping", "203.0.113.7:310ms",
+			"worst_loss", "198.51.100.2:12.5%", "alerts", "3", "listener_alerts", "1", "unreachable", "1", "files", ""),
+	}
+}
+
+func TestFormatLineGolden(t *testing.T) {
+	var b strings.Builder
+	for _, e := range eventsOfEachKind() {
+		b.WriteString(FormatLine(e))
+		b.WriteByte('\n')
+	}
+	got := b.String()
+	path := filepath.Join("testdata", "events.golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update)", err)
+	}
+	if got != string(want) {
+		t.Errorf("lines differ from %s:\n%s", path, got)
+	}
+}
@@ -0,0 +1,223 @@
+package eventlog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// maxQueue bounds the events waiting to be written; when it is full new
+// events are dropped and counted.
+const maxQueue = 1024
+
+// checkEvery is how often buffered lines are flushed and the path is
+// checked for the file having been rotated away. Tests shorten it.
+var checkEvery = time.Second
+
+// Stats are a writer's running totals.
+type Stats struct {
+	Written   uint64 // lines written
+	Dropped   uint64 // events dropped because the queue was full
+	Reopened  uint64 // times the file was reopened after a rotation or SIGHUP
+	LastError string // the most recent failed write or reopen, if any
+}
+
+// Writer appends events at or above a severity floor to a file. Events are
+// queued and written from the writer's own goroutine through a buffer
+// flushed every second, so the scan loop never waits on the disk. It
+// follows logrotate: the file is reopened on SIGHUP, and also when the path
+// no longer names the open file (rotated by rename, or deleted), so the
+// copytruncate and create methods both work without a postrotate script.
+// It implements tracker.EventSink.
+type Writer struct {
+	path  string
+	queue chan tracker.Event
+
+	mu    sync.Mutex // guards the fields below, and writes to f
+	floor tracker.Severity
+	f     *os.File
+	buf   *bufio.Writer
+	stats Stats
+
+	reopen chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Open opens path for appending, creating it if needed, and starts the
+// writer.
+func Open(path string, floor tracker.Severity) (*Writer, error) {
+	w := &Writer{
+		path:   path,
+		queue:  make(chan tracker.Event, maxQueue),
+		floor:  floor,
+		reopen: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// LogEvent implements tracker.EventSink. It queues e unless it is below
+// the floor, dropping it when the queue is full.
+func (w *Writer) LogEvent(e tracker.Event) {
+	w.mu.Lock()
+	skip := e.Severity < w.floor
+	w.mu.Unlock()
+	if skip {
+		return
+	}
+	select {
+	case w.queue <- e:
+	default:
+		w.mu.Lock()
+		w.stats.Dropped++
+		w.mu.Unlock()
+	}
+}
+
+// SetFloor sets the lowest severity written. It is safe to call while the
+// writer is running.
+func (w *Writer) SetFloor(floor tracker.Severity) {
+	w.mu.Lock()
+	w.floor = floor
+	w.mu.Unlock()
+}
+
+// Reopen has the file closed and opened again by path, as SIGHUP does.
+func (w *Writer) Reopen() {
+	select {
+	case w.reopen <- struct{}{}:
+	default:
+	}
+}
+
+// Path returns the file written to.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Stats returns the running totals.
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Close writes the queued events, flushes and closes the file, and stops
+// the writer.
+func (w *Writer) Close() error {
+	close(w.stop)
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.buf.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	hup, stopHup := notifyReopen()
+	defer stopHup()
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-w.queue:
+			w.write(e)
+		case <-ticker.C:
+			w.mu.Lock()
+			w.flush()
+			if w.rotated() {
+				w.reopenLocked()
+			}
+			w.mu.Unlock()
+		case <-hup:
+			w.Reopen()
+		case <-w.reopen:
+			w.mu.Lock()
+			w.reopenLocked()
+			w.mu.Unlock()
+		case <-w.stop:
+			for {
+				select {
+				case e := <-w.queue:
+					w.write(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *Writer) write(e tracker.Event) {
+	line := FormatLine(e) + "\n"
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.buf.WriteString(line); err != nil {
+		w.stats.LastError = err.Error()
+		return
+	}
+	w.stats.Written++
+}
+
+// flush writes out the buffer. Caller must hold mu.
+func (w *Writer) flush() {
+	if err := w.buf.Flush(); err != nil {
+		w.stats.LastError = err.Error()
+		// Throw the lines away rather than retrying them forever; the
+		// next flush starts clean.
+		w.buf.Reset(w.f)
+	}
+}
+
+// rotated reports whether the path no longer names the open file. Caller
+// must hold mu.
+func (w *Writer) rotated() bool {
+	onDisk, err := os.Stat(w.path)
+	if err != nil {
+		return true
+	}
+	open, err := w.f.Stat()
+	return err != nil || !os.SameFile(onDisk, open)
+}
+
+// reopenLocked flushes to the old file and switches to a new one at path,
+// keeping the old one if that fails. Caller must hold mu.
+func (w *Writer) reopenLocked() {
+	w.flush()
+	old := w.f
+	if err := w.open(); err != nil {
+		w.stats.LastError = err.Error()
+		return
+	}
+	old.Close()
+	w.stats.Reopened++
+}
+
+// open opens the file at path for appending.
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("event log: %w", err)
+	}
+	w.f = f
+	if w.buf == nil {
+		w.buf = bufio.NewWriter(f)
+	} else {
+		w.buf.Reset(f)
+	}
+	return nil
+}
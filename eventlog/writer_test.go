@@ -0,0 +1,228 @@
+package eventlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// fastChecks has the writer flush and look for rotation every few
+// milliseconds for the rest of the test.
+func fastChecks(t *testing.T) {
+	old := checkEvery
+	checkEvery = 5 * time.Millisecond
+	t.Cleanup(func() { checkEvery = old })
+}
+
+func marker(name string) tracker.Event {
+	return tracker.Event{Time: at, Severity: tracker.SeverityInfo, Kind: tracker.EventMarker,
+		Fields: []tracker.EventField{{Key: "name", Value: name}}}
+}
+
+// markers returns the name of each marker line in the file at path.
+func markers(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if _, name, ok := strings.Cut(line, " name="); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// waitFor polls until ok holds, failing the test after two seconds.
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !ok(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriterFlushesAndCloses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	if err := os.WriteFile(path, []byte("kept\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Open(path, tracker.SeverityInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		w.LogEvent(marker(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "kept\n") {
+		t.Errorf("existing lines not kept: %q", data)
+	}
+	if got := strings.Join(markers(t, path), ","); got != "a,b,c" {
+		t.Errorf("markers = %s, want a,b,c", got)
+	}
+	if s := w.Stats(); s.Written != 3 || s.Dropped != 0 || s.Reopened != 0 || s.LastError != "" {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestWriterFloor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	w, err := Open(path, tracker.SeverityWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := func(name string, sev tracker.Severity) {
+		e := marker(name)
+		e.Severity = sev
+		w.LogEvent(e)
+	}
+	ev("info", tracker.SeverityInfo)
+	ev("warn", tracker.SeverityWarn)
+	ev("crit", tracker.SeverityCrit)
+	w.SetFloor(tracker.SeverityCrit)
+	ev("warn2", tracker.SeverityWarn)
+	ev("crit2", tracker.SeverityCrit)
+	w.SetFloor(tracker.SeverityInfo)
+	ev("info2", tracker.SeverityInfo)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(markers(t, path), ","); got != "warn,crit,crit2,info2" {
+		t.Errorf("markers = %s, want warn,crit,crit2,info2", got)
+	}
+}
+
+// TestWriterRename rotates the way logrotate's create method does: the
+// file is renamed away mid-run and the writer must notice and carry on in
+// a new file at the path, without a SIGHUP.
+func TestWriterRename(t *testing.T) {
+	fastChecks(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	rotated := path + ".1"
+	w, err := Open(path, tracker.SeverityInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.LogEvent(marker("before"))
+	waitFor(t, "the first line", func() bool { return w.Stats().Written == 1 })
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reopen", func() bool { return w.Stats().Reopened == 1 })
+	w.LogEvent(marker("after"))
+	w.LogEvent(marker("later"))
+	waitFor(t, "the new file", func() bool {
+		data, _ := os.ReadFile(path)
+		return strings.Count(string(data), "\n") == 2
+	})
+
+	if got := strings.Join(markers(t, rotated), ","); got != "before" {
+		t.Errorf("rotated file has %s, want before", got)
+	}
+	if got := strings.Join(markers(t, path), ","); got != "after,later" {
+		t.Errorf("new file has %s, want after,later", got)
+	}
+	if s := w.Stats(); s.LastError != "" {
+		t.Errorf("last error = %s", s.LastError)
+	}
+}
+
+// TestWriterDeleted carries on in a new file when the log is deleted.
+func TestWriterDeleted(t *testing.T) {
+	fastChecks(t)
+	path := filepath.Join(t.TempDir(), "events.log")
+	w, err := Open(path, tracker.SeverityInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.LogEvent(marker("gone"))
+	waitFor(t, "the first line", func() bool { return w.Stats().Written == 1 })
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reopen", func() bool { return w.Stats().Reopened == 1 })
+	w.LogEvent(marker("back"))
+	waitFor(t, "the new file", func() bool {
+		data, _ := os.ReadFile(path)
+		return strings.Contains(string(data), "name=back")
+	})
+}
+
+// TestWriterTruncate rotates the way copytruncate does: the path keeps
+// naming the same file, which is emptied under the writer. Appends land
+// at the new end, with no reopen and no hole of zero bytes.
+func TestWriterTruncate(t *testing.T) {
+	fastChecks(t)
+	path := filepath.Join(t.TempDir(), "events.log")
+	w, err := Open(path, tracker.SeverityInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.LogEvent(marker("copied"))
+	waitFor(t, "the first line", func() bool {
+		data, _ := os.ReadFile(path)
+		return len(data) > 0
+	})
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	w.LogEvent(marker("fresh"))
+	waitFor(t, "the line after truncating", func() bool {
+		data, _ := os.ReadFile(path)
+		return len(data) > 0
+	})
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "2026-") {
+		t.Errorf("file after truncating starts %q", data[:min(len(data), 16)])
+	}
+	if got := strings.Join(markers(t, path), ","); got != "fresh" {
+		t.Errorf("markers = %s, want fresh", got)
+	}
+	if s := w.Stats(); s.Reopened != 0 {
+		t.Errorf("reopened %d times on copytruncate", s.Reopened)
+	}
+}
+
+// TestWriterReopen reopens on request, as SIGHUP does, even when the path
+// still names the open file.
+func TestWriterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	w, err := Open(path, tracker.SeverityInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.LogEvent(marker("one"))
+	w.Reopen()
+	waitFor(t, "the reopen", func() bool { return w.Stats().Reopened == 1 })
+	w.LogEvent(marker("two"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(markers(t, path), ","); got != "one,two" {
+		t.Errorf("markers = %s, want one,two", got)
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing", "events.log"), tracker.SeverityInfo)
+	if err == nil || !strings.HasPrefix(err.Error(), "event log: ") {
+		t.Errorf("Open in a missing directory: %v", err)
+	}
+}
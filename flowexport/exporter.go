@@ -0,0 +1,189 @@
+// Package flowexport sends a flow record for every tracked connection that
+// ends, as IPFIX (RFC 7011) or JSON over UDP.
+package flowexport
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+const (
+	// queueSize bounds the records waiting to be sent; more are dropped.
+	queueSize = 1024
+	// flushInterval is how long records may wait to share a message.
+	flushInterval = time.Second
+	// maxMessage keeps IPFIX messages below a typical path MTU.
+	maxMessage = 1400
+	// templateRefresh is how often templates are resent over UDP, where the
+	// collector may have missed them (RFC 7011 section 8.4).
+	templateRefresh = 10 * time.Minute
+)
+
+// Record is one exported flow.
+type Record struct {
+	Protocol string        `json:"protocol"` // tcp, tcp6, udp or udp6
+	SrcAddr  string        `json:"src_addr"`
+	SrcPort  int           `json:"src_port"`
+	DstAddr  string        `json:"dst_addr"`
+	DstPort  int           `json:"dst_port"`
+	TxBytes  uint64        `json:"tx_bytes"`
+	RxBytes  uint64        `json:"rx_bytes"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	App      string        `json:"app"`
+	PID      int           `json:"pid"`
+	RTT      time.Duration `json:"rtt_ns"`
+	Loss     float64       `json:"loss_pct"`
+}
+
+// IsIPv6 reports whether the record's addresses are IPv6.
+func (r Record) IsIPv6() bool {
+	ip := net.ParseIP(r.SrcAddr)
+	return ip != nil && ip.To4() == nil
+}
+
+// ProtocolNumber is the IP protocol number (6 for TCP, 17 for UDP).
+func (r Record) ProtocolNumber() byte {
+	if strings.HasPrefix(r.Protocol, "udp") {
+		return 17
+	}
+	return 6
+}
+
+// Exporter queues records and sends them from its own goroutine, so the
+// tracker's scan never waits on the network.
+type Exporter struct {
+	conn    net.Conn
+	format  string
+	profile *Profile
+	queue   chan Record
+	done    chan struct{}
+
+	seq          uint32
+	lastTemplate time.Time
+}
+
+// New creates an exporter for a target of the form udp:host:port. format
+// is "ipfix" or "json"; profile names the JSON fields and may be nil for
+// the default names.
+func New(target, format string, profile *Profile) (*Exporter, error) {
+	addr, ok := strings.CutPrefix(target, "udp:")
+	if !ok {
+		return nil, fmt.Errorf("flow export target %q: want udp:host:port", target)
+	}
+	if format != "ipfix" && format != "json" {
+		return nil, fmt.Errorf("unknown flow format %q (want ipfix or json)", format)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		profile = Profiles[0]
+	}
+	e := &Exporter{
+		conn:    conn,
+		format:  format,
+		profile: profile,
+		queue:   make(chan Record, queueSize),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// ExportFlow implements tracker.FlowSink. It never blocks; when the queue is
+// full the record is dropped.
+func (e *Exporter) ExportFlow(c tracker.Connection, start, end time.Time) {
+	select {
+	case e.queue <- NewRecord(c, start, end):
+	default:
+	}
+}
+
+// NewRecord is the flow record of c between start and end.
+func NewRecord(c tracker.Connection, start, end time.Time) Record {
+	return Record{
+		Protocol: c.Protocol,
+		SrcAddr:  c.LocalAddr,
+		SrcPort:  c.LocalPort,
+		DstAddr:  c.RemoteAddr,
+		DstPort:  c.RemotePort,
+		TxBytes:  c.TxBytes,
+		RxBytes:  c.RxBytes,
+		Start:    start,
+		End:      end,
+		App:      c.AppName,
+		PID:      c.PID,
+		RTT:      c.Ping,
+		Loss:     c.Loss,
+	}
+}
+
+// Close sends the queued records and closes the socket.
+func (e *Exporter) Close() error {
+	close(e.queue)
+	<-e.done
+	return e.conn.Close()
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var pending []Record
+	for {
+		select {
+		case r, ok := <-e.queue:
+			if !ok {
+				e.flush(pending)
+				return
+			}
+			pending = append(pending, r)
+			if e.format == "json" || len(pending) >= e.batchSize() {
+				e.flush(pending)
+				pending = pending[:0]
+			}
+		case <-ticker.C:
+			e.flush(pending)
+			pending = pending[:0]
+		}
+	}
+}
+
+// batchSize is how many records fit in one IPFIX message, assuming IPv6
+// addresses, the longest app name encoded (maxAppName) and room for the
+// template set (140 bytes for both templates).
+func (e *Exporter) batchSize() int {
+	const perRecord = 16 + 16 + 2 + 2 + 1 + 8 + 8 + 8 + 8 + 4 + 2 + 1 + maxAppName
+	return (maxMessage - messageHeaderLen - 2*setHeaderLen - 160) / perRecord
+}
+
+// flush sends pending records. Send errors are ignored: UDP export is best
+// effort and the collector may simply be down.
+func (e *Exporter) flush(pending []Record) {
+	if len(pending) == 0 {
+		return
+	}
+	if e.format == "json" {
+		for _, r := range pending {
+			if data, err := e.profile.MarshalRecord(r); err == nil {
+				e.conn.Write(data)
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	withTemplate := e.lastTemplate.IsZero() || now.Sub(e.lastTemplate) >= templateRefresh
+	msg := encodeMessage(pending, withTemplate, e.seq, 0, now)
+	if _, err := e.conn.Write(msg); err == nil && withTemplate {
+		e.lastTemplate = now
+	}
+	e.seq += uint32(len(pending))
+}
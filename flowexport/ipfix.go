@@ -0,0 +1,186 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// IPFIX constants from RFC 7011.
+const (
+	ipfixVersion     = 10
+	templateSetID    = 2
+	templateIDv4     = 256
+	templateIDv6     = 257
+	variableLength   = 0xFFFF
+	enterpriseBit    = 0x8000
+	messageHeaderLen = 16
+	setHeaderLen     = 4
+)
+
+// maxAppName caps the encoded app name so a full batch fits in one message.
+const maxAppName = 64
+
+// privateEnterprise is the enterprise number of the ping-tracker specific
+// information elements. 32473 is reserved for documentation (RFC 5612).
+const privateEnterprise = 32473
+
+// fieldSpec is one field specifier of a template record.
+type fieldSpec struct {
+	id         uint16
+	length     uint16
+	enterprise bool
+}
+
+// IANA information elements, plus enterprise-specific ones for the
+// measurements IPFIX has no standard element for.
+var (
+	ieOctetTotalCount   = fieldSpec{id: 85, length: 8}
+	ieProtocol          = fieldSpec{id: 4, length: 1}
+	ieSourcePort        = fieldSpec{id: 7, length: 2}
+	ieDestinationPort   = fieldSpec{id: 11, length: 2}
+	ieSourceIPv4        = fieldSpec{id: 8, length: 4}
+	ieDestinationIPv4   = fieldSpec{id: 12, length: 4}
+	ieSourceIPv6        = fieldSpec{id: 27, length: 16}
+	ieDestinationIPv6   = fieldSpec{id: 28, length: 16}
+	ieFlowStartMillis   = fieldSpec{id: 152, length: 8}
+	ieFlowEndMillis     = fieldSpec{id: 153, length: 8}
+	ieRxOctets          = fieldSpec{id: 1, length: 8, enterprise: true}
+	ieRTTMicros         = fieldSpec{id: 2, length: 4, enterprise: true}
+	ieLossHundredthsPct = fieldSpec{id: 3, length: 2, enterprise: true}
+	ieAppName           = fieldSpec{id: 4, length: variableLength, enterprise: true}
+)
+
+// templateFields returns the field layout for the IPv4 or IPv6 template.
+func templateFields(v6 bool) []fieldSpec {
+	src, dst := ieSourceIPv4, ieDestinationIPv4
+	if v6 {
+		src, dst = ieSourceIPv6, ieDestinationIPv6
+	}
+	return []fieldSpec{
+		src, dst, ieSourcePort, ieDestinationPort, ieProtocol,
+		ieOctetTotalCount, ieRxOctets, ieFlowStartMillis, ieFlowEndMillis,
+		ieRTTMicros, ieLossHundredthsPct, ieAppName,
+	}
+}
+
+// appendTemplateSet appends a template set describing both templates.
+func appendTemplateSet(b []byte) []byte {
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, templateSetID)
+	b = binary.BigEndian.AppendUint16(b, 0) // length, patched below
+	for _, v6 := range []bool{false, true} {
+		id := uint16(templateIDv4)
+		if v6 {
+			id = templateIDv6
+		}
+		fields := templateFields(v6)
+		b = binary.BigEndian.AppendUint16(b, id)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(fields)))
+		for _, f := range fields {
+			if f.enterprise {
+				b = binary.BigEndian.AppendUint16(b, f.id|enterpriseBit)
+				b = binary.BigEndian.AppendUint16(b, f.length)
+				b = binary.BigEndian.AppendUint32(b, privateEnterprise)
+			} else {
+				b = binary.BigEndian.AppendUint16(b, f.id)
+				b = binary.BigEndian.AppendUint16(b, f.length)
+			}
+		}
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+// appendDataRecord appends one record laid out as templateFields(v6).
+func appendDataRecord(b []byte, r Record, v6 bool) []byte {
+	ip := func(s string) []byte {
+		p := net.ParseIP(s)
+		if v6 {
+			if p16 := p.To16(); p16 != nil {
+				return p16
+			}
+			return make([]byte, 16)
+		}
+		if p4 := p.To4(); p4 != nil {
+			return p4
+		}
+		return make([]byte, 4)
+	}
+	b = append(b, ip(r.SrcAddr)...)
+	b = append(b, ip(r.DstAddr)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(r.SrcPort))
+	b = binary.BigEndian.AppendUint16(b, uint16(r.DstPort))
+	b = append(b, r.ProtocolNumber())
+	b = binary.BigEndian.AppendUint64(b, r.TxBytes)
+	b = binary.BigEndian.AppendUint64(b, r.RxBytes)
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Start.UnixMilli()))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.End.UnixMilli()))
+	b = binary.BigEndian.AppendUint32(b, uint32(r.RTT/time.Microsecond))
+	b = binary.BigEndian.AppendUint16(b, uint16(r.Loss*100))
+	app := r.App
+	if len(app) > maxAppName {
+		app = app[:maxAppName]
+	}
+	return appendVariable(b, []byte(app))
+}
+
+// appendVariable encodes a variable-length field (RFC 7011 section 7).
+func appendVariable(b, v []byte) []byte {
+	if len(v) > 0xFFFF {
+		v = v[:0xFFFF]
+	}
+	if len(v) < 255 {
+		b = append(b, byte(len(v)))
+	} else {
+		b = append(b, 255)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	}
+	return append(b, v...)
+}
+
+// appendDataSet appends a data set for one template holding recs.
+func appendDataSet(b []byte, recs []Record, v6 bool) []byte {
+	if len(recs) == 0 {
+		return b
+	}
+	id := uint16(templateIDv4)
+	if v6 {
+		id = templateIDv6
+	}
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, id)
+	b = binary.BigEndian.AppendUint16(b, 0)
+	for _, r := range recs {
+		b = appendDataRecord(b, r, v6)
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+// encodeMessage builds an IPFIX message. seq is the number of data records
+// sent before this message, as required for the header's sequence number.
+func encodeMessage(recs []Record, withTemplate bool, seq uint32, domain uint32, now time.Time) []byte {
+	b := make([]byte, messageHeaderLen, 512)
+	binary.BigEndian.PutUint16(b[0:], ipfixVersion)
+	binary.BigEndian.PutUint32(b[4:], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(b[8:], seq)
+	binary.BigEndian.PutUint32(b[12:], domain)
+
+	if withTemplate {
+		b = appendTemplateSet(b)
+	}
+	var v4, v6 []Record
+	for _, r := range recs {
+		if r.IsIPv6() {
+			v6 = append(v6, r)
+		} else {
+			v4 = append(v4, r)
+		}
+	}
+	b = appendDataSet(b, v4, false)
+	b = appendDataSet(b, v6, true)
+
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+	return b
+}
@@ -0,0 +1,211 @@
+package flowexport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRecord = Record{
+	Protocol: "tcp",
+	SrcAddr:  "192.0.2.10", SrcPort: 40001,
+	DstAddr: "198.51.100.7", DstPort: 443,
+	TxBytes: 1500, RxBytes: 90000,
+	Start: time.UnixMilli(1700000000123), End: time.UnixMilli(1700000060456),
+	App: "curl", RTT: 12345 * time.Microsecond, Loss: 2.5,
+}
+
+// ipfixSet is one set of a decoded message.
+type ipfixSet struct {
+	id   uint16
+	body []byte
+}
+
+// splitMessage checks the message header (RFC 7011 section 3.1) and splits
+// the message into its sets.
+func splitMessage(t *testing.T, msg []byte) (seq, domain uint32, sets []ipfixSet) {
+	t.Helper()
+	if len(msg) < messageHeaderLen {
+		t.Fatalf("message of %d bytes", len(msg))
+	}
+	if v := binary.BigEndian.Uint16(msg[0:]); v != 10 {
+		t.Fatalf("version %d, want 10", v)
+	}
+	if n := binary.BigEndian.Uint16(msg[2:]); int(n) != len(msg) {
+		t.Fatalf("header length %d, message is %d bytes", n, len(msg))
+	}
+	seq, domain = binary.BigEndian.Uint32(msg[8:]), binary.BigEndian.Uint32(msg[12:])
+	rest := msg[messageHeaderLen:]
+	for len(rest) > 0 {
+		if len(rest) < setHeaderLen {
+			t.Fatalf("%d trailing bytes", len(rest))
+		}
+		id, n := binary.BigEndian.Uint16(rest), int(binary.BigEndian.Uint16(rest[2:]))
+		if n < setHeaderLen || n > len(rest) {
+			t.Fatalf("set %d: length %d with %d bytes left", id, n, len(rest))
+		}
+		sets = append(sets, ipfixSet{id, rest[setHeaderLen:n]})
+		rest = rest[n:]
+	}
+	return seq, domain, sets
+}
+
+func TestIPFIXHeader(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+	msg := encodeMessage([]Record{testRecord}, false, 42, 7, now)
+	seq, domain, sets := splitMessage(t, msg)
+	if seq != 42 || domain != 7 {
+		t.Errorf("sequence %d, domain %d", seq, domain)
+	}
+	if got := binary.BigEndian.Uint32(msg[4:]); got != uint32(now.Unix()) {
+		t.Errorf("export time %d", got)
+	}
+	if len(sets) != 1 || sets[0].id != templateIDv4 {
+		t.Fatalf("sets %+v, want one IPv4 data set", sets)
+	}
+}
+
+// TestIPFIXTemplateSet checks the template records field by field (RFC 7011
+// sections 3.4.1 and 3.2): enterprise elements carry the enterprise bit
+// and a 4-byte enterprise number, standard ones only id and length.
+func TestIPFIXTemplateSet(t *testing.T) {
+	_, _, sets := splitMessage(t, encodeMessage(nil, true, 0, 0, time.Unix(0, 0)))
+	if len(sets) != 1 || sets[0].id != templateSetID {
+		t.Fatalf("sets %+v, want only the template set", sets)
+	}
+	body := sets[0].body
+	for _, tmpl := range []struct {
+		id     uint16
+		fields []fieldSpec
+	}{{templateIDv4, templateFields(false)}, {templateIDv6, templateFields(true)}} {
+		if id, n := binary.BigEndian.Uint16(body), binary.BigEndian.Uint16(body[2:]); id != tmpl.id || int(n) != len(tmpl.fields) {
+			t.Fatalf("template %d with %d fields, want %d with %d", id, n, tmpl.id, len(tmpl.fields))
+		}
+		body = body[4:]
+		for i, f := range tmpl.fields {
+			id, length := binary.BigEndian.Uint16(body), binary.BigEndian.Uint16(body[2:])
+			body = body[4:]
+			if f.enterprise {
+				if id != f.id|0x8000 || binary.BigEndian.Uint32(body) != privateEnterprise {
+					t.Errorf("template %d field %d: id %#x, enterprise %d", tmpl.id, i, id, binary.BigEndian.Uint32(body))
+				}
+				body = body[4:]
+			} else if id != f.id {
+				t.Errorf("template %d field %d: id %d, want %d", tmpl.id, i, id, f.id)
+			}
+			if length != f.length {
+				t.Errorf("template %d field %d: length %d, want %d", tmpl.id, i, length, f.length)
+			}
+		}
+	}
+	if len(body) != 0 {
+		t.Fatalf("%d bytes after the templates", len(body))
+	}
+}
+
+func TestIPFIXDataRecord(t *testing.T) {
+	want := []byte{
+		192, 0, 2, 10, // sourceIPv4Address
+		198, 51, 100, 7, // destinationIPv4Address
+		0x9c, 0x41, // sourceTransportPort 40001
+		0x01, 0xbb, // destinationTransportPort 443
+		6,                            // protocolIdentifier
+		0, 0, 0, 0, 0, 0, 0x05, 0xdc, // octetTotalCount 1500
+		0, 0, 0, 0, 0, 0x01, 0x5f, 0x90, // rx octets 90000
+		0, 0, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x7b, // flowStartMilliseconds
+		0, 0, 0x01, 0x8b, 0xcf, 0xe6, 0x54, 0x28, // flowEndMilliseconds
+		0, 0, 0x30, 0x39, // RTT 12345 us
+		0, 250, // loss 2.50%
+		4, 'c', 'u', 'r', 'l', // app name, short variable length
+	}
+	if got := appendDataRecord(nil, testRecord, false); !bytes.Equal(got, want) {
+		t.Fatalf("record\n got % x\nwant % x", got, want)
+	}
+
+	v6 := testRecord
+	v6.SrcAddr, v6.DstAddr = "2001:db8::1", "2001:db8::2"
+	_, _, sets := splitMessage(t, encodeMessage([]Record{testRecord, v6}, false, 0, 0, time.Unix(0, 0)))
+	if len(sets) != 2 || sets[0].id != templateIDv4 || sets[1].id != templateIDv6 {
+		t.Fatalf("sets %+v, want an IPv4 and an IPv6 data set", sets)
+	}
+	if rec := sets[1].body; len(rec) != len(want)+24 || !bytes.Equal(rec[:16], net.ParseIP("2001:db8::1")) {
+		t.Fatalf("IPv6 record % x", rec)
+	}
+}
+
+// TestIPFIXVariableLength checks both encodings of RFC 7011 section 7: one
+// length byte below 255, else 255 followed by a 2-byte length.
+func TestIPFIXVariableLength(t *testing.T) {
+	if got := appendVariable(nil, []byte("ab")); !bytes.Equal(got, []byte{2, 'a', 'b'}) {
+		t.Errorf("short: % x", got)
+	}
+	long := bytes.Repeat([]byte{'x'}, 300)
+	got := appendVariable(nil, long)
+	if !bytes.Equal(got[:3], []byte{255, 0x01, 0x2c}) || len(got) != 303 {
+		t.Errorf("long: % x... (%d bytes)", got[:3], len(got))
+	}
+
+	r := testRecord
+	r.App = strings.Repeat("a", 200)
+	rec := appendDataRecord(nil, r, false)
+	if n := rec[len(rec)-maxAppName-1]; n != maxAppName {
+		t.Errorf("app name length %d, want it capped at %d", n, maxAppName)
+	}
+}
+
+// TestIPFIXTemplateRetransmission sends through a real exporter: the
+// template goes out with the first message and again once templateRefresh
+// has passed, and the sequence number counts data records.
+func TestIPFIXTemplateRetransmission(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	e, err := New("udp:"+pc.LocalAddr().String(), "ipfix", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	receive := func() (uint32, bool) {
+		buf := make([]byte, 65536)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq, _, sets := splitMessage(t, buf[:n])
+		return seq, sets[0].id == templateSetID
+	}
+
+	e.flush([]Record{testRecord, testRecord})
+	if seq, tmpl := receive(); seq != 0 || !tmpl {
+		t.Fatalf("first message: sequence %d, template %v", seq, tmpl)
+	}
+	e.flush([]Record{testRecord})
+	if seq, tmpl := receive(); seq != 2 || tmpl {
+		t.Fatalf("second message: sequence %d, template %v", seq, tmpl)
+	}
+	e.lastTemplate = e.lastTemplate.Add(-templateRefresh)
+	e.flush([]Record{testRecord})
+	if seq, tmpl := receive(); seq != 3 || !tmpl {
+		t.Fatalf("after the refresh interval: sequence %d, template %v", seq, tmpl)
+	}
+}
+
+func TestIPFIXBatchFits(t *testing.T) {
+	r := testRecord
+	r.SrcAddr, r.DstAddr = "2001:db8::1", "2001:db8::2"
+	r.App = strings.Repeat("a", maxAppName)
+	recs := make([]Record, (&Exporter{}).batchSize())
+	for i := range recs {
+		recs[i] = r
+	}
+	if msg := encodeMessage(recs, true, 0, 0, time.Unix(0, 0)); len(msg) > maxMessage {
+		t.Fatalf("full batch is %d bytes, over %d", len(msg), maxMessage)
+	}
+}
@@ -0,0 +1,211 @@
+package flowexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields are the record fields in output order, by their default names.
+var Fields = []string{
+	"protocol", "src_addr", "src_port", "dst_addr", "dst_port",
+	"tx_bytes", "rx_bytes", "start", "end", "app", "pid", "rtt_ns", "loss_pct",
+}
+
+// Profile renames record fields for the JSON flow format and for snapshots
+// served with ?profile=, so the output matches what other tools expect.
+// Only names change; values keep their units and formats. Fields a profile
+// does not rename keep their default name.
+type Profile struct {
+	Name  string
+	names map[string]string // default name -> output name
+}
+
+// Profiles are the built-in profiles. The wireshark profile uses the
+// display filter names of the IPv4 and TCP fields for every record, so a
+// column keeps one name whatever the record's family and protocol.
+var Profiles = []*Profile{
+	{Name: "default"},
+	{Name: "wireshark", names: map[string]string{
+		"protocol": "ip.proto",
+		"src_addr": "ip.src",
+		"src_port": "tcp.srcport",
+		"dst_addr": "ip.dst",
+		"dst_port": "tcp.dstport",
+	}},
+	{Name: "ntopng", names: map[string]string{
+		"protocol": "PROTOCOL",
+		"src_addr": "IPV4_SRC_ADDR",
+		"src_port": "L4_SRC_PORT",
+		"dst_addr": "IPV4_DST_ADDR",
+		"dst_port": "L4_DST_PORT",
+		"tx_bytes": "OUT_BYTES",
+		"rx_bytes": "IN_BYTES",
+		"start":    "FIRST_SWITCHED",
+		"end":      "LAST_SWITCHED",
+		"app":      "SRC_PROC_NAME",
+		"pid":      "SRC_PROC_PID",
+	}},
+}
+
+// FindProfile returns the built-in profile called name, or nil.
+func FindProfile(name string) *Profile {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// LoadProfile returns the built-in profile called spec, or else reads a
+// custom mapping from the JSON file spec, e.g. {"src_addr": "source"}. A
+// custom profile is called "custom".
+func LoadProfile(spec string) (*Profile, error) {
+	if p := FindProfile(spec); p != nil {
+		return p, nil
+	}
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		names := make([]string, len(Profiles))
+		for i, p := range Profiles {
+			names[i] = p.Name
+		}
+		return nil, fmt.Errorf("export profile %q: not a built-in profile (%s) or a readable mapping file: %v",
+			spec, strings.Join(names, ", "), err)
+	}
+	var names map[string]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("export profile %s: %v", spec, err)
+	}
+	p, err := NewProfile("custom", names)
+	if err != nil {
+		return nil, fmt.Errorf("export profile %s: %v", spec, err)
+	}
+	return p, nil
+}
+
+// NewProfile builds a profile from renames keyed by default field name.
+// Every key must be one of Fields, and no two fields may end up with the
+// same name.
+func NewProfile(name string, names map[string]string) (*Profile, error) {
+	valid := make(map[string]bool, len(Fields))
+	for _, f := range Fields {
+		valid[f] = true
+	}
+	var unknown []string
+	for f, to := range names {
+		if !valid[f] {
+			unknown = append(unknown, f)
+		} else if to == "" {
+			return nil, fmt.Errorf("empty name for field %q", f)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown fields %s (valid fields: %s)",
+			strings.Join(unknown, ", "), strings.Join(Fields, ", "))
+	}
+	p := &Profile{Name: name, names: names}
+	seen := make(map[string]string, len(Fields))
+	for _, f := range Fields {
+		key := p.Key(f)
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("fields %q and %q are both named %q", other, f, key)
+		}
+		seen[key] = f
+	}
+	return p, nil
+}
+
+// Key is the output name of the field with default name field.
+func (p *Profile) Key(field string) string {
+	if to, ok := p.names[field]; ok {
+		return to
+	}
+	return field
+}
+
+// Header is the output names of Fields, in order.
+func (p *Profile) Header() []string {
+	h := make([]string, len(Fields))
+	for i, f := range Fields {
+		h[i] = p.Key(f)
+	}
+	return h
+}
+
+// values are r's fields in the order of Fields.
+func (r Record) values() []any {
+	return []any{
+		r.Protocol, r.SrcAddr, r.SrcPort, r.DstAddr, r.DstPort,
+		r.TxBytes, r.RxBytes, r.Start, r.End, r.App, r.PID, r.RTT, r.Loss,
+	}
+}
+
+// MarshalRecord encodes r as a JSON object keyed by the profile's names, in
+// the order of Fields. With the default profile the result is the same as
+// json.Marshal(r).
+func (p *Profile) MarshalRecord(r Record) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, v := range r.values() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(p.Key(Fields[i]))
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// WriteCSV writes a header row with the profile's names and one row per
+// record. Times are RFC 3339, the RTT is in nanoseconds.
+func (p *Profile) WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write(p.Header())
+	row := make([]string, len(Fields))
+	for _, r := range records {
+		for i, v := range r.values() {
+			row[i] = csvValue(v)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,159 @@
+package flowexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuiltinProfiles checks each built-in profile against the names the
+// README documents.
+func TestBuiltinProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"default", Fields},
+		{"wireshark", []string{
+			"ip.proto", "ip.src", "tcp.srcport", "ip.dst", "tcp.dstport",
+			"tx_bytes", "rx_bytes", "start", "end", "app", "pid", "rtt_ns", "loss_pct",
+		}},
+		{"ntopng", []string{
+			"PROTOCOL", "IPV4_SRC_ADDR", "L4_SRC_PORT", "IPV4_DST_ADDR", "L4_DST_PORT",
+			"OUT_BYTES", "IN_BYTES", "FIRST_SWITCHED", "LAST_SWITCHED", "SRC_PROC_NAME", "SRC_PROC_PID",
+			"rtt_ns", "loss_pct",
+		}},
+	}
+	for _, tt := range tests {
+		p, err := LoadProfile(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != tt.name {
+			t.Errorf("LoadProfile(%q) is called %q", tt.name, p.Name)
+		}
+		if got := p.Header(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s header:\n got %v\nwant %v", tt.name, got, tt.want)
+		}
+		checkPairing(t, p, testRecord)
+	}
+}
+
+func TestDefaultProfileMatchesJSON(t *testing.T) {
+	r := testRecord
+	want, _ := json.Marshal(r)
+	got, err := FindProfile("default").MarshalRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("default profile:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestCustomProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fields.json")
+	if err := os.WriteFile(path, []byte(`{"src_addr": "source", "dst_addr": "destination", "rtt_ns": "latency"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "custom" {
+		t.Errorf("custom profile is called %q", p.Name)
+	}
+	h := p.Header()
+	if h[1] != "source" || h[3] != "destination" || h[11] != "latency" || h[0] != "protocol" {
+		t.Errorf("header %v", h)
+	}
+	checkPairing(t, p, testRecord)
+}
+
+// checkPairing round-trips r through the profile's JSON and CSV forms and
+// checks both put every value under the same name.
+func checkPairing(t *testing.T, p *Profile, r Record) {
+	t.Helper()
+	data, err := p.MarshalRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatalf("%s: %v in %s", p.Name, err, data)
+	}
+	if len(obj) != len(Fields) {
+		t.Errorf("%s: %d JSON keys, want %d", p.Name, len(obj), len(Fields))
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteCSV(&buf, []Record{r}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !slices.Equal(rows[0], p.Header()) {
+		t.Fatalf("%s: CSV %v", p.Name, rows)
+	}
+	for i, name := range rows[0] {
+		raw, ok := obj[name]
+		if !ok {
+			t.Errorf("%s: CSV column %q missing from the JSON", p.Name, name)
+			continue
+		}
+		// JSON strings are quoted; the CSV cell holds the bare value.
+		want := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			want = s
+		}
+		got := rows[1][i]
+		if Fields[i] == "start" || Fields[i] == "end" {
+			a, _ := time.Parse(time.RFC3339Nano, got)
+			b, _ := time.Parse(time.RFC3339Nano, want)
+			if !a.Equal(b) {
+				t.Errorf("%s: %s is %q in CSV and %q in JSON", p.Name, name, got, want)
+			}
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: %s is %q in CSV and %q in JSON", p.Name, name, got, want)
+		}
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		names map[string]string
+		want  string
+	}{
+		{"unknown", map[string]string{"src_ip": "source", "dport": "port"}, "unknown fields dport, src_ip (valid fields: protocol, src_addr"},
+		{"empty", map[string]string{"app": ""}, `empty name for field "app"`},
+		{"duplicate", map[string]string{"src_addr": "addr", "dst_addr": "addr"}, `fields "src_addr" and "dst_addr" are both named "addr"`},
+		{"clash with a default", map[string]string{"app": "pid"}, `fields "app" and "pid" are both named "pid"`},
+	}
+	for _, tt := range tests {
+		_, err := NewProfile("custom", tt.names)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := LoadProfile("netflow"); err == nil || !strings.Contains(err.Error(), "default, wireshark, ntopng") {
+		t.Errorf("unknown profile: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "bad.json")
+	os.WriteFile(path, []byte(`["src_addr"]`), 0o644)
+	if _, err := LoadProfile(path); err == nil {
+		t.Error("a JSON array loaded as a mapping")
+	}
+}
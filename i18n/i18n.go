@@ -0,0 +1,179 @@
+// Package i18n holds the TUI's message catalogs and the locale's number
+// formatting. Catalogs are flat JSON files of key to text, embedded per
+// language; a key missing from one falls back to English. Logs and
+// exports do not go through it and stay locale-invariant.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// decimalKey and groupKey are the catalog entries holding the decimal
+// and the thousands separator.
+const (
+	decimalKey = "number.decimal"
+	groupKey   = "number.group"
+)
+
+// Locale is a loaded catalog.
+type Locale struct {
+	Lang     string
+	msgs     map[string]string
+	fallback map[string]string // English; nil for English itself
+	decimal  string
+	group    string
+}
+
+// Languages lists the languages with a catalog, e.g. "de".
+func Languages() []string {
+	entries, _ := catalogFiles.ReadDir("catalogs")
+	langs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return langs
+}
+
+// Catalog returns the raw entries of lang's catalog.
+func Catalog(lang string) (map[string]string, error) {
+	data, err := catalogFiles.ReadFile(path.Join("catalogs", lang+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no catalog for language %q (have %s)", lang, strings.Join(Languages(), ", "))
+	}
+	var msgs map[string]string
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("catalog %s: %w", lang, err)
+	}
+	return msgs, nil
+}
+
+// English is the built-in catalog, used when no other is selected.
+func English() *Locale {
+	l, err := New("en")
+	if err != nil {
+		panic(err) // the embedded catalog is broken
+	}
+	return l
+}
+
+// New loads the catalog of lang, a language code such as "de".
+func New(lang string) (*Locale, error) {
+	msgs, err := Catalog(lang)
+	if err != nil {
+		return nil, err
+	}
+	l := &Locale{Lang: lang, msgs: msgs}
+	if lang != "en" {
+		if l.fallback, err = Catalog("en"); err != nil {
+			return nil, err
+		}
+	}
+	l.decimal = l.T(decimalKey)
+	l.group = l.T(groupKey)
+	return l, nil
+}
+
+// FromEnv returns the language of the locale environment (LC_ALL,
+// LC_MESSAGES, then LANG), e.g. "de" for de_DE.UTF-8; "en" when unset or
+// the C locale.
+func FromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		lang, _, _ := strings.Cut(v, "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		lang = strings.ToLower(lang)
+		if lang == "c" || lang == "posix" {
+			return "en"
+		}
+		return lang
+	}
+	return "en"
+}
+
+// Select loads lang, or the environment's language when lang is "". An
+// environment language without a catalog is English, an explicit one an
+// error.
+func Select(lang string) (*Locale, error) {
+	if lang != "" {
+		return New(lang)
+	}
+	if env := FromEnv(); slices.Contains(Languages(), env) {
+		return New(env)
+	}
+	return English(), nil
+}
+
+// T returns the text of key: the locale's own, else English, else the
+// key itself, so a missing entry shows up instead of a blank.
+func (l *Locale) T(key string) string {
+	if s, ok := l.msgs[key]; ok {
+		return s
+	}
+	if s, ok := l.fallback[key]; ok {
+		return s
+	}
+	return key
+}
+
+// Tf formats the text of key with args, as fmt.Sprintf.
+func (l *Locale) Tf(key string, args ...any) string {
+	return fmt.Sprintf(l.T(key), args...)
+}
+
+// Number localizes a number formatted with a '.' decimal point, possibly
+// with a unit, e.g. "1.5s" to "1,5s" and "2048.0 GB" to "2.048,0 GB": the
+// digits before the point are grouped by thousands from four on. It must
+// not be given anything else that has a dot in it, such as an address.
+func (l *Locale) Number(s string) string {
+	start := 0
+	if strings.HasPrefix(s, "-") {
+		start = 1
+	}
+	end := start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	rest := s[end:]
+	if l.decimal != "." {
+		rest = strings.Replace(rest, ".", l.decimal, 1)
+	}
+	return s[:start] + l.groupDigits(s[start:end]) + rest
+}
+
+// Int formats n with the locale's thousands separator, e.g. 12345 as
+// "12,345" in English and "12.345" in German.
+func (l *Locale) Int(n int) string {
+	return l.Number(strconv.Itoa(n))
+}
+
+// groupDigits puts the thousands separator into a run of digits of four
+// or more.
+func (l *Locale) groupDigits(digits string) string {
+	if len(digits) < 4 || l.group == "" {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head == 0 {
+		head = 3
+	}
+	b.WriteString(digits[:head])
+	for i := head; i < len(digits); i += 3 {
+		b.WriteString(l.group)
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// verbs matches the fmt verbs of a catalog text.
+var verbs = regexp.MustCompile(`%[-+# 0]*[0-9.]*[a-zA-Z%]`)
+
+// TestCatalogsComplete checks that every catalog has exactly the English
+// keys, and that each text takes the same fmt verbs as the English one.
+func TestCatalogsComplete(t *testing.T) {
+	if got := Languages(); !slices.Equal(got, []string{"de", "en", "es", "fr"}) {
+		t.Fatalf("languages %v", got)
+	}
+	en, err := Catalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lang := range Languages() {
+		msgs, err := Catalog(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, text := range en {
+			got, ok := msgs[key]
+			switch {
+			case !ok:
+				t.Errorf("%s: no %s", lang, key)
+			case got == "":
+				t.Errorf("%s: %s is empty", lang, key)
+			case !slices.Equal(verbs.FindAllString(got, -1), verbs.FindAllString(text, -1)):
+				t.Errorf("%s: %s takes %q, English %q", lang, key, verbs.FindAllString(got, -1), verbs.FindAllString(text, -1))
+			}
+		}
+		for key := range msgs {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", lang, key)
+			}
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	l, err := New("de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.T("col.loss"); got != "Verlust" {
+		t.Errorf("own entry %q", got)
+	}
+	delete(l.msgs, "col.loss")
+	if got := l.T("col.loss"); got != "Loss" {
+		t.Errorf("missing entry %q, want the English one", got)
+	}
+	if got := l.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("unknown key %q", got)
+	}
+	if got := l.Tf("status.focus", "250ms", 3); got != "Fokus 250ms: 3 Zeilen" {
+		t.Errorf("Tf %q", got)
+	}
+	if _, err := New("xx"); err == nil {
+		t.Error("no error for a language without a catalog")
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		lang, in, want string
+	}{
+		{"en", "1.5s", "1.5s"},
+		{"en", "2048.0 GB", "2,048.0 GB"},
+		{"en", "-12345", "-12,345"},
+		{"en", "999", "999"},
+		{"de", "1.5s", "1,5s"},
+		{"de", "2048.0 GB", "2.048,0 GB"},
+		{"de", "1234567", "1.234.567"},
+		{"es", "12.25ms", "12,25ms"},
+		{"fr", "2048.5 KB", "2 048,5 KB"},
+		{"fr", "-", "-"},
+	}
+	for _, tt := range tests {
+		l, err := New(tt.lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.Number(tt.in); got != tt.want {
+			t.Errorf("%s Number(%q) = %q, want %q", tt.lang, tt.in, got, tt.want)
+		}
+	}
+	if got := English().Int(12345); got != "12,345" {
+		t.Errorf("Int %q", got)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		all, messages, lang, want string
+	}{
+		{"", "", "", "en"},
+		{"", "", "de_DE.UTF-8", "de"},
+		{"", "fr_FR", "de_DE.UTF-8", "fr"},
+		{"es_ES.UTF-8", "fr_FR", "de_DE", "es"},
+		{"C", "", "de_DE", "en"},
+		{"POSIX", "", "", "en"},
+		{"", "", "ja_JP.UTF-8", "ja"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.all)
+		t.Setenv("LC_MESSAGES", tt.messages)
+		t.Setenv("LANG", tt.lang)
+		if got := FromEnv(); got != tt.want {
+			t.Errorf("LC_ALL=%q LC_MESSAGES=%q LANG=%q: %q, want %q", tt.all, tt.messages, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "ja_JP.UTF-8")
+	if l, err := Select(""); err != nil || l.Lang != "en" {
+		t.Errorf("environment language without a catalog: %v, %v", l, err)
+	}
+	if _, err := Select("ja"); err == nil {
+		t.Error("no error for an explicit language without a catalog")
+	}
+	t.Setenv("LANG", "fr_CA.UTF-8")
+	if l, err := Select(""); err != nil || l.Lang != "fr" {
+		t.Errorf("environment language: %v, %v", l, err)
+	}
+	if l, err := Select("es"); err != nil || l.Lang != "es" {
+		t.Errorf("explicit language: %v, %v", l, err)
+	}
+}
@@ -0,0 +1,260 @@
+package influx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+const (
+	// DefaultFlushEvery is how often queued scans are written by default.
+	DefaultFlushEvery = 10 * time.Second
+	// maxQueue bounds the scans waiting to be written; when it is full the
+	// oldest is dropped.
+	maxQueue = 360
+	// maxBatchLines caps one write request; a backlog is sent in several.
+	maxBatchLines = 5000
+	// firstRetry is the wait after the first failed write, doubled after
+	// each further failure up to maxRetry.
+	firstRetry = time.Second
+	maxRetry   = 2 * time.Minute
+	// requestTimeout bounds one write request.
+	requestTimeout = 10 * time.Second
+)
+
+// Options configures an Exporter.
+type Options struct {
+	URL        string        // write endpoint, e.g. http://host:8086/api/v2/write
+	Bucket     string        // added to the URL as ?bucket=
+	Org        string        // added to the URL as ?org=; optional
+	Token      string        // sent as "Authorization: Token ..."; optional
+	CAFile     string        // PEM file of CAs trusted for https, besides the system ones
+	FlushEvery time.Duration // minimum time between write requests; 0 = DefaultFlushEvery
+}
+
+// Stats are an exporter's running totals.
+type Stats struct {
+	Written   uint64 // scans written
+	Dropped   uint64 // scans dropped because the queue was full
+	Rejected  uint64 // scans the server refused (4xx); not retried
+	Queued    int    // scans waiting
+	LastError string // the most recent failed write, if any
+}
+
+// batch is one scan's points in line protocol.
+type batch struct {
+	lines []byte
+	n     int
+}
+
+// Exporter writes a batch of points per scan in line protocol: one "conn"
+// point per connection and one "app" point per app. Scans are queued and
+// written from the exporter's own goroutine at most every FlushEvery, so the
+// tracker never waits on the network; failed writes are retried with
+// exponential backoff. It implements tracker.ScanSink.
+type Exporter struct {
+	url        string
+	token      string
+	client     *http.Client
+	flushEvery time.Duration
+
+	mu    sync.Mutex
+	queue []batch
+	stats Stats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New validates o and starts the exporter.
+func New(o Options) (*Exporter, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("influx url %q: want http(s)://host[:port]/path", o.URL)
+	}
+	q := u.Query()
+	if o.Bucket != "" {
+		q.Set("bucket", o.Bucket)
+	}
+	if o.Org != "" {
+		q.Set("org", o.Org)
+	}
+	q.Set("precision", "ns")
+	u.RawQuery = q.Encode()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("influx CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("influx CA file %s: no PEM certificates", o.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	e := &Exporter{
+		url:        u.String(),
+		token:      o.Token,
+		client:     &http.Client{Transport: transport, Timeout: requestTimeout},
+		flushEvery: o.FlushEvery,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if e.flushEvery <= 0 {
+		e.flushEvery = DefaultFlushEvery
+	}
+	go e.run()
+	return e, nil
+}
+
+// ExportScan implements tracker.ScanSink. It encodes the scan and queues it,
+// dropping the oldest queued scan when the queue is full.
+func (e *Exporter) ExportScan(now time.Time, conns []*tracker.Connection) {
+	b := encodeScan(now, conns)
+	if b.n == 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueue {
+		e.queue = e.queue[1:]
+		e.stats.Dropped++
+	}
+	e.queue = append(e.queue, b)
+}
+
+// Stats returns the running totals.
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.stats
+	s.Queued = len(e.queue)
+	return s
+}
+
+// Close makes one last attempt to write the queue and stops the exporter. It
+// may wait for one request timeout when the server does not answer.
+func (e *Exporter) Close() error {
+	close(e.stop)
+	<-e.done
+	return nil
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	wait := e.flushEvery
+	backoff := firstRetry
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-e.stop:
+			for e.Stats().Queued > 0 {
+				if e.flush() != nil {
+					return
+				}
+			}
+			return
+		case <-timer.C:
+		}
+		if err := e.flush(); err != nil {
+			wait, backoff = backoff, min(backoff*2, maxRetry)
+		} else if e.Stats().Queued > 0 {
+			wait, backoff = 0, firstRetry // more backlog than one request holds
+		} else {
+			wait, backoff = e.flushEvery, firstRetry
+		}
+		timer.Reset(wait)
+	}
+}
+
+// retryable is a write error worth trying again: the network, the server
+// being overloaded or down.
+type retryable struct{ err error }
+
+func (r retryable) Error() string { return r.err.Error() }
+
+// flush writes the oldest queued scans, up to maxBatchLines lines, in one
+// request. They leave the queue when the server accepted or refused them;
+// on a retryable error they stay and the error is returned.
+func (e *Exporter) flush() error {
+	e.mu.Lock()
+	droppedBefore := e.stats.Dropped
+	var body bytes.Buffer
+	lines, n := 0, 0
+	for _, b := range e.queue {
+		if n > 0 && lines+b.n > maxBatchLines {
+			break
+		}
+		body.Write(b.lines)
+		lines += b.n
+		n++
+	}
+	e.mu.Unlock()
+	if n == 0 {
+		return nil
+	}
+
+	err := e.post(body.Bytes())
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.LastError = err.Error()
+	}
+	if _, retry := err.(retryable); retry {
+		return err
+	}
+	// Scans dropped from the front while the request ran were among those
+	// sent; only the rest are still queued.
+	if sent := n - int(e.stats.Dropped-droppedBefore); sent > 0 {
+		e.queue = e.queue[sent:]
+	}
+	if err != nil {
+		e.stats.Rejected += uint64(n)
+	} else {
+		e.stats.Written += uint64(n)
+	}
+	return nil
+}
+
+// post sends one request. 429 and 5xx answers are retryable; other
+// non-2xx answers mean the data or the credentials are wrong.
+func (e *Exporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return retryable{err}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("influx write: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500 {
+		return retryable{err}
+	}
+	return err
+}
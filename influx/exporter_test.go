@@ -0,0 +1,177 @@
+package influx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// writeServer records the write requests it gets and answers each with the
+// next status of its script, then 204.
+type writeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	auth     []string
+	queries  []string
+}
+
+func newWriteServer(t *testing.T, statuses ...int) *writeServer {
+	s := &writeServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		s.queries = append(s.queries, r.URL.RawQuery)
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		if status != http.StatusNoContent {
+			http.Error(w, "nope", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *writeServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func scanConns(app string) []*tracker.Connection {
+	return []*tracker.Connection{{
+		AppName: app, Protocol: "tcp", State: tracker.StateEstablished, Direction: tracker.Outbound,
+		RemoteAddr: "192.0.2.1", RemotePort: 443, Ping: 12500 * time.Microsecond, TxRate: 100,
+	}, {
+		AppName: app, Protocol: "tcp", State: tracker.StateListening, LocalPort: 8080,
+	}}
+}
+
+func TestEncodeScan(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	conns := append(scanConns("my app"), &tracker.Connection{AppName: "my app", Protocol: "udp6", Direction: tracker.Outbound, RemoteAddr: "2001:db8::1", RemotePort: 53})
+	b := encodeScan(at, conns)
+	want := `conn,app=my\ app,direction=OUT,proto=tcp,remote=192.0.2.1:443 loss=0,tx_rate=100,rx_rate=0,rtt_ms=12.5 1700000000000000000
+conn,app=my\ app,direction=OUT,proto=udp6,remote=[2001:db8::1]:53 loss=0,tx_rate=0,rx_rate=0 1700000000000000000
+app,app=my\ app conns=2i,tx_rate=100,rx_rate=0,rtt_ms=12.5,loss=0 1700000000000000000
+`
+	if string(b.lines) != want || b.n != 3 {
+		t.Errorf("%d lines:\n%s\nwant:\n%s", b.n, b.lines, want)
+	}
+}
+
+// TestExporterBatches queues scans between flushes and checks they go in
+// one request, with the token and the URL parameters.
+func TestExporterBatches(t *testing.T) {
+	s := newWriteServer(t)
+	e, err := New(Options{URL: s.URL + "/api/v2/write", Bucket: "net", Org: "home", Token: "s3cret", FlushEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	for _, app := range []string{"a", "b", "c"} {
+		e.ExportScan(time.Now(), scanConns(app))
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.requests() != 1 {
+		t.Fatalf("%d requests for three scans, want 1", s.requests())
+	}
+	if n := strings.Count(s.bodies[0], "\n"); n != 6 {
+		t.Errorf("%d lines, want 6:\n%s", n, s.bodies[0])
+	}
+	if s.auth[0] != "Token s3cret" || s.queries[0] != "bucket=net&org=home&precision=ns" {
+		t.Errorf("auth %q, query %q", s.auth[0], s.queries[0])
+	}
+	if st := e.Stats(); st.Written != 3 || st.Queued != 0 {
+		t.Errorf("stats %+v", st)
+	}
+
+	// A backlog larger than one request goes in several.
+	for range 3 {
+		e.queue = append(e.queue, batch{lines: []byte(strings.Repeat("m v=1\n", 2000)), n: 2000})
+	}
+	e.flush()
+	e.flush()
+	if s.requests() != 3 || strings.Count(s.bodies[1], "\n") != 4000 || strings.Count(s.bodies[2], "\n") != 2000 {
+		t.Errorf("%d requests for a backlog of 6000 lines", s.requests())
+	}
+}
+
+func TestExporterRetries(t *testing.T) {
+	s := newWriteServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	e, err := New(Options{URL: s.URL, FlushEvery: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.ExportScan(time.Now(), scanConns("a"))
+
+	// 503, then 429 a second later, then written two seconds after that.
+	deadline := time.Now().Add(10 * time.Second)
+	for e.Stats().Written == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := e.Stats()
+	if st.Written != 1 || s.requests() != 3 || !strings.Contains(st.LastError, "429") {
+		t.Fatalf("after retries: %+v, %d requests", st, s.requests())
+	}
+	s.mu.Lock()
+	if s.bodies[0] != s.bodies[2] {
+		t.Error("the retry sent other data")
+	}
+	s.mu.Unlock()
+}
+
+func TestExporterRejectsAndDrops(t *testing.T) {
+	s := newWriteServer(t, http.StatusBadRequest)
+	e, err := New(Options{URL: s.URL, FlushEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.ExportScan(time.Now(), scanConns("a"))
+	if err := e.flush(); err != nil {
+		t.Errorf("a refused write is not retried, got %v", err)
+	}
+	if st := e.Stats(); st.Rejected != 1 || st.Queued != 0 || !strings.Contains(st.LastError, "400 Bad Request: nope") {
+		t.Errorf("after a 400: %+v", st)
+	}
+
+	for range maxQueue + 5 {
+		e.ExportScan(time.Now(), scanConns("a"))
+	}
+	if st := e.Stats(); st.Dropped != 5 || st.Queued != maxQueue {
+		t.Errorf("full queue: %+v", st)
+	}
+	// Close writes what is left.
+	e.Close()
+	if st := e.Stats(); st.Queued != 0 || st.Written != maxQueue {
+		t.Errorf("after Close: %+v", st)
+	}
+}
+
+func TestNewRejectsURL(t *testing.T) {
+	for _, u := range []string{"", "localhost:8086", "ftp://host/write", "http:///write"} {
+		if _, err := New(Options{URL: u}); err == nil {
+			t.Errorf("%q accepted", u)
+		}
+	}
+	if _, err := New(Options{URL: "https://host/write", CAFile: "/nonexistent.pem"}); err == nil {
+		t.Error("missing CA file accepted")
+	}
+}
@@ -0,0 +1,121 @@
+// Package influx pushes per-scan measurements to InfluxDB, or anything else
+// that accepts line protocol over HTTP, in the background.
+package influx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag is one tag of a point. Tags with an empty value are left out, as line
+// protocol has no way to write them.
+type Tag struct {
+	Key, Value string
+}
+
+// Field is one field of a point. Value is a float64, int, int64, uint64,
+// bool or string; floats that are NaN or infinite are left out.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Point is one line of line protocol.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	Time        time.Time
+}
+
+var (
+	// measurementEscaper escapes a measurement name. Newlines cannot be
+	// carried by line protocol at all, so they become spaces.
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	// keyEscaper escapes tag keys, tag values and field keys.
+	keyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	// stringEscaper escapes the inside of a quoted string field value.
+	stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", " ")
+)
+
+// AppendPoint appends p as one line, ending in a newline, with tags sorted
+// by key and the timestamp in nanoseconds. A point with no writable field
+// is not valid line protocol and appends nothing.
+func AppendPoint(b []byte, p Point) []byte {
+	start := len(b)
+	b = appendEscaped(b, measurementEscaper, p.Measurement)
+
+	tags := append([]Tag(nil), p.Tags...)
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	for _, t := range tags {
+		if t.Key == "" || t.Value == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = appendEscaped(b, keyEscaper, t.Key)
+		b = append(b, '=')
+		b = appendEscaped(b, keyEscaper, t.Value)
+	}
+
+	sep := byte(' ')
+	n := 0
+	for _, f := range p.Fields {
+		v, ok := fieldValue(f.Value)
+		if f.Key == "" || !ok {
+			continue
+		}
+		b = append(b, sep)
+		b = appendEscaped(b, keyEscaper, f.Key)
+		b = append(b, '=')
+		b = append(b, v...)
+		sep = ','
+		n++
+	}
+	if n == 0 {
+		return b[:start]
+	}
+
+	if !p.Time.IsZero() {
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, p.Time.UnixNano(), 10)
+	}
+	return append(b, '\n')
+}
+
+// appendEscaped appends s escaped by r. A value ending in an odd number of
+// backslashes gets one more, so the last one cannot escape the separator
+// that follows.
+func appendEscaped(b []byte, r *strings.Replacer, s string) []byte {
+	s = r.Replace(s)
+	n := len(s) - len(strings.TrimRight(s, `\`))
+	if n%2 == 1 {
+		s += `\`
+	}
+	return append(b, s...)
+}
+
+// fieldValue formats a field value: floats as they are, integers with the
+// i (or u) suffix, strings quoted.
+func fieldValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v) + "i", true
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case uint64:
+		return strconv.FormatUint(v, 10) + "u", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	}
+	return "", false
+}
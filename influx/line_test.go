@@ -0,0 +1,51 @@
+package influx
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAppendPoint(t *testing.T) {
+	at := time.Unix(1700000000, 123)
+	tests := []struct {
+		name string
+		p    Point
+		want string
+	}{
+		{"plain", Point{"conn", []Tag{{"app", "curl"}}, []Field{{"loss", 0.5}}, at},
+			"conn,app=curl loss=0.5 1700000000000000123\n"},
+		{"tags sorted, empty ones left out", Point{"conn", []Tag{{"remote", "192.0.2.1:443"}, {"direction", ""}, {"app", "curl"}, {"", "x"}}, []Field{{"loss", 0.0}}, at},
+			"conn,app=curl,remote=192.0.2.1:443 loss=0 1700000000000000123\n"},
+		{"space, comma and equals in a tag value", Point{"app", []Tag{{"app", "Google Chrome Helper, GPU=1"}}, []Field{{"conns", 2}}, at},
+			`app,app=Google\ Chrome\ Helper\,\ GPU\=1 conns=2i 1700000000000000123` + "\n"},
+		{"quotes in a tag value stay", Point{"app", []Tag{{"app", `say "hi"`}}, []Field{{"conns", 1}}, at},
+			`app,app=say\ "hi" conns=1i 1700000000000000123` + "\n"},
+		{"newline in a tag value", Point{"app", []Tag{{"app", "two\nlines"}}, []Field{{"conns", 1}}, at},
+			`app,app=two\ lines conns=1i 1700000000000000123` + "\n"},
+		{"trailing backslash", Point{"app", []Tag{{"app", `C:\`}}, []Field{{"conns", 1}}, at},
+			`app,app=C:\\ conns=1i 1700000000000000123` + "\n"},
+		{"two trailing backslashes", Point{"app", []Tag{{"app", `a\\`}}, []Field{{"conns", 1}}, at},
+			`app,app=a\\ conns=1i 1700000000000000123` + "\n"},
+		{"measurement", Point{"my conn,v2", nil, []Field{{"n", 1}}, at},
+			`my\ conn\,v2 n=1i 1700000000000000123` + "\n"},
+		{"field key", Point{"m", nil, []Field{{"tx rate=", 1.5}}, at},
+			`m tx\ rate\==1.5 1700000000000000123` + "\n"},
+		{"field types", Point{"m", nil, []Field{{"f", 2.0}, {"i", int64(-3)}, {"u", uint64(4)}, {"b", true}, {"s", `a "q" \ b` + "\n"}}, at},
+			`m f=2,i=-3i,u=4u,b=true,s="a \"q\" \\ b " 1700000000000000123` + "\n"},
+		{"no exponent", Point{"m", nil, []Field{{"f", 1e21}, {"g", 0.000001}}, at},
+			"m f=1000000000000000000000,g=0.000001 1700000000000000123\n"},
+		{"NaN, Inf and unknown types left out", Point{"m", nil, []Field{{"nan", math.NaN()}, {"inf", math.Inf(1)}, {"d", time.Second}, {"ok", 1.0}}, at},
+			"m ok=1 1700000000000000123\n"},
+		{"no time", Point{"m", nil, []Field{{"ok", 1.0}}, time.Time{}},
+			"m ok=1\n"},
+		{"no field", Point{"m", []Tag{{"app", "x"}}, []Field{{"nan", math.NaN()}, {"", 1.0}}, at},
+			""},
+	}
+	for _, tt := range tests {
+		got := string(AppendPoint([]byte("prev\n"), tt.p))
+		if got != "prev\n"+tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got[5:], tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package influx
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// encodeScan is the points of one scan: a "conn" point per connection with
+// a remote end, tagged app, remote, proto and direction, and an "app" point
+// per app with its totals. rtt_ms is left out until a connection has a
+// measurement, so it does not read as 0 in graphs.
+func encodeScan(now time.Time, conns []*tracker.Connection) batch {
+	var b batch
+	var active []*tracker.Connection
+	for _, c := range conns {
+		if c.IsListener() || c.Protocol == tracker.ExternalProtocol {
+			continue
+		}
+		active = append(active, c)
+		fields := []Field{
+			{"loss", c.Loss},
+			{"tx_rate", c.TxRate},
+			{"rx_rate", c.RxRate},
+		}
+		if c.Ping > 0 {
+			fields = append(fields, Field{"rtt_ms", ms(c.Ping)})
+		}
+		b.add(Point{
+			Measurement: "conn",
+			Tags: []Tag{
+				{"app", c.AppName},
+				{"remote", net.JoinHostPort(c.RemoteAddr, strconv.Itoa(c.RemotePort))},
+				{"proto", c.DisplayProtocol()},
+				{"direction", string(c.Direction)},
+			},
+			Fields: fields,
+			Time:   now,
+		})
+	}
+
+	for _, g := range tracker.GroupBy(active, tracker.GroupByApp) {
+		var rtt time.Duration
+		var loss float64
+		pinged := 0
+		for _, c := range g.Conns {
+			if c.Ping > 0 {
+				rtt += c.Ping
+				loss += c.Loss
+				pinged++
+			}
+		}
+		fields := []Field{
+			{"conns", len(g.Conns)},
+			{"tx_rate", g.TxRate},
+			{"rx_rate", g.RxRate},
+		}
+		if pinged > 0 {
+			fields = append(fields,
+				Field{"rtt_ms", ms(rtt / time.Duration(pinged))},
+				Field{"loss", loss / float64(pinged)})
+		}
+		b.add(Point{
+			Measurement: "app",
+			Tags:        []Tag{{"app", g.Key}},
+			Fields:      fields,
+			Time:        now,
+		})
+	}
+	return b
+}
+
+// add appends one point.
+func (b *batch) add(p Point) {
+	before := len(b.lines)
+	b.lines = AppendPoint(b.lines, p)
+	if len(b.lines) > before {
+		b.n++
+	}
+}
+
+// ms is d in fractional milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -4,34 +4,1011 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"ping-tracker/agent"
+	"ping-tracker/config"
+	"ping-tracker/demo"
+	"ping-tracker/eventlog"
+	"ping-tracker/flowexport"
+	"ping-tracker/i18n"
+	"ping-tracker/influx"
+	"ping-tracker/notify"
+	"ping-tracker/policy"
 	"ping-tracker/tracker"
 	"ping-tracker/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
 )
 
+// stringList is a flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(runAgentCommand(os.Args[2:]))
+	}
 	interval := flag.Duration("interval", 3*time.Second, "scan interval")
 	noPing := flag.Bool("no-ping", false, "disable ping measurements (faster, no TCP probes)")
+	rawPing := flag.Bool("raw-ping", false, "show raw TCP connect times without correcting for handshake overhead")
+	audit := flag.Bool("audit", false, "score connections by where their executable lives and how recently it changed")
+	probeProxy := flag.String("probe-proxy", "", "send TCP ping probes through a SOCKS5 proxy: socks5://[user:pass@]host:port")
+	probeBypass := flag.String("probe-proxy-bypass", "", "comma-separated addresses or CIDRs probed directly, besides private and link-local ones")
+	maxConns := flag.Int("max-connections", 0, "track at most this many connections; the rest are only counted per app and state (0 = no cap)")
+	probeBudget := flag.String("probe-budget", "", "daily cap on probe traffic, e.g. 5MB/day; past it probing stops until local midnight")
+	loadHigh := flag.Float64("load-high", 0, "back off while the load per CPU (Windows: CPU busy share) is at or above this, e.g. 1.5: longer scan interval, fewer probes at once (0 = off)")
+	probeAll := flag.Bool("probe-all", false, "probe every connection every cycle instead of by priority tier")
 	filter := flag.String("filter", "", "initial app name filter (substring match)")
+	alertPing := flag.Duration("alert-ping", 0, "alert when a connection's ping reaches this value (0 = off)")
+	alertStall := flag.Duration("alert-stall", 0, "alert when a TCP transfer has been stalled this long (0 = off)")
+	alertSendQ := flag.Uint64("alert-sendq", 0, "alert when a socket's send queue holds this many bytes for several scans in a row (0 = off)")
+	alertScore := flag.Int("alert-score", 0, "alert when a connection's health score stays below this (0-100) for several scans in a row (0 = off)")
+	alertAppSockMem := flag.Uint64("alert-app-sockmem", 0, "alert when an app's sockets hold this many bytes of kernel socket memory together (0 = off; -scanner ss)")
+	alertLoss := flag.Float64("alert-loss", 0, "alert when a connection's loss reaches this percentage (0 = off)")
+	recordOnAlert := flag.String("record-on-alert", "", "record snapshots around alerts to <prefix>-<timestamp>.jsonl")
+	preroll := flag.Duration("preroll", 2*time.Minute, "history kept before an alert when using -record-on-alert")
+	postroll := flag.Duration("postroll", time.Minute, "time recorded after an alert when using -record-on-alert")
+	recordCooldown := flag.Duration("record-cooldown", 5*time.Minute, "minimum gap between incident recordings")
+	showClosing := flag.Bool("show-terminal-states", false, "list TIME_WAIT, FIN_WAIT2 and LAST_ACK sockets one per row instead of summarized per app (toggle with H)")
+	anonymize := flag.Bool("anonymize", false, "mask addresses, app names and hosts in the display (toggle with F9)")
+	restoreSession := flag.Bool("restore-session", false, "restore filter, sort, toggles and selection from the last run")
+	fresh := flag.Bool("fresh", false, "ignore the saved session even if restore is enabled in the config")
+	scanner := flag.String("scanner", "", "socket enumeration backend (Linux: proc or ss; Windows: iphlpapi)")
+	allNetns := flag.Bool("all-netns", false, "also scan the network namespaces of containers and ip netns (Linux, root)")
+	conntrack := flag.Bool("conntrack", false, "also show the flows this machine forwards, from the conntrack table (Linux router, root)")
+	pcapAccounting := flag.Bool("pcap-accounting", false, "count the bytes of sockets without kernel counters from a packet capture, and spot QUIC on any port (Linux, root or CAP_NET_RAW)")
+	dhcpLeases := flag.String("dhcp-leases", "", "dnsmasq or dhcpd leases file naming the LAN clients of -conntrack flows")
+	flowExport := flag.String("flow-export", "", "send a flow record for each closed connection to udp:host:port")
+	flowFormat := flag.String("flow-format", "ipfix", "flow record format for -flow-export: ipfix or json")
+	influxURL := flag.String("influx-url", "", "push per-scan measurements in line protocol to this write URL (e.g. http://host:8086/api/v2/write)")
+	influxBucket := flag.String("influx-bucket", "", "bucket for -influx-url")
+	influxOrg := flag.String("influx-org", "", "organization for -influx-url (InfluxDB 2)")
+	influxTokenEnv := flag.String("influx-token-env", "", "environment variable holding the API token for -influx-url")
+	influxCA := flag.String("influx-ca", "", "PEM file of extra CAs trusted for an https -influx-url")
+	influxEvery := flag.Duration("influx-every", influx.DefaultFlushEvery, "minimum time between -influx-url writes")
+	eventLog := flag.String("event-log", "", "append alerts and notable events to this file, one line each (reopened on SIGHUP or when rotated)")
+	eventLogLevel := flag.String("event-log-level", "", "lowest severity written to -event-log: info, warn or crit (default info)")
+	exportProfile := flag.String("export-profile", "default", "field names for JSON flow records and -serve ?profile=: default, wireshark, ntopng or a mapping file")
+	serve := flag.String("serve", "", "run headless and serve snapshots on this address (e.g. :7777, which listens on 127.0.0.1; other hosts need -serve-token-env or a paired -tls agent)")
+	serveChanges := flag.Int("serve-changes", tracker.DefaultChangeScans, "with -serve, scans of changes kept for polling /changes (0 = off)")
+	pprofListen := flag.String("pprof-listen", "", "serve net/http/pprof on this loopback address (e.g. :6060) to diagnose ping-tracker's own CPU use")
+	ingest := flag.String("ingest", "", "accept external latency measurements as JSON datagrams on this UDP address (e.g. :7071, which listens on 127.0.0.1; other hosts need -ingest-token-env)")
+	ingestTokenEnv := flag.String("ingest-token-env", "", "accept POST /ingest with -serve, and -ingest datagrams, only from senders carrying the token in this environment variable")
+	serveTokenEnv := flag.String("serve-token-env", "", "with -serve, answer only viewers carrying the token in this environment variable (health probes excepted)")
+	connectTokenEnv := flag.String("connect-token-env", "", "with -connect, send the token in this environment variable to the agents")
+	var connect stringList
+	flag.Var(&connect, "connect", "merge connections from an agent at host:port (repeatable)")
+	useTLS := flag.Bool("tls", false, "-serve and -connect over TLS: the agent's self-signed certificate is pinned on first connect")
+	acceptNewCert := flag.Bool("accept-new-cert", false, "with -tls -connect, pin an agent's certificate even if it changed")
+	pairCode := flag.String("pair", "", "with -tls -connect, pair with the agent using the code \"ping-tracker agent pair\" printed there")
+	var inject stringList
+	flag.Var(&inject, "inject", "testing: perturb the data shown and alerted on, e.g. ping-spike=app:steam,+200ms,30s (repeatable; see README)")
+	var dualStack stringList
+	flag.Var(&dualStack, "dual-stack", "probe host:port over IPv4 and IPv6 separately and compare them (repeatable)")
+	noState := flag.Bool("no-state", false, "start fresh: don't load or save ping calibration and per-app totals in state.json")
+	knownHosts := flag.Bool("known-hosts", true, "remember every remote host across sessions and flag new ones")
+	listenerAlerts := flag.Bool("listener-alerts", true, "alert on listening ports not acknowledged before (a acknowledges)")
+	frameInterval := flag.Duration("frame-interval", 100*time.Millisecond, "minimum time between screen redraws")
+	a11y := flag.Bool("a11y", false, "screen-reader friendly mode: no full-screen table, announce changes as lines")
+	verbosity := flag.Int("a11y-verbosity", 2, "a11y announcements: 1 = new/closed, 2 = + state changes, 3 = + ping changes")
+	demoMode := flag.Bool("demo", false, "run against a simulated network instead of this machine's sockets")
+	lang := flag.String("lang", "", "language of the TUI's labels and numbers: en, de, fr or es (default from LANG)")
+	onboarding := flag.Bool("onboarding", false, "show the first-run introduction again")
+	noSummary := flag.Bool("no-summary", false, "don't print the session summary after the TUI exits")
+	readOnly := flag.Bool("read-only", false, "refuse every action that sends traffic other than probes, runs a program or changes the system")
+	dryRun := flag.Bool("dry-run", false, "show what the actions that run a program would run, instead of running it")
+	demoSeed := flag.Int64("demo-seed", 1, "seed for -demo; the same seed replays the same session")
 	flag.Parse()
 
-	checkPrivileges()
+	var sandbox tracker.Sandbox
+	if *demoMode {
+		// Nothing real is scanned, and nothing learned is worth keeping.
+		*knownHosts, *listenerAlerts, *noState = false, false, true
+	} else {
+		sandbox = tracker.ProbeSandbox()
+		tracker.AdaptToSandbox(sandbox)
+		checkPrivileges(sandbox)
+	}
+
+	if *scanner != "" {
+		if err := tracker.SelectScanner(*scanner); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *allNetns {
+		if err := tracker.EnableAllNetns(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *conntrack {
+		if err := tracker.EnableConntrack(*dhcpLeases); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	firstRun := isFirstRun()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not load config: %v\n", err)
+	}
+
+	pinned := setFlags()
+	scanInterval, pingOn := *interval, !*noPing
+	if !pinned["interval"] && cfg.Interval != "" {
+		if d, err := parseInterval(cfg.Interval); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			scanInterval = d
+		}
+	}
+	if !pinned["no-ping"] && cfg.NoPing {
+		pingOn = false
+	}
+
+	if !pinned["read-only"] && !*dryRun && cfg.ReadOnly {
+		*readOnly = true
+	}
+	mode, err := policy.Parse(*readOnly, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	t := tracker.NewTracker(scanInterval, pingOn)
+	t.SetPolicy(mode)
+	if *demoMode {
+		t.SetSource(demo.New(*demoSeed, scanInterval))
+	} else if *pcapAccounting {
+		if err := t.StartCapture(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	t.SetProbeAll(*probeAll)
+	t.SetMaxConnections(*maxConns)
+	budget, err := tracker.ParseProbeBudget(*probeBudget)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	t.SetProbeBudget(budget)
+	t.SetPingCorrection(!*rawPing)
+	if *probeProxy != "" {
+		p, err := tracker.ParseProbeProxy(*probeProxy)
+		if err == nil {
+			p.Bypass, err = tracker.ParseBypass(*probeBypass)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		t.SetProbeProxy(p)
+	}
+	if targets := append(cfg.DualStackTargets, dualStack...); len(targets) > 0 {
+		d, err := tracker.NewDualStack(targets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		t.SetDualStack(d)
+	}
+	t.SetCalibrationHosts(cfg.CalibrationHostsMax)
+	if *audit {
+		t.SetAuditor(tracker.NewAuditor(auditRulesFromConfig(cfg)))
+	}
+	t.SetEncryptionOverrides(cfg.EncryptionOverrides)
+	if stuck, err := tracker.ParseStuckThresholds(cfg.StuckStates); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetStuckThresholds(stuck)
+	}
+	if noProbe, err := tracker.ParseNoProbe(cfg.NoProbe); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetNoProbe(noProbe)
+	}
+	if weights, err := tracker.ParseScoreWeights(cfg.ScoreWeights); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetScoreWeights(weights)
+	}
+	if filter, err := tracker.ParseSampleFilter(cfg.NoPingWarmUp, cfg.PingOutlierMAD); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetSampleFilter(filter)
+	}
+	if d, err := tracker.ParseOutageAlert(cfg.UnreachableAlert); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetOutageAlert(d)
+	}
+	if r, err := tracker.ParseHalfOpen(cfg.HalfOpenIdle, cfg.HalfOpenUnreachable); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetHalfOpen(r)
+	}
+	if schedule, err := scheduleFromConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetSchedule(schedule)
+	}
+	if throttle, err := loadThrottleFromConfig(cfg, pinned, *loadHigh); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		t.SetLoadThrottle(throttle)
+	}
+	derived, err := derivedColumnsFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	t.SetDerivedColumns(derived)
+	checks, err := serviceChecksFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	t.SetServiceChecks(checks)
+	if len(checks) > 0 && mode.Check(policy.ServiceChecks) == policy.Deny {
+		fmt.Fprintf(os.Stderr, "Note: %v\n", &policy.DeniedError{Action: policy.ServiceChecks})
+	}
+	triggers, err := triggersFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	t.SetTriggers(triggers)
+	if len(triggers) > 0 && mode.Check(policy.Triggers) == policy.Deny {
+		fmt.Fprintf(os.Stderr, "Note: %v\n", &policy.DeniedError{Action: policy.Triggers})
+	}
+
+	flowLink := tracker.DefaultFlowLinkConfig
+	flowLink.MatchApp = cfg.FlowLinkByApp
+	if cfg.FlowLinkGrace != "" {
+		grace, err := time.ParseDuration(cfg.FlowLinkGrace)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: invalid flow_link_grace %q: %v\n", cfg.FlowLinkGrace, err)
+		} else {
+			flowLink.Grace = grace
+		}
+	}
+	t.SetFlowLink(flowLink)
 
-	t := tracker.NewTracker(*interval, !*noPing)
+	if cfg.EphemeralPorts != "" {
+		r, err := tracker.ParsePortRange(cfg.EphemeralPorts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ephemeral_ports: %v\n", err)
+		} else {
+			tracker.SetEphemeralRange(r)
+		}
+	}
+	if *knownHosts {
+		if dir, err := config.Dir(); err == nil {
+			max := tracker.DefaultKnownHosts
+			if cfg.KnownHostsMax > 0 {
+				max = cfg.KnownHostsMax
+			}
+			k, err := tracker.OpenKnownHosts(filepath.Join(dir, "known_hosts.json"), max)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: known hosts database: %v\n", err)
+			}
+			t.SetKnownHosts(k)
+		}
+	}
+	if !*noState {
+		if dir, err := config.Dir(); err == nil {
+			openState(t, filepath.Join(dir, "state.json"), cfg)
+		}
+	}
+	var listeners *tracker.ListenerWatch
+	if *listenerAlerts {
+		if dir, err := config.Dir(); err == nil {
+			w, err := tracker.OpenListenerWatch(filepath.Join(dir, "listeners.json"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: listener history: %v\n", err)
+			}
+			rules, err := listenerSuppressionsFromConfig(cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			w.SetSuppressions(rules)
+			t.SetListenerWatch(w)
+			listeners = w
+		}
+	}
+	rule, err := alertRuleFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	pinRule := func(r *tracker.AlertRule) {
+		if *alertPing > 0 {
+			r.PingThreshold = *alertPing
+		}
+		if *alertLoss > 0 {
+			r.LossThreshold = *alertLoss
+		}
+		if *alertStall > 0 {
+			r.StallTime = *alertStall
+		}
+		if *alertSendQ > 0 {
+			r.SendQThreshold = *alertSendQ
+		}
+		if *alertScore > 0 {
+			r.ScoreThreshold = *alertScore
+		}
+		if *alertAppSockMem > 0 {
+			r.AppSockMemThreshold = *alertAppSockMem
+		}
+	}
+	pinRule(&rule)
+	if err := rule.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: alert thresholds: %v\n", err)
+		os.Exit(1)
+	}
+	t.SetAlertRule(rule)
+	var recorder *tracker.IncidentRecorder
+	if *recordOnAlert != "" {
+		pre := int(*preroll / scanInterval)
+		post := int(*postroll / scanInterval)
+		recorder = tracker.NewIncidentRecorder(*recordOnAlert, pre, post, *recordCooldown)
+		t.SetIncidentRecorder(recorder)
+	}
+	profile, err := flowexport.LoadProfile(*exportProfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *flowExport != "" {
+		exp, err := flowexport.New(*flowExport, *flowFormat, profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer exp.Close()
+		t.SetFlowSink(exp)
+	}
+	if *influxURL != "" {
+		exp, err := openInflux(*influxURL, *influxBucket, *influxOrg, *influxTokenEnv, *influxCA, *influxEvery)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer closeInflux(exp)
+		t.SetScanSink(exp)
+	}
+	if *serve != "" && *serveChanges > 0 {
+		t.SetChangeJournal(tracker.NewChangeJournal(*serveChanges))
+	}
+	var events *eventlog.Writer
+	if *eventLog != "" || cfg.EventLog != "" {
+		events, err = openEventLog(cfg, pinned, *eventLog, *eventLogLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer closeEventLog(events)
+		t.SetEventSink(events)
+		t.SetEventApps(cfg.EventLogApps)
+	}
+	if cfg.Notify != nil {
+		closeNotify, err := openNotify(t, cfg.Notify)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer closeNotify()
+		if mode.Check(policy.Notifications) == policy.Deny {
+			fmt.Fprintf(os.Stderr, "Note: %v\n", &policy.DeniedError{Action: policy.Notifications})
+		}
+	}
+	for _, spec := range inject {
+		inj, err := tracker.ParseInjection(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "INJECTION ACTIVE for %s: %s\n", inj.For, inj.Spec)
+		t.Inject(inj)
+	}
 	t.Start()
 	defer t.Stop()
 
+	ingestToken, err := envToken("-ingest-token-env", *ingestTokenEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *ingest != "" {
+		l, err := agent.ListenIngest(*ingest, t, ingestToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer l.Close()
+	}
+
+	if *pprofListen != "" {
+		l, err := listenPprof(*pprofListen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer l.Close()
+		fmt.Fprintf(os.Stderr, "Serving pprof on http://%s/debug/pprof/\n", l.Addr())
+	}
+
+	if *serve != "" {
+		viewerToken, err := envToken("-serve-token-env", *serveTokenEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		serveFn := func() error { return agent.Serve(*serve, t, profile, ingestToken, viewerToken) }
+		if *useTLS {
+			s, err := serveTLS()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			serveFn = func() error { return agent.ServeTLS(*serve, t, profile, ingestToken, viewerToken, s) }
+		}
+		fmt.Fprintf(os.Stderr, "Serving snapshots on %s%s\n", *serve, agent.SnapshotPath)
+		if err := serveFn(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if loc, err := i18n.Select(*lang); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: -lang: %v\n", err)
+	} else {
+		tui.SetLocale(loc)
+	}
 	model := tui.NewModel(t)
+	model.SetProfiler(profileCPUFor, captureProfiles)
+	model.SetSandbox(sandbox)
+	if (*pairCode != "" || *acceptNewCert) && (!*useTLS || len(connect) == 0) {
+		fmt.Fprintln(os.Stderr, "Warning: -pair and -accept-new-cert only apply with -tls -connect")
+	}
+	if len(connect) > 0 {
+		remotes := agent.NewMulti(connect, scanInterval)
+		token, err := envToken("-connect-token-env", *connectTokenEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		remotes.UseToken(token)
+		if *useTLS {
+			pins, err := connectTLS(connect, *acceptNewCert, *pairCode)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			remotes.UseTLS(pins)
+		}
+		remotes.Start()
+		defer remotes.Stop()
+		model.SetRemotes(remotes)
+	}
+
+	model.SetConfirmQuit(cfg.ConfirmQuit)
+	model.SetPolicy(mode)
+	model.SetTimeDisplay(cfg.AbsoluteTimes, cfg.Clock12h)
+	model.SetAnonymize(*anonymize)
+	model.SetCompactPorts(cfg.CompactPorts)
+	model.SetShowClosing(*showClosing)
+	model.SetNamespaceColumn(*allNetns)
+	if argv, err := tui.ParseOpenCommand(cfg.OpenCmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		model.SetOpenCommand(argv)
+	}
+	if err := model.SetPalette(cfg.Palette); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	model.SetSTUNServers(cfg.STUNServer, cfg.STUNServer2)
+	if rate, d, err := tracker.ParseDeepDive(cfg.DeepDiveRate, cfg.DeepDiveDuration); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		model.SetDeepDive(rate, d)
+	}
+	if d, err := tracker.ParseFocusInterval(cfg.FocusInterval); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		model.SetFocusInterval(d)
+	}
+	if err := tracker.SetNameLookups(cfg.NameLookupsPerScan); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	model.SetThresholdSaver(saveAlertRule)
+	model.SetDeltaOptions(deltaOptionsFromConfig(cfg))
+	model.SetSortHysteresis(sortHysteresisFromConfig(cfg))
+	if path, err := config.Path(); err == nil {
+		w := newConfigWatcher(path, cfg, t, pinRule, pinned)
+		w.listeners = listeners
+		w.loadHigh = *loadHigh
+		w.events = events
+		model.SetConfigReloader(w.check)
+	}
+
+	opts := []tea.ProgramOption{tea.WithoutCatchPanics()}
+	if *frameInterval > 0 {
+		// Bursts of messages between frames are coalesced into one redraw.
+		opts = append(opts, tea.WithFPS(int(time.Second / *frameInterval)))
+	}
+	if *a11y || os.Getenv("TERM") == "dumb" {
+		model.SetAccessible(*verbosity)
+	} else {
+		opts = append(opts, tea.WithAltScreen())
+		if *onboarding || (firstRun && !cfg.OnboardingDone) {
+			model.SetOnboarding(saveOnboardingDone)
+		}
+	}
+
+	sessionPath := ""
+	if (*restoreSession || cfg.RestoreSession) && !*fresh {
+		if dir, err := config.Dir(); err == nil {
+			sessionPath = filepath.Join(dir, "session.json")
+			if s, err := tui.LoadSession(sessionPath); err == nil {
+				model.RestoreSession(s)
+			} else if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring saved session: %v\n", err)
+			}
+		}
+	}
+
+	// Set after the restore so -filter wins over the saved session's.
 	if *filter != "" {
 		model.SetFilter(*filter)
 	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(model, opts...)
+	final, err := runProgram(p)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	m, ok := final.(tui.Model)
+	if ok && sessionPath != "" {
+		if err := tui.SaveSession(sessionPath, m.Session()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not save session: %v\n", err)
+		}
+	}
+
+	s := t.Session()
+	if events != nil {
+		s.Files = append(s.Files, events.Path())
+	}
+	if recorder != nil {
+		s.Files = append(s.Files, recorder.Files()...)
+	}
+	if ok {
+		s.Files = append(s.Files, m.WrittenFiles()...)
+	}
+	if events != nil {
+		events.LogEvent(summaryEvent(s))
+	}
+	if !*noSummary {
+		// EnvColorProfile is plain text for NO_COLOR or a redirected stdout.
+		color := termenv.NewOutput(os.Stdout).EnvColorProfile() != termenv.Ascii
+		fmt.Print(renderSummary(s, color))
+	}
+}
+
+// envToken reads a token from the environment variable env named by the
+// flag name, so it stays out of the process list and the config. An empty
+// env is no token; a named variable that is empty or unset is an error.
+func envToken(name, env string) (string, error) {
+	if env == "" {
+		return "", nil
+	}
+	token := os.Getenv(env)
+	if token == "" {
+		return "", fmt.Errorf("%s: $%s is empty or unset", name, env)
+	}
+	return token, nil
+}
+
+// openInflux starts the line protocol exporter.
+func openInflux(url, bucket, org, tokenEnv, caFile string, every time.Duration) (*influx.Exporter, error) {
+	token, err := envToken("-influx-token-env", tokenEnv)
+	if err != nil {
+		return nil, err
+	}
+	return influx.New(influx.Options{URL: url, Bucket: bucket, Org: org, Token: token, CAFile: caFile, FlushEvery: every})
+}
+
+// closeInflux writes what is still queued and reports scans that never
+// made it, which the UI has no place for.
+func closeInflux(exp *influx.Exporter) {
+	exp.Close()
+	s := exp.Stats()
+	if lost := s.Dropped + s.Rejected + uint64(s.Queued); lost > 0 {
+		fmt.Fprintf(os.Stderr, "InfluxDB export: %d of %d scans not written (%d dropped from a full queue, %d refused, %d unsent at exit); last error: %s\n",
+			lost, lost+s.Written, s.Dropped, s.Rejected, s.Queued, s.LastError)
+	}
+}
+
+// openNotify starts the webhook and mail notifiers of the config's notify
+// section. Secrets are only read from the environment, like the InfluxDB
+// token. The returned func stops them and reports notifications that
+// never made it, which the UI has no place for at exit.
+func openNotify(t *tracker.Tracker, n *config.Notify) (func(), error) {
+	failed := func(sink string) func(error) {
+		return func(err error) { t.NotifyFailed(sink, err) }
+	}
+	var sinks []tracker.Notifier
+	var closers []func() error
+	if len(n.Webhooks) > 0 {
+		targets := make([]notify.WebhookTarget, 0, len(n.Webhooks))
+		for _, w := range n.Webhooks {
+			target := notify.WebhookTarget{URL: w.URL}
+			if w.SecretEnv != "" {
+				target.Secret = os.Getenv(w.SecretEnv)
+				if target.Secret == "" {
+					return nil, fmt.Errorf("notify webhook secret_env: $%s is empty or unset", w.SecretEnv)
+				}
+			}
+			targets = append(targets, target)
+		}
+		wh, err := notify.NewWebhook(notify.WebhookOptions{Targets: targets, Failed: failed("webhook")})
+		if err != nil {
+			return nil, err
+		}
+		sinks, closers = append(sinks, wh), append(closers, wh.Close)
+	}
+	if e := n.Email; e != nil {
+		o := notify.MailOptions{Server: e.Server, From: e.From, To: e.To, Username: e.Username, Failed: failed("email")}
+		if e.PasswordEnv != "" {
+			o.Password = os.Getenv(e.PasswordEnv)
+			if o.Password == "" {
+				return nil, fmt.Errorf("notify email password_env: $%s is empty or unset", e.PasswordEnv)
+			}
+		}
+		if e.Batch != "" {
+			d, err := time.ParseDuration(e.Batch)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("notify email batch %q: want a positive duration", e.Batch)
+			}
+			o.Batch = d
+		}
+		m, err := notify.NewMail(o)
+		if err != nil {
+			return nil, err
+		}
+		sinks, closers = append(sinks, m), append(closers, m.Close)
+	}
+	t.SetNotifiers(n.RateLimit, sinks...)
+	return func() {
+		for _, c := range closers {
+			c()
+		}
+		if h := t.Health(); h.NotifyFailures > 0 || h.NotifyDropped > 0 {
+			fmt.Fprintf(os.Stderr, "Notifications: %d failed, %d dropped by the rate limit; last error: %s\n",
+				h.NotifyFailures, h.NotifyDropped, h.NotifyLastError)
+		}
+	}, nil
+}
+
+// openEventLog opens the event log at the flag's path or the config's,
+// with the flag's severity floor or the config's.
+func openEventLog(cfg *config.Config, pinned map[string]bool, path, level string) (*eventlog.Writer, error) {
+	if path == "" {
+		path = cfg.EventLog
+	}
+	if !pinned["event-log-level"] {
+		level = cfg.EventLogLevel
+	}
+	floor, err := tracker.ParseSeverity(level)
+	if err != nil {
+		return nil, err
+	}
+	return eventlog.Open(path, floor)
+}
+
+// closeEventLog writes what is still queued and reports events that never
+// made it.
+func closeEventLog(w *eventlog.Writer) {
+	if err := w.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Event log: %v\n", err)
+	}
+	if s := w.Stats(); s.Dropped > 0 || s.LastError != "" {
+		fmt.Fprintf(os.Stderr, "Event log %s: %d events written, %d dropped from a full queue; last error: %s\n",
+			w.Path(), s.Written, s.Dropped, s.LastError)
+	}
+}
+
+// openState warm-starts t from the state file and keeps it saved. Every
+// problem is a warning: the tracker runs without state, or without the
+// sections it could not read.
+func openState(t *tracker.Tracker, path string, cfg *config.Config) {
+	every := tracker.DefaultStateSaveInterval
+	if cfg.StateSaveInterval != "" {
+		d, err := time.ParseDuration(cfg.StateSaveInterval)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Warning: invalid state_save_interval %q\n", cfg.StateSaveInterval)
+		} else {
+			every = d
+		}
+	}
+	s, err := tracker.OpenState(path)
+	if s == nil {
+		fmt.Fprintf(os.Stderr, "Warning: running without saved state: %v\n", err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if err := t.SetStateStore(s, every); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// alertRuleFromConfig builds the alert thresholds stored in the config file.
+// Unparsable durations are treated as off and reported in the error.
+func alertRuleFromConfig(cfg *config.Config) (tracker.AlertRule, error) {
+	var r tracker.AlertRule
+	var firstErr error
+	parse := func(name, v string) time.Duration {
+		if v == "" {
+			return 0
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid %s %q: %v", name, v, err)
+			}
+			return 0
+		}
+		return d
+	}
+	r.PingWarn = parse("alert_ping_warn", cfg.AlertPingWarn)
+	r.PingThreshold = parse("alert_ping", cfg.AlertPing)
+	r.LossWarn = cfg.AlertLossWarn
+	r.LossThreshold = cfg.AlertLoss
+	r.RateThreshold = cfg.AlertRate
+	r.StallTime = parse("alert_stall", cfg.AlertStall)
+	r.SendQThreshold = cfg.AlertSendQ
+	r.SendQScans = cfg.AlertSendQScans
+	r.ScoreThreshold = cfg.AlertScore
+	r.ScoreScans = cfg.AlertScoreScans
+	r.AppSockMemThreshold = cfg.AlertAppSockMem
+	return r, firstErr
+}
+
+// deltaOptionsFromConfig returns the delta view thresholds, defaulting to
+// 100 KB/s for rate crossings.
+func deltaOptionsFromConfig(cfg *config.Config) tracker.DiffOptions {
+	opts := tracker.DefaultDiffOptions
+	opts.RateThreshold = 100 << 10
+	if cfg.DeltaPingPct > 0 {
+		opts.PingChangePct = cfg.DeltaPingPct
+	}
+	if cfg.DeltaRate > 0 {
+		opts.RateThreshold = cfg.DeltaRate
+	}
+	return opts
+}
+
+// sortHysteresisFromConfig is the rate sort hysteresis as a fraction.
+func sortHysteresisFromConfig(cfg *config.Config) float64 {
+	switch {
+	case cfg.SortHysteresis < 0:
+		return 0
+	case cfg.SortHysteresis > 0:
+		return cfg.SortHysteresis / 100
+	}
+	return tui.DefaultSortHysteresis
+}
+
+// isFirstRun reports whether neither the config nor the state file exists
+// yet. It must be called before anything creates them.
+func isFirstRun() bool {
+	dir, err := config.Dir()
+	if err != nil {
+		return false
+	}
+	for _, name := range []string{"config.json", "state.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveOnboardingDone records in the config file that the introduction was
+// dismissed, keeping every other setting.
+func saveOnboardingDone() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg.OnboardingDone = true
+	return config.Save(cfg)
+}
+
+// saveAlertRule writes thresholds edited in the TUI back to the config file,
+// keeping every other setting. A config file that fails to parse is left alone.
+func saveAlertRule(r tracker.AlertRule) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg.AlertPingWarn, cfg.AlertPing = "", ""
+	if r.PingWarn > 0 {
+		cfg.AlertPingWarn = r.PingWarn.String()
+	}
+	if r.PingThreshold > 0 {
+		cfg.AlertPing = r.PingThreshold.String()
+	}
+	cfg.AlertLossWarn = r.LossWarn
+	cfg.AlertLoss = r.LossThreshold
+	cfg.AlertRate = r.RateThreshold
+	cfg.AlertStall = ""
+	if r.StallTime > 0 {
+		cfg.AlertStall = r.StallTime.String()
+	}
+	cfg.AlertSendQ = r.SendQThreshold
+	cfg.AlertSendQScans = r.SendQScans
+	cfg.AlertScore = r.ScoreThreshold
+	cfg.AlertScoreScans = r.ScoreScans
+	cfg.AlertAppSockMem = r.AppSockMemThreshold
+	return config.Save(cfg)
+}
+
+// auditRulesFromConfig returns the configured audit rules, or the built-in
+// ones if none are configured.
+func auditRulesFromConfig(cfg *config.Config) []tracker.AuditRule {
+	if len(cfg.AuditRules) == 0 {
+		return tracker.DefaultAuditRules()
+	}
+	var rules []tracker.AuditRule
+	for _, r := range cfg.AuditRules {
+		rule := tracker.AuditRule{
+			Name:          r.Name,
+			Score:         r.Score,
+			PathPrefixes:  r.PathPrefixes,
+			WorldWritable: r.WorldWritable,
+			Deleted:       r.Deleted,
+		}
+		if r.ModifiedWithin != "" {
+			d, err := time.ParseDuration(r.ModifiedWithin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: audit rule %q: invalid modified_within %q: %v\n", r.Name, r.ModifiedWithin, err)
+				continue
+			}
+			rule.ModifiedWithin = d
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// listenerSuppressionsFromConfig returns the configured new-listener
+// suppressions. Invalid rules are skipped and the first one reported.
+func listenerSuppressionsFromConfig(cfg *config.Config) ([]tracker.ListenerSuppression, error) {
+	var rules []tracker.ListenerSuppression
+	var firstErr error
+	for i, r := range cfg.ListenerSuppress {
+		rule := tracker.ListenerSuppression{App: r.App}
+		var err error
+		if r.Ports != "" {
+			rule.Ports, err = tracker.ParsePortRange(r.Ports)
+		} else if r.App == "" {
+			err = fmt.Errorf("needs app, ports or both")
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("listener_suppress rule %d: %v", i+1, err)
+			}
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, firstErr
+}
+
+// serviceChecksFromConfig returns the configured service checks. Invalid
+// checks, and a second check of the same name, are skipped and the first
+// one reported.
+func serviceChecksFromConfig(cfg *config.Config) ([]tracker.ServiceCheckDef, error) {
+	var defs []tracker.ServiceCheckDef
+	var firstErr error
+	seen := make(map[string]bool, len(cfg.ServiceChecks))
+	for _, c := range cfg.ServiceChecks {
+		def, err := tracker.ParseServiceCheck(c.Name, c.Proto, c.Port, c.Remote, c.Query, c.Path, c.Host, c.Every, c.Timeout)
+		if err == nil && seen[def.Name] {
+			err = fmt.Errorf("service check %q is defined twice", def.Name)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("service_checks: %v", err)
+			}
+			continue
+		}
+		seen[def.Name] = true
+		defs = append(defs, def)
+	}
+	return defs, firstErr
+}
+
+// triggersFromConfig returns the configured trigger rules. Invalid rules,
+// and a second rule of the same name, are skipped and the first one
+// reported.
+func triggersFromConfig(cfg *config.Config) ([]tracker.TriggerRule, error) {
+	var rules []tracker.TriggerRule
+	var firstErr error
+	seen := make(map[string]bool, len(cfg.Triggers))
+	for _, c := range cfg.Triggers {
+		rule, err := tracker.ParseTrigger(c.Name, c.Filter, c.On, c.Run, c.MinInterval, c.Timeout, c.Disabled)
+		if err == nil && seen[rule.Name] {
+			err = fmt.Errorf("trigger %q is defined twice", rule.Name)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("triggers: %v", err)
+			}
+			continue
+		}
+		seen[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, firstErr
+}
+
+// derivedColumnsFromConfig parses the configured derived columns. Any bad
+// expression or repeated name fails the whole list.
+func derivedColumnsFromConfig(cfg *config.Config) ([]tracker.DerivedColumn, error) {
+	cols := make([]tracker.DerivedColumn, 0, len(cfg.DerivedColumns))
+	seen := make(map[string]bool, len(cfg.DerivedColumns))
+	for _, d := range cfg.DerivedColumns {
+		if seen[d.Name] {
+			return nil, fmt.Errorf("derived_columns: column %q is defined twice", d.Name)
+		}
+		seen[d.Name] = true
+		col, err := tracker.ParseDerivedColumn(d.Name, d.Expr)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// loadThrottleFromConfig parses the load throttle settings; -load-high
+// given on the command line wins over load_high.
+func loadThrottleFromConfig(cfg *config.Config, pinned map[string]bool, flagHigh float64) (tracker.LoadThrottle, error) {
+	high := cfg.LoadHigh
+	if pinned["load-high"] {
+		high = flagHigh
+	}
+	return tracker.ParseLoadThrottle(high, cfg.LoadLow, cfg.LoadIntervalFactor, cfg.LoadProbeConcurrency)
+}
+
+// scheduleFromConfig parses the configured schedule windows. Any bad
+// window fails the whole schedule.
+func scheduleFromConfig(cfg *config.Config) (tracker.Schedule, error) {
+	var s tracker.Schedule
+	for _, w := range cfg.Schedule {
+		win, err := tracker.ParseScheduleWindow(w.Name, w.Days, w.Time, w.Probes, w.Silent, w.IntervalFactor)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, win)
+	}
+	return s, nil
 }
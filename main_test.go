@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ping-tracker/config"
+	"ping-tracker/tracker"
+)
+
+func TestListenerSuppressionsFromConfig(t *testing.T) {
+	cfg := &config.Config{ListenerSuppress: []config.ListenerSuppression{
+		{App: "transmission"},
+		{Ports: "6881-6999"},
+		{App: "vsftpd", Ports: "40000-40100"},
+		{},                                 // matches everything: rejected
+		{App: "qbittorrent", Ports: "9-3"}, // reversed range
+	}}
+	rules, err := listenerSuppressionsFromConfig(cfg)
+	if err == nil || !strings.HasPrefix(err.Error(), "listener_suppress rule 4: ") {
+		t.Errorf("error %v, want rule 4 reported", err)
+	}
+	want := []tracker.ListenerSuppression{
+		{App: "transmission"},
+		{Ports: tracker.PortRange{Low: 6881, High: 6999}},
+		{App: "vsftpd", Ports: tracker.PortRange{Low: 40000, High: 40100}},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules %+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d: %+v, want %+v", i+1, rules[i], want[i])
+		}
+	}
+}
+
+// TestOnboardingDonePersists dismisses the introduction in a fresh config
+// directory and checks it stays dismissed, keeping the other settings.
+func TestOnboardingDonePersists(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	if !isFirstRun() {
+		t.Fatal("empty config directory is not a first run")
+	}
+	if err := config.Save(&config.Config{Interval: "5s"}); err != nil {
+		t.Fatal(err)
+	}
+	if isFirstRun() {
+		t.Error("first run with a config file")
+	}
+	if err := saveOnboardingDone(); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.OnboardingDone || cfg.Interval != "5s" {
+		t.Errorf("after dismissal: %+v", cfg)
+	}
+
+	// state.json alone also means the program ran before.
+	cdir, _ := config.Dir()
+	os.Remove(filepath.Join(cdir, "config.json"))
+	if !isFirstRun() {
+		t.Fatal("not a first run without files")
+	}
+	if err := os.WriteFile(filepath.Join(cdir, "state.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if isFirstRun() {
+		t.Error("first run with a state file")
+	}
+}
+
+func TestDerivedColumnsFromConfig(t *testing.T) {
+	cfg := &config.Config{DerivedColumns: []config.DerivedColumn{
+		{Name: "weighted", Expr: "ping_ms * (1 + loss / 100)"},
+		{Name: "total", Expr: "tx_rate + rx_rate"},
+	}}
+	cols, err := derivedColumnsFromConfig(cfg)
+	if err != nil || len(cols) != 2 || cols[0].Name != "weighted" || cols[1].Name != "total" {
+		t.Fatalf("%+v %v", cols, err)
+	}
+
+	for _, tt := range []struct {
+		cols []config.DerivedColumn
+		err  string
+	}{
+		{[]config.DerivedColumn{{Name: "a", Expr: "1"}, {Name: "a", Expr: "2"}}, `column "a" is defined twice`},
+		{[]config.DerivedColumn{{Name: "a", Expr: "1"}, {Name: "bad", Expr: "ping_ms * lost"}}, `column "bad": unknown identifier "lost"`},
+		{[]config.DerivedColumn{{Name: "open", Expr: "(1"}}, `column "open": missing )`},
+	} {
+		_, err := derivedColumnsFromConfig(&config.Config{DerivedColumns: tt.cols})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: error %v, want %s", tt.cols, err, tt.err)
+		}
+	}
+}
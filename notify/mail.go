@@ -0,0 +1,310 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// DefaultMailBatch is how long alerts are collected into one mail when
+// not told otherwise.
+const DefaultMailBatch = time.Minute
+
+const (
+	// mailMaxBatch caps the alerts listed in one mail; the rest are
+	// counted at its end.
+	mailMaxBatch = 200
+	// mailAttempts is how many times a mail is sent before it counts as
+	// failed.
+	mailAttempts = 3
+	// mailTimeout bounds one SMTP session.
+	mailTimeout = 30 * time.Second
+)
+
+var (
+	// The wait after a failed mail is mailFirstRetry, and twice as long
+	// after each further failure up to mailMaxRetry; tests shorten them.
+	mailFirstRetry = 15 * time.Second
+	mailMaxRetry   = time.Minute
+	// mailRootCAs verifies the server's certificate, nil for the system
+	// roots; tests replace it.
+	mailRootCAs *x509.CertPool
+)
+
+// MailOptions configures a Mail sink.
+type MailOptions struct {
+	Server   string // host:port of the submission server; port 587 when left out
+	From     string
+	To       []string
+	Username string // for SMTP AUTH PLAIN; none when empty
+	Password string
+	Batch    time.Duration // how long alerts are collected; 0 = DefaultMailBatch
+	// Failed is told of every mail not sent after the retries. It is
+	// called from the sink's goroutine; nil ignores failures.
+	Failed func(err error)
+}
+
+// Mail sends the alerts as plain-text mail through an SMTP server, always
+// over STARTTLS. The first alert starts a batch and everything raised or
+// cleared within Batch goes into the same mail, so a burst of alerts is
+// one mail rather than a storm of them. It implements tracker.Notifier.
+type Mail struct {
+	o    MailOptions
+	host string // the server's, for STARTTLS and AUTH
+	from string // the addresses alone, for the envelope
+	to   []string
+	me   string // this machine, in subjects
+
+	mu      sync.Mutex
+	pending []tracker.Notification
+	dropped int // beyond mailMaxBatch in the pending batch
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMail validates o and starts the sink.
+func NewMail(o MailOptions) (*Mail, error) {
+	if o.Server == "" {
+		return nil, fmt.Errorf("mail: no server")
+	}
+	if _, _, err := net.SplitHostPort(o.Server); err != nil {
+		o.Server = net.JoinHostPort(o.Server, "587")
+	}
+	host, _, err := net.SplitHostPort(o.Server)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("mail server %q: want host[:port]", o.Server)
+	}
+	from, err := mail.ParseAddress(o.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail from %q: %v", o.From, err)
+	}
+	if len(o.To) == 0 {
+		return nil, fmt.Errorf("mail: no recipient")
+	}
+	m := &Mail{o: o, host: host, from: from.Address, me: hostname(),
+		wake: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	for _, to := range o.To {
+		a, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("mail to %q: %v", to, err)
+		}
+		m.to = append(m.to, a.Address)
+	}
+	if m.o.Batch <= 0 {
+		m.o.Batch = DefaultMailBatch
+	}
+	go m.run()
+	return m, nil
+}
+
+// Notify implements tracker.Notifier. It adds n to the batch, starting
+// one if none is open.
+func (m *Mail) Notify(n tracker.Notification) {
+	m.mu.Lock()
+	if len(m.pending) < mailMaxBatch {
+		m.pending = append(m.pending, n)
+	} else {
+		m.dropped++
+	}
+	m.mu.Unlock()
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close sends the open batch, making one attempt, and stops the sink.
+func (m *Mail) Close() error {
+	close(m.stop)
+	<-m.done
+	return nil
+}
+
+func (m *Mail) run() {
+	defer close(m.done)
+	for {
+		select {
+		case <-m.stop:
+			if msg, n := m.take(); n > 0 {
+				if err := m.send(msg); err != nil {
+					m.fail(fmt.Errorf("%s not sent at exit: %w", plural(n, "alert"), err))
+				}
+			}
+			return
+		case <-m.wake:
+		}
+		// The batch is open: collect until it closes.
+		timer := time.NewTimer(m.o.Batch)
+		select {
+		case <-m.stop:
+			timer.Stop()
+		case <-timer.C:
+		}
+		msg, n := m.take()
+		if n == 0 {
+			continue
+		}
+		m.deliver(msg, n)
+	}
+}
+
+// deliver sends msg, of n alerts, retrying with backoff, and reports it
+// failed once the attempts run out. It gives up early when the sink stops.
+func (m *Mail) deliver(msg []byte, n int) {
+	for attempt := 1; ; attempt++ {
+		err := m.send(msg)
+		if err == nil {
+			return
+		}
+		if attempt == mailAttempts {
+			m.fail(fmt.Errorf("%s not sent: %w", plural(n, "alert"), err))
+			return
+		}
+		timer := time.NewTimer(backoff(attempt, mailFirstRetry, mailMaxRetry))
+		select {
+		case <-m.stop:
+			timer.Stop()
+			m.fail(fmt.Errorf("%s not sent, stopped while retrying: %w", plural(n, "alert"), err))
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// take closes the pending batch and returns it as a mail, with the number
+// of alerts in it.
+func (m *Mail) take() ([]byte, int) {
+	m.mu.Lock()
+	batch, dropped := m.pending, m.dropped
+	m.pending, m.dropped = nil, 0
+	m.mu.Unlock()
+	if len(batch) == 0 {
+		return nil, 0
+	}
+	return m.compose(batch, dropped, time.Now()), len(batch) + dropped
+}
+
+// compose writes the mail listing batch, one line per alert, plus a count
+// of the dropped ones.
+func (m *Mail) compose(batch []tracker.Notification, dropped int, now time.Time) []byte {
+	// Values come from app names and the hostname: no line breaks.
+	oneLine := strings.NewReplacer("\r", " ", "\n", " ")
+	raised, cleared := 0, 0
+	var body strings.Builder
+	for _, n := range batch {
+		verb := "raised "
+		if n.Event == tracker.EventAlertCleared {
+			verb = "cleared"
+			cleared++
+		} else {
+			raised++
+		}
+		a := n.Alert
+		line := fmt.Sprintf("%s  %s  %s", n.Time.Format("2006-01-02 15:04:05 MST"), verb, a.AppName)
+		if a.Remote != "" {
+			line += "  " + a.Remote
+		}
+		if a.Reason != "" {
+			line += "  " + a.Reason
+		}
+		body.WriteString(oneLine.Replace(line) + "\r\n")
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&body, "\r\n%d more alerts in this batch are not listed.\r\n", dropped)
+	}
+
+	var parts []string
+	if raised > 0 {
+		parts = append(parts, plural(raised, "alert")+" raised")
+	}
+	if cleared > 0 {
+		parts = append(parts, plural(cleared, "alert")+" cleared")
+	}
+	subject := fmt.Sprintf("[ping-tracker] %s: %s", m.me, strings.Join(parts, ", "))
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, oneLine.Replace(value))
+	}
+	header("From", m.o.From)
+	header("To", strings.Join(m.o.To, ", "))
+	header("Subject", subject)
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	msg.WriteString("\r\n")
+	msg.WriteString(body.String())
+	return msg.Bytes()
+}
+
+// plural is "1 alert" or "3 alerts".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// send delivers msg in one SMTP session. The server must offer STARTTLS:
+// alerts and credentials do not go out in the clear.
+func (m *Mail) send(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", m.o.Server, mailTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		return fmt.Errorf("%s does not offer STARTTLS", m.o.Server)
+	}
+	if err := c.StartTLS(&tls.Config{ServerName: m.host, RootCAs: mailRootCAs, MinVersion: tls.VersionTLS12}); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+	if m.o.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.o.Username, m.o.Password, m.host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	for _, to := range m.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *Mail) fail(err error) {
+	if m.o.Failed != nil {
+		m.o.Failed(err)
+	}
+}
@@ -0,0 +1,400 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// smtpServer is a fake submission server. It offers STARTTLS unless
+// plain, takes AUTH PLAIN for user and pass once TLS is up, and answers
+// the first failData DATA commands with 451.
+type smtpServer struct {
+	ln       net.Listener
+	tls      *tls.Config
+	plain    bool
+	user     string
+	pass     string
+	failData int
+
+	mu     sync.Mutex
+	authed []string // the usernames that logged in
+	mails  []smtpMail
+	got    chan struct{} // signalled on every mail taken
+}
+
+// smtpMail is a mail the server took.
+type smtpMail struct {
+	from string
+	to   []string
+	tls  bool
+	data string
+}
+
+// newSMTPServer starts a server with a certificate for 127.0.0.1, trusted
+// by the mail sink for the test.
+func newSMTPServer(t *testing.T, plain bool) *smtpServer {
+	t.Helper()
+	// Borrow httptest's certificate rather than making one.
+	hs := httptest.NewTLSServer(nil)
+	cert, leaf := hs.TLS.Certificates[0], hs.Certificate()
+	hs.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	saved := mailRootCAs
+	mailRootCAs = roots
+	t.Cleanup(func() { mailRootCAs = saved })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, tls: &tls.Config{Certificates: []tls.Certificate{cert}}, plain: plain,
+		user: "alerts", pass: "hunter2", got: make(chan struct{}, 100)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tp := textproto.NewConn(conn)
+	secure := false
+	var m smtpMail
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			ext := []string{"250-fake", "250-8BITMIME"}
+			if !s.plain && !secure {
+				ext = append(ext, "250-STARTTLS")
+			}
+			if secure {
+				ext = append(ext, "250-AUTH PLAIN")
+			}
+			tp.PrintfLine("%s", strings.Join(ext, "\r\n"))
+			tp.PrintfLine("250 SIZE 1000000")
+		case "STARTTLS":
+			if s.plain || secure {
+				tp.PrintfLine("502 not now")
+				continue
+			}
+			tp.PrintfLine("220 go ahead")
+			tc := tls.Server(conn, s.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, secure = tc, true
+			tp = textproto.NewConn(tc)
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			cred, _ := base64.StdEncoding.DecodeString(resp)
+			if !secure || mech != "PLAIN" || string(cred) != "\x00"+s.user+"\x00"+s.pass {
+				tp.PrintfLine("535 authentication failed")
+				continue
+			}
+			s.mu.Lock()
+			s.authed = append(s.authed, s.user)
+			s.mu.Unlock()
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			m = smtpMail{from: strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">"), tls: secure}
+			if i := strings.Index(m.from, ">"); i >= 0 {
+				m.from = m.from[:i] // parameters such as BODY=8BITMIME
+			}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.to = append(m.to, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			fail := s.failData > 0
+			if fail {
+				s.failData--
+			} else {
+				m.data = string(data)
+				s.mails = append(s.mails, m)
+			}
+			s.mu.Unlock()
+			if fail {
+				tp.PrintfLine("451 try again later")
+				continue
+			}
+			tp.PrintfLine("250 queued")
+			s.got <- struct{}{}
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// options returns MailOptions for the server, logging in as its user.
+func (s *smtpServer) options(failed failures) MailOptions {
+	return MailOptions{
+		Server: s.ln.Addr().String(), From: "Ping Tracker <tracker@example.com>", To: []string{"ops@example.com", "Me <me@example.com>"},
+		Username: s.user, Password: s.pass, Batch: 50 * time.Millisecond, Failed: failed.report,
+	}
+}
+
+// wait waits for n mails taken and returns all of them.
+func (s *smtpServer) wait(t *testing.T, n int) []smtpMail {
+	t.Helper()
+	for range n {
+		select {
+		case <-s.got:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no mail taken in 5s")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMail(nil), s.mails...)
+}
+
+func (s *smtpServer) logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.authed)
+}
+
+func TestNewMailInvalid(t *testing.T) {
+	ok := MailOptions{Server: "mail.example.com", From: "tracker@example.com", To: []string{"ops@example.com"}}
+	for name, change := range map[string]func(*MailOptions){
+		"no server":    func(o *MailOptions) { o.Server = "" },
+		"no host":      func(o *MailOptions) { o.Server = ":25" },
+		"bad from":     func(o *MailOptions) { o.From = "tracker" },
+		"no recipient": func(o *MailOptions) { o.To = nil },
+		"bad to":       func(o *MailOptions) { o.To = []string{"ops@example.com", "ops"} },
+	} {
+		o := ok
+		change(&o)
+		if _, err := NewMail(o); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	m, err := NewMail(ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.o.Server != "mail.example.com:587" || m.o.Batch != DefaultMailBatch {
+		t.Errorf("defaults: server %s, batch %s", m.o.Server, m.o.Batch)
+	}
+}
+
+// TestMailBatch checks that alerts within the batch window go out as one
+// mail, over TLS and logged in, to every recipient.
+func TestMailBatch(t *testing.T) {
+	s := newSMTPServer(t, false)
+	failed := make(failures, 10)
+	m, err := NewMail(s.options(failed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raised := pingAlert()
+	cleared := pingAlert()
+	cleared.Event = tracker.EventAlertCleared
+	m.Notify(raised)
+	m.Notify(raised)
+	m.Notify(cleared)
+	s.wait(t, 1)
+	m.Notify(raised)
+	mails := s.wait(t, 1)
+	m.Close()
+	failed.none(t)
+
+	if len(mails) != 2 {
+		t.Fatalf("%d mails, want 2", len(mails))
+	}
+	first := mails[0]
+	if !first.tls || s.logins() != 2 {
+		t.Errorf("tls %v, %d logins", first.tls, s.logins())
+	}
+	if first.from != "tracker@example.com" || strings.Join(first.to, " ") != "ops@example.com me@example.com" {
+		t.Errorf("envelope from %q to %q", first.from, first.to)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(first.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, want := msg.Header.Get("Subject"), ": 2 alerts raised, 1 alert cleared"; !strings.HasPrefix(subject, "[ping-tracker] ") || !strings.HasSuffix(subject, want) {
+		t.Errorf("subject %q", subject)
+	}
+	_, body, _ := strings.Cut(first.data, "\n\n") // ReadDotBytes ends lines in \n
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "cleared  game  [2001:db8:aa::5]:27015") {
+		t.Errorf("body %q", lines)
+	}
+	if subject := mustHeader(t, mails[1].data, "Subject"); !strings.HasSuffix(subject, ": 1 alert raised") {
+		t.Errorf("second mail %q", subject)
+	}
+}
+
+func mustHeader(t *testing.T, data, name string) string {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.Header.Get(name)
+}
+
+// TestMailRequiresSTARTTLS checks that a server without STARTTLS gets
+// neither the credentials nor the mail.
+func TestMailRequiresSTARTTLS(t *testing.T) {
+	withFastRetry(t)
+	s := newSMTPServer(t, true)
+	failed := make(failures, 10)
+	m, err := NewMail(s.options(failed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Notify(pingAlert())
+	err = failed.next(t)
+	m.Close()
+	if !strings.Contains(err.Error(), "does not offer STARTTLS") || !strings.HasPrefix(err.Error(), "1 alert not sent") {
+		t.Errorf("failure %v", err)
+	}
+	if s.logins() != 0 || len(s.mails) != 0 {
+		t.Errorf("%d logins, %d mails in the clear", s.logins(), len(s.mails))
+	}
+}
+
+func TestMailRetry(t *testing.T) {
+	withFastRetry(t)
+	s := newSMTPServer(t, false)
+	s.failData = mailAttempts - 1
+	failed := make(failures, 10)
+	m, err := NewMail(s.options(failed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Notify(pingAlert())
+	s.wait(t, 1)
+	failed.none(t)
+
+	// One failure more than the attempts is reported.
+	s.mu.Lock()
+	s.failData = mailAttempts
+	s.mu.Unlock()
+	m.Notify(pingAlert())
+	err = failed.next(t)
+	m.Close()
+	if !strings.Contains(err.Error(), "451") {
+		t.Errorf("failure %v", err)
+	}
+}
+
+func TestMailAuthFailed(t *testing.T) {
+	withFastRetry(t)
+	s := newSMTPServer(t, false)
+	failed := make(failures, 10)
+	o := s.options(failed)
+	o.Password = "wrong"
+	m, err := NewMail(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Notify(pingAlert())
+	err = failed.next(t)
+	m.Close()
+	if !strings.Contains(err.Error(), "auth: 535") {
+		t.Errorf("failure %v", err)
+	}
+}
+
+// TestMailClose checks that Close sends the open batch at once.
+func TestMailClose(t *testing.T) {
+	s := newSMTPServer(t, false)
+	failed := make(failures, 10)
+	o := s.options(failed)
+	o.Batch = time.Hour
+	m, err := NewMail(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Notify(pingAlert())
+	start := time.Now()
+	m.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Close took %s", d)
+	}
+	s.wait(t, 1)
+	failed.none(t)
+}
+
+// TestMailCompose checks the mail against a golden file, with line breaks
+// in the app name and the hostname kept out of the headers, and the
+// alerts beyond the batch cap counted.
+func TestMailCompose(t *testing.T) {
+	m := &Mail{o: MailOptions{From: "Ping Tracker <tracker@example.com>", To: []string{"ops@example.com"}},
+		me: "host1\r\nBcc: victim@example.com", wake: make(chan struct{}, 1)}
+	evil := pingAlert()
+	evil.Alert.AppName = "game\r\nBcc: victim@example.com\r\n\r\nforged body"
+	cleared := pingAlert()
+	cleared.Event = tracker.EventAlertCleared
+	cleared.Alert.Reason = ""
+	m.Notify(evil)
+	m.Notify(cleared)
+	for range mailMaxBatch {
+		m.Notify(pingAlert())
+	}
+	if len(m.pending) != mailMaxBatch || m.dropped != 2 {
+		t.Fatalf("%d pending, %d dropped", len(m.pending), m.dropped)
+	}
+	m.pending = m.pending[:3]
+	data := m.compose(m.pending, m.dropped, scanTime)
+	golden(t, "mail", strings.ReplaceAll(string(data), "\r\n", "\n"))
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Header["Bcc"]) != 0 || len(msg.Header) != 7 {
+		t.Errorf("headers %v", msg.Header)
+	}
+	sc := bufio.NewScanner(msg.Body)
+	n := 0
+	for sc.Scan() {
+		if strings.Contains(sc.Text(), "forged body") && !strings.Contains(sc.Text(), "raised ") {
+			t.Errorf("app name broke the line: %q", sc.Text())
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("%d body lines, want 3 alerts, a blank and the count", n)
+	}
+}
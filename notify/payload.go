@@ -0,0 +1,129 @@
+// Package notify sends alerts on as they are raised and cleared: as JSON
+// to webhooks, and by mail. Both implement tracker.Notifier.
+package notify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// PayloadVersion is the version of the webhook payload. It changes when a
+// field is renamed or removed or changes meaning; new fields may be added
+// without a new version.
+const PayloadVersion = 1
+
+// Payload is the JSON body a webhook receives for one alert.
+type Payload struct {
+	Version   int       `json:"version"`
+	Event     string    `json:"event"` // alert_raised or alert_cleared
+	Kind      string    `json:"kind"`  // threshold, unhealthy, service_check, sockmem or new_listener
+	Host      string    `json:"host"`  // the machine the tracker runs on
+	Timestamp time.Time `json:"timestamp"`
+	Key       string    `json:"key"` // the same for an alert's raise and clear
+	App       string    `json:"app"`
+	Remote    string    `json:"remote,omitempty"`
+	Reason    string    `json:"reason"`
+	Metric    *Metric   `json:"metric,omitempty"` // for alerts about a measurement
+
+	// Connection is the connection alerted on as of the scan; absent for
+	// an app's alert, or when the connection closed.
+	Connection *Connection `json:"connection,omitempty"`
+}
+
+// Metric is the measurement an alert is about, named with its unit (see
+// tracker.MetricPing and the others), and the threshold it crossed.
+type Metric struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Connection is the part of a connection a payload carries. Local and
+// Remote are host:port, IPv6 addresses in brackets; Remote is "" for a
+// listener. PingMs is 0 when the remote was not probed.
+type Connection struct {
+	PID       int       `json:"pid"`
+	App       string    `json:"app"`
+	Proto     string    `json:"proto"`
+	Direction string    `json:"direction"`
+	Local     string    `json:"local"`
+	Remote    string    `json:"remote"`
+	State     string    `json:"state"`
+	PingMs    float64   `json:"ping_ms"`
+	LossPct   float64   `json:"loss_pct"`
+	TxRate    float64   `json:"tx_bytes_per_s"`
+	RxRate    float64   `json:"rx_bytes_per_s"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// NewPayload returns the payload of n, sent from host.
+func NewPayload(n tracker.Notification, host string) Payload {
+	a := n.Alert
+	p := Payload{
+		Version:   PayloadVersion,
+		Event:     n.Event,
+		Kind:      a.Kind,
+		Host:      host,
+		Timestamp: n.Time.UTC(),
+		Key:       a.Key,
+		App:       a.AppName,
+		Remote:    a.Remote,
+		Reason:    a.Reason,
+	}
+	if p.Kind == "" {
+		p.Kind = "threshold"
+	}
+	if a.Metric != "" {
+		p.Metric = &Metric{Name: a.Metric, Value: a.Value, Threshold: a.Threshold}
+	}
+	if c := n.Conn; c != nil {
+		p.Connection = &Connection{
+			PID:       c.PID,
+			App:       c.AppName,
+			Proto:     c.DisplayProtocol(),
+			Direction: string(c.Direction),
+			Local:     endpoint(c.LocalAddr, c.LocalPort),
+			Remote:    endpoint(c.RemoteAddr, c.RemotePort),
+			State:     string(c.State),
+			PingMs:    float64(c.Ping) / float64(time.Millisecond),
+			LossPct:   c.Loss,
+			TxRate:    c.TxRate,
+			RxRate:    c.RxRate,
+			FirstSeen: c.FirstSeen.UTC(),
+		}
+	}
+	return p
+}
+
+// endpoint is addr:port, with an IPv6 address in brackets, or "" for a
+// listener's missing remote.
+func endpoint(addr string, port int) string {
+	if addr == "" {
+		return ""
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// hostname is the host payloads and mails name, "unknown" when the system
+// will not say.
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		return "unknown"
+	}
+	return h
+}
+
+// backoff is the wait before retry n (1 for the first), doubling from
+// first up to limit.
+func backoff(n int, first, limit time.Duration) time.Duration {
+	d := first
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+// scanTime is the scan the test notifications come from, off UTC so the
+// payload's conversion shows.
+var scanTime = time.Date(2026, 3, 14, 15, 9, 26, 0, time.FixedZone("CET", 3600))
+
+// pingAlert is a threshold alert raised on a game's connection.
+func pingAlert() tracker.Notification {
+	c := &tracker.Connection{
+		AppName: "game", PID: 4242, Protocol: "tcp6", Family: 6, State: tracker.StateEstablished,
+		Direction: tracker.Outbound, LocalAddr: "2001:db8::2", LocalPort: 51234,
+		RemoteAddr: "2001:db8:aa::5", RemotePort: 27015,
+		Ping: 187500 * time.Microsecond, Loss: 2.5, TxRate: 1200, RxRate: 48000.5,
+		FirstSeen: scanTime.Add(-time.Hour),
+	}
+	return tracker.Notification{
+		Event: tracker.EventAlertRaised,
+		Time:  scanTime,
+		Alert: tracker.Alert{
+			Key: c.Key(), AppName: "game", Remote: "[2001:db8:aa::5]:27015", Reason: "ping 187ms > 150ms",
+			Metric: tracker.MetricPing, Value: 187.5, Threshold: 150,
+		},
+		Conn: c,
+	}
+}
+
+func TestPayloadGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		n    tracker.Notification
+	}{
+		{"payload_threshold", pingAlert()},
+		{"payload_cleared", tracker.Notification{
+			Event: tracker.EventAlertCleared,
+			Time:  scanTime,
+			Alert: tracker.Alert{Key: "4242:tcp:10.0.0.2:51234->203.0.113.5:27015", AppName: "game", Remote: "203.0.113.5:27015", Reason: "ping back under 150ms"},
+		}},
+		{"payload_sockmem", tracker.Notification{
+			Event: tracker.EventAlertRaised,
+			Time:  scanTime,
+			Alert: tracker.Alert{
+				Kind: tracker.AlertSockMem, Key: "sockmem:backup", AppName: "backup", Reason: "socket memory 96.0 MB > 64.0 MB",
+				Metric: tracker.MetricSockMem, Value: 96 << 20, Threshold: 64 << 20,
+			},
+		}},
+		{"payload_new_listener", tracker.Notification{
+			Event: tracker.EventAlertRaised,
+			Time:  scanTime,
+			Alert: tracker.Alert{Kind: tracker.AlertNewListener, Key: "listen:tcp:0.0.0.0:8080", AppName: "devserver", Reason: "new listener on 0.0.0.0:8080"},
+			Conn: &tracker.Connection{
+				AppName: "devserver", PID: 77, Protocol: "tcp", State: tracker.StateListening, Direction: tracker.Inbound,
+				LocalAddr: "0.0.0.0", LocalPort: 8080, FirstSeen: scanTime,
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.MarshalIndent(NewPayload(tt.n, "host1"), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, string(b)+"\n")
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{5, 32 * time.Second},
+		{6, time.Minute},
+		{50, time.Minute},
+	} {
+		if got := backoff(tt.n, 2*time.Second, time.Minute); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
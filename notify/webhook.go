@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// SignatureHeader carries, when the webhook has a secret, the HMAC-SHA256
+// of the request body keyed with it: "sha256=" and the hex digest.
+const SignatureHeader = "X-Ping-Tracker-Signature"
+
+const (
+	// webhookQueue bounds the payloads waiting for one URL; when it is
+	// full the oldest is dropped.
+	webhookQueue = 100
+	// webhookAttempts is how many times a payload is posted before it
+	// counts as failed.
+	webhookAttempts = 5
+	// webhookTimeout bounds one request.
+	webhookTimeout = 10 * time.Second
+)
+
+// The wait after a failed post starts at webhookFirstRetry and doubles up
+// to webhookMaxRetry; tests shorten them.
+var (
+	webhookFirstRetry = 2 * time.Second
+	webhookMaxRetry   = time.Minute
+)
+
+// WebhookTarget is a URL payloads are posted to, and the secret they are
+// signed with ("" for none).
+type WebhookTarget struct {
+	URL    string
+	Secret string
+}
+
+// WebhookOptions configures a Webhook.
+type WebhookOptions struct {
+	Targets []WebhookTarget
+	// Failed is told of every payload a URL did not take, after the
+	// retries, or that was dropped from a full queue. It is called from
+	// the webhook's goroutines; nil ignores failures.
+	Failed func(err error)
+}
+
+// Webhook posts a JSON Payload per notification to each of its URLs. Each
+// URL has its own queue and goroutine, so a slow or failing one does not
+// hold up the others; failed posts are retried with exponential backoff.
+// It implements tracker.Notifier.
+type Webhook struct {
+	host    string
+	targets []*webhookTarget
+}
+
+// webhookTarget is one URL's queue and sender.
+type webhookTarget struct {
+	url    string
+	name   string // scheme and host, for errors: the path may be a secret
+	secret []byte
+	client *http.Client
+	failed func(error)
+
+	mu    sync.Mutex
+	queue [][]byte
+	wake  chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewWebhook validates o and starts posting.
+func NewWebhook(o WebhookOptions) (*Webhook, error) {
+	if len(o.Targets) == 0 {
+		return nil, fmt.Errorf("webhook: no URL")
+	}
+	w := &Webhook{host: hostname()}
+	for _, t := range o.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook url %q: want http(s)://host[:port]/path", t.URL)
+		}
+		w.targets = append(w.targets, &webhookTarget{
+			url:    t.URL,
+			name:   u.Scheme + "://" + u.Host,
+			secret: []byte(t.Secret),
+			client: &http.Client{Timeout: webhookTimeout},
+			failed: o.Failed,
+			wake:   make(chan struct{}, 1),
+			stop:   make(chan struct{}),
+			done:   make(chan struct{}),
+		})
+	}
+	for _, t := range w.targets {
+		go t.run()
+	}
+	return w, nil
+}
+
+// Notify implements tracker.Notifier. It encodes n and queues it for
+// every URL.
+func (w *Webhook) Notify(n tracker.Notification) {
+	body, err := json.Marshal(NewPayload(n, w.host))
+	if err != nil {
+		return
+	}
+	for _, t := range w.targets {
+		t.push(body)
+	}
+}
+
+// Close stops posting and waits for the requests in flight. Payloads still
+// queued are reported as failed.
+func (w *Webhook) Close() error {
+	for _, t := range w.targets {
+		close(t.stop)
+	}
+	for _, t := range w.targets {
+		<-t.done
+	}
+	return nil
+}
+
+// push queues body, dropping the oldest payload when the queue is full.
+func (t *webhookTarget) push(body []byte) {
+	t.mu.Lock()
+	full := len(t.queue) >= webhookQueue
+	if full {
+		t.queue = t.queue[1:]
+	}
+	t.queue = append(t.queue, body)
+	t.mu.Unlock()
+	if full {
+		t.fail(fmt.Errorf("queue full, oldest notification dropped"))
+	}
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the oldest queued payload, or nil.
+func (t *webhookTarget) pop() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) == 0 {
+		return nil
+	}
+	body := t.queue[0]
+	t.queue = t.queue[1:]
+	return body
+}
+
+func (t *webhookTarget) run() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.stop:
+			t.unsent()
+			return
+		case <-t.wake:
+		}
+		for body := t.pop(); body != nil; body = t.pop() {
+			// Once stopped, only the request in flight is finished.
+			if !t.deliver(body) || t.stopped() {
+				t.unsent()
+				return
+			}
+		}
+	}
+}
+
+// stopped reports whether Close was called.
+func (t *webhookTarget) stopped() bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// unsent reports the payloads still queued as failed.
+func (t *webhookTarget) unsent() {
+	t.mu.Lock()
+	n := len(t.queue)
+	t.queue = nil
+	t.mu.Unlock()
+	if n > 0 {
+		t.fail(fmt.Errorf("%d notifications unsent at exit", n))
+	}
+}
+
+// deliver posts body until the server takes it, refuses it, or the
+// attempts run out, reporting the last two as failures. It returns false
+// when the target was stopped while waiting to retry.
+func (t *webhookTarget) deliver(body []byte) bool {
+	for attempt := 1; ; attempt++ {
+		err := t.post(body)
+		if err == nil {
+			return true
+		}
+		if _, retry := err.(retryable); !retry || attempt == webhookAttempts {
+			t.fail(err)
+			return true
+		}
+		timer := time.NewTimer(backoff(attempt, webhookFirstRetry, webhookMaxRetry))
+		select {
+		case <-t.stop:
+			timer.Stop()
+			t.fail(fmt.Errorf("stopped while retrying: %w", err))
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable is a post error worth trying again: the network, the server
+// being overloaded or down.
+type retryable struct{ err error }
+
+func (r retryable) Error() string { return r.err.Error() }
+
+// post sends one request. 429 and 5xx answers are retryable; other
+// non-2xx answers mean the receiver will not take the payload.
+func (t *webhookTarget) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(t.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(t.secret, body))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// Not the url.Error itself: it quotes the URL, path and all.
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return retryable{err}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500 {
+		return retryable{err}
+	}
+	return err
+}
+
+// fail reports err, naming the URL by its scheme and host.
+func (t *webhookTarget) fail(err error) {
+	if t.failed != nil {
+		t.failed(fmt.Errorf("%s: %w", t.name, err))
+	}
+}
+
+// Sign returns the SignatureHeader value of body under secret, for
+// receivers to compare with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// withFastRetry shortens the waits between attempts for the test.
+func withFastRetry(t *testing.T) {
+	t.Helper()
+	saved := [4]time.Duration{webhookFirstRetry, webhookMaxRetry, mailFirstRetry, mailMaxRetry}
+	webhookFirstRetry, webhookMaxRetry = time.Millisecond, 4*time.Millisecond
+	mailFirstRetry, mailMaxRetry = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() {
+		webhookFirstRetry, webhookMaxRetry, mailFirstRetry, mailMaxRetry = saved[0], saved[1], saved[2], saved[3]
+	})
+}
+
+// failures collects the errors a sink reports.
+type failures chan error
+
+func (f failures) report(err error) { f <- err }
+
+// next waits for the next failure.
+func (f failures) next(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-f:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("no failure reported in 5s")
+		return nil
+	}
+}
+
+// none checks that nothing was reported.
+func (f failures) none(t *testing.T) {
+	t.Helper()
+	select {
+	case err := <-f:
+		t.Errorf("failure reported: %v", err)
+	default:
+	}
+}
+
+// receiver is a webhook endpoint answering with the statuses in order,
+// then 204, and recording the requests.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	sigs     []string
+	got      chan struct{} // signalled on every 2xx answer
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, got: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.bodies = append(r.bodies, body)
+		r.sigs = append(r.sigs, req.Header.Get(SignatureHeader))
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		if status/100 == 2 {
+			r.got <- struct{}{}
+		} else {
+			fmt.Fprintln(w, "try later")
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// wait waits for n payloads taken.
+func (r *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-r.got:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no payload taken in 5s")
+		}
+	}
+}
+
+// requests returns the bodies and signatures received so far.
+func (r *receiver) requests() ([][]byte, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.bodies...), append([]string(nil), r.sigs...)
+}
+
+func TestNewWebhookInvalid(t *testing.T) {
+	for _, u := range []string{"", "ftp://example.com/hook", "http:///hook", "example.com/hook", "http://%zz"} {
+		if _, err := NewWebhook(WebhookOptions{Targets: []WebhookTarget{{URL: u}}}); err == nil {
+			t.Errorf("%q accepted", u)
+		}
+	}
+	if _, err := NewWebhook(WebhookOptions{}); err == nil {
+		t.Error("accepted without a URL")
+	}
+}
+
+// TestWebhookRetry checks that overloaded and failing answers are retried
+// until the receiver takes the payload, every attempt signed.
+func TestWebhookRetry(t *testing.T) {
+	withFastRetry(t)
+	r := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusRequestTimeout)
+	failed := make(failures, 10)
+	w, err := NewWebhook(WebhookOptions{Targets: []WebhookTarget{{URL: r.URL + "/hook", Secret: "s3cret"}}, Failed: failed.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Notify(pingAlert())
+	r.wait(t, 1)
+	w.Close()
+	failed.none(t)
+
+	bodies, sigs := r.requests()
+	if len(bodies) != 4 {
+		t.Fatalf("%d attempts, want 4", len(bodies))
+	}
+	for i, body := range bodies {
+		if string(body) != string(bodies[0]) {
+			t.Errorf("attempt %d posted another body", i+1)
+		}
+		if want := Sign([]byte("s3cret"), body); !hmac.Equal([]byte(sigs[i]), []byte(want)) {
+			t.Errorf("attempt %d signed %q, want %q", i+1, sigs[i], want)
+		}
+	}
+	if !strings.HasPrefix(sigs[0], "sha256=") || len(sigs[0]) != len("sha256=")+64 {
+		t.Errorf("signature %q", sigs[0])
+	}
+	var p Payload
+	if err := json.Unmarshal(bodies[0], &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != PayloadVersion || p.Event != tracker.EventAlertRaised || p.App != "game" || p.Host == "" {
+		t.Errorf("payload %+v", p)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	r := newReceiver(t)
+	w, err := NewWebhook(WebhookOptions{Targets: []WebhookTarget{{URL: r.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Notify(pingAlert())
+	r.wait(t, 1)
+	w.Close()
+	if _, sigs := r.requests(); sigs[0] != "" {
+		t.Errorf("signed without a secret: %q", sigs[0])
+	}
+}
+
+// TestWebhookFailures checks that a refused payload is not retried, that
+// one still failing after the attempts is reported, and that the report
+// names the URL without its path.
+func TestWebhookFailures(t *testing.T) {
+	withFastRetry(t)
+	refuse := newReceiver(t, http.StatusForbidden)
+	down := newReceiver(t, 500, 502, 503, 504, 500, 500)
+	failed := make(failures, 10)
+	w, err := NewWebhook(WebhookOptions{
+		Targets: []WebhookTarget{{URL: refuse.URL + "/token/abc123"}, {URL: down.URL + "/token/abc123"}},
+		Failed:  failed.report,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Notify(pingAlert())
+	errs := []error{failed.next(t), failed.next(t)}
+	w.Close()
+
+	var forbidden, server bool
+	for _, err := range errs {
+		msg := err.Error()
+		if strings.Contains(msg, "abc123") {
+			t.Errorf("failure quotes the path: %s", msg)
+		}
+		switch {
+		case strings.HasPrefix(msg, refuse.URL+": 403 Forbidden: try later"):
+			forbidden = true
+		case strings.HasPrefix(msg, down.URL+": 500 Internal Server Error"):
+			server = true
+		default:
+			t.Errorf("failure %q", msg)
+		}
+	}
+	if !forbidden || !server {
+		t.Errorf("failures %v", errs)
+	}
+	if bodies, _ := refuse.requests(); len(bodies) != 1 {
+		t.Errorf("refused payload posted %d times", len(bodies))
+	}
+	if bodies, _ := down.requests(); len(bodies) != webhookAttempts {
+		t.Errorf("failing payload posted %d times, want %d", len(bodies), webhookAttempts)
+	}
+}
+
+func TestWebhookUnreachable(t *testing.T) {
+	withFastRetry(t)
+	r := newReceiver(t)
+	url := r.URL
+	r.Close()
+	failed := make(failures, 10)
+	w, err := NewWebhook(WebhookOptions{Targets: []WebhookTarget{{URL: url + "/secret-path"}}, Failed: failed.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Notify(pingAlert())
+	err = failed.next(t)
+	w.Close()
+	if msg := err.Error(); !strings.HasPrefix(msg, url+": ") || strings.Contains(msg, "secret-path") {
+		t.Errorf("failure %q", msg)
+	}
+}
+
+// TestWebhookQueue checks that a full queue drops the oldest payload, and
+// that payloads still queued at Close count as failed.
+func TestWebhookQueue(t *testing.T) {
+	failed := make(failures, 10)
+	tg := &webhookTarget{name: "http://example.com", failed: failed.report, wake: make(chan struct{}, 1)}
+	for i := range webhookQueue + 1 {
+		tg.push([]byte{byte(i)})
+	}
+	if err := failed.next(t); !strings.Contains(err.Error(), "oldest notification dropped") {
+		t.Errorf("failure %v", err)
+	}
+	if len(tg.queue) != webhookQueue || tg.queue[0][0] != 1 {
+		t.Errorf("%d queued, oldest %d", len(tg.queue), tg.queue[0][0])
+	}
+
+	// A receiver that never answers holds the first payload in flight.
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+	w, err := NewWebhook(WebhookOptions{Targets: []WebhookTarget{{URL: srv.URL}}, Failed: failed.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.targets[0].client.Timeout = 200 * time.Millisecond
+	for range 3 {
+		w.Notify(pingAlert())
+	}
+	w.Close()
+	var msgs []string
+	for len(failed) > 0 {
+		msgs = append(msgs, (<-failed).Error())
+	}
+	if !strings.Contains(strings.Join(msgs, "\n"), "notifications unsent at exit") {
+		t.Errorf("failures at Close: %q", msgs)
+	}
+}
@@ -0,0 +1,132 @@
+// Package policy decides which actions that reach beyond watching may run:
+// the ones that send traffic other than the latency probes, and the ones
+// that run a program or change the system. Every such action is declared
+// here and performed through Mode.Do, so -read-only and -dry-run cover it
+// without code of its own.
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mode is the policy in effect for the session.
+type Mode int
+
+const (
+	// Normal runs every action.
+	Normal Mode = iota
+	// ReadOnly refuses every declared action.
+	ReadOnly
+	// DryRun runs the traffic actions, but of the ones that run a program
+	// or change the system, only shows what they would do.
+	DryRun
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ReadOnly:
+		return "read-only"
+	case DryRun:
+		return "dry-run"
+	}
+	return "normal"
+}
+
+// Effect is what an action does beyond watching.
+type Effect int
+
+const (
+	// Traffic sends traffic other than the latency probes.
+	Traffic Effect = iota + 1
+	// Exec runs a program or changes the system.
+	Exec
+)
+
+// Action is one action the policy rules on. Name is how notices refer to
+// it.
+type Action struct {
+	Name   string
+	Effect Effect
+}
+
+// The actions ping-tracker can take. A new one is declared here and
+// performed through Mode.Do, or for a key, listed in the TUI's key table,
+// which the key dispatcher checks before any handler runs.
+var (
+	OpenCommand   = Action{Name: "open command (o)", Effect: Exec}
+	PublicAddress = Action{Name: "public address lookup (F3)", Effect: Traffic}
+	ServiceChecks = Action{Name: "service checks", Effect: Traffic}
+	Triggers      = Action{Name: "trigger commands", Effect: Exec}
+	Notifications = Action{Name: "alert notifications", Effect: Traffic}
+)
+
+// Verdict is how a mode rules on an action.
+type Verdict int
+
+const (
+	Allow    Verdict = iota
+	Deny             // read-only: not performed
+	Simulate         // dry-run: shown, not performed
+)
+
+// Check rules on a under m.
+func (m Mode) Check(a Action) Verdict {
+	switch {
+	case m == ReadOnly:
+		return Deny
+	case m == DryRun && a.Effect == Exec:
+		return Simulate
+	}
+	return Allow
+}
+
+// DeniedError is the error of an action refused in read-only mode.
+type DeniedError struct {
+	Action Action
+}
+
+func (e *DeniedError) Error() string {
+	return e.Action.Name + ": disabled (read-only)"
+}
+
+// Do performs a by calling do, as m allows. In read-only mode it returns a
+// *DeniedError; in dry-run mode, for an Exec action, it returns plan, what
+// do would have done, without calling do. plan is "" when do ran.
+func (m Mode) Do(a Action, plan func() string, do func() error) (string, error) {
+	switch m.Check(a) {
+	case Deny:
+		return "", &DeniedError{Action: a}
+	case Simulate:
+		return plan(), nil
+	}
+	return "", do()
+}
+
+// Argv formats a command line as it would be run, each word quoted where
+// it needs to be, for a dry-run plan.
+func Argv(argv []string) string {
+	words := make([]string, len(argv))
+	for i, w := range argv {
+		if w == "" || strings.ContainsAny(w, " \t\n\"'\\$`;&|<>()*?[]{}~#") {
+			w = strconv.Quote(w)
+		}
+		words[i] = w
+	}
+	return strings.Join(words, " ")
+}
+
+// Parse reads a mode from the -read-only and -dry-run flags; both at once
+// is an error.
+func Parse(readOnly, dryRun bool) (Mode, error) {
+	switch {
+	case readOnly && dryRun:
+		return Normal, fmt.Errorf("-read-only and -dry-run exclude each other")
+	case readOnly:
+		return ReadOnly, nil
+	case dryRun:
+		return DryRun, nil
+	}
+	return Normal, nil
+}
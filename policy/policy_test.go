@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		mode   Mode
+		action Action
+		want   Verdict
+	}{
+		{Normal, OpenCommand, Allow},
+		{Normal, ServiceChecks, Allow},
+		{ReadOnly, OpenCommand, Deny},
+		{ReadOnly, PublicAddress, Deny},
+		{ReadOnly, Notifications, Deny},
+		{DryRun, OpenCommand, Simulate},
+		{DryRun, Triggers, Simulate},
+		{DryRun, PublicAddress, Allow},
+		{DryRun, ServiceChecks, Allow},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.Check(tt.action); got != tt.want {
+			t.Errorf("%s %s: %d, want %d", tt.mode, tt.action.Name, got, tt.want)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	for _, mode := range []Mode{Normal, DryRun, ReadOnly} {
+		ran := false
+		plan, err := mode.Do(Triggers, func() string { return "touch /tmp/x" }, func() error {
+			ran = true
+			return nil
+		})
+		var denied *DeniedError
+		switch mode {
+		case Normal:
+			if !ran || plan != "" || err != nil {
+				t.Errorf("normal: ran %v, plan %q, %v", ran, plan, err)
+			}
+		case DryRun:
+			if ran || plan != "touch /tmp/x" || err != nil {
+				t.Errorf("dry-run: ran %v, plan %q, %v", ran, plan, err)
+			}
+		case ReadOnly:
+			if ran || !errors.As(err, &denied) || err.Error() != "trigger commands: disabled (read-only)" {
+				t.Errorf("read-only: ran %v, %v", ran, err)
+			}
+		}
+	}
+}
+
+func TestArgv(t *testing.T) {
+	got := Argv([]string{"notify-send", "game lag", "", "$HOME", "-u"})
+	if want := `notify-send "game lag" "" "$HOME" -u`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		readOnly, dryRun bool
+		want             Mode
+		wantErr          bool
+	}{
+		{false, false, Normal, false},
+		{true, false, ReadOnly, false},
+		{false, true, DryRun, false},
+		{true, true, Normal, true},
+	} {
+		got, err := Parse(tt.readOnly, tt.dryRun)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%v, %v) = %s, %v", tt.readOnly, tt.dryRun, got, err)
+		}
+	}
+}
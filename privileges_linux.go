@@ -5,9 +5,21 @@ package main
 import (
 	"fmt"
 	"os"
+
+	"ping-tracker/tracker"
 )
 
-func checkPrivileges() {
+// checkPrivileges warns about running without root, and in a container or
+// under a restricted /proc, lists what it keeps from view and why.
+func checkPrivileges(sandbox tracker.Sandbox) {
+	if sandbox.Restricted() && len(sandbox.Limits) > 0 {
+		fmt.Fprintln(os.Stderr, "Warning: "+sandbox.Summary()+".")
+		for _, l := range sandbox.Limits {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n    fix: %s\n", l.Missing, l.Reason, l.Fix)
+		}
+		fmt.Fprintln(os.Stderr, "")
+		return
+	}
 	if os.Geteuid() != 0 {
 		fmt.Fprintln(os.Stderr, "Warning: running without root. PID/app resolution may be incomplete.")
 		fmt.Fprintln(os.Stderr, "Run with: sudo ping-tracker")
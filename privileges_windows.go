@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+
+	"ping-tracker/tracker"
 )
 
-func checkPrivileges() {
+// checkPrivileges warns about running without Administrator; Windows has
+// no sandbox to report.
+func checkPrivileges(sandbox tracker.Sandbox) {
 	if !isRunningAsAdmin() {
 		fmt.Fprintln(os.Stderr, "Warning: running without Administrator. Some process names may not resolve.")
 		fmt.Fprintln(os.Stderr, "Run as Administrator for full functionality.")
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+
+	"ping-tracker/config"
+)
+
+// profileCPUFor is how long F10 samples the CPU.
+var profileCPUFor = 15 * time.Second
+
+// captureProfiles samples the CPU for profileCPUFor, then snapshots the
+// heap, and writes both to profile-cpu-<timestamp>.pprof and
+// profile-heap-<timestamp>.pprof in the config directory, falling back to
+// the temp directory. It returns the files written; after an error, the
+// ones written before it.
+func captureProfiles() ([]string, error) {
+	dir, err := config.Dir()
+	if err != nil || os.MkdirAll(dir, 0o755) != nil {
+		dir = os.TempDir()
+	}
+	return captureProfilesTo(dir, time.Now(), profileCPUFor)
+}
+
+func captureProfilesTo(dir string, now time.Time, cpuFor time.Duration) ([]string, error) {
+	stamp := now.Format("20060102-150405")
+	// Profiles are collected in memory, so a full disk cannot leave a
+	// truncated file that looks valid.
+	var cpu bytes.Buffer
+	if err := rpprof.StartCPUProfile(&cpu); err != nil {
+		return nil, fmt.Errorf("CPU profile: %w", err)
+	}
+	time.Sleep(cpuFor)
+	rpprof.StopCPUProfile()
+	var saved []string
+	path := filepath.Join(dir, "profile-cpu-"+stamp+".pprof")
+	if err := writeFileAtomic(path, cpu.Bytes()); err != nil {
+		return saved, err
+	}
+	saved = append(saved, path)
+
+	runtime.GC() // up-to-date heap statistics
+	var heap bytes.Buffer
+	if err := rpprof.WriteHeapProfile(&heap); err != nil {
+		return saved, fmt.Errorf("heap profile: %w", err)
+	}
+	path = filepath.Join(dir, "profile-heap-"+stamp+".pprof")
+	if err := writeFileAtomic(path, heap.Bytes()); err != nil {
+		return saved, err
+	}
+	return append(saved, path), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, removing it if anything fails.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// listenPprof serves the net/http/pprof handlers on addr, which must be on
+// the loopback interface; a bare ":6060" listens on 127.0.0.1.
+func listenPprof(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("-pprof-listen: %w", err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if ip := net.ParseIP(host); (ip == nil && host != "localhost") || (ip != nil && !ip.IsLoopback()) {
+		return nil, fmt.Errorf("-pprof-listen: %s is not a loopback address", host)
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go http.Serve(l, mux)
+	return l, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	rpprof "runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/config"
+)
+
+// TestCaptureProfiles runs F10's capture with the CPU window shortened and
+// checks both profiles land in the config directory, complete.
+func TestCaptureProfiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	old := profileCPUFor
+	profileCPUFor = 50 * time.Millisecond
+	t.Cleanup(func() { profileCPUFor = old })
+
+	start := time.Now()
+	saved, err := captureProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < profileCPUFor {
+		t.Errorf("capture took %s, shorter than the CPU window", took)
+	}
+	cdir, _ := config.Dir()
+	if len(saved) != 2 || filepath.Dir(saved[0]) != cdir ||
+		!strings.HasPrefix(filepath.Base(saved[0]), "profile-cpu-") || !strings.HasPrefix(filepath.Base(saved[1]), "profile-heap-") {
+		t.Fatalf("saved %v", saved)
+	}
+	for _, path := range saved {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A profile is a gzipped protobuf; a truncated one fails to inflate.
+		zr, err := gzip.NewReader(f)
+		if err == nil {
+			_, err = io.Copy(io.Discard, zr)
+		}
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	entries, _ := os.ReadDir(cdir)
+	if len(entries) != 2 {
+		t.Errorf("%d files in the config directory, want the 2 profiles", len(entries))
+	}
+}
+
+func TestCaptureProfilesErrors(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// The directory cannot take the files: nothing is saved.
+	notDir := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(notDir, nil, 0o644)
+	saved, err := captureProfilesTo(notDir, at, time.Millisecond)
+	if err == nil || len(saved) != 0 || !strings.HasPrefix(err.Error(), "writing profile-cpu-20260301-120000.pprof: ") {
+		t.Errorf("saved %v, error %v", saved, err)
+	}
+
+	// Another CPU profile is already running.
+	if err := rpprof.StartCPUProfile(io.Discard); err != nil {
+		t.Skip("a CPU profile is already running:", err)
+	}
+	defer rpprof.StopCPUProfile()
+	dir := t.TempDir()
+	saved, err = captureProfilesTo(dir, at, time.Millisecond)
+	if err == nil || len(saved) != 0 || !strings.HasPrefix(err.Error(), "CPU profile: ") {
+		t.Errorf("saved %v, error %v", saved, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left behind", len(entries))
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.pprof")
+	os.WriteFile(path, []byte("old"), 0o644)
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new" {
+		t.Errorf("file holds %q", b)
+	}
+	// Renaming over a directory fails: the temporary file goes.
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0o755)
+	os.WriteFile(filepath.Join(sub, "x"), nil, 0o644)
+	if err := writeFileAtomic(sub, []byte("data")); err == nil || !strings.HasPrefix(err.Error(), "writing sub: ") {
+		t.Errorf("error %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d entries left, want out.pprof and sub", len(entries))
+	}
+}
+
+func TestListenPprof(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "192.0.2.1:0", "[::]:0", "example.com:0"} {
+		if l, err := listenPprof(addr); err == nil || !strings.Contains(err.Error(), "is not a loopback address") {
+			t.Errorf("%s: %v", addr, err)
+			if l != nil {
+				l.Close()
+			}
+		}
+	}
+	if _, err := listenPprof("6060"); err == nil || !strings.HasPrefix(err.Error(), "-pprof-listen: ") {
+		t.Errorf("bare number: %v", err)
+	}
+
+	l, err := listenPprof(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if !strings.HasPrefix(l.Addr().String(), "127.0.0.1:") {
+		t.Errorf("listening on %s", l.Addr())
+	}
+	resp, err := http.Get("http://" + l.Addr().String() + "/debug/pprof/cmdline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("cmdline: %s, %q", resp.Status, body)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"ping-tracker/config"
+	"ping-tracker/eventlog"
+	"ping-tracker/tracker"
+	"ping-tracker/tui"
+)
+
+// minInterval is the shortest scan interval accepted from the config file.
+const minInterval = 500 * time.Millisecond
+
+// setFlags returns the names of the flags given on the command line. Their
+// values win over the config file, at startup and on reload.
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// parseInterval parses the config's scan interval.
+func parseInterval(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q: %v", v, err)
+	}
+	if d < minInterval {
+		return 0, fmt.Errorf("interval %s is below the %s minimum", d, minInterval)
+	}
+	return d, nil
+}
+
+// configWatcher re-reads config.json when its modification time or size
+// changes, and applies the difference to the running tracker and TUI.
+type configWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+
+	cur     *config.Config
+	t       *tracker.Tracker
+	pinRule func(*tracker.AlertRule) // re-applies -alert-* flags to reloaded thresholds
+	pinned  map[string]bool          // flags given on the command line
+
+	listeners *tracker.ListenerWatch // nil unless -listener-alerts is on
+	loadHigh  float64                // -load-high, used when pinned
+	events    *eventlog.Writer       // nil without an event log
+}
+
+func newConfigWatcher(path string, cfg *config.Config, t *tracker.Tracker, pinRule func(*tracker.AlertRule), pinned map[string]bool) *configWatcher {
+	w := &configWatcher{path: path, cur: cfg, t: t, pinRule: pinRule, pinned: pinned}
+	if fi, err := os.Stat(path); err == nil {
+		w.modTime, w.size = fi.ModTime(), fi.Size()
+	}
+	return w
+}
+
+// check implements tui.ConfigReloader. A file that fails to parse or
+// validate is rejected as a whole, and is not retried until it changes again.
+func (w *configWatcher) check(force bool) (*tui.Reload, error) {
+	fi, err := os.Stat(w.path)
+	var modTime time.Time
+	var size int64
+	if err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	if !force && modTime.Equal(w.modTime) && size == w.size {
+		return nil, nil
+	}
+	w.modTime, w.size = modTime, size
+
+	next, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	r, err := w.apply(w.cur, next)
+	if err != nil {
+		return nil, err
+	}
+	w.cur = next
+	return r, nil
+}
+
+// apply validates next, then applies what differs from old: thresholds,
+// encryption overrides, stuck states, score weights, no_probe, the event log's level and apps, listener suppressions, display settings, open_cmd,
+// the STUN servers and the palette live, the scan interval and ping mode after confirmation, and
+// the rest is reported as needing a restart. Nothing is applied if any setting in next is invalid.
+func (w *configWatcher) apply(old, next *config.Config) (*tui.Reload, error) {
+	rule, err := alertRuleFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	w.pinRule(&rule)
+	if err := rule.Validate(); err != nil {
+		return nil, fmt.Errorf("alert thresholds: %v", err)
+	}
+	var interval time.Duration
+	if next.Interval != "" {
+		if interval, err = parseInterval(next.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if next.EphemeralPorts != "" {
+		if _, err := tracker.ParsePortRange(next.EphemeralPorts); err != nil {
+			return nil, fmt.Errorf("ephemeral_ports: %v", err)
+		}
+	}
+	if next.FlowLinkGrace != "" {
+		if _, err := time.ParseDuration(next.FlowLinkGrace); err != nil {
+			return nil, fmt.Errorf("invalid flow_link_grace %q: %v", next.FlowLinkGrace, err)
+		}
+	}
+	if next.StateSaveInterval != "" {
+		if d, err := time.ParseDuration(next.StateSaveInterval); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid state_save_interval %q", next.StateSaveInterval)
+		}
+	}
+	openCmd, err := tui.ParseOpenCommand(next.OpenCmd)
+	if err != nil {
+		return nil, err
+	}
+	suppress, err := listenerSuppressionsFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	if err := tui.ValidatePalette(next.Palette); err != nil {
+		return nil, err
+	}
+	stuck, err := tracker.ParseStuckThresholds(next.StuckStates)
+	if err != nil {
+		return nil, err
+	}
+	weights, err := tracker.ParseScoreWeights(next.ScoreWeights)
+	if err != nil {
+		return nil, err
+	}
+	noProbe, err := tracker.ParseNoProbe(next.NoProbe)
+	if err != nil {
+		return nil, err
+	}
+	sampleFilter, err := tracker.ParseSampleFilter(next.NoPingWarmUp, next.PingOutlierMAD)
+	if err != nil {
+		return nil, err
+	}
+	outageAlert, err := tracker.ParseOutageAlert(next.UnreachableAlert)
+	if err != nil {
+		return nil, err
+	}
+	halfOpen, err := tracker.ParseHalfOpen(next.HalfOpenIdle, next.HalfOpenUnreachable)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := scheduleFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := derivedColumnsFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := serviceChecksFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := triggersFromConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	floor := tracker.SeverityInfo
+	if !w.pinned["event-log-level"] {
+		if floor, err = tracker.ParseSeverity(next.EventLogLevel); err != nil {
+			return nil, err
+		}
+	}
+	diveRate, diveFor, err := tracker.ParseDeepDive(next.DeepDiveRate, next.DeepDiveDuration)
+	if err != nil {
+		return nil, err
+	}
+	focusEvery, err := tracker.ParseFocusInterval(next.FocusInterval)
+	if err != nil {
+		return nil, err
+	}
+	if next.NameLookupsPerScan < 0 {
+		return nil, fmt.Errorf("name_lookups_per_scan %d: want at least 1", next.NameLookupsPerScan)
+	}
+	oldThrottle, _ := loadThrottleFromConfig(old, w.pinned, w.loadHigh)
+	throttle, err := loadThrottleFromConfig(next, w.pinned, w.loadHigh)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &tui.Reload{}
+	// live records a changed setting applied without asking: apply updates
+	// the tracker now, ui the model when it handles the reload.
+	live := func(name string, changed bool, apply func(), ui func(*tui.Model)) {
+		if !changed {
+			return
+		}
+		r.Applied = append(r.Applied, name)
+		if apply != nil {
+			apply()
+		}
+		if ui != nil {
+			r.UI = append(r.UI, ui)
+		}
+	}
+
+	oldRule, _ := alertRuleFromConfig(old)
+	w.pinRule(&oldRule)
+	live("alert thresholds", rule != oldRule, func() { w.t.SetAlertRule(rule) }, nil)
+	live("encryption_overrides", !reflect.DeepEqual(old.EncryptionOverrides, next.EncryptionOverrides),
+		func() { w.t.SetEncryptionOverrides(next.EncryptionOverrides) }, nil)
+	live("confirm_quit", old.ConfirmQuit != next.ConfirmQuit, nil, func(m *tui.Model) {
+		m.SetConfirmQuit(next.ConfirmQuit)
+	})
+	live("time display", old.AbsoluteTimes != next.AbsoluteTimes || old.Clock12h != next.Clock12h, nil, func(m *tui.Model) {
+		m.SetTimeDisplay(next.AbsoluteTimes, next.Clock12h)
+	})
+	live("compact_ports", old.CompactPorts != next.CompactPorts, nil, func(m *tui.Model) {
+		m.SetCompactPorts(next.CompactPorts)
+	})
+	live("stuck_states", !reflect.DeepEqual(old.StuckStates, next.StuckStates),
+		func() { w.t.SetStuckThresholds(stuck) }, nil)
+	live("score_weights", !reflect.DeepEqual(old.ScoreWeights, next.ScoreWeights),
+		func() { w.t.SetScoreWeights(weights) }, nil)
+	live("no_probe", !reflect.DeepEqual(old.NoProbe, next.NoProbe),
+		func() { w.t.SetNoProbe(noProbe) }, nil)
+	live("ping sample filter", old.NoPingWarmUp != next.NoPingWarmUp || old.PingOutlierMAD != next.PingOutlierMAD,
+		func() { w.t.SetSampleFilter(sampleFilter) }, nil)
+	live("unreachable_alert", old.UnreachableAlert != next.UnreachableAlert,
+		func() { w.t.SetOutageAlert(outageAlert) }, nil)
+	live("half-open check", old.HalfOpenIdle != next.HalfOpenIdle || old.HalfOpenUnreachable != next.HalfOpenUnreachable,
+		func() { w.t.SetHalfOpen(halfOpen) }, nil)
+	live("schedule", !reflect.DeepEqual(old.Schedule, next.Schedule),
+		func() { w.t.SetSchedule(schedule) }, nil)
+	live("load throttle", throttle != oldThrottle,
+		func() { w.t.SetLoadThrottle(throttle) }, nil)
+	live("derived_columns", !reflect.DeepEqual(old.DerivedColumns, next.DerivedColumns),
+		func() { w.t.SetDerivedColumns(derived) }, nil)
+	live("service_checks", !reflect.DeepEqual(old.ServiceChecks, next.ServiceChecks),
+		func() { w.t.SetServiceChecks(checks) }, nil)
+	live("triggers", !reflect.DeepEqual(old.Triggers, next.Triggers),
+		func() { w.t.SetTriggers(triggers) }, nil)
+	live("event_log_level", !w.pinned["event-log-level"] && old.EventLogLevel != next.EventLogLevel, func() {
+		if w.events != nil {
+			w.events.SetFloor(floor)
+		}
+	}, nil)
+	live("event_log_apps", !reflect.DeepEqual(old.EventLogApps, next.EventLogApps),
+		func() { w.t.SetEventApps(next.EventLogApps) }, nil)
+	live("listener_suppress", !reflect.DeepEqual(old.ListenerSuppress, next.ListenerSuppress), func() {
+		if w.listeners != nil {
+			w.listeners.SetSuppressions(suppress)
+		}
+	}, nil)
+	live("open_cmd", old.OpenCmd != next.OpenCmd, nil, func(m *tui.Model) {
+		m.SetOpenCommand(openCmd)
+	})
+	live("stun servers", old.STUNServer != next.STUNServer || old.STUNServer2 != next.STUNServer2, nil, func(m *tui.Model) {
+		m.SetSTUNServers(next.STUNServer, next.STUNServer2)
+	})
+	live("deep-dive settings", old.DeepDiveRate != next.DeepDiveRate || old.DeepDiveDuration != next.DeepDiveDuration, nil, func(m *tui.Model) {
+		m.SetDeepDive(diveRate, diveFor)
+	})
+	live("focus_interval", old.FocusInterval != next.FocusInterval, nil, func(m *tui.Model) {
+		m.SetFocusInterval(focusEvery)
+	})
+	live("name_lookups_per_scan", old.NameLookupsPerScan != next.NameLookupsPerScan,
+		func() { tracker.SetNameLookups(next.NameLookupsPerScan) }, nil)
+	live("palette", old.Palette != next.Palette, nil, func(m *tui.Model) {
+		m.SetPalette(next.Palette)
+	})
+	live("sort_hysteresis", old.SortHysteresis != next.SortHysteresis, nil, func(m *tui.Model) {
+		m.SetSortHysteresis(sortHysteresisFromConfig(next))
+	})
+	live("delta thresholds", old.DeltaPingPct != next.DeltaPingPct || old.DeltaRate != next.DeltaRate, nil, func(m *tui.Model) {
+		m.SetDeltaOptions(deltaOptionsFromConfig(next))
+	})
+
+	if !w.pinned["interval"] && interval > 0 && old.Interval != next.Interval {
+		from := w.t.ConfiguredInterval()
+		if interval != from {
+			r.Confirm = append(r.Confirm, tui.ConfirmChange{
+				Prompt: fmt.Sprintf("scan interval %s -> %s", from, interval),
+				Apply:  func() { w.t.SetInterval(interval) },
+			})
+		}
+	}
+	if !w.pinned["no-ping"] && old.NoPing != next.NoPing {
+		prompt, on := "ping probes off", false
+		if !next.NoPing {
+			prompt, on = "ping probes on", true
+		}
+		r.Confirm = append(r.Confirm, tui.ConfirmChange{
+			Prompt: prompt,
+			Apply:  func() { w.t.SetPingEnabled(on) },
+		})
+	}
+
+	restart := func(name string, changed bool) {
+		if changed {
+			r.Restart = append(r.Restart, name)
+		}
+	}
+	restart("flow_link_grace", old.FlowLinkGrace != next.FlowLinkGrace)
+	restart("flow_link_by_app", old.FlowLinkByApp != next.FlowLinkByApp)
+	restart("ephemeral_ports", old.EphemeralPorts != next.EphemeralPorts)
+	restart("state_save_interval", old.StateSaveInterval != next.StateSaveInterval)
+	restart("restore_session", old.RestoreSession != next.RestoreSession)
+	restart("read_only", old.ReadOnly != next.ReadOnly)
+	restart("audit_rules", !reflect.DeepEqual(old.AuditRules, next.AuditRules))
+	restart("event_log", old.EventLog != next.EventLog)
+	restart("dual_stack_targets", !reflect.DeepEqual(old.DualStackTargets, next.DualStackTargets))
+	restart("notify", !reflect.DeepEqual(old.Notify, next.Notify))
+	return r, nil
+}
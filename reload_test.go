@@ -0,0 +1,127 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"ping-tracker/config"
+	"ping-tracker/tracker"
+)
+
+func newTestWatcher(pinned ...string) (*configWatcher, *tracker.Tracker) {
+	t := tracker.NewTracker(3*time.Second, false)
+	set := make(map[string]bool)
+	for _, name := range pinned {
+		set[name] = true
+	}
+	w := newConfigWatcher("", &config.Config{}, t, func(*tracker.AlertRule) {}, set)
+	return w, t
+}
+
+func TestReloadLive(t *testing.T) {
+	w, tr := newTestWatcher()
+	old := &config.Config{Interval: "3s", AlertPing: "200ms"}
+	next := *old
+	next.AlertPing = "150ms"
+	next.Palette = "colorblind"
+	next.ConfirmQuit = true
+
+	r, err := w.apply(old, &next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alert thresholds", "palette", "confirm_quit"} {
+		if !slices.Contains(r.Applied, name) {
+			t.Errorf("%s not applied live: %v", name, r.Applied)
+		}
+	}
+	if len(r.Confirm) != 0 || len(r.Restart) != 0 {
+		t.Errorf("confirm %v, restart %v", r.Confirm, r.Restart)
+	}
+	// The tracker changes at once; the UI parts wait for the model.
+	if got := tr.AlertRule().PingThreshold; got != 150*time.Millisecond {
+		t.Errorf("ping threshold %v", got)
+	}
+	if len(r.UI) != 2 {
+		t.Errorf("%d UI changes, want palette and confirm_quit", len(r.UI))
+	}
+}
+
+func TestReloadNeedsConfirmation(t *testing.T) {
+	w, tr := newTestWatcher()
+	old := &config.Config{Interval: "3s"}
+	next := &config.Config{Interval: "10s", NoPing: true}
+	r, err := w.apply(old, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Confirm) != 2 || r.Confirm[0].Prompt != "scan interval 3s -> 10s" || r.Confirm[1].Prompt != "ping probes off" {
+		t.Fatalf("confirm %+v", r.Confirm)
+	}
+	if tr.ConfiguredInterval() != 3*time.Second {
+		t.Fatal("interval changed before confirmation")
+	}
+	r.Confirm[0].Apply()
+	if tr.ConfiguredInterval() != 10*time.Second {
+		t.Fatalf("interval %v after confirming", tr.ConfiguredInterval())
+	}
+
+	// Flags given on the command line win over the file.
+	w, _ = newTestWatcher("interval", "no-ping")
+	if r, _ := w.apply(old, next); len(r.Confirm) != 0 {
+		t.Fatalf("pinned settings asked for: %+v", r.Confirm)
+	}
+}
+
+func TestReloadRestart(t *testing.T) {
+	w, _ := newTestWatcher()
+	old := &config.Config{}
+	next := &config.Config{EventLog: "/var/log/pt.jsonl", ReadOnly: true}
+	r, err := w.apply(old, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(r.Restart, []string{"read_only", "event_log"}) || len(r.Applied) != 0 {
+		t.Fatalf("restart %v, applied %v", r.Restart, r.Applied)
+	}
+}
+
+func TestReloadRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *config.Config)
+	}{
+		{"interval", func(c *config.Config) { c.Interval = "fast" }},
+		{"short interval", func(c *config.Config) { c.Interval = "100ms" }},
+		{"threshold", func(c *config.Config) { c.AlertPing = "soon" }},
+		{"palette", func(c *config.Config) { c.Palette = "plaid" }},
+		{"ports", func(c *config.Config) { c.EphemeralPorts = "9-3" }},
+		{"lookups", func(c *config.Config) { c.NameLookupsPerScan = -1 }},
+	}
+	for _, tt := range tests {
+		w, tr := newTestWatcher()
+		old := &config.Config{Interval: "3s", AlertPing: "200ms"}
+		next := *old
+		next.AlertPing = "100ms" // valid, but must not be applied
+		tt.edit(&next)
+		if _, err := w.apply(old, &next); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+		if tr.AlertRule().PingThreshold != 0 {
+			t.Errorf("%s: thresholds applied from a rejected file", tt.name)
+		}
+	}
+}
+
+func TestReloadNoChanges(t *testing.T) {
+	w, _ := newTestWatcher()
+	cfg := &config.Config{Interval: "3s", AlertPing: "200ms", Palette: "colorblind"}
+	r, err := w.apply(cfg, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Applied) > 0 || len(r.Confirm) > 0 || len(r.Restart) > 0 || len(r.UI) > 0 {
+		t.Fatalf("changes reported for an identical file: %+v", r)
+	}
+}
@@ -0,0 +1,367 @@
+// Package snippet writes capture filters and firewall rules matching a set
+// of connections, to paste elsewhere: a tcpdump/Wireshark capture filter,
+// an nftables rule set, iptables commands and Windows Firewall netsh
+// commands. It only produces text; nothing it writes is ever run.
+package snippet
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ping-tracker/tracker"
+)
+
+// Target is a tool a snippet is written for.
+type Target string
+
+const (
+	Tcpdump  Target = "tcpdump"
+	Nftables Target = "nftables"
+	Iptables Target = "iptables"
+	Netsh    Target = "netsh"
+)
+
+// Targets lists the targets in the order the F8 overlay cycles through them.
+func Targets() []Target {
+	return []Target{Tcpdump, Nftables, Iptables, Netsh}
+}
+
+// Describe names what t's snippet is, for the overlay.
+func (t Target) Describe() string {
+	switch t {
+	case Tcpdump:
+		return "tcpdump / Wireshark capture filter"
+	case Nftables:
+		return "nftables rule set (drops the traffic)"
+	case Iptables:
+		return "iptables / ip6tables commands (drop the traffic)"
+	}
+	return "Windows Firewall netsh commands (block the traffic)"
+}
+
+const (
+	// minPrefix4 and minPrefix6 are the widest prefixes remotes are merged
+	// into: hosts sharing less than a /24 (or /64) are listed one by one,
+	// so a rule never takes in a whole provider by accident.
+	minPrefix4 = 24
+	minPrefix6 = 64
+)
+
+// rule is one coalesced match: a protocol, remotes and remote ports, and
+// for a single connection its local end too, so it matches the 5-tuple.
+type rule struct {
+	proto     string // "tcp" or "udp"
+	v6        bool
+	remotes   []netip.Prefix // hosts are /32 or /128
+	ports     []int          // remote ports, ascending
+	local     netip.Addr     // valid only for a single connection
+	localPort int
+}
+
+// Generate writes target's snippet for conns. Connections without a
+// remote (listeners, unconnected UDP) and other protocols are left out; it
+// is an error when none is left.
+func Generate(target Target, conns []*tracker.Connection) (string, error) {
+	rules := coalesce(conns)
+	if len(rules) == 0 {
+		return "", fmt.Errorf("no TCP or UDP connection with a remote address to match")
+	}
+	switch target {
+	case Tcpdump:
+		return tcpdump(rules), nil
+	case Nftables:
+		return nftables(rules), nil
+	case Iptables:
+		return iptables(rules), nil
+	case Netsh:
+		return netsh(rules), nil
+	}
+	return "", fmt.Errorf("unknown snippet target %q", target)
+}
+
+// endpoint is one connection reduced to what a rule matches.
+type endpoint struct {
+	proto      string
+	local      netip.Addr
+	localPort  int
+	remote     netip.Addr
+	remotePort int
+}
+
+// endpoints reduces conns to the ones a rule can match, once each.
+func endpoints(conns []*tracker.Connection) []endpoint {
+	var eps []endpoint
+	for _, c := range conns {
+		proto := strings.TrimSuffix(c.Protocol, "6")
+		if proto != "tcp" && proto != "udp" {
+			continue
+		}
+		remote, err := netip.ParseAddr(c.RemoteAddr)
+		if err != nil || remote.IsUnspecified() || c.RemotePort == 0 {
+			continue
+		}
+		local, _ := netip.ParseAddr(c.LocalAddr)
+		ep := endpoint{proto, local.Unmap(), c.LocalPort, remote.Unmap(), c.RemotePort}
+		if !slices.Contains(eps, ep) {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// coalesce turns conns into as few rules as it can: one connection keeps
+// its 5-tuple; otherwise the ports of each remote are combined, and
+// remotes with the same protocol and ports are merged into their common
+// prefix when that is at least a /24 (/64), or else listed together.
+func coalesce(conns []*tracker.Connection) []rule {
+	eps := endpoints(conns)
+	if len(eps) == 1 {
+		ep := eps[0]
+		r := rule{proto: ep.proto, v6: ep.remote.Is6(), remotes: []netip.Prefix{netip.PrefixFrom(ep.remote, ep.remote.BitLen())},
+			ports: []int{ep.remotePort}}
+		if ep.local.IsValid() && !ep.local.IsUnspecified() && ep.local.Is6() == ep.remote.Is6() {
+			r.local, r.localPort = ep.local, ep.localPort
+		}
+		return []rule{r}
+	}
+
+	// Ports of each protocol and remote.
+	type host struct {
+		proto string
+		addr  netip.Addr
+	}
+	var hosts []host
+	ports := make(map[host][]int)
+	for _, ep := range eps {
+		h := host{ep.proto, ep.remote}
+		if _, ok := ports[h]; !ok {
+			hosts = append(hosts, h)
+		}
+		if !slices.Contains(ports[h], ep.remotePort) {
+			ports[h] = append(ports[h], ep.remotePort)
+		}
+	}
+
+	// Remotes of each protocol, family and port set.
+	type group struct {
+		proto string
+		v6    bool
+		ports string
+	}
+	var order []group
+	members := make(map[group][]netip.Addr)
+	portsOf := make(map[group][]int)
+	for _, h := range hosts {
+		ps := ports[h]
+		slices.Sort(ps)
+		g := group{h.proto, h.addr.Is6(), fmt.Sprint(ps)}
+		if _, ok := members[g]; !ok {
+			order = append(order, g)
+			portsOf[g] = ps
+		}
+		members[g] = append(members[g], h.addr)
+	}
+
+	rules := make([]rule, 0, len(order))
+	for _, g := range order {
+		addrs := members[g]
+		slices.SortFunc(addrs, netip.Addr.Compare)
+		rules = append(rules, rule{proto: g.proto, v6: g.v6, remotes: mergePrefix(addrs), ports: portsOf[g]})
+	}
+	slices.SortStableFunc(rules, func(a, b rule) int {
+		switch {
+		case a.v6 != b.v6:
+			if a.v6 {
+				return 1
+			}
+			return -1
+		case a.proto != b.proto:
+			return strings.Compare(a.proto, b.proto)
+		}
+		return a.remotes[0].Addr().Compare(b.remotes[0].Addr())
+	})
+	return rules
+}
+
+// mergePrefix returns the common prefix of addrs, one family, sorted,
+// when it is narrow enough, or else each address as a host prefix.
+func mergePrefix(addrs []netip.Addr) []netip.Prefix {
+	hosts := make([]netip.Prefix, len(addrs))
+	for i, a := range addrs {
+		hosts[i] = netip.PrefixFrom(a, a.BitLen())
+	}
+	if len(addrs) == 1 {
+		return hosts
+	}
+	limit := minPrefix4
+	if addrs[0].Is6() {
+		limit = minPrefix6
+	}
+	// Sorted, the first and last address differ the earliest.
+	first, last := addrs[0].AsSlice(), addrs[len(addrs)-1].AsSlice()
+	bits := 0
+	for i := range first {
+		x := first[i] ^ last[i]
+		if x == 0 {
+			bits += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			bits++
+			x <<= 1
+		}
+		break
+	}
+	if bits < limit {
+		return hosts
+	}
+	p, _ := addrs[0].Prefix(bits)
+	return []netip.Prefix{p}
+}
+
+// prefixString writes a host prefix as the bare address.
+func prefixString(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+func joinPrefixes(ps []netip.Prefix, sep string) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = prefixString(p)
+	}
+	return strings.Join(s, sep)
+}
+
+func joinPorts(ports []int, sep string) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, sep)
+}
+
+// tcpdump writes one BPF expression, which Wireshark takes as a capture
+// filter too. It matches both directions.
+func tcpdump(rules []rule) string {
+	terms := make([]string, 0, len(rules))
+	for _, r := range rules {
+		parts := []string{r.proto}
+		if r.local.IsValid() {
+			parts = append(parts, "host "+r.local.String(), "port "+strconv.Itoa(r.localPort))
+		}
+		var remotes []string
+		for _, p := range r.remotes {
+			if p.IsSingleIP() {
+				remotes = append(remotes, "host "+p.Addr().String())
+			} else {
+				remotes = append(remotes, "net "+p.String())
+			}
+		}
+		parts = append(parts, alternatives(remotes))
+		var ports []string
+		for _, p := range r.ports {
+			ports = append(ports, "port "+strconv.Itoa(p))
+		}
+		parts = append(parts, alternatives(ports))
+		terms = append(terms, strings.Join(parts, " and "))
+	}
+	if len(terms) == 1 {
+		return terms[0] + "\n"
+	}
+	return "(" + strings.Join(terms, ") or (") + ")\n"
+}
+
+// alternatives ors terms, in parentheses when there is more than one.
+func alternatives(terms []string) string {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " or ") + ")"
+}
+
+// nftables writes a table of its own that drops the traffic both ways, to
+// load with nft -f and remove with nft delete table inet ping_tracker. It
+// indents with spaces, which survive copying from a terminal.
+func nftables(rules []rule) string {
+	var in, out []string
+	for _, r := range rules {
+		family := "ip"
+		if r.v6 {
+			family = "ip6"
+		}
+		remotes := nftSet(joinPrefixes(r.remotes, ", "), len(r.remotes))
+		ports := nftSet(joinPorts(r.ports, ", "), len(r.ports))
+		local, localIn := "", ""
+		if r.local.IsValid() {
+			local = fmt.Sprintf("%s saddr %s %s sport %d ", family, r.local, r.proto, r.localPort)
+			localIn = fmt.Sprintf(" %s daddr %s %s dport %d", family, r.local, r.proto, r.localPort)
+		}
+		out = append(out, fmt.Sprintf("        %s%s daddr %s %s dport %s drop", local, family, remotes, r.proto, ports))
+		in = append(in, fmt.Sprintf("        %s saddr %s %s sport %s%s drop", family, remotes, r.proto, ports, localIn))
+	}
+	var b strings.Builder
+	b.WriteString("table inet ping_tracker {\n")
+	b.WriteString("    chain output {\n        type filter hook output priority 0; policy accept;\n")
+	b.WriteString(strings.Join(out, "\n") + "\n    }\n")
+	b.WriteString("    chain input {\n        type filter hook input priority 0; policy accept;\n")
+	b.WriteString(strings.Join(in, "\n") + "\n    }\n}\n")
+	return b.String()
+}
+
+// nftSet writes one value bare and several as an anonymous set.
+func nftSet(values string, n int) string {
+	if n == 1 {
+		return values
+	}
+	return "{ " + values + " }"
+}
+
+// iptables writes an OUTPUT and an INPUT rule per match, with ip6tables
+// for IPv6; more than one port uses the multiport match.
+func iptables(rules []rule) string {
+	var b strings.Builder
+	for _, r := range rules {
+		cmd := "iptables"
+		if r.v6 {
+			cmd = "ip6tables"
+		}
+		remotes := joinPrefixes(r.remotes, ",")
+		dports, sports := "--dport "+joinPorts(r.ports, ","), "--sport "+joinPorts(r.ports, ",")
+		if len(r.ports) > 1 {
+			dports, sports = "-m multiport --dports "+joinPorts(r.ports, ","), "-m multiport --sports "+joinPorts(r.ports, ",")
+		}
+		local, localIn := "", ""
+		if r.local.IsValid() {
+			local = fmt.Sprintf(" -s %s --sport %d", r.local, r.localPort)
+			localIn = fmt.Sprintf(" -d %s --dport %d", r.local, r.localPort)
+		}
+		fmt.Fprintf(&b, "%s -A OUTPUT -p %s%s -d %s %s -j DROP\n", cmd, r.proto, local, remotes, dports)
+		fmt.Fprintf(&b, "%s -A INPUT -p %s -s %s %s%s -j DROP\n", cmd, r.proto, remotes, sports, localIn)
+	}
+	return b.String()
+}
+
+// netsh writes an outbound and an inbound block rule per match, named so
+// they can be found and deleted together.
+func netsh(rules []rule) string {
+	var b strings.Builder
+	for _, r := range rules {
+		remotes := joinPrefixes(r.remotes, ",")
+		ports := joinPorts(r.ports, ",")
+		local := ""
+		if r.local.IsValid() {
+			local = fmt.Sprintf(" localip=%s localport=%d", r.local, r.localPort)
+		}
+		for _, dir := range []string{"out", "in"} {
+			fmt.Fprintf(&b, "netsh advfirewall firewall add rule name=\"ping-tracker block\" dir=%s action=block protocol=%s remoteip=%s remoteport=%s%s\n",
+				dir, strings.ToUpper(r.proto), remotes, ports, local)
+		}
+	}
+	return b.String()
+}
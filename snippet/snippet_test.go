@@ -0,0 +1,153 @@
+package snippet
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// conn is an established connection from local:lport to remote:rport.
+func conn(proto, local string, lport int, remote string, rport int) *tracker.Connection {
+	return &tracker.Connection{
+		AppName: "app", PID: 100, Protocol: proto, State: tracker.StateEstablished,
+		LocalAddr: local, LocalPort: lport, RemoteAddr: remote, RemotePort: rport,
+	}
+}
+
+// all writes the snippet of every target for conns, one after another.
+func all(t *testing.T, conns ...*tracker.Connection) string {
+	t.Helper()
+	var b strings.Builder
+	for _, target := range Targets() {
+		s, err := Generate(target, conns)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		b.WriteString("# " + target.Describe() + "\n" + s + "\n")
+	}
+	return b.String()
+}
+
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+func TestGenerateGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		conns []*tracker.Connection
+	}{
+		{"single", []*tracker.Connection{
+			conn("tcp", "10.0.0.2", 51234, "93.184.216.34", 443),
+		}},
+		{"multi_port", []*tracker.Connection{
+			conn("tcp", "10.0.0.2", 51234, "93.184.216.34", 443),
+			conn("tcp", "10.0.0.2", 51235, "93.184.216.34", 80),
+			conn("tcp", "10.0.0.2", 51236, "93.184.216.34", 443),
+		}},
+		{"multi_host", []*tracker.Connection{
+			conn("tcp", "10.0.0.2", 51234, "198.51.100.10", 443),
+			conn("tcp", "10.0.0.2", 51235, "198.51.100.20", 443),
+			conn("tcp", "10.0.0.2", 51236, "198.51.100.30", 443),
+			conn("tcp", "10.0.0.2", 51237, "203.0.113.9", 443),
+			conn("tcp", "10.0.0.2", 51238, "192.0.2.1", 443),
+			conn("udp", "10.0.0.2", 53000, "198.51.100.10", 3478),
+		}},
+		{"multi_host_prefix", []*tracker.Connection{
+			conn("tcp", "10.0.0.2", 51234, "198.51.100.10", 443),
+			conn("tcp", "10.0.0.2", 51235, "198.51.100.20", 443),
+			conn("tcp", "10.0.0.2", 51236, "198.51.100.200", 443),
+			conn("tcp", "10.0.0.2", 51237, "198.51.100.200", 8443),
+		}},
+		{"v6_single", []*tracker.Connection{
+			conn("tcp6", "2001:db8::2", 51234, "2606:4700::6810:85e5", 443),
+		}},
+		{"v6_multi", []*tracker.Connection{
+			conn("tcp6", "2001:db8::2", 51234, "2001:db8:aa::1", 443),
+			conn("tcp6", "2001:db8::2", 51235, "2001:db8:aa::ff", 443),
+			conn("udp6", "2001:db8::2", 53000, "2001:db8:bb::53", 53),
+			conn("tcp", "10.0.0.2", 51236, "198.51.100.10", 22),
+		}},
+		{"v4_mapped", []*tracker.Connection{
+			conn("tcp6", "::ffff:10.0.0.2", 51234, "::ffff:93.184.216.34", 443),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden(t, tt.name, all(t, tt.conns...))
+		})
+	}
+}
+
+func TestGenerateSkips(t *testing.T) {
+	listener := &tracker.Connection{Protocol: "tcp", State: tracker.StateListening, LocalAddr: "0.0.0.0", LocalPort: 22}
+	unconnected := &tracker.Connection{Protocol: "udp", State: tracker.StateUnconnected, LocalAddr: "0.0.0.0", LocalPort: 5353, RemoteAddr: "0.0.0.0"}
+	other := conn("icmp", "10.0.0.2", 0, "192.0.2.1", 0)
+	if _, err := Generate(Tcpdump, []*tracker.Connection{listener, unconnected, other}); err == nil {
+		t.Error("no error without a connection to match")
+	}
+
+	// Skipped and repeated connections leave a single one, kept as its
+	// 5-tuple.
+	c := conn("tcp", "10.0.0.2", 51234, "192.0.2.1", 443)
+	got, err := Generate(Tcpdump, []*tracker.Connection{listener, c, c, unconnected})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "tcp and host 10.0.0.2 and port 51234 and host 192.0.2.1 and port 443\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := Generate(Target("pf"), []*tracker.Connection{c}); err == nil {
+		t.Error("no error for an unknown target")
+	}
+}
+
+func TestMergePrefix(t *testing.T) {
+	tests := []struct {
+		addrs []string
+		want  string
+	}{
+		{[]string{"192.0.2.7"}, "192.0.2.7"},
+		{[]string{"192.0.2.1", "192.0.2.200"}, "192.0.2.0/24"},
+		{[]string{"192.0.2.16", "192.0.2.31"}, "192.0.2.16/28"},
+		{[]string{"192.0.2.1", "192.0.3.1"}, "192.0.2.1 192.0.3.1"},
+		{[]string{"2001:db8::1", "2001:db8::2:1"}, "2001:db8::/110"},
+		{[]string{"2001:db8:1::1", "2001:db8:2::1"}, "2001:db8:1::1 2001:db8:2::1"},
+	}
+	for _, tt := range tests {
+		eps := make([]*tracker.Connection, len(tt.addrs))
+		for i, a := range tt.addrs {
+			eps[i] = conn("tcp", "10.0.0.2", 50000+i, a, 443)
+		}
+		rules := coalesce(eps)
+		if len(rules) != 1 {
+			t.Fatalf("%v: %d rules", tt.addrs, len(rules))
+		}
+		if got := joinPrefixes(rules[0].remotes, " "); got != tt.want {
+			t.Errorf("%v: %s, want %s", tt.addrs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// summaryTop is how many apps and remotes each list of the session summary
+// shows.
+const summaryTop = 5
+
+// renderSummary renders the end-of-session summary printed after the TUI
+// exits, as plain text, with bold headings when color is set.
+func renderSummary(s tracker.SessionStats, color bool) string {
+	heading := func(h string) string {
+		if color {
+			return "\x1b[1m" + h + "\x1b[0m"
+		}
+		return h
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s, %d %s\n", heading("ping-tracker session:"),
+		s.Duration().Round(time.Second), s.Scans, plural(s.Scans, "scan", "scans"))
+	if s.PeakRate > 0 {
+		fmt.Fprintf(&b, "Bandwidth: peak %s at %s, average %s\n",
+			tracker.FormatBytes(s.PeakRate), s.PeakAt.Format("15:04:05"), tracker.FormatBytes(s.AvgRate))
+	}
+
+	b.WriteString(heading("Top apps by transfer:") + "\n")
+	apps := s.Apps[:min(summaryTop, len(s.Apps))]
+	if len(apps) == 0 {
+		b.WriteString("  none measured (this scanner reports no byte counters)\n")
+	}
+	for _, a := range apps {
+		fmt.Fprintf(&b, "  %-24s %10s  (up %s, down %s)\n", a.App,
+			tracker.FormatBytesTotal(a.Total()), tracker.FormatBytesTotal(a.TxBytes), tracker.FormatBytesTotal(a.RxBytes))
+	}
+
+	b.WriteString(heading("Highest average ping:") + "\n")
+	worst := s.WorstByPing(summaryTop)
+	if len(worst) == 0 {
+		b.WriteString("  no remotes pinged\n")
+	}
+	for _, r := range worst {
+		fmt.Fprintf(&b, "  %-40s %8s  (%d %s)\n", remoteLabel(r),
+			r.AvgPing.Round(100*time.Microsecond), r.Pinged, plural(r.Pinged, "sample", "samples"))
+	}
+
+	b.WriteString(heading("Highest loss:") + "\n")
+	lossy := s.WorstByLoss(summaryTop)
+	if len(lossy) == 0 {
+		b.WriteString("  no loss\n")
+	}
+	for _, r := range lossy {
+		fmt.Fprintf(&b, "  %-40s %7.1f%%  (%d %s)\n", remoteLabel(r),
+			r.Loss, r.Probes, plural(r.Probes, "probe", "probes"))
+	}
+
+	fmt.Fprintf(&b, "%s %d threshold, %d new listener or injected, %d unreachable\n",
+		heading("Alerts raised:"), s.Alerts, s.ListenerAlerts, s.Outages)
+	if len(s.Files) > 0 {
+		b.WriteString(heading("Files written:") + "\n")
+		for _, f := range s.Files {
+			b.WriteString("  " + f + "\n")
+		}
+	}
+	return b.String()
+}
+
+// remoteLabel names a remote by its address and, when one was seen, its
+// server name.
+func remoteLabel(r tracker.RemoteSummary) string {
+	if r.Name != "" {
+		return r.Addr + " (" + r.Name + ")"
+	}
+	return r.Addr
+}
+
+// summaryEvent is the session summary as one event log line.
+func summaryEvent(s tracker.SessionStats) tracker.Event {
+	var apps, ping, loss []string
+	for _, a := range s.Apps[:min(summaryTop, len(s.Apps))] {
+		apps = append(apps, a.App+":"+strconv.FormatUint(a.Total(), 10))
+	}
+	for _, r := range s.WorstByPing(summaryTop) {
+		ping = append(ping, r.Addr+":"+strconv.FormatInt(r.AvgPing.Milliseconds(), 10)+"ms")
+	}
+	for _, r := range s.WorstByLoss(summaryTop) {
+		loss = append(loss, r.Addr+":"+strconv.FormatFloat(r.Loss, 'f', 1, 64)+"%")
+	}
+	return tracker.Event{
+		Time:     s.End,
+		Severity: tracker.SeverityInfo,
+		Kind:     tracker.EventSessionSummary,
+		Fields: []tracker.EventField{
+			{Key: "duration", Value: s.Duration().Round(time.Second).String()},
+			{Key: "scans", Value: strconv.Itoa(s.Scans)},
+			{Key: "peak_bps", Value: strconv.FormatFloat(s.PeakRate, 'f', 0, 64)},
+			{Key: "avg_bps", Value: strconv.FormatFloat(s.AvgRate, 'f', 0, 64)},
+			{Key: "top_apps", Value: strings.Join(apps, ",")},
+			{Key: "worst_ping", Value: strings.Join(ping, ",")},
+			{Key: "worst_loss", Value: strings.Join(loss, ",")},
+			{Key: "alerts", Value: strconv.Itoa(s.Alerts)},
+			{Key: "listener_alerts", Value: strconv.Itoa(s.ListenerAlerts)},
+			{Key: "unreachable", Value: strconv.Itoa(s.Outages)},
+			{Key: "files", Value: strings.Join(s.Files, ",")},
+		},
+	}
+}
+
+// plural picks the singular or plural form for n.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
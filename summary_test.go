@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+var summaryStart = time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+// busySession has more apps and remotes than the summary lists.
+func busySession() tracker.SessionStats {
+	return tracker.SessionStats{
+		Start:    summaryStart,
+		End:      summaryStart.Add(42*time.Minute + 17*time.Second + 400*time.Millisecond),
+		Scans:    845,
+		PeakRate: 12.5 * 1024 * 1024,
+		PeakAt:   summaryStart.Add(13*time.Minute + 2*time.Second),
+		AvgRate:  340 * 1024,
+		Apps: []tracker.AppTransfer{
+			{App: "steam", TxBytes: 20 << 20, RxBytes: 3 << 30},
+			{App: "firefox", TxBytes: 14 << 20, RxBytes: 410 << 20},
+			{App: "zoom", TxBytes: 120 << 20, RxBytes: 130 << 20},
+			{App: "syncthing", TxBytes: 80 << 20, RxBytes: 12 << 20},
+			{App: "ssh", TxBytes: 2 << 20, RxBytes: 5 << 20},
+			{App: "curl", TxBytes: 1024, RxBytes: 900 << 10},
+		},
+		Remotes: []tracker.RemoteSummary{
+			{Addr: "142.250.74.46", Name: "www.google.com", AvgPing: 12345 * time.Microsecond, Probes: 280, Pinged: 280},
+			{Addr: "162.254.193.6", Name: "steamcdn-a.akamaihd.net", AvgPing: 88 * time.Millisecond, Loss: 0.5, Probes: 400, Pinged: 398},
+			{Addr: "170.114.52.2", AvgPing: 143250 * time.Microsecond, Loss: 12.5, Probes: 8, Pinged: 7},
+			{Addr: "192.0.2.1", Loss: 100, Probes: 1},
+			{Addr: "2a03:2880:f12f:83:face:b00c:0:25de", Name: "star.c10r.facebook.com", AvgPing: 31 * time.Millisecond, Loss: 2, Probes: 50, Pinged: 49},
+			{Addr: "198.51.100.7", AvgPing: 250 * time.Millisecond, Probes: 1, Pinged: 1},
+			{Addr: "203.0.113.40", AvgPing: 64 * time.Millisecond, Loss: 1, Probes: 100, Pinged: 99},
+		},
+		Alerts:         3,
+		ListenerAlerts: 1,
+		Outages:        2,
+		Files: []string{
+			"/home/me/.config/ping-tracker/events.log",
+			"/home/me/.config/ping-tracker/recordings/incident-20260314-091502.jsonl",
+			"snippet-nftables-20260314-093010.txt",
+		},
+	}
+}
+
+func TestRenderSummaryGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats tracker.SessionStats
+		color bool
+	}{
+		{"summary_busy", busySession(), false},
+		{"summary_busy_color", busySession(), true},
+		// A scanner without byte counters, no probes, no alerts.
+		{"summary_quiet", tracker.SessionStats{
+			Start: summaryStart,
+			End:   summaryStart.Add(59 * time.Second),
+			Scans: 1,
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden(t, tt.name, renderSummary(tt.stats, tt.color))
+		})
+	}
+}
+
+func TestRenderSummaryNoColor(t *testing.T) {
+	if s := renderSummary(busySession(), false); strings.Contains(s, "\x1b") {
+		t.Errorf("escape codes without color:\n%s", s)
+	}
+}
+
+func TestSummaryEvent(t *testing.T) {
+	e := summaryEvent(busySession())
+	if e.Kind != tracker.EventSessionSummary || !e.Time.Equal(summaryStart.Add(42*time.Minute+17*time.Second+400*time.Millisecond)) {
+		t.Errorf("event %s at %s", e.Kind, e.Time)
+	}
+	fields := make(map[string]string)
+	for _, f := range e.Fields {
+		fields[f.Key] = f.Value
+	}
+	want := map[string]string{
+		"duration":        "42m17s",
+		"scans":           "845",
+		"peak_bps":        "13107200",
+		"top_apps":        "steam:3242196992,firefox:444596224,zoom:262144000,syncthing:96468992,ssh:7340032",
+		"worst_ping":      "198.51.100.7:250ms,170.114.52.2:143ms,162.254.193.6:88ms,203.0.113.40:64ms,2a03:2880:f12f:83:face:b00c:0:25de:31ms",
+		"worst_loss":      "192.0.2.1:100.0%,170.114.52.2:12.5%,2a03:2880:f12f:83:face:b00c:0:25de:2.0%,203.0.113.40:1.0%,162.254.193.6:0.5%",
+		"alerts":          "3",
+		"listener_alerts": "1",
+		"unreachable":     "2",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s=%q, want %q", k, fields[k], v)
+		}
+	}
+	if !strings.Contains(fields["files"], "events.log,") {
+		t.Errorf("files=%q", fields["files"])
+	}
+}
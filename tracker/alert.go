@@ -0,0 +1,266 @@
+package tracker
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// AlertRule holds the thresholds that cause a connection to raise an alert.
+// A zero threshold disables that check. The warn levels only classify rows
+// (see Level); alerts are raised at the critical thresholds.
+type AlertRule struct {
+	PingThreshold time.Duration // critical
+	LossThreshold float64       // critical, percentage (0-100)
+	PingWarn      time.Duration
+	LossWarn      float64
+	RateThreshold float64       // bytes/sec, TX+RX
+	StallTime     time.Duration // a confirmed transfer stall lasting this long
+
+	// A send queue holding at least SendQThreshold bytes for SendQScans
+	// consecutive scans (DefaultSendQScans when 0).
+	SendQThreshold uint64
+	SendQScans     int
+
+	// A health score below ScoreThreshold for ScoreScans consecutive scans
+	// (DefaultScoreScans when 0) raises one AlertUnhealthy alert instead of
+	// the connection's threshold alert.
+	ScoreThreshold int
+	ScoreScans     int
+
+	// An app whose sockets hold at least AppSockMemThreshold bytes of
+	// kernel socket memory together raises one AlertSockMem alert.
+	AppSockMemThreshold uint64
+}
+
+// AlertLevel classifies a connection against an AlertRule.
+type AlertLevel int
+
+const (
+	AlertNone AlertLevel = iota
+	AlertWarn
+	AlertCrit
+)
+
+// Alert kinds besides threshold crossings: a listening service that has not
+// been acknowledged (see ListenerWatch), a connection whose health score
+// stayed low (see HealthScore), a remote whose service check failed (see
+// SetServiceChecks), and an app holding too much socket memory.
+const (
+	AlertNewListener  = "new_listener"
+	AlertUnhealthy    = "unhealthy"
+	AlertServiceCheck = "service_check"
+	AlertSockMem      = "sockmem"
+)
+
+// Alert metrics: the measurement a threshold alert or an AlertUnhealthy or
+// AlertSockMem one is about, named with its unit.
+const (
+	MetricPing    = "ping_ms"
+	MetricLoss    = "loss_pct"
+	MetricRate    = "rate_bytes_per_s"
+	MetricStall   = "stall_s"
+	MetricSendQ   = "send_queue_bytes"
+	MetricScore   = "score"
+	MetricSockMem = "sockmem_bytes"
+)
+
+// Alert describes a single threshold crossing, a new listener, or an
+// unhealthy connection observed during a scan. Metric, Value and
+// Threshold give the measurement behind Reason, for notifications; Metric
+// is "" for alerts that are not about one.
+type Alert struct {
+	Time      time.Time
+	Kind      string `json:",omitempty"` // "" for thresholds, or one of the kinds above
+	Key       string
+	AppName   string
+	Remote    string
+	Reason    string
+	Metric    string  `json:",omitempty"`
+	Value     float64 `json:",omitempty"`
+	Threshold float64 `json:",omitempty"`
+}
+
+// Enabled reports whether any threshold is set.
+func (r AlertRule) Enabled() bool {
+	return r.PingThreshold > 0 || r.LossThreshold > 0 || r.PingWarn > 0 || r.LossWarn > 0 || r.RateThreshold > 0 || r.StallTime > 0 || r.SendQThreshold > 0 || r.ScoreThreshold > 0 || r.AppSockMemThreshold > 0
+}
+
+// Validate checks that thresholds are in range and each warn level is below
+// its critical level.
+func (r AlertRule) Validate() error {
+	switch {
+	case r.PingThreshold < 0 || r.PingWarn < 0:
+		return fmt.Errorf("ping thresholds must not be negative")
+	case r.PingThreshold > time.Minute || r.PingWarn > time.Minute:
+		return fmt.Errorf("ping thresholds must be at most 1m")
+	case r.LossThreshold < 0 || r.LossThreshold > 100 || r.LossWarn < 0 || r.LossWarn > 100:
+		return fmt.Errorf("loss thresholds must be between 0 and 100%%")
+	case r.RateThreshold < 0:
+		return fmt.Errorf("bandwidth threshold must not be negative")
+	case r.StallTime < 0:
+		return fmt.Errorf("stall threshold must not be negative")
+	case r.SendQScans < 0:
+		return fmt.Errorf("send queue scan count must not be negative")
+	case r.ScoreThreshold < 0 || r.ScoreThreshold > 100:
+		return fmt.Errorf("score threshold must be between 0 and 100")
+	case r.ScoreScans < 0:
+		return fmt.Errorf("score scan count must not be negative")
+	case r.PingWarn > 0 && r.PingThreshold > 0 && r.PingWarn >= r.PingThreshold:
+		return fmt.Errorf("ping warn (%s) must be below crit (%s)", r.PingWarn, r.PingThreshold)
+	case r.LossWarn > 0 && r.LossThreshold > 0 && r.LossWarn >= r.LossThreshold:
+		return fmt.Errorf("loss warn (%.0f%%) must be below crit (%.0f%%)", r.LossWarn, r.LossThreshold)
+	}
+	return nil
+}
+
+// Level returns how far a connection is past the thresholds.
+func (r AlertRule) Level(c *Connection) AlertLevel {
+	if r.reason(c) != "" || r.unhealthy(c) || c.ServiceCheck.Failed() {
+		return AlertCrit
+	}
+	switch {
+	case r.ScoreThreshold > 0 && c.HasScore && c.Score < r.ScoreThreshold:
+		return AlertWarn
+	case r.LossWarn > 0 && c.PingCount > 0 && c.Loss >= r.LossWarn:
+		return AlertWarn
+	case r.PingWarn > 0 && c.Ping >= r.PingWarn:
+		return AlertWarn
+	}
+	return AlertNone
+}
+
+// reason describes the critical threshold a connection crosses, if any.
+func (r AlertRule) reason(c *Connection) string {
+	return r.crossing(c).Reason
+}
+
+// crossing returns the critical threshold a connection crosses as an
+// alert with only Reason and the metric set, or a zero Alert.
+func (r AlertRule) crossing(c *Connection) Alert {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	switch {
+	case r.LossThreshold > 0 && c.PingCount > 0 && c.Loss >= r.LossThreshold:
+		return Alert{Reason: fmt.Sprintf("loss %.0f%% >= %.0f%%", c.Loss, r.LossThreshold),
+			Metric: MetricLoss, Value: c.Loss, Threshold: r.LossThreshold}
+	case r.PingThreshold > 0 && c.Ping >= r.PingThreshold:
+		return Alert{Reason: fmt.Sprintf("ping %s >= %s", c.Ping.Round(time.Millisecond), r.PingThreshold),
+			Metric: MetricPing, Value: ms(c.Ping), Threshold: ms(r.PingThreshold)}
+	case r.RateThreshold > 0 && c.TxRate+c.RxRate >= r.RateThreshold:
+		return Alert{Reason: fmt.Sprintf("rate %s >= %s", FormatBytes(c.TxRate+c.RxRate), FormatBytes(r.RateThreshold)),
+			Metric: MetricRate, Value: c.TxRate + c.RxRate, Threshold: r.RateThreshold}
+	case r.StallTime > 0 && !c.StallSince.IsZero() && c.StallDuration() >= r.StallTime:
+		return Alert{Reason: fmt.Sprintf("stalled (%s) for %s", c.StallReason, c.StallDuration().Round(time.Second)),
+			Metric: MetricStall, Value: c.StallDuration().Seconds(), Threshold: r.StallTime.Seconds()}
+	case r.SendQThreshold > 0 && c.SendQHigh >= r.sendQScans():
+		return Alert{Reason: fmt.Sprintf("send queue %s >= %s for %d scans", FormatBytesTotal(c.SendQ), FormatBytesTotal(r.SendQThreshold), c.SendQHigh),
+			Metric: MetricSendQ, Value: float64(c.SendQ), Threshold: float64(r.SendQThreshold)}
+	}
+	return Alert{}
+}
+
+// sendQScans returns SendQScans or its default.
+func (r AlertRule) sendQScans() int {
+	if r.SendQScans > 0 {
+		return r.SendQScans
+	}
+	return DefaultSendQScans
+}
+
+// scoreScans returns ScoreScans or its default.
+func (r AlertRule) scoreScans() int {
+	if r.ScoreScans > 0 {
+		return r.ScoreScans
+	}
+	return DefaultScoreScans
+}
+
+// unhealthy reports whether a connection's score has stayed below
+// ScoreThreshold long enough to alert.
+func (r AlertRule) unhealthy(c *Connection) bool {
+	return r.ScoreThreshold > 0 && c.HasScore && c.ScoreLow >= r.scoreScans()
+}
+
+// Evaluate returns an alert for every connection that crosses a critical
+// threshold, or an AlertUnhealthy one for a connection whose score stayed
+// low, which covers its threshold crossings too. A connection with neither
+// whose service check failed raises an AlertServiceCheck; checks are opt-in,
+// so they alert without any threshold set. Each app over
+// AppSockMemThreshold adds an AlertSockMem.
+func (r AlertRule) Evaluate(now time.Time, conns []*Connection) []Alert {
+	enabled := r.Enabled()
+	var alerts []Alert
+	for _, c := range conns {
+		var a Alert
+		switch {
+		case enabled && r.unhealthy(c):
+			a = Alert{Kind: AlertUnhealthy, Reason: fmt.Sprintf("score %d < %d for %d scans", c.Score, r.ScoreThreshold, c.ScoreLow),
+				Metric: MetricScore, Value: float64(c.Score), Threshold: float64(r.ScoreThreshold)}
+			if c.ScoreWorst != "" {
+				a.Reason += ", worst: " + c.ScoreWorst
+			}
+		case enabled && r.reason(c) != "":
+			a = r.crossing(c)
+		case c.ServiceCheck.Failed():
+			a = Alert{Kind: AlertServiceCheck, Reason: c.ServiceCheck.Name + " check failed: " + c.ServiceCheck.Summary()}
+		default:
+			continue
+		}
+		a.Time, a.Key, a.AppName = now, c.Key(), c.AppName
+		a.Remote = net.JoinHostPort(c.RemoteAddr, strconv.Itoa(c.RemotePort))
+		alerts = append(alerts, a)
+	}
+	if r.AppSockMemThreshold > 0 {
+		alerts = append(alerts, r.sockMemAlerts(now, conns)...)
+	}
+	return alerts
+}
+
+// sockMemAlerts sums the socket memory of each app, the apps of each agent
+// apart, and alerts for the ones at or above AppSockMemThreshold.
+func (r AlertRule) sockMemAlerts(now time.Time, conns []*Connection) []Alert {
+	type appMem struct {
+		app     string
+		bytes   uint64
+		sockets int
+	}
+	apps := make(map[string]*appMem)
+	for _, c := range conns {
+		if c.SockMemInfo == nil {
+			continue
+		}
+		key := AlertSockMem + "|" + c.Host + "|" + c.AppName
+		a := apps[key]
+		if a == nil {
+			a = &appMem{app: c.AppName}
+			apps[key] = a
+		}
+		a.bytes += c.SockMem
+		a.sockets++
+	}
+	var alerts []Alert
+	for _, key := range slices.Sorted(maps.Keys(apps)) {
+		a := apps[key]
+		if a.bytes < r.AppSockMemThreshold {
+			continue
+		}
+		sockets := fmt.Sprintf("%d sockets", a.sockets)
+		if a.sockets == 1 {
+			sockets = "1 socket"
+		}
+		alerts = append(alerts, Alert{
+			Time:      now,
+			Kind:      AlertSockMem,
+			Key:       key,
+			AppName:   a.app,
+			Reason:    fmt.Sprintf("socket memory %s >= %s in %s", FormatBytesTotal(a.bytes), FormatBytesTotal(r.AppSockMemThreshold), sockets),
+			Metric:    MetricSockMem,
+			Value:     float64(a.bytes),
+			Threshold: float64(r.AppSockMemThreshold),
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,83 @@
+package tracker
+
+import (
+	"sort"
+	"time"
+)
+
+// maxAppTotals bounds the apps with lifetime totals; the least recently
+// seen are dropped beyond it.
+const maxAppTotals = 1024
+
+// AppTotals is what one app has moved across sessions, counting the
+// connections that closed while the tracker was running.
+type AppTotals struct {
+	TxBytes   uint64    `json:"tx_bytes"`
+	RxBytes   uint64    `json:"rx_bytes"`
+	Conns     int       `json:"conns"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// addClosed folds a closed connection into its app's totals. Sockets
+// without byte counters still count as a connection. Caller must hold the
+// lock.
+func (t *Tracker) addClosed(c *Connection, now time.Time) {
+	if c.AppName == "" {
+		return
+	}
+	a, ok := t.appTotals[c.AppName]
+	if !ok {
+		a = &AppTotals{FirstSeen: c.FirstSeen}
+		t.appTotals[c.AppName] = a
+	}
+	if c.HasByteCounts {
+		a.TxBytes += c.TxBytes
+		a.RxBytes += c.RxBytes
+	}
+	a.Conns++
+	a.LastSeen = now
+}
+
+// pruneAppTotals drops the least recently seen apps beyond maxAppTotals.
+// Caller must hold the lock.
+func (t *Tracker) pruneAppTotals() {
+	if len(t.appTotals) <= maxAppTotals {
+		return
+	}
+	apps := make([]string, 0, len(t.appTotals))
+	for app := range t.appTotals {
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool { return t.appTotals[apps[i]].LastSeen.Before(t.appTotals[apps[j]].LastSeen) })
+	for _, app := range apps[:len(apps)-maxAppTotals] {
+		delete(t.appTotals, app)
+	}
+}
+
+// AppLifetime returns app's lifetime totals including its open
+// connections, and whether anything is known about it.
+func (t *Tracker) AppLifetime(app string) (AppTotals, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var a AppTotals
+	found := false
+	if saved, ok := t.appTotals[app]; ok {
+		a, found = *saved, true
+	}
+	for _, c := range t.connections {
+		if c.AppName != app || c.Protocol == ExternalProtocol {
+			continue
+		}
+		if !found || c.FirstSeen.Before(a.FirstSeen) {
+			a.FirstSeen = c.FirstSeen
+		}
+		found = true
+		if c.HasByteCounts {
+			a.TxBytes += c.TxBytes
+			a.RxBytes += c.RxBytes
+		}
+		a.Conns++
+	}
+	return a, found
+}
@@ -0,0 +1,167 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// AuditRule is one triage heuristic applied to a connection's executable.
+// A rule matches when every condition it sets holds; its Score is then
+// added to the connection's suspicion score.
+type AuditRule struct {
+	Name           string
+	Score          int
+	PathPrefixes   []string      // any of these (case-insensitive on Windows)
+	ModifiedWithin time.Duration // executable mtime is this recent
+	WorldWritable  bool          // containing directory is writable by anyone
+	Deleted        bool          // executable was removed after the process started
+}
+
+// AuditResult is the evaluation of all rules for one executable.
+type AuditResult struct {
+	Score   int
+	Reasons []string
+}
+
+// DefaultAuditRules returns the built-in rules for the current OS.
+func DefaultAuditRules() []AuditRule {
+	home, _ := os.UserHomeDir()
+	if runtime.GOOS == "windows" {
+		var temp []string
+		for _, env := range []string{"TEMP", "TMP"} {
+			if v := os.Getenv(env); v != "" {
+				temp = append(temp, v+`\`)
+			}
+		}
+		if v := os.Getenv("LOCALAPPDATA"); v != "" {
+			temp = append(temp, filepath.Join(v, "Temp")+`\`)
+		}
+		return []AuditRule{
+			{Name: "runs from a temp directory", Score: 50, PathPrefixes: temp},
+			{Name: "runs from Downloads", Score: 30, PathPrefixes: []string{filepath.Join(home, "Downloads") + `\`}},
+			{Name: "modified in the last day", Score: 20, ModifiedWithin: 24 * time.Hour},
+		}
+	}
+	return []AuditRule{
+		{Name: "runs from a temp directory", Score: 50, PathPrefixes: []string{"/tmp/", "/var/tmp/", "/dev/shm/"}},
+		{Name: "runs from Downloads", Score: 30, PathPrefixes: []string{filepath.Join(home, "Downloads") + "/"}},
+		{Name: "directory is world-writable", Score: 40, WorldWritable: true},
+		{Name: "modified in the last day", Score: 20, ModifiedWithin: 24 * time.Hour},
+		{Name: "executable deleted", Score: 40, Deleted: true},
+	}
+}
+
+// maxAuditCache caps the cached audit results; the cache is cleared when full.
+const maxAuditCache = 4096
+
+// auditKey identifies one version of an executable.
+type auditKey struct {
+	path  string
+	mtime time.Time
+}
+
+// Auditor scores executables against a rule set. Results are cached per
+// path and modification time. It is not safe for concurrent use; the
+// tracker calls it with its lock held.
+type Auditor struct {
+	rules []AuditRule
+	stat  func(string) (os.FileInfo, error)
+	now   func() time.Time
+	cache map[auditKey]AuditResult
+}
+
+// NewAuditor creates an auditor using the real filesystem.
+func NewAuditor(rules []AuditRule) *Auditor {
+	return &Auditor{
+		rules: rules,
+		stat:  os.Stat,
+		now:   time.Now,
+		cache: make(map[auditKey]AuditResult),
+	}
+}
+
+// Evaluate scores the executable at path. An empty path (unknown
+// executable) scores zero.
+func (a *Auditor) Evaluate(path string) AuditResult {
+	if path == "" {
+		return AuditResult{}
+	}
+	deleted := strings.HasSuffix(path, " (deleted)")
+	clean := strings.TrimSuffix(path, " (deleted)")
+
+	var mtime time.Time
+	fi, err := a.stat(clean)
+	if err == nil {
+		mtime = fi.ModTime()
+	}
+	key := auditKey{path: path, mtime: mtime}
+	if r, ok := a.cache[key]; ok {
+		return r
+	}
+
+	var dirInfo os.FileInfo
+	if d, err := a.stat(filepath.Dir(clean)); err == nil {
+		dirInfo = d
+	}
+
+	var res AuditResult
+	for _, rule := range a.rules {
+		if a.matches(rule, clean, fi, dirInfo, deleted) {
+			res.Score += rule.Score
+			res.Reasons = append(res.Reasons, rule.Name)
+		}
+	}
+	if len(a.cache) >= maxAuditCache {
+		a.cache = make(map[auditKey]AuditResult)
+	}
+	a.cache[key] = res
+	return res
+}
+
+// matches reports whether every condition rule sets holds for the executable.
+func (a *Auditor) matches(rule AuditRule, path string, fi, dir os.FileInfo, deleted bool) bool {
+	if len(rule.PathPrefixes) == 0 && rule.ModifiedWithin == 0 && !rule.WorldWritable && !rule.Deleted {
+		return false
+	}
+	if len(rule.PathPrefixes) > 0 {
+		found := false
+		for _, p := range rule.PathPrefixes {
+			if p != "" && hasPathPrefix(path, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.ModifiedWithin > 0 && (fi == nil || a.now().Sub(fi.ModTime()) > rule.ModifiedWithin) {
+		return false
+	}
+	if rule.WorldWritable && (dir == nil || dir.Mode().Perm()&0o002 == 0) {
+		return false
+	}
+	if rule.Deleted && !deleted {
+		return false
+	}
+	return true
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.HasPrefix(strings.ToLower(path), strings.ToLower(prefix))
+	}
+	return strings.HasPrefix(path, prefix)
+}
+
+// Summary formats a result for display, e.g. "60: runs from a temp directory, ...".
+func (r AuditResult) Summary() string {
+	if r.Score == 0 {
+		return "no findings"
+	}
+	return fmt.Sprintf("%d: %s", r.Score, strings.Join(r.Reasons, ", "))
+}
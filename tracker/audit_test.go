@@ -0,0 +1,116 @@
+package tracker
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeFS is a filesystem for the auditor: paths map to their stat results.
+type fakeFS struct {
+	files map[string]*fstest.MapFile
+	stats int
+}
+
+func (f *fakeFS) stat(path string) (os.FileInfo, error) {
+	f.stats++
+	file, ok := f.files[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return fstest.MapFS{"x": file}.Stat("x")
+}
+
+func TestAuditRules(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-30 * 24 * time.Hour)
+	rules := []AuditRule{
+		{Name: "temp", Score: 50, PathPrefixes: []string{"/tmp/", "/dev/shm/"}},
+		{Name: "writable", Score: 40, WorldWritable: true},
+		{Name: "recent", Score: 20, ModifiedWithin: 24 * time.Hour},
+		{Name: "deleted", Score: 40, Deleted: true},
+		{Name: "temp and recent", Score: 5, PathPrefixes: []string{"/tmp/"}, ModifiedWithin: time.Hour},
+		{Name: "no conditions", Score: 100},
+	}
+	fsys := &fakeFS{files: map[string]*fstest.MapFile{
+		"/usr/bin":           {Mode: fs.ModeDir | 0o755, ModTime: old},
+		"/usr/bin/curl":      {Mode: 0o755, ModTime: old},
+		"/usr/bin/new":       {Mode: 0o755, ModTime: now.Add(-time.Hour)},
+		"/tmp":               {Mode: fs.ModeDir | fs.ModeSticky | 0o777, ModTime: now},
+		"/tmp/x":             {Mode: 0o755, ModTime: now.Add(-10 * time.Minute)},
+		"/tmp/old":           {Mode: 0o755, ModTime: old},
+		"/home/u/bin":        {Mode: fs.ModeDir | 0o755, ModTime: old},
+		"/home/u/bin/tool":   {Mode: 0o755, ModTime: now.Add(-2 * time.Hour)},
+		"/home/u/tmp/script": {Mode: 0o755, ModTime: old},
+	}}
+	a := NewAuditor(rules)
+	a.stat = fsys.stat
+	a.now = func() time.Time { return now }
+
+	tests := []struct {
+		path    string
+		score   int
+		reasons []string
+	}{
+		{"", 0, nil},
+		{"/usr/bin/curl", 0, nil},
+		{"/usr/bin/new", 20, []string{"recent"}},
+		{"/tmp/x", 50 + 40 + 20 + 5, []string{"temp", "writable", "recent", "temp and recent"}},
+		{"/tmp/old", 50 + 40, []string{"temp", "writable"}},
+		{"/home/u/bin/tool", 20, []string{"recent"}},
+		{"/home/u/tmp/script", 0, nil}, // prefixes match from the start
+		{"/usr/bin/curl (deleted)", 40, []string{"deleted"}},
+		{"/tmp/gone (deleted)", 50 + 40 + 40, []string{"temp", "writable", "deleted"}},
+	}
+	for _, tt := range tests {
+		r := a.Evaluate(tt.path)
+		if r.Score != tt.score || len(r.Reasons) != len(tt.reasons) {
+			t.Errorf("%q: %s, want %d %v", tt.path, r.Summary(), tt.score, tt.reasons)
+			continue
+		}
+		for i := range tt.reasons {
+			if r.Reasons[i] != tt.reasons[i] {
+				t.Errorf("%q: reasons %v, want %v", tt.path, r.Reasons, tt.reasons)
+				break
+			}
+		}
+	}
+}
+
+func TestAuditCache(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fsys := &fakeFS{files: map[string]*fstest.MapFile{
+		"/tmp":   {Mode: fs.ModeDir | 0o777},
+		"/tmp/x": {Mode: 0o755, ModTime: now.Add(-48 * time.Hour)},
+	}}
+	a := NewAuditor([]AuditRule{{Name: "recent", Score: 20, ModifiedWithin: 24 * time.Hour}})
+	a.stat = fsys.stat
+	a.now = func() time.Time { return now }
+
+	if r := a.Evaluate("/tmp/x"); r.Score != 0 {
+		t.Fatalf("old binary scored %d", r.Score)
+	}
+	fsys.stats = 0
+	a.Evaluate("/tmp/x")
+	if fsys.stats != 1 {
+		t.Fatalf("%d stats for a cached path, want only the mtime check", fsys.stats)
+	}
+
+	// Replacing the binary changes its mtime, which is a new cache entry.
+	fsys.files["/tmp/x"] = &fstest.MapFile{Mode: 0o755, ModTime: now.Add(-time.Minute)}
+	if r := a.Evaluate("/tmp/x"); r.Score != 20 {
+		t.Fatalf("replaced binary scored %d, want 20", r.Score)
+	}
+}
+
+func TestAuditSummary(t *testing.T) {
+	if got := (AuditResult{}).Summary(); got != "no findings" {
+		t.Errorf("empty: %q", got)
+	}
+	r := AuditResult{Score: 70, Reasons: []string{"runs from a temp directory", "modified in the last day"}}
+	if got, want := r.Summary(), "70: runs from a temp directory, modified in the last day"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,295 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// captureQueueLen is how many packets wait for inspection; a packet
+	// that finds the queue full is counted but not inspected.
+	captureQueueLen = 1024
+	// inspectPackets is how many payload packets of each flow are
+	// inspected: enough for its handshake.
+	inspectPackets = 8
+	// maxInspectBytes is how much of a payload is copied for inspection.
+	maxInspectBytes = 4096
+	// maxCaptureFlows bounds the flows counted; new flows beyond it are not.
+	maxCaptureFlows = 1 << 16
+	// captureFlowTTL is how long a flow without packets is kept, so a
+	// connection idle for a while keeps its totals.
+	captureFlowTTL = 10 * time.Minute
+)
+
+// packetSource reads the packets the host sends and receives, from the IP
+// header on. It is implemented per OS (capture_<os>.go).
+type packetSource interface {
+	// read waits for the next packet and copies it into buf. ok is false
+	// for a packet the host neither sent nor received, such as one seen
+	// in promiscuous mode. It returns an error once closed.
+	read(buf []byte) (n int, outbound, ok bool, err error)
+	close() error
+}
+
+// ipPacket is the part of a captured TCP or UDP packet the capture uses.
+type ipPacket struct {
+	udp      bool
+	src, dst netip.AddrPort
+	payload  []byte
+	size     int    // on the wire, IP header included
+	seq      uint32 // TCP sequence number of the payload
+}
+
+// decodeIPPacket reads the IPv4 or IPv6 packet at the start of b. It
+// returns false for other protocols and for fragments after the first,
+// which carry no ports. It never reads past b.
+func decodeIPPacket(b []byte) (ipPacket, bool) {
+	var p ipPacket
+	var proto byte
+	var src, dst netip.Addr
+	var off int
+	switch {
+	case len(b) >= 20 && b[0]>>4 == 4:
+		off = int(b[0]&0x0f) * 4
+		p.size = int(binary.BigEndian.Uint16(b[2:4]))
+		if off < 20 || p.size < off || binary.BigEndian.Uint16(b[6:8])&0x1fff != 0 {
+			return p, false
+		}
+		proto = b[9]
+		src = netip.AddrFrom4([4]byte(b[12:16]))
+		dst = netip.AddrFrom4([4]byte(b[16:20]))
+	case len(b) >= 40 && b[0]>>4 == 6:
+		p.size = 40 + int(binary.BigEndian.Uint16(b[4:6]))
+		proto = b[6]
+		src = netip.AddrFrom16([16]byte(b[8:24]))
+		dst = netip.AddrFrom16([16]byte(b[24:40]))
+		off = 40
+		for proto == 0 || proto == 43 || proto == 44 || proto == 60 { // extension headers
+			if len(b) < off+8 {
+				return p, false
+			}
+			if proto == 44 && binary.BigEndian.Uint16(b[off+2:off+4])>>3 != 0 {
+				return p, false // not the first fragment
+			}
+			next, size := b[off], 8
+			if proto != 44 {
+				size = (int(b[off+1]) + 1) * 8
+			}
+			proto, off = next, off+size
+		}
+	default:
+		return p, false
+	}
+	end := min(p.size, len(b))
+	switch proto {
+	case 6:
+		if end < off+20 {
+			return p, false
+		}
+		data := off + int(b[off+12]>>4)*4
+		if data < off+20 || data > end {
+			return p, false
+		}
+		p.payload = b[data:end]
+		p.seq = binary.BigEndian.Uint32(b[off+4 : off+8])
+	case 17:
+		if end < off+8 {
+			return p, false
+		}
+		p.udp = true
+		p.payload = b[off+8 : end]
+	default:
+		return p, false
+	}
+	p.src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[off:off+2]))
+	p.dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[off+2:off+4]))
+	return p, true
+}
+
+// flowCount is what the capture saw of one flow.
+type flowCount struct {
+	tx, rx   uint64 // bytes on the wire
+	payloads int    // packets with a payload, both ways
+	seen     time.Time
+	follow   bool // every payload is inspected, not just the first
+}
+
+// capturedPacket is a payload queued for inspection.
+type capturedPacket struct {
+	flow     sniFlow // from the host's side
+	outbound bool
+	seq      uint32
+	payload  []byte
+}
+
+// packetCapture is -pcap-accounting: it counts the bytes of every TCP and
+// UDP flow of the host for the connections the scanner has no counters
+// for, and has the first packets of each flow inspected for a TLS or QUIC
+// ClientHello or the HTTP/2 preface; h2c connections are followed further
+// for their frame headers (see h2c.go). Counting happens on the reading
+// goroutine, under a lock of its own; inspection on another, behind a
+// queue that drops packets rather than hold up the capture.
+type packetCapture struct {
+	src     packetSource
+	queue   chan capturedPacket
+	dropped atomic.Uint64 // packets not inspected because the queue was full
+
+	mu    sync.Mutex
+	flows map[sniFlow]*flowCount
+
+	h2c h2cFlows // used by the inspecting goroutine and fill
+}
+
+// StartCapture turns on -pcap-accounting. It fails without a packet
+// capture on this OS, or without the privilege to open one. Must be
+// called before Start.
+func (t *Tracker) StartCapture() error {
+	src, err := openPacketSource()
+	if err != nil {
+		return err
+	}
+	t.startCapture(src)
+	return nil
+}
+
+// startCapture counts and inspects the packets of src.
+func (t *Tracker) startCapture(src packetSource) {
+	c := &packetCapture{
+		src:   src,
+		queue: make(chan capturedPacket, captureQueueLen),
+		flows: make(map[sniFlow]*flowCount),
+	}
+	t.capture = c
+	go c.run()
+	go t.inspect(c.queue)
+}
+
+// run reads packets until the source is closed.
+func (c *packetCapture) run() {
+	defer close(c.queue)
+	buf := make([]byte, 1<<16)
+	for {
+		n, outbound, ok, err := c.src.read(buf)
+		if err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+		if p, ok := decodeIPPacket(buf[:n]); ok {
+			c.count(p, outbound, time.Now())
+		}
+	}
+}
+
+// count adds p to its flow and queues its payload while the flow is new.
+func (c *packetCapture) count(p ipPacket, outbound bool, now time.Time) {
+	flow := sniFlow{unmapAddrPort(p.dst), unmapAddrPort(p.src), p.udp}
+	if outbound {
+		flow.local, flow.remote = flow.remote, flow.local
+	}
+	c.mu.Lock()
+	f := c.flows[flow]
+	if f == nil {
+		if len(c.flows) >= maxCaptureFlows {
+			c.mu.Unlock()
+			return
+		}
+		f = &flowCount{}
+		c.flows[flow] = f
+	}
+	if outbound {
+		f.tx += uint64(p.size)
+	} else {
+		f.rx += uint64(p.size)
+	}
+	f.seen = now
+	inspect, size := false, maxInspectBytes
+	if len(p.payload) > 0 && (f.payloads < inspectPackets || f.follow) {
+		f.payloads++
+		inspect = true
+	}
+	if f.follow || outbound && !p.udp && len(p.payload) > 0 && p.payload[0] == 0x16 {
+		// A frame header may be anywhere in it; a ClientHello must not be
+		// cut short.
+		size = len(p.payload)
+	}
+	c.mu.Unlock()
+	if !inspect {
+		return
+	}
+	payload := append([]byte(nil), p.payload[:min(len(p.payload), size)]...)
+	select {
+	case c.queue <- capturedPacket{flow, outbound, p.seq, payload}:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// inspect hands queued payloads to the parsers until the capture stops.
+func (t *Tracker) inspect(queue <-chan capturedPacket) {
+	c := t.capture
+	for p := range queue {
+		if p.flow.udp {
+			t.ObserveQUIC(p.flow.local, p.flow.remote, p.payload, p.outbound)
+			continue
+		}
+		if p.outbound {
+			t.ObserveClientHello(p.flow.local, p.flow.remote, p.payload)
+		}
+		follow := c.h2c.observe(p.flow, p.outbound, p.seq, p.payload, time.Now())
+		c.setFollow(p.flow, follow)
+	}
+}
+
+// setFollow sets whether all of flow's payloads are inspected.
+func (c *packetCapture) setFollow(flow sniFlow, follow bool) {
+	c.mu.Lock()
+	if f := c.flows[flow]; f != nil {
+		f.follow = follow
+	}
+	c.mu.Unlock()
+}
+
+// fill gives connections without byte counters of their own the totals
+// captured for their 5-tuple, and h2c connections their stream count, and
+// forgets flows idle past captureFlowTTL.
+func (c *packetCapture) fill(conns []*Connection, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range conns {
+		if conn.Host != "" {
+			continue
+		}
+		local, err1 := netip.ParseAddr(conn.LocalAddr)
+		remote, err2 := netip.ParseAddr(conn.RemoteAddr)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		flow := sniFlow{
+			netip.AddrPortFrom(local.Unmap(), uint16(conn.LocalPort)),
+			netip.AddrPortFrom(remote.Unmap(), uint16(conn.RemotePort)),
+			strings.HasPrefix(conn.Protocol, "udp"),
+		}
+		if n, ok := c.h2c.hint(flow); ok {
+			conn.StreamHint, conn.StreamHintSource = n, StreamsH2C
+		}
+		if conn.HasByteCounts {
+			continue
+		}
+		if f := c.flows[flow]; f != nil {
+			conn.TxBytes, conn.RxBytes = f.tx, f.rx
+			conn.HasByteCounts, conn.CapturedBytes = true, true
+		}
+	}
+	for flow, f := range c.flows {
+		if now.Sub(f.seen) > captureFlowTTL {
+			delete(c.flows, flow)
+		}
+	}
+	c.h2c.prune(now)
+}
@@ -0,0 +1,70 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+)
+
+// ethPAll is ETH_P_ALL in network byte order, as AF_PACKET wants it.
+const ethPAll = syscall.ETH_P_ALL<<8&0xff00 | syscall.ETH_P_ALL>>8
+
+// packetSocket reads packets from an AF_PACKET socket on every interface.
+// SOCK_DGRAM strips the link-layer header, so any interface type yields
+// IP packets.
+type packetSocket struct {
+	fd     int
+	closed atomic.Bool
+}
+
+func openPacketSource() (packetSource, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, ethPAll)
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return nil, errors.New("-pcap-accounting needs root or CAP_NET_RAW")
+		}
+		return nil, fmt.Errorf("-pcap-accounting: %v", err)
+	}
+	// Wake up now and then, so close is noticed. The reading goroutine
+	// closes the socket itself, so its descriptor cannot be reused while
+	// it reads.
+	tv := syscall.Timeval{Usec: 500000}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("-pcap-accounting: %v", err)
+	}
+	return &packetSocket{fd: fd}, nil
+}
+
+func (s *packetSocket) read(buf []byte) (n int, outbound, ok bool, err error) {
+	for {
+		if s.closed.Load() {
+			syscall.Close(s.fd)
+			return 0, false, false, errors.New("capture closed")
+		}
+		n, from, err := syscall.Recvfrom(s.fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, false, false, err
+		}
+		ll, isLL := from.(*syscall.SockaddrLinklayer)
+		if !isLL {
+			return n, false, false, nil
+		}
+		switch ll.Pkttype {
+		case syscall.PACKET_OUTGOING:
+			return n, true, true, nil
+		case syscall.PACKET_HOST:
+			return n, false, true, nil
+		}
+		return n, false, false, nil
+	}
+}
+
+func (s *packetSocket) close() error {
+	s.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,213 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ipPacketBytes builds an IPv4 or IPv6 packet carrying a TCP segment
+// (proto 6) or a UDP datagram (17) with payload.
+func ipPacketBytes(proto byte, src, dst netip.AddrPort, payload []byte) []byte {
+	var l4 []byte
+	if proto == 6 {
+		l4 = make([]byte, 20)
+		l4[12] = 5 << 4
+	} else {
+		l4 = make([]byte, 8)
+		binary.BigEndian.PutUint16(l4[4:], uint16(8+len(payload)))
+	}
+	binary.BigEndian.PutUint16(l4[0:], src.Port())
+	binary.BigEndian.PutUint16(l4[2:], dst.Port())
+	l4 = append(l4, payload...)
+	if src.Addr().Is4() {
+		h := make([]byte, 20)
+		h[0] = 0x45
+		binary.BigEndian.PutUint16(h[2:], uint16(20+len(l4)))
+		h[8], h[9] = 64, proto
+		copy(h[12:], src.Addr().AsSlice())
+		copy(h[16:], dst.Addr().AsSlice())
+		return append(h, l4...)
+	}
+	h := make([]byte, 40)
+	h[0] = 0x60
+	binary.BigEndian.PutUint16(h[4:], uint16(len(l4)))
+	h[6], h[7] = proto, 64
+	copy(h[8:], src.Addr().AsSlice())
+	copy(h[24:], dst.Addr().AsSlice())
+	return append(h, l4...)
+}
+
+// withHopByHop inserts an empty IPv6 hop-by-hop options header.
+func withHopByHop(b []byte) []byte {
+	ext := []byte{b[6], 0, 1, 4, 0, 0, 0, 0} // next header, length 0, PadN
+	out := append(append(append([]byte(nil), b[:40]...), ext...), b[40:]...)
+	out[6] = 0
+	binary.BigEndian.PutUint16(out[4:], uint16(len(out)-40))
+	return out
+}
+
+func TestDecodeIPPacket(t *testing.T) {
+	v4a, v4b := netip.MustParseAddrPort("10.0.0.2:53000"), netip.MustParseAddrPort("192.0.2.1:53")
+	v6a, v6b := netip.MustParseAddrPort("[2001:db8::2]:50000"), netip.MustParseAddrPort("[2001:db8::1]:4433")
+	query := readPacket(t, "dns/query.bin")
+
+	fragment := ipPacketBytes(17, v4a, v4b, query)
+	binary.BigEndian.PutUint16(fragment[6:], 185) // offset 1480
+	// A short frame padded to the Ethernet minimum.
+	padded := append(ipPacketBytes(6, v4a, v4b, []byte("hi")), 0, 0, 0, 0)
+	icmp := ipPacketBytes(17, v4a, v4b, nil)
+	icmp[9] = 1
+
+	tests := []struct {
+		name    string
+		b       []byte
+		ok, udp bool
+		payload int
+	}{
+		{"v4 udp", ipPacketBytes(17, v4a, v4b, query), true, true, len(query)},
+		{"v4 tcp", ipPacketBytes(6, v4a, v4b, []byte("GET / HTTP/1.1\r\n")), true, false, 16},
+		{"v4 tcp with padding", padded, true, false, 2},
+		{"v6 udp", ipPacketBytes(17, v6a, v6b, query), true, true, len(query)},
+		{"v6 hop-by-hop", withHopByHop(ipPacketBytes(17, v6a, v6b, query)), true, true, len(query)},
+		{"v4 fragment", fragment, false, false, 0},
+		{"icmp", icmp, false, false, 0},
+		{"short tcp", ipPacketBytes(6, v4a, v4b, nil)[:30], false, false, 0},
+		{"not ip", []byte{0x00, 0x01, 0x02}, false, false, 0},
+	}
+	for _, tt := range tests {
+		p, ok := decodeIPPacket(tt.b)
+		if ok != tt.ok {
+			t.Errorf("%s: ok %v", tt.name, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		src, dst := v4a, v4b
+		if tt.b[0]>>4 == 6 {
+			src, dst = v6a, v6b
+		}
+		if p.udp != tt.udp || p.src != src || p.dst != dst || len(p.payload) != tt.payload {
+			t.Errorf("%s: %+v", tt.name, p)
+		}
+		if want := len(tt.b); tt.name == "v4 tcp with padding" && p.size != want-4 || tt.name != "v4 tcp with padding" && p.size != want {
+			t.Errorf("%s: size %d, want %d", tt.name, p.size, want)
+		}
+		for n := range len(tt.b) {
+			decodeIPPacket(tt.b[:n]) // must not read past the end
+		}
+	}
+}
+
+// fakePackets replays packets, then fails as a closed source does.
+type fakePackets struct {
+	mu      sync.Mutex
+	packets [][]byte
+	out     []bool
+}
+
+func (f *fakePackets) add(b []byte, outbound bool) {
+	f.packets = append(f.packets, b)
+	f.out = append(f.out, outbound)
+}
+
+func (f *fakePackets) read(buf []byte) (int, bool, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.packets) == 0 {
+		return 0, false, false, errors.New("closed")
+	}
+	n := copy(buf, f.packets[0])
+	out := f.out[0]
+	f.packets, f.out = f.packets[1:], f.out[1:]
+	return n, out, true, nil
+}
+
+func (f *fakePackets) close() error { return nil }
+
+// TestPacketCapture replays a QUIC handshake on port 4433 and checks the
+// connection gets the captured byte counts and what the inspection found.
+func TestPacketCapture(t *testing.T) {
+	local, remote := netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("198.51.100.7:4433")
+	client := ipPacketBytes(17, local, remote, readPacket(t, "quic/v1_client_initial.bin"))
+	server := ipPacketBytes(17, remote, local, readPacket(t, "quic/v1_server_flight.bin"))
+	src := &fakePackets{}
+	src.add(client, true)
+	src.add(server, false)
+
+	scanned := &fakeSource{}
+	c := fakeConn("app", "198.51.100.7", 4433)
+	c.Protocol, c.LocalPort = "udp", 50000
+	counted := fakeConn("app", "198.51.100.7", 443)
+	counted.HasByteCounts, counted.TxBytes = true, 7
+	scanned.set(c, counted)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(scanned)
+	tr.startCapture(src)
+	waitFor(t, func() bool {
+		tr.sni.mu.Lock()
+		defer tr.sni.mu.Unlock()
+		e := tr.sni.flows[sniFlow{local, remote, true}]
+		return e != nil && e.name != "" && e.quicVersion != 0
+	})
+	tr.scan()
+	for _, got := range tr.Snapshot() {
+		if got.RemotePort == 443 {
+			if got.TxBytes != 7 || got.CapturedBytes {
+				t.Errorf("counted connection overwritten: %+v", got)
+			}
+			continue
+		}
+		if !got.HasByteCounts || !got.CapturedBytes || got.TxBytes != uint64(len(client)) || got.RxBytes != uint64(len(server)) {
+			t.Errorf("captured bytes: has %v captured %v tx %d rx %d", got.HasByteCounts, got.CapturedBytes, got.TxBytes, got.RxBytes)
+		}
+		if got.Service != ServiceQUIC || got.QUICVersion != "v1" || got.SNI != "quic.test" {
+			t.Errorf("inspection: service %q, version %q, SNI %q", got.Service, got.QUICVersion, got.SNI)
+		}
+	}
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for range 100 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met within a second")
+}
+
+func TestCaptureCount(t *testing.T) {
+	local, remote := netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("192.0.2.1:443")
+	c := &packetCapture{queue: make(chan capturedPacket, 1), flows: make(map[sniFlow]*flowCount)}
+	now := time.Now()
+	for range inspectPackets + 2 {
+		p, _ := decodeIPPacket(ipPacketBytes(6, local, remote, []byte("data")))
+		c.count(p, true, now)
+	}
+	ack, _ := decodeIPPacket(ipPacketBytes(6, remote, local, nil))
+	c.count(ack, false, now)
+
+	f := c.flows[sniFlow{local, remote, false}]
+	if f == nil || f.tx != uint64(10*44) || f.rx != 40 || f.payloads != inspectPackets {
+		t.Fatalf("flow %+v", f)
+	}
+	if len(c.queue) != 1 || c.dropped.Load() != inspectPackets-1 {
+		t.Errorf("%d queued, %d dropped", len(c.queue), c.dropped.Load())
+	}
+
+	c.fill(nil, now.Add(captureFlowTTL))
+	if len(c.flows) != 1 {
+		t.Error("flow dropped before captureFlowTTL")
+	}
+	c.fill(nil, now.Add(captureFlowTTL+time.Second))
+	if len(c.flows) != 0 {
+		t.Error("flow kept past captureFlowTTL")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package tracker
+
+import "errors"
+
+// openPacketSource would need a capture driver such as Npcap on Windows.
+func openPacketSource() (packetSource, error) {
+	return nil, errors.New("-pcap-accounting is only supported on Linux")
+}
@@ -0,0 +1,235 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultChangeScans is how many scans of changes a ChangeJournal keeps
+// when not told otherwise.
+const DefaultChangeScans = 120
+
+// ConnFields is a connection as the top-level fields of its JSON encoding,
+// as /snapshot serves it: field name -> encoded value.
+type ConnFields map[string]json.RawMessage
+
+// Changes is what changed in the connections since a cursor, as served by
+// the agent's /changes endpoint:
+//
+//   - Cursor names the scan the changes lead up to; pass it back to get
+//     the next ones.
+//   - Full is set when the cursor was empty, from another run, or older than
+//     the changes kept: Added then holds every connection and the client
+//     drops what it had.
+//   - Added holds the full record of each connection, by key, that appeared
+//     since the cursor, or that went away and came back.
+//   - Removed lists the keys of the connections that went away. A key can be
+//     one the client never had, when a connection came and went between
+//     two polls.
+//   - Changed holds, by key, only the fields whose value changed, each with
+//     its new value. A field is replaced whole: nested objects are not
+//     diffed further.
+//
+// Apply is the reference for applying it. Records carry no order: the
+// order of /snapshot is not kept.
+type Changes struct {
+	Cursor  string                `json:"cursor"`
+	Full    bool                  `json:"full,omitempty"`
+	Added   map[string]ConnFields `json:"added,omitempty"`
+	Removed []string              `json:"removed,omitempty"`
+	Changed map[string]ConnFields `json:"changed,omitempty"`
+}
+
+// Apply applies c to state, the connections by key as of c's starting
+// cursor, and returns the state as of c.Cursor. state may be nil.
+func (c Changes) Apply(state map[string]ConnFields) map[string]ConnFields {
+	if c.Full || state == nil {
+		state = make(map[string]ConnFields, len(c.Added))
+	}
+	for _, key := range c.Removed {
+		delete(state, key)
+	}
+	for key, f := range c.Added {
+		state[key] = maps.Clone(f)
+	}
+	for key, f := range c.Changed {
+		if cur, ok := state[key]; ok {
+			maps.Copy(cur, f)
+		}
+	}
+	return state
+}
+
+// scanChanges is what one scan changed.
+type scanChanges struct {
+	seq     uint64
+	added   map[string]ConnFields
+	removed []string
+	changed map[string]ConnFields
+}
+
+// ChangeJournal keeps the changes of the last scans so a client can poll
+// for what changed since the scan it has, instead of a full snapshot. It
+// compares each scan's connections with the previous scan's field by field,
+// on their JSON encoding. It is safe for concurrent use.
+type ChangeJournal struct {
+	mu   sync.Mutex
+	run  string // tells this run's cursors from another's
+	seq  uint64 // the last scan recorded
+	cur  map[string]ConnFields
+	sets []scanChanges // oldest first
+	size int
+}
+
+// NewChangeJournal returns a journal keeping the changes of the last scans
+// scans (DefaultChangeScans when 0).
+func NewChangeJournal(scans int) *ChangeJournal {
+	if scans <= 0 {
+		scans = DefaultChangeScans
+	}
+	return &ChangeJournal{
+		run:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		cur:  make(map[string]ConnFields),
+		size: scans,
+	}
+}
+
+// Record adds a scan's connections to the journal.
+func (j *ChangeJournal) Record(conns []*Connection) {
+	next := make(map[string]ConnFields, len(conns))
+	for _, c := range conns {
+		f, err := encodeFields(c)
+		if err != nil {
+			continue
+		}
+		next[c.Key()] = f
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq++
+	set := scanChanges{seq: j.seq, added: make(map[string]ConnFields), changed: make(map[string]ConnFields)}
+	for key, f := range next {
+		old, ok := j.cur[key]
+		if !ok {
+			set.added[key] = f
+			continue
+		}
+		var diff ConnFields
+		for name, v := range f {
+			if !bytes.Equal(old[name], v) {
+				if diff == nil {
+					diff = make(ConnFields)
+				}
+				diff[name] = v
+			}
+		}
+		if diff != nil {
+			set.changed[key] = diff
+		}
+	}
+	for key := range j.cur {
+		if _, ok := next[key]; !ok {
+			set.removed = append(set.removed, key)
+		}
+	}
+	j.cur = next
+	j.sets = append(j.sets, set)
+	if len(j.sets) > j.size {
+		j.sets = append(j.sets[:0:0], j.sets[len(j.sets)-j.size:]...)
+	}
+}
+
+// encodeFields encodes c as the top-level fields of its JSON encoding.
+func encodeFields(c *Connection) (ConnFields, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var f ConnFields
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
+
+// Since returns the changes after cursor, folded into one set, or every
+// connection when the changes after cursor are no longer all kept.
+func (j *ChangeJournal) Since(cursor string) Changes {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := Changes{Cursor: j.run + "." + strconv.FormatUint(j.seq, 10)}
+	since, ok := j.parseCursor(cursor)
+	if !ok || since > j.seq || (len(j.sets) > 0 && since < j.sets[0].seq-1) {
+		out.Full = true
+		out.Added = make(map[string]ConnFields, len(j.cur))
+		for key, f := range j.cur {
+			out.Added[key] = maps.Clone(f)
+		}
+		return out
+	}
+
+	added := make(map[string]ConnFields)
+	removed := make(map[string]bool)
+	changed := make(map[string]ConnFields)
+	for _, set := range j.sets {
+		if set.seq <= since {
+			continue
+		}
+		for _, key := range set.removed {
+			delete(added, key)
+			delete(changed, key)
+			removed[key] = true
+		}
+		for key, f := range set.added {
+			// Added replaces whatever the client has under the key, so a
+			// connection that went away and came back needs no removal.
+			delete(removed, key)
+			delete(changed, key)
+			added[key] = maps.Clone(f)
+		}
+		for key, f := range set.changed {
+			if a, ok := added[key]; ok {
+				maps.Copy(a, f)
+				continue
+			}
+			if changed[key] == nil {
+				changed[key] = make(ConnFields, len(f))
+			}
+			maps.Copy(changed[key], f)
+		}
+	}
+	if len(added) > 0 {
+		out.Added = added
+	}
+	out.Removed = slices.Sorted(maps.Keys(removed))
+	if len(changed) > 0 {
+		out.Changed = changed
+	}
+	return out
+}
+
+// parseCursor returns the scan a cursor of this run names.
+func (j *ChangeJournal) parseCursor(cursor string) (uint64, bool) {
+	run, seq, ok := strings.Cut(cursor, ".")
+	if !ok || run != j.run {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// SetChangeJournal keeps the changes of every scan in j, for clients that
+// poll for what changed (see ChangeJournal). Must be called before Start.
+func (t *Tracker) SetChangeJournal(j *ChangeJournal) {
+	t.journal = j
+}
+
+// ChangeJournal returns the journal set with SetChangeJournal, or nil.
+func (t *Tracker) ChangeJournal() *ChangeJournal {
+	return t.journal
+}
@@ -0,0 +1,229 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// connState is what a client polling /changes should hold for conns.
+func connState(t *testing.T, conns []*Connection) map[string]ConnFields {
+	t.Helper()
+	out := make(map[string]ConnFields, len(conns))
+	for _, c := range conns {
+		f, err := encodeFields(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[c.Key()] = f
+	}
+	return out
+}
+
+// sameState reports the first difference between two client states, ""
+// when they are equal. Values are compared as encoded.
+func sameState(got, want map[string]ConnFields) string {
+	for _, key := range slices.Sorted(maps.Keys(want)) {
+		g, ok := got[key]
+		if !ok {
+			return "missing " + key
+		}
+		for name, v := range want[key] {
+			if string(g[name]) != string(v) {
+				return fmt.Sprintf("%s: %s is %s, want %s", key, name, g[name], v)
+			}
+		}
+		if len(g) != len(want[key]) {
+			return fmt.Sprintf("%s: %d fields, want %d", key, len(g), len(want[key]))
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			return "extra " + key
+		}
+	}
+	return ""
+}
+
+// roundTrip sends the changes through JSON, as a client receives them.
+func roundTrip(t *testing.T, c Changes) Changes {
+	t.Helper()
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Changes
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// TestChangesReplay polls a journal over random scans, at random intervals,
+// and checks that applying each answer to the state the client had gives
+// the current connections exactly.
+func TestChangesReplay(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	pool := make([]Connection, 12)
+	for i := range pool {
+		pool[i] = fakeConn(fmt.Sprintf("app%d", i%4), fmt.Sprintf("192.0.2.%d", 1+i), 443)
+	}
+	live := map[int]*Connection{}
+	scan := func() []*Connection {
+		for i := range pool {
+			switch r := rng.IntN(10); {
+			case r == 0 && live[i] != nil:
+				delete(live, i)
+			case r == 1 && live[i] == nil:
+				c := pool[i]
+				live[i] = &c
+			case r < 5 && live[i] != nil:
+				c := *live[i] // a changed copy, as a scan makes
+				c.Ping = time.Duration(rng.IntN(100)) * time.Millisecond
+				c.TxBytes += uint64(rng.IntN(5000))
+				if rng.IntN(3) == 0 {
+					c.State = StateCloseWait
+				}
+				if rng.IntN(3) == 0 {
+					c.SockMemInfo = nil
+				} else {
+					c.setSockMem(&SockMemInfo{RmemAlloc: uint64(rng.IntN(4096)), WmemQueued: 1})
+				}
+				live[i] = &c
+			}
+		}
+		var conns []*Connection
+		for _, i := range slices.Sorted(maps.Keys(live)) {
+			conns = append(conns, live[i])
+		}
+		return conns
+	}
+
+	j := NewChangeJournal(20)
+	type client struct {
+		cursor string
+		state  map[string]ConnFields
+	}
+	clients := make([]client, 4)
+	every := []int{1, 3, 7, 25} // the last one falls behind the journal
+	fulls := 0
+	for n := 1; n <= 300; n++ {
+		conns := scan()
+		j.Record(conns)
+		for i := range clients {
+			if n%every[i] != 0 {
+				continue
+			}
+			c := &clients[i]
+			ch := roundTrip(t, j.Since(c.cursor))
+			if ch.Full {
+				fulls++
+			}
+			c.state, c.cursor = ch.Apply(c.state), ch.Cursor
+			if diff := sameState(c.state, connState(t, conns)); diff != "" {
+				t.Fatalf("scan %d, client polling every %d scans: %s", n, every[i], diff)
+			}
+		}
+	}
+	// The first poll of each client, and every poll of the one further
+	// behind than the journal reaches.
+	if want := 4 + 300/25 - 1; fulls != want {
+		t.Errorf("%d full answers, want %d", fulls, want)
+	}
+}
+
+func TestChangesReAdded(t *testing.T) {
+	j := NewChangeJournal(10)
+	a, b := fakeConn("game", "203.0.113.5", 27015), fakeConn("browser", "192.0.2.1", 443)
+	j.Record([]*Connection{&a, &b})
+	first := j.Since("")
+	state := first.Apply(nil)
+
+	// a goes away and comes back changed, b changes, c comes and goes, all
+	// between two polls.
+	c := fakeConn("curl", "198.51.100.7", 80)
+	j.Record([]*Connection{&b, &c})
+	a2, b2 := a, b
+	a2.Ping, b2.Ping = 40*time.Millisecond, 7*time.Millisecond
+	j.Record([]*Connection{&a2, &b2})
+
+	ch := j.Since(first.Cursor)
+	if ch.Full {
+		t.Fatal("full answer for a kept cursor")
+	}
+	if keys := slices.Sorted(maps.Keys(ch.Added)); !slices.Equal(keys, []string{a.Key()}) {
+		t.Errorf("added %q", keys)
+	}
+	if !slices.Equal(ch.Removed, []string{c.Key()}) {
+		t.Errorf("removed %q, want only the connection the client never had", ch.Removed)
+	}
+	if got := ch.Changed[b.Key()]; len(got) != 1 || string(got["Ping"]) != "7000000" {
+		t.Errorf("changed %v, want only the ping", got)
+	}
+	state = ch.Apply(state)
+	if diff := sameState(state, connState(t, []*Connection{&a2, &b2})); diff != "" {
+		t.Error(diff)
+	}
+
+	// Nothing new: an empty answer with the same cursor.
+	again := j.Since(ch.Cursor)
+	if again.Cursor != ch.Cursor || again.Full || again.Added != nil || again.Removed != nil || again.Changed != nil {
+		t.Errorf("no scan since: %+v", again)
+	}
+}
+
+func TestChangesCursors(t *testing.T) {
+	j := NewChangeJournal(3)
+	a := fakeConn("game", "203.0.113.5", 27015)
+	for range 5 {
+		j.Record([]*Connection{&a})
+	}
+	cur := j.Since("").Cursor
+	run := j.run
+	tests := []struct {
+		cursor string
+		full   bool
+	}{
+		{"", true},
+		{"garbage", true},
+		{"otherrun.5", true}, // from an earlier run of the agent
+		{run + ".x", true},
+		{run + ".9", true}, // ahead of the journal
+		{run + ".1", true}, // scans 2-5 are needed, 3-5 kept
+		{run + ".2", false},
+		{run + ".4", false},
+		{cur, false},
+	}
+	for _, tt := range tests {
+		ch := j.Since(tt.cursor)
+		if ch.Full != tt.full || ch.Cursor != cur {
+			t.Errorf("%q: full %v, cursor %q", tt.cursor, ch.Full, ch.Cursor)
+		}
+		if tt.full && len(ch.Added) != 1 {
+			t.Errorf("%q: full answer with %d connections", tt.cursor, len(ch.Added))
+		}
+	}
+	if len(j.sets) != 3 {
+		t.Errorf("%d scans kept", len(j.sets))
+	}
+}
+
+// TestChangesApplyFull checks that a full answer replaces what the client
+// had, and that Apply does not share maps with the answer.
+func TestChangesApplyFull(t *testing.T) {
+	stale := map[string]ConnFields{"gone": {"AppName": json.RawMessage(`"old"`)}}
+	ch := Changes{Full: true, Added: map[string]ConnFields{"k": {"AppName": json.RawMessage(`"new"`)}}}
+	state := ch.Apply(stale)
+	if want := map[string]ConnFields{"k": {"AppName": json.RawMessage(`"new"`)}}; !reflect.DeepEqual(state, want) {
+		t.Errorf("state %v", state)
+	}
+	Changes{Changed: map[string]ConnFields{"k": {"AppName": json.RawMessage(`"changed"`)}}}.Apply(state)
+	if string(ch.Added["k"]["AppName"]) != `"new"` {
+		t.Error("applying a change altered an earlier answer")
+	}
+}
@@ -0,0 +1,123 @@
+package tracker
+
+import "time"
+
+const (
+	// minClockJump is the smallest gap or step reported: a scan a few
+	// seconds late is a busy machine, not a suspend.
+	minClockJump = 10 * time.Second
+
+	// maxClockEvents bounds the session's clock event log.
+	maxClockEvents = 100
+)
+
+// ClockJumpKind tells a suspend from the wall clock being set.
+type ClockJumpKind int
+
+const (
+	// ClockResumed is a gap between scans far longer than the interval:
+	// the machine was suspended, or the process stopped, or the wall
+	// clock was set forward.
+	ClockResumed ClockJumpKind = iota
+	// ClockStepped is the wall clock set backwards.
+	ClockStepped
+)
+
+// ClockEvent is a suspend/resume or a clock step seen between two scans.
+type ClockEvent struct {
+	Time time.Time // the first scan after it
+	Kind ClockJumpKind
+	Gap  time.Duration // the time the scans missed; negative for a step back
+}
+
+// detectClockJump compares the end of the previous cycle with the start of
+// this one. The monotonic clock catches a suspend on Windows and a stopped
+// process; on Linux it stands still during suspend, so the wall clock,
+// which does not, is checked too and shows the time asleep. A wall clock
+// moving against the monotonic one is a clock step. Times without a
+// monotonic reading (a fake clock) are compared by wall clock alone.
+func detectClockJump(prevEnd, start time.Time, interval time.Duration) (ClockEvent, bool) {
+	if prevEnd.IsZero() {
+		return ClockEvent{}, false
+	}
+	idle := start.Sub(prevEnd)
+	wall := start.Round(0).Sub(prevEnd.Round(0))
+	late := interval + max(interval, minClockJump)
+	switch {
+	case wall < 0 && -wall >= minClockJump:
+		return ClockEvent{Time: start, Kind: ClockStepped, Gap: wall}, true
+	case idle > late:
+		return ClockEvent{Time: start, Kind: ClockResumed, Gap: max(idle, wall) - interval}, true
+	case wall > late && wall-idle >= minClockJump:
+		return ClockEvent{Time: start, Kind: ClockResumed, Gap: wall - interval}, true
+	}
+	return ClockEvent{}, false
+}
+
+// SetClock replaces time.Now as the scan loop's clock, for driving the
+// tracker through suspends and clock steps. Must be called before Start.
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.clock = now
+}
+
+// now reads the tracker's clock.
+func (t *Tracker) now() time.Time {
+	if t.clock != nil {
+		return t.clock()
+	}
+	return time.Now()
+}
+
+// checkClock looks for a suspend or clock step since the last cycle and
+// logs it. Called at the start of each scan; the returned event, if any,
+// applies to that scan.
+func (t *Tracker) checkClock(start time.Time) (ClockEvent, bool) {
+	interval := max(t.lastInterval, t.Interval())
+	e, ok := detectClockJump(t.lastCycleEnd, start, interval)
+	if !ok {
+		return e, false
+	}
+	t.mu.Lock()
+	kind := "resumed"
+	if e.Kind == ClockStepped {
+		kind = "stepped_back"
+	}
+	t.emit(start, SeverityWarn, EventClockJump, "kind", kind, "gap", e.Gap.Round(time.Second).String())
+	t.clockLog = append(t.clockLog, e)
+	if over := len(t.clockLog) - maxClockEvents; over > 0 {
+		t.clockLog = append([]ClockEvent(nil), t.clockLog[over:]...)
+	}
+	t.mu.Unlock()
+	return e, true
+}
+
+// endCycle records when a cycle ended and the interval it ran at, for the
+// next checkClock.
+func (t *Tracker) endCycle() {
+	t.lastCycleEnd = t.now()
+	t.lastInterval = t.Interval()
+}
+
+// bridgeGap makes the histories of the connections and probed hosts start
+// over after a suspend or clock step, so no rate, trend or outlier check
+// spans it: byte counts restart from this scan, loss windows and RTT
+// baselines are emptied. Caller must hold the lock.
+func (t *Tracker) bridgeGap() {
+	for _, c := range t.connections {
+		c.prevTime = time.Time{}
+		c.TxRate, c.RxRate = 0, 0
+		c.lossSamples = nil
+		c.LossTrend = LossTrend{Direction: TrendStable}
+	}
+	for _, s := range t.samples {
+		s.accepted, s.pending, s.warmedUp = nil, nil, false
+	}
+}
+
+// ClockEvents returns this session's suspends and clock steps, oldest
+// first.
+func (t *Tracker) ClockEvents() []ClockEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]ClockEvent(nil), t.clockLog...)
+}
@@ -0,0 +1,130 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectClockJump(t *testing.T) {
+	prev := time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		start time.Time
+		kind  ClockJumpKind
+		gap   time.Duration
+		ok    bool
+	}{
+		{"on time", prev.Add(2 * time.Second), 0, 0, false},
+		{"a busy machine", prev.Add(12 * time.Second), 0, 0, false},
+		{"just past late", prev.Add(13 * time.Second), ClockResumed, 11 * time.Second, true},
+		{"suspended", prev.Add(2 * time.Hour), ClockResumed, 2*time.Hour - 2*time.Second, true},
+		{"small step back", prev.Add(-5 * time.Second), 0, 0, false},
+		{"set back", prev.Add(-time.Hour), ClockStepped, -time.Hour, true},
+	}
+	for _, tt := range tests {
+		e, ok := detectClockJump(prev, tt.start, 2*time.Second)
+		if ok != tt.ok || ok && (e.Kind != tt.kind || e.Gap != tt.gap || !e.Time.Equal(tt.start)) {
+			t.Errorf("%s: %+v %v", tt.name, e, ok)
+		}
+	}
+	if _, ok := detectClockJump(time.Time{}, prev, time.Second); ok {
+		t.Error("jump before the first cycle")
+	}
+	// A long interval is not a gap: late is twice the interval.
+	if _, ok := detectClockJump(prev, prev.Add(3*time.Minute), 2*time.Minute); ok {
+		t.Error("jump within twice a long interval")
+	}
+
+	// With monotonic readings, a process stopped for a while.
+	mono := time.Now()
+	if e, ok := detectClockJump(mono, mono.Add(time.Hour), time.Second); !ok || e.Kind != ClockResumed || e.Gap != time.Hour-time.Second {
+		t.Errorf("monotonic gap: %+v %v", e, ok)
+	}
+	if _, ok := detectClockJump(mono, mono.Add(time.Second), time.Second); ok {
+		t.Error("monotonic: jump on time")
+	}
+}
+
+// TestClockJumpScan drives the scan loop through a suspend and a clock
+// step on a fake clock: the scan after each reports no rate rather than a
+// wrong one, the next is right again, and the gap is logged and marked.
+func TestClockJumpScan(t *testing.T) {
+	now := time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC)
+	src := &fakeSource{}
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetClock(func() time.Time { return now })
+
+	var sent uint64
+	scan := func(advance time.Duration) *Connection {
+		t.Helper()
+		now = now.Add(advance)
+		sent += 1000 // 1000 bytes a scan whatever the clock says
+		c := fakeConn("app", "192.0.2.1", 443)
+		c.HasByteCounts, c.TxBytes = true, sent
+		src.set(c)
+		tr.scan()
+		return tr.Snapshot()[0]
+	}
+	scan(0)
+	for i := 0; i < 3; i++ {
+		if c := scan(time.Second); c.TxRate != 1000 {
+			t.Fatalf("scan %d: rate %v", i, c.TxRate)
+		}
+	}
+	tr.mu.Lock()
+	for _, c := range tr.connections {
+		c.lossSamples = []lossSample{{at: now, loss: 50}}
+	}
+	tr.samples = map[string]*rttSamples{"192.0.2.1": {accepted: []time.Duration{time.Millisecond}, warmedUp: true, lastSeen: now}}
+	tr.mu.Unlock()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		rate    float64
+	}{
+		{"resumed", 3 * time.Minute, 0},
+		{"after resume", time.Second, 1000},
+		{"set back", -time.Hour, 0},
+		{"after the step", time.Second, 1000},
+		{"on time", time.Second, 1000},
+	}
+	for _, s := range steps {
+		if c := scan(s.advance); c.TxRate != s.rate {
+			t.Errorf("%s: rate %v, want %v", s.name, c.TxRate, s.rate)
+		}
+	}
+
+	events := tr.ClockEvents()
+	if len(events) != 2 ||
+		events[0].Kind != ClockResumed || events[0].Gap != 3*time.Minute-time.Second ||
+		events[1].Kind != ClockStepped || events[1].Gap != -time.Hour {
+		t.Errorf("events %+v", events)
+	}
+	tr.mu.RLock()
+	for _, c := range tr.connections {
+		if c.lossSamples != nil && c.lossSamples[0].loss == 50 {
+			t.Error("loss samples kept across the gap")
+		}
+	}
+	if s := tr.samples["192.0.2.1"]; s.warmedUp || len(s.accepted) != 0 {
+		t.Errorf("RTT history kept across the gap: %+v", s)
+	}
+	tr.mu.RUnlock()
+
+	// The scan stats mark the gaps, and the effective interval starts
+	// after the last one.
+	var gaps []time.Duration
+	for _, st := range tr.PerfStats() {
+		if st.Gap != 0 {
+			gaps = append(gaps, st.Gap)
+		}
+	}
+	if len(gaps) != 2 || gaps[0] != events[0].Gap || gaps[1] != events[1].Gap {
+		t.Errorf("gap markers %v", gaps)
+	}
+	if h := tr.Health(); h.EffectiveInterval != time.Second {
+		t.Errorf("effective interval %v", h.EffectiveInterval)
+	}
+}
@@ -0,0 +1,197 @@
+package tracker
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// closingRateWindow is how far back entries into a closing state are
+// counted for ClosingRates.
+const closingRateWindow = time.Minute
+
+// Closing reports whether s is one of the states a socket passes through
+// after its owner is done with it (TIME_WAIT, FIN_WAIT2, LAST_ACK). A busy
+// server holds thousands of them; CLOSE_WAIT is not one, as it waits on
+// the app and is worth seeing socket by socket.
+func (s ConnState) Closing() bool {
+	return s == StateTimeWait || s == StateFinWait2 || s == StateLastAck
+}
+
+// ClosingBy selects what CollapseClosing summarizes closing sockets by.
+type ClosingBy int
+
+const (
+	ClosingByApp  ClosingBy = iota
+	ClosingByPort           // local port: a server's listening port, for its inbound connections
+)
+
+// closingKey is what c is counted under in by's summaries and rates.
+func closingKey(c *Connection, by ClosingBy) string {
+	if by == ClosingByPort {
+		return strconv.Itoa(c.LocalPort)
+	}
+	return c.AppName
+}
+
+// ClosingSummary stands for the closing sockets sharing an app or local
+// port on one host and origin. It is carried by a synthetic connection
+// (see CollapseClosing).
+type ClosingSummary struct {
+	By        ClosingBy
+	Key       string // the app name or local port
+	Count     int
+	States    map[ConnState]int
+	Apps      []string // distinct app names, sorted; one for ClosingByApp
+	PerMinute float64  // sockets entering a closing state per minute; local sockets only
+	HasRate   bool
+}
+
+// closingScan is one scan's entries into a closing state by app and by
+// local port.
+type closingScan struct {
+	at     time.Time
+	byApp  map[string]int
+	byPort map[string]int
+}
+
+// noteClosing counts the sockets of this scan that entered a closing
+// state: new ones found in one after the first scan, and known ones that
+// moved into one. Caller must hold the lock.
+func (t *Tracker) noteClosing(entered []*Connection, now time.Time) {
+	if t.closingFrom.IsZero() {
+		t.closingFrom = now
+	}
+	keep := t.closingLog[:0]
+	for _, s := range t.closingLog {
+		if now.Sub(s.at) < closingRateWindow {
+			keep = append(keep, s)
+		}
+	}
+	t.closingLog = keep
+	if len(entered) == 0 {
+		return
+	}
+	s := closingScan{at: now, byApp: make(map[string]int), byPort: make(map[string]int)}
+	for _, c := range entered {
+		s.byApp[closingKey(c, ClosingByApp)]++
+		s.byPort[closingKey(c, ClosingByPort)]++
+	}
+	t.closingLog = append(t.closingLog, s)
+}
+
+// closingOwners maps the address 4-tuples of the connections closed since
+// the last scan to their app, so the ownerless TIME_WAIT socket a closed
+// connection leaves behind can be put under its app. Caller must hold the
+// lock.
+func (t *Tracker) closingOwners(now time.Time) map[string]string {
+	owners := make(map[string]string)
+	for _, c := range t.closed {
+		if c.ClosedAt.Equal(now) && c.PID != 0 {
+			owners[tupleKey(c)] = c.AppName
+		}
+	}
+	return owners
+}
+
+func tupleKey(c *Connection) string {
+	return baseProtocol(c.Protocol) + "|" + c.LocalAddr + ":" + strconv.Itoa(c.LocalPort) +
+		"|" + c.RemoteAddr + ":" + strconv.Itoa(c.RemotePort)
+}
+
+// ClosingRates returns how many local sockets entered a closing state per
+// minute over the last minute, by app name or local port as by selects.
+// Until the tracker has run a minute the rate is over the time it has.
+func (t *Tracker) ClosingRates(by ClosingBy) map[string]float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closingFrom.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	span := min(closingRateWindow, now.Sub(t.closingFrom))
+	rates := make(map[string]float64)
+	if span <= 0 {
+		return rates
+	}
+	for _, s := range t.closingLog {
+		if now.Sub(s.at) >= closingRateWindow {
+			continue
+		}
+		counts := s.byApp
+		if by == ClosingByPort {
+			counts = s.byPort
+		}
+		for k, n := range counts {
+			rates[k] += float64(n)
+		}
+	}
+	for k := range rates {
+		rates[k] /= span.Minutes()
+	}
+	return rates
+}
+
+// CollapseClosing replaces the sockets in a closing state with one
+// synthetic connection per host, origin and app or local port, carrying a
+// ClosingSummary; the others keep their order. rates, from ClosingRates,
+// fills in the local summaries' PerMinute. closing is the number of
+// sockets collapsed.
+func CollapseClosing(conns []*Connection, by ClosingBy, rates map[string]float64) (out []*Connection, closing int) {
+	out = make([]*Connection, 0, len(conns))
+	index := make(map[string]*Connection)
+	var summaries []*Connection
+	for _, c := range conns {
+		if !c.State.Closing() || c.Closing != nil {
+			out = append(out, c)
+			continue
+		}
+		closing++
+		key := closingKey(c, by)
+		id := c.Host + "|" + string(c.Origin) + "|" + key
+		s, ok := index[id]
+		if !ok {
+			s = &Connection{
+				Host:   c.Host,
+				Origin: c.Origin,
+				State:  c.State,
+				Closing: &ClosingSummary{
+					By:     by,
+					Key:    key,
+					States: make(map[ConnState]int),
+				},
+			}
+			if by == ClosingByPort {
+				s.LocalPort = c.LocalPort
+			}
+			if c.Host == "" && rates != nil {
+				s.Closing.PerMinute, s.Closing.HasRate = rates[key], true
+			}
+			index[id] = s
+			summaries = append(summaries, s)
+		}
+		sum := s.Closing
+		sum.Count++
+		sum.States[c.State]++
+		if !slices.Contains(sum.Apps, c.AppName) {
+			sum.Apps = append(sum.Apps, c.AppName)
+		}
+	}
+	for _, s := range summaries {
+		sum := s.Closing
+		sort.Strings(sum.Apps)
+		// The row shows the state most of its sockets are in.
+		for st, n := range sum.States {
+			if n > sum.States[s.State] || n == sum.States[s.State] && st < s.State {
+				s.State = st
+			}
+		}
+		s.AppName = sum.Apps[0]
+		if len(sum.Apps) > 1 {
+			s.AppName = strconv.Itoa(len(sum.Apps)) + " apps"
+		}
+		out = append(out, s)
+	}
+	return out, closing
+}
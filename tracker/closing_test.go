@@ -0,0 +1,170 @@
+package tracker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func closingConn(app string, pid, local int, remote string, state ConnState) *Connection {
+	return &Connection{AppName: app, PID: pid, Protocol: "tcp", State: state, Direction: Inbound,
+		LocalAddr: "10.0.0.2", LocalPort: local, RemoteAddr: remote, RemotePort: 50000}
+}
+
+func TestCollapseClosing(t *testing.T) {
+	conns := []*Connection{
+		closingConn("nginx", 10, 443, "192.0.2.1", StateEstablished),
+		closingConn("nginx", 10, 443, "192.0.2.2", StateTimeWait),
+		closingConn("nginx", 10, 443, "192.0.2.3", StateTimeWait),
+		closingConn("nginx", 10, 80, "192.0.2.4", StateFinWait2),
+		closingConn("sshd", 20, 22, "192.0.2.5", StateCloseWait), // waits on the app: kept
+		closingConn("sshd", 20, 22, "192.0.2.6", StateLastAck),
+		closingConn("haproxy", 30, 443, "192.0.2.7", StateTimeWait),
+	}
+	remote := closingConn("nginx", 10, 443, "192.0.2.8", StateTimeWait)
+	remote.Host = "edge-1"
+	conns = append(conns, remote)
+	rates := map[string]float64{"nginx": 12, "443": 30}
+
+	out, closing := CollapseClosing(conns, ClosingByApp, rates)
+	if closing != 6 {
+		t.Errorf("%d closing, want 6", closing)
+	}
+	got := summaries(out)
+	want := []string{
+		"nginx ESTABLISHED", "sshd CLOSE_WAIT",
+		"nginx: 3 TIME_WAIT (FIN_WAIT2:1 TIME_WAIT:2) nginx 12/min",
+		"sshd: 1 LAST_ACK (LAST_ACK:1) sshd 0/min",
+		"haproxy: 1 TIME_WAIT (TIME_WAIT:1) haproxy 0/min",
+		"edge-1 nginx: 1 TIME_WAIT (TIME_WAIT:1) nginx",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("by app:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	out, _ = CollapseClosing(conns, ClosingByPort, rates)
+	got = summaries(out)
+	want = []string{
+		"nginx ESTABLISHED", "sshd CLOSE_WAIT",
+		"2 apps: 3 TIME_WAIT (TIME_WAIT:3) haproxy,nginx 30/min",
+		"nginx: 1 FIN_WAIT2 (FIN_WAIT2:1) nginx 0/min",
+		"sshd: 1 LAST_ACK (LAST_ACK:1) sshd 0/min",
+		"edge-1 nginx: 1 TIME_WAIT (TIME_WAIT:1) nginx",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("by port:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if out[2].LocalPort != 443 || out[2].Closing.Key != "443" || out[2].Key() == out[5].Key() {
+		t.Errorf("port summary %+v", out[2])
+	}
+
+	// Without rates no summary claims one; collapsing twice changes nothing.
+	out, _ = CollapseClosing(conns, ClosingByApp, nil)
+	again, closing := CollapseClosing(out, ClosingByApp, nil)
+	if closing != 0 || len(again) != len(out) || out[2].Closing.HasRate {
+		t.Errorf("collapsed again: %d closing, %d rows", closing, len(again))
+	}
+}
+
+// summaries describes rows for TestCollapseClosing: connections by app
+// and state, summary rows by count, states, apps and rate.
+func summaries(conns []*Connection) []string {
+	var out []string
+	for _, c := range conns {
+		s := c.AppName + " " + string(c.State)
+		if sum := c.Closing; sum != nil {
+			var states []string
+			for _, st := range []ConnState{StateFinWait2, StateLastAck, StateTimeWait} {
+				if n := sum.States[st]; n > 0 {
+					states = append(states, string(st)+":"+itoa(n))
+				}
+			}
+			s = c.AppName + ": " + itoa(sum.Count) + " " + string(c.State) +
+				" (" + strings.Join(states, " ") + ") " + strings.Join(sum.Apps, ",")
+			if sum.HasRate {
+				s += " " + itoa(int(sum.PerMinute)) + "/min"
+			}
+		}
+		if c.Host != "" {
+			s = c.Host + " " + s
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// TestClosingRates scans sockets into closing states and checks the
+// per-minute rates by app and port, and the owner of ownerless TIME_WAIT.
+func TestClosingRates(t *testing.T) {
+	src := &fakeSource{}
+	web := fakeConn("web", "192.0.2.1", 443)
+	old := fakeConn("web", "192.0.2.2", 443)
+	old.State = StateTimeWait
+	src.set(web, old)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan() // sockets already closing at the first scan are not entries
+
+	fin := web
+	fin.State = StateFinWait2
+	left := fakeConn("curl", "192.0.2.3", 80)
+	left.PID, left.AppName, left.State = 0, "", StateTimeWait // a connection closed before this scan
+	src.set(fin, old, left)
+	tr.scan()
+
+	tr.mu.Lock()
+	tr.closingFrom = time.Now().Add(-2 * time.Minute)
+	tr.mu.Unlock()
+	if got := tr.ClosingRates(ClosingByApp); len(got) != 2 || got["web"] != 1 || got[""] != 1 {
+		t.Errorf("by app: %v", got)
+	}
+	if got := tr.ClosingRates(ClosingByPort); len(got) != 2 || got["40443"] != 1 || got["40080"] != 1 {
+		t.Errorf("by port: %v", got)
+	}
+
+	// Half a minute in, the rate is over the half minute.
+	tr.mu.Lock()
+	tr.closingFrom = time.Now().Add(-30 * time.Second)
+	tr.mu.Unlock()
+	if got := tr.ClosingRates(ClosingByApp)["web"]; got < 1.9 || got > 2.1 {
+		t.Errorf("rate after 30s: %v", got)
+	}
+
+	// Entries older than a minute no longer count.
+	tr.mu.Lock()
+	for i := range tr.closingLog {
+		tr.closingLog[i].at = tr.closingLog[i].at.Add(-closingRateWindow)
+	}
+	tr.closingFrom = time.Now().Add(-2 * time.Minute)
+	tr.mu.Unlock()
+	if got := tr.ClosingRates(ClosingByApp); len(got) != 0 {
+		t.Errorf("after a minute: %v", got)
+	}
+}
+
+// TestClosingOwner checks the ownerless TIME_WAIT socket a connection
+// leaves when it closes stays under the connection's app.
+func TestClosingOwner(t *testing.T) {
+	src := &fakeSource{}
+	c := fakeConn("curl", "192.0.2.1", 443)
+	src.set(c)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+
+	tw := c
+	tw.PID, tw.AppName, tw.State = 0, "", StateTimeWait
+	other := fakeConn("", "192.0.2.9", 443)
+	other.PID, other.State = 0, StateTimeWait
+	src.set(tw, other)
+	tr.scan()
+	apps := map[string]string{}
+	for _, c := range tr.Snapshot() {
+		if c.State == StateTimeWait {
+			apps[c.RemoteAddr] = c.AppName
+		}
+	}
+	if apps["192.0.2.1"] != "curl" || apps["192.0.2.9"] != "" {
+		t.Errorf("TIME_WAIT owners %v", apps)
+	}
+}
@@ -0,0 +1,167 @@
+package tracker
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Reference is a snapshot pinned as a point to compare later snapshots
+// against. Its connections are stripped copies holding only what a
+// comparison shows, so keeping a few references costs little memory.
+type Reference struct {
+	Name  string
+	Time  time.Time
+	Conns []*Connection
+}
+
+// NewReference pins snap under name.
+func NewReference(name string, at time.Time, snap []*Connection) Reference {
+	conns := make([]*Connection, len(snap))
+	for i, c := range snap {
+		conns[i] = &Connection{
+			Host:       c.Host,
+			Namespace:  c.Namespace,
+			PID:        c.PID,
+			AppName:    c.AppName,
+			Protocol:   c.Protocol,
+			Direction:  c.Direction,
+			LocalAddr:  c.LocalAddr,
+			LocalPort:  c.LocalPort,
+			RemoteAddr: c.RemoteAddr,
+			RemotePort: c.RemotePort,
+			State:      c.State,
+			Ping:       c.Ping,
+			Loss:       c.Loss,
+			PingCount:  c.PingCount,
+			TxRate:     c.TxRate,
+			RxRate:     c.RxRate,
+			TxBytes:    c.TxBytes,
+			RxBytes:    c.RxBytes,
+
+			HasByteCounts: c.HasByteCounts,
+		}
+	}
+	return Reference{Name: name, Time: at, Conns: conns}
+}
+
+// ConnDelta is how one connection present in both snapshots changed.
+type ConnDelta struct {
+	Old, New *Connection
+	Linked   bool // New is a replacement socket continuing Old's flow
+
+	Ping             time.Duration // New.Ping - Old.Ping; 0 unless both were probed
+	TxRate, RxRate   float64       // bytes/sec
+	TxBytes, RxBytes int64         // bytes moved since the reference
+}
+
+// Magnitude scores the change for sorting: the largest relative change of
+// ping, TX rate or RX rate, from 0 (unchanged) to 1 (from or to zero). Moves
+// below a noise floor (5ms, 1 KB/s) count as unchanged.
+func (d ConnDelta) Magnitude() float64 {
+	m := 0.0
+	if d.Old.PingCount > 0 && d.New.PingCount > 0 && d.Ping.Abs() >= 5*time.Millisecond {
+		m = relChange(float64(d.Old.Ping), float64(d.New.Ping))
+	}
+	if math.Abs(d.TxRate) >= 1<<10 {
+		m = max(m, relChange(d.Old.TxRate, d.New.TxRate))
+	}
+	if math.Abs(d.RxRate) >= 1<<10 {
+		m = max(m, relChange(d.Old.RxRate, d.New.RxRate))
+	}
+	return m
+}
+
+// relChange is |b-a| relative to the larger of the two.
+func relChange(a, b float64) float64 {
+	hi := max(a, b)
+	if hi <= 0 {
+		return 0
+	}
+	return math.Abs(b-a) / hi
+}
+
+// Comparison is the difference between a reference and a later snapshot.
+type Comparison struct {
+	Added   []*Connection // in the snapshot only, by app name
+	Removed []*Connection // in the reference only, by app name
+	Changed []ConnDelta   // in both, largest Magnitude first
+}
+
+// Compare compares cur against the reference by connection key. A current
+// socket whose LinkedFrom names a reference connection that is gone counts
+// as that connection (see FlowLinkConfig); only the most recent link is
+// known, so a flow relinked twice since the reference shows as replaced.
+func (r Reference) Compare(cur []*Connection) Comparison {
+	before := make(map[string]*Connection, len(r.Conns))
+	for _, c := range r.Conns {
+		before[c.Key()] = c
+	}
+	now := make(map[string]bool, len(cur))
+	for _, c := range cur {
+		now[c.Key()] = true
+	}
+
+	var cmp Comparison
+	matched := make(map[string]bool, len(cur))
+	for _, c := range cur {
+		key := c.Key()
+		old, ok := before[key]
+		linked := false
+		if !ok && c.LinkedFrom != "" {
+			prev := c.LinkedFrom
+			if c.Host != "" {
+				prev = c.Host + "|" + prev // LinkedFrom was set on the agent, without the host prefix
+			}
+			if !now[prev] && !matched[prev] {
+				old, ok = before[prev]
+				linked, key = ok, prev
+			}
+		}
+		if !ok {
+			cmp.Added = append(cmp.Added, c)
+			continue
+		}
+		matched[key] = true
+		cmp.Changed = append(cmp.Changed, newConnDelta(old, c, linked))
+	}
+	for _, c := range r.Conns {
+		if !matched[c.Key()] {
+			cmp.Removed = append(cmp.Removed, c)
+		}
+	}
+
+	byApp := func(conns []*Connection) {
+		sort.SliceStable(conns, func(i, j int) bool { return conns[i].AppName < conns[j].AppName })
+	}
+	byApp(cmp.Added)
+	byApp(cmp.Removed)
+	sort.SliceStable(cmp.Changed, func(i, j int) bool {
+		a, b := cmp.Changed[i], cmp.Changed[j]
+		if ma, mb := a.Magnitude(), b.Magnitude(); ma != mb {
+			return ma > mb
+		}
+		return a.New.AppName < b.New.AppName
+	})
+	return cmp
+}
+
+func newConnDelta(old, cur *Connection, linked bool) ConnDelta {
+	d := ConnDelta{
+		Old:    old,
+		New:    cur,
+		Linked: linked,
+		TxRate: cur.TxRate - old.TxRate,
+		RxRate: cur.RxRate - old.RxRate,
+	}
+	if old.PingCount > 0 && cur.PingCount > 0 {
+		d.Ping = cur.Ping - old.Ping
+	}
+	if old.HasByteCounts && cur.HasByteCounts && !linked {
+		// A replacement socket's counters start over; only the same
+		// socket's totals can be subtracted.
+		d.TxBytes = int64(cur.TxBytes) - int64(old.TxBytes)
+		d.RxBytes = int64(cur.RxBytes) - int64(old.RxBytes)
+	}
+	return d
+}
@@ -0,0 +1,133 @@
+package tracker
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewReferenceStrips(t *testing.T) {
+	c := fakeConn("web", "192.0.2.1", 443)
+	c.Ping, c.PingCount, c.TxBytes, c.HasByteCounts = 20*time.Millisecond, 3, 1000, true
+	c.TCPInfo = &TCPInfo{Retrans: 4}
+	c.ExePath = "/usr/bin/web"
+	ref := NewReference("R1", time.Unix(0, 0), []*Connection{&c})
+	r := ref.Conns[0]
+	if r == &c || r.Key() != c.Key() || r.Ping != c.Ping || r.TxBytes != 1000 || !r.HasByteCounts {
+		t.Fatalf("reference copy %+v", r)
+	}
+	if r.TCPInfo != nil || r.ExePath != "" {
+		t.Error("reference keeps fields a comparison does not show")
+	}
+	c.Ping = time.Second
+	if r.Ping != 20*time.Millisecond {
+		t.Error("reference shares the live connection")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	conn := func(app, remote string, port int, ping time.Duration, tx float64) *Connection {
+		c := fakeConn(app, remote, port)
+		c.Ping, c.PingCount, c.TxRate = ping, 5, tx
+		return &c
+	}
+	ref := NewReference("R1", time.Unix(0, 0), []*Connection{
+		conn("steady", "192.0.2.1", 443, 20*time.Millisecond, 0),
+		conn("slower", "192.0.2.2", 443, 20*time.Millisecond, 0),
+		conn("upload", "192.0.2.3", 443, 20*time.Millisecond, 10<<10),
+		conn("noise", "192.0.2.4", 443, 20*time.Millisecond, 100),
+		conn("gone", "192.0.2.5", 22, 0, 0),
+	})
+	cur := []*Connection{
+		conn("steady", "192.0.2.1", 443, 21*time.Millisecond, 0),      // below the 5ms floor
+		conn("slower", "192.0.2.2", 443, 80*time.Millisecond, 0),      // 0.75
+		conn("upload", "192.0.2.3", 443, 20*time.Millisecond, 40<<10), // 0.75 -> by name
+		conn("noise", "192.0.2.4", 443, 20*time.Millisecond, 900),     // below 1 KB/s
+		conn("new", "198.51.100.1", 80, 0, 0),
+		conn("another", "198.51.100.2", 80, 0, 0),
+	}
+	cmp := ref.Compare(cur)
+
+	if len(cmp.Added) != 2 || cmp.Added[0].AppName != "another" || cmp.Added[1].AppName != "new" {
+		t.Errorf("added %v", apps(cmp.Added))
+	}
+	if len(cmp.Removed) != 1 || cmp.Removed[0].AppName != "gone" {
+		t.Errorf("removed %v", apps(cmp.Removed))
+	}
+	var order []string
+	for _, d := range cmp.Changed {
+		order = append(order, d.New.AppName)
+	}
+	if want := []string{"slower", "upload", "noise", "steady"}; !slices.Equal(order, want) {
+		t.Errorf("changed %v, want %v", order, want)
+	}
+	d := cmp.Changed[0]
+	if d.Ping != 60*time.Millisecond || d.Magnitude() != 0.75 || d.Linked {
+		t.Errorf("slower: %+v magnitude %v", d, d.Magnitude())
+	}
+	if m := cmp.Changed[2].Magnitude(); m != 0 {
+		t.Errorf("noise magnitude %v", m)
+	}
+}
+
+func TestCompareDeltas(t *testing.T) {
+	old := fakeConn("dl", "192.0.2.1", 443)
+	old.HasByteCounts, old.TxBytes, old.RxBytes = true, 1000, 5000
+	cur := old
+	cur.TxBytes, cur.RxBytes, cur.RxRate = 1500, 4000, 2048
+	d := NewReference("R", time.Time{}, []*Connection{&old}).Compare([]*Connection{&cur}).Changed[0]
+	if d.TxBytes != 500 || d.RxBytes != -1000 || d.RxRate != 2048 || d.Ping != 0 {
+		t.Errorf("delta %+v", d)
+	}
+
+	// Unprobed on one side: no ping delta.
+	old.PingCount, old.Ping = 0, 0
+	cur.PingCount, cur.Ping = 3, 30*time.Millisecond
+	if d := newConnDelta(&old, &cur, false); d.Ping != 0 || d.Magnitude() != relChange(0, 2048) {
+		t.Errorf("unprobed: %+v", d)
+	}
+}
+
+// TestCompareLinked checks that a replacement socket continues the flow
+// it was linked from, also for an agent's connections, whose keys carry
+// the host but whose LinkedFrom does not.
+func TestCompareLinked(t *testing.T) {
+	for _, host := range []string{"", "agent:7777"} {
+		old := fakeConn("game", "192.0.2.1", 27015)
+		old.Host, old.HasByteCounts, old.TxBytes = host, true, 1<<20
+		repl := old
+		repl.LocalPort++
+		repl.TxBytes = 10
+		repl.LinkedFrom = old.Key()
+		if host != "" {
+			repl.LinkedFrom = fakeConnKey(old)
+		}
+		cmp := NewReference("R", time.Time{}, []*Connection{&old}).Compare([]*Connection{&repl})
+		if len(cmp.Added) != 0 || len(cmp.Removed) != 0 || len(cmp.Changed) != 1 {
+			t.Fatalf("host %q: %d added, %d removed, %d changed", host, len(cmp.Added), len(cmp.Removed), len(cmp.Changed))
+		}
+		if d := cmp.Changed[0]; !d.Linked || d.TxBytes != 0 {
+			t.Errorf("host %q: linked %v, bytes %d across sockets", host, d.Linked, d.TxBytes)
+		}
+
+		// While the old socket still exists, the new one is just new.
+		cmp = NewReference("R", time.Time{}, []*Connection{&old}).Compare([]*Connection{&old, &repl})
+		if len(cmp.Added) != 1 || len(cmp.Changed) != 1 || cmp.Changed[0].Linked {
+			t.Errorf("host %q with both sockets: %+v", host, cmp)
+		}
+	}
+}
+
+// fakeConnKey is c's key as the agent that scanned it sees it.
+func fakeConnKey(c Connection) string {
+	c.Host = ""
+	return c.Key()
+}
+
+func apps(conns []*Connection) []string {
+	var out []string
+	for _, c := range conns {
+		out = append(out, c.AppName)
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BBRInfo is BBR's model of a connection's path, as the kernel reports it
+// (INET_DIAG_BBRINFO): the bottleneck bandwidth it estimated and the
+// lowest RTT it saw in its window.
+type BBRInfo struct {
+	Bandwidth float64 // bytes/sec
+	MinRTT    time.Duration
+}
+
+// String formats the estimate for the detail view, e.g.
+// "bottleneck 1.2 MB/s, min RTT 10.5ms".
+func (b BBRInfo) String() string {
+	return fmt.Sprintf("bottleneck %s, min RTT %s", FormatBytes(b.Bandwidth), b.MinRTT.Round(10*time.Microsecond))
+}
+
+// matchCongestion reports whether c uses the congestion control algorithm
+// v (cc:bbr, cc:cubic); cc:unknown matches the ones it is not known for.
+func matchCongestion(c *Connection, v string) bool {
+	if c.CongestionAlgo == "" {
+		return v == "unknown"
+	}
+	return strings.ToLower(c.CongestionAlgo) == v
+}
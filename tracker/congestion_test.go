@@ -0,0 +1,37 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchCongestion(t *testing.T) {
+	bbr := &Connection{CongestionAlgo: "bbr"}
+	unknown := &Connection{}
+	for _, tt := range []struct {
+		c    *Connection
+		v    string
+		want bool
+	}{
+		{bbr, "bbr", true},
+		{bbr, "cubic", false},
+		{&Connection{CongestionAlgo: "BBR"}, "bbr", true},
+		{unknown, "unknown", true},
+		{unknown, "bbr", false},
+		{bbr, "unknown", false},
+	} {
+		if got := matchCongestion(tt.c, tt.v); got != tt.want {
+			t.Errorf("%q cc:%s = %v", tt.c.CongestionAlgo, tt.v, got)
+		}
+	}
+	if got := FilterConnections([]*Connection{bbr, unknown}, "cc:bbr"); len(got) != 1 || got[0] != bbr {
+		t.Errorf("cc:bbr kept %v", got)
+	}
+}
+
+func TestBBRInfoString(t *testing.T) {
+	b := BBRInfo{Bandwidth: 12.3e6, MinRTT: 26917 * time.Microsecond}
+	if got, want := b.String(), "bottleneck 11.7 MB/s, min RTT 26.92ms"; got != want {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
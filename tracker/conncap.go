@@ -0,0 +1,110 @@
+package tracker
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Overflow summarizes the sockets the last scan found beyond the
+// connection cap (see SetMaxConnections). They are counted but not
+// tracked, so they have no rates, pings or history.
+type Overflow struct {
+	Conns   int               `json:"conns"`
+	ByApp   map[string]int    `json:"by_app,omitempty"`
+	ByState map[ConnState]int `json:"by_state,omitempty"`
+}
+
+// Apps is the number of distinct apps in the overflow.
+func (o Overflow) Apps() int {
+	return len(o.ByApp)
+}
+
+// capConnections keeps the limit most relevant of a scan's connections and
+// counts the rest into an Overflow. The order is:
+//   - ESTABLISHED before every other state
+//   - connections already tracked before new ones, so a full table does
+//     not churn as sockets come and go
+//   - higher TX+RX rate, as of the last scan
+//   - newer first
+//   - by Key, so equal connections always fall the same way
+//
+// It returns the kept connections in scan order, and the keys of the
+// dropped ones. limit 0 keeps everything.
+func capConnections(scanned []*Connection, limit int, tracked map[string]*Connection, now time.Time) (kept []*Connection, over Overflow, dropped []string) {
+	if limit <= 0 || len(scanned) <= limit {
+		return scanned, Overflow{}, nil
+	}
+	type ranked struct {
+		c       *Connection
+		key     string
+		index   int
+		tracked bool
+		rate    float64
+		first   time.Time
+	}
+	rs := make([]ranked, len(scanned))
+	for i, c := range scanned {
+		r := ranked{c: c, key: c.Key(), index: i, first: now}
+		if prev, ok := tracked[r.key]; ok {
+			r.tracked, r.rate, r.first = true, prev.TxRate+prev.RxRate, prev.FirstSeen
+		}
+		rs[i] = r
+	}
+	slices.SortFunc(rs, func(a, b ranked) int {
+		if ea, eb := a.c.State == StateEstablished, b.c.State == StateEstablished; ea != eb {
+			if ea {
+				return -1
+			}
+			return 1
+		}
+		if a.tracked != b.tracked {
+			if a.tracked {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(b.rate, a.rate); c != 0 {
+			return c
+		}
+		if c := b.first.Compare(a.first); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.key, b.key)
+	})
+
+	over = Overflow{ByApp: make(map[string]int), ByState: make(map[ConnState]int)}
+	for _, r := range rs[limit:] {
+		over.Conns++
+		over.ByApp[r.c.AppName]++
+		over.ByState[r.c.State]++
+		dropped = append(dropped, r.key)
+	}
+	rs = rs[:limit]
+	slices.SortFunc(rs, func(a, b ranked) int { return a.index - b.index })
+	kept = make([]*Connection, len(rs))
+	for i, r := range rs {
+		kept[i] = r.c
+	}
+	return kept, over, dropped
+}
+
+// SetMaxConnections caps the connections tracked; 0 tracks all of them.
+// It is safe to call while the tracker is running and applies from the
+// next scan.
+func (t *Tracker) SetMaxConnections(n int) {
+	t.mu.Lock()
+	t.maxConns = max(n, 0)
+	t.mu.Unlock()
+}
+
+// Overflow returns what the last scan found beyond the connection cap.
+func (t *Tracker) Overflow() Overflow {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	o := t.overflow
+	o.ByApp = maps.Clone(o.ByApp)
+	o.ByState = maps.Clone(o.ByState)
+	return o
+}
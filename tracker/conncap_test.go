@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCapConnectionsOrder(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	conn := func(app string, port int, state ConnState) *Connection {
+		c := fakeConn(app, "192.0.2.1", port)
+		c.State = state
+		return &c
+	}
+	tracked := func(c *Connection, rate float64, age time.Duration) *Connection {
+		p := *c
+		p.TxRate, p.FirstSeen = rate, now.Add(-age)
+		return &p
+	}
+	busyOld := conn("a", 1, StateEstablished)
+	quietOld := conn("a", 2, StateEstablished)
+	quietNew := conn("a", 3, StateEstablished)
+	fresh := conn("b", 4, StateEstablished)
+	fresh2 := conn("b", 5, StateEstablished)
+	waiting := conn("c", 6, StateTimeWait)
+	listening := conn("c", 7, StateListening)
+	scanned := []*Connection{waiting, fresh2, quietNew, listening, busyOld, fresh, quietOld}
+	prev := map[string]*Connection{}
+	for _, p := range []*Connection{
+		tracked(busyOld, 1000, time.Hour), tracked(quietOld, 10, time.Hour), tracked(quietNew, 10, time.Minute),
+		tracked(waiting, 5000, time.Hour), // busy but not established
+	} {
+		prev[p.Key()] = p
+	}
+
+	// ESTABLISHED, then tracked, then by rate, then newer, then by key.
+	rank := []*Connection{busyOld, quietNew, quietOld, fresh, fresh2, waiting, listening}
+	for limit := 1; limit <= len(scanned); limit++ {
+		kept, over, dropped := capConnections(scanned, limit, prev, now)
+		var want []*Connection
+		for _, c := range scanned { // in scan order
+			if slices.Index(rank, c) < limit {
+				want = append(want, c)
+			}
+		}
+		if !slices.Equal(kept, want) {
+			t.Errorf("limit %d: kept %v", limit, appPorts(kept))
+		}
+		if over.Conns != len(scanned)-limit || len(dropped) != over.Conns {
+			t.Errorf("limit %d: %d over, %d dropped", limit, over.Conns, len(dropped))
+		}
+	}
+	if kept, over, dropped := capConnections(scanned, 0, prev, now); len(kept) != len(scanned) || over.Conns != 0 || dropped != nil {
+		t.Error("limit 0 capped")
+	}
+}
+
+func appPorts(conns []*Connection) []string {
+	var ks []string
+	for _, c := range conns {
+		ks = append(ks, fmt.Sprint(c.AppName, c.RemotePort))
+	}
+	return ks
+}
+
+// TestCapConnectionsStable scans a table larger than the cap with sockets
+// coming and going, and checks the tracked set does not churn, and that
+// tracked and overflow add up to the uncapped table.
+func TestCapConnectionsStable(t *testing.T) {
+	src := &fakeSource{}
+	var table []Connection
+	for i := range 20 {
+		c := fakeConn(fmt.Sprintf("app%d", i%3), "192.0.2.1", 1000+i)
+		if i%4 == 0 {
+			c.State = StateTimeWait
+		}
+		table = append(table, c)
+	}
+	src.set(table...)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.SetMaxConnections(10)
+	tr.scan()
+	first := snapshotKeys(tr)
+	if len(first) != 10 {
+		t.Fatalf("%d tracked, want 10", len(first))
+	}
+
+	for round := range 5 {
+		// New sockets appear, each scan listing them first.
+		extra := fakeConn("new", "192.0.2.9", 2000+round)
+		src.set(append([]Connection{extra}, table...)...)
+		tr.scan()
+		if got := snapshotKeys(tr); !slices.Equal(got, first) {
+			t.Fatalf("round %d: tracked set changed:\n%v\n%v", round, got, first)
+		}
+	}
+
+	// Overflow totals make the table whole.
+	src.set(table...)
+	tr.scan()
+	over := tr.Overflow()
+	byApp, byState := map[string]int{}, map[ConnState]int{}
+	for _, c := range tr.Snapshot() {
+		byApp[c.AppName]++
+		byState[c.State]++
+	}
+	for app, n := range over.ByApp {
+		byApp[app] += n
+	}
+	for st, n := range over.ByState {
+		byState[st] += n
+	}
+	if over.Conns != 10 || byApp["app0"] != 7 || byApp["app1"] != 7 || byApp["app2"] != 6 ||
+		byState[StateTimeWait] != 5 || byState[StateEstablished] != 15 {
+		t.Errorf("overflow %+v does not add up: %v %v", over, byApp, byState)
+	}
+	if over.Apps() != len(over.ByApp) {
+		t.Error("Apps")
+	}
+
+	// Lifting the cap tracks everything again.
+	tr.SetMaxConnections(0)
+	tr.scan()
+	if n := len(tr.Snapshot()); n != len(table) || tr.Overflow().Conns != 0 {
+		t.Errorf("uncapped: %d tracked, overflow %+v", n, tr.Overflow())
+	}
+}
+
+func snapshotKeys(tr *Tracker) []string {
+	var ks []string
+	for _, c := range tr.Snapshot() {
+		ks = append(ks, c.Key())
+	}
+	slices.Sort(ks)
+	return ks
+}
@@ -0,0 +1,361 @@
+package tracker
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Origin says where a connection's traffic comes from: a socket of this
+// machine, or a flow it only forwards (see ClassifyFlow).
+type Origin string
+
+const (
+	OriginLocal     Origin = ""          // a socket of this machine
+	OriginForwarded Origin = "forwarded" // routed for a LAN client
+	OriginBridged   Origin = "bridged"   // routed for a container on a bridge (docker0, br-*, ...)
+)
+
+// String names the origin, "local" for OriginLocal.
+func (o Origin) String() string {
+	if o == OriginLocal {
+		return "local"
+	}
+	return string(o)
+}
+
+// ParseOrigin parses "local", "forwarded" or "bridged".
+func ParseOrigin(s string) (Origin, bool) {
+	switch Origin(s) {
+	case "local":
+		return OriginLocal, true
+	case OriginForwarded, OriginBridged:
+		return Origin(s), true
+	}
+	return OriginLocal, false
+}
+
+// bridgeIfacePrefixes are the name prefixes of container bridges: Docker's
+// default and user-defined networks, Podman, CNI and LXC.
+var bridgeIfacePrefixes = []string{"docker", "br-", "podman", "cni", "cbr", "lxcbr"}
+
+// ConntrackFlow is one entry of the kernel's connection tracking table:
+// the tuple of the packet that opened the flow and the tuple replies carry,
+// which differ when the flow is NATed.
+type ConntrackFlow struct {
+	Protocol string    // "tcp" or "udp"
+	State    ConnState // TCP state; StateEstablished for UDP
+	OrigSrc  netip.AddrPort
+	OrigDst  netip.AddrPort
+	ReplySrc netip.AddrPort
+	ReplyDst netip.AddrPort
+
+	// Bytes in each direction, when nf_conntrack_acct is on
+	OrigBytes, ReplyBytes uint64
+	HasBytes              bool
+}
+
+// ParseConntrackLine parses one line of /proc/net/nf_conntrack, or of
+// `conntrack -L`, which is the same without the leading family fields:
+//
+//	ipv4 2 tcp 6 431999 ESTABLISHED src=192.168.1.20 dst=140.82.112.3 sport=50412 dport=443 packets=12 bytes=2133 src=140.82.112.3 dst=203.0.113.7 sport=443 dport=50412 packets=10 bytes=6021 [ASSURED] mark=0 use=1
+//
+// The first src/dst/sport/dport/bytes belong to the original direction,
+// the second to the reply. ok is false for other protocols and lines that
+// do not parse.
+func ParseConntrackLine(line string) (f ConntrackFlow, ok bool) {
+	fields := strings.Fields(line)
+	i := 0
+	for i < len(fields) && fields[i] != "tcp" && fields[i] != "udp" {
+		if strings.Contains(fields[i], "=") || i >= 2 {
+			return f, false // icmp, sctp, ... or not a conntrack line
+		}
+		i++
+	}
+	if i == len(fields) {
+		return f, false
+	}
+	f.Protocol = fields[i]
+	f.State = StateEstablished
+
+	var addrs [2][2]netip.Addr // [orig, reply][src, dst]
+	var ports [2][2]uint16
+	var seen [2]int // src/dst/sport/dport fields read per direction
+	dir := 0
+	for _, field := range fields[i+1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			if f.Protocol == "tcp" && field == strings.ToUpper(field) && !strings.HasPrefix(field, "[") {
+				if _, err := strconv.Atoi(field); err != nil {
+					f.State = conntrackState(field)
+				}
+			}
+			continue
+		}
+		switch key {
+		case "src", "dst":
+			if key == "src" && seen[0] > 0 {
+				dir = 1
+			}
+			a, err := netip.ParseAddr(value)
+			if err != nil {
+				return f, false
+			}
+			side := 0
+			if key == "dst" {
+				side = 1
+			}
+			addrs[dir][side] = a.Unmap()
+			seen[dir]++
+		case "sport", "dport":
+			p, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return f, false
+			}
+			side := 0
+			if key == "dport" {
+				side = 1
+			}
+			ports[dir][side] = uint16(p)
+			seen[dir]++
+		case "bytes":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return f, false
+			}
+			if dir == 0 {
+				f.OrigBytes = n
+			} else {
+				f.ReplyBytes = n
+			}
+			f.HasBytes = true
+		}
+	}
+	if seen[0] != 4 || seen[1] != 4 {
+		return f, false
+	}
+	f.OrigSrc = netip.AddrPortFrom(addrs[0][0], ports[0][0])
+	f.OrigDst = netip.AddrPortFrom(addrs[0][1], ports[0][1])
+	f.ReplySrc = netip.AddrPortFrom(addrs[1][0], ports[1][0])
+	f.ReplyDst = netip.AddrPortFrom(addrs[1][1], ports[1][1])
+	return f, true
+}
+
+// conntrackState maps a conntrack TCP state to ConnState. Conntrack's
+// SYN_SENT2 and NONE have no socket equivalent.
+func conntrackState(s string) ConnState {
+	switch s {
+	case "TIME_WAIT":
+		return StateTimeWait
+	case "CLOSE":
+		return StateClosed
+	case "LAST_ACK":
+		return StateLastAck
+	case "FIN_WAIT":
+		return StateFinWait1
+	case "CLOSE_WAIT":
+		return StateCloseWait
+	case "SYN_SENT", "SYN_SENT2":
+		return StateSynSent
+	case "SYN_RECV":
+		return StateSynRecv
+	case "ESTABLISHED":
+		return StateEstablished
+	}
+	return StateUnknown
+}
+
+// IfaceNet is a subnet configured on a local interface.
+type IfaceNet struct {
+	Name   string
+	Prefix netip.Prefix
+}
+
+// FlowOrigin is a flow as ClassifyFlow sees it. For forwarded flows Client
+// is the LAN side (the host behind this router) and Peer the other end.
+type FlowOrigin struct {
+	Origin      Origin
+	Direction   Direction // Outbound when Client opened the flow
+	Client      netip.AddrPort
+	Peer        netip.AddrPort
+	ClientIface string // interface Client's subnet is on; "" when none is
+	PeerIface   string // likewise for Peer; "" when it is reached by the default route
+}
+
+// ClassifyFlow decides whether a conntrack flow is this machine's own
+// traffic or forwarded, and from the interface the client side sits on,
+// whether it is bridged to a container. A flow is local when a socket of
+// this machine matched it (socketMatched), when this machine opened it, or
+// when it was addressed to this machine and not redirected elsewhere by
+// DNAT. A forwarded flow's client is the side on a local subnet: the sender
+// of an outbound flow, or the DNAT target of a port forward.
+func ClassifyFlow(f ConntrackFlow, socketMatched bool, local map[netip.Addr]bool, nets []IfaceNet) FlowOrigin {
+	o := FlowOrigin{Direction: Outbound, Client: f.OrigSrc, Peer: f.OrigDst}
+	switch {
+	case socketMatched, local[f.OrigSrc.Addr()]:
+		return o
+	case local[f.OrigDst.Addr()] && f.ReplySrc.Addr() == f.OrigDst.Addr():
+		o.Direction = Inbound
+		return o
+	case local[f.OrigDst.Addr()]:
+		// Port forward: the reply comes from the host the flow was
+		// redirected to, which is the client on our side.
+		o.Direction, o.Client, o.Peer = Inbound, f.ReplySrc, f.OrigSrc
+	}
+	o.Origin = OriginForwarded
+	o.ClientIface = ifaceOf(o.Client.Addr(), nets)
+	o.PeerIface = ifaceOf(o.Peer.Addr(), nets)
+	for _, p := range bridgeIfacePrefixes {
+		if strings.HasPrefix(o.ClientIface, p) {
+			o.Origin = OriginBridged
+			break
+		}
+	}
+	return o
+}
+
+// ifaceOf returns the interface whose subnet holds a, the most specific
+// one when several do.
+func ifaceOf(a netip.Addr, nets []IfaceNet) string {
+	name, bits := "", -1
+	for _, n := range nets {
+		if n.Prefix.Contains(a) && n.Prefix.Bits() > bits {
+			name, bits = n.Name, n.Prefix.Bits()
+		}
+	}
+	return name
+}
+
+// interfaceNets lists the subnets of the local interfaces. It is empty
+// when the interfaces cannot be read.
+func interfaceNets() []IfaceNet {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var nets []IfaceNet
+	for _, ifc := range ifaces {
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipnet.IP)
+			if !ok {
+				continue
+			}
+			ones, _ := ipnet.Mask.Size()
+			nets = append(nets, IfaceNet{ifc.Name, netip.PrefixFrom(ip.Unmap(), ones).Masked()})
+		}
+	}
+	return nets
+}
+
+// flowConnection turns a forwarded flow into the connection shown for it:
+// the client in the app name's place (its DHCP hostname when known) and as
+// the local end.
+func flowConnection(f ConntrackFlow, o FlowOrigin, hostname string) *Connection {
+	proto := f.Protocol
+	if o.Client.Addr().Is6() {
+		proto += "6"
+	}
+	c := &Connection{
+		AppName:     o.Client.Addr().String(),
+		Protocol:    proto,
+		Direction:   o.Direction,
+		LocalAddr:   o.Client.Addr().String(),
+		LocalPort:   int(o.Client.Port()),
+		RemoteAddr:  o.Peer.Addr().String(),
+		RemotePort:  int(o.Peer.Port()),
+		State:       f.State,
+		Origin:      o.Origin,
+		ClientName:  hostname,
+		OriginIface: o.ClientIface,
+		Provenance:  []string{ProvenanceConntrack},
+	}
+	if hostname != "" {
+		c.AppName = hostname
+	}
+	if f.HasBytes {
+		// The original direction is the client's sending side, except
+		// for a port forward, where the client is the one replying.
+		c.TxBytes, c.RxBytes = f.OrigBytes, f.ReplyBytes
+		if o.Client != f.OrigSrc {
+			c.TxBytes, c.RxBytes = f.ReplyBytes, f.OrigBytes
+		}
+		c.HasByteCounts = true
+	}
+	return c
+}
+
+// udpEnd is the local end of a UDP flow, by port and family.
+type udpEnd struct {
+	port uint16
+	v6   bool
+}
+
+// estimateSocketFlows sets the StreamHint of the unconnected UDP sockets
+// of this machine: how many of its own UDP flows in the conntrack table go
+// through the socket's address and port, one per peer it exchanges
+// datagrams with. ends holds the local end of each such flow. A socket
+// bound to 0.0.0.0 counts the IPv4 flows to any address, one bound to ::
+// (or ss's *) those of both families.
+func estimateSocketFlows(sockets []*Connection, ends []netip.AddrPort) {
+	if len(ends) == 0 {
+		return
+	}
+	byAddr := make(map[netip.AddrPort]int, len(ends))
+	byPort := make(map[udpEnd]int)
+	for _, e := range ends {
+		byAddr[e]++
+		byPort[udpEnd{e.Port(), e.Addr().Is6()}]++
+	}
+	for _, c := range sockets {
+		if c.State != StateUnconnected || baseProtocol(c.Protocol) != "udp" || c.Host != "" || c.Namespace != "" {
+			continue
+		}
+		port := uint16(c.LocalPort)
+		a, err := netip.ParseAddr(c.LocalAddr)
+		var n int
+		switch {
+		case c.LocalAddr == "*": // ss's dual-stack wildcard
+			n = byPort[udpEnd{port, false}] + byPort[udpEnd{port, true}]
+		case err != nil:
+			continue
+		case a.IsUnspecified() && a.Is4():
+			n = byPort[udpEnd{port, false}]
+		case a.IsUnspecified():
+			n = byPort[udpEnd{port, false}] + byPort[udpEnd{port, true}]
+		default:
+			n = byAddr[netip.AddrPortFrom(a.Unmap(), port)]
+		}
+		if n > 0 {
+			c.StreamHint, c.StreamHintSource = n, StreamsConntrack
+		}
+	}
+}
+
+// OriginSummary is the traffic of one origin section.
+type OriginSummary struct {
+	Conns  int
+	TxRate float64
+	RxRate float64
+}
+
+// SummarizeOrigins totals conns by origin.
+func SummarizeOrigins(conns []*Connection) map[Origin]OriginSummary {
+	sums := make(map[Origin]OriginSummary)
+	for _, c := range conns {
+		s := sums[c.Origin]
+		s.Conns++
+		s.TxRate += c.TxRate
+		s.RxRate += c.RxRate
+		sums[c.Origin] = s
+	}
+	return sums
+}
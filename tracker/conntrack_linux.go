@@ -0,0 +1,110 @@
+//go:build linux
+
+package tracker
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// conntrack adds forwarded flows to every scan; nil unless EnableConntrack
+// was called.
+var conntrack *conntrackReader
+
+// conntrackReader reads forwarded flows from the connection tracking table.
+// Only the scan goroutine uses it.
+type conntrackReader struct {
+	path   string
+	leases *leasesFile // nil without -dhcp-leases
+	local  map[netip.Addr]bool
+	nets   []IfaceNet
+	at     time.Time // when local and nets were read
+}
+
+// EnableConntrack makes scans include the flows this machine forwards (a
+// router's LAN clients, containers behind a bridge) from
+// /proc/net/nf_conntrack, besides its own sockets. leasesPath, when set, is
+// a dnsmasq or dhcpd leases file that names the clients. Must be called
+// before Start.
+func EnableConntrack(leasesPath string) error {
+	path := filepath.Join(procRoot, "net", "nf_conntrack")
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("-conntrack: %v (is the nf_conntrack module loaded, and are we root?)", err)
+	}
+	f.Close()
+	r := &conntrackReader{path: path}
+	if leasesPath != "" {
+		if _, err := os.Stat(leasesPath); err != nil {
+			return fmt.Errorf("-dhcp-leases: %v", err)
+		}
+		r.leases = &leasesFile{path: leasesPath}
+	}
+	conntrack = r
+	return nil
+}
+
+// connections returns the forwarded flows of the table, leaving out the ones
+// a scanned socket already shows, and estimates the flows through the
+// unconnected UDP sockets among sockets from this machine's own. A table
+// that cannot be read adds nothing.
+func (r *conntrackReader) connections(sockets []*Connection) []*Connection {
+	now := time.Now()
+	if now.Sub(r.at) >= localAddrsRefresh {
+		r.local = make(map[netip.Addr]bool)
+		for a, class := range localAddrs() {
+			if class == AddrOwn {
+				r.local[a] = true
+			}
+		}
+		r.nets, r.at = interfaceNets(), now
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	owned := make(map[[2]netip.AddrPort]bool, len(sockets))
+	for _, c := range sockets {
+		local, err1 := netip.ParseAddr(c.LocalAddr)
+		remote, err2 := netip.ParseAddr(c.RemoteAddr)
+		if err1 == nil && err2 == nil {
+			owned[[2]netip.AddrPort{
+				netip.AddrPortFrom(local.Unmap(), uint16(c.LocalPort)),
+				netip.AddrPortFrom(remote.Unmap(), uint16(c.RemotePort)),
+			}] = true
+		}
+	}
+
+	var conns []*Connection
+	var udpEnds []netip.AddrPort // local ends of this machine's UDP flows
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		flow, ok := ParseConntrackLine(sc.Text())
+		if !ok {
+			continue
+		}
+		matched := owned[[2]netip.AddrPort{flow.OrigSrc, flow.OrigDst}] ||
+			owned[[2]netip.AddrPort{flow.OrigDst, flow.OrigSrc}]
+		o := ClassifyFlow(flow, matched, r.local, r.nets)
+		if o.Origin == OriginLocal {
+			if flow.Protocol == "udp" {
+				end := flow.OrigDst
+				if r.local[flow.OrigSrc.Addr()] {
+					end = flow.OrigSrc
+				}
+				udpEnds = append(udpEnds, end)
+			}
+			continue
+		}
+		conns = append(conns, flowConnection(flow, o, r.leases.lookup(o.Client.Addr(), now)))
+	}
+	estimateSocketFlows(sockets, udpEnds)
+	return conns
+}
@@ -0,0 +1,191 @@
+package tracker
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestEstimateSocketFlows(t *testing.T) {
+	udp := func(addr string, port int) *Connection {
+		return &Connection{Protocol: "udp", State: StateUnconnected, LocalAddr: addr, LocalPort: port}
+	}
+	quic := udp("192.0.2.10", 443)
+	anyV4 := udp("0.0.0.0", 5353)
+	anyV6 := udp("::", 3478)
+	ssAny := udp("*", 51820)
+	idle := udp("192.0.2.10", 9999)
+	connected := udp("192.0.2.10", 443)
+	connected.State = StateEstablished
+	tcp := &Connection{Protocol: "tcp", State: StateListening, LocalAddr: "192.0.2.10", LocalPort: 443}
+	agent := udp("192.0.2.10", 443)
+	agent.Host = "edge-1"
+
+	ends := []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.10:443"),
+		netip.MustParseAddrPort("192.0.2.10:443"),
+		netip.MustParseAddrPort("192.0.2.10:443"),
+		netip.MustParseAddrPort("192.0.2.11:443"), // another address
+		netip.MustParseAddrPort("192.0.2.10:5353"),
+		netip.MustParseAddrPort("192.0.2.11:5353"),
+		netip.MustParseAddrPort("[2001:db8::10]:5353"),
+		netip.MustParseAddrPort("192.0.2.10:3478"),
+		netip.MustParseAddrPort("[2001:db8::10]:3478"),
+		netip.MustParseAddrPort("[2001:db8::10]:51820"),
+	}
+	estimateSocketFlows([]*Connection{quic, anyV4, anyV6, ssAny, idle, connected, tcp, agent}, ends)
+	tests := []struct {
+		name string
+		c    *Connection
+		want int
+	}{
+		{"bound to an address", quic, 3},
+		{"0.0.0.0", anyV4, 2},
+		{"::", anyV6, 2},
+		{"ss wildcard", ssAny, 1},
+		{"no flows", idle, 0},
+		{"connected", connected, 0},
+		{"tcp", tcp, 0},
+		{"remote agent", agent, 0},
+	}
+	for _, tt := range tests {
+		source := ""
+		if tt.want > 0 {
+			source = StreamsConntrack
+		}
+		if tt.c.StreamHint != tt.want || tt.c.StreamHintSource != source {
+			t.Errorf("%s: %d from %q, want %d", tt.name, tt.c.StreamHint, tt.c.StreamHintSource, tt.want)
+		}
+	}
+}
+
+func TestParseConntrackLine(t *testing.T) {
+	ap := netip.MustParseAddrPort
+	tests := []struct {
+		name string
+		line string
+		want ConntrackFlow
+		ok   bool
+	}{
+		{"proc, NATed", "ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.20 dst=140.82.112.3 sport=50412 dport=443 packets=12 bytes=2133 src=140.82.112.3 dst=203.0.113.7 sport=443 dport=50412 packets=10 bytes=6021 [ASSURED] mark=0 use=1",
+			ConntrackFlow{"tcp", StateEstablished, ap("192.168.1.20:50412"), ap("140.82.112.3:443"), ap("140.82.112.3:443"), ap("203.0.113.7:50412"), 2133, 6021, true}, true},
+		{"conntrack -L, no accounting", "tcp      6 117 TIME_WAIT src=10.0.0.5 dst=10.0.0.1 sport=40000 dport=22 src=10.0.0.1 dst=10.0.0.5 sport=22 dport=40000 [ASSURED] mark=0 use=1",
+			ConntrackFlow{Protocol: "tcp", State: StateTimeWait, OrigSrc: ap("10.0.0.5:40000"), OrigDst: ap("10.0.0.1:22"), ReplySrc: ap("10.0.0.1:22"), ReplyDst: ap("10.0.0.5:40000")}, true},
+		{"udp, unreplied", "ipv4 2 udp 17 29 src=192.168.1.30 dst=8.8.8.8 sport=53000 dport=53 [UNREPLIED] src=8.8.8.8 dst=192.168.1.30 sport=53 dport=53000 mark=0 use=1",
+			ConntrackFlow{Protocol: "udp", State: StateEstablished, OrigSrc: ap("192.168.1.30:53000"), OrigDst: ap("8.8.8.8:53"), ReplySrc: ap("8.8.8.8:53"), ReplyDst: ap("192.168.1.30:53000")}, true},
+		{"ipv6", "ipv6 10 tcp 6 60 SYN_SENT src=2001:db8::20 dst=2001:db8:1::1 sport=41000 dport=80 src=2001:db8:1::1 dst=2001:db8::20 sport=80 dport=41000 mark=0 use=1",
+			ConntrackFlow{Protocol: "tcp", State: StateSynSent, OrigSrc: ap("[2001:db8::20]:41000"), OrigDst: ap("[2001:db8:1::1]:80"), ReplySrc: ap("[2001:db8:1::1]:80"), ReplyDst: ap("[2001:db8::20]:41000")}, true},
+		{"unknown state", "tcp 6 10 NONE src=10.0.0.5 dst=10.0.0.1 sport=1 dport=2 src=10.0.0.1 dst=10.0.0.5 sport=2 dport=1",
+			ConntrackFlow{Protocol: "tcp", State: StateUnknown, OrigSrc: ap("10.0.0.5:1"), OrigDst: ap("10.0.0.1:2"), ReplySrc: ap("10.0.0.1:2"), ReplyDst: ap("10.0.0.5:1")}, true},
+		{"icmp", "ipv4 2 icmp 1 29 src=10.0.0.5 dst=10.0.0.1 type=8 code=0 id=1 src=10.0.0.1 dst=10.0.0.5 type=0 code=0 id=1", ConntrackFlow{}, false},
+		{"no reply tuple", "tcp 6 10 ESTABLISHED src=10.0.0.5 dst=10.0.0.1 sport=1 dport=2", ConntrackFlow{}, false},
+		{"bad port", "tcp 6 10 ESTABLISHED src=10.0.0.5 dst=10.0.0.1 sport=70000 dport=2 src=10.0.0.1 dst=10.0.0.5 sport=2 dport=1", ConntrackFlow{}, false},
+		{"bad address", "tcp 6 10 ESTABLISHED src=host dst=10.0.0.1 sport=1 dport=2 src=10.0.0.1 dst=10.0.0.5 sport=2 dport=1", ConntrackFlow{}, false},
+		{"not conntrack", "conntrack v1.4.7 (conntrack-tools): 3 flow entries have been shown.", ConntrackFlow{}, false},
+		{"empty", "", ConntrackFlow{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseConntrackLine(tt.line)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("%s: %+v %v, want %+v %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClassifyFlow(t *testing.T) {
+	ap := netip.MustParseAddrPort
+	local := map[netip.Addr]bool{netip.MustParseAddr("192.168.1.1"): true, netip.MustParseAddr("203.0.113.7"): true}
+	nets := []IfaceNet{
+		{"lan0", netip.MustParsePrefix("192.168.1.0/24")},
+		{"docker0", netip.MustParsePrefix("172.17.0.0/16")},
+		{"br-1a2b", netip.MustParsePrefix("172.18.0.0/16")},
+		{"wg0", netip.MustParsePrefix("10.8.0.0/16")},
+		{"wg0-peer", netip.MustParsePrefix("10.8.3.0/24")}, // more specific
+	}
+	flow := func(src, dst, replySrc, replyDst string) ConntrackFlow {
+		return ConntrackFlow{Protocol: "tcp", OrigSrc: ap(src), OrigDst: ap(dst), ReplySrc: ap(replySrc), ReplyDst: ap(replyDst)}
+	}
+	tests := []struct {
+		name    string
+		f       ConntrackFlow
+		matched bool
+		want    FlowOrigin
+	}{
+		{"socket matched", flow("192.168.1.50:1000", "1.1.1.1:443", "1.1.1.1:443", "203.0.113.7:1000"), true,
+			FlowOrigin{Direction: Outbound, Client: ap("192.168.1.50:1000"), Peer: ap("1.1.1.1:443")}},
+		{"opened here", flow("203.0.113.7:40000", "1.1.1.1:443", "1.1.1.1:443", "203.0.113.7:40000"), false,
+			FlowOrigin{Direction: Outbound, Client: ap("203.0.113.7:40000"), Peer: ap("1.1.1.1:443")}},
+		{"to this machine", flow("198.51.100.9:50000", "203.0.113.7:22", "203.0.113.7:22", "198.51.100.9:50000"), false,
+			FlowOrigin{Direction: Inbound, Client: ap("198.51.100.9:50000"), Peer: ap("203.0.113.7:22")}},
+		{"LAN client, masqueraded", flow("192.168.1.20:50412", "140.82.112.3:443", "140.82.112.3:443", "203.0.113.7:50412"), false,
+			FlowOrigin{OriginForwarded, Outbound, ap("192.168.1.20:50412"), ap("140.82.112.3:443"), "lan0", ""}},
+		{"port forward", flow("198.51.100.9:50000", "203.0.113.7:8080", "192.168.1.30:80", "198.51.100.9:50000"), false,
+			FlowOrigin{OriginForwarded, Inbound, ap("192.168.1.30:80"), ap("198.51.100.9:50000"), "lan0", ""}},
+		{"container", flow("172.17.0.2:41000", "1.1.1.1:53", "1.1.1.1:53", "203.0.113.7:41000"), false,
+			FlowOrigin{OriginBridged, Outbound, ap("172.17.0.2:41000"), ap("1.1.1.1:53"), "docker0", ""}},
+		{"user-defined bridge to the LAN", flow("172.18.0.5:41000", "192.168.1.20:80", "192.168.1.20:80", "172.18.0.5:41000"), false,
+			FlowOrigin{OriginBridged, Outbound, ap("172.18.0.5:41000"), ap("192.168.1.20:80"), "br-1a2b", "lan0"}},
+		{"container port forward", flow("198.51.100.9:50000", "203.0.113.7:8443", "172.17.0.3:443", "198.51.100.9:50000"), false,
+			FlowOrigin{OriginBridged, Inbound, ap("172.17.0.3:443"), ap("198.51.100.9:50000"), "docker0", ""}},
+		{"most specific subnet", flow("10.8.3.4:5000", "1.1.1.1:443", "1.1.1.1:443", "203.0.113.7:5000"), false,
+			FlowOrigin{OriginForwarded, Outbound, ap("10.8.3.4:5000"), ap("1.1.1.1:443"), "wg0-peer", ""}},
+	}
+	for _, tt := range tests {
+		if got := ClassifyFlow(tt.f, tt.matched, local, nets); got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFlowConnection(t *testing.T) {
+	ap := netip.MustParseAddrPort
+	f := ConntrackFlow{Protocol: "tcp", State: StateEstablished,
+		OrigSrc: ap("198.51.100.9:50000"), OrigDst: ap("203.0.113.7:8080"), ReplySrc: ap("192.168.1.30:80"), ReplyDst: ap("198.51.100.9:50000"),
+		OrigBytes: 100, ReplyBytes: 9000, HasBytes: true}
+	o := ClassifyFlow(f, false, map[netip.Addr]bool{netip.MustParseAddr("203.0.113.7"): true}, []IfaceNet{{"lan0", netip.MustParsePrefix("192.168.1.0/24")}})
+	c := flowConnection(f, o, "nas")
+	if c.AppName != "nas" || c.ClientName != "nas" || c.LocalAddr != "192.168.1.30" || c.LocalPort != 80 || c.RemotePort != 50000 ||
+		c.Direction != Inbound || c.Origin != OriginForwarded || c.OriginIface != "lan0" {
+		t.Errorf("port forward: %+v", c)
+	}
+	// The server behind the forward sends the reply direction.
+	if !c.HasByteCounts || c.TxBytes != 9000 || c.RxBytes != 100 {
+		t.Errorf("port forward bytes: tx %d rx %d", c.TxBytes, c.RxBytes)
+	}
+
+	f = ConntrackFlow{Protocol: "udp", OrigSrc: ap("[2001:db8::20]:5000"), OrigDst: ap("[2001:db8:1::1]:53"), OrigBytes: 60, ReplyBytes: 200, HasBytes: true}
+	c = flowConnection(f, FlowOrigin{OriginForwarded, Outbound, f.OrigSrc, f.OrigDst, "lan0", ""}, "")
+	if c.AppName != "2001:db8::20" || c.Protocol != "udp6" || c.TxBytes != 60 || c.RxBytes != 200 {
+		t.Errorf("outbound: %+v", c)
+	}
+}
+
+func TestSummarizeOrigins(t *testing.T) {
+	conns := []*Connection{
+		{TxRate: 10, RxRate: 20},
+		{TxRate: 1, RxRate: 2},
+		{Origin: OriginForwarded, TxRate: 100, RxRate: 1000},
+		{Origin: OriginBridged, RxRate: 5},
+	}
+	got := SummarizeOrigins(conns)
+	want := map[Origin]OriginSummary{
+		OriginLocal:     {Conns: 2, TxRate: 11, RxRate: 22},
+		OriginForwarded: {Conns: 1, TxRate: 100, RxRate: 1000},
+		OriginBridged:   {Conns: 1, RxRate: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%+v", got)
+	}
+	for o, w := range want {
+		if got[o] != w {
+			t.Errorf("%s: %+v, want %+v", o, got[o], w)
+		}
+	}
+	for _, s := range []string{"local", "forwarded", "bridged"} {
+		if o, ok := ParseOrigin(s); !ok || o.String() != s {
+			t.Errorf("%s: %q %v", s, o, ok)
+		}
+	}
+	if _, ok := ParseOrigin("routed"); ok {
+		t.Error("routed parsed")
+	}
+}
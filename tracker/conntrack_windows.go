@@ -0,0 +1,10 @@
+//go:build windows
+
+package tracker
+
+import "errors"
+
+// EnableConntrack is Linux only; Windows has no connection tracking table.
+func EnableConntrack(leasesPath string) error {
+	return errors.New("-conntrack is only supported on Linux")
+}
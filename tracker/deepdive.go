@@ -0,0 +1,330 @@
+package tracker
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxDeepDiveRate and MaxDeepDiveDuration bound a deep-dive: at most
+	// 10 probes a second for at most 5 minutes.
+	MaxDeepDiveRate     = 10
+	MaxDeepDiveDuration = 5 * time.Minute
+
+	DefaultDeepDiveRate     = 10
+	DefaultDeepDiveDuration = time.Minute
+
+	// deepDiveTimeout is how long one deep-dive probe waits; a slower
+	// answer counts as lost, so probes in flight stay few.
+	deepDiveTimeout = time.Second
+
+	// maxDeepDiveSamples is the most a deep-dive can collect.
+	maxDeepDiveSamples = MaxDeepDiveRate * int(MaxDeepDiveDuration/time.Second)
+)
+
+// DeepDiveEnd says why a deep-dive stopped.
+type DeepDiveEnd string
+
+const (
+	DeepDiveTimeUp  DeepDiveEnd = "time up"
+	DeepDiveStopped DeepDiveEnd = "stopped"
+	DeepDiveClosed  DeepDiveEnd = "connection closed"
+	DeepDiveBudget  DeepDiveEnd = "probe budget used up"
+)
+
+// DeepDiveSample is one deep-dive probe.
+type DeepDiveSample struct {
+	Time time.Time // when it was sent
+	RTT  time.Duration
+	Lost bool
+}
+
+// DeepDive is a high-frequency probe of one connection's remote: single
+// TCP connects at Rate per second for For, each kept as a sample. Normal
+// probing of the remote host is suspended while it runs, so the two do not
+// count each other's connects.
+type DeepDive struct {
+	Key     string // the connection's key
+	App     string
+	Addr    string
+	Port    int
+	Rate    int // probes per second
+	For     time.Duration
+	Started time.Time
+	Ended   time.Time // zero while running
+	End     DeepDiveEnd
+	Samples []DeepDiveSample // oldest first
+
+	stop chan struct{}
+}
+
+// Running reports whether the deep-dive is still probing.
+func (d *DeepDive) Running() bool {
+	return d.Ended.IsZero()
+}
+
+// DeepDiveStats summarize a deep-dive's samples.
+type DeepDiveStats struct {
+	Sent, Lost int
+	Current    time.Duration // the latest answered probe
+	LastLost   bool          // the latest probe went unanswered
+	Min        time.Duration
+	Avg        time.Duration
+	Max        time.Duration
+	Jitter     time.Duration // mean difference between consecutive answered probes
+}
+
+// Loss is the percentage of probes that went unanswered.
+func (s DeepDiveStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(s.Sent) * 100
+}
+
+// Stats summarizes the samples.
+func (d *DeepDive) Stats() DeepDiveStats {
+	var s DeepDiveStats
+	var total, diffs time.Duration
+	var prev time.Duration
+	answered := 0
+	for _, x := range d.Samples {
+		s.Sent++
+		s.LastLost = x.Lost
+		if x.Lost {
+			s.Lost++
+			continue
+		}
+		if answered == 0 || x.RTT < s.Min {
+			s.Min = x.RTT
+		}
+		s.Max = max(s.Max, x.RTT)
+		if answered > 0 {
+			diffs += (x.RTT - prev).Abs()
+		}
+		total += x.RTT
+		prev = x.RTT
+		s.Current = x.RTT
+		answered++
+	}
+	if answered > 0 {
+		s.Avg = total / time.Duration(answered)
+	}
+	if answered > 1 {
+		s.Jitter = diffs / time.Duration(answered-1)
+	}
+	return s
+}
+
+// WriteCSV writes the samples as time,rtt_ms,lost rows under a header.
+func (d *DeepDive) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "rtt_ms", "lost"})
+	for _, x := range d.Samples {
+		rtt := ""
+		if !x.Lost {
+			rtt = strconv.FormatFloat(float64(x.RTT)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		cw.Write([]string{x.Time.Format(time.RFC3339Nano), rtt, strconv.FormatBool(x.Lost)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ParseDeepDive checks the configured deep-dive rate and duration; 0 and
+// "" mean DefaultDeepDiveRate and DefaultDeepDiveDuration.
+func ParseDeepDive(rate int, duration string) (int, time.Duration, error) {
+	if rate == 0 {
+		rate = DefaultDeepDiveRate
+	}
+	if rate < 1 || rate > MaxDeepDiveRate {
+		return 0, 0, fmt.Errorf("deep_dive_rate %d: want 1 to %d probes a second", rate, MaxDeepDiveRate)
+	}
+	d := DefaultDeepDiveDuration
+	if duration != "" {
+		var err error
+		if d, err = time.ParseDuration(duration); err != nil || d <= 0 || d > MaxDeepDiveDuration {
+			return 0, 0, fmt.Errorf("deep_dive_duration %q: want a duration up to %s", duration, MaxDeepDiveDuration)
+		}
+	}
+	return rate, d, nil
+}
+
+// StartDeepDive starts a deep-dive of c's remote at rate probes a second
+// for d, ending the one running, if any. It is refused for remotes that
+// are never probed, through -probe-proxy, and with the probe budget used
+// up. It is safe to call while the tracker is running.
+func (t *Tracker) StartDeepDive(c *Connection, rate int, d time.Duration) error {
+	switch {
+	case rate < 1 || rate > MaxDeepDiveRate:
+		return fmt.Errorf("deep-dive rate %d: want 1 to %d probes a second", rate, MaxDeepDiveRate)
+	case d <= 0 || d > MaxDeepDiveDuration:
+		return fmt.Errorf("deep-dive duration %s: want at most %s", d, MaxDeepDiveDuration)
+	case c.State != StateEstablished || c.RemoteAddr == "" || c.RemoteAddr == "0.0.0.0" || c.RemoteAddr == "::" || c.Host != "":
+		return errors.New("deep-dive needs an established local connection")
+	case c.NoProbe != AddrProbeable:
+		return fmt.Errorf("%s is never probed (%s)", c.RemoteAddr, c.NoProbe)
+	case t.source == nil && t.probeProxy != nil && !t.probeProxy.Bypassed(c.RemoteAddr):
+		return errors.New("deep-dive does not run through -probe-proxy")
+	case t.source == nil && !probeMeter.allowed():
+		return ErrProbeBudget
+	}
+	dive := &DeepDive{
+		Key:     c.Key(),
+		App:     c.AppName,
+		Addr:    c.RemoteAddr,
+		Port:    c.RemotePort,
+		Rate:    rate,
+		For:     d,
+		Started: t.now(),
+		stop:    make(chan struct{}),
+	}
+	t.mu.Lock()
+	if t.deepDive != nil {
+		t.endDeepDive(DeepDiveStopped)
+	}
+	t.deepDive = dive
+	t.mu.Unlock()
+	go t.runDeepDive(dive)
+	return nil
+}
+
+// StopDeepDive ends the running deep-dive, if any.
+func (t *Tracker) StopDeepDive() {
+	t.mu.Lock()
+	t.endDeepDive(DeepDiveStopped)
+	t.mu.Unlock()
+}
+
+// DeepDive returns a copy of the running deep-dive, or of the last one,
+// and false if there was none.
+func (t *Tracker) DeepDive() (DeepDive, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.deepDive == nil {
+		return DeepDive{}, false
+	}
+	d := *t.deepDive
+	d.Samples = append([]DeepDiveSample(nil), d.Samples...)
+	d.stop = nil
+	return d, true
+}
+
+// endDeepDive tells the running deep-dive to stop for why. Caller must
+// hold the lock.
+func (t *Tracker) endDeepDive(why DeepDiveEnd) {
+	d := t.deepDive
+	if d == nil || d.End != "" {
+		return
+	}
+	d.End = why
+	close(d.stop)
+}
+
+// deepDiving reports whether a deep-dive is probing addr, whose normal
+// probes are then skipped. Caller must hold the lock.
+func (t *Tracker) deepDiving(addr string) bool {
+	d := t.deepDive
+	return d != nil && d.Running() && d.Addr == addr
+}
+
+// checkDeepDive ends the deep-dive when its connection is gone. Called
+// from scan with the lock held.
+func (t *Tracker) checkDeepDive() {
+	if d := t.deepDive; d != nil && d.Running() && t.connections[d.Key] == nil {
+		t.endDeepDive(DeepDiveClosed)
+	}
+}
+
+// deepDiveClock paces a deep-dive: tick fires for every probe and timeUp
+// when its time is up. Tests replace it to step a deep-dive by hand.
+var deepDiveClock = func(d *DeepDive) (tick, timeUp <-chan time.Time, stop func()) {
+	ticker := time.NewTicker(time.Second / time.Duration(d.Rate))
+	timer := time.NewTimer(d.For)
+	return ticker.C, timer.C, func() {
+		ticker.Stop()
+		timer.Stop()
+	}
+}
+
+// runDeepDive sends the probes of d until its time is up or it is ended.
+func (t *Tracker) runDeepDive(d *DeepDive) {
+	tick, timeUp, stop := deepDiveClock(d)
+	defer stop()
+	inFlight := make(chan struct{}, d.Rate*int(deepDiveTimeout/time.Second+1))
+	why := DeepDiveTimeUp
+loop:
+	for {
+		select {
+		case <-d.stop:
+			break loop
+		case <-timeUp:
+			break loop
+		case <-tick:
+			if t.source == nil && !probeMeter.allowed() {
+				why = DeepDiveBudget
+				break loop
+			}
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				continue // every slot waits on a timeout; this probe would be late
+			}
+			go func(sent time.Time) {
+				defer func() { <-inFlight }()
+				rtt, lost := t.deepProbe(d.Addr, d.Port)
+				t.mu.Lock()
+				if len(d.Samples) < maxDeepDiveSamples {
+					d.addSample(DeepDiveSample{Time: sent, RTT: rtt, Lost: lost})
+				}
+				t.mu.Unlock()
+				t.touch()
+			}(t.now())
+		}
+	}
+	for range cap(inFlight) {
+		inFlight <- struct{}{} // wait for the probes in flight
+	}
+	t.mu.Lock()
+	if d.End == "" {
+		d.End = why
+		close(d.stop)
+	}
+	d.Ended = t.now()
+	t.mu.Unlock()
+	t.touch()
+}
+
+// addSample inserts x in time order: probes answer out of order.
+func (d *DeepDive) addSample(x DeepDiveSample) {
+	i := len(d.Samples)
+	for i > 0 && d.Samples[i-1].Time.After(x.Time) {
+		i--
+	}
+	d.Samples = append(d.Samples, DeepDiveSample{})
+	copy(d.Samples[i+1:], d.Samples[i:])
+	d.Samples[i] = x
+}
+
+// deepProbe is one deep-dive or focus probe: a single connect, counted
+// against the probe budget like any other.
+func (t *Tracker) deepProbe(addr string, port int) (time.Duration, bool) {
+	if t.source != nil {
+		rtt, loss := t.source.Ping(addr, port)
+		return rtt, loss >= 100
+	}
+	start := time.Now()
+	conn, err := dialProbe(context.Background(), "tcp", net.JoinHostPort(addr, strconv.Itoa(port)), deepDiveTimeout)
+	if err != nil {
+		return 0, true
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, false
+}
@@ -0,0 +1,409 @@
+package tracker
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// divePinger is a Source whose probes answer with the next scripted RTT,
+// a negative one meaning lost, and count the probes of each address. With
+// hold set, every probe waits for a value on release first.
+type divePinger struct {
+	fakeSource
+	hold    bool
+	release chan struct{}
+
+	mu      sync.Mutex
+	rtts    []time.Duration
+	pings   map[string]int
+	started int
+}
+
+func newDivePinger(rtts ...time.Duration) *divePinger {
+	return &divePinger{rtts: rtts, pings: make(map[string]int), release: make(chan struct{})}
+}
+
+func (p *divePinger) Ping(addr string, port int) (time.Duration, float64) {
+	p.mu.Lock()
+	p.pings[addr]++
+	p.started++
+	hold := p.hold
+	p.mu.Unlock()
+	if hold {
+		<-p.release
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rtt := 10 * time.Millisecond
+	if len(p.rtts) > 0 {
+		rtt, p.rtts = p.rtts[0], p.rtts[1:]
+	}
+	if rtt < 0 {
+		return 0, 100
+	}
+	return rtt, 0
+}
+
+func (p *divePinger) count(addr string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pings[addr]
+}
+
+func (p *divePinger) inFlight() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.started
+}
+
+// diveClock replaces the deep-dive's ticker and timer for the rest of the
+// test, and the tracker's clock with one that steps a tick's worth of time
+// on every tick sent.
+type diveClock struct {
+	tick, timeUp chan time.Time
+	every        time.Duration
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newDiveClock(t *testing.T, tr *Tracker, every time.Duration) *diveClock {
+	c := &diveClock{
+		tick:   make(chan time.Time),
+		timeUp: make(chan time.Time),
+		every:  every,
+		now:    time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	old := deepDiveClock
+	deepDiveClock = func(*DeepDive) (<-chan time.Time, <-chan time.Time, func()) {
+		return c.tick, c.timeUp, func() {}
+	}
+	t.Cleanup(func() { deepDiveClock = old })
+	tr.SetClock(c.Now)
+	return c
+}
+
+func (c *diveClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// step moves the clock on and sends n ticks, each received before the
+// next is sent.
+func (c *diveClock) step(n int) {
+	for range n {
+		c.mu.Lock()
+		c.now = c.now.Add(c.every)
+		c.mu.Unlock()
+		c.tick <- c.Now()
+	}
+}
+
+// waitDive polls until ok holds of the tracker's deep-dive.
+func waitDive(t *testing.T, tr *Tracker, what string, ok func(DeepDive) bool) DeepDive {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		d, _ := tr.DeepDive()
+		if ok(d) {
+			return d
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %d samples, end %q", what, len(d.Samples), d.End)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParseDeepDive(t *testing.T) {
+	if rate, d, err := ParseDeepDive(0, ""); err != nil || rate != DefaultDeepDiveRate || d != DefaultDeepDiveDuration {
+		t.Errorf("defaults: %d, %s, %v", rate, d, err)
+	}
+	if rate, d, err := ParseDeepDive(4, "5m"); err != nil || rate != 4 || d != 5*time.Minute {
+		t.Errorf("4, 5m: %d, %s, %v", rate, d, err)
+	}
+	for _, tt := range []struct {
+		rate int
+		dur  string
+		want string
+	}{
+		{11, "", "deep_dive_rate 11"},
+		{-1, "", "deep_dive_rate -1"},
+		{1, "5m1s", `deep_dive_duration "5m1s"`},
+		{1, "0s", `deep_dive_duration "0s"`},
+		{1, "soon", `deep_dive_duration "soon"`},
+	} {
+		if _, _, err := ParseDeepDive(tt.rate, tt.dur); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%d, %q: %v", tt.rate, tt.dur, err)
+		}
+	}
+}
+
+func TestDeepDiveStats(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	d := DeepDive{}
+	for i, rtt := range []time.Duration{20 * ms, -1, 30 * ms, 10 * ms, -1} {
+		d.Samples = append(d.Samples, DeepDiveSample{Time: at.Add(time.Duration(i) * 100 * ms), RTT: max(rtt, 0), Lost: rtt < 0})
+	}
+	s := d.Stats()
+	want := DeepDiveStats{Sent: 5, Lost: 2, Current: 10 * ms, LastLost: true, Min: 10 * ms, Avg: 20 * ms, Max: 30 * ms, Jitter: 15 * ms}
+	if s != want {
+		t.Errorf("stats = %+v, want %+v", s, want)
+	}
+	if s.Loss() != 40 {
+		t.Errorf("loss = %v, want 40", s.Loss())
+	}
+	if (&DeepDive{}).Stats() != (DeepDiveStats{}) || (DeepDiveStats{}).Loss() != 0 {
+		t.Error("no samples should give zero stats")
+	}
+
+	var b strings.Builder
+	if err := d.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "time,rtt_ms,lost\n" +
+		"2026-03-01T12:00:00Z,20.000,false\n" +
+		"2026-03-01T12:00:00.1Z,,true\n" +
+		"2026-03-01T12:00:00.2Z,30.000,false\n" +
+		"2026-03-01T12:00:00.3Z,10.000,false\n" +
+		"2026-03-01T12:00:00.4Z,,true\n"
+	if b.String() != wantCSV {
+		t.Errorf("csv:\n%s\nwant:\n%s", b.String(), wantCSV)
+	}
+}
+
+func TestStartDeepDiveRefused(t *testing.T) {
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(newDivePinger())
+	ok := fakeConn("game", "192.0.2.1", 27015)
+	listen := ok
+	listen.State, listen.RemoteAddr = StateListening, "0.0.0.0"
+	remote := ok
+	remote.Host = "nas"
+	multicast := ok
+	multicast.NoProbe = AddrMulticast
+	for _, tt := range []struct {
+		name string
+		c    Connection
+		rate int
+		d    time.Duration
+		want string
+	}{
+		{"rate 0", ok, 0, time.Minute, "deep-dive rate 0"},
+		{"rate 11", ok, 11, time.Minute, "deep-dive rate 11"},
+		{"no duration", ok, 10, 0, "deep-dive duration 0s"},
+		{"too long", ok, 10, 6 * time.Minute, "deep-dive duration 6m0s"},
+		{"listener", listen, 10, time.Minute, "deep-dive needs an established local connection"},
+		{"remote host", remote, 10, time.Minute, "deep-dive needs an established local connection"},
+		{"multicast", multicast, 10, time.Minute, "192.0.2.1 is never probed"},
+	} {
+		if err := tr.StartDeepDive(&tt.c, tt.rate, tt.d); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+	if _, ok := tr.DeepDive(); ok {
+		t.Error("a refused deep-dive was recorded")
+	}
+}
+
+// TestDeepDiveScheduler steps a deep-dive tick by tick: one probe per
+// tick, stamped with the tick's time, until its time is up.
+func TestDeepDiveScheduler(t *testing.T) {
+	ms := time.Millisecond
+	p := newDivePinger(12*ms, 15*ms, -1, 11*ms)
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(p)
+	clock := newDiveClock(t, tr, 100*ms)
+	start := clock.Now()
+	c := fakeConn("game", "192.0.2.1", 27015)
+	if err := tr.StartDeepDive(&c, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := tr.DeepDive()
+	if !d.Running() || d.Key != c.Key() || d.Addr != "192.0.2.1" || d.Port != 27015 || d.Rate != 10 || !d.Started.Equal(start) {
+		t.Fatalf("started %+v", d)
+	}
+
+	for i := range 4 {
+		g := tr.Generation()
+		clock.step(1)
+		waitDive(t, tr, "a sample", func(d DeepDive) bool { return len(d.Samples) == i+1 })
+		// The views show the samples, so each one moves the generation on.
+		for deadline := time.Now().Add(2 * time.Second); tr.Generation() == g; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("sample %d left the generation alone", i+1)
+			}
+		}
+	}
+	clock.timeUp <- clock.Now()
+	d = waitDive(t, tr, "the end", func(d DeepDive) bool { return !d.Running() })
+
+	if d.End != DeepDiveTimeUp || !d.Ended.Equal(start.Add(400*ms)) {
+		t.Errorf("ended %q at %s", d.End, d.Ended.Sub(start))
+	}
+	for i, x := range d.Samples {
+		if want := start.Add(time.Duration(i+1) * 100 * ms); !x.Time.Equal(want) {
+			t.Errorf("sample %d at %s, want %s", i, x.Time.Sub(start), want.Sub(start))
+		}
+	}
+	if s := d.Stats(); s.Sent != 4 || s.Lost != 1 || s.Min != 11*ms || s.Max != 15*ms {
+		t.Errorf("stats %+v", s)
+	}
+	if p.count("192.0.2.1") != 4 {
+		t.Errorf("%d probes, want 4", p.count("192.0.2.1"))
+	}
+}
+
+// TestDeepDiveOrder checks samples stay in the order probes were sent
+// when a later probe answers first.
+func TestDeepDiveOrder(t *testing.T) {
+	p := newDivePinger(50*time.Millisecond, 5*time.Millisecond)
+	p.hold = true
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(p)
+	clock := newDiveClock(t, tr, 100*time.Millisecond)
+	c := fakeConn("game", "192.0.2.1", 27015)
+	if err := tr.StartDeepDive(&c, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	clock.step(2)
+	for p.inFlight() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	p.release <- struct{}{} // one of the two answers, with 50ms
+	waitDive(t, tr, "the first answer", func(d DeepDive) bool { return len(d.Samples) == 1 })
+	p.release <- struct{}{}
+	d := waitDive(t, tr, "the second answer", func(d DeepDive) bool { return len(d.Samples) == 2 })
+	if !d.Samples[0].Time.Before(d.Samples[1].Time) {
+		t.Errorf("samples out of order: %v then %v", d.Samples[0].Time, d.Samples[1].Time)
+	}
+	tr.StopDeepDive()
+	waitDive(t, tr, "the stop", func(d DeepDive) bool { return !d.Running() })
+}
+
+// TestDeepDiveInFlight checks that with every probe waiting on a timeout
+// the ticks skip probes instead of piling them up, and that the deep-dive
+// ends only once the ones in flight are back.
+func TestDeepDiveInFlight(t *testing.T) {
+	p := newDivePinger()
+	p.hold = true
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(p)
+	clock := newDiveClock(t, tr, time.Second)
+	c := fakeConn("game", "192.0.2.1", 27015)
+	if err := tr.StartDeepDive(&c, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	slots := 1 * int(deepDiveTimeout/time.Second+1)
+	clock.step(slots + 3)
+	for p.inFlight() < slots {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := p.inFlight(); n != slots {
+		t.Fatalf("%d probes in flight, want %d", n, slots)
+	}
+
+	tr.StopDeepDive()
+	time.Sleep(10 * time.Millisecond)
+	if d, _ := tr.DeepDive(); d.End != DeepDiveStopped || !d.Ended.IsZero() {
+		t.Fatalf("ended %q at %v with probes in flight", d.End, d.Ended)
+	}
+	for range slots {
+		p.release <- struct{}{}
+	}
+	d := waitDive(t, tr, "the end", func(d DeepDive) bool { return !d.Running() })
+	if len(d.Samples) != slots {
+		t.Errorf("%d samples, want %d", len(d.Samples), slots)
+	}
+}
+
+// TestDeepDiveSampleBound checks a deep-dive stops keeping samples at
+// the most a full-rate, full-length one can send.
+func TestDeepDiveSampleBound(t *testing.T) {
+	p := newDivePinger()
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(p)
+	clock := newDiveClock(t, tr, 100*time.Millisecond)
+	d := &DeepDive{Addr: "192.0.2.1", Port: 27015, Rate: 10, For: MaxDeepDiveDuration, stop: make(chan struct{})}
+	d.Samples = make([]DeepDiveSample, maxDeepDiveSamples-2)
+	tr.deepDive = d
+	go tr.runDeepDive(d)
+
+	for i := 1; i <= 5; i++ {
+		clock.step(1)
+		for p.count("192.0.2.1") < i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	clock.timeUp <- clock.Now()
+	got := waitDive(t, tr, "the end", func(d DeepDive) bool { return !d.Running() })
+	if len(got.Samples) != maxDeepDiveSamples {
+		t.Errorf("%d samples, want %d", len(got.Samples), maxDeepDiveSamples)
+	}
+	if maxDeepDiveSamples != 3000 {
+		t.Errorf("bound %d, want 10/s for 5 minutes", maxDeepDiveSamples)
+	}
+}
+
+// TestDeepDiveSuspendsProbes checks that scans stop probing the host
+// being deep-dived, and only that one, until the deep-dive ends, and that
+// the deep-dive ends when its connection closes.
+func TestDeepDiveSuspendsProbes(t *testing.T) {
+	p := newDivePinger()
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(p)
+	clock := newDiveClock(t, tr, 100*time.Millisecond)
+	game, web := fakeConn("game", "192.0.2.1", 27015), fakeConn("web", "192.0.2.2", 443)
+	p.set(game, web)
+	tr.scan()
+	if p.count("192.0.2.1") != 1 || p.count("192.0.2.2") != 1 {
+		t.Fatalf("first scan probed %v", p.pings)
+	}
+
+	if err := tr.StartDeepDive(&game, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		tr.scan()
+	}
+	if n := p.count("192.0.2.1"); n != 1 {
+		t.Errorf("scans probed the deep-dived host %d more times", n-1)
+	}
+	if p.count("192.0.2.2") < 2 {
+		t.Error("scans stopped probing the other host")
+	}
+
+	// The deep-dive's own probes are the only ones.
+	clock.step(3)
+	waitDive(t, tr, "three samples", func(d DeepDive) bool { return len(d.Samples) == 3 })
+	if n := p.count("192.0.2.1"); n != 4 {
+		t.Errorf("%d probes of the deep-dived host, want 1 + 3", n)
+	}
+
+	// A second deep-dive ends the first.
+	if err := tr.StartDeepDive(&game, 5, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := tr.DeepDive(); d.Rate != 5 || !d.Running() || len(d.Samples) != 0 {
+		t.Fatalf("second deep-dive %+v", d)
+	}
+
+	p.set(web)
+	tr.scan()
+	d := waitDive(t, tr, "the end", func(d DeepDive) bool { return !d.Running() })
+	if d.End != DeepDiveClosed {
+		t.Errorf("ended %q, want %q", d.End, DeepDiveClosed)
+	}
+	p.set(game, web)
+	before := p.count("192.0.2.1")
+	for range 10 {
+		tr.scan()
+	}
+	if p.count("192.0.2.1") == before {
+		t.Error("probes of the host did not resume after the deep-dive")
+	}
+}
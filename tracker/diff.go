@@ -0,0 +1,110 @@
+package tracker
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeKind classifies a difference between two snapshots.
+type ChangeKind string
+
+const (
+	ChangeNew    ChangeKind = "new"
+	ChangeClosed ChangeKind = "closed"
+	ChangeState  ChangeKind = "state"
+	ChangePing   ChangeKind = "ping"
+	ChangeRate   ChangeKind = "rate"
+)
+
+// Change is one typed difference between two snapshots.
+type Change struct {
+	Kind     ChangeKind
+	Conn     *Connection // current connection (previous one for ChangeClosed)
+	OldState ConnState
+	OldPing  time.Duration
+	OldRate  float64 // TX+RX bytes/sec, for ChangeRate
+}
+
+// DiffOptions controls what counts as a material change.
+type DiffOptions struct {
+	// PingChangePct is the relative ping change (in percent) that is reported.
+	PingChangePct float64
+	// PingChangeMin ignores ping moves smaller than this, whatever the ratio.
+	PingChangeMin time.Duration
+	// RateThreshold reports a connection whose TX+RX rate crosses this value
+	// (bytes/sec) in either direction. Zero disables rate changes.
+	RateThreshold float64
+}
+
+// DefaultDiffOptions reports ping moves of at least 50% and 20ms.
+var DefaultDiffOptions = DiffOptions{PingChangePct: 50, PingChangeMin: 20 * time.Millisecond}
+
+// DiffSnapshots compares two snapshots by connection key. Changes are ordered
+// by kind (new, closed, state, ping, rate) and then by app name.
+func DiffSnapshots(prev, cur []*Connection, opts DiffOptions) []Change {
+	before := make(map[string]*Connection, len(prev))
+	for _, c := range prev {
+		before[c.Key()] = c
+	}
+
+	var changes []Change
+	seen := make(map[string]bool, len(cur))
+	for _, c := range cur {
+		key := c.Key()
+		seen[key] = true
+		old, ok := before[key]
+		if !ok {
+			changes = append(changes, Change{Kind: ChangeNew, Conn: c})
+			continue
+		}
+		if old.State != c.State {
+			changes = append(changes, Change{Kind: ChangeState, Conn: c, OldState: old.State})
+		}
+		if pingMoved(old.Ping, c.Ping, opts) {
+			changes = append(changes, Change{Kind: ChangePing, Conn: c, OldPing: old.Ping})
+		}
+		if rateCrossed(old.TxRate+old.RxRate, c.TxRate+c.RxRate, opts) {
+			changes = append(changes, Change{Kind: ChangeRate, Conn: c, OldRate: old.TxRate + old.RxRate})
+		}
+	}
+	for _, c := range prev {
+		if !seen[c.Key()] {
+			changes = append(changes, Change{Kind: ChangeClosed, Conn: c})
+		}
+	}
+
+	order := map[ChangeKind]int{ChangeNew: 0, ChangeClosed: 1, ChangeState: 2, ChangePing: 3, ChangeRate: 4}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if order[a.Kind] != order[b.Kind] {
+			return order[a.Kind] < order[b.Kind]
+		}
+		return strings.ToLower(a.Conn.AppName) < strings.ToLower(b.Conn.AppName)
+	})
+	return changes
+}
+
+// pingMoved reports whether a ping change is large enough to report.
+// Appearing or disappearing measurements (zero on one side) are not changes.
+func pingMoved(old, cur time.Duration, opts DiffOptions) bool {
+	if old <= 0 || cur <= 0 {
+		return false
+	}
+	delta := cur - old
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta < opts.PingChangeMin {
+		return false
+	}
+	return float64(delta)/float64(old)*100 >= opts.PingChangePct
+}
+
+// rateCrossed reports whether a rate moved across the threshold.
+func rateCrossed(old, cur float64, opts DiffOptions) bool {
+	if opts.RateThreshold <= 0 {
+		return false
+	}
+	return (old >= opts.RateThreshold) != (cur >= opts.RateThreshold)
+}
@@ -0,0 +1,99 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	conn := func(app string, port int, state ConnState, ping time.Duration, rate float64) *Connection {
+		return &Connection{AppName: app, PID: 1, Protocol: "tcp", RemoteAddr: "192.0.2.1", RemotePort: port,
+			State: state, Ping: ping, RxRate: rate}
+	}
+	opts := DiffOptions{PingChangePct: 50, PingChangeMin: 20 * time.Millisecond, RateThreshold: 1000}
+
+	prev := []*Connection{
+		conn("same", 1, StateEstablished, 100*time.Millisecond, 10),
+		conn("gone", 2, StateEstablished, 0, 0),
+		conn("state", 3, StateEstablished, 0, 0),
+		conn("Ping", 4, StateEstablished, 100*time.Millisecond, 0),
+		conn("rate", 5, StateEstablished, 0, 500),
+		conn("busy", 6, StateEstablished, 0, 5000),
+		conn("small", 7, StateEstablished, 10*time.Millisecond, 0),
+		conn("appears", 8, StateEstablished, 0, 0),
+	}
+	cur := []*Connection{
+		conn("same", 1, StateEstablished, 140*time.Millisecond, 20), // +40%: under the ratio
+		conn("state", 3, StateCloseWait, 0, 0),
+		conn("Ping", 4, StateEstablished, 40*time.Millisecond, 0),
+		conn("rate", 5, StateEstablished, 0, 1500),
+		conn("busy", 6, StateEstablished, 0, 900),
+		conn("small", 7, StateEstablished, 25*time.Millisecond, 0),   // +150% but only 15ms
+		conn("appears", 8, StateEstablished, 30*time.Millisecond, 0), // a first measurement
+		conn("new", 9, StateSynSent, 0, 0),
+	}
+
+	got := DiffSnapshots(prev, cur, opts)
+	want := []struct {
+		kind ChangeKind
+		app  string
+	}{
+		{ChangeNew, "new"},
+		{ChangeClosed, "gone"},
+		{ChangeState, "state"},
+		{ChangePing, "Ping"},
+		{ChangeRate, "busy"},
+		{ChangeRate, "rate"},
+	}
+	if len(got) != len(want) {
+		for _, ch := range got {
+			t.Logf("%s %s", ch.Kind, ch.Conn.AppName)
+		}
+		t.Fatalf("%d changes, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].Conn.AppName != w.app {
+			t.Errorf("change %d: %s %s, want %s %s", i, got[i].Kind, got[i].Conn.AppName, w.kind, w.app)
+		}
+	}
+	if got[2].OldState != StateEstablished || got[2].Conn.State != StateCloseWait {
+		t.Errorf("state change %s -> %s", got[2].OldState, got[2].Conn.State)
+	}
+	if got[3].OldPing != 100*time.Millisecond {
+		t.Errorf("old ping %v", got[3].OldPing)
+	}
+	if got[4].OldRate != 5000 || got[5].OldRate != 500 {
+		t.Errorf("old rates %v, %v", got[4].OldRate, got[5].OldRate)
+	}
+	if got[1].Conn != prev[1] {
+		t.Error("a closed change does not carry the previous connection")
+	}
+}
+
+func TestDiffSnapshotsNoRateThreshold(t *testing.T) {
+	a := &Connection{AppName: "a", RxRate: 0}
+	b := &Connection{AppName: "a", RxRate: 1e9}
+	if got := DiffSnapshots([]*Connection{a}, []*Connection{b}, DefaultDiffOptions); len(got) != 0 {
+		t.Fatalf("rate change reported without a threshold: %v", got)
+	}
+}
+
+func TestPingMoved(t *testing.T) {
+	tests := []struct {
+		old, cur time.Duration
+		want     bool
+	}{
+		{100 * time.Millisecond, 150 * time.Millisecond, true},
+		{100 * time.Millisecond, 149 * time.Millisecond, false},
+		{100 * time.Millisecond, 50 * time.Millisecond, true},
+		{10 * time.Millisecond, 29 * time.Millisecond, false}, // under 20ms
+		{10 * time.Millisecond, 30 * time.Millisecond, true},
+		{0, 500 * time.Millisecond, false},
+		{500 * time.Millisecond, 0, false},
+	}
+	for _, tt := range tests {
+		if got := pingMoved(tt.old, tt.cur, DefaultDiffOptions); got != tt.want {
+			t.Errorf("pingMoved(%v, %v) = %v", tt.old, tt.cur, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsHeaderLen = 12
+	dnsMaxReply  = 512 // a UDP reply without EDNS
+	udpHeaderLen = 8
+
+	dnsTypeA   = 1
+	dnsClassIN = 1
+)
+
+// dnsRcodes names the common response codes.
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+func dnsRcodeName(rcode int) string {
+	if rcode < len(dnsRcodes) {
+		return dnsRcodes[rcode]
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// dnsQuery encodes a recursive query for the A records of name.
+func dnsQuery(id uint16, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return nil, fmt.Errorf("query %q is not a domain name", name)
+	}
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)      // QDCOUNT
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("query %q is not a domain name", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, dnsTypeA, 0, dnsClassIN)
+	return msg, nil
+}
+
+// parseDNSReply checks that reply answers query and returns its RCODE.
+// The question must come back as it was asked.
+func parseDNSReply(query, reply []byte) (int, error) {
+	if len(reply) < dnsHeaderLen {
+		return 0, fmt.Errorf("malformed reply: %d bytes", len(reply))
+	}
+	if !bytes.Equal(reply[:2], query[:2]) {
+		return 0, errors.New("malformed reply: wrong ID")
+	}
+	flags := binary.BigEndian.Uint16(reply[2:])
+	switch {
+	case flags&0x8000 == 0:
+		return 0, errors.New("malformed reply: not a response")
+	case flags&0x7800 != 0:
+		return 0, errors.New("malformed reply: wrong opcode")
+	}
+	rcode := int(flags & 0x000f)
+	question := query[dnsHeaderLen:]
+	qd := binary.BigEndian.Uint16(reply[4:])
+	// A server refusing the query may leave the question out.
+	if qd != 0 && (qd != 1 || !bytes.HasPrefix(reply[dnsHeaderLen:], question)) {
+		return 0, errors.New("malformed reply: question does not match")
+	}
+	return rcode, nil
+}
+
+// checkDNS asks the server at target for the A records of name over
+// network ("udp" or "tcp") and records the RCODE and answer time.
+// NOERROR and NXDOMAIN are healthy answers: the server resolved the name.
+func checkDNS(ctx context.Context, network, target, name string, r *ServiceCheck) error {
+	var id [2]byte
+	rand.Read(id[:])
+	query, err := dnsQuery(binary.BigEndian.Uint16(id[:]), name)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	var reply []byte
+	if network == "udp" {
+		reply, err = exchangeUDP(ctx, target, query)
+	} else {
+		reply, err = exchangeTCP(ctx, target, query)
+	}
+	if err != nil {
+		return err
+	}
+	r.Latency = time.Since(start)
+	rcode, err := parseDNSReply(query, reply)
+	if err != nil {
+		return err
+	}
+	r.Status = dnsRcodeName(rcode)
+	if rcode != 0 && rcode != 3 {
+		return fmt.Errorf("server answered %s", r.Status)
+	}
+	r.OK = true
+	return nil
+}
+
+// exchangeUDP sends query in one datagram and returns the first reply with
+// its ID; stray datagrams are skipped.
+func exchangeUDP(ctx context.Context, target string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip := ipHeaderBytes(conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	probeMeter.add(ProbeTraffic{Sent: ip + udpHeaderLen + uint64(len(query))})
+	buf := make([]byte, dnsMaxReply)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		probeMeter.add(ProbeTraffic{Received: ip + udpHeaderLen + uint64(n)})
+		if n >= 2 && bytes.Equal(buf[:2], query[:2]) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// exchangeTCP sends query with its two-byte length prefix and reads the
+// reply the same way.
+func exchangeTCP(ctx context.Context, target string, query []byte) ([]byte, error) {
+	conn, err := dialProbe(ctx, "tcp", target, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, fmt.Errorf("no reply: %w", err)
+	}
+	reply := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("malformed reply: %w", err)
+	}
+	return reply, nil
+}
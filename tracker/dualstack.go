@@ -0,0 +1,230 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dualStackResolveEvery is how often dual-stack targets are resolved again,
+// so a changed A or AAAA record is picked up.
+const dualStackResolveEvery = 5 * time.Minute
+
+// dualStackLookupTimeout bounds one target's name lookup.
+const dualStackLookupTimeout = 5 * time.Second
+
+// FamilyPing is one address family's side of a dual-stack target.
+type FamilyPing struct {
+	Addr   string        // address probed; empty when the name has none in this family
+	RTT    time.Duration // average connect time of the last probe; 0 when all failed
+	Loss   float64       // loss of the last probe (0-100)
+	Probes int           // probes made since the address was resolved
+}
+
+// Measured reports whether the family has a successful measurement.
+func (f FamilyPing) Measured() bool {
+	return f.Addr != "" && f.Probes > 0 && f.RTT > 0
+}
+
+// DualStackTarget is a host:port probed over IPv4 and IPv6 separately.
+type DualStackTarget struct {
+	Name       string // host:port as configured
+	V4, V6     FamilyPing
+	Resolved   time.Time // last successful lookup; zero before the first
+	ResolveErr string    // error of the last lookup, if it failed
+}
+
+// Delta is the IPv6 RTT minus the IPv4 RTT; ok is false unless both
+// families have a measurement.
+func (d DualStackTarget) Delta() (delta time.Duration, ok bool) {
+	if !d.V4.Measured() || !d.V6.Measured() {
+		return 0, false
+	}
+	return d.V6.RTT - d.V4.RTT, true
+}
+
+// DualStackDelta is the average Delta over the targets that have both
+// families measured, and how many those are.
+func DualStackDelta(targets []DualStackTarget) (avg time.Duration, n int) {
+	var sum time.Duration
+	for _, t := range targets {
+		if d, ok := t.Delta(); ok {
+			sum += d
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / time.Duration(n), n
+}
+
+// dualStackLookup resolves a host to its addresses.
+type dualStackLookup func(ctx context.Context, host string) ([]netip.Addr, error)
+
+// dualStackPing probes addr:port over network ("tcp4" or "tcp6").
+type dualStackPing func(network, addr string, port int) (time.Duration, float64)
+
+// DualStack measures configured targets over each address family on its
+// own, to compare the IPv4 and IPv6 paths to the same service. Names are
+// resolved for both A and AAAA records, and each family is probed with
+// the same TCP connect as connections, dialing "tcp4" or "tcp6". It is
+// safe for concurrent use.
+type DualStack struct {
+	mu      sync.Mutex
+	targets []DualStackTarget
+	hosts   []string
+	ports   []int
+
+	lookup dualStackLookup
+	ping   dualStackPing
+	heat   *Heatmap // nil until SetDualStack
+}
+
+// NewDualStack validates targets of the form host:port. A literal address
+// is probed in its own family only.
+func NewDualStack(targets []string) (*DualStack, error) {
+	d := &DualStack{
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		ping: measurePing,
+	}
+	for _, t := range targets {
+		host, portStr, err := net.SplitHostPort(t)
+		if err != nil {
+			return nil, fmt.Errorf("dual-stack target %q: %v", t, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 || host == "" {
+			return nil, fmt.Errorf("dual-stack target %q: want host:port", t)
+		}
+		d.targets = append(d.targets, DualStackTarget{Name: t})
+		d.hosts = append(d.hosts, host)
+		d.ports = append(d.ports, port)
+	}
+	return d, nil
+}
+
+// Targets returns the targets' latest results, in configured order.
+func (d *DualStack) Targets() []DualStackTarget {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DualStackTarget(nil), d.targets...)
+}
+
+// Probe resolves the targets that are due and probes every target over
+// both families, all concurrently. It returns when all probes are done.
+func (d *DualStack) Probe(now time.Time) {
+	var wg sync.WaitGroup
+	for i := range d.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.mu.Lock()
+			resolved := d.targets[i].Resolved
+			d.mu.Unlock()
+			if resolved.IsZero() || now.Sub(resolved) >= dualStackResolveEvery {
+				d.resolve(i, now)
+			}
+
+			d.mu.Lock()
+			v4, v6 := d.targets[i].V4.Addr, d.targets[i].V6.Addr
+			d.mu.Unlock()
+			var fam sync.WaitGroup
+			fam.Add(2)
+			go func() { defer fam.Done(); d.probeFamily(i, "tcp4", v4) }()
+			go func() { defer fam.Done(); d.probeFamily(i, "tcp6", v6) }()
+			fam.Wait()
+		}()
+	}
+	wg.Wait()
+}
+
+// probeFamily probes target i at addr over network and keeps the result,
+// unless the target was resolved to another address meanwhile.
+func (d *DualStack) probeFamily(i int, network, addr string) {
+	if addr == "" {
+		return
+	}
+	rtt, loss := d.ping(network, addr, d.ports[i])
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fp := &d.targets[i].V4
+	if network == "tcp6" {
+		fp = &d.targets[i].V6
+	}
+	if fp.Addr == addr {
+		fp.RTT, fp.Loss = rtt, loss
+		fp.Probes++
+		if d.heat != nil {
+			d.heat.Add(HeatSeries(d.targets[i].Name, network), time.Now(), rtt, loss)
+		}
+	}
+}
+
+// HeatSeries is the heatmap series of a dual-stack target's family
+// ("tcp4" or "tcp6"), e.g. "example.com:443 IPv6".
+func HeatSeries(target, network string) string {
+	if network == "tcp6" {
+		return target + " IPv6"
+	}
+	return target + " IPv4"
+}
+
+// resolve looks up target i and keeps the first address of each family.
+// A failed lookup keeps the previous addresses; a family that disappeared
+// from the records loses its results.
+func (d *DualStack) resolve(i int, now time.Time) {
+	var addrs []netip.Addr
+	var err error
+	if ip, perr := netip.ParseAddr(d.hosts[i]); perr == nil {
+		addrs = []netip.Addr{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), dualStackLookupTimeout)
+		addrs, err = d.lookup(ctx, d.hosts[i])
+		cancel()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := &d.targets[i]
+	if err != nil {
+		t.ResolveErr = err.Error()
+		return
+	}
+	var v4, v6 string
+	for _, a := range addrs {
+		a = a.Unmap()
+		switch {
+		case a.Is4() && v4 == "":
+			v4 = a.String()
+		case a.Is6() && v6 == "":
+			v6 = a.String()
+		}
+	}
+	if t.V4.Addr != v4 {
+		t.V4 = FamilyPing{Addr: v4}
+	}
+	if t.V6.Addr != v6 {
+		t.V6 = FamilyPing{Addr: v6}
+	}
+	t.Resolved, t.ResolveErr = now, ""
+}
+
+// SetDualStack probes d's targets after every ping cycle, and records
+// the results in the heatmap. Must be called before Start.
+func (t *Tracker) SetDualStack(d *DualStack) {
+	d.heat = t.heatmap
+	t.dualStack = d
+}
+
+// DualStack returns the dual-stack prober, or nil when there are no
+// targets.
+func (t *Tracker) DualStack() *DualStack {
+	return t.dualStack
+}
@@ -0,0 +1,144 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFamilies answers lookups from a table and pings with a fixed RTT and
+// loss per family, recording what it was asked.
+type fakeFamilies struct {
+	mu      sync.Mutex
+	records map[string][]netip.Addr
+	err     error
+	lookups int
+	pings   []string // "network addr:port"
+}
+
+func (f *fakeFamilies) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.records[host], nil
+}
+
+func (f *fakeFamilies) ping(network, addr string, port int) (time.Duration, float64) {
+	f.mu.Lock()
+	f.pings = append(f.pings, network+" "+netip.AddrPortFrom(netip.MustParseAddr(addr), uint16(port)).String())
+	f.mu.Unlock()
+	if network == "tcp6" {
+		return 30 * time.Millisecond, 50
+	}
+	return 10 * time.Millisecond, 0
+}
+
+func newFakeDualStack(t *testing.T, f *fakeFamilies, targets ...string) *DualStack {
+	t.Helper()
+	d, err := NewDualStack(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.lookup, d.ping = f.lookup, f.ping
+	return d
+}
+
+func TestDualStackProbesEachFamily(t *testing.T) {
+	f := &fakeFamilies{records: map[string][]netip.Addr{
+		"both.test": {
+			netip.MustParseAddr("::ffff:192.0.2.1"), // mapped: counts as IPv4
+			netip.MustParseAddr("2001:db8::1"),
+			netip.MustParseAddr("192.0.2.2"),
+			netip.MustParseAddr("2001:db8::2"),
+		},
+		"v6only.test": {netip.MustParseAddr("2001:db8::6")},
+	}}
+	d := newFakeDualStack(t, f, "both.test:443", "v6only.test:8443", "192.0.2.9:22")
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.Probe(t0)
+
+	slices.Sort(f.pings)
+	want := []string{"tcp4 192.0.2.1:443", "tcp4 192.0.2.9:22", "tcp6 [2001:db8::1]:443", "tcp6 [2001:db8::6]:8443"}
+	if !slices.Equal(f.pings, want) {
+		t.Errorf("probed %v, want %v", f.pings, want)
+	}
+	if f.lookups != 2 {
+		t.Errorf("%d lookups: a literal address is not looked up", f.lookups)
+	}
+
+	got := d.Targets()
+	both := got[0]
+	if both.V4 != (FamilyPing{"192.0.2.1", 10 * time.Millisecond, 0, 1}) || both.V6 != (FamilyPing{"2001:db8::1", 30 * time.Millisecond, 50, 1}) {
+		t.Errorf("both.test: v4 %+v, v6 %+v", both.V4, both.V6)
+	}
+	if delta, ok := both.Delta(); !ok || delta != 20*time.Millisecond {
+		t.Errorf("delta %v %v", delta, ok)
+	}
+	if v6 := got[1]; v6.V4.Addr != "" || v6.V4.Probes != 0 || !v6.V6.Measured() {
+		t.Errorf("v6only.test: %+v", v6)
+	}
+	if _, ok := got[1].Delta(); ok {
+		t.Error("delta with one family")
+	}
+	if lit := got[2]; lit.V4.Addr != "192.0.2.9" || lit.V6.Addr != "" || !lit.Resolved.Equal(t0) {
+		t.Errorf("literal: %+v", lit)
+	}
+	if avg, n := DualStackDelta(got); n != 1 || avg != 20*time.Millisecond {
+		t.Errorf("average delta %v over %d", avg, n)
+	}
+}
+
+func TestDualStackResolve(t *testing.T) {
+	f := &fakeFamilies{records: map[string][]netip.Addr{
+		"svc.test": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")},
+	}}
+	d := newFakeDualStack(t, f, "svc.test:443")
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.Probe(t0)
+	d.Probe(t0.Add(dualStackResolveEvery - time.Second))
+	if f.lookups != 1 || d.Targets()[0].V4.Probes != 2 {
+		t.Fatalf("%d lookups, %d probes before the re-resolve", f.lookups, d.Targets()[0].V4.Probes)
+	}
+
+	// A failed lookup keeps the addresses and their results.
+	f.err = errors.New("no such host")
+	d.Probe(t0.Add(dualStackResolveEvery))
+	got := d.Targets()[0]
+	if f.lookups != 2 || got.ResolveErr != "no such host" || got.V4.Probes != 3 || got.V6.Probes != 3 {
+		t.Errorf("after a failed lookup: %d lookups, %+v", f.lookups, got)
+	}
+
+	// A changed AAAA record starts IPv6 over; IPv4 keeps its count.
+	f.err = nil
+	f.records["svc.test"] = []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::99")}
+	d.Probe(t0.Add(dualStackResolveEvery + time.Second))
+	got = d.Targets()[0]
+	if got.ResolveErr != "" || got.V4.Probes != 4 || got.V6.Addr != "2001:db8::99" || got.V6.Probes != 1 {
+		t.Errorf("after a changed record: %+v", got)
+	}
+
+	// A family gone from the records loses its results.
+	f.records["svc.test"] = []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	d.Probe(t0.Add(3 * dualStackResolveEvery))
+	if got := d.Targets()[0]; got.V6 != (FamilyPing{}) {
+		t.Errorf("IPv6 kept after its record went: %+v", got.V6)
+	}
+}
+
+func TestNewDualStack(t *testing.T) {
+	for _, bad := range []string{"example.com", "example.com:0", "example.com:https", ":443", "[2001:db8::1]:70000"} {
+		if _, err := NewDualStack([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	if _, err := NewDualStack([]string{"example.com:443", "[2001:db8::1]:443"}); err != nil {
+		t.Error(err)
+	}
+}
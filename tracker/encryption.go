@@ -0,0 +1,50 @@
+package tracker
+
+// Encryption is a heuristic guess at whether a connection's payload is encrypted.
+type Encryption string
+
+const (
+	EncUnknown   Encryption = ""
+	EncEncrypted Encryption = "yes"
+	EncPlaintext Encryption = "no"
+)
+
+// portEncryption classifies well-known ports.
+var portEncryption = map[int]Encryption{
+	22:  EncEncrypted, // ssh
+	443: EncEncrypted, // https
+	465: EncEncrypted, // smtps
+	853: EncEncrypted, // dns-over-tls
+	993: EncEncrypted, // imaps
+	995: EncEncrypted, // pop3s
+	21:  EncPlaintext, // ftp
+	23:  EncPlaintext, // telnet
+	25:  EncPlaintext, // smtp
+	80:  EncPlaintext, // http
+	110: EncPlaintext, // pop3
+	143: EncPlaintext, // imap
+}
+
+// ClassifyEncryption guesses whether a connection is encrypted. User overrides
+// win, then the port table (remote port first, then local), then whether the
+// owning process has a TLS library mapped. The second return value names the
+// rule that decided, for display.
+func ClassifyEncryption(c *Connection, overrides map[int]bool, hasTLSLib bool) (Encryption, string) {
+	for _, port := range []int{c.RemotePort, c.LocalPort} {
+		if enc, ok := overrides[port]; ok {
+			if enc {
+				return EncEncrypted, "config override"
+			}
+			return EncPlaintext, "config override"
+		}
+	}
+	for _, port := range []int{c.RemotePort, c.LocalPort} {
+		if enc, ok := portEncryption[port]; ok {
+			return enc, "well-known port"
+		}
+	}
+	if hasTLSLib {
+		return EncEncrypted, "process has TLS library loaded"
+	}
+	return EncUnknown, "no signal"
+}
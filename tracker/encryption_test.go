@@ -0,0 +1,33 @@
+package tracker
+
+import "testing"
+
+func TestClassifyEncryption(t *testing.T) {
+	tests := []struct {
+		name       string
+		local      int
+		remote     int
+		overrides  map[int]bool
+		tlsLib     bool
+		want       Encryption
+		wantSource string
+	}{
+		{"https", 50000, 443, nil, false, EncEncrypted, "well-known port"},
+		{"http", 50000, 80, nil, false, EncPlaintext, "well-known port"},
+		{"ssh server", 22, 50000, nil, false, EncEncrypted, "well-known port"},
+		{"remote port wins", 80, 443, nil, false, EncEncrypted, "well-known port"},
+		{"unknown port", 50000, 9000, nil, false, EncUnknown, "no signal"},
+		{"tls library", 50000, 9000, nil, true, EncEncrypted, "process has TLS library loaded"},
+		{"port beats tls library", 50000, 80, nil, true, EncPlaintext, "well-known port"},
+		{"override encrypted", 50000, 8443, map[int]bool{8443: true}, false, EncEncrypted, "config override"},
+		{"override beats port table", 50000, 443, map[int]bool{443: false}, false, EncPlaintext, "config override"},
+		{"override on local port", 8080, 50000, map[int]bool{8080: false}, true, EncPlaintext, "config override"},
+	}
+	for _, tt := range tests {
+		c := &Connection{LocalPort: tt.local, RemotePort: tt.remote}
+		got, source := ClassifyEncryption(c, tt.overrides, tt.tlsLib)
+		if got != tt.want || source != tt.wantSource {
+			t.Errorf("%s: got %q (%s), want %q (%s)", tt.name, got, source, tt.want, tt.wantSource)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package tracker
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity ranks events for an event log's floor.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarn
+	SeverityCrit
+)
+
+var severityNames = []string{"info", "warn", "crit"}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return "info"
+}
+
+// ParseSeverity parses "info", "warn" or "crit"; "" is info.
+func ParseSeverity(s string) (Severity, error) {
+	if s == "" {
+		return SeverityInfo, nil
+	}
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("event_log_level: %q is not info, warn or crit", s)
+}
+
+// Event kinds.
+const (
+	EventConnOpened     = "conn_opened" // a connection of a watched app (SetEventApps)
+	EventConnClosed     = "conn_closed"
+	EventAlertRaised    = "alert_raised"
+	EventAlertCleared   = "alert_cleared"
+	EventNewListener    = "new_listener"
+	EventSchedule       = "schedule"      // a schedule window started or ended
+	EventLoadThrottle   = "load_throttle" // the busy-machine throttle started or ended
+	EventScansBehind    = "scans_behind"  // scans started or stopped overrunning the interval
+	EventClockJump      = "clock_jump"
+	EventProbeBudget    = "probe_budget" // the daily probe budget was used up
+	EventPaused         = "paused"
+	EventResumed        = "resumed"
+	EventMarker         = "marker"
+	EventInjection      = "injection" // an -inject perturbation started
+	EventInjectionDone  = "injection_ended"
+	EventUnreachable    = "unreachable"     // a remote host's outage passed the unreachable alert threshold
+	EventReachable      = "reachable"       // and it answered again
+	EventHalfOpen       = "half_open"       // a connection became, or stopped being, a half-open suspect
+	EventSessionSummary = "session_summary" // written by the caller as the UI exits
+)
+
+// EventField is one key=value pair of an Event.
+type EventField struct {
+	Key, Value string
+}
+
+// Event is one line of the event log: something notable, with fields in
+// the order they are written.
+type Event struct {
+	Time     time.Time
+	Severity Severity
+	Kind     string
+	Fields   []EventField
+}
+
+// EventSink receives notable events, e.g. to append them to a log file.
+// LogEvent is called from the scan loop with the tracker's lock held and
+// from the UI, so implementations must queue the event and return at
+// once, without calling back into the tracker.
+type EventSink interface {
+	LogEvent(Event)
+}
+
+// SetEventSink attaches an event log. Must be called before Start.
+func (t *Tracker) SetEventSink(s EventSink) {
+	t.events = s
+}
+
+// SetEventApps sets the apps, by name and ignoring case, whose
+// connections opening and closing are logged. It is safe to call while the
+// tracker is running.
+func (t *Tracker) SetEventApps(apps []string) {
+	set := make(map[string]bool, len(apps))
+	for _, a := range apps {
+		set[strings.ToLower(a)] = true
+	}
+	t.mu.Lock()
+	t.eventApps = set
+	t.mu.Unlock()
+}
+
+// EventLogging reports whether there is an event log.
+func (t *Tracker) EventLogging() bool {
+	return t.events != nil
+}
+
+// LogEvent passes e to the event log, if there is one; the UI uses it for
+// pauses and markers.
+func (t *Tracker) LogEvent(e Event) {
+	if t.events != nil {
+		t.events.LogEvent(e)
+	}
+}
+
+// emit logs an event of kind with fields given as key, value pairs.
+func (t *Tracker) emit(now time.Time, sev Severity, kind string, kv ...string) {
+	if t.events == nil {
+		return
+	}
+	e := Event{Time: now, Severity: sev, Kind: kind, Fields: make([]EventField, 0, len(kv)/2)}
+	for i := 0; i+1 < len(kv); i += 2 {
+		e.Fields = append(e.Fields, EventField{kv[i], kv[i+1]})
+	}
+	t.events.LogEvent(e)
+}
+
+// watched reports whether c's opening and closing are logged. Caller must
+// hold the lock.
+func (t *Tracker) watched(c *Connection) bool {
+	return t.events != nil && t.eventApps[strings.ToLower(c.AppName)]
+}
+
+// emitConn logs a watched connection opening or closing. Caller must hold
+// the lock.
+func (t *Tracker) emitConn(now time.Time, kind string, c *Connection) {
+	kv := []string{"app", c.AppName, "pid", strconv.Itoa(c.PID), "proto", c.DisplayProtocol(),
+		"local", fmt.Sprintf("%s:%d", c.LocalAddr, c.LocalPort),
+		"remote", fmt.Sprintf("%s:%d", c.RemoteAddr, c.RemotePort), "state", string(c.State)}
+	if kind == EventConnClosed {
+		kv = append(kv, "duration", now.Sub(c.FirstSeen).Round(time.Second).String(),
+			"tx_bytes", strconv.FormatUint(c.TxBytes, 10), "rx_bytes", strconv.FormatUint(c.RxBytes, 10))
+	}
+	t.emit(now, SeverityInfo, kind, kv...)
+}
+
+// emitAlerts logs the alerts raised since the previous scan and the ones
+// that cleared, queues them for the trigger rules, and notes scans falling behind the interval or catching
+// up and the probe budget running out. It counts the raised alerts for
+// the session with or without an event log. Called at the end of a scan.
+func (t *Tracker) emitAlerts(now time.Time, snap []*Connection, listenerAlerts []Alert) {
+	for _, a := range listenerAlerts {
+		t.emit(now, SeverityWarn, EventNewListener, "app", a.AppName, "addr", a.Remote, "reason", a.Reason)
+		t.notifyAlert(now, EventAlertRaised, a, nil)
+	}
+	current := make(map[string]Alert)
+	raised := 0
+	var byKey map[string]*Connection // for the trigger rules, once an alert changes
+	conn := func(key string) *Connection {
+		if byKey == nil {
+			byKey = make(map[string]*Connection, len(snap))
+			for _, c := range snap {
+				byKey[c.Key()] = c
+			}
+		}
+		return byKey[key]
+	}
+	for _, a := range t.AlertRule().Evaluate(now, snap) {
+		current[a.Key] = a
+		if _, ok := t.alerting[a.Key]; !ok {
+			t.emit(now, SeverityCrit, EventAlertRaised, "app", a.AppName, "remote", a.Remote, "reason", a.Reason, "key", a.Key)
+			raised++
+			c := conn(a.Key)
+			if c != nil {
+				t.noteTrigger(TriggerAlerting, c, a.Reason)
+			}
+			t.notifyAlert(now, EventAlertRaised, a, c)
+		}
+	}
+	if raised > 0 {
+		t.mu.Lock()
+		t.session.alerts += raised
+		t.mu.Unlock()
+	}
+	for _, key := range slices.Sorted(maps.Keys(t.alerting)) {
+		if _, ok := current[key]; !ok {
+			a := t.alerting[key]
+			t.emit(now, SeverityInfo, EventAlertCleared, "app", a.AppName, "remote", a.Remote, "key", key)
+			c := conn(key)
+			if c != nil {
+				t.noteTrigger(TriggerRecovered, c, a.Reason)
+			}
+			t.notifyAlert(now, EventAlertCleared, a, c)
+		}
+	}
+	t.alerting = current
+
+	if behind := t.Health().Overrunning(); behind != t.behind {
+		t.behind = behind
+		if behind {
+			t.emit(now, SeverityWarn, EventScansBehind, "state", "started", "interval", t.Interval().String(),
+				"effective", t.Health().EffectiveInterval.Round(time.Millisecond).String())
+		} else {
+			t.emit(now, SeverityInfo, EventScansBehind, "state", "ended")
+		}
+	}
+	if u := probeMeter.snapshot(); u.Exceeded != t.budgetExceeded {
+		t.budgetExceeded = u.Exceeded
+		if u.Exceeded {
+			t.emit(now, SeverityWarn, EventProbeBudget, "budget_bytes", strconv.FormatUint(u.Budget, 10))
+		}
+	}
+}
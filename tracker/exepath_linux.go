@@ -0,0 +1,23 @@
+//go:build linux
+
+package tracker
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processExePath returns the executable a process runs from, or "" if it
+// cannot be read. A binary replaced or removed since start keeps the
+// " (deleted)" suffix the kernel adds.
+func processExePath(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	path, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(path)
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package tracker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// processExePath returns the full image path of a process, or "" if it
+// cannot be opened.
+func processExePath(pid int) string {
+	if pid <= 4 {
+		return ""
+	}
+	handle, _, _ := procOpenProcess.Call(PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if handle == 0 {
+		return ""
+	}
+	defer procCloseHandle.Call(handle)
+
+	var buf [1024]uint16
+	size := uint32(len(buf))
+	ret, _, _ := procGetProcessImageFileNameW.Call(
+		handle,
+		0, // Win32 path format
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if ret == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:size])
+}
@@ -0,0 +1,308 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields a derived column expression can use, with the value each takes
+// from a connection and whether the connection has it.
+var exprFields = []struct {
+	name  string
+	value func(c *Connection, now time.Time) (float64, bool)
+}{
+	{"ping_ms", func(c *Connection, _ time.Time) (float64, bool) {
+		return float64(c.Ping) / float64(time.Millisecond), c.Ping > 0 && c.NoProbe == AddrProbeable
+	}},
+	{"loss", func(c *Connection, _ time.Time) (float64, bool) {
+		return c.Loss, c.PingCount > 0 && c.NoProbe == AddrProbeable
+	}},
+	{"tx_rate", func(c *Connection, _ time.Time) (float64, bool) { return c.TxRate, c.HasByteCounts }},
+	{"rx_rate", func(c *Connection, _ time.Time) (float64, bool) { return c.RxRate, c.HasByteCounts }},
+	{"age_s", func(c *Connection, now time.Time) (float64, bool) {
+		return now.Sub(c.FirstSeen).Seconds(), !c.FirstSeen.IsZero()
+	}},
+	{"idle_s", func(c *Connection, now time.Time) (float64, bool) {
+		return now.Sub(c.LastActive).Seconds(), c.HasByteCounts && !c.LastActive.IsZero()
+	}},
+	{"score", func(c *Connection, _ time.Time) (float64, bool) { return float64(c.Score), c.HasScore }},
+}
+
+// exprNode is one node of a parsed expression: a number, a field, a
+// negation (left only) or a binary operator.
+type exprNode struct {
+	op          byte // 'n' number, 'f' field, '~' negation, or + - * /
+	num         float64
+	field       int
+	left, right *exprNode
+}
+
+// Expr is a parsed derived column expression: numbers, the fields of
+// exprFields, + - * /, unary minus and parentheses, with the usual
+// precedence.
+type Expr struct {
+	root *exprNode
+	src  string
+}
+
+// String returns the expression as written.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// ParseExpr parses an expression such as "ping_ms * (1 + loss / 100)".
+func ParseExpr(src string) (*Expr, error) {
+	p := exprParser{src: src}
+	p.next()
+	root, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tok, p.tokPos)
+	}
+	return &Expr{root: root, src: src}, nil
+}
+
+// Eval evaluates e for c. ok is false when a field it uses is missing for
+// c, or on division by zero.
+func (e *Expr) Eval(c *Connection, now time.Time) (v float64, ok bool) {
+	return e.root.eval(c, now)
+}
+
+func (n *exprNode) eval(c *Connection, now time.Time) (float64, bool) {
+	switch n.op {
+	case 'n':
+		return n.num, true
+	case 'f':
+		return exprFields[n.field].value(c, now)
+	case '~':
+		v, ok := n.left.eval(c, now)
+		return -v, ok
+	}
+	a, ok := n.left.eval(c, now)
+	if !ok {
+		return 0, false
+	}
+	b, ok := n.right.eval(c, now)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return a + b, true
+	case '-':
+		return a - b, true
+	case '*':
+		return a * b, true
+	}
+	if b == 0 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+// exprParser is a recursive descent parser over a token at a time.
+type exprParser struct {
+	src    string
+	pos    int
+	tok    string // current token; "" at the end
+	tokPos int
+}
+
+// next reads the next token: a number, an identifier, or one of +-*/().
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	ch := p.src[p.pos]
+	switch {
+	case isExprDigit(ch) || ch == '.':
+		for p.pos < len(p.src) && (isExprDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+	case isExprLetter(ch):
+		for p.pos < len(p.src) && (isExprLetter(p.src[p.pos]) || isExprDigit(p.src[p.pos])) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// sum := product { ("+" | "-") product }
+func (p *exprParser) sum() (*exprNode, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// product := unary { ("*" | "/") unary }
+func (p *exprParser) product() (*exprNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := "-" unary | "(" sum ")" | number | field
+func (p *exprParser) unary() (*exprNode, error) {
+	tok, at := p.tok, p.tokPos
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "-":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: '~', left: operand}, nil
+	case tok == "(":
+		p.next()
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", at)
+		}
+		p.next()
+		return inner, nil
+	case isExprDigit(tok[0]) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", tok, at)
+		}
+		p.next()
+		return &exprNode{op: 'n', num: v}, nil
+	case isExprLetter(tok[0]):
+		for i, f := range exprFields {
+			if f.name == tok {
+				p.next()
+				return &exprNode{op: 'f', field: i}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown identifier %q (want %s)", tok, exprFieldNames())
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", tok, at)
+}
+
+func isExprDigit(ch byte) bool  { return ch >= '0' && ch <= '9' }
+func isExprLetter(ch byte) bool { return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' }
+
+func exprFieldNames() string {
+	names := make([]string, len(exprFields))
+	for i, f := range exprFields {
+		names[i] = f.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// DerivedColumn is a user-defined column computed from other fields.
+type DerivedColumn struct {
+	Name string
+	Expr *Expr
+}
+
+// ParseDerivedColumn parses one derived_columns entry; the error names
+// the column.
+func ParseDerivedColumn(name, expr string) (DerivedColumn, error) {
+	if strings.TrimSpace(name) == "" {
+		return DerivedColumn{}, fmt.Errorf("derived_columns: column with expression %q has no name", expr)
+	}
+	e, err := ParseExpr(expr)
+	if err != nil {
+		return DerivedColumn{}, fmt.Errorf("derived_columns: column %q: %v", name, err)
+	}
+	return DerivedColumn{Name: name, Expr: e}, nil
+}
+
+// FormatNumber renders a derived value compactly: at most four significant
+// digits, with k, M and G suffixes for large values.
+func FormatNumber(v float64) string {
+	abs := v
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs >= 1e9:
+		return strconv.FormatFloat(v/1e9, 'f', 1, 64) + "G"
+	case abs >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'f', 1, 64) + "M"
+	case abs >= 1e4:
+		return strconv.FormatFloat(v/1e3, 'f', 1, 64) + "k"
+	case abs >= 100 || v == float64(int64(v)):
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	case abs >= 10:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// SetDerivedColumns sets the user-defined columns computed after each
+// scan. It is safe to call while the tracker is running.
+func (t *Tracker) SetDerivedColumns(cols []DerivedColumn) {
+	t.mu.Lock()
+	t.derived = slices.Clone(cols)
+	t.mu.Unlock()
+}
+
+// DerivedColumns returns the user-defined columns, in config order.
+func (t *Tracker) DerivedColumns() []DerivedColumn {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.derived)
+}
+
+// updateDerived evaluates the derived columns for every connection. Each
+// gets a new map, so earlier snapshots keep theirs.
+func (t *Tracker) updateDerived(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.connections {
+		if len(t.derived) == 0 {
+			c.Derived = nil
+			continue
+		}
+		c.Derived = make(map[string]float64, len(t.derived))
+		for _, d := range t.derived {
+			// Inf and NaN would fail the JSON snapshot; show them as missing.
+			if v, ok := d.Expr.Eval(c, now); ok && !math.IsInf(v, 0) && !math.IsNaN(v) {
+				c.Derived[d.Name] = v
+			}
+		}
+	}
+}
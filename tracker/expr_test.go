@@ -0,0 +1,169 @@
+package tracker
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExprEval(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &Connection{
+		Ping: 40 * time.Millisecond, PingCount: 3, Loss: 5,
+		TxRate: 1000, RxRate: 3000, HasByteCounts: true,
+		FirstSeen: now.Add(-time.Minute), LastActive: now.Add(-10 * time.Second),
+		Score: 80, HasScore: true,
+	}
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"64 / 4 / 2", 8},
+		{"2 * 3 / 4", 1.5},
+		{"-2 * 3", -6},
+		{"--4", 4},
+		{"1 - -1", 2},
+		{"-(1 + 2) * 2", -6},
+		{".5 + 1.25", 1.75},
+		{"ping_ms * (1 + loss / 100)", 42},
+		{"tx_rate + rx_rate", 4000},
+		{"rx_rate / tx_rate", 3},
+		{"age_s - idle_s", 50},
+		{"100 - score", 20},
+		{"\tping_ms\t", 40},
+		{"((((ping_ms))))", 40},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got, ok := e.Eval(c, now); !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%q = %v %v, want %v", tt.expr, got, ok, tt.want)
+		}
+		if e.String() != tt.expr {
+			t.Errorf("%q printed as %q", tt.expr, e.String())
+		}
+	}
+}
+
+func TestExprMissing(t *testing.T) {
+	now := time.Now()
+	bare := &Connection{}
+	unprobed := &Connection{Ping: 10 * time.Millisecond, PingCount: 1, NoProbe: AddrLoopback}
+	zeroTx := &Connection{HasByteCounts: true, RxRate: 10}
+	tests := []struct {
+		expr string
+		c    *Connection
+	}{
+		{"1 / 0", bare},
+		{"1 / (2 - 2)", bare},
+		{"rx_rate / tx_rate", zeroTx},
+		{"ping_ms", bare},
+		{"ping_ms", unprobed},
+		{"loss + 1", bare},
+		{"1 + score", bare},
+		{"-age_s", bare},
+		{"idle_s", &Connection{HasByteCounts: true}},
+		{"0 * tx_rate", bare}, // a missing input is missing whatever it is multiplied by
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if v, ok := e.Eval(tt.c, now); ok {
+			t.Errorf("%q = %v, want no value", tt.expr, v)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr, err string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "missing ) for ( at offset 0"},
+		{"1 + 2)", `unexpected ")" at offset 5`},
+		{"1 2", `unexpected "2" at offset 2`},
+		{"ping", `unknown identifier "ping" (want ping_ms, loss, tx_rate, rx_rate, age_s, idle_s, score)`},
+		{"PING_MS", `unknown identifier "PING_MS"`},
+		{"1.2.3", `invalid number "1.2.3" at offset 0`},
+		{"2 ^ 3", `unexpected "^" at offset 2`},
+		{"* 2", `unexpected "*" at offset 0`},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpr(tt.expr)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %s", tt.expr, err, tt.err)
+		}
+	}
+
+	_, err := ParseDerivedColumn("weighted", "ping_ms * lost")
+	if err == nil || !strings.HasPrefix(err.Error(), `derived_columns: column "weighted": unknown identifier "lost"`) {
+		t.Errorf("column error %v", err)
+	}
+	if _, err := ParseDerivedColumn(" ", "1"); err == nil {
+		t.Error("unnamed column accepted")
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	for v, want := range map[float64]string{
+		0: "0", 7: "7", -3: "-3", 1.234: "1.23", 0.005: "0.01", 12.34: "12.3", 123.4: "123",
+		9999: "9999", 12345: "12.3k", -25000: "-25.0k", 2.5e6: "2.5M", 7.25e9: "7.2G",
+	} {
+		if got := FormatNumber(v); got != want {
+			t.Errorf("%v: %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestUpdateDerived(t *testing.T) {
+	src := &fakeSource{}
+	src.set(fakeConn("app", "192.0.2.1", 443))
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	huge := strings.Repeat("9", 200) // 1e200: squared it is +Inf
+	var cols []DerivedColumn
+	for name, expr := range map[string]string{"age": "age_s + 2", "inf": huge + " * " + huge, "ping": "ping_ms"} {
+		col, err := ParseDerivedColumn(name, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols = append(cols, col)
+	}
+	tr.SetDerivedColumns(cols)
+	tr.scan()
+	c := tr.Snapshot()[0]
+	if c.Derived["age"] < 2 {
+		t.Errorf("age = %v", c.Derived["age"])
+	}
+	if _, ok := c.Derived["inf"]; ok {
+		t.Error("infinite value kept")
+	}
+	if _, ok := c.Derived["ping"]; ok {
+		t.Error("value kept for a connection that was not pinged")
+	}
+	tr.SetDerivedColumns(nil)
+	tr.scan()
+	if len(tr.Snapshot()[0].Derived) != 0 {
+		t.Error("derived values kept after the columns were removed")
+	}
+}
+
+func BenchmarkExprEval(b *testing.B) {
+	e, _ := ParseExpr("ping_ms * (1 + loss / 100) + (tx_rate + rx_rate) / 1000")
+	c := &Connection{Ping: 40 * time.Millisecond, PingCount: 3, Loss: 5, TxRate: 1000, RxRate: 3000, HasByteCounts: true}
+	now := time.Now()
+	b.ReportAllocs()
+	for b.Loop() {
+		e.Eval(c, now)
+	}
+}
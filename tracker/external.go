@@ -0,0 +1,198 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"time"
+	"unicode"
+)
+
+// ExternalTTL is how long an injected measurement overrides our own probes.
+// After it the connection goes back to being probed, and a synthetic target
+// created for it is removed.
+const ExternalTTL = 15 * time.Second
+
+const (
+	maxExternal       = 1024    // remotes with a live external measurement
+	maxExternalRTT    = 60000.0 // ms; anything above is rejected as bogus
+	maxExternalSource = 32      // characters in a source name
+)
+
+// ExternalProtocol is the Protocol of a synthetic connection created for an
+// external measurement that matches no socket.
+const ExternalProtocol = "ext"
+
+// ExternalRTT is a latency measurement reported by another program, e.g. a
+// game client logging its own server RTT.
+type ExternalRTT struct {
+	Remote string  `json:"remote"` // "1.2.3.4:27015" or "[2001:db8::1]:443"
+	RTTms  float64 `json:"rtt_ms"`
+	Source string  `json:"source"` // short name shown in the detail view
+}
+
+// externalSample is a validated ExternalRTT.
+type externalSample struct {
+	rtt    time.Duration
+	source string
+	at     time.Time
+}
+
+// parse validates r and returns its remote in the normalized form used by
+// connections (IPv4-mapped addresses unmapped).
+func (r ExternalRTT) parse() (netip.AddrPort, externalSample, error) {
+	ap, err := netip.ParseAddrPort(r.Remote)
+	if err != nil {
+		return ap, externalSample{}, fmt.Errorf("invalid remote %q: want ip:port", r.Remote)
+	}
+	ap = netip.AddrPortFrom(ap.Addr().Unmap().WithZone(""), ap.Port())
+	if ap.Port() == 0 || ap.Addr().IsUnspecified() {
+		return ap, externalSample{}, fmt.Errorf("invalid remote %q: no address or port", r.Remote)
+	}
+	if math.IsNaN(r.RTTms) || r.RTTms <= 0 || r.RTTms > maxExternalRTT {
+		return ap, externalSample{}, fmt.Errorf("rtt_ms %v out of range (0, %.0f]", r.RTTms, maxExternalRTT)
+	}
+	if r.Source == "" || len(r.Source) > maxExternalSource {
+		return ap, externalSample{}, fmt.Errorf("source must be 1-%d characters", maxExternalSource)
+	}
+	for _, c := range r.Source {
+		if !unicode.IsPrint(c) {
+			return ap, externalSample{}, errors.New("source contains control characters")
+		}
+	}
+	return ap, externalSample{
+		rtt:    time.Duration(r.RTTms * float64(time.Millisecond)),
+		source: r.Source,
+	}, nil
+}
+
+// IngestRTT merges an external measurement into the connections to its
+// remote. They show it as their ping, marked CorrectionExternal, instead of
+// our probe result until it is ExternalTTL old. A remote with no connection
+// gets a synthetic one (Protocol ExternalProtocol) for as long as the
+// measurement is fresh. It is safe to call while the tracker is running.
+func (t *Tracker) IngestRTT(r ExternalRTT) error {
+	ap, s, err := r.parse()
+	if err != nil {
+		return err
+	}
+	s.at = time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.external == nil {
+		t.external = make(map[netip.AddrPort]externalSample)
+	}
+	if _, ok := t.external[ap]; !ok && len(t.external) >= maxExternal {
+		t.evictExternal()
+	}
+	t.external[ap] = s
+	t.applyExternal(s.at)
+	t.touch()
+	return nil
+}
+
+// evictExternal drops the oldest external measurement. Caller must hold the lock.
+func (t *Tracker) evictExternal() {
+	var oldest netip.AddrPort
+	var at time.Time
+	for ap, s := range t.external {
+		if at.IsZero() || s.at.Before(at) {
+			oldest, at = ap, s.at
+		}
+	}
+	delete(t.external, oldest)
+}
+
+// applyExternal expires old external measurements and copies the fresh ones
+// onto matching connections, adding or removing synthetic connections as
+// needed. Caller must hold the lock.
+func (t *Tracker) applyExternal(now time.Time) {
+	if len(t.external) == 0 && len(t.synthetic) == 0 {
+		return
+	}
+	for ap, s := range t.external {
+		if now.Sub(s.at) > ExternalTTL {
+			delete(t.external, ap)
+		}
+	}
+
+	matched := make(map[netip.AddrPort]bool)
+	for _, c := range t.connections {
+		if c.Protocol == ExternalProtocol {
+			continue
+		}
+		ap, ok := connRemote(c)
+		s, fresh := t.external[ap]
+		if ok && fresh {
+			matched[ap] = true
+			c.Ping, c.RawPing = s.rtt, s.rtt
+			c.PingCorrection, c.PingSource = CorrectionExternal, s.source
+			continue
+		}
+		if c.PingCorrection == CorrectionExternal {
+			// Expired: the next probe replaces the value.
+			c.PingCorrection, c.PingSource = CorrectionNone, ""
+			c.lastProbeCycle = 0
+		}
+	}
+
+	for ap, key := range t.synthetic {
+		s, fresh := t.external[ap]
+		if !fresh || matched[ap] {
+			delete(t.connections, key)
+			delete(t.synthetic, ap)
+			continue
+		}
+		c := t.connections[key]
+		c.Ping, c.RawPing, c.PingSource = s.rtt, s.rtt, s.source
+		c.LastUpdated = now
+		c.ConnAge = now.Sub(c.FirstSeen)
+	}
+	for ap, s := range t.external {
+		if matched[ap] {
+			continue
+		}
+		if _, ok := t.synthetic[ap]; ok {
+			continue
+		}
+		c := &Connection{
+			AppName:        s.source,
+			Protocol:       ExternalProtocol,
+			Direction:      Outbound,
+			Family:         4,
+			RemoteAddr:     ap.Addr().String(),
+			RemotePort:     int(ap.Port()),
+			State:          StateEstablished,
+			Ping:           s.rtt,
+			RawPing:        s.rtt,
+			PingCorrection: CorrectionExternal,
+			PingSource:     s.source,
+			PingTier:       TierFocused,
+			FirstSeen:      now,
+			LastUpdated:    now,
+			LastActive:     now,
+		}
+		if ap.Addr().Is6() {
+			c.Family = 6
+		}
+		c.LogicalFirstSeen = now
+		if t.synthetic == nil {
+			t.synthetic = make(map[netip.AddrPort]string)
+		}
+		key := c.Key()
+		t.connections[key] = c
+		t.synthetic[ap] = key
+	}
+}
+
+// connRemote returns c's remote endpoint in the form external measurements
+// are keyed by.
+func connRemote(c *Connection) (netip.AddrPort, bool) {
+	addr, err := netip.ParseAddr(c.RemoteAddr)
+	if err != nil || c.RemotePort <= 0 || c.RemotePort > 65535 {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr.Unmap().WithZone(""), uint16(c.RemotePort)), true
+}
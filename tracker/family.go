@@ -0,0 +1,45 @@
+package tracker
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// normalizeFamily rewrites IPv4-mapped IPv6 addresses (::ffff:192.0.2.1) on
+// dual-stack sockets to plain IPv4, so filtering, aggregation and flow
+// matching see one form. Family is set from the addresses; V4Mapped records
+// that the socket itself is AF_INET6. It runs on every scan before keys are
+// computed, so keys stay stable across scans.
+func normalizeFamily(c *Connection) {
+	local, lm := unmap(c.LocalAddr)
+	remote, rm := unmap(c.RemoteAddr)
+	c.LocalAddr, c.RemoteAddr = local, remote
+	c.V4Mapped = lm || rm
+
+	c.Family = 4
+	if strings.HasSuffix(c.Protocol, "6") && !c.V4Mapped {
+		c.Family = 6
+	}
+
+	if rm && remote == "0.0.0.0" {
+		c.Direction = Inbound
+	}
+}
+
+// unmap returns the IPv4 form of a v4-mapped address and whether it was mapped.
+func unmap(addr string) (string, bool) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil || !ip.Is4In6() {
+		return addr, false
+	}
+	return ip.Unmap().String(), true
+}
+
+// DisplayProtocol is the protocol as shown to users: v4-mapped traffic on an
+// AF_INET6 socket is shown as IPv4 ("tcp" rather than "tcp6").
+func (c *Connection) DisplayProtocol() string {
+	if c.V4Mapped {
+		return strings.TrimSuffix(c.Protocol, "6")
+	}
+	return c.Protocol
+}
@@ -0,0 +1,100 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeFamily(t *testing.T) {
+	tests := []struct {
+		name                    string
+		protocol, local, remote string
+		wantLocal, wantRemote   string
+		family                  int
+		mapped                  bool
+		display                 string
+	}{
+		{"mapped", "tcp6", "::ffff:10.0.0.2", "::ffff:192.0.2.1", "10.0.0.2", "192.0.2.1", 4, true, "tcp"},
+		{"mapped listener", "tcp6", "::ffff:0.0.0.0", "::ffff:0.0.0.0", "0.0.0.0", "0.0.0.0", 4, true, "tcp"},
+		{"native v6", "tcp6", "2001:db8::2", "2001:db8::1", "2001:db8::2", "2001:db8::1", 6, false, "tcp6"},
+		{"v6 wildcard", "udp6", "::", "::", "::", "::", 6, false, "udp6"},
+		{"native v4", "tcp", "10.0.0.2", "192.0.2.1", "10.0.0.2", "192.0.2.1", 4, false, "tcp"},
+		{"not an address", "tcp", "10.0.0.2", "*", "10.0.0.2", "*", 4, false, "tcp"},
+	}
+	for _, tt := range tests {
+		c := &Connection{Protocol: tt.protocol, LocalAddr: tt.local, RemoteAddr: tt.remote, Direction: Outbound}
+		normalizeFamily(c)
+		if c.LocalAddr != tt.wantLocal || c.RemoteAddr != tt.wantRemote || c.Family != tt.family ||
+			c.V4Mapped != tt.mapped || c.DisplayProtocol() != tt.display {
+			t.Errorf("%s: %s -> %s, family %d, mapped %v, shown as %s", tt.name,
+				c.LocalAddr, c.RemoteAddr, c.Family, c.V4Mapped, c.DisplayProtocol())
+		}
+		if c.Protocol != tt.protocol {
+			t.Errorf("%s: socket protocol rewritten to %s", tt.name, c.Protocol)
+		}
+	}
+
+	// A mapped wildcard peer is a listener's.
+	c := &Connection{Protocol: "tcp6", LocalAddr: "::ffff:10.0.0.2", RemoteAddr: "::ffff:0.0.0.0", Direction: Outbound}
+	normalizeFamily(c)
+	if c.Direction != Inbound {
+		t.Error("mapped wildcard peer left outbound")
+	}
+}
+
+func TestMappedAddressesDownstream(t *testing.T) {
+	mapped := fakeConn("web", "::ffff:192.0.2.1", 443)
+	mapped.Protocol, mapped.LocalAddr, mapped.PID = "tcp6", "::ffff:10.0.0.2", 101
+	plain := fakeConn("curl", "192.0.2.1", 443)
+	v6 := fakeConn("web", "2001:db8::1", 443)
+	v6.Protocol, v6.LocalAddr = "tcp6", "2001:db8::2"
+
+	src := &fakeSource{}
+	src.set(mapped, plain, v6)
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := t0
+	tr.SetClock(func() time.Time { return now })
+	tr.scan()
+
+	// v4 filtering sees the mapped socket.
+	if got := tr.Search("192.0.2."); len(got) != 2 {
+		t.Errorf("192.0.2. matched %d connections, want 2", len(got))
+	}
+	if got := tr.Search("2001:db8"); len(got) != 1 {
+		t.Errorf("2001:db8 matched %d connections, want 1", len(got))
+	}
+
+	// Both v4 peers are one host and one /24.
+	snap := tr.Snapshot()
+	if groups := GroupBy(snap, GroupByRemoteHost); len(groups) != 2 {
+		t.Errorf("%d remote hosts, want 2", len(groups))
+	}
+	for _, c := range snap {
+		want := "192.0.2.0/24"
+		if c.Family == 6 {
+			want = "2001:db8::/64"
+		}
+		if got := clientSubnet(c.RemoteAddr); got != want {
+			t.Errorf("%s: subnet %s, want %s", c.RemoteAddr, got, want)
+		}
+	}
+
+	// Keys stay put across scans: nothing is new or closed the next time.
+	keys := make(map[string]time.Time)
+	for _, c := range snap {
+		keys[c.Key()] = c.FirstSeen
+	}
+	now = t0.Add(time.Second)
+	tr.scan()
+	for _, c := range tr.Snapshot() {
+		first, ok := keys[c.Key()]
+		if !ok || !first.Equal(t0) {
+			t.Errorf("%s: key changed between scans", c.Key())
+		}
+	}
+	if closed := tr.RecentlyClosed(); len(closed) != 0 {
+		t.Errorf("%d connections closed by a rescan", len(closed))
+	}
+}
@@ -0,0 +1,175 @@
+package tracker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filterKeys maps the "key:" prefixes accepted in a search query to their
+// predicates. Values are lower-cased before matching.
+var filterKeys = map[string]func(c *Connection, value string) bool{
+	"trend": func(c *Connection, v string) bool {
+		return string(c.LossTrend.Direction) == v
+	},
+	"enc": func(c *Connection, v string) bool {
+		if v == "unknown" {
+			return c.Encryption == EncUnknown
+		}
+		return string(c.Encryption) == v
+	},
+	"service": func(c *Connection, v string) bool {
+		return strings.ToLower(c.Service) == v
+	},
+	"new": func(c *Connection, v string) bool {
+		return c.IsNewRemote(time.Now()) == (v == "yes")
+	},
+	"audit": func(c *Connection, v string) bool {
+		switch v {
+		case "yes":
+			return c.Audit.Score > 0
+		case "no":
+			return c.Audit.Score == 0
+		}
+		min, err := strconv.Atoi(v)
+		return err == nil && c.Audit.Score >= min
+	},
+	"sni": func(c *Connection, v string) bool {
+		if v == "none" {
+			return c.SNI == ""
+		}
+		return c.SNI != "" && strings.Contains(c.SNI, v)
+	},
+	"origin": func(c *Connection, v string) bool {
+		o, ok := ParseOrigin(v)
+		return ok && c.Origin == o
+	},
+	"dscp":  matchDSCP,
+	"cc":    matchCongestion,
+	"score": matchScore,
+	"state": func(c *Connection, v string) bool {
+		return strings.ToLower(string(c.State)) == v
+	},
+	"stuck": func(c *Connection, v string) bool {
+		return c.Stuck == (v == "yes")
+	},
+	"halfopen": func(c *Connection, v string) bool {
+		return c.HalfOpen == (v == "yes")
+	},
+	"listener": func(c *Connection, v string) bool {
+		return v == "new" && c.NewListener
+	},
+	"netns": func(c *Connection, v string) bool {
+		if c.Namespace == "" {
+			return v == "host"
+		}
+		return strings.Contains(strings.ToLower(c.Namespace), v)
+	},
+	"host": func(c *Connection, v string) bool {
+		if c.Host == "" {
+			return v == "local"
+		}
+		return strings.Contains(strings.ToLower(c.Host), v)
+	},
+}
+
+// queryTerm is one whitespace-separated part of a search query.
+type queryTerm struct {
+	match func(c *Connection, value string) bool
+	value string
+}
+
+// parseQuery splits a search query into terms, checked in this order:
+//   - key:value with a known key uses that filter key
+//   - all digits (e.g. 8080) matches a local port, remote port or PID exactly
+//   - containing '.' or ':' plus at least one hex digit (e.g. 10.0., fe80:)
+//     matches the start of the local or remote address
+//   - anything else is an app name substring
+func parseQuery(query string) []queryTerm {
+	var terms []queryTerm
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		if key, value, ok := strings.Cut(field, ":"); ok {
+			if fn, known := filterKeys[key]; known {
+				terms = append(terms, queryTerm{match: fn, value: value})
+				continue
+			}
+		}
+		switch {
+		case isNumber(field):
+			terms = append(terms, queryTerm{match: matchNumber, value: field})
+		case isAddrFragment(field):
+			terms = append(terms, queryTerm{match: matchAddrPrefix, value: field})
+		default:
+			terms = append(terms, queryTerm{match: matchApp, value: field})
+		}
+	}
+	return terms
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isAddrFragment reports whether s looks like part of an IP address: only
+// hex digits, dots and colons, with at least one separator and one digit.
+func isAddrFragment(s string) bool {
+	sep, digit := false, false
+	for _, r := range s {
+		switch {
+		case r == '.' || r == ':':
+			sep = true
+		case r >= '0' && r <= '9' || r >= 'a' && r <= 'f':
+			digit = true
+		default:
+			return false
+		}
+	}
+	return sep && digit
+}
+
+func matchApp(c *Connection, v string) bool {
+	return strings.Contains(strings.ToLower(c.AppName), v)
+}
+
+func matchNumber(c *Connection, v string) bool {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return false
+	}
+	return c.LocalPort == n || c.RemotePort == n || c.PID == n
+}
+
+func matchAddrPrefix(c *Connection, v string) bool {
+	return strings.HasPrefix(strings.ToLower(c.LocalAddr), v) || strings.HasPrefix(strings.ToLower(c.RemoteAddr), v)
+}
+
+// matchAll reports whether the connection satisfies every term.
+func matchAll(c *Connection, terms []queryTerm) bool {
+	for _, t := range terms {
+		if !t.match(c, t.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterConnections returns the connections matching query, using the same
+// syntax as Tracker.Search.
+func FilterConnections(conns []*Connection, query string) []*Connection {
+	if query == "" {
+		return conns
+	}
+	terms := parseQuery(query)
+	var result []*Connection
+	for _, c := range conns {
+		if matchAll(c, terms) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package tracker
+
+import "testing"
+
+func TestQueryHeuristics(t *testing.T) {
+	web := &Connection{AppName: "firefox", PID: 4321, LocalAddr: "10.0.0.2", LocalPort: 51000, RemoteAddr: "93.184.216.34", RemotePort: 443}
+	dev := &Connection{AppName: "node", PID: 8080, LocalAddr: "127.0.0.1", LocalPort: 3000, RemoteAddr: "127.0.0.1", RemotePort: 51234}
+	v6 := &Connection{AppName: "ssh3", PID: 77, LocalAddr: "fe80::1", LocalPort: 22, RemoteAddr: "2001:db8::5", RemotePort: 60022}
+	conns := []*Connection{web, dev, v6}
+
+	tests := []struct {
+		query string
+		want  []*Connection
+	}{
+		// numbers: a port or PID, exactly
+		{"443", []*Connection{web}},
+		{"8080", []*Connection{dev}},
+		{"22", []*Connection{v6}},
+		{"2", nil},
+		{"4321", []*Connection{web}},
+		{"00443", []*Connection{web}},
+		// address fragments: the start of either address
+		{"10.0.", []*Connection{web}},
+		{"127.", []*Connection{dev}},
+		{"3.", nil}, // a prefix, not a substring of 93.184...
+		{"fe80:", []*Connection{v6}},
+		{"2001:DB8", []*Connection{v6}},
+		{"::1", nil},
+		// everything else: app name substring
+		{"fox", []*Connection{web}},
+		{"ssh3", []*Connection{v6}},
+		{"NODE", []*Connection{dev}},
+		// mixed: every term must match
+		{"firefox 443", []*Connection{web}},
+		{"firefox 22", nil},
+		{"node 127.0", []*Connection{dev}},
+		// adversarial
+		{":", nil},
+		{".", nil},
+		{"...", nil},
+		{"-1", nil},
+		{"99999999999999999999", nil},
+		{"sni:", nil},
+	}
+	for _, tt := range tests {
+		got := FilterConnections(conns, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("%q matched %d connections, want %d", tt.query, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q matched %s, want %s", tt.query, got[i].AppName, tt.want[i].AppName)
+			}
+		}
+	}
+}
+
+func TestQueryClassification(t *testing.T) {
+	tests := []struct {
+		field     string
+		num, frag bool
+	}{
+		{"8080", true, false},
+		{"", false, false},
+		{"3.", false, true},
+		{":", false, false},
+		{".:", false, false},
+		{"a:b", false, true},
+		{"cafe", false, false},
+		{"10.0.0.1", false, true},
+		{"1e3", false, false},
+		{"g.1", false, false},
+	}
+	for _, tt := range tests {
+		if got := isNumber(tt.field); got != tt.num {
+			t.Errorf("isNumber(%q) = %v", tt.field, got)
+		}
+		if got := isAddrFragment(tt.field); got != tt.frag {
+			t.Errorf("isAddrFragment(%q) = %v", tt.field, got)
+		}
+	}
+}
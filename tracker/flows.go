@@ -0,0 +1,115 @@
+package tracker
+
+import "time"
+
+const (
+	// closedRetention is how long closed connections stay in the recently-closed buffer.
+	closedRetention = 5 * time.Minute
+
+	// maxClosed caps the recently-closed buffer.
+	maxClosed = 500
+)
+
+// FlowLinkConfig controls how a new socket is linked to a recently closed one
+// that represents the same logical flow (e.g. after a VPN renumbers local ports).
+type FlowLinkConfig struct {
+	// Grace is the longest gap between the old socket closing and the new one
+	// appearing. Zero disables linking.
+	Grace time.Duration
+	// MatchApp links by app name instead of PID, for apps that restart.
+	MatchApp bool
+}
+
+// DefaultFlowLinkConfig links sockets of the same PID reappearing within 30s.
+var DefaultFlowLinkConfig = FlowLinkConfig{Grace: 30 * time.Second}
+
+// findPredecessor returns the recently closed connection that c continues:
+// same PID (or app), protocol family and remote endpoint, closed within the
+// grace window. If several candidates qualify the link is ambiguous and nil
+// is returned rather than guessing.
+func findPredecessor(c *Connection, closed []*Connection, now time.Time, cfg FlowLinkConfig) *Connection {
+	if cfg.Grace <= 0 || !isTrackableRemote(c.RemoteAddr) || c.RemotePort == 0 {
+		return nil
+	}
+
+	var match *Connection
+	for _, p := range closed {
+		if now.Sub(p.ClosedAt) > cfg.Grace {
+			continue
+		}
+		if p.RemoteAddr != c.RemoteAddr || p.RemotePort != c.RemotePort {
+			continue
+		}
+		if baseProtocol(p.Protocol) != baseProtocol(c.Protocol) {
+			continue
+		}
+		if cfg.MatchApp {
+			if p.AppName != c.AppName {
+				continue
+			}
+		} else if p.PID != c.PID {
+			continue
+		}
+		if match != nil {
+			return nil
+		}
+		match = p
+	}
+	return match
+}
+
+// inheritFlow carries the logical flow's history over from its predecessor.
+// Physical fields (addresses, FirstSeen, byte counters) stay untouched.
+func (c *Connection) inheritFlow(prev *Connection) {
+	c.LogicalFirstSeen = prev.LogicalFirstSeen
+	c.LinkedFrom = prev.Key()
+	c.Relinks = prev.Relinks + 1
+	c.Ping = prev.Ping
+	c.RawPing = prev.RawPing
+	c.PingCorrection = prev.PingCorrection
+	c.Loss = prev.Loss
+	c.LossTrend = prev.LossTrend
+	c.PingCount = prev.PingCount
+	c.PingFailed = prev.PingFailed
+	c.lossSamples = append([]lossSample(nil), prev.lossSamples...)
+}
+
+// RecentlyClosed returns copies of connections that disappeared within the
+// last few minutes, most recently closed first.
+func (t *Tracker) RecentlyClosed() []*Connection {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]*Connection, 0, len(t.closed))
+	for i := len(t.closed) - 1; i >= 0; i-- {
+		cp := *t.closed[i]
+		result = append(result, &cp)
+	}
+	return result
+}
+
+// pruneClosed drops closed connections past retention or beyond the cap.
+// Caller must hold the lock.
+func (t *Tracker) pruneClosed(now time.Time) {
+	keep := t.closed[:0]
+	for _, c := range t.closed {
+		if now.Sub(c.ClosedAt) <= closedRetention {
+			keep = append(keep, c)
+		}
+	}
+	if len(keep) > maxClosed {
+		keep = keep[len(keep)-maxClosed:]
+	}
+	t.closed = keep
+}
+
+// removeClosed drops c from the recently-closed buffer once it has been
+// linked, so it cannot be claimed twice. Caller must hold the lock.
+func (t *Tracker) removeClosed(c *Connection) {
+	for i, p := range t.closed {
+		if p == c {
+			t.closed = append(t.closed[:i], t.closed[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindPredecessor(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	closed := func(pid int, app, protocol, remote string, port int, ago time.Duration) *Connection {
+		return &Connection{PID: pid, AppName: app, Protocol: protocol, RemoteAddr: remote, RemotePort: port,
+			ClosedAt: now.Add(-ago)}
+	}
+	c := &Connection{PID: 10, AppName: "vpn", Protocol: "tcp", RemoteAddr: "192.0.2.1", RemotePort: 443}
+	match := closed(10, "vpn", "tcp", "192.0.2.1", 443, 5*time.Second)
+	v6 := closed(10, "vpn", "tcp6", "192.0.2.1", 443, time.Second)
+	restarted := closed(11, "vpn", "tcp", "192.0.2.1", 443, time.Second)
+
+	tests := []struct {
+		name   string
+		closed []*Connection
+		cfg    FlowLinkConfig
+		want   *Connection
+	}{
+		{"single candidate", []*Connection{match}, DefaultFlowLinkConfig, match},
+		{"tcp6 is the same family", []*Connection{v6}, DefaultFlowLinkConfig, v6},
+		{"past the grace window", []*Connection{closed(10, "vpn", "tcp", "192.0.2.1", 443, time.Minute)}, DefaultFlowLinkConfig, nil},
+		{"other remote port", []*Connection{closed(10, "vpn", "tcp", "192.0.2.1", 80, time.Second)}, DefaultFlowLinkConfig, nil},
+		{"other protocol", []*Connection{closed(10, "vpn", "udp", "192.0.2.1", 443, time.Second)}, DefaultFlowLinkConfig, nil},
+		{"other PID", []*Connection{restarted}, DefaultFlowLinkConfig, nil},
+		{"other PID, matching by app", []*Connection{restarted}, FlowLinkConfig{Grace: time.Minute, MatchApp: true}, restarted},
+		{"ambiguous", []*Connection{match, closed(10, "vpn", "tcp", "192.0.2.1", 443, 2*time.Second)}, DefaultFlowLinkConfig, nil},
+		{"ambiguity outside the window is ignored", []*Connection{match, closed(10, "vpn", "tcp", "192.0.2.1", 443, time.Hour)}, DefaultFlowLinkConfig, match},
+		{"disabled", []*Connection{match}, FlowLinkConfig{}, nil},
+	}
+	for _, tt := range tests {
+		if got := findPredecessor(c, tt.closed, now, tt.cfg); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	local := &Connection{PID: 10, Protocol: "tcp", RemoteAddr: "127.0.0.1", RemotePort: 443}
+	if findPredecessor(local, []*Connection{closed(10, "", "tcp", "127.0.0.1", 443, time.Second)}, now, DefaultFlowLinkConfig) != nil {
+		t.Error("loopback linked")
+	}
+}
+
+func TestRenumberingCarriesHistory(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := t0
+	src := &fakeSource{}
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetClock(func() time.Time { return now })
+
+	old := fakeConn("vpn", "192.0.2.1", 443)
+	old.LocalPort = 40001
+	src.set(old)
+	tr.scan()
+
+	// The tunnel renegotiates: same remote, new local port.
+	now = t0.Add(2 * time.Second)
+	renum := old
+	renum.LocalPort = 40002
+	src.set(renum)
+	tr.scan()
+
+	snap := tr.Snapshot()
+	if len(snap) != 1 {
+		t.Fatalf("%d connections", len(snap))
+	}
+	c := snap[0]
+	if c.LinkedFrom != old.Key() || c.Relinks != 1 {
+		t.Fatalf("linked from %q (%d relinks), want %q", c.LinkedFrom, c.Relinks, old.Key())
+	}
+	if !c.LogicalFirstSeen.Equal(t0) || !c.FirstSeen.Equal(now) {
+		t.Fatalf("logical first seen %v, physical %v", c.LogicalFirstSeen, c.FirstSeen)
+	}
+	for _, p := range tr.RecentlyClosed() {
+		if p.Key() == old.Key() {
+			t.Fatal("the linked predecessor is still in the closed list")
+		}
+	}
+}
+
+func TestRenumberingAmbiguous(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := t0
+	src := &fakeSource{}
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetClock(func() time.Time { return now })
+
+	a := fakeConn("vpn", "192.0.2.1", 443)
+	a.LocalPort = 40001
+	b := a
+	b.LocalPort = 40002
+	src.set(a, b)
+	tr.scan()
+
+	// Both close and one replacement appears: either could be its
+	// predecessor, so neither is linked.
+	now = t0.Add(time.Second)
+	c := a
+	c.LocalPort = 40003
+	src.set(c)
+	tr.scan()
+
+	snap := tr.Snapshot()
+	if len(snap) != 1 || snap[0].LinkedFrom != "" || !snap[0].LogicalFirstSeen.Equal(now) {
+		t.Fatalf("ambiguous replacement linked: %+v", snap[0])
+	}
+}
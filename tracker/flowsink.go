@@ -0,0 +1,47 @@
+package tracker
+
+import "time"
+
+// flowActiveTimeout is how often a long-lived connection is reported to the
+// flow sink while it is still open, like a NetFlow active timeout.
+const flowActiveTimeout = 30 * time.Minute
+
+// FlowSink receives a flow record when a connection ends, and periodically
+// for long-lived ones. ExportFlow is called with the tracker lock held, so
+// implementations must queue the record and return without blocking.
+type FlowSink interface {
+	ExportFlow(c Connection, start, end time.Time)
+}
+
+// SetFlowSink attaches a flow exporter. Must be called before Start.
+func (t *Tracker) SetFlowSink(s FlowSink) {
+	t.flowSink = s
+}
+
+// exportFlow reports the part of c's lifetime not yet exported, ending at
+// end. Caller must hold the lock.
+func (t *Tracker) exportFlow(c *Connection, end time.Time) {
+	start := c.FirstSeen
+	if c.flowExportedAt.After(start) {
+		start = c.flowExportedAt
+	}
+	t.flowSink.ExportFlow(*c, start, end)
+	c.flowExportedAt = end
+}
+
+// exportLongLived reports open connections whose current record window has
+// reached the active timeout. Caller must hold the lock.
+func (t *Tracker) exportLongLived(now time.Time) {
+	for _, c := range t.connections {
+		if c.Protocol == ExternalProtocol {
+			continue
+		}
+		start := c.FirstSeen
+		if c.flowExportedAt.After(start) {
+			start = c.flowExportedAt
+		}
+		if now.Sub(start) >= flowActiveTimeout {
+			t.exportFlow(c, now)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFocusInterval and MinFocusInterval bound the focus loop's
+	// cadence: 4 to 10 ticks a second.
+	DefaultFocusInterval = 250 * time.Millisecond
+	MinFocusInterval     = 100 * time.Millisecond
+	MaxFocusInterval     = DefaultFocusInterval
+
+	// maxFocusConns is the most connections a focus tick refreshes, and
+	// maxFocusRemotes the most remotes it probes: with one connect per
+	// remote per tick, at most 80 connects a second at the fastest cadence.
+	maxFocusConns   = 16
+	maxFocusRemotes = 8
+
+	// focusLossWindow is the span a focused connection's Loss is averaged
+	// over; a single tick's probe is all or nothing.
+	focusLossWindow = 5 * time.Second
+)
+
+// ParseFocusInterval parses the focus_interval setting: "" is
+// DefaultFocusInterval.
+func ParseFocusInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultFocusInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < MinFocusInterval || d > MaxFocusInterval {
+		return 0, fmt.Errorf("focus_interval %q: want %s to %s", s, MinFocusInterval, MaxFocusInterval)
+	}
+	return d, nil
+}
+
+// FocusStatus describes the armed focus loop.
+type FocusStatus struct {
+	Query    string
+	Interval time.Duration
+	Since    time.Time
+	Conns    int // connections refreshed by the last tick
+	Remotes  int // remotes probed by the last tick
+	Ticks    int
+	Late     int // ticks that outlasted the interval; the ones they overlapped were dropped
+}
+
+// focus is the armed focus loop.
+type focus struct {
+	FocusStatus
+	terms []queryTerm
+	keys  map[string]bool // the connections refreshed by the last tick
+	stop  chan struct{}
+}
+
+// focusTarget is what a focus tick needs of a connection, copied under
+// the lock.
+type focusTarget struct {
+	key                   string
+	pid                   int
+	inode                 string
+	protocol              string
+	remoteAddr            string
+	localPort, remotePort int
+}
+
+// ArmFocus starts the focus loop: every interval, the connections matching
+// query (the filter syntax of Search) are checked for being still open and
+// their remotes probed, outside the full scan, which goes on at its own
+// interval. Only established local connections with probeable remotes take
+// part, at most 16 of them. New sockets join at the next full scan, as do
+// closed ones leave the table. It replaces the loop already armed, if any.
+// It is safe to call while the tracker is running.
+func (t *Tracker) ArmFocus(query string, interval time.Duration) error {
+	switch {
+	case query == "":
+		return errors.New("focus needs a filter")
+	case interval < MinFocusInterval || interval > MaxFocusInterval:
+		return fmt.Errorf("focus interval %s: want %s to %s", interval, MinFocusInterval, MaxFocusInterval)
+	case t.source == nil && !probeMeter.allowed():
+		return ErrProbeBudget
+	}
+	f := &focus{
+		FocusStatus: FocusStatus{Query: query, Interval: interval, Since: t.now()},
+		terms:       parseQuery(query),
+		stop:        make(chan struct{}),
+	}
+	t.mu.Lock()
+	if t.focus != nil {
+		close(t.focus.stop)
+	}
+	t.focus = f
+	t.mu.Unlock()
+	go t.runFocus(f)
+	return nil
+}
+
+// DisarmFocus stops the focus loop, if armed. A tick still probing records
+// nothing, and the focused connections are probed by the full scan again
+// from its next cycle. It is safe to call while the tracker is running.
+func (t *Tracker) DisarmFocus() {
+	t.mu.Lock()
+	if t.focus != nil {
+		close(t.focus.stop)
+		t.focus = nil
+	}
+	t.mu.Unlock()
+}
+
+// Focus returns the armed focus loop's status, and false when none is.
+func (t *Tracker) Focus() (FocusStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.focus == nil {
+		return FocusStatus{}, false
+	}
+	return t.focus.FocusStatus, true
+}
+
+// FocusSnapshot returns copies of the connections the last focus tick
+// refreshed, or nil when no focus loop is armed.
+func (t *Tracker) FocusSnapshot() []*Connection {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.focus == nil {
+		return nil
+	}
+	var result []*Connection
+	for key := range t.focus.keys {
+		if c := t.connections[key]; c != nil {
+			cp := *c
+			result = append(result, &cp)
+		}
+	}
+	return result
+}
+
+// TakeProbe copies the probe results of from, a fresher copy of the same
+// connection, leaving everything the scan fills in as it is.
+func (c *Connection) TakeProbe(from *Connection) {
+	c.Ping, c.RawPing, c.PingCorrection = from.Ping, from.RawPing, from.PingCorrection
+	c.Proxy, c.LastSample = from.Proxy, from.LastSample
+	c.Loss, c.LossTrend = from.Loss, from.LossTrend
+	c.PingCount, c.PingFailed = from.PingCount, from.PingFailed
+	c.WarmUpSamples, c.OutlierSamples = from.WarmUpSamples, from.OutlierSamples
+	c.UnreachableSince = from.UnreachableSince
+}
+
+// Updates delivers a value after every full scan and every focus tick.
+// Nothing queues up: a reader that falls behind gets one value for all
+// the updates it missed.
+func (t *Tracker) Updates() <-chan struct{} {
+	return t.updates
+}
+
+// notifyUpdate signals Updates without blocking.
+func (t *Tracker) notifyUpdate() {
+	select {
+	case t.updates <- struct{}{}:
+	default:
+	}
+}
+
+// focusing reports whether the focus loop probes c, whose normal probes
+// are then skipped. Caller must hold the lock.
+func (t *Tracker) focusing(c *Connection) bool {
+	return t.focus != nil && t.focus.keys[c.Key()]
+}
+
+// runFocus ticks f until it is disarmed or the tracker stops. Ticks run
+// one at a time; a tick that outlasts the interval drops the ones it
+// overlapped rather than queuing them.
+func (t *Tracker) runFocus(f *focus) {
+	tick := time.NewTicker(f.Interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-t.stopCh:
+			return
+		case <-tick.C:
+			start := time.Now()
+			t.focusTick(f)
+			if time.Since(start) > f.Interval {
+				t.mu.Lock()
+				f.Late++
+				t.mu.Unlock()
+			}
+		}
+	}
+}
+
+// focusTick refreshes the focused connections once: it drops the ones
+// whose socket is gone, probes each remote with a single connect and
+// records the results as pingAll does.
+func (t *Tracker) focusTick(f *focus) {
+	t.mu.Lock()
+	targets := t.focusTargets(f)
+	t.mu.Unlock()
+
+	if t.source == nil {
+		alive := socketsAlive(targets)
+		targets = slices.DeleteFunc(targets, func(x focusTarget) bool { return !alive[x.key] })
+	}
+
+	type remote struct {
+		addr string
+		port int
+	}
+	var remotes []remote
+	for _, x := range targets {
+		r := remote{x.remoteAddr, x.remotePort}
+		if !slices.Contains(remotes, r) && len(remotes) < maxFocusRemotes {
+			remotes = append(remotes, r)
+		}
+	}
+	type result struct {
+		rtt  time.Duration
+		lost bool
+	}
+	results := make(map[remote]result, len(remotes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, r := range remotes {
+		if t.source == nil && !probeMeter.allowed() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, lost := t.deepProbe(r.addr, r.port)
+			mu.Lock()
+			results[r] = result{rtt, lost}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+	t.mu.Lock()
+	if t.focus == f {
+		f.keys = make(map[string]bool, len(targets))
+		for _, x := range targets {
+			c := t.connections[x.key]
+			res, ok := results[remote{x.remoteAddr, x.remotePort}]
+			if c == nil || !ok {
+				continue
+			}
+			f.keys[x.key] = true
+			loss := 0.0
+			if res.lost {
+				loss = 100
+			}
+			t.recordProbe(c, res.rtt, loss, nil, now)
+			c.Loss, _ = windowLoss(c.lossSamples, now.Add(-focusLossWindow), now.Add(time.Nanosecond))
+			t.perf.probe(loss)
+		}
+		f.Conns, f.Remotes = len(f.keys), len(results)
+		f.Ticks++
+	}
+	t.mu.Unlock()
+	t.touch()
+	t.notifyUpdate()
+}
+
+// focusTargets picks the connections f refreshes: established local ones
+// matching its query, with a probeable remote that neither a deep-dive
+// nor -probe-proxy handles, by key, at most maxFocusConns. Caller must
+// hold the lock.
+func (t *Tracker) focusTargets(f *focus) []focusTarget {
+	var targets []focusTarget
+	for key, c := range t.connections {
+		if c.State != StateEstablished || c.Host != "" || c.NoProbe != AddrProbeable ||
+			c.RemoteAddr == "0.0.0.0" || c.RemoteAddr == "::" || c.PingCorrection == CorrectionExternal {
+			continue
+		}
+		if t.deepDiving(c.RemoteAddr) || (t.source == nil && t.probeProxy != nil && !t.probeProxy.Bypassed(c.RemoteAddr)) {
+			continue
+		}
+		if !matchAll(c, f.terms) {
+			continue
+		}
+		targets = append(targets, focusTarget{
+			key: key, pid: c.PID, inode: c.inode, protocol: c.Protocol,
+			localPort: c.LocalPort, remoteAddr: c.RemoteAddr, remotePort: c.RemotePort,
+		})
+	}
+	slices.SortFunc(targets, func(a, b focusTarget) int { return strings.Compare(a.key, b.key) })
+	if len(targets) > maxFocusConns {
+		targets = targets[:maxFocusConns]
+	}
+	return targets
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package tracker
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// socketsAlive reports which targets are still open by reading only the
+// /proc/<pid>/fd entries of their PIDs. A target whose owner or inode is
+// unknown (the ss scanner, TIME_WAIT), or whose fds cannot be read, counts
+// as open: the next full scan decides.
+func socketsAlive(targets []focusTarget) map[string]bool {
+	held := make(map[int]map[string]bool) // PID -> socket inodes; nil when unreadable
+	alive := make(map[string]bool, len(targets))
+	for _, x := range targets {
+		if x.pid == 0 || x.inode == "" || x.inode == "0" {
+			alive[x.key] = true
+			continue
+		}
+		inodes, ok := held[x.pid]
+		if !ok {
+			inodes = pidSocketInodes(x.pid)
+			held[x.pid] = inodes
+		}
+		alive[x.key] = inodes == nil || inodes[x.inode]
+	}
+	return alive
+}
+
+// pidSocketInodes returns the socket inodes pid holds: empty when it has
+// exited, nil when its fds cannot be read.
+func pidSocketInodes(pid int) map[string]bool {
+	fdDir := filepath.Join(procRoot, strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]bool{}
+	}
+	if err != nil {
+		return nil
+	}
+	inodes := make(map[string]bool)
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err == nil && strings.HasPrefix(link, "socket:[") {
+			inodes[link[8:len(link)-1]] = true
+		}
+	}
+	return inodes
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package tracker
+
+import "testing"
+
+func TestSocketsAlive(t *testing.T) {
+	p := newFakeProc(t)
+	p.add(100, "game", "1001", "1002")
+	p.add(200, "voice", "2001")
+
+	targets := []focusTarget{
+		{key: "open", pid: 100, inode: "1002"},
+		{key: "closed", pid: 100, inode: "1003"},
+		{key: "other", pid: 200, inode: "2001"},
+		{key: "exited", pid: 300, inode: "3001"},
+		{key: "no owner", pid: 0, inode: "4001"},
+		{key: "no inode", pid: 100, inode: ""},
+		{key: "inode 0", pid: 100, inode: "0"},
+	}
+	alive := socketsAlive(targets)
+	want := map[string]bool{
+		"open": true, "closed": false, "other": true, "exited": false,
+		"no owner": true, "no inode": true, "inode 0": true,
+	}
+	for key, w := range want {
+		if alive[key] != w {
+			t.Errorf("%s: alive %v, want %v", key, alive[key], w)
+		}
+	}
+
+	p.remove(200)
+	if socketsAlive(targets[2:3])["other"] {
+		t.Error("socket of an exited process still open")
+	}
+}
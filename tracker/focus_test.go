@@ -0,0 +1,258 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// focusSource is a fakeSource counting its scans and the probes of
+// each remote.
+type focusSource struct {
+	fakeSource
+	count sync.Mutex
+	scans int
+	pings map[string]int
+}
+
+func newFocusSource(conns ...Connection) *focusSource {
+	s := &focusSource{pings: make(map[string]int)}
+	s.set(conns...)
+	s.rtt = 5 * time.Millisecond
+	return s
+}
+
+func (s *focusSource) Scan() ([]*Connection, error) {
+	s.count.Lock()
+	s.scans++
+	s.count.Unlock()
+	return s.fakeSource.Scan()
+}
+
+func (s *focusSource) Ping(addr string, port int) (time.Duration, float64) {
+	s.count.Lock()
+	s.pings[addr]++
+	s.count.Unlock()
+	return s.fakeSource.Ping(addr, port)
+}
+
+// counts returns the scans so far and the probes of addr.
+func (s *focusSource) counts(addr string) (scans, pings int) {
+	s.count.Lock()
+	defer s.count.Unlock()
+	return s.scans, s.pings[addr]
+}
+
+// armFocusNow arms a focus loop on query without starting its goroutine,
+// for tests that tick it by hand.
+func armFocusNow(tr *Tracker, query string) *focus {
+	f := &focus{
+		FocusStatus: FocusStatus{Query: query, Interval: DefaultFocusInterval},
+		terms:       parseQuery(query),
+		stop:        make(chan struct{}),
+	}
+	tr.mu.Lock()
+	tr.focus = f
+	tr.mu.Unlock()
+	return f
+}
+
+func TestParseFocusInterval(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", DefaultFocusInterval, false},
+		{"100ms", 100 * time.Millisecond, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"50ms", 0, true},
+		{"1s", 0, true},
+		{"fast", 0, true},
+	} {
+		got, err := ParseFocusInterval(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFocusInterval(%q) = %s, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestArmFocusRefused(t *testing.T) {
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(newFocusSource())
+	if err := tr.ArmFocus("", DefaultFocusInterval); err == nil {
+		t.Error("armed without a filter")
+	}
+	if err := tr.ArmFocus("game", 50*time.Millisecond); err == nil {
+		t.Error("armed faster than the minimum interval")
+	}
+	if _, ok := tr.Focus(); ok {
+		t.Error("a refused focus is armed")
+	}
+}
+
+func TestFocusTick(t *testing.T) {
+	src := newFocusSource(
+		fakeConn("game", "203.0.113.5", 27015),
+		fakeConn("browser", "192.0.2.1", 443),
+		Connection{AppName: "game", PID: 100, Protocol: "tcp", State: StateListening, LocalAddr: "0.0.0.0", LocalPort: 27016},
+	)
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(src)
+	tr.scan()
+	_, before := src.counts("203.0.113.5")
+
+	f := armFocusNow(tr, "game")
+	tr.focusTick(f)
+	st, ok := tr.Focus()
+	if !ok || st.Ticks != 1 || st.Conns != 1 || st.Remotes != 1 {
+		t.Fatalf("status %+v", st)
+	}
+	if _, n := src.counts("203.0.113.5"); n != before+1 {
+		t.Errorf("%d probes of the focused remote in a tick", n-before)
+	}
+	if _, n := src.counts("192.0.2.1"); n > 1 {
+		t.Errorf("the tick probed a remote outside the filter")
+	}
+	snap := tr.FocusSnapshot()
+	if len(snap) != 1 || snap[0].AppName != "game" || snap[0].Ping == 0 {
+		t.Fatalf("focus snapshot %v", snap)
+	}
+
+	// While focused, full scans leave the game's remote to the loop.
+	_, before = src.counts("203.0.113.5")
+	for range 5 {
+		tr.scan()
+	}
+	if _, n := src.counts("203.0.113.5"); n != before {
+		t.Errorf("full scans probed the focused remote %d times", n-before)
+	}
+
+	tr.DisarmFocus()
+	if _, ok := tr.Focus(); ok || tr.FocusSnapshot() != nil {
+		t.Fatal("still armed")
+	}
+	for range 5 {
+		tr.scan()
+	}
+	if _, n := src.counts("203.0.113.5"); n == before {
+		t.Error("full scans do not probe the remote again after disarming")
+	}
+}
+
+func TestFocusBounds(t *testing.T) {
+	var conns []Connection
+	for i := range 40 {
+		c := fakeConn("game", fmt.Sprintf("203.0.113.%d", 1+i%10), 27015)
+		c.LocalPort = 50000 + i
+		conns = append(conns, c)
+	}
+	src := newFocusSource(conns...)
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.scan()
+
+	f := armFocusNow(tr, "game")
+	tr.focusTick(f)
+	st, _ := tr.Focus()
+	if st.Remotes != maxFocusRemotes {
+		t.Errorf("%d remotes probed, want %d", st.Remotes, maxFocusRemotes)
+	}
+	if st.Conns > maxFocusConns {
+		t.Errorf("%d connections refreshed, want at most %d", st.Conns, maxFocusConns)
+	}
+	probes := 0
+	for i := range 10 {
+		_, n := src.counts(fmt.Sprintf("203.0.113.%d", 1+i))
+		probes += n
+	}
+	if probes != maxFocusRemotes {
+		t.Errorf("%d connects in a tick, want one per remote", probes)
+	}
+}
+
+// TestFocusCadences runs the focus loop next to the full scan, with
+// readers on every side; run it with -race.
+func TestFocusCadences(t *testing.T) {
+	src := newFocusSource(
+		fakeConn("game", "203.0.113.5", 27015),
+		fakeConn("browser", "192.0.2.1", 443),
+		fakeConn("browser", "192.0.2.2", 443),
+	)
+	tr := NewTracker(time.Second, true)
+	tr.SetSource(src)
+	tr.Start()
+	defer tr.Stop()
+	if err := tr.ArmFocus("game", MinFocusInterval); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				tr.Snapshot()
+				tr.FocusSnapshot()
+				tr.Focus()
+			}
+		}
+	}()
+	updates := 0
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tr.Updates():
+				updates++
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, _ := tr.Focus()
+		if st.Ticks >= 8 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d focus ticks in 5s", st.Ticks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+
+	st, _ := tr.Focus()
+	scans, game := src.counts("203.0.113.5")
+	_, browser := src.counts("192.0.2.1")
+	if game < 8 {
+		t.Errorf("focused remote probed %d times in %d ticks", game, st.Ticks)
+	}
+	if browser > scans {
+		t.Errorf("unfocused remote probed %d times in %d full scans", browser, scans)
+	}
+	if scans > 3 {
+		t.Errorf("%d full scans in about a second at a 1s interval", scans)
+	}
+	if updates == 0 {
+		t.Error("no update signalled")
+	}
+
+	// After disarming, a tick already under way and a full scan may
+	// still probe the remote, the focus loop no more.
+	tr.DisarmFocus()
+	_, before := src.counts("203.0.113.5")
+	time.Sleep(5 * MinFocusInterval)
+	if _, after := src.counts("203.0.113.5"); after > before+2 {
+		t.Errorf("%d probes in %s after disarming", after-before, 5*MinFocusInterval)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package tracker
+
+import "strings"
+
+// socketsAlive reports which targets are still open from the rows of
+// their PIDs in the TCP tables. The tables cannot be asked for one PID,
+// so both are read whole and the other rows skipped; UDP targets, which
+// the table lists without a peer, and reads that fail count as open.
+func socketsAlive(targets []focusTarget) map[string]bool {
+	type tuple struct{ pid, local, remote int }
+	var rows map[tuple]bool
+	read, readable := false, false
+	alive := make(map[string]bool, len(targets))
+	for _, x := range targets {
+		if x.pid == 0 || !strings.HasPrefix(x.protocol, "tcp") {
+			alive[x.key] = true
+			continue
+		}
+		if !read {
+			read = true
+			v4, err4 := getTCPTable()
+			v6, err6 := getTCP6Table()
+			readable = err4 == nil && err6 == nil
+			rows = make(map[tuple]bool, len(v4)+len(v6))
+			for _, e := range append(v4, v6...) {
+				rows[tuple{e.pid, e.localPort, e.remotePort}] = true
+			}
+		}
+		alive[x.key] = !readable || rows[tuple{x.pid, x.localPort, x.remotePort}]
+	}
+	return alive
+}
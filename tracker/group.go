@@ -0,0 +1,111 @@
+package tracker
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GroupKeyFunc returns the key a connection is grouped under.
+type GroupKeyFunc func(c *Connection) string
+
+// GroupByApp groups connections by owning app name.
+func GroupByApp(c *Connection) string {
+	return c.AppName
+}
+
+// GroupByRemoteHost groups connections by remote IP, whatever process owns them.
+// Connections from remote agents are kept apart per agent.
+func GroupByRemoteHost(c *Connection) string {
+	if c.Host != "" {
+		return c.Host + "|" + c.RemoteAddr
+	}
+	return c.RemoteAddr
+}
+
+// Group aggregates the connections sharing a key.
+type Group struct {
+	Key    string
+	Conns  []*Connection
+	Apps   []string // distinct app names, sorted
+	TxRate float64
+	RxRate float64
+	// Ping is the most recent successful measurement in the group; for
+	// remote-host groups every member probes the same host.
+	Ping time.Duration
+	// Endpoints is the number of distinct remote address:port pairs the
+	// group's connections go to. One socket multiplexing many requests
+	// counts once, and listening sockets not at all.
+	Endpoints int
+	// WorstScore and AvgScore summarize the health scores of the Scored
+	// members that have one; both are 0 when Scored is 0.
+	WorstScore int
+	AvgScore   int
+	Scored     int
+	// SockMem sums the socket memory of the members that report it;
+	// HasSockMem is false when none does.
+	SockMem    uint64
+	HasSockMem bool
+}
+
+// GroupBy aggregates conns by key, in order of first appearance.
+func GroupBy(conns []*Connection, key GroupKeyFunc) []Group {
+	index := make(map[string]int)
+	var groups []Group
+	apps := make(map[string]map[string]bool)
+	endpoints := make(map[string]map[string]bool)
+	pingAt := make(map[string]time.Time)
+
+	for _, c := range conns {
+		k := key(c)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, Group{Key: k})
+			apps[k] = make(map[string]bool)
+			endpoints[k] = make(map[string]bool)
+		}
+		g := &groups[i]
+		g.Conns = append(g.Conns, c)
+		g.TxRate += c.TxRate
+		g.RxRate += c.RxRate
+		if !apps[k][c.AppName] {
+			apps[k][c.AppName] = true
+			g.Apps = append(g.Apps, c.AppName)
+		}
+		if c.RemotePort != 0 {
+			ep := net.JoinHostPort(c.RemoteAddr, strconv.Itoa(c.RemotePort))
+			if !endpoints[k][ep] {
+				endpoints[k][ep] = true
+				g.Endpoints++
+			}
+		}
+		if c.HasScore {
+			if g.Scored == 0 || c.Score < g.WorstScore {
+				g.WorstScore = c.Score
+			}
+			g.AvgScore += c.Score // summed here, divided below
+			g.Scored++
+		}
+		if c.SockMemInfo != nil {
+			g.SockMem += c.SockMem
+			g.HasSockMem = true
+		}
+		if c.Ping > 0 && c.LastUpdated.After(pingAt[k]) {
+			g.Ping = c.Ping
+			pingAt[k] = c.LastUpdated
+		}
+	}
+	for i := range groups {
+		if g := &groups[i]; g.Scored > 0 {
+			g.AvgScore = (g.AvgScore + g.Scored/2) / g.Scored
+		}
+		sort.Slice(groups[i].Apps, func(a, b int) bool {
+			return strings.ToLower(groups[i].Apps[a]) < strings.ToLower(groups[i].Apps[b])
+		})
+	}
+	return groups
+}
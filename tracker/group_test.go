@@ -0,0 +1,65 @@
+package tracker
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGroupBy(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	conns := []*Connection{
+		{AppName: "firefox", RemoteAddr: "192.0.2.1", RemotePort: 443, TxRate: 10, RxRate: 100,
+			Ping: 30 * time.Millisecond, LastUpdated: t0, HasScore: true, Score: 90},
+		{AppName: "curl", RemoteAddr: "192.0.2.1", RemotePort: 443, RxRate: 50,
+			Ping: 35 * time.Millisecond, LastUpdated: t0.Add(time.Second), HasScore: true, Score: 61},
+		{AppName: "Firefox", RemoteAddr: "192.0.2.1", RemotePort: 80},
+		{AppName: "firefox", RemoteAddr: "198.51.100.7", RemotePort: 443, TxRate: 5,
+			SockMemInfo: &SockMemInfo{}, SockMem: 4096},
+		{AppName: "firefox", RemoteAddr: "192.0.2.1", RemotePort: 443, Host: "db1:7070"},
+		{AppName: "nginx", RemoteAddr: "0.0.0.0", State: StateListening},
+	}
+
+	byApp := GroupBy(conns, GroupByApp)
+	keys := func(gs []Group) []string {
+		var out []string
+		for _, g := range gs {
+			out = append(out, g.Key)
+		}
+		return out
+	}
+	if got := keys(byApp); !slices.Equal(got, []string{"firefox", "curl", "Firefox", "nginx"}) {
+		t.Fatalf("app groups %v", got)
+	}
+	ff := byApp[0]
+	if len(ff.Conns) != 3 || ff.TxRate != 15 || ff.RxRate != 100 || ff.Endpoints != 2 {
+		t.Errorf("firefox: %d conns, tx %v, rx %v, %d endpoints", len(ff.Conns), ff.TxRate, ff.RxRate, ff.Endpoints)
+	}
+	if !ff.HasSockMem || ff.SockMem != 4096 || ff.Scored != 1 || ff.WorstScore != 90 {
+		t.Errorf("firefox: sockmem %d (%v), scores %d worst %d", ff.SockMem, ff.HasSockMem, ff.Scored, ff.WorstScore)
+	}
+	if nginx := byApp[3]; nginx.Endpoints != 0 || nginx.Ping != 0 {
+		t.Errorf("listener counted as an endpoint: %+v", nginx)
+	}
+
+	byHost := GroupBy(conns, GroupByRemoteHost)
+	if got := keys(byHost); !slices.Equal(got, []string{"192.0.2.1", "198.51.100.7", "db1:7070|192.0.2.1", "0.0.0.0"}) {
+		t.Fatalf("host groups %v", got)
+	}
+	h := byHost[0]
+	if !slices.Equal(h.Apps, []string{"curl", "firefox", "Firefox"}) {
+		t.Errorf("apps %v, want sorted case-insensitively", h.Apps)
+	}
+	if len(h.Conns) != 3 || h.RxRate != 150 || h.Endpoints != 2 {
+		t.Errorf("host: %d conns, rx %v, %d endpoints", len(h.Conns), h.RxRate, h.Endpoints)
+	}
+	if h.Ping != 35*time.Millisecond {
+		t.Errorf("ping %v, want the most recent measurement", h.Ping)
+	}
+	if h.Scored != 2 || h.WorstScore != 61 || h.AvgScore != 76 {
+		t.Errorf("scores: %d, worst %d, avg %d", h.Scored, h.WorstScore, h.AvgScore)
+	}
+	if h.HasSockMem {
+		t.Error("sockmem reported without any member having it")
+	}
+}
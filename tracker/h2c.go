@@ -0,0 +1,232 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// h2cPreface opens every cleartext HTTP/2 connection, from the client.
+const h2cPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const (
+	// h2FrameHeaderLen is the size of an HTTP/2 frame header.
+	h2FrameHeaderLen = 9
+	// maxH2CFlows bounds the h2c connections followed; new ones beyond it
+	// are not.
+	maxH2CFlows = 1024
+	// maxH2CStreams bounds the open streams counted per connection.
+	maxH2CStreams = 1024
+)
+
+// HTTP/2 frame types and the flag the stream count uses (RFC 9113 section 6).
+const (
+	h2Data         = 0x0
+	h2Headers      = 0x1
+	h2Priority     = 0x2
+	h2RSTStream    = 0x3
+	h2Settings     = 0x4
+	h2PushPromise  = 0x5
+	h2Ping         = 0x6
+	h2GoAway       = 0x7
+	h2WindowUpdate = 0x8
+	h2Continuation = 0x9
+
+	h2EndStream = 0x1
+)
+
+// Stream hint sources, for Connection.StreamHintSource.
+const (
+	StreamsH2C       = "h2c"       // HTTP/2 frame headers in the packet capture
+	StreamsConntrack = "conntrack" // flows through an unconnected UDP socket
+)
+
+// h2FrameHeader is the fixed header in front of every HTTP/2 frame.
+type h2FrameHeader struct {
+	length int
+	typ    byte
+	flags  byte
+	stream uint32
+}
+
+// parseH2FrameHeader reads the frame header at the start of b. ok is false
+// when b is short, or when the header cannot be one: a frame type that
+// belongs on stream 0 on another stream, or the reverse. Unknown types
+// (extensions) are accepted, as peers must ignore them.
+func parseH2FrameHeader(b []byte) (h h2FrameHeader, ok bool) {
+	if len(b) < h2FrameHeaderLen {
+		return h, false
+	}
+	h.length = int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	h.typ, h.flags = b[3], b[4]
+	h.stream = binary.BigEndian.Uint32(b[5:9]) &^ (1 << 31)
+	switch h.typ {
+	case h2Data, h2Headers, h2Priority, h2RSTStream, h2PushPromise, h2Continuation:
+		return h, h.stream != 0
+	case h2Settings, h2Ping, h2GoAway:
+		return h, h.stream == 0
+	}
+	return h, true
+}
+
+// h2cReader finds the frame headers in one direction of a TCP connection,
+// from payloads in sequence order. It reads headers only: frame bodies are
+// skipped by their length.
+type h2cReader struct {
+	started bool
+	next    uint32 // sequence number of the next byte expected
+	skip    int    // bytes left of the frame body (or preface) being skipped
+	header  []byte // a frame header split across payloads
+}
+
+// feed reads the frame headers of a payload starting at sequence number
+// seq, calling frame for each. A retransmitted payload is read only past
+// what was read before. It returns false when the reader lost its place:
+// on a gap in the sequence numbers, as when a packet was not inspected, or
+// on bytes that are not a frame header.
+func (r *h2cReader) feed(seq uint32, payload []byte, frame func(h2FrameHeader)) bool {
+	if !r.started {
+		r.started, r.next = true, seq
+	}
+	switch d := int32(seq - r.next); {
+	case d > 0:
+		return false
+	case d < 0:
+		if -int(d) >= len(payload) {
+			return true
+		}
+		payload = payload[-d:]
+	}
+	r.next += uint32(len(payload))
+	for len(payload) > 0 {
+		if r.skip > 0 {
+			n := min(r.skip, len(payload))
+			r.skip -= n
+			payload = payload[n:]
+			continue
+		}
+		n := min(h2FrameHeaderLen-len(r.header), len(payload))
+		r.header = append(r.header, payload[:n]...)
+		payload = payload[n:]
+		if len(r.header) < h2FrameHeaderLen {
+			break
+		}
+		h, ok := parseH2FrameHeader(r.header)
+		if !ok {
+			return false
+		}
+		frame(h)
+		r.skip, r.header = h.length, r.header[:0]
+	}
+	return true
+}
+
+// h2cConn counts the open streams of one h2c connection from the frame
+// headers of both directions: a stream opens with its first HEADERS and
+// closes once both sides ended it, or either reset it.
+type h2cConn struct {
+	dirs    [2]h2cReader // outbound, inbound
+	streams map[uint32]byte
+	last    [2]uint32 // highest stream ID opened, by parity
+	peak    int       // most streams open at once since the last hint
+	seen    time.Time
+}
+
+// newH2CConn starts counting a connection whose preface went the way of
+// outbound.
+func newH2CConn(outbound bool) *h2cConn {
+	c := &h2cConn{streams: make(map[uint32]byte)}
+	c.dirs[h2cDir(outbound)].skip = len(h2cPreface)
+	return c
+}
+
+func h2cDir(outbound bool) int {
+	if outbound {
+		return 0
+	}
+	return 1
+}
+
+// frame applies a frame header sent in direction dir.
+func (c *h2cConn) frame(dir int, h h2FrameHeader) {
+	switch h.typ {
+	case h2Headers, h2Data:
+		half, open := c.streams[h.stream]
+		if !open && h.typ == h2Headers && h.stream > c.last[h.stream&1] && len(c.streams) < maxH2CStreams {
+			c.last[h.stream&1], open = h.stream, true
+		}
+		if !open {
+			return
+		}
+		if h.flags&h2EndStream != 0 {
+			half |= 1 << dir
+		}
+		if half == 3 {
+			delete(c.streams, h.stream)
+			return
+		}
+		c.streams[h.stream] = half
+		c.peak = max(c.peak, len(c.streams))
+	case h2RSTStream:
+		delete(c.streams, h.stream)
+	}
+}
+
+// h2cFlows follows the h2c connections the packet capture sees.
+type h2cFlows struct {
+	mu    sync.Mutex
+	flows map[sniFlow]*h2cConn
+}
+
+// observe reads a TCP payload captured on flow. It returns whether the flow
+// is an h2c connection still followed, whose every payload it wants to
+// see: one whose first payload held the whole preface, and where the frame
+// headers have not been lost track of since.
+func (h *h2cFlows) observe(flow sniFlow, outbound bool, seq uint32, payload []byte, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.flows[flow]
+	if c == nil {
+		if !strings.HasPrefix(string(payload), h2cPreface) || len(h.flows) >= maxH2CFlows {
+			return false
+		}
+		if h.flows == nil {
+			h.flows = make(map[sniFlow]*h2cConn)
+		}
+		c = newH2CConn(outbound)
+		h.flows[flow] = c
+	}
+	dir := h2cDir(outbound)
+	if !c.dirs[dir].feed(seq, payload, func(f h2FrameHeader) { c.frame(dir, f) }) {
+		delete(h.flows, flow)
+		return false
+	}
+	c.seen = now
+	return true
+}
+
+// hint returns the most streams open at once on flow since the last call,
+// and whether it is an h2c connection.
+func (h *h2cFlows) hint(flow sniFlow) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.flows[flow]
+	if c == nil {
+		return 0, false
+	}
+	n := c.peak
+	c.peak = len(c.streams)
+	return n, true
+}
+
+// prune forgets connections without packets for captureFlowTTL.
+func (h *h2cFlows) prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for flow, c := range h.flows {
+		if now.Sub(c.seen) > captureFlowTTL {
+			delete(h.flows, flow)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseH2FrameHeader(t *testing.T) {
+	client := readPacket(t, "h2c/client.bin")
+	tests := []struct {
+		name string
+		b    []byte
+		want h2FrameHeader
+		ok   bool
+	}{
+		{"settings", client[24:], h2FrameHeader{24, h2Settings, 0, 0}, true},
+		{"window update", client[57:], h2FrameHeader{4, h2WindowUpdate, 0, 0}, true},
+		{"headers", client[70:], h2FrameHeader{39, h2Headers, 0x5, 1}, true},
+		{"settings ack", client[154:], h2FrameHeader{0, h2Settings, 0x1, 0}, true},
+		{"reserved bit", []byte{0, 0, 4, h2Data, 1, 0x80, 0, 0, 3}, h2FrameHeader{4, h2Data, 1, 3}, true},
+		{"extension type", []byte{0, 0, 2, 0x10, 0, 0, 0, 0, 0}, h2FrameHeader{2, 0x10, 0, 0}, true},
+		{"short", client[24:32], h2FrameHeader{}, false},
+		{"headers on stream 0", []byte{0, 0, 0, h2Headers, 4, 0, 0, 0, 0}, h2FrameHeader{}, false},
+		{"settings on a stream", []byte{0, 0, 0, h2Settings, 0, 0, 0, 0, 1}, h2FrameHeader{}, false},
+		{"data on stream 0", []byte{0, 0, 1, h2Data, 0, 0, 0, 0, 0}, h2FrameHeader{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseH2FrameHeader(tt.b)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("%s: %+v %v, want %+v %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// h2cSegments cuts b into TCP payloads of size bytes, numbered from seq.
+// The first is at least first bytes long.
+func h2cSegments(b []byte, seq uint32, first, size int) (segs [][]byte, seqs []uint32) {
+	for off := 0; off < len(b); {
+		n := size
+		if off == 0 {
+			n = max(first, size)
+		}
+		segs = append(segs, b[off:min(len(b), off+n)])
+		seqs = append(seqs, seq+uint32(off))
+		off += n
+	}
+	return segs, seqs
+}
+
+// TestH2CStreams replays a captured h2c connection: three GETs in
+// parallel, then a fourth, in the order the peers sent them.
+func TestH2CStreams(t *testing.T) {
+	client, server := readPacket(t, "h2c/client.bin"), readPacket(t, "h2c/server.bin")
+	flow := sniFlow{netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("198.51.100.7:8080"), false}
+	const clientISN, serverISN = 0xfffffff0, 1000 // the client's wraps around
+	steps := []struct {
+		outbound bool
+		from, to int
+		open     int
+	}{
+		{true, 0, 163, 3},    // preface, settings, the three GETs
+		{false, 0, 148, 2},   // settings, the response to stream 5
+		{false, 148, 220, 0}, // streams 1 and 3
+		{true, 163, 186, 1},  // the fourth GET
+		{false, 220, 262, 0}, // its response
+	}
+	for _, size := range []int{1, 5, 9, 64, 1500} {
+		var h h2cFlows
+		now := time.Now()
+		for i, st := range steps {
+			b, isn := server, uint32(serverISN)
+			if st.outbound {
+				b, isn = client, clientISN
+			}
+			first := 0
+			if i == 0 {
+				first = len(h2cPreface) // as one write, with the settings
+			}
+			segs, seqs := h2cSegments(b[st.from:st.to], isn+uint32(st.from), first, size)
+			for j := range segs {
+				if !h.observe(flow, st.outbound, seqs[j], segs[j], now) {
+					t.Fatalf("size %d, step %d: lost the connection at segment %d", size, i+1, j)
+				}
+			}
+			c := h.flows[flow]
+			if len(c.streams) != st.open {
+				t.Errorf("size %d, step %d: %d streams open, want %d", size, i+1, len(c.streams), st.open)
+			}
+			if i == 2 {
+				if n, ok := h.hint(flow); !ok || n != 3 {
+					t.Errorf("size %d: hint %d %v after the parallel GETs, want 3", size, n, ok)
+				}
+			}
+		}
+		if n, _ := h.hint(flow); n != 1 {
+			t.Errorf("size %d: hint %d after the fourth GET, want 1", size, n)
+		}
+		if n, _ := h.hint(flow); n != 0 {
+			t.Errorf("size %d: hint %d once idle, want 0", size, n)
+		}
+	}
+}
+
+func TestH2CLosesTrack(t *testing.T) {
+	client := readPacket(t, "h2c/client.bin")
+	flow := sniFlow{netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("198.51.100.7:8080"), false}
+	now := time.Now()
+
+	var h h2cFlows
+	if h.observe(flow, true, 1, []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n"), now) || len(h.flows) != 0 {
+		t.Error("HTTP/1.1 followed")
+	}
+
+	// A retransmission is read past what was seen; a gap ends the count.
+	if !h.observe(flow, true, 1, client[:80], now) || !h.observe(flow, true, 1, client[:100], now) || !h.observe(flow, true, 61, client[60:120], now) {
+		t.Fatal("retransmissions lost the connection")
+	}
+	if c := h.flows[flow]; len(c.streams) != 1 || c.dirs[0].next != 121 {
+		t.Fatalf("after retransmissions: %d streams, next %d", len(c.streams), c.dirs[0].next)
+	}
+	if h.observe(flow, true, 140, client[139:], now) || h.flows[flow] != nil {
+		t.Error("followed past a gap")
+	}
+
+	// Bytes that are no frame header where one is due.
+	bad := append([]byte(h2cPreface), 0, 0, 0, h2Headers, 0, 0, 0, 0, 0)
+	if h.observe(flow, true, 1, bad, now) {
+		t.Error("followed after HEADERS on stream 0")
+	}
+
+	h.observe(flow, true, 1, client, now)
+	h.prune(now.Add(captureFlowTTL))
+	if len(h.flows) != 1 {
+		t.Error("connection dropped before captureFlowTTL")
+	}
+	h.prune(now.Add(captureFlowTTL + time.Second))
+	if len(h.flows) != 0 {
+		t.Error("connection kept past captureFlowTTL")
+	}
+}
+
+// tcpSegment is ipPacketBytes for TCP with a sequence number.
+func tcpSegment(src, dst netip.AddrPort, seq uint32, payload []byte) []byte {
+	b := ipPacketBytes(6, src, dst, payload)
+	off := 20
+	if src.Addr().Is6() {
+		off = 40
+	}
+	binary.BigEndian.PutUint32(b[off+4:], seq)
+	return b
+}
+
+// TestH2CCapture runs the captured connection through -pcap-accounting and
+// checks the scanned connection's hint.
+func TestH2CCapture(t *testing.T) {
+	client, server := readPacket(t, "h2c/client.bin"), readPacket(t, "h2c/server.bin")
+	local, remote := netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("198.51.100.7:8080")
+	src := &fakePackets{}
+	src.add(tcpSegment(local, remote, 1, client[:163]), true)
+	src.add(tcpSegment(remote, local, 1, server[:148]), false)
+	src.add(tcpSegment(remote, local, 149, server[148:]), false)
+
+	scanned := &fakeSource{}
+	c := fakeConn("curl", "198.51.100.7", 8080)
+	c.LocalPort = 50000
+	c.HasByteCounts, c.TxBytes = true, 163 // from ss: kept
+	other := fakeConn("curl", "198.51.100.7", 443)
+	scanned.set(c, other)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(scanned)
+	tr.startCapture(src)
+	flow := sniFlow{local, remote, false}
+	waitFor(t, func() bool {
+		tr.capture.h2c.mu.Lock()
+		defer tr.capture.h2c.mu.Unlock()
+		h := tr.capture.h2c.flows[flow]
+		return h != nil && h.dirs[1].next == 1+uint32(len(server))
+	})
+	tr.capture.mu.Lock()
+	follow := tr.capture.flows[flow].follow
+	tr.capture.mu.Unlock()
+	if !follow {
+		t.Error("h2c flow not followed past its first packets")
+	}
+	tr.scan()
+	for _, got := range tr.Snapshot() {
+		switch got.RemotePort {
+		case 8080:
+			if got.StreamHint != 3 || got.StreamHintSource != StreamsH2C || got.TxBytes != 163 || got.CapturedBytes {
+				t.Errorf("h2c connection: %d streams from %q, tx %d, captured %v", got.StreamHint, got.StreamHintSource, got.TxBytes, got.CapturedBytes)
+			}
+		default:
+			if got.StreamHint != 0 || got.StreamHintSource != "" {
+				t.Errorf("hint on a connection the capture did not see: %d from %q", got.StreamHint, got.StreamHintSource)
+			}
+		}
+	}
+}
+
+func TestCaptureFollow(t *testing.T) {
+	local, remote := netip.MustParseAddrPort("10.0.0.2:50000"), netip.MustParseAddrPort("192.0.2.1:80")
+	c := &packetCapture{queue: make(chan capturedPacket, 2*inspectPackets), flows: make(map[sniFlow]*flowCount)}
+	big := make([]byte, 2*maxInspectBytes)
+	p, _ := decodeIPPacket(tcpSegment(local, remote, 7, big))
+	for range inspectPackets + 1 {
+		c.count(p, true, time.Now())
+	}
+	if len(c.queue) != inspectPackets {
+		t.Fatalf("%d packets inspected, want %d", len(c.queue), inspectPackets)
+	}
+	if q := <-c.queue; q.seq != 7 || len(q.payload) != maxInspectBytes {
+		t.Errorf("queued seq %d, %d bytes", q.seq, len(q.payload))
+	}
+
+	for len(c.queue) > 0 {
+		<-c.queue
+	}
+
+	c.setFollow(sniFlow{local, remote, false}, true)
+	c.count(p, true, time.Now())
+	if len(c.queue) != 1 {
+		t.Fatal("followed flow not inspected")
+	}
+	if q := <-c.queue; len(q.payload) != len(big) {
+		t.Errorf("followed flow's payload cut to %d bytes", len(q.payload))
+	}
+}
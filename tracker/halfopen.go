@@ -0,0 +1,154 @@
+package tracker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HalfOpenRule sets when an established connection is suspected to be
+// half-open: its peer gone (crashed, or NAT state expired) while the socket
+// still says ESTABLISHED. Every condition is required, so an idle
+// connection kept alive by its app is not flagged:
+//
+//   - its byte counters have not moved for Idle, and
+//   - its remote host has been unreachable for Unreachable, or the kernel
+//     has retransmitted at least halfOpenRetrans times since data last
+//     moved.
+//
+// A zero Idle turns detection off. Connections without byte counters (the
+// proc scanner, UDP, Windows) are never flagged.
+type HalfOpenRule struct {
+	Idle        time.Duration
+	Unreachable time.Duration
+}
+
+// DefaultHalfOpenRule flags a connection idle for 3 minutes whose peer
+// has been unreachable for a minute.
+var DefaultHalfOpenRule = HalfOpenRule{Idle: 3 * time.Minute, Unreachable: time.Minute}
+
+// halfOpenRetrans is how many retransmits since data last moved count as
+// the kernel retrying without acks.
+const halfOpenRetrans = 3
+
+// ParseHalfOpen parses the half_open_idle and half_open_unreachable
+// settings: "" is the default, and an idle of "0" turns detection off.
+func ParseHalfOpen(idle, unreachable string) (HalfOpenRule, error) {
+	r := DefaultHalfOpenRule
+	for _, s := range []struct {
+		name, value string
+		d           *time.Duration
+	}{{"half_open_idle", idle, &r.Idle}, {"half_open_unreachable", unreachable, &r.Unreachable}} {
+		if s.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s.value)
+		if err != nil || d < 0 {
+			return HalfOpenRule{}, fmt.Errorf("%s: %q is not a duration", s.name, s.value)
+		}
+		*s.d = d
+	}
+	return r, nil
+}
+
+// noteData records the connection's byte counters, restarting the idle
+// time when they moved since the last scan. Caller must hold the tracker
+// lock.
+func (c *Connection) noteData(now time.Time) {
+	if !c.dataAt.IsZero() && c.TxBytes == c.dataTx && c.RxBytes == c.dataRx {
+		return
+	}
+	c.dataTx, c.dataRx, c.dataAt = c.TxBytes, c.RxBytes, now
+	c.retransAtData = c.retrans()
+}
+
+// retrans is the socket's retransmit count, 0 when the scanner has none.
+func (c *Connection) retrans() uint64 {
+	if c.TCPInfo == nil || !c.TCPInfo.HasRetrans {
+		return 0
+	}
+	return c.TCPInfo.Retrans
+}
+
+// halfOpenReason returns why the connection is suspected to be half-open,
+// e.g. "no data for 3m, peer unreachable for 2m, 14 retransmits", or ""
+// when r's conditions are not all met. noteData must have been called
+// for the scan.
+func (c *Connection) halfOpenReason(now time.Time, r HalfOpenRule) string {
+	if r.Idle <= 0 || c.State != StateEstablished || !c.HasByteCounts {
+		return ""
+	}
+	idle := now.Sub(c.dataAt)
+	if idle < r.Idle {
+		return ""
+	}
+	down := c.UnreachableFor(now)
+	retries := c.retrans() - min(c.retransAtData, c.retrans())
+	if !(down > 0 && down >= r.Unreachable) && retries < halfOpenRetrans {
+		return ""
+	}
+	parts := []string{"no data for " + shortDuration(idle)}
+	if down > 0 {
+		parts = append(parts, "peer unreachable for "+shortDuration(down))
+	}
+	if retries > 0 {
+		parts = append(parts, fmt.Sprintf("%d retransmits", retries))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// shortDuration is d to the second under a minute and to the minute
+// above, e.g. "45s", "3m" or "1h5m".
+func shortDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
+
+// checkHalfOpen updates every connection's half-open suspicion after the
+// outages are stamped, and logs the ones raised and cleared. Caller must
+// hold the tracker lock.
+func (t *Tracker) checkHalfOpen(now time.Time) {
+	type change struct {
+		c      *Connection
+		raised bool
+	}
+	var changes []change
+	for _, c := range t.connections {
+		if c.State != StateEstablished || !c.HasByteCounts {
+			c.dataAt = time.Time{}
+		} else {
+			c.noteData(now)
+		}
+		reason := c.halfOpenReason(now, t.halfOpen)
+		c.HalfOpenReason = reason
+		switch {
+		case reason != "" && !c.HalfOpen:
+			c.HalfOpen, c.HalfOpenSince = true, now
+			changes = append(changes, change{c, true})
+		case reason == "" && c.HalfOpen:
+			c.HalfOpen, c.HalfOpenSince = false, time.Time{}
+			changes = append(changes, change{c, false})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].c.Key() < changes[j].c.Key() })
+	for _, ch := range changes {
+		c := ch.c
+		remote := fmt.Sprintf("%s:%d", c.RemoteAddr, c.RemotePort)
+		if ch.raised {
+			t.emit(now, SeverityWarn, EventHalfOpen, "state", "raised", "app", c.AppName, "remote", remote, "reason", c.HalfOpenReason)
+		} else {
+			t.emit(now, SeverityInfo, EventHalfOpen, "state", "cleared", "app", c.AppName, "remote", remote)
+		}
+	}
+}
+
+// SetHalfOpen sets when established connections are suspected to be
+// half-open. It is safe to call while the tracker is running.
+func (t *Tracker) SetHalfOpen(r HalfOpenRule) {
+	t.mu.Lock()
+	t.halfOpen = r
+	t.mu.Unlock()
+}
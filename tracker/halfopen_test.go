@@ -0,0 +1,166 @@
+package tracker
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseHalfOpen(t *testing.T) {
+	tests := []struct {
+		idle, unreachable string
+		want              HalfOpenRule
+		wantErr           bool
+	}{
+		{"", "", DefaultHalfOpenRule, false},
+		{"10m", "", HalfOpenRule{Idle: 10 * time.Minute, Unreachable: time.Minute}, false},
+		{"0", "30s", HalfOpenRule{Unreachable: 30 * time.Second}, false},
+		{"-1m", "", HalfOpenRule{}, true},
+		{"", "soon", HalfOpenRule{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHalfOpen(tt.idle, tt.unreachable)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseHalfOpen(%q, %q) = %+v, %v", tt.idle, tt.unreachable, got, err)
+		}
+	}
+}
+
+// halfOpenInputs is one synthetic combination of what the heuristic looks
+// at, as of a scan a while after data last moved.
+type halfOpenInputs struct {
+	idle        time.Duration // since the byte counters last moved
+	unreachable time.Duration // the peer unreachable for; 0 while it answers
+	retransAt   uint64        // retransmits when data last moved
+	retrans     uint64        // retransmits now
+	noRetrans   bool          // the scanner has no retransmit count
+	moved       bool          // the counters moved in this scan
+	state       ConnState
+	noCounters  bool
+}
+
+// halfOpenConn is a connection in the state in, and the time of the scan.
+func halfOpenConn(in halfOpenInputs) (*Connection, time.Time) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	c := fakeConn("app", "203.0.113.5", 443)
+	c.HasByteCounts, c.TxBytes, c.RxBytes = !in.noCounters, 1000, 5000
+	c.TCPInfo = &TCPInfo{Retrans: in.retransAt, HasRetrans: !in.noRetrans}
+	c.noteData(start)
+
+	now := start.Add(in.idle)
+	if in.state != "" {
+		c.State = in.state
+	}
+	c.TCPInfo.Retrans = in.retrans
+	if in.moved {
+		c.RxBytes += 52 // a keepalive answered with data
+	}
+	if in.unreachable > 0 {
+		c.UnreachableSince = now.Add(-in.unreachable)
+	}
+	c.noteData(now)
+	return &c, now
+}
+
+// TestHalfOpenReason runs the heuristic on combinations of its inputs. It
+// must not flag a connection that is merely idle: every condition is
+// required.
+func TestHalfOpenReason(t *testing.T) {
+	tests := []struct {
+		name string
+		in   halfOpenInputs
+		want string
+	}{
+		{"idle keepalive, peer answers", halfOpenInputs{idle: time.Hour}, ""},
+		{"idle keepalive, a few retransmits", halfOpenInputs{idle: time.Hour, retransAt: 4, retrans: 6}, ""},
+		{"peer gone", halfOpenInputs{idle: 5 * time.Minute, unreachable: 2 * time.Minute},
+			"no data for 5m, peer unreachable for 2m"},
+		{"peer just went unreachable", halfOpenInputs{idle: 5 * time.Minute, unreachable: 30 * time.Second}, ""},
+		{"peer gone, not idle long enough", halfOpenInputs{idle: 2 * time.Minute, unreachable: 2 * time.Minute}, ""},
+		{"peer gone, data still moving", halfOpenInputs{idle: 10 * time.Minute, unreachable: 5 * time.Minute, moved: true}, ""},
+		{"kernel retrying", halfOpenInputs{idle: 4 * time.Minute, retransAt: 2, retrans: 16},
+			"no data for 4m, 14 retransmits"},
+		{"retransmits before data moved", halfOpenInputs{idle: 4 * time.Minute, retransAt: 40, retrans: 41}, ""},
+		{"retransmit counter reset", halfOpenInputs{idle: 4 * time.Minute, retransAt: 40, retrans: 1}, ""},
+		{"no retransmit count", halfOpenInputs{idle: 4 * time.Minute, retransAt: 9, retrans: 20, noRetrans: true}, ""},
+		{"everything", halfOpenInputs{idle: 90 * time.Minute, unreachable: 80 * time.Minute, retrans: 14},
+			"no data for 1h30m, peer unreachable for 1h20m, 14 retransmits"},
+		{"closing", halfOpenInputs{idle: time.Hour, unreachable: time.Hour, state: StateCloseWait}, ""},
+		{"no byte counters", halfOpenInputs{idle: time.Hour, unreachable: time.Hour, noCounters: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, now := halfOpenConn(tt.in)
+			if got := c.halfOpenReason(now, DefaultHalfOpenRule); got != tt.want {
+				t.Errorf("reason %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	c, now := halfOpenConn(halfOpenInputs{idle: time.Hour, unreachable: time.Hour})
+	if got := c.halfOpenReason(now, HalfOpenRule{}); got != "" {
+		t.Errorf("detection off: %q", got)
+	}
+	if got := c.halfOpenReason(now, HalfOpenRule{Idle: 2 * time.Hour, Unreachable: time.Minute}); got != "" {
+		t.Errorf("a longer idle setting: %q", got)
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		45*time.Second + 400*time.Millisecond: "45s",
+		3*time.Minute + 20*time.Second:        "3m",
+		65 * time.Minute:                      "1h5m",
+		2 * time.Hour:                         "2h0m",
+	} {
+		if got := shortDuration(d); got != want {
+			t.Errorf("shortDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// TestCheckHalfOpen raises and clears the suspicion through the scan's
+// check, with an event each way, and filters on it.
+func TestCheckHalfOpen(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	rec := &eventRecorder{}
+	tr.SetEventSink(rec)
+	gone, idle := fakeConn("game", "203.0.113.5", 27015), fakeConn("ssh", "192.0.2.1", 22)
+	for _, c := range []*Connection{&gone, &idle} {
+		c.HasByteCounts = true
+		tr.connections[c.Key()] = c
+	}
+	start := time.Now()
+	tr.checkHalfOpen(start)
+	gone.UnreachableSince = start.Add(time.Minute)
+	tr.checkHalfOpen(start.Add(2 * time.Minute))
+	if gone.HalfOpen {
+		t.Fatal("flagged before half_open_idle")
+	}
+	at := start.Add(4 * time.Minute)
+	tr.checkHalfOpen(at)
+	if !gone.HalfOpen || !gone.HalfOpenSince.Equal(at) || gone.HalfOpenReason != "no data for 4m, peer unreachable for 3m" {
+		t.Fatalf("peer gone: %v since %s, %q", gone.HalfOpen, gone.HalfOpenSince, gone.HalfOpenReason)
+	}
+	if idle.HalfOpen {
+		t.Error("an idle connection whose peer answers is flagged")
+	}
+	if got := FilterConnections([]*Connection{&gone, &idle}, "halfopen:yes"); len(got) != 1 || got[0] != &gone {
+		t.Errorf("halfopen:yes matched %d connections", len(got))
+	}
+	tr.checkHalfOpen(at.Add(time.Minute)) // still suspect: no new event
+
+	gone.RxBytes += 100
+	gone.UnreachableSince = time.Time{}
+	tr.checkHalfOpen(at.Add(2 * time.Minute))
+	if gone.HalfOpen || gone.HalfOpenReason != "" {
+		t.Errorf("still flagged after data moved: %q", gone.HalfOpenReason)
+	}
+	want := []string{
+		"half_open state=raised app=game remote=203.0.113.5:27015 reason=no data for 4m, peer unreachable for 3m",
+		"half_open state=cleared app=game remote=203.0.113.5:27015",
+	}
+	if got := rec.lines(EventHalfOpen); !slices.Equal(got, want) {
+		t.Errorf("events\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package tracker
+
+import "time"
+
+// stallIntervals is how many scan intervals may pass without a completed
+// scan before the scan loop counts as stalled.
+const stallIntervals = 3
+
+// ScanDurationBuckets are the upper bounds of the scan duration histogram.
+var ScanDurationBuckets = [...]time.Duration{
+	10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Probe outcomes counted in Health.Probes.
+const (
+	ProbeOK     = "ok"     // every ping answered
+	ProbeLossy  = "lossy"  // some pings lost
+	ProbeFailed = "failed" // no answer
+)
+
+// effectiveScans is how many recent scans the effective interval is
+// averaged over.
+const effectiveScans = 10
+
+// probeOutcomes indexes perfRing.probes.
+var probeOutcomes = [...]string{ProbeOK, ProbeLossy, ProbeFailed}
+
+// Health is the state of the scan loop, from the same scan records as
+// PerfStats: whether it is keeping up, and running totals for metrics.
+type Health struct {
+	Started   time.Time     // when the tracker started
+	LastScan  time.Time     // end of the last completed scan; zero before the first
+	Interval  time.Duration // the scan interval
+	Scans     uint64        // completed scans
+	Errors    uint64        // scans that could not read the socket tables
+	LastError string        // the most recent of those errors
+
+	// Overruns counts cycles (scan plus pings) that took longer than the
+	// interval, and SkippedTicks the ticks dropped while they ran.
+	// EffectiveInterval is the mean time between recent scan starts; 0
+	// before the second scan.
+	Overruns          uint64
+	SkippedTicks      uint64
+	EffectiveInterval time.Duration
+
+	// Scan durations: counts of scans at or under each ScanDurationBuckets
+	// bound (cumulative), and the total time.
+	DurationBuckets []uint64
+	DurationSum     time.Duration
+
+	Probes map[string]uint64 // ping probes by outcome (ProbeOK, ...)
+
+	// Alert notifications (see SetNotifiers): dropped by the rate limit,
+	// and not delivered after the notifier's retries, with the last
+	// failure.
+	NotifyDropped     uint64
+	NotifyFailures    uint64
+	NotifyLastError   string
+	NotifyLastFailure time.Time
+}
+
+// Ready reports whether a scan has completed.
+func (h Health) Ready() bool {
+	return !h.LastScan.IsZero()
+}
+
+// Stalled reports whether no scan has completed for stallIntervals scan
+// intervals, counting from the start before the first scan, and how long
+// it has been. A tracker that was never started is not stalled.
+func (h Health) Stalled(now time.Time) (time.Duration, bool) {
+	from := h.LastScan
+	if from.IsZero() {
+		from = h.Started
+	}
+	if from.IsZero() {
+		return 0, false
+	}
+	since := now.Sub(from)
+	return since, since > stallIntervals*h.Interval
+}
+
+// Overrunning reports whether scans start noticeably less often than the
+// interval asks for, because cycles take longer than it.
+func (h Health) Overrunning() bool {
+	return h.EffectiveInterval > h.Interval*5/4
+}
+
+// Age is how old the data of the last completed scan is; 0 before the first.
+func (h Health) Age(now time.Time) time.Duration {
+	if h.LastScan.IsZero() {
+		return 0
+	}
+	return now.Sub(h.LastScan)
+}
+
+// Health returns the scan loop's health.
+func (t *Tracker) Health() Health {
+	h := t.perf.health()
+	h.Started = t.started
+	h.Interval = t.Interval()
+	t.notify.health(&h)
+	return h
+}
+
+// health fills in what the ring records.
+func (r *perfRing) health() Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := Health{
+		Scans:           r.scans,
+		Errors:          r.errors,
+		LastError:       r.lastErr,
+		Overruns:        r.overruns,
+		SkippedTicks:    r.skipped,
+		DurationBuckets: make([]uint64, len(ScanDurationBuckets)),
+		DurationSum:     r.durationSum,
+		Probes:          make(map[string]uint64, len(probeOutcomes)),
+	}
+	if r.count > 0 {
+		last := r.stats[(r.next-1+perfHistory)%perfHistory]
+		h.LastScan = last.Start.Add(last.Total)
+	}
+	n := min(r.count, effectiveScans)
+	// A suspend or clock step is not a slow scan: start after it.
+	for i := 1; i < n; i++ {
+		if r.stats[(r.next-i+perfHistory)%perfHistory].Gap != 0 {
+			n = i
+			break
+		}
+	}
+	if n > 1 {
+		first := r.stats[(r.next-n+perfHistory)%perfHistory]
+		last := r.stats[(r.next-1+perfHistory)%perfHistory]
+		h.EffectiveInterval = last.Start.Sub(first.Start) / time.Duration(n-1)
+	}
+	var total uint64
+	for i, c := range r.buckets {
+		total += c
+		h.DurationBuckets[i] = total
+	}
+	for i, o := range probeOutcomes {
+		h.Probes[o] = r.probes[i]
+	}
+	return h
+}
+
+// fail counts a scan that could not read the socket tables.
+func (r *perfRing) fail(err error) {
+	r.mu.Lock()
+	r.errors++
+	r.lastErr = err.Error()
+	r.mu.Unlock()
+}
+
+// probe counts a ping probe by its loss.
+func (r *perfRing) probe(loss float64) {
+	i := 0
+	switch {
+	case loss >= 100:
+		i = 2
+	case loss > 0:
+		i = 1
+	}
+	r.mu.Lock()
+	r.probes[i]++
+	r.mu.Unlock()
+}
@@ -0,0 +1,103 @@
+package tracker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthOverruns(t *testing.T) {
+	var r perfRing
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Ten scans of 250ms against a 100ms interval, started every 300ms.
+	for i := range 10 {
+		r.add(ScanStats{Start: t0.Add(time.Duration(i) * 300 * time.Millisecond), Total: 250 * time.Millisecond, Skipped: 2})
+	}
+	h := r.health()
+	h.Interval = 100 * time.Millisecond
+	if h.Overruns != 10 || h.SkippedTicks != 20 {
+		t.Errorf("%d overruns, %d skipped ticks", h.Overruns, h.SkippedTicks)
+	}
+	if h.EffectiveInterval != 300*time.Millisecond || !h.Overrunning() {
+		t.Errorf("effective interval %v, overrunning %v", h.EffectiveInterval, h.Overrunning())
+	}
+	if want := t0.Add(2950 * time.Millisecond); !h.LastScan.Equal(want) {
+		t.Errorf("last scan %v, want %v", h.LastScan, want)
+	}
+
+	// A suspend restarts the average after it.
+	r.add(ScanStats{Start: t0.Add(time.Hour), Total: 10 * time.Millisecond, Gap: time.Hour})
+	r.add(ScanStats{Start: t0.Add(time.Hour + 100*time.Millisecond), Total: 10 * time.Millisecond})
+	h = r.health()
+	h.Interval = 100 * time.Millisecond
+	if h.EffectiveInterval != 100*time.Millisecond || h.Overrunning() || h.Overruns != 10 {
+		t.Errorf("after a suspend: every %v, overrunning %v, %d overruns", h.EffectiveInterval, h.Overrunning(), h.Overruns)
+	}
+}
+
+// timedSource records when each scan starts and ends.
+type timedSource struct {
+	slowSource
+	mu     sync.Mutex
+	starts []time.Time
+	ends   []time.Time
+}
+
+func (s *timedSource) Scan() ([]*Connection, error) {
+	start := time.Now()
+	conns, err := s.slowSource.Scan()
+	s.mu.Lock()
+	s.starts = append(s.starts, start)
+	s.ends = append(s.ends, time.Now())
+	s.mu.Unlock()
+	return conns, err
+}
+
+// TestScanLoopSkipsTicks runs the scan loop with scans two and a half times
+// the interval: ticks that pass during a scan are dropped, so the next
+// scan waits for a fresh tick instead of starting straight away.
+func TestScanLoopSkipsTicks(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	src := &timedSource{slowSource: slowSource{scanDelay: 5 * interval / 2}}
+	src.set(fakeConn("web", "192.0.2.1", 443))
+	tr := NewTracker(interval, false)
+	tr.SetSource(src)
+	tr.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.Health().Scans < 6 && time.Now().Before(deadline) {
+		time.Sleep(interval)
+	}
+	tr.Stop()
+
+	h := tr.Health()
+	if h.Scans < 6 {
+		t.Fatalf("%d scans in 5s", h.Scans)
+	}
+	if h.Overruns != h.Scans || h.SkippedTicks < 2*h.Scans {
+		t.Errorf("%d scans, %d overruns, %d skipped ticks", h.Scans, h.Overruns, h.SkippedTicks)
+	}
+	if h.EffectiveInterval < src.scanDelay || !h.Overrunning() {
+		t.Errorf("effective interval %v (set %v), overrunning %v", h.EffectiveInterval, h.Interval, h.Overrunning())
+	}
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	// The first scan runs from Start itself; after that each one waits for
+	// a tick. With the queued tick kept, the loop would go straight on.
+	var idle []time.Duration
+	for i := 2; i < len(src.starts); i++ {
+		if src.starts[i].Before(src.ends[i-1]) {
+			t.Fatalf("scan %d started before scan %d ended", i+1, i)
+		}
+		idle = append(idle, src.starts[i].Sub(src.ends[i-1]))
+	}
+	waited := 0
+	for _, d := range idle {
+		if d >= time.Millisecond {
+			waited++
+		}
+	}
+	if waited*2 < len(idle) {
+		t.Errorf("scans started back to back: idle %v", idle)
+	}
+}
@@ -0,0 +1,263 @@
+package tracker
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HoursPerWeek is the number of cells in a heatmap: one per hour of the
+// week, Monday 00:00 first.
+const HoursPerWeek = 7 * 24
+
+// HeatMinProbes is how many probes a cell needs before it has a value;
+// below it, the cell is "no data" rather than one lucky or unlucky probe.
+const HeatMinProbes = 6
+
+const (
+	// heatBuckets is the size of a cell's RTT histogram. Bucket 0 holds
+	// RTTs below heatBase; bucket i spans a quarter octave from
+	// heatBase·2^((i-1)/4), so a median is within 10% of the real one. The
+	// last bucket is open-ended, from about 2.9s.
+	heatBuckets = 52
+	heatBase    = 500 * time.Microsecond
+	// heatCellMax probes in a cell halve its counts, so older weeks weigh
+	// less and a counter never overflows: a cell holds the last few weeks
+	// of that hour.
+	heatCellMax = 8192
+	// heatKeep is how long a series no longer probed is kept, and
+	// maxHeatSeries how many are kept at most.
+	heatKeep      = 30 * 24 * time.Hour
+	maxHeatSeries = 64
+)
+
+// HourOfWeek is t's cell in a heatmap: Monday 00:00-00:59 is 0, Sunday
+// 23:00-23:59 is 167, in t's location.
+func HourOfWeek(t time.Time) int {
+	day := (int(t.Weekday()) + 6) % 7 // Monday first
+	return day*24 + t.Hour()
+}
+
+// heatBucket is the histogram bucket of rtt.
+func heatBucket(rtt time.Duration) int {
+	if rtt < heatBase {
+		return 0
+	}
+	i := int(math.Floor(4*math.Log2(float64(rtt)/float64(heatBase)))) + 1
+	return min(i, heatBuckets-1)
+}
+
+// heatBucketValue is the RTT bucket i stands for: the geometric middle of
+// its span, or the lower bound of the open-ended last one, rounded up so
+// it stays in the bucket.
+func heatBucketValue(i int) time.Duration {
+	switch i {
+	case 0:
+		return heatBase / 2
+	case heatBuckets - 1:
+		return time.Duration(math.Ceil(float64(heatBase) * math.Exp2(float64(i-1)/4)))
+	}
+	return time.Duration(float64(heatBase) * math.Exp2((float64(i)-0.5)/4))
+}
+
+// heatCell accumulates the probes of one hour of the week. A probe that
+// got no answer counts toward loss but has no RTT.
+type heatCell struct {
+	RTT     map[int]uint32 `json:"rtt,omitempty"` // histogram bucket -> probes
+	Probes  uint32         `json:"probes"`
+	LossSum float64        `json:"loss_sum"` // sum of the probes' loss percentages
+}
+
+func (c *heatCell) add(rtt time.Duration, loss float64) {
+	if rtt > 0 {
+		if c.RTT == nil {
+			c.RTT = make(map[int]uint32)
+		}
+		c.RTT[heatBucket(rtt)]++
+	}
+	c.Probes++
+	c.LossSum += loss
+	if c.Probes < heatCellMax {
+		return
+	}
+	for i, n := range c.RTT {
+		if n /= 2; n == 0 {
+			delete(c.RTT, i)
+		} else {
+			c.RTT[i] = n
+		}
+	}
+	c.Probes /= 2
+	c.LossSum /= 2
+}
+
+// HeatCell is one hour of the week of a series.
+type HeatCell struct {
+	Probes int
+	Median time.Duration // median RTT of the answered probes; 0 when none answered
+	Loss   float64       // mean loss of the probes (0-100)
+}
+
+// HasRTT reports whether the cell has enough answered probes for Median.
+func (c HeatCell) HasRTT() bool { return c.Median > 0 }
+
+// HasLoss reports whether the cell has enough probes for Loss.
+func (c HeatCell) HasLoss() bool { return c.Probes >= HeatMinProbes }
+
+// summary is the cell's HeatCell. Median stays 0 below HeatMinProbes
+// answered probes.
+func (c *heatCell) summary() HeatCell {
+	h := HeatCell{Probes: int(c.Probes)}
+	if c.Probes > 0 {
+		h.Loss = c.LossSum / float64(c.Probes)
+	}
+	var n uint32
+	for _, k := range c.RTT {
+		n += k
+	}
+	if n < HeatMinProbes {
+		return h
+	}
+	var seen uint32
+	for i := 0; i < heatBuckets; i++ {
+		if seen += c.RTT[i]; 2*seen >= n {
+			h.Median = heatBucketValue(i)
+			break
+		}
+	}
+	return h
+}
+
+// heatSeries is one target's heatmap.
+type heatSeries struct {
+	Seen  time.Time        `json:"seen"`
+	Cells map[int]heatCell `json:"cells"` // hour of week -> cell; empty cells left out
+}
+
+// Heatmap accumulates probe results by hour of the week, across days and,
+// through the state file, across runs, to show when a path is worse: every
+// series has one cell per hour of the week with a bounded RTT histogram.
+// It is safe for concurrent use.
+type Heatmap struct {
+	mu     sync.Mutex
+	series map[string]*heatSeries
+}
+
+// NewHeatmap returns an empty heatmap.
+func NewHeatmap() *Heatmap {
+	return &Heatmap{series: make(map[string]*heatSeries)}
+}
+
+// Add records a probe of series made at now: its RTT, 0 when nothing
+// answered, and its loss percentage.
+func (h *Heatmap) Add(series string, now time.Time, rtt time.Duration, loss float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[series]
+	if s == nil {
+		s = &heatSeries{Cells: make(map[int]heatCell)}
+		h.series[series] = s
+	}
+	s.Seen = now
+	hour := HourOfWeek(now)
+	c := s.Cells[hour]
+	c.add(rtt, loss)
+	s.Cells[hour] = c
+}
+
+// Series returns the names of the series with data, sorted.
+func (h *Heatmap) Series() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.series))
+	for name := range h.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Grid returns a series' cells by hour of the week.
+func (h *Heatmap) Grid(series string) [HoursPerWeek]HeatCell {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var grid [HoursPerWeek]HeatCell
+	if s := h.series[series]; s != nil {
+		for hour, c := range s.Cells {
+			grid[hour] = c.summary()
+		}
+	}
+	return grid
+}
+
+// state returns the series to save, after dropping the ones not probed
+// for heatKeep and the oldest beyond maxHeatSeries.
+func (h *Heatmap) state(now time.Time) map[string]heatSeries {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(now)
+	out := make(map[string]heatSeries, len(h.series))
+	for name, s := range h.series {
+		cells := make(map[int]heatCell, len(s.Cells))
+		for hour, c := range s.Cells {
+			rtt := make(map[int]uint32, len(c.RTT))
+			for i, n := range c.RTT {
+				rtt[i] = n
+			}
+			c.RTT = rtt
+			cells[hour] = c
+		}
+		out[name] = heatSeries{Seen: s.Seen, Cells: cells}
+	}
+	return out
+}
+
+// restore replaces the heatmap with saved series, leaving out cells and
+// buckets outside the grid.
+func (h *Heatmap) restore(saved map[string]heatSeries, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.series = make(map[string]*heatSeries, len(saved))
+	for name, s := range saved {
+		cells := make(map[int]heatCell, len(s.Cells))
+		for hour, c := range s.Cells {
+			if hour < 0 || hour >= HoursPerWeek {
+				continue
+			}
+			for i := range c.RTT {
+				if i < 0 || i >= heatBuckets {
+					delete(c.RTT, i)
+				}
+			}
+			cells[hour] = c
+		}
+		h.series[name] = &heatSeries{Seen: s.Seen, Cells: cells}
+	}
+	h.prune(now)
+}
+
+// prune drops the series not probed for heatKeep, then the least recently
+// probed beyond maxHeatSeries. Caller must hold the lock.
+func (h *Heatmap) prune(now time.Time) {
+	names := make([]string, 0, len(h.series))
+	for name, s := range h.series {
+		if now.Sub(s.Seen) > heatKeep {
+			delete(h.series, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) <= maxHeatSeries {
+		return
+	}
+	sort.Slice(names, func(i, j int) bool { return h.series[names[i]].Seen.Before(h.series[names[j]].Seen) })
+	for _, name := range names[:len(names)-maxHeatSeries] {
+		delete(h.series, name)
+	}
+}
+
+// Heatmap returns the hour-of-week heatmap of the dual-stack targets.
+func (t *Tracker) Heatmap() *Heatmap {
+	return t.heatmap
+}
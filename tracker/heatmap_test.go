@@ -0,0 +1,194 @@
+package tracker
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// monday is the start of a week, in UTC.
+var monday = time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+
+func TestHourOfWeek(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{monday, 0},
+		{monday.Add(59 * time.Minute), 0},
+		{monday.Add(time.Hour), 1},
+		{monday.Add(2*24*time.Hour + 13*time.Hour + 30*time.Minute), 2*24 + 13},
+		{monday.Add(7*24*time.Hour - time.Second), HoursPerWeek - 1},
+		{monday.Add(7 * 24 * time.Hour), 0},
+	}
+	for _, tt := range tests {
+		if got := HourOfWeek(tt.at); got != tt.want {
+			t.Errorf("%s: hour %d, want %d", tt.at.Format(time.RFC1123), got, tt.want)
+		}
+	}
+	// The cell follows the time's location: 23:30 UTC on a Sunday is
+	// Monday 01:30 in Berlin.
+	berlin := time.FixedZone("CEST", 2*60*60)
+	if got := HourOfWeek(monday.Add(-30 * time.Minute).In(berlin)); got != 1 {
+		t.Errorf("in Berlin: hour %d, want 1", got)
+	}
+}
+
+func TestHeatBucket(t *testing.T) {
+	tests := []struct {
+		rtt  time.Duration
+		want int
+	}{
+		{0, 0},
+		{heatBase - 1, 0},
+		{heatBase, 1},
+		{2 * heatBase, 5},   // an octave is 4 buckets
+		{4*heatBase - 1, 8}, // just below the next octave
+		{time.Hour, heatBuckets - 1},
+	}
+	for _, tt := range tests {
+		if got := heatBucket(tt.rtt); got != tt.want {
+			t.Errorf("heatBucket(%s) = %d, want %d", tt.rtt, got, tt.want)
+		}
+	}
+	for i := range heatBuckets {
+		if got := heatBucket(heatBucketValue(i)); got != i {
+			t.Errorf("bucket %d stands for %s, which is in bucket %d", i, heatBucketValue(i), got)
+		}
+	}
+	// Between the first and the open-ended bucket, a bucket's value is
+	// within 10% of any RTT in it.
+	for rtt := heatBase; rtt < heatBucketValue(heatBuckets-1); rtt = rtt * 21 / 20 {
+		v := heatBucketValue(heatBucket(rtt))
+		if d := float64(v-rtt) / float64(rtt); d > 0.1 || d < -0.1 {
+			t.Errorf("%s stands for %s, %.1f%% off", rtt, v, 100*d)
+		}
+	}
+}
+
+func TestHeatCellSummary(t *testing.T) {
+	var c heatCell
+	for range HeatMinProbes - 1 {
+		c.add(20*time.Millisecond, 0)
+	}
+	c.add(0, 100) // unanswered
+	s := c.summary()
+	if s.HasRTT() || !s.HasLoss() || s.Probes != HeatMinProbes {
+		t.Fatalf("%d answered probes: %+v", HeatMinProbes-1, s)
+	}
+	if want := 100.0 / HeatMinProbes; s.Loss != want {
+		t.Errorf("loss %.2f, want %.2f", s.Loss, want)
+	}
+
+	c.add(20*time.Millisecond, 0)
+	c.add(200*time.Millisecond, 0)
+	c.add(300*time.Millisecond, 0)
+	if s = c.summary(); s.Median != heatBucketValue(heatBucket(20*time.Millisecond)) {
+		t.Errorf("median %s, want the 20ms bucket", s.Median)
+	}
+
+	var empty heatCell
+	if s := empty.summary(); s.HasRTT() || s.HasLoss() || s.Loss != 0 {
+		t.Errorf("empty cell: %+v", s)
+	}
+}
+
+// TestHeatCellBounded fills a cell past heatCellMax: its counts halve, and
+// the median and mean loss stay what they were.
+func TestHeatCellBounded(t *testing.T) {
+	var c heatCell
+	for i := range heatCellMax - 1 {
+		rtt := 10 * time.Millisecond
+		if i%4 == 0 {
+			rtt = 80 * time.Millisecond
+		}
+		c.add(rtt, float64(10*(i%2)))
+	}
+	before := c.summary()
+	c.add(10*time.Millisecond, 0)
+	after := c.summary()
+	if c.Probes != heatCellMax/2 {
+		t.Errorf("%d probes after halving", c.Probes)
+	}
+	if after.Median != before.Median || after.Loss < 4.9 || after.Loss > 5.1 {
+		t.Errorf("before %+v, after %+v", before, after)
+	}
+	if len(c.RTT) != 2 {
+		t.Errorf("%d buckets in use", len(c.RTT))
+	}
+}
+
+func TestHeatmapRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := monday.Add(3*24*time.Hour + 19*time.Hour) // Thursday 19:00
+	tr := NewTracker(time.Hour, false)
+	s := openTestState(t, path)
+	if err := tr.SetStateStore(s, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	h := tr.Heatmap()
+	for i := range 10 {
+		h.Add("example.com:443 IPv4", now, time.Duration(20+i)*time.Millisecond, 0)
+		h.Add("example.com:443 IPv6", now.Add(-time.Hour), 0, 100)
+	}
+	h.Add("example.com:443 IPv4", now.Add(time.Hour), 15*time.Millisecond, 0)
+	if err := tr.saveState(now); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	next := NewTracker(time.Hour, false)
+	if err := next.SetStateStore(openTestState(t, path), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range h.Series() {
+		if got, want := next.Heatmap().Grid(name), h.Grid(name); got != want {
+			t.Errorf("%s differs after the restart", name)
+		}
+	}
+	if got := fmt.Sprint(next.Heatmap().Series()); got != "[example.com:443 IPv4 example.com:443 IPv6]" {
+		t.Errorf("series %s", got)
+	}
+	g := next.Heatmap().Grid("example.com:443 IPv4")
+	if c := g[HourOfWeek(now)]; c.Probes != 10 || !c.HasRTT() {
+		t.Errorf("Thursday 19:00: %+v", c)
+	}
+	if c := g[HourOfWeek(now.Add(time.Hour))]; c.Probes != 1 || c.HasRTT() || c.HasLoss() {
+		t.Errorf("a single probe has a value: %+v", c)
+	}
+}
+
+func TestHeatmapRestoreBounds(t *testing.T) {
+	now := monday
+	h := NewHeatmap()
+	saved := map[string]heatSeries{
+		"kept": {Seen: now, Cells: map[int]heatCell{
+			0:            {RTT: map[int]uint32{3: 6, -1: 4, heatBuckets: 4}, Probes: 6},
+			HoursPerWeek: {RTT: map[int]uint32{3: 6}, Probes: 6},
+			-1:           {RTT: map[int]uint32{3: 6}, Probes: 6},
+		}},
+		"stale": {Seen: now.Add(-heatKeep - time.Hour), Cells: map[int]heatCell{0: {Probes: 6}}},
+	}
+	h.restore(saved, now)
+	if got := fmt.Sprint(h.Series()); got != "[kept]" {
+		t.Fatalf("series %s", got)
+	}
+	s := h.series["kept"]
+	if len(s.Cells) != 1 || len(s.Cells[0].RTT) != 1 {
+		t.Errorf("cells %v", s.Cells)
+	}
+
+	for i := range maxHeatSeries + 5 {
+		h.Add(fmt.Sprintf("target%02d", i), now.Add(time.Duration(i)*time.Second), time.Millisecond, 0)
+	}
+	st := h.state(now.Add(time.Minute))
+	if len(st) != maxHeatSeries {
+		t.Fatalf("%d series kept", len(st))
+	}
+	for _, name := range []string{"kept", "target00", "target04"} {
+		if _, ok := st[name]; ok {
+			t.Errorf("%s kept over newer series", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tracker
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxFrameConns caps how many connections are kept per buffered frame so the
+// pre-roll buffer stays bounded no matter how many sockets the host has.
+const maxFrameConns = 500
+
+// IncidentRecorder keeps a rolling pre-roll buffer of snapshots and, when an
+// alert fires, writes the pre-roll plus the following snapshots to a new
+// record file. After an incident it stays idle until the cooldown expires.
+type IncidentRecorder struct {
+	mu sync.Mutex
+
+	prefix     string
+	postFrames int
+	cooldown   time.Duration
+
+	preroll []RecordFrame // ring buffer
+	head    int           // index of the oldest frame
+	count   int
+
+	file      *os.File
+	enc       *json.Encoder
+	remaining int // post-roll frames still to write
+	lastEnd   time.Time
+	lastFile  string
+	files     []string // every incident file started, oldest first
+	lastErr   error
+}
+
+// NewIncidentRecorder creates a recorder that writes files named <prefix>-<timestamp>.jsonl,
+// holding preFrames snapshots before the alert and postFrames after it.
+func NewIncidentRecorder(prefix string, preFrames, postFrames int, cooldown time.Duration) *IncidentRecorder {
+	if preFrames < 1 {
+		preFrames = 1
+	}
+	return &IncidentRecorder{
+		prefix:     prefix,
+		postFrames: postFrames,
+		cooldown:   cooldown,
+		preroll:    make([]RecordFrame, preFrames),
+	}
+}
+
+// Observe feeds one scan result to the recorder.
+func (r *IncidentRecorder) Observe(now time.Time, conns []*Connection, alerts []Alert) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	frame := RecordFrame{Time: now, Alerts: alerts, Connections: conns}
+	if len(conns) > maxFrameConns {
+		frame.Connections = conns[:maxFrameConns]
+		frame.Truncated = len(conns) - maxFrameConns
+	}
+
+	if r.file != nil {
+		r.write(frame)
+		r.remaining--
+		if r.remaining <= 0 {
+			r.finish(now)
+		}
+		return
+	}
+
+	if len(alerts) > 0 && (r.lastEnd.IsZero() || now.Sub(r.lastEnd) >= r.cooldown) {
+		if r.start(now) {
+			r.write(frame)
+			r.remaining = r.postFrames
+			if r.remaining <= 0 {
+				r.finish(now)
+			}
+			return
+		}
+	}
+
+	r.push(frame)
+}
+
+// Active reports whether an incident is currently being written.
+func (r *IncidentRecorder) Active() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file != nil
+}
+
+// LastFile returns the path of the most recently started incident file.
+func (r *IncidentRecorder) LastFile() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastFile
+}
+
+// Files returns the paths of the incident files started so far, oldest
+// first.
+func (r *IncidentRecorder) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Err returns the last write error, if any.
+func (r *IncidentRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// Close flushes and closes any incident file in progress.
+func (r *IncidentRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	r.enc = nil
+	return err
+}
+
+func (r *IncidentRecorder) push(f RecordFrame) {
+	size := len(r.preroll)
+	if r.count < size {
+		r.preroll[(r.head+r.count)%size] = f
+		r.count++
+		return
+	}
+	r.preroll[r.head] = f
+	r.head = (r.head + 1) % size
+}
+
+// start opens a new incident file and flushes the pre-roll into it.
+func (r *IncidentRecorder) start(now time.Time) bool {
+	f, err := createRecordFile(r.prefix, now)
+	if err != nil {
+		r.lastErr = err
+		return false
+	}
+	r.file = f
+	r.enc = json.NewEncoder(f)
+	r.lastFile = f.Name()
+	r.files = append(r.files, r.lastFile)
+
+	size := len(r.preroll)
+	for i := 0; i < r.count; i++ {
+		r.write(r.preroll[(r.head+i)%size])
+		r.preroll[(r.head+i)%size] = RecordFrame{}
+	}
+	r.head = 0
+	r.count = 0
+	return true
+}
+
+func (r *IncidentRecorder) write(f RecordFrame) {
+	if err := r.enc.Encode(f); err != nil {
+		r.lastErr = err
+	}
+}
+
+func (r *IncidentRecorder) finish(now time.Time) {
+	if err := r.file.Close(); err != nil {
+		r.lastErr = err
+	}
+	r.file = nil
+	r.enc = nil
+	r.lastEnd = now
+}
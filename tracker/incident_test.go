@@ -0,0 +1,106 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readFrames decodes a record file.
+func readFrames(t *testing.T, path string) []RecordFrame {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var frames []RecordFrame
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var fr RecordFrame
+		if err := json.Unmarshal(sc.Bytes(), &fr); err != nil {
+			t.Fatalf("line %d: %v", len(frames)+1, err)
+		}
+		frames = append(frames, fr)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestIncidentRecorderPreAndPostRoll(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "incident")
+	r := NewIncidentRecorder(prefix, 3, 2, time.Minute)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return t0.Add(time.Duration(i) * time.Second) }
+	conns := []*Connection{{AppName: "app", RemoteAddr: "192.0.2.1", RemotePort: 443}}
+
+	// Five quiet scans: only the last three stay in the pre-roll.
+	for i := range 5 {
+		r.Observe(at(i), conns, nil)
+	}
+	if r.Active() {
+		t.Fatal("active before any alert")
+	}
+	alert := []Alert{{Key: "k", AppName: "app", Reason: "ping 300ms"}}
+	r.Observe(at(5), conns, alert)
+	if !r.Active() {
+		t.Fatal("not active after an alert")
+	}
+	r.Observe(at(6), conns, nil)
+	r.Observe(at(7), conns, nil)
+	if r.Active() {
+		t.Fatal("still active after the post-roll")
+	}
+	r.Observe(at(8), conns, nil) // back to the pre-roll
+
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	frames := readFrames(t, r.LastFile())
+	want := []int{2, 3, 4, 5, 6, 7}
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	for i, fr := range frames {
+		if !fr.Time.Equal(at(want[i])) {
+			t.Errorf("frame %d at %v, want %v", i, fr.Time, at(want[i]))
+		}
+		if got := len(fr.Alerts) > 0; got != (want[i] == 5) {
+			t.Errorf("frame %d: alerts %v", i, fr.Alerts)
+		}
+	}
+}
+
+func TestIncidentRecorderCooldown(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "incident")
+	r := NewIncidentRecorder(prefix, 1, 0, 10*time.Minute)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alert := []Alert{{Key: "k"}}
+
+	r.Observe(t0, nil, alert)
+	r.Observe(t0.Add(time.Minute), nil, alert)    // within the cooldown
+	r.Observe(t0.Add(11*time.Minute), nil, alert) // after it
+	if got := len(r.Files()); got != 2 {
+		t.Fatalf("%d files, want 2", got)
+	}
+}
+
+func TestIncidentRecorderTruncatesFrames(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "incident")
+	r := NewIncidentRecorder(prefix, 1, 0, 0)
+	conns := make([]*Connection, maxFrameConns+7)
+	for i := range conns {
+		conns[i] = &Connection{RemotePort: i}
+	}
+	r.Observe(time.Now(), conns, []Alert{{Key: "k"}})
+	frames := readFrames(t, r.LastFile())
+	if len(frames) != 1 || len(frames[0].Connections) != maxFrameConns || frames[0].Truncated != 7 {
+		t.Fatalf("got %d frames, %d connections, %d truncated", len(frames), len(frames[0].Connections), frames[0].Truncated)
+	}
+}
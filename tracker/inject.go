@@ -0,0 +1,254 @@
+package tracker
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InjectKind is the perturbation an Injection applies.
+type InjectKind string
+
+const (
+	InjectPingSpike   InjectKind = "ping-spike"   // raise or set the ping of matching connections
+	InjectLoss        InjectKind = "loss"         // raise or set their loss
+	InjectDrop        InjectKind = "conn-drop"    // hide them, as if they had closed
+	InjectNewListener InjectKind = "new-listener" // add an unacknowledged LISTEN socket
+)
+
+// Injection is a synthetic perturbation of the tracked data, for checking
+// that thresholds, alerts and exporters react without waiting for a real
+// outage. It applies to every snapshot (the TUI, -serve, the incident
+// recorder and scan exporters) while it lasts; the tracked connections
+// themselves are never changed, so data is clean again once it expires.
+// Connections it touches, and the ones it adds, have Injected set.
+type Injection struct {
+	Spec   string // as given, for display
+	Kind   InjectKind
+	Target string        // search query the connections must match; an app name for InjectNewListener
+	Ping   time.Duration // InjectPingSpike
+	Loss   float64       // InjectLoss, a percentage
+	Add    bool          // Ping or Loss is added to the measured value rather than replacing it
+	Port   int           // InjectNewListener
+	For    time.Duration
+	Until  time.Time // set by Inject
+
+	alerted bool // the new-listener alert was raised
+	logged  bool // its start went to the event log
+	terms   []queryTerm
+}
+
+// ParseInjection parses kind=target,args...,duration:
+//
+//	ping-spike=app:steam,+200ms,30s    add 200ms to steam's pings for 30s
+//	loss=service:https,25%,1m          25% loss on HTTPS connections
+//	conn-drop=app:firefox,45s          firefox's connections disappear
+//	new-listener=app:backdoor,4444,2m  a new listener on port 4444
+//
+// The target is a search query (see Tracker.Search), where app:NAME stands
+// for the plain word NAME; "all" matches every connection. A value with a
+// leading + is added to the measured one, otherwise it replaces it.
+func ParseInjection(spec string) (Injection, error) {
+	kind, rest, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return Injection{}, fmt.Errorf("inject %q: want kind=target,...,duration", spec)
+	}
+	args := strings.Split(rest, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	inj := Injection{Spec: spec, Kind: InjectKind(kind)}
+	want := 3
+	if inj.Kind == InjectDrop {
+		want = 2
+	}
+	switch inj.Kind {
+	case InjectPingSpike, InjectLoss, InjectDrop, InjectNewListener:
+	default:
+		return Injection{}, fmt.Errorf("inject %q: unknown kind %q (ping-spike, loss, conn-drop, new-listener)", spec, kind)
+	}
+	if len(args) != want || args[0] == "" {
+		return Injection{}, fmt.Errorf("inject %q: %s takes %d comma-separated values", spec, kind, want)
+	}
+	d, err := time.ParseDuration(args[want-1])
+	if err != nil || d <= 0 {
+		return Injection{}, fmt.Errorf("inject %q: invalid duration %q", spec, args[want-1])
+	}
+	inj.For = d
+	inj.Target = injectTarget(args[0])
+	value := args[1]
+	switch inj.Kind {
+	case InjectPingSpike:
+		value, inj.Add = strings.CutPrefix(value, "+")
+		inj.Ping, err = time.ParseDuration(value)
+		if err != nil || inj.Ping <= 0 {
+			return Injection{}, fmt.Errorf("inject %q: invalid ping %q", spec, args[1])
+		}
+	case InjectLoss:
+		value, inj.Add = strings.CutPrefix(value, "+")
+		inj.Loss, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || inj.Loss <= 0 || inj.Loss > 100 {
+			return Injection{}, fmt.Errorf("inject %q: invalid loss %q (want 1%% to 100%%)", spec, args[1])
+		}
+	case InjectNewListener:
+		inj.Port, err = strconv.Atoi(value)
+		if err != nil || inj.Port < 1 || inj.Port > 65535 {
+			return Injection{}, fmt.Errorf("inject %q: invalid port %q", spec, args[1])
+		}
+	}
+	if inj.Target != "*" && inj.Kind != InjectNewListener {
+		inj.terms = parseQuery(inj.Target)
+	}
+	return inj, nil
+}
+
+// injectTarget turns app:NAME words into the plain word NAME, which the
+// search matches against app names; "all" becomes "*".
+func injectTarget(s string) string {
+	if strings.EqualFold(s, "all") {
+		return "*"
+	}
+	fields := strings.Fields(s)
+	for i, f := range fields {
+		if name, ok := strings.CutPrefix(f, "app:"); ok {
+			fields[i] = name
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// matches reports whether the injection applies to c.
+func (inj *Injection) matches(c *Connection) bool {
+	return inj.Target == "*" || matchAll(c, inj.terms)
+}
+
+// Inject starts inj now; it expires after inj.For. Injections compose: a
+// connection matched by several gets all of them, in the order injected.
+// It is safe to call while the tracker is running.
+func (t *Tracker) Inject(inj Injection) {
+	t.mu.Lock()
+	inj.Until = time.Now().Add(inj.For)
+	t.injections = append(t.injections, &inj)
+	t.mu.Unlock()
+	t.touch()
+}
+
+// Injections returns the injections in effect, for a watermark.
+func (t *Tracker) Injections() []Injection {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := time.Now()
+	var out []Injection
+	for _, inj := range t.injections {
+		if now.Before(inj.Until) {
+			out = append(out, *inj)
+		}
+	}
+	return out
+}
+
+// pruneInjections drops expired injections, logging their start and end.
+// Caller must hold the lock.
+func (t *Tracker) pruneInjections(now time.Time) {
+	keep := t.injections[:0]
+	for _, inj := range t.injections {
+		if !inj.logged {
+			inj.logged = true
+			t.emit(now, SeverityWarn, EventInjection, "spec", inj.Spec, "for", inj.For.String())
+		}
+		if now.Before(inj.Until) {
+			keep = append(keep, inj)
+		} else {
+			t.emit(now, SeverityInfo, EventInjectionDone, "spec", inj.Spec)
+		}
+	}
+	clear(t.injections[len(keep):])
+	t.injections = keep
+}
+
+// inject applies the injections in effect to snapshot copies of the
+// connections, dropping and adding rows as they say. Caller must hold the
+// lock (a read lock will do).
+func (t *Tracker) inject(conns []*Connection, now time.Time) []*Connection {
+	if len(t.injections) == 0 {
+		return conns
+	}
+	out := conns[:0]
+	for _, c := range conns {
+		dropped := false
+		for _, inj := range t.injections {
+			if !now.Before(inj.Until) || inj.Kind == InjectNewListener || !inj.matches(c) {
+				continue
+			}
+			c.Injected = true
+			switch inj.Kind {
+			case InjectPingSpike:
+				if inj.Add {
+					c.Ping += inj.Ping
+				} else {
+					c.Ping = inj.Ping
+				}
+				c.PingCount = max(c.PingCount, 1)
+			case InjectLoss:
+				if inj.Add {
+					c.Loss = min(100, c.Loss+inj.Loss)
+				} else {
+					c.Loss = inj.Loss
+				}
+				c.PingCount = max(c.PingCount, 1)
+			case InjectDrop:
+				dropped = true
+			}
+		}
+		if !dropped {
+			out = append(out, c)
+		}
+	}
+	for _, inj := range t.injections {
+		if inj.Kind == InjectNewListener && now.Before(inj.Until) {
+			out = append(out, inj.listener())
+		}
+	}
+	return out
+}
+
+// listener is the synthetic socket of an InjectNewListener.
+func (inj *Injection) listener() *Connection {
+	return &Connection{
+		AppName:     inj.Target,
+		Protocol:    "tcp",
+		Family:      4,
+		LocalAddr:   "0.0.0.0",
+		LocalPort:   inj.Port,
+		RemoteAddr:  "0.0.0.0",
+		State:       StateListening,
+		NewListener: true,
+		Injected:    true,
+		FirstSeen:   inj.Until.Add(-inj.For),
+		LastUpdated: time.Now(),
+	}
+}
+
+// injectedAlerts raises the alert of each new-listener injection once, in
+// the first scan after it starts. Caller must hold the lock.
+func (t *Tracker) injectedAlerts(now time.Time) []Alert {
+	var alerts []Alert
+	for _, inj := range t.injections {
+		if inj.Kind != InjectNewListener || inj.alerted || !now.Before(inj.Until) {
+			continue
+		}
+		inj.alerted = true
+		c := inj.listener()
+		alerts = append(alerts, Alert{
+			Time:    now,
+			Kind:    AlertNewListener,
+			Key:     c.Key(),
+			AppName: c.AppName,
+			Remote:  net.JoinHostPort(c.LocalAddr, strconv.Itoa(c.LocalPort)),
+			Reason:  fmt.Sprintf("new listener on TCP %s:%d (injected: %s)", c.LocalAddr, c.LocalPort, inj.Spec),
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,183 @@
+package tracker
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseInjection(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Injection
+	}{
+		{"ping-spike=app:steam,+200ms,30s", Injection{Kind: InjectPingSpike, Target: "steam", Ping: 200 * time.Millisecond, Add: true, For: 30 * time.Second}},
+		{"ping-spike=all,80ms,1m", Injection{Kind: InjectPingSpike, Target: "*", Ping: 80 * time.Millisecond, For: time.Minute}},
+		{"loss=service:https,25%,1m", Injection{Kind: InjectLoss, Target: "service:https", Loss: 25, For: time.Minute}},
+		{"loss=app:a app:b, +5 , 2s", Injection{Kind: InjectLoss, Target: "a b", Loss: 5, Add: true, For: 2 * time.Second}},
+		{"conn-drop=app:firefox,45s", Injection{Kind: InjectDrop, Target: "firefox", For: 45 * time.Second}},
+		{"new-listener=app:backdoor,4444,2m", Injection{Kind: InjectNewListener, Target: "backdoor", Port: 4444, For: 2 * time.Minute}},
+	}
+	for _, tt := range tests {
+		got, err := ParseInjection(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if got.Spec != tt.spec || got.Kind != tt.want.Kind || got.Target != tt.want.Target || got.Ping != tt.want.Ping ||
+			got.Loss != tt.want.Loss || got.Add != tt.want.Add || got.Port != tt.want.Port || got.For != tt.want.For {
+			t.Errorf("%s: %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ spec, err string }{
+		{"ping-spike", "want kind=target"},
+		{"latency=all,1s,1s", `unknown kind "latency"`},
+		{"ping-spike=all,30s", "ping-spike takes 3 comma-separated values"},
+		{"conn-drop=all,1s,1s", "conn-drop takes 2"},
+		{"loss=,5%,1s", "loss takes 3"},
+		{"loss=all,5%,forever", `invalid duration "forever"`},
+		{"loss=all,5%,-1s", `invalid duration "-1s"`},
+		{"ping-spike=all,fast,1s", `invalid ping "fast"`},
+		{"ping-spike=all,-5ms,1s", `invalid ping "-5ms"`},
+		{"loss=all,0%,1s", `invalid loss "0%"`},
+		{"loss=all,101%,1s", `invalid loss "101%"`},
+		{"new-listener=app:x,70000,1s", `invalid port "70000"`},
+		{"new-listener=app:x,ssh,1s", `invalid port "ssh"`},
+	} {
+		_, err := ParseInjection(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.HasPrefix(err.Error(), "inject ") {
+			t.Errorf("%s: error %v, want %s", tt.spec, err, tt.err)
+		}
+	}
+}
+
+// scanRecorder keeps the snapshots handed to scan exporters.
+type scanRecorder struct {
+	mu    sync.Mutex
+	scans [][]*Connection
+}
+
+func (r *scanRecorder) ExportScan(now time.Time, conns []*Connection) {
+	r.mu.Lock()
+	r.scans = append(r.scans, conns)
+	r.mu.Unlock()
+}
+
+func (r *scanRecorder) last() []*Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scans[len(r.scans)-1]
+}
+
+func mustInject(t *testing.T, tr *Tracker, spec string) {
+	t.Helper()
+	inj, err := ParseInjection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Inject(inj)
+}
+
+// byApp indexes a snapshot by app name.
+func byApp(conns []*Connection) map[string]*Connection {
+	m := make(map[string]*Connection)
+	for _, c := range conns {
+		m[c.AppName] = c
+	}
+	return m
+}
+
+// TestInjectCompose checks injections compose in the order given, reach
+// what scan exporters and alert rules see, leave the tracked connections
+// alone, and end on their own.
+func TestInjectCompose(t *testing.T) {
+	src := &fakeSource{}
+	steam := fakeConn("steam", "192.0.2.1", 27015)
+	steam.Ping, steam.PingCount, steam.Loss = 30*time.Millisecond, 5, 2
+	src.set(steam, fakeConn("firefox", "192.0.2.2", 443), fakeConn("curl", "192.0.2.3", 443))
+	sink := &scanRecorder{}
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.SetScanSink(sink)
+	tr.scan()
+
+	for _, spec := range []string{
+		"ping-spike=app:steam,100ms,1m",
+		"ping-spike=all,+50ms,1m",
+		"loss=app:steam,+10%,1m",
+		"loss=app:curl,95%,1m",
+		"loss=app:curl,+10%,1m", // capped at 100
+		"conn-drop=app:firefox,1m",
+		"new-listener=app:backdoor,4444,1m",
+	} {
+		mustInject(t, tr, spec)
+	}
+	tr.scan()
+	got := byApp(sink.last())
+	if _, ok := got["firefox"]; ok || len(got) != 3 {
+		t.Fatalf("snapshot %v", got)
+	}
+	if c := got["steam"]; c.Ping != 150*time.Millisecond || c.Loss != 12 || !c.Injected {
+		t.Errorf("steam: ping %v, loss %v, injected %v", c.Ping, c.Loss, c.Injected)
+	}
+	if c := got["curl"]; c.Ping != 50*time.Millisecond || c.PingCount != 1 || c.Loss != 100 {
+		t.Errorf("curl: ping %v (%d), loss %v", c.Ping, c.PingCount, c.Loss)
+	}
+	if c := got["backdoor"]; c.State != StateListening || c.LocalPort != 4444 || !c.NewListener || !c.Injected {
+		t.Errorf("listener %+v", c)
+	}
+	if s := FilterConnections(tr.Snapshot(), "steam"); len(s) != 1 || s[0].Ping != 150*time.Millisecond {
+		t.Errorf("search sees %v", s)
+	}
+	if s := tr.Search("firefox"); len(s) != 0 {
+		t.Errorf("search found a dropped connection: %v", s)
+	}
+
+	// Alerts: the thresholds see the injected values, and the listener
+	// alert is raised once.
+	alerts := AlertRule{PingThreshold: 120 * time.Millisecond, LossThreshold: 50}.Evaluate(time.Now(), sink.last())
+	var alerted []string
+	for _, a := range alerts {
+		alerted = append(alerted, a.AppName)
+	}
+	if strings.Join(alerted, ",") != "steam,curl" && strings.Join(alerted, ",") != "curl,steam" {
+		t.Errorf("alerts for %v", alerted)
+	}
+	tr.scan()
+	if a := tr.NewListenerAlerts(); len(a) != 1 || a[0].Kind != AlertNewListener || !strings.Contains(a[0].Reason, "injected: new-listener=app:backdoor") {
+		t.Errorf("listener alerts %+v", a)
+	}
+
+	tr.mu.RLock()
+	for _, c := range tr.connections {
+		if c.Injected || c.AppName == "steam" && (c.Ping != 30*time.Millisecond || c.Loss != 2) {
+			t.Errorf("tracked connection changed: %+v", c)
+		}
+	}
+	tr.mu.RUnlock()
+
+	// All but the drop expire; the next scan forgets them.
+	tr.mu.Lock()
+	for _, inj := range tr.injections {
+		if inj.Kind != InjectDrop {
+			inj.Until = time.Now().Add(-time.Second)
+		}
+	}
+	tr.mu.Unlock()
+	if left := tr.Injections(); len(left) != 1 || left[0].Kind != InjectDrop {
+		t.Errorf("in effect: %+v", left)
+	}
+	tr.scan()
+	got = byApp(sink.last())
+	if c := got["steam"]; len(got) != 2 || c.Ping != 30*time.Millisecond || c.Loss != 2 || c.Injected {
+		t.Errorf("after expiry: %v, steam %+v", got, c)
+	}
+	tr.mu.RLock()
+	n := len(tr.injections)
+	tr.mu.RUnlock()
+	if n != 1 {
+		t.Errorf("%d injections kept", n)
+	}
+}
@@ -0,0 +1,305 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+	"unsafe"
+)
+
+// The iphlpapi owner-PID tables, declared as in iprtrmib.h and tcpmib.h /
+// udpmib.h. Every field is a DWORD or a byte array, so a row is 4-byte
+// aligned and the first one follows dwNumEntries directly, on 32- and
+// 64-bit builds alike; the offsets are still taken from these declarations
+// rather than assumed. They are decoded here, on any platform, so the
+// parsers can be fed captured buffers. DWORDs are little-endian, as on
+// every Windows target.
+
+// winPort is a dwLocalPort or dwRemotePort: the port in network byte order
+// in its first two bytes. Windows leaves the other two uninitialized.
+type winPort [4]byte
+
+func (p winPort) port() int {
+	return int(p[0])<<8 | int(p[1])
+}
+
+// MIB_TCPROW_OWNER_PID
+type tcpRowOwnerPID struct {
+	State      uint32
+	LocalAddr  [4]byte
+	LocalPort  winPort
+	RemoteAddr [4]byte
+	RemotePort winPort
+	OwningPid  uint32
+}
+
+// MIB_TCPTABLE_OWNER_PID
+type tcpTableOwnerPID struct {
+	NumEntries uint32
+	Table      [1]tcpRowOwnerPID
+}
+
+// MIB_TCPROW_OWNER_MODULE. liCreateTimestamp and OwningModuleInfo are a
+// LARGE_INTEGER and ULONGLONGs, 8-byte aligned on Windows; they are
+// declared as bytes, which 386 builds would align to 4 otherwise, and the
+// padding before the first row is spelled out in the table.
+type tcpRowOwnerModule struct {
+	State            uint32
+	LocalAddr        [4]byte
+	LocalPort        winPort
+	RemoteAddr       [4]byte
+	RemotePort       winPort
+	OwningPid        uint32
+	CreateTimestamp  [8]byte
+	OwningModuleInfo [16 * 8]byte
+}
+
+// MIB_TCPTABLE_OWNER_MODULE
+type tcpTableOwnerModule struct {
+	NumEntries uint32
+	_          [4]byte // aligns the rows to 8
+	Table      [1]tcpRowOwnerModule
+}
+
+// MIB_TCP6ROW_OWNER_PID
+type tcp6RowOwnerPID struct {
+	LocalAddr     [16]byte
+	LocalScopeId  uint32
+	LocalPort     winPort
+	RemoteAddr    [16]byte
+	RemoteScopeId uint32
+	RemotePort    winPort
+	State         uint32
+	OwningPid     uint32
+}
+
+// MIB_TCP6TABLE_OWNER_PID
+type tcp6TableOwnerPID struct {
+	NumEntries uint32
+	Table      [1]tcp6RowOwnerPID
+}
+
+// MIB_UDPROW_OWNER_PID
+type udpRowOwnerPID struct {
+	LocalAddr [4]byte
+	LocalPort winPort
+	OwningPid uint32
+}
+
+// MIB_UDPTABLE_OWNER_PID
+type udpTableOwnerPID struct {
+	NumEntries uint32
+	Table      [1]udpRowOwnerPID
+}
+
+// MIB_UDP6ROW_OWNER_PID
+type udp6RowOwnerPID struct {
+	LocalAddr    [16]byte
+	LocalScopeId uint32
+	LocalPort    winPort
+	OwningPid    uint32
+}
+
+// MIB_UDP6TABLE_OWNER_PID
+type udp6TableOwnerPID struct {
+	NumEntries uint32
+	Table      [1]udp6RowOwnerPID
+}
+
+// Windows TCP connection states
+var winTCPStates = map[uint32]ConnState{
+	1:  StateClosed,
+	2:  StateListening,
+	3:  StateSynSent,
+	4:  StateSynRecv,
+	5:  StateEstablished,
+	6:  StateFinWait1,
+	7:  StateFinWait2,
+	8:  StateCloseWait,
+	9:  StateClosing,
+	10: StateLastAck,
+	11: StateTimeWait,
+	12: StateClosed, // MIB_TCP_STATE_DELETE_TCB
+}
+
+// connEntry is a unified entry before converting to Connection
+type connEntry struct {
+	protocol   string
+	localAddr  string
+	localPort  int
+	remoteAddr string
+	remotePort int
+	state      ConnState
+	pid        int
+}
+
+// rejectedRows counts table rows dropped as impossible since start.
+var rejectedRows atomic.Uint64
+
+// RejectedRows is how many socket table rows were dropped since start for
+// an impossible state, PID or port, or for lying past the end of the
+// buffer; always 0 where the scanner reads no such tables.
+func RejectedRows() uint64 {
+	return rejectedRows.Load()
+}
+
+// tableRows returns the rows of an owner-PID table in buf: dwNumEntries,
+// then the rows from offset first. Rows the buffer cannot hold are
+// rejected.
+func tableRows[R any](buf []byte, first uintptr) ([]R, error) {
+	if uintptr(len(buf)) < first {
+		return nil, fmt.Errorf("table of %d bytes has no room for its header", len(buf))
+	}
+	n := uintptr(*(*uint32)(unsafe.Pointer(&buf[0])))
+	size := unsafe.Sizeof(*new(R))
+	if fit := (uintptr(len(buf)) - first) / size; n > fit {
+		rejectedRows.Add(uint64(n - fit))
+		n = fit
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return unsafe.Slice((*R)(unsafe.Pointer(&buf[first])), n), nil
+}
+
+// errBadRow marks a row whose fields cannot be right.
+var errBadRow = errors.New("impossible row")
+
+// winPID checks an OwningPid. Windows numbers processes in multiples of 4,
+// from 0 (the idle process) and 4 (System).
+func winPID(pid uint32) (int, error) {
+	if pid%4 != 0 {
+		return 0, errBadRow
+	}
+	return int(pid), nil
+}
+
+// tcpEntry checks and converts the fields of a TCP row. A listener's remote
+// endpoint is not valid and is reported as none.
+func tcpEntry(protocol string, state uint32, local, remote net.IP, lport, rport winPort, pid uint32, none string) (connEntry, error) {
+	st, ok := winTCPStates[state]
+	if !ok {
+		return connEntry{}, errBadRow
+	}
+	p, err := winPID(pid)
+	if err != nil {
+		return connEntry{}, err
+	}
+	e := connEntry{protocol: protocol, localAddr: local.String(), localPort: lport.port(), state: st, pid: p}
+	if st == StateListening {
+		e.remoteAddr = none
+		return e, nil
+	}
+	e.remoteAddr, e.remotePort = remote.String(), rport.port()
+	if (e.localPort == 0 && st != StateClosed) || (st == StateEstablished && e.remotePort == 0) {
+		return connEntry{}, errBadRow
+	}
+	return e, nil
+}
+
+// parseTCPTable decodes a MIB_TCPTABLE_OWNER_PID.
+func parseTCPTable(buf []byte) ([]connEntry, error) {
+	rows, err := tableRows[tcpRowOwnerPID](buf, unsafe.Offsetof(tcpTableOwnerPID{}.Table))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]connEntry, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		e, err := tcpEntry("tcp", r.State, r.LocalAddr[:], r.RemoteAddr[:], r.LocalPort, r.RemotePort, r.OwningPid, "0.0.0.0")
+		if err != nil {
+			rejectedRows.Add(1)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseTCPModuleTable returns the rows of a MIB_TCPTABLE_OWNER_MODULE
+// with a possible owner, as they are: only their owner is looked up.
+func parseTCPModuleTable(buf []byte) ([]tcpRowOwnerModule, error) {
+	rows, err := tableRows[tcpRowOwnerModule](buf, unsafe.Offsetof(tcpTableOwnerModule{}.Table))
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(rows), func(r tcpRowOwnerModule) bool {
+		_, err := winPID(r.OwningPid)
+		return err != nil || r.OwningPid == 0
+	}), nil
+}
+
+// parseTCP6Table decodes a MIB_TCP6TABLE_OWNER_PID.
+func parseTCP6Table(buf []byte) ([]connEntry, error) {
+	rows, err := tableRows[tcp6RowOwnerPID](buf, unsafe.Offsetof(tcp6TableOwnerPID{}.Table))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]connEntry, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		e, err := tcpEntry("tcp6", r.State, r.LocalAddr[:], r.RemoteAddr[:], r.LocalPort, r.RemotePort, r.OwningPid, "::")
+		if err != nil {
+			rejectedRows.Add(1)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseUDPTable decodes a MIB_UDPTABLE_OWNER_PID. The owner-PID table has
+// no remote endpoint, so every row is reported as unconnected.
+func parseUDPTable(buf []byte) ([]connEntry, error) {
+	rows, err := tableRows[udpRowOwnerPID](buf, unsafe.Offsetof(udpTableOwnerPID{}.Table))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]connEntry, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		pid, err := winPID(r.OwningPid)
+		if err != nil {
+			rejectedRows.Add(1)
+			continue
+		}
+		entries = append(entries, connEntry{
+			protocol:   "udp",
+			localAddr:  net.IP(r.LocalAddr[:]).String(),
+			localPort:  r.LocalPort.port(),
+			remoteAddr: "0.0.0.0",
+			state:      StateUnconnected,
+			pid:        pid,
+		})
+	}
+	return entries, nil
+}
+
+// parseUDP6Table decodes a MIB_UDP6TABLE_OWNER_PID, unconnected like
+// parseUDPTable's rows.
+func parseUDP6Table(buf []byte) ([]connEntry, error) {
+	rows, err := tableRows[udp6RowOwnerPID](buf, unsafe.Offsetof(udp6TableOwnerPID{}.Table))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]connEntry, 0, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		pid, err := winPID(r.OwningPid)
+		if err != nil {
+			rejectedRows.Add(1)
+			continue
+		}
+		entries = append(entries, connEntry{
+			protocol:   "udp6",
+			localAddr:  net.IP(r.LocalAddr[:]).String(),
+			localPort:  r.LocalPort.port(),
+			remoteAddr: "::",
+			state:      StateUnconnected,
+			pid:        pid,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+	"unsafe"
+)
+
+// TestIphlpapiLayout pins the declared tables to the sizes and offsets of
+// the Windows headers, which are the same on 32- and 64-bit builds.
+func TestIphlpapiLayout(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"MIB_TCPROW_OWNER_PID", unsafe.Sizeof(tcpRowOwnerPID{}), 24},
+		{"MIB_TCP6ROW_OWNER_PID", unsafe.Sizeof(tcp6RowOwnerPID{}), 56},
+		{"MIB_UDPROW_OWNER_PID", unsafe.Sizeof(udpRowOwnerPID{}), 12},
+		{"MIB_UDP6ROW_OWNER_PID", unsafe.Sizeof(udp6RowOwnerPID{}), 28},
+		{"MIB_TCPROW_OWNER_MODULE", unsafe.Sizeof(tcpRowOwnerModule{}), 160},
+		{"MIB_TCPTABLE_OWNER_PID.table", unsafe.Offsetof(tcpTableOwnerPID{}.Table), 4},
+		{"MIB_TCP6TABLE_OWNER_PID.table", unsafe.Offsetof(tcp6TableOwnerPID{}.Table), 4},
+		{"MIB_UDPTABLE_OWNER_PID.table", unsafe.Offsetof(udpTableOwnerPID{}.Table), 4},
+		{"MIB_UDP6TABLE_OWNER_PID.table", unsafe.Offsetof(udp6TableOwnerPID{}.Table), 4},
+		{"MIB_TCPTABLE_OWNER_MODULE.table", unsafe.Offsetof(tcpTableOwnerModule{}.Table), 8},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: %d bytes, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestParseIphlpapiTables feeds table buffers laid out as a 32-bit and a
+// 64-bit build get them, with the uninitialized high bytes of the ports
+// and the slack after the last row left in, through the parsers.
+func TestParseIphlpapiTables(t *testing.T) {
+	if !littleEndian() {
+		t.Skip("the tables hold little-endian DWORDs, read in place")
+	}
+	tests := []struct {
+		file     string
+		parse    func([]byte) ([]connEntry, error)
+		want     []connEntry
+		rejected uint64
+	}{
+		{"iphlpapi/tcp4_amd64.bin", parseTCPTable, []connEntry{
+			{"tcp", "0.0.0.0", 135, "0.0.0.0", 0, StateListening, 1036},
+			{"tcp", "0.0.0.0", 445, "0.0.0.0", 0, StateListening, 4},
+			{"tcp", "192.168.1.20", 50123, "140.82.112.4", 443, StateEstablished, 7340},
+			{"tcp", "192.168.1.20", 50100, "142.250.185.78", 443, StateTimeWait, 0},
+			{"tcp", "127.0.0.1", 49670, "127.0.0.1", 49669, StateCloseWait, 5512},
+		}, 3},
+		{"iphlpapi/tcp4_386.bin", parseTCPTable, []connEntry{
+			{"tcp", "127.0.0.1", 5939, "0.0.0.0", 0, StateListening, 2716},
+			{"tcp", "10.0.2.15", 49682, "20.42.65.92", 443, StateEstablished, 3388},
+			{"tcp", "10.0.2.15", 49690, "93.184.216.34", 80, StateSynSent, 3388},
+			{"tcp", "10.0.2.15", 49691, "93.184.216.34", 80, StateClosed, 0},
+		}, 1},
+		{"iphlpapi/tcp6_amd64.bin", parseTCP6Table, []connEntry{
+			{"tcp6", "::", 135, "::", 0, StateListening, 1036},
+			{"tcp6", "2a02:8070:d80:aa00::5", 50210, "2a00:1450:4001:82a::200e", 443, StateEstablished, 7340},
+			{"tcp6", "fe80::1c2d:3e4f:5a6b:7c8d", 50211, "fe80::1", 8080, StateEstablished, 7340},
+		}, 1},
+		{"iphlpapi/udp4_amd64.bin", parseUDPTable, []connEntry{
+			{"udp", "0.0.0.0", 5353, "0.0.0.0", 0, StateUnconnected, 2240},
+			{"udp", "127.0.0.1", 1900, "0.0.0.0", 0, StateUnconnected, 4412},
+			{"udp", "192.168.1.20", 137, "0.0.0.0", 0, StateUnconnected, 4},
+		}, 1},
+		{"iphlpapi/udp4_386.bin", parseUDPTable, []connEntry{
+			{"udp", "0.0.0.0", 500, "0.0.0.0", 0, StateUnconnected, 3012},
+			{"udp", "0.0.0.0", 4500, "0.0.0.0", 0, StateUnconnected, 3012},
+		}, 0},
+		{"iphlpapi/udp6_amd64.bin", parseUDP6Table, []connEntry{
+			{"udp6", "::", 5353, "::", 0, StateUnconnected, 2240},
+			{"udp6", "fe80::1c2d:3e4f:5a6b:7c8d", 546, "::", 0, StateUnconnected, 1488},
+		}, 0},
+	}
+	for _, tt := range tests {
+		before := RejectedRows()
+		got, err := tt.parse(readPacket(t, tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s:\n got %v\nwant %v", tt.file, got, tt.want)
+		}
+		if n := RejectedRows() - before; n != tt.rejected {
+			t.Errorf("%s: %d rows rejected, want %d", tt.file, n, tt.rejected)
+		}
+	}
+}
+
+func TestParseTCPModuleTable(t *testing.T) {
+	if !littleEndian() {
+		t.Skip("the tables hold little-endian DWORDs, read in place")
+	}
+	rows, err := parseTCPModuleTable(readPacket(t, "iphlpapi/tcpmodule_amd64.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, r := range rows {
+		got = append(got, int(r.OwningPid), r.LocalPort.port())
+	}
+	if want := []int{7340, 50123, 4, 445}; !slices.Equal(got, want) {
+		t.Errorf("pid, port of the rows kept: %v, want %v", got, want)
+	}
+}
+
+// TestParseIphlpapiTruncated checks a table claiming more rows than its
+// buffer holds yields the ones there, counting the rest as rejected, and
+// a buffer too short for the header is an error.
+func TestParseIphlpapiTruncated(t *testing.T) {
+	if !littleEndian() {
+		t.Skip("the tables hold little-endian DWORDs, read in place")
+	}
+	buf := readPacket(t, "iphlpapi/udp4_386.bin")
+	before := RejectedRows()
+	got, err := parseUDPTable(buf[:len(buf)-1])
+	if err != nil || len(got) != 1 || got[0].localPort != 500 {
+		t.Errorf("truncated table: %v, %v", got, err)
+	}
+	if n := RejectedRows() - before; n != 1 {
+		t.Errorf("%d rows rejected, want 1", n)
+	}
+
+	empty := binary.LittleEndian.AppendUint32(nil, 0)
+	if got, err := parseTCPTable(empty); err != nil || len(got) != 0 {
+		t.Errorf("empty table: %v, %v", got, err)
+	}
+	if _, err := parseTCP6Table(empty[:2]); err == nil {
+		t.Error("a 2-byte table parsed")
+	}
+	if _, err := parseTCPModuleTable(empty); err == nil {
+		t.Error("a module table without its padding parsed")
+	}
+}
+
+func littleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
@@ -0,0 +1,176 @@
+package tracker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// newRemoteBadge is how long a never-before-seen remote is flagged as new.
+	newRemoteBadge = 5 * time.Minute
+
+	// maxAppsPerHost bounds the app list stored for each remote.
+	maxAppsPerHost = 16
+
+	// DefaultKnownHosts is the default size limit of the database.
+	DefaultKnownHosts = 50000
+)
+
+// HostRecord is the persisted history of one remote address.
+type HostRecord struct {
+	Addr      string    `json:"addr"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Sessions  int       `json:"sessions"`
+	Apps      []string  `json:"apps,omitempty"`
+}
+
+// KnownHosts is a persistent database of every remote address observed.
+// It is kept in memory and written atomically to a JSON file.
+type KnownHosts struct {
+	mu         sync.Mutex
+	path       string
+	maxEntries int
+	hosts      map[string]*HostRecord
+	session    map[string]bool // hosts already counted in this run
+	dirty      bool
+}
+
+// OpenKnownHosts loads the database at path, keeping at most maxEntries hosts.
+// A missing file starts an empty database; a corrupt one is reported but
+// still returns a usable empty database.
+func OpenKnownHosts(path string, maxEntries int) (*KnownHosts, error) {
+	k := &KnownHosts{
+		path:       path,
+		maxEntries: maxEntries,
+		hosts:      make(map[string]*HostRecord),
+		session:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return k, err
+	}
+
+	var records []*HostRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return k, err
+	}
+	for _, r := range records {
+		k.hosts[r.Addr] = r
+	}
+	return k, nil
+}
+
+// Observe records that app talked to addr and returns when addr was first
+// seen across all sessions.
+func (k *KnownHosts) Observe(addr, app string, now time.Time) time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	r, ok := k.hosts[addr]
+	if !ok {
+		r = &HostRecord{Addr: addr, FirstSeen: now}
+		k.hosts[addr] = r
+	}
+	r.LastSeen = now
+	if !k.session[addr] {
+		k.session[addr] = true
+		r.Sessions++
+	}
+	if !containsString(r.Apps, app) && len(r.Apps) < maxAppsPerHost {
+		r.Apps = append(r.Apps, app)
+	}
+	k.dirty = true
+	return r.FirstSeen
+}
+
+// Len returns the number of hosts in the database and how many were seen in
+// this run. Between saves the database may briefly exceed its limit.
+func (k *KnownHosts) Len() (hosts, session int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.hosts), len(k.session)
+}
+
+// Lookup returns a copy of the record for addr.
+func (k *KnownHosts) Lookup(addr string) (HostRecord, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	r, ok := k.hosts[addr]
+	if !ok {
+		return HostRecord{}, false
+	}
+	cp := *r
+	cp.Apps = append([]string(nil), r.Apps...)
+	return cp, true
+}
+
+// Save evicts the least recently seen hosts beyond the size limit and writes
+// the database to a temporary file that is then renamed over the old one, so
+// a crash mid-write never leaves a truncated file.
+func (k *KnownHosts) Save() error {
+	k.mu.Lock()
+	if !k.dirty {
+		k.mu.Unlock()
+		return nil
+	}
+	records := make([]*HostRecord, 0, len(k.hosts))
+	for _, r := range k.hosts {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].LastSeen.After(records[j].LastSeen) })
+	if k.maxEntries > 0 && len(records) > k.maxEntries {
+		for _, r := range records[k.maxEntries:] {
+			delete(k.hosts, r.Addr)
+			delete(k.session, r.Addr)
+		}
+		records = records[:k.maxEntries]
+	}
+	data, err := json.Marshal(records)
+	k.dirty = false
+	k.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o755); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// IsNewRemote reports whether the remote was first seen (across all sessions)
+// within the last few minutes.
+func (c *Connection) IsNewRemote(now time.Time) bool {
+	return !c.RemoteFirstSeenEver.IsZero() && now.Sub(c.RemoteFirstSeenEver) < newRemoteBadge
+}
+
+// isTrackableRemote reports whether addr is a real peer worth remembering.
+func isTrackableRemote(addr string) bool {
+	switch addr {
+	case "", "0.0.0.0", "::", "127.0.0.1", "::1":
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
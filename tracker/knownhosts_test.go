@@ -0,0 +1,216 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKnownHostsPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts.json")
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	k, err := OpenKnownHosts(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Observe("192.0.2.1", "curl", t0)
+	k.Observe("192.0.2.1", "curl", t0.Add(time.Minute)) // same session
+	k.Observe("192.0.2.1", "firefox", t0.Add(2*time.Minute))
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run counts a new session but keeps the first-seen time.
+	k, err = OpenKnownHosts(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := k.Observe("192.0.2.1", "curl", t0.Add(time.Hour)); !first.Equal(t0) {
+		t.Fatalf("first seen %v after reopening, want %v", first, t0)
+	}
+	r, ok := k.Lookup("192.0.2.1")
+	if !ok {
+		t.Fatal("host lost on reload")
+	}
+	if r.Sessions != 2 || len(r.Apps) != 2 || !r.LastSeen.Equal(t0.Add(time.Hour)) {
+		t.Fatalf("record %+v", r)
+	}
+}
+
+func TestKnownHostsEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts.json")
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	k, _ := OpenKnownHosts(path, 2)
+	k.Observe("192.0.2.1", "a", t0.Add(3*time.Minute))
+	k.Observe("192.0.2.2", "a", t0) // least recently seen
+	k.Observe("192.0.2.3", "a", t0.Add(time.Minute))
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ := k.Len(); hosts != 2 {
+		t.Fatalf("%d hosts after save, want 2", hosts)
+	}
+	k, _ = OpenKnownHosts(path, 2)
+	if _, ok := k.Lookup("192.0.2.2"); ok {
+		t.Fatal("the oldest host survived eviction")
+	}
+	for _, addr := range []string{"192.0.2.1", "192.0.2.3"} {
+		if _, ok := k.Lookup(addr); !ok {
+			t.Fatalf("%s evicted", addr)
+		}
+	}
+}
+
+func TestKnownHostsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts.json")
+	if err := os.WriteFile(path, []byte(`[{"addr":"192.0.2.1",`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k, err := OpenKnownHosts(path, 0)
+	if err == nil {
+		t.Fatal("no error for a truncated file")
+	}
+	k.Observe("192.0.2.9", "a", time.Now())
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenKnownHosts(path, 0); err != nil {
+		t.Fatalf("saved file does not load: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("temporary file left behind")
+	}
+}
+
+func TestKnownHostsConcurrentObserve(t *testing.T) {
+	k, _ := OpenKnownHosts(filepath.Join(t.TempDir(), "known_hosts.json"), 0)
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				k.Observe(fmt.Sprintf("192.0.2.%d", i), fmt.Sprintf("app%d", w), time.Now())
+				if i%10 == 0 {
+					k.Save()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if hosts, session := k.Len(); hosts != 50 || session != 50 {
+		t.Fatalf("hosts %d, session %d, want 50", hosts, session)
+	}
+	if r, _ := k.Lookup("192.0.2.7"); r.Sessions != 1 || len(r.Apps) != 8 {
+		t.Fatalf("record %+v", r)
+	}
+}
+
+func TestNewRemoteBadge(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &Connection{RemoteFirstSeenEver: t0}
+	if !c.IsNewRemote(t0.Add(time.Minute)) {
+		t.Fatal("not new a minute after first sight")
+	}
+	if c.IsNewRemote(t0.Add(newRemoteBadge)) {
+		t.Fatal("still new after the badge period")
+	}
+	if (&Connection{}).IsNewRemote(t0) {
+		t.Fatal("a connection without history is new")
+	}
+
+	fresh := &Connection{AppName: "a", RemoteFirstSeenEver: time.Now()}
+	old := &Connection{AppName: "b", RemoteFirstSeenEver: time.Now().Add(-time.Hour)}
+	conns := []*Connection{fresh, old}
+	if got := FilterConnections(conns, "new:yes"); len(got) != 1 || got[0] != fresh {
+		t.Fatalf("new:yes matched %v", got)
+	}
+	if got := FilterConnections(conns, "new:no"); len(got) != 1 || got[0] != old {
+		t.Fatalf("new:no matched %v", got)
+	}
+}
+
+// fakeSource serves a fixed socket table. Each scan returns fresh copies,
+// like the OS tables do.
+type fakeSource struct {
+	mu    sync.Mutex
+	conns []Connection
+	rtt   time.Duration
+}
+
+func (f *fakeSource) set(conns ...Connection) {
+	f.mu.Lock()
+	f.conns = conns
+	f.mu.Unlock()
+}
+
+func (f *fakeSource) Scan() ([]*Connection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]*Connection, len(f.conns))
+	for i := range f.conns {
+		c := f.conns[i]
+		out[i] = &c
+	}
+	return out, nil
+}
+
+func (f *fakeSource) Ping(addr string, port int) (time.Duration, float64) {
+	return f.rtt, 0
+}
+
+func fakeConn(app, remote string, port int) Connection {
+	return Connection{
+		AppName: app, PID: 100, Protocol: "tcp", State: StateEstablished, Direction: Outbound,
+		LocalAddr: "10.0.0.2", LocalPort: 40000 + port, RemoteAddr: remote, RemotePort: port,
+	}
+}
+
+func TestScanAnnotatesFirstSeen(t *testing.T) {
+	k, _ := OpenKnownHosts(filepath.Join(t.TempDir(), "known_hosts.json"), 0)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	k.Observe("192.0.2.1", "old", t0.Add(-24*time.Hour))
+
+	src := &fakeSource{}
+	src.set(fakeConn("web", "192.0.2.1", 443), fakeConn("web", "192.0.2.2", 80), fakeConn("dev", "127.0.0.1", 8080))
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetKnownHosts(k)
+	now := t0
+	tr.SetClock(func() time.Time { return now })
+	tr.scan()
+
+	want := map[string]time.Time{
+		"192.0.2.1": t0.Add(-24 * time.Hour),
+		"192.0.2.2": t0,
+		"127.0.0.1": {},
+	}
+	snap := tr.Snapshot()
+	if len(snap) != len(want) {
+		t.Fatalf("%d connections, want %d", len(snap), len(want))
+	}
+	for _, c := range snap {
+		if !c.RemoteFirstSeenEver.Equal(want[c.RemoteAddr]) {
+			t.Errorf("%s: first seen %v, want %v", c.RemoteAddr, c.RemoteFirstSeenEver, want[c.RemoteAddr])
+		}
+		if got := c.IsNewRemote(now); got != (c.RemoteAddr == "192.0.2.2") {
+			t.Errorf("%s: new %v", c.RemoteAddr, got)
+		}
+	}
+	if _, ok := k.Lookup("127.0.0.1"); ok {
+		t.Error("loopback recorded")
+	}
+
+	// The badge wears off while the connection stays open.
+	now = t0.Add(newRemoteBadge + time.Second)
+	tr.scan()
+	for _, c := range tr.Snapshot() {
+		if c.IsNewRemote(now) {
+			t.Errorf("%s still new after %v", c.RemoteAddr, newRemoteBadge)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"sort"
+	"time"
+)
+
+// PingCorrection says how a displayed ping was adjusted for the TCP connect
+// probe's handshake overhead.
+type PingCorrection string
+
+const (
+	CorrectionNone     PingCorrection = ""
+	CorrectionHost     PingCorrection = "host"     // offset measured for this remote host
+	CorrectionGlobal   PingCorrection = "global"   // session-wide default offset
+	CorrectionExternal PingCorrection = "external" // reported by another program (see IngestRTT)
+)
+
+// Marker is the subtle suffix shown next to a corrected ping.
+func (p PingCorrection) Marker() string {
+	switch p {
+	case CorrectionHost:
+		return "*"
+	case CorrectionGlobal:
+		return "~"
+	case CorrectionExternal:
+		return "@"
+	}
+	return ""
+}
+
+// offsetSmoothing weights a new offset sample against the running value.
+const offsetSmoothing = 0.3
+
+// EstimateOffset returns the probe's bias given a TCP connect RTT and the
+// kernel's smoothed RTT for the same host. A probe faster than the kernel
+// value yields a zero offset rather than a negative one.
+func EstimateOffset(probe, kernel time.Duration) (time.Duration, bool) {
+	if probe <= 0 || kernel <= 0 {
+		return 0, false
+	}
+	if probe < kernel {
+		return 0, true
+	}
+	return probe - kernel, true
+}
+
+// ApplyOffset subtracts an offset from a probe RTT. The result never drops
+// below half the raw value, so a bad offset cannot hide a slow host.
+func ApplyOffset(probe, offset time.Duration) time.Duration {
+	if probe <= 0 || offset <= 0 {
+		return probe
+	}
+	corrected := probe - offset
+	if corrected < probe/2 {
+		corrected = probe / 2
+	}
+	return corrected
+}
+
+const (
+	// DefaultCalibrationHosts caps the hosts with a learned offset.
+	DefaultCalibrationHosts = 4096
+	// calibrationTTL drops offsets of hosts not probed for this long.
+	calibrationTTL = time.Hour
+)
+
+// hostOffset is one host's smoothed offset and when it was last updated.
+type hostOffset struct {
+	offset time.Duration
+	seen   time.Time
+}
+
+// LatencyCalibration learns per-host probe offsets during a session. At most
+// maxHosts offsets are kept; Prune drops stale ones and the least recently
+// updated beyond the cap. It is not safe for concurrent use; the tracker
+// guards it with its lock.
+type LatencyCalibration struct {
+	offsets  map[string]hostOffset // remote address -> smoothed offset
+	maxHosts int
+}
+
+// NewLatencyCalibration returns an empty calibration.
+func NewLatencyCalibration() *LatencyCalibration {
+	return &LatencyCalibration{offsets: make(map[string]hostOffset), maxHosts: DefaultCalibrationHosts}
+}
+
+// Observe records one probe/kernel pair for a host.
+func (l *LatencyCalibration) Observe(host string, probe, kernel time.Duration) {
+	off, ok := EstimateOffset(probe, kernel)
+	if !ok {
+		return
+	}
+	if prev, seen := l.offsets[host]; seen {
+		off = prev.offset + time.Duration(offsetSmoothing*float64(off-prev.offset))
+	}
+	l.offsets[host] = hostOffset{offset: off, seen: time.Now()}
+}
+
+// Prune drops offsets not updated within calibrationTTL, then the least
+// recently updated ones beyond the cap.
+func (l *LatencyCalibration) Prune(now time.Time) {
+	for host, o := range l.offsets {
+		if now.Sub(o.seen) > calibrationTTL {
+			delete(l.offsets, host)
+		}
+	}
+	if l.maxHosts <= 0 || len(l.offsets) <= l.maxHosts {
+		return
+	}
+	hosts := make([]string, 0, len(l.offsets))
+	for h := range l.offsets {
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return l.offsets[hosts[i]].seen.Before(l.offsets[hosts[j]].seen) })
+	for _, h := range hosts[:len(hosts)-l.maxHosts] {
+		delete(l.offsets, h)
+	}
+}
+
+// Len is the number of hosts with a learned offset.
+func (l *LatencyCalibration) Len() int {
+	return len(l.offsets)
+}
+
+// GlobalOffset is the median of the per-host offsets, or zero if none have
+// been measured yet.
+func (l *LatencyCalibration) GlobalOffset() time.Duration {
+	if len(l.offsets) == 0 {
+		return 0
+	}
+	vals := make([]time.Duration, 0, len(l.offsets))
+	for _, v := range l.offsets {
+		vals = append(vals, v.offset)
+	}
+	sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+	return vals[len(vals)/2]
+}
+
+// Correct returns the estimate for a probe to host and which offset was used.
+func (l *LatencyCalibration) Correct(host string, probe time.Duration) (time.Duration, PingCorrection) {
+	if probe <= 0 {
+		return probe, CorrectionNone
+	}
+	if o, ok := l.offsets[host]; ok {
+		return ApplyOffset(probe, o.offset), CorrectionHost
+	}
+	if off := l.GlobalOffset(); off > 0 {
+		return ApplyOffset(probe, off), CorrectionGlobal
+	}
+	return probe, CorrectionNone
+}
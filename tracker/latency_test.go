@@ -0,0 +1,108 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+const ms = time.Millisecond
+
+func TestEstimateOffset(t *testing.T) {
+	tests := []struct {
+		probe, kernel, want time.Duration
+		ok                  bool
+	}{
+		{50 * ms, 40 * ms, 10 * ms, true},
+		{30 * ms, 40 * ms, 0, true}, // probe faster than the kernel's estimate
+		{0, 40 * ms, 0, false},
+		{50 * ms, 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := EstimateOffset(tt.probe, tt.kernel)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("EstimateOffset(%v, %v) = %v, %v", tt.probe, tt.kernel, got, ok)
+		}
+	}
+}
+
+func TestApplyOffset(t *testing.T) {
+	tests := []struct{ probe, offset, want time.Duration }{
+		{50 * ms, 10 * ms, 40 * ms},
+		{50 * ms, 40 * ms, 25 * ms}, // floored at half the raw value
+		{50 * ms, 0, 50 * ms},
+		{0, 10 * ms, 0},
+	}
+	for _, tt := range tests {
+		if got := ApplyOffset(tt.probe, tt.offset); got != tt.want {
+			t.Errorf("ApplyOffset(%v, %v) = %v, want %v", tt.probe, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyCalibration(t *testing.T) {
+	l := NewLatencyCalibration()
+	if got, corr := l.Correct("192.0.2.1", 50*ms); got != 50*ms || corr != CorrectionNone {
+		t.Fatalf("uncalibrated: %v %q", got, corr)
+	}
+
+	l.Observe("192.0.2.1", 50*ms, 40*ms) // offset 10ms
+	l.Observe("192.0.2.1", 60*ms, 40*ms) // 20ms, smoothed to 13ms
+	if o := l.offsets["192.0.2.1"].offset; o != 13*ms {
+		t.Fatalf("smoothed offset %v, want 13ms", o)
+	}
+	if got, corr := l.Correct("192.0.2.1", 50*ms); got != 37*ms || corr != CorrectionHost || corr.Marker() != "*" {
+		t.Fatalf("host correction: %v %q", got, corr)
+	}
+
+	l.Observe("192.0.2.2", 45*ms, 40*ms) // 5ms
+	l.Observe("192.0.2.3", 70*ms, 40*ms) // 30ms
+	if g := l.GlobalOffset(); g != 13*ms {
+		t.Fatalf("global offset %v, want the median 13ms", g)
+	}
+	if got, corr := l.Correct("198.51.100.1", 100*ms); got != 87*ms || corr != CorrectionGlobal || corr.Marker() != "~" {
+		t.Fatalf("global correction: %v %q", got, corr)
+	}
+	l.Observe("198.51.100.1", 0, 40*ms) // nothing to learn
+	if l.Len() != 3 {
+		t.Fatalf("%d hosts", l.Len())
+	}
+}
+
+func TestLatencyCalibrationPrune(t *testing.T) {
+	l := NewLatencyCalibration()
+	l.maxHosts = 2
+	now := time.Now()
+	l.offsets["stale"] = hostOffset{offset: ms, seen: now.Add(-2 * calibrationTTL)}
+	l.offsets["old"] = hostOffset{offset: ms, seen: now.Add(-3 * time.Minute)}
+	l.offsets["mid"] = hostOffset{offset: ms, seen: now.Add(-2 * time.Minute)}
+	l.offsets["new"] = hostOffset{offset: ms, seen: now.Add(-time.Minute)}
+	l.Prune(now)
+	if l.Len() != 2 {
+		t.Fatalf("%d hosts after pruning, want 2", l.Len())
+	}
+	for _, h := range []string{"mid", "new"} {
+		if _, ok := l.offsets[h]; !ok {
+			t.Errorf("%s pruned", h)
+		}
+	}
+}
+
+func TestRecordProbeCorrection(t *testing.T) {
+	for _, on := range []bool{true, false} {
+		tr := NewTracker(time.Second, true)
+		tr.SetSampleFilter(SampleFilter{})
+		tr.SetPingCorrection(on)
+		c := &Connection{RemoteAddr: "192.0.2.1", RemotePort: 443, KernelRTT: 40 * ms}
+		tr.mu.Lock()
+		tr.recordProbe(c, 50*ms, 0, nil, time.Now())
+		tr.mu.Unlock()
+
+		want, corr := 40*ms, CorrectionHost
+		if !on {
+			want, corr = 50*ms, CorrectionNone
+		}
+		if c.Ping != want || c.RawPing != 50*ms || c.PingCorrection != corr {
+			t.Errorf("correction %v: ping %v (raw %v, %q)", on, c.Ping, c.RawPing, c.PingCorrection)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tracker
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// ParseLeases reads the hostnames of a DHCP server's leases file, by
+// address. It understands dnsmasq's format, one lease per line:
+//
+//	1718200000 aa:bb:cc:dd:ee:ff 192.168.1.20 laptop 01:aa:bb:cc:dd:ee:ff
+//
+// and ISC dhcpd's dhcpd.leases blocks:
+//
+//	lease 192.168.1.20 { ... client-hostname "laptop"; }
+//
+// Leases without a hostname ("*" in dnsmasq) are skipped; for an address
+// leased more than once, the last entry wins, as both servers append.
+func ParseLeases(r io.Reader) (map[netip.Addr]string, error) {
+	names := make(map[netip.Addr]string)
+	sc := bufio.NewScanner(r)
+	var block netip.Addr // address of the dhcpd lease block being read
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(line, "#"):
+		case fields[0] == "lease" && len(fields) >= 2:
+			block, _ = netip.ParseAddr(fields[1])
+		case fields[0] == "}":
+			block = netip.Addr{}
+		case fields[0] == "client-hostname" && block.IsValid() && len(fields) >= 2:
+			name := strings.Trim(strings.TrimSuffix(strings.Join(fields[1:], " "), ";"), `"`)
+			if name != "" {
+				names[block.Unmap()] = name
+			}
+		case len(fields) >= 4 && !block.IsValid():
+			a, err := netip.ParseAddr(fields[2])
+			if err != nil || fields[3] == "*" {
+				continue
+			}
+			names[a.Unmap()] = fields[3]
+		}
+	}
+	return names, sc.Err()
+}
+
+// leasesRecheck is how often a leases file's modification time is checked.
+const leasesRecheck = 10 * time.Second
+
+// leasesFile is a leases file read again whenever it changes.
+type leasesFile struct {
+	path    string
+	names   map[netip.Addr]string
+	modTime time.Time
+	checked time.Time
+}
+
+// lookup returns the hostname leased to a, or "". A file that cannot be
+// read keeps the names read last.
+func (l *leasesFile) lookup(a netip.Addr, now time.Time) string {
+	if l == nil {
+		return ""
+	}
+	if now.Sub(l.checked) >= leasesRecheck {
+		l.checked = now
+		if fi, err := os.Stat(l.path); err == nil && !fi.ModTime().Equal(l.modTime) {
+			if f, err := os.Open(l.path); err == nil {
+				if names, err := ParseLeases(f); err == nil {
+					l.names, l.modTime = names, fi.ModTime()
+				}
+				f.Close()
+			}
+		}
+	}
+	return l.names[a.Unmap()]
+}
@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLeases(t *testing.T) {
+	dnsmasq := `1718200000 aa:bb:cc:dd:ee:01 192.168.1.20 laptop 01:aa:bb:cc:dd:ee:01
+1718200100 aa:bb:cc:dd:ee:02 192.168.1.21 * 01:aa:bb:cc:dd:ee:02
+1718200200 aa:bb:cc:dd:ee:03 2001:db8::30 printer *
+1718200300 aa:bb:cc:dd:ee:04 192.168.1.20 laptop-renamed *
+garbage
+`
+	dhcpd := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.40 {
+  starts 4 2026/03/05 10:00:00;
+  hardware ethernet aa:bb:cc:dd:ee:05;
+  client-hostname "phone";
+}
+lease 192.168.1.41 {
+  hardware ethernet aa:bb:cc:dd:ee:06;
+}
+lease 192.168.1.40 {
+  client-hostname "phone 2";
+}
+`
+	tests := []struct {
+		name string
+		file string
+		want map[string]string
+	}{
+		{"dnsmasq", dnsmasq, map[string]string{"192.168.1.20": "laptop-renamed", "2001:db8::30": "printer"}},
+		{"dhcpd", dhcpd, map[string]string{"192.168.1.40": "phone 2"}},
+		{"empty", "", map[string]string{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLeases(strings.NewReader(tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %v", tt.name, got)
+		}
+		for a, name := range tt.want {
+			if got[netip.MustParseAddr(a)] != name {
+				t.Errorf("%s: %s is %q, want %q", tt.name, a, got[netip.MustParseAddr(a)], name)
+			}
+		}
+	}
+}
+
+func TestLeasesFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	write := func(content string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	write("1 aa 192.168.1.20 laptop *\n", t0)
+	l := &leasesFile{path: path}
+	a := netip.MustParseAddr("192.168.1.20")
+	if got := l.lookup(netip.MustParseAddr("::ffff:192.168.1.20"), t0); got != "laptop" {
+		t.Fatalf("first lookup: %q", got)
+	}
+
+	write("1 aa 192.168.1.20 desktop *\n", t0.Add(time.Minute))
+	if got := l.lookup(a, t0.Add(leasesRecheck-time.Second)); got != "laptop" {
+		t.Errorf("read again before leasesRecheck: %q", got)
+	}
+	if got := l.lookup(a, t0.Add(leasesRecheck)); got != "desktop" {
+		t.Errorf("change not read: %q", got)
+	}
+
+	// A file gone keeps the names read last.
+	os.Remove(path)
+	if got := l.lookup(a, t0.Add(2*leasesRecheck)); got != "desktop" {
+		t.Errorf("after removal: %q", got)
+	}
+	var none *leasesFile
+	if none.lookup(a, t0) != "" {
+		t.Error("nil leases file")
+	}
+}
@@ -0,0 +1,89 @@
+package tracker
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ListenerStats aggregates the established connections served by a listener.
+type ListenerStats struct {
+	Clients   []*Connection
+	TxRate    float64
+	RxRate    float64
+	WorstPing time.Duration
+	BySubnet  map[string]int // client /24 (IPv4) or /64 (IPv6) -> client count
+}
+
+// ListenerClients returns the clients of the LISTEN or unconnected UDP socket
+// with the given key. The second result is false if the key is unknown or not
+// a listener.
+func (t *Tracker) ListenerClients(key string) (ListenerStats, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	l, ok := t.connections[key]
+	if !ok || !l.IsListener() {
+		return ListenerStats{}, false
+	}
+	conns := make([]*Connection, 0, len(t.connections))
+	for _, c := range t.connections {
+		conns = append(conns, c)
+	}
+	return listenerClients(l, conns), true
+}
+
+// listenerClients joins established connections to a listener on protocol
+// family, local port and PID. A wildcard bind accepts any local address, and
+// tcp and tcp6 are treated as one protocol so dual-stack listeners (two LISTEN
+// rows) each see every client.
+func listenerClients(l *Connection, conns []*Connection) ListenerStats {
+	stats := ListenerStats{BySubnet: make(map[string]int)}
+	for _, c := range conns {
+		if c.State != StateEstablished || c.LocalPort != l.LocalPort || c.PID != l.PID {
+			continue
+		}
+		if baseProtocol(c.Protocol) != baseProtocol(l.Protocol) {
+			continue
+		}
+		if !isWildcard(l.LocalAddr) && c.LocalAddr != l.LocalAddr {
+			continue
+		}
+
+		cp := *c
+		stats.Clients = append(stats.Clients, &cp)
+		stats.TxRate += c.TxRate
+		stats.RxRate += c.RxRate
+		if c.Ping > stats.WorstPing {
+			stats.WorstPing = c.Ping
+		}
+		stats.BySubnet[clientSubnet(c.RemoteAddr)]++
+	}
+	return stats
+}
+
+// baseProtocol strips the IPv6 suffix: "tcp6" -> "tcp".
+func baseProtocol(p string) string {
+	return strings.TrimSuffix(p, "6")
+}
+
+func isWildcard(addr string) bool {
+	return addr == "0.0.0.0" || addr == "::"
+}
+
+// clientSubnet returns the /24 (IPv4) or /64 (IPv6) containing addr.
+func clientSubnet(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return addr
+	}
+	bits := 64
+	if ip.Is4() {
+		bits = 24
+	}
+	p, err := ip.Prefix(bits)
+	if err != nil {
+		return addr
+	}
+	return p.String()
+}
@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func listenRow(pid int, protocol, addr string, port int) *Connection {
+	return &Connection{PID: pid, Protocol: protocol, State: StateListening, Direction: Inbound,
+		LocalAddr: addr, LocalPort: port, RemoteAddr: "0.0.0.0"}
+}
+
+func clientRow(pid int, protocol, local string, port int, remote string, ping time.Duration, rx float64) *Connection {
+	return &Connection{PID: pid, Protocol: protocol, State: StateEstablished, Direction: Inbound,
+		LocalAddr: local, LocalPort: port, RemoteAddr: remote, RemotePort: 50000, Ping: ping, RxRate: rx}
+}
+
+func TestListenerClients(t *testing.T) {
+	conns := []*Connection{
+		clientRow(10, "tcp", "192.168.1.5", 27015, "203.0.113.7", 40*time.Millisecond, 100),
+		clientRow(10, "tcp", "10.0.0.5", 27015, "203.0.113.9", 90*time.Millisecond, 50),
+		clientRow(10, "tcp6", "2001:db8::5", 27015, "2001:db8:1::7", 10*time.Millisecond, 25),
+		clientRow(20, "tcp", "192.168.1.5", 27015, "198.51.100.1", 0, 1000), // another process
+		clientRow(10, "udp", "192.168.1.5", 27015, "203.0.113.8", 0, 1000),  // another protocol
+		clientRow(10, "tcp", "192.168.1.5", 8080, "203.0.113.8", 0, 1000),   // another port
+	}
+	closing := clientRow(10, "tcp", "192.168.1.5", 27015, "203.0.113.10", 0, 0)
+	closing.State = StateTimeWait
+	conns = append(conns, closing)
+
+	tests := []struct {
+		name     string
+		listener *Connection
+		clients  int
+		rx       float64
+		worst    time.Duration
+		subnets  map[string]int
+	}{
+		{"wildcard v4", listenRow(10, "tcp", "0.0.0.0", 27015), 3, 175, 90 * time.Millisecond,
+			map[string]int{"203.0.113.0/24": 2, "2001:db8:1::/64": 1}},
+		{"wildcard v6 of the same dual-stack listener", listenRow(10, "tcp6", "::", 27015), 3, 175, 90 * time.Millisecond, nil},
+		{"bound address", listenRow(10, "tcp", "192.168.1.5", 27015), 1, 100, 40 * time.Millisecond,
+			map[string]int{"203.0.113.0/24": 1}},
+		{"second process on the port", listenRow(20, "tcp", "0.0.0.0", 27015), 1, 1000, 0, nil},
+		{"no clients", listenRow(10, "tcp", "0.0.0.0", 9999), 0, 0, 0, map[string]int{}},
+	}
+	for _, tt := range tests {
+		s := listenerClients(tt.listener, conns)
+		if len(s.Clients) != tt.clients || s.RxRate != tt.rx || s.WorstPing != tt.worst {
+			t.Errorf("%s: %d clients, rx %v, worst %v; want %d, %v, %v",
+				tt.name, len(s.Clients), s.RxRate, s.WorstPing, tt.clients, tt.rx, tt.worst)
+		}
+		if tt.subnets == nil {
+			continue
+		}
+		if len(s.BySubnet) != len(tt.subnets) {
+			t.Errorf("%s: subnets %v, want %v", tt.name, s.BySubnet, tt.subnets)
+		}
+		for k, n := range tt.subnets {
+			if s.BySubnet[k] != n {
+				t.Errorf("%s: subnet %s has %d, want %d", tt.name, k, s.BySubnet[k], n)
+			}
+		}
+	}
+}
+
+func TestListenerClientsCopies(t *testing.T) {
+	c := clientRow(10, "tcp", "192.168.1.5", 80, "203.0.113.7", 0, 0)
+	s := listenerClients(listenRow(10, "tcp", "0.0.0.0", 80), []*Connection{c})
+	s.Clients[0].AppName = "changed"
+	if c.AppName == "changed" {
+		t.Fatal("client list shares the tracker's connections")
+	}
+}
+
+func TestListenerClientsByKey(t *testing.T) {
+	src := &fakeSource{}
+	l := *listenRow(10, "tcp", "0.0.0.0", 8080)
+	l.AppName = "srv"
+	client := *clientRow(10, "tcp", "10.0.0.2", 8080, "192.0.2.1", 0, 0)
+	client.AppName = "srv"
+	src.set(l, client)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+
+	if s, ok := tr.ListenerClients(l.Key()); !ok || len(s.Clients) != 1 {
+		t.Fatalf("listener: %d clients, ok %v", len(s.Clients), ok)
+	}
+	if _, ok := tr.ListenerClients(client.Key()); ok {
+		t.Fatal("an established connection counted as a listener")
+	}
+	if _, ok := tr.ListenerClients("nope"); ok {
+		t.Fatal("unknown key found")
+	}
+}
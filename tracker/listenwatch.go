@@ -0,0 +1,297 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxListenerRecords bounds listeners.json; the least recently seen
+	// listeners are dropped first.
+	maxListenerRecords = 4096
+
+	// maxListenerAlerts bounds the session's new-listener alert history.
+	maxListenerAlerts = 100
+)
+
+// ListenerID identifies a listening service across restarts: the PID and
+// bind address change between boots, the app, protocol and port do not.
+// The protocol has no family suffix, so IPv4 and IPv6 sockets of one
+// service share an ID.
+type ListenerID struct {
+	App   string `json:"app"`
+	Proto string `json:"proto"`
+	Port  int    `json:"port"`
+}
+
+// listenerID returns the identity of a LISTEN connection.
+func listenerID(c *Connection) ListenerID {
+	return ListenerID{App: c.AppName, Proto: strings.TrimSuffix(c.Protocol, "6"), Port: c.LocalPort}
+}
+
+// ListenerRecord is the persisted history of one listening service.
+type ListenerRecord struct {
+	ListenerID
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	AckedAt   time.Time `json:"acked_at,omitempty"` // zero until acknowledged
+}
+
+// ListenerSuppression exempts listeners from new-listener alerts, e.g. the
+// passive FTP or torrent ports an app opens on the fly. An empty App matches
+// any app; a zero Ports range matches any port.
+type ListenerSuppression struct {
+	App   string
+	Ports PortRange
+}
+
+func (s ListenerSuppression) matches(id ListenerID) bool {
+	if s.App != "" && s.App != id.App {
+		return false
+	}
+	return s.Ports == (PortRange{}) || s.Ports.Contains(id.Port)
+}
+
+// ListenerWatch remembers every listening service seen on this machine and
+// which of them the user has acknowledged. A listener that is neither
+// acknowledged nor suppressed raises a new-listener alert the first time it
+// appears in a session. It is kept in memory and written atomically to a
+// JSON file.
+type ListenerWatch struct {
+	mu       sync.Mutex
+	path     string
+	records  map[ListenerID]*ListenerRecord
+	session  map[ListenerID]bool // listeners already seen in this run
+	suppress []ListenerSuppression
+	baseline bool // no file existed: the first scan's listeners are acknowledged silently
+	dirty    bool
+}
+
+// OpenListenerWatch loads the listener history at path. A missing file
+// starts an empty history whose first scan becomes the baseline; a corrupt
+// one is reported but still returns a usable empty history.
+func OpenListenerWatch(path string) (*ListenerWatch, error) {
+	w := &ListenerWatch{
+		path:    path,
+		records: make(map[ListenerID]*ListenerRecord),
+		session: make(map[ListenerID]bool),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		w.baseline = true
+		return w, nil
+	}
+	if err != nil {
+		return w, err
+	}
+	var records []*ListenerRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return w, err
+	}
+	for _, r := range records {
+		w.records[r.ListenerID] = r
+	}
+	return w, nil
+}
+
+// SetSuppressions sets the rules exempting listeners from alerts.
+func (w *ListenerWatch) SetSuppressions(rules []ListenerSuppression) {
+	w.mu.Lock()
+	w.suppress = rules
+	w.mu.Unlock()
+}
+
+// observe records the LISTEN connections of one scan and returns the
+// identities that should alert: first seen in this session, not
+// acknowledged and not suppressed.
+func (w *ListenerWatch) observe(listeners []*Connection, now time.Time) []ListenerID {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var alerts []ListenerID
+	for _, c := range listeners {
+		id := listenerID(c)
+		r, ok := w.records[id]
+		if !ok {
+			r = &ListenerRecord{ListenerID: id, FirstSeen: now}
+			w.records[id] = r
+		}
+		r.LastSeen = now
+		w.dirty = true
+		if w.session[id] {
+			continue
+		}
+		w.session[id] = true
+		if w.baseline {
+			r.AckedAt = now
+			continue
+		}
+		if r.AckedAt.IsZero() && !w.suppressed(id) {
+			alerts = append(alerts, id)
+		}
+	}
+	w.baseline = false
+	return alerts
+}
+
+func (w *ListenerWatch) suppressed(id ListenerID) bool {
+	for _, s := range w.suppress {
+		if s.matches(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// pending reports whether id has alerted and is waiting for acknowledgement.
+func (w *ListenerWatch) pending(id ListenerID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r, ok := w.records[id]
+	return ok && r.AckedAt.IsZero() && w.session[id] && !w.suppressed(id)
+}
+
+// ack marks id as a known service, so it no longer alerts in this or any
+// later session.
+func (w *ListenerWatch) ack(id ListenerID, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r, ok := w.records[id]
+	if !ok || !r.AckedAt.IsZero() {
+		return false
+	}
+	r.AckedAt = now
+	w.dirty = true
+	return true
+}
+
+// Len returns the number of listeners in the history.
+func (w *ListenerWatch) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.records)
+}
+
+// Save drops the least recently seen listeners beyond maxListenerRecords and
+// writes the history to a temporary file that is renamed over the old one.
+func (w *ListenerWatch) Save() error {
+	w.mu.Lock()
+	if !w.dirty {
+		w.mu.Unlock()
+		return nil
+	}
+	records := make([]*ListenerRecord, 0, len(w.records))
+	for _, r := range w.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].LastSeen.After(records[j].LastSeen) })
+	if len(records) > maxListenerRecords {
+		for _, r := range records[maxListenerRecords:] {
+			delete(w.records, r.ListenerID)
+		}
+		records = records[:maxListenerRecords]
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	w.dirty = false
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.path)
+}
+
+// SetListenerWatch enables new-listener alerts backed by w. Must be called
+// before Start.
+func (t *Tracker) SetListenerWatch(w *ListenerWatch) {
+	t.listeners = w
+}
+
+// AckListener acknowledges the listening service of the connection with the
+// given key, clearing its highlight, and saves the history. It reports
+// whether there was anything to acknowledge.
+func (t *Tracker) AckListener(key string) (bool, error) {
+	if t.listeners == nil {
+		return false, nil
+	}
+	t.mu.Lock()
+	c, ok := t.connections[key]
+	if !ok || c.State != StateListening {
+		t.mu.Unlock()
+		return false, nil
+	}
+	id := listenerID(c)
+	acked := t.listeners.ack(id, time.Now())
+	for _, other := range t.connections {
+		if other.State == StateListening && listenerID(other) == id {
+			other.NewListener = false
+		}
+	}
+	t.mu.Unlock()
+	t.touch()
+	if !acked {
+		return false, nil
+	}
+	return true, t.listeners.Save()
+}
+
+// watchListeners feeds this scan's new LISTEN sockets to the listener watch,
+// flags unacknowledged ones and returns an alert for each listener that
+// appeared for the first time this session. Caller must hold the lock.
+func (t *Tracker) watchListeners(added []*Connection, now time.Time) []Alert {
+	var listeners []*Connection
+	for _, c := range added {
+		if c.State == StateListening {
+			listeners = append(listeners, c)
+		}
+	}
+	fresh := make(map[ListenerID]bool)
+	for _, id := range t.listeners.observe(listeners, now) {
+		fresh[id] = true
+	}
+
+	var alerts []Alert
+	for _, c := range listeners {
+		id := listenerID(c)
+		c.NewListener = t.listeners.pending(id)
+		if !fresh[id] {
+			continue
+		}
+		delete(fresh, id) // one alert per service, not per socket (IPv4 + IPv6)
+		exe := t.exePath(c.PID)
+		if exe == "" {
+			exe = "unknown executable"
+		}
+		alerts = append(alerts, Alert{
+			Time:    now,
+			Kind:    AlertNewListener,
+			Key:     c.Key(),
+			AppName: c.AppName,
+			Remote:  net.JoinHostPort(c.LocalAddr, strconv.Itoa(c.LocalPort)),
+			Reason:  fmt.Sprintf("new listener on %s %s:%d (pid %d, %s)", c.DisplayProtocol(), c.LocalAddr, c.LocalPort, c.PID, exe),
+		})
+	}
+	return alerts
+}
+
+// NewListenerAlerts returns the new-listener alerts raised so far this
+// session, oldest first.
+func (t *Tracker) NewListenerAlerts() []Alert {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Alert(nil), t.listenerAlerts...)
+}
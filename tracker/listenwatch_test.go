@@ -0,0 +1,196 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenConn(app string, pid int, proto string, port int) Connection {
+	return Connection{
+		AppName: app, PID: pid, Protocol: proto, State: StateListening, Direction: Inbound,
+		LocalAddr: "0.0.0.0", LocalPort: port,
+	}
+}
+
+// newListenerTracker is a tracker with a listener watch kept at path,
+// scanning src.
+func newListenerTracker(t *testing.T, path string, src *fakeSource) (*Tracker, *ListenerWatch) {
+	t.Helper()
+	w, err := OpenListenerWatch(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetListenerWatch(w)
+	return tr, w
+}
+
+func TestNewListenerDetection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "listeners.json")
+	src := &fakeSource{}
+	src.set(listenConn("sshd", 1, "tcp", 22))
+	tr, _ := newListenerTracker(t, path, src)
+
+	// Without a history the first scan is the baseline.
+	tr.scan()
+	if a := tr.NewListenerAlerts(); len(a) != 0 {
+		t.Fatalf("baseline alerted: %+v", a)
+	}
+
+	backdoor := listenConn("nc", 4444, "tcp", 31337)
+	backdoor6 := listenConn("nc", 4444, "tcp6", 31337)
+	backdoor6.LocalAddr = "::"
+	src.set(listenConn("sshd", 1, "tcp", 22), backdoor, backdoor6, fakeConn("web", "192.0.2.1", 443))
+	tr.scan()
+	alerts := tr.NewListenerAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts for one new service on two families: %+v", len(alerts), alerts)
+	}
+	a := alerts[0]
+	if a.Kind != AlertNewListener || a.AppName != "nc" || a.Remote != "0.0.0.0:31337" ||
+		!strings.Contains(a.Reason, "pid 4444") || !strings.Contains(a.Reason, "unknown executable") {
+		t.Errorf("alert %+v", a)
+	}
+	for _, c := range tr.Snapshot() {
+		want := c.AppName == "nc"
+		if c.NewListener != want {
+			t.Errorf("%s:%d highlighted %v", c.AppName, c.LocalPort, c.NewListener)
+		}
+	}
+
+	// Gone and back within the session: still highlighted, no second alert.
+	src.set(listenConn("sshd", 1, "tcp", 22))
+	tr.scan()
+	src.set(listenConn("sshd", 1, "tcp", 22), backdoor)
+	tr.scan()
+	if n := len(tr.NewListenerAlerts()); n != 1 {
+		t.Errorf("%d alerts after the listener came back", n)
+	}
+	if c := findConn(tr, "nc"); c == nil || !c.NewListener {
+		t.Error("returning listener not highlighted")
+	}
+}
+
+func TestListenerAckPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "listeners.json")
+	src := &fakeSource{}
+	tr, w := newListenerTracker(t, path, src)
+	tr.scan() // empty baseline
+	src.set(listenConn("redis", 9, "tcp", 6379), listenConn("nc", 10, "tcp", 4444), fakeConn("web", "192.0.2.1", 443))
+	tr.scan()
+	if n := len(tr.NewListenerAlerts()); n != 2 {
+		t.Fatalf("%d alerts", n)
+	}
+	redis := findConn(tr, "redis")
+	if ok, err := tr.AckListener(redis.Key()); !ok || err != nil {
+		t.Fatalf("ack: %v %v", ok, err)
+	}
+	if ok, _ := tr.AckListener(redis.Key()); ok {
+		t.Error("acknowledged twice")
+	}
+	if ok, _ := tr.AckListener(findConn(tr, "web").Key()); ok {
+		t.Error("acknowledged a connection that is not a listener")
+	}
+	if findConn(tr, "redis").NewListener || !findConn(tr, "nc").NewListener {
+		t.Error("highlight not cleared for the acknowledged listener only")
+	}
+	if err := w.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next session alerts on the unacknowledged listener only.
+	tr2, w2 := newListenerTracker(t, path, src)
+	if w2.Len() != 2 {
+		t.Fatalf("%d listeners loaded", w2.Len())
+	}
+	tr2.scan()
+	alerts := tr2.NewListenerAlerts()
+	if len(alerts) != 1 || alerts[0].AppName != "nc" {
+		t.Fatalf("after restart: %+v", alerts)
+	}
+}
+
+func TestListenerSuppression(t *testing.T) {
+	torrent := PortRange{Low: 6881, High: 6999}
+	tests := []struct {
+		rule ListenerSuppression
+		id   ListenerID
+		want bool
+	}{
+		{ListenerSuppression{App: "transmission"}, ListenerID{"transmission", "tcp", 51413}, true},
+		{ListenerSuppression{App: "transmission"}, ListenerID{"transmissio", "tcp", 51413}, false},
+		{ListenerSuppression{Ports: torrent}, ListenerID{"anything", "udp", 6881}, true},
+		{ListenerSuppression{Ports: torrent}, ListenerID{"anything", "udp", 6999}, true},
+		{ListenerSuppression{Ports: torrent}, ListenerID{"anything", "udp", 7000}, false},
+		{ListenerSuppression{App: "vsftpd", Ports: PortRange{Low: 40000, High: 40100}}, ListenerID{"vsftpd", "tcp", 40050}, true},
+		{ListenerSuppression{App: "vsftpd", Ports: PortRange{Low: 40000, High: 40100}}, ListenerID{"vsftpd", "tcp", 21}, false},
+		{ListenerSuppression{App: "vsftpd", Ports: PortRange{Low: 40000, High: 40100}}, ListenerID{"nc", "tcp", 40050}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.matches(tt.id); got != tt.want {
+			t.Errorf("%+v matches %+v = %v, want %v", tt.rule, tt.id, got, tt.want)
+		}
+	}
+
+	src := &fakeSource{}
+	tr, w := newListenerTracker(t, filepath.Join(t.TempDir(), "listeners.json"), src)
+	w.SetSuppressions([]ListenerSuppression{{App: "vsftpd", Ports: PortRange{Low: 40000, High: 40100}}})
+	tr.scan()
+	src.set(listenConn("vsftpd", 5, "tcp", 40050), listenConn("vsftpd", 5, "tcp", 2121))
+	tr.scan()
+	alerts := tr.NewListenerAlerts()
+	if len(alerts) != 1 || alerts[0].Remote != "0.0.0.0:2121" {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	if findConnPort(tr, 40050).NewListener {
+		t.Error("suppressed listener highlighted")
+	}
+}
+
+func TestListenerWatchSaveBounds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "listeners.json")
+	w, _ := OpenListenerWatch(path)
+	t0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range maxListenerRecords + 10 {
+		c := listenConn(fmt.Sprintf("app%d", i), i, "tcp", 1000+i)
+		w.observe([]*Connection{&c}, t0.Add(time.Duration(i)*time.Second))
+	}
+	if err := w.Save(); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := OpenListenerWatch(path)
+	if err != nil || w2.Len() != maxListenerRecords {
+		t.Fatalf("%d records reloaded, %v", w2.Len(), err)
+	}
+	if _, ok := w2.records[ListenerID{"app0", "tcp", 1000}]; ok {
+		t.Error("kept the least recently seen listener")
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if w3, err := OpenListenerWatch(path); err == nil || w3 == nil || w3.Len() != 0 {
+		t.Errorf("corrupt file: %v", err)
+	}
+}
+
+func findConn(tr *Tracker, app string) *Connection {
+	for _, c := range tr.Snapshot() {
+		if c.AppName == app {
+			return c
+		}
+	}
+	return nil
+}
+
+func findConnPort(tr *Tracker, port int) *Connection {
+	for _, c := range tr.Snapshot() {
+		if c.LocalPort == port {
+			return c
+		}
+	}
+	return nil
+}
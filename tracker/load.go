@@ -0,0 +1,224 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Defaults of a LoadThrottle that leaves them unset.
+	defaultLoadIntervalFactor   = 2
+	defaultLoadProbeConcurrency = 4
+	defaultLoadLowRatio         = 0.8 // Low as a share of High
+
+	// maxProbeConcurrency is how many probes run at once normally.
+	maxProbeConcurrency = 20
+
+	// maxLoadEvents bounds the session's throttle transition log.
+	maxLoadEvents = 100
+)
+
+// errNoLoadSample is returned by a sampler that needs a second reading
+// before it can report (Windows CPU times).
+var errNoLoadSample = errors.New("no load sample yet")
+
+// loadReader reads the system load: the platform's loadSampler, or
+// scripted samples in tests.
+type loadReader interface {
+	sample() (float64, error)
+}
+
+// LoadThrottle backs the tracker off while the machine is busy. Load is
+// the 1-minute load average per CPU on Linux, and the share of CPU time
+// busy since the previous scan on Windows; 1 means every CPU is in use.
+// Throttling starts once load reaches High and ends when it drops below
+// Low, so a load hovering around one threshold does not flap.
+type LoadThrottle struct {
+	High, Low        float64
+	IntervalFactor   float64 // multiplies the scan interval while throttled
+	ProbeConcurrency int     // probes run at once while throttled
+}
+
+// Enabled reports whether the throttle is on.
+func (l LoadThrottle) Enabled() bool {
+	return l.High > 0
+}
+
+// ParseLoadThrottle builds a throttle from its config keys: high 0 turns
+// it off; low defaults to 80% of high, factor to 2 and concurrency to 4.
+func ParseLoadThrottle(high, low, factor float64, concurrency int) (LoadThrottle, error) {
+	if high == 0 {
+		return LoadThrottle{}, nil
+	}
+	l := LoadThrottle{High: high, Low: low, IntervalFactor: factor, ProbeConcurrency: concurrency}
+	if l.Low == 0 {
+		l.Low = high * defaultLoadLowRatio
+	}
+	if l.IntervalFactor == 0 {
+		l.IntervalFactor = defaultLoadIntervalFactor
+	}
+	if l.ProbeConcurrency == 0 {
+		l.ProbeConcurrency = defaultLoadProbeConcurrency
+	}
+	switch {
+	case high < 0:
+		return LoadThrottle{}, fmt.Errorf("load_high: invalid %v", high)
+	case l.Low < 0 || l.Low >= high:
+		return LoadThrottle{}, fmt.Errorf("load_low: %v must be below load_high %v", l.Low, high)
+	case l.IntervalFactor < 1:
+		return LoadThrottle{}, fmt.Errorf("load_interval_factor: %v must be at least 1", l.IntervalFactor)
+	case l.ProbeConcurrency < 1 || l.ProbeConcurrency > maxProbeConcurrency:
+		return LoadThrottle{}, fmt.Errorf("load_probe_concurrency: %d must be 1 to %d", l.ProbeConcurrency, maxProbeConcurrency)
+	}
+	return l, nil
+}
+
+// nextThrottled is the throttle decision for a new load sample: it starts
+// at High and ends below Low, and otherwise stays as it was.
+func (l LoadThrottle) nextThrottled(throttled bool, load float64) bool {
+	switch {
+	case !l.Enabled():
+		return false
+	case !throttled:
+		return load >= l.High
+	}
+	return load >= l.Low
+}
+
+// parseLoadavg reads the 1-minute load average from the contents of
+// /proc/loadavg and divides it by cpus.
+func parseLoadavg(s string, cpus int) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty loadavg")
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid loadavg %q", fields[0])
+	}
+	return v / float64(max(cpus, 1)), nil
+}
+
+// cpuTimes are the system-wide CPU times GetSystemTimes reports, in 100ns
+// units. Kernel time includes idle time.
+type cpuTimes struct {
+	idle, kernel, user uint64
+}
+
+// cpuBusy is the share of CPU time spent busy between two readings; ok is
+// false when no time passed or the counters went backwards.
+func cpuBusy(prev, cur cpuTimes) (float64, bool) {
+	if cur.idle < prev.idle || cur.kernel < prev.kernel || cur.user < prev.user {
+		return 0, false
+	}
+	idle := cur.idle - prev.idle
+	total := (cur.kernel - prev.kernel) + (cur.user - prev.user)
+	if total == 0 || idle > total {
+		return 0, false
+	}
+	return float64(total-idle) / float64(total), true
+}
+
+// LoadEvent is the throttle starting or ending.
+type LoadEvent struct {
+	Time      time.Time
+	Load      float64
+	Throttled bool
+}
+
+// LoadStatus is the last load sample and whether the tracker is backing
+// off.
+type LoadStatus struct {
+	Sampled   bool // false until a sample was read, or with the throttle off
+	Load      float64
+	Throttled bool
+	Since     time.Time // when Throttled last changed
+}
+
+// SetLoadThrottle sets when the tracker backs off for a busy machine. A
+// throttle turned off ends at once. It is safe to call while the tracker
+// is running.
+func (t *Tracker) SetLoadThrottle(l LoadThrottle) {
+	t.mu.Lock()
+	before := t.effectiveInterval()
+	t.loadThrottle = l
+	if !l.Enabled() {
+		if t.loadStatus.Throttled {
+			t.logLoad(LoadEvent{Time: time.Now(), Load: t.loadStatus.Load})
+		}
+		t.loadStatus = LoadStatus{}
+	}
+	changed := t.effectiveInterval() != before
+	t.mu.Unlock()
+	if changed {
+		t.resetTicker()
+	}
+}
+
+// sampleLoad reads the system load and applies the throttle decision,
+// restarting the scan ticker when the interval changes. Called at the
+// start of each scan.
+func (t *Tracker) sampleLoad(now time.Time) {
+	t.mu.RLock()
+	enabled := t.loadThrottle.Enabled()
+	t.mu.RUnlock()
+	if !enabled {
+		return
+	}
+	load, err := t.loadSampler.sample()
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	before := t.effectiveInterval()
+	throttled := t.loadThrottle.nextThrottled(t.loadStatus.Throttled, load)
+	if throttled != t.loadStatus.Throttled {
+		t.loadStatus.Since = now
+		t.logLoad(LoadEvent{Time: now, Load: load, Throttled: throttled})
+	}
+	t.loadStatus.Sampled, t.loadStatus.Load, t.loadStatus.Throttled = true, load, throttled
+	changed := t.effectiveInterval() != before
+	t.mu.Unlock()
+	if changed {
+		t.resetTicker()
+	}
+}
+
+// logLoad appends e to the transition log. Caller must hold the lock.
+func (t *Tracker) logLoad(e LoadEvent) {
+	state := "ended"
+	if e.Throttled {
+		state = "started"
+	}
+	t.emit(e.Time, SeverityWarn, EventLoadThrottle, "state", state, "load", strconv.FormatFloat(e.Load, 'f', 2, 64))
+	t.loadLog = append(t.loadLog, e)
+	if over := len(t.loadLog) - maxLoadEvents; over > 0 {
+		t.loadLog = append([]LoadEvent(nil), t.loadLog[over:]...)
+	}
+}
+
+// probeConcurrency is how many probes may run at once. Caller must hold
+// the lock.
+func (t *Tracker) probeConcurrency() int {
+	if t.loadStatus.Throttled {
+		return t.loadThrottle.ProbeConcurrency
+	}
+	return maxProbeConcurrency
+}
+
+// LoadStatus returns the last load sample and the throttle state.
+func (t *Tracker) LoadStatus() LoadStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.loadStatus
+}
+
+// LoadEvents returns this session's throttle transitions, oldest first.
+func (t *Tracker) LoadEvents() []LoadEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]LoadEvent(nil), t.loadLog...)
+}
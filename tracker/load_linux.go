@@ -0,0 +1,19 @@
+//go:build linux
+
+package tracker
+
+import (
+	"os"
+	"runtime"
+)
+
+// loadSampler reads the 1-minute load average per CPU.
+type loadSampler struct{}
+
+func (s *loadSampler) sample() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadavg(string(data), runtime.NumCPU())
+}
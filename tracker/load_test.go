@@ -0,0 +1,197 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLoadThrottle(t *testing.T) {
+	if l, err := ParseLoadThrottle(0, 0.5, 3, 2); err != nil || l.Enabled() {
+		t.Errorf("off: %+v %v", l, err)
+	}
+	l, err := ParseLoadThrottle(2, 0, 0, 0)
+	if err != nil || l != (LoadThrottle{High: 2, Low: 1.6, IntervalFactor: 2, ProbeConcurrency: 4}) {
+		t.Errorf("defaults: %+v %v", l, err)
+	}
+	l, err = ParseLoadThrottle(0.9, 0.5, 3, 1)
+	if err != nil || l != (LoadThrottle{High: 0.9, Low: 0.5, IntervalFactor: 3, ProbeConcurrency: 1}) {
+		t.Errorf("set: %+v %v", l, err)
+	}
+	for _, tt := range []struct {
+		high, low, factor float64
+		concurrency       int
+		err               string
+	}{
+		{-1, 0, 0, 0, "load_high"},
+		{1, 1, 0, 0, "load_low: 1 must be below load_high 1"},
+		{1, -0.5, 0, 0, "load_low"},
+		{1, 0, 0.5, 0, "load_interval_factor"},
+		{1, 0, 0, 21, "load_probe_concurrency: 21 must be 1 to 20"},
+		{1, 0, 0, -1, "load_probe_concurrency"},
+	} {
+		_, err := ParseLoadThrottle(tt.high, tt.low, tt.factor, tt.concurrency)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%+v: error %v, want %s", tt, err, tt.err)
+		}
+	}
+}
+
+// TestNextThrottled walks a load around both thresholds: the throttle
+// starts at High, holds in between, and ends below Low.
+func TestNextThrottled(t *testing.T) {
+	l := LoadThrottle{High: 1, Low: 0.8}
+	throttled := false
+	for _, step := range []struct {
+		load float64
+		want bool
+	}{
+		{0.5, false}, {0.99, false}, {1, true}, {0.9, true}, {0.8, true},
+		{1.2, true}, {0.79, false}, {0.95, false}, {0.81, false}, {3, true}, {0, false},
+	} {
+		throttled = l.nextThrottled(throttled, step.load)
+		if throttled != step.want {
+			t.Fatalf("load %v: throttled %v", step.load, throttled)
+		}
+	}
+	if (LoadThrottle{}).nextThrottled(true, 100) {
+		t.Error("a disabled throttle throttles")
+	}
+}
+
+func TestParseLoadavg(t *testing.T) {
+	tests := []struct {
+		s    string
+		cpus int
+		want float64
+	}{
+		{"3.00 1.50 0.75 2/812 12345\n", 4, 0.75},
+		{"0.00 0.01 0.05 1/100 1", 8, 0},
+		{"2.50 1 1 1/1 1", 0, 2.5}, // an unknown CPU count counts as one
+	}
+	for _, tt := range tests {
+		if got, err := parseLoadavg(tt.s, tt.cpus); err != nil || got != tt.want {
+			t.Errorf("%q on %d CPUs: %v %v, want %v", tt.s, tt.cpus, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "\n", "high 1 1", "-1.0 0 0"} {
+		if _, err := parseLoadavg(bad, 1); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestCPUBusy(t *testing.T) {
+	prev := cpuTimes{idle: 1000, kernel: 3000, user: 1000}
+	tests := []struct {
+		cur  cpuTimes
+		want float64
+		ok   bool
+	}{
+		// 400 of kernel+user 1000 idle: 60% busy.
+		{cpuTimes{idle: 1400, kernel: 3600, user: 1400}, 0.6, true},
+		{cpuTimes{idle: 2000, kernel: 4000, user: 1000}, 0, true},
+		{cpuTimes{idle: 1000, kernel: 3500, user: 1500}, 1, true},
+		{prev, 0, false},
+		{cpuTimes{idle: 900, kernel: 3600, user: 1400}, 0, false},
+		{cpuTimes{idle: 3000, kernel: 3500, user: 1000}, 0, false}, // idle past the total
+	}
+	for _, tt := range tests {
+		if got, ok := cpuBusy(prev, tt.cur); ok != tt.ok || got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("%+v: %v %v, want %v %v", tt.cur, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// scriptedLoad returns its samples in turn, or the error set for a read.
+type scriptedLoad struct {
+	samples []float64
+	errs    map[int]error
+	n       int
+}
+
+func (s *scriptedLoad) sample() (float64, error) {
+	i := s.n
+	s.n++
+	if err := s.errs[i]; err != nil {
+		return 0, err
+	}
+	return s.samples[i], nil
+}
+
+func TestLoadThrottleTransitions(t *testing.T) {
+	script := &scriptedLoad{
+		samples: []float64{0.5, 1.1, 0.9, 0, 0.7, 0.95, 1.0, 0.5},
+		errs:    map[int]error{3: errNoLoadSample},
+	}
+	tr := NewTracker(2*time.Second, false)
+	tr.loadSampler = script
+	l, err := ParseLoadThrottle(1, 0.8, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.SetLoadThrottle(l)
+
+	start := time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		throttled   bool
+		interval    time.Duration
+		concurrency int
+	}{
+		{false, 2 * time.Second, 20},
+		{true, 6 * time.Second, 2},
+		{true, 6 * time.Second, 2}, // between the thresholds
+		{true, 6 * time.Second, 2}, // a failed read changes nothing
+		{false, 2 * time.Second, 20},
+		{false, 2 * time.Second, 20},
+		{true, 6 * time.Second, 2},
+		{false, 2 * time.Second, 20},
+	}
+	for i, s := range steps {
+		tr.sampleLoad(start.Add(time.Duration(i) * time.Minute))
+		st := tr.LoadStatus()
+		tr.mu.RLock()
+		interval, concurrency := tr.effectiveInterval(), tr.probeConcurrency()
+		tr.mu.RUnlock()
+		if !st.Sampled || st.Throttled != s.throttled || interval != s.interval || concurrency != s.concurrency {
+			t.Errorf("sample %d: %+v, interval %v, %d probes at once", i, st, interval, concurrency)
+		}
+	}
+	if st := tr.LoadStatus(); st.Load != 0.5 || !st.Since.Equal(start.Add(7*time.Minute)) {
+		t.Errorf("status %+v", st)
+	}
+
+	var log []string
+	for _, e := range tr.LoadEvents() {
+		log = append(log, e.Time.Format("15:04")+fmt.Sprintf(" %v %.2f", e.Throttled, e.Load))
+	}
+	if got, want := strings.Join(log, ", "), "12:01 true 1.10, 12:04 false 0.70, 12:06 true 1.00, 12:07 false 0.50"; got != want {
+		t.Errorf("log %s, want %s", got, want)
+	}
+}
+
+// TestLoadThrottleOff checks a throttle turned off while throttling ends
+// at once, and that the sampler is not read while it is off.
+func TestLoadThrottleOff(t *testing.T) {
+	script := &scriptedLoad{samples: []float64{5}, errs: map[int]error{1: errors.New("read after the throttle was turned off")}}
+	tr := NewTracker(time.Second, false)
+	tr.loadSampler = script
+	tr.SetLoadThrottle(LoadThrottle{High: 1, Low: 0.5, IntervalFactor: 4, ProbeConcurrency: 1})
+	tr.sampleLoad(time.Now())
+	if !tr.LoadStatus().Throttled {
+		t.Fatal("not throttled")
+	}
+	tr.SetLoadThrottle(LoadThrottle{})
+	tr.sampleLoad(time.Now())
+	if st := tr.LoadStatus(); st.Throttled || st.Sampled || script.n != 1 {
+		t.Errorf("after turning it off: %+v, %d reads", st, script.n)
+	}
+	tr.mu.RLock()
+	interval := tr.effectiveInterval()
+	tr.mu.RUnlock()
+	if events := tr.LoadEvents(); interval != time.Second || len(events) != 2 || events[1].Throttled {
+		t.Errorf("interval %v, events %+v", interval, events)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+package tracker
+
+import (
+	"unsafe"
+)
+
+var procGetSystemTimes = modkernel32.NewProc("GetSystemTimes")
+
+// loadSampler reads the share of CPU time busy since its previous sample.
+// Windows has no load average.
+type loadSampler struct {
+	prev    cpuTimes
+	hasPrev bool
+}
+
+func (s *loadSampler) sample() (float64, error) {
+	var idle, kernel, user filetime
+	r, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&idle)),
+		uintptr(unsafe.Pointer(&kernel)),
+		uintptr(unsafe.Pointer(&user)),
+	)
+	if r == 0 {
+		return 0, err
+	}
+	cur := cpuTimes{idle: idle.ticks(), kernel: kernel.ticks(), user: user.ticks()}
+	prev, hasPrev := s.prev, s.hasPrev
+	s.prev, s.hasPrev = cur, true
+	if !hasPrev {
+		return 0, errNoLoadSample
+	}
+	busy, ok := cpuBusy(prev, cur)
+	if !ok {
+		return 0, errNoLoadSample
+	}
+	return busy, nil
+}
+
+// filetime is a Windows FILETIME: 100ns ticks split into two halves.
+type filetime struct {
+	low, high uint32
+}
+
+func (f filetime) ticks() uint64 {
+	return uint64(f.high)<<32 | uint64(f.low)
+}
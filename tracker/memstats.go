@@ -0,0 +1,65 @@
+package tracker
+
+import "runtime"
+
+// MemEntry is the size of one in-memory structure.
+type MemEntry struct {
+	Name  string
+	Count int
+	Cap   int // 0 when bounded by live state (e.g. open sockets) rather than a cap
+}
+
+// MemStats reports the entry counts of the tracker's caches and history
+// buffers, for spotting growth in long-running sessions.
+func (t *Tracker) MemStats() []MemEntry {
+	t.mu.RLock()
+	entries := []MemEntry{
+		{Name: "connections", Count: len(t.connections), Cap: t.maxConns},
+		{Name: "recently closed", Count: len(t.closed), Cap: maxClosed},
+		{Name: "TLS library cache", Count: len(t.tlsLibCache)},
+		{Name: "executable cache", Count: len(t.exeCache)},
+		{Name: "external measurements", Count: len(t.external), Cap: maxExternal},
+		{Name: "app lifetime totals", Count: len(t.appTotals), Cap: maxAppTotals},
+		{Name: "probe samples", Count: len(t.samples)},
+	}
+	if t.auditor != nil {
+		entries = append(entries, MemEntry{Name: "audit results", Count: len(t.auditor.cache), Cap: maxAuditCache})
+	}
+	if t.listeners != nil {
+		entries = append(entries, MemEntry{Name: "listener history", Count: t.listeners.Len(), Cap: maxListenerRecords})
+	}
+	if t.calibration != nil {
+		entries = append(entries, MemEntry{Name: "ping calibration", Count: t.calibration.Len(), Cap: t.calibration.maxHosts})
+	}
+	t.mu.RUnlock()
+
+	if t.knownHosts != nil {
+		hosts, session := t.knownHosts.Len()
+		entries = append(entries,
+			MemEntry{Name: "known hosts", Count: hosts, Cap: t.knownHosts.maxEntries},
+			MemEntry{Name: "known hosts this run", Count: session, Cap: t.knownHosts.maxEntries})
+	}
+	if t.capture != nil {
+		t.capture.mu.Lock()
+		entries = append(entries, MemEntry{Name: "captured flows", Count: len(t.capture.flows), Cap: maxCaptureFlows})
+		t.capture.mu.Unlock()
+		t.capture.h2c.mu.Lock()
+		entries = append(entries, MemEntry{Name: "h2c connections", Count: len(t.capture.h2c.flows), Cap: maxH2CFlows})
+		t.capture.h2c.mu.Unlock()
+	}
+	t.sni.mu.Lock()
+	entries = append(entries,
+		MemEntry{Name: "observed flows", Count: len(t.sni.flows), Cap: maxSNIFlows},
+		MemEntry{Name: "QUIC servers", Count: len(t.sni.remotes), Cap: maxSNIFlows})
+	t.sni.mu.Unlock()
+	entries = append(entries, MemEntry{Name: "owner retries", Count: t.resolveQueue.Len(), Cap: maxResolveQueue})
+	entries = append(entries, MemEntry{Name: "scan stats", Count: len(t.perf.list()), Cap: perfHistory})
+	return entries
+}
+
+// HeapBytes is the Go heap currently in use.
+func HeapBytes() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
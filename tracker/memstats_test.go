@@ -0,0 +1,77 @@
+package tracker
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestSoakMemoryBounds simulates a day of churn: every scan replaces all
+// connections with ones to remotes never seen before, so every per-remote
+// structure sees hundreds of thousands of distinct keys. Entry counts must
+// stay within their caps and the heap must stop growing once they are full.
+func TestSoakMemoryBounds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	const (
+		interval = 2 * time.Minute
+		scans    = int(24 * time.Hour / interval)
+		perScan  = 250
+	)
+	k, _ := OpenKnownHosts(filepath.Join(t.TempDir(), "known_hosts.json"), 2000)
+	src := &fakeSource{rtt: 20 * time.Millisecond}
+	tr := NewTracker(interval, true)
+	tr.SetSource(src)
+	tr.SetKnownHosts(k)
+	tr.SetAuditor(NewAuditor(DefaultAuditRules()))
+	tr.SetCalibrationHosts(500)
+	tr.SetPingCorrection(true)
+	tr.SetSampleFilter(SampleFilter{})
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tr.SetClock(func() time.Time { return now })
+
+	remote := 0
+	var warmHeap uint64
+	conns := make([]Connection, perScan)
+	for scan := range scans {
+		for i := range conns {
+			addr := fmt.Sprintf("%d.%d.%d.1", 20+remote>>16, remote>>8&0xff, remote&0xff)
+			conns[i] = fakeConn(fmt.Sprintf("app%d", remote%50), addr, 443)
+			conns[i].PID = 1000 + remote%200
+			remote++
+		}
+		src.set(conns...)
+		tr.scan()
+		now = now.Add(interval)
+		if scan%30 == 0 { // the state is saved every hour
+			if err := k.Save(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if scan == scans/4 {
+			warmHeap = settledHeap()
+		}
+	}
+
+	for _, e := range tr.MemStats() {
+		if e.Cap > 0 && e.Count > e.Cap {
+			t.Errorf("%s: %d entries over the cap of %d", e.Name, e.Count, e.Cap)
+		}
+		if e.Cap == 0 && e.Count > perScan*int(sampleHostTTL/interval+2) {
+			t.Errorf("%s: %d entries with only %d live connections", e.Name, e.Count, perScan)
+		}
+	}
+	if end := settledHeap(); end > warmHeap*3/2+8<<20 {
+		t.Errorf("heap grew from %d to %d bytes after the caches filled", warmHeap, end)
+	}
+	t.Logf("%d remotes over %d scans", remote, scans)
+}
+
+func settledHeap() uint64 {
+	runtime.GC()
+	runtime.GC()
+	return HeapBytes()
+}
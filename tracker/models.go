@@ -5,7 +5,8 @@ import (
 	"time"
 )
 
-// ConnState represents the state of a TCP connection.
+// ConnState represents the state of a TCP connection, or of a UDP socket
+// (UNCONN or ESTABLISHED once connected).
 type ConnState string
 
 const (
@@ -20,6 +21,7 @@ const (
 	StateLastAck     ConnState = "LAST_ACK"
 	StateClosing     ConnState = "CLOSING"
 	StateClosed      ConnState = "CLOSED"
+	StateUnconnected ConnState = "UNCONN" // UDP socket with no remote endpoint, as ss shows it
 	StateUnknown     ConnState = "UNKNOWN"
 )
 
@@ -34,10 +36,21 @@ const (
 // Connection represents a single tracked network connection.
 type Connection struct {
 	// Identity
+	Host      string // agent the connection was fetched from; empty for this machine
+	Namespace string // network namespace with -all-netns; empty for our own
 	PID       int
 	AppName   string
-	Protocol  string // "tcp", "tcp6", "udp", "udp6"
+	Protocol  string // "tcp", "tcp6", "udp", "udp6" (the socket's protocol)
 	Direction Direction
+	Family    int  // 4 or 6, from the addresses after unmapping
+	V4Mapped  bool // AF_INET6 socket carrying IPv4-mapped addresses
+
+	// Origin is set for flows this machine forwards rather than owns (see
+	// EnableConntrack). Their LocalAddr is the LAN client, ClientName its
+	// DHCP hostname and OriginIface the interface it sits behind.
+	Origin      Origin
+	ClientName  string
+	OriginIface string
 
 	// Endpoints
 	LocalAddr  string
@@ -48,16 +61,163 @@ type Connection struct {
 	// State
 	State ConnState
 
+	// Provenance lists the scanners that reported the socket in the last
+	// scan, in order (ProvenanceProc, ...). Merged counts the duplicate
+	// reports folded into this connection then (see reconcile).
+	Provenance []string
+	Merged     int
+
+	// Heuristic classification
+	Encryption       Encryption
+	EncryptionSource string // which rule decided Encryption
+	Service          string // application protocol from the ports or the packets, e.g. "quic" (see ClassifyService, ObserveQUIC)
+	SNI              string // server name from the TLS ClientHello (see ObserveClientHello and ObserveQUIC); "" when not seen
+	QUICVersion      string // QUIC version of the flow's long headers, e.g. "v1" (see ObserveQUIC); "" when not seen
+
+	// StreamHint estimates the parallel streams or flows this one socket
+	// carries: the most HTTP/2 streams open at once since the last scan
+	// of an h2c connection followed by -pcap-accounting, or the conntrack
+	// flows through an unconnected UDP socket with -conntrack.
+	// StreamHintSource says which (StreamsH2C, StreamsConntrack); both are
+	// empty where neither applies.
+	StreamHint       int
+	StreamHintSource string
+
+	// Traffic marking (ss backend on Linux); nil when it cannot be read
+	QoS *QoS
+
+	// TCP congestion control (ss backend on Linux): the algorithm, e.g.
+	// "cubic" or "bbr", "" when unknown, and BBR's own path model
+	CongestionAlgo string
+	BBR            *BBRInfo
+
+	// Kernel socket memory (ss backend on Linux): SockMem is the total
+	// charged to the socket (see SockMemInfo.Total), 0 with SockMemInfo
+	// nil when it cannot be read
+	SockMem     uint64
+	SockMemInfo *SockMemInfo
+
+	// StateSince is when the connection entered State; StateSinceExact is
+	// false when it was already in State when tracking started. Stuck is set
+	// while it has been in State longer than its StuckThresholds entry.
+	StateSince      time.Time
+	StateSinceExact bool
+	Stuck           bool
+
+	// NewListener marks a LISTEN socket whose service has not been
+	// acknowledged (see ListenerWatch)
+	NewListener bool
+
+	// Executable attribution and audit (only filled in with -audit)
+	ExePath string
+	Audit   AuditResult
+
 	// Metrics
-	Ping    time.Duration // RTT latency
-	Loss    float64       // packet loss percentage (0-100)
-	TxBytes uint64        // bytes sent (from /proc/net)
-	RxBytes uint64        // bytes received
-	TxRate  float64       // bytes/sec send rate
-	RxRate  float64       // bytes/sec receive rate
-	ConnAge time.Duration // how long the connection has existed
+	Ping      time.Duration // RTT latency, corrected for probe bias (see PingCorrection)
+	Loss      float64       // packet loss percentage (0-100)
+	LossTrend LossTrend     // windowed loss, last minute vs. the minute before
+	TxBytes   uint64        // bytes sent and acknowledged, from kernel counters
+	RxBytes   uint64        // bytes received
+	TxRate    float64       // bytes/sec send rate
+	RxRate    float64       // bytes/sec receive rate
+	ConnAge   time.Duration // how long the connection has existed
+
+	// HasByteCounts is set when the scanner reports real byte counters
+	// (ss -i for TCP) or -pcap-accounting counted the flow; otherwise the
+	// bytes and rates above are zero. CapturedBytes is set in the second
+	// case, where the bytes are IP packets, headers included.
+	HasByteCounts bool
+	CapturedBytes bool
+
+	// Socket buffer occupancy. SendQ is data not yet acknowledged by the
+	// peer, RecvQ data received but not yet read by the app (for LISTEN
+	// sockets: the accept backlog). HasQueues is false where the scanner
+	// cannot read them (Windows).
+	SendQ     uint64
+	RecvQ     uint64
+	HasQueues bool
+	SendQHigh int // consecutive scans with SendQ at or above the alert threshold
+
+	// Probe calibration: the raw TCP connect RTT, the kernel's smoothed RTT
+	// for the socket where the scanner reports it, and how Ping was derived.
+	RawPing        time.Duration
+	KernelRTT      time.Duration
+	PingCorrection PingCorrection
+	PingSource     string     // who reported Ping when PingCorrection is CorrectionExternal
+	Proxy          *ProxyPing // legs of the last probe made through -probe-proxy; nil when probed directly
+
+	// Probe RTTs the sample filter kept out of Ping (see SampleFilter), and
+	// what it made of the last one; RawPing holds that sample either way.
+	WarmUpSamples  int
+	OutlierSamples int
+	LastSample     SampleVerdict
+
+	// Transfer stalls, from kernel TCP info where the scanner provides it
+	TCPInfo     *TCPInfo  // nil when unavailable; replaced, never mutated, each scan
+	StallSince  time.Time // zero unless a stall has been confirmed
+	StallReason string    // "zero window" or "send buffer full"
+
+	// PortShare is set on a listener whose protocol and port other
+	// processes listen on too (see DetectPortShares); nil otherwise.
+	PortShare *PortShare
+
+	// UnreachableSince is when the probes to the remote host started
+	// failing, kept per host across connections; zero while it answers.
+	UnreachableSince time.Time
+
+	// HalfOpen is set on an established connection suspected to be
+	// half-open (see HalfOpenRule), since HalfOpenSince, with the evidence
+	// in HalfOpenReason.
+	HalfOpen       bool
+	HalfOpenSince  time.Time
+	HalfOpenReason string
+
+	// ServiceCheck is the latest application-layer health check of the
+	// remote (see SetServiceChecks); nil when no check applies or none has
+	// finished yet.
+	ServiceCheck *ServiceCheck
+
+	// Health score (see HealthScore), recomputed after each scan's probes.
+	// RetransRate is the percentage of segments retransmitted since the
+	// previous scan, where TCP info reports the counters.
+	Score          int
+	ScoreWorst     string // lowest component, e.g. "loss"; "" when none is below 1
+	HasScore       bool
+	ScoreLow       int // consecutive scans below the alert threshold
+	RetransRate    float64
+	HasRetransRate bool
+
+	// Derived holds the values of the user-defined columns (see
+	// SetDerivedColumns) by name; a column is absent when one of its
+	// inputs is missing for this connection.
+	Derived map[string]float64
+
+	// Injected marks a connection an -inject perturbation changed or made
+	// up (see Injection); it is only ever set on snapshot copies.
+	Injected bool
+
+	// Closing is set only on the synthetic rows CollapseClosing makes, one
+	// per app or local port, that stand for its closing-state sockets.
+	Closing *ClosingSummary
+
+	// RemoteFirstSeenEver is when RemoteAddr was first observed across all
+	// sessions (zero if the known-hosts database is disabled).
+	RemoteFirstSeenEver time.Time
+
+	// Logical flow identity: a socket that replaces a recently closed one to
+	// the same remote inherits its history (see FlowLinkConfig).
+	LogicalFirstSeen time.Time
+	LinkedFrom       string // Key() of the socket this one continues
+	Relinks          int
+	ClosedAt         time.Time // set once the connection is in the recently-closed buffer
+
+	// Probe scheduling
+	PingTier   PingTier
+	LastActive time.Time // last scan with non-zero throughput
+	NoProbe    AddrClass // why RemoteAddr is never probed; AddrProbeable when it is
 
 	// Internal bookkeeping
+	inode       string // socket inode from the proc scanner, for retrying its owner
 	FirstSeen   time.Time
 	LastUpdated time.Time
 	PingCount   int
@@ -67,12 +227,42 @@ type Connection struct {
 	prevTxBytes uint64
 	prevRxBytes uint64
 	prevTime    time.Time
+
+	// Recent ping results for windowed loss
+	lossSamples []lossSample
+
+	// Scan cycle of the last probe
+	lastProbeCycle int
+
+	// Consecutive stalled samples and when the first of them was seen
+	stallSamples int
+	stallStart   time.Time
+
+	// Byte counters when they last moved, when that was, and the
+	// retransmit count then, for the half-open check
+	dataTx, dataRx uint64
+	dataAt         time.Time
+	retransAtData  uint64
+
+	// End of the last flow record exported for this connection
+	flowExportedAt time.Time
 }
 
-// Key returns a unique identifier for this connection.
+// Key returns a unique identifier for this connection. Connections fetched
+// from a remote agent are prefixed with their host.
 func (c *Connection) Key() string {
-	return fmt.Sprintf("%d:%s:%s:%d->%s:%d",
+	key := fmt.Sprintf("%d:%s:%s:%d->%s:%d",
 		c.PID, c.Protocol, c.LocalAddr, c.LocalPort, c.RemoteAddr, c.RemotePort)
+	if c.Closing != nil {
+		key = fmt.Sprintf("closing:%d:%s:%s", c.Closing.By, c.Origin, c.Closing.Key)
+	}
+	if c.Namespace != "" {
+		key = "netns:" + c.Namespace + "|" + key
+	}
+	if c.Host != "" {
+		key = c.Host + "|" + key
+	}
+	return key
 }
 
 // BandwidthStr returns a human-readable bandwidth string.
@@ -0,0 +1,198 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// NetContextTimeout bounds one family's lookups in DiscoverNetContext.
+	NetContextTimeout = 3 * time.Second
+
+	// NetContextTTL is how long a NetContext is shown before it is looked
+	// up again.
+	NetContextTTL = 10 * time.Minute
+)
+
+// sharedAddressSpace is 100.64.0.0/10 (RFC 6598), the range carriers
+// number their customers from behind carrier-grade NAT.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NATMapping is how a NAT maps one local socket's packets to different
+// servers (RFC 4787), as far as two STUN servers can tell.
+type NATMapping int
+
+const (
+	MappingUnknown             NATMapping = iota // one STUN server, or a lookup failed
+	MappingNone                                  // the public address is the local one
+	MappingEndpointIndependent                   // the same public port for both servers
+	MappingEndpointDependent                     // a new public port per server ("symmetric")
+)
+
+var natMappingNames = []string{"unknown", "no NAT", "endpoint-independent", "endpoint-dependent (symmetric)"}
+
+func (m NATMapping) String() string {
+	if int(m) < len(natMappingNames) {
+		return natMappingNames[m]
+	}
+	return "unknown"
+}
+
+// FamilyContext is what one address family looks like from outside.
+type FamilyContext struct {
+	Iface   string         // the interface of the default route; "" if unknown
+	Local   netip.AddrPort // the socket's address on it
+	Public  netip.AddrPort // the address the STUN server saw
+	Public2 netip.AddrPort // the address the second server saw, if one is set
+	Mapping NATMapping
+	Err     error // the family has no route, or the server did not answer
+}
+
+// OK reports whether the public address was found.
+func (f FamilyContext) OK() bool {
+	return f.Err == nil && f.Public.IsValid()
+}
+
+// NATed reports whether the public address differs from the local one.
+func (f FamilyContext) NATed() bool {
+	return f.OK() && f.Public.Addr() != f.Local.Addr()
+}
+
+// CGNAT reports whether the machine sits behind carrier-grade NAT: it is
+// NATed and its own address is in 100.64.0.0/10.
+func (f FamilyContext) CGNAT() bool {
+	return f.NATed() && sharedAddressSpace.Contains(f.Local.Addr())
+}
+
+// DoubleNAT is a hint of two NATs in a row: the STUN server saw an address
+// that is not public either, so another NAT lies past the one it sits
+// behind.
+func (f FamilyContext) DoubleNAT() bool {
+	return f.NATed() && !isPublicAddr(f.Public.Addr())
+}
+
+func isPublicAddr(a netip.Addr) bool {
+	return a.IsGlobalUnicast() && !a.IsPrivate() && !sharedAddressSpace.Contains(a)
+}
+
+// NetContext is the public IPv4 and IPv6 addresses next to the local ones,
+// from STUN binding requests.
+type NetContext struct {
+	At      time.Time
+	Server  string
+	Server2 string // "" without a second server
+	V4, V6  FamilyContext
+}
+
+// Stale reports whether c is older than NetContextTTL.
+func (c NetContext) Stale(now time.Time) bool {
+	return now.Sub(c.At) >= NetContextTTL
+}
+
+// DiscoverNetContext asks server, and server2 if set, for this machine's
+// public IPv4 and IPv6 addresses, both families at once, each within
+// NetContextTimeout. It is not part of the scan loop; callers run it when
+// asked to.
+func DiscoverNetContext(ctx context.Context, server, server2 string) NetContext {
+	if server == "" {
+		server = DefaultSTUNServer
+	}
+	c := NetContext{At: time.Now(), Server: server, Server2: server2}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.V4 = discoverFamily(ctx, "udp4", server, server2)
+	}()
+	go func() {
+		defer wg.Done()
+		c.V6 = discoverFamily(ctx, "udp6", server, server2)
+	}()
+	wg.Wait()
+	return c
+}
+
+// discoverFamily runs the lookups of one family ("udp4" or "udp6") from a
+// single socket, so that two servers seeing different ports tells how the
+// NAT maps.
+func discoverFamily(ctx context.Context, network, server, server2 string) FamilyContext {
+	ctx, cancel := context.WithTimeout(ctx, NetContextTimeout)
+	defer cancel()
+	var f FamilyContext
+	to, err := resolveSTUN(ctx, network, server)
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	// Connecting a UDP socket sends nothing; it picks the source address
+	// of the route the packets would take.
+	route, err := net.Dial(network, to.String())
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	src := route.LocalAddr().(*net.UDPAddr).AddrPort()
+	route.Close()
+	conn, err := net.ListenUDP(network, net.UDPAddrFromAddrPort(netip.AddrPortFrom(src.Addr(), 0)))
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	defer conn.Close()
+	f.Local = conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	f.Local = netip.AddrPortFrom(f.Local.Addr().Unmap(), f.Local.Port())
+	f.Iface = ifaceOf(f.Local.Addr(), interfaceNets())
+	if f.Public, f.Err = stunBinding(ctx, conn, to); f.Err != nil {
+		return f
+	}
+	f.Public = netip.AddrPortFrom(f.Public.Addr().Unmap(), f.Public.Port())
+	if !f.NATed() {
+		f.Mapping = MappingNone
+	}
+	if server2 == "" {
+		return f
+	}
+	to2, err := resolveSTUN(ctx, network, server2)
+	if err == nil {
+		f.Public2, err = stunBinding(ctx, conn, to2)
+	}
+	switch {
+	case err != nil:
+		// The first answer stands; only the mapping stays unknown.
+	case f.Mapping == MappingNone:
+	case f.Public2 == f.Public:
+		f.Mapping = MappingEndpointIndependent
+	default:
+		f.Mapping = MappingEndpointDependent
+	}
+	return f
+}
+
+// resolveSTUN looks up a host:port server in network's family.
+func resolveSTUN(ctx context.Context, network, server string) (netip.AddrPort, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("stun server %q: %w", server, err)
+	}
+	p, err := net.DefaultResolver.LookupPort(ctx, "udp", port)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ipNet := "ip4"
+	if network == "udp6" {
+		ipNet = "ip6"
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, ipNet, host)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	if len(addrs) == 0 {
+		return netip.AddrPort{}, errors.New("no address for " + host)
+	}
+	return netip.AddrPortFrom(addrs[0].Unmap(), uint16(p)), nil
+}
@@ -0,0 +1,129 @@
+//go:build linux
+
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// allNetns makes the proc scanner read the socket tables of every network
+// namespace, not just our own. Set once with EnableAllNetns before Start.
+var allNetns bool
+
+// netnsRunDir holds the bind mounts of namespaces named with `ip netns add`.
+var netnsRunDir = "/run/netns"
+
+// EnableAllNetns turns on scanning of every network namespace (containers,
+// `ip netns`). It needs root to read other processes' namespace links.
+func EnableAllNetns() error {
+	allNetns = true
+	return nil
+}
+
+// netnsInfo is one network namespace other than our own.
+type netnsInfo struct {
+	inode uint64
+	pid   int // lowest PID inside it, whose /proc/<pid>/net is read
+	label string
+}
+
+// netnsEntries reads the socket tables of every other network namespace.
+// Each namespace is read once through one of its processes, since
+// /proc/<pid>/net shows the tables of the namespace pid lives in; this avoids
+// setns and so never moves an OS thread between namespaces. A process that
+// exits between listing and reading just loses that namespace for one scan.
+func netnsEntries() []inodeEntry {
+	var entries []inodeEntry
+	for _, ns := range listNetns() {
+		dir := filepath.Join(procRoot, strconv.Itoa(ns.pid), "net")
+		parsed, err := readProcTables(dir, ns.label)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, parsed...)
+	}
+	return entries
+}
+
+// listNetns finds the network namespaces that have at least one process in
+// them, excluding our own, from the /proc/<pid>/ns/net links.
+func listNetns() []netnsInfo {
+	self, ok := netnsInode(filepath.Join(procRoot, "self", "ns", "net"))
+	if !ok {
+		return nil
+	}
+	dirs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil
+	}
+
+	byInode := make(map[uint64]*netnsInfo)
+	var order []uint64
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+		ino, ok := netnsInode(filepath.Join(procRoot, d.Name(), "ns", "net"))
+		if !ok || ino == self {
+			continue
+		}
+		if ns, seen := byInode[ino]; seen {
+			if pid < ns.pid {
+				ns.pid = pid
+			}
+			continue
+		}
+		byInode[ino] = &netnsInfo{inode: ino, pid: pid}
+		order = append(order, ino)
+	}
+
+	names := namedNetns()
+	list := make([]netnsInfo, 0, len(order))
+	for _, ino := range order {
+		ns := byInode[ino]
+		ns.label = names[ino]
+		if ns.label == "" {
+			ns.label = strconv.FormatUint(ino, 10)
+		}
+		list = append(list, *ns)
+	}
+	return list
+}
+
+// netnsInode parses a namespace link like "net:[4026531840]".
+func netnsInode(path string) (uint64, bool) {
+	link, err := os.Readlink(path)
+	if err != nil {
+		return 0, false
+	}
+	s, ok := strings.CutPrefix(link, "net:[")
+	if !ok {
+		return 0, false
+	}
+	ino, err := strconv.ParseUint(strings.TrimSuffix(s, "]"), 10, 64)
+	return ino, err == nil
+}
+
+// namedNetns maps namespace inodes to their `ip netns` names.
+func namedNetns() map[uint64]string {
+	names := make(map[uint64]string)
+	entries, err := os.ReadDir(netnsRunDir)
+	if err != nil {
+		return names
+	}
+	for _, e := range entries {
+		fi, err := os.Stat(filepath.Join(netnsRunDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			names[st.Ino] = e.Name()
+		}
+	}
+	return names
+}
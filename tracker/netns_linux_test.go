@@ -0,0 +1,143 @@
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+const procTCPHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// procTCPLine is a /proc/net/tcp row for an established IPv4 socket.
+func procTCPLine(local, remote, inode string) string {
+	return "   0: " + local + " " + remote + " 01 00000000:00000000 00:00000000 00000000  1000        0 " + inode + " 1 0000000000000000 20 4 30 10 -1\n"
+}
+
+// setNetns links pid (or "self") into the network namespace with inode ino.
+func (p *fakeProc) setNetns(pid string, ino uint64) {
+	dir := filepath.Join(p.root, pid, "ns")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		p.t.Fatal(err)
+	}
+	if err := os.Symlink("net:["+strconv.FormatUint(ino, 10)+"]", filepath.Join(dir, "net")); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// setTCP writes the tcp table seen from dir ("net" or "<pid>/net").
+func (p *fakeProc) setTCP(dir string, lines ...string) {
+	path := filepath.Join(p.root, dir)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		p.t.Fatal(err)
+	}
+	data := procTCPHeader
+	for _, l := range lines {
+		data += l
+	}
+	if err := os.WriteFile(filepath.Join(path, "tcp"), []byte(data), 0o644); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func TestNetnsInode(t *testing.T) {
+	p := newFakeProc(t)
+	p.setNetns("1", 4026531840)
+	os.Symlink("mnt:[4026531841]", filepath.Join(p.root, "1", "ns", "mnt"))
+	os.Symlink("net:[x]", filepath.Join(p.root, "1", "ns", "bad"))
+
+	if ino, ok := netnsInode(filepath.Join(p.root, "1", "ns", "net")); !ok || ino != 4026531840 {
+		t.Errorf("net link: %d %v", ino, ok)
+	}
+	for _, name := range []string{"mnt", "bad", "missing"} {
+		if _, ok := netnsInode(filepath.Join(p.root, "1", "ns", name)); ok {
+			t.Errorf("%s link parsed", name)
+		}
+	}
+}
+
+func TestScanAllNetns(t *testing.T) {
+	p := newFakeProc(t)
+	oldResolver, oldAll, oldRun := resolver, allNetns, netnsRunDir
+	resolver, allNetns, netnsRunDir = newTestResolver(), true, t.TempDir()
+	t.Cleanup(func() { resolver, allNetns, netnsRunDir = oldResolver, oldAll, oldRun })
+
+	// A named namespace is identified by the inode of its bind mount.
+	named := filepath.Join(netnsRunDir, "web")
+	os.WriteFile(named, nil, 0o644)
+	fi, err := os.Stat(named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webNS := fi.Sys().(*syscall.Stat_t).Ino
+
+	const hostNS, anonNS = 1, 4026532999
+	p.setNetns("self", hostNS)
+	p.add(100, "curl", "1001")
+	p.setNetns("100", hostNS)
+	p.setTCP("net", procTCPLine("0200000A:9C40", "0100A8C0:01BB", "1001"))
+
+	// Two processes share the web namespace; its table is read once, through
+	// the lower PID, yet both sockets resolve to their owners.
+	p.add(300, "nginx", "3001")
+	p.add(200, "sidecar", "3002")
+	p.setNetns("300", webNS)
+	p.setNetns("200", webNS)
+	p.setTCP("200/net",
+		procTCPLine("0200000A:0050", "0300000A:C350", "3001"),
+		procTCPLine("0200000A:1F90", "0300000A:C351", "3002"))
+	p.setTCP("300/net", procTCPLine("0200000A:0050", "0300000A:C350", "3001"))
+
+	p.add(400, "redis", "4001")
+	p.setNetns("400", anonNS)
+	p.setTCP("400/net", procTCPLine("0200000A:18EB", "0300000A:C352", "4001"))
+
+	// A process that exits before its table is read loses the namespace
+	// for this scan only.
+	p.setNetns("500", 4026533000)
+
+	conns, err := scanProc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		app string
+		pid int
+		ns  string
+	}{
+		"1001": {"curl", 100, ""},
+		"3001": {"nginx", 300, "web"},
+		"3002": {"sidecar", 200, "web"},
+		"4001": {"redis", 400, "4026532999"},
+	}
+	if len(conns) != len(want) {
+		for _, c := range conns {
+			t.Logf("%s", c.Key())
+		}
+		t.Fatalf("%d connections, want %d", len(conns), len(want))
+	}
+	keys := make(map[string]bool)
+	for _, c := range conns {
+		w, ok := want[c.inode]
+		if !ok {
+			t.Errorf("unexpected socket %s", c.inode)
+			continue
+		}
+		if c.AppName != w.app || c.PID != w.pid || c.Namespace != w.ns {
+			t.Errorf("socket %s: %s/%d in %q, want %s/%d in %q", c.inode, c.AppName, c.PID, c.Namespace, w.app, w.pid, w.ns)
+		}
+		keys[c.Key()] = true
+	}
+	if len(keys) != len(conns) {
+		t.Errorf("%d distinct keys for %d connections", len(keys), len(conns))
+	}
+
+	filtered := FilterConnections(conns, "netns:web")
+	if len(filtered) != 2 {
+		t.Errorf("netns:web matched %d connections, want 2", len(filtered))
+	}
+	if got := FilterConnections(conns, "netns:host"); len(got) != 1 || got[0].AppName != "curl" {
+		t.Errorf("netns:host matched %d connections", len(got))
+	}
+}
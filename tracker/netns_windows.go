@@ -0,0 +1,10 @@
+//go:build windows
+
+package tracker
+
+import "errors"
+
+// EnableAllNetns is Linux only; Windows has no network namespaces.
+func EnableAllNetns() error {
+	return errors.New("-all-netns is only supported on Linux")
+}
@@ -0,0 +1,124 @@
+package tracker
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"ping-tracker/policy"
+)
+
+// DefaultNotifyRate is how many notifications an hour are sent when not
+// told otherwise.
+const DefaultNotifyRate = 60
+
+// EventNotify is the event of a notification that could not be delivered,
+// or of the rate limit starting and stopping to drop them.
+const EventNotify = "notify"
+
+// Notification is an alert raised or cleared, as sent on by a Notifier.
+type Notification struct {
+	Event string    // EventAlertRaised or EventAlertCleared
+	Time  time.Time // of the scan that raised or cleared it
+	Alert Alert
+	// Conn is a copy of the connection alerted on as of the scan; nil for
+	// an app's alert, or when the connection closed.
+	Conn *Connection
+}
+
+// Notifier sends notifications on, e.g. by mail or to a webhook. Notify
+// is called from the scan loop, so implementations must queue n and
+// return without blocking, and report failed deliveries with
+// NotifyFailed.
+type Notifier interface {
+	Notify(n Notification)
+}
+
+// notifiers hands the alerts to the Notifiers, at most perHour an hour
+// across all of them. It has its own lock: failures are reported from
+// the notifiers' goroutines.
+type notifiers struct {
+	sinks   []Notifier
+	perHour int
+
+	mu        sync.Mutex
+	sent      []time.Time // notifications passed in the last hour, oldest first
+	limiting  bool        // the last notification was dropped
+	dropped   uint64
+	failures  uint64
+	lastErr   string
+	lastErrAt time.Time
+}
+
+// SetNotifiers sends every alert raised or cleared to each of sinks, at
+// most perHour notifications an hour in all (DefaultNotifyRate when 0).
+// Must be called before Start.
+func (t *Tracker) SetNotifiers(perHour int, sinks ...Notifier) {
+	if perHour <= 0 {
+		perHour = DefaultNotifyRate
+	}
+	t.notify.sinks, t.notify.perHour = sinks, perHour
+}
+
+// notifyAlert sends an alert raised or cleared to the notifiers, unless
+// the rate limit is reached or the policy rules them out. c is the
+// connection alerted on, or nil. Called from the scan loop.
+func (t *Tracker) notifyAlert(now time.Time, event string, a Alert, c *Connection) {
+	s := &t.notify
+	if len(s.sinks) == 0 || t.policy.Check(policy.Notifications) != policy.Allow {
+		return
+	}
+	s.mu.Lock()
+	i := 0
+	for i < len(s.sent) && now.Sub(s.sent[i]) >= time.Hour {
+		i++
+	}
+	s.sent = s.sent[i:]
+	if len(s.sent) >= s.perHour {
+		s.dropped++
+		first := !s.limiting
+		s.limiting = true
+		s.mu.Unlock()
+		if first {
+			t.emit(now, SeverityWarn, EventNotify, "state", "rate_limited", "limit", strconv.Itoa(s.perHour)+"/h")
+		}
+		return
+	}
+	s.sent = append(s.sent, now)
+	resumed := s.limiting
+	s.limiting = false
+	s.mu.Unlock()
+	if resumed {
+		t.emit(now, SeverityInfo, EventNotify, "state", "resumed")
+	}
+
+	n := Notification{Event: event, Time: now, Alert: a}
+	if c != nil {
+		cp := *c
+		n.Conn = &cp
+	}
+	for _, sink := range s.sinks {
+		sink.Notify(n)
+	}
+}
+
+// NotifyFailed records a notification that sink could not deliver, for
+// Health and the event log. It is safe for concurrent use.
+func (t *Tracker) NotifyFailed(sink string, err error) {
+	now := time.Now()
+	s := &t.notify
+	s.mu.Lock()
+	s.failures++
+	s.lastErr, s.lastErrAt = sink+": "+err.Error(), now
+	s.mu.Unlock()
+	t.emit(now, SeverityWarn, EventNotify, "sink", sink, "error", err.Error())
+}
+
+// health fills in the notification counters.
+func (s *notifiers) health(h *Health) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.NotifyDropped = s.dropped
+	h.NotifyFailures = s.failures
+	h.NotifyLastError, h.NotifyLastFailure = s.lastErr, s.lastErrAt
+}
@@ -0,0 +1,166 @@
+package tracker
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/policy"
+)
+
+// sinkRecorder is a Notifier keeping what it was sent.
+type sinkRecorder struct {
+	mu  sync.Mutex
+	got []Notification
+}
+
+func (s *sinkRecorder) Notify(n Notification) {
+	s.mu.Lock()
+	s.got = append(s.got, n)
+	s.mu.Unlock()
+}
+
+// apps returns the app of every notification, in order.
+func (s *sinkRecorder) apps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var apps []string
+	for _, n := range s.got {
+		apps = append(apps, n.Alert.AppName)
+	}
+	return apps
+}
+
+// TestNotifyRateLimit checks that the cap is shared by the sinks, that
+// the notifications past it are counted and the drop logged once, and
+// that sending resumes as the hour moves on.
+func TestNotifyRateLimit(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	rec := &eventRecorder{}
+	tr.SetEventSink(rec)
+	a, b := &sinkRecorder{}, &sinkRecorder{}
+	tr.SetNotifiers(3, a, b)
+	base := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i := range 6 {
+		tr.notifyAlert(base.Add(time.Duration(i)*time.Minute), EventAlertRaised, Alert{AppName: strconv.Itoa(i)}, nil)
+	}
+	want := []string{"0", "1", "2"}
+	if !slices.Equal(a.apps(), want) || !slices.Equal(b.apps(), want) {
+		t.Fatalf("sent %q and %q, want %q to both", a.apps(), b.apps(), want)
+	}
+	if h := tr.Health(); h.NotifyDropped != 3 {
+		t.Errorf("%d dropped, want 3", h.NotifyDropped)
+	}
+
+	// An hour after the first, one slot is free again.
+	tr.notifyAlert(base.Add(time.Hour), EventAlertCleared, Alert{AppName: "6"}, nil)
+	tr.notifyAlert(base.Add(time.Hour), EventAlertCleared, Alert{AppName: "7"}, nil)
+	if got := a.apps(); !slices.Equal(got, []string{"0", "1", "2", "6"}) {
+		t.Errorf("sent %q after the hour", got)
+	}
+	if got, want := rec.lines(EventNotify), []string{
+		"notify state=rate_limited limit=3/h",
+		"notify state=resumed",
+		"notify state=rate_limited limit=3/h",
+	}; !slices.Equal(got, want) {
+		t.Errorf("events %q, want %q", got, want)
+	}
+	if h := tr.Health(); h.NotifyDropped != 4 {
+		t.Errorf("%d dropped, want 4", h.NotifyDropped)
+	}
+}
+
+func TestNotifyPolicy(t *testing.T) {
+	for _, mode := range []policy.Mode{policy.Normal, policy.DryRun, policy.ReadOnly} {
+		tr := NewTracker(time.Second, false)
+		tr.SetPolicy(mode)
+		sink := &sinkRecorder{}
+		tr.SetNotifiers(0, sink)
+		tr.notifyAlert(time.Now(), EventAlertRaised, Alert{AppName: "game"}, nil)
+		if sent, want := len(sink.apps()), 1; mode == policy.ReadOnly && sent != 0 || mode != policy.ReadOnly && sent != want {
+			t.Errorf("%s: %d sent", mode, sent)
+		}
+	}
+}
+
+// TestNotifyScan raises and clears a threshold alert on an IPv6
+// connection through scans, checking what the sink gets.
+func TestNotifyScan(t *testing.T) {
+	src := &fakeSource{}
+	src.set(Connection{AppName: "game", PID: 100, Protocol: "tcp6", State: StateEstablished, Direction: Outbound,
+		LocalAddr: "2001:db8::2", LocalPort: 40000, RemoteAddr: "2606:4700::6810:85e5", RemotePort: 27015})
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetAlertRule(AlertRule{PingThreshold: 100 * time.Millisecond})
+	sink := &sinkRecorder{}
+	tr.SetNotifiers(0, sink)
+	// Without probes, the ping set between scans stays.
+	setPing := func(d time.Duration) {
+		tr.mu.Lock()
+		for _, c := range tr.connections {
+			c.Ping = d
+		}
+		tr.mu.Unlock()
+	}
+	tr.scan()
+	setPing(200 * time.Millisecond)
+	tr.scan()
+	setPing(10 * time.Millisecond)
+	tr.scan()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.got) != 2 {
+		t.Fatalf("%d notifications, want a raise and a clear", len(sink.got))
+	}
+	raised, cleared := sink.got[0], sink.got[1]
+	if raised.Event != EventAlertRaised || cleared.Event != EventAlertCleared || raised.Alert.Key != cleared.Alert.Key {
+		t.Errorf("events %s %s, keys %s %s", raised.Event, cleared.Event, raised.Alert.Key, cleared.Alert.Key)
+	}
+	if a := raised.Alert; a.Remote != "[2606:4700::6810:85e5]:27015" || a.Metric != MetricPing || a.Threshold != 100 {
+		t.Errorf("alert %+v", a)
+	}
+	if raised.Conn == nil || raised.Conn.RemoteAddr != "2606:4700::6810:85e5" {
+		t.Errorf("connection %+v", raised.Conn)
+	}
+}
+
+// TestNotifyConnCopy checks that a sink gets a copy of the connection,
+// not the scan's own.
+func TestNotifyConnCopy(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	sink := &sinkRecorder{}
+	tr.SetNotifiers(0, sink)
+	c := fakeConn("game", "203.0.113.5", 27015)
+	tr.notifyAlert(time.Now(), EventAlertRaised, Alert{AppName: "game"}, &c)
+	c.AppName = "changed"
+	if got := sink.got[0].Conn; got == &c || got.AppName != "game" {
+		t.Errorf("sink shares the connection: %+v", got)
+	}
+}
+
+func TestNotifyFailed(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	rec := &eventRecorder{}
+	tr.SetEventSink(rec)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr.NotifyFailed("webhook", errors.New("https://hooks.example.com: 500 Internal Server Error"))
+		}()
+	}
+	wg.Wait()
+	h := tr.Health()
+	if h.NotifyFailures != 4 || h.NotifyLastError != "webhook: https://hooks.example.com: 500 Internal Server Error" || h.NotifyLastFailure.IsZero() {
+		t.Errorf("health %d %q %s", h.NotifyFailures, h.NotifyLastError, h.NotifyLastFailure)
+	}
+	lines := rec.lines(EventNotify)
+	if len(lines) != 4 || lines[0] != "notify sink=webhook error=https://hooks.example.com: 500 Internal Server Error" {
+		t.Errorf("events %q", lines)
+	}
+}
@@ -0,0 +1,158 @@
+package tracker
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	// outageProbes is how many probes in a row must fail before a host
+	// counts as unreachable: one lost probe is not an outage.
+	outageProbes = 2
+	// DefaultOutageAlert is how long a host is unreachable before the
+	// outage is logged as an alert.
+	DefaultOutageAlert = time.Minute
+	// maxOutageEvents bounds the session's outage log.
+	maxOutageEvents = 100
+)
+
+// ParseOutageAlert parses the unreachable_alert setting: "" is the
+// default, "0" turns outage alerts off.
+func ParseOutageAlert(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultOutageAlert, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("unreachable_alert: %q is not a duration", s)
+	}
+	return d, nil
+}
+
+// OutageEvent is a host outage passing the alert threshold, or ending
+// after it did.
+type OutageEvent struct {
+	Time  time.Time
+	Addr  string
+	Since time.Time // when the probes started failing
+	Ended bool      // the host answered again
+}
+
+// Duration is how long the host had been unreachable at e.Time.
+func (e OutageEvent) Duration() time.Duration {
+	return e.Time.Sub(e.Since)
+}
+
+// outage is the probe failure streak of one remote host.
+type outage struct {
+	failures int       // failed probes in a row
+	since    time.Time // when the first of them finished
+	alerted  bool      // logged as passing the alert threshold
+}
+
+// probe records one probe outcome. It returns the outage a success ended,
+// if it had been alerted on.
+func (o *outage) probe(failed bool, now time.Time) (ended outage, ok bool) {
+	if failed {
+		if o.failures == 0 {
+			o.since = now
+		}
+		o.failures++
+		return outage{}, false
+	}
+	ended, ok = *o, o.alerted
+	*o = outage{}
+	return ended, ok
+}
+
+// unreachableSince is when the probes started failing, or zero while the
+// host answers.
+func (o *outage) unreachableSince() time.Time {
+	if o.failures < outageProbes {
+		return time.Time{}
+	}
+	return o.since
+}
+
+// due reports whether the outage has just passed threshold, and marks it
+// alerted; a zero threshold never alerts.
+func (o *outage) due(threshold time.Duration, now time.Time) bool {
+	since := o.unreachableSince()
+	if o.alerted || threshold <= 0 || since.IsZero() || now.Sub(since) < threshold {
+		return false
+	}
+	o.alerted = true
+	return true
+}
+
+// UnreachableFor is how long the remote has been unreachable as of now,
+// or zero while it answers.
+func (c *Connection) UnreachableFor(now time.Time) time.Duration {
+	if c.UnreachableSince.IsZero() {
+		return 0
+	}
+	return max(0, now.Sub(c.UnreachableSince))
+}
+
+// noteProbe feeds a probe outcome to addr's outage state and logs the end
+// of an outage that was alerted on. Caller must hold the tracker lock.
+func (t *Tracker) noteProbe(addr string, failed bool, now time.Time) time.Time {
+	s := t.hostSamples(addr, now)
+	if o, ok := s.outage.probe(failed, now); ok {
+		t.logOutage(OutageEvent{Time: now, Addr: addr, Since: o.since, Ended: true})
+	}
+	return s.outage.unreachableSince()
+}
+
+// checkOutages logs the outages that passed the alert threshold since the
+// last scan and stamps every connection with its remote's outage. Caller
+// must hold the tracker lock.
+func (t *Tracker) checkOutages(now time.Time) {
+	for _, addr := range slices.Sorted(maps.Keys(t.samples)) {
+		o := &t.samples[addr].outage
+		if o.due(t.outageAlert, now) {
+			t.logOutage(OutageEvent{Time: now, Addr: addr, Since: o.since})
+		}
+	}
+	for _, c := range t.connections {
+		c.UnreachableSince = time.Time{}
+		if s := t.samples[c.RemoteAddr]; s != nil {
+			c.UnreachableSince = s.outage.unreachableSince()
+		}
+	}
+}
+
+// logOutage appends e to the outage log. Caller must hold the lock.
+func (t *Tracker) logOutage(e OutageEvent) {
+	d := e.Duration().Round(time.Second).String()
+	if e.Ended {
+		t.emit(e.Time, SeverityInfo, EventReachable, "remote", e.Addr, "outage", d)
+	} else {
+		t.emit(e.Time, SeverityCrit, EventUnreachable, "remote", e.Addr,
+			"since", e.Since.Format(time.RFC3339), "for", d)
+		t.session.outages++
+	}
+	t.outageLog = append(t.outageLog, e)
+	if over := len(t.outageLog) - maxOutageEvents; over > 0 {
+		t.outageLog = append([]OutageEvent(nil), t.outageLog[over:]...)
+	}
+}
+
+// OutageEvents returns this session's outage alerts and recoveries, oldest
+// first.
+func (t *Tracker) OutageEvents() []OutageEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]OutageEvent(nil), t.outageLog...)
+}
+
+// SetOutageAlert sets how long a host must be unreachable before the
+// outage is logged; 0 turns outage alerts off. It is safe to call while
+// the tracker is running.
+func (t *Tracker) SetOutageAlert(d time.Duration) {
+	t.mu.Lock()
+	t.outageAlert = d
+	t.mu.Unlock()
+}
@@ -0,0 +1,247 @@
+package tracker
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseOutageAlert(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", DefaultOutageAlert, true},
+		{"0", 0, true},
+		{"90s", 90 * time.Second, true},
+		{"-1m", 0, false},
+		{"soon", 0, false},
+	} {
+		got, err := ParseOutageAlert(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: %s, %v", tt.in, got, err)
+		}
+	}
+}
+
+// TestOutageScript feeds scripted probe outcomes, x failed and . answered,
+// ten seconds apart, and checks after each one since when the host is
+// unreachable, as the offset of that probe ("-" for reachable), and
+// whether an answer ended an alerted outage.
+func TestOutageScript(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, probes string
+		since        []string
+		ended        string // index of the probe that ended an alerted outage, if any
+	}{
+		{"one lost probe is no outage", "x.", []string{"-", "-"}, ""},
+		{"two in a row are", "xxx.", []string{"-", "0s", "0s", "-"}, ""},
+		{"flapping never adds up", "x.x.x.x.", []string{"-", "-", "-", "-", "-", "-", "-", "-"}, ""},
+		{"a new streak starts over", "xx.xx", []string{"-", "0s", "-", "-", "30s"}, ""},
+		{"alerted outage ends", "xxxxxxxxx.", []string{"-", "0s", "0s", "0s", "0s", "0s", "0s", "0s", "0s", "-"}, "9"},
+	}
+	for _, tt := range tests {
+		var o outage
+		ended := ""
+		for i, p := range tt.probes {
+			now := start.Add(time.Duration(i) * 10 * time.Second)
+			if e, ok := o.probe(p == 'x', now); ok {
+				ended = strconv.Itoa(i)
+				if !e.since.Equal(start) {
+					t.Errorf("%s: ended outage began %s", tt.name, e.since.Sub(start))
+				}
+			}
+			got := "-"
+			if s := o.unreachableSince(); !s.IsZero() {
+				got = s.Sub(start).String()
+			}
+			if got != tt.since[i] {
+				t.Errorf("%s: after probe %d unreachable since %s, want %s", tt.name, i, got, tt.since[i])
+			}
+			o.due(time.Minute, now)
+		}
+		if ended != tt.ended {
+			t.Errorf("%s: ended at probe %q, want %q", tt.name, ended, tt.ended)
+		}
+	}
+}
+
+func TestOutageDue(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var o outage
+	o.probe(true, start)
+	if o.due(time.Minute, start.Add(time.Hour)) {
+		t.Error("one failed probe came due")
+	}
+	o.probe(true, start.Add(10*time.Second))
+	if o.due(time.Minute, start.Add(59*time.Second)) {
+		t.Error("due before the threshold")
+	}
+	if !o.due(time.Minute, start.Add(time.Minute)) {
+		t.Error("not due at the threshold")
+	}
+	if o.due(time.Minute, start.Add(2*time.Minute)) {
+		t.Error("due twice for one outage")
+	}
+	var off outage
+	off.probe(true, start)
+	off.probe(true, start)
+	if off.due(0, start.Add(time.Hour)) {
+		t.Error("a zero threshold came due")
+	}
+}
+
+// eventRecorder is an EventSink keeping what it is given.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) LogEvent(e Event) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+// lines renders the events of kind as "kind k=v ...".
+func (r *eventRecorder) lines(kinds ...string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, e := range r.events {
+		for _, k := range kinds {
+			if e.Kind != k {
+				continue
+			}
+			s := e.Kind
+			for _, f := range e.Fields {
+				s += " " + f.Key + "=" + f.Value
+			}
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// TestOutageTracker runs an outage through the tracker: it is keyed by
+// host so it outlives the socket, alerts once however many scans pass,
+// and its end is logged with its length.
+func TestOutageTracker(t *testing.T) {
+	src := &fakeSource{}
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	rec := &eventRecorder{}
+	tr.SetEventSink(rec)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	tr.SetClock(func() time.Time { return now })
+
+	first := fakeConn("game", "192.0.2.1", 27015)
+	src.set(first, fakeConn("web", "192.0.2.2", 443))
+	tr.scan()
+	probe := func(remote string, lost bool) {
+		t.Helper()
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		for _, c := range tr.connections {
+			if c.RemoteAddr != remote {
+				continue
+			}
+			if lost {
+				tr.recordProbe(c, 0, 100, nil, now)
+			} else {
+				tr.recordProbe(c, 20*time.Millisecond, 0, nil, now)
+			}
+			return
+		}
+		t.Fatalf("no connection to %s", remote)
+	}
+	since := func(remote string) time.Duration {
+		t.Helper()
+		for _, c := range tr.Snapshot() {
+			if c.RemoteAddr == remote {
+				if c.UnreachableSince.IsZero() {
+					return -1
+				}
+				return c.UnreachableFor(now)
+			}
+		}
+		t.Fatalf("no connection to %s", remote)
+		return 0
+	}
+
+	// The game server stops answering; the web one flaps.
+	for i := range 12 {
+		now = start.Add(time.Duration(i+1) * 10 * time.Second)
+		probe("192.0.2.1", true)
+		probe("192.0.2.2", i%2 == 0)
+		if i == 5 {
+			// The game reconnects from a new socket mid-outage.
+			second := first
+			second.LocalPort++
+			src.set(second, fakeConn("web", "192.0.2.2", 443))
+		}
+		tr.scan()
+	}
+	if d := since("192.0.2.1"); d != 110*time.Second {
+		t.Errorf("game down for %s, want 1m50s", d)
+	}
+	if d := since("192.0.2.2"); d != -1 {
+		t.Errorf("flapping host down for %s", d)
+	}
+	if got := rec.lines(EventUnreachable); len(got) != 1 || got[0] != "unreachable remote=192.0.2.1 since=2026-03-01T12:00:10Z for=1m0s" {
+		t.Errorf("unreachable events %q", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	probe("192.0.2.1", false)
+	tr.scan()
+	if d := since("192.0.2.1"); d != -1 {
+		t.Errorf("still down %s after answering", d)
+	}
+	if got := rec.lines(EventReachable); len(got) != 1 || got[0] != "reachable remote=192.0.2.1 outage=2m0s" {
+		t.Errorf("reachable events %q", got)
+	}
+	events := tr.OutageEvents()
+	if len(events) != 2 || events[0].Ended || !events[1].Ended || events[1].Duration() != 2*time.Minute {
+		t.Errorf("outage log %+v", events)
+	}
+	if s := tr.Session(); s.Outages != 1 {
+		t.Errorf("session counted %d outages", s.Outages)
+	}
+
+	// Below the threshold, or with alerts off, an outage is shown but not
+	// logged.
+	tr.SetOutageAlert(0)
+	for range 20 {
+		now = now.Add(10 * time.Second)
+		probe("192.0.2.1", true)
+		tr.scan()
+	}
+	if d := since("192.0.2.1"); d != 190*time.Second {
+		t.Errorf("second outage %s, want 3m10s", d)
+	}
+	now = now.Add(10 * time.Second)
+	probe("192.0.2.1", false)
+	tr.scan()
+	if n := len(tr.OutageEvents()); n != 2 {
+		t.Errorf("%d outage events with alerts off", n)
+	}
+}
+
+func TestOutageLogBound(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr.mu.Lock()
+	for i := range maxOutageEvents + 5 {
+		tr.logOutage(OutageEvent{Time: start.Add(time.Duration(i) * time.Second), Addr: "192.0.2.1", Since: start})
+	}
+	tr.mu.Unlock()
+	events := tr.OutageEvents()
+	if len(events) != maxOutageEvents || !events[0].Time.Equal(start.Add(5*time.Second)) {
+		t.Errorf("%d events from %s", len(events), events[0].Time.Sub(start))
+	}
+}
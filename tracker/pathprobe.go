@@ -0,0 +1,204 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PathProbeTimeout bounds a whole path-quality probe.
+const PathProbeTimeout = 5 * time.Second
+
+// pathProbeSizes are the ICMP echo payload sizes tried with DF set. 1472 is
+// the largest that fits a 1500-byte Ethernet MTU (20 IP + 8 ICMP header).
+var pathProbeSizes = []int{64, 576, 1000, 1280, 1400, 1472}
+
+const (
+	idleConnects    = 5 // sequential connects for the idle RTT
+	loadParallelism = 8 // concurrent connect loops generating load
+	echoesPerSize   = 3
+	icmpHeaderBytes = 28 // IPv4 + ICMP headers added to the payload
+)
+
+// errNoICMP means DF-flagged echo requests cannot be sent from here (no
+// privilege, IPv6, or an unsupported platform); only the TCP part runs.
+var errNoICMP = errors.New("ICMP echo with DF unavailable")
+
+// pathEcho sends one DF echo request for the size test; tests replace it.
+var pathEcho = echoDF
+
+// ErrProbeBudget is the error of a path probe refused because today's
+// probe budget is used up (see SetProbeBudget).
+var ErrProbeBudget = errors.New("today's probe budget is used up")
+
+// SizeResult is the outcome of the echo requests of one payload size.
+type SizeResult struct {
+	Size int // ICMP payload bytes
+	Sent int
+	Lost int
+	RTT  time.Duration // mean of the replies; 0 if none came back
+}
+
+// Loss is the percentage of echo requests of this size that went unanswered.
+func (s SizeResult) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(s.Sent) * 100
+}
+
+// PathQuality is the result of an on-demand path probe to one remote host.
+type PathQuality struct {
+	Addr      string
+	Port      int
+	At        time.Time
+	IdleRTT   time.Duration // median TCP connect time with nothing else running
+	LoadedRTT time.Duration // median TCP connect time during the parallel burst
+	Sizes     []SizeResult  // empty when ICMP was unavailable
+	PMTU      int           // largest packet (headers included) that got a reply; 0 if unknown
+	TCPErr    string        // why the RTT tests found nothing, if they did not
+	ICMPErr   string        // why the size test was skipped, if it was
+	Err       error         // the probe failed or was cancelled
+}
+
+// Bloat is how much latency grew under load (bufferbloat); 0 if unknown.
+func (p PathQuality) Bloat() time.Duration {
+	if p.IdleRTT == 0 || p.LoadedRTT == 0 {
+		return 0
+	}
+	return p.LoadedRTT - p.IdleRTT
+}
+
+// ProbePath measures path quality to addr: idle TCP connect RTT against
+// port, connect RTT while loadParallelism connect loops run, and with ICMP
+// available which echo payload sizes get through with DF set. It never
+// runs longer than PathProbeTimeout and stops early when ctx is cancelled.
+// Unlike MeasurePing it probes loopback too, as it is only run on request.
+func ProbePath(ctx context.Context, addr string, port int) PathQuality {
+	ctx, cancel := context.WithTimeout(ctx, PathProbeTimeout)
+	defer cancel()
+
+	p := PathQuality{Addr: addr, Port: port, At: time.Now()}
+	if !probeMeter.allowed() {
+		p.Err = ErrProbeBudget
+		return p
+	}
+	target := net.JoinHostPort(addr, itoa(port))
+
+	// Phase budgets: idle and loaded RTT get a second each, the size test the rest.
+	idleCtx, idleCancel := context.WithTimeout(ctx, time.Second)
+	p.IdleRTT = median(connectLoop(idleCtx, target, idleConnects))
+	idleCancel()
+	if err := ctx.Err(); err != nil {
+		p.Err = err
+		return p
+	}
+	if p.IdleRTT == 0 {
+		// Nothing listens on port (e.g. an inbound client's ephemeral
+		// port); the ICMP size test may still work.
+		p.TCPErr = "no TCP connect to port " + itoa(port) + " succeeded"
+	} else {
+		loadCtx, loadCancel := context.WithTimeout(ctx, time.Second)
+		p.LoadedRTT = loadedRTT(loadCtx, target)
+		loadCancel()
+		if err := ctx.Err(); err != nil {
+			p.Err = err
+			return p
+		}
+	}
+
+	p.Sizes, p.PMTU = sizeTest(ctx, addr)
+	if len(p.Sizes) == 0 {
+		p.ICMPErr = errNoICMP.Error()
+	}
+	if err := ctx.Err(); err != nil && errors.Is(err, context.Canceled) {
+		p.Err = err
+	}
+	return p
+}
+
+// connectLoop times up to n sequential TCP connects to target.
+func connectLoop(ctx context.Context, target string, n int) []time.Duration {
+	var rtts []time.Duration
+	for i := 0; i < n && ctx.Err() == nil && probeMeter.allowed(); i++ {
+		start := time.Now()
+		conn, err := dialProbe(ctx, "tcp", target, 0)
+		if err != nil {
+			continue
+		}
+		rtts = append(rtts, time.Since(start))
+		conn.Close()
+	}
+	return rtts
+}
+
+// loadedRTT runs loadParallelism connect loops until ctx ends and returns
+// the median connect time observed while they overlapped.
+func loadedRTT(ctx context.Context, target string) time.Duration {
+	var mu sync.Mutex
+	var all []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < loadParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtts := connectLoop(ctx, target, 1<<30)
+			mu.Lock()
+			all = append(all, rtts...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return median(all)
+}
+
+// sizeTest sends echoesPerSize DF echo requests per size in pathProbeSizes.
+// It returns nothing when ICMP is unavailable. Sizes above one that got no
+// reply at all are still tried, since a blackhole can hit only some sizes.
+func sizeTest(ctx context.Context, addr string) ([]SizeResult, int) {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() == nil {
+		return nil, 0
+	}
+	var results []SizeResult
+	pmtu := 0
+	for _, size := range pathProbeSizes {
+		r := SizeResult{Size: size}
+		var total time.Duration
+		for i := 0; i < echoesPerSize && ctx.Err() == nil && probeMeter.allowed(); i++ {
+			rtt, err := pathEcho(ctx, ip.To4(), size)
+			if errors.Is(err, errNoICMP) {
+				return nil, 0
+			}
+			probeMeter.add(echoTraffic(size, err == nil))
+			r.Sent++
+			if err != nil {
+				r.Lost++
+				continue
+			}
+			total += rtt
+		}
+		if r.Sent == 0 {
+			break
+		}
+		if got := r.Sent - r.Lost; got > 0 {
+			r.RTT = total / time.Duration(got)
+			pmtu = size + icmpHeaderBytes
+		}
+		results = append(results, r)
+	}
+	return results, pmtu
+}
+
+// median returns the middle value of ds, or 0 for none.
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	s := append([]time.Duration(nil), ds...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)/2]
+}
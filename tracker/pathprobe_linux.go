@@ -0,0 +1,89 @@
+//go:build linux
+
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// echoTimeout is how long one echo request waits for its reply.
+const echoTimeout = 400 * time.Millisecond
+
+var echoSeq atomic.Uint32
+
+// echoDF sends one ICMP echo request with size payload bytes and the DF bit
+// set, and waits for the matching reply. It needs a raw socket (root).
+func echoDF(ctx context.Context, ip net.IP, size int) (time.Duration, error) {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return 0, errNoICMP
+	}
+	defer conn.Close()
+
+	// IP_PMTUDISC_PROBE sets DF but ignores the cached path MTU, so sizes
+	// above a previously learned PMTU are still sent and can be measured.
+	raw, err := conn.(*net.IPConn).SyscallConn()
+	if err != nil {
+		return 0, errNoICMP
+	}
+	var sockErr error
+	raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	})
+	if sockErr != nil {
+		return 0, errNoICMP
+	}
+
+	id := uint16(os.Getpid())
+	seq := uint16(echoSeq.Add(1))
+	msg := make([]byte, 8+size)
+	msg[0] = 8 // echo request
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+
+	deadline := time.Now().Add(echoTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	start := time.Now()
+	if _, err := conn.WriteTo(msg, &net.IPAddr{IP: ip}); err != nil {
+		return 0, err // EMSGSIZE when size exceeds the local interface MTU
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		if n < 8 || buf[0] != 0 || !from.(*net.IPAddr).IP.Equal(ip) {
+			continue // not an echo reply from the target
+		}
+		if binary.BigEndian.Uint16(buf[4:]) == id && binary.BigEndian.Uint16(buf[6:]) == seq {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// icmpChecksum is the RFC 1071 Internet checksum of b.
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
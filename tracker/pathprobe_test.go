@@ -0,0 +1,143 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoListener is a local TCP fixture that accepts and closes connections.
+func echoListener(t *testing.T) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// fakeEcho answers DF echo requests up to mtu bytes (headers included)
+// with rtt and drops larger ones, like a path with that MTU.
+func fakeEcho(t *testing.T, mtu int, rtt time.Duration) *[]int {
+	var sent []int
+	old := pathEcho
+	pathEcho = func(ctx context.Context, ip net.IP, size int) (time.Duration, error) {
+		sent = append(sent, size)
+		if size+icmpHeaderBytes > mtu {
+			return 0, errors.New("timeout")
+		}
+		return rtt, nil
+	}
+	t.Cleanup(func() { pathEcho = old })
+	return &sent
+}
+
+func TestProbePathTCP(t *testing.T) {
+	fakeEcho(t, 1500, time.Millisecond)
+	addr, port := echoListener(t)
+	p := ProbePath(context.Background(), addr, port)
+	if p.Err != nil || p.TCPErr != "" {
+		t.Fatalf("probe failed: %v %s", p.Err, p.TCPErr)
+	}
+	if p.IdleRTT <= 0 || p.LoadedRTT <= 0 {
+		t.Fatalf("idle %v, loaded %v", p.IdleRTT, p.LoadedRTT)
+	}
+	if p.Bloat() != p.LoadedRTT-p.IdleRTT {
+		t.Errorf("bloat %v", p.Bloat())
+	}
+	if p.PMTU != 1500 || len(p.Sizes) != len(pathProbeSizes) {
+		t.Errorf("PMTU %d over %d sizes", p.PMTU, len(p.Sizes))
+	}
+}
+
+func TestProbePathClosedPort(t *testing.T) {
+	fakeEcho(t, 1500, time.Millisecond)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	closed := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	p := ProbePath(context.Background(), "127.0.0.1", closed)
+	if p.TCPErr == "" || p.IdleRTT != 0 || p.LoadedRTT != 0 || p.Bloat() != 0 {
+		t.Fatalf("closed port %d: %+v", closed, p)
+	}
+	if len(p.Sizes) == 0 {
+		t.Error("size test skipped after the TCP part failed")
+	}
+}
+
+func TestProbePathCancel(t *testing.T) {
+	fakeEcho(t, 1500, time.Millisecond)
+	addr, port := echoListener(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(200*time.Millisecond, cancel) // during the load phase
+	start := time.Now()
+	p := ProbePath(ctx, addr, port)
+	if !errors.Is(p.Err, context.Canceled) {
+		t.Fatalf("error %v, want context.Canceled", p.Err)
+	}
+	if d := time.Since(start); d > 700*time.Millisecond {
+		t.Fatalf("cancelled probe took %v", d)
+	}
+}
+
+func TestSizeTest(t *testing.T) {
+	ctx := context.Background()
+
+	sent := fakeEcho(t, 1280+icmpHeaderBytes, 3*time.Millisecond)
+	sizes, pmtu := sizeTest(ctx, "192.0.2.1")
+	if pmtu != 1280+icmpHeaderBytes {
+		t.Errorf("PMTU %d, want %d", pmtu, 1280+icmpHeaderBytes)
+	}
+	// Sizes above the first lost one are still tried.
+	if len(sizes) != len(pathProbeSizes) || len(*sent) != len(pathProbeSizes)*echoesPerSize {
+		t.Fatalf("%d sizes, %d echoes", len(sizes), len(*sent))
+	}
+	for _, s := range sizes {
+		wantLoss := 0.0
+		if s.Size > 1280 {
+			wantLoss = 100
+		}
+		if s.Loss() != wantLoss || s.Sent != echoesPerSize {
+			t.Errorf("size %d: loss %v of %d", s.Size, s.Loss(), s.Sent)
+		}
+		if wantLoss == 0 && s.RTT != 3*time.Millisecond {
+			t.Errorf("size %d: rtt %v", s.Size, s.RTT)
+		}
+	}
+
+	// No ICMP, or an address the size test cannot use, skips it.
+	pathEcho = func(context.Context, net.IP, int) (time.Duration, error) { return 0, errNoICMP }
+	if sizes, pmtu := sizeTest(ctx, "192.0.2.1"); sizes != nil || pmtu != 0 {
+		t.Errorf("without ICMP: %v %d", sizes, pmtu)
+	}
+	if sizes, _ := sizeTest(ctx, "2001:db8::1"); sizes != nil {
+		t.Errorf("IPv6: %v", sizes)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	if median(nil) != 0 {
+		t.Error("median of nothing")
+	}
+	ds := []time.Duration{5, 1, 3}
+	if m := median(ds); m != 3 || ds[0] != 5 {
+		t.Errorf("median %v of %v", m, ds)
+	}
+}
@@ -0,0 +1,85 @@
+//go:build windows
+
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+)
+
+var (
+	procIcmpCreateFile  = modiphlpapi.NewProc("IcmpCreateFile")
+	procIcmpCloseHandle = modiphlpapi.NewProc("IcmpCloseHandle")
+	procIcmpSendEcho    = modiphlpapi.NewProc("IcmpSendEcho")
+)
+
+const (
+	ipFlagDF         = 0x2
+	ipSuccess        = 0
+	ipPacketTooBig   = 11009
+	echoTimeoutMilli = 400
+)
+
+// ipOptionInformation is IP_OPTION_INFORMATION.
+type ipOptionInformation struct {
+	TTL         uint8
+	TOS         uint8
+	Flags       uint8
+	OptionsSize uint8
+	OptionsData uintptr
+}
+
+// icmpEchoReply is the start of ICMP_ECHO_REPLY; only these fields are read.
+type icmpEchoReply struct {
+	Address       uint32
+	Status        uint32
+	RoundTripTime uint32
+	DataSize      uint16
+	Reserved      uint16
+	Data          uintptr
+	Options       ipOptionInformation
+}
+
+// echoDF sends one ICMP echo request with size payload bytes and the DF
+// flag set through IcmpSendEcho, which needs no elevation. The call blocks
+// for at most echoTimeoutMilli, so ctx is only checked before sending.
+func echoDF(ctx context.Context, ip net.IP, size int) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	handle, _, _ := procIcmpCreateFile.Call()
+	if handle == 0 || handle == ^uintptr(0) {
+		return 0, errNoICMP
+	}
+	defer procIcmpCloseHandle.Call(handle)
+
+	req := make([]byte, size)
+	opts := ipOptionInformation{TTL: 128, Flags: ipFlagDF}
+	reply := make([]byte, int(unsafe.Sizeof(icmpEchoReply{}))+size+8+64)
+	n, _, _ := procIcmpSendEcho.Call(
+		handle,
+		uintptr(binary.LittleEndian.Uint32(ip)), // IPAddr is in network byte order in memory
+		uintptr(unsafe.Pointer(&req[0])),
+		uintptr(size),
+		uintptr(unsafe.Pointer(&opts)),
+		uintptr(unsafe.Pointer(&reply[0])),
+		uintptr(len(reply)),
+		echoTimeoutMilli,
+	)
+	if n == 0 {
+		return 0, fmt.Errorf("no reply")
+	}
+	r := (*icmpEchoReply)(unsafe.Pointer(&reply[0]))
+	switch r.Status {
+	case ipSuccess:
+		return time.Duration(r.RoundTripTime) * time.Millisecond, nil
+	case ipPacketTooBig:
+		return 0, fmt.Errorf("packet too big")
+	default:
+		return 0, fmt.Errorf("echo status %d", r.Status)
+	}
+}
@@ -0,0 +1,94 @@
+package tracker
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// perfHistory is how many scans PerfStats keeps.
+const perfHistory = 100
+
+// ScanStats is the timing breakdown of one scan cycle.
+type ScanStats struct {
+	Start     time.Time
+	Enumerate time.Duration // reading the socket tables, including Resolve
+	Resolve   time.Duration // mapping sockets to PIDs and names (/proc, or process names on Windows)
+	Diff      time.Duration // reconciling with the previous state
+	Ping      time.Duration // the whole ping cycle
+	Total     time.Duration
+	Conns     int
+	Allocs    uint64        // heap allocations during the cycle
+	Skipped   int           // ticks dropped because the cycle outlasted the interval
+	Gap       time.Duration // a suspend or clock step before this scan (see ClockEvent)
+	Opens     int           // processes opened for their names since the last scan (Windows)
+}
+
+// lastResolve holds the PID resolution time of the most recent scan, set by
+// scanners that have a separate resolution phase.
+var lastResolve atomic.Int64
+
+// perfRing is a fixed-size ring of scan stats, plus running totals since
+// the start for Health.
+type perfRing struct {
+	mu    sync.Mutex
+	stats [perfHistory]ScanStats
+	next  int
+	count int
+
+	scans       uint64
+	buckets     [len(ScanDurationBuckets)]uint64 // per bucket, not cumulative
+	durationSum time.Duration
+	errors      uint64
+	lastErr     string
+	overruns    uint64 // cycles longer than the interval
+	skipped     uint64
+	probes      [len(probeOutcomes)]uint64
+}
+
+func (r *perfRing) add(s ScanStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats[r.next] = s
+	r.next = (r.next + 1) % perfHistory
+	if r.count < perfHistory {
+		r.count++
+	}
+	r.scans++
+	r.durationSum += s.Total
+	if s.Skipped > 0 {
+		r.overruns++
+		r.skipped += uint64(s.Skipped)
+	}
+	for i, le := range ScanDurationBuckets {
+		if s.Total <= le {
+			r.buckets[i]++
+			break
+		}
+	}
+}
+
+// list returns the stored stats, oldest first.
+func (r *perfRing) list() []ScanStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ScanStats, 0, r.count)
+	start := (r.next - r.count + perfHistory) % perfHistory
+	for i := 0; i < r.count; i++ {
+		out = append(out, r.stats[(start+i)%perfHistory])
+	}
+	return out
+}
+
+// mallocs returns the cumulative heap allocation count.
+func mallocs() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Mallocs
+}
+
+// PerfStats returns timing stats for the most recent scans, oldest first.
+func (t *Tracker) PerfStats() []ScanStats {
+	return t.perf.list()
+}
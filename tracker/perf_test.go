@@ -0,0 +1,79 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPerfRingWraps(t *testing.T) {
+	var r perfRing
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := r.list(); len(got) != 0 {
+		t.Fatalf("empty ring lists %d", len(got))
+	}
+	for i := range perfHistory + 30 {
+		r.add(ScanStats{Start: t0.Add(time.Duration(i) * time.Second), Conns: i, Total: time.Millisecond})
+	}
+	got := r.list()
+	if len(got) != perfHistory {
+		t.Fatalf("%d stats kept, want %d", len(got), perfHistory)
+	}
+	for i, s := range got {
+		if s.Conns != 30+i {
+			t.Fatalf("stat %d is scan %d, want %d (oldest first)", i, s.Conns, 30+i)
+		}
+	}
+	if h := r.health(); h.Scans != perfHistory+30 || h.DurationSum != (perfHistory+30)*time.Millisecond {
+		t.Fatalf("totals: %d scans, %v", h.Scans, h.DurationSum)
+	}
+}
+
+// slowSource takes a fixed time to scan and to answer each ping.
+type slowSource struct {
+	fakeSource
+	scanDelay, pingDelay time.Duration
+}
+
+func (s *slowSource) Scan() ([]*Connection, error) {
+	time.Sleep(s.scanDelay)
+	return s.fakeSource.Scan()
+}
+
+func (s *slowSource) Ping(addr string, port int) (time.Duration, float64) {
+	time.Sleep(s.pingDelay)
+	return time.Millisecond, 0
+}
+
+func TestScanPhaseAccounting(t *testing.T) {
+	src := &slowSource{scanDelay: 20 * time.Millisecond, pingDelay: 30 * time.Millisecond}
+	src.set(fakeConn("web", "192.0.2.1", 443), fakeConn("db", "192.0.2.2", 5432))
+	tr := NewTracker(time.Hour, true)
+	tr.SetSource(src)
+	tr.scan()
+
+	stats := tr.PerfStats()
+	if len(stats) != 1 {
+		t.Fatalf("%d stats after one scan", len(stats))
+	}
+	s := stats[0]
+	if s.Conns != 2 {
+		t.Errorf("conns %d, want 2", s.Conns)
+	}
+	if s.Enumerate < src.scanDelay {
+		t.Errorf("enumerate %v, shorter than the scan", s.Enumerate)
+	}
+	if s.Ping < src.pingDelay {
+		t.Errorf("ping %v, shorter than a probe", s.Ping)
+	}
+	if sum := s.Enumerate + s.Diff + s.Ping; s.Total < sum {
+		t.Errorf("total %v below its phases (%v)", s.Total, sum)
+	}
+
+	// Without pinging the ping phase is empty.
+	tr = NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+	if s := tr.PerfStats()[0]; s.Ping != 0 {
+		t.Errorf("ping phase %v with pings off", s.Ping)
+	}
+}
@@ -1,6 +1,7 @@
 package tracker
 
 import (
+	"context"
 	"net"
 	"time"
 )
@@ -14,6 +15,12 @@ const (
 // a TCP connect. This works without raw sockets (no root needed for ICMP
 // alternative). Returns average RTT and loss percentage.
 func MeasurePing(addr string, port int) (rtt time.Duration, loss float64) {
+	return measurePing("tcp", addr, port)
+}
+
+// measurePing is MeasurePing dialing on network: "tcp", or "tcp4" or
+// "tcp6" to pin the address family.
+func measurePing(network, addr string, port int) (rtt time.Duration, loss float64) {
 	if addr == "0.0.0.0" || addr == "::" || addr == "127.0.0.1" || addr == "::1" {
 		return 0, 0
 	}
@@ -25,7 +32,7 @@ func MeasurePing(addr string, port int) (rtt time.Duration, loss float64) {
 
 	for i := 0; i < pingCount; i++ {
 		start := time.Now()
-		conn, err := net.DialTimeout("tcp", target, pingTimeout)
+		conn, err := dialProbe(context.Background(), network, target, pingTimeout)
 		elapsed := time.Since(start)
 
 		if err == nil {
@@ -0,0 +1,106 @@
+package tracker
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ping-tracker/policy"
+)
+
+// TestTriggersPolicy fires a trigger rule under each mode with a fake
+// command runner: read-only never calls it, dry-run logs the exact
+// command line instead.
+func TestTriggersPolicy(t *testing.T) {
+	rule, err := ParseTrigger("block", "game", TriggerOpened, "iptables -A OUTPUT -d {remote_addr} -p tcp --dport {remote_port} -j DROP", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "iptables -A OUTPUT -d 203.0.113.5 -p tcp --dport 27015 -j DROP"
+	for _, mode := range []policy.Mode{policy.Normal, policy.DryRun, policy.ReadOnly} {
+		t.Run(mode.String(), func(t *testing.T) {
+			tr := NewTracker(time.Second, false)
+			tr.SetPolicy(mode)
+			rec := &eventRecorder{}
+			tr.SetEventSink(rec)
+			tr.SetTriggers([]TriggerRule{rule})
+			var calls atomic.Int32
+			var ran []string
+			done := make(chan struct{}, 1)
+			tr.triggers.run = func(argv []string, _ time.Duration) (int, string, error) {
+				calls.Add(1)
+				ran = argv
+				done <- struct{}{}
+				return 0, "", nil
+			}
+			// The first scan only sets the baseline: the game opens after it.
+			src := &fakeSource{}
+			src.set(fakeConn("browser", "192.0.2.1", 443))
+			tr.SetSource(src)
+			tr.scan()
+			src.set(fakeConn("browser", "192.0.2.1", 443), fakeConn("game", "203.0.113.5", 27015))
+			tr.scan()
+
+			st := tr.Triggers()[0]
+			switch mode {
+			case policy.Normal:
+				<-done
+				if policy.Argv(ran) != want {
+					t.Errorf("ran %q", ran)
+				}
+			case policy.DryRun:
+				if st.Runs != 1 || st.Result != "dry run: "+want {
+					t.Errorf("runs %d, result %q", st.Runs, st.Result)
+				}
+				lines := rec.lines(EventTrigger)
+				if !slices.Equal(lines, []string{"trigger rule=block event=opened app=game remote=203.0.113.5:27015 dry_run=" + want}) {
+					t.Errorf("events %q", lines)
+				}
+			case policy.ReadOnly:
+				if st.Runs != 0 || st.Result != "" || len(rec.lines(EventTrigger)) != 0 {
+					t.Errorf("runs %d, result %q, events %q", st.Runs, st.Result, rec.lines(EventTrigger))
+				}
+			}
+			if mode != policy.Normal && calls.Load() != 0 {
+				t.Errorf("the runner was called %d times", calls.Load())
+			}
+		})
+	}
+}
+
+// TestServiceChecksPolicy checks that read-only sends no service check.
+// A check is traffic, which dry-run lets through.
+func TestServiceChecksPolicy(t *testing.T) {
+	def, err := ParseServiceCheck("web", CheckHTTPS, 443, "", "", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []policy.Mode{policy.Normal, policy.DryRun, policy.ReadOnly} {
+		t.Run(mode.String(), func(t *testing.T) {
+			tr := NewTracker(time.Second, false)
+			tr.SetPolicy(mode)
+			tr.SetServiceChecks([]ServiceCheckDef{def})
+			var calls atomic.Int32
+			done := make(chan struct{}, 1)
+			tr.checks.check = func(ServiceCheckDef, string, int, bool, string) ServiceCheck {
+				calls.Add(1)
+				done <- struct{}{}
+				return ServiceCheck{OK: true}
+			}
+			src := &fakeSource{}
+			src.set(fakeConn("browser", "192.0.2.1", 443))
+			tr.SetSource(src)
+			tr.scan()
+			tr.runServiceChecks(time.Now())
+			if mode != policy.ReadOnly {
+				<-done
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			if calls.Load() != 0 {
+				t.Errorf("%d checks ran", calls.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package tracker
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// PortStat is the traffic of one app on one service port.
+type PortStat struct {
+	Port      int
+	Protocol  string    // as DisplayProtocol, e.g. "tcp"
+	Direction Direction // Outbound: the remote's port; Inbound: our listening port
+	Service   string    // the port's well-known service or "quic"; "" when unknown
+	Conns     int
+	TxRate    float64
+	RxRate    float64
+	Ping      time.Duration // mean of the measured pings; 0 when none was
+	Pinged    int           // connections with a ping measurement
+}
+
+// PortDistribution groups app's connections by the service port they talk
+// to: the remote port of outbound connections and the local port of
+// inbound ones, so an app accepting many clients counts on its own port
+// rather than on their ephemeral ones. Listeners are left out. The result
+// is sorted by connection count, then by total rate, then by port.
+func PortDistribution(conns []*Connection, app string) []PortStat {
+	type key struct {
+		port  int
+		proto string
+		dir   Direction
+	}
+	index := make(map[key]int)
+	var stats []PortStat
+	var pingSum []time.Duration
+	for _, c := range conns {
+		if c.AppName != app || c.IsListener() {
+			continue
+		}
+		k := key{c.RemotePort, c.DisplayProtocol(), c.Direction}
+		if c.Direction == Inbound {
+			k.port = c.LocalPort
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(stats)
+			index[k] = i
+			stats = append(stats, PortStat{Port: k.port, Protocol: k.proto, Direction: k.dir, Service: portService(k.proto, k.port)})
+			pingSum = append(pingSum, 0)
+		}
+		s := &stats[i]
+		s.Conns++
+		s.TxRate += c.TxRate
+		s.RxRate += c.RxRate
+		if c.Ping > 0 {
+			pingSum[i] += c.Ping
+			s.Pinged++
+		}
+	}
+	for i := range stats {
+		if stats[i].Pinged > 0 {
+			stats[i].Ping = pingSum[i] / time.Duration(stats[i].Pinged)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Conns != b.Conns {
+			return a.Conns > b.Conns
+		}
+		if ra, rb := a.TxRate+a.RxRate, b.TxRate+b.RxRate; ra != rb {
+			return ra > rb
+		}
+		return a.Port < b.Port
+	})
+	return stats
+}
+
+// portService is the service of one port, with ClassifyService's rules.
+func portService(proto string, port int) string {
+	if strings.HasPrefix(proto, "udp") && port == 443 {
+		return ServiceQUIC
+	}
+	return ServiceName(port)
+}
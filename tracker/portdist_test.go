@@ -0,0 +1,64 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPortDistribution(t *testing.T) {
+	conn := func(app, proto string, dir Direction, local, remote int, ping time.Duration, tx float64) *Connection {
+		return &Connection{AppName: app, Protocol: proto, State: StateEstablished, Direction: dir,
+			LocalAddr: "10.0.0.2", LocalPort: local, RemoteAddr: "192.0.2.1", RemotePort: remote, Ping: ping, TxRate: tx}
+	}
+	conns := []*Connection{
+		conn("web", "tcp", Outbound, 40001, 443, 10*time.Millisecond, 100),
+		conn("web", "tcp", Outbound, 40002, 443, 30*time.Millisecond, 50),
+		conn("web", "tcp", Outbound, 40003, 443, 0, 0), // not pinged: not in the mean
+		conn("web", "udp", Outbound, 40004, 443, 0, 500),
+		conn("web", "tcp", Outbound, 40005, 80, 0, 10),
+		conn("web", "tcp", Outbound, 40006, 22, 0, 10),
+		// Clients on our port count once, on that port.
+		conn("web", "tcp", Inbound, 8080, 51000, 5*time.Millisecond, 0),
+		conn("web", "tcp", Inbound, 8080, 51001, 0, 0),
+		conn("web", "tcp", Inbound, 8080, 51002, 0, 0),
+		// IPv4-mapped tcp6 counts with tcp.
+		{AppName: "web", Protocol: "tcp6", V4Mapped: true, State: StateEstablished, Direction: Outbound, LocalPort: 40007, RemotePort: 80},
+		{AppName: "web", Protocol: "tcp", State: StateListening, LocalPort: 8080},
+		conn("other", "tcp", Outbound, 40008, 443, 0, 0),
+	}
+	got := PortDistribution(conns, "web")
+	want := []PortStat{
+		{Port: 443, Protocol: "tcp", Direction: Outbound, Service: "https", Conns: 3, TxRate: 150, Ping: 20 * time.Millisecond, Pinged: 2},
+		{Port: 8080, Protocol: "tcp", Direction: Inbound, Service: "http-alt", Conns: 3, Ping: 5 * time.Millisecond, Pinged: 1},
+		{Port: 80, Protocol: "tcp", Direction: Outbound, Service: "http", Conns: 2, TxRate: 10},
+		{Port: 443, Protocol: "udp", Direction: Outbound, Service: ServiceQUIC, Conns: 1, TxRate: 500},
+		{Port: 22, Protocol: "tcp", Direction: Outbound, Service: "ssh", Conns: 1, TxRate: 10},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d ports: %+v", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := PortDistribution(conns, "nobody"); len(got) != 0 {
+		t.Errorf("unknown app: %+v", got)
+	}
+}
+
+// TestPortDistributionTies orders equal counts and rates by port.
+func TestPortDistributionTies(t *testing.T) {
+	var conns []*Connection
+	for _, port := range []int{9000, 53, 7000} {
+		conns = append(conns, &Connection{AppName: "a", Protocol: "udp", Direction: Outbound, RemotePort: port})
+	}
+	got := PortDistribution(conns, "a")
+	if len(got) != 3 || got[0].Port != 53 || got[1].Port != 7000 || got[2].Port != 9000 {
+		t.Errorf("%+v", got)
+	}
+	if got[0].Service != "dns" || got[1].Service != "" {
+		t.Errorf("services %q %q", got[0].Service, got[1].Service)
+	}
+}
@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PortRange is an inclusive range of port numbers.
+type PortRange struct {
+	Low, High int
+}
+
+// Contains reports whether port lies in the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Low && port <= r.High
+}
+
+// ParsePortRange parses "32768-60999".
+func ParsePortRange(s string) (PortRange, error) {
+	lo, hi, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return PortRange{}, fmt.Errorf("invalid port range %q (want low-high)", s)
+	}
+	l, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	h, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || l < 1 || h > 65535 || l > h {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{Low: l, High: h}, nil
+}
+
+// parseLocalPortRange parses net.ipv4.ip_local_port_range, "32768\t60999".
+func parseLocalPortRange(s string) (PortRange, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return ParsePortRange(s)
+	}
+	return ParsePortRange(fields[0] + "-" + fields[1])
+}
+
+// parseDynamicPorts parses `netsh int ipv4 show dynamicport tcp`:
+//
+//	Start Port      : 49152
+//	Number of Ports : 16384
+func parseDynamicPorts(out string) (PortRange, error) {
+	var start, count int
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Start Port":
+			start = n
+		case "Number of Ports":
+			count = n
+		}
+	}
+	if start == 0 || count == 0 {
+		return PortRange{}, fmt.Errorf("could not parse netsh dynamic port output")
+	}
+	return PortRange{Low: start, High: start + count - 1}, nil
+}
+
+// defaultEphemeralRange is the IANA dynamic range, used if the OS cannot be queried.
+var defaultEphemeralRange = PortRange{Low: 49152, High: 65535}
+
+var (
+	ephemeralOnce     sync.Once
+	ephemeralRange    PortRange
+	ephemeralOverride *PortRange
+)
+
+// SetEphemeralRange overrides the OS-reported ephemeral port range.
+// Must be called before the range is first used.
+func SetEphemeralRange(r PortRange) {
+	ephemeralOverride = &r
+}
+
+// EphemeralRange returns the OS ephemeral port range, detected once and cached.
+func EphemeralRange() PortRange {
+	ephemeralOnce.Do(func() {
+		if ephemeralOverride != nil {
+			ephemeralRange = *ephemeralOverride
+			return
+		}
+		r, err := detectEphemeralRange()
+		if err != nil {
+			r = defaultEphemeralRange
+		}
+		ephemeralRange = r
+	})
+	return ephemeralRange
+}
+
+// IsEphemeralPort reports whether port is in the OS ephemeral range, i.e. most
+// likely an auto-assigned client port rather than a service.
+func IsEphemeralPort(port int) bool {
+	return EphemeralRange().Contains(port)
+}
+
+// serviceNames annotates well-known service ports.
+var serviceNames = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 53: "dns", 67: "dhcp", 68: "dhcp",
+	80: "http", 110: "pop3", 123: "ntp", 143: "imap", 443: "https", 465: "smtps",
+	587: "submission", 853: "dot", 993: "imaps", 995: "pop3s", 1433: "mssql",
+	1883: "mqtt", 3306: "mysql", 3389: "rdp", 5353: "mdns", 5432: "postgres",
+	5672: "amqp", 6379: "redis", 8080: "http-alt", 8443: "https-alt", 9090: "prometheus",
+	9200: "elasticsearch", 11211: "memcached", 27017: "mongodb",
+}
+
+// ServiceName returns the well-known service for port, or "".
+func ServiceName(port int) string {
+	return serviceNames[port]
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package tracker
+
+import "os"
+
+// detectEphemeralRange reads net.ipv4.ip_local_port_range.
+func detectEphemeralRange() (PortRange, error) {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return PortRange{}, err
+	}
+	return parseLocalPortRange(string(data))
+}
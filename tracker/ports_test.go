@@ -0,0 +1,65 @@
+package tracker
+
+import "testing"
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want PortRange
+		ok   bool
+	}{
+		{"32768-60999", PortRange{32768, 60999}, true},
+		{" 1024 - 2048 ", PortRange{1024, 2048}, true},
+		{"80-80", PortRange{80, 80}, true},
+		{"60999-32768", PortRange{}, false},
+		{"0-100", PortRange{}, false},
+		{"1-65536", PortRange{}, false},
+		{"32768", PortRange{}, false},
+		{"a-b", PortRange{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePortRange(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParsePortRange(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestParseLocalPortRange(t *testing.T) {
+	for in, want := range map[string]PortRange{
+		"32768\t60999\n": {32768, 60999},
+		"1024 65000":     {1024, 65000},
+		"10000-20000":    {10000, 20000},
+	} {
+		if got, err := parseLocalPortRange(in); err != nil || got != want {
+			t.Errorf("%q: %v, %v", in, got, err)
+		}
+	}
+	if _, err := parseLocalPortRange("32768"); err == nil {
+		t.Error("a single number parsed")
+	}
+}
+
+func TestParseDynamicPorts(t *testing.T) {
+	out := "\r\nProtocol tcp Dynamic Port Range\r\n---------------------------------\r\n" +
+		"Start Port      : 10000\r\nNumber of Ports : 5000\r\n\r\n"
+	got, err := parseDynamicPorts(out)
+	if err != nil || got != (PortRange{10000, 14999}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := parseDynamicPorts("The requested operation requires elevation.\r\n"); err == nil {
+		t.Fatal("no error for unrelated output")
+	}
+}
+
+func TestPortRangeContains(t *testing.T) {
+	r := PortRange{Low: 10000, High: 14999}
+	for port, want := range map[int]bool{9999: false, 10000: true, 12345: true, 14999: true, 15000: false} {
+		if r.Contains(port) != want {
+			t.Errorf("%d: %v", port, !want)
+		}
+	}
+	if ServiceName(5432) != "postgres" || ServiceName(40000) != "" {
+		t.Error("service names")
+	}
+}
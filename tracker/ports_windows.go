@@ -0,0 +1,14 @@
+//go:build windows
+
+package tracker
+
+import "os/exec"
+
+// detectEphemeralRange asks netsh for the dynamic TCP port range.
+func detectEphemeralRange() (PortRange, error) {
+	out, err := exec.Command("netsh", "int", "ipv4", "show", "dynamicport", "tcp").Output()
+	if err != nil {
+		return PortRange{}, err
+	}
+	return parseDynamicPorts(string(out))
+}
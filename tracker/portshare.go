@@ -0,0 +1,177 @@
+package tracker
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PortShareKind classifies listeners of several processes on one port.
+type PortShareKind string
+
+const (
+	// PortReuse is the same address, family and state in every process:
+	// load sharing with SO_REUSEPORT (or SO_REUSEADDR for UDP).
+	PortReuse PortShareKind = "REUSEPORT"
+	// PortOverlap is a wildcard bind and a specific one in different
+	// processes: the specific one takes its address's traffic.
+	PortOverlap PortShareKind = "OVERLAP"
+	// PortConflict is the same address in different states, which no
+	// sharing setup produces.
+	PortConflict PortShareKind = "CONFLICT"
+)
+
+// Describe says what the kind means, for the detail view.
+func (k PortShareKind) Describe() string {
+	switch k {
+	case PortReuse:
+		return "load sharing (SO_REUSEPORT)"
+	case PortOverlap:
+		return "a wildcard bind overlaps a specific one"
+	}
+	return "one address in different states: likely misconfigured"
+}
+
+// PortShareMember is one listening socket of a PortShare.
+type PortShareMember struct {
+	PID       int
+	AppName   string
+	LocalAddr string
+	State     ConnState
+}
+
+// PortShare is a protocol and local port that listening sockets of more
+// than one process claim. Every member's Connection points to the same
+// PortShare.
+type PortShare struct {
+	Kind     PortShareKind
+	Protocol string
+	Port     int
+	Members  []PortShareMember // by PID, then address
+}
+
+// Processes is the number of distinct PIDs sharing the port.
+func (s *PortShare) Processes() int {
+	n := 0
+	for i, m := range s.Members {
+		if i == 0 || m.PID != s.Members[i-1].PID {
+			n++
+		}
+	}
+	return n
+}
+
+// Apps returns the distinct app names, sorted.
+func (s *PortShare) Apps() []string {
+	apps := make([]string, 0, len(s.Members))
+	for _, m := range s.Members {
+		apps = append(apps, m.AppName)
+	}
+	slices.Sort(apps)
+	return slices.Compact(apps)
+}
+
+// DetectPortShares finds the listeners claimed by more than one process:
+// the same protocol, address and port in several PIDs, or a wildcard and
+// a specific address on one port in different PIDs. Protocols are compared
+// with their family, so a dual-stack pair (tcp on 0.0.0.0 and tcp6 on ::)
+// is never flagged, nor are specific addresses that differ. Sockets with
+// no known owner are left out, and network namespaces are kept apart. It
+// returns the share of each member, by connection key.
+func DetectPortShares(conns []*Connection) map[string]*PortShare {
+	groups := make(map[string][]*Connection)
+	var order []string
+	for _, c := range conns {
+		if !c.IsListener() || c.PID == 0 {
+			continue
+		}
+		id := c.Host + "|" + c.Namespace + "|" + c.Protocol + "|" + strconv.Itoa(c.LocalPort)
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], c)
+	}
+	shares := make(map[string]*PortShare)
+	for _, id := range order {
+		group := groups[id]
+		kind, ok := classifyPortShare(group)
+		if !ok {
+			continue
+		}
+		s := &PortShare{Kind: kind, Protocol: group[0].Protocol, Port: group[0].LocalPort}
+		for _, c := range group {
+			s.Members = append(s.Members, PortShareMember{PID: c.PID, AppName: c.AppName, LocalAddr: c.LocalAddr, State: c.State})
+			shares[c.Key()] = s
+		}
+		slices.SortFunc(s.Members, func(a, b PortShareMember) int {
+			if a.PID != b.PID {
+				return a.PID - b.PID
+			}
+			return strings.Compare(a.LocalAddr, b.LocalAddr)
+		})
+	}
+	return shares
+}
+
+// classifyPortShare judges the listeners of one protocol and port. ok is
+// false when no two processes claim the same traffic.
+func classifyPortShare(group []*Connection) (kind PortShareKind, ok bool) {
+	byAddr := make(map[string][]*Connection)
+	for _, c := range group {
+		byAddr[c.LocalAddr] = append(byAddr[c.LocalAddr], c)
+	}
+	shared, mixed, overlap := false, false, false
+	for _, socks := range byAddr {
+		if !manyPIDs(socks) {
+			continue
+		}
+		shared = true
+		for _, c := range socks[1:] {
+			if c.State != socks[0].State {
+				mixed = true
+			}
+		}
+	}
+	for wild, ws := range byAddr {
+		if !isWildcard(wild) {
+			continue
+		}
+		for addr, socks := range byAddr {
+			if addr != wild && manyPIDs(append(slices.Clone(ws), socks...)) {
+				overlap = true
+			}
+		}
+	}
+	switch {
+	case mixed:
+		return PortConflict, true
+	case overlap:
+		return PortOverlap, true
+	case shared:
+		return PortReuse, true
+	}
+	return "", false
+}
+
+// manyPIDs reports whether socks belong to more than one process.
+func manyPIDs(socks []*Connection) bool {
+	for _, c := range socks[1:] {
+		if c.PID != socks[0].PID {
+			return true
+		}
+	}
+	return false
+}
+
+// markPortShares points every listener at its PortShare, or nil. Caller
+// must hold the lock.
+func (t *Tracker) markPortShares() {
+	conns := make([]*Connection, 0, len(t.connections))
+	for _, c := range t.connections {
+		conns = append(conns, c)
+	}
+	shares := DetectPortShares(conns)
+	for key, c := range t.connections {
+		c.PortShare = shares[key]
+	}
+}
@@ -0,0 +1,174 @@
+package tracker
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// listener is a socket of pid listening on addr:port.
+func listener(app string, pid int, proto, addr string, port int) *Connection {
+	state := StateListening
+	if proto == "udp" || proto == "udp6" {
+		state = StateUnconnected
+	}
+	return &Connection{AppName: app, PID: pid, Protocol: proto, State: state, Direction: Inbound, LocalAddr: addr, LocalPort: port}
+}
+
+func TestDetectPortShares(t *testing.T) {
+	tests := []struct {
+		name  string
+		conns []*Connection
+		want  PortShareKind // "" for no share
+		procs int
+	}{
+		{"reuseport pair", []*Connection{
+			listener("nginx", 10, "tcp", "0.0.0.0", 80),
+			listener("nginx", 11, "tcp", "0.0.0.0", 80),
+		}, PortReuse, 2},
+		{"reuseport workers", []*Connection{
+			listener("envoy", 20, "tcp6", "::", 443),
+			listener("envoy", 21, "tcp6", "::", 443),
+			listener("envoy", 22, "tcp6", "::", 443),
+			listener("envoy", 23, "tcp6", "::", 443),
+		}, PortReuse, 4},
+		{"reuseport udp", []*Connection{
+			listener("dns", 30, "udp", "127.0.0.53", 53),
+			listener("dns", 31, "udp", "127.0.0.53", 53),
+		}, PortReuse, 2},
+		{"wildcard over specific", []*Connection{
+			listener("web", 40, "tcp", "0.0.0.0", 8080),
+			listener("dev", 41, "tcp", "127.0.0.1", 8080),
+		}, PortOverlap, 2},
+		{"v6 wildcard over specific", []*Connection{
+			listener("web", 40, "tcp6", "::", 8080),
+			listener("dev", 41, "tcp6", "::1", 8080),
+		}, PortOverlap, 2},
+		{"overlap beats sharing", []*Connection{
+			listener("web", 40, "tcp", "0.0.0.0", 8080),
+			listener("web", 41, "tcp", "0.0.0.0", 8080),
+			listener("dev", 42, "tcp", "127.0.0.1", 8080),
+		}, PortOverlap, 3},
+		{"one address, different states", []*Connection{
+			listener("a", 50, "udp", "0.0.0.0", 5353),
+			{AppName: "b", PID: 51, Protocol: "udp", State: StateListening, LocalAddr: "0.0.0.0", LocalPort: 5353},
+		}, PortConflict, 2},
+		{"dual-stack pair", []*Connection{
+			listener("sshd", 60, "tcp", "0.0.0.0", 22),
+			listener("other", 61, "tcp6", "::", 22),
+		}, "", 0},
+		{"distinct specific addresses", []*Connection{
+			listener("a", 70, "tcp", "10.0.0.2", 9000),
+			listener("b", 71, "tcp", "192.168.1.2", 9000),
+		}, "", 0},
+		{"one process, wildcard and specific", []*Connection{
+			listener("a", 80, "tcp", "0.0.0.0", 9100),
+			listener("a", 80, "tcp", "127.0.0.1", 9100),
+		}, "", 0},
+		{"tcp and udp", []*Connection{
+			listener("a", 90, "tcp", "0.0.0.0", 53),
+			listener("b", 91, "udp", "0.0.0.0", 53),
+		}, "", 0},
+		{"unknown owner", []*Connection{
+			listener("a", 100, "tcp", "0.0.0.0", 25),
+			listener("", 0, "tcp", "0.0.0.0", 25),
+		}, "", 0},
+		{"namespaces kept apart", []*Connection{
+			listener("a", 110, "tcp", "0.0.0.0", 8443),
+			{AppName: "b", PID: 111, Protocol: "tcp", State: StateListening, LocalAddr: "0.0.0.0", LocalPort: 8443, Namespace: "blue"},
+		}, "", 0},
+		{"hosts kept apart", []*Connection{
+			listener("a", 120, "tcp", "0.0.0.0", 8443),
+			{AppName: "b", PID: 121, Protocol: "tcp", State: StateListening, LocalAddr: "0.0.0.0", LocalPort: 8443, Host: "db1"},
+		}, "", 0},
+		{"established sockets", []*Connection{
+			{AppName: "a", PID: 130, Protocol: "tcp", State: StateEstablished, LocalAddr: "0.0.0.0", LocalPort: 7000},
+			{AppName: "b", PID: 131, Protocol: "tcp", State: StateEstablished, LocalAddr: "0.0.0.0", LocalPort: 7000},
+		}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := DetectPortShares(tt.conns)
+			if tt.want == "" {
+				if len(shares) != 0 {
+					t.Fatalf("flagged: %v", shares)
+				}
+				return
+			}
+			if len(shares) != len(tt.conns) {
+				t.Fatalf("%d of %d sockets flagged", len(shares), len(tt.conns))
+			}
+			s := shares[tt.conns[0].Key()]
+			for _, c := range tt.conns {
+				if shares[c.Key()] != s {
+					t.Fatalf("%s does not point to the group's share", c.Key())
+				}
+			}
+			if s.Kind != tt.want || s.Processes() != tt.procs {
+				t.Errorf("%s with %d processes, want %s with %d", s.Kind, s.Processes(), tt.want, tt.procs)
+			}
+		})
+	}
+}
+
+func TestPortShareMembers(t *testing.T) {
+	shares := DetectPortShares([]*Connection{
+		listener("worker", 12, "tcp", "0.0.0.0", 80),
+		listener("proxy", 3, "tcp", "127.0.0.1", 80),
+		listener("worker", 11, "tcp", "0.0.0.0", 80),
+		listener("proxy", 3, "tcp", "0.0.0.0", 80),
+	})
+	s := shares["3:tcp:127.0.0.1:80->:0"]
+	if s == nil {
+		t.Fatalf("no share: %v", shares)
+	}
+	var got []string
+	for _, m := range s.Members {
+		got = append(got, fmt.Sprintf("%d %s", m.PID, m.LocalAddr))
+	}
+	if want := []string{"3 0.0.0.0", "3 127.0.0.1", "11 0.0.0.0", "12 0.0.0.0"}; !slices.Equal(got, want) {
+		t.Errorf("members %q, want %q", got, want)
+	}
+	if s.Processes() != 3 {
+		t.Errorf("%d processes", s.Processes())
+	}
+	if apps := s.Apps(); !slices.Equal(apps, []string{"proxy", "worker"}) {
+		t.Errorf("apps %q", apps)
+	}
+	if s.Protocol != "tcp" || s.Port != 80 {
+		t.Errorf("share %s/%d", s.Protocol, s.Port)
+	}
+}
+
+// TestScanMarksPortShares checks that a scan points the sharing listeners
+// at their share and clears it once one of them is gone.
+func TestScanMarksPortShares(t *testing.T) {
+	a, b := *listener("nginx", 10, "tcp", "0.0.0.0", 80), *listener("nginx", 11, "tcp", "0.0.0.0", 80)
+	src := &fakeSource{}
+	src.set(a, b, fakeConn("curl", "192.0.2.1", 443))
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.scan()
+
+	shared := 0
+	for _, c := range tr.Snapshot() {
+		if c.PortShare != nil {
+			shared++
+			if c.PortShare.Kind != PortReuse {
+				t.Errorf("%s: %s", c.Key(), c.PortShare.Kind)
+			}
+		}
+	}
+	if shared != 2 {
+		t.Fatalf("%d sockets marked, want the 2 listeners", shared)
+	}
+
+	src.set(a)
+	tr.scan()
+	for _, c := range tr.Snapshot() {
+		if c.PortShare != nil {
+			t.Errorf("%s still marked after the other listener closed", c.Key())
+		}
+	}
+}
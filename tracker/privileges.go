@@ -0,0 +1,28 @@
+package tracker
+
+// Privileges is what this process may see of the machine's sockets, for
+// first-run hints.
+type Privileges struct {
+	// Elevated is set when the owners of every process's sockets can be
+	// resolved: root or CAP_SYS_PTRACE on Linux, an elevated token on
+	// Windows.
+	Elevated bool
+	// SS is set when the ss binary is on PATH (Linux), so -scanner ss can
+	// add kernel TCP info and QoS marking.
+	SS bool
+	// Sandbox is the container this process runs in and what it keeps
+	// from view (Linux).
+	Sandbox Sandbox
+}
+
+// UnresolvedOwners counts the connections whose owning process could not
+// be found, leaving out sockets that belong to no process (TIME_WAIT).
+func UnresolvedOwners(conns []*Connection) int {
+	n := 0
+	for _, c := range conns {
+		if c.Host == "" && c.PID == 0 && c.State != StateTimeWait && c.Protocol != ExternalProtocol {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,26 @@
+package tracker
+
+import (
+	"os"
+	"os/exec"
+)
+
+// capSysPtrace is the CAP_SYS_PTRACE bit, which lets /proc/<pid>/fd of
+// other users' processes be read.
+const capSysPtrace = 19
+
+// ProbePrivileges checks the effective user and capabilities, whether ss
+// is installed, and the sandbox this process runs in.
+func ProbePrivileges() Privileges {
+	_, err := exec.LookPath("ss")
+	return Privileges{
+		Elevated: os.Geteuid() == 0 || hasCapability(capSysPtrace),
+		SS:       err == nil,
+		Sandbox:  ProbeSandbox(),
+	}
+}
+
+// hasCapability reports whether bit is in this process's effective set.
+func hasCapability(bit uint) bool {
+	return effectiveCaps()&(1<<bit) != 0
+}
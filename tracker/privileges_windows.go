@@ -0,0 +1,26 @@
+package tracker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// tokenElevation is the TokenElevation information class.
+const tokenElevation = 20
+
+// ProbePrivileges checks whether the process token is elevated; without it
+// the names of other users' and protected processes cannot be read.
+func ProbePrivileges() Privileges {
+	proc, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return Privileges{}
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(proc, syscall.TOKEN_QUERY, &token); err != nil {
+		return Privileges{}
+	}
+	defer token.Close()
+	var elevated, n uint32
+	err = syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevated)), uint32(unsafe.Sizeof(elevated)), &n)
+	return Privileges{Elevated: err == nil && elevated != 0}
+}
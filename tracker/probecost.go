@@ -0,0 +1,273 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estimated wire sizes of probe packets. Probe traffic is accounted by
+// estimate, not captured: what a probe costs follows from what it did.
+const (
+	ipv4HeaderBytes = 20
+	ipv6HeaderBytes = 40
+	tcpSynBytes     = 40 // TCP header with the SYN options: MSS, SACK, timestamps, window scale
+	tcpSegBytes     = 32 // TCP header with the timestamp option
+)
+
+// ProbeTraffic is the bytes probes sent and received, IP headers included.
+type ProbeTraffic struct {
+	Sent     uint64 `json:"sent_bytes"`
+	Received uint64 `json:"received_bytes"`
+}
+
+// Total is the bytes in both directions.
+func (p ProbeTraffic) Total() uint64 {
+	return p.Sent + p.Received
+}
+
+func (p *ProbeTraffic) add(q ProbeTraffic) {
+	p.Sent += q.Sent
+	p.Received += q.Received
+}
+
+func ipHeaderBytes(v6 bool) uint64 {
+	if v6 {
+		return ipv6HeaderBytes
+	}
+	return ipv4HeaderBytes
+}
+
+// tcpConnectTraffic estimates one probe connect. A connect that succeeds
+// sends SYN, ACK, and FIN plus the last ACK when it is closed, and
+// receives SYN-ACK, the ACK of the FIN and the peer's FIN. One that fails
+// is counted as a SYN and one retransmission, which the 2s probe timeout
+// leaves room for; a refusal's RST is not counted.
+func tcpConnectTraffic(v6, connected bool) ProbeTraffic {
+	ip := ipHeaderBytes(v6)
+	if !connected {
+		return ProbeTraffic{Sent: 2 * (ip + tcpSynBytes)}
+	}
+	return ProbeTraffic{
+		Sent:     ip + tcpSynBytes + 3*(ip+tcpSegBytes),
+		Received: ip + tcpSynBytes + 2*(ip+tcpSegBytes),
+	}
+}
+
+// socksTraffic estimates the SOCKS5 exchange that follows the connect to
+// the proxy: greeting, optional username/password, and CONNECT, each a
+// request and a reply segment.
+func socksTraffic(proxyV6, targetV6 bool, user, password string) ProbeTraffic {
+	seg := ipHeaderBytes(proxyV6) + tcpSegBytes
+	addr := uint64(4)
+	if targetV6 {
+		addr = 16
+	}
+	p := ProbeTraffic{
+		Sent:     seg + 3 + seg + 6 + addr, // greeting; CONNECT request
+		Received: seg + 2 + seg + 6 + addr, // method choice; CONNECT reply
+	}
+	if user != "" {
+		p.Sent += seg + 3 + uint64(len(user)+len(password))
+		p.Received += seg + 2
+	}
+	return p
+}
+
+// echoTraffic estimates one ICMP echo with payload bytes of data: the
+// request, and the reply if one came.
+func echoTraffic(payload int, replied bool) ProbeTraffic {
+	p := ProbeTraffic{Sent: uint64(payload + icmpHeaderBytes)}
+	if replied {
+		p.Received = p.Sent
+	}
+	return p
+}
+
+// dialProbe is the TCP connect every probe method makes (connection
+// pings, dual-stack targets, the SOCKS5 proxy and the path probe), and
+// where its traffic is accounted. timeout 0 leaves it to ctx.
+func dialProbe(ctx context.Context, network, target string, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, network, target)
+	v6 := network == "tcp6"
+	if conn != nil {
+		if a, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			v6 = a.IP.To4() == nil
+		}
+	} else if host, _, splitErr := net.SplitHostPort(target); splitErr == nil {
+		if a, parseErr := netip.ParseAddr(host); parseErr == nil {
+			v6 = a.Unmap().Is6()
+		}
+	}
+	probeMeter.add(tcpConnectTraffic(v6, err == nil))
+	return conn, err
+}
+
+// ProbeUsage is the probe traffic of this session and of the current local
+// day, and the daily budget's state.
+type ProbeUsage struct {
+	Session    ProbeTraffic `json:"session"`
+	Today      ProbeTraffic `json:"today"`
+	Day        time.Time    `json:"day"`                    // local midnight that started Today
+	Budget     uint64       `json:"budget_bytes,omitempty"` // per day, both directions; 0 = none
+	Exceeded   bool         `json:"exceeded"`
+	ExceededAt time.Time    `json:"exceeded_at,omitempty"`
+}
+
+// Remaining is what is left of today's budget; 0 without one.
+func (u ProbeUsage) Remaining() uint64 {
+	if u.Budget == 0 || u.Today.Total() >= u.Budget {
+		return 0
+	}
+	return u.Budget - u.Today.Total()
+}
+
+// meter accounts probe traffic and trips the daily budget. The day rolls
+// over at local midnight, on the first use after it.
+type meter struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	usage ProbeUsage
+}
+
+// probeMeter counts the traffic of every probe in the process.
+var probeMeter = &meter{now: time.Now}
+
+// midnight returns the local midnight starting t's day.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// rollover starts a new day once now is past the current one. Caller must
+// hold m.mu.
+func (m *meter) rollover(now time.Time) {
+	day := midnight(now)
+	if day.Equal(m.usage.Day) {
+		return
+	}
+	m.usage.Day = day
+	m.usage.Today = ProbeTraffic{}
+	m.usage.Exceeded, m.usage.ExceededAt = false, time.Time{}
+}
+
+func (m *meter) add(p ProbeTraffic) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.rollover(now)
+	m.usage.Session.add(p)
+	m.usage.Today.add(p)
+	if m.usage.Budget > 0 && !m.usage.Exceeded && m.usage.Today.Total() >= m.usage.Budget {
+		m.usage.Exceeded, m.usage.ExceededAt = true, now
+	}
+}
+
+// allowed reports whether active probes may run: there is no budget, or
+// today's is not used up.
+func (m *meter) allowed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(m.now())
+	return !m.usage.Exceeded
+}
+
+func (m *meter) snapshot() ProbeUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(m.now())
+	return m.usage
+}
+
+func (m *meter) setBudget(b uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(m.now())
+	m.usage.Budget = b
+	m.usage.Exceeded = b > 0 && m.usage.Today.Total() >= b
+	if !m.usage.Exceeded {
+		m.usage.ExceededAt = time.Time{}
+	} else if m.usage.ExceededAt.IsZero() {
+		m.usage.ExceededAt = m.now()
+	}
+}
+
+// restore adds a saved day's traffic to today's, if it is from today.
+func (m *meter) restore(saved probeTrafficState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.rollover(now)
+	if !midnight(saved.Day.In(now.Location())).Equal(m.usage.Day) {
+		return
+	}
+	m.usage.Today.add(saved.Today)
+	if m.usage.Budget > 0 && m.usage.Today.Total() >= m.usage.Budget {
+		m.usage.Exceeded = true
+		m.usage.ExceededAt = saved.ExceededAt
+		if m.usage.ExceededAt.IsZero() {
+			m.usage.ExceededAt = now
+		}
+	}
+}
+
+// probeTrafficState is the probe traffic section of the state file: the
+// current day's traffic, so a restart does not reset the budget.
+type probeTrafficState struct {
+	Day        time.Time    `json:"day"`
+	Today      ProbeTraffic `json:"today"`
+	ExceededAt time.Time    `json:"exceeded_at,omitempty"`
+}
+
+// ParseProbeBudget parses a daily probe traffic budget such as "5MB/day",
+// "500KB" or "1GB/day"; units are binary, as shown in the UI. "" or "0"
+// means no budget.
+func ParseProbeBudget(s string) (uint64, error) {
+	v := strings.TrimSpace(s)
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "/day"), "/d")
+	if v == "" {
+		return 0, nil
+	}
+	upper := strings.ToUpper(v)
+	mult := uint64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   uint64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid probe budget %q (want e.g. 5MB/day)", s)
+	}
+	return uint64(n * float64(mult)), nil
+}
+
+// SetProbeBudget caps the probe traffic per local day, in bytes both ways;
+// 0 removes the cap. Once today's traffic reaches it, no active probe runs
+// until midnight: pings, dual-stack and path probes stop, and connections
+// keep only what the scanner reports, such as the kernel's RTT. It is safe
+// to call while the tracker is running.
+func (t *Tracker) SetProbeBudget(bytes uint64) {
+	probeMeter.setBudget(bytes)
+}
+
+// ProbeUsage returns the probe traffic so far and the budget's state.
+func (t *Tracker) ProbeUsage() ProbeUsage {
+	return probeMeter.snapshot()
+}
+
+// ProbesAllowed reports whether today's probe budget leaves room for
+// active probes.
+func ProbesAllowed() bool {
+	return probeMeter.allowed()
+}
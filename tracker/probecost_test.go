@@ -0,0 +1,228 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProbeTrafficEstimates(t *testing.T) {
+	tests := []struct {
+		name string
+		got  ProbeTraffic
+		want ProbeTraffic
+	}{
+		// SYN, ACK, FIN, ACK out; SYN-ACK, ACK, FIN in.
+		{"IPv4 connect", tcpConnectTraffic(false, true), ProbeTraffic{Sent: 60 + 3*52, Received: 60 + 2*52}},
+		{"IPv6 connect", tcpConnectTraffic(true, true), ProbeTraffic{Sent: 80 + 3*72, Received: 80 + 2*72}},
+		{"IPv4 timeout", tcpConnectTraffic(false, false), ProbeTraffic{Sent: 2 * 60}},
+		{"IPv6 timeout", tcpConnectTraffic(true, false), ProbeTraffic{Sent: 2 * 80}},
+		{"SOCKS5", socksTraffic(false, false, "", ""), ProbeTraffic{Sent: 52 + 3 + 52 + 10, Received: 52 + 2 + 52 + 10}},
+		{"SOCKS5 to IPv6", socksTraffic(false, true, "", ""), ProbeTraffic{Sent: 52 + 3 + 52 + 22, Received: 52 + 2 + 52 + 22}},
+		{"SOCKS5 with login", socksTraffic(true, false, "user", "pw"), ProbeTraffic{Sent: 72 + 3 + 72 + 10 + 72 + 3 + 6, Received: 72 + 2 + 72 + 10 + 72 + 2}},
+		{"echo", echoTraffic(1400, true), ProbeTraffic{Sent: 1428, Received: 1428}},
+		{"lost echo", echoTraffic(64, false), ProbeTraffic{Sent: 92}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestDialProbe checks a probe connect is accounted as such, to a
+// listener and to a closed port.
+func TestDialProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, tt := range []struct {
+		addr      string
+		connected bool
+	}{{ln.Addr().String(), true}, {closed, false}} {
+		before := probeMeter.snapshot().Session
+		conn, err := dialProbe(context.Background(), "tcp", tt.addr, time.Second)
+		if (err == nil) != tt.connected {
+			t.Fatalf("%s: %v", tt.addr, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		after := probeMeter.snapshot().Session
+		want := tcpConnectTraffic(false, tt.connected)
+		if after.Sent-before.Sent != want.Sent || after.Received-before.Received != want.Received {
+			t.Errorf("%s: accounted %d/%d, want %+v", tt.addr, after.Sent-before.Sent, after.Received-before.Received, want)
+		}
+	}
+}
+
+// fakeMeter returns a meter on a clock the test moves.
+func fakeMeter(now *time.Time) *meter {
+	return &meter{now: func() time.Time { return *now }}
+}
+
+func TestMeterBudget(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2026, 3, 6, 22, 0, 0, 0, loc)
+	m := fakeMeter(&now)
+	m.setBudget(1000)
+
+	m.add(ProbeTraffic{Sent: 400, Received: 200})
+	if u := m.snapshot(); !m.allowed() || u.Exceeded || u.Remaining() != 400 || !u.Day.Equal(time.Date(2026, 3, 6, 0, 0, 0, 0, loc)) {
+		t.Errorf("under the budget: %+v", u)
+	}
+	now = now.Add(time.Hour)
+	trip := now
+	m.add(ProbeTraffic{Sent: 400})
+	if m.allowed() {
+		t.Error("probes allowed past the budget")
+	}
+	if u := m.snapshot(); !u.Exceeded || !u.ExceededAt.Equal(trip) || u.Remaining() != 0 {
+		t.Errorf("over the budget: %+v", u)
+	}
+	now = now.Add(30 * time.Minute)
+	m.add(ProbeTraffic{Sent: 100}) // a probe already running when it tripped
+	if u := m.snapshot(); !u.ExceededAt.Equal(trip) || u.Today.Total() != 1100 {
+		t.Errorf("late traffic: %+v", u)
+	}
+
+	// 23:59:59 is still the same day; local midnight starts a new one.
+	now = time.Date(2026, 3, 6, 23, 59, 59, 0, loc)
+	if m.allowed() {
+		t.Error("allowed before midnight")
+	}
+	now = time.Date(2026, 3, 7, 0, 0, 0, 0, loc)
+	if !m.allowed() {
+		t.Error("not allowed after midnight")
+	}
+	u := m.snapshot()
+	if u.Today != (ProbeTraffic{}) || u.Session.Total() != 1100 || !u.ExceededAt.IsZero() || !u.Day.Equal(now) {
+		t.Errorf("new day: %+v", u)
+	}
+
+	// Changing the budget applies to today's traffic at once.
+	m.add(ProbeTraffic{Sent: 500})
+	m.setBudget(400)
+	if u := m.snapshot(); !u.Exceeded || !u.ExceededAt.Equal(now) {
+		t.Errorf("lowered budget: %+v", u)
+	}
+	m.setBudget(600)
+	if u := m.snapshot(); u.Exceeded || !u.ExceededAt.IsZero() || u.Remaining() != 100 {
+		t.Errorf("raised budget: %+v", u)
+	}
+	m.setBudget(0)
+	m.add(ProbeTraffic{Sent: 1 << 30})
+	if !m.allowed() || m.snapshot().Remaining() != 0 {
+		t.Error("no budget tripped")
+	}
+}
+
+// TestMeterRestore checks a saved day counts toward today's budget after
+// a restart, and an older one does not.
+func TestMeterRestore(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2026, 3, 6, 20, 0, 0, 0, loc)
+	tripped := now.Add(-time.Hour)
+	// The saved day is read back as UTC, as from the state file.
+	roundTrip := func(s probeTrafficState) probeTrafficState {
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out probeTrafficState
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	today := roundTrip(probeTrafficState{Day: midnight(now).UTC(), Today: ProbeTraffic{Sent: 700, Received: 400}, ExceededAt: tripped})
+
+	m := fakeMeter(&now)
+	m.setBudget(1000)
+	m.add(ProbeTraffic{Sent: 50})
+	m.restore(today)
+	if u := m.snapshot(); u.Today.Total() != 1150 || u.Session.Total() != 50 || !u.Exceeded || !u.ExceededAt.Equal(tripped) {
+		t.Errorf("restored today: %+v", u)
+	}
+
+	m = fakeMeter(&now)
+	m.setBudget(1000)
+	m.restore(roundTrip(probeTrafficState{Day: midnight(now).AddDate(0, 0, -1), Today: ProbeTraffic{Sent: 5000}}))
+	if u := m.snapshot(); u.Today.Total() != 0 || u.Exceeded {
+		t.Errorf("restored yesterday: %+v", u)
+	}
+
+	// Saved under the budget, restored under a lower one: tripped now.
+	m = fakeMeter(&now)
+	m.setBudget(500)
+	m.restore(roundTrip(probeTrafficState{Day: midnight(now), Today: ProbeTraffic{Sent: 600}}))
+	if u := m.snapshot(); !u.Exceeded || !u.ExceededAt.Equal(now) {
+		t.Errorf("lower budget: %+v", u)
+	}
+}
+
+// TestProbeTrafficState saves the day's traffic through the state file and
+// restores it into a fresh meter.
+func TestProbeTrafficState(t *testing.T) {
+	old := probeMeter
+	t.Cleanup(func() { probeMeter = old })
+	now := time.Now()
+	probeMeter = fakeMeter(&now)
+	probeMeter.setBudget(1000)
+	probeMeter.add(ProbeTraffic{Sent: 900, Received: 200})
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := openTestState(t, path)
+	tr := NewTracker(time.Hour, false)
+	if err := tr.SetStateStore(s, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.saveState(now); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	probeMeter = fakeMeter(&now)
+	probeMeter.setBudget(1000)
+	if err := NewTracker(time.Hour, false).SetStateStore(openTestState(t, path), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if u := probeMeter.snapshot(); u.Today.Total() != 1100 || u.Session.Total() != 0 || !u.Exceeded || ProbesAllowed() {
+		t.Errorf("after restart: %+v", u)
+	}
+}
+
+func TestParseProbeBudget(t *testing.T) {
+	for s, want := range map[string]uint64{
+		"":          0,
+		"0":         0,
+		"5MB/day":   5 << 20,
+		"500KB":     500 << 10,
+		"1GB/d":     1 << 30,
+		"1.5 mb":    3 << 19,
+		"2048":      2048,
+		"100B/day":  100,
+		" 10MB/day": 10 << 20,
+	} {
+		if got, err := ParseProbeBudget(s); err != nil || got != want {
+			t.Errorf("%q: %d %v, want %d", s, got, err, want)
+		}
+	}
+	for _, bad := range []string{"5TB", "-1MB", "MB", "5MB/week", "lots"} {
+		if _, err := ParseProbeBudget(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package tracker
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// AddrClass says why a remote address is not probed; AddrProbeable ("")
+// means it is. The names read as "a multicast address".
+type AddrClass string
+
+const (
+	AddrProbeable     AddrClass = ""
+	AddrInvalid       AddrClass = "invalid"
+	AddrUnspecified   AddrClass = "unspecified"   // 0.0.0.0/8, ::
+	AddrLoopback      AddrClass = "loopback"      // 127/8, ::1
+	AddrMulticast     AddrClass = "multicast"     // 224/4, ff00::/8
+	AddrBroadcast     AddrClass = "broadcast"     // 255.255.255.255 and local subnet broadcasts
+	AddrLinkLocal     AddrClass = "link-local"    // fe80::/10 without a zone, which cannot be dialed
+	AddrDocumentation AddrClass = "documentation" // RFC 5737, RFC 3849, RFC 9637
+	AddrBenchmarking  AddrClass = "benchmarking"  // RFC 2544, RFC 5180
+	AddrReserved      AddrClass = "reserved"      // 240/4
+	AddrOwn           AddrClass = "local"         // an address of this machine's interfaces
+	AddrExcluded      AddrClass = "excluded"      // in the no_probe config list
+)
+
+// localAddrsRefresh is how often the local interface addresses are read
+// again, so addresses that come and go (DHCP, VPNs) are noticed.
+const localAddrsRefresh = 30 * time.Second
+
+// reservedRanges are the special-purpose ranges ClassifyAddr checks after
+// the ones netip knows about.
+var reservedRanges = []struct {
+	prefix netip.Prefix
+	class  AddrClass
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), AddrUnspecified},
+	{netip.MustParsePrefix("192.0.2.0/24"), AddrDocumentation},
+	{netip.MustParsePrefix("198.51.100.0/24"), AddrDocumentation},
+	{netip.MustParsePrefix("203.0.113.0/24"), AddrDocumentation},
+	{netip.MustParsePrefix("2001:db8::/32"), AddrDocumentation},
+	{netip.MustParsePrefix("3fff::/20"), AddrDocumentation},
+	{netip.MustParsePrefix("198.18.0.0/15"), AddrBenchmarking},
+	{netip.MustParsePrefix("2001:2::/48"), AddrBenchmarking},
+	{netip.MustParsePrefix("240.0.0.0/4"), AddrReserved},
+}
+
+// ClassifyAddr classifies a remote address by its range alone: whether a
+// TCP connect to it can reach a peer at all. IPv4-mapped IPv6 addresses are
+// classified as IPv4. It does not know the local interfaces or no_probe;
+// see probeGate for those.
+func ClassifyAddr(a netip.Addr) AddrClass {
+	a = a.Unmap()
+	switch {
+	case !a.IsValid():
+		return AddrInvalid
+	case a.IsUnspecified():
+		return AddrUnspecified
+	case a.IsLoopback():
+		return AddrLoopback
+	case a.IsMulticast():
+		return AddrMulticast
+	case a == netip.AddrFrom4([4]byte{255, 255, 255, 255}):
+		return AddrBroadcast
+	case a.Is6() && a.IsLinkLocalUnicast() && a.Zone() == "":
+		return AddrLinkLocal
+	}
+	for _, r := range reservedRanges {
+		if r.prefix.Contains(a) {
+			return r.class
+		}
+	}
+	return AddrProbeable
+}
+
+// probeGate classifies remotes before they are probed or counted in
+// per-host statistics: by range, against this machine's own and subnet
+// broadcast addresses, and against the no_probe list. Callers hold the
+// tracker lock.
+type probeGate struct {
+	excluded []netip.Prefix
+	local    map[netip.Addr]AddrClass // AddrOwn or AddrBroadcast
+	localAt  time.Time
+}
+
+// classify returns addr's class, reading the local addresses again when
+// they are older than localAddrsRefresh.
+func (g *probeGate) classify(addr string, now time.Time) AddrClass {
+	a, err := netip.ParseAddr(addr)
+	if err != nil {
+		return AddrInvalid
+	}
+	a = a.Unmap()
+	if class := ClassifyAddr(a); class != AddrProbeable {
+		return class
+	}
+	if now.Sub(g.localAt) >= localAddrsRefresh {
+		g.local, g.localAt = localAddrs(), now
+	}
+	if class, ok := g.local[a.WithZone("")]; ok {
+		return class
+	}
+	for _, p := range g.excluded {
+		if p.Contains(a) {
+			return AddrExcluded
+		}
+	}
+	return AddrProbeable
+}
+
+// localAddrs maps the addresses of the local interfaces to AddrOwn, and the
+// broadcast address of each IPv4 subnet on them to AddrBroadcast. It is
+// empty when the interfaces cannot be read.
+func localAddrs() map[netip.Addr]AddrClass {
+	local := make(map[netip.Addr]AddrClass)
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return local
+	}
+	for _, ifa := range addrs {
+		ipnet, ok := ifa.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		a, ok := netip.AddrFromSlice(ipnet.IP)
+		if !ok {
+			continue
+		}
+		a = a.Unmap()
+		local[a] = AddrOwn
+		ones, bits := ipnet.Mask.Size()
+		if a.Is4() && bits == 32 && ones < 31 {
+			b := a.As4()
+			for i, m := range net.IP(ipnet.Mask).To4() {
+				b[i] |= ^m
+			}
+			if bcast := netip.AddrFrom4(b); local[bcast] == "" {
+				local[bcast] = AddrBroadcast
+			}
+		}
+	}
+	return local
+}
+
+// ParseNoProbe parses the no_probe config list of CIDR prefixes or single
+// addresses.
+func ParseNoProbe(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("no_probe: %v", err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// SetNoProbe sets extra ranges that are never probed, besides the
+// non-routable ones. It is safe to call while the tracker is running; the
+// new list applies from the next scan.
+func (t *Tracker) SetNoProbe(prefixes []netip.Prefix) {
+	t.mu.Lock()
+	t.probeGate.excluded = prefixes
+	t.mu.Unlock()
+}
@@ -0,0 +1,135 @@
+package tracker
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want AddrClass
+	}{
+		{"8.8.8.8", AddrProbeable},
+		{"10.1.2.3", AddrProbeable},
+		{"100.64.0.1", AddrProbeable}, // CGNAT: reachable from inside
+		{"169.254.1.1", AddrProbeable},
+		{"2606:4700::1111", AddrProbeable},
+		{"fe80::1%eth0", AddrProbeable},
+		{"fd00::1", AddrProbeable},
+
+		{"0.0.0.0", AddrUnspecified},
+		{"0.1.2.3", AddrUnspecified},
+		{"::", AddrUnspecified},
+		{"127.0.0.1", AddrLoopback},
+		{"127.255.255.254", AddrLoopback},
+		{"::1", AddrLoopback},
+		{"224.0.0.251", AddrMulticast},
+		{"239.255.255.250", AddrMulticast},
+		{"ff02::fb", AddrMulticast},
+		{"255.255.255.255", AddrBroadcast},
+		{"fe80::1", AddrLinkLocal},
+		{"192.0.2.1", AddrDocumentation},
+		{"198.51.100.255", AddrDocumentation},
+		{"203.0.113.7", AddrDocumentation},
+		{"2001:db8::1", AddrDocumentation},
+		{"3fff:fff::1", AddrDocumentation},
+		{"198.18.0.1", AddrBenchmarking},
+		{"198.19.255.255", AddrBenchmarking},
+		{"2001:2::1", AddrBenchmarking},
+		{"240.0.0.1", AddrReserved},
+		{"254.255.255.255", AddrReserved},
+
+		// Mapped addresses are classified as IPv4.
+		{"::ffff:127.0.0.1", AddrLoopback},
+		{"::ffff:224.0.0.1", AddrMulticast},
+		{"::ffff:192.0.2.1", AddrDocumentation},
+		{"::ffff:8.8.8.8", AddrProbeable},
+
+		// Just outside the ranges.
+		{"198.17.255.255", AddrProbeable},
+		{"198.20.0.0", AddrProbeable},
+		{"192.0.3.0", AddrProbeable},
+		{"223.255.255.255", AddrProbeable},
+		{"2001:db9::1", AddrProbeable},
+		{"4000::1", AddrProbeable},
+	}
+	for _, tt := range tests {
+		if got := ClassifyAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if got := ClassifyAddr(netip.Addr{}); got != AddrInvalid {
+		t.Errorf("zero address: %q", got)
+	}
+}
+
+func TestProbeGate(t *testing.T) {
+	excluded, err := ParseNoProbe([]string{"10.20.0.0/16", "2001:4860::/32", "8.8.4.4", "::ffff:1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g := &probeGate{
+		excluded: excluded,
+		local: map[netip.Addr]AddrClass{
+			netip.MustParseAddr("10.0.0.2"):   AddrOwn,
+			netip.MustParseAddr("10.0.0.255"): AddrBroadcast,
+			netip.MustParseAddr("fe80::2"):    AddrOwn,
+		},
+		localAt: now,
+	}
+	tests := []struct {
+		addr string
+		want AddrClass
+	}{
+		{"10.0.0.1", AddrProbeable},
+		{"10.0.0.2", AddrOwn},
+		{"::ffff:10.0.0.2", AddrOwn},
+		{"10.0.0.255", AddrBroadcast},
+		{"fe80::2%eth0", AddrOwn},
+		{"10.20.255.1", AddrExcluded},
+		{"10.21.0.1", AddrProbeable},
+		{"2001:4860:4860::8888", AddrExcluded},
+		{"8.8.4.4", AddrExcluded},
+		{"8.8.8.8", AddrProbeable},
+		{"1.1.1.1", AddrExcluded},
+		{"127.0.0.1", AddrLoopback}, // by range before the local table
+		{"not an address", AddrInvalid},
+		{"", AddrInvalid},
+	}
+	for _, tt := range tests {
+		if got := g.classify(tt.addr, now.Add(localAddrsRefresh-time.Second)); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+
+	// The local table is read again once it is old.
+	g.classify("10.0.0.1", now.Add(localAddrsRefresh))
+	if !g.localAt.Equal(now.Add(localAddrsRefresh)) {
+		t.Errorf("local addresses read at %v", g.localAt)
+	}
+}
+
+func TestParseNoProbe(t *testing.T) {
+	got, err := ParseNoProbe([]string{"192.168.1.77/24", "2001:db8::1", "::ffff:10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("192.168.1.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("10.0.0.1/32"),
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "example.com", "10.0.0/8", ""} {
+		if _, err := ParseNoProbe([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
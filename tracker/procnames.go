@@ -0,0 +1,208 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Process names for the scanners that have to open a process to learn its
+// name (Windows). Opening every process on every scan makes some EDR and
+// antivirus products flag or throttle the scanner, so names are cached by
+// PID, new PIDs are looked up a few per scan with a short random pause
+// between opens, and the owner-module table, which names a socket's owner
+// without opening anything, is asked first.
+const (
+	// ResolvingName is the app name of a socket whose process waits for a
+	// later scan to be looked up.
+	ResolvingName = "resolving…"
+
+	// DefaultNameLookups is how many processes a scan opens at most.
+	DefaultNameLookups = 16
+
+	// nameLookupJitter bounds the random pause between two opens.
+	nameLookupJitter = 10 * time.Millisecond
+)
+
+// ProcNameStats describe the process name cache.
+type ProcNameStats struct {
+	Cached  int    // PIDs with a known name, or a failed lookup
+	Pending int    // PIDs the last scan left for a later one
+	PerScan int    // the most processes a scan opens
+	Opens   uint64 // processes opened since start
+	Modules uint64 // names taken from the owner-module table since start
+}
+
+// procNameCache holds the names of the PIDs the last scan saw. It is safe
+// for concurrent use.
+type procNameCache struct {
+	mu    sync.Mutex // held for a whole scan's lookups
+	names map[int]string
+
+	// Read without the lock, so the perf view never waits on a scan.
+	perScan atomic.Int64
+	pending atomic.Int64
+	cached  atomic.Int64
+
+	// open looks pid up by opening the process; modules names the PIDs in
+	// want from the owner-module table, without opening them.
+	open    func(pid int) (string, bool)
+	modules func(want map[int]bool) map[int]string
+	sleep   func(time.Duration)
+
+	opens       atomic.Uint64
+	moduleNames atomic.Uint64
+}
+
+func newProcNameCache(open func(int) (string, bool), modules func(map[int]bool) map[int]string) *procNameCache {
+	p := &procNameCache{
+		names:   make(map[int]string),
+		open:    open,
+		modules: modules,
+		sleep:   time.Sleep,
+	}
+	p.perScan.Store(DefaultNameLookups)
+	return p
+}
+
+// procNames is the process name cache of the Windows scanner.
+var procNames = newProcNameCache(openProcessName, ownerModuleNames)
+
+// SetNameLookups sets how many processes a Windows scan opens at most for
+// their names; 0 means DefaultNameLookups. It has no effect on Linux,
+// which reads names from /proc. It is safe to call while the tracker is
+// running.
+func SetNameLookups(n int) error {
+	if n < 0 {
+		return fmt.Errorf("name_lookups_per_scan %d: want at least 1", n)
+	}
+	if n == 0 {
+		n = DefaultNameLookups
+	}
+	procNames.perScan.Store(int64(n))
+	return nil
+}
+
+// NameLookupStats returns the state of the Windows process name cache.
+func NameLookupStats() ProcNameStats {
+	return procNames.stats()
+}
+
+func (p *procNameCache) stats() ProcNameStats {
+	return ProcNameStats{
+		Cached:  int(p.cached.Load()),
+		Pending: int(p.pending.Load()),
+		PerScan: int(p.perScan.Load()),
+		Opens:   p.opens.Load(),
+		Modules: p.moduleNames.Load(),
+	}
+}
+
+// resolve returns the name of every PID in pids for one scan. Cached names
+// are used as they are; the others come from the owner-module table, or
+// else from opening the process, lowest PID first, at most perScan of
+// them with a random pause of up to nameLookupJitter before each open but
+// the first. PIDs past the cap are ResolvingName until a later scan.
+// A failed open is cached as "pid:N" like a name, so it is not retried on
+// every scan; the resolve queue retries it a few times. PIDs the scan did
+// not see are forgotten, so a reused PID is looked up again.
+func (p *procNameCache) resolve(pids []int) map[int]string {
+	pids = slices.Compact(slices.Sorted(slices.Values(pids)))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[int]bool, len(pids))
+	want := make(map[int]bool)
+	for _, pid := range pids {
+		seen[pid] = true
+		if _, ok := p.names[pid]; ok {
+			continue
+		}
+		if name, ok := systemProcessName(pid); ok {
+			p.names[pid] = name
+		} else {
+			want[pid] = true
+		}
+	}
+	for pid := range p.names {
+		if !seen[pid] {
+			delete(p.names, pid)
+		}
+	}
+
+	if len(want) > 0 && p.modules != nil {
+		for pid, name := range p.modules(want) {
+			if want[pid] {
+				p.names[pid] = name
+				delete(want, pid)
+				p.moduleNames.Add(1)
+			}
+		}
+	}
+
+	opened, pending, perScan := 0, 0, int(p.perScan.Load())
+	for _, pid := range pids {
+		if !want[pid] {
+			continue
+		}
+		if opened == perScan {
+			pending++
+			continue
+		}
+		if opened > 0 {
+			p.sleep(rand.N(nameLookupJitter))
+		}
+		opened++
+		p.names[pid] = p.lookup(pid)
+	}
+	p.pending.Store(int64(pending))
+	p.cached.Store(int64(len(p.names)))
+
+	names := make(map[int]string, len(seen))
+	for pid := range seen {
+		name, ok := p.names[pid]
+		if !ok {
+			name = ResolvingName
+		}
+		names[pid] = name
+	}
+	return names
+}
+
+// systemProcessName names the PIDs Windows reserves, which cannot be
+// opened: the idle process and System.
+func systemProcessName(pid int) (string, bool) {
+	switch pid {
+	case 0:
+		return "System Idle Process", true
+	case 4:
+		return "System", true
+	}
+	return "", false
+}
+
+// retry opens pid again for the resolve queue, replacing a failed lookup
+// in the cache when it succeeds.
+func (p *procNameCache) retry(pid int) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name, ok := p.open(pid)
+	p.opens.Add(1)
+	if ok {
+		p.names[pid] = name
+		p.cached.Store(int64(len(p.names)))
+	}
+	return name, ok
+}
+
+// lookup opens pid for its name, "pid:N" when that fails. Caller must
+// hold the lock.
+func (p *procNameCache) lookup(pid int) string {
+	p.opens.Add(1)
+	if name, ok := p.open(pid); ok {
+		return name
+	}
+	return fmt.Sprintf("pid:%d", pid)
+}
@@ -0,0 +1,191 @@
+package tracker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeResolver stands in for the Windows process lookups, counting opens
+// per PID. Names in modules come from the owner-module table.
+type fakeResolver struct {
+	opens   map[int]int
+	fail    map[int]bool
+	modules map[int]string
+	pauses  int
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{opens: make(map[int]int), fail: make(map[int]bool), modules: make(map[int]string)}
+}
+
+func (r *fakeResolver) cache(perScan int) *procNameCache {
+	p := newProcNameCache(r.open, r.owners)
+	p.perScan.Store(int64(perScan))
+	p.sleep = func(time.Duration) { r.pauses++ }
+	return p
+}
+
+func (r *fakeResolver) open(pid int) (string, bool) {
+	r.opens[pid]++
+	if r.fail[pid] {
+		return "", false
+	}
+	return fmt.Sprintf("app%d.exe", pid), true
+}
+
+func (r *fakeResolver) owners(want map[int]bool) map[int]string {
+	names := make(map[int]string)
+	for pid := range want {
+		if name, ok := r.modules[pid]; ok {
+			names[pid] = name
+		}
+	}
+	return names
+}
+
+func (r *fakeResolver) total() int {
+	n := 0
+	for _, c := range r.opens {
+		n += c
+	}
+	return n
+}
+
+func pidRange(from, n int) []int {
+	pids := make([]int, n)
+	for i := range pids {
+		pids[i] = from + i
+	}
+	return pids
+}
+
+func TestProcNamesCap(t *testing.T) {
+	r := newFakeResolver()
+	p := r.cache(4)
+	pids := pidRange(100, 10)
+	names := p.resolve(pids)
+	if r.total() != 4 {
+		t.Fatalf("%d opens in a scan capped at 4", r.total())
+	}
+	if r.pauses != 3 {
+		t.Errorf("%d pauses between 4 opens", r.pauses)
+	}
+	// Lowest PIDs first, the rest wait.
+	for _, pid := range pids {
+		want := fmt.Sprintf("app%d.exe", pid)
+		if pid >= 104 {
+			want = ResolvingName
+		}
+		if names[pid] != want {
+			t.Errorf("pid %d: %q, want %q", pid, names[pid], want)
+		}
+	}
+	if st := p.stats(); st.Pending != 6 || st.Cached != 4 || st.Opens != 4 || st.PerScan != 4 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestProcNamesCacheHit(t *testing.T) {
+	r := newFakeResolver()
+	p := r.cache(DefaultNameLookups)
+	pids := pidRange(200, 5)
+	p.resolve(pids)
+	for range 3 {
+		names := p.resolve(pids)
+		if names[202] != "app202.exe" {
+			t.Errorf("cached name %q", names[202])
+		}
+	}
+	if r.total() != 5 {
+		t.Errorf("%d opens for 5 PIDs over 4 scans", r.total())
+	}
+
+	// A failed open is cached too, until the resolve queue retries it.
+	r.fail[300] = true
+	if names := p.resolve([]int{300}); names[300] != "pid:300" {
+		t.Errorf("failed lookup %q", names[300])
+	}
+	p.resolve([]int{300})
+	if r.opens[300] != 1 {
+		t.Errorf("failed lookup opened %d times", r.opens[300])
+	}
+	r.fail[300] = false
+	if name, ok := p.retry(300); !ok || name != "app300.exe" {
+		t.Errorf("retry %q, %v", name, ok)
+	}
+	if names := p.resolve([]int{300}); names[300] != "app300.exe" {
+		t.Errorf("after retry %q", names[300])
+	}
+
+	// A PID gone from a scan is forgotten, so its reuse is looked up.
+	p.resolve([]int{201})
+	p.resolve(pids)
+	if r.opens[200] != 2 {
+		t.Errorf("reused PID opened %d times", r.opens[200])
+	}
+}
+
+func TestProcNamesModulesAndSystem(t *testing.T) {
+	r := newFakeResolver()
+	r.modules[500] = "svchost.exe"
+	p := r.cache(DefaultNameLookups)
+	names := p.resolve([]int{0, 4, 500, 501})
+	want := map[int]string{0: "System Idle Process", 4: "System", 500: "svchost.exe", 501: "app501.exe"}
+	for pid, name := range want {
+		if names[pid] != name {
+			t.Errorf("pid %d: %q, want %q", pid, names[pid], name)
+		}
+	}
+	if r.total() != 1 || r.opens[501] != 1 {
+		t.Errorf("opens %v, want only 501", r.opens)
+	}
+	if st := p.stats(); st.Modules != 1 || st.Opens != 1 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestProcNamesEventuallyResolve(t *testing.T) {
+	r := newFakeResolver()
+	p := r.cache(3)
+	pids := pidRange(1000, 20)
+	scans := 0
+	for scans < 20 {
+		names := p.resolve(pids)
+		scans++
+		resolving := 0
+		for _, name := range names {
+			if name == ResolvingName {
+				resolving++
+			}
+		}
+		if resolving == 0 {
+			break
+		}
+	}
+	if scans != 7 {
+		t.Errorf("%d scans to name 20 PIDs 3 at a time, want 7", scans)
+	}
+	for _, pid := range pids {
+		if r.opens[pid] != 1 {
+			t.Errorf("pid %d opened %d times", pid, r.opens[pid])
+		}
+	}
+	if st := p.stats(); st.Pending != 0 || st.Cached != 20 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestSetNameLookups(t *testing.T) {
+	saved := procNames.perScan.Load()
+	t.Cleanup(func() { procNames.perScan.Store(saved) })
+	if err := SetNameLookups(-1); err == nil {
+		t.Error("no error for a negative cap")
+	}
+	if err := SetNameLookups(0); err != nil || NameLookupStats().PerScan != DefaultNameLookups {
+		t.Errorf("0: %v, %d", err, NameLookupStats().PerScan)
+	}
+	if err := SetNameLookups(5); err != nil || NameLookupStats().PerScan != 5 {
+		t.Errorf("5: %v, %d", err, NameLookupStats().PerScan)
+	}
+}
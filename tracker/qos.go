@@ -0,0 +1,66 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QoS is a socket's traffic marking as reported by the kernel.
+type QoS struct {
+	TOS         uint8  // IPv4 TOS byte or IPv6 traffic class; DSCP is the top six bits
+	Priority    uint32 // SO_PRIORITY (or the net_cls class id when one is set)
+	HasPriority bool
+}
+
+// DSCP returns the differentiated services code point (0-63).
+func (q QoS) DSCP() int {
+	return int(q.TOS >> 2)
+}
+
+// dscpNames are the standard per-hop behaviour names (RFC 2474, 2597,
+// 3246, 5865, 8622).
+var dscpNames = map[int]string{
+	0: "CS0", 8: "CS1", 16: "CS2", 24: "CS3", 32: "CS4", 40: "CS5", 48: "CS6", 56: "CS7",
+	10: "AF11", 12: "AF12", 14: "AF13",
+	18: "AF21", 20: "AF22", 22: "AF23",
+	26: "AF31", 28: "AF32", 30: "AF33",
+	34: "AF41", 36: "AF42", 38: "AF43",
+	44: "VA", 46: "EF", 1: "LE",
+}
+
+// DSCPName returns the class name of a DSCP value, e.g. "EF" for 46, or
+// the number for values without a standard name.
+func DSCPName(dscp int) string {
+	if name, ok := dscpNames[dscp]; ok {
+		return name
+	}
+	return strconv.Itoa(dscp)
+}
+
+// Class is the DSCP class name, e.g. "EF".
+func (q QoS) Class() string {
+	return DSCPName(q.DSCP())
+}
+
+// String formats the marking for the detail view, e.g.
+// "EF (DSCP 46, TOS 0xb8), priority 6".
+func (q QoS) String() string {
+	s := fmt.Sprintf("%s (DSCP %d, TOS 0x%02x)", q.Class(), q.DSCP(), q.TOS)
+	if q.HasPriority {
+		s += fmt.Sprintf(", priority %d", q.Priority)
+	}
+	return s
+}
+
+// matchDSCP reports whether c's marking matches a class name (ef, af41,
+// cs1) or a DSCP number. Connections with an unknown marking never match.
+func matchDSCP(c *Connection, v string) bool {
+	if c.QoS == nil {
+		return v == "unknown"
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return c.QoS.DSCP() == n
+	}
+	return strings.ToLower(c.QoS.Class()) == v
+}
@@ -0,0 +1,78 @@
+package tracker
+
+import "testing"
+
+func TestDSCPDecoding(t *testing.T) {
+	tests := []struct {
+		tos   uint8
+		dscp  int
+		class string
+	}{
+		{0x00, 0, "CS0"},
+		{0x04, 1, "LE"},
+		{0x20, 8, "CS1"},
+		{0x28, 10, "AF11"},
+		{0x48, 18, "AF21"},
+		{0x68, 26, "AF31"},
+		{0x88, 34, "AF41"},
+		{0x98, 38, "AF43"},
+		{0xb0, 44, "VA"},
+		{0xb8, 46, "EF"},
+		{0xc0, 48, "CS6"},
+		{0xe0, 56, "CS7"},
+		{0xbb, 46, "EF"}, // the ECN bits do not change the class
+		{0x0c, 3, "3"},
+		{0xfc, 63, "63"},
+	}
+	for _, tt := range tests {
+		q := QoS{TOS: tt.tos}
+		if q.DSCP() != tt.dscp || q.Class() != tt.class {
+			t.Errorf("TOS %#02x: DSCP %d %s, want %d %s", tt.tos, q.DSCP(), q.Class(), tt.dscp, tt.class)
+		}
+	}
+}
+
+func TestQoSString(t *testing.T) {
+	if got, want := (QoS{TOS: 0xb8}).String(), "EF (DSCP 46, TOS 0xb8)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	q := QoS{TOS: 0x10, Priority: 6, HasPriority: true}
+	if got, want := q.String(), "4 (DSCP 4, TOS 0x10), priority 6"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDSCPFilter(t *testing.T) {
+	voice := &Connection{AppName: "voip", QoS: &QoS{TOS: 0xb8}}
+	video := &Connection{AppName: "video", QoS: &QoS{TOS: 0x88}}
+	plain := &Connection{AppName: "curl", QoS: &QoS{}}
+	unknown := &Connection{AppName: "win"}
+	conns := []*Connection{voice, video, plain, unknown}
+
+	tests := []struct {
+		query string
+		want  []*Connection
+	}{
+		{"dscp:ef", []*Connection{voice}},
+		{"dscp:EF", []*Connection{voice}},
+		{"dscp:46", []*Connection{voice}},
+		{"dscp:af41", []*Connection{video}},
+		{"dscp:cs0", []*Connection{plain}},
+		{"dscp:0", []*Connection{plain}},
+		{"dscp:unknown", []*Connection{unknown}},
+		{"dscp:af11", nil},
+		{"dscp:", nil},
+	}
+	for _, tt := range tests {
+		got := FilterConnections(conns, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s matched %d, want %d", tt.query, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s matched %s, want %s", tt.query, got[i].AppName, tt.want[i].AppName)
+			}
+		}
+	}
+}
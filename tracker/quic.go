@@ -0,0 +1,450 @@
+package tracker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// QUIC versions with their own packet protection (RFC 9001, RFC 9369).
+const (
+	quicV1 uint32 = 0x00000001
+	quicV2 uint32 = 0x6b3343cf
+)
+
+// Long header packet types, numbered as in QUIC v1. QUIC v2 puts other
+// values on the wire; parseQUICLongHeader and sealQUIC translate them.
+const (
+	quicInitial byte = iota
+	quic0RTT
+	quicHandshake
+	quicRetry
+)
+
+const (
+	// quicMaxCID is the longest connection ID QUIC v1 and v2 allow.
+	quicMaxCID = 20
+	// quicMinInitial is the smallest UDP payload that may carry a client's
+	// Initial packet.
+	quicMinInitial = 1200
+	// quicTagLen is the AEAD tag of every protected packet.
+	quicTagLen = 16
+)
+
+// Initial salts of RFC 9001 section 5.2 and RFC 9369 section 3.3.1.
+var (
+	quicV1Salt = []byte{
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	}
+	quicV2Salt = []byte{
+		0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+		0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+	}
+)
+
+var errNotQUIC = errors.New("quic: not a long header packet")
+
+// QUICVersionName names a QUIC version as it is usually written: "v1",
+// "v2", "draft-29", Google QUIC's "Q046", or the number in hex.
+func QUICVersionName(v uint32) string {
+	switch {
+	case v == quicV1:
+		return "v1"
+	case v == quicV2:
+		return "v2"
+	case v>>8 == 0xff0000:
+		return fmt.Sprintf("draft-%d", v&0xff)
+	case isGoogleQUIC(v):
+		return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+	}
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// isGoogleQUIC reports whether v is a Google QUIC version: 'Q' or 'T'
+// and three digits.
+func isGoogleQUIC(v uint32) bool {
+	if c := byte(v >> 24); c != 'Q' && c != 'T' {
+		return false
+	}
+	for _, c := range []byte{byte(v >> 16), byte(v >> 8), byte(v)} {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// quicVersionKnown reports whether v is a version QUIC traffic is seen
+// with: v1, v2, the IETF drafts, Google QUIC, the versions reserved to
+// exercise version negotiation, and 0 for a Version Negotiation packet.
+// Other protocols on UDP rarely put one of these in bytes 1 to 4.
+func quicVersionKnown(v uint32) bool {
+	return v == 0 || v == quicV1 || v == quicV2 || v>>8 == 0xff0000 ||
+		isGoogleQUIC(v) || v&0x0f0f0f0f == 0x0a0a0a0a
+}
+
+// quicHeader is the clear part of a long header packet.
+type quicHeader struct {
+	version  uint32
+	typ      byte // quicInitial, quic0RTT, quicHandshake or quicRetry
+	dcid     []byte
+	scid     []byte
+	token    []byte   // Initial and Retry
+	versions []uint32 // Version Negotiation: the versions the server offers
+	pnOffset int      // where the protected packet number starts; 0 for Retry and Version Negotiation
+	end      int      // where the packet ends; other packets may follow in the datagram
+}
+
+// parseQUICLongHeader reads the long header packet at the start of b. It
+// checks the structure only: the version may be one this tracker cannot
+// decrypt. It never reads past b.
+func parseQUICLongHeader(b []byte) (quicHeader, error) {
+	var h quicHeader
+	if len(b) < 7 || b[0]&0x80 == 0 {
+		return h, errNotQUIC
+	}
+	h.version = binary.BigEndian.Uint32(b[1:5])
+	r := helloReader(b[5:])
+	var ok bool
+	if h.dcid, ok = r.vector(1); !ok || len(h.dcid) > quicMaxCID && h.version != 0 {
+		return h, errNotQUIC
+	}
+	if h.scid, ok = r.vector(1); !ok || len(h.scid) > quicMaxCID && h.version != 0 {
+		return h, errNotQUIC
+	}
+	if h.version == 0 {
+		// Version Negotiation: the rest is a list of versions.
+		if len(r) == 0 || len(r)%4 != 0 {
+			return h, errNotQUIC
+		}
+		for ; len(r) > 0; r = r[4:] {
+			h.versions = append(h.versions, binary.BigEndian.Uint32(r))
+		}
+		h.end = len(b)
+		return h, nil
+	}
+	if b[0]&0x40 == 0 && (h.version == quicV1 || h.version == quicV2) {
+		return h, errNotQUIC // the fixed bit
+	}
+	h.typ = b[0] >> 4 & 3
+	if h.version == quicV2 {
+		h.typ = (h.typ + 3) & 3
+	}
+	switch h.typ {
+	case quicRetry:
+		if len(r) < quicTagLen {
+			return h, errNotQUIC
+		}
+		h.token = r[:len(r)-quicTagLen]
+		h.end = len(b)
+		return h, nil
+	case quicInitial:
+		n, size, ok := quicVarint(r)
+		if !ok || uint64(len(r)-size) < n {
+			return h, errNotQUIC
+		}
+		h.token = r[size : size+int(n)]
+		r = r[size+int(n):]
+	}
+	n, size, ok := quicVarint(r)
+	if !ok || uint64(len(r)-size) < n || n < 1 {
+		return h, errNotQUIC
+	}
+	h.pnOffset = len(b) - len(r) + size
+	h.end = h.pnOffset + int(n)
+	return h, nil
+}
+
+// quicVarint decodes the variable-length integer at the start of b and
+// returns it with its size.
+func quicVarint(b []byte) (v uint64, size int, ok bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	size = 1 << (b[0] >> 6)
+	if len(b) < size {
+		return 0, 0, false
+	}
+	v = uint64(b[0] & 0x3f)
+	for _, c := range b[1:size] {
+		v = v<<8 | uint64(c)
+	}
+	return v, size, true
+}
+
+// appendQUICVarint appends v in the shortest variable-length encoding.
+func appendQUICVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// quicKeys protect the packets of one direction at one encryption level.
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 (RFC 8446 section 7.1)
+// with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) ([]byte, error) {
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len("tls13 ")+len(label)))
+	info = append(info, "tls13 "+label...)
+	info = append(info, 0)
+	return hkdf.Expand(h, secret, string(info), length)
+}
+
+// newQUICKeys derives AES-GCM packet protection from a TLS traffic
+// secret. keyLen is 16 for TLS_AES_128_GCM_SHA256 and 32 for
+// TLS_AES_256_GCM_SHA384, with h its hash.
+func newQUICKeys(version uint32, h func() hash.Hash, secret []byte, keyLen int) (*quicKeys, error) {
+	prefix := "quic "
+	if version == quicV2 {
+		prefix = "quicv2 "
+	}
+	key, err := hkdfExpandLabel(h, secret, prefix+"key", keyLen)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hkdfExpandLabel(h, secret, prefix+"iv", 12)
+	if err != nil {
+		return nil, err
+	}
+	hpKey, err := hkdfExpandLabel(h, secret, prefix+"hp", keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil, err
+	}
+	return &quicKeys{aead: aead, iv: iv, hp: hp}, nil
+}
+
+// quicInitialKeys derives the Initial packet protection of the client, or
+// of the server, from the connection ID the client first sent to.
+func quicInitialKeys(version uint32, dcid []byte, server bool) (*quicKeys, error) {
+	salt := quicV1Salt
+	switch version {
+	case quicV1:
+	case quicV2:
+		salt = quicV2Salt
+	default:
+		return nil, fmt.Errorf("quic: no Initial keys for version %s", QUICVersionName(version))
+	}
+	initial, err := hkdf.Extract(sha256.New, dcid, salt)
+	if err != nil {
+		return nil, err
+	}
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+	secret, err := hkdfExpandLabel(sha256.New, initial, label, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newQUICKeys(version, sha256.New, secret, 16)
+}
+
+// open removes the header protection of the long header packet h at the
+// start of b and decrypts it, returning its packet number and frames. b
+// is modified.
+func (k *quicKeys) open(b []byte, h quicHeader) (pn uint64, payload []byte, err error) {
+	if h.pnOffset == 0 || h.end > len(b) || h.pnOffset+4+aes.BlockSize > h.end {
+		return 0, nil, errNotQUIC
+	}
+	var mask [aes.BlockSize]byte
+	k.hp.Encrypt(mask[:], b[h.pnOffset+4:h.pnOffset+4+aes.BlockSize])
+	b[0] ^= mask[0] & 0x0f
+	pnLen := int(b[0]&3) + 1
+	for i := range pnLen {
+		b[h.pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(b[h.pnOffset+i])
+	}
+	hdr := b[:h.pnOffset+pnLen]
+	payload, err = k.aead.Open(nil, k.nonce(pn), b[len(hdr):h.end], hdr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("quic: %v", err)
+	}
+	return pn, payload, nil
+}
+
+func (k *quicKeys) nonce(pn uint64) []byte {
+	nonce := append([]byte(nil), k.iv...)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+// sealQUIC builds a protected long header packet of type typ with a
+// two-byte packet number. token is only sent in Initial packets.
+func (k *quicKeys) sealQUIC(version uint32, typ byte, dcid, scid, token []byte, pn uint64, payload []byte) []byte {
+	for len(payload) < 2 {
+		payload = append(payload, 0) // PADDING: the sample needs 4 bytes after the packet number
+	}
+	wireType := typ
+	if version == quicV2 {
+		wireType = (typ + 1) & 3
+	}
+	const pnLen = 2
+	b := []byte{0xc0 | wireType<<4 | (pnLen - 1)}
+	b = binary.BigEndian.AppendUint32(b, version)
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	if typ == quicInitial {
+		b = appendQUICVarint(b, uint64(len(token)))
+		b = append(b, token...)
+	}
+	length := uint64(pnLen + len(payload) + quicTagLen)
+	b = append(b, byte(length>>8)|0x40, byte(length)) // always two bytes
+	pnOffset := len(b)
+	b = binary.BigEndian.AppendUint16(b, uint16(pn))
+	b = k.aead.Seal(b, k.nonce(pn), payload, b)
+
+	var mask [aes.BlockSize]byte
+	k.hp.Encrypt(mask[:], b[pnOffset+4:pnOffset+4+aes.BlockSize])
+	b[0] ^= mask[0] & 0x0f
+	for i := range pnLen {
+		b[pnOffset+i] ^= mask[1+i]
+	}
+	return b
+}
+
+// quicCryptoFrame is the data of one CRYPTO frame at its stream offset.
+type quicCryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+// QUICCloseError is a CONNECTION_CLOSE frame the peer sent.
+type QUICCloseError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *QUICCloseError) Error() string {
+	if e.Code > 0x100 && e.Code < 0x200 {
+		return fmt.Sprintf("closed with TLS alert %d %s", e.Code-0x100, e.Reason)
+	}
+	return fmt.Sprintf("closed with error 0x%x %s", e.Code, e.Reason)
+}
+
+// parseQUICFrames reads the frames an Initial or Handshake packet may
+// carry: PADDING, PING, ACK, CRYPTO and CONNECTION_CLOSE. It returns the
+// CRYPTO frames, and a *QUICCloseError for a CONNECTION_CLOSE.
+func parseQUICFrames(p []byte) ([]quicCryptoFrame, error) {
+	var crypto []quicCryptoFrame
+	varint := func() (uint64, bool) {
+		v, n, ok := quicVarint(p)
+		p = p[n:]
+		return v, ok
+	}
+	for len(p) > 0 {
+		typ, ok := varint()
+		if !ok {
+			return nil, errNotQUIC
+		}
+		switch typ {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK, ACK with ECN counts
+			fields := 4 // largest, delay, range count, first range
+			for i := 0; i < fields; i++ {
+				v, ok := varint()
+				if !ok {
+					return nil, errNotQUIC
+				}
+				if i == 2 {
+					if v > uint64(len(p)) {
+						return nil, errNotQUIC
+					}
+					fields += 2 * int(v) // gap and length of each further range
+				}
+			}
+			if typ == 0x03 {
+				for range 3 {
+					if _, ok := varint(); !ok {
+						return nil, errNotQUIC
+					}
+				}
+			}
+		case 0x06: // CRYPTO
+			off, ok1 := varint()
+			n, ok2 := varint()
+			if !ok1 || !ok2 || n > uint64(len(p)) {
+				return nil, errNotQUIC
+			}
+			crypto = append(crypto, quicCryptoFrame{off, p[:n]})
+			p = p[n:]
+		case 0x1c: // CONNECTION_CLOSE
+			code, ok1 := varint()
+			_, ok2 := varint() // the frame type that caused it
+			n, ok3 := varint()
+			if !ok1 || !ok2 || !ok3 || n > uint64(len(p)) {
+				return nil, errNotQUIC
+			}
+			return crypto, &QUICCloseError{Code: code, Reason: string(p[:n])}
+		default:
+			return nil, fmt.Errorf("quic: unexpected frame type 0x%x", typ)
+		}
+	}
+	return crypto, nil
+}
+
+// quicStream reassembles a CRYPTO stream from frames that may arrive out of
+// order or overlap. At most maxHelloLen bytes are kept.
+type quicStream struct {
+	data    []byte // the contiguous bytes from offset 0
+	pending []quicCryptoFrame
+}
+
+// add stores f and returns false when it lies beyond what is kept.
+func (s *quicStream) add(f quicCryptoFrame) bool {
+	if f.offset+uint64(len(f.data)) > maxHelloLen {
+		return false
+	}
+	s.pending = append(s.pending, quicCryptoFrame{f.offset, append([]byte(nil), f.data...)})
+	for progress := true; progress; {
+		progress = false
+		rest := s.pending[:0]
+		for _, p := range s.pending {
+			end := p.offset + uint64(len(p.data))
+			switch {
+			case end <= uint64(len(s.data)):
+				// already have it
+			case p.offset <= uint64(len(s.data)):
+				s.data = append(s.data, p.data[uint64(len(s.data))-p.offset:]...)
+				progress = true
+			default:
+				rest = append(rest, p)
+			}
+		}
+		s.pending = rest
+	}
+	return true
+}
@@ -0,0 +1,350 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The packets in testdata/quic were captured on loopback from the quic
+// check against quicTestServer, asking for quic.test; testdata/dns holds
+// a query of Go's resolver for example.com and its answer.
+func readPacket(t testing.TB, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestQUICInitialKeys checks the Initial keys against RFC 9001 appendix
+// A.1 and RFC 9369 appendix A.1.
+func TestQUICInitialKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     uint32
+		server      bool
+		key, iv, hp string
+	}{
+		{"v1 client", quicV1, false, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{"v1 server", quicV1, true, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+		{"v2 client", quicV2, false, "8b1a0bc121284290a29e0971b5cd045d", "91f73e2351d8fa91660e909f", "45b95e15235d6f45a6b19cbcb0294ba9"},
+	}
+	dcid := unhex(t, "8394c8f03e515708")
+	sample := unhex(t, "d1b1c98dd7689fb8ec11d242b123dc9b")
+	for _, tt := range tests {
+		k, err := quicInitialKeys(tt.version, dcid, tt.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(k.iv, unhex(t, tt.iv)) {
+			t.Errorf("%s: iv %x, want %s", tt.name, k.iv, tt.iv)
+		}
+		block, _ := aes.NewCipher(unhex(t, tt.key))
+		aead, _ := cipher.NewGCM(block)
+		if got, want := k.aead.Seal(nil, k.nonce(2), sample, nil), aead.Seal(nil, k.nonce(2), sample, nil); !bytes.Equal(got, want) {
+			t.Errorf("%s: packet key differs from %s", tt.name, tt.key)
+		}
+		hp, _ := aes.NewCipher(unhex(t, tt.hp))
+		var got, want [aes.BlockSize]byte
+		k.hp.Encrypt(got[:], sample)
+		hp.Encrypt(want[:], sample)
+		if got != want {
+			t.Errorf("%s: header protection key differs from %s", tt.name, tt.hp)
+		}
+	}
+	if _, err := quicInitialKeys(0xff00001d, dcid, false); err == nil {
+		t.Error("Initial keys for draft-29")
+	}
+}
+
+// TestQUICVarint uses the examples of RFC 9000 appendix A.1.
+func TestQUICVarint(t *testing.T) {
+	tests := []struct {
+		enc  string
+		v    uint64
+		size int
+	}{
+		{"c2197c5eff14e88c", 151288809941952652, 8},
+		{"9d7f3e7d", 494878333, 4},
+		{"7bbd", 15293, 2},
+		{"25", 37, 1},
+		{"4025", 37, 2},
+	}
+	for _, tt := range tests {
+		b := unhex(t, tt.enc)
+		v, size, ok := quicVarint(b)
+		if !ok || v != tt.v || size != tt.size {
+			t.Errorf("%s: %d (%d bytes, %v), want %d (%d bytes)", tt.enc, v, size, ok, tt.v, tt.size)
+		}
+		if _, _, ok := quicVarint(b[:len(b)-1]); ok && len(b) > 1 {
+			t.Errorf("%s: truncated varint decoded", tt.enc)
+		}
+		if tt.size == 1<<(b[0]>>6) && tt.enc != "4025" {
+			if got := appendQUICVarint(nil, tt.v); !bytes.Equal(got, b) {
+				t.Errorf("appendQUICVarint(%d) = %x, want %s", tt.v, got, tt.enc)
+			}
+		}
+	}
+}
+
+func TestParseQUICLongHeader(t *testing.T) {
+	tests := []struct {
+		file     string
+		version  uint32
+		typ      byte
+		token    string
+		versions []uint32
+		packets  int // in the datagram
+	}{
+		{"quic/v1_client_initial.bin", quicV1, quicInitial, "", nil, 1},
+		{"quic/v2_client_initial.bin", quicV2, quicInitial, "", nil, 1},
+		{"quic/v1_server_flight.bin", quicV1, quicInitial, "", nil, 2},
+		{"quic/retry.bin", quicV1, quicRetry, "token", nil, 1},
+		{"quic/version_negotiation.bin", 0, 0, "", []uint32{0x1a2a3a4a, quicV2}, 1},
+	}
+	for _, tt := range tests {
+		b := readPacket(t, tt.file)
+		h, err := parseQUICLongHeader(b)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if h.version != tt.version || h.typ != tt.typ || string(h.token) != tt.token || !slices.Equal(h.versions, tt.versions) {
+			t.Errorf("%s: %+v", tt.file, h)
+		}
+		if len(h.dcid) != quicProbeCIDLen && h.version != 0 && tt.typ != quicRetry && tt.file != "quic/v1_server_flight.bin" {
+			t.Errorf("%s: dcid %x", tt.file, h.dcid)
+		}
+		packets := 1
+		for rest := b[h.end:]; len(rest) > 0; packets++ {
+			next, err := parseQUICLongHeader(rest)
+			if err != nil {
+				t.Fatalf("%s: packet %d: %v", tt.file, packets+1, err)
+			}
+			if next.typ != quicHandshake {
+				t.Errorf("%s: packet %d has type %d", tt.file, packets+1, next.typ)
+			}
+			rest = rest[next.end:]
+		}
+		if packets != tt.packets {
+			t.Errorf("%s: %d packets, want %d", tt.file, packets, tt.packets)
+		}
+		// No prefix of a packet may be read past its end.
+		for n := range len(b) {
+			parseQUICLongHeader(b[:n])
+		}
+	}
+
+	for _, file := range []string{"dns/query.bin", "dns/response.bin"} {
+		if h, err := parseQUICLongHeader(readPacket(t, file)); err == nil && quicVersionKnown(h.version) {
+			t.Errorf("%s parsed as QUIC %s", file, QUICVersionName(h.version))
+		}
+	}
+}
+
+func TestQUICSealOpen(t *testing.T) {
+	dcid, scid := []byte("destcid1"), []byte("srccid")
+	for _, version := range []uint32{quicV1, quicV2} {
+		for _, typ := range []byte{quicInitial, quicHandshake} {
+			keys, err := quicInitialKeys(version, dcid, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload := []byte{0x01} // PING, padded by sealQUIC
+			b := keys.sealQUIC(version, typ, dcid, scid, []byte("tok"), 0x1234, payload)
+			b = append(b, 0, 0, 0) // padding after the packet
+			h, err := parseQUICLongHeader(b)
+			if err != nil {
+				t.Fatalf("%s type %d: %v", QUICVersionName(version), typ, err)
+			}
+			if h.typ != typ || !bytes.Equal(h.dcid, dcid) || !bytes.Equal(h.scid, scid) || h.end != len(b)-3 {
+				t.Errorf("%s type %d: header %+v", QUICVersionName(version), typ, h)
+			}
+			if typ == quicInitial && string(h.token) != "tok" {
+				t.Errorf("%s: token %q", QUICVersionName(version), h.token)
+			}
+			pn, got, err := keys.open(b, h)
+			if err != nil || pn != 0x1234 || got[0] != 0x01 {
+				t.Errorf("%s type %d: open: pn %x, payload %x, %v", QUICVersionName(version), typ, pn, got, err)
+			}
+		}
+	}
+}
+
+func TestParseQUICFrames(t *testing.T) {
+	crypto := func(off uint64, data string) []byte {
+		b := appendQUICVarint([]byte{0x06}, off)
+		b = appendQUICVarint(b, uint64(len(data)))
+		return append(b, data...)
+	}
+	// 9-8, then 5 after a gap of 6-7, then 2-0 after a gap of 3-4
+	ack := ackFrame([]uint64{0, 1, 2, 5, 9, 8})
+	if want := []byte{0x02, 9, 0, 2, 1, 1, 0, 1, 2}; !bytes.Equal(ack, want) {
+		t.Errorf("ACK frame %x, want %x", ack, want)
+	}
+	var p []byte
+	p = append(p, 0x00, 0x00, 0x01)
+	p = append(p, ack...)
+	p = append(p, crypto(5, " world")...)
+	p = append(p, 0x03, 0x02, 0x00, 0x00, 0x02, 1, 2, 3) // ACK with ECN counts
+	p = append(p, crypto(0, "hello")...)
+	frames, err := parseQUICFrames(p)
+	if err != nil || len(frames) != 2 {
+		t.Fatalf("frames %+v, %v", frames, err)
+	}
+	var s quicStream
+	for _, f := range frames {
+		s.add(f)
+	}
+	if string(s.data) != "hello world" {
+		t.Errorf("stream %q", s.data)
+	}
+
+	var closeErr *QUICCloseError
+	_, err = parseQUICFrames([]byte{0x1c, 0x41, 0x28, 0x06, 3, 'b', 'a', 'd'})
+	if !errors.As(err, &closeErr) || closeErr.Code != 0x128 || err.Error() != "closed with TLS alert 40 bad" {
+		t.Errorf("CONNECTION_CLOSE: %v", err)
+	}
+	if _, err := parseQUICFrames([]byte{0x08, 0x00}); err == nil {
+		t.Error("STREAM frame accepted in a handshake packet")
+	}
+	if _, err := parseQUICFrames([]byte{0x02, 0x05, 0x00, 0x3f}); err == nil {
+		t.Error("ACK with more ranges than bytes accepted")
+	}
+}
+
+func TestQUICStream(t *testing.T) {
+	var s quicStream
+	s.add(quicCryptoFrame{6, []byte("gh")})
+	s.add(quicCryptoFrame{2, []byte("cdef")})
+	if len(s.data) != 0 {
+		t.Errorf("data %q before offset 0 arrived", s.data)
+	}
+	s.add(quicCryptoFrame{0, []byte("abc")}) // overlaps the next
+	s.add(quicCryptoFrame{1, []byte("b")})   // already have it
+	if string(s.data) != "abcdefgh" || len(s.pending) != 0 {
+		t.Errorf("data %q, %d pending", s.data, len(s.pending))
+	}
+	if s.add(quicCryptoFrame{maxHelloLen - 1, []byte("xy")}) {
+		t.Error("frame past maxHelloLen kept")
+	}
+}
+
+// observeFile feeds a captured datagram to ObserveQUIC.
+func observeFile(t *testing.T, tr *Tracker, file string, local, remote netip.AddrPort, outbound bool) {
+	t.Helper()
+	tr.ObserveQUIC(local, remote, readPacket(t, file), outbound)
+}
+
+// TestObserveQUIC checks the passive detection on captured packets, on a
+// port other than 443.
+func TestObserveQUIC(t *testing.T) {
+	remote := netip.MustParseAddrPort("198.51.100.7:8443")
+	tests := []struct {
+		name    string
+		files   []string
+		inbound []bool
+		quic    bool
+		version string
+		sni     string
+	}{
+		{"v1 handshake", []string{"quic/v1_client_initial.bin", "quic/v1_server_flight.bin"}, []bool{false, true}, true, "v1", "quic.test"},
+		{"v2 Initial", []string{"quic/v2_client_initial.bin"}, []bool{false}, true, "v2", "quic.test"},
+		{"server flight only", []string{"quic/v1_server_flight.bin"}, []bool{true}, true, "v1", ""},
+		{"version negotiation", []string{"quic/version_negotiation.bin"}, []bool{true}, true, "", ""},
+		{"dns", []string{"dns/query.bin", "dns/response.bin"}, []bool{false, true}, false, "", ""},
+	}
+	for i, tt := range tests {
+		local := netip.AddrPortFrom(netip.MustParseAddr("10.0.0.2"), uint16(50000+i))
+		src := &fakeSource{}
+		c := fakeConn("app", remote.Addr().String(), int(remote.Port()))
+		c.Protocol, c.LocalPort = "udp", int(local.Port())
+		src.set(c)
+		tr := NewTracker(time.Hour, false)
+		tr.SetSource(src)
+		for j, file := range tt.files {
+			observeFile(t, tr, file, local, remote, !tt.inbound[j])
+		}
+		tr.scan()
+		conns := tr.Snapshot()
+		if len(conns) != 1 {
+			t.Fatalf("%s: %d connections", tt.name, len(conns))
+		}
+		got := conns[0]
+		if (got.Service == ServiceQUIC) != tt.quic || got.QUICVersion != tt.version || got.SNI != tt.sni {
+			t.Errorf("%s: service %q, version %q, SNI %q; want QUIC %v, %q, %q",
+				tt.name, got.Service, got.QUICVersion, got.SNI, tt.quic, tt.version, tt.sni)
+		}
+	}
+}
+
+// TestQUICRemoteCache checks that a flow whose handshake was not seen
+// takes what an earlier flow to the same server showed.
+func TestQUICRemoteCache(t *testing.T) {
+	remote := netip.MustParseAddrPort("198.51.100.7:4433")
+	seen := fakeConn("app", "198.51.100.7", 4433)
+	seen.Protocol, seen.LocalPort = "udp", 50001
+	later := seen
+	later.LocalPort = 50002
+	other := seen
+	other.RemoteAddr, other.LocalPort = "198.51.100.8", 50003
+
+	src := &fakeSource{}
+	src.set(seen)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	now := time.Now()
+	tr.SetClock(func() time.Time { return now })
+	observeFile(t, tr, "quic/v1_client_initial.bin", netip.MustParseAddrPort("10.0.0.2:50001"), remote, true)
+	tr.scan()
+	src.set(seen, later, other)
+	now = now.Add(2 * sniTTL) // the flow itself has expired
+	tr.scan()
+	for _, c := range tr.Snapshot() {
+		switch c.LocalPort {
+		case 50001, 50002:
+			if c.Service != ServiceQUIC || c.QUICVersion != "v1" || c.SNI != "quic.test" {
+				t.Errorf("port %d: service %q, version %q, SNI %q", c.LocalPort, c.Service, c.QUICVersion, c.SNI)
+			}
+		case 50003:
+			if c.Service == ServiceQUIC {
+				t.Errorf("flow to another server labelled QUIC")
+			}
+		}
+	}
+	now = now.Add(quicRemoteTTL + time.Second)
+	tr.scan()
+	if n := len(tr.sni.remotes); n != 0 {
+		t.Errorf("%d servers kept past quicRemoteTTL", n)
+	}
+}
+
+// TestHKDFExpandLabel checks the client Initial secret of RFC 9001
+// appendix A.1.
+func TestHKDFExpandLabel(t *testing.T) {
+	initial := unhex(t, "7db5df06e7a69e432496adedb00851923595221596ae2ae9fb8115c1e9ed0a44")
+	got, err := hkdfExpandLabel(sha256.New, initial, "client in", 32)
+	if want := unhex(t, "c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea"); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("client initial secret %x, %v", got, err)
+	}
+}
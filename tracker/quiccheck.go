@@ -0,0 +1,486 @@
+package tracker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// quicProbeCIDLen is the length of the connection IDs the check picks.
+const quicProbeCIDLen = 8
+
+// errQUICProbeDone stops the TLS handshake once the server's certificate
+// is in: the check learns nothing more from finishing it.
+var errQUICProbeDone = errors.New("quic check: certificate received")
+
+// quicVersionError is a Version Negotiation packet: the server does not
+// speak the version asked for.
+type quicVersionError struct {
+	offered []uint32
+}
+
+func (e *quicVersionError) Error() string {
+	names := make([]string, len(e.offered))
+	for i, v := range e.offered {
+		names[i] = QUICVersionName(v)
+	}
+	return "server offers only QUIC " + strings.Join(names, ", ")
+}
+
+// Packet number spaces the check uses; 0-RTT and 1-RTT packets are never
+// sent.
+const (
+	spaceInitial = iota
+	spaceHandshake
+	quicSpaces
+)
+
+// quicProbe is the client side of one QUIC handshake, run up to the
+// server's certificate.
+type quicProbe struct {
+	conn     net.Conn
+	ip       uint64 // IP header bytes, for the probe traffic meter
+	version  uint32
+	dcid     []byte // where packets go: the server's ID once it picked one
+	origDCID []byte // the ID the Initial keys come from
+	scid     []byte
+	token    []byte // from a Retry
+	retried  bool
+	tls      *tls.QUICConn
+
+	send, recv [quicSpaces]*quicKeys
+	nextPN     [quicSpaces]uint64
+	received   [quicSpaces][]uint64 // packet numbers to acknowledge
+	ackDue     [quicSpaces]bool
+	in         [quicSpaces]quicStream
+	fed        [quicSpaces]int    // bytes of in given to TLS
+	out        [quicSpaces][]byte // CRYPTO data to send
+	sent       [quicSpaces]int    // bytes of out sent
+	early      [][]byte           // Handshake packets that came before their keys
+
+	answered    bool // a valid packet came back
+	firstAnswer time.Time
+	cert        *x509.Certificate
+	alpn        string
+	done        bool
+}
+
+// checkQUIC runs a QUIC handshake with the server at target, asking for
+// host (no SNI when empty) and ALPN h3, and records the version and ALPN
+// agreed on and the first name of the server's certificate. It starts
+// with v1 and moves to v2 if the server offers only that. The certificate
+// is not verified, and the handshake is closed as soon as it arrives.
+func checkQUIC(ctx context.Context, target, host string, r *ServiceCheck) error {
+	r.Target = target
+	if host != "" {
+		_, port, _ := net.SplitHostPort(target)
+		r.Target = net.JoinHostPort(host, port)
+	}
+	version := quicV1
+	for {
+		start := time.Now()
+		p, err := runQUICProbe(ctx, target, host, version)
+		if p != nil && p.answered {
+			r.Latency = p.firstAnswer.Sub(start)
+		}
+		var vn *quicVersionError
+		if errors.As(err, &vn) && version == quicV1 && slices.Contains(vn.offered, quicV2) {
+			version = quicV2
+			continue
+		}
+		if p != nil && p.send[spaceHandshake] != nil {
+			r.Status = QUICVersionName(p.version)
+			if p.alpn != "" {
+				r.Status += " " + p.alpn
+			}
+		}
+		if err != nil {
+			return err
+		}
+		r.Cert = certName(p.cert)
+		r.OK = true
+		return nil
+	}
+}
+
+// certName is the first DNS name of cert, or its common name.
+func certName(cert *x509.Certificate) string {
+	switch {
+	case cert == nil:
+		return ""
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// runQUICProbe runs one handshake attempt with version. The probe is
+// returned with what it learned, also on error.
+func runQUICProbe(ctx context.Context, target, host string, version uint32) (*quicProbe, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	p := &quicProbe{
+		conn:    conn,
+		ip:      ipHeaderBytes(conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil),
+		version: version,
+		dcid:    make([]byte, quicProbeCIDLen),
+		scid:    make([]byte, quicProbeCIDLen),
+	}
+	rand.Read(p.dcid)
+	rand.Read(p.scid)
+	p.origDCID = p.dcid
+	if err := p.initialKeys(); err != nil {
+		return p, err
+	}
+	p.tls = tls.QUICClient(&tls.QUICConfig{TLSConfig: &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true, // the check asks who answers, not whether to trust it
+		NextProtos:         []string{"h3"},
+		MinVersion:         tls.VersionTLS13,
+		// No post-quantum key share, so the ClientHello fits one packet.
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) > 0 {
+				p.cert = cs.PeerCertificates[0]
+			}
+			p.alpn = cs.NegotiatedProtocol
+			return errQUICProbeDone
+		},
+	}})
+	p.tls.SetTransportParameters(quicTransportParams(p.scid))
+	if err := p.tls.Start(ctx); err != nil {
+		return p, err
+	}
+	defer p.tls.Close()
+	if err := p.events(); err != nil {
+		return p, err
+	}
+	if err := p.flush(); err != nil {
+		return p, err
+	}
+	buf := make([]byte, 1<<16)
+	for !p.done {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if p.send[spaceHandshake] != nil {
+				return p, fmt.Errorf("handshake stopped before the certificate: %w", err)
+			}
+			return p, err
+		}
+		probeMeter.add(ProbeTraffic{Received: p.ip + udpHeaderLen + uint64(n)})
+		if err := p.handleDatagram(buf[:n]); err != nil {
+			return p, err
+		}
+		if !p.done {
+			if err := p.flush(); err != nil {
+				return p, err
+			}
+		}
+	}
+	p.close()
+	return p, nil
+}
+
+// initialKeys derives the Initial keys of both directions from origDCID.
+func (p *quicProbe) initialKeys() error {
+	var err error
+	if p.send[spaceInitial], err = quicInitialKeys(p.version, p.origDCID, false); err != nil {
+		return err
+	}
+	p.recv[spaceInitial], err = quicInitialKeys(p.version, p.origDCID, true)
+	return err
+}
+
+// quicTransportParams are the client's QUIC transport parameters: its
+// connection ID, which v1 requires, and an idle timeout.
+func quicTransportParams(scid []byte) []byte {
+	var b []byte
+	b = appendQUICVarint(b, 0x01) // max_idle_timeout, in ms
+	b = appendQUICVarint(b, 2)
+	b = appendQUICVarint(b, 5000)
+	b = appendQUICVarint(b, 0x0f) // initial_source_connection_id
+	b = appendQUICVarint(b, uint64(len(scid)))
+	return append(b, scid...)
+}
+
+// quicSuiteKeys derives the packet protection of a TLS 1.3 cipher suite.
+func quicSuiteKeys(version uint32, suite uint16, secret []byte) (*quicKeys, error) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		return newQUICKeys(version, sha256.New, secret, 16)
+	case tls.TLS_AES_256_GCM_SHA384:
+		return newQUICKeys(version, func() hash.Hash { return sha512.New384() }, secret, 32)
+	}
+	return nil, fmt.Errorf("server chose %s, which this check cannot decrypt", tls.CipherSuiteName(suite))
+}
+
+// quicSpace is the packet number space of a TLS encryption level, or -1.
+func quicSpace(level tls.QUICEncryptionLevel) int {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return spaceInitial
+	case tls.QUICEncryptionLevelHandshake:
+		return spaceHandshake
+	}
+	return -1
+}
+
+// events takes what the TLS handshake produced: data to send and keys.
+func (p *quicProbe) events() error {
+	for {
+		e := p.tls.NextEvent()
+		space := quicSpace(e.Level)
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICWriteData:
+			if space >= 0 {
+				p.out[space] = append(p.out[space], e.Data...)
+			}
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			if space != spaceHandshake {
+				continue
+			}
+			k, err := quicSuiteKeys(p.version, e.Suite, e.Data)
+			if err != nil {
+				return err
+			}
+			if e.Kind == tls.QUICSetReadSecret {
+				p.recv[space] = k
+			} else {
+				p.send[space] = k
+			}
+		case tls.QUICHandshakeDone:
+			p.done = true
+		}
+	}
+}
+
+// handleDatagram processes the long header packets of one datagram.
+func (p *quicProbe) handleDatagram(b []byte) error {
+	for len(b) > 0 {
+		h, err := parseQUICLongHeader(b)
+		if err != nil {
+			return nil // a short header packet, or padding: nothing the check needs
+		}
+		pkt := b[:h.end]
+		b = b[h.end:]
+		switch {
+		case h.version == 0:
+			if !slices.Equal(h.dcid, p.scid) {
+				continue
+			}
+			return &quicVersionError{offered: h.versions}
+		case h.version != p.version:
+			continue
+		case h.typ == quicRetry:
+			if p.retried || p.answered || len(h.scid) == 0 {
+				continue
+			}
+			// The integrity tag is not checked: a forged Retry can only
+			// make this check fail.
+			p.retried, p.token = true, append([]byte(nil), h.token...)
+			p.dcid = append([]byte(nil), h.scid...)
+			p.origDCID = p.dcid
+			if err := p.initialKeys(); err != nil {
+				return err
+			}
+			p.sent[spaceInitial] = 0 // send the ClientHello again
+			return nil
+		case h.typ == quicHandshake && p.recv[spaceHandshake] == nil:
+			if len(p.early) < 8 {
+				p.early = append(p.early, append([]byte(nil), pkt...))
+			}
+			continue
+		}
+		space := spaceInitial
+		if h.typ == quicHandshake {
+			space = spaceHandshake
+		} else if h.typ != quicInitial {
+			continue
+		}
+		if err := p.handlePacket(space, pkt, h); err != nil || p.done {
+			return err
+		}
+		if space == spaceInitial && p.recv[spaceHandshake] != nil {
+			early := p.early
+			p.early = nil
+			for _, pkt := range early {
+				if h, err := parseQUICLongHeader(pkt); err == nil {
+					if err := p.handlePacket(spaceHandshake, pkt, h); err != nil || p.done {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// handlePacket decrypts one packet and gives its CRYPTO data to TLS.
+func (p *quicProbe) handlePacket(space int, pkt []byte, h quicHeader) error {
+	pn, frames, err := p.recv[space].open(pkt, h)
+	if err != nil {
+		return nil // not for us, or damaged: skip it like a lost packet
+	}
+	if !p.answered {
+		p.answered, p.firstAnswer = true, time.Now()
+	}
+	if space == spaceInitial && len(h.scid) > 0 {
+		p.dcid = append([]byte(nil), h.scid...) // the server's choice from now on
+	}
+	if !slices.Contains(p.received[space], pn) {
+		p.received[space] = append(p.received[space], pn)
+	}
+	p.ackDue[space] = true
+	crypto, err := parseQUICFrames(frames)
+	if err != nil {
+		return err
+	}
+	for _, f := range crypto {
+		if !p.in[space].add(f) {
+			return errors.New("server handshake too large")
+		}
+	}
+	if data := p.in[space].data; len(data) > p.fed[space] {
+		level := tls.QUICEncryptionLevelInitial
+		if space == spaceHandshake {
+			level = tls.QUICEncryptionLevelHandshake
+		}
+		err := p.tls.HandleData(level, data[p.fed[space]:])
+		p.fed[space] = len(data)
+		if errors.Is(err, errQUICProbeDone) {
+			p.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return p.events()
+	}
+	return nil
+}
+
+// ackFrame acknowledges the packet numbers in pns.
+func ackFrame(pns []uint64) []byte {
+	sorted := slices.Clone(pns)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	// ranges of consecutive numbers, largest first, as [largest, smallest]
+	var ranges [][2]uint64
+	for _, pn := range sorted {
+		if n := len(ranges); n > 0 && ranges[n-1][1] == pn+1 {
+			ranges[n-1][1] = pn
+			continue
+		}
+		ranges = append(ranges, [2]uint64{pn, pn})
+	}
+	b := []byte{0x02}
+	b = appendQUICVarint(b, ranges[0][0])
+	b = appendQUICVarint(b, 0) // ack delay
+	b = appendQUICVarint(b, uint64(len(ranges)-1))
+	b = appendQUICVarint(b, ranges[0][0]-ranges[0][1])
+	for i := 1; i < len(ranges); i++ {
+		b = appendQUICVarint(b, ranges[i-1][1]-ranges[i][0]-2) // gap
+		b = appendQUICVarint(b, ranges[i][0]-ranges[i][1])
+	}
+	return b
+}
+
+// maxCryptoChunk is the CRYPTO data put in one packet, so that a datagram
+// with an Initial and a Handshake packet stays under common path MTUs.
+const maxCryptoChunk = 1000
+
+// flush sends the CRYPTO data not sent yet and the acknowledgments due, an
+// Initial and a Handshake packet per datagram. Datagrams with an Initial
+// packet are padded to quicMinInitial bytes, as clients must.
+func (p *quicProbe) flush() error {
+	for {
+		var payloads [quicSpaces][]byte
+		any := false
+		for space := range quicSpaces {
+			if p.send[space] == nil {
+				continue
+			}
+			var f []byte
+			if p.ackDue[space] {
+				f = ackFrame(p.received[space])
+				p.ackDue[space] = false
+			}
+			if rest := p.out[space][p.sent[space]:]; len(rest) > 0 {
+				chunk := rest[:min(len(rest), maxCryptoChunk)]
+				f = append(f, 0x06)
+				f = appendQUICVarint(f, uint64(p.sent[space]))
+				f = appendQUICVarint(f, uint64(len(chunk)))
+				f = append(f, chunk...)
+				p.sent[space] += len(chunk)
+			}
+			if len(f) > 0 {
+				payloads[space], any = f, true
+			}
+		}
+		if !any {
+			return nil
+		}
+		var hs []byte
+		if payloads[spaceHandshake] != nil {
+			hs = p.seal(spaceHandshake, payloads[spaceHandshake])
+		}
+		datagram := hs
+		if payloads[spaceInitial] != nil {
+			initial := p.seal(spaceInitial, payloads[spaceInitial])
+			if short := quicMinInitial - len(initial) - len(hs); short > 0 {
+				p.nextPN[spaceInitial]--
+				initial = p.seal(spaceInitial, append(payloads[spaceInitial], make([]byte, short)...))
+			}
+			datagram = append(initial, hs...)
+		}
+		if _, err := p.conn.Write(datagram); err != nil {
+			return err
+		}
+		probeMeter.add(ProbeTraffic{Sent: p.ip + udpHeaderLen + uint64(len(datagram))})
+	}
+}
+
+// seal protects payload as the next packet of space.
+func (p *quicProbe) seal(space int, payload []byte) []byte {
+	typ, token := quicInitial, p.token
+	if space == spaceHandshake {
+		typ, token = quicHandshake, nil
+	}
+	pn := p.nextPN[space]
+	p.nextPN[space]++
+	return p.send[space].sealQUIC(p.version, typ, p.dcid, p.scid, token, pn, payload)
+}
+
+// close tells the server the check is done, with a CONNECTION_CLOSE
+// without error, so it does not wait for the rest of the handshake.
+func (p *quicProbe) close() {
+	frame := []byte{0x1c, 0, 0, 0} // NO_ERROR, no frame type, no reason
+	var datagram []byte
+	if p.send[spaceHandshake] != nil {
+		datagram = p.seal(spaceHandshake, frame)
+	} else {
+		datagram = p.seal(spaceInitial, append(frame, make([]byte, quicMinInitial-100)...))
+	}
+	if _, err := p.conn.Write(datagram); err == nil {
+		probeMeter.add(ProbeTraffic{Sent: p.ip + udpHeaderLen + uint64(len(datagram))})
+	}
+}
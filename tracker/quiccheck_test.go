@@ -0,0 +1,342 @@
+package tracker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// quicTestServer answers QUIC handshakes on loopback with crypto/tls, as
+// far as the quic check goes. It speaks versions, and first answers with a
+// Retry when retry is set.
+type quicTestServer struct {
+	t        *testing.T
+	conn     *net.UDPConn
+	versions []uint32
+	retry    bool
+	config   *tls.Config
+
+	mu     sync.Mutex
+	peers  map[string]*quicTestPeer
+	closed bool     // a client sent CONNECTION_CLOSE
+	sent   [][]byte // datagrams sent, first to last
+	got    [][]byte // datagrams received
+}
+
+// quicTestPeer is the server side of one client's handshake.
+type quicTestPeer struct {
+	version    uint32
+	dcid, scid []byte // the client's ID, and the server's
+	tls        *tls.QUICConn
+	send, recv [quicSpaces]*quicKeys
+	in         [quicSpaces]quicStream
+	fed        [quicSpaces]int
+	pn         [quicSpaces]uint64
+	sent       [quicSpaces]int // CRYPTO bytes sent
+}
+
+func startQUICTestServer(t *testing.T, retry bool, versions ...uint32) *quicTestServer {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &quicTestServer{
+		t: t, conn: conn, versions: versions, retry: retry,
+		config: &tls.Config{
+			Certificates: []tls.Certificate{testCertificate(t, "quic.test")},
+			NextProtos:   []string{"h3"},
+			MinVersion:   tls.VersionTLS13,
+		},
+		peers: make(map[string]*quicTestPeer),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func testCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// waitClosed waits a while for the client's CONNECTION_CLOSE.
+func (s *quicTestServer) waitClosed() bool {
+	for range 100 {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func (s *quicTestServer) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *quicTestServer) serve() {
+	buf := make([]byte, 1<<16)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.got = append(s.got, append([]byte(nil), buf[:n]...))
+		for _, d := range s.handle(from.String(), buf[:n]) {
+			s.sent = append(s.sent, d)
+			s.conn.WriteToUDP(d, from)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// handle answers one datagram from the client at from.
+func (s *quicTestServer) handle(from string, b []byte) [][]byte {
+	h, err := parseQUICLongHeader(b)
+	if err != nil || h.version == 0 {
+		return nil
+	}
+	if !slices.Contains(s.versions, h.version) {
+		vn := []byte{0x80 | 0x4a, 0, 0, 0, 0, byte(len(h.scid))}
+		vn = append(vn, h.scid...)
+		vn = append(vn, byte(len(h.dcid)))
+		vn = append(vn, h.dcid...)
+		for _, v := range append([]uint32{0x1a2a3a4a}, s.versions...) {
+			vn = binary.BigEndian.AppendUint32(vn, v)
+		}
+		return [][]byte{vn}
+	}
+	p := s.peers[from]
+	if p == nil {
+		if h.typ != quicInitial {
+			return nil
+		}
+		if s.retry && len(h.token) == 0 {
+			wire := quicRetry
+			if h.version == quicV2 {
+				wire = (quicRetry + 1) & 3
+			}
+			retry := []byte{0xc0 | wire<<4}
+			retry = binary.BigEndian.AppendUint32(retry, h.version)
+			retry = append(retry, byte(len(h.scid)))
+			retry = append(retry, h.scid...)
+			retry = append(retry, 8, 'r', 'e', 't', 'r', 'y', 'c', 'i', 'd')
+			retry = append(retry, "token"...)
+			return [][]byte{append(retry, make([]byte, quicTagLen)...)}
+		}
+		p = &quicTestPeer{version: h.version, dcid: h.scid, scid: []byte("servercid")}
+		p.recv[spaceInitial], _ = quicInitialKeys(h.version, h.dcid, false)
+		p.send[spaceInitial], _ = quicInitialKeys(h.version, h.dcid, true)
+		p.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: s.config})
+		if err := p.tls.Start(context.Background()); err != nil {
+			s.t.Error(err)
+			return nil
+		}
+		s.peers[from] = p
+	}
+	var out [quicSpaces][]byte
+	for len(b) > 0 {
+		h, err := parseQUICLongHeader(b)
+		if err != nil {
+			break
+		}
+		pkt := b[:h.end]
+		b = b[h.end:]
+		space := spaceInitial
+		if h.typ == quicHandshake {
+			space = spaceHandshake
+		}
+		if p.recv[space] == nil {
+			continue
+		}
+		_, frames, err := p.recv[space].open(pkt, h)
+		if err != nil {
+			s.t.Errorf("server: %v", err)
+			continue
+		}
+		crypto, err := parseQUICFrames(frames)
+		if _, ok := err.(*QUICCloseError); ok {
+			s.closed = true
+		}
+		for _, f := range crypto {
+			p.in[space].add(f)
+		}
+		if data := p.in[space].data; len(data) > p.fed[space] {
+			level := tls.QUICEncryptionLevelInitial
+			if space == spaceHandshake {
+				level = tls.QUICEncryptionLevelHandshake
+			}
+			if err := p.tls.HandleData(level, data[p.fed[space]:]); err != nil {
+				s.t.Errorf("server: %v", err)
+			}
+			p.fed[space] = len(data)
+			s.events(p, &out)
+		}
+	}
+	return p.datagrams(out)
+}
+
+// events takes what the server's TLS handshake produced.
+func (s *quicTestServer) events(p *quicTestPeer, out *[quicSpaces][]byte) {
+	for {
+		e := p.tls.NextEvent()
+		space := quicSpace(e.Level)
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return
+		case tls.QUICTransportParametersRequired:
+			p.tls.SetTransportParameters(quicTransportParams(p.scid))
+		case tls.QUICWriteData:
+			if space >= 0 {
+				out[space] = append(out[space], e.Data...)
+			}
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			if space != spaceHandshake {
+				continue
+			}
+			k, err := quicSuiteKeys(p.version, e.Suite, e.Data)
+			if err != nil {
+				s.t.Error(err)
+				continue
+			}
+			if e.Kind == tls.QUICSetReadSecret {
+				p.recv[space] = k
+			} else {
+				p.send[space] = k
+			}
+		}
+	}
+}
+
+// datagrams packs the server's CRYPTO data: the Initial packet and the
+// first Handshake packet together, the rest of the flight after them.
+func (p *quicTestPeer) datagrams(out [quicSpaces][]byte) [][]byte {
+	var ds [][]byte
+	var d []byte
+	for space := range quicSpaces {
+		typ := quicInitial
+		if space == spaceHandshake {
+			typ = quicHandshake
+		}
+		for off := 0; off < len(out[space]); off += maxCryptoChunk {
+			chunk := out[space][off:min(len(out[space]), off+maxCryptoChunk)]
+			f := []byte{0x06}
+			f = appendQUICVarint(f, uint64(p.sent[space]+off))
+			f = appendQUICVarint(f, uint64(len(chunk)))
+			f = append(f, chunk...)
+			d = append(d, p.send[space].sealQUIC(p.version, typ, p.dcid, p.scid, nil, p.pn[space], f)...)
+			p.pn[space]++
+			if len(d) > maxCryptoChunk {
+				ds, d = append(ds, d), nil
+			}
+		}
+		p.sent[space] += len(out[space])
+	}
+	if d != nil {
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+func TestCheckQUIC(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    bool
+		versions []uint32
+		status   string
+		err      string
+	}{
+		{"v1", false, []uint32{quicV1, quicV2}, "v1 h3", ""},
+		{"v2 after version negotiation", false, []uint32{quicV2}, "v2 h3", ""},
+		{"retry", true, []uint32{quicV1}, "v1 h3", ""},
+		{"no common version", false, []uint32{0xff00001d, 0x51303436}, "", "server offers only QUIC 0x1a2a3a4a, draft-29, Q046"},
+	}
+	for _, tt := range tests {
+		s := startQUICTestServer(t, tt.retry, tt.versions...)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var r ServiceCheck
+		err := checkQUIC(ctx, s.addr(), "quic.test", &r)
+		cancel()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !r.OK || r.Status != tt.status || r.Cert != "quic.test" || r.Latency <= 0 {
+			t.Errorf("%s: %+v", tt.name, r)
+		}
+		if !s.waitClosed() {
+			t.Errorf("%s: the check did not close the connection", tt.name)
+		}
+		s.mu.Lock()
+		for i, d := range s.got {
+			if h, err := parseQUICLongHeader(d); err == nil && h.typ == quicInitial && len(d) < quicMinInitial {
+				t.Errorf("%s: datagram %d with an Initial packet is %d bytes", tt.name, i, len(d))
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestQUICServiceCheck(t *testing.T) {
+	def, err := ParseServiceCheck("h3", "QUIC", 443, "", "", "", "", "", "2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startQUICTestServer(t, false, quicV1)
+	_, port, _ := net.SplitHostPort(s.addr())
+	p, _ := strconv.Atoi(port)
+	before := probeMeter.snapshot().Session
+	r := runServiceCheck(def, "127.0.0.1", p, true, "quic.test")
+	if !r.OK || !strings.HasPrefix(r.Summary(), "quic v1 h3 cert quic.test in ") {
+		t.Errorf("summary %q, error %q", r.Summary(), r.Err)
+	}
+	if r.Target != "quic.test:"+port {
+		t.Errorf("target %q", r.Target)
+	}
+	if after := probeMeter.snapshot().Session; after.Sent-before.Sent < quicMinInitial || after.Received == before.Received {
+		t.Errorf("probe traffic not metered: %+v then %+v", before, after)
+	}
+
+	// Nothing listening: the ICMP error, or the timeout, fails the check.
+	s.conn.Close()
+	if r := runServiceCheck(def, "127.0.0.1", p, true, ""); r.OK || r.Err == "" {
+		t.Errorf("check against a closed port: %+v", r)
+	}
+}
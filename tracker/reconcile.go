@@ -0,0 +1,129 @@
+package tracker
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+)
+
+// Scanners recorded in Connection.Provenance.
+const (
+	ProvenanceProc      = "proc"      // /proc/net tables, including other namespaces' with -all-netns
+	ProvenanceSS        = "ss"        // the ss backend
+	ProvenanceIphlpapi  = "iphlpapi"  // Windows socket tables
+	ProvenanceDemo      = "demo"      // the -demo simulation
+	ProvenanceConntrack = "conntrack" // forwarded flows from the connection tracking table
+)
+
+// stateRank orders TCP states along a socket's life, so that when two
+// reports of one socket disagree the one further along, which was read
+// later, wins. States off that path rank 0 and lose to any on it.
+var stateRank = map[ConnState]int{
+	StateSynSent: 1, StateSynRecv: 1,
+	StateEstablished: 2,
+	StateFinWait1:    3, StateCloseWait: 3,
+	StateFinWait2: 4, StateClosing: 4, StateLastAck: 4,
+	StateTimeWait: 5,
+	StateClosed:   6,
+}
+
+// flowKey is a socket's 5-tuple in canonical form: addresses already
+// unmapped by normalizeFamily, tcp6 carrying IPv4 counted as tcp, and
+// scoped to its host and namespace, so reports of one socket from
+// different sources meet.
+func flowKey(c *Connection) string {
+	return c.Host + "|" + c.Namespace + "|" + c.DisplayProtocol() + "|" +
+		c.LocalAddr + ":" + strconv.Itoa(c.LocalPort) + "->" +
+		c.RemoteAddr + ":" + strconv.Itoa(c.RemotePort)
+}
+
+// reconcile merges the connections of one scan that are the same socket
+// reported twice, by two sources or by one source reading a table while it
+// changed, and returns the rest in scan order. Two reports are the same
+// socket when their flowKeys match and their PIDs and socket inodes each
+// agree or are missing from one; two PIDs or inodes on one tuple are
+// separate sockets (SO_REUSEPORT listeners). See mergeInto for which report
+// each field comes from.
+func reconcile(conns []*Connection) []*Connection {
+	byKey := make(map[string][]*Connection, len(conns))
+	out := make([]*Connection, 0, len(conns))
+	for _, c := range conns {
+		k := flowKey(c)
+		var into *Connection
+		for _, prev := range byKey[k] {
+			if agree(prev.PID, c.PID, 0) && agree(prev.inode, c.inode, "") {
+				into = prev
+				break
+			}
+		}
+		if into == nil {
+			byKey[k] = append(byKey[k], c)
+			out = append(out, c)
+			continue
+		}
+		mergeInto(into, c)
+	}
+	return out
+}
+
+// agree reports whether a and b are equal or either is the zero value.
+func agree[T comparable](a, b, zero T) bool {
+	return a == b || a == zero || b == zero
+}
+
+// mergeInto folds dup, a later report of the same socket, into c:
+//   - identity (PID, app name, protocol) comes from the report with a PID,
+//     else from c; the socket inode from whichever has one
+//   - byte counters from the report that has them, else from c; likewise
+//     the socket queues, kernel RTT, TCP info, QoS marking and congestion control
+//   - the state from the report further along the socket's life, ties and
+//     states off the path going to the identity's report
+//   - direction from the identity's report
+//   - Provenance is the union of both, in order
+func mergeInto(c, dup *Connection) {
+	id := c
+	if c.PID == 0 && dup.PID != 0 {
+		id = dup
+	}
+	other := dup
+	if id == dup {
+		other = c
+	}
+
+	if rank, idRank := stateRank[other.State], stateRank[id.State]; rank > idRank || id.State == StateUnknown {
+		c.State = other.State
+	} else {
+		c.State = id.State
+	}
+	c.PID, c.AppName, c.Protocol, c.Direction = id.PID, id.AppName, id.Protocol, id.Direction
+	c.V4Mapped, c.inode = id.V4Mapped, cmp.Or(id.inode, other.inode)
+
+	if !c.HasByteCounts && dup.HasByteCounts {
+		c.TxBytes, c.RxBytes, c.HasByteCounts = dup.TxBytes, dup.RxBytes, true
+	}
+	if !c.HasQueues && dup.HasQueues {
+		c.SendQ, c.RecvQ, c.HasQueues = dup.SendQ, dup.RecvQ, true
+	}
+	if c.KernelRTT == 0 {
+		c.KernelRTT = dup.KernelRTT
+	}
+	if c.TCPInfo == nil {
+		c.TCPInfo = dup.TCPInfo
+	}
+	if c.QoS == nil {
+		c.QoS = dup.QoS
+	}
+	if c.CongestionAlgo == "" {
+		c.CongestionAlgo, c.BBR = dup.CongestionAlgo, dup.BBR
+	}
+	if c.SockMemInfo == nil {
+		c.SockMem, c.SockMemInfo = dup.SockMem, dup.SockMemInfo
+	}
+
+	for _, p := range dup.Provenance {
+		if !slices.Contains(c.Provenance, p) {
+			c.Provenance = append(c.Provenance, p)
+		}
+	}
+	c.Merged++
+}
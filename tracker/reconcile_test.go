@@ -0,0 +1,131 @@
+package tracker
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// report is one source's view of the socket 10.0.0.2:40443 -> 192.0.2.1:443,
+// with what that source knows: proc the inode and queues, ss the byte
+// counters and TCP info, iphlpapi only the owner.
+func report(source string, pid int, state ConnState) *Connection {
+	c := &Connection{
+		AppName: fmt.Sprintf("app%d", pid), PID: pid, Protocol: "tcp", State: state, Direction: Outbound,
+		LocalAddr: "10.0.0.2", LocalPort: 40443, RemoteAddr: "192.0.2.1", RemotePort: 443,
+		Provenance: []string{source},
+	}
+	switch source {
+	case ProvenanceProc:
+		c.inode = "4711"
+		c.SendQ, c.RecvQ, c.HasQueues = 10, 20, true
+	case ProvenanceSS:
+		c.TxBytes, c.RxBytes, c.HasByteCounts = 1000, 2000, true
+		c.TCPInfo = &TCPInfo{}
+		c.KernelRTT = 5
+	}
+	return c
+}
+
+func TestReconcileSourcePairs(t *testing.T) {
+	sources := []string{ProvenanceProc, ProvenanceSS, ProvenanceIphlpapi, ProvenanceDemo}
+	for _, a := range sources {
+		for _, b := range sources {
+			first, second := report(a, 100, StateEstablished), report(b, 100, StateEstablished)
+			out := reconcile([]*Connection{first, second})
+			name := a + "+" + b
+			if len(out) != 1 || out[0] != first {
+				t.Errorf("%s: %d connections", name, len(out))
+				continue
+			}
+			c := out[0]
+			want := []string{a}
+			if b != a {
+				want = append(want, b)
+			}
+			if !slices.Equal(c.Provenance, want) || c.Merged != 1 {
+				t.Errorf("%s: provenance %v, merged %d", name, c.Provenance, c.Merged)
+			}
+			hasProc, hasSS := a == ProvenanceProc || b == ProvenanceProc, a == ProvenanceSS || b == ProvenanceSS
+			if (c.inode == "4711") != hasProc || c.HasQueues != hasProc || hasProc && c.RecvQ != 20 {
+				t.Errorf("%s: inode %q, queues %v", name, c.inode, c.HasQueues)
+			}
+			if c.HasByteCounts != hasSS || (c.TCPInfo != nil) != hasSS || hasSS && (c.RxBytes != 2000 || c.KernelRTT != 5) {
+				t.Errorf("%s: byte counts %v (%d), TCP info %v", name, c.HasByteCounts, c.RxBytes, c.TCPInfo != nil)
+			}
+		}
+	}
+}
+
+func TestReconcileConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      *Connection
+		n         int // connections out
+		state     ConnState
+		pid       int
+		direction Direction
+	}{
+		{"same state", report(ProvenanceProc, 100, StateEstablished), report(ProvenanceSS, 100, StateEstablished), 1, StateEstablished, 100, Outbound},
+		{"later state wins", report(ProvenanceProc, 100, StateEstablished), report(ProvenanceSS, 100, StateFinWait1), 1, StateFinWait1, 100, Outbound},
+		{"later state wins, either order", report(ProvenanceSS, 100, StateTimeWait), report(ProvenanceProc, 100, StateEstablished), 1, StateTimeWait, 100, Outbound},
+		{"SYN_SENT then ESTABLISHED", report(ProvenanceProc, 100, StateSynSent), report(ProvenanceProc, 100, StateEstablished), 1, StateEstablished, 100, Outbound},
+		{"unknown loses", report(ProvenanceProc, 100, StateUnknown), report(ProvenanceSS, 100, StateCloseWait), 1, StateCloseWait, 100, Outbound},
+		{"off-path state loses to the owner's", report(ProvenanceProc, 100, StateEstablished), report(ProvenanceSS, 100, StateListening), 1, StateEstablished, 100, Outbound},
+		{"tie goes to the owner's report", func() *Connection {
+			c := report(ProvenanceProc, 0, StateFinWait1)
+			c.AppName = ""
+			return c
+		}(), func() *Connection {
+			c := report(ProvenanceSS, 100, StateCloseWait)
+			c.Direction = Inbound
+			return c
+		}(), 1, StateCloseWait, 100, Inbound},
+		{"owner from the report with a PID", func() *Connection {
+			c := report(ProvenanceProc, 0, StateEstablished)
+			c.AppName = ""
+			return c
+		}(), report(ProvenanceSS, 100, StateEstablished), 1, StateEstablished, 100, Outbound},
+		{"two PIDs: two sockets", report(ProvenanceProc, 100, StateListening), report(ProvenanceSS, 200, StateListening), 2, StateListening, 100, Outbound},
+		{"two inodes: two sockets", report(ProvenanceProc, 100, StateEstablished), func() *Connection {
+			c := report(ProvenanceProc, 100, StateEstablished)
+			c.inode = "4712"
+			return c
+		}(), 2, StateEstablished, 100, Outbound},
+		{"other host: not merged", report(ProvenanceSS, 100, StateEstablished), func() *Connection {
+			c := report(ProvenanceSS, 100, StateEstablished)
+			c.Host = "edge-1"
+			return c
+		}(), 2, StateEstablished, 100, Outbound},
+	}
+	for _, tt := range tests {
+		out := reconcile([]*Connection{tt.a, tt.b})
+		if len(out) != tt.n {
+			t.Errorf("%s: %d connections, want %d", tt.name, len(out), tt.n)
+			continue
+		}
+		c := out[0]
+		if c.State != tt.state || c.PID != tt.pid || c.Direction != tt.direction {
+			t.Errorf("%s: %s pid %d %s, want %s pid %d %s", tt.name, c.State, c.PID, c.Direction, tt.state, tt.pid, tt.direction)
+		}
+		if tt.n == 1 && c.AppName != fmt.Sprintf("app%d", tt.pid) {
+			t.Errorf("%s: app %q", tt.name, c.AppName)
+		}
+	}
+}
+
+// TestReconcileMappedFamily merges an IPv4-mapped tcp6 report with the plain
+// tcp one, as normalizeFamily leaves them.
+func TestReconcileMappedFamily(t *testing.T) {
+	v4 := report(ProvenanceSS, 100, StateEstablished)
+	v6 := report(ProvenanceProc, 100, StateEstablished)
+	v6.Protocol, v6.LocalAddr, v6.RemoteAddr = "tcp6", "::ffff:10.0.0.2", "::ffff:192.0.2.1"
+	conns := []*Connection{v4, v6}
+	for _, c := range conns {
+		normalizeFamily(c)
+	}
+	out := reconcile(conns)
+	if len(out) != 1 || out[0].inode != "4711" || !out[0].HasByteCounts {
+		t.Fatalf("mapped report not merged: %d connections", len(out))
+	}
+}
@@ -0,0 +1,33 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// RecordFrame is one snapshot as written to a record file (one JSON object per line).
+type RecordFrame struct {
+	Time        time.Time     `json:"time"`
+	Alerts      []Alert       `json:"alerts,omitempty"`
+	Connections []*Connection `json:"connections"`
+	Truncated   int           `json:"truncated,omitempty"` // connections dropped to bound frame size
+}
+
+// createRecordFile opens a new record file named <prefix>-<timestamp>.jsonl.
+// If that name is taken, a numeric suffix is appended until an unused name is found.
+func createRecordFile(prefix string, now time.Time) (*os.File, error) {
+	base := fmt.Sprintf("%s-%s", prefix, now.Format("20060102-150405"))
+	name := base + ".jsonl"
+	for i := 1; i < 1000; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		name = fmt.Sprintf("%s-%d.jsonl", base, i)
+	}
+	return nil, fmt.Errorf("no free record file name for %s", base)
+}
@@ -0,0 +1,191 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+)
+
+// Retrying unresolved socket owners. A socket whose process could not be
+// found during a scan (the process had only just started, or its fd
+// directory was briefly unreadable) would show "unknown" until the next
+// scan, which can be a long time with a long interval. Instead it is
+// queued and looked up again shortly after, a few times with backoff.
+const (
+	maxResolveQueue   = 256                    // connections waiting for a retry
+	resolveAttempts   = 4                      // retries before giving up
+	resolveFirstRetry = 200 * time.Millisecond // doubles after each failure
+)
+
+// resolveFunc looks up the owner of c's socket again. ok is false while it
+// still cannot be found.
+type resolveFunc func(c *Connection) (pid int, name string, ok bool)
+
+// resolveItem is a queued connection. conn is a copy, so the lookup runs
+// without the tracker lock.
+type resolveItem struct {
+	conn     Connection
+	attempts int
+	next     time.Time
+	busy     bool // being looked up right now
+}
+
+// resolveQueue holds the connections waiting for an owner lookup, keyed by
+// Key(). It is safe for concurrent use.
+type resolveQueue struct {
+	mu      sync.Mutex
+	items   map[string]*resolveItem
+	max     int
+	resolve resolveFunc
+	wake    chan struct{}
+}
+
+func newResolveQueue(resolve resolveFunc, max int) *resolveQueue {
+	return &resolveQueue{
+		items:   make(map[string]*resolveItem),
+		max:     max,
+		resolve: resolve,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// add queues c for its first retry. It reports false when c is already
+// queued or the queue is full.
+func (q *resolveQueue) add(c *Connection, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := c.Key()
+	if _, ok := q.items[key]; ok || len(q.items) >= q.max {
+		return false
+	}
+	q.items[key] = &resolveItem{conn: *c, next: now.Add(resolveFirstRetry)}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// forget drops key, for a connection that closed or was resolved.
+func (q *resolveQueue) forget(key string) {
+	q.mu.Lock()
+	delete(q.items, key)
+	q.mu.Unlock()
+}
+
+// Len is the number of queued connections.
+func (q *resolveQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// due marks the items whose retry time has come as busy and returns them.
+func (q *resolveQueue) due(now time.Time) map[string]*resolveItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	due := make(map[string]*resolveItem)
+	for key, it := range q.items {
+		if !it.busy && !now.Before(it.next) {
+			it.busy = true
+			due[key] = it
+		}
+	}
+	return due
+}
+
+// failed schedules the next retry of it, or drops it after the last
+// attempt. An item forgotten while it was being looked up stays dropped.
+func (q *resolveQueue) failed(key string, it *resolveItem, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.items[key] != it {
+		return
+	}
+	it.attempts++
+	if it.attempts >= resolveAttempts {
+		delete(q.items, key)
+		return
+	}
+	it.busy = false
+	it.next = now.Add(resolveFirstRetry << it.attempts)
+}
+
+// nextRetry is when the earliest queued item is due; zero if none is.
+func (q *resolveQueue) nextRetry() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next time.Time
+	for _, it := range q.items {
+		if !it.busy && (next.IsZero() || it.next.Before(next)) {
+			next = it.next
+		}
+	}
+	return next
+}
+
+// runResolveQueue retries queued lookups until the tracker stops, merging
+// every owner found into its live connection.
+func (t *Tracker) runResolveQueue() {
+	q := t.resolveQueue
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		for key, it := range q.due(time.Now()) {
+			if pid, name, ok := q.resolve(&it.conn); ok {
+				q.forget(key)
+				t.applyResolved(key, pid, name)
+			} else {
+				q.failed(key, it, time.Now())
+			}
+		}
+
+		wait := time.Hour
+		if next := q.nextRetry(); !next.IsZero() {
+			wait = time.Until(next)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// applyResolved gives the connection at key its owner. The PID is part of
+// the key, so the connection moves to its new key, which is also what the
+// next scan will report for it. Classification that depends on the process
+// is redone.
+func (t *Tracker) applyResolved(key string, pid int, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.connections[key]
+	if !ok {
+		return
+	}
+	oldPID, oldName := c.PID, c.AppName
+	c.PID, c.AppName = pid, name
+	if newKey := c.Key(); newKey != key {
+		if _, taken := t.connections[newKey]; taken {
+			// A scan already found it under its owner; this one is about to close.
+			c.PID, c.AppName = oldPID, oldName
+			return
+		}
+		delete(t.connections, key)
+		t.connections[newKey] = c
+	}
+	c.Encryption, c.EncryptionSource = ClassifyEncryption(c, t.encOverrides, t.hasTLSLib(pid))
+	if t.auditor != nil {
+		c.ExePath = t.exePath(pid)
+		c.Audit = t.auditor.Evaluate(c.ExePath)
+	}
+	rememberOwner(pid)
+	t.touch()
+}
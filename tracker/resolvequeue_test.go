@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveQueueBackoff(t *testing.T) {
+	q := newResolveQueue(nil, 2)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a, b, c := fakeConn("", "192.0.2.1", 443), fakeConn("", "192.0.2.2", 443), fakeConn("", "192.0.2.3", 443)
+	a.PID, b.PID, c.PID = 0, 0, 0
+	if !q.add(&a, t0) || q.add(&a, t0) {
+		t.Fatal("first add refused, or a second add of the same socket accepted")
+	}
+	q.add(&b, t0.Add(10*time.Second))
+	if q.add(&c, t0) {
+		t.Error("add past the bound accepted")
+	}
+
+	// Retries come after 200ms, 400ms, 800ms and 1.6s; then a is dropped.
+	at := t0
+	for attempt := range resolveAttempts {
+		at = at.Add(resolveFirstRetry << attempt)
+		if due := q.due(at.Add(-time.Millisecond)); len(due) != 0 {
+			t.Fatalf("attempt %d: due %v early", attempt+1, keys(due))
+		}
+		due := q.due(at)
+		it, ok := due[a.Key()]
+		if !ok {
+			t.Fatalf("attempt %d: not due at %s", attempt+1, at.Sub(t0))
+		}
+		if len(q.due(at)) != 0 {
+			t.Fatal("an item being looked up handed out twice")
+		}
+		q.failed(a.Key(), it, at)
+	}
+	if q.Len() != 1 {
+		t.Errorf("%d queued after the last attempt, want only b", q.Len())
+	}
+
+	// A connection that closes while it is looked up stays dropped.
+	due := q.due(t0.Add(time.Hour))
+	q.forget(b.Key())
+	q.failed(b.Key(), due[b.Key()], t0.Add(time.Hour))
+	if q.Len() != 0 || !q.nextRetry().IsZero() {
+		t.Errorf("forgotten item came back: %d queued", q.Len())
+	}
+}
+
+func keys(m map[string]*resolveItem) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+// failingResolver finds the owner on its fails+1th call.
+type failingResolver struct {
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+func (f *failingResolver) resolve(c *Connection) (int, string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.fails {
+		return 0, "", false
+	}
+	return 4242, "late", true
+}
+
+func TestResolveQueueMergesOwner(t *testing.T) {
+	r := &failingResolver{fails: 2}
+	tr := NewTracker(time.Hour, false)
+	tr.resolveQueue = newResolveQueue(r.resolve, maxResolveQueue)
+	c := fakeConn("", "192.0.2.1", 443)
+	c.PID = 0
+	oldKey := c.Key()
+	live := c
+	tr.connections[oldKey] = &live
+	gen := tr.Generation()
+	tr.resolveQueue.add(&c, time.Now())
+	go tr.runResolveQueue()
+	defer close(tr.stopCh)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tr.mu.Lock()
+		var found Connection
+		var key string
+		for k, conn := range tr.connections {
+			key, found = k, *conn
+		}
+		n := len(tr.connections)
+		tr.mu.Unlock()
+		if found.PID == 4242 {
+			if n != 1 || found.AppName != "late" || key == oldKey || key != found.Key() {
+				t.Errorf("merged connection %s under %q among %d", found.AppName, key, n)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("owner not merged after %d lookups", r.calls)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if r.calls != 3 {
+		t.Errorf("%d lookups, want 3", r.calls)
+	}
+	if tr.Generation() == gen {
+		t.Error("generation not moved on: the UI would not redraw")
+	}
+	if tr.resolveQueue.Len() != 0 {
+		t.Error("resolved connection still queued")
+	}
+}
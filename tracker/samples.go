@@ -0,0 +1,181 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// sampleWindow is how many accepted RTTs per host the median and the
+	// median absolute deviation (MAD) are taken over.
+	sampleWindow = 16
+	// minOutlierSamples is how many accepted RTTs a host needs before any
+	// sample is rejected as an outlier.
+	minOutlierSamples = 5
+	// stepConfirm is how many outliers in a row on the same side are taken
+	// as a step change of the path (a reroute, a VPN coming up) rather than
+	// spikes: the window restarts from them and the last one is accepted.
+	stepConfirm = 3
+	// sampleHostTTL is how long a host's samples are kept without a probe;
+	// after that its next probe counts as a warm-up again.
+	sampleHostTTL = 5 * time.Minute
+)
+
+// SampleFilter is the hygiene applied to every probe RTT, whichever probe
+// method measured it, before it becomes a connection's Ping.
+type SampleFilter struct {
+	// WarmUp drops the first sample of each host: its TCP connect often
+	// pays for DNS, ARP/ND or conntrack setup and runs 3-10x the steady RTT.
+	WarmUp bool
+	// OutlierK rejects samples more than OutlierK median absolute
+	// deviations from the host's median; 0 turns rejection off.
+	OutlierK float64
+}
+
+// DefaultSampleFilter drops warm-up samples and rejects beyond 5 MADs.
+var DefaultSampleFilter = SampleFilter{WarmUp: true, OutlierK: 5}
+
+// ParseSampleFilter builds the filter from the no_ping_warmup and
+// ping_outlier_mad config settings: mad 0 means the default, a negative
+// value turns outlier rejection off.
+func ParseSampleFilter(noWarmUp bool, mad float64) (SampleFilter, error) {
+	f := DefaultSampleFilter
+	f.WarmUp = !noWarmUp
+	switch {
+	case math.IsNaN(mad) || math.IsInf(mad, 0):
+		return SampleFilter{}, fmt.Errorf("ping_outlier_mad: invalid value %v", mad)
+	case mad < 0:
+		f.OutlierK = 0
+	case mad > 0:
+		f.OutlierK = mad
+	}
+	return f, nil
+}
+
+// SampleVerdict is what the filter made of one RTT sample.
+type SampleVerdict int
+
+const (
+	SampleAccepted SampleVerdict = iota
+	SampleWarmUp                 // the host's first sample, not used
+	SampleOutlier                // beyond OutlierK MADs, not used
+)
+
+// rttSamples is the recent RTT history of one remote host, shared by all
+// connections to it.
+type rttSamples struct {
+	accepted    []time.Duration // the last sampleWindow accepted RTTs, oldest first
+	pending     []time.Duration // outliers in a row, all on one side of the median
+	pendingHigh bool            // the side of pending
+	warmedUp    bool
+	lastSeen    time.Time
+	outage      outage // the current run of failed probes
+}
+
+// add judges rtt against the history and records it.
+func (s *rttSamples) add(rtt time.Duration, f SampleFilter) SampleVerdict {
+	if f.WarmUp && !s.warmedUp {
+		s.warmedUp = true
+		return SampleWarmUp
+	}
+	s.warmedUp = true
+	if f.OutlierK > 0 && len(s.accepted) >= minOutlierSamples {
+		med := medianDuration(s.accepted)
+		if high, out := isOutlier(rtt, med, s.accepted, f.OutlierK); out {
+			if len(s.pending) > 0 && s.pendingHigh != high {
+				s.pending = s.pending[:0]
+			}
+			s.pending = append(s.pending, rtt)
+			s.pendingHigh = high
+			if len(s.pending) < stepConfirm {
+				return SampleOutlier
+			}
+			// The path itself moved: start over from the new level.
+			s.accepted = append(s.accepted[:0], s.pending...)
+			s.pending = s.pending[:0]
+			return SampleAccepted
+		}
+	}
+	s.pending = s.pending[:0]
+	s.accepted = append(s.accepted, rtt)
+	if over := len(s.accepted) - sampleWindow; over > 0 {
+		s.accepted = append(s.accepted[:0], s.accepted[over:]...)
+	}
+	return SampleAccepted
+}
+
+// isOutlier reports whether rtt lies more than k MADs from med, and on
+// which side. The MAD has a floor of a tenth of the median and 500µs, so a
+// very steady history does not reject ordinary jitter.
+func isOutlier(rtt, med time.Duration, window []time.Duration, k float64) (high, out bool) {
+	dev := make([]time.Duration, len(window))
+	for i, v := range window {
+		dev[i] = absDuration(v - med)
+	}
+	mad := max(medianDuration(dev), med/10, 500*time.Microsecond)
+	d := rtt - med
+	return d > 0, float64(absDuration(d)) > k*float64(mad)
+}
+
+// medianDuration returns the median of vs, which it does not modify.
+func medianDuration(vs []time.Duration) time.Duration {
+	s := slices.Clone(vs)
+	slices.Sort(s)
+	n := len(s)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// hostSamples returns addr's history, starting one if needed, and marks
+// the host probed at now. Caller must hold the tracker lock.
+func (t *Tracker) hostSamples(addr string, now time.Time) *rttSamples {
+	if t.samples == nil {
+		t.samples = make(map[string]*rttSamples)
+	}
+	s := t.samples[addr]
+	if s == nil {
+		s = &rttSamples{}
+		t.samples[addr] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// filterSample runs a successful probe's RTT to addr through the sample
+// filter. Caller must hold the tracker lock.
+func (t *Tracker) filterSample(addr string, rtt time.Duration, now time.Time) SampleVerdict {
+	return t.hostSamples(addr, now).add(rtt, t.sampleFilter)
+}
+
+// pruneSamples forgets hosts not probed for sampleHostTTL, with any outage
+// still open: nothing is left to probe them. Caller must hold the tracker
+// lock.
+func (t *Tracker) pruneSamples(now time.Time) {
+	for addr, s := range t.samples {
+		if now.Sub(s.lastSeen) > sampleHostTTL {
+			delete(t.samples, addr)
+		}
+	}
+}
+
+// SetSampleFilter sets the warm-up and outlier rules for probe RTTs. It is
+// safe to call while the tracker is running.
+func (t *Tracker) SetSampleFilter(f SampleFilter) {
+	t.mu.Lock()
+	t.sampleFilter = f
+	t.mu.Unlock()
+}
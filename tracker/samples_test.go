@@ -0,0 +1,108 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSampleFilterStreams(t *testing.T) {
+	const (
+		A = SampleAccepted
+		W = SampleWarmUp
+		O = SampleOutlier
+	)
+	tests := []struct {
+		name string
+		f    SampleFilter
+		ms   []int
+		want []SampleVerdict
+	}{
+		{"warm-up", DefaultSampleFilter, []int{80, 20, 21, 20}, []SampleVerdict{W, A, A, A}},
+		{"spike", DefaultSampleFilter, []int{90, 20, 21, 19, 20, 22, 200, 20}, []SampleVerdict{W, A, A, A, A, A, O, A}},
+		{"too few samples to judge", DefaultSampleFilter, []int{90, 20, 21, 19, 200}, []SampleVerdict{W, A, A, A, A}},
+		{"step change", DefaultSampleFilter, []int{90, 20, 21, 19, 20, 22, 60, 61, 59, 60, 62}, []SampleVerdict{W, A, A, A, A, A, O, O, A, A, A}},
+		{"step down", DefaultSampleFilter, []int{90, 60, 61, 59, 60, 62, 20, 21, 20, 200}, []SampleVerdict{W, A, A, A, A, A, O, O, A, A}},
+		{"spikes both ways are no step", DefaultSampleFilter, []int{90, 20, 21, 19, 20, 22, 60, 5, 60, 60, 20}, []SampleVerdict{W, A, A, A, A, A, O, O, O, O, A}},
+		{"jitter under the MAD floor", DefaultSampleFilter, []int{90, 20, 20, 20, 20, 20, 29, 11}, []SampleVerdict{W, A, A, A, A, A, A, A}},
+		{"off", SampleFilter{}, []int{90, 20, 21, 19, 20, 22, 200}, []SampleVerdict{A, A, A, A, A, A, A}},
+		{"warm-up only", SampleFilter{WarmUp: true}, []int{90, 20, 21, 19, 20, 22, 200}, []SampleVerdict{W, A, A, A, A, A, A}},
+		{"tighter", SampleFilter{OutlierK: 2}, []int{20, 21, 19, 20, 22, 25}, []SampleVerdict{A, A, A, A, A, O}},
+	}
+	for _, tt := range tests {
+		var s rttSamples
+		for i, ms := range tt.ms {
+			if got := s.add(time.Duration(ms)*time.Millisecond, tt.f); got != tt.want[i] {
+				t.Errorf("%s: sample %d (%dms) %d, want %d", tt.name, i+1, ms, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSampleWindowBound(t *testing.T) {
+	var s rttSamples
+	for i := range 3 * sampleWindow {
+		s.add(time.Duration(20+i%3)*time.Millisecond, DefaultSampleFilter)
+	}
+	if len(s.accepted) != sampleWindow {
+		t.Errorf("%d samples kept, want %d", len(s.accepted), sampleWindow)
+	}
+}
+
+func TestParseSampleFilter(t *testing.T) {
+	tests := []struct {
+		noWarmUp bool
+		mad      float64
+		want     SampleFilter
+	}{
+		{false, 0, DefaultSampleFilter},
+		{true, 0, SampleFilter{OutlierK: 5}},
+		{false, 3.5, SampleFilter{WarmUp: true, OutlierK: 3.5}},
+		{true, -1, SampleFilter{}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSampleFilter(tt.noWarmUp, tt.mad); err != nil || got != tt.want {
+			t.Errorf("%v %v: %+v %v", tt.noWarmUp, tt.mad, got, err)
+		}
+	}
+	if _, err := ParseSampleFilter(false, math.Inf(1)); err == nil {
+		t.Error("infinite MAD accepted")
+	}
+}
+
+// TestRecordProbeFilters checks what the tracker does with each verdict,
+// and that a host not probed for sampleHostTTL warms up again.
+func TestRecordProbeFilters(t *testing.T) {
+	tr := NewTracker(time.Hour, false)
+	c := fakeConn("app", "192.0.2.1", 443)
+	conn := &c
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	probe := func(ms int, at time.Time) {
+		tr.recordProbe(conn, time.Duration(ms)*time.Millisecond, 0, nil, at)
+	}
+	probe(90, t0)
+	if conn.Ping != 0 || conn.RawPing != 90*time.Millisecond || conn.WarmUpSamples != 1 || conn.PingCount != 1 {
+		t.Errorf("warm-up: ping %v raw %v, %d warm-ups", conn.Ping, conn.RawPing, conn.WarmUpSamples)
+	}
+	for _, ms := range []int{20, 21, 19, 20, 22} {
+		probe(ms, t0)
+	}
+	probe(300, t0)
+	if conn.Ping != 22*time.Millisecond || conn.OutlierSamples != 1 || conn.LastSample != SampleOutlier {
+		t.Errorf("outlier: ping %v, %d outliers", conn.Ping, conn.OutlierSamples)
+	}
+
+	// A failed probe is no sample.
+	tr.recordProbe(conn, 0, 100, nil, t0)
+	if conn.LastSample != SampleAccepted || len(tr.samples["192.0.2.1"].accepted) != 5 {
+		t.Error("failed probe judged as a sample")
+	}
+
+	tr.pruneSamples(t0.Add(sampleHostTTL + time.Second))
+	probe(20, t0.Add(sampleHostTTL+time.Second))
+	if conn.LastSample != SampleWarmUp {
+		t.Error("host probed again after sampleHostTTL not warmed up")
+	}
+}
@@ -0,0 +1,76 @@
+package tracker
+
+import "strings"
+
+// LimitKind names one way a sandbox narrows what the tracker sees.
+type LimitKind string
+
+const (
+	// LimitProcNet: /proc/net is masked, so the socket tables can only be
+	// read over netlink (ss).
+	LimitProcNet LimitKind = "proc-net"
+	// LimitOwners: without CAP_SYS_PTRACE, the fds of other users'
+	// processes cannot be read, so their sockets have no owner.
+	LimitOwners LimitKind = "owners"
+	// LimitHiddenPIDs: /proc is mounted with hidepid, so other users'
+	// processes are not listed at all.
+	LimitHiddenPIDs LimitKind = "hidepid"
+	// LimitPIDNamespace: the container has its own PID namespace, so
+	// processes outside it cannot own a socket in the table.
+	LimitPIDNamespace LimitKind = "pid-namespace"
+	// LimitNetNamespace: the container has its own network namespace, so
+	// only its sockets are in the tables.
+	LimitNetNamespace LimitKind = "net-namespace"
+	// LimitNetAdmin: without CAP_NET_ADMIN, closing sockets and reading
+	// conntrack fail.
+	LimitNetAdmin LimitKind = "net-admin"
+)
+
+// Limitation is data a sandbox keeps from the tracker: what is missing,
+// why, and how to get it back.
+type Limitation struct {
+	Kind    LimitKind
+	Missing string
+	Reason  string
+	Fix     string
+}
+
+// Sandbox is the container or sandbox the tracker runs in, if any, and
+// what it keeps from view.
+type Sandbox struct {
+	Kind   string // "kubernetes", "docker", "podman", "flatpak", the $container value, or "" outside one
+	Limits []Limitation
+}
+
+// Has reports whether s has a limitation of kind.
+func (s Sandbox) Has(kind LimitKind) bool {
+	for _, l := range s.Limits {
+		if l.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted reports whether s is worth a banner: a container, or a /proc
+// that hides data. Missing privileges alone are a plain unprivileged run.
+func (s Sandbox) Restricted() bool {
+	return s.Kind != "" || s.Has(LimitProcNet) || s.Has(LimitHiddenPIDs)
+}
+
+// Summary lists what is missing in one line, e.g. for a banner; "" when
+// nothing is.
+func (s Sandbox) Summary() string {
+	if len(s.Limits) == 0 {
+		return ""
+	}
+	missing := make([]string, len(s.Limits))
+	for i, l := range s.Limits {
+		missing[i] = l.Missing
+	}
+	where := "this sandbox"
+	if s.Kind != "" {
+		where = "a " + s.Kind + " container"
+	}
+	return "Limited view in " + where + ": " + strings.Join(missing, "; ")
+}
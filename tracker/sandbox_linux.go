@@ -0,0 +1,224 @@
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// capNetAdmin is the CAP_NET_ADMIN bit, which conntrack needs.
+const capNetAdmin = 12
+
+// sandboxEnv is what detectSandbox reads, so it can be given a fake file
+// system and capabilities.
+type sandboxEnv struct {
+	readFile func(name string) ([]byte, error)
+	readDir  func(name string) ([]os.DirEntry, error)
+	readlink func(name string) (string, error)
+	exists   func(name string) bool
+	getenv   func(key string) string
+	caps     uint64 // the effective set
+	root     bool
+}
+
+// osSandboxEnv is sandboxEnv over this process and the real file system.
+func osSandboxEnv() sandboxEnv {
+	return sandboxEnv{
+		readFile: os.ReadFile,
+		readDir:  os.ReadDir,
+		readlink: os.Readlink,
+		exists: func(name string) bool {
+			_, err := os.Stat(name)
+			return err == nil
+		},
+		getenv: os.Getenv,
+		caps:   effectiveCaps(),
+		root:   os.Geteuid() == 0,
+	}
+}
+
+// ProbeSandbox detects the container or sandbox this process runs in and
+// what it keeps from the tracker.
+func ProbeSandbox() Sandbox {
+	return detectSandbox(osSandboxEnv())
+}
+
+// detectSandbox works out the sandbox kind from its marker files and
+// environment, then checks each limitation: a masked /proc/net, missing
+// capabilities, a hidepid /proc, and in a container, its own PID and
+// network namespaces.
+func detectSandbox(env sandboxEnv) Sandbox {
+	var s Sandbox
+	proc := func(elem ...string) string { return filepath.Join(append([]string{procRoot}, elem...)...) }
+	switch {
+	case env.getenv("KUBERNETES_SERVICE_HOST") != "":
+		s.Kind = "kubernetes"
+	case env.exists("/.flatpak-info"):
+		s.Kind = "flatpak"
+	case env.exists("/run/.containerenv"):
+		s.Kind = "podman"
+	case env.exists("/.dockerenv"):
+		s.Kind = "docker"
+	case env.getenv("container") != "":
+		s.Kind = env.getenv("container")
+	}
+	fix := func(k8s, docker, other string) string {
+		switch s.Kind {
+		case "kubernetes":
+			return k8s
+		case "docker", "podman":
+			return docker
+		}
+		return other
+	}
+
+	_, err4 := env.readFile(proc("net", "tcp"))
+	_, err6 := env.readFile(proc("net", "tcp6"))
+	if err4 != nil && err6 != nil {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitProcNet,
+			Missing: "/proc/net socket tables",
+			Reason:  "/proc/net is masked or unreadable; sockets are read with ss over netlink instead, if installed",
+			Fix: fix("set securityContext.procMount: Unmasked",
+				"run with --security-opt systempaths=unconfined, or --privileged", "unmask /proc/net"),
+		})
+	}
+
+	if env.caps&(1<<capSysPtrace) == 0 {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitOwners,
+			Missing: "owners of other users' sockets",
+			Reason:  "without CAP_SYS_PTRACE the fds of other users' processes cannot be read; only this user's processes are searched",
+			Fix: fix(`add "SYS_PTRACE" to securityContext.capabilities.add`,
+				"run with --cap-add SYS_PTRACE, or --privileged",
+				"run with sudo, or: sudo setcap cap_sys_ptrace,cap_dac_read_search+ep $(command -v ping-tracker)"),
+		})
+	}
+
+	if mounts, err := env.readFile(proc("self", "mountinfo")); err == nil && hidepidMount(string(mounts)) && !env.root {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitHiddenPIDs,
+			Missing: "other users' processes",
+			Reason:  "/proc is mounted with hidepid, which hides them from this user",
+			Fix:     "run as root, or add this user to the group of the mount's gid= option",
+		})
+	}
+
+	if s.Kind == "" {
+		return s
+	}
+	if comm, err := env.readFile(proc("1", "comm")); err == nil && !slices.Contains([]string{"systemd", "init"}, strings.TrimSpace(string(comm))) {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitPIDNamespace,
+			Missing: "processes outside the container",
+			Reason:  "the container has its own PID namespace; sockets of host processes show no owner",
+			Fix:     fix("set hostPID: true in the pod spec", "run with --pid=host", "share the host's PID namespace"),
+		})
+	}
+	if ownNetNamespace(env) {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitNetNamespace,
+			Missing: "the host's sockets",
+			Reason:  "the container has its own network namespace; only its own sockets are in the tables",
+			Fix:     fix("set hostNetwork: true in the pod spec", "run with --network=host", "share the host's network namespace"),
+		})
+	}
+	if env.caps&(1<<capNetAdmin) == 0 {
+		s.Limits = append(s.Limits, Limitation{
+			Kind:    LimitNetAdmin,
+			Missing: "forwarded flows (-conntrack)",
+			Reason:  "reading conntrack needs CAP_NET_ADMIN",
+			Fix: fix(`add "NET_ADMIN" to securityContext.capabilities.add`,
+				"run with --cap-add NET_ADMIN, or --privileged", "grant CAP_NET_ADMIN"),
+		})
+	}
+	return s
+}
+
+// hidepidMount reports whether mountinfo has /proc mounted with a hidepid
+// option other than 0 (or "off").
+func hidepidMount(mountinfo string) bool {
+	for _, line := range strings.Split(mountinfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[4] != "/proc" {
+			continue
+		}
+		for _, opt := range strings.Split(strings.Join(fields[5:], ","), ",") {
+			if v, ok := strings.CutPrefix(opt, "hidepid="); ok && v != "0" && v != "off" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ownNetNamespace reports whether this process has a network namespace of
+// its own: a different one than PID 1 where that can be read, or else
+// every interface but lo being one end of a pair whose other end lives in
+// another namespace (a veth), as a container's eth0 is.
+func ownNetNamespace(env sandboxEnv) bool {
+	self, err1 := env.readlink(filepath.Join(procRoot, "self", "ns", "net"))
+	pid1, err2 := env.readlink(filepath.Join(procRoot, "1", "ns", "net"))
+	if err1 == nil && err2 == nil && self != pid1 {
+		return true
+	}
+	links, err := env.readDir("/sys/class/net")
+	if err != nil {
+		return false
+	}
+	paired := 0
+	for _, l := range links {
+		if l.Name() == "lo" {
+			continue
+		}
+		index, err1 := env.readFile(filepath.Join("/sys/class/net", l.Name(), "ifindex"))
+		peer, err2 := env.readFile(filepath.Join("/sys/class/net", l.Name(), "iflink"))
+		if err1 != nil || err2 != nil || strings.TrimSpace(string(index)) == strings.TrimSpace(string(peer)) {
+			return false
+		}
+		paired++
+	}
+	return paired > 0
+}
+
+// effectiveCaps reads this process's effective capability set.
+func effectiveCaps() uint64 {
+	data, err := os.ReadFile(filepath.Join(procRoot, "self", "status"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if hex, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			caps, _ := strconv.ParseUint(strings.TrimSpace(hex), 16, 64)
+			return caps
+		}
+	}
+	return 0
+}
+
+// AdaptToSandbox stops the scanner from trying what s rules out: with
+// /proc/net masked, ss is tried first; without access to other users'
+// processes, the owner search only walks this user's PIDs. Must be called
+// before Start.
+func AdaptToSandbox(s Sandbox) {
+	if s.Has(LimitProcNet) && preferredBackend == "proc" {
+		preferredBackend = "ss"
+	}
+	if s.Has(LimitOwners) || s.Has(LimitHiddenPIDs) {
+		resolver.ownUID = os.Geteuid()
+	}
+}
+
+// ownedBy reports whether pid runs as uid. A PID that is gone counts as
+// not owned.
+func ownedBy(pid, uid int) bool {
+	info, err := os.Stat(filepath.Join(procRoot, strconv.Itoa(pid)))
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == uid
+}
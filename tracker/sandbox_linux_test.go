@@ -0,0 +1,270 @@
+package tracker
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeSandbox is a sandboxEnv over an in-memory file system, with
+// readlink targets, environment and capabilities given directly.
+type fakeSandbox struct {
+	files fstest.MapFS
+	links map[string]string
+	env   map[string]string
+	caps  uint64
+	root  bool
+}
+
+// hostSandbox is a root process on a host with every capability, a
+// readable /proc/net and systemd as PID 1.
+func hostSandbox() *fakeSandbox {
+	return &fakeSandbox{
+		files: fstest.MapFS{
+			"proc/net/tcp":               {Data: []byte("  sl  local_address\n")},
+			"proc/net/tcp6":              {Data: []byte("  sl  local_address\n")},
+			"proc/self/mountinfo":        {Data: []byte("22 1 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw\n")},
+			"proc/1/comm":                {Data: []byte("systemd\n")},
+			"sys/class/net/lo/ifindex":   {Data: []byte("1\n")},
+			"sys/class/net/lo/iflink":    {Data: []byte("1\n")},
+			"sys/class/net/eth0/ifindex": {Data: []byte("2\n")},
+			"sys/class/net/eth0/iflink":  {Data: []byte("2\n")},
+		},
+		links: map[string]string{"/proc/self/ns/net": "net:[4026531840]", "/proc/1/ns/net": "net:[4026531840]"},
+		env:   map[string]string{},
+		caps:  1<<capSysPtrace | 1<<capNetAdmin,
+		root:  true,
+	}
+}
+
+func (f *fakeSandbox) sandboxEnv() sandboxEnv {
+	name := func(path string) string { return strings.TrimPrefix(path, "/") }
+	return sandboxEnv{
+		readFile: func(path string) ([]byte, error) { return f.files.ReadFile(name(path)) },
+		readDir:  func(path string) ([]os.DirEntry, error) { return f.files.ReadDir(name(path)) },
+		readlink: func(path string) (string, error) {
+			if l, ok := f.links[path]; ok {
+				return l, nil
+			}
+			return "", fs.ErrNotExist
+		},
+		exists: func(path string) bool {
+			_, err := f.files.Stat(name(path))
+			return err == nil
+		},
+		getenv: func(key string) string { return f.env[key] },
+		caps:   f.caps,
+		root:   f.root,
+	}
+}
+
+// container turns f into a container of kind with its own PID and network
+// namespaces, as docker or kubernetes start one by default.
+func (f *fakeSandbox) container(marker string) *fakeSandbox {
+	if marker != "" {
+		f.files[marker] = &fstest.MapFile{}
+	}
+	f.files["proc/1/comm"] = &fstest.MapFile{Data: []byte("nginx\n")}
+	f.links["/proc/self/ns/net"] = "net:[4026532201]"
+	delete(f.links, "/proc/1/ns/net")
+	f.files["sys/class/net/eth0/iflink"] = &fstest.MapFile{Data: []byte("17\n")}
+	f.caps = 1 << 0 // CAP_CHOWN, docker's default set has neither
+	return f
+}
+
+func TestDetectSandbox(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *fakeSandbox)
+		kind  string
+		want  []LimitKind
+	}{
+		{"host", func(*fakeSandbox) {}, "", nil},
+		{"unprivileged user", func(f *fakeSandbox) { f.caps, f.root = 0, false }, "", []LimitKind{LimitOwners}},
+		{"hidepid", func(f *fakeSandbox) {
+			f.files["proc/self/mountinfo"] = &fstest.MapFile{Data: []byte("22 1 0:21 / /proc rw,nosuid - proc proc rw,hidepid=invisible\n")}
+			f.root = false
+		}, "", []LimitKind{LimitHiddenPIDs}},
+		{"hidepid=0", func(f *fakeSandbox) {
+			f.files["proc/self/mountinfo"] = &fstest.MapFile{Data: []byte("22 1 0:21 / /proc rw - proc proc rw,hidepid=0\n")}
+			f.root = false
+		}, "", nil},
+		{"hidepid as root", func(f *fakeSandbox) {
+			f.files["proc/self/mountinfo"] = &fstest.MapFile{Data: []byte("22 1 0:21 / /proc rw - proc proc rw,hidepid=2\n")}
+		}, "", nil},
+		{"docker", func(f *fakeSandbox) { f.container(".dockerenv") }, "docker",
+			[]LimitKind{LimitOwners, LimitPIDNamespace, LimitNetNamespace, LimitNetAdmin}},
+		{"docker --pid=host --network=host --privileged", func(f *fakeSandbox) {
+			f.files[".dockerenv"] = &fstest.MapFile{}
+		}, "docker", nil},
+		{"podman", func(f *fakeSandbox) { f.container("run/.containerenv") }, "podman",
+			[]LimitKind{LimitOwners, LimitPIDNamespace, LimitNetNamespace, LimitNetAdmin}},
+		{"kubernetes, masked /proc/net", func(f *fakeSandbox) {
+			f.container("")
+			f.env["KUBERNETES_SERVICE_HOST"] = "10.96.0.1"
+			delete(f.files, "proc/net/tcp")
+			delete(f.files, "proc/net/tcp6")
+		}, "kubernetes", []LimitKind{LimitProcNet, LimitOwners, LimitPIDNamespace, LimitNetNamespace, LimitNetAdmin}},
+		{"kubernetes hostPID", func(f *fakeSandbox) {
+			f.container("")
+			f.env["KUBERNETES_SERVICE_HOST"] = "10.96.0.1"
+			f.files["proc/1/comm"] = &fstest.MapFile{Data: []byte("systemd\n")}
+			f.caps = 1 << capSysPtrace
+		}, "kubernetes", []LimitKind{LimitNetNamespace, LimitNetAdmin}},
+		{"flatpak", func(f *fakeSandbox) {
+			f.files[".flatpak-info"] = &fstest.MapFile{}
+			f.files["proc/1/comm"] = &fstest.MapFile{Data: []byte("bwrap\n")}
+			f.caps, f.root = 0, false
+		}, "flatpak", []LimitKind{LimitOwners, LimitPIDNamespace, LimitNetAdmin}},
+		{"$container", func(f *fakeSandbox) { f.env["container"] = "lxc" }, "lxc", nil},
+		{"only tcp6 readable", func(f *fakeSandbox) { delete(f.files, "proc/net/tcp") }, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := hostSandbox()
+			tt.setup(f)
+			s := detectSandbox(f.sandboxEnv())
+			var got []LimitKind
+			for _, l := range s.Limits {
+				got = append(got, l.Kind)
+				if l.Missing == "" || l.Reason == "" || l.Fix == "" {
+					t.Errorf("%s: incomplete %+v", l.Kind, l)
+				}
+			}
+			if s.Kind != tt.kind || strings.Join(kinds(got), ",") != strings.Join(kinds(tt.want), ",") {
+				t.Errorf("%q with %v, want %q with %v", s.Kind, got, tt.kind, tt.want)
+			}
+		})
+	}
+}
+
+func kinds(ks []LimitKind) []string {
+	out := make([]string, len(ks))
+	for i, k := range ks {
+		out[i] = string(k)
+	}
+	return out
+}
+
+// TestSandboxFixes checks that each limitation's remediation speaks the
+// sandbox's own terms.
+func TestSandboxFixes(t *testing.T) {
+	fixOf := func(s Sandbox, kind LimitKind) string {
+		for _, l := range s.Limits {
+			if l.Kind == kind {
+				return l.Fix
+			}
+		}
+		return ""
+	}
+	k8s := hostSandbox().container("")
+	k8s.env["KUBERNETES_SERVICE_HOST"] = "10.96.0.1"
+	s := detectSandbox(k8s.sandboxEnv())
+	for kind, want := range map[LimitKind]string{
+		LimitPIDNamespace: "hostPID: true",
+		LimitNetNamespace: "hostNetwork: true",
+		LimitNetAdmin:     `"NET_ADMIN"`,
+		LimitOwners:       `"SYS_PTRACE"`,
+	} {
+		if fix := fixOf(s, kind); !strings.Contains(fix, want) {
+			t.Errorf("kubernetes %s: %q", kind, fix)
+		}
+	}
+	s = detectSandbox(hostSandbox().container(".dockerenv").sandboxEnv())
+	for kind, want := range map[LimitKind]string{
+		LimitPIDNamespace: "--pid=host",
+		LimitNetNamespace: "--network=host",
+		LimitNetAdmin:     "--privileged",
+	} {
+		if fix := fixOf(s, kind); !strings.Contains(fix, want) {
+			t.Errorf("docker %s: %q", kind, fix)
+		}
+	}
+}
+
+func TestHidepidMount(t *testing.T) {
+	for _, tt := range []struct {
+		mountinfo string
+		want      bool
+	}{
+		{"22 1 0:21 / /proc rw,relatime shared:12 - proc proc rw,hidepid=2", true},
+		{"22 1 0:21 / /proc rw - proc proc rw,hidepid=invisible,gid=27", true},
+		{"22 1 0:21 / /proc rw - proc proc rw,hidepid=off", false},
+		{"22 1 0:21 / /proc rw - proc proc rw", false},
+		{"30 1 0:30 / /mnt/proc rw - proc proc rw,hidepid=2", false},
+		{"", false},
+	} {
+		if got := hidepidMount(tt.mountinfo); got != tt.want {
+			t.Errorf("%q: %v", tt.mountinfo, got)
+		}
+	}
+}
+
+// TestAdaptToSandbox checks the behavior switches: ss first when /proc/net
+// is masked, and the owner sweep kept to this user's processes.
+func TestAdaptToSandbox(t *testing.T) {
+	savedBackend, savedUID := preferredBackend, resolver.ownUID
+	t.Cleanup(func() { preferredBackend, resolver.ownUID = savedBackend, savedUID })
+
+	preferredBackend, resolver.ownUID = "proc", -1
+	AdaptToSandbox(Sandbox{})
+	if preferredBackend != "proc" || resolver.ownUID != -1 {
+		t.Errorf("no limits: backend %s, uid %d", preferredBackend, resolver.ownUID)
+	}
+	AdaptToSandbox(Sandbox{Limits: []Limitation{{Kind: LimitProcNet}}})
+	if preferredBackend != "ss" || resolver.ownUID != -1 {
+		t.Errorf("masked /proc/net: backend %s, uid %d", preferredBackend, resolver.ownUID)
+	}
+	preferredBackend = "netlink"
+	AdaptToSandbox(Sandbox{Limits: []Limitation{{Kind: LimitProcNet}, {Kind: LimitHiddenPIDs}}})
+	if preferredBackend != "netlink" {
+		t.Errorf("a chosen backend was replaced by %s", preferredBackend)
+	}
+	if resolver.ownUID != os.Geteuid() {
+		t.Errorf("hidepid: uid %d", resolver.ownUID)
+	}
+}
+
+// TestResolveOwnUID checks that with ownUID set, processes of other users
+// are skipped once and remembered, not read on every scan.
+func TestResolveOwnUID(t *testing.T) {
+	p := newFakeProc(t)
+	p.add(100, "curl", "5001")
+	want := map[string]bool{"5001": true}
+
+	r := newTestResolver()
+	r.ownUID = os.Geteuid() + 1
+	if pids, _ := r.resolve(want); len(pids) != 0 {
+		t.Errorf("resolved through another user's process: %v", pids)
+	}
+	if !r.foreign[100] {
+		t.Error("the other user's process is not remembered")
+	}
+
+	r = newTestResolver()
+	r.ownUID = os.Geteuid()
+	if pids, _ := r.resolve(want); pids["5001"] != 100 {
+		t.Errorf("own process: %v", pids)
+	}
+}
+
+func TestSandboxSummary(t *testing.T) {
+	var s Sandbox
+	if s.Restricted() || s.Summary() != "" {
+		t.Errorf("empty sandbox: %v %q", s.Restricted(), s.Summary())
+	}
+	s.Limits = []Limitation{{Kind: LimitOwners, Missing: "owners of other users' sockets"}}
+	if s.Restricted() {
+		t.Error("a plain unprivileged run is restricted")
+	}
+	s.Kind = "docker"
+	s.Limits = append(s.Limits, Limitation{Kind: LimitNetNamespace, Missing: "the host's sockets"})
+	if !s.Restricted() || !s.Has(LimitNetNamespace) || s.Has(LimitProcNet) {
+		t.Errorf("docker: %v", s)
+	}
+	if got := s.Summary(); got != "Limited view in a docker container: owners of other users' sockets; the host's sockets" {
+		t.Errorf("summary %q", got)
+	}
+}
@@ -0,0 +1,10 @@
+package tracker
+
+// ProbeSandbox finds no sandbox on Windows: the socket tables and process
+// names come from the same APIs inside a container.
+func ProbeSandbox() Sandbox {
+	return Sandbox{}
+}
+
+// AdaptToSandbox has nothing to adapt on Windows.
+func AdaptToSandbox(s Sandbox) {}
@@ -10,8 +10,10 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -41,36 +43,122 @@ type inodeEntry struct {
 	inode      string
 	txQueue    uint64
 	rxQueue    uint64
+	namespace  string // network namespace label; empty for our own
 }
 
-// ScanConnections reads /proc/net/tcp and /proc/net/tcp6 to discover connections,
-// then resolves each socket inode to a PID and process name.
+// scanBackend is one way of enumerating sockets on Linux.
+type scanBackend struct {
+	name string
+	scan func() ([]*Connection, error)
+}
+
+// scanBackends lists the Linux backends in fallback order.
+var scanBackends = []scanBackend{
+	{"proc", scanProc},
+	{"ss", scanSS},
+}
+
+// preferredBackend is tried first; the others follow in scanBackends order.
+var preferredBackend = "proc"
+
+// SelectScanner picks the socket enumeration backend: "proc" or "ss".
+func SelectScanner(name string) error {
+	for _, b := range scanBackends {
+		if b.name == name {
+			preferredBackend = name
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scanner %q (want proc or ss)", name)
+}
+
+// ScanConnections discovers connections with the preferred backend. If it
+// fails without returning anything, the remaining backends are tried in order.
 func ScanConnections() ([]*Connection, error) {
-	now := time.Now()
+	order := make([]scanBackend, 0, len(scanBackends))
+	for _, b := range scanBackends {
+		if b.name == preferredBackend {
+			order = append([]scanBackend{b}, order...)
+		} else {
+			order = append(order, b)
+		}
+	}
+
+	var firstErr error
+	for _, b := range order {
+		conns, err := b.scan()
+		if err == nil || len(conns) > 0 {
+			if allNetns && b.name != "proc" {
+				// Only the proc backend reads other namespaces itself.
+				conns = append(conns, resolveEntries(netnsEntries())...)
+			}
+			if conntrack != nil {
+				conns = append(conns, conntrack.connections(conns)...)
+			}
+			return conns, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// scanProc reads /proc/net/tcp and /proc/net/tcp6 to discover connections,
+// then resolves each socket inode to a PID and process name. With
+// -all-netns the tables of every other network namespace are read as well.
+func scanProc() ([]*Connection, error) {
+	entries, err := readProcTables(filepath.Join(procRoot, "net"), "")
+	if err != nil {
+		return nil, err
+	}
+	if allNetns {
+		entries = append(entries, netnsEntries()...)
+	}
+	return resolveEntries(entries), nil
+}
 
+// readProcTables parses the tcp, tcp6, udp and udp6 tables under dir, tagging
+// each entry with namespace. It fails only if none of the tables can be read.
+func readProcTables(dir, namespace string) ([]inodeEntry, error) {
 	var entries []inodeEntry
+	var lastErr error
+	opened := 0
 
-	for _, proto := range []string{"tcp", "tcp6"} {
-		path := "/proc/net/" + proto
-		parsed, err := parseProcNet(path, proto)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		parsed, err := parseProcNet(filepath.Join(dir, proto), proto)
 		if err != nil {
+			lastErr = err
 			continue // skip if file doesn't exist (e.g., no IPv6)
 		}
+		opened++
+		for i := range parsed {
+			parsed[i].namespace = namespace
+		}
 		entries = append(entries, parsed...)
 	}
+	if opened == 0 {
+		return nil, lastErr
+	}
+	return entries, nil
+}
 
-	// Build inode -> PID+name map
-	inodePID, inodeName := buildInodeMap()
+// resolveEntries resolves the socket inodes of entries to their owning
+// processes and builds the connections.
+func resolveEntries(entries []inodeEntry) []*Connection {
+	now := time.Now()
 
-	// Also read UDP for completeness
-	for _, proto := range []string{"udp", "udp6"} {
-		path := "/proc/net/" + proto
-		parsed, err := parseProcNet(path, proto)
-		if err != nil {
-			continue
+	// Build inode -> PID+name map for the sockets in the tables. Inode 0
+	// (e.g. TIME_WAIT) has no owning process.
+	want := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.inode != "0" {
+			want[e.inode] = true
 		}
-		entries = append(entries, parsed...)
 	}
+	resolveStart := time.Now()
+	inodePID, inodeName := buildInodeMap(want)
+	lastResolve.Store(int64(time.Since(resolveStart)))
 
 	var conns []*Connection
 	for _, e := range entries {
@@ -88,6 +176,7 @@ func ScanConnections() ([]*Connection, error) {
 		conn := &Connection{
 			PID:         pid,
 			AppName:     name,
+			Namespace:   e.namespace,
 			Protocol:    e.protocol,
 			Direction:   dir,
 			LocalAddr:   e.localAddr,
@@ -95,15 +184,18 @@ func ScanConnections() ([]*Connection, error) {
 			RemoteAddr:  e.remoteAddr,
 			RemotePort:  e.remotePort,
 			State:       e.state,
-			TxBytes:     e.txQueue,
-			RxBytes:     e.rxQueue,
+			Provenance:  []string{ProvenanceProc},
+			SendQ:       e.txQueue,
+			RecvQ:       e.rxQueue,
+			HasQueues:   true,
+			inode:       e.inode,
 			FirstSeen:   now,
 			LastUpdated: now,
 		}
 		conns = append(conns, conn)
 	}
 
-	return conns, nil
+	return conns
 }
 
 // parseProcNet parses a /proc/net/tcp or /proc/net/udp file.
@@ -142,8 +234,13 @@ func parseProcNet(path, protocol string) ([]inodeEntry, error) {
 		if !ok {
 			state = StateUnknown
 		}
+		// UDP sockets use the TCP codes too: 01 once connect() gave them
+		// a remote, 07 (TCP_CLOSE) while they are not connected.
+		if state == StateClosed && strings.HasPrefix(protocol, "udp") {
+			state = StateUnconnected
+		}
 
-		// tx_queue:rx_queue
+		// tx_queue:rx_queue, the bytes waiting in the socket buffers
 		queues := strings.Split(fields[4], ":")
 		var txQ, rxQ uint64
 		if len(queues) == 2 {
@@ -216,41 +313,205 @@ func hexToIP(h string) (string, error) {
 	}
 }
 
-// buildInodeMap scans /proc/*/fd/* to map socket inodes to PIDs and process names.
-func buildInodeMap() (map[string]int, map[string]string) {
-	inodePID := make(map[string]int)
-	inodeName := make(map[string]string)
+// procRoot is where the proc filesystem is mounted.
+var procRoot = "/proc"
+
+// inodeResolver maps socket inodes to owning processes. Walking every fd of
+// every process is expensive on desktops with many processes, so it first
+// checks the PIDs that owned sockets in the previous scan and only sweeps the
+// rest of /proc while inodes remain unresolved. Only the scan loop resolves
+// with it; remember may be called from anywhere.
+type inodeResolver struct {
+	socketPIDs    map[int]bool // PIDs that owned a wanted socket last scan
+	kernelThreads map[int]bool // PIDs with an empty cmdline, never swept
+	ownUID        int          // with AdaptToSandbox, only this user's PIDs are swept; -1: all
+	foreign       map[int]bool // PIDs of other users, never swept when ownUID is set
+
+	mu         sync.Mutex
+	remembered map[int]bool // owners found between scans, checked first next scan
+}
 
-	procs, _ := filepath.Glob("/proc/[0-9]*/fd/[0-9]*")
-	for _, fdPath := range procs {
-		link, err := os.Readlink(fdPath)
-		if err != nil {
-			continue
+var resolver = &inodeResolver{
+	socketPIDs:    make(map[int]bool),
+	kernelThreads: make(map[int]bool),
+	ownUID:        -1,
+	foreign:       make(map[int]bool),
+	remembered:    make(map[int]bool),
+}
+
+// remember has the next scan check pid before sweeping /proc.
+func (r *inodeResolver) remember(pid int) {
+	r.mu.Lock()
+	r.remembered[pid] = true
+	r.mu.Unlock()
+}
+
+// buildInodeMap resolves the wanted socket inodes to PIDs and process names.
+func buildInodeMap(want map[string]bool) (map[string]int, map[string]string) {
+	return resolver.resolve(want)
+}
+
+func (r *inodeResolver) resolve(want map[string]bool) (map[string]int, map[string]string) {
+	inodePID := make(map[string]int, len(want))
+	inodeName := make(map[string]string, len(want))
+	remaining := len(want)
+	owners := make(map[int]bool)
+	visited := make(map[int]bool)
+
+	r.mu.Lock()
+	for pid := range r.remembered {
+		r.socketPIDs[pid] = true
+	}
+	clear(r.remembered)
+	r.mu.Unlock()
+
+	walk := func(pid int) {
+		visited[pid] = true
+		if n := scanPIDSockets(pid, want, inodePID, inodeName); n > 0 {
+			owners[pid] = true
+			remaining -= n
+		}
+	}
+
+	for pid := range r.socketPIDs {
+		if remaining == 0 {
+			break
+		}
+		walk(pid)
+	}
+
+	if remaining > 0 {
+		dirs, _ := os.ReadDir(procRoot)
+		alive := make(map[int]bool, len(dirs))
+		complete := true
+		for _, d := range dirs {
+			pid, err := strconv.Atoi(d.Name())
+			if err != nil {
+				continue
+			}
+			if remaining == 0 {
+				complete = false
+				break
+			}
+			alive[pid] = true
+			if visited[pid] || r.kernelThreads[pid] || r.foreign[pid] {
+				continue
+			}
+			if r.ownUID >= 0 && !ownedBy(pid, r.ownUID) {
+				// Its fds cannot be read; a PID does not change owner
+				// unless reused, and then it leaves alive first.
+				r.foreign[pid] = true
+				continue
+			}
+			if isKernelThread(pid) {
+				r.kernelThreads[pid] = true
+				continue
+			}
+			walk(pid)
 		}
-		if !strings.HasPrefix(link, "socket:[") {
+		if complete {
+			for pid := range r.kernelThreads {
+				if !alive[pid] {
+					delete(r.kernelThreads, pid)
+				}
+			}
+			for pid := range r.foreign {
+				if !alive[pid] {
+					delete(r.foreign, pid)
+				}
+			}
+		}
+	}
+
+	r.socketPIDs = owners
+	return inodePID, inodeName
+}
+
+// scanPIDSockets records the wanted socket inodes held by pid and returns how
+// many new ones it resolved. A process exiting mid-walk just yields fewer results.
+func scanPIDSockets(pid int, want map[string]bool, inodePID map[string]int, inodeName map[string]string) int {
+	fdDir := filepath.Join(procRoot, strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return 0 // exited, or not ours to read
+	}
+
+	found := 0
+	name := ""
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
 			continue
 		}
 		inode := link[8 : len(link)-1]
-
-		// Extract PID from path: /proc/<pid>/fd/<fd>
-		parts := strings.Split(fdPath, "/")
-		if len(parts) < 4 {
+		if !want[inode] {
 			continue
 		}
-		pid, err := strconv.Atoi(parts[2])
-		if err != nil {
+		if _, done := inodePID[inode]; done {
 			continue
 		}
-
+		if name == "" {
+			comm, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "comm"))
+			if err == nil {
+				name = strings.TrimSpace(string(comm))
+			}
+		}
 		inodePID[inode] = pid
+		if name != "" {
+			inodeName[inode] = name
+		}
+		found++
+	}
+	return found
+}
+
+// openProcessName and ownerModuleNames are the Windows scanner's; the proc
+// scanner reads names from /proc/<pid>/comm without opening anything.
+func openProcessName(pid int) (string, bool) { return "", false }
 
-		// Read process name from /proc/<pid>/comm
-		commPath := fmt.Sprintf("/proc/%d/comm", pid)
-		comm, err := os.ReadFile(commPath)
-		if err == nil {
-			inodeName[inode] = strings.TrimSpace(string(comm))
+func ownerModuleNames(want map[int]bool) map[int]string { return nil }
+
+// needsResolve reports whether the owner of c is worth looking up again:
+// the proc scanner read its socket but found no process holding it. Sockets
+// without an inode (TIME_WAIT) have no owner, and the ss scanner gives no
+// inode to look for.
+func needsResolve(c *Connection) bool {
+	return c.PID == 0 && c.inode != "" && c.inode != "0"
+}
+
+// resolveOwner sweeps /proc for the process holding c's socket. Newest
+// PIDs go first, as an unresolved socket usually belongs to a process that
+// had only just started.
+func resolveOwner(c *Connection) (int, string, bool) {
+	dirs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0, "", false
+	}
+	var pids []int
+	for _, d := range dirs {
+		if pid, err := strconv.Atoi(d.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(pids)))
+	want := map[string]bool{c.inode: true}
+	inodePID, inodeName := map[string]int{}, map[string]string{}
+	for _, pid := range pids {
+		if scanPIDSockets(pid, want, inodePID, inodeName) > 0 {
+			name, ok := inodeName[c.inode]
+			return pid, name, ok
 		}
 	}
+	return 0, "", false
+}
 
-	return inodePID, inodeName
+// rememberOwner makes pid the first place the next scan looks for sockets.
+func rememberOwner(pid int) {
+	resolver.remember(pid)
+}
+
+// isKernelThread reports whether pid is a kernel thread (readable, empty cmdline).
+func isKernelThread(pid int) bool {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	return err == nil && len(data) == 0
 }
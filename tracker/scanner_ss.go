@@ -0,0 +1,344 @@
+//go:build linux
+
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ssStates maps the state column of `ss` to ConnState.
+var ssStates = map[string]ConnState{
+	"ESTAB":      StateEstablished,
+	"LISTEN":     StateListening,
+	"TIME-WAIT":  StateTimeWait,
+	"CLOSE-WAIT": StateCloseWait,
+	"SYN-SENT":   StateSynSent,
+	"SYN-RECV":   StateSynRecv,
+	"FIN-WAIT-1": StateFinWait1,
+	"FIN-WAIT-2": StateFinWait2,
+	"LAST-ACK":   StateLastAck,
+	"CLOSING":    StateClosing,
+	"UNCONN":     StateUnconnected,
+}
+
+// ssTOSUnsupported is set once ss rejects --tos (iproute2 before 4.x).
+var ssTOSUnsupported bool
+
+// scanSS runs `ss -tunapimH --tos` and parses its output. Unlike /proc it
+// works when /proc/net is masked, as ss talks to the kernel over netlink; -i
+// adds the kernel's TCP info (e.g. the smoothed RTT, the congestion control
+// algorithm and BBR's path model) on a continuation line, -m the socket's
+// memory and --tos its TOS/traffic class and priority.
+func scanSS() ([]*Connection, error) {
+	if !ssTOSUnsupported {
+		out, err := exec.Command("ss", "-tunapimH", "--tos").Output()
+		if err == nil {
+			return parseSS(bytes.NewReader(out), time.Now())
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("ss: %w", err)
+		}
+		ssTOSUnsupported = true
+	}
+	out, err := exec.Command("ss", "-tunapimH").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ss: %w", err)
+	}
+	return parseSS(bytes.NewReader(out), time.Now())
+}
+
+// parseSS parses `ss -tunapH` output, with or without -i and -m. Indented
+// lines carry TCP info and socket memory for the socket above them. Lines it cannot parse are skipped.
+func parseSS(r io.Reader, now time.Time) ([]*Connection, error) {
+	var conns []*Connection
+	var last *Connection // socket the next info line belongs to
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ") {
+			if last != nil {
+				parseSSInfo(line, last)
+			}
+			continue
+		}
+		last = nil
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		netid := fields[0]
+		if netid != "tcp" && netid != "udp" {
+			continue
+		}
+
+		state, ok := ssStates[fields[1]]
+		if !ok {
+			state = StateUnknown
+		}
+		rxQ, _ := strconv.ParseUint(fields[2], 10, 64)
+		txQ, _ := strconv.ParseUint(fields[3], 10, 64)
+
+		localAddr, localPort, v6, err := parseSSAddr(fields[4])
+		if err != nil {
+			continue
+		}
+		remoteAddr, remotePort, _, err := parseSSAddr(fields[5])
+		if err != nil {
+			continue
+		}
+		if remoteAddr == "*" {
+			remoteAddr = "0.0.0.0"
+			if v6 {
+				remoteAddr = "::"
+			}
+		}
+
+		protocol := netid
+		if v6 {
+			protocol += "6"
+		}
+
+		name, pid := "unknown", 0
+		var qos *QoS
+		if len(fields) > 6 {
+			if n, p, ok := parseSSUsers(strings.Join(fields[6:], " ")); ok {
+				name, pid = n, p
+			}
+			qos = parseSSQoS(fields[6:], v6)
+		}
+
+		dir := Outbound
+		if state == StateListening || remoteAddr == "0.0.0.0" || remoteAddr == "::" {
+			dir = Inbound
+		}
+
+		last = &Connection{
+			PID:         pid,
+			AppName:     name,
+			Protocol:    protocol,
+			Direction:   dir,
+			LocalAddr:   localAddr,
+			LocalPort:   localPort,
+			RemoteAddr:  remoteAddr,
+			RemotePort:  remotePort,
+			State:       state,
+			Provenance:  []string{ProvenanceSS},
+			SendQ:       txQ,
+			RecvQ:       rxQ,
+			HasQueues:   true,
+			QoS:         qos,
+			FirstSeen:   now,
+			LastUpdated: now,
+		}
+		conns = append(conns, last)
+	}
+	return conns, scanner.Err()
+}
+
+// ssInfoFlags are the bare words `ss -i` prints before the congestion
+// control algorithm, which is the last bare word ahead of the first
+// key:value field.
+var ssInfoFlags = map[string]bool{"ts": true, "sack": true, "ecn": true, "ecnseen": true, "fastopen": true}
+
+// parseSSInfo reads the continuation line printed by `ss -i` and `ss -m`.
+// With -m it starts with the socket memory, ahead of the congestion control
+// algorithm, so skmem does not count as the first key:value field.
+func parseSSInfo(line string, c *Connection) {
+	var info TCPInfo
+	fields := false // a key:value field was seen
+	for _, tok := range strings.Fields(line) {
+		key, value, ok := strings.Cut(tok, ":")
+		if !ok {
+			if !fields && !ssInfoFlags[tok] {
+				c.CongestionAlgo = tok
+			}
+			continue
+		}
+		if key == "skmem" {
+			c.setSockMem(parseSSSkmem(value))
+			continue
+		}
+		fields = true
+		switch key {
+		case "rtt":
+			// rtt:<srtt>/<rttvar> in milliseconds
+			srtt, _, _ := strings.Cut(value, "/")
+			if ms, err := strconv.ParseFloat(srtt, 64); err == nil && ms > 0 {
+				c.KernelRTT = time.Duration(ms * float64(time.Millisecond))
+			}
+		case "snd_wnd":
+			info.SndWnd, _ = strconv.ParseUint(value, 10, 64)
+			info.HasSndWnd = true
+		case "rcv_space":
+			info.RcvSpace, _ = strconv.ParseUint(value, 10, 64)
+		case "notsent":
+			info.NotSent, _ = strconv.ParseUint(value, 10, 64)
+		case "retrans":
+			// retrans:<unacked>/<total>, left out while both are 0
+			_, total, _ := strings.Cut(value, "/")
+			info.Retrans, _ = strconv.ParseUint(total, 10, 64)
+		case "segs_out":
+			info.SegsOut, _ = strconv.ParseUint(value, 10, 64)
+			info.HasRetrans = true
+		case "bytes_acked":
+			// bytes_sent would count retransmissions too
+			c.TxBytes, _ = strconv.ParseUint(value, 10, 64)
+			c.HasByteCounts = true
+		case "bytes_received":
+			c.RxBytes, _ = strconv.ParseUint(value, 10, 64)
+			c.HasByteCounts = true
+		case "bbr":
+			c.BBR = parseSSBBR(value)
+		}
+	}
+	if strings.HasPrefix(c.Protocol, "tcp") {
+		c.TCPInfo = &info
+	}
+}
+
+// parseSSBBR reads the BBR info printed by `ss -i` for a BBR socket,
+// "(bw:5.1Mbps,mrtt:0.5,pacing_gain:2.88672,cwnd_gain:2.88672)", with the
+// bandwidth in bits and mrtt in milliseconds. It returns nil when either
+// is missing.
+func parseSSBBR(s string) *BBRInfo {
+	var b BBRInfo
+	var hasBW, hasRTT bool
+	for _, kv := range strings.Split(strings.Trim(s, "()"), ",") {
+		key, value, _ := strings.Cut(kv, ":")
+		switch key {
+		case "bw":
+			b.Bandwidth, hasBW = parseSSBandwidth(value)
+		case "mrtt":
+			if ms, err := strconv.ParseFloat(value, 64); err == nil {
+				b.MinRTT, hasRTT = time.Duration(ms*float64(time.Millisecond)), true
+			}
+		}
+	}
+	if !hasBW || !hasRTT {
+		return nil
+	}
+	return &b
+}
+
+// parseSSBandwidth converts a bandwidth as ss prints it, "5.1Mbps" or
+// "980bps", to bytes/sec.
+func parseSSBandwidth(s string) (float64, bool) {
+	num, ok := strings.CutSuffix(s, "bps")
+	if !ok {
+		return 0, false
+	}
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(num, "G"):
+		scale = 1e9
+	case strings.HasSuffix(num, "M"):
+		scale = 1e6
+	case strings.HasSuffix(num, "K"), strings.HasSuffix(num, "k"):
+		scale = 1e3
+	}
+	if scale > 1 {
+		num = num[:len(num)-1]
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * scale / 8, true
+}
+
+// parseSSQoS reads the tos:, tclass: and class_id: fields printed by
+// `ss --tos`. IPv6 sockets are marked by their traffic class; IPv4 ones by
+// TOS. It returns nil when the fields are absent.
+func parseSSQoS(fields []string, v6 bool) *QoS {
+	var q QoS
+	found := false
+	for _, tok := range fields {
+		key, value, ok := strings.Cut(tok, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			continue
+		}
+		switch {
+		case key == "tos" && !v6, key == "tclass" && v6:
+			q.TOS = uint8(n)
+			found = true
+		case key == "class_id":
+			q.Priority, q.HasPriority = uint32(n), true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &q
+}
+
+// parseSSAddr parses "1.2.3.4:80", "[::1]:631", "127.0.0.53%lo:53" or "*:*".
+// The bool result reports an IPv6 address.
+func parseSSAddr(s string) (string, int, bool, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return "", 0, false, fmt.Errorf("invalid ss addr: %s", s)
+	}
+	host, portStr := s[:i], s[i+1:]
+
+	port := 0
+	if portStr != "*" {
+		p, err := strconv.Atoi(portStr)
+		if err != nil {
+			return "", 0, false, err
+		}
+		port = p
+	}
+
+	v6 := strings.HasPrefix(host, "[")
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j] // drop interface scope
+	}
+	if host == "*" {
+		return host, port, v6, nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", 0, false, fmt.Errorf("invalid ss addr: %s", s)
+	}
+	return ip.String(), port, v6 || ip.To4() == nil, nil
+}
+
+// parseSSUsers extracts the first process from `users:(("name",pid=1,fd=3),...)`.
+func parseSSUsers(s string) (string, int, bool) {
+	start := strings.Index(s, `(("`)
+	if start < 0 {
+		return "", 0, false
+	}
+	rest := s[start+3:]
+	end := strings.Index(rest, `"`)
+	if end < 0 {
+		return "", 0, false
+	}
+	name := rest[:end]
+
+	pidIdx := strings.Index(rest, "pid=")
+	if pidIdx < 0 {
+		return name, 0, true
+	}
+	digits := rest[pidIdx+4:]
+	n := 0
+	for n < len(digits) && digits[n] >= '0' && digits[n] <= '9' {
+		n++
+	}
+	pid, _ := strconv.Atoi(digits[:n])
+	return name, pid, true
+}
@@ -0,0 +1,288 @@
+//go:build linux
+
+package tracker
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func parseSSFile(t *testing.T, name string) []*Connection {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	conns, err := parseSS(f, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conns
+}
+
+func TestParseSSPrivileged(t *testing.T) {
+	conns := parseSSFile(t, "ss_root.txt")
+	want := []struct {
+		app      string
+		pid      int
+		protocol string
+		state    ConnState
+		local    string
+		lport    int
+		remote   string
+		rport    int
+		dir      Direction
+	}{
+		{"systemd-resolve", 612, "udp", StateUnconnected, "127.0.0.53", 53, "0.0.0.0", 0, Inbound},
+		{"sshd", 881, "tcp", StateListening, "0.0.0.0", 22, "0.0.0.0", 0, Inbound},
+		{"firefox", 4242, "tcp", StateEstablished, "192.168.1.23", 52814, "142.250.74.36", 443, Outbound},
+		{"sshd", 900, "tcp6", StateEstablished, "10.0.0.5", 22, "10.0.0.9", 51000, Outbound},
+		{"nginx", 1200, "tcp6", StateEstablished, "2001:db8::1", 443, "2001:db8::2", 40000, Outbound},
+		{"unknown", 0, "tcp", StateTimeWait, "192.168.1.23", 52700, "93.184.216.34", 80, Outbound},
+	}
+	if len(conns) != len(want) {
+		t.Fatalf("got %d connections, want %d", len(conns), len(want))
+	}
+	for i, w := range want {
+		c := conns[i]
+		if c.AppName != w.app || c.PID != w.pid || c.Protocol != w.protocol || c.State != w.state ||
+			c.LocalAddr != w.local || c.LocalPort != w.lport || c.RemoteAddr != w.remote ||
+			c.RemotePort != w.rport || c.Direction != w.dir {
+			t.Errorf("line %d: got %s/%d %s %s %s:%d -> %s:%d %s", i, c.AppName, c.PID, c.Protocol, c.State,
+				c.LocalAddr, c.LocalPort, c.RemoteAddr, c.RemotePort, c.Direction)
+		}
+	}
+
+	ff := conns[2]
+	if ff.KernelRTT != 15200*time.Microsecond || ff.CongestionAlgo != "cubic" {
+		t.Errorf("firefox: rtt %v, algo %q", ff.KernelRTT, ff.CongestionAlgo)
+	}
+	if !ff.HasByteCounts || ff.TxBytes != 3211 || ff.RxBytes != 54321 {
+		t.Errorf("firefox: bytes %d/%d", ff.TxBytes, ff.RxBytes)
+	}
+	if ff.TCPInfo == nil || ff.TCPInfo.Retrans != 2 || ff.TCPInfo.SndWnd != 65535 {
+		t.Errorf("firefox: tcp info %+v", ff.TCPInfo)
+	}
+	if ff.QoS == nil || ff.QoS.TOS != 0x10 || ff.SockMem != 4096 {
+		t.Errorf("firefox: qos %+v, sockmem %d", ff.QoS, ff.SockMem)
+	}
+
+	ssh := conns[3]
+	if ssh.SendQ != 36 || !ssh.HasQueues {
+		t.Errorf("sshd: send queue %d", ssh.SendQ)
+	}
+	if ssh.BBR == nil || ssh.BBR.Bandwidth != 5100000.0/8 || ssh.BBR.MinRTT != 500*time.Microsecond {
+		t.Errorf("sshd: bbr %+v", ssh.BBR)
+	}
+
+	ngx := conns[4]
+	if ngx.QoS == nil || ngx.QoS.TOS != 0x2e || !ngx.QoS.HasPriority || ngx.QoS.Priority != 0x10003 {
+		t.Errorf("nginx: qos %+v", ngx.QoS)
+	}
+	if conns[5].TCPInfo != nil {
+		t.Error("info from the previous socket attached to a bare line")
+	}
+}
+
+func TestParseSSUnprivileged(t *testing.T) {
+	conns := parseSSFile(t, "ss_user.txt")
+	// The bad address and the unix socket are skipped.
+	if len(conns) != 5 {
+		t.Fatalf("got %d connections, want 5", len(conns))
+	}
+	for i, w := range []struct {
+		app string
+		pid int
+	}{
+		{"unknown", 0},
+		{"unknown", 0},
+		{"git-remote-http", 7001},
+		{"code", 0}, // cut off before the pid
+		{"unknown", 0},
+	} {
+		if conns[i].AppName != w.app || conns[i].PID != w.pid {
+			t.Errorf("line %d: %s/%d, want %s/%d", i, conns[i].AppName, conns[i].PID, w.app, w.pid)
+		}
+	}
+	if c := conns[4]; c.Protocol != "tcp6" || c.LocalAddr != "::1" || c.RemotePort != 50500 {
+		t.Errorf("v6 loopback: %s %s -> %d", c.Protocol, c.LocalAddr, c.RemotePort)
+	}
+	for _, c := range conns {
+		if c.TCPInfo != nil || c.SockMemInfo != nil {
+			t.Errorf("%s:%d: info without -i", c.LocalAddr, c.LocalPort)
+		}
+	}
+}
+
+func TestScanConnectionsFallback(t *testing.T) {
+	saved, savedPref := scanBackends, preferredBackend
+	t.Cleanup(func() { scanBackends, preferredBackend = saved, savedPref })
+
+	var tried []string
+	backend := func(name string, conns []*Connection, err error) scanBackend {
+		return scanBackend{name, func() ([]*Connection, error) {
+			tried = append(tried, name)
+			return conns, err
+		}}
+	}
+	ssConn := &Connection{AppName: "from-ss"}
+	scanBackends = []scanBackend{
+		backend("proc", nil, errors.New("permission denied")),
+		backend("ss", []*Connection{ssConn}, nil),
+	}
+
+	conns, err := ScanConnections()
+	if err != nil || len(conns) != 1 || conns[0] != ssConn {
+		t.Fatalf("got %v, %v", conns, err)
+	}
+	if len(tried) != 2 || tried[0] != "proc" {
+		t.Fatalf("tried %v", tried)
+	}
+
+	// The preferred backend goes first and the fallback is not needed.
+	tried = nil
+	if err := SelectScanner("ss"); err != nil {
+		t.Fatal(err)
+	}
+	ScanConnections()
+	if len(tried) != 1 || tried[0] != "ss" {
+		t.Fatalf("tried %v with ss preferred", tried)
+	}
+
+	// Partial results from a failing backend are kept.
+	tried = nil
+	procConn := &Connection{AppName: "from-proc"}
+	scanBackends[0] = backend("proc", []*Connection{procConn}, errors.New("tcp6: no such file"))
+	preferredBackend = "proc"
+	if conns, err := ScanConnections(); err != nil || len(conns) != 1 || conns[0] != procConn {
+		t.Fatalf("partial result: %v, %v", conns, err)
+	}
+
+	if err := SelectScanner("netlink"); err == nil {
+		t.Fatal("unknown backend accepted")
+	}
+}
+
+func TestParseSSQoS(t *testing.T) {
+	tests := []struct {
+		fields []string
+		v6     bool
+		want   *QoS
+	}{
+		{[]string{"tos:0xb8"}, false, &QoS{TOS: 0xb8}},
+		{[]string{"tos:0xb8", "class_id:6"}, false, &QoS{TOS: 0xb8, Priority: 6, HasPriority: true}},
+		{[]string{"tclass:0x88", "tos:0x10"}, true, &QoS{TOS: 0x88}},
+		{[]string{"tos:0x10"}, true, nil}, // an IPv6 socket is marked by its traffic class
+		{[]string{"tclass:0x88"}, false, nil},
+		{[]string{"class_id:6"}, false, nil},
+		{[]string{"tos:bogus", "cubic"}, false, nil},
+		{nil, false, nil},
+	}
+	for _, tt := range tests {
+		got := parseSSQoS(tt.fields, tt.v6)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%v (v6 %v): %+v, want %+v", tt.fields, tt.v6, got, tt.want)
+		}
+	}
+}
+
+// TestParseSSCongestion reads the congestion control algorithm and BBR's
+// path model from captured `ss -tunapiH` info lines: cubic, BBR with and
+// without its info block, reno and dctcp, behind the ts, sack, ecn,
+// ecnseen and fastopen flags.
+func TestParseSSCongestion(t *testing.T) {
+	conns := parseSSFile(t, "ss_cc.txt")
+	want := []struct {
+		app  string
+		algo string
+		bbr  *BBRInfo
+	}{
+		{"firefox", "cubic", nil},
+		{"rclone", "bbr", &BBRInfo{Bandwidth: 98.4e6 / 8, MinRTT: 26917 * time.Microsecond}},
+		{"sshd", "bbr", nil},
+		{"nginx", "reno", nil},
+		{"java", "dctcp", nil},
+		{"wireguard", "", nil},
+	}
+	if len(conns) != len(want) {
+		t.Fatalf("got %d connections, want %d", len(conns), len(want))
+	}
+	for i, w := range want {
+		c := conns[i]
+		if c.AppName != w.app || c.CongestionAlgo != w.algo {
+			t.Errorf("line %d: %s with %q, want %s with %q", i, c.AppName, c.CongestionAlgo, w.app, w.algo)
+		}
+		switch {
+		case w.bbr == nil && c.BBR != nil:
+			t.Errorf("%s: bbr %+v", c.AppName, c.BBR)
+		case w.bbr != nil && (c.BBR == nil || *c.BBR != *w.bbr):
+			t.Errorf("%s: bbr %+v, want %+v", c.AppName, c.BBR, w.bbr)
+		}
+	}
+	if rc := conns[1]; rc.KernelRTT != 27613*time.Microsecond || rc.TxBytes != 812348672 {
+		t.Errorf("rclone: the fields after bbr:(...) were lost: rtt %v, tx %d", rc.KernelRTT, rc.TxBytes)
+	}
+}
+
+func TestParseSSBBR(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *BBRInfo
+	}{
+		{"(bw:5.1Mbps,mrtt:0.5,pacing_gain:2.88672,cwnd_gain:2.88672)", &BBRInfo{Bandwidth: 5.1e6 / 8, MinRTT: 500 * time.Microsecond}},
+		{"(bw:1.2Gbps,mrtt:0.031)", &BBRInfo{Bandwidth: 1.2e9 / 8, MinRTT: 31 * time.Microsecond}},
+		{"(bw:980bps,mrtt:120)", &BBRInfo{Bandwidth: 980.0 / 8, MinRTT: 120 * time.Millisecond}},
+		{"(bw:64kbps,mrtt:12.5)", &BBRInfo{Bandwidth: 8000, MinRTT: 12500 * time.Microsecond}},
+		{"(bw:5.1Mbps)", nil},
+		{"(mrtt:0.5)", nil},
+		{"(bw:fast,mrtt:0.5)", nil},
+		{"(bw:5.1Mbit,mrtt:0.5)", nil},
+	}
+	for _, tt := range tests {
+		got := parseSSBBR(tt.in)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("parseSSBBR(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestParseSSSockMem reads captured `ss -tuanpim` output: the socket
+// memory of each socket, and the congestion algorithm after it.
+func TestParseSSSockMem(t *testing.T) {
+	conns := parseSSFile(t, "ss_skmem.txt")
+	want := []struct {
+		app   string
+		total uint64 // with mem
+		mem   bool
+		algo  string
+	}{
+		{"leaky", 327680 + 3072, true, "cubic"},
+		{"rclone", 1073920 + 2304, true, "bbr"},
+		{"sshd", 0, true, "cubic"},
+		{"avahi-daemon", 2304 + 1792, true, ""},
+		{"java", 0, false, "cubic"},
+		{"java", 0, false, "cubic"},
+	}
+	if len(conns) != len(want) {
+		t.Fatalf("got %d connections, want %d", len(conns), len(want))
+	}
+	for i, w := range want {
+		c := conns[i]
+		if c.AppName != w.app || (c.SockMemInfo != nil) != w.mem || c.SockMem != w.total || c.CongestionAlgo != w.algo {
+			t.Errorf("line %d: %s with %d bytes (info %v, %q), want %s with %d (info %v, %q)",
+				i, c.AppName, c.SockMem, c.SockMemInfo != nil, c.CongestionAlgo, w.app, w.total, w.mem, w.algo)
+		}
+	}
+	if got, want := conns[0].SockMemInfo.String(), "read 320.0 KB of 208.0 KB, send queued 0 B (in stack 0 B) of 85.0 KB, reserved 3.0 KB, 14 drops"; got != want {
+		t.Errorf("breakdown %q, want %q", got, want)
+	}
+	if got, want := conns[2].SockMemInfo.String(), "read 0 B of 360.6 KB, send queued 0 B (in stack 0 B) of 85.0 KB, reserved 0 B, options 320 B"; got != want {
+		t.Errorf("breakdown %q, want %q", got, want)
+	}
+	if rc := conns[1]; rc.KernelRTT != 27613*time.Microsecond {
+		t.Errorf("rclone: rtt %v after skmem", rc.KernelRTT)
+	}
+}
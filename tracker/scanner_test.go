@@ -0,0 +1,230 @@
+//go:build linux
+
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeProc is a synthetic proc tree: <pid>/comm, <pid>/cmdline and
+// <pid>/fd/<n> links to socket:[inode] or a plain file.
+type fakeProc struct {
+	t    testing.TB
+	root string
+}
+
+func newFakeProc(t testing.TB) *fakeProc {
+	p := &fakeProc{t: t, root: t.TempDir()}
+	old := procRoot
+	procRoot = p.root
+	t.Cleanup(func() { procRoot = old })
+	return p
+}
+
+// add creates a process named comm holding the given socket inodes. An
+// empty comm makes a kernel thread.
+func (p *fakeProc) add(pid int, comm string, inodes ...string) {
+	dir := filepath.Join(p.root, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+		p.t.Fatal(err)
+	}
+	cmdline := ""
+	if comm != "" {
+		cmdline = "/usr/bin/" + comm + "\x00"
+	}
+	os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0o644)
+	os.Symlink("/dev/null", filepath.Join(dir, "fd", "0"))
+	for i, inode := range inodes {
+		if err := os.Symlink("socket:["+inode+"]", filepath.Join(dir, "fd", strconv.Itoa(i+3))); err != nil {
+			p.t.Fatal(err)
+		}
+	}
+}
+
+func (p *fakeProc) remove(pid int) {
+	os.RemoveAll(filepath.Join(p.root, strconv.Itoa(pid)))
+}
+
+func newTestResolver() *inodeResolver {
+	return &inodeResolver{
+		socketPIDs:    make(map[int]bool),
+		kernelThreads: make(map[int]bool),
+		ownUID:        -1,
+		foreign:       make(map[int]bool),
+		remembered:    make(map[int]bool),
+	}
+}
+
+func wantSet(inodes ...string) map[string]bool {
+	want := make(map[string]bool, len(inodes))
+	for _, in := range inodes {
+		want[in] = true
+	}
+	return want
+}
+
+func TestResolverResolvesAllInodes(t *testing.T) {
+	p := newFakeProc(t)
+	p.add(1, "init")
+	p.add(2, "") // kthreadd
+	p.add(100, "curl", "1001", "1002")
+	p.add(200, "sshd", "2001")
+	p.add(300, "idle")
+	p.add(400, "", "4001") // kernel threads are never swept
+
+	r := newTestResolver()
+	pids, names := r.resolve(wantSet("1001", "1002", "2001", "4001", "9999"))
+	want := map[string]int{"1001": 100, "1002": 100, "2001": 200}
+	if len(pids) != len(want) {
+		t.Fatalf("resolved %v, want %v", pids, want)
+	}
+	for inode, pid := range want {
+		if pids[inode] != pid {
+			t.Errorf("inode %s: pid %d, want %d", inode, pids[inode], pid)
+		}
+	}
+	if names["1001"] != "curl" || names["2001"] != "sshd" {
+		t.Errorf("names %v", names)
+	}
+	if len(r.socketPIDs) != 2 || !r.socketPIDs[100] || !r.socketPIDs[200] {
+		t.Errorf("socket owners %v, want 100 and 200", r.socketPIDs)
+	}
+	if !r.kernelThreads[2] || !r.kernelThreads[400] {
+		t.Errorf("kernel threads %v", r.kernelThreads)
+	}
+
+	// A new socket in a process that owned none last scan is still found,
+	// and exited PIDs leave the caches.
+	p.add(500, "firefox", "5001")
+	p.remove(200)
+	p.remove(2)
+	pids, _ = r.resolve(wantSet("1001", "5001"))
+	if pids["1001"] != 100 || pids["5001"] != 500 {
+		t.Fatalf("second scan resolved %v", pids)
+	}
+	if r.socketPIDs[200] || !r.socketPIDs[500] {
+		t.Errorf("socket owners %v after the second scan", r.socketPIDs)
+	}
+	if r.kernelThreads[2] {
+		t.Error("exited kernel thread still cached")
+	}
+}
+
+func TestResolverRememberedOwner(t *testing.T) {
+	p := newFakeProc(t)
+	p.add(100, "curl", "1001")
+	r := newTestResolver()
+	r.remember(100)
+	r.resolve(wantSet("1001"))
+	if len(r.remembered) != 0 || !r.socketPIDs[100] {
+		t.Fatalf("remembered %v, owners %v", r.remembered, r.socketPIDs)
+	}
+
+	// An owner that exited between scans yields nothing, not an error.
+	r.remember(700)
+	if pids, _ := r.resolve(wantSet("1001")); pids["1001"] != 100 {
+		t.Fatalf("resolved %v", pids)
+	}
+}
+
+func TestResolveOwnerNewestFirst(t *testing.T) {
+	p := newFakeProc(t)
+	p.add(100, "parent", "1001") // inherited by the child
+	p.add(900, "child", "1001")
+	pid, name, ok := resolveOwner(&Connection{inode: "1001"})
+	if !ok || pid != 900 || name != "child" {
+		t.Fatalf("owner %d %q %v, want the newest PID", pid, name, ok)
+	}
+	if _, _, ok := resolveOwner(&Connection{inode: "4242"}); ok {
+		t.Fatal("resolved an inode nobody holds")
+	}
+}
+
+// benchProc lays out procs processes of which every tenth owns a socket.
+func benchProc(b *testing.B, procs int) map[string]bool {
+	p := newFakeProc(b)
+	want := make(map[string]bool)
+	for pid := 1; pid <= procs; pid++ {
+		if pid%10 == 0 {
+			inode := fmt.Sprint(100000 + pid)
+			want[inode] = true
+			p.add(pid, "app", inode)
+		} else {
+			p.add(pid, "idle")
+		}
+	}
+	return want
+}
+
+// BenchmarkResolveFullSweep is the cost without the owner cache: every
+// process directory is read each scan.
+func BenchmarkResolveFullSweep(b *testing.B) {
+	want := benchProc(b, 500)
+	for b.Loop() {
+		newTestResolver().resolve(want)
+	}
+}
+
+// BenchmarkResolveCached reads only the fd directories of last scan's owners.
+func BenchmarkResolveCached(b *testing.B) {
+	want := benchProc(b, 500)
+	r := newTestResolver()
+	r.resolve(want)
+	for b.Loop() {
+		r.resolve(want)
+	}
+}
+
+func TestParseProcNetUDP(t *testing.T) {
+	type row struct {
+		local      string
+		localPort  int
+		remote     string
+		remotePort int
+		state      ConnState
+		inode      string
+		tx, rx     uint64
+	}
+	tests := []struct {
+		file, protocol string
+		want           []row
+	}{
+		{"proc_net_udp.txt", "udp", []row{
+			{"127.0.0.53", 53, "0.0.0.0", 0, StateUnconnected, "21345", 0, 0},
+			{"0.0.0.0", 5353, "0.0.0.0", 0, StateUnconnected, "21400", 0, 0x300},
+			{"10.0.0.2", 41234, "8.8.8.8", 53, StateEstablished, "31001", 0x40, 0},
+		}},
+		{"proc_net_udp6.txt", "udp6", []row{
+			{"::", 443, "::", 0, StateUnconnected, "41000", 0, 0},
+			{"2001:db8::2", 50000, "2001:db8::1", 443, StateEstablished, "41007", 0, 0},
+			{"192.0.2.5", 123, "::", 0, StateUnconnected, "41010", 0, 0}, // v4-mapped
+		}},
+	}
+	for _, tt := range tests {
+		entries, err := parseProcNet(filepath.Join("testdata", tt.file), tt.protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(tt.want) {
+			t.Fatalf("%s: %d entries, want %d", tt.file, len(entries), len(tt.want))
+		}
+		for i, e := range entries {
+			got := row{e.localAddr, e.localPort, e.remoteAddr, e.remotePort, e.state, e.inode, e.txQueue, e.rxQueue}
+			if got != tt.want[i] || e.protocol != tt.protocol {
+				t.Errorf("%s line %d: %+v, want %+v", tt.file, i+1, got, tt.want[i])
+			}
+		}
+	}
+
+	// TCP keeps CLOSE: only UDP uses it for "not connected".
+	tcp := filepath.Join(t.TempDir(), "tcp")
+	os.WriteFile(tcp, []byte("header\n   0: 0200000A:A112 08080808:0035 07 00000000:00000000 00:00000000 00000000  1000        0 5 1 0000000000000000 100 0 0 10 0\n"), 0o644)
+	if entries, _ := parseProcNet(tcp, "tcp"); len(entries) != 1 || entries[0].state != StateClosed {
+		t.Errorf("tcp state 07: %+v", entries)
+	}
+}
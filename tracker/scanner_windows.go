@@ -3,9 +3,7 @@
 package tracker
 
 import (
-	"encoding/binary"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,125 +17,54 @@ var (
 	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
 	modpsapi    = syscall.NewLazyDLL("psapi.dll")
 
-	procGetExtendedTcpTable      = modiphlpapi.NewProc("GetExtendedTcpTable")
-	procGetExtendedUdpTable      = modiphlpapi.NewProc("GetExtendedUdpTable")
-	procOpenProcess              = modkernel32.NewProc("OpenProcess")
-	procCloseHandle              = modkernel32.NewProc("CloseHandle")
-	procGetProcessImageFileNameW = modkernel32.NewProc("QueryFullProcessImageNameW")
+	procGetExtendedTcpTable        = modiphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable        = modiphlpapi.NewProc("GetExtendedUdpTable")
+	procGetOwnerModuleFromTcpEntry = modiphlpapi.NewProc("GetOwnerModuleFromTcpEntry")
+	procOpenProcess                = modkernel32.NewProc("OpenProcess")
+	procCloseHandle                = modkernel32.NewProc("CloseHandle")
+	procGetProcessImageFileNameW   = modkernel32.NewProc("QueryFullProcessImageNameW")
 )
 
 const (
-	TCP_TABLE_OWNER_PID_ALL = 5
-	UDP_TABLE_OWNER_PID     = 1
-	AF_INET                 = 2
-	AF_INET6                = 23
+	TCP_TABLE_OWNER_PID_ALL    = 5
+	TCP_TABLE_OWNER_MODULE_ALL = 8
+	UDP_TABLE_OWNER_PID        = 1
+	AF_INET                    = 2
+	AF_INET6                   = 23
 
 	PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
-)
-
-// Windows TCP connection states
-var winTCPStates = map[uint32]ConnState{
-	1:  StateClosed,
-	2:  StateListening,
-	3:  StateSynSent,
-	4:  StateSynRecv,
-	5:  StateEstablished,
-	6:  StateFinWait1,
-	7:  StateFinWait2,
-	8:  StateCloseWait,
-	9:  StateClosing,
-	10: StateLastAck,
-	11: StateTimeWait,
-	12: StateClosed, // MIB_TCP_STATE_DELETE_TCB
-}
-
-// MIB_TCPROW_OWNER_PID structure
-type tcpRowOwnerPID struct {
-	State      uint32
-	LocalAddr  uint32
-	LocalPort  uint32
-	RemoteAddr uint32
-	RemotePort uint32
-	OwningPid  uint32
-}
-
-// MIB_UDPROW_OWNER_PID structure
-type udpRowOwnerPID struct {
-	LocalAddr uint32
-	LocalPort uint32
-	OwningPid uint32
-}
-
-// MIB_TCP6ROW_OWNER_PID structure
-type tcp6RowOwnerPID struct {
-	LocalAddr     [16]byte
-	LocalScopeId  uint32
-	LocalPort     uint32
-	RemoteAddr    [16]byte
-	RemoteScopeId uint32
-	RemotePort    uint32
-	State         uint32
-	OwningPid     uint32
-}
 
-// MIB_UDP6ROW_OWNER_PID structure
-type udp6RowOwnerPID struct {
-	LocalAddr    [16]byte
-	LocalScopeId uint32
-	LocalPort    uint32
-	OwningPid    uint32
-}
+	TCPIP_OWNER_MODULE_INFO_BASIC = 0
+)
 
-// ScanConnections uses Windows API to discover active connections.
+// ScanConnections uses Windows API to discover active connections. Process
+// names come from procNames, which opens only processes it has not seen.
 func ScanConnections() ([]*Connection, error) {
 	now := time.Now()
 
-	var conns []*Connection
-
-	// TCP IPv4
-	if entries, err := getTCPTable(); err == nil {
-		for _, e := range entries {
-			conns = append(conns, e.toConnection(now))
-		}
-	}
-
-	// TCP IPv6
-	if entries, err := getTCP6Table(); err == nil {
-		for _, e := range entries {
-			conns = append(conns, e.toConnection(now))
+	var entries []connEntry
+	for _, get := range []func() ([]connEntry, error){getTCPTable, getTCP6Table, getUDPTable, getUDP6Table} {
+		if e, err := get(); err == nil {
+			entries = append(entries, e...)
 		}
 	}
 
-	// UDP IPv4
-	if entries, err := getUDPTable(); err == nil {
-		for _, e := range entries {
-			conns = append(conns, e.toConnection(now))
-		}
+	resolveStart := time.Now()
+	pids := make([]int, len(entries))
+	for i, e := range entries {
+		pids[i] = e.pid
 	}
+	names := procNames.resolve(pids)
+	lastResolve.Store(int64(time.Since(resolveStart)))
 
-	// UDP IPv6
-	if entries, err := getUDP6Table(); err == nil {
-		for _, e := range entries {
-			conns = append(conns, e.toConnection(now))
-		}
+	conns := make([]*Connection, 0, len(entries))
+	for _, e := range entries {
+		conns = append(conns, e.toConnection(now, names[e.pid]))
 	}
-
 	return conns, nil
 }
 
-// connEntry is a unified entry before converting to Connection
-type connEntry struct {
-	protocol   string
-	localAddr  string
-	localPort  int
-	remoteAddr string
-	remotePort int
-	state      ConnState
-	pid        int
-}
-
-func (e *connEntry) toConnection(now time.Time) *Connection {
-	name := getProcessName(e.pid)
+func (e *connEntry) toConnection(now time.Time, name string) *Connection {
 	if name == "" {
 		name = "unknown"
 	}
@@ -157,256 +84,88 @@ func (e *connEntry) toConnection(now time.Time) *Connection {
 		RemoteAddr:  e.remoteAddr,
 		RemotePort:  e.remotePort,
 		State:       e.state,
+		Provenance:  []string{ProvenanceIphlpapi},
 		FirstSeen:   now,
 		LastUpdated: now,
 	}
 }
 
-// networkToHostPort converts a network-byte-order port (uint32 with port in high 16 bits) to host port.
-func networkToHostPort(p uint32) int {
-	// The port is stored in network byte order in the first 2 bytes of the uint32
-	b := make([]byte, 4)
-	binary.LittleEndian.PutUint32(b, p)
-	return int(binary.BigEndian.Uint16(b[:2]))
-}
+// errInsufficientBuffer is ERROR_INSUFFICIENT_BUFFER: the table grew
+// since its size was asked for.
+const errInsufficientBuffer = 122
 
-// uint32ToIP converts a uint32 to an IPv4 string.
-func uint32ToIP(addr uint32) string {
-	ip := make(net.IP, 4)
-	binary.LittleEndian.PutUint32(ip, addr)
-	return ip.String()
-}
-
-// getTCPTable retrieves TCP IPv4 connections.
-func getTCPTable() ([]connEntry, error) {
+// fetchTable calls GetExtendedTcpTable or GetExtendedUdpTable for the
+// table of family and class, growing the buffer while the table grows
+// between the calls.
+func fetchTable(proc *syscall.LazyProc, name string, family, class uintptr) ([]byte, error) {
 	var size uint32
-	// First call to get size
-	ret, _, _ := procGetExtendedTcpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0, // no sort
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 && ret != 122 { // 122 = ERROR_INSUFFICIENT_BUFFER
-		return nil, fmt.Errorf("GetExtendedTcpTable size query failed: %d", ret)
+	ret, _, _ := proc.Call(0, uintptr(unsafe.Pointer(&size)), 0, family, class, 0)
+	if ret != 0 && ret != errInsufficientBuffer {
+		return nil, fmt.Errorf("%s size query failed: %d", name, ret)
 	}
-
-	buf := make([]byte, size)
-	ret, _, _ = procGetExtendedTcpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 {
-		return nil, fmt.Errorf("GetExtendedTcpTable failed: %d", ret)
-	}
-
-	numEntries := *(*uint32)(unsafe.Pointer(&buf[0]))
-	var entries []connEntry
-
-	rowSize := unsafe.Sizeof(tcpRowOwnerPID{})
-	for i := uint32(0); i < numEntries; i++ {
-		row := (*tcpRowOwnerPID)(unsafe.Pointer(&buf[4+uintptr(i)*rowSize]))
-
-		state, ok := winTCPStates[row.State]
-		if !ok {
-			state = StateUnknown
+	for range 3 {
+		// uint32s, so the buffer has the alignment of the rows
+		words := make([]uint32, (size+3)/4+1)
+		buf := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*4)
+		size = uint32(len(buf))
+		ret, _, _ = proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0, family, class, 0)
+		switch ret {
+		case 0:
+			return buf[:size], nil
+		case errInsufficientBuffer:
+			continue // size is the new one
 		}
-
-		entries = append(entries, connEntry{
-			protocol:   "tcp",
-			localAddr:  uint32ToIP(row.LocalAddr),
-			localPort:  networkToHostPort(row.LocalPort),
-			remoteAddr: uint32ToIP(row.RemoteAddr),
-			remotePort: networkToHostPort(row.RemotePort),
-			state:      state,
-			pid:        int(row.OwningPid),
-		})
+		return nil, fmt.Errorf("%s failed: %d", name, ret)
 	}
+	return nil, fmt.Errorf("%s: the table keeps growing", name)
+}
 
-	return entries, nil
+// getTCPTable retrieves TCP IPv4 connections.
+func getTCPTable() ([]connEntry, error) {
+	buf, err := fetchTable(procGetExtendedTcpTable, "GetExtendedTcpTable", AF_INET, TCP_TABLE_OWNER_PID_ALL)
+	if err != nil {
+		return nil, err
+	}
+	return parseTCPTable(buf)
 }
 
 // getTCP6Table retrieves TCP IPv6 connections.
 func getTCP6Table() ([]connEntry, error) {
-	var size uint32
-	ret, _, _ := procGetExtendedTcpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET6,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 && ret != 122 {
-		return nil, fmt.Errorf("GetExtendedTcpTable6 size query failed: %d", ret)
-	}
-
-	buf := make([]byte, size)
-	ret, _, _ = procGetExtendedTcpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET6,
-		TCP_TABLE_OWNER_PID_ALL,
-		0,
-	)
-	if ret != 0 {
-		return nil, fmt.Errorf("GetExtendedTcpTable6 failed: %d", ret)
-	}
-
-	numEntries := *(*uint32)(unsafe.Pointer(&buf[0]))
-	var entries []connEntry
-
-	rowSize := unsafe.Sizeof(tcp6RowOwnerPID{})
-	for i := uint32(0); i < numEntries; i++ {
-		row := (*tcp6RowOwnerPID)(unsafe.Pointer(&buf[4+uintptr(i)*rowSize]))
-
-		state, ok := winTCPStates[row.State]
-		if !ok {
-			state = StateUnknown
-		}
-
-		localIP := net.IP(row.LocalAddr[:]).String()
-		remoteIP := net.IP(row.RemoteAddr[:]).String()
-
-		entries = append(entries, connEntry{
-			protocol:   "tcp6",
-			localAddr:  localIP,
-			localPort:  networkToHostPort(row.LocalPort),
-			remoteAddr: remoteIP,
-			remotePort: networkToHostPort(row.RemotePort),
-			state:      state,
-			pid:        int(row.OwningPid),
-		})
+	buf, err := fetchTable(procGetExtendedTcpTable, "GetExtendedTcpTable6", AF_INET6, TCP_TABLE_OWNER_PID_ALL)
+	if err != nil {
+		return nil, err
 	}
-
-	return entries, nil
+	return parseTCP6Table(buf)
 }
 
-// getUDPTable retrieves UDP IPv4 connections.
+// getUDPTable retrieves UDP IPv4 sockets.
 func getUDPTable() ([]connEntry, error) {
-	var size uint32
-	ret, _, _ := procGetExtendedUdpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 && ret != 122 {
-		return nil, fmt.Errorf("GetExtendedUdpTable size query failed: %d", ret)
-	}
-
-	buf := make([]byte, size)
-	ret, _, _ = procGetExtendedUdpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 {
-		return nil, fmt.Errorf("GetExtendedUdpTable failed: %d", ret)
-	}
-
-	numEntries := *(*uint32)(unsafe.Pointer(&buf[0]))
-	var entries []connEntry
-
-	rowSize := unsafe.Sizeof(udpRowOwnerPID{})
-	for i := uint32(0); i < numEntries; i++ {
-		row := (*udpRowOwnerPID)(unsafe.Pointer(&buf[4+uintptr(i)*rowSize]))
-
-		entries = append(entries, connEntry{
-			protocol:   "udp",
-			localAddr:  uint32ToIP(row.LocalAddr),
-			localPort:  networkToHostPort(row.LocalPort),
-			remoteAddr: "0.0.0.0",
-			remotePort: 0,
-			state:      StateEstablished,
-			pid:        int(row.OwningPid),
-		})
+	buf, err := fetchTable(procGetExtendedUdpTable, "GetExtendedUdpTable", AF_INET, UDP_TABLE_OWNER_PID)
+	if err != nil {
+		return nil, err
 	}
-
-	return entries, nil
+	return parseUDPTable(buf)
 }
 
-// getUDP6Table retrieves UDP IPv6 connections.
+// getUDP6Table retrieves UDP IPv6 sockets.
 func getUDP6Table() ([]connEntry, error) {
-	var size uint32
-	ret, _, _ := procGetExtendedUdpTable.Call(
-		0,
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET6,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 && ret != 122 {
-		return nil, fmt.Errorf("GetExtendedUdpTable6 size query failed: %d", ret)
-	}
-
-	buf := make([]byte, size)
-	ret, _, _ = procGetExtendedUdpTable.Call(
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-		0,
-		AF_INET6,
-		UDP_TABLE_OWNER_PID,
-		0,
-	)
-	if ret != 0 {
-		return nil, fmt.Errorf("GetExtendedUdpTable6 failed: %d", ret)
-	}
-
-	numEntries := *(*uint32)(unsafe.Pointer(&buf[0]))
-	var entries []connEntry
-
-	rowSize := unsafe.Sizeof(udp6RowOwnerPID{})
-	for i := uint32(0); i < numEntries; i++ {
-		row := (*udp6RowOwnerPID)(unsafe.Pointer(&buf[4+uintptr(i)*rowSize]))
-
-		localIP := net.IP(row.LocalAddr[:]).String()
-
-		entries = append(entries, connEntry{
-			protocol:   "udp6",
-			localAddr:  localIP,
-			localPort:  networkToHostPort(row.LocalPort),
-			remoteAddr: "::",
-			remotePort: 0,
-			state:      StateEstablished,
-			pid:        int(row.OwningPid),
-		})
+	buf, err := fetchTable(procGetExtendedUdpTable, "GetExtendedUdpTable6", AF_INET6, UDP_TABLE_OWNER_PID)
+	if err != nil {
+		return nil, err
 	}
-
-	return entries, nil
+	return parseUDP6Table(buf)
 }
 
-// getProcessName resolves a PID to its executable name on Windows.
-func getProcessName(pid int) string {
-	if pid == 0 {
-		return "System Idle Process"
-	}
-	if pid == 4 {
-		return "System"
-	}
-
-	handle, _, err := procOpenProcess.Call(
+// openProcessName opens pid for the name of its executable, without
+// ".exe". Only procNames calls it, which counts the opens.
+func openProcessName(pid int) (string, bool) {
+	handle, _, _ := procOpenProcess.Call(
 		PROCESS_QUERY_LIMITED_INFORMATION,
 		0,
 		uintptr(pid),
 	)
 	if handle == 0 {
-		// Fallback: try reading from /proc-like approach or just return pid-based name
-		_ = err
-		return fmt.Sprintf("pid:%d", pid)
+		return "", false
 	}
 	defer procCloseHandle.Call(handle)
 
@@ -421,19 +180,99 @@ func getProcessName(pid int) string {
 		uintptr(unsafe.Pointer(&size)),
 	)
 	if ret == 0 {
-		return fmt.Sprintf("pid:%d", pid)
+		return "", false
 	}
+	return exeName(syscall.UTF16ToString(buf[:size])), true
+}
 
-	fullPath := syscall.UTF16ToString(buf[:size])
-	// Extract just the executable name
-	name := filepath.Base(fullPath)
-	// Remove .exe suffix for cleaner display
+// exeName is the name of an executable path or file, without ".exe", for
+// cleaner display.
+func exeName(path string) string {
+	name := filepath.Base(path)
 	name = strings.TrimSuffix(name, ".exe")
-	name = strings.TrimSuffix(name, ".EXE")
+	return strings.TrimSuffix(name, ".EXE")
+}
+
+// ownerModuleNames names the processes in want from the IPv4 TCP
+// owner-module table, which iphlpapi answers from its own records, so no
+// process is opened. Processes without an IPv4 TCP socket, and any the
+// table cannot name, are left out. A service hosted by svchost is named
+// after the service.
+func ownerModuleNames(want map[int]bool) map[int]string {
+	buf, err := fetchTable(procGetExtendedTcpTable, "GetExtendedTcpTable", AF_INET, TCP_TABLE_OWNER_MODULE_ALL)
+	if err != nil {
+		return nil
+	}
+	rows, err := parseTCPModuleTable(buf)
+	if err != nil {
+		return nil
+	}
+	names := make(map[int]string)
+	info := make([]uint64, 128) // TCPIP_OWNER_MODULE_BASIC_INFO and its strings
+	for i := range rows {
+		pid := int(rows[i].OwningPid)
+		if !want[pid] || names[pid] != "" {
+			continue
+		}
+		row := &rows[i]
+		size := uint32(len(info) * 8)
+		ret, _, _ := procGetOwnerModuleFromTcpEntry.Call(uintptr(unsafe.Pointer(row)), TCPIP_OWNER_MODULE_INFO_BASIC,
+			uintptr(unsafe.Pointer(&info[0])), uintptr(unsafe.Pointer(&size)))
+		if ret == errInsufficientBuffer && size <= 64<<10 {
+			info = make([]uint64, (size+7)/8)
+			ret, _, _ = procGetOwnerModuleFromTcpEntry.Call(uintptr(unsafe.Pointer(row)), TCPIP_OWNER_MODULE_INFO_BASIC,
+				uintptr(unsafe.Pointer(&info[0])), uintptr(unsafe.Pointer(&size)))
+		}
+		if ret != 0 {
+			continue
+		}
+		basic := (*ownerModuleBasicInfo)(unsafe.Pointer(&info[0]))
+		if name := utf16String(basic.ModuleName, len(info)*4); name != "" {
+			names[pid] = exeName(name)
+		}
+	}
+	return names
+}
 
-	return name
+// TCPIP_OWNER_MODULE_BASIC_INFO: pointers to the strings that follow it
+// in the same buffer.
+type ownerModuleBasicInfo struct {
+	ModuleName *uint16
+	ModulePath *uint16
 }
 
+// utf16String reads a NUL-terminated string of at most limit characters.
+func utf16String(p *uint16, limit int) string {
+	if p == nil {
+		return ""
+	}
+	chars := unsafe.Slice(p, limit)
+	for i, c := range chars {
+		if c == 0 {
+			return syscall.UTF16ToString(chars[:i])
+		}
+	}
+	return ""
+}
+
+// needsResolve reports whether the name of c's process is worth looking up
+// again: the table gave its PID, but the process could not be opened.
+func needsResolve(c *Connection) bool {
+	return c.PID > 4 && (c.AppName == "unknown" || c.AppName == fmt.Sprintf("pid:%d", c.PID))
+}
+
+// resolveOwner opens c's process again for its name.
+func resolveOwner(c *Connection) (int, string, bool) {
+	name, ok := procNames.retry(c.PID)
+	if !ok {
+		return 0, "", false
+	}
+	return c.PID, name, true
+}
+
+// rememberOwner does nothing: the Windows tables carry the PID.
+func rememberOwner(pid int) {}
+
 // isAdmin checks if the current process is running with administrator privileges on Windows.
 func isAdmin() bool {
 	_, err := os.Open("\\\\.\\PHYSICALDRIVE0")
@@ -442,3 +281,12 @@ func isAdmin() bool {
 	}
 	return true
 }
+
+// SelectScanner picks the socket enumeration backend. Windows only has the
+// iphlpapi backend.
+func SelectScanner(name string) error {
+	if name != "iphlpapi" {
+		return fmt.Errorf("unknown scanner %q (Windows supports iphlpapi only)", name)
+	}
+	return nil
+}
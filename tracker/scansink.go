@@ -0,0 +1,16 @@
+package tracker
+
+import "time"
+
+// ScanSink receives the connections after every scan and its pings, e.g. to
+// push them to a time series database. ExportScan is called from the scan
+// loop, so implementations must queue the data and return without blocking.
+// conns is a snapshot the sink may keep.
+type ScanSink interface {
+	ExportScan(now time.Time, conns []*Connection)
+}
+
+// SetScanSink attaches a per-scan exporter. Must be called before Start.
+func (t *Tracker) SetScanSink(s ScanSink) {
+	t.scanSink = s
+}
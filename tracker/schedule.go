@@ -0,0 +1,303 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// reducedProbeFactor stretches every tier's probe spacing while a
+	// window with ProbesReduced is active.
+	reducedProbeFactor = 4
+
+	// maxScheduleEvents bounds the session's schedule transition log.
+	maxScheduleEvents = 100
+)
+
+// ProbePolicy is what a schedule window does to ping probes.
+type ProbePolicy string
+
+const (
+	ProbesNormal  ProbePolicy = ""
+	ProbesReduced ProbePolicy = "reduced" // each tier probed reducedProbeFactor times less often
+	ProbesOff     ProbePolicy = "off"
+)
+
+// Weekdays is a set of days of the week, bit i for time.Weekday(i). The
+// zero value means every day.
+type Weekdays uint8
+
+// Has reports whether d is in the set.
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w == 0 || w&(1<<d) != 0
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseWeekdays parses a comma-separated list of days and day ranges, e.g.
+// "mon-fri" or "sat,sun"; ranges may wrap ("fri-mon"). "" means every day.
+func ParseWeekdays(s string) (Weekdays, error) {
+	var w Weekdays
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		a, ok := weekdayIndex(from)
+		b := a
+		if isRange {
+			var okTo bool
+			b, okTo = weekdayIndex(to)
+			ok = ok && okTo
+		}
+		if !ok {
+			return 0, fmt.Errorf("invalid day %q (want sun, mon, ..., sat or a range like mon-fri)", part)
+		}
+		for d := a; ; d = (d + 1) % 7 {
+			w |= 1 << d
+			if d == b {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+func weekdayIndex(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	for i, name := range weekdayNames {
+		if s == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock parses "HH:MM" into minutes after midnight; "24:00" is
+// allowed as an end time.
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh > 24 || hh == 24 && mm != 0 {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// ScheduleWindow is a recurring time of day, on some days of the week,
+// with the behavior that applies during it. Times are local wall-clock
+// times, so a window keeps its hours across DST changes.
+type ScheduleWindow struct {
+	Name string
+	Days Weekdays // the days the window starts on
+	// Start and End are minutes after midnight. A window with End <= Start
+	// spans midnight and ends on the day after it starts.
+	Start, End int
+
+	Probes         ProbePolicy
+	Silent         bool    // no announcements in accessible mode
+	IntervalFactor float64 // multiplies the scan interval; 0 or 1 leaves it
+}
+
+// ParseScheduleWindow builds a window from a schedule config entry: days
+// as for ParseWeekdays, span as "22:00-08:00", probes "", "reduced" or
+// "off". Errors name the window.
+func ParseScheduleWindow(name, days, span, probes string, silent bool, factor float64) (ScheduleWindow, error) {
+	w := ScheduleWindow{Name: name, Probes: ProbePolicy(probes), Silent: silent, IntervalFactor: factor}
+	fail := func(err error) (ScheduleWindow, error) {
+		return ScheduleWindow{}, fmt.Errorf("schedule: window %q: %v", name, err)
+	}
+	if name == "" {
+		return ScheduleWindow{}, fmt.Errorf("schedule: window %q has no name", span)
+	}
+	var err error
+	if w.Days, err = ParseWeekdays(days); err != nil {
+		return fail(err)
+	}
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return fail(fmt.Errorf("invalid time range %q (want HH:MM-HH:MM)", span))
+	}
+	if w.Start, err = parseClock(from); err != nil {
+		return fail(err)
+	}
+	if w.End, err = parseClock(to); err != nil {
+		return fail(err)
+	}
+	if w.Start == 24*60 || w.Start == w.End {
+		return fail(fmt.Errorf("empty time range %q", span))
+	}
+	switch w.Probes {
+	case ProbesNormal, ProbesReduced, ProbesOff:
+	default:
+		return fail(fmt.Errorf("invalid probes %q (want reduced or off)", probes))
+	}
+	if factor < 0 {
+		return fail(fmt.Errorf("invalid interval_factor %v", factor))
+	}
+	return w, nil
+}
+
+// spansMidnight reports whether the window ends on the day after it starts.
+func (w ScheduleWindow) spansMidnight() bool {
+	return w.End <= w.Start
+}
+
+// Contains reports whether t falls in the window. Only t's weekday and
+// wall-clock time matter, so the answer is the same for every instant
+// with the same local time, on either side of a DST change.
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if !w.spansMidnight() {
+		return w.Days.Has(day) && m >= w.Start && m < w.End
+	}
+	if m >= w.Start {
+		return w.Days.Has(day)
+	}
+	return m < w.End && w.Days.Has((day+6)%7)
+}
+
+// Until returns when the occurrence of the window containing t ends. A
+// wall-clock end that falls in a DST gap is normalized by time.Date.
+func (w ScheduleWindow) Until(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	if w.spansMidnight() && t.Hour()*60+t.Minute() >= w.Start {
+		d++
+	}
+	return time.Date(y, mo, d, w.End/60, w.End%60, 0, 0, t.Location())
+}
+
+// Schedule is the configured windows. Where windows overlap, the first
+// one in config order applies; the others are ignored until it ends.
+type Schedule []ScheduleWindow
+
+// Match returns the window that applies at t.
+func (s Schedule) Match(t time.Time) (ScheduleWindow, bool) {
+	for _, w := range s {
+		if w.Contains(t) {
+			return w, true
+		}
+	}
+	return ScheduleWindow{}, false
+}
+
+// ScheduleEvent is a schedule window starting or ending.
+type ScheduleEvent struct {
+	Time    time.Time
+	Window  string
+	Started bool
+}
+
+// ScheduleStatus is the window in effect and when it ends.
+type ScheduleStatus struct {
+	Active bool
+	Window ScheduleWindow
+	Until  time.Time
+}
+
+// SetSchedule sets the time windows that override probing, announcements
+// and the scan interval, and applies it at once. It is safe to call while
+// the tracker is running.
+func (t *Tracker) SetSchedule(s Schedule) {
+	t.mu.Lock()
+	t.schedule = s
+	t.mu.Unlock()
+	t.applySchedule(time.Now())
+}
+
+// applySchedule switches to the window that applies at now, logging the
+// transition, and restarts the scan ticker when the interval changes.
+// Called on a minute tick.
+func (t *Tracker) applySchedule(now time.Time) {
+	t.mu.Lock()
+	w, ok := t.schedule.Match(now)
+	prev := t.scheduleStatus
+	if ok != prev.Active || w != prev.Window {
+		if prev.Active {
+			t.logSchedule(ScheduleEvent{Time: now, Window: prev.Window.Name})
+		}
+		if ok {
+			t.logSchedule(ScheduleEvent{Time: now, Window: w.Name, Started: true})
+		}
+	}
+	t.scheduleStatus = ScheduleStatus{Active: ok, Window: w}
+	if ok {
+		t.scheduleStatus.Until = w.Until(now)
+	}
+	changed := t.effectiveInterval() != t.intervalFor(prev)
+	t.mu.Unlock()
+	if changed {
+		t.resetTicker()
+	}
+}
+
+// logSchedule appends e to the transition log. Caller must hold the lock.
+func (t *Tracker) logSchedule(e ScheduleEvent) {
+	state := "ended"
+	if e.Started {
+		state = "started"
+	}
+	t.emit(e.Time, SeverityInfo, EventSchedule, "window", e.Window, "state", state)
+	t.scheduleLog = append(t.scheduleLog, e)
+	if over := len(t.scheduleLog) - maxScheduleEvents; over > 0 {
+		t.scheduleLog = append([]ScheduleEvent(nil), t.scheduleLog[over:]...)
+	}
+}
+
+// intervalFor is the scan interval under status s, stretched further
+// while the load throttle is on. Caller must hold the lock.
+func (t *Tracker) intervalFor(s ScheduleStatus) time.Duration {
+	d := t.interval
+	if s.Active && s.Window.IntervalFactor > 0 {
+		d = time.Duration(float64(d) * s.Window.IntervalFactor)
+	}
+	if t.loadStatus.Throttled {
+		d = time.Duration(float64(d) * t.loadThrottle.IntervalFactor)
+	}
+	return d
+}
+
+// effectiveInterval is the scan interval now in effect. Caller must hold
+// the lock.
+func (t *Tracker) effectiveInterval() time.Duration {
+	return t.intervalFor(t.scheduleStatus)
+}
+
+// probePolicy is the probe policy now in effect. Caller must hold the lock.
+func (t *Tracker) probePolicy() ProbePolicy {
+	if !t.scheduleStatus.Active {
+		return ProbesNormal
+	}
+	return t.scheduleStatus.Window.Probes
+}
+
+// ProbeInterval is how often a connection in tier is probed under the
+// current interval and probe policy.
+func (t *Tracker) ProbeInterval(tier PingTier) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	every := tier.Every()
+	if t.probePolicy() == ProbesReduced {
+		every *= reducedProbeFactor
+	}
+	return t.effectiveInterval() * time.Duration(every)
+}
+
+// ScheduleStatus returns the window in effect, if any.
+func (t *Tracker) ScheduleStatus() ScheduleStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.scheduleStatus
+}
+
+// ScheduleEvents returns this session's schedule transitions, oldest first.
+func (t *Tracker) ScheduleEvents() []ScheduleEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]ScheduleEvent(nil), t.scheduleLog...)
+}
@@ -0,0 +1,281 @@
+package tracker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustWindow(t *testing.T, name, days, span, probes string) ScheduleWindow {
+	t.Helper()
+	w, err := ParseScheduleWindow(name, days, span, probes, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestParseWeekdays(t *testing.T) {
+	set := func(days ...time.Weekday) Weekdays {
+		var w Weekdays
+		for _, d := range days {
+			w |= 1 << d
+		}
+		return w
+	}
+	tests := map[string]Weekdays{
+		"":            0,
+		"mon-fri":     set(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday),
+		"sat, SUN":    set(time.Saturday, time.Sunday),
+		"fri-mon":     set(time.Friday, time.Saturday, time.Sunday, time.Monday),
+		"wed":         set(time.Wednesday),
+		"sun-sat":     0x7f,
+		"tue,tue-wed": set(time.Tuesday, time.Wednesday),
+	}
+	for s, want := range tests {
+		if got, err := ParseWeekdays(s); err != nil || got != want {
+			t.Errorf("%q: %07b %v, want %07b", s, got, err, want)
+		}
+	}
+	for _, bad := range []string{"monday", "mon-", "-fri", "mon fri", "x"} {
+		if _, err := ParseWeekdays(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	if !Weekdays(0).Has(time.Thursday) {
+		t.Error("the empty set does not mean every day")
+	}
+}
+
+func TestParseScheduleWindow(t *testing.T) {
+	w, err := ParseScheduleWindow("quiet", "mon-fri", "22:00-08:30", "reduced", true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Start != 22*60 || w.End != 8*60+30 || w.Probes != ProbesReduced || !w.Silent || w.IntervalFactor != 2 {
+		t.Errorf("%+v", w)
+	}
+	if w, err := ParseScheduleWindow("day", "", "00:00-24:00", "", false, 0); err != nil || w.End != 24*60 {
+		t.Errorf("whole day: %+v %v", w, err)
+	}
+	tests := []struct {
+		name, days, span, probes string
+		factor                   float64
+		err                      string
+	}{
+		{"", "", "22:00-08:00", "", 0, `window "22:00-08:00" has no name`},
+		{"w", "weekdays", "22:00-08:00", "", 0, `window "w": invalid day "weekdays"`},
+		{"w", "", "22:00", "", 0, `window "w": invalid time range`},
+		{"w", "", "25:00-08:00", "", 0, `invalid time "25:00"`},
+		{"w", "", "22:60-08:00", "", 0, `invalid time "22:60"`},
+		{"w", "", "22:00-24:01", "", 0, `invalid time "24:01"`},
+		{"w", "", "24:00-08:00", "", 0, "empty time range"},
+		{"w", "", "08:00-08:00", "", 0, "empty time range"},
+		{"w", "", "22:00-08:00", "none", 0, `invalid probes "none"`},
+		{"w", "", "22:00-08:00", "", -1, "invalid interval_factor -1"},
+	}
+	for _, tt := range tests {
+		_, err := ParseScheduleWindow(tt.name, tt.days, tt.span, tt.probes, false, tt.factor)
+		if err == nil || !strings.HasPrefix(err.Error(), "schedule: ") || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s %q: error %v, want %s", tt.days, tt.span, err, tt.err)
+		}
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2026-03-06 is a Friday.
+	at := func(day, hh, mm int) time.Time { return time.Date(2026, 3, day, hh, mm, 0, 0, time.UTC) }
+	night := mustWindow(t, "night", "mon-fri", "22:00-08:00", "")
+	lunch := mustWindow(t, "lunch", "sat,sun", "12:00-13:00", "")
+	tests := []struct {
+		w    ScheduleWindow
+		t    time.Time
+		want bool
+	}{
+		{night, at(6, 21, 59), false},
+		{night, at(6, 22, 0), true},
+		{night, at(6, 23, 59), true},
+		{night, at(7, 0, 0), true}, // Saturday morning: the Friday night window
+		{night, at(7, 7, 59), true},
+		{night, at(7, 8, 0), false},
+		{night, at(7, 22, 0), false}, // Saturday night: not a window day
+		{night, at(8, 23, 0), false},
+		{night, at(9, 3, 0), false}, // Monday morning: started on Sunday
+		{night, at(9, 22, 30), true},
+		{night, at(10, 7, 0), true},
+		{lunch, at(7, 11, 59), false},
+		{lunch, at(7, 12, 0), true},
+		{lunch, at(8, 12, 59), true},
+		{lunch, at(8, 13, 0), false},
+		{lunch, at(9, 12, 30), false},
+	}
+	for _, tt := range tests {
+		if got := tt.w.Contains(tt.t); got != tt.want {
+			t.Errorf("%s at %s: %v", tt.w.Name, tt.t.Format("Mon 15:04"), got)
+		}
+	}
+
+	for _, tt := range []struct {
+		w        ScheduleWindow
+		t, until time.Time
+	}{
+		{night, at(6, 22, 0), at(7, 8, 0)},
+		{night, at(7, 3, 0), at(7, 8, 0)},
+		{lunch, at(7, 12, 30), at(7, 13, 0)},
+		{mustWindow(t, "day", "", "00:00-24:00", ""), at(7, 12, 0), at(8, 0, 0)},
+	} {
+		if got := tt.w.Until(tt.t); !got.Equal(tt.until) {
+			t.Errorf("%s at %s: until %s, want %s", tt.w.Name, tt.t.Format("Mon 15:04"), got, tt.until)
+		}
+	}
+}
+
+// TestScheduleMatchOrder checks the first window in config order wins
+// where windows overlap.
+func TestScheduleMatchOrder(t *testing.T) {
+	weekend := mustWindow(t, "weekend", "sat,sun", "00:00-24:00", "off")
+	night := mustWindow(t, "night", "", "22:00-08:00", "reduced")
+	sat := time.Date(2026, 3, 7, 23, 0, 0, 0, time.UTC)
+	fri := time.Date(2026, 3, 6, 23, 0, 0, 0, time.UTC)
+	if w, ok := (Schedule{weekend, night}).Match(sat); !ok || w.Name != "weekend" {
+		t.Errorf("weekend first: %q %v", w.Name, ok)
+	}
+	if w, ok := (Schedule{night, weekend}).Match(sat); !ok || w.Name != "night" {
+		t.Errorf("night first: %q %v", w.Name, ok)
+	}
+	if w, ok := (Schedule{weekend, night}).Match(fri); !ok || w.Name != "night" {
+		t.Errorf("Friday: %q %v", w.Name, ok)
+	}
+	if _, ok := (Schedule{weekend, night}).Match(fri.Add(-12 * time.Hour)); ok {
+		t.Error("matched outside every window")
+	}
+	if _, ok := Schedule(nil).Match(sat); ok {
+		t.Error("empty schedule matched")
+	}
+}
+
+// TestScheduleDST walks the DST change nights in Berlin minute by minute:
+// windows follow the wall clock, so a window in the skipped hour never
+// applies and one in the repeated hour applies twice as long.
+func TestScheduleDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// minutesIn counts the real minutes w applies from Saturday 18:00 to
+	// Monday 06:00 around day.
+	minutesIn := func(w ScheduleWindow, day time.Time) int {
+		n := 0
+		for m := day.Add(-6 * time.Hour); m.Before(day.Add(30 * time.Hour)); m = m.Add(time.Minute) {
+			if w.Contains(m) {
+				n++
+			}
+		}
+		return n
+	}
+	gap := mustWindow(t, "gap", "sun", "02:00-03:00", "")
+	night := mustWindow(t, "night", "sat", "22:00-08:00", "")
+	spring := time.Date(2026, 3, 29, 0, 0, 0, 0, berlin)  // 02:00 CET is 03:00 CEST
+	autumn := time.Date(2026, 10, 25, 0, 0, 0, 0, berlin) // 03:00 CEST is 02:00 CET
+	tests := []struct {
+		name string
+		w    ScheduleWindow
+		day  time.Time
+		want int
+	}{
+		{"skipped hour", gap, spring, 0},
+		{"repeated hour", gap, autumn, 120},
+		{"night into spring", night, spring, 9 * 60},
+		{"night into autumn", night, autumn, 11 * 60},
+	}
+	for _, tt := range tests {
+		if got := minutesIn(tt.w, tt.day); got != tt.want {
+			t.Errorf("%s: %d minutes, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	sat := time.Date(2026, 3, 28, 23, 0, 0, 0, berlin)
+	if got, want := night.Until(sat), time.Date(2026, 3, 29, 8, 0, 0, 0, berlin); !got.Equal(want) || got.Sub(sat) != 8*time.Hour {
+		t.Errorf("until %s, want %s", got, want)
+	}
+	// The end falls in the gap; it is normalized past it, to 03:30 CEST.
+	into := mustWindow(t, "into", "", "01:00-02:30", "")
+	if got := into.Until(time.Date(2026, 3, 29, 1, 30, 0, 0, berlin)); got.Sub(spring) != 150*time.Minute {
+		t.Errorf("until %s", got)
+	}
+}
+
+func TestApplySchedule(t *testing.T) {
+	tr := NewTracker(2*time.Second, false)
+	quiet, err := ParseScheduleWindow("quiet", "", "22:00-08:00", "reduced", true, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch := mustWindow(t, "lunch", "", "12:00-13:00", "off")
+	tr.mu.Lock()
+	tr.schedule = Schedule{quiet, lunch}
+	tr.mu.Unlock()
+
+	day := time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		at       time.Duration
+		window   string
+		interval time.Duration
+		probe    time.Duration // a normal tier connection's probe spacing
+	}{
+		{21 * time.Hour, "", 2 * time.Second, 6 * time.Second},
+		{22 * time.Hour, "quiet", 6 * time.Second, 72 * time.Second},
+		{23 * time.Hour, "quiet", 6 * time.Second, 72 * time.Second},
+		{32 * time.Hour, "", 2 * time.Second, 6 * time.Second},
+		{36 * time.Hour, "lunch", 2 * time.Second, 6 * time.Second},
+		{37 * time.Hour, "", 2 * time.Second, 6 * time.Second},
+	}
+	for _, s := range steps {
+		now := day.Add(s.at)
+		tr.applySchedule(now)
+		st := tr.ScheduleStatus()
+		if st.Window.Name != s.window || st.Active != (s.window != "") {
+			t.Errorf("%s: window %q", now.Format("Mon 15:04"), st.Window.Name)
+		}
+		tr.mu.RLock()
+		interval := tr.effectiveInterval()
+		tr.mu.RUnlock()
+		if interval != s.interval || tr.ProbeInterval(TierNormal) != s.probe {
+			t.Errorf("%s: interval %v, probe every %v", now.Format("Mon 15:04"), interval, tr.ProbeInterval(TierNormal))
+		}
+	}
+	tr.mu.RLock()
+	policy := tr.probePolicy()
+	tr.mu.RUnlock()
+	if policy != ProbesNormal {
+		t.Errorf("policy %q outside every window", policy)
+	}
+
+	var log []string
+	for _, e := range tr.ScheduleEvents() {
+		log = append(log, e.Time.Format("15:04 ")+e.Window+map[bool]string{true: " started", false: " ended"}[e.Started])
+	}
+	want := "22:00 quiet started, 08:00 quiet ended, 12:00 lunch started, 13:00 lunch ended"
+	if got := strings.Join(log, ", "); got != want {
+		t.Errorf("log %s, want %s", got, want)
+	}
+	tr.applySchedule(day.Add(47 * time.Hour))
+	if st := tr.ScheduleStatus(); !st.Until.Equal(day.Add(56 * time.Hour)) {
+		t.Errorf("until %s", st.Until)
+	}
+}
+
+func TestScheduleLogBound(t *testing.T) {
+	tr := NewTracker(time.Second, false)
+	tr.mu.Lock()
+	tr.schedule = Schedule{mustWindow(t, "w", "", "00:00-00:01", "")}
+	tr.mu.Unlock()
+	start := time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 2*maxScheduleEvents; i++ {
+		tr.applySchedule(start.Add(time.Duration(i) * 12 * time.Hour))
+	}
+	events := tr.ScheduleEvents()
+	if len(events) != maxScheduleEvents || events[0].Started || !events[len(events)-1].Started {
+		t.Fatalf("%d events", len(events))
+	}
+}
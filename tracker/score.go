@@ -0,0 +1,233 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultScoreScans is how many consecutive scans a connection's score must
+// stay below AlertRule.ScoreThreshold when AlertRule.ScoreScans is unset.
+const DefaultScoreScans = 3
+
+// retransBadPct is the share of segments retransmitted between two scans
+// that scores 0; a healthy path retransmits well under 1%.
+const retransBadPct = 5.0
+
+// Health score components, as named in score_weights and ScoreWorst.
+const (
+	ScoreRTT     = "rtt"
+	ScoreLoss    = "loss"
+	ScoreRetrans = "retrans"
+	ScoreStall   = "stall"
+	ScoreReach   = "reach"
+)
+
+// ScoreWeights weigh the components of the health score against each other.
+// Only their ratios matter; a zero weight leaves the component out.
+type ScoreWeights struct {
+	RTT     float64
+	Loss    float64
+	Retrans float64
+	Stall   float64
+	Reach   float64
+}
+
+// DefaultScoreWeights counts latency and loss most, as they are measured
+// for every probed connection.
+var DefaultScoreWeights = ScoreWeights{RTT: 30, Loss: 30, Retrans: 15, Stall: 10, Reach: 15}
+
+// ParseScoreWeights overrides the defaults by component name, e.g.
+// {"retrans": 40}; 0 turns a component off.
+func ParseScoreWeights(overrides map[string]float64) (ScoreWeights, error) {
+	w := DefaultScoreWeights
+	fields := map[string]*float64{
+		ScoreRTT: &w.RTT, ScoreLoss: &w.Loss, ScoreRetrans: &w.Retrans, ScoreStall: &w.Stall, ScoreReach: &w.Reach,
+	}
+	for name, v := range overrides {
+		f, ok := fields[name]
+		if !ok {
+			return ScoreWeights{}, fmt.Errorf("score_weights: unknown component %q (want rtt, loss, retrans, stall or reach)", name)
+		}
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return ScoreWeights{}, fmt.Errorf("score_weights: invalid weight %v for %s", v, name)
+		}
+		*f = v
+	}
+	if w.RTT+w.Loss+w.Retrans+w.Stall+w.Reach == 0 {
+		return ScoreWeights{}, fmt.Errorf("score_weights: every component is turned off")
+	}
+	return w, nil
+}
+
+// ScoreLimits are the points at which latency and loss score 1 and 0.
+type ScoreLimits struct {
+	PingGood time.Duration // at or below: full marks
+	PingBad  time.Duration // at or above: 0
+	LossBad  float64       // percentage at or above which loss scores 0
+}
+
+// DefaultScoreLimits match the table's default ping and loss colors.
+var DefaultScoreLimits = ScoreLimits{PingGood: 50 * time.Millisecond, PingBad: 150 * time.Millisecond, LossBad: 10}
+
+// ScoreLimits takes the limits from the warn and critical thresholds that
+// are set, and the defaults for the rest.
+func (r AlertRule) ScoreLimits() ScoreLimits {
+	lim := DefaultScoreLimits
+	if r.PingThreshold > 0 {
+		lim.PingBad = r.PingThreshold
+	}
+	if r.PingWarn > 0 {
+		lim.PingGood = r.PingWarn
+	}
+	if lim.PingGood >= lim.PingBad {
+		lim.PingGood = lim.PingBad / 3
+	}
+	if r.LossThreshold > 0 {
+		lim.LossBad = r.LossThreshold
+	}
+	return lim
+}
+
+// HealthScore rates a connection from 0 (broken) to 100 (healthy). Each
+// component is normalized to 0..1, and the score is their weighted mean
+// over the components there is data for:
+//   - rtt: 1 up to lim.PingGood, falling linearly to 0 at lim.PingBad,
+//     and 0 while the peer is unreachable; needs a ping measurement
+//   - loss: 1 - Loss/lim.LossBad, 0 from lim.LossBad; needs a probe
+//   - retrans: 1 - RetransRate/5%; needs the ss backend's TCP info
+//   - stall: 0 while a stall is confirmed, 0.5 while the send queue is
+//     over the alert threshold, else 1; needs TCP info or socket queues
+//   - reach: 0 when the last probe failed outright, else 1; needs a probe
+//
+// Remotes that are never probed (see Connection.NoProbe) have no rtt, loss
+// or reach component. worst names the lowest component below 1, or is ""
+// when none is. ok is false for listeners and when there is no data for any
+// component, e.g. an unprobed connection on Windows. HealthScore only reads c.
+func HealthScore(c *Connection, w ScoreWeights, lim ScoreLimits) (score int, worst string, ok bool) {
+	if c.IsListener() {
+		return 0, "", false
+	}
+	var sum, total float64
+	low := 1.0
+	add := func(name string, weight, v float64) {
+		if weight <= 0 {
+			return
+		}
+		v = min(max(v, 0), 1)
+		sum += weight * v
+		total += weight
+		if v < low {
+			low, worst = v, name
+		}
+	}
+
+	probed := c.PingCount > 0 && c.NoProbe == AddrProbeable
+	unreachable := probed && c.Loss >= 100
+	if (c.Ping > 0 && c.NoProbe == AddrProbeable) || unreachable {
+		switch {
+		case unreachable:
+			add(ScoreRTT, w.RTT, 0)
+		case c.Ping <= lim.PingGood:
+			add(ScoreRTT, w.RTT, 1)
+		case c.Ping >= lim.PingBad:
+			add(ScoreRTT, w.RTT, 0)
+		default:
+			add(ScoreRTT, w.RTT, float64(lim.PingBad-c.Ping)/float64(lim.PingBad-lim.PingGood))
+		}
+	}
+	if probed {
+		add(ScoreLoss, w.Loss, 1-c.Loss/lim.LossBad)
+		reach := 1.0
+		if unreachable {
+			reach = 0
+		}
+		add(ScoreReach, w.Reach, reach)
+	}
+	if c.HasRetransRate {
+		add(ScoreRetrans, w.Retrans, 1-c.RetransRate/retransBadPct)
+	}
+	if c.TCPInfo != nil || c.HasQueues {
+		stall := 1.0
+		switch {
+		case !c.StallSince.IsZero():
+			stall = 0
+		case c.SendQHigh > 0:
+			stall = 0.5
+		}
+		add(ScoreStall, w.Stall, stall)
+	}
+
+	if total == 0 {
+		return 0, "", false
+	}
+	return int(math.Round(100 * sum / total)), worst, true
+}
+
+// matchScore is the score: filter: "<50", "<=50", ">80", ">=80" or "=100";
+// a bare number means at most. Connections without a score never match.
+func matchScore(c *Connection, v string) bool {
+	if !c.HasScore {
+		return false
+	}
+	op := strings.TrimRight(v, "0123456789")
+	n, err := strconv.Atoi(v[len(op):])
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "<":
+		return c.Score < n
+	case "<=", "":
+		return c.Score <= n
+	case ">":
+		return c.Score > n
+	case ">=":
+		return c.Score >= n
+	case "=":
+		return c.Score == n
+	}
+	return false
+}
+
+// updateRetrans derives RetransRate from the retransmission counters of the
+// previous scan's TCP info and next, before next replaces it.
+func (c *Connection) updateRetrans(next *TCPInfo) {
+	prev := c.TCPInfo
+	if prev == nil || next == nil || !prev.HasRetrans || !next.HasRetrans ||
+		next.Retrans < prev.Retrans || next.SegsOut < prev.SegsOut {
+		c.RetransRate, c.HasRetransRate = 0, false
+		return
+	}
+	c.HasRetransRate = true
+	c.RetransRate = 0
+	if sent := next.SegsOut - prev.SegsOut; sent > 0 {
+		c.RetransRate = 100 * float64(next.Retrans-prev.Retrans) / float64(sent)
+	}
+}
+
+// SetScoreWeights sets the weights of the health score components. It is
+// safe to call while the tracker is running.
+func (t *Tracker) SetScoreWeights(w ScoreWeights) {
+	t.mu.Lock()
+	t.scoreWeights = w
+	t.mu.Unlock()
+}
+
+// updateScores scores every connection after the scan's probes and counts
+// the consecutive scans each has stayed below the alert rule's ScoreThreshold.
+func (t *Tracker) updateScores() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lim := t.alertRule.ScoreLimits()
+	for _, c := range t.connections {
+		c.Score, c.ScoreWorst, c.HasScore = HealthScore(c, t.scoreWeights, lim)
+		if c.HasScore && c.Score < t.alertRule.ScoreThreshold {
+			c.ScoreLow++
+		} else {
+			c.ScoreLow = 0
+		}
+	}
+}
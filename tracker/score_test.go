@@ -0,0 +1,140 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthScore(t *testing.T) {
+	probed := func(ping time.Duration, loss float64) *Connection {
+		return &Connection{Protocol: "tcp", State: StateEstablished, Ping: ping, PingCount: 5, Loss: loss}
+	}
+	with := func(c *Connection, f func(*Connection)) *Connection { f(c); return c }
+	tests := []struct {
+		name  string
+		c     *Connection
+		score int
+		worst string
+		ok    bool
+	}{
+		{"listener", &Connection{Protocol: "tcp", State: StateListening, Ping: time.Millisecond, PingCount: 1}, 0, "", false},
+		{"no data", &Connection{Protocol: "tcp", State: StateEstablished}, 0, "", false},
+		{"perfect", with(probed(10*time.Millisecond, 0), func(c *Connection) {
+			c.TCPInfo, c.HasRetransRate = &TCPInfo{}, true
+		}), 100, "", true},
+		{"at PingGood", probed(50*time.Millisecond, 0), 100, "", true},
+		// rtt 0.5: (15 + 30 + 15) / 75
+		{"halfway to PingBad", probed(100*time.Millisecond, 0), 80, ScoreRTT, true},
+		{"at PingBad", probed(150*time.Millisecond, 0), 60, ScoreRTT, true},
+		// loss 0.5, reach 1, no rtt yet: (15 + 15) / 45
+		{"loss only", probed(0, 5), 67, ScoreLoss, true},
+		{"loss past LossBad", probed(0, 40), 33, ScoreLoss, true},
+		{"unreachable", probed(0, 100), 0, ScoreRTT, true},
+		{"unreachable with an old ping", probed(20*time.Millisecond, 100), 0, ScoreRTT, true},
+		{"never probed", with(probed(20*time.Millisecond, 0), func(c *Connection) {
+			c.NoProbe, c.HasQueues = AddrLoopback, true
+		}), 100, "", true},
+		{"never probed, no socket data", with(probed(20*time.Millisecond, 0), func(c *Connection) {
+			c.NoProbe = AddrExcluded
+		}), 0, "", false},
+		{"stalled", &Connection{Protocol: "tcp", State: StateEstablished, TCPInfo: &TCPInfo{}, StallSince: time.Now()}, 0, ScoreStall, true},
+		{"send queue high", &Connection{Protocol: "tcp", State: StateEstablished, HasQueues: true, SendQHigh: 1}, 50, ScoreStall, true},
+		{"retransmits", &Connection{Protocol: "tcp", State: StateEstablished, HasRetransRate: true, RetransRate: 2.5}, 50, ScoreRetrans, true},
+		{"retransmits past 5%", &Connection{Protocol: "tcp", State: StateEstablished, HasRetransRate: true, RetransRate: 12}, 0, ScoreRetrans, true},
+		// rtt 0.5 (30), loss 0.8 (30), reach 1 (15), retrans 0.6 (15), stall 1 (10)
+		{"everything", with(probed(100*time.Millisecond, 2), func(c *Connection) {
+			c.TCPInfo, c.HasRetransRate, c.RetransRate = &TCPInfo{}, true, 2
+		}), 73, ScoreRTT, true},
+	}
+	for _, tt := range tests {
+		score, worst, ok := HealthScore(tt.c, DefaultScoreWeights, DefaultScoreLimits)
+		if score != tt.score || worst != tt.worst || ok != tt.ok {
+			t.Errorf("%s: %d %q %v, want %d %q %v", tt.name, score, worst, ok, tt.score, tt.worst, tt.ok)
+		}
+	}
+}
+
+func TestHealthScoreWeights(t *testing.T) {
+	c := &Connection{Protocol: "tcp", State: StateEstablished, Ping: 10 * time.Millisecond, PingCount: 5, Loss: 10,
+		HasQueues: true, SendQHigh: 1}
+	w, err := ParseScoreWeights(map[string]float64{ScoreLoss: 0, ScoreReach: 0, ScoreStall: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rtt 1 (30) and stall 0.5 (30); loss does not count.
+	if score, worst, ok := HealthScore(c, w, DefaultScoreLimits); score != 75 || worst != ScoreStall || !ok {
+		t.Errorf("reweighted: %d %q %v", score, worst, ok)
+	}
+	onlyLoss := ScoreWeights{Loss: 1}
+	if _, _, ok := HealthScore(&Connection{Protocol: "tcp", HasQueues: true}, onlyLoss, DefaultScoreLimits); ok {
+		t.Error("scored without data for a weighted component")
+	}
+
+	for _, bad := range []map[string]float64{
+		{"latency": 1},
+		{ScoreRTT: -1},
+		{ScoreRTT: 0, ScoreLoss: 0, ScoreRetrans: 0, ScoreStall: 0, ScoreReach: 0},
+	} {
+		if _, err := ParseScoreWeights(bad); err == nil {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+}
+
+func TestScoreLimits(t *testing.T) {
+	tests := []struct {
+		rule AlertRule
+		want ScoreLimits
+	}{
+		{AlertRule{}, DefaultScoreLimits},
+		{AlertRule{PingWarn: 20 * time.Millisecond, PingThreshold: 80 * time.Millisecond, LossThreshold: 3},
+			ScoreLimits{20 * time.Millisecond, 80 * time.Millisecond, 3}},
+		// A critical threshold under the default warn level.
+		{AlertRule{PingThreshold: 30 * time.Millisecond}, ScoreLimits{10 * time.Millisecond, 30 * time.Millisecond, 10}},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.ScoreLimits(); got != tt.want {
+			t.Errorf("%+v: %+v, want %+v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	c := &Connection{Score: 50, HasScore: true}
+	for v, want := range map[string]bool{
+		"<50": false, "<51": true, "<=50": true, "50": true, "49": false,
+		">49": true, ">=50": true, ">50": false, "=50": true, "=5": false, "~50": false, "<": false,
+	} {
+		if matchScore(c, v) != want {
+			t.Errorf("score:%s matched %v", v, !want)
+		}
+	}
+	if matchScore(&Connection{}, "<=100") {
+		t.Error("connection without a score matched")
+	}
+}
+
+func TestUpdateRetrans(t *testing.T) {
+	info := func(retrans, segs uint64) *TCPInfo {
+		return &TCPInfo{Retrans: retrans, SegsOut: segs, HasRetrans: true}
+	}
+	tests := []struct {
+		name       string
+		prev, next *TCPInfo
+		rate       float64
+		ok         bool
+	}{
+		{"first scan", nil, info(1, 100), 0, false},
+		{"no counters", &TCPInfo{}, info(1, 100), 0, false},
+		{"1 in 100", info(4, 1000), info(5, 1100), 1, true},
+		{"idle", info(4, 1000), info(4, 1000), 0, true},
+		{"counters went back", info(4, 1000), info(1, 10), 0, false},
+	}
+	for _, tt := range tests {
+		c := &Connection{TCPInfo: tt.prev}
+		c.updateRetrans(tt.next)
+		if c.RetransRate != tt.rate || c.HasRetransRate != tt.ok {
+			t.Errorf("%s: %v %v, want %v %v", tt.name, c.RetransRate, c.HasRetransRate, tt.rate, tt.ok)
+		}
+	}
+}
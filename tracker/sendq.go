@@ -0,0 +1,17 @@
+package tracker
+
+// DefaultSendQScans is how many consecutive scans the send queue must stay
+// at or above AlertRule.SendQThreshold when AlertRule.SendQScans is unset.
+const DefaultSendQScans = 3
+
+// updateSendQ counts the consecutive scans in which the send queue held at
+// least threshold bytes. A queue that keeps data unacknowledged scan after
+// scan means the peer stopped reading or is gone. LISTEN sockets are
+// skipped: their queues are connection backlogs, not bytes.
+func (c *Connection) updateSendQ(threshold uint64) {
+	if threshold == 0 || !c.HasQueues || c.State == StateListening || c.SendQ < threshold {
+		c.SendQHigh = 0
+		return
+	}
+	c.SendQHigh++
+}
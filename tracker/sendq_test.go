@@ -0,0 +1,91 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateSendQ(t *testing.T) {
+	c := &Connection{State: StateEstablished, HasQueues: true}
+	var got []int
+	for _, q := range []uint64{0, 70000, 80000, 64 << 10, 100, 90000} {
+		c.SendQ = q
+		c.updateSendQ(64 << 10)
+		got = append(got, c.SendQHigh)
+	}
+	want := []int{0, 1, 2, 3, 0, 1} // at the threshold counts; one low scan resets
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("consecutive high scans %v, want %v", got, want)
+		}
+	}
+
+	for _, c := range []*Connection{
+		{State: StateListening, HasQueues: true, SendQ: 1 << 20, SendQHigh: 5}, // backlog, not bytes
+		{State: StateEstablished, SendQ: 1 << 20, SendQHigh: 5},                // no queues read
+	} {
+		c.updateSendQ(1)
+		if c.SendQHigh != 0 {
+			t.Errorf("%s, queues %v: %d high scans", c.State, c.HasQueues, c.SendQHigh)
+		}
+	}
+	c.updateSendQ(0)
+	if c.SendQHigh != 0 {
+		t.Error("counted with the alert off")
+	}
+}
+
+// TestSendQAlert drives the count through scans: the alert fires on the
+// SendQScans-th consecutive high scan, not before.
+func TestSendQAlert(t *testing.T) {
+	src := &fakeSource{}
+	stuck := fakeConn("backup", "192.0.2.5", 22)
+	stuck.HasQueues, stuck.SendQ = true, 2<<20
+	idle := fakeConn("web", "192.0.2.6", 443)
+	idle.HasQueues, idle.SendQ = true, 512
+	src.set(stuck, idle)
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	rule := AlertRule{SendQThreshold: 1 << 20, SendQScans: 3}
+	tr.SetAlertRule(rule)
+
+	for scan := 1; scan <= 4; scan++ {
+		tr.scan()
+		var alerts []Alert
+		for _, c := range tr.Snapshot() {
+			if a := rule.crossing(c); a.Reason != "" {
+				alerts = append(alerts, a)
+			}
+		}
+		if scan < 3 && len(alerts) > 0 {
+			t.Fatalf("scan %d: alert %+v before 3 high scans", scan, alerts[0])
+		}
+		if scan >= 3 {
+			if len(alerts) != 1 || alerts[0].Metric != MetricSendQ || alerts[0].Value != 2<<20 {
+				t.Fatalf("scan %d: alerts %+v", scan, alerts)
+			}
+			if scan == 3 && alerts[0].Reason != "send queue 2.0 MB >= 1.0 MB for 3 scans" {
+				t.Errorf("reason %q", alerts[0].Reason)
+			}
+		}
+	}
+
+	stuck.SendQ = 0
+	src.set(stuck, idle)
+	tr.scan()
+	for _, c := range tr.Snapshot() {
+		if c.SendQHigh != 0 {
+			t.Errorf("%s: %d high scans after the queue drained", c.AppName, c.SendQHigh)
+		}
+	}
+
+	if (AlertRule{SendQThreshold: 1}).sendQScans() != DefaultSendQScans {
+		t.Error("default scan count")
+	}
+	if !(AlertRule{SendQThreshold: 1}).Enabled() {
+		t.Error("send queue threshold alone does not enable alerts")
+	}
+	if err := (AlertRule{SendQScans: -1}).Validate(); err == nil {
+		t.Error("negative scan count accepted")
+	}
+}
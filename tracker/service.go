@@ -0,0 +1,32 @@
+package tracker
+
+import "strings"
+
+// ServiceQUIC is the service hint for UDP flows on port 443, which
+// browsers and CDNs use for QUIC (HTTP/3), and for UDP flows on any port a
+// packet capture saw QUIC long headers on.
+const ServiceQUIC = "quic"
+
+// ClassifyService guesses the application protocol of a connection from its
+// ports: UDP to or from port 443 is QUIC, anything else gets the well-known
+// service of the remote port, then the local one. It returns "" when
+// neither port is known.
+func ClassifyService(c *Connection) string {
+	if strings.HasPrefix(c.Protocol, "udp") && (c.RemotePort == 443 || c.LocalPort == 443) {
+		return ServiceQUIC
+	}
+	if s := ServiceName(c.RemotePort); s != "" {
+		return s
+	}
+	return ServiceName(c.LocalPort)
+}
+
+// ProtocolHint is the protocol as shown in the table: QUIC flows are shown
+// as "quic" ("quic6" over IPv6) rather than "udp".
+func (c *Connection) ProtocolHint() string {
+	p := c.DisplayProtocol()
+	if c.Service == ServiceQUIC {
+		return ServiceQUIC + strings.TrimPrefix(p, "udp")
+	}
+	return p
+}
@@ -0,0 +1,472 @@
+package tracker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping-tracker/policy"
+)
+
+// Service check protocols.
+const (
+	CheckDNS   = "dns"   // a query for Query: answer time and RCODE
+	CheckHTTP  = "http"  // GET Path: status and time to first byte
+	CheckHTTPS = "https" // the same over TLS
+	CheckSMTP  = "smtp"  // the greeting banner: its code and how long it took
+	CheckQUIC  = "quic"  // a QUIC handshake: version, ALPN and certificate name
+)
+
+const (
+	DefaultServiceCheckEvery   = time.Minute
+	DefaultServiceCheckTimeout = 5 * time.Second
+	MinServiceCheckEvery       = 10 * time.Second
+	MaxServiceCheckTimeout     = 10 * time.Second
+
+	// maxServiceChecks is how many checks run at once; a check that finds
+	// no free slot waits for a later scan.
+	maxServiceChecks = 4
+
+	// serviceCheckForget is how long a target no connection uses keeps
+	// its result, so a reconnect shows it right away.
+	serviceCheckForget = 10 * time.Minute
+)
+
+// ServiceCheckDef is one configured application-layer health check. It
+// applies to established connections to its remote port, its remote
+// addresses, or both.
+type ServiceCheckDef struct {
+	Name    string
+	Proto   string       // CheckDNS, CheckHTTP, CheckHTTPS, CheckSMTP or CheckQUIC
+	Port    int          // remote port; 0 for any
+	Remote  netip.Prefix // remote addresses; invalid for any
+	Query   string       // CheckDNS: the name asked for
+	Path    string       // CheckHTTP(S): the path requested
+	Host    string       // CheckHTTP(S), CheckQUIC: Host header and TLS server name; the connection's SNI when empty
+	Every   time.Duration
+	Timeout time.Duration
+}
+
+// ParseServiceCheck validates one configured check. every and timeout are
+// durations ("" for the defaults); remote is an address or a CIDR prefix.
+func ParseServiceCheck(name, proto string, port int, remote, query, path, host, every, timeout string) (ServiceCheckDef, error) {
+	d := ServiceCheckDef{Name: name, Proto: strings.ToLower(proto), Port: port, Query: query, Path: path, Host: host,
+		Every: DefaultServiceCheckEvery, Timeout: DefaultServiceCheckTimeout}
+	if d.Name == "" {
+		d.Name = d.Proto
+	}
+	fail := func(format string, args ...any) (ServiceCheckDef, error) {
+		return ServiceCheckDef{}, fmt.Errorf("service check %q: %s", d.Name, fmt.Sprintf(format, args...))
+	}
+	switch d.Proto {
+	case CheckDNS:
+		if d.Query == "" {
+			d.Query = "example.com"
+		}
+		if _, err := dnsQuery(0, d.Query); err != nil {
+			return fail("%v", err)
+		}
+	case CheckHTTP, CheckHTTPS:
+		if d.Path == "" {
+			d.Path = "/"
+		}
+		if !strings.HasPrefix(d.Path, "/") {
+			return fail("path %q must start with /", d.Path)
+		}
+	case CheckSMTP, CheckQUIC:
+	default:
+		return fail("unknown proto %q (dns, http, https, smtp, quic)", proto)
+	}
+	if port < 0 || port > 65535 {
+		return fail("invalid port %d", port)
+	}
+	if remote != "" {
+		var err error
+		if d.Remote, err = netip.ParsePrefix(remote); err != nil {
+			a, aerr := netip.ParseAddr(remote)
+			if aerr != nil {
+				return fail("remote %q is not an address or prefix", remote)
+			}
+			d.Remote = netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen())
+		}
+		d.Remote = d.Remote.Masked()
+	}
+	if d.Port == 0 && !d.Remote.IsValid() {
+		return fail("needs a port, a remote, or both")
+	}
+	if every != "" {
+		e, err := time.ParseDuration(every)
+		if err != nil || e < MinServiceCheckEvery {
+			return fail("every %q: want a duration of at least %s", every, MinServiceCheckEvery)
+		}
+		d.Every = e
+	}
+	if timeout != "" {
+		t, err := time.ParseDuration(timeout)
+		if err != nil || t <= 0 || t > MaxServiceCheckTimeout {
+			return fail("timeout %q: want a duration up to %s", timeout, MaxServiceCheckTimeout)
+		}
+		d.Timeout = t
+	}
+	return d, nil
+}
+
+// matches reports whether the check applies to c.
+func (d *ServiceCheckDef) matches(c *Connection) bool {
+	if d.Port != 0 && c.RemotePort != d.Port {
+		return false
+	}
+	if d.Remote.IsValid() {
+		a, err := netip.ParseAddr(c.RemoteAddr)
+		if err != nil || !d.Remote.Contains(a.Unmap()) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceCheck is the latest result of a connection's service check. It
+// is replaced, never mutated, each scan.
+type ServiceCheck struct {
+	Name     string
+	Proto    string
+	Target   string        // what was asked: the DNS name, the URL, or the SMTP or QUIC server
+	OK       bool          // the service answered as a healthy one does
+	Status   string        // the RCODE, the HTTP status, the SMTP reply code, or the QUIC version and ALPN; "" without an answer
+	Latency  time.Duration // answer time, time to first byte, banner time or time to the first QUIC packet
+	Cert     string        // CheckQUIC: the first name on the server's certificate
+	Err      string        // why it failed; "" when OK
+	At       time.Time
+	Failures int // consecutive failed checks
+}
+
+// Failed reports whether the latest check failed; false without one.
+func (s *ServiceCheck) Failed() bool {
+	return s != nil && !s.OK
+}
+
+// Summary describes the result in a few words, e.g. "dns NOERROR in 23ms".
+func (s *ServiceCheck) Summary() string {
+	var b strings.Builder
+	b.WriteString(s.Proto)
+	if s.Status != "" {
+		b.WriteString(" " + s.Status)
+	}
+	if s.Cert != "" {
+		b.WriteString(" cert " + s.Cert)
+	}
+	if s.Latency > 0 {
+		fmt.Fprintf(&b, " in %s", s.Latency.Round(100*time.Microsecond))
+	}
+	if s.Err != "" {
+		b.WriteString(": " + s.Err)
+	}
+	return b.String()
+}
+
+// checkTarget is one check of one remote, with its latest result.
+type checkTarget struct {
+	def     ServiceCheckDef
+	addr    string
+	port    int
+	udp     bool   // the connection is UDP; DNS asks over UDP then
+	host    string // the connection's SNI
+	result  *ServiceCheck
+	running bool
+	next    time.Time
+	seen    time.Time
+}
+
+// serviceChecks runs the configured checks of the connections that match
+// them. It has its own lock: results land from the check goroutines.
+type serviceChecks struct {
+	mu      sync.Mutex
+	defs    []ServiceCheckDef
+	targets map[string]*checkTarget // by check name and remote address:port
+	slots   chan struct{}
+	shown   bool // the last scan attached a result to a connection
+	// check runs one check; nil for runServiceCheck.
+	check func(def ServiceCheckDef, addr string, port int, udp bool, host string) ServiceCheck
+}
+
+// SetPolicy sets which of the tracker's own actions may run; in read-only
+// mode the service checks do not. Must be called before Start.
+func (t *Tracker) SetPolicy(p policy.Mode) {
+	t.policy = p
+}
+
+// SetServiceChecks sets the application-layer health checks; none by
+// default. Results of checks that are gone are dropped. It is safe to call
+// while the tracker is running.
+func (t *Tracker) SetServiceChecks(defs []ServiceCheckDef) {
+	s := &t.checks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defs = append([]ServiceCheckDef(nil), defs...)
+	for key, tg := range s.targets {
+		keep := false
+		for _, d := range defs {
+			if d == tg.def {
+				keep = true
+				break
+			}
+		}
+		if !keep {
+			delete(s.targets, key)
+		}
+	}
+}
+
+// attachServiceChecks gives each established connection the latest result
+// of the first check that applies to it, and notes the remotes to check.
+// Remotes that are never probed, or only through -probe-proxy, are not
+// checked. Called from scan with the lock held.
+func (t *Tracker) attachServiceChecks(now time.Time) {
+	s := &t.checks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.defs) == 0 && len(s.targets) == 0 && !s.shown {
+		return
+	}
+	s.shown = false
+	if s.targets == nil {
+		s.targets = make(map[string]*checkTarget)
+	}
+	for _, c := range t.connections {
+		c.ServiceCheck = nil
+		if c.State != StateEstablished || c.NoProbe != AddrProbeable || c.Host != "" ||
+			(t.probeProxy != nil && !t.probeProxy.Bypassed(c.RemoteAddr)) {
+			continue
+		}
+		for i := range s.defs {
+			d := &s.defs[i]
+			if !d.matches(c) {
+				continue
+			}
+			key := d.Name + " " + net.JoinHostPort(c.RemoteAddr, strconv.Itoa(c.RemotePort))
+			tg := s.targets[key]
+			if tg == nil {
+				tg = &checkTarget{def: *d, addr: c.RemoteAddr, port: c.RemotePort, next: now}
+				s.targets[key] = tg
+			}
+			tg.seen = now
+			tg.udp = strings.HasPrefix(c.Protocol, "udp")
+			tg.host = c.SNI
+			c.ServiceCheck = tg.result
+			s.shown = s.shown || tg.result != nil
+			break
+		}
+	}
+	for key, tg := range s.targets {
+		if now.Sub(tg.seen) > serviceCheckForget && !tg.running {
+			delete(s.targets, key)
+		}
+	}
+}
+
+// runServiceChecks starts the checks that are due, as many as there are
+// free slots, without waiting for them. The policy can rule them out.
+func (t *Tracker) runServiceChecks(now time.Time) {
+	if t.policy.Check(policy.ServiceChecks) != policy.Allow {
+		return
+	}
+	s := &t.checks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.slots == nil {
+		s.slots = make(chan struct{}, maxServiceChecks)
+	}
+	check := s.check
+	if check == nil {
+		check = runServiceCheck
+	}
+	for _, tg := range s.targets {
+		if tg.running || now.Before(tg.next) || now.Sub(tg.seen) > serviceCheckForget {
+			continue
+		}
+		if !probeMeter.allowed() {
+			return
+		}
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return // the rest wait for a slot
+		}
+		tg.running = true
+		tg.next = now.Add(tg.def.Every)
+		go func(tg *checkTarget, def ServiceCheckDef, addr string, port int, udp bool, host string) {
+			defer func() { <-s.slots }()
+			r := check(def, addr, port, udp, host)
+			s.mu.Lock()
+			if tg.result != nil && !r.OK {
+				r.Failures = tg.result.Failures + 1
+			} else if !r.OK {
+				r.Failures = 1
+			}
+			tg.result = &r
+			tg.running = false
+			s.mu.Unlock()
+		}(tg, tg.def, tg.addr, tg.port, tg.udp, tg.host)
+	}
+}
+
+// runServiceCheck runs def against addr:port within its timeout.
+func runServiceCheck(def ServiceCheckDef, addr string, port int, udp bool, host string) ServiceCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), def.Timeout)
+	defer cancel()
+	target := net.JoinHostPort(addr, strconv.Itoa(port))
+	r := ServiceCheck{Name: def.Name, Proto: def.Proto, At: time.Now()}
+	var err error
+	switch def.Proto {
+	case CheckDNS:
+		r.Target = def.Query
+		network := "tcp"
+		if udp {
+			network = "udp"
+		}
+		err = checkDNS(ctx, network, target, def.Query, &r)
+	case CheckHTTP, CheckHTTPS:
+		if def.Host != "" {
+			host = def.Host
+		}
+		err = checkHTTP(ctx, def.Proto, target, host, def.Path, &r)
+	case CheckSMTP:
+		r.Target = target
+		err = checkSMTP(ctx, target, &r)
+	case CheckQUIC:
+		if def.Host != "" {
+			host = def.Host
+		}
+		err = checkQUIC(ctx, target, host, &r)
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("no answer within %s", def.Timeout)
+		}
+		r.OK, r.Err = false, err.Error()
+	}
+	return r
+}
+
+// checkHTTP requests path from the server at target and records the status
+// and the time to its first byte. Redirects are not followed: a 3xx is an
+// answer. Without a host name to verify, the TLS certificate is not
+// checked; the check asks whether the server answers, not who it is.
+func checkHTTP(ctx context.Context, scheme, target, host, path string, r *ServiceCheck) error {
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialProbe(ctx, "tcp", target, 0)
+		},
+		TLSClientConfig:   &tls.Config{ServerName: host, InsecureSkipVerify: host == ""},
+		DisableKeepAlives: true,
+	}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{
+		Transport:     tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	authority := target
+	if host != "" {
+		_, port, _ := net.SplitHostPort(target)
+		authority = net.JoinHostPort(host, port)
+	}
+	r.Target = scheme + "://" + authority + path
+	start := time.Now()
+	var first time.Time
+	trace := &httptrace.ClientTrace{GotFirstResponseByte: func() { first = time.Now() }}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, r.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "ping-tracker service check")
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr interface{ Unwrap() error }
+		if errors.As(err, &uerr) {
+			err = uerr.Unwrap() // drop the repeated method and URL
+		}
+		return err
+	}
+	resp.Body.Close()
+	r.Latency = first.Sub(start)
+	r.Status = strconv.Itoa(resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	r.OK = true
+	return nil
+}
+
+// checkSMTP reads the greeting of the server at target and records its
+// reply code and how long it took from the connect. A multi-line greeting
+// is read to its last line. The session ends with QUIT.
+func checkSMTP(ctx context.Context, target string, r *ServiceCheck) error {
+	start := time.Now()
+	conn, err := dialProbe(ctx, "tcp", target, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	br := bufio.NewReaderSize(conn, 512)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				return errors.New("malformed greeting: line too long")
+			}
+			return fmt.Errorf("no greeting: %w", err)
+		}
+		if r.Latency == 0 {
+			r.Latency = time.Since(start)
+		}
+		code, more, ok := smtpReply(line)
+		if !ok {
+			return fmt.Errorf("malformed greeting %q", strings.TrimSpace(string(line)))
+		}
+		if more {
+			continue
+		}
+		r.Status = code
+		conn.Write([]byte("QUIT\r\n"))
+		if code != "220" {
+			return fmt.Errorf("greeting %s", strings.TrimSpace(string(line)))
+		}
+		r.OK = true
+		return nil
+	}
+}
+
+// smtpReply parses one reply line: its three-digit code, and whether more
+// lines follow ("220-...").
+func smtpReply(line []byte) (code string, more, ok bool) {
+	if len(line) < 4 {
+		return "", false, false
+	}
+	for _, b := range line[:3] {
+		if b < '0' || b > '9' {
+			return "", false, false
+		}
+	}
+	switch line[3] {
+	case '-':
+		more = true
+	case ' ', '\r', '\n':
+	default:
+		return "", false, false
+	}
+	return string(line[:3]), more, true
+}
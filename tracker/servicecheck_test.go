@@ -0,0 +1,545 @@
+package tracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dnsReply answers query with rcode and the question echoed back.
+func dnsReply(query []byte, rcode int) []byte {
+	reply := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(reply[2:], 0x8180|uint16(rcode))
+	return reply
+}
+
+// dnsTestServer answers DNS queries on loopback over UDP and TCP with
+// what answer returns; no datagrams means no answer.
+type dnsTestServer struct {
+	udp    *net.UDPConn
+	tcp    net.Listener
+	answer func(query []byte) [][]byte
+}
+
+func startDNSTestServer(t *testing.T, answer func(query []byte) [][]byte) *dnsTestServer {
+	t.Helper()
+	var udp *net.UDPConn
+	var tcp net.Listener
+	var err error
+	for range 10 { // until a port is free for both
+		if udp, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+			t.Fatal(err)
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err == nil {
+			break
+		}
+		udp.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsTestServer{udp: udp, tcp: tcp, answer: answer}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := udp.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			for _, r := range answer(append([]byte(nil), buf[:n]...)) {
+				udp.WriteToUDP(r, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				replies := answer(query)
+				if replies == nil {
+					io.Copy(io.Discard, conn) // hold the connection open, unanswered
+				}
+				for _, r := range replies {
+					conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(r))))
+					conn.Write(r)
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *dnsTestServer) addr() string { return s.udp.LocalAddr().String() }
+
+func TestCheckDNS(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer func(query []byte) [][]byte
+		ok     bool
+		status string
+		err    string
+	}{
+		{"noerror", func(q []byte) [][]byte { return [][]byte{dnsReply(q, 0)} }, true, "NOERROR", ""},
+		{"nxdomain", func(q []byte) [][]byte { return [][]byte{dnsReply(q, 3)} }, true, "NXDOMAIN", ""},
+		{"servfail", func(q []byte) [][]byte { return [][]byte{dnsReply(q, 2)} }, false, "SERVFAIL", "server answered SERVFAIL"},
+		{"unnamed rcode", func(q []byte) [][]byte { return [][]byte{dnsReply(q, 9)} }, false, "RCODE9", "server answered RCODE9"},
+		{"refused without the question", func(q []byte) [][]byte {
+			r := dnsReply(q[:dnsHeaderLen], 5)
+			binary.BigEndian.PutUint16(r[4:], 0)
+			return [][]byte{r}
+		}, false, "REFUSED", "server answered REFUSED"},
+		{"slow", func(q []byte) [][]byte { return nil }, false, "", "i/o timeout"},
+		{"short", func(q []byte) [][]byte { return [][]byte{dnsReply(q, 0)[:2]} }, false, "", "malformed reply: 2 bytes"},
+		{"not a response", func(q []byte) [][]byte { return [][]byte{q} }, false, "", "malformed reply: not a response"},
+		{"wrong opcode", func(q []byte) [][]byte {
+			r := dnsReply(q, 0)
+			r[2] |= 0x10
+			return [][]byte{r}
+		}, false, "", "malformed reply: wrong opcode"},
+		{"other question", func(q []byte) [][]byte {
+			r := dnsReply(q, 0)
+			r[dnsHeaderLen+1] = 'X'
+			return [][]byte{r}
+		}, false, "", "malformed reply: question does not match"},
+	}
+	for _, network := range []string{"udp", "tcp"} {
+		for _, tt := range tests {
+			s := startDNSTestServer(t, tt.answer)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			var r ServiceCheck
+			err := checkDNS(ctx, network, s.addr(), "example.com", &r)
+			cancel()
+			name := network + " " + tt.name
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("%s: %v", name, err)
+			case !tt.ok && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("%s: error %v, want %q", name, err, tt.err)
+			}
+			if r.OK != tt.ok || r.Status != tt.status {
+				t.Errorf("%s: ok %v status %q", name, r.OK, r.Status)
+			}
+			if tt.status != "" && r.Latency <= 0 {
+				t.Errorf("%s: no answer time", name)
+			}
+		}
+	}
+}
+
+// TestServiceCheckTimeout checks a check that outlasts its timeout says
+// so in words, whichever protocol it was.
+func TestServiceCheckTimeout(t *testing.T) {
+	s := startDNSTestServer(t, func([]byte) [][]byte { return nil })
+	_, portStr, _ := net.SplitHostPort(s.addr())
+	port, _ := strconv.Atoi(portStr)
+	for _, proto := range []string{"dns", "http", "smtp"} {
+		def, err := ParseServiceCheck("slow", proto, port, "", "", "", "", "", "100ms")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := runServiceCheck(def, "127.0.0.1", port, false, "")
+		if r.OK || r.Err != "no answer within 100ms" || r.Name != "slow" || r.At.IsZero() {
+			t.Errorf("%s: %+v", proto, r)
+		}
+	}
+}
+
+// TestCheckDNSStray checks a UDP datagram with another ID is skipped for
+// the answer that follows it.
+func TestCheckDNSStray(t *testing.T) {
+	s := startDNSTestServer(t, func(q []byte) [][]byte {
+		stray := dnsReply(q, 2)
+		stray[0] ^= 0xff
+		return [][]byte{stray, dnsReply(q, 0)}
+	})
+	var r ServiceCheck
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := checkDNS(ctx, "udp", s.addr(), "example.com.", &r); err != nil || r.Status != "NOERROR" {
+		t.Errorf("%v, status %q", err, r.Status)
+	}
+}
+
+func TestCheckHTTP(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "ping-tracker service check" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	handler.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	})
+	handler.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(handler)
+	secure.Config.ErrorLog = log.New(io.Discard, "", 0) // the failed handshake below
+	secure.StartTLS()
+	defer secure.Close()
+
+	tests := []struct {
+		scheme, path string
+		ok           bool
+		status, err  string
+	}{
+		{"http", "/ok", true, "200", ""},
+		{"https", "/ok", true, "200", ""},
+		{"http", "/moved", true, "302", ""},
+		{"https", "/down", false, "503", "HTTP 503 Service Unavailable"},
+		{"http", "/slow", false, "", "deadline exceeded"},
+	}
+	for _, tt := range tests {
+		srv := plain
+		if tt.scheme == "https" {
+			srv = secure
+		}
+		target := strings.TrimPrefix(srv.URL, tt.scheme+"://")
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		var r ServiceCheck
+		err := checkHTTP(ctx, tt.scheme, target, "", tt.path, &r)
+		cancel()
+		name := tt.scheme + " " + tt.path
+		if tt.ok != (err == nil) || err != nil && !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", name, err, tt.err)
+		}
+		if r.OK != tt.ok || r.Status != tt.status || r.Target != srv.URL+tt.path {
+			t.Errorf("%s: %+v", name, r)
+		}
+		if tt.status != "" && r.Latency <= 0 {
+			t.Errorf("%s: no time to first byte", name)
+		}
+	}
+
+	// With a name to check the certificate against, a self-signed one
+	// fails, and the name goes in the target.
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(secure.URL, "https://"))
+	var r ServiceCheck
+	err := checkHTTP(context.Background(), "https", strings.TrimPrefix(secure.URL, "https://"), "example.com", "/ok", &r)
+	if err == nil || r.OK || r.Target != "https://example.com:"+port+"/ok" {
+		t.Errorf("unverified certificate: %v, %+v", err, r)
+	}
+}
+
+// lineServer accepts connections on loopback and hands each to serve.
+func lineServer(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckHTTPMalformed(t *testing.T) {
+	addr := lineServer(t, func(c net.Conn) {
+		bufio.NewReader(c).ReadString('\n')
+		io.WriteString(c, "SSH-2.0-OpenSSH_9.6\r\n")
+	})
+	var r ServiceCheck
+	if err := checkHTTP(context.Background(), "http", addr, "", "/", &r); err == nil || r.OK || r.Status != "" {
+		t.Errorf("non-HTTP answer: %v, %+v", err, r)
+	}
+}
+
+func TestCheckSMTP(t *testing.T) {
+	tests := []struct {
+		name, greeting string
+		ok             bool
+		status, err    string
+	}{
+		{"ready", "220 mail.example ESMTP\r\n", true, "220", ""},
+		{"multi-line", "220-mail.example ESMTP\r\n220-no spam\r\n220 ready\r\n", true, "220", ""},
+		{"bare code", "220\r\n", true, "220", ""},
+		{"busy", "421 mail.example busy\r\n", false, "421", "greeting 421 mail.example busy"},
+		{"not smtp", "SSH-2.0-OpenSSH_9.6\r\n", false, "", `malformed greeting "SSH-2.0-OpenSSH_9.6"`},
+		{"bad separator", "220+x\r\n", false, "", `malformed greeting "220+x"`},
+		{"too long", "220 " + strings.Repeat("x", 600) + "\r\n", false, "", "malformed greeting: line too long"},
+		{"hang up", "220-half\r\n", false, "", "no greeting: EOF"},
+		{"slow", "", false, "", "no greeting"},
+	}
+	for _, tt := range tests {
+		quit := make(chan string, 1)
+		addr := lineServer(t, func(c net.Conn) {
+			if tt.greeting == "" {
+				time.Sleep(time.Second)
+				return
+			}
+			io.WriteString(c, tt.greeting)
+			if tt.name == "hang up" {
+				return
+			}
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			line, _ := bufio.NewReader(c).ReadString('\n')
+			quit <- line
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		var r ServiceCheck
+		err := checkSMTP(ctx, addr, &r)
+		cancel()
+		if tt.ok != (err == nil) || err != nil && !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+		if r.OK != tt.ok || r.Status != tt.status {
+			t.Errorf("%s: %+v", tt.name, r)
+		}
+		if tt.status != "" {
+			if r.Latency <= 0 {
+				t.Errorf("%s: no banner time", tt.name)
+			}
+			if got := <-quit; got != "QUIT\r\n" {
+				t.Errorf("%s: session ended with %q", tt.name, got)
+			}
+		}
+	}
+}
+
+func TestParseServiceCheck(t *testing.T) {
+	d, err := ParseServiceCheck("", "DNS", 53, "", "", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "dns" || d.Query != "example.com" || d.Every != DefaultServiceCheckEvery || d.Timeout != DefaultServiceCheckTimeout {
+		t.Errorf("dns defaults: %+v", d)
+	}
+	d, err = ParseServiceCheck("web", "https", 0, "::ffff:192.0.2.7", "", "", "", "30s", "10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Path != "/" || d.Remote != netip.MustParsePrefix("192.0.2.7/32") || d.Every != 30*time.Second || d.Timeout != 10*time.Second {
+		t.Errorf("https: %+v", d)
+	}
+	if d, _ := ParseServiceCheck("lan", "smtp", 25, "10.1.2.3/8", "", "", "", "", ""); d.Remote != netip.MustParsePrefix("10.0.0.0/8") {
+		t.Errorf("prefix not masked: %s", d.Remote)
+	}
+
+	for _, tt := range []struct {
+		proto             string
+		port              int
+		remote, query     string
+		path, every, tout string
+		want              string
+	}{
+		{"ftp", 21, "", "", "", "", "", `unknown proto "ftp"`},
+		{"dns", 53, "", "bad..name", "", "", "", `query "bad..name" is not a domain name`},
+		{"http", 80, "", "", "index.html", "", "", `path "index.html" must start with /`},
+		{"smtp", 70000, "", "", "", "", "", "invalid port 70000"},
+		{"smtp", 25, "mail", "", "", "", "", `remote "mail" is not an address or prefix`},
+		{"smtp", 0, "", "", "", "", "", "needs a port, a remote, or both"},
+		{"smtp", 25, "", "", "", "5s", "", `every "5s": want a duration of at least 10s`},
+		{"smtp", 25, "", "", "", "", "11s", `timeout "11s": want a duration up to 10s`},
+		{"smtp", 25, "", "", "", "", "0s", `timeout "0s"`},
+	} {
+		_, err := ParseServiceCheck("c", tt.proto, tt.port, tt.remote, tt.query, tt.path, "", tt.every, tt.tout)
+		if err == nil || !strings.HasPrefix(err.Error(), `service check "c": `+tt.want) {
+			t.Errorf("%s: %v, want %q", tt.proto, err, tt.want)
+		}
+	}
+}
+
+func TestServiceCheckMatches(t *testing.T) {
+	byPort, _ := ParseServiceCheck("p", "smtp", 25, "", "", "", "", "", "")
+	byNet, _ := ParseServiceCheck("n", "smtp", 0, "192.0.2.0/24", "", "", "", "", "")
+	both, _ := ParseServiceCheck("b", "smtp", 25, "192.0.2.0/24", "", "", "", "", "")
+	for _, tt := range []struct {
+		remote               string
+		port                 int
+		byPort, byNet, match bool
+	}{
+		{"192.0.2.9", 25, true, true, true},
+		{"192.0.2.9", 587, false, true, false},
+		{"198.51.100.1", 25, true, false, false},
+		{"::ffff:192.0.2.9", 25, true, true, true},
+		{"mail.example", 25, true, false, false},
+	} {
+		c := &Connection{RemoteAddr: tt.remote, RemotePort: tt.port}
+		if byPort.matches(c) != tt.byPort || byNet.matches(c) != tt.byNet || both.matches(c) != tt.match {
+			t.Errorf("%s:%d: port %v, net %v, both %v", tt.remote, tt.port, byPort.matches(c), byNet.matches(c), both.matches(c))
+		}
+	}
+}
+
+// TestServiceCheckScheduling runs checks through the tracker: one per
+// remote however many connections it has, no sooner than every, at most
+// maxServiceChecks at once, and a failure counted and alerted on.
+func TestServiceCheckScheduling(t *testing.T) {
+	var mu sync.Mutex
+	greeting := "220 ready\r\n"
+	hold := make(chan struct{})
+	greetings := 0
+	connects := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return greetings
+	}
+	addr := lineServer(t, func(c net.Conn) {
+		mu.Lock()
+		greetings++
+		g := greeting
+		mu.Unlock()
+		if g == "" {
+			<-hold
+			return
+		}
+		io.WriteString(c, g)
+		bufio.NewReader(c).ReadString('\n')
+	})
+	_, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	def, err := ParseServiceCheck("mail", "smtp", port, "", "", "", "", "", "1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTracker(time.Second, true)
+	tr.SetServiceChecks([]ServiceCheckDef{def})
+	conn := func(app string, local int, remote string, port int) *Connection {
+		c := &Connection{AppName: app, PID: 7, Protocol: "tcp", State: StateEstablished,
+			LocalAddr: "127.0.0.1", LocalPort: local, RemoteAddr: remote, RemotePort: port}
+		tr.connections[c.Key()] = c
+		return c
+	}
+	a, b := conn("mutt", 50001, "127.0.0.1", port), conn("mutt", 50002, "127.0.0.1", port)
+	other := conn("web", 50003, "127.0.0.1", port+1) // no check applies
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	scan := func() {
+		t.Helper()
+		tr.mu.Lock()
+		tr.attachServiceChecks(now)
+		tr.mu.Unlock()
+		tr.runServiceChecks(now)
+	}
+	waitIdle := func() {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+			tr.checks.mu.Lock()
+			busy := false
+			for _, tg := range tr.checks.targets {
+				busy = busy || tg.running
+			}
+			tr.checks.mu.Unlock()
+			if !busy {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("checks still running")
+			}
+		}
+	}
+
+	scan()
+	waitIdle()
+	scan() // attaches the result
+	if a.ServiceCheck == nil || a.ServiceCheck != b.ServiceCheck || other.ServiceCheck != nil {
+		t.Fatalf("results: %v, %v, %v", a.ServiceCheck, b.ServiceCheck, other.ServiceCheck)
+	}
+	if !a.ServiceCheck.OK || a.ServiceCheck.Status != "220" || connects() != 1 {
+		t.Fatalf("first check %+v after %d connects", a.ServiceCheck, connects())
+	}
+	if alerts := tr.AlertRule().Evaluate(now, []*Connection{a}); len(alerts) != 0 {
+		t.Errorf("alerts for a passing check: %v", alerts)
+	}
+
+	// Not due again until a minute has passed.
+	mu.Lock()
+	greeting = "554 go away\r\n"
+	mu.Unlock()
+	now = now.Add(30 * time.Second)
+	scan()
+	waitIdle()
+	if connects() != 1 {
+		t.Fatalf("checked again after 30s")
+	}
+	for range 2 {
+		now = now.Add(DefaultServiceCheckEvery)
+		scan()
+		waitIdle()
+	}
+	scan()
+	if r := a.ServiceCheck; r.OK || r.Failures != 2 || r.Err != "greeting 554 go away" {
+		t.Fatalf("failing check %+v", r)
+	}
+	alerts := tr.AlertRule().Evaluate(now, []*Connection{a})
+	if len(alerts) != 1 || alerts[0].Kind != AlertServiceCheck || alerts[0].Reason != "mail check failed: smtp 554 in "+a.ServiceCheck.Latency.Round(100*time.Microsecond).String()+": greeting 554 go away" {
+		t.Errorf("alerts %+v", alerts)
+	}
+
+	// At most maxServiceChecks run at once.
+	mu.Lock()
+	greeting = ""
+	mu.Unlock()
+	for i := range maxServiceChecks + 2 {
+		conn("many", 51000+i, "127.0.0."+strconv.Itoa(10+i), port)
+	}
+	now = now.Add(DefaultServiceCheckEvery)
+	scan()
+	tr.checks.mu.Lock()
+	running := 0
+	for _, tg := range tr.checks.targets {
+		if tg.running {
+			running++
+		}
+	}
+	tr.checks.mu.Unlock()
+	if running != maxServiceChecks {
+		t.Errorf("%d checks running, want %d", running, maxServiceChecks)
+	}
+	close(hold)
+	waitIdle()
+
+	// Removing the check drops its results.
+	tr.SetServiceChecks(nil)
+	scan()
+	if a.ServiceCheck != nil || len(tr.checks.targets) != 0 {
+		t.Errorf("results kept after the check was removed: %v", a.ServiceCheck)
+	}
+}
@@ -0,0 +1,213 @@
+package tracker
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// maxSessionRemotes bounds the remotes a session tallies probes for, and
+// maxAppTotals the apps it tallies traffic for; the ones first seen beyond
+// them are left out of the summary.
+const maxSessionRemotes = 4096
+
+// SessionStats is what one run of the tracker saw, for the summary printed
+// when it exits.
+type SessionStats struct {
+	Start, End time.Time
+	Scans      int
+	PeakRate   float64 // bytes/sec, all connections together, in the busiest scan
+	PeakAt     time.Time
+	AvgRate    float64 // bytes/sec, all connections together, averaged over the scans
+	Apps       []AppTransfer
+	Remotes    []RemoteSummary
+
+	Alerts         int // threshold alerts raised
+	ListenerAlerts int // new listeners and injected alerts
+	Outages        int // remotes that stayed unreachable past unreachable_alert
+
+	// Files are the paths of the files the run wrote, filled in by the
+	// caller: the tracker only knows its own.
+	Files []string
+}
+
+// Duration is how long the session ran.
+func (s SessionStats) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// AppTransfer is the traffic of one app during the session, from the
+// rates of its connections with byte counters.
+type AppTransfer struct {
+	App     string
+	TxBytes uint64
+	RxBytes uint64
+}
+
+// Total is the bytes moved both ways.
+func (a AppTransfer) Total() uint64 {
+	return a.TxBytes + a.RxBytes
+}
+
+// RemoteSummary is the probes of one remote during the session. AvgPing
+// is over the accepted samples, Loss over all probes.
+type RemoteSummary struct {
+	Addr    string
+	Name    string // SNI, or "" when none was seen
+	AvgPing time.Duration
+	Loss    float64
+	Probes  int
+	Pinged  int // probes with an accepted RTT sample
+}
+
+// sessionLog accumulates SessionStats. Guarded by the tracker lock.
+type sessionLog struct {
+	lastScan time.Time
+	scans    int
+	rateSum  float64
+	peak     float64
+	peakAt   time.Time
+	apps     map[string]*AppTransfer
+	remotes  map[string]*remoteTally
+
+	alerts, listenerAlerts, outages int
+}
+
+// remoteTally is the running probe totals of one remote.
+type remoteTally struct {
+	name    string
+	pingSum time.Duration
+	pinged  int
+	lossSum float64
+	probes  int
+}
+
+// noteScan folds a scan's rates into the session: the total for the peak
+// and average, and each app's rate times the time since the previous scan
+// into its transfer. Caller must hold the lock.
+func (s *sessionLog) noteScan(now time.Time, conns map[string]*Connection) {
+	if s.apps == nil {
+		s.apps = make(map[string]*AppTransfer)
+		s.remotes = make(map[string]*remoteTally)
+	}
+	elapsed := 0.0
+	if !s.lastScan.IsZero() {
+		elapsed = now.Sub(s.lastScan).Seconds()
+	}
+	s.lastScan = now
+	total := 0.0
+	for _, c := range conns {
+		if !c.HasByteCounts || c.Protocol == ExternalProtocol {
+			continue
+		}
+		total += c.TxRate + c.RxRate
+		if c.AppName == "" || elapsed <= 0 {
+			continue
+		}
+		a := s.apps[c.AppName]
+		if a == nil {
+			if len(s.apps) >= maxAppTotals {
+				continue
+			}
+			a = &AppTransfer{App: c.AppName}
+			s.apps[c.AppName] = a
+		}
+		a.TxBytes += uint64(c.TxRate * elapsed)
+		a.RxBytes += uint64(c.RxRate * elapsed)
+	}
+	s.scans++
+	s.rateSum += total
+	if total > s.peak {
+		s.peak, s.peakAt = total, now
+	}
+}
+
+// noteProbe tallies one probe of c's remote: its loss, and its Ping when
+// the sample filter accepted it. Caller must hold the lock.
+func (s *sessionLog) noteProbe(c *Connection, loss float64, accepted bool) {
+	if s.remotes == nil {
+		return
+	}
+	r := s.remotes[c.RemoteAddr]
+	if r == nil {
+		if len(s.remotes) >= maxSessionRemotes {
+			return
+		}
+		r = &remoteTally{}
+		s.remotes[c.RemoteAddr] = r
+	}
+	if c.SNI != "" {
+		r.name = c.SNI
+	}
+	r.probes++
+	r.lossSum += loss
+	if accepted && loss < 100 {
+		r.pingSum += c.Ping
+		r.pinged++
+	}
+}
+
+// Session returns the statistics of the run so far, with apps by bytes
+// moved and remotes by address.
+func (t *Tracker) Session() SessionStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s := &t.session
+	st := SessionStats{
+		Start:          t.started,
+		End:            time.Now(),
+		Scans:          s.scans,
+		PeakRate:       s.peak,
+		PeakAt:         s.peakAt,
+		Alerts:         s.alerts,
+		ListenerAlerts: s.listenerAlerts,
+		Outages:        s.outages,
+	}
+	if s.scans > 0 {
+		st.AvgRate = s.rateSum / float64(s.scans)
+	}
+	for _, a := range s.apps {
+		st.Apps = append(st.Apps, *a)
+	}
+	slices.SortFunc(st.Apps, func(a, b AppTransfer) int {
+		return cmp.Or(cmp.Compare(b.Total(), a.Total()), cmp.Compare(a.App, b.App))
+	})
+	for addr, r := range s.remotes {
+		rs := RemoteSummary{Addr: addr, Name: r.name, Probes: r.probes, Pinged: r.pinged}
+		if r.probes > 0 {
+			rs.Loss = r.lossSum / float64(r.probes)
+		}
+		if r.pinged > 0 {
+			rs.AvgPing = r.pingSum / time.Duration(r.pinged)
+		}
+		st.Remotes = append(st.Remotes, rs)
+	}
+	slices.SortFunc(st.Remotes, func(a, b RemoteSummary) int { return cmp.Compare(a.Addr, b.Addr) })
+	return st
+}
+
+// WorstByPing returns up to n remotes with the highest average ping,
+// leaving out the ones never pinged.
+func (s SessionStats) WorstByPing(n int) []RemoteSummary {
+	var out []RemoteSummary
+	for _, r := range s.Remotes {
+		if r.Pinged > 0 {
+			out = append(out, r)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b RemoteSummary) int { return cmp.Compare(b.AvgPing, a.AvgPing) })
+	return out[:min(n, len(out))]
+}
+
+// WorstByLoss returns up to n remotes with the highest loss, leaving out
+// the ones that lost nothing.
+func (s SessionStats) WorstByLoss(n int) []RemoteSummary {
+	var out []RemoteSummary
+	for _, r := range s.Remotes {
+		if r.Loss > 0 {
+			out = append(out, r)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b RemoteSummary) int { return cmp.Compare(b.Loss, a.Loss) })
+	return out[:min(n, len(out))]
+}
@@ -0,0 +1,72 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLog(t *testing.T) {
+	var s sessionLog
+	now := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	conn := func(app string, tx, rx float64) *Connection {
+		return &Connection{AppName: app, HasByteCounts: true, TxRate: tx, RxRate: rx}
+	}
+	// The first scan sets the peak but moves no bytes: there is no
+	// previous scan to measure from.
+	s.noteScan(now, map[string]*Connection{"a": conn("steam", 100, 900), "b": conn("zoom", 50, 50)})
+	s.noteScan(now.Add(2*time.Second), map[string]*Connection{
+		"a": conn("steam", 100, 400), "b": conn("zoom", 50, 50),
+		"c": {AppName: "curl", TxRate: 1e6}, // no byte counters
+		"d": {AppName: "ext", Protocol: ExternalProtocol, HasByteCounts: true, RxRate: 1e6},
+	})
+	s.noteScan(now.Add(3*time.Second), map[string]*Connection{"b": conn("zoom", 0, 0)})
+
+	remote := &Connection{RemoteAddr: "192.0.2.1", SNI: "example.net", Ping: 20 * time.Millisecond}
+	s.noteProbe(remote, 0, true)
+	remote.Ping = 40 * time.Millisecond
+	s.noteProbe(remote, 0, true)
+	s.noteProbe(remote, 0, false) // rejected by the sample filter
+	s.noteProbe(remote, 100, true)
+
+	tr := NewTracker(time.Second, false)
+	tr.started = now
+	tr.session = s
+	st := tr.Session()
+	if st.Scans != 3 || st.PeakRate != 1100 || !st.PeakAt.Equal(now) {
+		t.Errorf("scans %d, peak %.0f at %s", st.Scans, st.PeakRate, st.PeakAt)
+	}
+	if want := (1100.0 + 600 + 0) / 3; st.AvgRate != want {
+		t.Errorf("average %.1f, want %.1f", st.AvgRate, want)
+	}
+	if len(st.Apps) != 2 || st.Apps[0] != (AppTransfer{App: "steam", TxBytes: 200, RxBytes: 800}) ||
+		st.Apps[1] != (AppTransfer{App: "zoom", TxBytes: 100, RxBytes: 100}) {
+		t.Errorf("apps %+v", st.Apps)
+	}
+	want := RemoteSummary{Addr: "192.0.2.1", Name: "example.net", AvgPing: 30 * time.Millisecond, Loss: 25, Probes: 4, Pinged: 2}
+	if len(st.Remotes) != 1 || st.Remotes[0] != want {
+		t.Errorf("remotes %+v, want %+v", st.Remotes, want)
+	}
+}
+
+func TestSessionWorst(t *testing.T) {
+	s := SessionStats{Remotes: []RemoteSummary{
+		{Addr: "a", AvgPing: 10 * time.Millisecond, Pinged: 1},
+		{Addr: "b", Loss: 100, Probes: 1},
+		{Addr: "c", AvgPing: 30 * time.Millisecond, Loss: 5, Pinged: 9, Probes: 10},
+		{Addr: "d", AvgPing: 20 * time.Millisecond, Pinged: 1},
+	}}
+	var got []string
+	for _, r := range s.WorstByPing(2) {
+		got = append(got, r.Addr)
+	}
+	if len(got) != 2 || got[0] != "c" || got[1] != "d" {
+		t.Errorf("by ping %v", got)
+	}
+	got = got[:0]
+	for _, r := range s.WorstByLoss(5) {
+		got = append(got, r.Addr)
+	}
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("by loss %v, want the two lossy remotes", got)
+	}
+}
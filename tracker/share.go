@@ -0,0 +1,24 @@
+package tracker
+
+// minShareTotal is the combined throughput (bytes/sec) below which shares
+// are not meaningful and are reported as unavailable.
+const minShareTotal = 1.0
+
+// ComputeShares returns each connection's TxRate+RxRate as a percentage of
+// the total over conns, keyed by Key(), together with the total. The map is
+// nil when the total is too small to divide by.
+func ComputeShares(conns []*Connection) (map[string]float64, float64) {
+	var total float64
+	for _, c := range conns {
+		total += c.TxRate + c.RxRate
+	}
+	if total < minShareTotal {
+		return nil, total
+	}
+
+	shares := make(map[string]float64, len(conns))
+	for _, c := range conns {
+		shares[c.Key()] = (c.TxRate + c.RxRate) / total * 100
+	}
+	return shares, total
+}
@@ -0,0 +1,41 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeShares(t *testing.T) {
+	a := &Connection{AppName: "a", RemotePort: 1, TxRate: 300, RxRate: 450}
+	b := &Connection{AppName: "b", RemotePort: 2, RxRate: 250}
+	idle := &Connection{AppName: "c", RemotePort: 3}
+
+	shares, total := ComputeShares([]*Connection{a, b, idle})
+	if total != 1000 {
+		t.Fatalf("total %v, want 1000", total)
+	}
+	want := map[*Connection]float64{a: 75, b: 25, idle: 0}
+	var sum float64
+	for c, pct := range want {
+		if got := shares[c.Key()]; math.Abs(got-pct) > 1e-9 {
+			t.Errorf("%s: %v%%, want %v%%", c.AppName, got, pct)
+		}
+		sum += shares[c.Key()]
+	}
+	if math.Abs(sum-100) > 1e-9 {
+		t.Errorf("shares add up to %v", sum)
+	}
+}
+
+func TestComputeSharesNearZero(t *testing.T) {
+	for _, conns := range [][]*Connection{
+		nil,
+		{{RemotePort: 1}},
+		{{RemotePort: 1, TxRate: 0.4}, {RemotePort: 2, RxRate: 0.4}},
+	} {
+		shares, _ := ComputeShares(conns)
+		if shares != nil {
+			t.Errorf("%d conns: shares %v below the minimum total", len(conns), shares)
+		}
+	}
+}
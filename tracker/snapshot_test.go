@@ -0,0 +1,192 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// failingSource is a source whose scans fail.
+type failingSource struct{ fakeSource }
+
+func (s *failingSource) Scan() ([]*Connection, error) {
+	return nil, errors.New("netlink: operation not permitted")
+}
+
+func TestGeneration(t *testing.T) {
+	src := &fakeSource{}
+	src.set(fakeConn("curl", "192.0.2.1", 443))
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	g := tr.Generation()
+	tr.scan()
+	if tr.Generation() == g {
+		t.Fatal("a scan left the generation alone")
+	}
+
+	g = tr.Generation()
+	tr.Snapshot()
+	tr.Search("curl")
+	if tr.Generation() != g {
+		t.Error("reading moved the generation on")
+	}
+	tr.scan()
+	if tr.Generation() != g {
+		t.Error("an idle scan moved the generation on")
+	}
+	src.set(fakeConn("curl", "192.0.2.1", 443), fakeConn("wget", "192.0.2.2", 80))
+	tr.scan()
+	if tr.Generation() == g {
+		t.Fatal("a scan that found a new connection left the generation alone")
+	}
+	g = tr.Generation()
+	tr.mu.Lock()
+	for _, c := range tr.connections {
+		if c.AppName == "curl" {
+			c.Ping = 20 * time.Millisecond
+		}
+	}
+	tr.mu.Unlock()
+	tr.scan()
+	if tr.Generation() == g {
+		t.Error("a scan after a ping changed left the generation alone")
+	}
+
+	g = tr.Generation()
+	if err := tr.IngestRTT(ExternalRTT{Remote: "192.0.2.2:80", RTTms: 35, Source: "game"}); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Generation() == g {
+		t.Error("an external RTT left the generation alone")
+	}
+	g = tr.Generation()
+	mustInject(t, tr, "ping-spike=all,100ms,1m")
+	if tr.Generation() == g {
+		t.Error("an injection left the generation alone")
+	}
+
+	g = tr.Generation()
+	tr.SetSource(&failingSource{})
+	tr.scan()
+	if tr.Generation() != g {
+		t.Error("a failed scan moved the generation on")
+	}
+}
+
+// TestSnapshotInto checks that the buffers passed back are reused, and
+// that the copies are the tracked connections as Snapshot returns them.
+func TestSnapshotInto(t *testing.T) {
+	src := &fakeSource{}
+	var conns []Connection
+	for i := range 5 {
+		conns = append(conns, fakeConn(fmt.Sprintf("app%d", i), fmt.Sprintf("192.0.2.%d", i+1), 443))
+	}
+	src.set(conns...)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+
+	buf := tr.SnapshotInto(nil)
+	if len(buf) != 5 {
+		t.Fatalf("%d connections", len(buf))
+	}
+	first := buf[0]
+	first.AppName = "scribbled"
+	again := tr.SnapshotInto(buf)
+	if &again[0] != &buf[0] {
+		t.Error("the slice was not reused")
+	}
+	reused := map[*Connection]bool{}
+	for _, c := range buf[:cap(buf)] {
+		reused[c] = true
+	}
+	apps := map[string]bool{}
+	for _, c := range again {
+		if !reused[c] {
+			t.Errorf("%s: a new Connection value", c.AppName)
+		}
+		apps[c.AppName] = true
+	}
+	if len(apps) != 5 || apps["scribbled"] {
+		t.Errorf("apps %v", apps)
+	}
+	if got := byApp(tr.Snapshot()); len(got) != 5 || got["app3"] == nil || got["app3"].RemoteAddr != "192.0.2.4" {
+		t.Errorf("snapshot %v", got)
+	}
+
+	if n := testing.AllocsPerRun(10, func() { again = tr.SnapshotInto(again) }); n != 0 {
+		t.Errorf("%.0f allocations copying into a buffer that fits", n)
+	}
+
+	// More connections than the buffer holds: the rest are allocated.
+	src.set(append(conns, fakeConn("late", "192.0.2.99", 443))...)
+	tr.scan()
+	if again = tr.SnapshotInto(again); len(again) != 6 {
+		t.Errorf("%d connections after one opened", len(again))
+	}
+}
+
+// TestSnapshotIntoDrop checks that a dropped connection leaves no two
+// entries of the reused buffer pointing to the same value.
+func TestSnapshotIntoDrop(t *testing.T) {
+	src := &fakeSource{}
+	src.set(fakeConn("firefox", "192.0.2.1", 443), fakeConn("steam", "192.0.2.2", 443), fakeConn("curl", "192.0.2.3", 443))
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+	buf := tr.SnapshotInto(nil)
+	mustInject(t, tr, "conn-drop=app:firefox,1m")
+	for range 3 {
+		buf = tr.SnapshotInto(buf)
+		if len(buf) != 2 {
+			t.Fatalf("%d connections with one dropped", len(buf))
+		}
+		if buf[0] == buf[1] {
+			t.Fatal("two entries share a value")
+		}
+		seen := map[*Connection]bool{}
+		for _, c := range buf[:cap(buf)] {
+			if c != nil && seen[c] {
+				t.Fatalf("a spare slot points to %s, which is in use", c.AppName)
+			}
+			seen[c] = true
+		}
+		if got := byApp(buf); got["firefox"] != nil || got["steam"] == nil || got["curl"] == nil {
+			t.Fatalf("snapshot %v", got)
+		}
+	}
+}
+
+func benchTracker(b *testing.B, n int) *Tracker {
+	src := &fakeSource{}
+	conns := make([]Connection, n)
+	for i := range conns {
+		conns[i] = fakeConn(fmt.Sprintf("app%d", i%50), fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255), 443)
+		conns[i].LocalPort = 1024 + i
+	}
+	src.set(conns...)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.scan()
+	return tr
+}
+
+// BenchmarkSnapshot and BenchmarkSnapshotInto copy 5000 connections; the
+// second reuses its buffer, so a copy allocates nothing.
+func BenchmarkSnapshot(b *testing.B) {
+	tr := benchTracker(b, 5000)
+	b.ReportAllocs()
+	for b.Loop() {
+		tr.Snapshot()
+	}
+}
+
+func BenchmarkSnapshotInto(b *testing.B) {
+	tr := benchTracker(b, 5000)
+	buf := tr.SnapshotInto(nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		buf = tr.SnapshotInto(buf)
+	}
+}
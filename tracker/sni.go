@@ -0,0 +1,466 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxHelloLen bounds the ClientHello handshake message accepted; real
+	// ones, post-quantum key shares included, stay well below it.
+	maxHelloLen = 16 << 10
+	// maxHelloPackets is how many packets of one flow are buffered while a
+	// ClientHello is incomplete; after that the flow is given up on.
+	maxHelloPackets = 2
+	// sniTTL is how long an observed name waits for its socket to show up
+	// in a scan before it is dropped.
+	sniTTL = time.Minute
+	// maxSNIFlows bounds the names and partial hellos waiting to be matched.
+	maxSNIFlows = 4096
+	// maxQUICHelloPackets is how many Initial packets of one QUIC flow are
+	// decrypted looking for its ClientHello, which post-quantum key shares
+	// spread over two or three.
+	maxQUICHelloPackets = 4
+	// quicRemoteTTL is how long a server that spoke QUIC labels new flows
+	// to it whose handshake was not seen.
+	quicRemoteTTL = 30 * time.Minute
+)
+
+var (
+	// ErrHelloIncomplete means the bytes so far are the start of a TLS
+	// handshake but do not hold the whole ClientHello.
+	ErrHelloIncomplete = errors.New("tls client hello: incomplete")
+	// ErrNotClientHello means the bytes are not a TLS ClientHello.
+	ErrNotClientHello = errors.New("tls client hello: not a client hello")
+)
+
+// ParseClientHello returns the server_name (SNI) of the TLS ClientHello at
+// the start of b, the first bytes a client sends on a TLS connection. The
+// hello may span several TLS records. It returns "" with a nil error for a
+// hello without the extension, ErrHelloIncomplete when b ends before the
+// hello does, and ErrNotClientHello for anything else, malformed hellos
+// included. It never reads past b and never panics.
+func ParseClientHello(b []byte) (string, error) {
+	var hs []byte // handshake bytes reassembled from the records
+	for len(b) > 0 {
+		if len(b) < 5 {
+			return "", ErrHelloIncomplete
+		}
+		if b[0] != 0x16 || b[1] != 3 { // handshake record, SSL 3.0 / TLS 1.x
+			return "", ErrNotClientHello
+		}
+		n := int(binary.BigEndian.Uint16(b[3:5]))
+		if n == 0 || n > maxHelloLen {
+			return "", ErrNotClientHello
+		}
+		if len(b) < 5+n {
+			return "", ErrHelloIncomplete
+		}
+		hs = append(hs, b[5:5+n]...)
+		b = b[5+n:]
+		if name, err := clientHelloName(hs); err != ErrHelloIncomplete {
+			return name, err
+		}
+	}
+	return "", ErrHelloIncomplete
+}
+
+// clientHelloName returns the server name of the ClientHello handshake
+// message at the start of hs, as TLS records carry it or QUIC CRYPTO
+// frames do, with the errors of ParseClientHello.
+func clientHelloName(hs []byte) (string, error) {
+	if len(hs) < 4 {
+		return "", ErrHelloIncomplete
+	}
+	if hs[0] != 1 { // client_hello
+		return "", ErrNotClientHello
+	}
+	size := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+	if size > maxHelloLen {
+		return "", ErrNotClientHello
+	}
+	if len(hs) < 4+size {
+		return "", ErrHelloIncomplete
+	}
+	return helloServerName(hs[4 : 4+size])
+}
+
+// helloServerName reads the server_name extension from a ClientHello body.
+func helloServerName(body []byte) (string, error) {
+	r := helloReader(body)
+	if !r.skip(2 + 32) { // legacy_version, random
+		return "", ErrNotClientHello
+	}
+	if _, ok := r.vector(1); !ok { // legacy_session_id
+		return "", ErrNotClientHello
+	}
+	if _, ok := r.vector(2); !ok { // cipher_suites
+		return "", ErrNotClientHello
+	}
+	if _, ok := r.vector(1); !ok { // legacy_compression_methods
+		return "", ErrNotClientHello
+	}
+	if len(r) == 0 {
+		return "", nil // no extensions at all
+	}
+	exts, ok := r.vector(2)
+	if !ok {
+		return "", ErrNotClientHello
+	}
+	for len(exts) > 0 {
+		typ, ok := exts.uint16()
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		data, ok := exts.vector(2)
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		if typ != 0 { // server_name
+			continue
+		}
+		list, ok := data.vector(2)
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		for len(list) > 0 {
+			nameType := list[0]
+			list = list[1:]
+			name, ok := list.vector(2)
+			if !ok {
+				return "", ErrNotClientHello
+			}
+			if nameType == 0 { // host_name
+				return validHostName(string(name))
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// validHostName checks that an SNI value is a plausible DNS name and
+// lower-cases it; anything else would end up on screen unfiltered.
+func validHostName(name string) (string, error) {
+	if name == "" || len(name) > 253 {
+		return "", ErrNotClientHello
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return "", ErrNotClientHello
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(name, ".")), nil
+}
+
+// helloReader consumes a byte slice from the front.
+type helloReader []byte
+
+func (r *helloReader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *helloReader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+// vector reads a length-prefixed field whose length takes lenBytes (1 or
+// 2) bytes.
+func (r *helloReader) vector(lenBytes int) (helloReader, bool) {
+	if len(*r) < lenBytes {
+		return nil, false
+	}
+	n := int((*r)[0])
+	if lenBytes == 2 {
+		n = int(binary.BigEndian.Uint16(*r))
+	}
+	rest := (*r)[lenBytes:]
+	if len(rest) < n {
+		return nil, false
+	}
+	*r = rest[n:]
+	return rest[:n], true
+}
+
+// sniFlow is the 5-tuple an SNI was seen on, from the client's side.
+type sniFlow struct {
+	local, remote netip.AddrPort
+	udp           bool
+}
+
+// sniEntry is an observed name, or the start of a hello still incomplete.
+// A QUIC flow also keeps its version, and the connection ID and CRYPTO
+// data of the client's Initial packets.
+type sniEntry struct {
+	name    string
+	partial []byte
+	packets int
+	at      time.Time
+
+	quic        bool   // QUIC long headers were seen
+	quicVersion uint32 // of the latest; 0 while only Version Negotiation was seen
+	quicDCID    []byte // the client's first destination connection ID
+	crypto      quicStream
+}
+
+// quicRemote is what the QUIC flows to one server showed.
+type quicRemote struct {
+	version uint32
+	name    string
+	at      time.Time
+}
+
+// sniCache holds names seen by ObserveClientHello until a scan attaches
+// them to their connection. It has its own lock, so a capture loop feeding
+// it never waits for a scan.
+type sniCache struct {
+	mu    sync.Mutex
+	flows map[sniFlow]*sniEntry
+	// remotes are the servers QUIC flows went to, for flows to them that
+	// began before the capture or lost their Initial packets.
+	remotes map[netip.AddrPort]*quicRemote
+}
+
+// ObserveClientHello takes the TCP payload of one packet a local client
+// sent from local to remote, for a packet capture to call. Packets that
+// start or continue a TLS ClientHello are parsed, and a server name found
+// is attached to the connection on that 5-tuple by the next scan, where it
+// stays for the connection's lifetime. A hello split across packets is
+// buffered for up to maxHelloPackets packets. It is safe to call from any
+// goroutine and does not wait for the tracker's lock.
+func (t *Tracker) ObserveClientHello(local, remote netip.AddrPort, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	flow := sniFlow{unmapAddrPort(local), unmapAddrPort(remote), false}
+	c := &t.sni
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.flows[flow]
+	switch {
+	case e != nil && e.name != "":
+		return // already known; later packets are application data
+	case e == nil && payload[0] != 0x16:
+		return // not a TLS handshake: the common case, kept cheap
+	}
+	buf := payload
+	if e != nil {
+		buf = append(e.partial, payload...)
+	}
+	name, err := ParseClientHello(buf)
+	switch {
+	case err == ErrHelloIncomplete:
+		if e == nil {
+			if len(c.flows) >= maxSNIFlows {
+				return
+			}
+			e = &sniEntry{}
+			if c.flows == nil {
+				c.flows = make(map[sniFlow]*sniEntry)
+			}
+			c.flows[flow] = e
+		}
+		e.partial = append([]byte(nil), buf...)
+		e.packets++
+		e.at = time.Now()
+		if e.packets >= maxHelloPackets || len(e.partial) > maxHelloLen+5*4 {
+			delete(c.flows, flow)
+		}
+	case err != nil || name == "":
+		if e != nil {
+			delete(c.flows, flow)
+		}
+	default:
+		if e == nil {
+			if len(c.flows) >= maxSNIFlows {
+				return
+			}
+			if c.flows == nil {
+				c.flows = make(map[sniFlow]*sniEntry)
+			}
+			e = &sniEntry{}
+			c.flows[flow] = e
+		}
+		*e = sniEntry{name: name, at: time.Now()}
+	}
+}
+
+// ObserveQUIC takes the payload of one UDP datagram between local and
+// remote, for a packet capture to call; outbound is set when local sent
+// it. A QUIC long header marks the flow as QUIC whatever its ports, and
+// records its version. The server name is read from the ClientHello in the
+// client's Initial packets, whose keys follow from the packet itself. The
+// next scan attaches both to the connection on that 5-tuple. It is safe to
+// call from any goroutine and does not wait for the tracker's lock.
+func (t *Tracker) ObserveQUIC(local, remote netip.AddrPort, payload []byte, outbound bool) {
+	h, err := parseQUICLongHeader(payload)
+	if err != nil || !quicVersionKnown(h.version) {
+		return // short headers and other protocols: the common case
+	}
+	flow := sniFlow{unmapAddrPort(local), unmapAddrPort(remote), true}
+	c := &t.sni
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.flows[flow]
+	if e == nil {
+		if len(c.flows) >= maxSNIFlows {
+			return
+		}
+		if c.flows == nil {
+			c.flows = make(map[sniFlow]*sniEntry)
+		}
+		e = &sniEntry{}
+		c.flows[flow] = e
+	}
+	e.quic, e.at = true, time.Now()
+	if h.version != 0 && h.version&0x0f0f0f0f != 0x0a0a0a0a {
+		e.quicVersion = h.version
+	}
+	if !outbound || h.typ != quicInitial || e.name != "" || e.packets >= maxQUICHelloPackets {
+		return
+	}
+	if e.quicDCID == nil {
+		// Later Initial packets may go to the server's chosen ID, but stay
+		// protected with keys from the first one.
+		e.quicDCID = append([]byte(nil), h.dcid...)
+	}
+	e.packets++
+	keys, err := quicInitialKeys(h.version, e.quicDCID, false)
+	if err != nil {
+		e.packets = maxQUICHelloPackets // a version without known Initial keys
+		return
+	}
+	_, frames, err := keys.open(append([]byte(nil), payload[:h.end]...), h)
+	if err != nil {
+		return
+	}
+	crypto, err := parseQUICFrames(frames)
+	if err != nil {
+		return
+	}
+	for _, f := range crypto {
+		if !e.crypto.add(f) {
+			e.packets, e.crypto = maxQUICHelloPackets, quicStream{}
+			return
+		}
+	}
+	name, err := clientHelloName(e.crypto.data)
+	if err == ErrHelloIncomplete {
+		return
+	}
+	e.crypto = quicStream{}
+	if err != nil || name == "" {
+		e.packets = maxQUICHelloPackets
+		return
+	}
+	e.name = name
+}
+
+// attach copies observed names, and the QUIC service hint and version,
+// onto the connections of their 5-tuple and drops flows whose socket never
+// showed up. A UDP connection without a flow of its own takes them from
+// an earlier QUIC flow to the same server. Caller must hold the tracker
+// lock.
+func (c *sniCache) attach(conns map[string]*Connection, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.flows) == 0 && len(c.remotes) == 0 {
+		return
+	}
+	for _, conn := range conns {
+		udp := strings.HasPrefix(conn.Protocol, "udp")
+		if !udp && (conn.SNI != "" || !strings.HasPrefix(conn.Protocol, "tcp")) {
+			continue
+		}
+		local, err1 := netip.ParseAddr(conn.LocalAddr)
+		remote, err2 := netip.ParseAddr(conn.RemoteAddr)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		flow := sniFlow{
+			netip.AddrPortFrom(local.Unmap(), uint16(conn.LocalPort)),
+			netip.AddrPortFrom(remote.Unmap(), uint16(conn.RemotePort)),
+			udp,
+		}
+		e := c.flows[flow]
+		if e == nil {
+			if r := c.remotes[flow.remote]; udp && r != nil {
+				conn.Service = ServiceQUIC
+				if r.version != 0 {
+					conn.QUICVersion = QUICVersionName(r.version)
+				}
+				if conn.SNI == "" {
+					conn.SNI = r.name
+				}
+			}
+			continue
+		}
+		if e.quic {
+			conn.Service = ServiceQUIC
+			if e.quicVersion != 0 {
+				conn.QUICVersion = QUICVersionName(e.quicVersion)
+			}
+			c.remember(flow.remote, e, now)
+		}
+		// A QUIC flow stays until it expires, as later packets can still
+		// change its version.
+		if e.name != "" && conn.SNI == "" {
+			conn.SNI = e.name
+			if !udp {
+				delete(c.flows, flow)
+			}
+		}
+	}
+	for flow, e := range c.flows {
+		if now.Sub(e.at) > sniTTL {
+			delete(c.flows, flow)
+		}
+	}
+	for remote, r := range c.remotes {
+		if now.Sub(r.at) > quicRemoteTTL {
+			delete(c.remotes, remote)
+		}
+	}
+}
+
+// remember records what the QUIC flow e showed of its server.
+func (c *sniCache) remember(remote netip.AddrPort, e *sniEntry, now time.Time) {
+	r := c.remotes[remote]
+	if r == nil {
+		if len(c.remotes) >= maxSNIFlows {
+			return
+		}
+		if c.remotes == nil {
+			c.remotes = make(map[netip.AddrPort]*quicRemote)
+		}
+		r = &quicRemote{}
+		c.remotes[remote] = r
+	}
+	if e.quicVersion != 0 {
+		r.version = e.quicVersion
+	}
+	if e.name != "" {
+		r.name = e.name
+	}
+	r.at = now
+}
+
+func unmapAddrPort(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap().WithZone(""), ap.Port())
+}
@@ -0,0 +1,219 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The hellos in testdata/tls are what crypto/tls sends: TLS 1.3 with a
+// post-quantum key share for API.Example.com, TLS 1.2 only for
+// legacy.example.net, and one to an IP address, without server_name.
+
+// helloRecords builds the TLS records of a ClientHello with a server_name
+// of name (none when empty) after a padding extension of pad bytes. The
+// handshake message is cut into records of at most recordLen bytes.
+func helloRecords(name string, pad, recordLen int) []byte {
+	u16 := func(b []byte, n int) []byte { return binary.BigEndian.AppendUint16(b, uint16(n)) }
+	var exts []byte
+	if pad > 0 {
+		exts = u16(u16(exts, 21), pad) // padding
+		exts = append(exts, make([]byte, pad)...)
+	}
+	if name != "" {
+		entry := u16([]byte{0}, len(name))
+		entry = append(entry, name...)
+		exts = u16(u16(exts, 0), 2+len(entry))
+		exts = u16(exts, len(entry))
+		exts = append(exts, entry...)
+	}
+	body := append([]byte{3, 3}, make([]byte, 32)...) // version, random
+	body = append(body, 0)                            // session ID
+	body = append(body, 0, 2, 0x13, 0x01)             // cipher suites
+	body = append(body, 1, 0)                         // compression
+	body = u16(body, len(exts))
+	body = append(body, exts...)
+	hs := append([]byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+
+	var out []byte
+	for len(hs) > 0 {
+		n := min(len(hs), recordLen)
+		out = u16(append(out, 0x16, 3, 1), n)
+		out = append(out, hs[:n]...)
+		hs = hs[n:]
+	}
+	return out
+}
+
+func TestParseClientHello(t *testing.T) {
+	tls13 := readPacket(t, "tls/tls13.bin")
+	tls12 := readPacket(t, "tls/tls12.bin")
+	modified := func(b []byte, i int, v byte) []byte {
+		b = append([]byte(nil), b...)
+		b[i] = v
+		return b
+	}
+	tests := []struct {
+		name  string
+		b     []byte
+		want  string
+		error error
+	}{
+		{"TLS 1.3, post-quantum key share", tls13, "api.example.com", nil},
+		{"TLS 1.2", tls12, "legacy.example.net", nil},
+		{"no server_name", readPacket(t, "tls/no_sni.bin"), "", nil},
+		{"followed by more data", append(append([]byte(nil), tls12...), 0x17, 3, 3, 0, 1, 0), "legacy.example.net", nil},
+		{"two records", helloRecords("split.example.com", 0, 40), "split.example.com", nil},
+		{"one byte records", helloRecords("a.b", 0, 1), "a.b", nil},
+		{"large padding", helloRecords("pad.example.com", 8000, 1<<14), "pad.example.com", nil},
+		{"trailing dot", helloRecords("fqdn.example.", 0, 1<<14), "fqdn.example", nil},
+		{"no extensions", append([]byte{0x16, 3, 1, 0, 45, 1, 0, 0, 41, 3, 3}, append(make([]byte, 33), 0, 2, 0x13, 0x01, 1, 0)...), "", nil},
+		{"empty extensions", helloRecords("", 0, 1<<14), "", nil},
+
+		{"record header only", tls13[:5], "", ErrHelloIncomplete},
+		{"short record header", tls13[:3], "", ErrHelloIncomplete},
+		{"cut in the key share", tls13[:1000], "", ErrHelloIncomplete},
+		{"first of two records", helloRecords("split.example.com", 0, 40)[:45], "", ErrHelloIncomplete},
+		{"empty", nil, "", ErrHelloIncomplete},
+
+		{"HTTP", []byte("GET / HTTP/1.1\r\n\r\n"), "", ErrNotClientHello},
+		{"alert record", modified(tls12, 0, 0x15), "", ErrNotClientHello},
+		{"SSL 2 version", modified(tls12, 1, 2), "", ErrNotClientHello},
+		{"empty record", []byte{0x16, 3, 1, 0, 0}, "", ErrNotClientHello},
+		{"oversized record", []byte{0x16, 3, 1, 0xff, 0xff}, "", ErrNotClientHello},
+		{"server hello", modified(tls12, 5, 2), "", ErrNotClientHello},
+		{"oversized hello", modified(tls12, 6, 1), "", ErrNotClientHello},
+		{"name with a space", helloRecords("evil host", 0, 1<<14), "", ErrNotClientHello},
+		{"name with an escape", helloRecords("a\x1b[2J", 0, 1<<14), "", ErrNotClientHello},
+		{"name too long", helloRecords(strings.Repeat("a", 254), 0, 1<<14), "", ErrNotClientHello},
+		{"extension past the end", func() []byte {
+			b := helloRecords("x.example", 0, 1<<14)
+			return modified(b, len(b)-len("x.example")-7, 0xff) // its length
+		}(), "", ErrNotClientHello},
+	}
+	for _, tt := range tests {
+		got, err := ParseClientHello(tt.b)
+		if got != tt.want || !errors.Is(err, tt.error) {
+			t.Errorf("%s: %q %v, want %q %v", tt.name, got, err, tt.want, tt.error)
+		}
+	}
+}
+
+func FuzzParseClientHello(f *testing.F) {
+	for _, name := range []string{"tls13.bin", "tls12.bin", "no_sni.bin"} {
+		b := readPacket(f, "tls/"+name)
+		f.Add(b)
+		f.Add(b[:len(b)/2])
+	}
+	f.Add(helloRecords("split.example.com", 100, 50))
+	f.Add([]byte{0x16, 3, 1, 0, 4, 1, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		name, err := ParseClientHello(b)
+		if err != nil && err != ErrHelloIncomplete && err != ErrNotClientHello {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if err != nil && name != "" {
+			t.Fatalf("name %q with error %v", name, err)
+		}
+		if name != "" {
+			if valid, err := validHostName(name); err != nil || valid != name {
+				t.Fatalf("returned name %q is not a lower-case host name", name)
+			}
+		}
+	})
+}
+
+// TestObserveClientHello feeds hellos packet by packet as the capture does.
+func TestObserveClientHello(t *testing.T) {
+	tls13 := readPacket(t, "tls/tls13.bin")
+	local, remote := netip.MustParseAddrPort("10.0.0.2:40443"), netip.MustParseAddrPort("192.0.2.1:443")
+	flow := sniFlow{local, remote, false}
+	name := func(tr *Tracker) string {
+		if e := tr.sni.flows[flow]; e != nil {
+			return e.name
+		}
+		return ""
+	}
+
+	tr := NewTracker(time.Hour, false)
+	tr.ObserveClientHello(local, remote, tls13[:700])
+	tr.ObserveClientHello(local, remote, tls13[700:])
+	if name(tr) != "api.example.com" {
+		t.Errorf("hello in two packets: %q", name(tr))
+	}
+	tr.ObserveClientHello(local, remote, []byte{0x17, 3, 3, 0, 1, 0})
+	if name(tr) != "api.example.com" {
+		t.Error("application data replaced the name")
+	}
+
+	// A hello spread over more than maxHelloPackets packets is given up.
+	tr = NewTracker(time.Hour, false)
+	for i := 0; i < 3; i++ {
+		tr.ObserveClientHello(local, remote, tls13[i*500:(i+1)*500])
+	}
+	if len(tr.sni.flows) != 0 {
+		t.Error("flow kept past maxHelloPackets")
+	}
+
+	// Mapped addresses are the plain IPv4 flow.
+	tr = NewTracker(time.Hour, false)
+	mapped := netip.AddrPortFrom(netip.MustParseAddr("::ffff:10.0.0.2"), 40443)
+	tr.ObserveClientHello(mapped, netip.MustParseAddrPort("[::ffff:192.0.2.1]:443"), tls13)
+	if name(tr) != "api.example.com" {
+		t.Error("mapped flow not unmapped")
+	}
+
+	tr = NewTracker(time.Hour, false)
+	tr.ObserveClientHello(local, remote, []byte("GET / HTTP/1.1\r\n\r\n"))
+	tr.ObserveClientHello(local, remote, nil)
+	if len(tr.sni.flows) != 0 {
+		t.Error("non-TLS payload kept")
+	}
+}
+
+// TestCaptureClientHello checks -pcap-accounting reads the server names of
+// the host's TLS connections, from a hello in two segments and from one
+// larger than maxInspectBytes, and not from what servers send.
+func TestCaptureClientHello(t *testing.T) {
+	tls13 := readPacket(t, "tls/tls13.bin")
+	big := helloRecords("big.example.com", 2*maxInspectBytes, 1<<14)
+	local := netip.MustParseAddr("10.0.0.2")
+	remote := netip.MustParseAddrPort("192.0.2.1:443")
+	split, whole, inbound := netip.AddrPortFrom(local, 40001), netip.AddrPortFrom(local, 40002), netip.AddrPortFrom(local, 8443)
+	client := netip.MustParseAddrPort("198.51.100.9:50000")
+
+	src := &fakePackets{}
+	src.add(tcpSegment(split, remote, 1, tls13[:1000]), true)
+	src.add(tcpSegment(split, remote, 1001, tls13[1000:]), true)
+	src.add(tcpSegment(whole, remote, 1, big), true)
+	src.add(tcpSegment(client, inbound, 1, tls13), false) // a client of ours
+
+	scanned := &fakeSource{}
+	conns := []Connection{fakeConn("curl", "192.0.2.1", 443), fakeConn("curl", "192.0.2.1", 443), fakeConn("server", "198.51.100.9", 50000)}
+	conns[0].LocalPort, conns[1].LocalPort = 40001, 40002
+	conns[2].Direction, conns[2].LocalPort = Inbound, 8443
+	scanned.set(conns...)
+	tr := NewTracker(time.Hour, false)
+	tr.SetSource(scanned)
+	tr.startCapture(src)
+	waitFor(t, func() bool {
+		tr.capture.mu.Lock()
+		defer tr.capture.mu.Unlock()
+		return len(tr.capture.flows) == 3
+	})
+	waitFor(t, func() bool {
+		tr.sni.mu.Lock()
+		defer tr.sni.mu.Unlock()
+		return len(tr.sni.flows) == 2
+	})
+	tr.scan()
+	want := map[int]string{40001: "api.example.com", 40002: "big.example.com", 8443: ""}
+	for _, got := range tr.Snapshot() {
+		if got.SNI != want[got.LocalPort] {
+			t.Errorf("port %d: SNI %q, want %q", got.LocalPort, got.SNI, want[got.LocalPort])
+		}
+	}
+}
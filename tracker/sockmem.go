@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SockMemInfo is the kernel's memory accounting of a socket
+// (INET_DIAG_SKMEMINFO), in bytes.
+type SockMemInfo struct {
+	RmemAlloc  uint64 // received data waiting to be read by the app
+	RcvBuf     uint64 // receive buffer limit
+	WmemAlloc  uint64 // sent data still held by the stack (in flight or queued below TCP)
+	SndBuf     uint64 // send buffer limit
+	FwdAlloc   uint64 // memory reserved for the socket but not used yet
+	WmemQueued uint64 // data queued for sending, acknowledged or not
+	OptMem     uint64 // socket options and ancillary data
+	Backlog    uint64 // packets queued while the socket was locked
+	Drops      uint64 // packets dropped for lack of memory or a full buffer
+}
+
+// Total is the memory charged to the socket: what it holds to read and to
+// send, plus what it has reserved. WmemAlloc is part of WmemQueued for TCP,
+// so it is not added again.
+func (s SockMemInfo) Total() uint64 {
+	return s.RmemAlloc + s.WmemQueued + s.FwdAlloc
+}
+
+// String formats the breakdown for the detail view.
+func (s SockMemInfo) String() string {
+	str := fmt.Sprintf("read %s of %s, send queued %s (in stack %s) of %s, reserved %s",
+		FormatBytesTotal(s.RmemAlloc), FormatBytesTotal(s.RcvBuf), FormatBytesTotal(s.WmemQueued),
+		FormatBytesTotal(s.WmemAlloc), FormatBytesTotal(s.SndBuf), FormatBytesTotal(s.FwdAlloc))
+	if s.OptMem > 0 {
+		str += ", options " + FormatBytesTotal(s.OptMem)
+	}
+	if s.Drops > 0 {
+		str += fmt.Sprintf(", %d drops", s.Drops)
+	}
+	return str
+}
+
+// parseSSSkmem reads the socket memory printed by `ss -m`,
+// "(r0,rb131072,t0,tb16384,f0,w0,o0,bl0,d0)". It returns nil when the
+// receive or send allocation is missing.
+func parseSSSkmem(s string) *SockMemInfo {
+	var m SockMemInfo
+	var hasR, hasW bool
+	for _, kv := range strings.Split(strings.Trim(s, "()"), ",") {
+		i := strings.IndexAny(kv, "0123456789")
+		if i <= 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(kv[i:], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch kv[:i] {
+		case "r":
+			m.RmemAlloc, hasR = v, true
+		case "rb":
+			m.RcvBuf = v
+		case "t":
+			m.WmemAlloc = v
+		case "tb":
+			m.SndBuf = v
+		case "f":
+			m.FwdAlloc = v
+		case "w":
+			m.WmemQueued, hasW = v, true
+		case "o":
+			m.OptMem = v
+		case "bl":
+			m.Backlog = v
+		case "d":
+			m.Drops = v
+		}
+	}
+	if !hasR || !hasW {
+		return nil
+	}
+	return &m
+}
+
+// setSockMem records a socket's memory info, or clears it when mem is nil.
+func (c *Connection) setSockMem(mem *SockMemInfo) {
+	c.SockMemInfo = mem
+	c.SockMem = 0
+	if mem != nil {
+		c.SockMem = mem.Total()
+	}
+}
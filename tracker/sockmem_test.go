@@ -0,0 +1,97 @@
+package tracker
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSSSkmem(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *SockMemInfo
+	}{
+		{"(r0,rb131072,t0,tb16384,f0,w0,o0,bl0,d0)", &SockMemInfo{RcvBuf: 131072, SndBuf: 16384}},
+		{"(r327680,rb212992,t46080,tb87040,f3072,w1073920,o320,bl1280,d14)", &SockMemInfo{
+			RmemAlloc: 327680, RcvBuf: 212992, WmemAlloc: 46080, SndBuf: 87040, FwdAlloc: 3072,
+			WmemQueued: 1073920, OptMem: 320, Backlog: 1280, Drops: 14}},
+		// Older ss prints no backlog or drops; newer kernels may add
+		// fields it does not know.
+		{"(r1,rb2,t3,tb4,f5,w6,o7)", &SockMemInfo{RmemAlloc: 1, RcvBuf: 2, WmemAlloc: 3, SndBuf: 4, FwdAlloc: 5, WmemQueued: 6, OptMem: 7}},
+		{"(r1,rb2,t3,tb4,f5,w6,o7,bl8,d9,x10,zz)", &SockMemInfo{RmemAlloc: 1, RcvBuf: 2, WmemAlloc: 3, SndBuf: 4, FwdAlloc: 5, WmemQueued: 6, OptMem: 7, Backlog: 8, Drops: 9}},
+		{"(rb131072,tb87040,f0)", nil},
+		{"(r0,rb131072)", nil},
+		{"(r-1,w0)", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := parseSSSkmem(tt.in)
+		switch {
+		case tt.want == nil && got != nil:
+			t.Errorf("%q: %+v, want nil", tt.in, got)
+		case tt.want != nil && (got == nil || *got != *tt.want):
+			t.Errorf("%q: %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSockMemAlerts(t *testing.T) {
+	mem := func(app, host string, bytes uint64) *Connection {
+		c := fakeConn(app, "192.0.2.1", 443)
+		c.Host = host
+		c.setSockMem(&SockMemInfo{RmemAlloc: bytes, WmemQueued: 0})
+		return &c
+	}
+	none := fakeConn("leaky", "192.0.2.9", 443)
+	conns := []*Connection{
+		mem("leaky", "", 600<<10), mem("leaky", "", 500<<10), &none,
+		mem("leaky", "db1", 900<<10), // another agent's app of that name
+		mem("small", "", 2<<20-1),
+		mem("big", "", 3<<20),
+	}
+	r := AlertRule{AppSockMemThreshold: 1 << 20}
+	if !r.Enabled() {
+		t.Fatal("a socket memory limit alone does not enable the rule")
+	}
+	now := time.Now()
+	var got []string
+	for _, a := range r.Evaluate(now, conns) {
+		if a.Kind != AlertSockMem || a.Metric != MetricSockMem || a.Threshold != 1<<20 {
+			t.Errorf("alert %+v", a)
+		}
+		got = append(got, a.Key+": "+a.Reason)
+	}
+	want := []string{
+		"sockmem||big: socket memory 3.0 MB >= 1.0 MB in 1 socket",
+		"sockmem||leaky: socket memory 1.1 MB >= 1.0 MB in 2 sockets",
+		"sockmem||small: socket memory 2.0 MB >= 1.0 MB in 1 socket",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("alerts\n%q\nwant\n%q", got, want)
+	}
+	if alerts := (AlertRule{}).Evaluate(now, conns); len(alerts) != 0 {
+		t.Errorf("alerts without a limit: %v", alerts)
+	}
+}
+
+func TestGroupSockMem(t *testing.T) {
+	a, b, c := fakeConn("app", "192.0.2.1", 443), fakeConn("app", "192.0.2.2", 443), fakeConn("other", "192.0.2.3", 443)
+	a.setSockMem(&SockMemInfo{RmemAlloc: 1000, WmemQueued: 200, FwdAlloc: 30, WmemAlloc: 200})
+	b.setSockMem(&SockMemInfo{})
+	groups := GroupBy([]*Connection{&a, &b, &c}, GroupByApp)
+	for _, g := range groups {
+		switch g.Key {
+		case "app":
+			if !g.HasSockMem || g.SockMem != 1230 {
+				t.Errorf("app: %d bytes (reported %v)", g.SockMem, g.HasSockMem)
+			}
+		case "other":
+			if g.HasSockMem {
+				t.Error("other: reports socket memory it has no data for")
+			}
+		}
+	}
+	if len(groups) != 2 {
+		t.Errorf("%d groups", len(groups))
+	}
+}
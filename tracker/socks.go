@@ -0,0 +1,282 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProbeProxy routes TCP-connect probes through a SOCKS5 proxy, for networks
+// where direct outbound connections bypass or are blocked by a mandatory
+// proxy. Targets in Bypass, and private, loopback and link-local addresses,
+// are still probed directly.
+type ProbeProxy struct {
+	Addr     string // host:port of the proxy
+	User     string // RFC 1929 username/password auth when User is set
+	Password string
+	Bypass   []netip.Prefix
+}
+
+// ParseProbeProxy parses a socks5://[user:password@]host:port URL.
+func ParseProbeProxy(s string) (*ProbeProxy, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("probe proxy: %v", err)
+	}
+	if u.Scheme != "socks5" {
+		return nil, fmt.Errorf("probe proxy: unsupported scheme %q (want socks5://host:port)", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("probe proxy: %q has no port", s)
+	}
+	p := &ProbeProxy{Addr: u.Host}
+	if u.User != nil {
+		p.User = u.User.Username()
+		p.Password, _ = u.User.Password()
+		if len(p.User) > 255 || len(p.Password) > 255 {
+			return nil, errors.New("probe proxy: username and password are limited to 255 bytes")
+		}
+	}
+	return p, nil
+}
+
+// ParseBypass parses a comma-separated list of CIDR prefixes or addresses
+// to probe directly.
+func ParseBypass(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		p, err := parsePrefix(f)
+		if err != nil {
+			return nil, fmt.Errorf("probe proxy bypass: %v", err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// parsePrefix parses a CIDR prefix, or a single address as a prefix holding
+// only it.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// Bypassed reports whether addr is probed directly: local subnets never go
+// through the proxy, and neither do addresses in Bypass.
+func (p *ProbeProxy) Bypassed(addr string) bool {
+	a, err := netip.ParseAddr(addr)
+	if err != nil {
+		return true
+	}
+	a = a.Unmap()
+	if a.IsPrivate() || a.IsLoopback() || a.IsLinkLocalUnicast() || a.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range p.Bypass {
+		if prefix.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyPing is a probe made through a ProbeProxy, split into its legs.
+type ProxyPing struct {
+	Proxy    string        // host:port of the proxy
+	RTT      time.Duration // connect to the proxy until the CONNECT reply
+	ToProxy  time.Duration // TCP connect to the proxy
+	ToTarget time.Duration // the proxy's connect to the target
+	Loss     float64
+}
+
+// Measure probes addr:port through the proxy pingCount times, like
+// MeasurePing. The to-proxy leg is the TCP connect time to the proxy; the
+// proxy-to-target leg is what remains of the time to the CONNECT reply
+// after the round trips to the proxy, i.e. the proxy's own connect.
+func (p *ProbeProxy) Measure(addr string, port int) ProxyPing {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return ProxyPing{Proxy: p.Addr, Loss: 100}
+	}
+	var total, toProxy time.Duration
+	successful := 0
+	for i := 0; i < pingCount; i++ {
+		deadline := time.Now().Add(pingTimeout)
+		start := time.Now()
+		conn, err := dialProbe(context.Background(), "tcp", p.Addr, pingTimeout)
+		if err != nil {
+			continue
+		}
+		connected := time.Since(start)
+		conn.SetDeadline(deadline)
+		err = socks5Connect(conn, p.User, p.Password, netip.AddrPortFrom(ip.Unmap(), uint16(port)))
+		elapsed := time.Since(start)
+		proxy, _ := conn.RemoteAddr().(*net.TCPAddr)
+		proxyV6 := proxy != nil && proxy.IP.To4() == nil
+		probeMeter.add(socksTraffic(proxyV6, ip.Unmap().Is6(), p.User, p.Password))
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		total += elapsed
+		toProxy += connected
+		successful++
+	}
+	if successful == 0 {
+		return ProxyPing{Proxy: p.Addr, Loss: 100}
+	}
+	r := ProxyPing{
+		Proxy:   p.Addr,
+		RTT:     total / time.Duration(successful),
+		ToProxy: toProxy / time.Duration(successful),
+		Loss:    float64(pingCount-successful) / float64(pingCount) * 100,
+	}
+	// The connect, the greeting and the CONNECT request each cost one
+	// round trip to the proxy, authentication one more.
+	trips := time.Duration(3)
+	if p.User != "" {
+		trips = 4
+	}
+	r.ToTarget = max(0, r.RTT-trips*r.ToProxy)
+	return r
+}
+
+// SOCKS5 protocol constants (RFC 1928, RFC 1929).
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0x00
+	socksUserPass     = 0x02
+	socksNoAcceptable = 0xff
+	socksConnect      = 0x01
+	socksIPv4         = 0x01
+	socksDomain       = 0x03
+	socksIPv6         = 0x04
+)
+
+// socksReplies are the CONNECT failure codes.
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect performs the SOCKS5 greeting, optional username/password
+// authentication and a CONNECT to target on conn. It returns once the proxy
+// has reported the outcome of its connection to target.
+func socks5Connect(conn net.Conn, user, password string, target netip.AddrPort) error {
+	method := byte(socksNoAuth)
+	if user != "" {
+		method = socksUserPass
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("socks5 greeting: version %d", reply[0])
+	}
+	if reply[1] != method {
+		if reply[1] == socksNoAcceptable {
+			return errors.New("socks5: proxy accepts none of our auth methods")
+		}
+		return fmt.Errorf("socks5: proxy chose auth method %d", reply[1])
+	}
+
+	if method == socksUserPass {
+		req := []byte{1, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return fmt.Errorf("socks5 auth: %w", err)
+		}
+		if reply[1] != 0 {
+			return errors.New("socks5: authentication failed")
+		}
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	if target.Addr().Is4() {
+		req = append(req, socksIPv4)
+	} else {
+		req = append(req, socksIPv6)
+	}
+	req = append(req, target.Addr().AsSlice()...)
+	req = binary.BigEndian.AppendUint16(req, target.Port())
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+	if head[0] != socksVersion {
+		return fmt.Errorf("socks5 connect: version %d", head[0])
+	}
+	if head[1] != 0 {
+		if msg, ok := socksReplies[head[1]]; ok {
+			return errors.New("socks5: " + msg)
+		}
+		return fmt.Errorf("socks5: reply code %d", head[1])
+	}
+	// Skip the bound address and port.
+	var n int
+	switch head[3] {
+	case socksIPv4:
+		n = 4
+	case socksIPv6:
+		n = 16
+	case socksDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return fmt.Errorf("socks5 connect: %w", err)
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("socks5 connect: address type %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, n+2)); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+	return nil
+}
+
+// SetProbeProxy routes probes to non-local targets through a SOCKS5 proxy.
+// Must be called before Start.
+func (t *Tracker) SetProbeProxy(p *ProbeProxy) {
+	t.probeProxy = p
+}
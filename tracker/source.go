@@ -0,0 +1,27 @@
+package tracker
+
+import "time"
+
+// Source supplies the sockets a scan sees and the results of ping probes.
+// By default the tracker reads the OS socket tables and probes with TCP
+// connects; -demo injects a synthetic source instead.
+type Source interface {
+	// Scan returns the current sockets, filled in like ScanConnections.
+	Scan() ([]*Connection, error)
+	// Ping probes addr:port like MeasurePing. It is called concurrently.
+	Ping(addr string, port int) (rtt time.Duration, loss float64)
+}
+
+// SetSource replaces the OS socket tables and TCP probes with s. Probes
+// then bypass -probe-proxy. Must be called before Start.
+func (t *Tracker) SetSource(s Source) {
+	t.source = s
+}
+
+// scanSource discovers connections from the injected source or the OS.
+func (t *Tracker) scanSource() ([]*Connection, error) {
+	if t.source != nil {
+		return t.source.Scan()
+	}
+	return ScanConnections()
+}
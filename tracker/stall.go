@@ -0,0 +1,72 @@
+package tracker
+
+import "time"
+
+// TCPInfo is kernel TCP state for a socket, reported by the ss backend.
+// Scanners without access to it leave Connection.TCPInfo nil.
+type TCPInfo struct {
+	SndWnd    uint64 // window advertised by the peer
+	HasSndWnd bool   // SndWnd was reported (older ss versions omit it)
+	RcvSpace  uint64 // receive buffer space the kernel is aiming for
+	NotSent   uint64 // bytes queued locally but not yet sent
+
+	// Retransmitted and sent segments over the socket's life; HasRetrans
+	// is set when ss prints segs_out: (retrans: only once there are any).
+	Retrans    uint64
+	SegsOut    uint64
+	HasRetrans bool
+}
+
+const (
+	// stallConfirmSamples is how many consecutive stalled scans it takes
+	// before a stall is reported; a single sample is not enough.
+	stallConfirmSamples = 2
+	// stallNotSentMin is the unsent backlog treated as a full send buffer.
+	stallNotSentMin = 64 << 10
+)
+
+// stallReason classifies one TCP info sample: "zero window" when the peer
+// advertises no space, "send buffer full" when a large backlog is waiting
+// to be sent, or "" when the socket looks healthy.
+func stallReason(c *Connection) string {
+	info := c.TCPInfo
+	if info == nil || c.State != StateEstablished {
+		return ""
+	}
+	switch {
+	case info.HasSndWnd && info.SndWnd == 0:
+		return "zero window"
+	case info.NotSent >= stallNotSentMin:
+		return "send buffer full"
+	}
+	return ""
+}
+
+// updateStall feeds the latest TCP info sample into the debounced stall
+// state. Caller must hold the tracker lock.
+func (c *Connection) updateStall(now time.Time) {
+	reason := stallReason(c)
+	if reason == "" {
+		c.stallSamples = 0
+		c.StallSince = time.Time{}
+		c.StallReason = ""
+		return
+	}
+	c.stallSamples++
+	if c.stallSamples == 1 {
+		c.stallStart = now
+	}
+	if c.stallSamples >= stallConfirmSamples {
+		c.StallSince = c.stallStart
+		c.StallReason = reason
+	}
+}
+
+// StallDuration is how long the connection has been stalled as of its last
+// update, or zero if it is not.
+func (c *Connection) StallDuration() time.Duration {
+	if c.StallSince.IsZero() {
+		return 0
+	}
+	return c.LastUpdated.Sub(c.StallSince)
+}
@@ -0,0 +1,100 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStallReason(t *testing.T) {
+	tests := []struct {
+		name  string
+		state ConnState
+		info  *TCPInfo
+		want  string
+	}{
+		{"no info", StateEstablished, nil, ""},
+		{"healthy", StateEstablished, &TCPInfo{SndWnd: 65535, HasSndWnd: true, NotSent: 1024}, ""},
+		{"zero window", StateEstablished, &TCPInfo{HasSndWnd: true}, "zero window"},
+		{"window not reported", StateEstablished, &TCPInfo{}, ""},
+		{"backlog", StateEstablished, &TCPInfo{SndWnd: 1, HasSndWnd: true, NotSent: stallNotSentMin}, "send buffer full"},
+		{"backlog just under", StateEstablished, &TCPInfo{NotSent: stallNotSentMin - 1}, ""},
+		{"closing", StateCloseWait, &TCPInfo{HasSndWnd: true}, ""},
+	}
+	for _, tt := range tests {
+		c := &Connection{State: tt.state, TCPInfo: tt.info}
+		if got := stallReason(c); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestStallDebounce feeds TCP info sequences through a scanning tracker.
+func TestStallDebounce(t *testing.T) {
+	zero := &TCPInfo{HasSndWnd: true}
+	full := &TCPInfo{SndWnd: 8192, HasSndWnd: true, NotSent: stallNotSentMin}
+	ok := &TCPInfo{SndWnd: 65535, HasSndWnd: true}
+
+	tests := []struct {
+		name   string
+		seq    []*TCPInfo
+		since  int // scan index the reported stall started at; -1: none
+		reason string
+	}{
+		{"single sample", []*TCPInfo{ok, zero, ok}, -1, ""},
+		{"alternating", []*TCPInfo{zero, ok, zero, ok, zero}, -1, ""},
+		{"confirmed", []*TCPInfo{ok, zero, zero, zero}, 1, "zero window"},
+		{"reason changes", []*TCPInfo{full, zero, zero}, 0, "zero window"},
+		{"recovered", []*TCPInfo{zero, zero, ok}, -1, ""},
+		{"info disappears", []*TCPInfo{zero, zero, nil}, -1, ""},
+	}
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		src := &fakeSource{}
+		tr := NewTracker(time.Second, false)
+		tr.SetSource(src)
+		var now time.Time
+		tr.SetClock(func() time.Time { return now })
+		for i, info := range tt.seq {
+			c := fakeConn("scp", "192.0.2.1", 22)
+			c.TCPInfo = info
+			src.set(c)
+			now = t0.Add(time.Duration(i) * 5 * time.Second)
+			tr.scan()
+		}
+		snap := tr.Snapshot()
+		if len(snap) != 1 {
+			t.Fatalf("%s: %d connections", tt.name, len(snap))
+		}
+		c := snap[0]
+		if tt.since < 0 {
+			if !c.StallSince.IsZero() || c.StallReason != "" || c.StallDuration() != 0 {
+				t.Errorf("%s: stall %q since %v", tt.name, c.StallReason, c.StallSince)
+			}
+			continue
+		}
+		since := t0.Add(time.Duration(tt.since) * 5 * time.Second)
+		if !c.StallSince.Equal(since) || c.StallReason != tt.reason {
+			t.Errorf("%s: stall %q since %v, want %q since %v", tt.name, c.StallReason, c.StallSince, tt.reason, since)
+		}
+		if want := now.Sub(since); c.StallDuration() != want {
+			t.Errorf("%s: duration %v, want %v", tt.name, c.StallDuration(), want)
+		}
+	}
+}
+
+func TestStallAlert(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &Connection{StallSince: t0, StallReason: "zero window", LastUpdated: t0.Add(20 * time.Second)}
+	rule := AlertRule{StallTime: 30 * time.Second}
+	if a := rule.crossing(c); a.Reason != "" {
+		t.Fatalf("alert %q before the stall threshold", a.Reason)
+	}
+	c.LastUpdated = t0.Add(30 * time.Second)
+	a := rule.crossing(c)
+	if a.Metric != MetricStall || a.Value != 30 || a.Reason != "stalled (zero window) for 30s" {
+		t.Fatalf("alert %+v", a)
+	}
+	if err := (AlertRule{StallTime: -time.Second}).Validate(); err == nil {
+		t.Fatal("negative stall threshold accepted")
+	}
+}
@@ -0,0 +1,247 @@
+package tracker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultStateSaveInterval is how often the state file is written while
+// the tracker runs, besides on Stop.
+const DefaultStateSaveInterval = 5 * time.Minute
+
+// stateFileVersion is the layout of the state file itself. Each section
+// carries its own version, so one section from an older or newer build is
+// migrated or dropped without losing the others.
+const stateFileVersion = 1
+
+// State file sections and their current versions.
+const (
+	sectionCalibration  = "calibration"   // per-host ping offsets
+	sectionAppTotals    = "app_totals"    // per-app lifetime totals
+	sectionProbeTraffic = "probe_traffic" // today's probe traffic, for the daily budget
+	sectionHeatmap      = "heatmap"       // dual-stack results by hour of the week
+)
+
+var sectionVersions = map[string]int{
+	sectionCalibration:  1,
+	sectionAppTotals:    1,
+	sectionProbeTraffic: 1,
+	sectionHeatmap:      1,
+}
+
+// stateMigrations upgrade a section's data from the version in the key to
+// the next one. A section older than its current version without a path of
+// migrations is dropped.
+var stateMigrations = map[string]map[int]func(json.RawMessage) (json.RawMessage, error){}
+
+// ErrStateLocked is returned by OpenState when another instance holds the
+// state file.
+var ErrStateLocked = errors.New("state file is in use by another ping-tracker")
+
+type stateFile struct {
+	Version  int                     `json:"version"`
+	Saved    time.Time               `json:"saved"`
+	Sections map[string]stateSection `json:"sections"`
+}
+
+type stateSection struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// calibrationEntry is one host's learned offset in the state file.
+type calibrationEntry struct {
+	Offset time.Duration `json:"offset_ns"`
+	Seen   time.Time     `json:"seen"`
+}
+
+// StateStore is the file the tracker's learned state is kept in between
+// runs: ping calibration offsets, per-app lifetime totals, the day's
+// probe traffic and the hour-of-week heatmap. A lock file
+// next to it keeps a second instance from using it at the same time.
+type StateStore struct {
+	path     string
+	lock     *os.File
+	sections map[string]stateSection // as read at open
+}
+
+// OpenState locks and reads the state file at path. It returns
+// ErrStateLocked, and no store, when another instance holds the lock. A
+// missing file starts empty; a corrupt or too new one is reported but
+// still returns a usable empty store.
+func OpenState(path string) (*StateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	s := &StateStore{path: path, lock: lock, sections: map[string]stateSection{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return s, fmt.Errorf("ignoring corrupt state file: %v", err)
+	}
+	if f.Version != stateFileVersion {
+		return s, fmt.Errorf("ignoring state file version %d (this build reads %d)", f.Version, stateFileVersion)
+	}
+	if f.Sections != nil {
+		s.sections = f.Sections
+	}
+	return s, nil
+}
+
+// Close releases the lock.
+func (s *StateStore) Close() error {
+	return s.lock.Close()
+}
+
+// section returns the data of a section at its current version, migrating
+// older data. ok is false when the section is absent.
+func (s *StateStore) section(name string) (data json.RawMessage, ok bool, err error) {
+	sec, ok := s.sections[name]
+	if !ok {
+		return nil, false, nil
+	}
+	want := sectionVersions[name]
+	if sec.Version > want {
+		return nil, true, fmt.Errorf("state %s: dropping version %d (this build reads %d)", name, sec.Version, want)
+	}
+	data = sec.Data
+	for v := sec.Version; v < want; v++ {
+		migrate := stateMigrations[name][v]
+		if migrate == nil {
+			return nil, true, fmt.Errorf("state %s: dropping version %d (no migration to %d)", name, sec.Version, want)
+		}
+		if data, err = migrate(data); err != nil {
+			return nil, true, fmt.Errorf("state %s: dropping version %d: %v", name, sec.Version, err)
+		}
+	}
+	return data, true, nil
+}
+
+// save writes the sections atomically, like KnownHosts.Save. A
+// stateSection value is written as is, keeping its version.
+func (s *StateStore) save(sections map[string]any, now time.Time) error {
+	f := stateFile{Version: stateFileVersion, Saved: now, Sections: make(map[string]stateSection, len(sections))}
+	for name, v := range sections {
+		if sec, ok := v.(stateSection); ok {
+			f.Sections[name] = sec
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		f.Sections[name] = stateSection{Version: sectionVersions[name], Data: data}
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SetStateStore restores the state saved in s and keeps it up to date:
+// every interval while running, and on Stop. A section that cannot be read
+// is dropped and reported in the returned error; the others still load.
+// Must be called before Start, after SetPingCorrection.
+func (t *Tracker) SetStateStore(s *StateStore, interval time.Duration) error {
+	t.state = s
+	t.stateInterval = interval
+	t.lastStateSave = time.Now()
+
+	var errs []error
+	if data, ok, err := s.section(sectionCalibration); err != nil {
+		errs = append(errs, err)
+	} else if ok && t.calibration != nil {
+		var offsets map[string]calibrationEntry
+		if err := json.Unmarshal(data, &offsets); err != nil {
+			errs = append(errs, fmt.Errorf("state %s: %v", sectionCalibration, err))
+		} else {
+			for host, e := range offsets {
+				t.calibration.offsets[host] = hostOffset{offset: e.Offset, seen: e.Seen}
+			}
+			t.calibration.Prune(time.Now())
+		}
+	}
+	if data, ok, err := s.section(sectionAppTotals); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		var totals map[string]*AppTotals
+		if err := json.Unmarshal(data, &totals); err != nil {
+			errs = append(errs, fmt.Errorf("state %s: %v", sectionAppTotals, err))
+		} else {
+			for app, a := range totals {
+				if a != nil {
+					t.appTotals[app] = a
+				}
+			}
+			t.pruneAppTotals()
+		}
+	}
+	if data, ok, err := s.section(sectionProbeTraffic); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		var saved probeTrafficState
+		if err := json.Unmarshal(data, &saved); err != nil {
+			errs = append(errs, fmt.Errorf("state %s: %v", sectionProbeTraffic, err))
+		} else {
+			probeMeter.restore(saved)
+		}
+	}
+	if data, ok, err := s.section(sectionHeatmap); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		var saved map[string]heatSeries
+		if err := json.Unmarshal(data, &saved); err != nil {
+			errs = append(errs, fmt.Errorf("state %s: %v", sectionHeatmap, err))
+		} else {
+			t.heatmap.restore(saved, time.Now())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// saveState writes the state file. Caller must not hold the lock.
+func (t *Tracker) saveState(now time.Time) error {
+	t.mu.Lock()
+	t.pruneAppTotals()
+	sections := map[string]any{}
+	if t.calibration != nil {
+		offsets := make(map[string]calibrationEntry, len(t.calibration.offsets))
+		for host, o := range t.calibration.offsets {
+			offsets[host] = calibrationEntry{Offset: o.offset, Seen: o.seen}
+		}
+		sections[sectionCalibration] = offsets
+	} else if sec, ok := t.state.sections[sectionCalibration]; ok {
+		// Keep what was learned with correction on for the next run that uses it.
+		sections[sectionCalibration] = sec
+	}
+	totals := make(map[string]AppTotals, len(t.appTotals))
+	for app, a := range t.appTotals {
+		totals[app] = *a
+	}
+	sections[sectionAppTotals] = totals
+	t.mu.Unlock()
+	u := probeMeter.snapshot()
+	sections[sectionProbeTraffic] = probeTrafficState{Day: u.Day, Today: u.Today, ExceededAt: u.ExceededAt}
+	sections[sectionHeatmap] = t.heatmap.state(now)
+	return t.state.save(sections, now)
+}
@@ -0,0 +1,178 @@
+package tracker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestState(t *testing.T, path string) *StateStore {
+	t.Helper()
+	s, err := OpenState(path)
+	if s == nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func writeState(t *testing.T, path string, f stateFile) {
+	t.Helper()
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+
+	s := openTestState(t, path)
+	tr := NewTracker(time.Hour, false)
+	if err := tr.SetStateStore(s, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	src := &fakeSource{}
+	tr.SetSource(src)
+	c := fakeConn("firefox", "93.184.216.34", 443)
+	c.HasByteCounts, c.TxBytes, c.RxBytes = true, 1000, 50000
+	src.set(c)
+	tr.scan()
+	src.set()
+	tr.scan() // closes it into the lifetime totals
+	tr.calibration.offsets["93.184.216.34"] = hostOffset{offset: 3 * time.Millisecond, seen: now}
+	if err := tr.saveState(now); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openTestState(t, path)
+	next := NewTracker(time.Hour, false)
+	if err := next.SetStateStore(s, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	a, ok := next.AppLifetime("firefox")
+	if !ok || a.TxBytes != 1000 || a.RxBytes != 50000 || a.Conns != 1 {
+		t.Errorf("lifetime totals after restart: %+v (found %v)", a, ok)
+	}
+	if o := next.calibration.offsets["93.184.216.34"]; o.offset != 3*time.Millisecond {
+		t.Errorf("calibration offset after restart: %v", o.offset)
+	}
+}
+
+func TestStateCorrupt(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"garbage", "{not json", "corrupt state file"},
+		{"truncated", `{"version":1,"sections":{"app_totals":{"version":1,"data":{"fire`, "corrupt state file"},
+		{"newer file", `{"version":99,"sections":{}}`, "ignoring state file version 99"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		os.WriteFile(path, []byte(tt.data), 0o600)
+		s, err := OpenState(path)
+		if s == nil || err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%s: store %v, error %v", tt.name, s, err)
+		}
+		// The store still works, and the next save replaces the bad file.
+		tr := NewTracker(time.Hour, false)
+		if err := tr.SetStateStore(s, time.Minute); err != nil {
+			t.Errorf("%s: empty store: %v", tt.name, err)
+		}
+		if err := tr.saveState(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		if s, err := OpenState(path); err != nil {
+			t.Errorf("%s: file still bad after saving: %v", tt.name, err)
+		} else {
+			s.Close()
+		}
+	}
+}
+
+// TestStateSections checks that a bad section is dropped on its own and
+// the others still load.
+func TestStateSections(t *testing.T) {
+	totals := json.RawMessage(`{"curl":{"tx_bytes":7,"rx_bytes":9,"conns":2}}`)
+	tests := []struct {
+		name    string
+		section stateSection
+		want    string
+	}{
+		{"newer", stateSection{Version: 5, Data: json.RawMessage(`{}`)}, "dropping version 5 (this build reads 1)"},
+		{"older", stateSection{Version: 0, Data: json.RawMessage(`{}`)}, "dropping version 0 (no migration to 1)"},
+		{"wrong shape", stateSection{Version: 1, Data: json.RawMessage(`[1,2,3]`)}, "state calibration:"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		writeState(t, path, stateFile{Version: stateFileVersion, Sections: map[string]stateSection{
+			sectionCalibration: tt.section,
+			sectionAppTotals:   {Version: 1, Data: totals},
+		}})
+		tr := NewTracker(time.Hour, false)
+		err := tr.SetStateStore(openTestState(t, path), time.Minute)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+		if a, ok := tr.AppLifetime("curl"); !ok || a.Conns != 2 {
+			t.Errorf("%s: app totals not loaded beside the bad section: %+v", tt.name, a)
+		}
+	}
+}
+
+func TestStateMigration(t *testing.T) {
+	old := stateMigrations[sectionAppTotals]
+	t.Cleanup(func() { stateMigrations[sectionAppTotals] = old })
+	// Version 0 kept only a connection count per app.
+	stateMigrations[sectionAppTotals] = map[int]func(json.RawMessage) (json.RawMessage, error){
+		0: func(data json.RawMessage) (json.RawMessage, error) {
+			var counts map[string]int
+			if err := json.Unmarshal(data, &counts); err != nil {
+				return nil, err
+			}
+			totals := make(map[string]AppTotals, len(counts))
+			for app, n := range counts {
+				totals[app] = AppTotals{Conns: n}
+			}
+			return json.Marshal(totals)
+		},
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	writeState(t, path, stateFile{Version: stateFileVersion, Sections: map[string]stateSection{
+		sectionAppTotals: {Version: 0, Data: json.RawMessage(`{"sshd":4}`)},
+	}})
+	tr := NewTracker(time.Hour, false)
+	if err := tr.SetStateStore(openTestState(t, path), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := tr.AppLifetime("sshd"); !ok || a.Conns != 4 {
+		t.Errorf("migrated totals: %+v", a)
+	}
+}
+
+func TestStateLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := OpenState(path); !errors.Is(err, ErrStateLocked) || second != nil {
+		t.Fatalf("second instance: store %v, error %v", second, err)
+	}
+	s.Close()
+	s, err = OpenState(path)
+	if err != nil {
+		t.Fatalf("after the first closed: %v", err)
+	}
+	s.Close()
+}
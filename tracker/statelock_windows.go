@@ -0,0 +1,28 @@
+package tracker
+
+import (
+	"os"
+	"syscall"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION.
+const errSharingViolation syscall.Errno = 32
+
+// lockFile opens path, creating it, without sharing it, so a second open
+// fails until the handle is closed. Windows closes it when the process
+// exits, so a crash never leaves a stale lock behind.
+func lockFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errSharingViolation {
+			return nil, ErrStateLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
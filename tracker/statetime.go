@@ -0,0 +1,88 @@
+package tracker
+
+import (
+	"fmt"
+	"time"
+)
+
+// StuckThresholds is how long a connection may stay in a TCP state before
+// it counts as stuck. States without an entry never do.
+type StuckThresholds map[ConnState]time.Duration
+
+// DefaultStuckThresholds flags handshakes that never complete and closes the
+// local app never finishes. TIME_WAIT is left out: the kernel expires it.
+var DefaultStuckThresholds = StuckThresholds{
+	StateSynSent:   30 * time.Second,
+	StateSynRecv:   30 * time.Second,
+	StateCloseWait: 5 * time.Minute,
+	StateFinWait1:  time.Minute,
+	StateFinWait2:  5 * time.Minute,
+	StateLastAck:   time.Minute,
+	StateClosing:   time.Minute,
+}
+
+// ParseStuckThresholds overrides the defaults with durations by state name,
+// e.g. {"CLOSE_WAIT": "10m"}; "0" turns a state off.
+func ParseStuckThresholds(overrides map[string]string) (StuckThresholds, error) {
+	th := make(StuckThresholds, len(DefaultStuckThresholds))
+	for s, d := range DefaultStuckThresholds {
+		th[s] = d
+	}
+	for name, v := range overrides {
+		state := ConnState(name)
+		if !tcpStates[state] {
+			return nil, fmt.Errorf("stuck_states: unknown state %q", name)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("stuck_states: invalid duration %q for %s", v, name)
+		}
+		if d == 0 {
+			delete(th, state)
+			continue
+		}
+		th[state] = d
+	}
+	return th, nil
+}
+
+// tcpStates are the states a stuck threshold can be set for.
+var tcpStates = map[ConnState]bool{
+	StateEstablished: true, StateListening: true, StateTimeWait: true, StateCloseWait: true,
+	StateSynSent: true, StateSynRecv: true, StateFinWait1: true, StateFinWait2: true,
+	StateLastAck: true, StateClosing: true, StateClosed: true,
+}
+
+// Stuck reports whether c has been in its state longer than allowed.
+func (th StuckThresholds) Stuck(c *Connection) bool {
+	limit, ok := th[c.State]
+	return ok && !c.StateSince.IsZero() && c.TimeInState() >= limit
+}
+
+// TimeInState is how long the connection has been in its current state as
+// of its last scan. When StateSinceExact is false the connection was already
+// in this state when tracking started, so this is a lower bound.
+func (c *Connection) TimeInState() time.Duration {
+	if c.StateSince.IsZero() {
+		return 0
+	}
+	return c.LastUpdated.Sub(c.StateSince)
+}
+
+// noteState stamps a state change seen in a scan. exact is false for
+// connections found in the first scan, whose state began before we looked.
+func (c *Connection) noteState(state ConnState, now time.Time, exact bool) {
+	if c.StateSince.IsZero() || c.State != state {
+		c.StateSince = now
+		c.StateSinceExact = exact
+	}
+	c.State = state
+}
+
+// SetStuckThresholds sets how long each state may last before a connection
+// is flagged as stuck. It is safe to call while the tracker is running.
+func (t *Tracker) SetStuckThresholds(th StuckThresholds) {
+	t.mu.Lock()
+	t.stuck = th
+	t.mu.Unlock()
+}
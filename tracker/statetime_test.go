@@ -0,0 +1,123 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStuckThresholds(t *testing.T) {
+	th, err := ParseStuckThresholds(map[string]string{"CLOSE_WAIT": "10m", "SYN_SENT": "0", "ESTABLISHED": "24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th[StateCloseWait] != 10*time.Minute || th[StateEstablished] != 24*time.Hour || th[StateFinWait1] != time.Minute {
+		t.Errorf("thresholds %v", th)
+	}
+	if _, ok := th[StateSynSent]; ok {
+		t.Error("0 did not turn SYN_SENT off")
+	}
+	if DefaultStuckThresholds[StateSynSent] != 30*time.Second {
+		t.Error("overrides changed the defaults")
+	}
+	for _, bad := range []map[string]string{{"SYN_WAIT": "1m"}, {"CLOSE_WAIT": "soon"}, {"CLOSE_WAIT": "-1m"}} {
+		if _, err := ParseStuckThresholds(bad); err == nil {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+}
+
+func TestStuck(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		state ConnState
+		in    time.Duration
+		want  bool
+	}{
+		{StateSynSent, 29 * time.Second, false},
+		{StateSynSent, 30 * time.Second, true},
+		{StateCloseWait, 4 * time.Minute, false},
+		{StateCloseWait, 48 * time.Minute, true},
+		{StateEstablished, 72 * time.Hour, false},
+		{StateTimeWait, time.Hour, false},
+	}
+	for _, tt := range tests {
+		c := &Connection{State: tt.state, StateSince: t0, LastUpdated: t0.Add(tt.in)}
+		if got := DefaultStuckThresholds.Stuck(c); got != tt.want {
+			t.Errorf("%s for %v: stuck %v", tt.state, tt.in, got)
+		}
+	}
+	if DefaultStuckThresholds.Stuck(&Connection{State: StateSynSent, LastUpdated: t0}) {
+		t.Error("stuck without a state timestamp")
+	}
+}
+
+// TestStateTimestamps follows connections through scans: the first scan's
+// sockets get a lower bound, later ones an exact time, and only a change
+// of state moves the timestamp.
+func TestStateTimestamps(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := t0
+	src := &fakeSource{}
+	old := fakeConn("app", "192.0.2.1", 443)
+	old.State = StateCloseWait
+	src.set(old)
+	tr := NewTracker(time.Second, false)
+	tr.SetSource(src)
+	tr.SetClock(func() time.Time { return now })
+	step := func(d time.Duration, conns ...Connection) {
+		now = now.Add(d)
+		src.set(conns...)
+		tr.scan()
+	}
+	byApp := func(app string) *Connection {
+		for _, c := range tr.Snapshot() {
+			if c.AppName == app {
+				return c
+			}
+		}
+		t.Fatalf("no %s connection", app)
+		return nil
+	}
+
+	tr.scan()
+	c := byApp("app")
+	if c.StateSinceExact || !c.StateSince.Equal(t0) {
+		t.Fatalf("first scan: since %v, exact %v", c.StateSince, c.StateSinceExact)
+	}
+	step(6*time.Minute, old)
+	if c = byApp("app"); !c.Stuck || c.TimeInState() != 6*time.Minute || c.StateSinceExact {
+		t.Fatalf("after 6m: stuck %v, %v in state", c.Stuck, c.TimeInState())
+	}
+	if got := FilterConnections(tr.Snapshot(), "stuck:yes"); len(got) != 1 {
+		t.Errorf("stuck:yes matched %d", len(got))
+	}
+
+	dialing := fakeConn("dialer", "192.0.2.2", 22)
+	dialing.State = StateSynSent
+	step(time.Second, old, dialing)
+	d := byApp("dialer")
+	if !d.StateSinceExact || !d.StateSince.Equal(now) || d.Stuck {
+		t.Fatalf("new connection: since %v, exact %v", d.StateSince, d.StateSinceExact)
+	}
+	step(30*time.Second, old, dialing)
+	if d = byApp("dialer"); !d.Stuck {
+		t.Fatalf("SYN_SENT for %v not stuck", d.TimeInState())
+	}
+
+	// The handshake completes: a new state, timed from this scan.
+	dialing.State = StateEstablished
+	step(time.Second, old, dialing)
+	if d = byApp("dialer"); d.Stuck || !d.StateSince.Equal(now) || !d.StateSinceExact || d.TimeInState() != 0 {
+		t.Fatalf("after the state change: stuck %v, since %v", d.Stuck, d.StateSince)
+	}
+	if got := FilterConnections(tr.Snapshot(), "stuck:no"); len(got) != 1 || got[0].AppName != "dialer" {
+		t.Errorf("stuck:no matched %d", len(got))
+	}
+
+	// Thresholds apply live.
+	tr.SetStuckThresholds(StuckThresholds{StateEstablished: time.Second})
+	step(2*time.Second, old, dialing)
+	if !byApp("dialer").Stuck || byApp("app").Stuck {
+		t.Error("new thresholds not applied")
+	}
+}
@@ -0,0 +1,214 @@
+package tracker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// STUN (RFC 5389) binding requests: just enough to learn the address and
+// port a server sees a UDP socket as.
+const (
+	stunBindingRequest = 0x0001
+	stunBindingSuccess = 0x0101
+	stunBindingError   = 0x0111
+	stunMagicCookie    = 0x2112A442
+	stunHeaderBytes    = 20
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXorMappedAddress = 0x0020
+
+	stunFamilyIPv4 = 0x01
+	stunFamilyIPv6 = 0x02
+
+	// stunRetransmit is the wait before a request is sent again; a lookup
+	// gives up at its context's deadline.
+	stunRetransmit = 500 * time.Millisecond
+	stunMaxSends   = 4
+	udpHeaderBytes = 8
+)
+
+// DefaultSTUNServer is asked for the public address when stun_server is
+// not set.
+const DefaultSTUNServer = "stun.l.google.com:19302"
+
+var errNotSTUN = errors.New("not a STUN response")
+
+// stunTxID is a binding request's transaction ID.
+type stunTxID [12]byte
+
+func newSTUNTxID() stunTxID {
+	var id stunTxID
+	rand.Read(id[:])
+	return id
+}
+
+// stunRequest encodes a binding request with no attributes.
+func stunRequest(id stunTxID) []byte {
+	b := make([]byte, stunHeaderBytes)
+	binary.BigEndian.PutUint16(b[0:], stunBindingRequest)
+	binary.BigEndian.PutUint16(b[2:], 0)
+	binary.BigEndian.PutUint32(b[4:], stunMagicCookie)
+	copy(b[8:], id[:])
+	return b
+}
+
+// parseSTUNResponse decodes the binding response to request id and returns
+// the mapped address, preferring XOR-MAPPED-ADDRESS over the older
+// MAPPED-ADDRESS. errNotSTUN means b is not a response to id, which a
+// caller reading a socket skips.
+func parseSTUNResponse(b []byte, id stunTxID) (netip.AddrPort, error) {
+	if len(b) < stunHeaderBytes || b[0]&0xc0 != 0 ||
+		binary.BigEndian.Uint32(b[4:]) != stunMagicCookie || stunTxID(b[8:20]) != id {
+		return netip.AddrPort{}, errNotSTUN
+	}
+	typ := binary.BigEndian.Uint16(b[0:])
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length%4 != 0 || stunHeaderBytes+length > len(b) {
+		return netip.AddrPort{}, fmt.Errorf("STUN message length %d does not fit %d bytes", length, len(b))
+	}
+	switch typ {
+	case stunBindingSuccess:
+	case stunBindingError:
+		return netip.AddrPort{}, errors.New("STUN server returned an error")
+	default:
+		return netip.AddrPort{}, errNotSTUN
+	}
+	var mapped netip.AddrPort
+	attrs := b[stunHeaderBytes : stunHeaderBytes+length]
+	for len(attrs) >= 4 {
+		at := binary.BigEndian.Uint16(attrs[0:])
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+n > len(attrs) {
+			return netip.AddrPort{}, fmt.Errorf("STUN attribute 0x%04x overruns the message", at)
+		}
+		value := attrs[4 : 4+n]
+		switch at {
+		case stunAttrXorMappedAddress:
+			return decodeSTUNAddr(value, b[4:20])
+		case stunAttrMappedAddress:
+			if a, err := decodeSTUNAddr(value, nil); err == nil {
+				mapped = a
+			}
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		attrs = attrs[min(len(attrs), 4+(n+3)&^3):]
+	}
+	if !mapped.IsValid() {
+		return netip.AddrPort{}, errors.New("STUN response has no mapped address")
+	}
+	return mapped, nil
+}
+
+// decodeSTUNAddr decodes a (XOR-)MAPPED-ADDRESS value. xor is the magic
+// cookie and transaction ID the address is XORed with, nil for
+// MAPPED-ADDRESS.
+func decodeSTUNAddr(v, xor []byte) (netip.AddrPort, error) {
+	if len(v) < 4 {
+		return netip.AddrPort{}, errors.New("short STUN address")
+	}
+	family := v[1]
+	port := binary.BigEndian.Uint16(v[2:])
+	raw := v[4:]
+	var size int
+	switch family {
+	case stunFamilyIPv4:
+		size = 4
+	case stunFamilyIPv6:
+		size = 16
+	default:
+		return netip.AddrPort{}, fmt.Errorf("unknown STUN address family %d", family)
+	}
+	if len(raw) < size {
+		return netip.AddrPort{}, errors.New("short STUN address")
+	}
+	ip := make([]byte, size)
+	copy(ip, raw[:size])
+	if xor != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return netip.AddrPortFrom(addr, port), nil
+}
+
+// stunTraffic estimates one binding request sent, and its response if one
+// came (an XOR-MAPPED-ADDRESS and a little more, such as a SOFTWARE
+// attribute).
+func stunTraffic(v6, replied bool) ProbeTraffic {
+	head := ipHeaderBytes(v6) + udpHeaderBytes
+	p := ProbeTraffic{Sent: head + stunHeaderBytes}
+	if replied {
+		p.Received = head + stunHeaderBytes + 48
+	}
+	return p
+}
+
+// stunBinding asks server what address conn's packets come from, sending
+// the request again every stunRetransmit until ctx ends. Each request
+// counts as probe traffic.
+func stunBinding(ctx context.Context, conn net.PacketConn, server netip.AddrPort) (netip.AddrPort, error) {
+	id := newSTUNTxID()
+	req := stunRequest(id)
+	to := net.UDPAddrFromAddrPort(server)
+	v6 := server.Addr().Is6()
+	buf := make([]byte, 1500)
+	for sends := 0; sends < stunMaxSends; sends++ {
+		if !probeMeter.allowed() {
+			return netip.AddrPort{}, ErrProbeBudget
+		}
+		if _, err := conn.WriteTo(req, to); err != nil {
+			return netip.AddrPort{}, err
+		}
+		wait := time.Now().Add(stunRetransmit << sends)
+		if d, ok := ctx.Deadline(); ok && d.Before(wait) {
+			wait = d
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if err := ctxExpired(ctx); err != nil {
+					probeMeter.add(stunTraffic(v6, false))
+					return netip.AddrPort{}, err
+				}
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				probeMeter.add(stunTraffic(v6, false))
+				return netip.AddrPort{}, err
+			}
+			mapped, err := parseSTUNResponse(buf[:n], id)
+			if errors.Is(err, errNotSTUN) {
+				continue
+			}
+			probeMeter.add(stunTraffic(v6, true))
+			return mapped, err
+		}
+		probeMeter.add(stunTraffic(v6, false))
+		if err := ctxExpired(ctx); err != nil {
+			return netip.AddrPort{}, err
+		}
+	}
+	return netip.AddrPort{}, fmt.Errorf("no STUN response from %s", server)
+}
+
+// ctxExpired is ctx.Err, counting ctx as expired from its deadline on: a
+// read deadline set to it can pass before ctx's own timer marks it done.
+func ctxExpired(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testdata/stun holds the sample responses of RFC 5769, sections 2.2 and
+// 2.3, to transaction rfc5769TxID.
+var rfc5769TxID = stunTxID{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+
+// stunAttr encodes an attribute with its padding.
+func stunAttr(typ uint16, value []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, (4-len(value)%4)%4)...)
+}
+
+// stunMessage encodes a message of type typ to id with attrs.
+func stunMessage(typ uint16, id stunTxID, attrs ...[]byte) []byte {
+	body := bytes.Join(attrs, nil)
+	b := binary.BigEndian.AppendUint16(nil, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	b = binary.BigEndian.AppendUint32(b, stunMagicCookie)
+	b = append(b, id[:]...)
+	return append(b, body...)
+}
+
+// stunAddrValue encodes a as a (XOR-)MAPPED-ADDRESS value, XORed with id
+// when xor is set.
+func stunAddrValue(a netip.AddrPort, id stunTxID, xor bool) []byte {
+	family, ip := byte(stunFamilyIPv4), a.Addr().AsSlice()
+	if a.Addr().Is6() {
+		family = stunFamilyIPv6
+	}
+	port := a.Port()
+	if xor {
+		key := append(binary.BigEndian.AppendUint32(nil, stunMagicCookie), id[:]...)
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return append(binary.BigEndian.AppendUint16([]byte{0, family}, port), ip...)
+}
+
+func TestSTUNRequest(t *testing.T) {
+	id := stunTxID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	want := []byte{0, 1, 0, 0, 0x21, 0x12, 0xa4, 0x42, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if got := stunRequest(id); !bytes.Equal(got, want) {
+		t.Errorf("request % x", got)
+	}
+	if newSTUNTxID() == newSTUNTxID() {
+		t.Error("transaction IDs repeat")
+	}
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	id := stunTxID{9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9}
+	v4 := netip.MustParseAddrPort("203.0.113.7:50000")
+	v6 := netip.MustParseAddrPort("[2001:db8::7]:443")
+	xor := stunAttr(stunAttrXorMappedAddress, stunAddrValue(v4, id, true))
+	plain := stunAttr(stunAttrMappedAddress, stunAddrValue(v6, id, false))
+	software := stunAttr(0x8022, []byte("pion"))
+	truncated := stunMessage(stunBindingSuccess, id, xor)
+	binary.BigEndian.PutUint16(truncated[2:], 16)
+	overrun := stunMessage(stunBindingSuccess, id, xor)
+	binary.BigEndian.PutUint16(overrun[22:], 12)
+
+	tests := []struct {
+		name string
+		b    []byte
+		id   stunTxID
+		want string
+		err  string
+	}{
+		{"RFC 5769 IPv4", readPacket(t, "stun/rfc5769_ipv4.bin"), rfc5769TxID, "192.0.2.1:32853", ""},
+		{"RFC 5769 IPv6", readPacket(t, "stun/rfc5769_ipv6.bin"), rfc5769TxID, "[2001:db8:1234:5678:11:2233:4455:6677]:32853", ""},
+		{"XOR-MAPPED-ADDRESS", stunMessage(stunBindingSuccess, id, software, xor), id, "203.0.113.7:50000", ""},
+		{"MAPPED-ADDRESS only", stunMessage(stunBindingSuccess, id, plain), id, "[2001:db8::7]:443", ""},
+		{"XOR preferred", stunMessage(stunBindingSuccess, id, plain, xor), id, "203.0.113.7:50000", ""},
+		{"bad MAPPED-ADDRESS skipped", stunMessage(stunBindingSuccess, id, stunAttr(stunAttrMappedAddress, []byte{0, 3, 0, 1}), plain), id, "[2001:db8::7]:443", ""},
+		{"trailing bytes", append(stunMessage(stunBindingSuccess, id, xor), 0xff), id, "203.0.113.7:50000", ""},
+
+		{"other transaction", readPacket(t, "stun/rfc5769_ipv4.bin"), id, "", errNotSTUN.Error()},
+		{"request", stunRequest(id), id, "", errNotSTUN.Error()},
+		{"RTP", append([]byte{0x80}, stunRequest(id)[1:]...), id, "", errNotSTUN.Error()},
+		{"no cookie", append(stunRequest(id)[:4], append([]byte{0, 0, 0, 0}, id[:]...)...), id, "", errNotSTUN.Error()},
+		{"short", stunRequest(id)[:19], id, "", errNotSTUN.Error()},
+		{"error response", stunMessage(stunBindingError, id, stunAttr(0x0009, []byte{0, 0, 4, 0})), id, "", "STUN server returned an error"},
+		{"no address", stunMessage(stunBindingSuccess, id, software), id, "", "STUN response has no mapped address"},
+		{"length past the end", truncated, id, "", "STUN message length 16 does not fit"},
+		{"odd length", func() []byte {
+			b := stunMessage(stunBindingSuccess, id, xor)
+			binary.BigEndian.PutUint16(b[2:], 6)
+			return b
+		}(), id, "", "STUN message length 6"},
+		{"attribute overrun", overrun, id, "", "STUN attribute 0x0020 overruns the message"},
+		{"unknown family", stunMessage(stunBindingSuccess, id, stunAttr(stunAttrXorMappedAddress, []byte{0, 3, 0, 1, 1, 2, 3, 4})), id, "", "unknown STUN address family 3"},
+		{"short IPv6", stunMessage(stunBindingSuccess, id, stunAttr(stunAttrXorMappedAddress, []byte{0, 2, 0, 1, 1, 2, 3, 4})), id, "", "short STUN address"},
+		{"short header", stunMessage(stunBindingSuccess, id, stunAttr(stunAttrXorMappedAddress, []byte{0, 1})), id, "", "short STUN address"},
+	}
+	for _, tt := range tests {
+		got, err := parseSTUNResponse(tt.b, tt.id)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%s: %v %v, want error %s", tt.name, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s: %v %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := parseSTUNResponse(stunRequest(id), id); !errors.Is(err, errNotSTUN) {
+		t.Errorf("request: %v is not errNotSTUN", err)
+	}
+}
+
+// stunServer answers binding requests on loopback with the sender's
+// address, after a packet that is not STUN, and drops the first drop
+// requests it gets.
+func stunServer(t *testing.T, drop int) netip.AddrPort {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n != stunHeaderBytes || binary.BigEndian.Uint16(buf) != stunBindingRequest {
+				continue
+			}
+			if drop > 0 {
+				drop--
+				continue
+			}
+			id := stunTxID(buf[8:20])
+			conn.WriteTo([]byte("not stun"), from)
+			conn.WriteTo(stunMessage(stunBindingSuccess, stunTxID{}, stunAttr(stunAttrXorMappedAddress, make([]byte, 8))), from)
+			mapped := from.(*net.UDPAddr).AddrPort()
+			conn.WriteTo(stunMessage(stunBindingSuccess, id, stunAttr(stunAttrXorMappedAddress, stunAddrValue(mapped, id, true))), from)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+func TestSTUNBinding(t *testing.T) {
+	for _, drop := range []int{0, 1} {
+		server := stunServer(t, drop)
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		before := probeMeter.snapshot().Session
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		got, err := stunBinding(ctx, conn, server)
+		cancel()
+		if want := conn.LocalAddr().(*net.UDPAddr).AddrPort(); err != nil || got != want {
+			t.Errorf("%d dropped: %v %v, want %v", drop, got, err, want)
+		}
+		// One request per send, and the response.
+		sent := probeMeter.snapshot().Session.Sent - before.Sent
+		if want := uint64(drop+1) * stunTraffic(false, true).Sent; sent != want {
+			t.Errorf("%d dropped: %d bytes sent accounted, want %d", drop, sent, want)
+		}
+	}
+}
+
+func TestSTUNBindingTimeout(t *testing.T) {
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = stunBinding(ctx, conn, silent.LocalAddr().(*net.UDPAddr).AddrPort())
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Errorf("error %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,86 @@
+package tracker
+
+import (
+	"sort"
+	"time"
+)
+
+// PingTier decides how often a connection is probed.
+type PingTier int
+
+const (
+	TierFocused    PingTier = iota // matches the active filter or is a top talker: every cycle
+	TierNormal                     // every 3rd cycle
+	TierBackground                 // idle for a while: every 10th cycle
+)
+
+const (
+	// focusTopN connections by throughput are always focused.
+	focusTopN = 10
+
+	// idleAfter without traffic moves a connection to the background tier.
+	idleAfter = 5 * time.Minute
+)
+
+// String returns the tier name.
+func (t PingTier) String() string {
+	switch t {
+	case TierFocused:
+		return "focused"
+	case TierBackground:
+		return "background"
+	default:
+		return "normal"
+	}
+}
+
+// Every returns how many scan cycles pass between probes in this tier.
+func (t PingTier) Every() int {
+	switch t {
+	case TierFocused:
+		return 1
+	case TierBackground:
+		return 10
+	default:
+		return 3
+	}
+}
+
+// AssignTiers assigns a ping tier to every connection, keyed by Key().
+// Connections matching query (Search syntax, empty = none) and the top
+// talkers by throughput are focused; connections without traffic for
+// idleAfter are background; everything else is normal.
+func AssignTiers(conns []*Connection, query string, now time.Time) map[string]PingTier {
+	tiers := make(map[string]PingTier, len(conns))
+
+	byRate := make([]*Connection, 0, len(conns))
+	for _, c := range conns {
+		if c.TxRate+c.RxRate > 0 {
+			byRate = append(byRate, c)
+		}
+	}
+	sort.Slice(byRate, func(i, j int) bool {
+		return byRate[i].TxRate+byRate[i].RxRate > byRate[j].TxRate+byRate[j].RxRate
+	})
+	top := make(map[*Connection]bool, focusTopN)
+	for i := 0; i < len(byRate) && i < focusTopN; i++ {
+		top[byRate[i]] = true
+	}
+
+	var terms []queryTerm
+	if query != "" {
+		terms = parseQuery(query)
+	}
+
+	for _, c := range conns {
+		switch {
+		case top[c] || (terms != nil && matchAll(c, terms)):
+			tiers[c.Key()] = TierFocused
+		case !c.LastActive.IsZero() && now.Sub(c.LastActive) >= idleAfter:
+			tiers[c.Key()] = TierBackground
+		default:
+			tiers[c.Key()] = TierNormal
+		}
+	}
+	return tiers
+}
@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAssignTiers(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var conns []*Connection
+	// Twelve talkers: the ten fastest are focused.
+	for i := range 12 {
+		conns = append(conns, &Connection{AppName: fmt.Sprintf("talker%d", i), RemotePort: 1000 + i,
+			RxRate: float64(100 * (i + 1)), LastActive: now})
+	}
+	watched := &Connection{AppName: "ssh", RemotePort: 22, LastActive: now.Add(-time.Hour)}
+	idle := &Connection{AppName: "idle", RemotePort: 5432, LastActive: now.Add(-idleAfter)}
+	quiet := &Connection{AppName: "quiet", RemotePort: 5433, LastActive: now.Add(-time.Minute)}
+	unknown := &Connection{AppName: "new", RemotePort: 5434}
+	conns = append(conns, watched, idle, quiet, unknown)
+
+	tiers := AssignTiers(conns, "ssh", now)
+	want := map[*Connection]PingTier{
+		conns[0]:  TierNormal, // slowest two talkers
+		conns[1]:  TierNormal,
+		conns[2]:  TierFocused,
+		conns[11]: TierFocused,
+		watched:   TierFocused, // the filter beats idleness
+		idle:      TierBackground,
+		quiet:     TierNormal,
+		unknown:   TierNormal,
+	}
+	for c, tier := range want {
+		if got := tiers[c.Key()]; got != tier {
+			t.Errorf("%s: %s, want %s", c.AppName, got, tier)
+		}
+	}
+	if len(tiers) != len(conns) {
+		t.Errorf("%d tiers for %d connections", len(tiers), len(conns))
+	}
+
+	// Without a filter the watched connection falls back to its idleness.
+	if got := AssignTiers(conns, "", now)[watched.Key()]; got != TierBackground {
+		t.Errorf("ssh without a filter: %s", got)
+	}
+}
+
+func TestTierEvery(t *testing.T) {
+	for tier, every := range map[PingTier]int{TierFocused: 1, TierNormal: 3, TierBackground: 10} {
+		if tier.Every() != every {
+			t.Errorf("%s every %d, want %d", tier, tier.Every(), every)
+		}
+	}
+}
+
+// countingSource counts pings per remote address.
+type countingSource struct {
+	fakeSource
+	mu    sync.Mutex
+	pings map[string]int
+}
+
+func (s *countingSource) Ping(addr string, port int) (time.Duration, float64) {
+	s.mu.Lock()
+	s.pings[addr]++
+	s.mu.Unlock()
+	return 10 * time.Millisecond, 0
+}
+
+func TestTieredProbing(t *testing.T) {
+	for _, probeAll := range []bool{false, true} {
+		src := &countingSource{pings: map[string]int{}}
+		src.set(fakeConn("ssh", "192.0.2.1", 22), fakeConn("db", "192.0.2.2", 5432))
+		tr := NewTracker(time.Second, true)
+		tr.SetSource(src)
+		tr.SetFocusQuery("ssh")
+		tr.SetProbeAll(probeAll)
+		t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		for i := range 9 {
+			now := t0.Add(time.Duration(i) * time.Second)
+			tr.SetClock(func() time.Time { return now })
+			tr.scan()
+		}
+
+		wantDB := 3
+		if probeAll {
+			wantDB = 9
+		}
+		if src.pings["192.0.2.1"] != 9 || src.pings["192.0.2.2"] != wantDB {
+			t.Errorf("probe all %v: focused pinged %d times, normal %d; want 9 and %d",
+				probeAll, src.pings["192.0.2.1"], src.pings["192.0.2.2"], wantDB)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package tracker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsLibNames are substrings of shared objects that indicate TLS support.
+var tlsLibNames = []string{"libssl", "libgnutls", "libnss3", "libwolfssl", "libmbedtls"}
+
+// processHasTLSLib reports whether /proc/<pid>/maps contains a TLS library.
+func processHasTLSLib(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, lib := range tlsLibNames {
+			if strings.Contains(line, lib) {
+				return true
+			}
+		}
+	}
+	return false
+}
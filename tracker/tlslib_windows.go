@@ -0,0 +1,8 @@
+//go:build windows
+
+package tracker
+
+// processHasTLSLib is not implemented on Windows; classification relies on ports.
+func processHasTLSLib(pid int) bool {
+	return false
+}
@@ -1,42 +1,302 @@
 package tracker
 
 import (
-	"strings"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"ping-tracker/policy"
 )
 
+// knownHostsSaveInterval is how often the known-hosts database is flushed to disk.
+const knownHostsSaveInterval = 30 * time.Second
+
 // Tracker manages the lifecycle of connection tracking.
 type Tracker struct {
 	mu          sync.RWMutex
 	connections map[string]*Connection
 	stopCh      chan struct{}
-	interval    time.Duration
+	intervalCh  chan struct{} // tells the running scan loop the interval changed
+	interval    time.Duration // as configured; a schedule window may stretch it
 	pingEnabled bool
+	alertRule   AlertRule
+	recorder    *IncidentRecorder
+
+	encOverrides map[int]bool
+	tlsLibCache  map[int]bool // PID -> has a TLS library mapped
+
+	knownHosts *KnownHosts
+	lastSave   time.Time
+
+	perf    perfRing
+	started time.Time // when Start was called, for Health
+
+	closed   []*Connection // recently closed, oldest first
+	flowLink FlowLinkConfig
+
+	probeAll   bool   // probe every connection every cycle, ignoring tiers
+	focusQuery string // the UI's active filter; matching connections are probed every cycle
+	cycle      int
+
+	calibration      *LatencyCalibration // nil when ping correction is off
+	calibrationHosts int                 // cap on calibrated hosts; 0 = default
+	flowSink         FlowSink
+	scanSink         ScanSink
+	journal          *ChangeJournal // nil unless SetChangeJournal
+
+	auditor  *Auditor       // nil unless audit mode is on
+	exeCache map[int]string // PID -> executable path, for audit mode
+
+	listeners      *ListenerWatch // nil unless new-listener alerts are on
+	probeProxy     *ProbeProxy    // nil unless -probe-proxy is set
+	policy         policy.Mode    // -read-only or -dry-run
+	dualStack      *DualStack     // nil without dual-stack targets
+	heatmap        *Heatmap       // dual-stack results by hour of the week
+	listenerAlerts []Alert        // this session's new-listener alerts, oldest first
+	stuck          StuckThresholds
+	probeGate      probeGate
+	scoreWeights   ScoreWeights
+	maxConns       int      // 0 = no cap
+	overflow       Overflow // sockets of the last scan beyond maxConns
+	sampleFilter   SampleFilter
+	samples        map[string]*rttSamples // probe RTT history by remote address
+	outageAlert    time.Duration          // 0: outages are not logged
+	halfOpen       HalfOpenRule
+	outageLog      []OutageEvent  // this session's outage alerts and recoveries, oldest first
+	sni            sniCache       // names from ObserveClientHello and ObserveQUIC not yet attached
+	capture        *packetCapture // nil unless -pcap-accounting
+	derived        []DerivedColumn
+	schedule       Schedule
+	scheduleStatus ScheduleStatus  // the window in effect since the last minute tick
+	scheduleLog    []ScheduleEvent // this session's transitions, oldest first
+	closingLog     []closingScan   // entries into a closing state, last minute
+	closingFrom    time.Time       // the first scan, where closing entries start being counted
+	loadThrottle   LoadThrottle
+	loadSampler    loadReader
+	loadStatus     LoadStatus
+	loadLog        []LoadEvent  // this session's throttle transitions, oldest first
+	clockLog       []ClockEvent // this session's suspends and clock steps, oldest first
+	injections     []*Injection // -inject perturbations, applied to snapshots
+	deepDive       *DeepDive    // the running or last deep-dive
+	focus          *focus       // nil unless a focus loop is armed
+	session        sessionLog
+	updates        chan struct{}
+	generation     atomic.Uint64 // see Generation
+	lastView       uint64        // viewSum when touchIfChanged last ran
+	lastViewConns  int           // and the connections then
+	checks         serviceChecks
+	triggers       triggers
+	notify         notifiers
+	events         EventSink
+	eventApps      map[string]bool // lower-case app names whose connections are logged
+
+	// Read and written by the scan loop only.
+	clock          func() time.Time // nil for time.Now
+	lastCycleEnd   time.Time
+	lastInterval   time.Duration
+	alerting       map[string]Alert // critical alerts of the last scan by key, for the event log
+	behind         bool             // scans were overrunning at the last scan
+	budgetExceeded bool
+	processOpens   uint64         // procNames' open count at the last scan
+	triggerQueue   []triggerEvent // this scan's events for the trigger rules
+
+	source Source // nil for the OS socket tables and real probes
+
+	resolveQueue *resolveQueue // sockets whose owner is looked up again soon
+
+	appTotals     map[string]*AppTotals // lifetime totals of closed connections by app
+	state         *StateStore           // nil with -no-state
+	stateInterval time.Duration
+	lastStateSave time.Time
+
+	external  map[netip.AddrPort]externalSample // injected measurements by remote
+	synthetic map[netip.AddrPort]string         // remote -> Key() of its synthetic connection
 }
 
 // NewTracker creates a new Tracker with the given scan interval.
 func NewTracker(interval time.Duration, pingEnabled bool) *Tracker {
 	return &Tracker{
 		connections: make(map[string]*Connection),
+		tlsLibCache: make(map[int]bool),
+		exeCache:    make(map[int]string),
+		appTotals:   make(map[string]*AppTotals),
+		flowLink:    DefaultFlowLinkConfig,
+		calibration: NewLatencyCalibration(),
+		heatmap:     NewHeatmap(),
 		stopCh:      make(chan struct{}),
+		intervalCh:  make(chan struct{}, 1),
+		updates:     make(chan struct{}, 1),
 		interval:    interval,
 		pingEnabled: pingEnabled,
+		stuck:       DefaultStuckThresholds,
+		halfOpen:    DefaultHalfOpenRule,
+
+		resolveQueue: newResolveQueue(resolveOwner, maxResolveQueue),
+		scoreWeights: DefaultScoreWeights,
+		sampleFilter: DefaultSampleFilter,
+		outageAlert:  DefaultOutageAlert,
+		loadSampler:  &loadSampler{},
 	}
 }
 
+// SetAlertRule sets the thresholds evaluated after every scan. It is safe to
+// call while the tracker is running.
+func (t *Tracker) SetAlertRule(r AlertRule) {
+	t.mu.Lock()
+	t.alertRule = r
+	t.mu.Unlock()
+}
+
+// AlertRule returns the thresholds currently in effect.
+func (t *Tracker) AlertRule() AlertRule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.alertRule
+}
+
+// SetIncidentRecorder attaches a recorder that captures snapshots around alerts.
+// Must be called before Start.
+func (t *Tracker) SetIncidentRecorder(r *IncidentRecorder) {
+	t.recorder = r
+}
+
+// RecordingIncident reports whether an incident record file is being written.
+func (t *Tracker) RecordingIncident() bool {
+	return t.recorder != nil && t.recorder.Active()
+}
+
+// SetEncryptionOverrides sets per-port encryption classifications that take
+// precedence over the built-in table. It is safe to call while the tracker is
+// running; connections already classified keep their classification.
+func (t *Tracker) SetEncryptionOverrides(overrides map[int]bool) {
+	t.mu.Lock()
+	t.encOverrides = overrides
+	t.mu.Unlock()
+}
+
+// SetFlowLink configures how replacement sockets are linked to closed ones.
+// Must be called before Start.
+func (t *Tracker) SetFlowLink(cfg FlowLinkConfig) {
+	t.flowLink = cfg
+}
+
+// Interval returns the scan interval in effect: the configured one, or
+// as stretched by the active schedule window.
+func (t *Tracker) Interval() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.effectiveInterval()
+}
+
+// ConfiguredInterval returns the scan interval as set, whatever the
+// schedule does to it.
+func (t *Tracker) ConfiguredInterval() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.interval
+}
+
+// SetInterval changes the scan interval. It is safe to call while the
+// tracker is running; the next scan follows the new interval.
+func (t *Tracker) SetInterval(d time.Duration) {
+	t.mu.Lock()
+	t.interval = d
+	t.mu.Unlock()
+	t.resetTicker()
+}
+
+// resetTicker tells the scan loop to pick up Interval again. A signal
+// already pending covers this one.
+func (t *Tracker) resetTicker() {
+	select {
+	case t.intervalCh <- struct{}{}:
+	default:
+	}
+}
+
+// SetPingEnabled turns ping probes on or off. It is safe to call while the
+// tracker is running.
+func (t *Tracker) SetPingEnabled(on bool) {
+	t.mu.Lock()
+	t.pingEnabled = on
+	t.mu.Unlock()
+}
+
+// SetProbeAll disables tiered probing so every connection is pinged each cycle.
+func (t *Tracker) SetProbeAll(on bool) {
+	t.probeAll = on
+}
+
+// SetFocusQuery tells the tracker which connections the user is looking at
+// (Search syntax) so they are probed every cycle.
+func (t *Tracker) SetFocusQuery(query string) {
+	t.mu.Lock()
+	t.focusQuery = query
+	t.mu.Unlock()
+}
+
+// SetPingCorrection turns the probe bias correction on or off. When off,
+// Ping is the raw TCP connect RTT. Must be called before Start.
+func (t *Tracker) SetPingCorrection(on bool) {
+	t.calibration = nil
+	if on {
+		t.calibration = NewLatencyCalibration()
+		if t.calibrationHosts > 0 {
+			t.calibration.maxHosts = t.calibrationHosts
+		}
+	}
+}
+
+// SetCalibrationHosts caps how many hosts keep a learned ping offset (default
+// DefaultCalibrationHosts). Must be called before Start.
+func (t *Tracker) SetCalibrationHosts(n int) {
+	t.calibrationHosts = n
+	if t.calibration != nil && n > 0 {
+		t.calibration.maxHosts = n
+	}
+}
+
+// SetAuditor turns on audit mode: each new connection's executable is
+// resolved and scored. Must be called before Start.
+func (t *Tracker) SetAuditor(a *Auditor) {
+	t.auditor = a
+}
+
+// SetKnownHosts attaches the persistent remote-host database. Must be called before Start.
+func (t *Tracker) SetKnownHosts(k *KnownHosts) {
+	t.knownHosts = k
+}
+
 // Start begins periodic scanning in the background.
 func (t *Tracker) Start() {
+	t.started = time.Now()
+	t.applySchedule(t.started)
 	// Initial scan
 	t.scan()
+	go t.runResolveQueue()
 
 	go func() {
-		ticker := time.NewTicker(t.interval)
+		ticker := time.NewTicker(t.Interval())
 		defer ticker.Stop()
+		// Schedule windows are checked every minute; they go by wall-clock
+		// time, so a DST change at worst moves a transition by a tick.
+		minute := time.NewTicker(time.Minute)
+		defer minute.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				t.scan()
+				// A cycle that outlasted the interval leaves a tick
+				// waiting; drop it rather than start over straight away.
+				select {
+				case <-ticker.C:
+				default:
+				}
+			case <-t.intervalCh:
+				ticker.Reset(t.Interval())
+			case now := <-minute.C:
+				t.applySchedule(now)
 			case <-t.stopCh:
 				return
 			}
@@ -47,31 +307,153 @@ func (t *Tracker) Start() {
 // Stop halts the tracker.
 func (t *Tracker) Stop() {
 	close(t.stopCh)
+	if t.capture != nil {
+		t.capture.src.close()
+	}
+	t.StopDeepDive()
+	t.DisarmFocus()
+	if t.recorder != nil {
+		t.recorder.Close()
+	}
+	if t.knownHosts != nil {
+		t.knownHosts.Save()
+	}
+	if t.listeners != nil {
+		t.listeners.Save()
+	}
+	if t.state != nil {
+		t.saveState(time.Now())
+		t.state.Close()
+	}
 }
 
 // scan performs a single scan cycle: discover connections, update metrics.
 func (t *Tracker) scan() {
-	scanned, err := ScanConnections()
+	start := t.now()
+	jump, jumped := t.checkClock(start)
+	defer t.endCycle()
+	defer t.notifyUpdate()
+	t.sampleLoad(start)
+	allocsBefore := mallocs()
+	lastResolve.Store(0)
+
+	scanned, err := t.scanSource()
 	if err != nil {
+		t.perf.fail(err)
 		return
 	}
 
-	now := time.Now()
+	now := t.now()
+	stats := ScanStats{
+		Start:     start,
+		Enumerate: now.Sub(start),
+		Resolve:   time.Duration(lastResolve.Load()),
+		Conns:     len(scanned),
+	}
+	opens := procNames.opens.Load()
+	stats.Opens, t.processOpens = int(opens-t.processOpens), opens
+	if jumped {
+		stats.Gap = jump.Gap
+	}
 	t.mu.Lock()
+	if jumped {
+		t.bridgeGap()
+	}
 
 	// Track which keys are still alive
+	for _, sc := range scanned {
+		normalizeFamily(sc)
+	}
+	scanned = reconcile(scanned)
+	correlateUDP(scanned)
+	if t.capture != nil {
+		t.capture.fill(scanned, now)
+	}
+	var overflowed []string
+	scanned, t.overflow, overflowed = capConnections(scanned, t.maxConns, t.connections, now)
 	alive := make(map[string]bool)
+	for _, sc := range scanned {
+		alive[sc.Key()] = true
+	}
+	// Connections pushed over the cap are still open: forget them without
+	// counting them as closed.
+	for _, key := range overflowed {
+		if _, ok := t.connections[key]; ok {
+			delete(t.connections, key)
+			t.resolveQueue.forget(key)
+		}
+	}
 
+	// Move stale connections to the recently-closed buffer first, so a
+	// replacement socket seen in this same scan can be linked to them.
+	for key, c := range t.connections {
+		if !alive[key] && c.Protocol != ExternalProtocol {
+			if t.flowSink != nil {
+				t.exportFlow(c, now)
+			}
+			c.ClosedAt = now
+			if t.watched(c) {
+				t.emitConn(now, EventConnClosed, c)
+			}
+			t.noteTrigger(TriggerClosed, c, "")
+			t.addClosed(c, now)
+			t.closed = append(t.closed, c)
+			delete(t.connections, key)
+			t.resolveQueue.forget(key)
+		}
+	}
+	t.pruneClosed(now)
+	t.checkDeepDive()
+
+	var added, closing []*Connection
+	var owners map[string]string
 	for _, sc := range scanned {
 		key := sc.Key()
-		alive[key] = true
 
 		existing, ok := t.connections[key]
+		// The simulated network uses documentation addresses and probes
+		// nothing for real, so the gate only applies to real sockets.
+		if t.source == nil {
+			sc.NoProbe = t.probeGate.classify(sc.RemoteAddr, now)
+		}
+		if t.knownHosts != nil && isTrackableRemote(sc.RemoteAddr) && sc.NoProbe == AddrProbeable {
+			first := t.knownHosts.Observe(sc.RemoteAddr, sc.AppName, now)
+			if !ok {
+				sc.RemoteFirstSeenEver = first
+			}
+		}
 		if ok {
 			// Update existing connection
-			existing.State = sc.State
+			if sc.State.Closing() && !existing.State.Closing() {
+				closing = append(closing, existing)
+			}
+			established := sc.State == StateEstablished && existing.State != StateEstablished
+			existing.noteState(sc.State, now, true)
+			existing.Direction = sc.Direction
+			existing.NoProbe = sc.NoProbe
+			if sc.Origin != OriginLocal {
+				// A client's DHCP lease may name it after the flow began.
+				existing.AppName, existing.ClientName = sc.AppName, sc.ClientName
+			} else if existing.AppName == ResolvingName && sc.AppName != ResolvingName {
+				// Its process waited for this scan to be looked up.
+				existing.AppName = sc.AppName
+				existing.Encryption, existing.EncryptionSource = ClassifyEncryption(existing, t.encOverrides, t.hasTLSLib(existing.PID))
+			}
+			existing.Provenance, existing.Merged = sc.Provenance, sc.Merged
+			existing.KernelRTT = sc.KernelRTT
+			existing.updateRetrans(sc.TCPInfo)
+			existing.TCPInfo = sc.TCPInfo
+			existing.QoS = sc.QoS
+			existing.CongestionAlgo, existing.BBR = sc.CongestionAlgo, sc.BBR
+			existing.SockMem, existing.SockMemInfo = sc.SockMem, sc.SockMemInfo
+			existing.SendQ, existing.RecvQ, existing.HasQueues = sc.SendQ, sc.RecvQ, sc.HasQueues
+			existing.HasByteCounts, existing.CapturedBytes = sc.HasByteCounts, sc.CapturedBytes
+			existing.StreamHint, existing.StreamHintSource = sc.StreamHint, sc.StreamHintSource
 			existing.LastUpdated = now
+			existing.updateStall(now)
+			existing.updateSendQ(t.alertRule.SendQThreshold)
 			existing.ConnAge = now.Sub(existing.FirstSeen)
+			existing.Stuck = t.stuck.Stuck(existing)
 
 			// Calculate bandwidth rate
 			if !existing.prevTime.IsZero() {
@@ -85,11 +467,17 @@ func (t *Tracker) scan() {
 					}
 				}
 			}
-			existing.prevTxBytes = existing.TxBytes
-			existing.prevRxBytes = existing.RxBytes
+			existing.prevTxBytes = sc.TxBytes
+			existing.prevRxBytes = sc.RxBytes
 			existing.prevTime = now
 			existing.TxBytes = sc.TxBytes
 			existing.RxBytes = sc.RxBytes
+			if existing.TxRate+existing.RxRate > 0 {
+				existing.LastActive = now
+			}
+			if established {
+				t.noteTrigger(TriggerEstablished, existing, "")
+			}
 		} else {
 			// New connection
 			sc.FirstSeen = now
@@ -97,92 +485,370 @@ func (t *Tracker) scan() {
 			sc.prevTime = now
 			sc.prevTxBytes = sc.TxBytes
 			sc.prevRxBytes = sc.RxBytes
+			sc.Encryption, sc.EncryptionSource = ClassifyEncryption(sc, t.encOverrides, t.hasTLSLib(sc.PID))
+			sc.Service = ClassifyService(sc)
+			if t.source == nil && needsResolve(sc) {
+				t.resolveQueue.add(sc, now)
+			}
+			sc.LogicalFirstSeen = now
+			sc.LastActive = now
+			// Sockets found by the first scan were in their state before we looked.
+			sc.noteState(sc.State, now, t.cycle > 0)
+			sc.Stuck = t.stuck.Stuck(sc)
+			sc.updateStall(now)
+			sc.updateSendQ(t.alertRule.SendQThreshold)
+			if t.auditor != nil {
+				sc.ExePath = t.exePath(sc.PID)
+				sc.Audit = t.auditor.Evaluate(sc.ExePath)
+			}
+			if prev := findPredecessor(sc, t.closed, now, t.flowLink); prev != nil {
+				sc.inheritFlow(prev)
+				t.removeClosed(prev)
+			}
+			if sc.State.Closing() && t.cycle > 0 {
+				// An ownerless TIME_WAIT socket is what a connection
+				// closed in this scan left behind: keep it under its app.
+				if sc.PID == 0 {
+					if owners == nil {
+						owners = t.closingOwners(now)
+					}
+					if app, ok := owners[tupleKey(sc)]; ok {
+						sc.AppName = app
+					}
+				}
+				closing = append(closing, sc)
+			}
+			if t.cycle > 0 && t.watched(sc) {
+				t.emitConn(now, EventConnOpened, sc)
+			}
+			if t.cycle > 0 {
+				t.noteTrigger(TriggerOpened, sc, "")
+				if sc.State == StateEstablished {
+					t.noteTrigger(TriggerEstablished, sc, "")
+				}
+			}
 			t.connections[key] = sc
+			added = append(added, sc)
 		}
 	}
 
-	// Remove stale connections
-	for key := range t.connections {
-		if !alive[key] {
-			delete(t.connections, key)
+	t.noteClosing(closing, now)
+
+	var listenerAlerts []Alert
+	if t.listeners != nil {
+		listenerAlerts = t.watchListeners(added, now)
+	}
+	t.pruneInjections(now)
+	listenerAlerts = append(listenerAlerts, t.injectedAlerts(now)...)
+	if len(listenerAlerts) > 0 {
+		t.listenerAlerts = append(t.listenerAlerts, listenerAlerts...)
+		if over := len(t.listenerAlerts) - maxListenerAlerts; over > 0 {
+			t.listenerAlerts = append([]Alert(nil), t.listenerAlerts[over:]...)
+		}
+	}
+	t.session.noteScan(now, t.connections)
+	t.session.listenerAlerts += len(listenerAlerts)
+
+	t.applyExternal(now)
+	t.sni.attach(t.connections, now)
+	t.attachServiceChecks(now)
+
+	if t.flowSink != nil {
+		t.exportLongLived(now)
+	}
+
+	// Re-evaluate probe tiers
+	conns := make([]*Connection, 0, len(t.connections))
+	for _, c := range t.connections {
+		conns = append(conns, c)
+	}
+	if t.probeAll {
+		for _, c := range conns {
+			c.PingTier = TierFocused
+		}
+	} else {
+		for key, tier := range AssignTiers(conns, t.focusQuery, now) {
+			t.connections[key].PingTier = tier
+		}
+	}
+	t.cycle++
+
+	// Forget TLS library results for processes that no longer own sockets
+	livePIDs := make(map[int]bool)
+	for _, c := range t.connections {
+		livePIDs[c.PID] = true
+	}
+	for pid := range t.tlsLibCache {
+		if !livePIDs[pid] {
+			delete(t.tlsLibCache, pid)
 		}
 	}
+	for pid := range t.exeCache {
+		if !livePIDs[pid] {
+			delete(t.exeCache, pid)
+		}
+	}
+	if t.calibration != nil {
+		t.calibration.Prune(now)
+	}
+	t.pruneSamples(now)
+	t.checkOutages(now)
+	t.checkHalfOpen(now)
+	t.markPortShares()
 
+	// Past the daily probe budget, connections keep what the scanner
+	// reports (kernel RTT, queues) until midnight.
+	pingEnabled := t.pingEnabled && t.probePolicy() != ProbesOff && (t.source != nil || probeMeter.allowed())
+	t.touchIfChanged()
 	t.mu.Unlock()
+	stats.Diff = time.Since(now)
+
+	if now.Sub(t.lastSave) >= knownHostsSaveInterval {
+		if t.knownHosts != nil {
+			t.knownHosts.Save()
+		}
+		if t.listeners != nil {
+			t.listeners.Save()
+		}
+		t.lastSave = now
+	}
+	if t.state != nil && now.Sub(t.lastStateSave) >= t.stateInterval {
+		t.saveState(now)
+		t.lastStateSave = now
+	}
 
 	// Ping in parallel (outside lock)
-	if t.pingEnabled {
+	if pingEnabled {
+		pingStart := time.Now()
 		t.pingAll()
+		if t.dualStack != nil && t.source == nil {
+			t.dualStack.Probe(time.Now())
+		}
+		if t.source == nil {
+			t.runServiceChecks(time.Now())
+		}
+		stats.Ping = time.Since(pingStart)
+	}
+
+	t.updateScores()
+	t.updateDerived(time.Now())
+	t.mu.Lock()
+	t.touchIfChanged()
+	t.mu.Unlock()
+
+	// Alerts are followed every scan, for the session summary if nothing
+	// else.
+	snap := t.Snapshot()
+	if t.recorder != nil {
+		t.recorder.Observe(now, snap, append(t.AlertRule().Evaluate(now, snap), listenerAlerts...))
 	}
+	if t.scanSink != nil {
+		t.scanSink.ExportScan(now, snap)
+	}
+	if t.journal != nil {
+		t.journal.Record(snap)
+	}
+	t.emitAlerts(now, snap, listenerAlerts)
+	t.runTriggers(now)
+
+	stats.Total = time.Since(start)
+	stats.Allocs = mallocs() - allocsBefore
+	if iv := t.Interval(); iv > 0 && stats.Total > iv {
+		stats.Skipped = int(stats.Total / iv)
+	}
+	t.perf.add(stats)
+}
+
+// hasTLSLib returns the cached TLS library check for a PID. Caller must hold the lock.
+func (t *Tracker) hasTLSLib(pid int) bool {
+	has, ok := t.tlsLibCache[pid]
+	if !ok {
+		has = processHasTLSLib(pid)
+		t.tlsLibCache[pid] = has
+	}
+	return has
+}
+
+// exePath returns the cached executable path for a PID. Caller must hold the lock.
+func (t *Tracker) exePath(pid int) string {
+	path, ok := t.exeCache[pid]
+	if !ok {
+		path = processExePath(pid)
+		t.exeCache[pid] = path
+	}
+	return path
 }
 
-// pingAll measures latency for all active ESTABLISHED connections.
+// pingAll measures latency for ESTABLISHED connections that are due for a
+// probe according to their tier.
 func (t *Tracker) pingAll() {
-	t.mu.RLock()
+	t.mu.Lock()
 	var targets []*Connection
 	for _, c := range t.connections {
-		if c.State == StateEstablished && c.RemoteAddr != "0.0.0.0" && c.RemoteAddr != "::" {
-			targets = append(targets, c)
+		// Connected UDP sockets are ESTABLISHED and probed like TCP ones;
+		// unconnected ones (UNCONN) have no peer to probe, and neither do
+		// multicast, broadcast or otherwise unreachable remotes.
+		if c.State != StateEstablished || c.RemoteAddr == "0.0.0.0" || c.RemoteAddr == "::" || c.NoProbe != AddrProbeable {
+			continue
 		}
+		if c.PingCorrection == CorrectionExternal {
+			continue // a fresh external measurement wins over our probe
+		}
+		if t.deepDiving(c.RemoteAddr) || t.focusing(c) {
+			continue // the deep-dive's or focus loop's connects would be counted twice
+		}
+		every := c.PingTier.Every()
+		if t.probePolicy() == ProbesReduced {
+			every *= reducedProbeFactor
+		}
+		if c.lastProbeCycle != 0 && t.cycle-c.lastProbeCycle < every {
+			continue
+		}
+		c.lastProbeCycle = t.cycle
+		targets = append(targets, c)
 	}
-	t.mu.RUnlock()
+	t.mu.Unlock()
 
-	// Limit concurrency to avoid flooding
-	sem := make(chan struct{}, 20)
+	// Limit concurrency to avoid flooding, and further on a busy machine
+	t.mu.RLock()
+	sem := make(chan struct{}, t.probeConcurrency())
+	t.mu.RUnlock()
 	var wg sync.WaitGroup
 
 	for _, c := range targets {
+		if t.source == nil && !probeMeter.allowed() {
+			break // the budget ran out during this cycle
+		}
 		wg.Add(1)
 		sem <- struct{}{}
 		go func(conn *Connection) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			rtt, loss := MeasurePing(conn.RemoteAddr, conn.RemotePort)
+			var proxied *ProxyPing
+			var rtt time.Duration
+			var loss float64
+			if t.source != nil {
+				rtt, loss = t.source.Ping(conn.RemoteAddr, conn.RemotePort)
+			} else if t.probeProxy != nil && !t.probeProxy.Bypassed(conn.RemoteAddr) {
+				r := t.probeProxy.Measure(conn.RemoteAddr, conn.RemotePort)
+				proxied, rtt, loss = &r, r.RTT, r.Loss
+			} else {
+				rtt, loss = MeasurePing(conn.RemoteAddr, conn.RemotePort)
+			}
 
+			now := t.now()
 			t.mu.Lock()
-			conn.Ping = rtt
-			conn.PingCount++
+			t.recordProbe(conn, rtt, loss, proxied, now)
 			conn.Loss = loss
-			if loss >= 100 {
-				conn.PingFailed++
-			}
 			t.mu.Unlock()
+			t.perf.probe(loss)
 		}(c)
 	}
 
 	wg.Wait()
 }
 
+// recordProbe applies one probe of conn's remote: the sample filter, the
+// calibration, Ping, the loss window and the host's outage state. It
+// leaves conn.Loss to the caller. Caller must hold the lock.
+func (t *Tracker) recordProbe(conn *Connection, rtt time.Duration, loss float64, proxied *ProxyPing, now time.Time) {
+	// Warm-up and outlier samples are kept out of Ping, and so out
+	// of alerts and the score, and out of the calibration.
+	verdict := SampleAccepted
+	if loss < 100 && rtt > 0 {
+		verdict = t.filterSample(conn.RemoteAddr, rtt, now)
+	}
+	conn.LastSample = verdict
+	switch verdict {
+	case SampleWarmUp:
+		conn.WarmUpSamples++
+	case SampleOutlier:
+		conn.OutlierSamples++
+	}
+	// A proxied probe says nothing about the direct path, so it
+	// neither feeds nor uses the calibration.
+	if t.calibration != nil && proxied == nil && verdict == SampleAccepted {
+		t.calibration.Observe(conn.RemoteAddr, rtt, conn.KernelRTT)
+	}
+	// An external measurement that arrived during the probe wins.
+	if conn.PingCorrection != CorrectionExternal {
+		conn.RawPing = rtt
+		if verdict == SampleAccepted {
+			conn.Ping, conn.PingCorrection = rtt, CorrectionNone
+			conn.Proxy = proxied
+			if t.calibration != nil && proxied == nil {
+				conn.Ping, conn.PingCorrection = t.calibration.Correct(conn.RemoteAddr, rtt)
+			}
+		}
+	}
+	conn.PingCount++
+	conn.recordLoss(now, loss)
+	if loss >= 100 {
+		conn.PingFailed++
+	}
+	conn.UnreachableSince = t.noteProbe(conn.RemoteAddr, loss >= 100, now)
+	t.session.noteProbe(conn, loss, verdict == SampleAccepted)
+}
+
 // Snapshot returns a copy of all current connections.
 func (t *Tracker) Snapshot() []*Connection {
+	return t.SnapshotInto(nil)
+}
+
+// SnapshotInto is Snapshot reusing dst: its backing array, and the
+// Connection values its elements up to cap(dst) point to, are overwritten
+// with the copies, and only what does not fit is allocated. The caller
+// must no longer use anything dst pointed to; passing back the previous
+// result each time makes a steady-state snapshot allocation-free.
+func (t *Tracker) SnapshotInto(dst []*Connection) []*Connection {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	result := make([]*Connection, 0, len(t.connections))
+	bufs := dst[:cap(dst)]
+	result := dst[:0]
 	for _, c := range t.connections {
-		cp := *c // shallow copy
-		result = append(result, &cp)
+		var cp *Connection
+		if i := len(result); i < len(bufs) && bufs[i] != nil {
+			cp = bufs[i]
+		} else {
+			cp = new(Connection)
+		}
+		*cp = *c // shallow copy
+		result = append(result, cp)
 	}
-	return result
+	out := t.inject(result, time.Now())
+	if len(out) < len(result) {
+		// Dropping a connection moved the ones after it down, leaving
+		// their old slots pointing at values still in use.
+		clear(out[len(out):len(result)])
+	}
+	return out
 }
 
-// Search returns connections whose AppName contains the given substring (case-insensitive).
-func (t *Tracker) Search(query string) []*Connection {
-	if query == "" {
-		return t.Snapshot()
-	}
+// Generation is a counter that changes whenever what Snapshot returns
+// may have changed: after a scan or its probes that changed what a
+// connection shows (see connView), every focus tick, and every change
+// made between scans (an owner resolved, a listener acknowledged, an
+// injection added, an external RTT ingested, a deep-dive sample taken).
+// Equal generations mean equal connections, except that -inject
+// perturbations also start and expire with time while Injections is not
+// empty, and that the times every scan moves on (LastUpdated, ConnAge)
+// may be a scan behind.
+func (t *Tracker) Generation() uint64 {
+	return t.generation.Load()
+}
 
-	t.mu.RLock()
-	defer t.mu.RUnlock()
+// touch moves Generation on after connections changed.
+func (t *Tracker) touch() {
+	t.generation.Add(1)
+}
 
-	query = strings.ToLower(query)
-	var result []*Connection
-	for _, c := range t.connections {
-		if strings.Contains(strings.ToLower(c.AppName), query) {
-			cp := *c
-			result = append(result, &cp)
-		}
-	}
-	return result
+// Search returns connections matching the query. Plain words match the AppName
+// as a case-insensitive substring, numbers match a port or PID, address
+// fragments match an address prefix, and key:value terms (e.g. trend:degrading)
+// filter on other fields. All terms must match (see parseQuery).
+func (t *Tracker) Search(query string) []*Connection {
+	// Filtered after any injections, so the search sees what is shown.
+	return FilterConnections(t.Snapshot(), query)
 }
@@ -0,0 +1,96 @@
+package tracker
+
+import "time"
+
+const (
+	// lossWindow is the length of each window compared by the loss trend.
+	lossWindow = time.Minute
+
+	// trendThreshold is the change in percentage points below which the
+	// trend is reported as stable.
+	trendThreshold = 5.0
+)
+
+// TrendDirection describes how a metric has moved between two windows.
+type TrendDirection string
+
+const (
+	TrendStable    TrendDirection = "stable"
+	TrendImproving TrendDirection = "improving"
+	TrendDegrading TrendDirection = "degrading"
+)
+
+// LossTrend compares windowed loss over the last minute with the minute before.
+type LossTrend struct {
+	Direction TrendDirection
+	Delta     float64 // current minus previous window, in percentage points
+}
+
+// lossSample is one ping result used for windowed loss.
+type lossSample struct {
+	at   time.Time
+	loss float64
+}
+
+// Arrow returns a one-character indicator for the trend.
+func (t LossTrend) Arrow() string {
+	switch t.Direction {
+	case TrendDegrading:
+		return "↑"
+	case TrendImproving:
+		return "↓"
+	default:
+		return ""
+	}
+}
+
+// ComputeLossTrend classifies the change from the previous window's loss to the current one.
+func ComputeLossTrend(previous, current float64) LossTrend {
+	delta := current - previous
+	switch {
+	case delta >= trendThreshold:
+		return LossTrend{Direction: TrendDegrading, Delta: delta}
+	case delta <= -trendThreshold:
+		return LossTrend{Direction: TrendImproving, Delta: delta}
+	default:
+		return LossTrend{Direction: TrendStable, Delta: delta}
+	}
+}
+
+// windowLoss averages the loss of samples taken in [from, to).
+func windowLoss(samples []lossSample, from, to time.Time) (float64, bool) {
+	var sum float64
+	var n int
+	for _, s := range samples {
+		if !s.at.Before(from) && s.at.Before(to) {
+			sum += s.loss
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// recordLoss appends a sample, drops samples older than two windows and
+// recomputes the connection's loss trend. Caller must hold the tracker lock.
+func (c *Connection) recordLoss(now time.Time, loss float64) {
+	cutoff := now.Add(-2 * lossWindow)
+	kept := make([]lossSample, 0, len(c.lossSamples)+1)
+	for _, s := range c.lossSamples {
+		if !s.at.Before(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	c.lossSamples = append(kept, lossSample{at: now, loss: loss})
+
+	mid := now.Add(-lossWindow)
+	prev, okPrev := windowLoss(c.lossSamples, cutoff, mid)
+	cur, okCur := windowLoss(c.lossSamples, mid, now.Add(time.Nanosecond))
+	if !okPrev || !okCur {
+		c.LossTrend = LossTrend{Direction: TrendStable}
+		return
+	}
+	c.LossTrend = ComputeLossTrend(prev, cur)
+}
@@ -0,0 +1,79 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeLossTrend(t *testing.T) {
+	tests := []struct {
+		prev, cur float64
+		want      TrendDirection
+	}{
+		{0, 0, TrendStable},
+		{10, 14.9, TrendStable},
+		{10, 15, TrendDegrading},
+		{0, 100, TrendDegrading},
+		{20, 15, TrendImproving},
+		{20, 15.1, TrendStable},
+		{100, 0, TrendImproving},
+	}
+	for _, tt := range tests {
+		got := ComputeLossTrend(tt.prev, tt.cur)
+		if got.Direction != tt.want {
+			t.Errorf("ComputeLossTrend(%v, %v) = %s, want %s", tt.prev, tt.cur, got.Direction, tt.want)
+		}
+		if got.Delta != tt.cur-tt.prev {
+			t.Errorf("ComputeLossTrend(%v, %v).Delta = %v", tt.prev, tt.cur, got.Delta)
+		}
+	}
+}
+
+func TestRecordLossWindows(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &Connection{}
+
+	// One window only: no trend yet.
+	for i := range 6 {
+		c.recordLoss(t0.Add(time.Duration(i)*10*time.Second), 0)
+	}
+	if c.LossTrend.Direction != TrendStable {
+		t.Fatalf("one window: %s", c.LossTrend.Direction)
+	}
+
+	// The next minute loses 20%: degrading.
+	for i := range 6 {
+		c.recordLoss(t0.Add(time.Minute+time.Duration(i)*10*time.Second), 20)
+	}
+	if c.LossTrend.Direction != TrendDegrading {
+		t.Fatalf("after a lossy minute: %s (delta %v)", c.LossTrend.Direction, c.LossTrend.Delta)
+	}
+
+	// A clean minute after that: improving, and samples older than two
+	// windows are gone.
+	last := t0
+	for i := range 6 {
+		last = t0.Add(2*time.Minute + time.Duration(i)*10*time.Second)
+		c.recordLoss(last, 0)
+	}
+	if c.LossTrend.Direction != TrendImproving {
+		t.Fatalf("after a clean minute: %s (delta %v)", c.LossTrend.Direction, c.LossTrend.Delta)
+	}
+	for _, s := range c.lossSamples {
+		if s.at.Before(last.Add(-2 * lossWindow)) {
+			t.Fatalf("sample at %v kept past two windows", s.at)
+		}
+	}
+}
+
+func TestFilterTrend(t *testing.T) {
+	up := &Connection{AppName: "a", LossTrend: LossTrend{Direction: TrendDegrading}}
+	flat := &Connection{AppName: "b", LossTrend: LossTrend{Direction: TrendStable}}
+	got := FilterConnections([]*Connection{up, flat}, "trend:Degrading")
+	if len(got) != 1 || got[0] != up {
+		t.Fatalf("trend:degrading matched %v", got)
+	}
+	if up.LossTrend.Arrow() != "↑" || flat.LossTrend.Arrow() != "" {
+		t.Fatalf("arrows %q %q", up.LossTrend.Arrow(), flat.LossTrend.Arrow())
+	}
+}
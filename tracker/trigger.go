@@ -0,0 +1,381 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping-tracker/cmdline"
+	"ping-tracker/policy"
+)
+
+// Trigger events: the points in a connection's life a trigger rule can
+// run a command at. Connections found by the first scan were open before
+// the tracker looked, so they neither open nor become established.
+const (
+	TriggerOpened      = "opened"      // the connection appeared
+	TriggerEstablished = "established" // it reached ESTABLISHED, or appeared in it
+	TriggerClosed      = "closed"      // it went away
+	TriggerAlerting    = "alerting"    // an alert was raised for it
+	TriggerRecovered   = "recovered"   // its alert cleared while it stayed open
+)
+
+var triggerEvents = []string{TriggerOpened, TriggerEstablished, TriggerClosed, TriggerAlerting, TriggerRecovered}
+
+const (
+	DefaultTriggerMinInterval = 10 * time.Second
+	DefaultTriggerTimeout     = time.Minute
+
+	// maxTriggerRuns is how many trigger commands run at once; a rule that
+	// fires with none free is skipped and the skip logged.
+	maxTriggerRuns = 4
+
+	// maxTriggerStderr is how much of a command's stderr is kept.
+	maxTriggerStderr = 4 << 10
+
+	// triggerWaitDelay is how long a killed command's stderr is read
+	// before it is closed.
+	triggerWaitDelay = time.Second
+)
+
+// EventTrigger is the event of a trigger command that ran, was skipped
+// for want of a free slot, or was only shown in dry-run mode.
+const EventTrigger = "trigger"
+
+// CommandFields are the connection fields a command run for a connection
+// can use as {name}: open_cmd and trigger commands.
+var CommandFields = map[string]func(c *Connection) string{
+	"remote_addr": func(c *Connection) string { return c.RemoteAddr },
+	"remote_port": func(c *Connection) string { return strconv.Itoa(c.RemotePort) },
+	"local_addr":  func(c *Connection) string { return c.LocalAddr },
+	"local_port":  func(c *Connection) string { return strconv.Itoa(c.LocalPort) },
+	"app":         func(c *Connection) string { return c.AppName },
+	"pid":         func(c *Connection) string { return strconv.Itoa(c.PID) },
+	"proto":       func(c *Connection) string { return c.DisplayProtocol() },
+	"state":       func(c *Connection) string { return string(c.State) },
+}
+
+// triggerFields are the placeholders of trigger commands besides
+// CommandFields.
+var triggerFields = map[string]func(r *TriggerRule, e *triggerEvent) string{
+	"rule":   func(r *TriggerRule, _ *triggerEvent) string { return r.Name },
+	"event":  func(_ *TriggerRule, e *triggerEvent) string { return e.on },
+	"reason": func(_ *TriggerRule, e *triggerEvent) string { return e.reason },
+}
+
+// TriggerRule runs a command when a connection matching Filter reaches
+// the event On.
+type TriggerRule struct {
+	Name        string
+	Filter      string        // search query syntax; "" matches every connection
+	On          string        // one of the Trigger* events
+	Argv        []string      // the command; words may hold placeholders
+	MinInterval time.Duration // the least time between two runs; 0 for none
+	Timeout     time.Duration // the command is killed after it
+	Disabled    bool          // starts disabled, for the rules overlay to enable
+
+	terms []queryTerm
+}
+
+// ParseTrigger validates one configured rule. run is a command line whose
+// words may contain the placeholders of CommandFields and {rule}, {event}
+// and {reason}; minInterval and timeout are durations ("" for the
+// defaults).
+func ParseTrigger(name, filter, on, run, minInterval, timeout string, disabled bool) (TriggerRule, error) {
+	r := TriggerRule{Name: name, Filter: filter, On: strings.ToLower(on), Disabled: disabled,
+		MinInterval: DefaultTriggerMinInterval, Timeout: DefaultTriggerTimeout}
+	fail := func(format string, args ...any) (TriggerRule, error) {
+		return TriggerRule{}, fmt.Errorf("trigger %q: %s", name, fmt.Sprintf(format, args...))
+	}
+	if name == "" {
+		return fail("needs a name")
+	}
+	if !slices.Contains(triggerEvents, r.On) {
+		return fail("unknown event %q (%s)", on, strings.Join(triggerEvents, ", "))
+	}
+	var err error
+	r.Argv, err = cmdline.Parse(run, func(name string) bool {
+		return CommandFields[name] != nil || triggerFields[name] != nil
+	})
+	if err != nil {
+		return fail("run: %v", err)
+	}
+	if minInterval != "" {
+		d, err := time.ParseDuration(minInterval)
+		if err != nil || d < 0 {
+			return fail("min_interval %q: want a duration", minInterval)
+		}
+		r.MinInterval = d
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return fail("timeout %q: want a positive duration", timeout)
+		}
+		r.Timeout = d
+	}
+	r.terms = parseQuery(filter)
+	return r, nil
+}
+
+// TriggerStatus is a trigger rule and what it did this session.
+type TriggerStatus struct {
+	TriggerRule
+	Enabled  bool
+	Runs     int // commands that ran to the end, or were shown in dry-run mode
+	Failures int // of those, the ones that failed to start, exited non-zero or timed out
+	Skipped  int // firings within MinInterval or without a free slot
+	Running  int
+	Last     time.Time // when the last run started
+	Result   string    // the last run's outcome
+}
+
+// triggerEvent is a connection reaching a trigger event in a scan, with a
+// copy of the connection as it was then.
+type triggerEvent struct {
+	on     string
+	conn   Connection
+	reason string // the alert's, for alerting and recovered
+}
+
+// triggers runs the trigger rules. It has its own lock: results land from
+// the command goroutines.
+type triggers struct {
+	mu    sync.Mutex
+	rules []*TriggerStatus
+	slots chan struct{}
+	// run runs a command; nil for runTriggerCommand.
+	run func(argv []string, timeout time.Duration) (exit int, stderr string, err error)
+}
+
+// errTriggerBusy is why a rule that fired did not run.
+var errTriggerBusy = errors.New("all trigger slots busy")
+
+// SetTriggers sets the trigger rules; none by default. A rule that keeps
+// its name keeps its counters, and the enabled state set in the rules
+// overlay unless its disabled setting changed. It is safe to call while
+// the tracker is running.
+func (t *Tracker) SetTriggers(rules []TriggerRule) {
+	s := &t.triggers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make([]*TriggerStatus, 0, len(rules))
+	for _, r := range rules {
+		st := &TriggerStatus{TriggerRule: r, Enabled: !r.Disabled}
+		for _, old := range s.rules {
+			if old.Name == r.Name {
+				st.Runs, st.Failures, st.Skipped = old.Runs, old.Failures, old.Skipped
+				st.Last, st.Result = old.Last, old.Result
+				if old.Disabled == r.Disabled {
+					st.Enabled = old.Enabled
+				}
+			}
+		}
+		next = append(next, st)
+	}
+	s.rules = next
+}
+
+// Triggers returns the trigger rules in configured order, with what each
+// did this session.
+func (t *Tracker) Triggers() []TriggerStatus {
+	s := &t.triggers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]TriggerStatus, len(s.rules))
+	for i, r := range s.rules {
+		out[i] = *r
+	}
+	return out
+}
+
+// SetTriggerEnabled enables or disables the rule named name until the
+// next restart. It is safe to call while the tracker is running.
+func (t *Tracker) SetTriggerEnabled(name string, enabled bool) {
+	s := &t.triggers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.Name == name {
+			r.Enabled = enabled
+		}
+	}
+}
+
+// wants reports whether an enabled rule runs on the event on.
+func (s *triggers) wants(on string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.Enabled && r.On == on {
+			return true
+		}
+	}
+	return false
+}
+
+// noteTrigger queues c reaching the event on, for runTriggers at the end
+// of the scan. Called from the scan loop.
+func (t *Tracker) noteTrigger(on string, c *Connection, reason string) {
+	if t.triggers.wants(on) {
+		t.triggerQueue = append(t.triggerQueue, triggerEvent{on: on, conn: *c, reason: reason})
+	}
+}
+
+// runTriggers starts the commands of the rules the scan's events match,
+// without waiting for them. In read-only mode nothing runs; in dry-run
+// mode each command line is logged instead. Called at the end of a scan.
+func (t *Tracker) runTriggers(now time.Time) {
+	queue := t.triggerQueue
+	t.triggerQueue = nil
+	if len(queue) == 0 || t.policy.Check(policy.Triggers) == policy.Deny {
+		return
+	}
+	s := &t.triggers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.slots == nil {
+		s.slots = make(chan struct{}, maxTriggerRuns)
+	}
+	run := s.run
+	if run == nil {
+		run = runTriggerCommand
+	}
+	for i := range queue {
+		e := &queue[i]
+		for _, r := range s.rules {
+			if !r.Enabled || r.On != e.on || !matchAll(&e.conn, r.terms) {
+				continue
+			}
+			if !r.Last.IsZero() && now.Sub(r.Last) < r.MinInterval {
+				r.Skipped++
+				continue
+			}
+			argv := r.expand(e)
+			kv := []string{"rule", r.Name, "event", e.on, "app", e.conn.AppName,
+				"remote", fmt.Sprintf("%s:%d", e.conn.RemoteAddr, e.conn.RemotePort)}
+			plan, err := t.policy.Do(policy.Triggers, func() string { return policy.Argv(argv) }, func() error {
+				select {
+				case s.slots <- struct{}{}:
+				default:
+					return errTriggerBusy
+				}
+				r.Running++
+				go t.runTrigger(r, run, argv, kv)
+				return nil
+			})
+			switch {
+			case err != nil:
+				r.Skipped++
+				t.emit(now, SeverityWarn, EventTrigger, append(kv, "skipped", err.Error())...)
+				continue
+			case plan != "":
+				r.Runs++
+				r.Result = "dry run: " + plan
+				t.emit(now, SeverityInfo, EventTrigger, append(kv, "dry_run", plan)...)
+			}
+			r.Last = now
+		}
+	}
+}
+
+// expand fills e into the rule's command.
+func (r *TriggerRule) expand(e *triggerEvent) []string {
+	return cmdline.Expand(r.Argv, func(name string) string {
+		if f := triggerFields[name]; f != nil {
+			return f(r, e)
+		}
+		return CommandFields[name](&e.conn)
+	})
+}
+
+// runTrigger runs one command of rule r in a slot, then records and logs
+// how it ended. kv are the event fields naming the rule and connection.
+func (t *Tracker) runTrigger(r *TriggerStatus, run func([]string, time.Duration) (int, string, error), argv, kv []string) {
+	s := &t.triggers
+	defer func() { <-s.slots }()
+	start := time.Now()
+	exit, stderr, err := run(argv, r.Timeout)
+	took := time.Since(start)
+
+	line, _, _ := strings.Cut(strings.TrimSpace(stderr), "\n")
+	sev := SeverityInfo
+	var result string
+	switch {
+	case err != nil:
+		sev = SeverityWarn
+		result = "failed: " + err.Error()
+		kv = append(kv, "error", err.Error())
+	case exit != 0:
+		sev = SeverityWarn
+		result = fmt.Sprintf("exit %d after %s", exit, took.Round(time.Millisecond))
+		kv = append(kv, "exit", strconv.Itoa(exit))
+	default:
+		result = fmt.Sprintf("exit 0 after %s", took.Round(time.Millisecond))
+		kv = append(kv, "exit", "0")
+	}
+	kv = append(kv, "duration", took.Round(time.Millisecond).String())
+	if line != "" {
+		result += ": " + line
+		kv = append(kv, "stderr", line)
+	}
+
+	s.mu.Lock()
+	r.Running--
+	r.Runs++
+	if sev != SeverityInfo {
+		r.Failures++
+	}
+	r.Result = result
+	s.mu.Unlock()
+	t.emit(time.Now(), sev, EventTrigger, kv...)
+}
+
+// runTriggerCommand runs argv directly, without a shell, and kills it
+// after timeout. err is set when it did not start or did not finish;
+// otherwise exit is its exit status. The first maxTriggerStderr bytes of
+// its stderr are returned; stdin and stdout are the null device.
+func runTriggerCommand(argv []string, timeout time.Duration) (exit int, stderr string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	var buf cappedBuffer
+	cmd.Stderr = &buf
+	// A child left holding stderr open does not keep the slot past the
+	// timeout.
+	cmd.WaitDelay = triggerWaitDelay
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return -1, buf.String(), fmt.Errorf("killed after %s", timeout)
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), buf.String(), nil
+	case err != nil:
+		return -1, buf.String(), err
+	}
+	return 0, buf.String(), nil
+}
+
+// cappedBuffer keeps the first maxTriggerStderr bytes written to it. The
+// buffer is a field, not embedded, so io.Copy cannot go around Write
+// through its ReadFrom.
+type cappedBuffer struct {
+	buf bytes.Buffer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := maxTriggerStderr - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
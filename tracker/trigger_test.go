@@ -0,0 +1,341 @@
+package tracker
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRunner stands in for runTriggerCommand: it records the command
+// lines and answers with exit, stderr and err. While hold is open, it
+// waits for it to close.
+type fakeRunner struct {
+	mu     sync.Mutex
+	ran    []string
+	exit   int
+	stderr string
+	err    error
+	hold   chan struct{}
+}
+
+func (f *fakeRunner) run(argv []string, _ time.Duration) (int, string, error) {
+	f.mu.Lock()
+	f.ran = append(f.ran, strings.Join(argv, " "))
+	hold := f.hold
+	f.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	return f.exit, f.stderr, f.err
+}
+
+func (f *fakeRunner) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.ran)
+}
+
+// triggerTracker is a tracker running rules through a fakeRunner, with
+// its events recorded.
+func triggerTracker(t *testing.T, rules ...TriggerRule) (*Tracker, *fakeRunner, *eventRecorder) {
+	t.Helper()
+	tr := NewTracker(time.Second, false)
+	rec := &eventRecorder{}
+	tr.SetEventSink(rec)
+	tr.SetTriggers(rules)
+	f := &fakeRunner{}
+	tr.triggers.run = f.run
+	return tr, f, rec
+}
+
+// settle waits for the commands started to finish.
+func settle(t *testing.T, tr *Tracker) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		running := 0
+		for _, r := range tr.Triggers() {
+			running += r.Running
+		}
+		if running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d trigger commands still running", running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustTrigger(t *testing.T, name, filter, on, run, minInterval string) TriggerRule {
+	t.Helper()
+	r, err := ParseTrigger(name, filter, on, run, minInterval, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// durations drops the varying duration field of event lines.
+var durations = regexp.MustCompile(` duration=\S+`)
+
+func TestParseTrigger(t *testing.T) {
+	r, err := ParseTrigger("start", "obs 1935", "Established", "stream-start {app} {remote_port}", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.On != TriggerEstablished || r.MinInterval != DefaultTriggerMinInterval || r.Timeout != DefaultTriggerTimeout {
+		t.Errorf("rule %+v", r)
+	}
+	if !slices.Equal(r.Argv, []string{"stream-start", "{app}", "{remote_port}"}) {
+		t.Errorf("argv %q", r.Argv)
+	}
+	for _, tt := range []struct {
+		name, on, run, minInterval, timeout string
+	}{
+		{"", "opened", "true", "", ""},
+		{"x", "connected", "true", "", ""},
+		{"x", "opened", "", "", ""},
+		{"x", "opened", "echo {nope}", "", ""},
+		{"x", "opened", "echo 'unterminated", "", ""},
+		{"x", "opened", "true", "-1s", ""},
+		{"x", "opened", "true", "soon", ""},
+		{"x", "opened", "true", "", "0s"},
+	} {
+		if _, err := ParseTrigger(tt.name, "", tt.on, tt.run, tt.minInterval, tt.timeout, false); err == nil {
+			t.Errorf("%+v: no error", tt)
+		}
+	}
+}
+
+// TestTriggerStream runs rules on a stream of scans: OBS connecting to an
+// RTMP server, establishing, then closing, next to a browser no rule
+// matches.
+func TestTriggerStream(t *testing.T) {
+	tr, f, _ := triggerTracker(t,
+		mustTrigger(t, "start", "obs 1935", TriggerEstablished, "stream-start {app} {remote_addr}:{remote_port} {event}", "0s"),
+		mustTrigger(t, "stop", "obs 1935", TriggerClosed, "stream-stop {rule} {state}", "0s"),
+		mustTrigger(t, "any", "", TriggerOpened, "log {app} {proto}", "0s"),
+	)
+	src := &fakeSource{}
+	tr.SetSource(src)
+	browser := fakeConn("firefox", "192.0.2.1", 443)
+	src.set(browser)
+	tr.scan() // the baseline: nothing opens
+
+	obs := fakeConn("obs", "198.51.100.20", 1935)
+	obs.State = StateSynSent
+	src.set(browser, obs)
+	tr.scan()
+	settle(t, tr)
+	obs.State = StateEstablished
+	src.set(browser, obs)
+	tr.scan()
+	settle(t, tr)
+	tr.scan() // staying established does not fire again
+	src.set(browser)
+	tr.scan()
+	settle(t, tr)
+
+	want := []string{
+		"log obs tcp",
+		"stream-start obs 198.51.100.20:1935 established",
+		"stream-stop stop ESTABLISHED",
+	}
+	if got := f.commands(); !slices.Equal(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+	for _, r := range tr.Triggers() {
+		if r.Runs != 1 || r.Failures != 0 || r.Result == "" {
+			t.Errorf("%s: %d runs, %d failures, result %q", r.Name, r.Runs, r.Failures, r.Result)
+		}
+	}
+}
+
+func TestTriggerEnabled(t *testing.T) {
+	off := mustTrigger(t, "off", "", TriggerOpened, "echo {app}", "0s")
+	off.Disabled = true
+	tr, f, _ := triggerTracker(t, off)
+	c := fakeConn("curl", "192.0.2.1", 443)
+	tr.noteTrigger(TriggerOpened, &c, "")
+	tr.runTriggers(time.Now())
+	if len(f.commands()) != 0 {
+		t.Fatalf("a disabled rule ran %q", f.commands())
+	}
+
+	tr.SetTriggerEnabled("off", true)
+	tr.noteTrigger(TriggerOpened, &c, "")
+	tr.runTriggers(time.Now())
+	settle(t, tr)
+	if got := f.commands(); !slices.Equal(got, []string{"echo curl"}) {
+		t.Errorf("ran %q once enabled", got)
+	}
+
+	// Reloading keeps the runtime switch unless the configured one
+	// changed, and keeps the counters.
+	tr.SetTriggers([]TriggerRule{off})
+	if r := tr.Triggers()[0]; !r.Enabled || r.Runs != 1 {
+		t.Errorf("after a reload: %+v", r)
+	}
+	off.Disabled = false
+	tr.SetTriggerEnabled("off", false)
+	tr.SetTriggers([]TriggerRule{off})
+	if r := tr.Triggers()[0]; !r.Enabled {
+		t.Error("enabling in the config does not enable the rule")
+	}
+}
+
+// TestTriggerAlerts fires rules on the alert events, with the alert's
+// reason as {reason}.
+func TestTriggerAlerts(t *testing.T) {
+	tr, f, _ := triggerTracker(t,
+		mustTrigger(t, "bad", "game", TriggerAlerting, "notify {app} {reason}", "0s"),
+		mustTrigger(t, "good", "game", TriggerRecovered, "notify {app} ok", "0s"),
+	)
+	game, other := fakeConn("game", "203.0.113.5", 27015), fakeConn("browser", "192.0.2.1", 443)
+	now := time.Now()
+	tr.noteTrigger(TriggerAlerting, &game, "ping 250ms")
+	tr.noteTrigger(TriggerAlerting, &other, "ping 300ms")
+	tr.runTriggers(now)
+	settle(t, tr)
+	tr.noteTrigger(TriggerRecovered, &game, "ping 250ms")
+	tr.runTriggers(now.Add(time.Second))
+	settle(t, tr)
+	if got, want := f.commands(), []string{"notify game ping 250ms", "notify game ok"}; !slices.Equal(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestTriggerRateLimit(t *testing.T) {
+	tr, f, _ := triggerTracker(t, mustTrigger(t, "r", "", TriggerOpened, "echo {local_port}", "10s"))
+	now := time.Now()
+	fire := func(at time.Duration, ports ...int) {
+		for _, p := range ports {
+			c := fakeConn("curl", "192.0.2.1", p)
+			tr.noteTrigger(TriggerOpened, &c, "")
+		}
+		tr.runTriggers(now.Add(at))
+		settle(t, tr)
+	}
+	fire(0, 1, 2)           // the second within the same scan is too soon
+	fire(5*time.Second, 3)  // too soon
+	fire(10*time.Second, 4) // due
+	fire(15*time.Second, 5) // 5s after the last run
+	if got, want := f.commands(), []string{"echo 40001", "echo 40004"}; !slices.Equal(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+	if r := tr.Triggers()[0]; r.Runs != 2 || r.Skipped != 3 || !r.Last.Equal(now.Add(10*time.Second)) {
+		t.Errorf("%d runs, %d skipped, last %s", r.Runs, r.Skipped, r.Last)
+	}
+}
+
+// TestTriggerSlots fires more commands than there are slots: the ones
+// that find none are skipped, and the skips logged.
+func TestTriggerSlots(t *testing.T) {
+	tr, f, rec := triggerTracker(t, mustTrigger(t, "slow", "", TriggerOpened, "sleep {local_port}", "0s"))
+	f.hold = make(chan struct{})
+	for p := range maxTriggerRuns + 2 {
+		c := fakeConn("curl", "192.0.2.1", p)
+		tr.noteTrigger(TriggerOpened, &c, "")
+	}
+	tr.runTriggers(time.Now())
+	r := tr.Triggers()[0]
+	if r.Running != maxTriggerRuns || r.Skipped != 2 {
+		t.Errorf("%d running, %d skipped", r.Running, r.Skipped)
+	}
+	skips := rec.lines(EventTrigger)
+	if len(skips) != 2 || !strings.HasSuffix(skips[0], " skipped=all trigger slots busy") {
+		t.Errorf("events %q", skips)
+	}
+
+	close(f.hold)
+	settle(t, tr)
+	c := fakeConn("curl", "192.0.2.1", 99)
+	tr.noteTrigger(TriggerOpened, &c, "")
+	tr.runTriggers(time.Now())
+	settle(t, tr)
+	if r := tr.Triggers()[0]; r.Runs != maxTriggerRuns+1 {
+		t.Errorf("%d runs once the slots are free", r.Runs)
+	}
+}
+
+func TestTriggerFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		exit   int
+		stderr string
+		err    error
+		event  string
+		result string
+		failed bool
+	}{
+		{"ok", 0, "", nil,
+			"trigger rule=r event=opened app=curl remote=192.0.2.1:443 exit=0", "exit 0 after 0s", false},
+		{"ok with stderr", 0, "warning: slow\nmore\n", nil,
+			"trigger rule=r event=opened app=curl remote=192.0.2.1:443 exit=0 stderr=warning: slow", "exit 0 after 0s: warning: slow", false},
+		{"exit status", 3, "  no such stream  \n", nil,
+			"trigger rule=r event=opened app=curl remote=192.0.2.1:443 exit=3 stderr=no such stream", "exit 3 after 0s: no such stream", true},
+		{"not started", -1, "", errors.New(`exec: "stream-start": executable file not found in $PATH`),
+			`trigger rule=r event=opened app=curl remote=192.0.2.1:443 error=exec: "stream-start": executable file not found in $PATH`,
+			`failed: exec: "stream-start": executable file not found in $PATH`, true},
+		{"killed", -1, "partial", errors.New("killed after 1m0s"),
+			"trigger rule=r event=opened app=curl remote=192.0.2.1:443 error=killed after 1m0s stderr=partial", "failed: killed after 1m0s: partial", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, f, rec := triggerTracker(t, mustTrigger(t, "r", "", TriggerOpened, "stream-start", "0s"))
+			f.exit, f.stderr, f.err = tt.exit, tt.stderr, tt.err
+			c := fakeConn("curl", "192.0.2.1", 443)
+			tr.noteTrigger(TriggerOpened, &c, "")
+			tr.runTriggers(time.Now())
+			settle(t, tr)
+
+			lines := rec.lines(EventTrigger)
+			if len(lines) != 1 || durations.ReplaceAllString(lines[0], "") != tt.event {
+				t.Errorf("events %q, want %q", lines, tt.event)
+			}
+			r := tr.Triggers()[0]
+			if r.Runs != 1 || (r.Failures == 1) != tt.failed || r.Result != tt.result {
+				t.Errorf("%d runs, %d failures, result %q, want %q", r.Runs, r.Failures, r.Result, tt.result)
+			}
+			rec.mu.Lock()
+			sev := rec.events[0].Severity
+			rec.mu.Unlock()
+			if (sev == SeverityWarn) != tt.failed {
+				t.Errorf("severity %v", sev)
+			}
+		})
+	}
+}
+
+// TestRunTriggerCommand runs real commands: no shell between, exit status
+// and stderr captured, and killed at the timeout.
+func TestRunTriggerCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	exit, stderr, err := runTriggerCommand([]string{"sh", "-c", "echo oops >&2; exit 3"}, 5*time.Second)
+	if exit != 3 || stderr != "oops\n" || err != nil {
+		t.Errorf("exit %d, stderr %q, %v", exit, stderr, err)
+	}
+	// The argument reaches the program as one word, not through a shell.
+	exit, stderr, err = runTriggerCommand([]string{"sh", "-c", `echo "$0" >&2`, "a; touch pwned"}, 5*time.Second)
+	if exit != 0 || stderr != "a; touch pwned\n" || err != nil {
+		t.Errorf("exit %d, stderr %q, %v", exit, stderr, err)
+	}
+	if _, _, err = runTriggerCommand([]string{"sh", "-c", "sleep 5"}, 50*time.Millisecond); err == nil || err.Error() != "killed after 50ms" {
+		t.Errorf("timeout: %v", err)
+	}
+	if _, _, err = runTriggerCommand([]string{"definitely-not-a-command"}, time.Second); err == nil {
+		t.Error("no error for a missing program")
+	}
+	_, stderr, _ = runTriggerCommand([]string{"sh", "-c", "head -c 10000 /dev/zero | tr '\\0' x >&2"}, 5*time.Second)
+	if len(stderr) != maxTriggerStderr {
+		t.Errorf("%d bytes of stderr kept", len(stderr))
+	}
+}
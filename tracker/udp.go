@@ -0,0 +1,43 @@
+package tracker
+
+import "strconv"
+
+// IsListener reports whether c accepts traffic from any peer: a TCP LISTEN
+// socket or an unconnected UDP socket.
+func (c *Connection) IsListener() bool {
+	return c.State == StateListening || c.State == StateUnconnected
+}
+
+// correlateUDP sets the direction of UDP sockets. An unconnected socket is
+// inbound like a listener. A connected one is inbound when the same process
+// also has an unconnected socket on its local port (a server that connects
+// a socket per client, as some QUIC servers do), and outbound otherwise.
+// A wildcard bind of either family matches, as dual-stack sockets carry
+// both.
+func correlateUDP(conns []*Connection) {
+	listeners := make(map[string]bool)
+	for _, c := range conns {
+		if c.State == StateUnconnected {
+			listeners[udpListenKey(c, c.LocalAddr)] = true
+		}
+	}
+	for _, c := range conns {
+		if baseProtocol(c.Protocol) != "udp" {
+			continue
+		}
+		switch {
+		case c.State == StateUnconnected:
+			c.Direction = Inbound
+		case listeners[udpListenKey(c, c.LocalAddr)] || listeners[udpListenKey(c, "0.0.0.0")] || listeners[udpListenKey(c, "::")]:
+			c.Direction = Inbound
+		default:
+			c.Direction = Outbound
+		}
+	}
+}
+
+// udpListenKey identifies a UDP socket's bind: its host, namespace, PID,
+// address and port.
+func udpListenKey(c *Connection, addr string) string {
+	return c.Host + "|" + c.Namespace + "|" + strconv.Itoa(c.PID) + "|" + addr + "|" + strconv.Itoa(c.LocalPort)
+}
@@ -0,0 +1,46 @@
+package tracker
+
+import "testing"
+
+func TestCorrelateUDP(t *testing.T) {
+	udp := func(pid int, local string, port int, state ConnState, remote string) *Connection {
+		return &Connection{Protocol: "udp", PID: pid, LocalAddr: local, LocalPort: port, RemoteAddr: remote, RemotePort: 50000, State: state}
+	}
+	server := udp(10, "0.0.0.0", 443, StateUnconnected, "0.0.0.0")
+	perClient := udp(10, "192.0.2.10", 443, StateEstablished, "198.51.100.1")
+	dual := udp(11, "::", 4433, StateUnconnected, "::")
+	perClient6 := udp(11, "2001:db8::10", 4433, StateEstablished, "2001:db8::1")
+	otherPID := udp(12, "192.0.2.10", 443, StateEstablished, "198.51.100.2")
+	client := udp(13, "192.0.2.10", 41234, StateEstablished, "8.8.8.8")
+	tcp := &Connection{Protocol: "tcp", PID: 10, LocalAddr: "192.0.2.10", LocalPort: 443, State: StateEstablished, Direction: Inbound}
+	correlateUDP([]*Connection{server, perClient, dual, perClient6, otherPID, client, tcp})
+
+	tests := []struct {
+		name string
+		c    *Connection
+		want Direction
+	}{
+		{"unconnected", server, Inbound},
+		{"connected per client, same process and port", perClient, Inbound},
+		{"connected per client, dual-stack bind", perClient6, Inbound},
+		{"same port, other process", otherPID, Outbound},
+		{"client", client, Outbound},
+		{"tcp untouched", tcp, Inbound},
+	}
+	for _, tt := range tests {
+		if tt.c.Direction != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, tt.c.Direction, tt.want)
+		}
+	}
+	if !server.IsListener() || perClient.IsListener() {
+		t.Error("IsListener: an unconnected socket is one, a connected one is not")
+	}
+
+	got := FilterConnections([]*Connection{server, perClient, client}, "state:unconn")
+	if len(got) != 1 || got[0] != server {
+		t.Errorf("state:unconn matched %d", len(got))
+	}
+	if got := FilterConnections([]*Connection{server, perClient, client}, "state:established"); len(got) != 2 {
+		t.Errorf("state:established matched %d", len(got))
+	}
+}
@@ -0,0 +1,112 @@
+package tracker
+
+import (
+	"hash/maphash"
+	"math"
+	"time"
+)
+
+// viewSeed seeds the hashes behind viewSum.
+var viewSeed = maphash.MakeSeed()
+
+// connView is what the views show of a connection that a scan or its
+// probes can change. It leaves out the times every scan moves on
+// (LastUpdated, ConnAge, LastActive) and the probe counters, so a scan
+// that found the connection as it was hashes it the same.
+type connView struct {
+	host, namespace               string
+	pid                           int
+	app, client, protocol         string
+	local, remote                 string
+	localPort, remotePort         int
+	direction                     Direction
+	state                         ConnState
+	stateSince                    time.Time
+	stuck, newListener, halfOpen  bool
+	encryption                    Encryption
+	service, sni, quic            string
+	streams                       int
+	congestion                    string
+	qos                           QoS
+	sockMem, tx, rx, sendQ, recvQ uint64
+	txRate, rxRate                float64
+	ping, rawPing, kernelRTT      time.Duration
+	loss                          float64
+	lossTrend                     LossTrend
+	correction                    PingCorrection
+	pingSource                    string
+	proxy                         ProxyPing
+	stallSince, unreachableSince  time.Time
+	stallReason, halfOpenReason   string
+	check                         ServiceCheck
+	portShares                    int
+	score                         int
+	scoreWorst                    string
+	retransRate                   float64
+	audit                         int
+	tier                          PingTier
+	noProbe                       AddrClass
+}
+
+// derivedView is one user-defined column's value.
+type derivedView struct {
+	name  string
+	value uint64
+}
+
+// viewHash hashes what the views show of c.
+func (c *Connection) viewHash() uint64 {
+	v := connView{
+		host: c.Host, namespace: c.Namespace,
+		pid: c.PID, app: c.AppName, client: c.ClientName, protocol: c.Protocol,
+		local: c.LocalAddr, remote: c.RemoteAddr, localPort: c.LocalPort, remotePort: c.RemotePort,
+		direction: c.Direction, state: c.State, stateSince: c.StateSince,
+		stuck: c.Stuck, newListener: c.NewListener, halfOpen: c.HalfOpen,
+		encryption: c.Encryption, service: c.Service, sni: c.SNI, quic: c.QUICVersion,
+		streams: c.StreamHint, congestion: c.CongestionAlgo,
+		sockMem: c.SockMem, tx: c.TxBytes, rx: c.RxBytes, sendQ: c.SendQ, recvQ: c.RecvQ,
+		txRate: c.TxRate, rxRate: c.RxRate,
+		ping: c.Ping, rawPing: c.RawPing, kernelRTT: c.KernelRTT,
+		loss: c.Loss, lossTrend: c.LossTrend, correction: c.PingCorrection, pingSource: c.PingSource,
+		stallSince: c.StallSince, unreachableSince: c.UnreachableSince,
+		stallReason: c.StallReason, halfOpenReason: c.HalfOpenReason,
+		score: c.Score, scoreWorst: c.ScoreWorst, retransRate: c.RetransRate,
+		audit: c.Audit.Score, tier: c.PingTier, noProbe: c.NoProbe,
+	}
+	if c.QoS != nil {
+		v.qos = *c.QoS
+	}
+	if c.Proxy != nil {
+		v.proxy = *c.Proxy
+	}
+	if c.ServiceCheck != nil {
+		v.check = *c.ServiceCheck
+	}
+	if c.PortShare != nil {
+		v.portShares = len(c.PortShare.Members)
+	}
+	h := maphash.Comparable(viewSeed, v)
+	for name, x := range c.Derived {
+		h += maphash.Comparable(viewSeed, derivedView{name, math.Float64bits(x)})
+	}
+	return h
+}
+
+// viewSum sums the view hashes of the tracked connections, which makes
+// it independent of map order. Caller must hold the lock.
+func (t *Tracker) viewSum() uint64 {
+	var sum uint64
+	for _, c := range t.connections {
+		sum += c.viewHash()
+	}
+	return sum
+}
+
+// touchIfChanged moves Generation on if a connection was added, removed
+// or shows something else since the last call. Caller must hold the lock.
+func (t *Tracker) touchIfChanged() {
+	if sum := t.viewSum(); sum != t.lastView || len(t.connections) != t.lastViewConns {
+		t.lastView, t.lastViewConns = sum, len(t.connections)
+		t.touch()
+	}
+}
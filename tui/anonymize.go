@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// anonymizer masks addresses, app names and host names for screen sharing.
+// It only affects rendering: the tracker keeps real data. Masks are derived
+// from a per-run random seed, so equal inputs map to equal outputs within a
+// session but cannot be reversed or correlated across runs.
+type anonymizer struct {
+	seed []byte
+
+	mu    sync.Mutex
+	apps  map[string]string
+	hosts map[string]string
+}
+
+func newAnonymizer() *anonymizer {
+	seed := make([]byte, 32)
+	rand.Read(seed)
+	return &anonymizer{
+		seed:  seed,
+		apps:  make(map[string]string),
+		hosts: make(map[string]string),
+	}
+}
+
+// app returns a stable pseudonym like "app-07", numbered in order of first use.
+func (a *anonymizer) app(name string) string {
+	return a.pseudonym(a.apps, "app", name)
+}
+
+// host returns a stable pseudonym like "host-02" for an agent address.
+func (a *anonymizer) host(name string) string {
+	return a.pseudonym(a.hosts, "host", name)
+}
+
+func (a *anonymizer) pseudonym(m map[string]string, prefix, name string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p, ok := m[name]; ok {
+		return p
+	}
+	p := fmt.Sprintf("%s-%02d", prefix, len(m)+1)
+	m[name] = p
+	return p
+}
+
+// addr keeps the first octet of an IPv4 address (first 48 bits of IPv6) and
+// replaces the rest with a keyed hash. Wildcard and loopback addresses, and
+// anything that is not an IP, are returned unchanged.
+func (a *anonymizer) addr(s string) string {
+	ip, err := netip.ParseAddr(s)
+	if err != nil || ip.IsUnspecified() || ip.IsLoopback() {
+		return s
+	}
+
+	mac := hmac.New(sha256.New, a.seed)
+	mac.Write(ip.AsSlice())
+	sum := mac.Sum(nil)
+
+	if ip.Is4() {
+		b := ip.As4()
+		return fmt.Sprintf("%d.%d.%d.%d", b[0], sum[0], sum[1], sum[2])
+	}
+	b := ip.As16()
+	return fmt.Sprintf("%x:%x:%x:%x:%x::", uint16(b[0])<<8|uint16(b[1]), uint16(b[2])<<8|uint16(b[3]),
+		uint16(b[4])<<8|uint16(b[5]), uint16(sum[0])<<8|uint16(sum[1]), uint16(sum[2])<<8|uint16(sum[3]))
+}
+
+// prefix masks the address part of a CIDR prefix such as "10.1.2.0/24".
+func (a *anonymizer) prefix(s string) string {
+	addr, bits, ok := strings.Cut(s, "/")
+	if !ok {
+		return a.addr(s)
+	}
+	return a.addr(addr) + "/" + bits
+}
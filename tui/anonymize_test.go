@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+func TestAnonymizerAddr(t *testing.T) {
+	a := newAnonymizer()
+	for _, in := range []string{"192.168.1.23", "10.0.0.5", "2001:db8:aa:1::5"} {
+		got := a.addr(in)
+		if got == in {
+			t.Errorf("%s not masked", in)
+		}
+		if again := a.addr(in); again != got {
+			t.Errorf("%s: %s then %s", in, got, again)
+		}
+	}
+	if got := a.addr("192.168.1.23"); !strings.HasPrefix(got, "192.") {
+		t.Errorf("first octet lost: %s", got)
+	}
+	if got := a.addr("2001:db8:aa:1::5"); !strings.HasPrefix(got, "2001:db8:aa:") {
+		t.Errorf("48-bit prefix lost: %s", got)
+	}
+	for _, keep := range []string{"0.0.0.0", "::", "127.0.0.1", "::1", "*", "example.com"} {
+		if got := a.addr(keep); got != keep {
+			t.Errorf("%s masked to %s", keep, got)
+		}
+	}
+	if got := a.prefix("10.1.2.0/24"); !strings.HasPrefix(got, "10.") || !strings.HasSuffix(got, "/24") || got == "10.1.2.0/24" {
+		t.Errorf("prefix masked to %s", got)
+	}
+}
+
+func TestAnonymizerNoVisibleCollisions(t *testing.T) {
+	// With a fixed seed the masks are fixed, so this is not flaky.
+	a := &anonymizer{seed: []byte("fixed test seed"), apps: map[string]string{}, hosts: map[string]string{}}
+	seen := make(map[string]string)
+	for i := range 256 {
+		in := fmt.Sprintf("10.0.0.%d", i)
+		out := a.addr(in)
+		if prev, ok := seen[out]; ok {
+			t.Fatalf("%s and %s both mask to %s", prev, in, out)
+		}
+		seen[out] = in
+	}
+}
+
+func TestAnonymizerSessions(t *testing.T) {
+	a, b := newAnonymizer(), newAnonymizer()
+	if a.addr("192.0.2.1") == b.addr("192.0.2.1") {
+		t.Error("two runs mask an address the same way")
+	}
+
+	if got := a.app("firefox"); got != "app-01" {
+		t.Errorf("first app is %s", got)
+	}
+	if got := a.app("ssh"); got != "app-02" {
+		t.Errorf("second app is %s", got)
+	}
+	if got := a.app("firefox"); got != "app-01" {
+		t.Errorf("firefox renamed to %s", got)
+	}
+	if got := a.host("db1:8080"); got != "host-01" {
+		t.Errorf("host is %s", got)
+	}
+}
+
+func TestAnonymizeDisplayOnly(t *testing.T) {
+	c := &tracker.Connection{AppName: "firefox", RemoteAddr: "192.0.2.1"}
+	m, _ := press(t, newTestModel(), "f9")
+	if m.appName(c) == "firefox" || m.addr(c.RemoteAddr) == "192.0.2.1" || m.hostName("db1") == "db1" {
+		t.Fatal("not masked while on")
+	}
+	if c.AppName != "firefox" || c.RemoteAddr != "192.0.2.1" {
+		t.Fatal("the connection itself was changed")
+	}
+	m, _ = press(t, m, "f9")
+	if m.appName(c) != "firefox" || m.addr(c.RemoteAddr) != "192.0.2.1" || m.hostName("") != "local" {
+		t.Fatal("still masked after turning it off")
+	}
+}
@@ -0,0 +1,22 @@
+package tui
+
+import (
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// auditHighScore is the score from which the audit badge turns red.
+const auditHighScore = 50
+
+// auditBadge returns the App column badge for a connection with audit
+// findings: "!" for a low score, "!!" from auditHighScore up.
+func (m Model) auditBadge(c *tracker.Connection) (string, lipgloss.Style) {
+	switch {
+	case c.Audit.Score >= auditHighScore:
+		return "!!", m.st(styleAuditHigh)
+	case c.Audit.Score > 0:
+		return "!", m.st(styleAuditLow)
+	}
+	return "", lipgloss.Style{}
+}
@@ -0,0 +1,34 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// budgetBanner is the warning shown while the daily probe budget is used
+// up; "" otherwise.
+func (m Model) budgetBanner() string {
+	u := m.probeUsage
+	if !u.Exceeded {
+		return ""
+	}
+	return fmt.Sprintf("Probe budget of %s/day used up at %s: probes are off until midnight, pings show what the kernel reports",
+		tracker.FormatBytesTotal(u.Budget), m.times.clock(u.ExceededAt, time.Now()))
+}
+
+// probeTrafficSummary is the D view line on probe traffic.
+func (m Model) probeTrafficSummary() string {
+	u := m.tracker.ProbeUsage()
+	s := fmt.Sprintf("  probe traffic: session %s sent, %s received; today %s",
+		tracker.FormatBytesTotal(u.Session.Sent), tracker.FormatBytesTotal(u.Session.Received),
+		tracker.FormatBytesTotal(u.Today.Total()))
+	if u.Budget > 0 {
+		s += fmt.Sprintf(" of %s budget", tracker.FormatBytesTotal(u.Budget))
+		if u.Exceeded {
+			s += ", used up since " + m.times.format(u.ExceededAt, time.Now())
+		}
+	}
+	return s
+}
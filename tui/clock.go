@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// refreshClock notes a suspend/resume or clock step seen since the last
+// refresh in the status bar and the delta log.
+func (m *Model) refreshClock() {
+	for _, e := range m.tracker.ClockEvents() {
+		if !e.Time.After(m.clockSeen) {
+			continue
+		}
+		m.clockSeen = e.Time
+		note := clockText(e)
+		m.notice = note + ": rates and trends start over"
+		m.deltaLog = append(m.deltaLog, deltaEntry{Time: e.Time, Note: note})
+	}
+}
+
+// clockText describes a clock event: "Resumed after 2h 13m" or "Clock set
+// back 1h 0m".
+func clockText(e tracker.ClockEvent) string {
+	if e.Kind == tracker.ClockStepped {
+		return "Clock set back " + compactDuration(-e.Gap)
+	}
+	return "Resumed after " + compactDuration(e.Gap)
+}
+
+// gapRow is the D view's separator below the first scan after a suspend or
+// clock step.
+func (m Model) gapRow(gap time.Duration) string {
+	text := "resumed after " + compactDuration(gap)
+	if gap < 0 {
+		text = "clock set back " + compactDuration(-gap)
+	}
+	return m.st(styleWarn).Render(fmt.Sprintf("  ── %s ──", text))
+}
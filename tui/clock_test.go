@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func TestClockText(t *testing.T) {
+	tests := []struct {
+		e    tracker.ClockEvent
+		text string
+		row  string
+	}{
+		{tracker.ClockEvent{Kind: tracker.ClockResumed, Gap: 2*time.Hour + 13*time.Minute}, "Resumed after 2h 13m", "── resumed after 2h 13m ──"},
+		{tracker.ClockEvent{Kind: tracker.ClockStepped, Gap: -time.Hour}, "Clock set back 1h 0m", "── clock set back 1h 0m ──"},
+		{tracker.ClockEvent{Kind: tracker.ClockResumed, Gap: 45 * time.Second}, "Resumed after 45s", "── resumed after 45s ──"},
+	}
+	m := newTestModel()
+	for _, tt := range tests {
+		if got := clockText(tt.e); got != tt.text {
+			t.Errorf("%+v: %q, want %q", tt.e, got, tt.text)
+		}
+		if got := m.gapRow(tt.e.Gap); strings.TrimSpace(got) != tt.row {
+			t.Errorf("%+v: gap row %q", tt.e, got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ping-tracker/tracker"
+)
+
+// closingMode is how the table shows sockets in a closing state
+// (TIME_WAIT, FIN_WAIT2, LAST_ACK).
+type closingMode int
+
+const (
+	closingByApp closingMode = iota
+	closingByPort
+	closingExpanded
+)
+
+var closingModeNames = []string{"summarized by app", "summarized by local port", "listed"}
+
+// SetShowClosing starts with closing-state sockets listed one per row
+// instead of summarized (toggle with H).
+func (m *Model) SetShowClosing(on bool) {
+	m.closingMode = closingByApp
+	if on {
+		m.closingMode = closingExpanded
+	}
+}
+
+// collapseClosing counts the closing-state sockets among the rows and,
+// unless they are listed or group rows are shown, replaces them with one
+// summary row per app or local port. Called from refresh after grouping.
+func (m *Model) collapseClosing() {
+	m.closing = 0
+	for _, c := range m.connections {
+		if c.State.Closing() {
+			m.closing++
+		}
+	}
+	m.active = len(m.connections) - m.closing
+	if m.closingMode == closingExpanded || m.listingGroups() || m.closing == 0 {
+		return
+	}
+	by := tracker.ClosingByApp
+	if m.closingMode == closingByPort {
+		by = tracker.ClosingByPort
+	}
+	m.connections, _ = tracker.CollapseClosing(m.connections, by, m.tracker.ClosingRates(by))
+}
+
+// cycleClosing switches between summarizing closing sockets by app, by
+// local port, and listing them (H).
+func (m *Model) cycleClosing() {
+	m.closingMode = (m.closingMode + 1) % closingMode(len(closingModeNames))
+	m.cursor = 0
+	m.offset = 0
+	m.rows.reset()
+	m.refresh()
+	m.notice = "Closing sockets " + closingModeNames[m.closingMode]
+}
+
+// compareClosing orders summary rows after connections, and among
+// themselves by socket count, largest first when ascending. ok is false
+// when neither is a summary row.
+func (m Model) compareClosing(a, b *tracker.Connection) (less, ok bool) {
+	switch {
+	case a.Closing == nil && b.Closing == nil:
+		return false, false
+	case a.Closing == nil || b.Closing == nil:
+		return b.Closing != nil, true
+	}
+	cmp := b.Closing.Count - a.Closing.Count
+	if !m.sortAsc {
+		cmp = -cmp
+	}
+	if cmp == 0 {
+		return a.Closing.Key < b.Closing.Key, true
+	}
+	return cmp < 0, true
+}
+
+// closingLabel is the App cell of a summary row: the app, or the local
+// port when summarizing by port.
+func (m Model) closingLabel(c *tracker.Connection) string {
+	if c.Closing.By == tracker.ClosingByPort {
+		return fmt.Sprintf(":%d", c.LocalPort)
+	}
+	return m.appName(c)
+}
+
+// closingText describes a summary row after its App cell: the count by
+// state, the rate of new entries and, by port, the apps.
+func (m Model) closingText(c *tracker.Connection) string {
+	s := c.Closing
+	states := make([]tracker.ConnState, 0, len(s.States))
+	for st := range s.States {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if s.States[states[i]] != s.States[states[j]] {
+			return s.States[states[i]] > s.States[states[j]]
+		}
+		return states[i] < states[j]
+	})
+	var b strings.Builder
+	if len(states) == 1 {
+		fmt.Fprintf(&b, "%d %s", s.Count, states[0])
+	} else {
+		parts := make([]string, len(states))
+		for i, st := range states {
+			parts[i] = fmt.Sprintf("%d %s", s.States[st], st)
+		}
+		fmt.Fprintf(&b, "%d closing: %s", s.Count, strings.Join(parts, ", "))
+	}
+	if s.HasRate {
+		b.WriteString(", " + ratePerMinute(s.PerMinute) + " new")
+	}
+	if s.By == tracker.ClosingByPort {
+		apps := make([]string, len(s.Apps))
+		for i, a := range s.Apps {
+			if m.anon != nil {
+				a = m.anon.app(a)
+			}
+			apps[i] = a
+		}
+		b.WriteString(" (" + strings.Join(apps, ", ") + ")")
+	}
+	return b.String()
+}
+
+func ratePerMinute(r float64) string {
+	if r >= 10 || r == 0 {
+		return fmt.Sprintf("%.0f/min", r)
+	}
+	return fmt.Sprintf("%.1f/min", r)
+}
+
+// renderClosingRow renders a summary row: its label in the App column and
+// its description across the columns after it.
+func (m Model) renderClosingRow(c *tracker.Connection, l tableLayout) string {
+	hostCell := ""
+	if l.host > 0 {
+		hostCell = padRight(truncStr(m.hostName(c.Host), l.host), l.host) + " "
+	}
+	if l.netns > 0 {
+		hostCell += padRight("", l.netns) + " "
+	}
+	return hostCell + padLeft("-", l.pid) + " " + padRight(truncStr(m.closingLabel(c), l.app), l.app) + " " +
+		m.st(styleStale).Render(m.closingText(c))
+}
+
+// shortCount abbreviates large counts for the title: 18k rather than 18204.
+func shortCount(n int) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e4:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
@@ -0,0 +1,151 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+// closingModel has two connections and five closing sockets: three of
+// nginx on :443 and :80, one of haproxy on :443, one of sshd.
+func closingModel(t *testing.T) Model {
+	closing := func(app string, pid, local int, remote string, state tracker.ConnState) tracker.Connection {
+		c := testConn(app, pid, remote, 50000)
+		c.LocalPort, c.State, c.Direction = local, state, tracker.Inbound
+		return c
+	}
+	return newTestModelWith(t,
+		testConn("curl", 100, "192.0.2.1", 443),
+		closing("nginx", 200, 443, "198.51.100.1", tracker.StateTimeWait),
+		closing("nginx", 200, 443, "198.51.100.2", tracker.StateTimeWait),
+		closing("nginx", 200, 80, "198.51.100.3", tracker.StateFinWait2),
+		closing("haproxy", 300, 443, "198.51.100.4", tracker.StateTimeWait),
+		closing("sshd", 400, 22, "198.51.100.5", tracker.StateLastAck),
+		testConn("wget", 500, "192.0.2.2", 80),
+	)
+}
+
+// rowLabels is each row's app, or its summary's label and text.
+func rowLabels(m Model) []string {
+	var out []string
+	for _, c := range m.connections {
+		if c.Closing != nil {
+			out = append(out, m.closingLabel(c)+" "+m.closingText(c))
+		} else {
+			out = append(out, c.AppName)
+		}
+	}
+	return out
+}
+
+func TestClosingCycle(t *testing.T) {
+	m := closingModel(t)
+	want := []string{"curl", "wget",
+		"nginx 3 closing: 2 TIME_WAIT, 1 FIN_WAIT2, 0/min new",
+		"haproxy 1 TIME_WAIT, 0/min new",
+		"sshd 1 LAST_ACK, 0/min new",
+	}
+	if got := rowLabels(m); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("by app:\n%s", strings.Join(got, "\n"))
+	}
+	if got := m.titleText(); !strings.HasPrefix(got, "Ping Tracker - 2 active + 5 closing") {
+		t.Errorf("title %q", got)
+	}
+
+	m, _ = press(t, m, "H")
+	want = []string{"curl", "wget",
+		":443 3 TIME_WAIT, 0/min new (haproxy, nginx)",
+		":22 1 LAST_ACK, 0/min new (sshd)",
+		":80 1 FIN_WAIT2, 0/min new (nginx)",
+	}
+	if got := rowLabels(m); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("by port:\n%s", strings.Join(got, "\n"))
+	}
+	if m.notice != "Closing sockets summarized by local port" {
+		t.Errorf("notice %q", m.notice)
+	}
+
+	m, _ = press(t, m, "H")
+	if len(m.connections) != 7 || m.notice != "Closing sockets listed" {
+		t.Errorf("listed: %d rows, notice %q", len(m.connections), m.notice)
+	}
+	if got := m.titleText(); !strings.HasPrefix(got, "Ping Tracker - 2 active + 5 closing") {
+		t.Errorf("listed title %q", got)
+	}
+
+	m, _ = press(t, m, "H")
+	if m.closingMode != closingByApp || len(m.connections) != 5 {
+		t.Errorf("back to by app: mode %d, %d rows", m.closingMode, len(m.connections))
+	}
+
+	listed := closingModel(t)
+	listed.SetShowClosing(true)
+	listed.refresh()
+	if len(listed.connections) != 7 {
+		t.Errorf("-show-terminal-states: %d rows", len(listed.connections))
+	}
+}
+
+// TestClosingSort keeps summary rows after connections whichever way the
+// table is sorted, largest first when ascending and last when descending.
+func TestClosingSort(t *testing.T) {
+	for _, keys := range [][]string{nil, {"1"}, {"1", "1"}, {"2"}, {"2", "2"}} {
+		m, _ := press(t, closingModel(t), keys...)
+		rows := m.connections
+		if len(rows) != 5 || rows[0].Closing != nil || rows[1].Closing != nil {
+			t.Fatalf("sorted by %v: %q", keys, rowLabels(m))
+		}
+		largest := 2
+		if !m.sortAsc {
+			largest = 4
+		}
+		if rows[largest].Closing == nil || rows[largest].Closing.Count != 3 {
+			t.Errorf("sorted by %v (ascending %v): %q", keys, m.sortAsc, rowLabels(m))
+		}
+	}
+}
+
+func TestClosingEnter(t *testing.T) {
+	m := closingModel(t)
+	m, _ = press(t, m, "j", "j", "enter")
+	if _, ok := findMode[*detailMode](m); ok || !strings.Contains(m.notice, "Press H") {
+		t.Errorf("Enter on a summary row: notice %q", m.notice)
+	}
+}
+
+func TestClosingFilter(t *testing.T) {
+	m := closingModel(t)
+	m.filter = "nginx"
+	m.refresh()
+	if got := rowLabels(m); len(got) != 1 || !strings.HasPrefix(got[0], "nginx 3 closing") {
+		t.Errorf("filtered: %q", got)
+	}
+	if got := m.titleText(); !strings.HasPrefix(got, "Ping Tracker - 0 active + 3 closing") {
+		t.Errorf("filtered title %q", got)
+	}
+}
+
+func TestClosingFormat(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 9999: "9999", 18204: "18k", 2_500_000: "2.5M"} {
+		if got := shortCount(n); got != want {
+			t.Errorf("shortCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+	for r, want := range map[float64]string{0: "0/min", 0.5: "0.5/min", 9.96: "10.0/min", 12.4: "12/min"} {
+		if got := ratePerMinute(r); got != want {
+			t.Errorf("ratePerMinute(%v) = %q, want %q", r, got, want)
+		}
+	}
+	m := newTestModel()
+	c := &tracker.Connection{AppName: "nginx", Closing: &tracker.ClosingSummary{Count: 1200, HasRate: true, PerMinute: 340,
+		States: map[tracker.ConnState]int{tracker.StateTimeWait: 1200}, Apps: []string{"nginx"}}}
+	if got := m.closingText(c); got != "1200 TIME_WAIT, 340/min new" {
+		t.Errorf("closingText %q", got)
+	}
+	c.Closing.HasRate = false
+	if got := fmt.Sprint(m.closingLabel(c), " ", m.closingText(c)); got != "nginx 1200 TIME_WAIT" {
+		t.Errorf("remote summary %q", got)
+	}
+}
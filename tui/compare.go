@@ -0,0 +1,226 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxReferences is how many pinned snapshots are kept; pinning another
+// drops the oldest.
+const maxReferences = 5
+
+// compareView is the F6 overlay: the list of pinned references, or the
+// comparison of the current snapshot against one of them.
+type compareView struct {
+	selected  int  // reference highlighted in the list
+	comparing bool // showing the comparison instead of the list
+	offset    int  // first comparison line shown
+}
+
+// compareMode is the F6 reference list; comparisonMode, over it, compares
+// one reference with now.
+type (
+	compareMode    struct{}
+	comparisonMode struct{}
+)
+
+// pinReference pins the latest unfiltered snapshot as a reference (F5).
+func (m *Model) pinReference() {
+	if m.deltaPrev == nil {
+		m.notice = "Nothing to pin yet"
+		return
+	}
+	m.refSeq++
+	ref := tracker.NewReference(fmt.Sprintf("R%d", m.refSeq), time.Now(), m.deltaPrev)
+	m.refs = append(m.refs, ref)
+	if over := len(m.refs) - maxReferences; over > 0 {
+		m.refs = append(m.refs[:0:0], m.refs[over:]...)
+	}
+	m.notice = fmt.Sprintf("Pinned %s (%d connections); F6 compares", ref.Name, len(ref.Conns))
+}
+
+// openCompare opens the reference list (F6).
+func (m *Model) openCompare() {
+	if len(m.refs) == 0 {
+		m.notice = "No pinned snapshots; F5 pins one"
+		return
+	}
+	m.compare = &compareView{selected: len(m.refs) - 1}
+	m.pushMode(&compareMode{})
+}
+
+func (c *compareMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	v := m.compare
+	switch msg.String() {
+	case "f6":
+		m.cancelMode(c)
+	case "up", "k":
+		if v.selected > 0 {
+			v.selected--
+		}
+	case "down", "j":
+		if v.selected < len(m.refs)-1 {
+			v.selected++
+		}
+	case "enter":
+		v.comparing, v.offset = true, 0
+		m.pushMode(&comparisonMode{})
+	case "d":
+		m.refs = append(m.refs[:v.selected:v.selected], m.refs[v.selected+1:]...)
+		if len(m.refs) == 0 {
+			m.cancelMode(c)
+		} else if v.selected >= len(m.refs) {
+			v.selected = len(m.refs) - 1
+		}
+	case "T":
+		m.times.absolute = !m.times.absolute
+	}
+	return m, nil, true
+}
+
+func (c *compareMode) cancel(m *Model) {
+	m.compare = nil
+}
+
+func (c *compareMode) view(m Model) string { return m.renderCompare() }
+
+func (c *comparisonMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	v := m.compare
+	switch msg.String() {
+	case "f6":
+		m.cancelMode(c)
+		if list, ok := findMode[*compareMode](m); ok {
+			m.cancelMode(list)
+		}
+	case "up", "k":
+		if v.offset > 0 {
+			v.offset--
+		}
+	case "down", "j":
+		v.offset++
+	case "home", "g":
+		v.offset = 0
+	case "T":
+		m.times.absolute = !m.times.absolute
+	case "p":
+		m.togglePause()
+	}
+	return m, nil, true
+}
+
+func (c *comparisonMode) cancel(m *Model) {
+	m.compare.comparing = false
+}
+
+// renderCompare draws the F6 overlay.
+func (m Model) renderCompare() string {
+	if m.compare.comparing {
+		return m.renderComparison(m.refs[m.compare.selected])
+	}
+	now := time.Now()
+	lines := []string{m.st(styleTitle).Render(fmt.Sprintf("Pinned snapshots (%d of %d)", len(m.refs), maxReferences)), ""}
+	for i, ref := range m.refs {
+		line := fmt.Sprintf("  %-4s %-14s %d connections", ref.Name, m.times.format(ref.Time, now), len(ref.Conns))
+		if i == m.compare.selected {
+			line = m.st(styleSelection).Render(padRight(line, m.width))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", m.st(styleStatus).Render("Enter: compare with now  d: delete  F5 (in the table): pin  Esc/F6: close"))
+	return strings.Join(lines, "\n")
+}
+
+// renderComparison lists what was added, removed and changed since ref,
+// filtered like the table.
+func (m Model) renderComparison(ref tracker.Reference) string {
+	now := time.Now()
+	cur := tracker.FilterConnections(m.deltaPrev, m.filter)
+	ref.Conns = tracker.FilterConnections(ref.Conns, m.filter)
+	cmp := ref.Compare(cur)
+
+	var changed []tracker.ConnDelta
+	for _, d := range cmp.Changed {
+		if d.Magnitude() > 0 {
+			changed = append(changed, d)
+		}
+	}
+
+	pauseStr := ""
+	if m.paused {
+		pauseStr = " [PAUSED]"
+	}
+	title := fmt.Sprintf("Now vs. %s (%s): %d added, %d removed, %d changed, %d unchanged%s",
+		ref.Name, m.times.format(ref.Time, now), len(cmp.Added), len(cmp.Removed), len(changed), len(cmp.Changed)-len(changed), pauseStr)
+	head := []string{m.st(styleTitle).Render(truncate(title, m.width-1))}
+	if m.filter != "" {
+		head = append(head, m.st(styleSearch).Render("Filter: ")+m.filter)
+	} else {
+		head = append(head, "")
+	}
+
+	var body []string
+	section := func(name string, n int) {
+		body = append(body, m.st(styleHeader).Render(truncate(fmt.Sprintf(" %s (%d)", name, n), m.width)))
+	}
+	section("Added", len(cmp.Added))
+	for _, c := range cmp.Added {
+		body = append(body, m.st(styleGood).Render(m.compareConn(c, string(c.State))))
+	}
+	section("Removed", len(cmp.Removed))
+	for _, c := range cmp.Removed {
+		body = append(body, m.st(styleStale).Render(m.compareConn(c, string(c.State))))
+	}
+	section("Changed, largest first", len(changed))
+	for _, d := range changed {
+		line := m.compareConn(d.New, describeDelta(d))
+		if d.Ping > 0 {
+			line = m.st(styleBad).Render(line)
+		}
+		body = append(body, line)
+	}
+
+	rows := maxInt(1, m.height-len(head)-2)
+	start := minInt(m.compare.offset, maxInt(0, len(body)-rows))
+	end := minInt(start+rows, len(body))
+	lines := append(head, body[start:end]...)
+	for i := len(lines); i < m.height-1; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.st(styleStatus).Render("Esc: references  j/k: scroll  T: times  p: pause  F6: close"))
+	return strings.Join(lines, "\n")
+}
+
+// compareConn is one comparison line: app, remote endpoint and detail.
+func (m Model) compareConn(c *tracker.Connection, detail string) string {
+	remote := fmt.Sprintf("%s:%d", m.addr(c.RemoteAddr), c.RemotePort)
+	return truncate(fmt.Sprintf("  %-18s %-6s %-28s %s", truncStr(m.appName(c), 18), c.DisplayProtocol(),
+		truncStr(remote, 28), detail), m.width)
+}
+
+// describeDelta lists the metrics that moved: ping, rates and the bytes
+// moved since the reference.
+func describeDelta(d tracker.ConnDelta) string {
+	var parts []string
+	if d.Ping != 0 {
+		parts = append(parts, fmt.Sprintf("ping %s -> %s", fmtDur(d.Old.Ping), fmtDur(d.New.Ping)))
+	}
+	if d.TxRate != 0 {
+		parts = append(parts, fmt.Sprintf("TX %s -> %s", tracker.FormatBytes(d.Old.TxRate), tracker.FormatBytes(d.New.TxRate)))
+	}
+	if d.RxRate != 0 {
+		parts = append(parts, fmt.Sprintf("RX %s -> %s", tracker.FormatBytes(d.Old.RxRate), tracker.FormatBytes(d.New.RxRate)))
+	}
+	if d.TxBytes > 0 || d.RxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("moved %s up, %s down",
+			tracker.FormatBytesTotal(uint64(max(d.TxBytes, 0))), tracker.FormatBytesTotal(uint64(max(d.RxBytes, 0)))))
+	}
+	if d.Linked {
+		parts = append(parts, "(replacement socket)")
+	}
+	return strings.Join(parts, ", ")
+}
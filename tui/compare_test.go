@@ -0,0 +1,91 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func TestPinReferences(t *testing.T) {
+	m := newTestModel()
+	m, _ = press(t, m, "f5")
+	if m.notice != "Nothing to pin yet" || len(m.refs) != 0 {
+		t.Fatalf("pinned before the first scan: %q", m.notice)
+	}
+	m, _ = press(t, m, "f6")
+	if _, ok := findMode[*compareMode](m); ok || !strings.HasPrefix(m.notice, "No pinned snapshots") {
+		t.Fatalf("F6 without references: %q", m.notice)
+	}
+
+	m = newTestModelWith(t, testConn("web", 1, "192.0.2.1", 443))
+	for range maxReferences + 2 {
+		m, _ = press(t, m, "f5")
+	}
+	if len(m.refs) != maxReferences || m.refs[0].Name != "R3" || m.refs[maxReferences-1].Name != "R7" {
+		t.Fatalf("kept %d references from %s", len(m.refs), m.refs[0].Name)
+	}
+	if m.notice != "Pinned R7 (1 connections); F6 compares" {
+		t.Errorf("notice %q", m.notice)
+	}
+
+	// F6 selects the newest; d deletes it and the selection follows.
+	m, _ = press(t, m, "f6", "d")
+	if len(m.refs) != maxReferences-1 || m.compare.selected != maxReferences-2 {
+		t.Fatalf("%d references, selected %d", len(m.refs), m.compare.selected)
+	}
+	m, _ = press(t, m, "d", "d", "d", "d")
+	if _, ok := findMode[*compareMode](m); ok || m.compare != nil {
+		t.Error("list still open without references")
+	}
+}
+
+func TestComparisonView(t *testing.T) {
+	m := newTestModelWith(t, testConn("web", 1, "192.0.2.1", 443))
+	m.width, m.height = 120, 30
+	old := m.deltaPrev[0]
+	slow := *old
+	slow.Ping, slow.PingCount = 90*time.Millisecond, 3
+	base := *old
+	base.Ping, base.PingCount = 20*time.Millisecond, 3
+	m.refs = []tracker.Reference{tracker.NewReference("R1", time.Now(), []*tracker.Connection{&base, {AppName: "gone", RemoteAddr: "198.51.100.9", RemotePort: 22}})}
+	fresh := testConn("new", 2, "203.0.113.1", 80)
+	m.deltaPrev = []*tracker.Connection{&slow, &fresh}
+
+	m, _ = press(t, m, "f6", "enter")
+	if _, ok := findMode[*comparisonMode](m); !ok {
+		t.Fatal("comparison not open")
+	}
+	view := m.View()
+	for _, want := range []string{
+		"Now vs. R1", "1 added, 1 removed, 1 changed, 0 unchanged",
+		"Added (1)", "new", "Removed (1)", "gone", "Changed, largest first (1)", "ping 20ms -> 90ms",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("comparison lacks %q:\n%s", want, view)
+		}
+	}
+
+	// Esc goes back to the list, F6 closes everything.
+	m, _ = press(t, m, "esc")
+	if _, ok := findMode[*compareMode](m); !ok || m.compare.comparing {
+		t.Fatal("Esc did not return to the list")
+	}
+	m, _ = press(t, m, "enter", "f6")
+	if _, ok := findMode[*compareMode](m); ok {
+		t.Error("F6 left the list open")
+	}
+}
+
+func TestDescribeDelta(t *testing.T) {
+	old := &tracker.Connection{Ping: 20 * time.Millisecond, TxRate: 1024}
+	cur := &tracker.Connection{Ping: 35 * time.Millisecond, TxRate: 4096}
+	d := tracker.ConnDelta{Old: old, New: cur, Ping: 15 * time.Millisecond, TxRate: 3072, TxBytes: 2048, RxBytes: -5, Linked: false}
+	if got := describeDelta(d); got != "ping 20ms -> 35ms, TX 1.0 KB/s -> 4.0 KB/s, moved 2.0 KB up, 0 B down" {
+		t.Errorf("got %q", got)
+	}
+	if got := describeDelta(tracker.ConnDelta{Old: old, New: cur, Linked: true}); got != "(replacement socket)" {
+		t.Errorf("linked: %q", got)
+	}
+}
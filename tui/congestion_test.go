@@ -0,0 +1,52 @@
+package tui
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func TestCongestionDetail(t *testing.T) {
+	bbr := &tracker.Connection{CongestionAlgo: "bbr", Ping: 28 * time.Millisecond,
+		BBR: &tracker.BBRInfo{Bandwidth: 12.3e6, MinRTT: 26917 * time.Microsecond}}
+	if got, want := congestionDetail(bbr), "bbr; kernel's path estimate: bottleneck 11.7 MB/s, min RTT 26.92ms, measured ping 28ms"; got != want {
+		t.Errorf("bbr: %q, want %q", got, want)
+	}
+	if got := congestionDetail(&tracker.Connection{CongestionAlgo: "cubic"}); got != "cubic" {
+		t.Errorf("cubic: %q", got)
+	}
+	unknown := "-"
+	if runtime.GOOS == "windows" {
+		unknown = ""
+	}
+	if got := congestionDetail(&tracker.Connection{}); got != unknown {
+		t.Errorf("unknown: %q, want %q", got, unknown)
+	}
+	if got := congestionDetail(&tracker.Connection{Host: "db1:7777"}); got != "-" {
+		t.Errorf("an agent's connection: %q", got)
+	}
+}
+
+// TestCongestionColumn toggles the CC column with K.
+func TestCongestionColumn(t *testing.T) {
+	a, b := testConn("rclone", 1, "203.0.113.80", 443), testConn("curl", 2, "192.0.2.1", 443)
+	a.CongestionAlgo = "bbr"
+	m := newTestModelWith(t, a, b)
+	m.width, m.height = 220, 20
+	if strings.Contains(m.View(), "bbr") {
+		t.Fatal("CC column shown before K")
+	}
+	m, _ = press(t, m, "K")
+	var rows []string
+	for _, line := range strings.Split(m.View(), "\n") {
+		if strings.Contains(line, "rclone") || strings.Contains(line, "curl") {
+			rows = append(rows, line)
+		}
+	}
+	if len(rows) != 2 || !strings.Contains(rows[1], " bbr ") || !strings.Contains(rows[0], " - ") {
+		t.Errorf("rows:\n%s", strings.Join(rows, "\n"))
+	}
+}
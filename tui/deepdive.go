@@ -0,0 +1,268 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// deepDiveRedraw is how often the F7 overlay redraws while probes arrive.
+const deepDiveRedraw = 100 * time.Millisecond
+
+// deepDiveTickMsg redraws the F7 overlay.
+type deepDiveTickMsg struct{}
+
+func deepDiveTick() tea.Cmd {
+	return tea.Tick(deepDiveRedraw, func(time.Time) tea.Msg { return deepDiveTickMsg{} })
+}
+
+// SetDeepDive sets the probe rate and duration of an F7 deep-dive.
+func (m *Model) SetDeepDive(rate int, d time.Duration) {
+	m.deepDiveRate, m.deepDiveFor = rate, d
+}
+
+// openDeepDive starts a deep-dive of the selected connection's remote and
+// shows it.
+func (m Model) openDeepDive() (tea.Model, tea.Cmd) {
+	if m.listingGroups() || m.cursor >= len(m.connections) {
+		return m, nil
+	}
+	c := m.connections[m.cursor]
+	rate, d := m.deepDiveRate, m.deepDiveFor
+	if rate == 0 {
+		rate, d = tracker.DefaultDeepDiveRate, tracker.DefaultDeepDiveDuration
+	}
+	if err := m.tracker.StartDeepDive(c, rate, d); err != nil {
+		m.notice = fmt.Sprintf("Deep-dive: %v", err)
+		return m, nil
+	}
+	m.pushMode(&deepDiveMode{app: m.appName(c)})
+	return m, deepDiveTick()
+}
+
+// handleDeepDiveTick keeps redrawing while the deep-dive runs.
+func (m Model) handleDeepDiveTick() (tea.Model, tea.Cmd) {
+	if _, ok := findMode[*deepDiveMode](m); !ok {
+		return m, nil
+	}
+	if d, ok := m.tracker.DeepDive(); ok && d.Running() {
+		return m, deepDiveTick()
+	}
+	return m, nil
+}
+
+// deepDiveMode is the F7 overlay. Closing it stops the deep-dive; once it
+// has ended, s saves the samples.
+type deepDiveMode struct {
+	app   string // as displayed
+	saved string // the file saved to, or why saving failed
+}
+
+func (dm *deepDiveMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "f7":
+		m.cancelMode(dm)
+	case "s":
+		if d, ok := m.tracker.DeepDive(); ok && !d.Running() {
+			var path string
+			dm.saved, path = m.saveDeepDive(&d)
+			m.noteWritten(path)
+		}
+	}
+	return m, nil, true
+}
+
+func (dm *deepDiveMode) cancel(m *Model) {
+	m.tracker.StopDeepDive()
+}
+
+func (dm *deepDiveMode) view(m Model) string { return m.renderDeepDive(dm) }
+
+// saveDeepDive writes d's samples to deepdive-<addr>-<timestamp>.csv in
+// the working directory, leaving the address out while anonymizing. It
+// says where they went, and returns the file's name, or "" when saving
+// failed.
+func (m Model) saveDeepDive(d *tracker.DeepDive) (string, string) {
+	name := "deepdive-" + strings.NewReplacer(":", "-", ".", "-").Replace(d.Addr)
+	if m.anon != nil {
+		name = "deepdive"
+	}
+	name += "-" + d.Started.Format("20060102-150405") + ".csv"
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Sprintf("Save failed: %v", err), ""
+	}
+	err = d.WriteCSV(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Sprintf("Save failed: %v", err), ""
+	}
+	return fmt.Sprintf("Saved %d samples to %s", len(d.Samples), name), name
+}
+
+// renderDeepDive draws the F7 overlay: the latest probe in large digits,
+// the running stats and a graph with one column per probe.
+func (m Model) renderDeepDive(dm *deepDiveMode) string {
+	d, ok := m.tracker.DeepDive()
+	if !ok {
+		return ""
+	}
+	s := d.Stats()
+	lines := []string{
+		m.st(styleTitle).Render(fmt.Sprintf("Deep-dive to %s:%d (%s), %d probes/s", m.addr(d.Addr), d.Port, dm.app, d.Rate)),
+	}
+	if d.Running() {
+		lines = append(lines, fmt.Sprintf("  Running %s of %s; normal probing of this host is paused",
+			fmtClock(time.Since(d.Started)), fmtClock(d.For)))
+	} else {
+		lines = append(lines, fmt.Sprintf("  Ended (%s) after %s", d.End, fmtClock(d.Ended.Sub(d.Started))))
+	}
+	lines = append(lines, "")
+
+	current := "---"
+	style := m.st(styleTitle)
+	switch {
+	case s.LastLost:
+		style = m.st(styleBad)
+	case s.Sent > 0:
+		current = fmt.Sprintf("%.1f", float64(s.Current)/float64(time.Millisecond))
+	}
+	big := bigDigits(current)
+	for i, row := range big {
+		if i == len(big)-1 {
+			row += " ms"
+			if s.LastLost {
+				row += "  lost"
+			}
+		}
+		lines = append(lines, "  "+style.Render(row))
+	}
+	lines = append(lines, "",
+		fmt.Sprintf("  min %s  avg %s  max %s  jitter %s  loss %.1f%% (%d of %d)",
+			fmtDur(s.Min), fmtDur(s.Avg), fmtDur(s.Max), fmtDur(s.Jitter), s.Loss(), s.Lost, s.Sent),
+		"")
+	lines = append(lines, m.deepDiveGraph(&d)...)
+
+	if dm.saved != "" {
+		lines = append(lines, "", "  "+dm.saved)
+	}
+	help := "Esc/F7: stop"
+	if !d.Running() {
+		help = "s: save CSV  Esc/F7: close"
+	}
+	lines = append(lines, "", m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
+
+// deepDiveGraph plots the latest samples that fit the width, one column
+// each, oldest on the left. The scale spans the samples shown with some
+// room below, so jitter of a few milliseconds on a long path shows. A lost
+// probe is an x on the bottom row.
+func (m Model) deepDiveGraph(d *tracker.DeepDive) []string {
+	const axis = 9 // the y labels
+	width := max(10, m.width-axis-2)
+	height := min(12, max(3, m.height-17))
+	samples := d.Samples
+	if len(samples) > width {
+		samples = samples[len(samples)-width:]
+	}
+	var lo, top time.Duration
+	for _, x := range samples {
+		if x.Lost {
+			continue
+		}
+		if top == 0 || x.RTT < lo {
+			lo = x.RTT
+		}
+		top = max(top, x.RTT)
+	}
+	lo = max(0, lo-max(top-lo, top/10)/2)
+	top = max(top, lo+time.Millisecond)
+	lines := make([]string, 0, height+1)
+	for row := range height {
+		level := height - 1 - row // cells below this row
+		var b strings.Builder
+		for _, x := range samples {
+			switch {
+			case x.Lost && level == 0:
+				b.WriteString(m.st(styleBad).Render("x"))
+			case x.Lost:
+				b.WriteByte(' ')
+			default:
+				eighths := max(1, int(float64(x.RTT-lo)/float64(top-lo)*float64(height*8)+0.5))
+				b.WriteString(barCell(eighths - level*8))
+			}
+		}
+		label := ""
+		switch row {
+		case 0:
+			label = fmtDur(top)
+		case height - 1:
+			label = fmtDur(lo)
+		}
+		lines = append(lines, fmt.Sprintf("%*s │%s", axis-2, label, b.String()))
+	}
+	span := time.Duration(len(samples)) * time.Second / time.Duration(d.Rate)
+	left := "-" + fmtClock(span)
+	lines = append(lines, fmt.Sprintf("%*s └%-*s%s", axis-2, "", max(0, len(samples)-len("latest")), left, "latest"))
+	return lines
+}
+
+// barCell is one cell of a bar that fills eighths of it from the bottom.
+func barCell(eighths int) string {
+	const blocks = " ▁▂▃▄▅▆▇█"
+	switch {
+	case eighths <= 0:
+		return " "
+	case eighths >= 8:
+		return "█"
+	}
+	return string([]rune(blocks)[eighths])
+}
+
+// fmtClock formats d as m:ss.
+func fmtClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// bigFont is five rows of each character a readout needs.
+var bigFont = map[rune][5]string{
+	'0': {"███", "█ █", "█ █", "█ █", "███"},
+	'1': {"  █", "  █", "  █", "  █", "  █"},
+	'2': {"███", "  █", "███", "█  ", "███"},
+	'3': {"███", "  █", "███", "  █", "███"},
+	'4': {"█ █", "█ █", "███", "  █", "  █"},
+	'5': {"███", "█  ", "███", "  █", "███"},
+	'6': {"███", "█  ", "███", "█ █", "███"},
+	'7': {"███", "  █", "  █", "  █", "  █"},
+	'8': {"███", "█ █", "███", "█ █", "███"},
+	'9': {"███", "█ █", "███", "  █", "███"},
+	'.': {" ", " ", " ", " ", "█"},
+	'-': {"   ", "   ", "███", "   ", "   "},
+}
+
+// bigDigits renders s in bigFont, five rows tall.
+func bigDigits(s string) []string {
+	rows := make([]string, 5)
+	for i, r := range s {
+		glyph, ok := bigFont[r]
+		if !ok {
+			continue
+		}
+		for row := range rows {
+			if i > 0 {
+				rows[row] += " "
+			}
+			rows[row] += glyph[row]
+		}
+	}
+	return rows
+}
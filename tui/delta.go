@@ -0,0 +1,187 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxDeltaEntries caps how many changes the delta view keeps.
+const maxDeltaEntries = 300
+
+// defaultDeltaOptions extends the a11y diff with a 100 KB/s rate threshold.
+var defaultDeltaOptions = tracker.DiffOptions{
+	PingChangePct: tracker.DefaultDiffOptions.PingChangePct,
+	PingChangeMin: tracker.DefaultDiffOptions.PingChangeMin,
+	RateThreshold: 100 << 10,
+}
+
+// deltaEntry is one change shown in the delta view: a connection's, or
+// with Note set, one of the tracker's own (the load throttle).
+type deltaEntry struct {
+	Time   time.Time
+	Change tracker.Change
+	Note   string
+}
+
+// SetDeltaOptions sets what counts as a change in the delta view.
+func (m *Model) SetDeltaOptions(opts tracker.DiffOptions) {
+	m.deltaOpts = opts
+}
+
+// recordDelta diffs the unfiltered snapshot against the previous refresh and
+// appends the changes to the delta log. Closed connections are stamped with
+// the time the tracker moved them to its recently-closed buffer.
+func (m *Model) recordDelta(all []*tracker.Connection) {
+	prev := m.deltaPrev
+	m.deltaPrev = all
+	if prev == nil {
+		return
+	}
+
+	now := time.Now()
+	changes := tracker.DiffSnapshots(prev, all, m.deltaOpts)
+	var closedAt map[string]time.Time
+	for _, ch := range changes {
+		e := deltaEntry{Time: now, Change: ch}
+		e.Change.Conn = cloneConns([]*tracker.Connection{ch.Conn})[0] // the snapshot buffer is reused
+		if ch.Kind == tracker.ChangeClosed {
+			if closedAt == nil {
+				closedAt = make(map[string]time.Time)
+				for _, c := range m.tracker.RecentlyClosed() {
+					closedAt[c.Key()] = c.ClosedAt
+				}
+			}
+			if t, ok := closedAt[ch.Conn.Key()]; ok {
+				e.Time = t
+			}
+		}
+		m.deltaLog = append(m.deltaLog, e)
+	}
+	if over := len(m.deltaLog) - maxDeltaEntries; over > 0 {
+		m.deltaLog = append(m.deltaLog[:0], m.deltaLog[over:]...)
+	}
+}
+
+// visibleDeltas returns the logged changes matching the filter, newest first.
+func (m Model) visibleDeltas() []deltaEntry {
+	var out []deltaEntry
+	for i := len(m.deltaLog) - 1; i >= 0; i-- {
+		e := m.deltaLog[i]
+		if e.Note != "" {
+			out = append(out, e)
+			continue
+		}
+		if len(tracker.FilterConnections([]*tracker.Connection{e.Change.Conn}, m.filter)) == 0 {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// deltaMode is the z view of changes between refreshes.
+type deltaMode struct{}
+
+func (d *deltaMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "z":
+		m.cancelMode(d)
+	case "up", "k":
+		if m.deltaOffset > 0 {
+			m.deltaOffset--
+		}
+	case "down", "j":
+		if m.deltaOffset < len(m.visibleDeltas())-1 {
+			m.deltaOffset++
+		}
+	case "home", "g":
+		m.deltaOffset = 0
+	case "T":
+		m.times.absolute = !m.times.absolute
+	case "p":
+		m.togglePause()
+	}
+	return m, nil, true
+}
+
+func (d *deltaMode) cancel(m *Model) {}
+
+func (d *deltaMode) view(m Model) string { return m.renderDelta() }
+
+// describeChange is the "what changed" column of the delta view.
+func describeChange(ch tracker.Change) string {
+	c := ch.Conn
+	switch ch.Kind {
+	case tracker.ChangeState:
+		return fmt.Sprintf("%s -> %s", ch.OldState, c.State)
+	case tracker.ChangePing:
+		return fmt.Sprintf("%s -> %s", fmtDur(ch.OldPing), fmtDur(c.Ping))
+	case tracker.ChangeRate:
+		return fmt.Sprintf("%s -> %s", tracker.FormatBytes(ch.OldRate), tracker.FormatBytes(c.TxRate+c.RxRate))
+	}
+	return string(c.State)
+}
+
+// renderDelta lists recent changes, newest first.
+func (m Model) renderDelta() string {
+	entries := m.visibleDeltas()
+	now := time.Now()
+
+	pauseStr := ""
+	if m.paused {
+		pauseStr = " [PAUSED]"
+	}
+	lines := []string{m.st(styleTitle).Render(fmt.Sprintf("Changes - %d of the last %d%s", len(entries), maxDeltaEntries, pauseStr))}
+	if m.filter != "" {
+		lines = append(lines, m.st(styleSearch).Render("Filter: ")+m.filter)
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.st(styleHeader).Render(truncate(fmt.Sprintf(" %-12s %-7s %-18s %-28s %s", "Time", "Change", "App", "Remote", "Detail"), m.width)))
+
+	rows := maxInt(1, m.height-5)
+	start := minInt(m.deltaOffset, maxInt(0, len(entries)-1))
+	end := minInt(start+rows, len(entries))
+	for _, e := range entries[start:end] {
+		if e.Note != "" {
+			lines = append(lines, fmt.Sprintf(" %-12s %s %-18s %-28s %s",
+				truncStr(m.times.format(e.Time, now), 12), styledPadRight("note", m.st(styleWarn), 7), "-", "-", e.Note))
+			continue
+		}
+		c := e.Change.Conn
+		kind := string(e.Change.Kind)
+		style := m.st(styleRow)
+		switch e.Change.Kind {
+		case tracker.ChangeNew:
+			style = m.st(styleGood)
+		case tracker.ChangeClosed:
+			style = m.st(styleStale)
+		case tracker.ChangeState, tracker.ChangeRate:
+			style = m.st(styleWarn)
+		case tracker.ChangePing:
+			if c.Ping > e.Change.OldPing {
+				style = m.st(styleBad)
+			} else {
+				style = m.st(styleGood)
+			}
+		}
+		remote := fmt.Sprintf("%s:%d", m.addr(c.RemoteAddr), c.RemotePort)
+		line := fmt.Sprintf(" %-12s %s %-18s %-28s %s",
+			truncStr(m.times.format(e.Time, now), 12), styledPadRight(kind, style, 7),
+			truncStr(m.appName(c), 18), truncStr(remote, 28), describeChange(e.Change))
+		lines = append(lines, line)
+	}
+	if len(entries) == 0 {
+		lines = append(lines, m.st(styleStatus).Render("No changes yet."))
+	}
+	for i := len(lines); i < m.height-1; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.st(styleStatus).Render("z/Esc: back  j/k: scroll  T: times  p: pause"))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"fmt"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+func TestRecordDelta(t *testing.T) {
+	m := newTestModel()
+	web := &tracker.Connection{AppName: "web", RemoteAddr: "192.0.2.1", RemotePort: 443, State: tracker.StateEstablished}
+	ssh := &tracker.Connection{AppName: "ssh", RemoteAddr: "192.0.2.2", RemotePort: 22, State: tracker.StateEstablished}
+
+	m.recordDelta([]*tracker.Connection{web})
+	if len(m.deltaLog) != 0 {
+		t.Fatal("the first refresh logged changes")
+	}
+	m.recordDelta([]*tracker.Connection{web, ssh})
+	m.recordDelta([]*tracker.Connection{ssh})
+
+	got := m.visibleDeltas()
+	if len(got) != 2 {
+		t.Fatalf("%d changes, want 2", len(got))
+	}
+	// Newest first.
+	if got[0].Change.Kind != tracker.ChangeClosed || got[0].Change.Conn.AppName != "web" ||
+		got[1].Change.Kind != tracker.ChangeNew || got[1].Change.Conn.AppName != "ssh" {
+		t.Fatalf("got %s %s, %s %s", got[0].Change.Kind, got[0].Change.Conn.AppName,
+			got[1].Change.Kind, got[1].Change.Conn.AppName)
+	}
+
+	m.filter = "ssh"
+	if got := m.visibleDeltas(); len(got) != 1 || got[0].Change.Conn.AppName != "ssh" {
+		t.Fatalf("filtered: %d changes", len(got))
+	}
+}
+
+func TestRecordDeltaCap(t *testing.T) {
+	m := newTestModel()
+	m.recordDelta([]*tracker.Connection{})
+	for i := range maxDeltaEntries + 50 {
+		m.recordDelta([]*tracker.Connection{{AppName: fmt.Sprint(i), RemotePort: i}})
+	}
+	if len(m.deltaLog) != maxDeltaEntries {
+		t.Fatalf("%d entries kept, want %d", len(m.deltaLog), maxDeltaEntries)
+	}
+	// Each refresh logs the new connection, then the one it replaced.
+	newest := m.deltaLog[len(m.deltaLog)-2]
+	if newest.Change.Kind != tracker.ChangeNew || newest.Change.Conn.AppName != fmt.Sprint(maxDeltaEntries+49) {
+		t.Fatalf("newest entry %s %s", newest.Change.Kind, newest.Change.Conn.AppName)
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	c := &tracker.Connection{State: tracker.StateCloseWait}
+	if got := describeChange(tracker.Change{Kind: tracker.ChangeState, Conn: c, OldState: tracker.StateEstablished}); got != "ESTABLISHED -> CLOSE_WAIT" {
+		t.Errorf("state: %q", got)
+	}
+	if got := describeChange(tracker.Change{Kind: tracker.ChangeNew, Conn: c}); got != "CLOSE_WAIT" {
+		t.Errorf("new: %q", got)
+	}
+}
+
+func TestDeltaViewKeepsCursorAndFilter(t *testing.T) {
+	m := newTestModelWith(t,
+		testConn("a", 1, "192.0.2.1", 443),
+		testConn("b", 2, "192.0.2.2", 443),
+		testConn("c", 3, "192.0.2.3", 443),
+	)
+	m.cursor = 2
+	m.filter = "192.0.2."
+	m, _ = press(t, m, "z")
+	if _, ok := findMode[*deltaMode](m); !ok {
+		t.Fatal("z did not open the delta view")
+	}
+	m, _ = press(t, m, "j", "z")
+	if _, ok := findMode[*deltaMode](m); ok {
+		t.Fatal("z did not close the delta view")
+	}
+	if m.cursor != 2 || m.filter != "192.0.2." {
+		t.Fatalf("cursor %d, filter %q after the delta view", m.cursor, m.filter)
+	}
+}
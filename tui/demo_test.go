@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"ping-tracker/demo"
+	"ping-tracker/policy"
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// demoKeys are the keys the soak test presses at random: sorting,
+// grouping, navigation, the toggles and the views that only read. Keys
+// that quit, run commands or write files are left out.
+var demoKeys = []string{
+	"1", "2", "3", "4", "5", "6", "7", "8", "9", "0", "x", "!", "@", "U",
+	"j", "k", "up", "down", "g", "G", "[", "]",
+	"s", "w", "t", "K", "u", "e", "T", "C", "H", "O", "b", " ", "r",
+	"enter", "esc", "z", "?", "f9", "f4", "c",
+}
+
+// TestDemoSoak drives the model through simulated minutes of the demo
+// network, pressing keys between scans, and checks after every step that
+// nothing panics, the cursor stays on a row and group totals match their
+// rows.
+func TestDemoSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	const scans = 90 // three simulated minutes at -demo's 2s interval
+	tr := tracker.NewTracker(10*time.Millisecond, true)
+	tr.SetSource(demo.New(1, 2*time.Second))
+	tr.Start()
+	t.Cleanup(tr.Stop)
+
+	m := NewModel(tr)
+	m.SetPolicy(policy.ReadOnly)
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 160, Height: 40})
+	m = next.(Model)
+	rng := rand.New(rand.NewSource(1))
+	var gen uint64
+	for scan := 0; scan < scans; scan++ {
+		deadline := time.Now().Add(5 * time.Second)
+		for tr.Generation() == gen {
+			if time.Now().After(deadline) {
+				t.Fatalf("no scan after %d", scan)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		gen = tr.Generation()
+		next, _ := m.Update(tickMsg(time.Now()))
+		m = next.(Model)
+		checkDemoModel(t, m, scan, "tick")
+
+		for range 3 {
+			k := demoKeys[rng.Intn(len(demoKeys))]
+			m, _ = press(t, m, k)
+			checkDemoModel(t, m, scan, k)
+		}
+		if scan%30 == 29 {
+			// A search that narrows and then clears.
+			m, _ = press(t, m, "/", "f", "i", "r", "e", "enter")
+			checkDemoModel(t, m, scan, "/fire")
+			m, _ = press(t, m, "c")
+			checkDemoModel(t, m, scan, "c")
+		}
+	}
+}
+
+func checkDemoModel(t *testing.T, m Model, scan int, after string) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("scan %d, after %q: View panicked: %v", scan, after, r)
+		}
+	}()
+	m.View()
+	n := m.rowCount()
+	if (n == 0 && m.cursor != 0) || (n > 0 && (m.cursor < 0 || m.cursor >= n)) {
+		t.Fatalf("scan %d, after %q: cursor %d with %d rows", scan, after, m.cursor, n)
+	}
+	if m.offset < 0 || m.offset > m.cursor {
+		t.Fatalf("scan %d, after %q: offset %d past the cursor %d", scan, after, m.offset, m.cursor)
+	}
+	if m.filter == "" && !m.listingGroups() && len(m.connections) > len(m.tracker.Snapshot()) {
+		t.Fatalf("scan %d, after %q: %d rows from %d connections", scan, after, len(m.connections), len(m.tracker.Snapshot()))
+	}
+	for _, g := range m.groups {
+		var tx, rx float64
+		for _, c := range g.Conns {
+			tx += c.TxRate
+			rx += c.RxRate
+		}
+		// The sum is taken in another order, so allow rounding.
+		if len(g.Conns) == 0 || math.Abs(tx-g.TxRate) > 1e-9*tx || math.Abs(rx-g.RxRate) > 1e-9*rx {
+			t.Fatalf("scan %d, after %q: group %s has %d rows adding up to %v/%v, shows %v/%v",
+				scan, after, g.Key, len(g.Conns), tx, rx, g.TxRate, g.RxRate)
+		}
+	}
+}
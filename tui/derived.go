@@ -0,0 +1,117 @@
+package tui
+
+import (
+	"strings"
+
+	"ping-tracker/tracker"
+)
+
+// derivedSep separates the derived column names in tableLayout.derived and
+// their cells in rowFields.derived.
+const derivedSep = "\x00"
+
+// derivedLayout returns the names of the derived columns, joined by
+// derivedSep, and the width they all share: the longest name plus the
+// sort key hint, at least 10.
+func derivedLayout(cols []tracker.DerivedColumn) (names string, width int) {
+	if len(cols) == 0 {
+		return "", 0
+	}
+	list := make([]string, len(cols))
+	width = 10
+	for i, d := range cols {
+		list[i] = d.Name
+		width = max(width, len([]rune(d.Name))+4)
+	}
+	return strings.Join(list, derivedSep), width
+}
+
+// derivedNames splits tableLayout.derived back into names.
+func (l tableLayout) derivedNames() []string {
+	if l.derived == "" {
+		return nil
+	}
+	return strings.Split(l.derived, derivedSep)
+}
+
+// derivedText is the cell text of one derived column: the value, or "-"
+// when an input is missing for c.
+func derivedText(c *tracker.Connection, name string) string {
+	v, ok := c.Derived[name]
+	if !ok {
+		return "-"
+	}
+	return tracker.FormatNumber(v)
+}
+
+// derivedCells renders c's derived columns, each with a leading space.
+func derivedCells(c *tracker.Connection, l tableLayout) string {
+	var b strings.Builder
+	for _, name := range l.derivedNames() {
+		b.WriteString(" " + padLeft(derivedText(c, name), l.derivedW))
+	}
+	return b.String()
+}
+
+// derivedKey is what the derived columns of c display, for the row cache.
+func derivedKey(c *tracker.Connection, l tableLayout) string {
+	names := l.derivedNames()
+	if len(names) == 0 {
+		return ""
+	}
+	texts := make([]string, len(names))
+	for i, name := range names {
+		texts[i] = derivedText(c, name)
+	}
+	return strings.Join(texts, derivedSep)
+}
+
+// cycleDerivedSort sorts by the next derived column (x): each column
+// ascending in turn, then each descending, so with a single column x
+// toggles like the number keys.
+func (m *Model) cycleDerivedSort() {
+	if len(m.derived) == 0 {
+		m.notice = "No derived columns (set derived_columns in the config file)"
+		return
+	}
+	switch {
+	case m.sortField != SortDerived:
+		m.sortField, m.sortDerived, m.sortAsc = SortDerived, 0, true
+	case m.sortDerived+1 < len(m.derived):
+		m.sortDerived++
+	default:
+		m.sortDerived, m.sortAsc = 0, !m.sortAsc
+	}
+	m.sortConnections()
+	m.sortGroups()
+	m.rows.reset()
+}
+
+// refreshDerived picks up the tracker's derived columns, falling back to
+// sorting by ping when the sorted column was removed by a config reload.
+func (m *Model) refreshDerived() {
+	m.derived = m.tracker.DerivedColumns()
+	if m.sortField == SortDerived && m.sortDerived >= len(m.derived) {
+		m.sortField, m.sortDerived, m.sortAsc = SortPing, 0, true
+	}
+}
+
+// compareDerived orders a and b by the derived column at i, missing values
+// after present ones.
+func (m Model) compareDerived(i int, a, b *tracker.Connection) int {
+	if i >= len(m.derived) {
+		return 0
+	}
+	name := m.derived[i].Name
+	va, oka := a.Derived[name]
+	vb, okb := b.Derived[name]
+	switch {
+	case !oka && !okb:
+		return 0
+	case !oka:
+		return 1
+	case !okb:
+		return -1
+	}
+	return compareFloat(va, vb)
+}
@@ -0,0 +1,497 @@
+package tui
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// clientSortNames are the orders the listener client list cycles through with o.
+var clientSortNames = []string{"ping", "RX", "TX", "remote"}
+
+// maxDetailClients caps the client rows shown for a listener.
+const maxDetailClients = 15
+
+// detailLabels are the catalog keys of the detail view's labels, under
+// "detail.label."; the values line up after the widest in the language.
+var detailLabels = []string{
+	"protocol", "local", "remote", "state", "ping", "calibration", "stall",
+	"probing", "loss", "score", "txrx", "queues", "first_seen", "updated",
+	"source", "flow", "encrypted", "service", "remote_seen", "server_name",
+	"streams", "check", "origin", "app_total", "qos", "congestion",
+	"socket_mem", "half_open", "listener", "namespace", "executable", "audit",
+	"shared", "clients", "by_subnet",
+}
+
+// detailField is a detail view line: the label of key, padded to the
+// widest label, then value.
+func detailField(key, value string) string {
+	width := 0
+	for _, k := range detailLabels {
+		width = max(width, ansi.StringWidth(tr("detail.label."+k)))
+	}
+	return "  " + padRight(tr("detail.label."+key)+":", width+2) + value
+}
+
+func (m Model) renderDetail(c *tracker.Connection) string {
+	enc := string(c.Encryption)
+	if enc == "" {
+		enc = tr("detail.unknown")
+	}
+
+	now := time.Now()
+	lines := []string{
+		m.st(styleTitle).Render(trf("detail.title", m.appName(c), c.PID, m.hostSuffix(c))),
+		"",
+		detailField("protocol", fmt.Sprintf("%s %s%s", c.DisplayProtocol(), c.Direction, socketNote(c))),
+		detailField("local", fmt.Sprintf("%s:%d (%s)", m.addr(c.LocalAddr), c.LocalPort, portKind(c.LocalPort))),
+		detailField("remote", fmt.Sprintf("%s:%d", m.addr(c.RemoteAddr), c.RemotePort)),
+		detailField("state", stateDetail(c)),
+		detailField("ping", trf("detail.ping", c.Ping.Round(time.Microsecond*100), c.PingCount, c.PingFailed, sampleNote(c), unreachableNote(c, now))),
+		detailField("calibration", pingCalibration(c)),
+		detailField("stall", stallDetail(c)),
+		detailField("probing", m.probingDetail(c)),
+		detailField("loss", trf("detail.loss", c.Loss, c.LossTrend.Direction, c.LossTrend.Delta)),
+		detailField("score", scoreDetail(c)),
+		detailField("txrx", rateDetail(c)),
+		detailField("queues", queueDetail(c)),
+		detailField("first_seen", m.times.format(c.FirstSeen, now)),
+		detailField("updated", m.times.format(c.LastUpdated, now)),
+		detailField("source", provenanceDetail(c)),
+		detailField("flow", m.flowHistory(c, now)),
+		detailField("encrypted", trf("detail.encrypted", enc, c.EncryptionSource)),
+		detailField("service", serviceDetail(c)),
+		detailField("remote_seen", m.firstSeenEver(c, now)),
+	}
+	if c.SNI != "" {
+		sni := c.SNI
+		if m.anon != nil {
+			sni = tr("detail.hidden")
+		}
+		source := "TLS SNI"
+		if strings.HasPrefix(c.Protocol, "udp") {
+			source = "QUIC Initial"
+		}
+		lines = append(lines, detailField("server_name", fmt.Sprintf("%s (%s)", sni, source)))
+	}
+	if s := streamDetail(c); s != "" {
+		lines = append(lines, detailField("streams", s))
+	}
+	if sc := c.ServiceCheck; sc != nil {
+		lines = append(lines, detailField("check", m.serviceCheckDetail(sc, now)))
+	}
+	if c.Origin != tracker.OriginLocal {
+		lines = append(lines, detailField("origin", m.originDetail(c)))
+	}
+	if c.Host == "" {
+		lines = append(lines, detailField("app_total", m.appLifetime(c, now)))
+	}
+	if c.QoS != nil {
+		lines = append(lines, detailField("qos", c.QoS.String()))
+	} else {
+		lines = append(lines, detailField("qos", "-"))
+	}
+	if s := congestionDetail(c); s != "" {
+		lines = append(lines, detailField("congestion", s))
+	}
+	if c.SockMemInfo != nil {
+		lines = append(lines, detailField("socket_mem", fmt.Sprintf("%s (%s)", tracker.FormatBytesTotal(c.SockMem), c.SockMemInfo)))
+	}
+	if c.HalfOpen {
+		lines = append(lines, detailField("half_open", trf("detail.half_open", compactDuration(now.Sub(c.HalfOpenSince)), c.HalfOpenReason)))
+	}
+	if c.NewListener {
+		lines = append(lines, detailField("listener", tr("detail.listener_new")))
+	}
+	if c.Namespace != "" {
+		lines = append(lines, detailField("namespace", c.Namespace))
+	}
+	if c.ExePath != "" {
+		lines = append(lines,
+			detailField("executable", c.ExePath),
+			detailField("audit", c.Audit.Summary()))
+	}
+
+	help := tr("detail.keys")
+	if c.PortShare != nil {
+		lines = append(lines, m.portShareDetail(c.PortShare)...)
+	}
+	if c.Host == "" && c.IsListener() {
+		if stats, ok := m.tracker.ListenerClients(c.Key()); ok {
+			lines = append(lines, m.renderListenerClients(stats)...)
+			help = tr("detail.keys_clients") + "  " + help
+		}
+	}
+
+	lines = append(lines, "", m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
+
+// renderListenerClients summarizes the established clients of a listener.
+func (m Model) renderListenerClients(stats tracker.ListenerStats) []string {
+	worst := "-"
+	if stats.WorstPing > 0 {
+		worst = stats.WorstPing.Round(time.Microsecond * 100).String()
+	}
+	lines := []string{
+		"",
+		detailField("clients", trf("detail.clients", len(stats.Clients),
+			tracker.FormatBytes(stats.TxRate), tracker.FormatBytes(stats.RxRate), worst)),
+	}
+	if len(stats.Clients) == 0 {
+		return lines
+	}
+
+	subnets := make([]string, 0, len(stats.BySubnet))
+	for s := range stats.BySubnet {
+		subnets = append(subnets, s)
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		if stats.BySubnet[subnets[i]] != stats.BySubnet[subnets[j]] {
+			return stats.BySubnet[subnets[i]] > stats.BySubnet[subnets[j]]
+		}
+		return subnets[i] < subnets[j]
+	})
+	parts := make([]string, 0, len(subnets))
+	for _, s := range subnets {
+		label := s
+		if m.anon != nil {
+			label = m.anon.prefix(s)
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", label, stats.BySubnet[s]))
+	}
+	lines = append(lines, detailField("by_subnet", strings.Join(parts, ", ")), "")
+
+	clients := stats.Clients
+	sort.SliceStable(clients, func(i, j int) bool {
+		a, b := clients[i], clients[j]
+		switch clientSortNames[m.clientSort] {
+		case "ping":
+			return a.Ping > b.Ping
+		case "RX":
+			return a.RxRate > b.RxRate
+		case "TX":
+			return a.TxRate > b.TxRate
+		default:
+			return a.RemoteAddr < b.RemoteAddr
+		}
+	})
+
+	order := tr("detail.client_sort." + strings.ToLower(clientSortNames[m.clientSort]))
+	lines = append(lines, m.st(styleHeader).Render(fmt.Sprintf("  %s %s %s %s  %s",
+		padRight(tr("detail.client"), 40), padRight(tr("col.ping"), 10), padRight(tr("col.tx"), 10), padRight(tr("col.rx"), 10),
+		trf("detail.clients_by", order))))
+	for i, cl := range clients {
+		if i == maxDetailClients {
+			lines = append(lines, "  "+trf("detail.more", len(clients)-maxDetailClients))
+			break
+		}
+		ping := "-"
+		if cl.Ping > 0 {
+			ping = fmt.Sprintf("%.1fms", float64(cl.Ping.Microseconds())/1000.0)
+		}
+		lines = append(lines, fmt.Sprintf("  %-40s %-10s %-10s %-10s",
+			fmt.Sprintf("%s:%d", m.addr(cl.RemoteAddr), cl.RemotePort), ping,
+			tracker.FormatBytes(cl.TxRate), tracker.FormatBytes(cl.RxRate)))
+	}
+	return lines
+}
+
+func (m Model) firstSeenEver(c *tracker.Connection, now time.Time) string {
+	if c.RemoteFirstSeenEver.IsZero() {
+		return "-"
+	}
+	s := trf("detail.seen.first", m.times.format(c.RemoteFirstSeenEver, now))
+	if c.IsNewRemote(now) {
+		s += tr("detail.seen.new")
+	}
+	return s
+}
+
+// appLifetime is what the connection's app has moved in total, across
+// sessions when the state file is in use.
+func (m Model) appLifetime(c *tracker.Connection, now time.Time) string {
+	a, ok := m.tracker.AppLifetime(c.AppName)
+	if !ok {
+		return "-"
+	}
+	return trf("detail.app_total", tracker.FormatBytesTotal(a.TxBytes), tracker.FormatBytesTotal(a.RxBytes),
+		a.Conns, m.times.format(a.FirstSeen, now))
+}
+
+// flowHistory describes the logical flow a socket belongs to.
+func (m Model) flowHistory(c *tracker.Connection, now time.Time) string {
+	if c.Relinks == 0 {
+		return tr("detail.flow.single")
+	}
+	if m.anon != nil {
+		return trf("detail.flow.anon", m.times.format(c.LogicalFirstSeen, now), c.Relinks)
+	}
+	return trf("detail.flow.linked", m.times.format(c.LogicalFirstSeen, now), c.LinkedFrom, c.Relinks)
+}
+
+func (m Model) hostSuffix(c *tracker.Connection) string {
+	if c.Host == "" {
+		return ""
+	}
+	return trf("detail.on_host", m.hostName(c.Host))
+}
+
+// portKind describes a local port as ephemeral or a (named) service port.
+func portKind(port int) string {
+	if tracker.IsEphemeralPort(port) {
+		r := tracker.EphemeralRange()
+		return trf("detail.port.ephemeral", r.Low, r.High)
+	}
+	if svc := tracker.ServiceName(port); svc != "" {
+		return trf("detail.port.named", svc)
+	}
+	return tr("detail.port.service")
+}
+
+// serviceDetail is the service hint and the port rule behind it.
+func serviceDetail(c *tracker.Connection) string {
+	switch c.Service {
+	case "":
+		return tr("detail.unknown")
+	case tracker.ServiceQUIC:
+		if c.QUICVersion != "" {
+			return trf("detail.service.quic_version", c.QUICVersion)
+		}
+		if c.RemotePort == 443 || c.LocalPort == 443 {
+			return tr("detail.service.quic_port")
+		}
+		return tr("detail.service.quic")
+	}
+	return trf("detail.service.port", c.Service)
+}
+
+// streamDetail is the parallel streams or flows estimated for the socket,
+// and where the estimate comes from; "" without one.
+func streamDetail(c *tracker.Connection) string {
+	switch c.StreamHintSource {
+	case tracker.StreamsH2C:
+		return trf("detail.streams.h2c", c.StreamHint)
+	case tracker.StreamsConntrack:
+		return trn("detail.streams.conntrack", c.StreamHint, c.StreamHint)
+	}
+	return ""
+}
+
+// provenanceDetail names the scanners that reported the socket and how many
+// duplicate reports were merged into the row.
+func provenanceDetail(c *tracker.Connection) string {
+	if len(c.Provenance) == 0 {
+		return tr("detail.unknown")
+	}
+	s := strings.Join(c.Provenance, " + ")
+	if c.Merged > 0 {
+		s += trn("detail.merged", c.Merged, c.Merged)
+	}
+	return s
+}
+
+// probingDetail is the probe tier and interval, or why the remote is never
+// probed.
+func (m Model) probingDetail(c *tracker.Connection) string {
+	switch c.NoProbe {
+	case tracker.AddrProbeable:
+	case tracker.AddrExcluded:
+		return tr("detail.probe.excluded")
+	default:
+		return trf("detail.probe.never", c.NoProbe)
+	}
+	return trf("detail.probe.tier", c.PingTier, fmtDur(m.tracker.ProbeInterval(c.PingTier)))
+}
+
+// scoreDetail is the health score with its weakest component and, where
+// known, the retransmission rate.
+func scoreDetail(c *tracker.Connection) string {
+	if !c.HasScore {
+		return "-"
+	}
+	s := fmt.Sprintf("%d/100", c.Score)
+	if c.ScoreWorst != "" {
+		s += trf("detail.score.worst", c.ScoreWorst)
+	}
+	if c.HasRetransRate {
+		s += trf("detail.score.retrans", locale.Number(fmt.Sprintf("%.1f", c.RetransRate)))
+	}
+	return s
+}
+
+// socketNote explains IPv4 traffic carried on an IPv6 socket.
+func socketNote(c *tracker.Connection) string {
+	if c.V4Mapped {
+		return trf("detail.v4_mapped", c.Protocol)
+	}
+	return ""
+}
+
+// congestionDetail names c's congestion control and, for BBR, the path
+// the kernel estimated next to the measured ping. It is "-" when unknown,
+// and "" for a connection of this machine on Windows, which cannot know.
+func congestionDetail(c *tracker.Connection) string {
+	switch {
+	case c.CongestionAlgo == "" && c.Host == "" && runtime.GOOS == "windows":
+		return ""
+	case c.CongestionAlgo == "":
+		return "-"
+	case c.BBR == nil:
+		return c.CongestionAlgo
+	}
+	s := trf("detail.congestion.bbr", c.CongestionAlgo, c.BBR)
+	if c.Ping > 0 {
+		s += trf("detail.congestion.ping", c.Ping.Round(100*time.Microsecond))
+	}
+	return s
+}
+
+// pingCalibration explains how the displayed ping relates to the raw probe.
+func pingCalibration(c *tracker.Connection) string {
+	kernel := ""
+	if c.KernelRTT > 0 {
+		kernel = trf("detail.calibration.kernel", c.KernelRTT.Round(time.Microsecond*100))
+	}
+	switch c.PingCorrection {
+	case tracker.CorrectionHost:
+		return trf("detail.calibration.host", c.RawPing.Round(time.Microsecond*100), kernel)
+	case tracker.CorrectionGlobal:
+		return trf("detail.calibration.global", c.RawPing.Round(time.Microsecond*100), kernel)
+	case tracker.CorrectionExternal:
+		return trf("detail.calibration.external", c.PingSource, kernel)
+	}
+	if p := c.Proxy; p != nil {
+		if p.Loss >= 100 {
+			return trf("detail.calibration.proxy_down", p.Proxy)
+		}
+		return trf("detail.calibration.proxy", p.Proxy, p.ToProxy.Round(time.Microsecond*100),
+			p.ToTarget.Round(time.Microsecond*100), kernel)
+	}
+	return trf("detail.calibration.raw", kernel)
+}
+
+// stateDetail is the state with how long the connection has been in it.
+func stateDetail(c *tracker.Connection) string {
+	if c.StateSince.IsZero() {
+		return string(c.State)
+	}
+	s := trf("detail.for", c.State, compactDuration(c.TimeInState()))
+	if !c.StateSinceExact {
+		s = trf("detail.state.at_least", c.State, compactDuration(c.TimeInState()))
+	}
+	if c.Stuck {
+		s += tr("detail.state.stuck")
+	}
+	return s
+}
+
+// stallDetail describes the transfer stall state and the TCP info behind it.
+func stallDetail(c *tracker.Connection) string {
+	info := c.TCPInfo
+	if info == nil {
+		return tr("detail.not_observable")
+	}
+	window := tr("detail.unknown")
+	if info.HasSndWnd {
+		window = tracker.FormatBytesTotal(info.SndWnd)
+	}
+	state := tr("detail.stall.none")
+	if !c.StallSince.IsZero() {
+		state = trf("detail.for", c.StallReason, fmtDur(c.StallDuration()))
+	}
+	return trf("detail.stall", state, window, tracker.FormatBytesTotal(info.NotSent))
+}
+
+// rateDetail is the TX / RX line: the rates, or why there are none.
+func rateDetail(c *tracker.Connection) string {
+	if !c.HasByteCounts {
+		return tr("detail.rate.none")
+	}
+	s := trf("detail.rate", tracker.FormatBytes(c.TxRate), tracker.FormatBytes(c.RxRate),
+		tracker.FormatBytesTotal(c.TxBytes), tracker.FormatBytesTotal(c.RxBytes))
+	if c.CapturedBytes {
+		s += tr("detail.rate.captured")
+	}
+	return s
+}
+
+// queueDetail describes the socket buffer occupancy.
+func queueDetail(c *tracker.Connection) string {
+	if !c.HasQueues {
+		return tr("detail.not_observable")
+	}
+	s := trf("detail.queue", tracker.FormatBytesTotal(c.SendQ), tracker.FormatBytesTotal(c.RecvQ))
+	if c.State == tracker.StateListening {
+		s = trf("detail.queue.backlog", c.RecvQ)
+	}
+	if c.SendQHigh > 0 {
+		s += trf("detail.queue.high", c.SendQHigh)
+	}
+	return s
+}
+
+// sampleNote lists the probe samples the sample filter kept out of Ping,
+// and the last one when it was one of them.
+func sampleNote(c *tracker.Connection) string {
+	var s string
+	if c.WarmUpSamples > 0 {
+		s += trf("detail.sample.warm_up", c.WarmUpSamples)
+	}
+	if c.OutlierSamples > 0 {
+		s += trn("detail.sample.outliers", c.OutlierSamples, c.OutlierSamples)
+	}
+	switch c.LastSample {
+	case tracker.SampleWarmUp:
+		s += trf("detail.sample.last_warm_up", c.RawPing.Round(time.Microsecond*100))
+	case tracker.SampleOutlier:
+		s += trf("detail.sample.last_outlier", c.RawPing.Round(time.Microsecond*100))
+	}
+	return s
+}
+
+// unreachableNote says how long the remote has been down, e.g.
+// "; unreachable for 4m32s", when it has.
+func unreachableNote(c *tracker.Connection, now time.Time) string {
+	if d := c.UnreachableFor(now); d > 0 {
+		return trf("detail.unreachable", fmtOutage(d))
+	}
+	return ""
+}
+
+// originDetail describes a forwarded flow: for which client on our side,
+// and the interface it is behind.
+func (m Model) originDetail(c *tracker.Connection) string {
+	client := m.addr(c.LocalAddr)
+	if c.ClientName != "" {
+		client = m.appName(c) + " (" + client + ")"
+	}
+	s := trf("detail.origin", c.Origin, client)
+	if c.OriginIface != "" {
+		s += trf("detail.origin.behind", c.OriginIface)
+	}
+	return s
+}
+
+// serviceCheckDetail describes the latest service check of the remote:
+// its name and target, the answer or the error, and when it ran.
+func (m Model) serviceCheckDetail(sc *tracker.ServiceCheck, now time.Time) string {
+	state := tr("detail.check.ok")
+	if !sc.OK {
+		state = tr("detail.check.failed")
+		if sc.Failures > 1 {
+			state += trf("detail.check.times", sc.Failures)
+		}
+	}
+	target := sc.Target
+	if m.anon != nil {
+		target = tr("detail.hidden")
+	}
+	return fmt.Sprintf("%s %s (%s), %s, %s", sc.Name, state, target, sc.Summary(), m.times.format(sc.At, now))
+}
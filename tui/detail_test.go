@@ -0,0 +1,38 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+func TestStreamDetail(t *testing.T) {
+	m := newTestModel()
+	c := testConn("curl", 100, "198.51.100.7", 8080)
+	if strings.Contains(m.renderDetail(&c), "Streams:") {
+		t.Error("Streams line without an estimate")
+	}
+	c.StreamHint, c.StreamHintSource = 3, tracker.StreamsH2C
+	if !strings.Contains(m.renderDetail(&c), "Streams:     up to 3 open at once since the last scan (h2c frame headers)") {
+		t.Errorf("h2c detail:\n%s", m.renderDetail(&c))
+	}
+	c.StreamHint, c.StreamHintSource = 1, tracker.StreamsConntrack
+	if got := streamDetail(&c); got != "1 flow through this socket (conntrack)" {
+		t.Errorf("conntrack detail %q", got)
+	}
+}
+
+func TestSockMemDetail(t *testing.T) {
+	m := newTestModel()
+	c := testConn("curl", 100, "198.51.100.7", 8080)
+	if strings.Contains(m.renderDetail(&c), "Socket mem:") {
+		t.Error("Socket mem line without the data")
+	}
+	c.SockMemInfo = &tracker.SockMemInfo{RmemAlloc: 4096, RcvBuf: 131072, SndBuf: 87040, FwdAlloc: 1024, Drops: 2}
+	c.SockMem = c.SockMemInfo.Total()
+	want := "Socket mem:  5.0 KB (read 4.0 KB of 128.0 KB, send queued 0 B (in stack 0 B) of 85.0 KB, reserved 1.0 KB, 2 drops)"
+	if detail := m.renderDetail(&c); !strings.Contains(detail, want) {
+		t.Errorf("no %q in\n%s", want, detail)
+	}
+}
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openDualStack shows the v overlay, or says how to add targets.
+func (m *Model) openDualStack() {
+	if m.tracker.DualStack() == nil {
+		m.notice = "No dual-stack targets; add them with -dual-stack host:port or dual_stack_targets"
+		return
+	}
+	m.pushMode(&dualStackMode{})
+}
+
+// dualStackMode is the v overlay.
+type dualStackMode struct{}
+
+func (d *dualStackMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	if msg.String() == "v" {
+		m.cancelMode(d)
+	}
+	return m, nil, true
+}
+
+func (d *dualStackMode) cancel(m *Model) {}
+
+func (d *dualStackMode) view(m Model) string { return m.renderDualStack() }
+
+// renderDualStack is the v overlay: each dual-stack target's IPv4 and IPv6
+// results side by side, and the average difference between the families.
+func (m Model) renderDualStack() string {
+	targets := m.tracker.DualStack().Targets()
+	lines := []string{m.st(styleTitle).Render(fmt.Sprintf("Dual-stack targets (%d)", len(targets))), ""}
+	lines = append(lines, m.st(styleHeader).Render(fmt.Sprintf("  %-28s %-30s %-30s %s", "Target", "IPv4", "IPv6", "v6 - v4")))
+	for _, t := range targets {
+		if t.Resolved.IsZero() {
+			status := "resolving"
+			if t.ResolveErr != "" {
+				status = m.st(styleBad).Render("lookup failed: " + t.ResolveErr)
+			}
+			lines = append(lines, fmt.Sprintf("  %-28s %s", truncStr(t.Name, 28), status))
+			continue
+		}
+		delta := "-"
+		if d, ok := t.Delta(); ok {
+			delta = signedMs(d)
+		}
+		lines = append(lines, fmt.Sprintf("  %-28s %-30s %-30s %s",
+			truncStr(t.Name, 28), m.familyCell(t.V4), m.familyCell(t.V6), delta))
+	}
+
+	lines = append(lines, "")
+	avg, n := tracker.DualStackDelta(targets)
+	switch {
+	case n == 0:
+		lines = append(lines, "  No target has both families measured yet")
+	case avg > 0:
+		lines = append(lines, fmt.Sprintf("  IPv6 is %s slower than IPv4 on average, over %d target%s with both", fmtMs(avg), n, plural(n)))
+	case avg < 0:
+		lines = append(lines, fmt.Sprintf("  IPv6 is %s faster than IPv4 on average, over %d target%s with both", fmtMs(-avg), n, plural(n)))
+	default:
+		lines = append(lines, fmt.Sprintf("  IPv4 and IPv6 are even on average, over %d target%s with both", n, plural(n)))
+	}
+
+	lines = append(lines, "", m.st(styleStatus).Render("v/Esc: back"))
+	return strings.Join(lines, "\n")
+}
+
+// familyCell is one family's result: "23.1ms 0% 192.0.2.1", "-" when the
+// name has no address in the family, "no answer" when every ping failed.
+func (m Model) familyCell(f tracker.FamilyPing) string {
+	switch {
+	case f.Addr == "":
+		return "-"
+	case f.Probes == 0:
+		return truncStr("probing "+m.addr(f.Addr), 30)
+	case f.RTT == 0:
+		return truncStr("no answer "+m.addr(f.Addr), 30)
+	}
+	return truncStr(fmt.Sprintf("%s %.0f%% %s", fmtMs(f.RTT), f.Loss, m.addr(f.Addr)), 30)
+}
+
+// fmtMs formats d in milliseconds with one decimal.
+func fmtMs(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
+
+// signedMs is fmtMs with an explicit sign.
+func signedMs(d time.Duration) string {
+	if d < 0 {
+		return "-" + fmtMs(-d)
+	}
+	return "+" + fmtMs(d)
+}
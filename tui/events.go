@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// togglePause pauses or resumes the display, noting it in the event log.
+func (m *Model) togglePause() {
+	m.paused = !m.paused
+	kind := tracker.EventResumed
+	if m.paused {
+		kind = tracker.EventPaused
+	}
+	m.tracker.LogEvent(tracker.Event{Time: time.Now(), Severity: tracker.SeverityInfo, Kind: kind})
+}
+
+// logMarker writes a marker to the event log, with the filter and the
+// selected row, to find a moment again when reading the log later.
+func (m *Model) logMarker() {
+	if !m.tracker.EventLogging() {
+		m.notice = "No event log: start with -event-log FILE or set event_log"
+		return
+	}
+	e := tracker.Event{Time: time.Now(), Severity: tracker.SeverityInfo, Kind: tracker.EventMarker}
+	if m.filter != "" {
+		e.Fields = append(e.Fields, tracker.EventField{Key: "filter", Value: m.filter})
+	}
+	switch {
+	case m.listingGroups():
+		if m.cursor < len(m.groups) {
+			e.Fields = append(e.Fields, tracker.EventField{Key: "group", Value: m.groups[m.cursor].Key})
+		}
+	case m.cursor < len(m.connections):
+		c := m.connections[m.cursor]
+		e.Fields = append(e.Fields,
+			tracker.EventField{Key: "app", Value: c.AppName},
+			tracker.EventField{Key: "remote", Value: fmt.Sprintf("%s:%d", c.RemoteAddr, c.RemotePort)})
+	}
+	m.tracker.LogEvent(e)
+	m.notice = "Marker written to the event log at " + e.Time.Format("15:04:05")
+}
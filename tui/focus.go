@@ -0,0 +1,87 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// focusUpdateMsg says the tracker finished a scan or a focus tick. gen is
+// the arming it was waited for under; a stale one ends its wait chain.
+type focusUpdateMsg struct{ gen int }
+
+// waitFocusUpdate waits for the tracker's next update.
+func waitFocusUpdate(updates <-chan struct{}, gen int) tea.Cmd {
+	return func() tea.Msg {
+		<-updates
+		return focusUpdateMsg{gen}
+	}
+}
+
+// SetFocusInterval sets the cadence of the F focus loop.
+func (m *Model) SetFocusInterval(d time.Duration) {
+	m.focusEvery = d
+}
+
+// toggleFocus arms the focus loop on the active filter, or disarms it.
+func (m Model) toggleFocus() (tea.Model, tea.Cmd) {
+	if _, ok := m.tracker.Focus(); ok {
+		m.tracker.DisarmFocus()
+		m.focusGen++
+		m.notice = "Focus off"
+		return m, nil
+	}
+	if m.filter == "" {
+		m.notice = "Focus: set a filter with / first"
+		return m, nil
+	}
+	every := m.focusEvery
+	if every == 0 {
+		every = tracker.DefaultFocusInterval
+	}
+	if err := m.tracker.ArmFocus(m.filter, every); err != nil {
+		m.notice = fmt.Sprintf("Focus: %v", err)
+		return m, nil
+	}
+	m.focusGen++
+	m.notice = fmt.Sprintf("Focus on %q every %s; F turns it off", m.filter, every)
+	return m, waitFocusUpdate(m.tracker.Updates(), m.focusGen)
+}
+
+// handleFocusUpdate refreshes the focused rows in place, between the
+// table's full refreshes: only their ping and loss change, and rows keep
+// their order until the next tick re-sorts.
+func (m Model) handleFocusUpdate(msg focusUpdateMsg) (tea.Model, tea.Cmd) {
+	if msg.gen != m.focusGen {
+		return m, nil
+	}
+	if _, ok := m.tracker.Focus(); !ok {
+		return m, nil
+	}
+	if !m.paused {
+		fresh := make(map[string]*tracker.Connection)
+		for _, c := range m.tracker.FocusSnapshot() {
+			fresh[c.Key()] = c
+		}
+		for i, c := range m.connections {
+			if f := fresh[c.Key()]; f != nil {
+				cp := *c // the old copy may be shared with the change log
+				cp.TakeProbe(f)
+				m.connections[i] = &cp
+			}
+		}
+	}
+	return m, waitFocusUpdate(m.tracker.Updates(), m.focusGen)
+}
+
+// focusText is the status bar note of the armed focus loop.
+func (m Model) focusText() string {
+	f, ok := m.tracker.Focus()
+	if !ok {
+		return ""
+	}
+	return trf("status.focus", f.Interval, f.Conns)
+}
@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFocusUpdatesRows(t *testing.T) {
+	m := newTestModelWith(t, testConn("game", 100, "203.0.113.5", 27015), testConn("browser", 200, "192.0.2.1", 443))
+	m.SetFocusInterval(100 * time.Millisecond)
+
+	m, cmd := press(t, m, "F")
+	if cmd != nil || !strings.Contains(m.notice, "set a filter") {
+		t.Fatalf("armed without a filter: %q", m.notice)
+	}
+	m, _ = press(t, m, "/", "g", "a", "m", "e", "enter")
+	m.refresh()
+	m, cmd = press(t, m, "F")
+	if cmd == nil || !strings.Contains(m.notice, `Focus on "game" every 100ms`) {
+		t.Fatalf("not armed: %q", m.notice)
+	}
+	m.notice = ""
+	if !strings.Contains(m.statusText(), "focus 100ms: 0 rows") {
+		t.Errorf("status %q", m.statusText())
+	}
+	if len(m.connections) != 1 || m.connections[0].Ping != 0 {
+		t.Fatalf("rows before the first tick: %v", m.connections)
+	}
+	stale := m.focusGen - 1
+
+	// The tracker's probes are off; only the focus loop sets a ping.
+	deadline := time.Now().Add(5 * time.Second)
+	for m.connections[0].Ping == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no focus tick reached the row")
+		}
+		next, _ := m.Update(cmd())
+		m = next.(Model)
+	}
+	if got := m.connections[0].Ping; got != 10*time.Millisecond {
+		t.Errorf("focused row ping %s", got)
+	}
+
+	if _, next := m.Update(focusUpdateMsg{gen: stale}); next != nil {
+		t.Error("a stale update keeps waiting")
+	}
+	m, cmd = press(t, m, "F")
+	if cmd != nil || m.notice != "Focus off" {
+		t.Fatalf("not disarmed: %q", m.notice)
+	}
+	if _, ok := m.tracker.Focus(); ok {
+		t.Error("tracker still focused")
+	}
+}
@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// frameMaxAge bounds how long a frame is reused. The table shows ages
+// computed at draw time (down for, time in state), which move on between
+// scans; a frame this old is drawn again even if nothing else changed.
+const frameMaxAge = 5 * time.Second
+
+// frameKey is what a frame depends on beyond the wall clock. rev moves on
+// with every message other than a tick and every rebuild of the rows.
+type frameKey struct {
+	rev                     uint64
+	width, height           int
+	lag, notifyWarn, notice string
+}
+
+// frameCache keeps the last drawn frame, so a tick that found the tracker
+// unchanged returns it instead of drawing the same frame again. It is
+// shared by all copies of the Model.
+type frameCache struct {
+	key frameKey
+	at  time.Time
+	out string
+}
+
+// get returns the cached frame if it was drawn for key less than
+// frameMaxAge ago.
+func (fc *frameCache) get(key frameKey, now time.Time) (string, bool) {
+	if fc.at.IsZero() || fc.key != key || now.Sub(fc.at) >= frameMaxAge {
+		return "", false
+	}
+	return fc.out, true
+}
+
+func (fc *frameCache) put(key frameKey, now time.Time, out string) {
+	fc.key, fc.at, fc.out = key, now, out
+}
+
+// snapBuffers are the two buffers refresh copies the snapshot into, in
+// turn, so the one the last refresh filled stays intact as deltaPrev
+// while the other is overwritten. What is kept for longer than that (the
+// delta log, the last announcement, a snippet's rows) keeps copies of its
+// own; see cloneConns. Shared by all copies of the Model.
+type snapBuffers struct {
+	bufs [2][]*tracker.Connection
+	next int
+}
+
+// fill copies t's connections, followed by extra, into the buffer the
+// previous fill did not use.
+func (sb *snapBuffers) fill(t *tracker.Tracker, extra []*tracker.Connection) []*tracker.Connection {
+	buf := append(t.SnapshotInto(sb.bufs[sb.next]), extra...)
+	sb.bufs[sb.next], sb.next = buf, 1-sb.next
+	return buf
+}
+
+// cloneConns copies conns out of a snapshot buffer.
+func cloneConns(conns []*tracker.Connection) []*tracker.Connection {
+	out := make([]*tracker.Connection, len(conns))
+	vals := make([]tracker.Connection, len(conns))
+	for i, c := range conns {
+		vals[i] = *c
+		out[i] = &vals[i]
+	}
+	return out
+}
+
+// needsRebuild reports whether a tick must rebuild the rows from a new
+// snapshot: the tracker moved on since the last one, a message since may
+// have changed what is shown, or the data has no generation to compare
+// (remote agents, injections that expire with time).
+func (m Model) needsRebuild() bool {
+	return m.stale || m.tracker.Generation() != m.gen || m.remotes != nil || m.injecting()
+}
+
+// frameKey returns the key of the frame m draws.
+func (m Model) frameKey() frameKey {
+	return frameKey{rev: m.rev, width: m.width, height: m.height, lag: m.lag, notifyWarn: m.notifyWarn, notice: m.notice}
+}
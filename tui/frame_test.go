@@ -0,0 +1,234 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// swapSource is a socket table a test can change between scans.
+type swapSource struct {
+	mu    sync.Mutex
+	conns staticSource
+}
+
+func (s *swapSource) set(conns ...tracker.Connection) {
+	s.mu.Lock()
+	s.conns = conns
+	s.mu.Unlock()
+}
+
+func (s *swapSource) Scan() ([]*tracker.Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns.Scan()
+}
+
+func (s *swapSource) Ping(addr string, port int) (time.Duration, float64) {
+	return 10 * time.Millisecond, 0
+}
+
+// updateModel sends msg to m through Update.
+func updateModel(m Model, msg tea.Msg) Model {
+	next, _ := m.Update(msg)
+	return next.(Model)
+}
+
+// tick sends a UI tick and reports whether it rebuilt the rows.
+func tick(t *testing.T, m Model) (Model, bool) {
+	t.Helper()
+	rev := m.rev
+	m = updateModel(m, tickMsg(time.Now()))
+	return m, m.rev != rev
+}
+
+// drawn reports whether View drew m's frame, rather than reusing it.
+func drawn(m Model) bool {
+	at := m.frame.at
+	m.View()
+	return m.frame.at != at
+}
+
+func TestFrameReused(t *testing.T) {
+	m := newTestModelWith(t, testConn("curl", 100, "192.0.2.1", 443), testConn("ssh", 200, "192.0.2.2", 22))
+	m = updateModel(m, tea.WindowSizeMsg{Width: 120, Height: 30})
+	m, _ = tick(t, m)
+	first := m.View()
+
+	m, rebuilt := tick(t, m)
+	if rebuilt {
+		t.Fatal("a tick rebuilt the rows of an unchanged tracker")
+	}
+	if drawn(m) || m.View() != first {
+		t.Error("an unchanged tick drew the frame again")
+	}
+
+	// The frame is drawn again once it is too old, for the ages it shows.
+	m.frame.at = m.frame.at.Add(-frameMaxAge)
+	if !drawn(m) {
+		t.Error("a stale frame was reused")
+	}
+	m.notice = "Saved"
+	if !drawn(m) {
+		t.Error("a new notice reused the frame")
+	}
+}
+
+// TestFrameInvalidated checks that a data change, a filter change and a
+// resize each lead to a new frame.
+func TestFrameInvalidated(t *testing.T) {
+	src := &swapSource{}
+	src.set(testConn("curl", 100, "192.0.2.1", 443))
+	tr := tracker.NewTracker(time.Hour, false)
+	tr.SetSource(src)
+	tr.Start()
+	t.Cleanup(tr.Stop)
+	m := NewModel(tr)
+	m.refresh()
+	m = updateModel(m, tea.WindowSizeMsg{Width: 120, Height: 30})
+	m, _ = tick(t, m)
+	m.View()
+
+	// Resize: a new frame at the new width.
+	m = updateModel(m, tea.WindowSizeMsg{Width: 60, Height: 30})
+	if !drawn(m) {
+		t.Error("a resize reused the frame")
+	}
+	for _, line := range strings.Split(m.View(), "\n") {
+		if w := ansi.StringWidth(line); w > 60 {
+			t.Fatalf("a %d-column line after resizing to 60: %q", w, line)
+		}
+	}
+	m = updateModel(m, tea.WindowSizeMsg{Width: 120, Height: 30})
+	m, _ = tick(t, m)
+
+	// Data: a scan that found a new connection.
+	gen := tr.Generation()
+	src.set(testConn("curl", 100, "192.0.2.1", 443), testConn("firefox", 300, "192.0.2.3", 443))
+	tr.SetInterval(5 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.Generation() == gen || len(tr.Snapshot()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("no scan")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tr.SetInterval(time.Hour)
+	m, rebuilt := tick(t, m)
+	if !rebuilt || !drawn(m) || !strings.Contains(m.View(), "firefox") {
+		t.Fatalf("a new connection was not drawn:\n%s", m.View())
+	}
+
+	// Filter: the key rebuilds, and so does the next tick.
+	m, _ = press(t, m, "/", "c", "u", "r", "l", "enter")
+	m, _ = tick(t, m)
+	if len(m.connections) != 1 || strings.Contains(m.View(), "firefox") {
+		t.Errorf("%d rows after filtering", len(m.connections))
+	}
+	m, _ = press(t, m, "c")
+	if m, _ = tick(t, m); len(m.connections) != 2 {
+		t.Errorf("%d rows after clearing the filter", len(m.connections))
+	}
+}
+
+// TestRefreshBuffers checks that refreshes take turns between two
+// snapshot buffers, and that the delta log keeps copies of its own.
+func TestRefreshBuffers(t *testing.T) {
+	m := newTestModelWith(t, testConn("curl", 100, "192.0.2.1", 443), testConn("ssh", 200, "192.0.2.2", 22))
+	first := slices.Clone(m.deltaPrev)
+	m.refresh()
+	second := slices.Clone(m.deltaPrev)
+	if len(second) != 2 || slices.ContainsFunc(second, func(c *tracker.Connection) bool { return slices.Contains(first, c) }) {
+		t.Error("a refresh overwrote the snapshot of the one before")
+	}
+	m.refresh()
+	if !sameValues(m.deltaPrev, first) {
+		t.Error("the third refresh did not reuse the first one's buffer")
+	}
+
+	// The ssh connection closes; its log entry must outlive the buffer.
+	prev := m.deltaPrev
+	m.recordDelta(cloneConns(prev[:1]))
+	if len(m.deltaLog) != 1 {
+		t.Fatalf("%d changes logged", len(m.deltaLog))
+	}
+	if c := m.deltaLog[0].Change.Conn; slices.Contains(prev, c) || c.AppName != prev[1].AppName {
+		t.Errorf("the change log shares %s with the snapshot buffer", c.AppName)
+	}
+}
+
+// sameValues reports whether a and b point to the same connection values,
+// in any order.
+func sameValues(a, b []*tracker.Connection) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	in := make(map[*tracker.Connection]bool, len(a))
+	for _, c := range a {
+		in[c] = true
+	}
+	for _, c := range b {
+		if !in[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// frameModel is a model over a tracker with n connections.
+func frameModel(b *testing.B, n int) Model {
+	conns := make(staticSource, n)
+	for i := range conns {
+		conns[i] = testConn(fmt.Sprintf("app%d", i%40), 1000+i, fmt.Sprintf("10.0.%d.%d", i/250, i%250), 1+i%1000)
+	}
+	tr := tracker.NewTracker(time.Hour, false)
+	tr.SetSource(conns)
+	tr.Start()
+	b.Cleanup(tr.Stop)
+	m := NewModel(tr)
+	m.refresh()
+	m = updateModel(m, tea.WindowSizeMsg{Width: 160, Height: 50})
+	m = updateModel(m, tickMsg(time.Now()))
+	m.View()
+	return m
+}
+
+// BenchmarkTickUnchanged is a UI tick and frame with 5000 connections that
+// did not change: no snapshot, no sort, the frame reused.
+func BenchmarkTickUnchanged(b *testing.B) {
+	m := frameModel(b, 5000)
+	b.ReportAllocs()
+	for b.Loop() {
+		m = updateModel(m, tickMsg(time.Now()))
+		m.View()
+	}
+}
+
+// BenchmarkTickRebuild is the same tick when the rows must be rebuilt.
+func BenchmarkTickRebuild(b *testing.B) {
+	m := frameModel(b, 5000)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.stale = true
+		m = updateModel(m, tickMsg(time.Now()))
+		m.View()
+	}
+}
+
+// BenchmarkRefresh rebuilds the rows of 5000 connections from a snapshot
+// copied into the reused buffers, without drawing them.
+func BenchmarkRefresh(b *testing.B) {
+	m := frameModel(b, 5000)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.refresh()
+	}
+}
@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// gotoMode is the goto prompt opened with ' or :. Enter jumps and Esc
+// cancels; either closes the prompt.
+type gotoMode struct {
+	query string // text typed so far
+}
+
+func (g *gotoMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter":
+		m.endMode(g)
+		m.jumpTo(strings.TrimSpace(g.query))
+	default:
+		g.query = editInput(g.query, msg)
+	}
+	return m, nil, true
+}
+
+func (g *gotoMode) cancel(m *Model) {}
+
+func (g *gotoMode) typing() {}
+
+// jumpTo moves the cursor to the row described by query: a 1-based row
+// number (clamped to the table), else the first row whose app name (or group
+// key) starts with or contains query, else the first row with a matching
+// address. A miss leaves the cursor where it is and says so.
+func (m *Model) jumpTo(query string) {
+	count := m.rowCount()
+	if query == "" || count == 0 {
+		return
+	}
+	if n, err := strconv.Atoi(query); err == nil {
+		row := minInt(maxInt(n, 1), count)
+		if n > count {
+			m.notice = fmt.Sprintf("Only %d rows; jumped to the last", count)
+		}
+		m.moveCursor(row - 1)
+		return
+	}
+
+	q := strings.ToLower(query)
+	for _, match := range []func(i int) bool{
+		func(i int) bool { return strings.HasPrefix(m.rowName(i), q) },
+		func(i int) bool { return strings.Contains(m.rowName(i), q) },
+		func(i int) bool { return m.rowAddrMatches(i, q) },
+	} {
+		for i := 0; i < count; i++ {
+			if match(i) {
+				m.moveCursor(i)
+				return
+			}
+		}
+	}
+	m.notice = fmt.Sprintf("No row matches %q", query)
+}
+
+// rowName is the lower-cased app name (or group key) of row i.
+func (m Model) rowName(i int) string {
+	if m.listingGroups() {
+		return strings.ToLower(m.groups[i].Key)
+	}
+	return strings.ToLower(m.connections[i].AppName)
+}
+
+// rowAddrMatches reports whether row i's remote or local address contains q.
+func (m Model) rowAddrMatches(i int, q string) bool {
+	if m.listingGroups() {
+		return strings.Contains(strings.ToLower(m.groups[i].Key), q)
+	}
+	c := m.connections[i]
+	return strings.Contains(strings.ToLower(c.RemoteAddr), q) || strings.Contains(strings.ToLower(c.LocalAddr), q)
+}
+
+// jumpApp moves the cursor to the first row of the next (dir 1) or
+// previous (dir -1) app in the current order: the nearest row whose app
+// differs from the selected one, then back to the start of that app's run
+// of rows. It works for any sort; when sorted by app every app is one run.
+// Listing groups, each row is its own group. The ends do not wrap.
+func (m *Model) jumpApp(dir int) {
+	count := m.rowCount()
+	if count == 0 {
+		return
+	}
+	cur := minInt(m.cursor, count-1)
+	name := m.rowName(cur)
+	i := cur + dir
+	for i >= 0 && i < count && !m.listingGroups() && m.rowName(i) == name {
+		i += dir
+	}
+	if i < 0 || i >= count {
+		if dir > 0 {
+			m.notice = "Already at the last app"
+		} else {
+			m.notice = "Already at the first app"
+		}
+		return
+	}
+	if dir < 0 && !m.listingGroups() {
+		name = m.rowName(i)
+		for i > 0 && m.rowName(i-1) == name {
+			i--
+		}
+	}
+	m.moveCursor(i)
+}
+
+// moveCursor selects row i and scrolls the least needed to show it.
+func (m *Model) moveCursor(i int) {
+	m.cursor = i
+	maxVisible := m.visibleRows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+maxVisible {
+		m.offset = m.cursor - maxVisible + 1
+	}
+}
@@ -0,0 +1,176 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+// gotoModel is a 10-row viewport over 30 connections: apps app00..app26,
+// then redis and nginx, plus one to a distinct remote.
+func gotoModel(t *testing.T) Model {
+	var conns []tracker.Connection
+	for i := range 27 {
+		conns = append(conns, testConn(fmt.Sprintf("app%02d", i), 100+i, "192.0.2.1", 1000+i))
+	}
+	conns = append(conns,
+		testConn("redis", 200, "192.0.2.1", 6379),
+		testConn("nginx", 201, "192.0.2.1", 80),
+		testConn("mail", 202, "198.51.100.25", 993))
+	m := newTestModelWith(t, conns...)
+	m.width, m.height = 120, 16
+	if m.visibleRows() != 10 {
+		t.Fatalf("%d visible rows, want 10", m.visibleRows())
+	}
+	return m
+}
+
+// rowOf is the row index of the first connection whose app starts with app.
+func rowOf(t *testing.T, m Model, app string) int {
+	t.Helper()
+	for i, c := range m.connections {
+		if strings.HasPrefix(c.AppName, app) {
+			return i
+		}
+	}
+	t.Fatalf("no row for %s", app)
+	return -1
+}
+
+func TestGotoRowNumber(t *testing.T) {
+	tests := []struct {
+		keys           []string
+		cursor, offset int
+		notice         string
+	}{
+		{[]string{"'", "1", "5", "enter"}, 14, 5, ""},
+		{[]string{":", "3", "enter"}, 2, 0, ""},
+		{[]string{"'", "30", "enter"}, 29, 20, ""},
+		{[]string{"'", "999", "enter"}, 29, 20, "Only 30 rows"},
+		{[]string{"'", "0", "enter"}, 0, 0, ""},
+		{[]string{"'", "2", "x", "backspace", "0", "enter"}, 19, 10, ""},
+		{[]string{"'", "enter"}, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		m, _ := press(t, gotoModel(t), tt.keys...)
+		if _, ok := findMode[*gotoMode](m); ok {
+			t.Errorf("%v: prompt still open", tt.keys)
+		}
+		if m.cursor != tt.cursor || m.offset != tt.offset {
+			t.Errorf("%v: cursor %d offset %d, want %d %d", tt.keys, m.cursor, m.offset, tt.cursor, tt.offset)
+		}
+		if !strings.HasPrefix(m.notice, tt.notice) || (tt.notice == "" && m.notice != "") {
+			t.Errorf("%v: notice %q, want %q", tt.keys, m.notice, tt.notice)
+		}
+	}
+}
+
+func TestGotoFromScrolledView(t *testing.T) {
+	m, _ := press(t, gotoModel(t), "'", "25", "enter")
+	m, _ = press(t, m, "'", "2", "enter")
+	if m.cursor != 1 || m.offset != 1 {
+		t.Fatalf("cursor %d offset %d, want the viewport to scroll back to row 2", m.cursor, m.offset)
+	}
+}
+
+func TestGotoName(t *testing.T) {
+	m := gotoModel(t)
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"redis", rowOf(t, m, "redis")},
+		{"RED", rowOf(t, m, "redis")},
+		{"gin", rowOf(t, m, "nginx")},   // substring when no prefix matches
+		{"app1", rowOf(t, m, "app1")},   // prefix: the first of app10..app19
+		{"198.51", rowOf(t, m, "mail")}, // remote address fragment
+		{"10.0.0", 0},                   // local address, first row
+	}
+	for _, tt := range tests {
+		got, _ := press(t, m, "'", tt.query, "enter")
+		if got.cursor != tt.want {
+			t.Errorf("%q: cursor %d, want %d", tt.query, got.cursor, tt.want)
+		}
+		if got.cursor < got.offset || got.cursor >= got.offset+got.visibleRows() {
+			t.Errorf("%q: cursor %d outside the viewport at %d", tt.query, got.cursor, got.offset)
+		}
+	}
+}
+
+func TestGotoMissAndCancel(t *testing.T) {
+	m, _ := press(t, gotoModel(t), "'", "5", "enter")
+
+	got, _ := press(t, m, "'", "postgres", "enter")
+	if got.cursor != 4 || !strings.Contains(got.notice, `"postgres"`) {
+		t.Errorf("miss: cursor %d, notice %q", got.cursor, got.notice)
+	}
+
+	got, _ = press(t, m, "'", "2", "0", "esc")
+	if _, ok := findMode[*gotoMode](got); ok {
+		t.Error("prompt open after Esc")
+	}
+	if got.cursor != 4 || got.offset != 0 {
+		t.Errorf("Esc moved the cursor to %d (offset %d)", got.cursor, got.offset)
+	}
+}
+
+// appsModel has runs of 4 chrome, 1 curl, 3 firefox and 2 spotify rows.
+func appsModel(t *testing.T) Model {
+	var conns []tracker.Connection
+	for i, app := range []string{"chrome", "chrome", "chrome", "chrome", "curl", "firefox", "firefox", "firefox", "spotify", "spotify"} {
+		conns = append(conns, testConn(app, 100+len(app), fmt.Sprintf("192.0.2.%d", i+1), 443))
+	}
+	m := newTestModelWith(t, conns...)
+	m.width, m.height = 120, 9
+	return m
+}
+
+func TestJumpApp(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m Model) Model
+		keys  []string
+		want  []int // cursor after each key
+	}{
+		{"sorted by app", nil,
+			[]string{"]", "]", "]", "]", "[", "[", "[", "["}, []int{4, 5, 8, 8, 5, 4, 0, 0}},
+		{"sorted by app, descending", func(m Model) Model { m, _ = press(t, m, "1"); return m },
+			[]string{"]", "]", "]", "[", "[", "["}, []int{2, 5, 6, 5, 2, 0}},
+		{"from the middle of a run", func(m Model) Model { m.moveCursor(6); return m },
+			[]string{"[", "]"}, []int{4, 5}},
+		{"interleaved, as by ping", func(m Model) Model {
+			// chrome chrome firefox chrome spotify spotify firefox
+			order := []int{0, 1, 5, 2, 8, 9, 6}
+			conns := make([]*tracker.Connection, len(order))
+			for i, j := range order {
+				conns[i] = m.connections[j]
+			}
+			m.connections = conns
+			return m
+		}, []string{"]", "]", "]", "]", "]", "[", "[", "[", "["}, []int{2, 3, 4, 6, 6, 4, 3, 2, 0}},
+		{"groups", func(m Model) Model { m, _ = press(t, m, "b"); return m },
+			[]string{"]", "]", "]", "]", "[", "["}, []int{1, 2, 3, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		m := appsModel(t)
+		if tt.setup != nil {
+			m = tt.setup(m)
+		}
+		for i, k := range tt.keys {
+			m.notice = ""
+			m, _ = press(t, m, k)
+			if m.cursor != tt.want[i] {
+				t.Errorf("%s: key %d (%s): cursor %d, want %d", tt.name, i+1, k, m.cursor, tt.want[i])
+				break
+			}
+			if m.cursor < m.offset || m.cursor >= m.offset+m.visibleRows() {
+				t.Errorf("%s: key %d: cursor %d outside the viewport at %d", tt.name, i+1, m.cursor, m.offset)
+			}
+			if i > 0 && m.cursor == tt.want[i-1] && m.notice == "" {
+				t.Errorf("%s: key %d: stopped at an end without a notice", tt.name, i+1)
+			}
+		}
+	}
+}
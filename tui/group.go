@@ -0,0 +1,317 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"ping-tracker/tracker"
+)
+
+// groupMode selects how the table aggregates connections.
+type groupMode int
+
+const (
+	groupNone groupMode = iota
+	groupApp
+	groupRemote
+)
+
+var groupModeNames = []string{"none", "app", "remote host"}
+
+// groupKeys maps each grouping mode to its key function.
+var groupKeys = map[groupMode]tracker.GroupKeyFunc{
+	groupApp:    tracker.GroupByApp,
+	groupRemote: tracker.GroupByRemoteHost,
+}
+
+// listingGroups reports whether the table shows group rows rather than
+// connections (grouping is on and no group is drilled into).
+func (m Model) listingGroups() bool {
+	return m.groupBy != groupNone && m.drillGroup == ""
+}
+
+// rowCount is the number of rows the cursor moves over.
+func (m Model) rowCount() int {
+	if m.listingGroups() {
+		return len(m.groups)
+	}
+	return len(m.connections)
+}
+
+// applyGrouping builds the group rows, or narrows the connections to the
+// drilled-into group. Called from refresh after filtering.
+func (m *Model) applyGrouping() {
+	m.groups = nil
+	if m.groupBy == groupNone {
+		return
+	}
+	key := groupKeys[m.groupBy]
+	if m.drillGroup != "" {
+		var members []*tracker.Connection
+		for _, c := range m.connections {
+			if key(c) == m.drillGroup {
+				members = append(members, c)
+			}
+		}
+		m.connections = members
+		return
+	}
+	m.groups = tracker.GroupBy(m.connections, key)
+	m.sortGroups()
+}
+
+// groupSortFields are the sorts groups have an aggregate for; the others
+// apply to rows only.
+var groupSortFields = map[SortField]bool{SortApp: true, SortPing: true, SortTxRate: true, SortRxRate: true, SortScore: true, SortSockMem: true}
+
+// shiftedDigits are the keys shift+1 to shift+0 type on a US layout; they
+// set the group sort as 1-0 set the row sort.
+var shiftedDigits = map[string]SortField{
+	"!": SortApp, "@": SortPing, "#": SortLoss, "$": SortTxRate, "%": SortRxRate,
+	"^": SortState, "&": SortLossTrend, "*": SortAudit, "(": SortStateTime, ")": SortScore,
+}
+
+// toggleGroupSort sets the order of group rows, independently of the
+// order of the rows within a group, keeping the cursor on its group.
+func (m *Model) toggleGroupSort(field SortField) {
+	if !groupSortFields[field] {
+		m.notice = "Groups sort by app or host (shift+1), ping (shift+2), TX (shift+4), RX (shift+5), score (shift+0) or socket memory (U)"
+		return
+	}
+	if m.groupSort == field {
+		m.groupSortAsc = !m.groupSortAsc
+	} else {
+		m.groupSort, m.groupSortAsc = field, true
+	}
+	selected := ""
+	if m.listingGroups() && m.cursor < len(m.groups) {
+		selected = m.groups[m.cursor].Key
+	}
+	m.sortGroups()
+	for i, g := range m.groups {
+		if g.Key == selected {
+			m.moveCursor(i)
+			break
+		}
+	}
+	m.rows.reset()
+}
+
+// groupSortName is the status bar name of the group sort, e.g. "TX desc".
+// It uses the row sort's names, except that groups sort by their key
+// where rows sort by app.
+func (m Model) groupSortName() string {
+	name := tr(sortKeys[m.groupSort])
+	if m.groupSort == SortApp {
+		name = tr("sort.group_key")
+	}
+	if m.groupSortAsc {
+		return name + " " + tr("status.asc")
+	}
+	return name + " " + tr("status.desc")
+}
+
+// sortGroups orders group rows by the group sort (ping, TX, RX, score by
+// the worst member, socket memory), and by key otherwise. Rows within a group follow the
+// row sort when it is drilled into.
+func (m *Model) sortGroups() {
+	sort.SliceStable(m.groups, func(i, j int) bool {
+		a, b := m.groups[i], m.groups[j]
+		cmp := 0
+		switch m.groupSort {
+		case SortPing:
+			cmp = compareDuration(a.Ping, b.Ping)
+		case SortTxRate:
+			cmp = compareFloat(a.TxRate, b.TxRate)
+		case SortRxRate:
+			cmp = compareFloat(a.RxRate, b.RxRate)
+		case SortScore:
+			cmp = groupScoreKey(a) - groupScoreKey(b)
+		case SortSockMem:
+			cmp = compareFloat(float64(a.SockMem), float64(b.SockMem))
+		default:
+			cmp = strings.Compare(strings.ToLower(a.Key), strings.ToLower(b.Key))
+		}
+		if !m.groupSortAsc {
+			cmp = -cmp
+		}
+		return cmp < 0
+	})
+}
+
+// groupScoreKey orders groups by their worst score, unscored groups after
+// perfect ones.
+func groupScoreKey(g tracker.Group) int {
+	if g.Scored == 0 {
+		return 101
+	}
+	return g.WorstScore
+}
+
+// cycleGrouping switches to the next grouping mode.
+func (m *Model) cycleGrouping() {
+	m.groupBy = (m.groupBy + 1) % groupMode(len(groupModeNames))
+	if d, ok := findMode[*drillMode](*m); ok {
+		m.endMode(d)
+	}
+	m.drillGroup = ""
+	m.cursor = 0
+	m.offset = 0
+	m.refresh()
+}
+
+// groupLabel is the displayed key of a group.
+func (m Model) groupLabel(g tracker.Group) string {
+	c := g.Conns[0]
+	if m.groupBy == groupApp {
+		return m.appName(c)
+	}
+	if c.Host != "" {
+		return m.hostName(c.Host) + " " + m.addr(c.RemoteAddr)
+	}
+	return m.addr(c.RemoteAddr)
+}
+
+// groupColumns lists the columns of the group table, in order, in the
+// shape of the connection table's: the sorts are group sorts. Socket
+// memory is only shown where a scanner reports it (ss on Linux).
+func (m Model) groupColumns() []tableColumn {
+	colConns := 6
+	if m.overflow.Conns > 0 && m.groupBy == groupApp {
+		colConns = 12 // tracked+overflow
+	}
+	keyName := "[!]" + tr("col.remote_host")
+	otherName := tr("col.apps")
+	if m.groupBy == groupApp {
+		keyName = "[!]" + tr("col.app")
+		otherName = tr("col.remotes")
+	}
+	by := func(f SortField) []sortKey { return []sortKey{{field: f}} }
+	cols := []tableColumn{
+		{keyName, 28, 0, by(SortApp)},
+		{otherName, 30, 0, nil},
+		{tr("col.conns"), colConns, colConns, nil},
+		{tr("col.endpoints"), 9, 9, nil},
+		{"[@]" + tr("col.ping"), 10, 10, by(SortPing)},
+		{"[)]" + tr("col.score_range"), 16, 16, by(SortScore)},
+		{"[$]" + tr("col.tx"), 10, 10, by(SortTxRate)},
+		{"[%]" + tr("col.rx"), 10, 10, by(SortRxRate)},
+	}
+	if m.groupsSockMem() {
+		cols = append(cols, tableColumn{"[U]" + tr("col.sockmem"), 12, 12, by(SortSockMem)})
+	}
+	return cols
+}
+
+// groupsSockMem reports whether a group has socket memory to show.
+func (m Model) groupsSockMem() bool {
+	return slices.ContainsFunc(m.groups, func(g tracker.Group) bool { return g.HasSockMem })
+}
+
+// groupCells pads the cells of a group table line to cols: text columns
+// cut and left-aligned, numeric ones right-aligned, headers included.
+func groupCells(cols []tableColumn, cells []string) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		if c.value > 0 {
+			out[i] = padLeft(cells[i], c.width)
+		} else {
+			out[i] = padRight(truncStr(cells[i], c.width), c.width)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// renderGroupRows writes the header and visible group rows into b.
+func (m Model) renderGroupRows(b *strings.Builder) {
+	cols := m.groupColumns()
+	sockMem := m.groupsSockMem()
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.header
+	}
+	b.WriteString(m.st(styleHeader).Render(truncate(groupCells(cols, headers), m.width)) + "\n")
+
+	maxRows := m.visibleRows()
+	end := minInt(m.offset+maxRows, len(m.groups))
+	for i := m.offset; i < end; i++ {
+		g := m.groups[i]
+		var others []string
+		if m.groupBy == groupApp {
+			seen := make(map[string]bool)
+			for _, c := range g.Conns {
+				if r := m.addr(c.RemoteAddr); !seen[r] {
+					seen[r] = true
+					others = append(others, r)
+				}
+			}
+		} else {
+			for _, a := range g.Apps {
+				if m.anon != nil {
+					a = m.anon.app(a)
+				}
+				others = append(others, a)
+			}
+		}
+
+		ping := "-"
+		if g.Ping > 0 {
+			ping = locale.Number(fmt.Sprintf("%.1fms", float64(g.Ping.Microseconds())/1000.0))
+		}
+		score := "-"
+		if g.Scored > 0 {
+			score = fmt.Sprintf("%d/%d", g.WorstScore, g.AvgScore)
+		}
+		conns := locale.Int(len(g.Conns))
+		if n := m.overflow.ByApp[g.Key]; n > 0 && m.groupBy == groupApp {
+			conns += "+" + locale.Int(n)
+		}
+		cells := []string{m.groupLabel(g), strings.Join(others, ", "), conns, locale.Int(g.Endpoints), ping, score,
+			locale.Number(tracker.FormatBytes(g.TxRate)), locale.Number(tracker.FormatBytes(g.RxRate))}
+		if sockMem {
+			mem := "-"
+			if g.HasSockMem {
+				mem = locale.Number(tracker.FormatBytesTotal(g.SockMem))
+			}
+			cells = append(cells, mem)
+		}
+		row := groupCells(cols, cells)
+		if i == m.cursor {
+			b.WriteString(m.st(styleSelection).Render(row) + "\n")
+		} else {
+			b.WriteString(m.st(styleRow).Render(row) + "\n")
+		}
+	}
+	for i := end - m.offset; i < maxRows; i++ {
+		b.WriteString("\n")
+	}
+}
+
+// overflowText is the footer under the table while the connection cap is
+// exceeded: how many sockets were left out, of how many apps, and their
+// most common states.
+func (m Model) overflowText() string {
+	o := m.overflow
+	states := make([]tracker.ConnState, 0, len(o.ByState))
+	for st := range o.ByState {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if o.ByState[states[i]] != o.ByState[states[j]] {
+			return o.ByState[states[i]] > o.ByState[states[j]]
+		}
+		return states[i] < states[j]
+	})
+	var parts []string
+	for i, st := range states {
+		if i == 3 {
+			parts = append(parts, "...")
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", o.ByState[st], st))
+	}
+	return fmt.Sprintf("  …and %d more (%d app%s) over -max-connections, not tracked: %s",
+		o.Conns, o.Apps(), plural(o.Apps()), strings.Join(parts, ", "))
+}
@@ -0,0 +1,162 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/i18n"
+	"ping-tracker/tracker"
+)
+
+func TestGroupingKeys(t *testing.T) {
+	m := newTestModelWith(t,
+		testConn("firefox", 1, "192.0.2.1", 443),
+		testConn("curl", 2, "192.0.2.1", 80),
+		testConn("firefox", 1, "198.51.100.7", 443),
+	)
+	m, _ = press(t, m, "b")
+	if m.groupBy != groupApp || len(m.groups) != 2 {
+		t.Fatalf("by app: mode %d, %d groups", m.groupBy, len(m.groups))
+	}
+	m, _ = press(t, m, "b")
+	if m.groupBy != groupRemote || len(m.groups) != 2 {
+		t.Fatalf("by host: mode %d, %d groups", m.groupBy, len(m.groups))
+	}
+
+	// Enter lists the group's connections, Esc goes back to the groups.
+	m.moveCursor(0)
+	host := m.groups[0].Key
+	m, _ = press(t, m, "enter")
+	if m.drillGroup != host || len(m.connections) != 2 || m.listingGroups() {
+		t.Fatalf("drilled into %q: %d connections", m.drillGroup, len(m.connections))
+	}
+	for _, c := range m.connections {
+		if c.RemoteAddr != host {
+			t.Errorf("%s in the %s group", c.RemoteAddr, host)
+		}
+	}
+	m, _ = press(t, m, "esc")
+	if m.drillGroup != "" || !m.listingGroups() || len(m.groups) != 2 {
+		t.Fatal("esc did not go back to the groups")
+	}
+
+	m, _ = press(t, m, "b")
+	if m.groupBy != groupNone || len(m.connections) != 3 {
+		t.Fatalf("ungrouped: mode %d, %d connections", m.groupBy, len(m.connections))
+	}
+}
+
+// TestSortNames checks that every sort field, the group-only ones
+// included, is named in every catalog.
+func TestSortNames(t *testing.T) {
+	if len(sortKeys) != int(SortSockMem)+1 {
+		t.Fatalf("%d sort names for %d fields", len(sortKeys), SortSockMem+1)
+	}
+	for _, lang := range i18n.Languages() {
+		msgs, err := i18n.Catalog(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for f, key := range sortKeys {
+			if SortField(f) != SortDerived && msgs[key] == "" {
+				t.Errorf("%s: no name for sort field %d (%q)", lang, f, key)
+			}
+		}
+	}
+
+	m := newTestModel()
+	for f := range groupSortFields {
+		m.groupSort, m.groupSortAsc = f, false
+		want := tr(sortKeys[f]) + " desc"
+		if f == SortApp {
+			want = "Key desc"
+		}
+		if got := m.groupSortName(); got != want {
+			t.Errorf("group sort %d: %q, want %q", f, got, want)
+		}
+	}
+}
+
+// TestGroupSort orders groups with the shifted digits and the rows of a
+// group with the digits, each on its own.
+func TestGroupSort(t *testing.T) {
+	conn := func(app string, port int, ping time.Duration, tx float64) tracker.Connection {
+		c := testConn(app, len(app), "192.0.2.1", port)
+		c.Ping, c.PingCount, c.TxRate = ping, 3, tx
+		return c
+	}
+	// Both alpha rows come from one scan, so either is the group's latest
+	// ping: both sort alpha last.
+	m := newTestModelWith(t,
+		conn("alpha", 1, 80*time.Millisecond, 100),
+		conn("alpha", 2, 70*time.Millisecond, 50),
+		conn("bravo", 3, 10*time.Millisecond, 500),
+		conn("charlie", 4, 30*time.Millisecond, 300),
+	)
+	groupKeys := func(m Model) string {
+		var keys []string
+		for _, g := range m.groups {
+			keys = append(keys, g.Key)
+		}
+		return strings.Join(keys, " ")
+	}
+	m, _ = press(t, m, "b")
+	tests := []struct {
+		key, order, name string
+	}{
+		{"", "alpha bravo charlie", "Key asc"},
+		{"!", "charlie bravo alpha", "Key desc"},
+		{"@", "bravo charlie alpha", "Ping asc"},
+		{"@", "alpha charlie bravo", "Ping desc"},
+		{"$", "alpha charlie bravo", "TX asc"},
+		{"$", "bravo charlie alpha", "TX desc"},
+	}
+	for _, tt := range tests {
+		if tt.key != "" {
+			m, _ = press(t, m, tt.key)
+		}
+		if got := groupKeys(m); got != tt.order || m.groupSortName() != tt.name {
+			t.Errorf("after %q: %s (%s), want %s (%s)", tt.key, got, m.groupSortName(), tt.order, tt.name)
+		}
+	}
+	if m.sortField != SortApp || !m.sortAsc {
+		t.Errorf("group sort changed the row sort: %d %v", m.sortField, m.sortAsc)
+	}
+
+	// The row sort leaves the groups alone; the cursor follows its group.
+	m, _ = press(t, m, "2")
+	if got := groupKeys(m); got != "bravo charlie alpha" {
+		t.Errorf("row sort reordered groups: %s", got)
+	}
+	m.moveCursor(2)
+	m, _ = press(t, m, "@")
+	if m.groups[m.cursor].Key != "alpha" {
+		t.Errorf("cursor on %s after the group sort", m.groups[m.cursor].Key)
+	}
+	m, _ = press(t, m, "#")
+	if !strings.HasPrefix(m.notice, "Groups sort by") || m.groupSort != SortPing {
+		t.Errorf("loss group sort: %q, sort %d", m.notice, m.groupSort)
+	}
+
+	// Inside a group the rows follow the row sort. (Enter on an app
+	// group shows its ports first.)
+	m.drillInto("alpha")
+	pings := func(m Model) []time.Duration {
+		var out []time.Duration
+		for _, c := range m.connections {
+			out = append(out, c.Ping)
+		}
+		return out
+	}
+	if got := pings(m); len(got) != 2 || got[0] != 70*time.Millisecond {
+		t.Errorf("alpha by ping asc: %v", got)
+	}
+	m, _ = press(t, m, "2")
+	if got := pings(m); got[0] != 80*time.Millisecond {
+		t.Errorf("alpha by ping desc: %v", got)
+	}
+	if m.groupSort != SortPing || !m.groupSortAsc {
+		t.Errorf("row sort changed the group sort: %d %v", m.groupSort, m.groupSortAsc)
+	}
+}
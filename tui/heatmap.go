@@ -0,0 +1,196 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// heatLevels are the shades of a heatmap cell, best first, each drawn two
+// characters wide in its style.
+var heatLevels = []struct {
+	glyph string
+	style styleName
+}{
+	{"░", styleGood},
+	{"▒", styleWarn},
+	{"▓", styleWarn},
+	{"█", styleBad},
+}
+
+// heatRTTSteps are the bounds between the RTT levels, as a factor of the
+// best hour's median: a cell within 20% of it is level 0.
+var heatRTTSteps = []float64{1.2, 1.5, 2}
+
+// heatLossSteps are the bounds between the loss levels, in percent.
+var heatLossSteps = []float64{1, 5, 15}
+
+// heatDays label the heatmap's rows.
+var heatDays = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// openHeatmap shows the W overlay, or says why there is nothing to show.
+func (m *Model) openHeatmap() {
+	if len(m.tracker.Heatmap().Series()) == 0 {
+		if m.tracker.DualStack() == nil {
+			m.notice = "No heatmap: it maps dual-stack targets; add them with -dual-stack host:port or dual_stack_targets"
+		} else {
+			m.notice = "No heatmap data yet: the dual-stack targets have not been probed"
+		}
+		return
+	}
+	m.pushMode(&heatmapMode{})
+}
+
+// heatmapMode is the W overlay: one series at a time, by RTT or by loss.
+type heatmapMode struct {
+	series int // index into Heatmap().Series()
+	loss   bool
+}
+
+func (hm *heatmapMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	n := len(m.tracker.Heatmap().Series())
+	switch msg.String() {
+	case "W":
+		m.cancelMode(hm)
+	case "tab", "right", "l":
+		if n == 0 {
+			break
+		}
+		hm.series = (hm.series + 1) % n
+	case "shift+tab", "left", "h":
+		if n == 0 {
+			break
+		}
+		hm.series = (hm.series + n - 1) % n
+	case "m":
+		hm.loss = !hm.loss
+	}
+	return m, nil, true
+}
+
+func (hm *heatmapMode) cancel(m *Model) {}
+
+func (hm *heatmapMode) view(m Model) string { return m.renderHeatmap(hm) }
+
+// renderHeatmap draws a series' week: a row per day, a cell per hour,
+// shaded by the hour's median RTT relative to the best hour, or by its
+// mean loss.
+func (m Model) renderHeatmap(hm *heatmapMode) string {
+	names := m.tracker.Heatmap().Series()
+	if len(names) == 0 {
+		return m.st(styleTitle).Render("No heatmap data") + "\n\n" + m.st(styleStatus).Render("W/Esc: back")
+	}
+	hm.series = min(hm.series, len(names)-1)
+	name := names[hm.series]
+	grid := m.tracker.Heatmap().Grid(name)
+
+	metric := "Median ping"
+	if hm.loss {
+		metric = "Mean loss"
+	}
+	lines := []string{
+		m.st(styleTitle).Render(fmt.Sprintf("%s by hour of the week: %s (%d of %d)", metric, name, hm.series+1, len(names))),
+		"",
+	}
+
+	var best time.Duration
+	for _, c := range grid {
+		if c.HasRTT() && (best == 0 || c.Median < best) {
+			best = c.Median
+		}
+	}
+	level := func(c tracker.HeatCell) (int, bool) {
+		if hm.loss {
+			if !c.HasLoss() {
+				return 0, false
+			}
+			return heatLevel(c.Loss, heatLossSteps), true
+		}
+		if !c.HasRTT() {
+			return 0, false
+		}
+		return heatLevel(float64(c.Median)/float64(best), heatRTTSteps), true
+	}
+
+	var hours strings.Builder
+	for h := 0; h < 24; h += 3 {
+		fmt.Fprintf(&hours, "%-6s", fmt.Sprintf("%02d", h))
+	}
+	lines = append(lines, m.st(styleHeader).Render("      "+strings.TrimRight(hours.String(), " ")))
+	for day, label := range heatDays {
+		var row strings.Builder
+		row.WriteString("  " + label + " ")
+		for h := 0; h < 24; h++ {
+			c := grid[day*24+h]
+			l, ok := level(c)
+			switch {
+			case ok:
+				row.WriteString(m.st(heatLevels[l].style).Render(strings.Repeat(heatLevels[l].glyph, 2)))
+			case !hm.loss && c.HasLoss() && c.Loss >= 100:
+				row.WriteString(m.st(styleBad).Render("××"))
+			default:
+				row.WriteString(m.st(styleStale).Render("··"))
+			}
+		}
+		lines = append(lines, row.String())
+	}
+
+	lines = append(lines, "")
+	var legend []string
+	if hm.loss {
+		legend = append(legend, m.heatLegend(0, fmt.Sprintf("<%g%%", heatLossSteps[0])))
+		for i := 1; i < len(heatLevels)-1; i++ {
+			legend = append(legend, m.heatLegend(i, fmt.Sprintf("%g-%g%%", heatLossSteps[i-1], heatLossSteps[i])))
+		}
+		legend = append(legend, m.heatLegend(len(heatLevels)-1, fmt.Sprintf(">=%g%%", heatLossSteps[len(heatLossSteps)-1])))
+	} else if best > 0 {
+		bound := func(i int) string { return fmtMs(time.Duration(float64(best) * heatRTTSteps[i])) }
+		legend = append(legend, m.heatLegend(0, "<"+bound(0)))
+		for i := 1; i < len(heatLevels)-1; i++ {
+			legend = append(legend, m.heatLegend(i, bound(i-1)+"-"+bound(i)))
+		}
+		legend = append(legend, m.heatLegend(len(heatLevels)-1, ">="+bound(len(heatRTTSteps)-1)))
+		legend = append(legend, m.st(styleBad).Render("××")+" no answers")
+	}
+	legend = append(legend, m.st(styleStale).Render("··")+fmt.Sprintf(" no data (under %d probes)", tracker.HeatMinProbes))
+	lines = append(lines, "  "+strings.Join(legend, "  "))
+	if !hm.loss && best > 0 {
+		lines = append(lines, fmt.Sprintf("  Shades are relative to the best hour, %s; medians are within 10%%", fmtMs(best)))
+	}
+
+	now := time.Now()
+	c := grid[tracker.HourOfWeek(now)]
+	cur := fmt.Sprintf("  This hour (%s %02d:00): ", heatDays[tracker.HourOfWeek(now)/24], now.Hour())
+	switch {
+	case c.Probes == 0:
+		cur += "no probes yet"
+	case c.HasRTT():
+		cur += fmt.Sprintf("median %s, loss %.1f%%, %d probes", fmtMs(c.Median), c.Loss, c.Probes)
+	default:
+		cur += fmt.Sprintf("loss %.1f%%, %d probes", c.Loss, c.Probes)
+	}
+	lines = append(lines, cur)
+
+	lines = append(lines, "", m.st(styleStatus).Render("Tab/Shift+Tab: target  m: ping/loss  W/Esc: back"))
+	return strings.Join(lines, "\n")
+}
+
+// heatLevel is the level of v: the number of steps it reaches.
+func heatLevel(v float64, steps []float64) int {
+	l := 0
+	for _, s := range steps {
+		if v >= s {
+			l++
+		}
+	}
+	return l
+}
+
+// heatLegend is one legend entry: level i's cell and what it stands for.
+func (m Model) heatLegend(i int, text string) string {
+	return m.st(heatLevels[i].style).Render(strings.Repeat(heatLevels[i].glyph, 2)) + " " + text
+}
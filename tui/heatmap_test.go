@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// heatWeek is the Monday a test heatmap's probes are made in.
+var heatWeek = time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)
+
+// addHeat records n probes of series in Monday's hour.
+func addHeat(m Model, series string, hour, n int, rtt time.Duration, loss float64) {
+	for range n {
+		m.tracker.Heatmap().Add(series, heatWeek.Add(time.Duration(hour)*time.Hour), rtt, loss)
+	}
+}
+
+// mondayRow is the heatmap's Monday row, its first 5 hours.
+func mondayRow(t *testing.T, view string) string {
+	t.Helper()
+	for _, line := range strings.Split(view, "\n") {
+		if row, ok := strings.CutPrefix(line, "  Mon "); ok {
+			return string([]rune(row)[:10])
+		}
+	}
+	t.Fatalf("no Monday row in\n%s", view)
+	return ""
+}
+
+func TestHeatmapNoData(t *testing.T) {
+	m := newTestModel()
+	if m, _ = press(t, m, "W"); !strings.HasPrefix(m.notice, "No heatmap") {
+		t.Fatalf("opened without data: notice %q", m.notice)
+	}
+
+	addHeat(m, "a IPv4", 0, tracker.HeatMinProbes, 20*time.Millisecond, 0)
+	addHeat(m, "a IPv4", 1, tracker.HeatMinProbes-1, 40*time.Millisecond, 0)
+	addHeat(m, "a IPv4", 2, tracker.HeatMinProbes, 60*time.Millisecond, 0)
+	addHeat(m, "a IPv4", 3, tracker.HeatMinProbes, 0, 100)
+	addHeat(m, "b IPv6", 0, 1, 20*time.Millisecond, 0)
+
+	m, _ = press(t, m, "W")
+	view := m.View()
+	if !strings.Contains(view, "Median ping by hour of the week: a IPv4 (1 of 2)") {
+		t.Fatalf("no title in\n%s", view)
+	}
+	// Hour 1 is short of probes: no data, not a shade from 5 probes.
+	if got := mondayRow(t, view); got != "░░··██××··" {
+		t.Errorf("ping row %q", got)
+	}
+	if !strings.Contains(view, "·· no data (under 6 probes)") {
+		t.Errorf("no legend for missing data in\n%s", view)
+	}
+
+	m, _ = press(t, m, "m")
+	view = m.View()
+	if got := mondayRow(t, view); got != "░░··░░██··" {
+		t.Errorf("loss row %q", got)
+	}
+
+	// Tab cycles the targets; a single probe is no data either way.
+	m, _ = press(t, m, "tab")
+	view = m.View()
+	if !strings.Contains(view, "Mean loss by hour of the week: b IPv6 (2 of 2)") {
+		t.Fatalf("no second target in\n%s", view)
+	}
+	if got := mondayRow(t, view); got != "··········" {
+		t.Errorf("single probe row %q", got)
+	}
+	if m, _ = press(t, m, "tab"); !strings.Contains(m.View(), "a IPv4 (1 of 2)") {
+		t.Error("Tab does not wrap around")
+	}
+	if m, _ = press(t, m, "W"); strings.Contains(m.View(), "by hour of the week") {
+		t.Error("W does not close the heatmap")
+	}
+}
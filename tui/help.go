@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// helpEntry is a help line: the keys, and the catalog key of what they
+// do. Keys is "" for a line continuing the entry above, such as a search
+// example. A description's line breaks are the catalog's.
+type helpEntry struct {
+	keys string
+	desc string
+}
+
+// helpSection is a heading of the help and its entries; title is the
+// catalog key of the heading.
+type helpSection struct {
+	title   string
+	entries []helpEntry
+}
+
+// helpKeyWidth is the width of the help's keys column.
+const helpKeyWidth = 18
+
+var helpSections = []helpSection{
+	{"help.navigation", []helpEntry{
+		{"j/k, Up/Down", "help.nav.move"},
+		{"g / G", "help.nav.ends"},
+		{"[ / ]", "help.nav.app"},
+		{"' / :", "help.nav.goto"},
+	}},
+	{"help.search", []helpEntry{
+		{"/", "help.search.start"},
+		{"", "help.search.port"},
+		{"", "help.search.addr"},
+		{"", "help.search.trend"},
+		{"", "help.search.enc"},
+		{"", "help.search.new"},
+		{"", "help.search.host"},
+		{"", "help.search.audit"},
+		{"", "help.search.netns"},
+		{"", "help.search.state"},
+		{"", "help.search.stuck"},
+		{"", "help.search.halfopen"},
+		{"", "help.search.score"},
+		{"", "help.search.origin"},
+		{"Enter", "help.search.confirm"},
+		{"Esc", "help.search.cancel"},
+		{"c", "help.search.clear"},
+	}},
+	{"help.details", []helpEntry{
+		{"Q", "help.details.quality"},
+		{"F7", "help.details.deep_dive"},
+		{"Space", "help.details.mark"},
+		{"F8", "help.details.snippets"},
+		{"F", "help.details.focus"},
+		{"o", "help.details.open"},
+		{"P", "help.details.ports"},
+		{"Enter", "help.details.show"},
+		{"Esc", "help.details.back"},
+	}},
+	{"help.sorting", []helpEntry{
+		{"1", "help.sorting.app"},
+		{"2", "help.sorting.ping"},
+		{"3", "help.sorting.loss"},
+		{"4", "help.sorting.tx"},
+		{"5", "help.sorting.rx"},
+		{"6", "help.sorting.state"},
+		{"7", "help.sorting.trend"},
+		{"8", "help.sorting.audit"},
+		{"9", "help.sorting.state_time"},
+		{"0", "help.sorting.health"},
+		{"x", "help.sorting.derived"},
+		{"F4", "help.sorting.picker"},
+		{"Shift+1-0", "help.sorting.groups"},
+		{"U", "help.sorting.sockmem"},
+	}},
+	{"help.changes", []helpEntry{
+		{"z", "help.changes.changed"},
+		{"F5", "help.changes.pin"},
+		{"F6", "help.changes.pinned"},
+	}},
+	{"help.grouping", []helpEntry{
+		{"b", "help.grouping.group"},
+		{"O", "help.grouping.forwarded"},
+		{"H", "help.grouping.closing"},
+	}},
+	{"help.columns", []helpEntry{
+		{"s", "help.columns.share"},
+		{"w", "help.columns.stall"},
+		{"t", "help.columns.qos"},
+		{"K", "help.columns.cc"},
+		{"u", "help.columns.queues"},
+		{"", "help.columns.ping_marks"},
+	}},
+	{"help.controls", []helpEntry{
+		{"D", "help.controls.stats"},
+		{"L", "help.controls.container"},
+		{"F10", "help.controls.profile"},
+		{"v", "help.controls.dual_stack"},
+		{"W", "help.controls.heatmap"},
+		{"F3", "help.controls.public"},
+		{"T", "help.controls.times"},
+		{"F9", "help.controls.anonymize"},
+		{"a", "help.controls.acknowledge"},
+		{"e", "help.controls.ports"},
+		{"C", "help.controls.palette"},
+		{"F2", "help.controls.thresholds"},
+		{"p", "help.controls.pause"},
+		{"M", "help.controls.marker"},
+		{"R", "help.controls.triggers"},
+		{"r", "help.controls.refresh"},
+		{"ctrl+r", "help.controls.reload"},
+		{"?", "help.controls.help"},
+		{"Esc", "help.controls.close"},
+		{"q / Ctrl+C", "help.controls.quit"},
+	}},
+}
+
+func (m Model) renderHelp() string {
+	title := tr("help.title")
+	var b strings.Builder
+	b.WriteString("\n  " + title + "\n  " + strings.Repeat("=", ansi.StringWidth(title)+1) + "\n")
+	for _, s := range helpSections {
+		b.WriteString("\n  " + tr(s.title) + ":\n")
+		for _, e := range s.entries {
+			keys := e.keys
+			for _, line := range strings.Split(tr(e.desc), "\n") {
+				b.WriteString("    " + padRight(keys, helpKeyWidth) + line + "\n")
+				keys = ""
+			}
+		}
+	}
+	b.WriteString("\n  " + tr("help.close") + "\n")
+	return lipgloss.NewStyle().Padding(1, 2).Render(b.String())
+}
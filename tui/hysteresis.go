@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"sort"
+
+	"ping-tracker/tracker"
+)
+
+// DefaultSortHysteresis is how much two rates must differ, relative to the
+// larger, before a TX or RX sort swaps rows that were the other way round
+// on the previous refresh.
+const DefaultSortHysteresis = 0.15
+
+// rateOrder is the row order of the previous refresh while sorted by a
+// rate column.
+type rateOrder struct {
+	field SortField
+	asc   bool
+	pos   map[string]int // connection key -> row
+}
+
+// SetSortHysteresis sets the relative rate difference needed to reorder
+// rows when sorted by TX or RX; 0 turns it off.
+func (m *Model) SetSortHysteresis(frac float64) {
+	m.sortHysteresis = frac
+	m.prevOrder = nil
+}
+
+// rateValue is the rate a TX or RX sort orders by.
+func rateValue(c *tracker.Connection, field SortField) float64 {
+	if field == SortTxRate {
+		return c.TxRate
+	}
+	return c.RxRate
+}
+
+// applyHysteresis keeps the previous refresh's order of rows whose rates
+// moved by less than the hysteresis, on top of the full sort just done.
+// Rows new since the previous refresh keep their sorted place; the others
+// fill the remaining places in their previous order, and then adjacent
+// rows are swapped only where the sort order is clear beyond the
+// hysteresis. The first refresh after the sort changes is a plain sort.
+func (m *Model) applyHysteresis() {
+	if m.sortHysteresis <= 0 || (m.sortField != SortTxRate && m.sortField != SortRxRate) {
+		m.prevOrder = nil
+		return
+	}
+	prev := m.prevOrder
+	if prev != nil && (prev.field != m.sortField || prev.asc != m.sortAsc) {
+		prev = nil
+	}
+	if prev != nil {
+		m.connections = holdOrder(m.connections, prev.pos, func(a, b *tracker.Connection) bool {
+			return m.clearlyBefore(a, b)
+		})
+	}
+	pos := make(map[string]int, len(m.connections))
+	for i, c := range m.connections {
+		pos[c.Key()] = i
+	}
+	m.prevOrder = &rateOrder{field: m.sortField, asc: m.sortAsc, pos: pos}
+}
+
+// holdOrder reorders sorted, which must be in full sort order, as
+// described at applyHysteresis. before reports whether a must come before
+// b regardless of their previous order.
+func holdOrder(sorted []*tracker.Connection, prev map[string]int, before func(a, b *tracker.Connection) bool) []*tracker.Connection {
+	var kept []*tracker.Connection
+	for _, c := range sorted {
+		if _, ok := prev[c.Key()]; ok {
+			kept = append(kept, c)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return prev[kept[i].Key()] < prev[kept[j].Key()] })
+	out := make([]*tracker.Connection, len(sorted))
+	k := 0
+	for i, c := range sorted {
+		if _, ok := prev[c.Key()]; ok {
+			out[i] = kept[k]
+			k++
+		} else {
+			out[i] = c
+		}
+	}
+	// Insertion sort on the clear inversions only: afterwards no two
+	// adjacent rows are clearly out of order.
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && before(out[j], out[j-1]); j-- {
+			out[j], out[j-1] = out[j-1], out[j]
+		}
+	}
+	return out
+}
+
+// clearlyBefore reports whether a sorts before b by a rate difference
+// larger than the hysteresis.
+func (m Model) clearlyBefore(a, b *tracker.Connection) bool {
+	va, vb := rateValue(a, m.sortField), rateValue(b, m.sortField)
+	if !m.sortAsc {
+		va, vb = vb, va
+	}
+	if va >= vb {
+		return false
+	}
+	return (vb-va)/max(va, vb) > m.sortHysteresis
+}
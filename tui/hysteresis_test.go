@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+// rateRefresh gives m fresh rows with the TX rates in rates, keyed by app,
+// sorts them as a refresh does and returns the apps in row order.
+func rateRefresh(m *Model, rates map[string]float64) []string {
+	m.connections = nil
+	port := 1
+	for _, app := range []string{"a", "b", "c", "d"} {
+		rate, ok := rates[app]
+		if !ok {
+			continue
+		}
+		c := testConn(app, 100+port, "192.0.2.1", port)
+		c.TxRate = rate
+		m.connections = append(m.connections, &c)
+		port++
+	}
+	m.sortConnections()
+	order := make([]string, len(m.connections))
+	for i, c := range m.connections {
+		order[i] = c.AppName
+	}
+	return order
+}
+
+func TestSortHysteresisHoldsUnderJitter(t *testing.T) {
+	m := newTestModel()
+	m.sortField, m.sortAsc = SortTxRate, false
+	if got := rateRefresh(&m, map[string]float64{"a": 100, "b": 95, "c": 10}); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("first refresh %v", got)
+	}
+	// a and b trade places by 5-10% every refresh: no swaps.
+	for i := range 20 {
+		rates := map[string]float64{"a": 92, "b": 100, "c": 11}
+		if i%2 == 1 {
+			rates = map[string]float64{"a": 104, "b": 96, "c": 9}
+		}
+		if got := rateRefresh(&m, rates); !slices.Equal(got, []string{"a", "b", "c"}) {
+			t.Fatalf("refresh %d reordered under jitter: %v", i, got)
+		}
+	}
+	// A sustained change beyond 15% moves the row.
+	if got := rateRefresh(&m, map[string]float64{"a": 100, "b": 130, "c": 10}); !slices.Equal(got, []string{"b", "a", "c"}) {
+		t.Fatalf("b at +30%% did not move up: %v", got)
+	}
+	// ...and the new order is held in turn.
+	if got := rateRefresh(&m, map[string]float64{"a": 110, "b": 100, "c": 10}); !slices.Equal(got, []string{"b", "a", "c"}) {
+		t.Fatalf("reordered back on jitter: %v", got)
+	}
+	// c climbing past both moves straight to the top.
+	if got := rateRefresh(&m, map[string]float64{"a": 100, "b": 100, "c": 500}); !slices.Equal(got, []string{"c", "b", "a"}) {
+		t.Fatalf("c at 5x did not move to the top: %v", got)
+	}
+}
+
+func TestSortHysteresisNewRows(t *testing.T) {
+	m := newTestModel()
+	m.sortField, m.sortAsc = SortTxRate, false
+	rateRefresh(&m, map[string]float64{"a": 100, "b": 10})
+	// d is new: it takes its sorted place even though it is within 15% of a.
+	if got := rateRefresh(&m, map[string]float64{"a": 100, "b": 10, "d": 105}); !slices.Equal(got, []string{"d", "a", "b"}) {
+		t.Fatalf("new row placed at %v", got)
+	}
+}
+
+func TestSortHysteresisResets(t *testing.T) {
+	jitter := []map[string]float64{{"a": 100, "b": 95}, {"a": 95, "b": 100}}
+
+	// Off, every refresh is a plain sort.
+	m := newTestModel()
+	m.SetSortHysteresis(0)
+	m.sortField, m.sortAsc = SortTxRate, false
+	rateRefresh(&m, jitter[0])
+	if got := rateRefresh(&m, jitter[1]); !slices.Equal(got, []string{"b", "a"}) {
+		t.Fatalf("hysteresis off held the order: %v", got)
+	}
+
+	// Reversing the sort starts over from a plain sort.
+	m = newTestModel()
+	m.sortField, m.sortAsc = SortTxRate, false
+	rateRefresh(&m, jitter[0])
+	m.sortAsc = true
+	if got := rateRefresh(&m, jitter[1]); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("ascending after descending: %v", got)
+	}
+
+	// Other columns ignore it.
+	m = newTestModel()
+	m.sortField, m.sortAsc = SortApp, true
+	rateRefresh(&m, jitter[0])
+	if m.prevOrder != nil {
+		t.Fatal("order kept while sorted by app")
+	}
+}
+
+func TestHoldOrder(t *testing.T) {
+	conn := func(app string, rate float64) *tracker.Connection {
+		c := testConn(app, 1, "192.0.2.1", len(app))
+		c.TxRate = rate
+		return &c
+	}
+	a, b, c := conn("a", 10), conn("bb", 20), conn("ccc", 30)
+	prev := map[string]int{a.Key(): 0, b.Key(): 1, c.Key(): 2}
+	never := func(x, y *tracker.Connection) bool { return false }
+	if got := holdOrder([]*tracker.Connection{c, b, a}, prev, never); !slices.Equal(got, []*tracker.Connection{a, b, c}) {
+		t.Errorf("previous order not kept: %v %v %v", got[0].AppName, got[1].AppName, got[2].AppName)
+	}
+	byRate := func(x, y *tracker.Connection) bool { return x.TxRate > y.TxRate }
+	if got := holdOrder([]*tracker.Connection{c, b, a}, prev, byRate); !slices.Equal(got, []*tracker.Connection{c, b, a}) {
+		t.Errorf("clear inversions not fixed: %v %v %v", got[0].AppName, got[1].AppName, got[2].AppName)
+	}
+}
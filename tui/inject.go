@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// refreshInjections picks up the -inject perturbations in effect, here or
+// on a remote agent (whose rows come marked Injected).
+func (m *Model) refreshInjections(all []*tracker.Connection) {
+	m.injections = m.tracker.Injections()
+	m.injectedRemote = false
+	for _, c := range all {
+		if c.Injected && c.Host != "" {
+			m.injectedRemote = true
+			break
+		}
+	}
+}
+
+// injecting reports whether any shown data may be synthetic.
+func (m Model) injecting() bool {
+	return len(m.injections) > 0 || m.injectedRemote
+}
+
+// injectBanner is the watermark shown while injections are in effect, so
+// synthetic data is not mistaken for real; "" otherwise.
+func (m Model) injectBanner() string {
+	if !m.injecting() {
+		return ""
+	}
+	now := time.Now()
+	parts := make([]string, 0, len(m.injections)+1)
+	for _, inj := range m.injections {
+		parts = append(parts, fmt.Sprintf("%s (%s left)", inj.Spec, compactDuration(inj.Until.Sub(now))))
+	}
+	if m.injectedRemote {
+		parts = append(parts, "on a remote agent")
+	}
+	return "INJECTION ACTIVE, data is synthetic: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+func TestInjectBanner(t *testing.T) {
+	m := newTestModel()
+	if m.injectBanner() != "" || m.injecting() {
+		t.Error("banner without injections")
+	}
+	inj, err := tracker.ParseInjection("loss=all,5%,2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.tracker.Inject(inj)
+	m.refreshInjections([]*tracker.Connection{{AppName: "curl", Host: "edge-1", Injected: true}})
+	banner := m.injectBanner()
+	if !strings.HasPrefix(banner, "INJECTION ACTIVE, data is synthetic: loss=all,5%,2m (1m 5") ||
+		!strings.HasSuffix(banner, "left), on a remote agent") {
+		t.Errorf("banner %q", banner)
+	}
+
+	m.refreshInjections(nil)
+	if banner := m.injectBanner(); !strings.Contains(banner, "loss=all") || strings.Contains(banner, "remote") {
+		t.Errorf("local only: %q", banner)
+	}
+}
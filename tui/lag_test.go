@@ -0,0 +1,43 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func TestLagWarning(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		h    tracker.Health
+		want string
+	}{
+		{"fresh", tracker.Health{Interval: time.Second, LastScan: now.Add(-1500 * time.Millisecond)}, ""},
+		{"before the first scan", tracker.Health{Interval: time.Second}, ""},
+		{"one slow scan", tracker.Health{Interval: time.Second, LastScan: now.Add(-3 * time.Second), EffectiveInterval: time.Second},
+			"Data is 3.0s old: the current scan is taking longer than the 1.0s interval"},
+		{"overrunning", tracker.Health{Interval: time.Second, LastScan: now.Add(-5 * time.Second), EffectiveInterval: 4 * time.Second},
+			"Data is 5.0s old: scans are overrunning, one every 4.0s instead of every 1.0s"},
+	}
+	for _, tt := range tests {
+		if got := lagWarning(tt.h, now); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLagBanner(t *testing.T) {
+	m := newTestModelWith(t, testConn("curl", 100, "192.0.2.1", 443))
+	m.width, m.height = 120, 20
+	rows := m.visibleRows()
+	m.lag = "Data is 3.0s old: the current scan is taking longer than the 1.0s interval"
+	if m.visibleRows() != rows-1 {
+		t.Errorf("%d rows with the banner, want %d", m.visibleRows(), rows-1)
+	}
+	if !strings.Contains(m.View(), m.lag) {
+		t.Error("banner not shown")
+	}
+}
@@ -0,0 +1,41 @@
+package tui
+
+import "fmt"
+
+// newListeners counts the unacknowledged listening sockets shown.
+func (m Model) newListeners() int {
+	n := 0
+	for _, c := range m.connections {
+		if c.NewListener {
+			n++
+		}
+	}
+	return n
+}
+
+// ackListener acknowledges the selected listener's service, so it stops
+// being highlighted and does not alert again.
+func (m *Model) ackListener() {
+	if m.cursor >= len(m.connections) || !m.connections[m.cursor].NewListener {
+		m.notice = "Nothing to acknowledge: select a highlighted LISTEN row"
+		return
+	}
+	c := m.connections[m.cursor]
+	acked, err := m.tracker.AckListener(c.Key())
+	switch {
+	case err != nil:
+		m.notice = "Acknowledged, but not saved: " + err.Error()
+	case !acked:
+		m.notice = "Already acknowledged"
+	default:
+		m.notice = fmt.Sprintf("Acknowledged %s listening on port %d", c.AppName, c.LocalPort)
+	}
+	m.refresh()
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
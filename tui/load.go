@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// refreshLoad picks up the load throttle state, notes a change in the
+// status bar, and adds the transitions since the last refresh to the
+// delta log.
+func (m *Model) refreshLoad() {
+	prev := m.load
+	m.load = m.tracker.LoadStatus()
+	if m.load.Throttled != prev.Throttled {
+		if m.load.Throttled {
+			m.notice = "Machine busy: " + m.loadText()
+		} else {
+			m.notice = fmt.Sprintf("Load down to %.2f: back to normal scanning", m.load.Load)
+		}
+	}
+	for _, e := range m.tracker.LoadEvents() {
+		if !e.Time.After(m.loadSeen) {
+			continue
+		}
+		m.loadSeen = e.Time
+		note := fmt.Sprintf("load throttle ended at %.2f", e.Load)
+		if e.Throttled {
+			note = fmt.Sprintf("load throttle started at %.2f", e.Load)
+		}
+		m.deltaLog = append(m.deltaLog, deltaEntry{Time: e.Time, Note: note})
+	}
+}
+
+// loadText is the status bar note while throttled, e.g. "load 1.82,
+// scans every 6.0s"; "" otherwise.
+func (m Model) loadText() string {
+	if !m.load.Throttled {
+		return ""
+	}
+	return fmt.Sprintf("load %.2f, scans every %s", m.load.Load, fmtDur(m.tracker.Interval()))
+}
+
+// loadLog lists the latest throttle transitions for the D view, most
+// recent first; "" before the first one.
+func (m Model) loadLog(now time.Time) string {
+	const shown = 6
+	events := m.tracker.LoadEvents()
+	if len(events) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := len(events) - 1; i >= 0 && len(parts) < shown; i-- {
+		e := events[i]
+		verb := "ended"
+		if e.Throttled {
+			verb = "started"
+		}
+		parts = append(parts, fmt.Sprintf("%s at %.2f %s", verb, e.Load, m.times.format(e.Time, now)))
+	}
+	return "  load throttle: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,34 @@
+package tui
+
+import "ping-tracker/i18n"
+
+// locale is the language of the UI's labels and its number separators. It
+// is a package variable rather than a Model field because the number
+// formatting helpers are plain functions; SetLocale sets it once, before
+// the program starts.
+var locale = i18n.English()
+
+// SetLocale selects the catalog labels are looked up in. Must be called
+// before the program starts.
+func SetLocale(l *i18n.Locale) {
+	locale = l
+}
+
+// tr returns the text of a catalog key in the selected language.
+func tr(key string) string {
+	return locale.T(key)
+}
+
+// trf formats the text of a catalog key with args.
+func trf(key string, args ...any) string {
+	return locale.Tf(key, args...)
+}
+
+// trn formats the ".one" or ".other" form of a catalog key, by n, e.g.
+// "detail.merged.one" for a single duplicate report.
+func trn(key string, n int, args ...any) string {
+	if n == 1 {
+		return trf(key+".one", args...)
+	}
+	return trf(key+".other", args...)
+}
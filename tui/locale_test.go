@@ -0,0 +1,89 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"ping-tracker/i18n"
+	"ping-tracker/tracker"
+)
+
+// withLocale selects lang for the test.
+func withLocale(t *testing.T, lang string) {
+	t.Helper()
+	l, err := i18n.New(lang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := locale
+	SetLocale(l)
+	t.Cleanup(func() { SetLocale(saved) })
+}
+
+// TestHelpKeys checks that every help heading and description is in the
+// English catalog, so none shows up as its key.
+func TestHelpKeys(t *testing.T) {
+	en, err := i18n.Catalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range helpSections {
+		if en[s.title] == "" {
+			t.Errorf("no heading %s", s.title)
+		}
+		for _, e := range s.entries {
+			if en[e.desc] == "" {
+				t.Errorf("%s %q: no description %s", s.title, e.keys, e.desc)
+			}
+		}
+	}
+	for _, k := range detailLabels {
+		if en["detail.label."+k] == "" {
+			t.Errorf("no detail label %s", k)
+		}
+	}
+}
+
+func TestHelpLocalized(t *testing.T) {
+	withLocale(t, "de")
+	help := newTestModel().renderHelp()
+	for _, want := range []string{
+		"Ping Tracker - Hilfe",
+		"=====================",
+		"  Sortierung:",
+		"    j/k, Up/Down      Cursor bewegen",
+		"    F10               15s CPU-Profil und Heap-Abbild von ping-tracker selbst",
+		"                      im Konfigurationsverzeichnis speichern",
+		"Eine beliebige Taste schließt diese Hilfe.",
+	} {
+		if !strings.Contains(help, want) {
+			t.Errorf("no %q in\n%s", want, help)
+		}
+	}
+	if strings.Contains(help, "help.") {
+		t.Errorf("a catalog key in the help:\n%s", help)
+	}
+}
+
+func TestDetailLocalized(t *testing.T) {
+	withLocale(t, "de")
+	m := newTestModel()
+	c := testConn("curl", 100, "198.51.100.7", 8080)
+	c.Provenance, c.Merged = []string{"ss"}, 2
+	c.StreamHint, c.StreamHintSource = 1, tracker.StreamsConntrack
+	detail := m.renderDetail(&c)
+	if strings.Contains(detail, "detail.") {
+		t.Fatalf("a catalog key in the detail view:\n%s", detail)
+	}
+	// The values line up after the widest German label, "Socket-Speicher".
+	for _, want := range []string{
+		"  Protokoll:       tcp",
+		"  Streams:         1 Fluss durch diesen Socket (conntrack)",
+		"  Quelle:          ss (2 doppelte Meldungen zusammengeführt)",
+		"Enter/Esc: zurück",
+	} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("no %q in\n%s", want, detail)
+		}
+	}
+}
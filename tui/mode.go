@@ -0,0 +1,247 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mode is one layer of the UI stacked over the table: an overlay, a prompt
+// or an editor. Keys go to the top mode first, and a key it does not
+// handle falls to the mode below, and from the bottom one to the table.
+// Esc always cancels exactly one mode, the top one; a mode that finishes
+// otherwise (Enter at a prompt, a toggle key) ends itself. q quits only
+// from the table, with no mode open.
+type mode interface {
+	// key handles msg. handled false passes it to the mode below.
+	key(m Model, msg tea.KeyMsg) (next Model, cmd tea.Cmd, handled bool)
+	// cancel puts back what the mode changed and closes what it opened;
+	// Esc calls it before the mode leaves the stack.
+	cancel(m *Model)
+}
+
+// viewer is a mode drawn instead of the table. A mode that is not, like a
+// prompt, leaves the screen to the modes below it.
+type viewer interface {
+	view(m Model) string
+}
+
+// prompter is a mode that asks a question in the status bar.
+type prompter interface {
+	prompt(m Model) string
+}
+
+// typist is a mode that takes free text: keys meant for prompts that open
+// on their own, like a config change, must not land in it.
+type typist interface {
+	typing()
+}
+
+// pushMode opens md over the current modes.
+func (m *Model) pushMode(md mode) {
+	m.modes = append(m.modes[:len(m.modes):len(m.modes)], md)
+}
+
+// queueMode opens md, which did not come from a key, under any mode being
+// typed into, so that the next keystroke still lands where it was headed.
+func (m *Model) queueMode(md mode) {
+	i := len(m.modes)
+	for i > 0 {
+		if _, ok := m.modes[i-1].(typist); !ok {
+			break
+		}
+		i--
+	}
+	modes := append([]mode(nil), m.modes[:i]...)
+	modes = append(modes, md)
+	m.modes = append(modes, m.modes[i:]...)
+}
+
+// endMode takes md off the stack as it is: what it changed stays.
+func (m *Model) endMode(md mode) {
+	for i := len(m.modes) - 1; i >= 0; i-- {
+		if m.modes[i] == md {
+			m.modes = append(m.modes[:i:i], m.modes[i+1:]...)
+			return
+		}
+	}
+}
+
+// cancelMode undoes md and takes it off the stack.
+func (m *Model) cancelMode(md mode) {
+	md.cancel(m)
+	m.endMode(md)
+}
+
+// topMode is the mode keys go to first; nil on the table.
+func (m Model) topMode() mode {
+	if len(m.modes) == 0 {
+		return nil
+	}
+	return m.modes[len(m.modes)-1]
+}
+
+// findMode returns the topmost open mode of type T.
+func findMode[T mode](m Model) (T, bool) {
+	for i := len(m.modes) - 1; i >= 0; i-- {
+		if md, ok := m.modes[i].(T); ok {
+			return md, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// typing reports whether the top mode takes free text.
+func (m Model) typing() bool {
+	_, ok := m.topMode().(typist)
+	return ok
+}
+
+// handleModeKey passes msg down the stack from the top mode and reports
+// whether one of them handled it. The policy rules on an actor's keys
+// first.
+func (m Model) handleModeKey(msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	for i := len(m.modes) - 1; i >= 0; i-- {
+		if i >= len(m.modes) {
+			continue // the modes above ended themselves and more with them
+		}
+		if a, ok := m.modes[i].(actor); ok && m.gate(a.actions(), msg.String()) {
+			return m, nil, true
+		}
+		next, cmd, handled := m.modes[i].key(m, msg)
+		m = next
+		if handled {
+			return m, cmd, true
+		}
+	}
+	return m, nil, false
+}
+
+// modeView draws the topmost mode that has a screen of its own, with the
+// question of a prompt above it in a status bar; "" leaves it to the table.
+func (m Model) modeView() string {
+	for i := len(m.modes) - 1; i >= 0; i-- {
+		v, ok := m.modes[i].(viewer)
+		if !ok {
+			continue
+		}
+		s := v.view(m)
+		if s == "" {
+			continue
+		}
+		if p := m.promptText(); p != "" {
+			s += "\n" + renderStatusBar(m.pal, p, m.width)
+		}
+		return s
+	}
+	return ""
+}
+
+// promptText is the question of the topmost prompt, "" without one.
+func (m Model) promptText() string {
+	for i := len(m.modes) - 1; i >= 0; i-- {
+		if p, ok := m.modes[i].(prompter); ok {
+			return p.prompt(m)
+		}
+	}
+	return ""
+}
+
+// helpMode is the ? screen; any key closes it.
+type helpMode struct{}
+
+func (h *helpMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	m.endMode(h)
+	return m, nil, true
+}
+
+func (h *helpMode) cancel(m *Model) {}
+
+func (h *helpMode) view(m Model) string { return m.renderHelp() }
+
+// perfMode is the D screen of scan performance stats.
+type perfMode struct{}
+
+func (p *perfMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "D":
+		m.cancelMode(p)
+	case "T":
+		m.times.absolute = !m.times.absolute
+	}
+	return m, nil, true
+}
+
+func (p *perfMode) cancel(m *Model) {}
+
+func (p *perfMode) view(m Model) string { return m.renderPerf() }
+
+// detailMode is the detail view of the selected connection.
+type detailMode struct{}
+
+func (d *detailMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter":
+		m.cancelMode(d)
+	case "o":
+		m.clientSort = (m.clientSort + 1) % len(clientSortNames)
+	case "T":
+		m.times.absolute = !m.times.absolute
+	}
+	return m, nil, true
+}
+
+func (d *detailMode) cancel(m *Model) {}
+
+func (d *detailMode) view(m Model) string {
+	if m.cursor >= len(m.connections) {
+		return ""
+	}
+	return m.renderDetail(m.connections[m.cursor])
+}
+
+// quitMode is the confirm-quit prompt. Any key but q or y cancels it and
+// then does what it does on the table.
+type quitMode struct {
+	at time.Time // when it was asked
+}
+
+func (q *quitMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	if (msg.String() == "q" || msg.String() == "y") && time.Since(q.at) <= quitConfirmWindow {
+		return m, tea.Quit, true
+	}
+	m.endMode(q)
+	return m, nil, false
+}
+
+func (q *quitMode) cancel(m *Model) {}
+
+func (q *quitMode) prompt(m Model) string {
+	return " Quit? Press q or y again to confirm, any other key to cancel"
+}
+
+// drillMode is a group shown as its connections (Enter on a group row).
+// Keys are the table's; Esc goes back to the group rows where they were.
+type drillMode struct {
+	cursor, offset int // on the group rows
+}
+
+func (d *drillMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	return m, nil, false
+}
+
+func (d *drillMode) cancel(m *Model) {
+	m.drillGroup = ""
+	m.refresh()
+	m.offset = d.offset
+	m.moveCursor(minInt(d.cursor, maxInt(0, m.rowCount()-1)))
+}
+
+// drillInto shows the connections of group key in place of the group rows.
+func (m *Model) drillInto(key string) {
+	m.pushMode(&drillMode{cursor: m.cursor, offset: m.offset})
+	m.drillGroup = key
+	m.cursor, m.offset = 0, 0
+	m.refresh()
+}
@@ -0,0 +1,220 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// modeModel is three connections, by two apps to two hosts, with a config
+// reloader whose next check asks to confirm one change.
+func modeModel(t *testing.T) (Model, *bool) {
+	t.Helper()
+	applied := new(bool)
+	m := newTestModelWith(t,
+		testConn("firefox", 1, "192.0.2.1", 443),
+		testConn("curl", 2, "192.0.2.1", 80),
+		testConn("steam", 3, "198.51.100.7", 27015),
+	)
+	f := &fakeReloader{r: &Reload{Confirm: []ConfirmChange{{
+		Prompt: "scan interval 3s -> 10s",
+		Apply:  func() { *applied = true },
+	}}}}
+	m.SetConfigReloader(f.check)
+	return m, applied
+}
+
+// stack names the open modes from the bottom up.
+func stack(m Model) string {
+	names := make([]string, len(m.modes))
+	for i, md := range m.modes {
+		name := strings.TrimPrefix(fmt.Sprintf("%T", md), "*tui.")
+		names[i] = strings.TrimSuffix(name, "Mode")
+	}
+	return strings.Join(names, ",")
+}
+
+// TestEscDetailConfirm opens the detail view, has a config change asked
+// about over it, and backs out one Esc at a time.
+func TestEscDetailConfirm(t *testing.T) {
+	m, applied := modeModel(t)
+	m, _ = press(t, m, "down", "enter")
+	if stack(m) != "detail" {
+		t.Fatalf("after enter: modes %q", stack(m))
+	}
+	row := m.cursor
+	m.checkConfig(true)
+	if stack(m) != "detail,confirm" {
+		t.Fatalf("after the reload: modes %q", stack(m))
+	}
+	if v := m.View(); !strings.Contains(v, "apply scan interval 3s -> 10s? y/n") {
+		t.Errorf("prompt not shown under the detail view:\n%s", v)
+	}
+
+	m, cmd := press(t, m, "esc")
+	if stack(m) != "detail" || *applied || isQuit(cmd) {
+		t.Fatalf("first esc: modes %q, applied %v", stack(m), *applied)
+	}
+	if m.notice != "Kept the running value instead of scan interval 3s -> 10s" {
+		t.Errorf("first esc: notice %q", m.notice)
+	}
+	if m.cursor != row {
+		t.Errorf("first esc: cursor %d, want %d", m.cursor, row)
+	}
+
+	m, cmd = press(t, m, "esc")
+	if stack(m) != "" || isQuit(cmd) || m.cursor != row {
+		t.Fatalf("second esc: modes %q, cursor %d", stack(m), m.cursor)
+	}
+	if _, cmd = press(t, m, "esc"); isQuit(cmd) {
+		t.Fatal("esc on the table quit")
+	}
+	if _, cmd = press(t, m, "q"); !isQuit(cmd) {
+		t.Fatal("q on the table did not quit")
+	}
+}
+
+// TestKeysFallThrough checks that a key the top mode does not handle
+// reaches the one below: y answers the prompt and leaves the detail view
+// open, and q closes neither.
+func TestKeysFallThrough(t *testing.T) {
+	m, applied := modeModel(t)
+	m, _ = press(t, m, "enter")
+	m.checkConfig(true)
+	m, cmd := press(t, m, "q")
+	if isQuit(cmd) || stack(m) != "detail,confirm" {
+		t.Fatalf("q over a prompt: quit %v, modes %q", isQuit(cmd), stack(m))
+	}
+	m, _ = press(t, m, "y")
+	if !*applied || stack(m) != "detail" {
+		t.Fatalf("y: applied %v, modes %q", *applied, stack(m))
+	}
+	if m, cmd = press(t, m, "q"); isQuit(cmd) || stack(m) != "detail" {
+		t.Fatalf("q in the detail view: quit %v, modes %q", isQuit(cmd), stack(m))
+	}
+	m, _ = press(t, m, "enter")
+	if stack(m) != "" {
+		t.Fatalf("enter did not close the detail view: %q", stack(m))
+	}
+}
+
+// TestEscSearchRestores checks that Esc puts back the filter and the row
+// from before the search, and Enter keeps the new filter.
+func TestEscSearchRestores(t *testing.T) {
+	m, _ := modeModel(t)
+	m, _ = press(t, m, "/", "1", "9", "2", ".", "enter")
+	if m.filter != "192." || len(m.connections) != 2 {
+		t.Fatalf("filter %q, %d rows", m.filter, len(m.connections))
+	}
+	m, _ = press(t, m, "down")
+	m, _ = press(t, m, "/", "backspace", "backspace", "backspace", "backspace", "s", "t")
+	m.refresh() // the next tick filters on what has been typed so far
+	if m.filter != "st" || len(m.connections) != 1 || m.cursor != 0 {
+		t.Fatalf("while typing: filter %q, %d rows, cursor %d", m.filter, len(m.connections), m.cursor)
+	}
+	m, _ = press(t, m, "esc")
+	if m.filter != "192." || len(m.connections) != 2 || m.cursor != 1 || stack(m) != "" {
+		t.Fatalf("after esc: filter %q, %d rows, cursor %d, modes %q", m.filter, len(m.connections), m.cursor, stack(m))
+	}
+
+	// q is text in the prompt, not a quit.
+	m, cmd := press(t, m, "/", "q")
+	if isQuit(cmd) || m.filter != "192.q" {
+		t.Fatalf("q in the search: quit %v, filter %q", isQuit(cmd), m.filter)
+	}
+	m, _ = press(t, m, "esc")
+	if m.filter != "192." {
+		t.Errorf("filter %q after the second esc", m.filter)
+	}
+}
+
+// TestEscDrillSearchDetail nests four levels: a group's connections, a
+// search in them, the detail view and a config prompt, and checks each
+// Esc undoes exactly the level on top.
+func TestEscDrillSearchDetail(t *testing.T) {
+	m, _ := modeModel(t)
+	m, _ = press(t, m, "b", "b") // group by host
+	if len(m.groups) != 2 {
+		t.Fatalf("%d groups", len(m.groups))
+	}
+	m.moveCursor(1)
+	group := m.groups[1].Key
+	m, _ = press(t, m, "enter")
+	if m.drillGroup != group {
+		t.Fatalf("drilled into %q, want %q", m.drillGroup, group)
+	}
+	rows := len(m.connections)
+	m, _ = press(t, m, "/", "z", "z")
+	m.refresh()
+	if len(m.connections) != 0 {
+		t.Fatalf("filter %q left %d rows", m.filter, len(m.connections))
+	}
+	m.checkConfig(true)
+	if stack(m) != "drill,confirm,search" {
+		t.Fatalf("modes %q: the prompt must queue under the search", stack(m))
+	}
+
+	m, _ = press(t, m, "esc")
+	if stack(m) != "drill,confirm" || m.filter != "" || len(m.connections) != rows {
+		t.Fatalf("esc 1: modes %q, filter %q, %d rows", stack(m), m.filter, len(m.connections))
+	}
+	m, _ = press(t, m, "esc")
+	if stack(m) != "drill" || m.drillGroup != group {
+		t.Fatalf("esc 2: modes %q, group %q", stack(m), m.drillGroup)
+	}
+	m, _ = press(t, m, "enter")
+	if stack(m) != "drill,detail" {
+		t.Fatalf("enter in the group: modes %q", stack(m))
+	}
+	m, _ = press(t, m, "esc")
+	if stack(m) != "drill" || m.drillGroup != group {
+		t.Fatalf("esc 3: modes %q, group %q", stack(m), m.drillGroup)
+	}
+	m, _ = press(t, m, "esc")
+	if stack(m) != "" || m.drillGroup != "" || !m.listingGroups() || m.cursor != 1 {
+		t.Fatalf("esc 4: modes %q, group %q, cursor %d", stack(m), m.drillGroup, m.cursor)
+	}
+}
+
+// TestHelpClosesOnAnyKey checks the help screen eats the key that closes
+// it, so q there does not quit.
+func TestHelpClosesOnAnyKey(t *testing.T) {
+	for _, k := range []string{"esc", "q", "x", "enter"} {
+		m, _ := modeModel(t)
+		m, _ = press(t, m, "?")
+		if stack(m) != "help" {
+			t.Fatalf("? opened %q", stack(m))
+		}
+		m, cmd := press(t, m, k)
+		if stack(m) != "" || isQuit(cmd) {
+			t.Errorf("%s on help: modes %q, quit %v", k, stack(m), isQuit(cmd))
+		}
+	}
+}
+
+// TestQueueMode checks a mode raised on its own goes under the prompts
+// being typed into and on top of everything else.
+func TestQueueMode(t *testing.T) {
+	var m Model
+	drill, search, gt := &drillMode{}, &searchMode{}, &gotoMode{}
+	m.pushMode(drill)
+	m.pushMode(search)
+	m.pushMode(gt)
+	c := &confirmMode{}
+	m.queueMode(c)
+	if stack(m) != "drill,confirm,search,goto" {
+		t.Fatalf("queued under typing: %q", stack(m))
+	}
+	m.endMode(search)
+	m.endMode(gt)
+	m.queueMode(&helpMode{})
+	if stack(m) != "drill,confirm,help" {
+		t.Fatalf("queued with nothing typed: %q", stack(m))
+	}
+	if top, ok := m.topMode().(*helpMode); !ok || top == nil {
+		t.Errorf("top mode %T", m.topMode())
+	}
+	if got, _ := findMode[*drillMode](m); got != drill {
+		t.Error("findMode did not find the drill mode")
+	}
+}
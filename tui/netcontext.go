@@ -0,0 +1,180 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"ping-tracker/policy"
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// netContextView is the F3 panel: public addresses next to the local
+// ones, looked up with STUN when it opens and the last result is stale.
+type netContextView struct {
+	running bool
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// netContextMsg delivers a finished lookup.
+type netContextMsg struct {
+	result tracker.NetContext
+	err    error // the lookup was cancelled
+}
+
+// SetSTUNServers sets the servers the F3 panel asks for the public
+// address; server "" means tracker.DefaultSTUNServer, and a second server
+// tells the NAT's mapping behavior. A change drops the cached result.
+func (m *Model) SetSTUNServers(server, server2 string) {
+	if server != m.stunServer || server2 != m.stunServer2 {
+		m.netCtx = nil
+	}
+	m.stunServer, m.stunServer2 = server, server2
+}
+
+// openNetContext shows the panel, looking the addresses up unless the last
+// result is recent enough.
+func (m Model) openNetContext() (tea.Model, tea.Cmd) {
+	m.netView = &netContextView{}
+	m.pushMode(&netContextMode{})
+	if m.netCtx != nil && !m.netCtx.Stale(time.Now()) {
+		return m, nil
+	}
+	return m, m.startNetContext()
+}
+
+// discoverNetContext looks the public addresses up; tests replace it.
+var discoverNetContext = tracker.DiscoverNetContext
+
+// startNetContext runs the lookups in the background.
+func (m Model) startNetContext() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := m.netView
+	v.running = true
+	v.started = time.Now()
+	v.cancel = cancel
+	server, server2 := m.stunServer, m.stunServer2
+	return func() tea.Msg {
+		r := discoverNetContext(ctx, server, server2)
+		return netContextMsg{result: r, err: ctx.Err()}
+	}
+}
+
+// handleNetContextMsg keeps a finished lookup. Cancelled ones are dropped.
+func (m Model) handleNetContextMsg(msg netContextMsg) (tea.Model, tea.Cmd) {
+	if errors.Is(msg.err, context.Canceled) {
+		return m, nil
+	}
+	r := msg.result
+	m.netCtx = &r
+	if m.netView != nil {
+		m.netView.running = false
+		m.netView.cancel = nil
+	}
+	return m, nil
+}
+
+// netContextMode is the open F3 panel. Closing it cancels a lookup.
+type netContextMode struct{}
+
+func (n *netContextMode) actions() map[string]keyAction {
+	return map[string]keyAction{"r": {action: policy.PublicAddress}}
+}
+
+func (n *netContextMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "f3":
+		m.cancelMode(n)
+	case "r":
+		if !m.netView.running {
+			return m, m.startNetContext(), true
+		}
+	}
+	return m, nil, true
+}
+
+func (n *netContextMode) cancel(m *Model) {
+	if m.netView.cancel != nil {
+		m.netView.cancel()
+	}
+	m.netView = nil
+}
+
+func (n *netContextMode) view(m Model) string { return m.renderNetContext() }
+
+// renderNetContext draws the F3 panel.
+func (m Model) renderNetContext() string {
+	v := m.netView
+	now := time.Now()
+	lines := []string{m.st(styleTitle).Render("Public address and NAT"), ""}
+	if v.running {
+		lines = append(lines, fmt.Sprintf("  Asking STUN servers… %s of at most %s",
+			fmtDur(time.Since(v.started)), fmtDur(tracker.NetContextTimeout)))
+		if m.netCtx != nil {
+			lines = append(lines, "", "  Previous result:")
+		}
+	}
+	if c := m.netCtx; c != nil {
+		servers := c.Server
+		if c.Server2 != "" {
+			servers += ", " + c.Server2
+		}
+		lines = append(lines,
+			fmt.Sprintf("  Looked up:   %s via %s", m.times.format(c.At, now), servers), "")
+		lines = append(lines, m.familyLines("IPv4", c.V4, c.Server2 != "")...)
+		lines = append(lines, "")
+		lines = append(lines, m.familyLines("IPv6", c.V6, c.Server2 != "")...)
+	}
+
+	help := "r: look up again  Esc/F3: close"
+	if v.running {
+		help = "Esc/F3: cancel"
+	}
+	lines = append(lines, "", m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
+
+// familyLines formats one address family of the panel.
+func (m Model) familyLines(name string, f tracker.FamilyContext, twoServers bool) []string {
+	lines := []string{"  " + name}
+	local := "-"
+	if f.Local.IsValid() {
+		local = m.addr(f.Local.Addr().String())
+		if f.Iface != "" {
+			local += " on " + f.Iface
+		}
+	}
+	lines = append(lines, "    Local:     "+local)
+	if !f.OK() {
+		return append(lines, fmt.Sprintf("    Public:    unknown (%v)", f.Err))
+	}
+	lines = append(lines, "    Public:    "+m.addrPort(f.Public))
+	switch {
+	case f.CGNAT():
+		lines = append(lines, m.st(styleWarn).Render("    Behind carrier-grade NAT: the local address is in 100.64.0.0/10"))
+	case f.DoubleNAT():
+		lines = append(lines, m.st(styleWarn).Render("    Double NAT likely: the STUN server saw a private address too"))
+	case f.NATed():
+		lines = append(lines, "    Behind NAT")
+	default:
+		lines = append(lines, "    No NAT: the public address is the local one")
+	}
+	if twoServers && f.Mapping != tracker.MappingNone {
+		mapping := f.Mapping.String()
+		if f.Public2.IsValid() && f.Public2 != f.Public {
+			mapping += " (second server saw " + m.addrPort(f.Public2) + ")"
+		}
+		lines = append(lines, "    Mapping:   "+mapping)
+	}
+	return lines
+}
+
+func (m Model) addrPort(a netip.AddrPort) string {
+	return fmt.Sprintf("%s port %d", m.addr(a.Addr().String()), a.Port())
+}
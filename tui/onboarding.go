@@ -0,0 +1,180 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// onboardingPages is how many pages the first-run overlay has.
+const onboardingPages = 3
+
+// columnHelp explains the table columns by header, without the sort key
+// prefix. The page lists tableLayout.columns, so a column missing here is
+// still listed, by name only.
+var columnHelp = map[string]string{
+	"Host":   "agent the row comes from (-connect)",
+	"Netns":  "network namespace (-all-netns)",
+	"PID":    "owning process; 0 when it could not be found",
+	"App":    "process name",
+	"Ping":   "TCP connect time to the remote",
+	"Loss":   "share of failed probes over the last minute",
+	"Score":  "health 0-100 from ping, loss, retransmits, stalls and reachability",
+	"Dir":    "OUT for connections this machine opened, IN for accepted ones",
+	"Proto":  "tcp/udp, or the service hint (quic)",
+	"Enc":    "whether the traffic looks encrypted (a port heuristic)",
+	"Local":  "local address and port",
+	"Remote": "remote address and port",
+	"State":  "TCP state, UNCONN for unconnected UDP; time in it when stuck",
+	"TX":     "send rate",
+	"RX":     "receive rate",
+	"Share":  "percent of the visible throughput",
+	"Stall":  "zero window or full send buffer",
+	"QoS":    "DSCP class / socket priority",
+	"CC":     "TCP congestion control algorithm",
+	"SendQ":  "bytes not yet acknowledged by the peer",
+	"RecvQ":  "bytes not yet read by the app",
+}
+
+// onboardingKeys are the essentials shown on the second page; ? lists the
+// rest.
+var onboardingKeys = []struct{ key, what string }{
+	{"j/k, Up/Down", "move the cursor"},
+	{"/", "search: app name, port, address prefix, or filters like state:unconn"},
+	{"0-9", "sort by a column (the number in its header); again to reverse"},
+	{"Enter", "details of the selected connection; Esc goes back"},
+	{"p", "pause or resume refreshing"},
+	{"b", "group rows by app or remote host"},
+	{"?", "every key"},
+	{"q", "quit"},
+}
+
+// SetOnboarding shows the first-run overlay. save records that it was
+// dismissed, so it is not shown again; it may be nil.
+func (m *Model) SetOnboarding(save func() error) {
+	m.onboardingPage = 1
+	m.saveOnboarding = save
+	m.pushMode(&onboardingMode{})
+}
+
+// onboardingMode is the first-run overlay. Finishing the last page or Esc
+// dismisses it for good.
+type onboardingMode struct{}
+
+func (o *onboardingMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "left", "h", "backspace", "pgup":
+		if m.onboardingPage > 1 {
+			m.onboardingPage--
+		}
+	case "right", "l", "enter", " ", "pgdown":
+		if m.onboardingPage < onboardingPages {
+			m.onboardingPage++
+			return m, nil, true
+		}
+		m.cancelMode(o)
+	}
+	return m, nil, true
+}
+
+func (o *onboardingMode) cancel(m *Model) {
+	m.dismissOnboarding()
+}
+
+func (o *onboardingMode) view(m Model) string { return m.renderOnboarding() }
+
+// dismissOnboarding hides the overlay and records it.
+func (m *Model) dismissOnboarding() {
+	m.onboardingPage = 0
+	if m.saveOnboarding == nil {
+		return
+	}
+	if err := m.saveOnboarding(); err != nil {
+		m.notice = "Could not record that the introduction was seen: " + err.Error()
+	}
+}
+
+// renderOnboarding is the first-run overlay's current page.
+func (m Model) renderOnboarding() string {
+	var title string
+	var body []string
+	switch m.onboardingPage {
+	case 1:
+		title, body = "The table", m.onboardingColumns()
+	case 2:
+		title, body = "Essential keys", onboardingKeyLines()
+	default:
+		title, body = "Privileges on this machine", m.onboardingPrivileges(tracker.ProbePrivileges())
+	}
+
+	lines := []string{
+		m.st(styleTitle).Render(fmt.Sprintf("Welcome to Ping Tracker (%d/%d): %s", m.onboardingPage, onboardingPages, title)),
+		"",
+	}
+	lines = append(lines, body...)
+	nav := "Right/Enter: next  Left: back  Esc: don't show again"
+	if m.onboardingPage == onboardingPages {
+		nav = "Enter/Esc: start  Left: back"
+	}
+	lines = append(lines, "", m.st(styleStatus).Render(nav))
+	return strings.Join(lines, "\n")
+}
+
+// onboardingColumns explains the columns of the current table layout and
+// the color grades.
+func (m Model) onboardingColumns() []string {
+	lines := []string{"  Each row is one socket. The columns:", ""}
+	for _, col := range m.tableLayout().columns() {
+		what := columnHelp[col.header[strings.Index(col.header, "]")+1:]]
+		lines = append(lines, fmt.Sprintf("  %-12s %s", col.header, what))
+	}
+	good, _ := m.metric(metricGood)
+	warn, _ := m.metric(metricWarn)
+	bad, _ := m.metric(metricBad)
+	return append(lines, "",
+		fmt.Sprintf("  Ping is %s below %dms, %s from %dms and %s from %dms.",
+			good.Render("good"), pingWarnMs, warn.Render("fair"), pingWarnMs, bad.Render("bad"), pingBadMs),
+		fmt.Sprintf("  Loss is %s below %d%%, %s from %d%% and %s from %d%%.",
+			good.Render("good"), lossWarnPct, warn.Render("fair"), lossWarnPct, bad.Render("bad"), lossBadPct),
+		"  Rows turn yellow or red when they cross the alert thresholds (F2 edits them).")
+}
+
+// onboardingKeyLines lists onboardingKeys.
+func onboardingKeyLines() []string {
+	var lines []string
+	for _, k := range onboardingKeys {
+		lines = append(lines, fmt.Sprintf("  %-14s %s", k.key, k.what))
+	}
+	return lines
+}
+
+// onboardingPrivileges explains what this process can see, with what to
+// change when it is not everything.
+func (m Model) onboardingPrivileges(p tracker.Privileges) []string {
+	var lines []string
+	unknown := tracker.UnresolvedOwners(m.tracker.Snapshot())
+	if p.Elevated {
+		lines = append(lines, "  "+m.st(styleGood).Render("Running with full privileges:")+" every socket's process can be resolved.")
+	} else {
+		lines = append(lines, "  "+m.st(styleWarn).Render("Running without privileges:")+" sockets of other users' processes show PID 0 and \"unknown\".")
+		if unknown > 0 {
+			lines = append(lines, fmt.Sprintf("  Right now %d connection%s could not be attributed.", unknown, plural(unknown)))
+		}
+		lines = append(lines, "  To see them:")
+		lines = append(lines, privilegeHints...)
+	}
+	if p.Sandbox.Restricted() && len(p.Sandbox.Limits) > 0 {
+		lines = append(lines, "", "  "+m.st(styleWarn).Render(p.Sandbox.Summary()+"."))
+		for _, l := range p.Sandbox.Limits {
+			lines = append(lines, "    - "+l.Missing+": "+l.Fix)
+		}
+	}
+	lines = append(lines, "", "  Pings are TCP connects, so they need no privileges or ICMP permissions.")
+	if p.SS {
+		lines = append(lines, ssHint...)
+	}
+	return lines
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package tui
+
+// privilegeHints are the ways to let the proc scanner resolve every
+// socket's owner.
+var privilegeHints = []string{
+	"    - run with sudo, or",
+	"    - grant the binary ptrace access once:",
+	"      sudo setcap cap_sys_ptrace,cap_dac_read_search+ep $(command -v ping-tracker)",
+	"    -all-netns (container namespaces) needs root in either case.",
+}
+
+// ssHint is shown when ss is installed.
+var ssHint = []string{
+	"  ss is installed: -scanner ss adds the Stall and QoS columns and kernel RTTs.",
+}
@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestOnboardingKeys presses every key the second page names on the table
+// and checks it does what the page says.
+func TestOnboardingKeys(t *testing.T) {
+	checks := map[string]func(t *testing.T, m Model){
+		"j/k, Up/Down": func(t *testing.T, m Model) {
+			for _, k := range [][2]string{{"j", "k"}, {"down", "up"}} {
+				down, _ := press(t, m, k[0])
+				up, _ := press(t, down, k[1])
+				if down.cursor != 1 || up.cursor != 0 {
+					t.Errorf("%s/%s: cursor %d, then %d", k[0], k[1], down.cursor, up.cursor)
+				}
+			}
+		},
+		"/": func(t *testing.T, m Model) {
+			m, _ = press(t, m, "/")
+			if _, ok := findMode[*searchMode](m); !ok {
+				t.Error("no search prompt")
+			}
+		},
+		"0-9": func(t *testing.T, m Model) {
+			for k, want := range map[string]SortField{"0": SortScore, "2": SortPing, "9": SortStateTime} {
+				if m, _ := press(t, m, k); m.sortField != want {
+					t.Errorf("%s sorts by %d, want %d", k, m.sortField, want)
+				}
+			}
+		},
+		"Enter": func(t *testing.T, m Model) {
+			m, _ = press(t, m, "enter")
+			if _, ok := findMode[*detailMode](m); !ok {
+				t.Fatal("no detail view")
+			}
+			if m, _ = press(t, m, "esc"); m.topMode() != nil {
+				t.Error("Esc did not go back")
+			}
+		},
+		"p": func(t *testing.T, m Model) {
+			if m, _ := press(t, m, "p"); !m.paused {
+				t.Error("not paused")
+			}
+		},
+		"b": func(t *testing.T, m Model) {
+			if m, _ := press(t, m, "b"); m.groupBy == groupNone {
+				t.Error("not grouped")
+			}
+		},
+		"?": func(t *testing.T, m Model) {
+			m, _ = press(t, m, "?")
+			if _, ok := findMode[*helpMode](m); !ok {
+				t.Error("no help")
+			}
+		},
+		"q": func(t *testing.T, m Model) {
+			if _, cmd := press(t, m, "q"); !isQuit(cmd) {
+				t.Error("did not quit")
+			}
+		},
+	}
+	m := newTestModelWith(t, testConn("curl", 100, "192.0.2.1", 443), testConn("wget", 200, "192.0.2.2", 80))
+	for _, k := range onboardingKeys {
+		check, ok := checks[k.key]
+		if !ok {
+			t.Errorf("no check for %q", k.key)
+			continue
+		}
+		t.Run(k.key, func(t *testing.T) { check(t, m) })
+	}
+	if len(checks) != len(onboardingKeys) {
+		t.Errorf("%d checks for %d keys", len(checks), len(onboardingKeys))
+	}
+}
+
+// TestOnboardingColumnHelp checks every column the table can show is
+// explained on the first page.
+func TestOnboardingColumnHelp(t *testing.T) {
+	m := newTestModel()
+	m.width = 300
+	m.showShare, m.showStall, m.showQoS, m.showCC, m.showQueues, m.showNetns = true, true, true, true, true, true
+	page := m.onboardingColumns()
+	for _, col := range m.tableLayout().columns() {
+		name := col.header[strings.Index(col.header, "]")+1:]
+		if columnHelp[name] == "" {
+			t.Errorf("column %s not explained", name)
+		}
+	}
+	if len(page) < len(columnHelp) {
+		t.Errorf("%d lines for %d columns", len(page), len(columnHelp))
+	}
+}
+
+func TestOnboardingDismiss(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"finished", []string{"enter", "right", "l"}},
+		{"back and finished", []string{"right", "left", "left", "enter", " ", "enter"}},
+		{"esc", []string{"esc"}},
+		{"esc on the last page", []string{"enter", "enter", "esc"}},
+	}
+	for _, tt := range tests {
+		saved := 0
+		m := newTestModel()
+		m.SetOnboarding(func() error { saved++; return nil })
+		m, _ = press(t, m, tt.keys[:len(tt.keys)-1]...)
+		if saved != 0 || m.onboardingPage == 0 {
+			t.Errorf("%s: dismissed early", tt.name)
+		}
+		m, _ = press(t, m, tt.keys[len(tt.keys)-1])
+		if _, open := findMode[*onboardingMode](m); open || m.onboardingPage != 0 || saved != 1 {
+			t.Errorf("%s: open %v, page %d, saved %d times", tt.name, open, m.onboardingPage, saved)
+		}
+	}
+
+	m := newTestModel()
+	m.SetOnboarding(func() error { return errors.New("read-only file system") })
+	m, _ = press(t, m, "esc")
+	if !strings.Contains(m.notice, "read-only file system") {
+		t.Errorf("notice %q", m.notice)
+	}
+}
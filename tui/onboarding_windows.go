@@ -0,0 +1,11 @@
+//go:build windows
+
+package tui
+
+// privilegeHints are the ways to let the scanner name every socket's owner.
+var privilegeHints = []string{
+	"    - run the terminal as administrator (right-click, Run as administrator).",
+}
+
+// ssHint is empty: Windows has a single scanner.
+var ssHint []string
@@ -0,0 +1,135 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"ping-tracker/cmdline"
+	"ping-tracker/policy"
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// DefaultOpenCommand is the built-in used by o when open_cmd is unset.
+const DefaultOpenCommand = "ipinfo"
+
+// maxOpenStderr is how much of a failed command's stderr is kept for the
+// status bar.
+const maxOpenStderr = 4 << 10
+
+// ParseOpenCommand resolves an open_cmd setting into an argv template: the
+// name of a built-in (see builtinOpenCommands), or a command line whose words
+// may contain the placeholders of tracker.CommandFields, such as
+// {remote_addr} and {app}. Words are split on spaces, with single or double
+// quotes grouping. The command is run directly, never through a shell.
+func ParseOpenCommand(s string) ([]string, error) {
+	if s == "" {
+		s = DefaultOpenCommand
+	}
+	if builtin, ok := builtinOpenCommands()[s]; ok {
+		s = builtin
+	}
+	argv, err := cmdline.Parse(s, func(name string) bool { return tracker.CommandFields[name] != nil })
+	if err != nil {
+		return nil, fmt.Errorf("open_cmd: %v", err)
+	}
+	return argv, nil
+}
+
+// expandOpenCommand substitutes c's fields into each word of argv.
+func expandOpenCommand(argv []string, c *tracker.Connection) []string {
+	return cmdline.Expand(argv, func(name string) string { return tracker.CommandFields[name](c) })
+}
+
+// SetOpenCommand sets the argv template run by o (see ParseOpenCommand).
+func (m *Model) SetOpenCommand(argv []string) {
+	m.openCmd = argv
+}
+
+// openResultMsg reports that a command started by o exited with an error.
+type openResultMsg struct {
+	name string
+	err  error
+}
+
+// startCommand starts an open command; tests replace it.
+var startCommand = (*exec.Cmd).Start
+
+// openArgs is the open command for the selected connection, nil when no
+// connection is selected.
+func (m Model) openArgs() ([]string, error) {
+	if m.cursor >= len(m.connections) || m.connections[m.cursor].Closing != nil {
+		return nil, nil
+	}
+	argv := m.openCmd
+	if argv == nil {
+		var err error
+		if argv, err = ParseOpenCommand(""); err != nil {
+			return nil, err
+		}
+	}
+	return expandOpenCommand(argv, m.connections[m.cursor]), nil
+}
+
+// openPlan is the command line o would run, for a dry run.
+func (m Model) openPlan() string {
+	args, err := m.openArgs()
+	if err != nil {
+		return err.Error()
+	}
+	if args == nil {
+		return ""
+	}
+	return policy.Argv(args)
+}
+
+// openSelected starts the open command for the selected connection without
+// waiting for it. Its exit is reported as an openResultMsg. The dispatcher
+// only calls it when the policy allows (see keyActions).
+func (m Model) openSelected() (tea.Model, tea.Cmd) {
+	args, err := m.openArgs()
+	if err != nil {
+		m.notice = err.Error()
+		return m, nil
+	}
+	if args == nil {
+		return m, nil
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, max: maxOpenStderr}
+	detach(cmd)
+	if err := startCommand(cmd); err != nil {
+		m.notice = fmt.Sprintf("open: %v", err)
+		return m, nil
+	}
+	m.notice = "Started " + args[0]
+	name := args[0]
+	return m, func() tea.Msg {
+		err := cmd.Wait()
+		if err == nil {
+			return nil
+		}
+		if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+			err = errors.New(line)
+		}
+		return openResultMsg{name: name, err: err}
+	}
+}
+
+// limitedWriter keeps the first max bytes written to it.
+type limitedWriter struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// builtinOpenCommands are the open_cmd values usable by name.
+func builtinOpenCommands() map[string]string {
+	term := os.Getenv("TERMINAL")
+	if term == "" {
+		term = "x-terminal-emulator"
+	}
+	return map[string]string{
+		"ipinfo": "xdg-open https://ipinfo.io/{remote_addr}",
+		"mtr":    term + " -e mtr {remote_addr}",
+	}
+}
+
+// detach starts cmd in its own session, so it neither reads the TUI's
+// terminal nor dies with it on Ctrl+C.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
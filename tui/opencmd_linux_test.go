@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOpenSelectedRunsArgv runs a real command and checks that a hostile
+// app name reaches it as one argument, never as shell syntax.
+func TestOpenSelectedRunsArgv(t *testing.T) {
+	dir := t.TempDir()
+	app := `x"; touch pwned; echo "$(touch pwned2)`
+	m := newTestModelWith(t, testConn(app, 7, "192.0.2.9", 443))
+	out := filepath.Join(dir, "out")
+	argv, err := ParseOpenCommand(`sh -c 'cd "$1" && printf %s "$2" > out' sh ` + dir + ` {app}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetOpenCommand(argv)
+	m, wait := press(t, m, "o")
+	if m.notice != "Started sh" || wait == nil {
+		t.Fatalf("notice %q", m.notice)
+	}
+	if msg := wait(); msg != nil {
+		t.Fatalf("command failed: %v", msg)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil || string(got) != app {
+		t.Fatalf("argument %q, %v; want %q", got, err, app)
+	}
+	for _, f := range []string{"pwned", "pwned2"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			t.Errorf("the app name ran as shell code: %s exists", f)
+		}
+	}
+}
+
+func TestOpenSelectedReportsStderr(t *testing.T) {
+	m := newTestModelWith(t, testConn("web", 7, "192.0.2.9", 443))
+	argv, _ := ParseOpenCommand(`sh -c 'echo "no route to {remote_addr}" >&2; echo more >&2; exit 3'`)
+	m.SetOpenCommand(argv)
+	m, wait := press(t, m, "o")
+	msg := wait()
+	if msg == nil {
+		t.Fatal("failure not reported")
+	}
+	next, _ := m.Update(msg)
+	if notice := next.(Model).notice; notice != "sh failed: no route to 192.0.2.9" {
+		t.Errorf("notice %q", notice)
+	}
+	if !strings.HasPrefix(m.notice, "Started") {
+		t.Errorf("notice before exit %q", m.notice)
+	}
+}
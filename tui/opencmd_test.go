@@ -0,0 +1,70 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"ping-tracker/policy"
+)
+
+func TestParseOpenCommand(t *testing.T) {
+	for name := range builtinOpenCommands() {
+		argv, err := ParseOpenCommand(name)
+		if err != nil || len(argv) < 2 || !strings.Contains(strings.Join(argv, " "), "{remote_addr}") {
+			t.Errorf("built-in %s: %q, %v", name, argv, err)
+		}
+	}
+	def, _ := ParseOpenCommand("")
+	builtin, _ := ParseOpenCommand(DefaultOpenCommand)
+	if !slices.Equal(def, builtin) {
+		t.Errorf("default %q, want the %s built-in %q", def, DefaultOpenCommand, builtin)
+	}
+	argv, err := ParseOpenCommand(`whois -h "whois.example net" {remote_addr}`)
+	if err != nil || !slices.Equal(argv, []string{"whois", "-h", "whois.example net", "{remote_addr}"}) {
+		t.Errorf("custom: %q, %v", argv, err)
+	}
+	for _, bad := range []string{`open "x`, "open {hostname}"} {
+		if _, err := ParseOpenCommand(bad); err == nil || !strings.HasPrefix(err.Error(), "open_cmd: ") {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
+
+func TestExpandOpenCommandHostileApp(t *testing.T) {
+	argv, err := ParseOpenCommand(`notify "{app} ({pid})" {remote_addr}:{remote_port} {local_addr}:{local_port}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range []string{`x"; rm -rf ~; "`, `it's'; reboot #`, "$(id)`id`|&<>"} {
+		c := testConn(app, 31337, "192.0.2.9", 443)
+		got := expandOpenCommand(argv, &c)
+		want := []string{"notify", app + " (31337)", "192.0.2.9:443", "10.0.0.2:40443"}
+		if !slices.Equal(got, want) {
+			t.Errorf("app %q: %q, want %q", app, got, want)
+		}
+	}
+}
+
+func TestOpenSelectedPolicy(t *testing.T) {
+	m := newTestModelWith(t, testConn(`a"; touch pwned; "`, 7, "192.0.2.9", 443))
+	argv, _ := ParseOpenCommand("definitely-not-a-command {app}")
+	m.SetOpenCommand(argv)
+
+	m.SetPolicy(policy.DryRun)
+	got, cmd := press(t, m, "o")
+	if cmd != nil || !strings.HasPrefix(got.notice, "Dry run, not started: definitely-not-a-command ") ||
+		!strings.Contains(got.notice, `"a\"; touch pwned; \""`) {
+		t.Errorf("dry run: notice %q", got.notice)
+	}
+
+	m.SetPolicy(policy.ReadOnly)
+	if got, cmd = press(t, m, "o"); cmd != nil || !strings.Contains(got.notice, "disabled (read-only)") {
+		t.Errorf("read-only: notice %q", got.notice)
+	}
+
+	m.SetPolicy(policy.Normal)
+	if got, _ = press(t, m, "o"); !strings.HasPrefix(got.notice, "open: ") {
+		t.Errorf("missing program: notice %q", got.notice)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package tui
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// builtinOpenCommands are the open_cmd values usable by name. Windows has
+// no mtr; pathping runs in a new console window that stays open. cmd /k
+// parses its arguments, which is safe here as an address has no shell
+// metacharacters; user commands should not wrap {app} in cmd the same way.
+func builtinOpenCommands() map[string]string {
+	return map[string]string{
+		"ipinfo": "rundll32 url.dll,FileProtocolHandler https://ipinfo.io/{remote_addr}",
+		"mtr":    "conhost.exe cmd /k pathping -n {remote_addr}",
+	}
+}
+
+const createNewProcessGroup = 0x00000200
+
+// detach starts cmd in its own process group, so Ctrl+C in the TUI does
+// not reach it.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createNewProcessGroup}
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ping-tracker/tracker"
+)
+
+// originView is which traffic the table shows (O cycles): this machine's
+// and forwarded flows in separate sections, or only one of them.
+type originView int
+
+const (
+	originBoth originView = iota
+	originLocal
+	originForwarded
+)
+
+var originViewNames = []string{"local and forwarded", "local only", "forwarded only"}
+
+// cycleOrigin switches to the next origin view.
+func (m *Model) cycleOrigin() {
+	m.originView = (m.originView + 1) % originView(len(originViewNames))
+	m.cursor, m.offset = 0, 0
+	m.notice = "Showing " + originViewNames[m.originView] + " traffic"
+	if !m.forwarding {
+		m.notice += " (no forwarded flows: run with -conntrack on a Linux router)"
+	}
+	m.rows.reset()
+	m.refresh()
+}
+
+// filterOrigin notes whether there is forwarded traffic at all and drops
+// the connections the origin view hides.
+func (m *Model) filterOrigin(all []*tracker.Connection) {
+	m.forwarding = false
+	for _, c := range all {
+		if c.Origin != tracker.OriginLocal {
+			m.forwarding = true
+			break
+		}
+	}
+	if m.originView == originBoth {
+		return
+	}
+	kept := make([]*tracker.Connection, 0, len(m.connections))
+	for _, c := range m.connections {
+		if (c.Origin == tracker.OriginLocal) == (m.originView == originLocal) {
+			kept = append(kept, c)
+		}
+	}
+	m.connections = kept
+}
+
+// sectioned reports whether the table is split into origin sections: both
+// origins are shown and there is forwarded traffic to set apart.
+func (m Model) sectioned() bool {
+	if m.originView != originBoth || m.listingGroups() {
+		return false
+	}
+	for o := range m.origins {
+		if o != tracker.OriginLocal {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionLines is how many table lines the section headers take.
+func (m Model) sectionLines() int {
+	if !m.sectioned() {
+		return 0
+	}
+	return len(m.origins)
+}
+
+// originRank orders the sections: local first, then forwarded, then bridged.
+func originRank(o tracker.Origin) int {
+	switch o {
+	case tracker.OriginLocal:
+		return 0
+	case tracker.OriginForwarded:
+		return 1
+	}
+	return 2
+}
+
+// groupOrigins moves rows into their sections, keeping the sorted order
+// within each.
+func (m *Model) groupOrigins() {
+	if !m.sectioned() {
+		return
+	}
+	sort.SliceStable(m.connections, func(i, j int) bool {
+		return originRank(m.connections[i].Origin) < originRank(m.connections[j].Origin)
+	})
+}
+
+// sectionHeader is the line above a section: its origin and totals.
+func (m Model) sectionHeader(o tracker.Origin, width int) string {
+	s := m.origins[o]
+	name := map[tracker.Origin]string{
+		tracker.OriginLocal:     "Local",
+		tracker.OriginForwarded: "Forwarded",
+		tracker.OriginBridged:   "Container bridges",
+	}[o]
+	text := fmt.Sprintf("── %s: %d connection%s, TX %s RX %s ", name, s.Conns, plural(s.Conns),
+		tracker.FormatBytes(s.TxRate), tracker.FormatBytes(s.RxRate))
+	if pad := width - len([]rune(text)); pad > 0 {
+		text += strings.Repeat("─", pad)
+	}
+	return m.st(styleHeader).Render(truncate(text, width))
+}
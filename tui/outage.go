@@ -0,0 +1,28 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+)
+
+// refreshOutages adds the outage alerts and recoveries since the last
+// refresh to the delta log, and notes the latest in the status bar.
+func (m *Model) refreshOutages() {
+	for _, e := range m.tracker.OutageEvents() {
+		if !e.Time.After(m.outageSeen) {
+			continue
+		}
+		m.outageSeen = e.Time
+		note := fmt.Sprintf("%s unreachable for %s", m.addr(e.Addr), fmtOutage(e.Duration()))
+		if e.Ended {
+			note = fmt.Sprintf("%s reachable again after %s", m.addr(e.Addr), fmtOutage(e.Duration()))
+		}
+		m.deltaLog = append(m.deltaLog, deltaEntry{Time: e.Time, Note: note})
+		m.notice = note
+	}
+}
+
+// fmtOutage formats an outage to the second, e.g. "4m32s".
+func fmtOutage(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
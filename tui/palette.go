@@ -0,0 +1,214 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// styleName is a semantic style. Rendering code asks the palette for one of
+// these instead of using a color directly, so palettes can swap every color.
+type styleName string
+
+const (
+	styleTitle       styleName = "title"
+	styleHeader      styleName = "header"
+	styleRow         styleName = "row"
+	styleSelection   styleName = "selection"
+	styleSearch      styleName = "search"
+	styleStatus      styleName = "status"
+	styleGood        styleName = "metric.good"
+	styleWarn        styleName = "metric.warn"
+	styleBad         styleName = "metric.bad"
+	styleDirIn       styleName = "direction.in"
+	styleDirOut      styleName = "direction.out"
+	styleStale       styleName = "stale"
+	styleBadgeNew    styleName = "badge.new"
+	styleAuditLow    styleName = "badge.audit_low"
+	styleAuditHigh   styleName = "badge.audit_high"
+	styleRowWarn     styleName = "row.warn"
+	styleRowCrit     styleName = "row.crit"
+	styleNewListener styleName = "row.new_listener"
+	styleMarked      styleName = "row.marked"
+)
+
+// palette maps every semantic style to a concrete one.
+type palette struct {
+	name string
+	// symbols adds a non-color cue to good / warn / bad values (·, !, !!)
+	// for palettes where the colors alone may not be told apart.
+	symbols bool
+	styles  map[styleName]lipgloss.Style
+}
+
+func fg(c string) lipgloss.Style { return lipgloss.NewStyle().Foreground(lipgloss.Color(c)) }
+
+func fgbg(f, b string) lipgloss.Style {
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(f)).Background(lipgloss.Color(b))
+}
+
+// palettes are the available palettes, in the order C cycles through them.
+var palettes = []*palette{
+	{
+		name: "default",
+		styles: map[styleName]lipgloss.Style{
+			styleTitle:       fg("170").Bold(true).PaddingLeft(1),
+			styleHeader:      fgbg("39", "236").Bold(true),
+			styleRow:         fg("252"),
+			styleSelection:   fgbg("229", "57"),
+			styleSearch:      fg("213").Bold(true),
+			styleStatus:      fg("241").PaddingLeft(1),
+			styleGood:        fg("46"),  // green
+			styleWarn:        fg("226"), // yellow
+			styleBad:         fg("196"), // red
+			styleDirIn:       fg("87"),
+			styleDirOut:      fg("214"),
+			styleStale:       fg("240"),
+			styleBadgeNew:    fgbg("0", "214").Bold(true),
+			styleAuditLow:    fgbg("0", "226").Bold(true),
+			styleAuditHigh:   fgbg("231", "160").Bold(true),
+			styleRowWarn:     fgbg("0", "178"),
+			styleRowCrit:     fgbg("231", "124"),
+			styleNewListener: fgbg("231", "90"),
+			styleMarked:      fgbg("231", "24"),
+		},
+	},
+	{
+		// Okabe-Ito colors, distinguishable with the common color vision
+		// deficiencies: blue / orange / vermillion instead of green /
+		// yellow / red.
+		name:    "colorblind",
+		symbols: true,
+		styles: map[styleName]lipgloss.Style{
+			styleTitle:       fg("175").Bold(true).PaddingLeft(1),
+			styleHeader:      fgbg("74", "236").Bold(true),
+			styleRow:         fg("252"),
+			styleSelection:   fgbg("231", "25"),
+			styleSearch:      fg("175").Bold(true),
+			styleStatus:      fg("245").PaddingLeft(1),
+			styleGood:        fg("33"),  // blue
+			styleWarn:        fg("214"), // orange
+			styleBad:         fg("166"), // vermillion
+			styleDirIn:       fg("74"),  // sky blue
+			styleDirOut:      fg("227"), // yellow
+			styleStale:       fg("243"),
+			styleBadgeNew:    fgbg("0", "227").Bold(true),
+			styleAuditLow:    fgbg("0", "214").Bold(true),
+			styleAuditHigh:   fgbg("231", "166").Bold(true),
+			styleRowWarn:     fgbg("0", "214"),
+			styleRowCrit:     fgbg("231", "166"),
+			styleNewListener: fgbg("0", "175"),
+			styleMarked:      fgbg("0", "117"),
+		},
+	},
+	{
+		// No colors at all: weight, underline and reverse video only, for
+		// monochrome terminals and maximum contrast.
+		name:    "mono",
+		symbols: true,
+		styles: map[styleName]lipgloss.Style{
+			styleTitle:       lipgloss.NewStyle().Bold(true).PaddingLeft(1),
+			styleHeader:      lipgloss.NewStyle().Bold(true).Underline(true),
+			styleRow:         lipgloss.NewStyle(),
+			styleSelection:   lipgloss.NewStyle().Reverse(true),
+			styleSearch:      lipgloss.NewStyle().Bold(true),
+			styleStatus:      lipgloss.NewStyle().PaddingLeft(1),
+			styleGood:        lipgloss.NewStyle(),
+			styleWarn:        lipgloss.NewStyle().Bold(true),
+			styleBad:         lipgloss.NewStyle().Bold(true).Underline(true),
+			styleDirIn:       lipgloss.NewStyle(),
+			styleDirOut:      lipgloss.NewStyle(),
+			styleStale:       lipgloss.NewStyle().Faint(true),
+			styleBadgeNew:    lipgloss.NewStyle().Reverse(true),
+			styleAuditLow:    lipgloss.NewStyle().Bold(true),
+			styleAuditHigh:   lipgloss.NewStyle().Bold(true).Reverse(true),
+			styleRowWarn:     lipgloss.NewStyle().Underline(true),
+			styleRowCrit:     lipgloss.NewStyle().Bold(true).Reverse(true),
+			styleNewListener: lipgloss.NewStyle().Bold(true).Underline(true),
+			styleMarked:      lipgloss.NewStyle().Italic(true).Underline(true),
+		},
+	},
+}
+
+// PaletteNames lists the palettes accepted by SetPalette.
+func PaletteNames() []string {
+	names := make([]string, len(palettes))
+	for i, p := range palettes {
+		names[i] = p.name
+	}
+	return names
+}
+
+// findPalette returns the palette called name ("" is the default).
+func findPalette(name string) (*palette, error) {
+	if name == "" {
+		return palettes[0], nil
+	}
+	for _, p := range palettes {
+		if p.name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown palette %q (want %s)", name, strings.Join(PaletteNames(), ", "))
+}
+
+// ValidatePalette checks a palette name from the config file.
+func ValidatePalette(name string) error {
+	_, err := findPalette(name)
+	return err
+}
+
+// SetPalette switches to the named palette; an unknown name keeps the
+// current one.
+func (m *Model) SetPalette(name string) error {
+	p, err := findPalette(name)
+	if err != nil {
+		return err
+	}
+	m.pal = p
+	m.rows.reset()
+	return nil
+}
+
+// cyclePalette switches to the next palette (C).
+func (m *Model) cyclePalette() {
+	for i, p := range palettes {
+		if p == m.pal {
+			m.pal = palettes[(i+1)%len(palettes)]
+			break
+		}
+	}
+	m.rows.reset()
+	m.notice = "Palette: " + m.pal.name
+}
+
+// st returns the current palette's style for name.
+func (m Model) st(name styleName) lipgloss.Style {
+	return m.pal.styles[name]
+}
+
+// metricLevel grades a value for the good / warn / bad styles.
+type metricLevel int
+
+const (
+	metricGood metricLevel = iota
+	metricWarn
+	metricBad
+)
+
+// metric returns the style of a graded value and, in palettes with
+// symbols, the suffix that repeats the grade without color.
+func (m Model) metric(level metricLevel) (lipgloss.Style, string) {
+	name, symbol := styleGood, "·"
+	switch level {
+	case metricWarn:
+		name, symbol = styleWarn, "!"
+	case metricBad:
+		name, symbol = styleBad, "!!"
+	}
+	if !m.pal.symbols {
+		symbol = ""
+	}
+	return m.st(name), symbol
+}
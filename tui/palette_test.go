@@ -0,0 +1,123 @@
+package tui
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// declaredStyles returns the styleName constants declared in palette.go.
+func declaredStyles(t *testing.T) []styleName {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "palette.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []styleName
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok || spec.Type == nil {
+			return true
+		}
+		if id, ok := spec.Type.(*ast.Ident); ok && id.Name == "styleName" {
+			for _, v := range spec.Values {
+				if lit, ok := v.(*ast.BasicLit); ok {
+					names = append(names, styleName(strings.Trim(lit.Value, `"`)))
+				}
+			}
+		}
+		return true
+	})
+	if len(names) < 10 {
+		t.Fatalf("found only %d style names", len(names))
+	}
+	return names
+}
+
+func TestPalettesDefineEveryStyle(t *testing.T) {
+	names := declaredStyles(t)
+	for _, p := range palettes {
+		for _, name := range names {
+			if _, ok := p.styles[name]; !ok {
+				t.Errorf("palette %s has no %s style", p.name, name)
+			}
+		}
+		if len(p.styles) != len(names) {
+			t.Errorf("palette %s has %d styles for %d names", p.name, len(p.styles), len(names))
+		}
+	}
+	if len(palettes) < 3 || palettes[0].name != "default" {
+		t.Errorf("palettes %v", PaletteNames())
+	}
+}
+
+// TestNoColorsOutsidePalette checks that rendering code takes its colors
+// from the palette, so switching palettes changes every one of them.
+func TestNoColorsOutsidePalette(t *testing.T) {
+	files, _ := filepath.Glob("*.go")
+	for _, f := range files {
+		if f == "palette.go" || strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "lipgloss.Color(") {
+			t.Errorf("%s sets a color directly", f)
+		}
+	}
+}
+
+func TestPaletteSelection(t *testing.T) {
+	m := newTestModel()
+	if m.pal.name != "default" {
+		t.Fatalf("starts with %s", m.pal.name)
+	}
+	if err := m.SetPalette("sepia"); err == nil || m.pal.name != "default" {
+		t.Errorf("unknown palette: %v, now %s", err, m.pal.name)
+	}
+	if ValidatePalette("mono") != nil || ValidatePalette("") != nil || ValidatePalette("Mono") == nil {
+		t.Error("ValidatePalette")
+	}
+	var seen []string
+	for range palettes {
+		m, _ = press(t, m, "C")
+		seen = append(seen, m.pal.name)
+		if m.notice != "Palette: "+m.pal.name {
+			t.Errorf("notice %q", m.notice)
+		}
+	}
+	if strings.Join(seen, ",") != strings.Join(append(PaletteNames()[1:], "default"), ",") {
+		t.Errorf("C cycled through %v", seen)
+	}
+}
+
+// TestMetricSymbols checks the non-color cue: the colorblind and mono
+// palettes repeat the grade after the value, the default one does not.
+func TestMetricSymbols(t *testing.T) {
+	conns := renderConns() // good, warn and bad ping and loss
+	for _, tt := range []struct {
+		palette string
+		want    []string
+	}{
+		{"default", []string{"12.3ms ", "87.0ms ", "310.0ms "}},
+		{"colorblind", []string{"12.3ms·", "87.0ms!", "310.0ms!!"}},
+		{"mono", []string{"12.3ms·", "87.0ms!", "310.0ms!!"}},
+	} {
+		m := newTestModel()
+		m.SetPalette(tt.palette)
+		for i, c := range conns {
+			row := ansi.Strip(m.renderRow(c, m.tableLayout()))
+			if !strings.Contains(row, tt.want[i]) {
+				t.Errorf("%s, row %d: %q lacks %q", tt.palette, i, row, tt.want[i])
+			}
+		}
+	}
+}
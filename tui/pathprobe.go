@@ -0,0 +1,172 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxPathResults caps the cached probe results; the oldest is dropped.
+const maxPathResults = 100
+
+// pathProbeView is the Q overlay: a path-quality probe to the selected
+// connection's remote host, running or finished.
+type pathProbeView struct {
+	addr    string
+	port    int
+	app     string
+	running bool
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// pathProbeMsg delivers a finished probe.
+type pathProbeMsg struct {
+	result tracker.PathQuality
+}
+
+// openPathProbe shows the cached result for the selected connection's
+// remote host, or starts a probe if there is none.
+func (m Model) openPathProbe() (tea.Model, tea.Cmd) {
+	if m.listingGroups() || m.cursor >= len(m.connections) {
+		return m, nil
+	}
+	c := m.connections[m.cursor]
+	if c.Host != "" || c.RemoteAddr == "" || c.RemoteAddr == "0.0.0.0" || c.RemoteAddr == "::" {
+		m.notice = "Path probe needs a local connection with a remote address"
+		return m, nil
+	}
+	m.pathView = &pathProbeView{addr: c.RemoteAddr, port: c.RemotePort, app: m.appName(c)}
+	m.pushMode(&pathProbeMode{})
+	if _, ok := m.pathResults[c.RemoteAddr]; ok {
+		return m, nil
+	}
+	return m, m.startPathProbe()
+}
+
+// startPathProbe runs a probe for the open overlay in the background.
+func (m Model) startPathProbe() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := m.pathView
+	v.running = true
+	v.started = time.Now()
+	v.cancel = cancel
+	addr, port := v.addr, v.port
+	return func() tea.Msg {
+		return pathProbeMsg{result: tracker.ProbePath(ctx, addr, port)}
+	}
+}
+
+// handlePathProbeMsg caches a finished probe. Cancelled probes are dropped.
+func (m Model) handlePathProbeMsg(msg pathProbeMsg) (tea.Model, tea.Cmd) {
+	r := msg.result
+	if errors.Is(r.Err, context.Canceled) {
+		return m, nil
+	}
+	if _, ok := m.pathResults[r.Addr]; !ok && len(m.pathResults) >= maxPathResults {
+		oldest := ""
+		for addr, p := range m.pathResults {
+			if oldest == "" || p.At.Before(m.pathResults[oldest].At) {
+				oldest = addr
+			}
+		}
+		delete(m.pathResults, oldest)
+	}
+	m.pathResults[r.Addr] = r
+	if m.pathView != nil && m.pathView.addr == r.Addr {
+		m.pathView.running = false
+		m.pathView.cancel = nil
+	}
+	return m, nil
+}
+
+// pathProbeMode is the open Q overlay. Closing it stops a running probe.
+type pathProbeMode struct{}
+
+func (p *pathProbeMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "Q":
+		m.cancelMode(p)
+	case "r":
+		if !m.pathView.running {
+			return m, m.startPathProbe(), true
+		}
+	}
+	return m, nil, true
+}
+
+func (p *pathProbeMode) cancel(m *Model) {
+	if m.pathView.cancel != nil {
+		m.pathView.cancel()
+	}
+	m.pathView = nil
+}
+
+func (p *pathProbeMode) view(m Model) string { return m.renderPathProbe() }
+
+// renderPathProbe draws the Q overlay.
+func (m Model) renderPathProbe() string {
+	v := m.pathView
+	lines := []string{
+		m.st(styleTitle).Render(fmt.Sprintf("Path quality to %s:%d (%s)", m.addr(v.addr), v.port, v.app)),
+		"",
+	}
+	r, ok := m.pathResults[v.addr]
+	switch {
+	case v.running:
+		lines = append(lines, fmt.Sprintf("  Probing… %s of at most %s", fmtDur(time.Since(v.started)), fmtDur(tracker.PathProbeTimeout)))
+		if ok {
+			lines = append(lines, "", "  Previous result:")
+			lines = append(lines, pathQualityLines(r, m.times, time.Now())...)
+		}
+	case ok:
+		lines = append(lines, pathQualityLines(r, m.times, time.Now())...)
+	}
+
+	help := "r: re-run  Esc/Q: close"
+	if v.running {
+		help = "Esc/Q: cancel"
+	}
+	lines = append(lines, "", m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
+
+// pathQualityLines formats a probe result.
+func pathQualityLines(r tracker.PathQuality, times timeFormatter, now time.Time) []string {
+	lines := []string{fmt.Sprintf("  Measured:    %s", times.format(r.At, now))}
+	if r.Err != nil {
+		return append(lines, fmt.Sprintf("  Failed:      %v", r.Err))
+	}
+	if r.TCPErr != "" {
+		lines = append(lines, fmt.Sprintf("  TCP:         %s", r.TCPErr))
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("  Idle RTT:    %s", r.IdleRTT.Round(10*time.Microsecond)),
+			fmt.Sprintf("  Loaded RTT:  %s (bufferbloat %+s)", r.LoadedRTT.Round(10*time.Microsecond), r.Bloat().Round(10*time.Microsecond)))
+	}
+	if r.ICMPErr != "" {
+		return append(lines, fmt.Sprintf("  Sizes:       skipped (%s)", r.ICMPErr))
+	}
+	pmtu := "unknown (no size got through)"
+	if r.PMTU > 0 {
+		pmtu = fmt.Sprintf("%d bytes", r.PMTU)
+		if last := r.Sizes[len(r.Sizes)-1]; last.Lost < last.Sent {
+			pmtu = fmt.Sprintf("at least %d bytes (largest size tried)", r.PMTU)
+		}
+	}
+	lines = append(lines, fmt.Sprintf("  Path MTU:    %s", pmtu), "", "  Size   Sent  Loss   RTT")
+	for _, s := range r.Sizes {
+		rtt := "-"
+		if s.RTT > 0 {
+			rtt = s.RTT.Round(10 * time.Microsecond).String()
+		}
+		lines = append(lines, fmt.Sprintf("  %-5d  %-4d  %3.0f%%  %s", s.Size, s.Sent, s.Loss(), rtt))
+	}
+	return lines
+}
@@ -0,0 +1,65 @@
+package tui
+
+import (
+	"ping-tracker/policy"
+)
+
+// keyAction is a key that acts beyond watching: the action the policy
+// rules on and, for an Exec action, what the key would run, "" when it
+// would do nothing.
+type keyAction struct {
+	action policy.Action
+	plan   func(m Model) string
+}
+
+// keyActions are the table keys that act beyond watching. The dispatcher
+// checks them before the table's handler sees them, so a key listed here
+// is refused in read-only mode and shows its plan in dry-run mode without
+// code of its own.
+var keyActions = map[string]keyAction{
+	"o":  {policy.OpenCommand, Model.openPlan},
+	"f3": {action: policy.PublicAddress},
+}
+
+// actor is a mode with keys of its own that act beyond watching, checked
+// by the dispatcher like keyActions before the mode sees them.
+type actor interface {
+	actions() map[string]keyAction
+}
+
+// SetPolicy sets which actions may run (-read-only, -dry-run).
+func (m *Model) SetPolicy(p policy.Mode) {
+	m.policy = p
+}
+
+// gate rules on key when actions list it, before its handler runs. A
+// refused key says so in the status bar, a simulated one shows what it
+// would have run; either way the handler never sees it. gate reports
+// whether it stopped the key.
+func (m *Model) gate(actions map[string]keyAction, key string) bool {
+	k, ok := actions[key]
+	if !ok {
+		return false
+	}
+	switch m.policy.Check(k.action) {
+	case policy.Deny:
+		m.notice = (&policy.DeniedError{Action: k.action}).Error()
+		return true
+	case policy.Simulate:
+		if k.plan != nil {
+			if plan := k.plan(*m); plan != "" {
+				m.notice = "Dry run, not started: " + plan
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// policyText is the status bar note of a mode other than normal.
+func (m Model) policyText() string {
+	if m.policy == policy.Normal {
+		return ""
+	}
+	return m.policy.String()
+}
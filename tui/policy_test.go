@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"ping-tracker/policy"
+	"ping-tracker/tracker"
+)
+
+// fakeActions replaces what the policed keys run with counters.
+type fakeActions struct {
+	started [][]string
+	lookups int
+}
+
+func newFakeActions(t *testing.T) *fakeActions {
+	f := &fakeActions{}
+	savedStart, savedDiscover := startCommand, discoverNetContext
+	startCommand = func(cmd *exec.Cmd) error {
+		f.started = append(f.started, cmd.Args)
+		return nil
+	}
+	discoverNetContext = func(context.Context, string, string) tracker.NetContext {
+		f.lookups++
+		return tracker.NetContext{}
+	}
+	t.Cleanup(func() { startCommand, discoverNetContext = savedStart, savedDiscover })
+	return f
+}
+
+// TestReadOnlyRunsNothing presses every key of the key table, and the
+// panel keys that act, in read-only mode: nothing starts, and each says
+// why.
+func TestReadOnlyRunsNothing(t *testing.T) {
+	f := newFakeActions(t)
+	m := newTestModelWith(t, testConn("curl", 100, "198.51.100.7", 443))
+	m.SetPolicy(policy.ReadOnly)
+	for key := range keyActions {
+		got, cmd := press(t, m, key)
+		if cmd != nil {
+			cmd()
+		}
+		if !strings.Contains(got.notice, "disabled (read-only)") {
+			t.Errorf("%s: notice %q", key, got.notice)
+		}
+	}
+
+	// A panel opened before the switch still refuses its own keys.
+	m.SetPolicy(policy.Normal)
+	m, _ = press(t, m, "f3")
+	lookups := f.lookups
+	m.SetPolicy(policy.ReadOnly)
+	if _, ok := findMode[*netContextMode](m); !ok {
+		t.Fatal("no F3 panel")
+	}
+	m.netView.running = false
+	got, cmd := press(t, m, "r")
+	if cmd != nil {
+		cmd()
+	}
+	if !strings.Contains(got.notice, "public address lookup (F3): disabled (read-only)") {
+		t.Errorf("r in the panel: notice %q", got.notice)
+	}
+	if len(f.started) != 0 || f.lookups != lookups {
+		t.Errorf("read-only started %q and %d lookups", f.started, f.lookups-lookups)
+	}
+}
+
+func TestDryRunShowsPlan(t *testing.T) {
+	f := newFakeActions(t)
+	m := newTestModelWith(t, testConn("curl", 100, "198.51.100.7", 443))
+	argv, _ := ParseOpenCommand("ss -tnp dst {remote_addr}")
+	m.SetOpenCommand(argv)
+
+	m.SetPolicy(policy.DryRun)
+	got, cmd := press(t, m, "o")
+	if cmd != nil || got.notice != "Dry run, not started: ss -tnp dst 198.51.100.7" {
+		t.Errorf("dry run: notice %q", got.notice)
+	}
+	if len(f.started) != 0 {
+		t.Fatalf("dry run started %q", f.started)
+	}
+
+	// The lookup is traffic, which dry-run lets through.
+	got, cmd = press(t, m, "f3")
+	if cmd != nil {
+		cmd()
+	}
+	if f.lookups != 1 {
+		t.Errorf("%d lookups in dry-run mode", f.lookups)
+	}
+
+	m.SetPolicy(policy.Normal)
+	if got, _ = press(t, m, "o"); got.notice != "Started ss" {
+		t.Errorf("normal: notice %q", got.notice)
+	}
+	if want := []string{"ss", "-tnp", "dst", "198.51.100.7"}; len(f.started) != 1 || !slices.Equal(f.started[0], want) {
+		t.Errorf("started %q, want %q", f.started, want)
+	}
+}
@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// portDistView is the P overlay: which service ports one app talks to.
+type portDistView struct {
+	app    string
+	offset int // first row shown
+}
+
+// openPortDist opens the port distribution of the selected app: the group
+// row when grouped by app, otherwise the selected connection's.
+func (m *Model) openPortDist() {
+	var app string
+	switch {
+	case m.listingGroups() && m.groupBy == groupApp:
+		if m.cursor < len(m.groups) {
+			app = m.groups[m.cursor].Key
+		}
+	case m.listingGroups():
+		m.notice = "Port distribution is per app: group by app (b) or select a connection"
+		return
+	case m.cursor < len(m.connections):
+		app = m.connections[m.cursor].AppName
+	}
+	if app == "" {
+		return
+	}
+	m.ports = &portDistView{app: app}
+	m.pushMode(&portDistMode{})
+}
+
+// portDistMode is the open P overlay.
+type portDistMode struct{}
+
+func (p *portDistMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	v := m.ports
+	switch msg.String() {
+	case "P":
+		m.cancelMode(p)
+	case "enter":
+		// Drill into the app's connections, as Enter on its group row
+		// did before the panel existed.
+		m.cancelMode(p)
+		if m.groupBy == groupApp && m.drillGroup == "" {
+			m.drillInto(v.app)
+		}
+	case "up", "k":
+		if v.offset > 0 {
+			v.offset--
+		}
+	case "down", "j":
+		v.offset++
+	case "home", "g":
+		v.offset = 0
+	case "p":
+		m.togglePause()
+	}
+	return m, nil, true
+}
+
+func (p *portDistMode) cancel(m *Model) {
+	m.ports = nil
+}
+
+func (p *portDistMode) view(m Model) string { return m.renderPortDist() }
+
+// renderPortDist draws the P overlay from the latest unfiltered snapshot,
+// so it follows every refresh.
+func (m Model) renderPortDist() string {
+	v := m.ports
+	stats := tracker.PortDistribution(m.deltaPrev, v.app)
+	app := v.app
+	if m.anon != nil {
+		app = m.anon.app(app)
+	}
+	total := 0
+	for _, s := range stats {
+		total += s.Conns
+	}
+	pauseStr := ""
+	if m.paused {
+		pauseStr = " [PAUSED]"
+	}
+	head := []string{
+		m.st(styleTitle).Render(truncate(fmt.Sprintf("Ports used by %s: %d connection%s on %d port%s%s",
+			app, total, plural(total), len(stats), plural(len(stats)), pauseStr), m.width-1)),
+		"",
+		m.st(styleHeader).Render(truncate(fmt.Sprintf("  %-6s %-6s %-4s %-12s %-18s %-10s %-10s %s",
+			"Port", "Proto", "Dir", "Service", "Conns", "TX", "RX", "Ping"), m.width)),
+	}
+
+	var body []string
+	if len(stats) == 0 {
+		body = append(body, "  No connections of this app right now")
+	}
+	const barLen = 10
+	for _, s := range stats {
+		filled := (s.Conns*barLen + total/2) / max(total, 1)
+		bar := strings.Repeat("█", filled) + strings.Repeat("·", barLen-filled)
+		service := s.Service
+		if service == "" {
+			service = "-"
+		}
+		ping := "-"
+		if s.Pinged > 0 {
+			ping = fmtMs(s.Ping)
+		}
+		body = append(body, truncate(fmt.Sprintf("  %-6d %-6s %-4s %-12s %s %-7d %-10s %-10s %s",
+			s.Port, s.Protocol, s.Direction, truncStr(service, 12), bar, s.Conns,
+			tracker.FormatBytes(s.TxRate), tracker.FormatBytes(s.RxRate), ping), m.width))
+	}
+
+	rows := maxInt(1, m.height-len(head)-2)
+	start := minInt(v.offset, maxInt(0, len(body)-rows))
+	end := minInt(start+rows, len(body))
+	lines := append(head, body[start:end]...)
+	for i := len(lines); i < m.height-1; i++ {
+		lines = append(lines, "")
+	}
+	help := "j/k: scroll  p: pause  P/Esc: close"
+	if m.groupBy == groupApp && m.drillGroup == "" {
+		help = "Enter: the app's connections  " + help
+	}
+	lines = append(lines, m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
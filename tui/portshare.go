@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"fmt"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// collapseShares keeps one row per port several processes listen on, the
+// first of its members shown; the detail view lists them all. Called from
+// refresh after grouping.
+func (m *Model) collapseShares() {
+	if m.listingGroups() {
+		return
+	}
+	seen := make(map[*tracker.PortShare]bool)
+	out := m.connections[:0]
+	for _, c := range m.connections {
+		if s := c.PortShare; s != nil {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+		}
+		out = append(out, c)
+	}
+	m.connections = out
+}
+
+// portShareBadge is the Remote cell of a shared listener, e.g.
+// "REUSEPORT x4", styled by how much it deserves a look.
+func (m Model) portShareBadge(s *tracker.PortShare) (string, lipgloss.Style) {
+	style := m.st(styleStale)
+	switch s.Kind {
+	case tracker.PortOverlap:
+		style = m.st(styleWarn)
+	case tracker.PortConflict:
+		style = m.st(styleBad)
+	}
+	return fmt.Sprintf("%s x%d", s.Kind, s.Processes()), style
+}
+
+// portShareApp is the App cell of a shared listener: the app, or how many
+// apps share the port.
+func (m Model) portShareApp(s *tracker.PortShare) string {
+	apps := s.Apps()
+	if len(apps) > 1 {
+		return fmt.Sprintf("%d apps", len(apps))
+	}
+	if m.anon != nil {
+		return m.anon.app(apps[0])
+	}
+	return apps[0]
+}
+
+// portShareDetail lists the processes sharing a listener's port.
+func (m Model) portShareDetail(s *tracker.PortShare) []string {
+	lines := []string{
+		"",
+		detailField("shared", trf("detail.shared", s.Protocol, s.Port, s.Processes(), s.Kind.Describe())),
+	}
+	for _, p := range s.Members {
+		app := p.AppName
+		if m.anon != nil {
+			app = m.anon.app(app)
+		}
+		lines = append(lines, fmt.Sprintf("    PID %-8d %-20s %-24s %s", p.PID, truncStr(app, 20), m.addr(p.LocalAddr), p.State))
+	}
+	return lines
+}
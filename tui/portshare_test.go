@@ -0,0 +1,52 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// sharedListener is pid's listener on 0.0.0.0:port.
+func sharedListener(app string, pid, port int) tracker.Connection {
+	return tracker.Connection{
+		AppName: app, PID: pid, Protocol: "tcp", State: tracker.StateListening, Direction: tracker.Inbound,
+		LocalAddr: "0.0.0.0", LocalPort: port,
+	}
+}
+
+func TestPortShareRow(t *testing.T) {
+	m := newTestModelWith(t,
+		sharedListener("nginx", 10, 80), sharedListener("nginx", 11, 80), sharedListener("haproxy", 12, 80),
+		testConn("curl", 20, "192.0.2.1", 443))
+	m.width, m.height = 160, 20
+	if len(m.connections) != 2 {
+		t.Fatalf("%d rows, want the shared port collapsed into one", len(m.connections))
+	}
+	view := ansi.Strip(m.View())
+	for _, want := range []string{"3 PIDs", "2 apps", "REUSEPORT x3"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("no %q in\n%s", want, view)
+		}
+	}
+
+	var shared *tracker.Connection
+	for _, c := range m.connections {
+		if c.PortShare != nil {
+			shared = c
+		}
+	}
+	detail := m.renderDetail(shared)
+	for _, want := range []string{
+		"Shared:      tcp port 80, 3 processes: load sharing (SO_REUSEPORT)",
+		"PID 10       nginx",
+		"PID 11       nginx",
+		"PID 12       haproxy",
+	} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("no %q in\n%s", want, detail)
+		}
+	}
+}
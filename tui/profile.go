@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// profileDoneMsg delivers a finished F10 capture.
+type profileDoneMsg struct {
+	saved []string
+	err   error
+}
+
+// SetProfiler enables F10: capture samples the CPU for cpuFor and
+// snapshots the heap, returning the files it wrote.
+func (m *Model) SetProfiler(cpuFor time.Duration, capture func() ([]string, error)) {
+	m.profileFor, m.profile = cpuFor, capture
+}
+
+// startProfile runs a capture in the background. Only one runs at a time.
+func (m Model) startProfile() (tea.Model, tea.Cmd) {
+	switch {
+	case m.profile == nil:
+		return m, nil
+	case m.profiling:
+		m.notice = "A profile capture is already running"
+		return m, nil
+	}
+	m.profiling = true
+	m.notice = fmt.Sprintf("Capturing a %s CPU profile and a heap snapshot...", m.profileFor)
+	capture := m.profile
+	return m, func() tea.Msg {
+		saved, err := capture()
+		return profileDoneMsg{saved: saved, err: err}
+	}
+}
+
+// handleProfileDone reports where a capture went.
+func (m Model) handleProfileDone(msg profileDoneMsg) (tea.Model, tea.Cmd) {
+	m.profiling = false
+	names := make([]string, len(msg.saved))
+	for i, path := range msg.saved {
+		names[i] = filepath.Base(path)
+		m.noteWritten(path)
+	}
+	switch {
+	case msg.err != nil && len(names) > 0:
+		m.notice = fmt.Sprintf("Profile capture failed: %v (saved %s)", msg.err, strings.Join(names, ", "))
+	case msg.err != nil:
+		m.notice = fmt.Sprintf("Profile capture failed: %v", msg.err)
+	default:
+		m.notice = fmt.Sprintf("Profiles saved to %s: %s", filepath.Dir(msg.saved[0]), strings.Join(names, ", "))
+	}
+	return m, nil
+}
@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProfileCapture runs F10 with a capture that waits to be released:
+// the UI keeps answering, a second F10 is refused, and the result lands in
+// the status bar and the session's files.
+func TestProfileCapture(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	m := newTestModel()
+	m.SetProfiler(15*time.Second, func() ([]string, error) {
+		calls++
+		<-release
+		return []string{"/cfg/profile-cpu-1.pprof", "/cfg/profile-heap-1.pprof"}, nil
+	})
+
+	m, cmd := press(t, m, "f10")
+	if cmd == nil || !m.profiling || m.notice != "Capturing a 15s CPU profile and a heap snapshot..." {
+		t.Fatalf("f10: cmd %v, profiling %v, notice %q", cmd != nil, m.profiling, m.notice)
+	}
+	done := make(chan any)
+	go func() { done <- cmd() }()
+
+	m, again := press(t, m, "f10")
+	if again != nil || m.notice != "A profile capture is already running" {
+		t.Errorf("second f10: cmd %v, notice %q", again != nil, m.notice)
+	}
+	m, _ = press(t, m, "down", "?", "esc") // the UI keeps going meanwhile
+	if !strings.Contains(m.statusText(), "profiling") {
+		t.Errorf("status bar does not show the capture: %q", m.statusText())
+	}
+
+	close(release)
+	msg := <-done
+	next, _ := m.Update(msg)
+	m = next.(Model)
+	if m.profiling || calls != 1 {
+		t.Fatalf("after the capture: profiling %v, %d captures", m.profiling, calls)
+	}
+	if m.notice != "Profiles saved to /cfg: profile-cpu-1.pprof, profile-heap-1.pprof" {
+		t.Errorf("notice %q", m.notice)
+	}
+	if got := strings.Join(m.WrittenFiles(), " "); got != "/cfg/profile-cpu-1.pprof /cfg/profile-heap-1.pprof" {
+		t.Errorf("written files %q", got)
+	}
+	if strings.Contains(m.statusText(), "profiling") {
+		t.Error("status bar still shows the capture")
+	}
+}
+
+func TestProfileCaptureFailed(t *testing.T) {
+	m := newTestModel()
+	for _, tt := range []struct {
+		saved []string
+		err   error
+		want  string
+	}{
+		{nil, errors.New("CPU profile: cpu profiling already in use"), "Profile capture failed: CPU profile: cpu profiling already in use"},
+		{[]string{"/cfg/profile-cpu-1.pprof"}, errors.New("writing profile-heap-1.pprof: no space left on device"),
+			"Profile capture failed: writing profile-heap-1.pprof: no space left on device (saved profile-cpu-1.pprof)"},
+	} {
+		m.profiling = true
+		next, _ := m.Update(profileDoneMsg{saved: tt.saved, err: tt.err})
+		got := next.(Model)
+		if got.profiling || got.notice != tt.want {
+			t.Errorf("profiling %v, notice %q, want %q", got.profiling, got.notice, tt.want)
+		}
+		if len(got.WrittenFiles()) != len(tt.saved) {
+			t.Errorf("written files %v", got.WrittenFiles())
+		}
+	}
+
+	// Without a profiler F10 does nothing.
+	if m, cmd := press(t, newTestModel(), "f10"); cmd != nil || m.profiling {
+		t.Error("f10 without a profiler started a capture")
+	}
+}
@@ -0,0 +1,103 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Reload is what changed when the config file was re-read. Main builds it
+// from the old and new config; the model applies the UI parts and asks
+// before applying Confirm.
+type Reload struct {
+	Applied []string        // settings already applied live, for the status bar
+	UI      []func(*Model)  // live UI changes, applied by the model
+	Confirm []ConfirmChange // changes applied only once the user agrees
+	Restart []string        // changed settings that take effect on the next start
+}
+
+// ConfirmChange is a reloaded setting that disrupts the running session
+// (e.g. the scan interval), applied only after a y at the prompt.
+type ConfirmChange struct {
+	Prompt string // e.g. "scan interval 3s -> 10s"
+	Apply  func()
+}
+
+// ConfigReloader re-reads the config file and applies what it can. With
+// force false it returns nil, nil when the file is unchanged. An error means
+// the new file was rejected and the old settings stay in effect.
+type ConfigReloader func(force bool) (*Reload, error)
+
+// SetConfigReloader makes the model check the config file on every tick
+// and on ctrl+r.
+func (m *Model) SetConfigReloader(r ConfigReloader) {
+	m.reloadConfig = r
+}
+
+// checkConfig runs the reloader and applies its result. It reports
+// whether the config file was reloaded.
+func (m *Model) checkConfig(force bool) bool {
+	if m.reloadConfig == nil {
+		return false
+	}
+	r, err := m.reloadConfig(force)
+	if err != nil {
+		m.notice = fmt.Sprintf("Config not reloaded: %v (keeping the previous settings)", err)
+		return false
+	}
+	if r == nil {
+		return false
+	}
+	for _, apply := range r.UI {
+		apply(m)
+	}
+	m.rows.reset()
+	for i := len(r.Confirm) - 1; i >= 0; i-- {
+		m.queueMode(&confirmMode{change: r.Confirm[i]})
+	}
+
+	var parts []string
+	if len(r.Applied) > 0 {
+		parts = append(parts, "applied "+strings.Join(r.Applied, ", "))
+	}
+	if len(r.Restart) > 0 {
+		parts = append(parts, "restart needed for "+strings.Join(r.Restart, ", "))
+	}
+	switch {
+	case len(parts) > 0:
+		m.notice = "Config reloaded: " + strings.Join(parts, "; ")
+	case force && len(r.Confirm) == 0:
+		m.notice = "Config reloaded: no changes"
+	}
+	return true
+}
+
+// confirmMode asks whether to apply a reloaded setting: y applies it, n
+// or Esc keeps the running value. Other keys work as usual.
+type confirmMode struct {
+	change ConfirmChange
+}
+
+func (c *confirmMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "y":
+		c.change.Apply()
+		m.notice = "Applied " + c.change.Prompt
+		m.endMode(c)
+	case "n":
+		m.cancelMode(c)
+	default:
+		return m, nil, false
+	}
+	m.rows.reset()
+	return m, nil, true
+}
+
+func (c *confirmMode) cancel(m *Model) {
+	m.notice = "Kept the running value instead of " + c.change.Prompt
+}
+
+func (c *confirmMode) prompt(m Model) string {
+	return fmt.Sprintf(" Config changed: apply %s? y/n", c.change.Prompt)
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeReloader returns r (or err) when forced or when changed is set.
+type fakeReloader struct {
+	r       *Reload
+	err     error
+	changed bool
+	calls   int
+}
+
+func (f *fakeReloader) check(force bool) (*Reload, error) {
+	f.calls++
+	if !force && !f.changed {
+		return nil, nil
+	}
+	return f.r, f.err
+}
+
+func TestReloadAppliesLive(t *testing.T) {
+	f := &fakeReloader{r: &Reload{
+		Applied: []string{"confirm_quit"},
+		UI:      []func(*Model){func(m *Model) { m.SetConfirmQuit(true) }},
+		Restart: []string{"event_log"},
+	}}
+	m := newTestModel()
+	m.SetConfigReloader(f.check)
+	m, _ = press(t, m, "ctrl+r")
+	if f.calls != 1 || !m.confirmQuit {
+		t.Fatalf("%d reloads, confirm_quit %v", f.calls, m.confirmQuit)
+	}
+	if want := "Config reloaded: applied confirm_quit; restart needed for event_log"; m.notice != want {
+		t.Errorf("notice %q, want %q", m.notice, want)
+	}
+}
+
+func TestReloadUnchanged(t *testing.T) {
+	f := &fakeReloader{r: &Reload{}}
+	m := newTestModel()
+	m.SetConfigReloader(f.check)
+	if m.checkConfig(false) {
+		t.Fatal("unchanged file reported as reloaded")
+	}
+	m, _ = press(t, m, "ctrl+r")
+	if m.notice != "Config reloaded: no changes" {
+		t.Errorf("notice %q", m.notice)
+	}
+}
+
+func TestReloadRejected(t *testing.T) {
+	f := &fakeReloader{err: errors.New(`invalid interval "fast"`)}
+	m := newTestModel()
+	m.SetConfigReloader(f.check)
+	m, _ = press(t, m, "ctrl+r")
+	if !strings.HasPrefix(m.notice, "Config not reloaded: invalid interval") || !strings.Contains(m.notice, "keeping the previous settings") {
+		t.Errorf("notice %q", m.notice)
+	}
+}
+
+func TestReloadConfirm(t *testing.T) {
+	for _, tt := range []struct {
+		key     string
+		applied bool
+		notice  string
+	}{
+		{"y", true, "Applied scan interval 3s -> 10s"},
+		{"n", false, "Kept the running value instead of scan interval 3s -> 10s"},
+		{"esc", false, "Kept the running value instead of scan interval 3s -> 10s"},
+	} {
+		applied := false
+		f := &fakeReloader{r: &Reload{Confirm: []ConfirmChange{{
+			Prompt: "scan interval 3s -> 10s",
+			Apply:  func() { applied = true },
+		}}}}
+		m := newTestModel()
+		m.SetConfigReloader(f.check)
+		m, _ = press(t, m, "ctrl+r")
+		c, ok := findMode[*confirmMode](m)
+		if !ok {
+			t.Fatal("no confirmation prompt")
+		}
+		if p := c.prompt(m); !strings.Contains(p, "apply scan interval 3s -> 10s? y/n") {
+			t.Errorf("prompt %q", p)
+		}
+		if applied {
+			t.Fatal("applied before confirming")
+		}
+		m, _ = press(t, m, tt.key)
+		if applied != tt.applied || m.notice != tt.notice {
+			t.Errorf("%s: applied %v, notice %q", tt.key, applied, m.notice)
+		}
+		if _, ok := findMode[*confirmMode](m); ok {
+			t.Errorf("%s: prompt still open", tt.key)
+		}
+	}
+}
+
+// TestReloadConfirmWaitsForTyping checks that a prompt raised while the
+// user types a search queues behind it instead of taking its keys.
+func TestReloadConfirmWaitsForTyping(t *testing.T) {
+	applied := false
+	f := &fakeReloader{r: &Reload{Confirm: []ConfirmChange{{Prompt: "ping probes off", Apply: func() { applied = true }}}}}
+	m := newTestModel()
+	m.SetConfigReloader(f.check)
+	m, _ = press(t, m, "/")
+	m.checkConfig(true)
+	m, _ = press(t, m, "y")
+	if applied || m.filter != "y" {
+		t.Fatalf("typed y went to the prompt (applied %v, filter %q)", applied, m.filter)
+	}
+	m, _ = press(t, m, "enter", "y")
+	if !applied {
+		t.Fatal("not applied after the search closed")
+	}
+}
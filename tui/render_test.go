@@ -0,0 +1,249 @@
+package tui
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites it under -update.
+// Escape sequences are written visibly so the files stay readable.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	got = strings.ReplaceAll(got, "\x1b", `\e`)
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+// withColor renders in 256 colors for the rest of the test; without it
+// lipgloss sees no terminal and renders plain text.
+func withColor(t *testing.T) {
+	old := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	t.Cleanup(func() { lipgloss.SetColorProfile(old) })
+}
+
+// renderConns are rows covering every metric grade, both directions,
+// a wide-character app name and an address too long for its column.
+func renderConns() []*tracker.Connection {
+	c := func(app string, pid int, remote string, port int) *tracker.Connection {
+		conn := testConn(app, pid, remote, port)
+		return &conn
+	}
+	good := c("firefox", 1200, "93.184.216.34", 443)
+	good.Ping, good.PingCount = 12300*time.Microsecond, 10
+	good.HasByteCounts, good.TxRate, good.RxRate = true, 2048, 512<<10
+	warn := c("ゲーム🎮クライアント", 4242, "203.0.113.7", 27015)
+	warn.Protocol, warn.LocalPort = "udp", 50000
+	warn.Ping, warn.PingCount, warn.Loss = 87*time.Millisecond, 20, 5
+	bad := c("sshd", 1, "2001:db8:aaaa:bbbb:cccc:dddd:eeee:1", 22)
+	bad.Direction = tracker.Inbound
+	bad.Ping, bad.PingCount, bad.Loss = 310*time.Millisecond, 20, 25
+	return []*tracker.Connection{good, warn, bad}
+}
+
+func renderTableLines(m Model, conns []*tracker.Connection, cursor, width, height int) string {
+	lines := m.renderTable(tableView{
+		conns: conns, layout: m.tableLayout(), cursor: cursor, height: height, width: width,
+	})
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestRenderTableGolden(t *testing.T) {
+	tests := []struct {
+		name          string
+		color         bool
+		palette       string
+		conns         []*tracker.Connection
+		cursor        int
+		width, height int
+	}{
+		{"table_plain", false, "default", renderConns(), 0, 200, 4},
+		{"table_narrow", false, "default", renderConns(), 1, 60, 4},
+		{"table_empty", false, "default", nil, 0, 80, 2},
+		{"table_color", true, "default", renderConns(), 1, 200, 4},
+		{"table_colorblind", true, "colorblind", renderConns(), 2, 200, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.color {
+				withColor(t)
+			}
+			m := newTestModel()
+			if err := m.SetPalette(tt.palette); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, renderTableLines(m, tt.conns, tt.cursor, tt.width, tt.height))
+		})
+	}
+}
+
+// TestRenderTableWidths checks every line is exactly as wide as the
+// terminal, whatever the cells hold, so nothing wraps or leaves a ragged
+// edge.
+func TestRenderTableWidths(t *testing.T) {
+	withColor(t)
+	m := newTestModel()
+	for _, width := range []int{40, 80, 132, 200} {
+		lines := m.renderTable(tableView{conns: renderConns(), layout: m.tableLayout(), height: 3, width: width})
+		for i, line := range lines {
+			if w := ansi.StringWidth(line); w > width {
+				t.Errorf("width %d, line %d: %d columns: %q", width, i, w, ansi.Strip(line))
+			}
+		}
+	}
+}
+
+// TestSelectedRowBackground checks that the selection's background runs
+// across the whole row: a colored cell's reset must not end it early.
+func TestSelectedRowBackground(t *testing.T) {
+	withColor(t)
+	m := newTestModel()
+	conns := renderConns()
+	for cursor := range conns {
+		lines := m.renderTable(tableView{conns: conns, layout: m.tableLayout(), cursor: cursor, height: 3, width: 200})
+		row := lines[1+cursor]
+		body := strings.TrimSuffix(row, "\x1b[0m")
+		if strings.Contains(body, "\x1b[0m") || strings.Contains(body, "\x1b[m") {
+			t.Errorf("row %d: reset inside the selected row: %q", cursor, row)
+		}
+	}
+}
+
+func TestRenderTitleAndStatus(t *testing.T) {
+	p, _ := findPalette("default")
+	title := renderTitle(p, "Ping Tracker — 3 connections", 20)
+	if w := ansi.StringWidth(title); w > 20 {
+		t.Errorf("title is %d columns: %q", w, title)
+	}
+	golden(t, "title_narrow", title+"\n")
+
+	status := renderStatusBar(p, " Sort: Ping ↓ | 3 conns | q quit", 24)
+	if w := ansi.StringWidth(status); w > 24 {
+		t.Errorf("status bar is %d columns: %q", w, status)
+	}
+	golden(t, "status_narrow", status+"\n")
+}
+
+// magnitudeConns are rows whose numbers differ by orders of magnitude in
+// every numeric column, for checking that the columns line up on their
+// right edge.
+func magnitudeConns() []*tracker.Connection {
+	c := func(app string, pid int, ping time.Duration, loss, tx, rx float64) *tracker.Connection {
+		conn := testConn(app, pid, "93.184.216.34", 443)
+		conn.LocalPort = 40000 + pid%20000
+		conn.Ping, conn.PingCount, conn.Loss = ping, 20, loss
+		conn.HasByteCounts, conn.TxRate, conn.RxRate = true, tx, rx
+		conn.LastUpdated = time.Date(2026, 3, 14, 12, 0, 0, pid, time.UTC)
+		return &conn
+	}
+	conns := []*tracker.Connection{
+		c("init", 1, 400*time.Microsecond, 0, 512, 9.8*1024),
+		c("curl", 42, 9800*time.Microsecond, 2.5, 9.8*1024, 98.7*1024*1024),
+		c("steam", 1234, 98700*time.Microsecond, 12, 98.7*1024*1024, 1.2*1024*1024*1024),
+		c("backup", 98765, 1200*time.Millisecond, 100, 2.4*1024*1024*1024, 0),
+	}
+	conns[1].PingCorrection = tracker.CorrectionHost
+	conns[3].PingCorrection = tracker.CorrectionExternal
+	return conns
+}
+
+// TestRenderAlignmentGolden renders numbers of mixed magnitudes in one
+// column, plain, colored, with colorblind symbols and with German
+// separators, and the group view's counts and rates.
+func TestRenderAlignmentGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		color   bool
+		palette string
+		lang    string
+	}{
+		{"align_plain", false, "default", "en"},
+		{"align_color", true, "default", "en"},
+		{"align_colorblind", true, "colorblind", "en"},
+		{"align_de", false, "default", "de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.color {
+				withColor(t)
+			}
+			withLocale(t, tt.lang)
+			m := newTestModel()
+			if err := m.SetPalette(tt.palette); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, renderTableLines(m, magnitudeConns(), 0, 200, 5))
+		})
+	}
+
+	t.Run("align_groups", func(t *testing.T) {
+		m := newTestModel()
+		m.width, m.height = 160, 20
+		m.groupBy = groupApp
+		conns := magnitudeConns()
+		for i := range 1500 {
+			extra := *conns[2]
+			extra.LocalPort, extra.TxRate, extra.RxRate = 1000+i, 1024, 0
+			conns = append(conns, &extra)
+		}
+		m.connections = conns
+		m.applyGrouping()
+		var b strings.Builder
+		m.renderGroupRows(&b)
+		golden(t, "align_groups", b.String())
+	})
+}
+
+// TestAlignmentKeepsSort checks that right-aligned cells sort by value,
+// not by their text: "9.8 KB/s" sorts below "98.7 MB/s".
+func TestAlignmentKeepsSort(t *testing.T) {
+	m := newTestModel()
+	conns := magnitudeConns()
+	for _, tt := range []struct {
+		field SortField
+		want  string
+	}{
+		{SortTxRate, "init curl steam backup"},
+		{SortRxRate, "backup init curl steam"},
+		{SortPing, "init curl steam backup"},
+	} {
+		m.connections = slices.Clone(conns)
+		m.sortField, m.sortAsc = tt.field, true
+		m.sortConnections()
+		var apps []string
+		for _, c := range m.connections {
+			apps = append(apps, c.AppName)
+		}
+		if got := strings.Join(apps, " "); got != tt.want {
+			t.Errorf("sort %d: %s, want %s", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tui
+
+import (
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// rowLook is how a table row is highlighted.
+type rowLook int
+
+const (
+	lookNormal rowLook = iota
+	lookSelected
+	lookCrit
+	lookWarn
+	lookStale
+	lookNewListener
+	lookMarked
+)
+
+// rowFields is everything a rendered table row depends on. Two rows with
+// equal rowFields render to the same string, so it doubles as the cache key.
+type rowFields struct {
+	look           rowLook
+	pid            int
+	origin         tracker.Origin
+	app            string
+	isNew          bool
+	ping           time.Duration
+	down           string
+	correction     tracker.PingCorrection
+	tierSuffix     string
+	probed         bool
+	noProbe        tracker.AddrClass
+	loss           float64
+	arrow          string
+	score          int
+	hasScore       bool
+	direction      tracker.Direction
+	protocol       string
+	encryption     tracker.Encryption
+	local, remote  string
+	localPort      int
+	remotePort     int
+	compact        bool
+	anon           bool
+	state          tracker.ConnState
+	stateAge       string
+	halfOpen       bool
+	tx, rx         float64
+	hasBytes       bool
+	sendQ, recvQ   uint64
+	hasQueues      bool
+	sendQHigh      bool
+	share          float64
+	hasShare       bool
+	stall          string
+	host           string
+	layout         tableLayout
+	width          int
+	qos            tracker.QoS
+	hasQoS         bool
+	cc             string
+	tcpInfoPresent bool
+	auditScore     int
+	derived        string
+	closing        string
+	portShare      *tracker.PortShare
+}
+
+type cachedRow struct {
+	fields rowFields
+	out    string
+}
+
+// rowCache keeps the styled strings of the rows drawn in the previous frame,
+// so rows whose displayed fields did not change skip lipgloss entirely. It is
+// shared by all copies of the Model.
+type rowCache struct {
+	prev map[string]cachedRow
+	next map[string]cachedRow
+}
+
+func newRowCache() *rowCache {
+	return &rowCache{prev: make(map[string]cachedRow)}
+}
+
+// get returns the cached row for key if its fields are unchanged, and keeps
+// it for the next frame either way once put is called.
+func (rc *rowCache) get(key string, f rowFields) (string, bool) {
+	if rc.next == nil {
+		rc.next = make(map[string]cachedRow)
+	}
+	if r, ok := rc.prev[key]; ok && r.fields == f {
+		rc.next[key] = r
+		return r.out, true
+	}
+	return "", false
+}
+
+func (rc *rowCache) put(key string, f rowFields, out string) {
+	rc.next[key] = cachedRow{fields: f, out: out}
+}
+
+// endFrame drops rows that were not drawn in this frame.
+func (rc *rowCache) endFrame() {
+	rc.prev = rc.next
+	if rc.prev == nil {
+		rc.prev = make(map[string]cachedRow)
+	}
+	rc.next = nil
+}
+
+// reset invalidates every cached row (resize, sort or filter change).
+func (rc *rowCache) reset() {
+	rc.prev = make(map[string]cachedRow)
+	rc.next = nil
+}
+
+// rowFieldsOf collects the displayed fields of c for the cache key.
+func (m Model) rowFieldsOf(c *tracker.Connection, look rowLook, l tableLayout, width int) rowFields {
+	f := rowFields{
+		look:           look,
+		pid:            c.PID,
+		origin:         c.Origin,
+		app:            c.AppName,
+		isNew:          c.IsNewRemote(time.Now()),
+		ping:           c.Ping,
+		correction:     c.PingCorrection,
+		probed:         c.PingCount > 0,
+		noProbe:        c.NoProbe,
+		loss:           c.Loss,
+		arrow:          c.LossTrend.Arrow(),
+		score:          c.Score,
+		hasScore:       c.HasScore,
+		direction:      c.Direction,
+		protocol:       c.ProtocolHint(),
+		encryption:     c.Encryption,
+		local:          c.LocalAddr,
+		remote:         c.RemoteAddr,
+		localPort:      c.LocalPort,
+		remotePort:     c.RemotePort,
+		compact:        m.compactPort,
+		anon:           m.anon != nil,
+		state:          c.State,
+		tx:             c.TxRate,
+		rx:             c.RxRate,
+		hasBytes:       c.HasByteCounts,
+		sendQ:          c.SendQ,
+		recvQ:          c.RecvQ,
+		hasQueues:      c.HasQueues,
+		sendQHigh:      c.SendQHigh > 0,
+		host:           c.Host,
+		layout:         l,
+		width:          width,
+		tcpInfoPresent: c.TCPInfo != nil,
+		auditScore:     c.Audit.Score,
+		derived:        derivedKey(c, l),
+		portShare:      c.PortShare,
+	}
+	if c.Host == "" && c.PingTier != tracker.TierFocused && c.State == tracker.StateEstablished && c.NoProbe == tracker.AddrProbeable {
+		f.tierSuffix = fmtDur(m.tracker.ProbeInterval(c.PingTier))
+	}
+	if d := c.UnreachableFor(time.Now()); d > 0 {
+		f.down = downAge(d)
+	}
+	if c.Stuck {
+		f.stateAge = stateAge(c)
+	}
+	f.halfOpen = c.HalfOpen
+	if c.Closing != nil {
+		f.closing = m.closingLabel(c) + "\x00" + m.closingText(c)
+	}
+	if l.share > 0 {
+		f.share, f.hasShare = m.shares[c.Key()]
+	}
+	if l.stall > 0 && !c.StallSince.IsZero() {
+		f.stall = c.StallReason + fmtDur(c.StallDuration())
+	}
+	if l.qos > 0 && c.QoS != nil {
+		f.qos, f.hasQoS = *c.QoS, true
+	}
+	if l.cc > 0 {
+		f.cc = c.CongestionAlgo
+	}
+	return f
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestRowCacheFrames(t *testing.T) {
+	rc := newRowCache()
+	a, b := rowFields{app: "a"}, rowFields{app: "b"}
+	if _, ok := rc.get("k", a); ok {
+		t.Fatal("hit in an empty cache")
+	}
+	rc.put("k", a, "row a")
+	rc.endFrame()
+	if out, ok := rc.get("k", a); !ok || out != "row a" {
+		t.Fatalf("got %q %v, want the cached row", out, ok)
+	}
+	if _, ok := rc.get("k", b); ok {
+		t.Fatal("hit after a displayed field changed")
+	}
+	rc.endFrame()
+
+	// The row was looked up, so it survives the frame; a row that is not
+	// drawn in a frame is gone after it.
+	if _, ok := rc.get("k", a); !ok {
+		t.Fatal("row drawn last frame was dropped")
+	}
+	rc.endFrame()
+	rc.endFrame()
+	if _, ok := rc.get("k", a); ok {
+		t.Fatal("row not drawn last frame still cached")
+	}
+
+	rc.put("k", a, "row a")
+	rc.endFrame()
+	rc.reset()
+	if _, ok := rc.get("k", a); ok {
+		t.Fatal("hit after reset")
+	}
+}
+
+// cacheModel is a wide model showing conns directly, without a tracker scan.
+func cacheModel(conns []*tracker.Connection) Model {
+	m := newTestModel()
+	m.width, m.height = 200, len(conns)+10
+	m.connections = conns
+	return m
+}
+
+func (m Model) drawRows() []string {
+	return m.renderTable(tableView{
+		conns: m.connections, layout: m.tableLayout(),
+		cursor: -1, height: len(m.connections), width: m.width,
+	})[1:]
+}
+
+// poison replaces every cached row, so a row served from the cache shows
+// up as "cached" in the next frame.
+func (rc *rowCache) poison() {
+	for k, r := range rc.prev {
+		r.out = "cached"
+		rc.prev[k] = r
+	}
+}
+
+func TestRowCacheInvalidation(t *testing.T) {
+	c := testConn("curl", 100, "192.0.2.1", 443)
+	c.Ping = 20 * time.Millisecond
+	conns := []*tracker.Connection{&c}
+
+	tests := []struct {
+		name   string
+		change func(c *tracker.Connection, m *Model)
+		cached bool
+	}{
+		{"nothing", func(*tracker.Connection, *Model) {}, true},
+		{"undisplayed field", func(c *tracker.Connection, _ *Model) { c.LastUpdated = time.Now() }, true},
+		{"ping", func(c *tracker.Connection, _ *Model) { c.Ping = 300 * time.Millisecond }, false},
+		{"loss", func(c *tracker.Connection, _ *Model) { c.Loss = 50 }, false},
+		{"state", func(c *tracker.Connection, _ *Model) { c.State = tracker.StateCloseWait }, false},
+		{"app", func(c *tracker.Connection, _ *Model) { c.AppName = "wget" }, false},
+		{"tx rate", func(c *tracker.Connection, _ *Model) { c.TxRate, c.HasByteCounts = 4096, true }, false},
+		{"width", func(_ *tracker.Connection, m *Model) { m.width = 150 }, false},
+		{"anonymize", func(_ *tracker.Connection, m *Model) { m.anon = newAnonymizer() }, false},
+	}
+	for _, tt := range tests {
+		cp := c
+		conns[0] = &cp
+		m := cacheModel(conns)
+		m.drawRows()
+		m.rows.poison()
+		tt.change(&cp, &m)
+		got := m.drawRows()[0]
+		if cached := got == "cached"; cached != tt.cached {
+			t.Errorf("%s: served from cache %v, want %v", tt.name, cached, tt.cached)
+		}
+	}
+}
+
+func TestRowCacheResetByUpdate(t *testing.T) {
+	m := newTestModelWith(t, testConn("curl", 100, "192.0.2.1", 443))
+	m.width, m.height = 200, 30
+	for _, msg := range []tea.Msg{
+		tea.WindowSizeMsg{Width: 200, Height: 30},
+		keyMsg("c"),
+	} {
+		m.drawRows()
+		m.rows.poison()
+		next, _ := m.Update(msg)
+		m = next.(Model)
+		if got := m.drawRows()[0]; got == "cached" {
+			t.Errorf("%T %v: stale row drawn", msg, msg)
+		}
+	}
+
+	m.drawRows()
+	m.rows.poison()
+	m.toggleSort(SortPing)
+	if got := m.drawRows()[0]; got == "cached" {
+		t.Error("sort change: stale row drawn")
+	}
+}
+
+func benchConns(n int) []*tracker.Connection {
+	conns := make([]*tracker.Connection, n)
+	for i := range conns {
+		c := testConn(fmt.Sprintf("app%d", i%40), 1000+i, fmt.Sprintf("192.0.2.%d", i%250), 1+i%1000)
+		c.Ping = time.Duration(i) * time.Millisecond
+		conns[i] = &c
+	}
+	return conns
+}
+
+// BenchmarkRenderTableCold styles all 1000 rows every frame, as before the
+// row cache.
+func BenchmarkRenderTableCold(b *testing.B) {
+	m := cacheModel(benchConns(1000))
+	for b.Loop() {
+		m.rows.reset()
+		m.drawRows()
+	}
+}
+
+// BenchmarkRenderTableCached redraws 1000 unchanged rows from the cache.
+func BenchmarkRenderTableCached(b *testing.B) {
+	m := cacheModel(benchConns(1000))
+	m.drawRows()
+	for b.Loop() {
+		m.drawRows()
+	}
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"strings"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SetSandbox shows a banner saying what the sandbox the tracker runs in
+// keeps from view, with L for the reasons and fixes.
+func (m *Model) SetSandbox(s tracker.Sandbox) {
+	m.sandbox = s
+}
+
+// sandboxBanner is the one-line banner of a restricted sandbox; ""
+// outside one.
+func (m Model) sandboxBanner() string {
+	if !m.sandbox.Restricted() || len(m.sandbox.Limits) == 0 {
+		return ""
+	}
+	return m.sandbox.Summary() + " (L: why and how to fix)"
+}
+
+// sandboxMode is the L screen listing each limitation of the sandbox.
+type sandboxMode struct{}
+
+func (sm *sandboxMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	if msg.String() == "L" {
+		m.cancelMode(sm)
+	}
+	return m, nil, true
+}
+
+func (sm *sandboxMode) cancel(m *Model) {}
+
+func (sm *sandboxMode) view(m Model) string { return m.renderSandbox() }
+
+// renderSandbox explains each limitation: what is missing, why, and what
+// to change.
+func (m Model) renderSandbox() string {
+	title := "Running in a sandbox"
+	if m.sandbox.Kind != "" {
+		title = "Running in a " + m.sandbox.Kind + " container"
+	}
+	lines := []string{m.st(styleTitle).Render(title), ""}
+	for _, l := range m.sandbox.Limits {
+		lines = append(lines,
+			"  "+m.st(styleWarn).Render("Missing: "+l.Missing),
+			"    Why: "+l.Reason,
+			"    Fix: "+l.Fix,
+			"")
+	}
+	lines = append(lines, m.st(styleStatus).Render("L/Esc: back"))
+	return strings.Join(lines, "\n")
+}
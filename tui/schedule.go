@@ -0,0 +1,70 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// refreshSchedule picks up the schedule window in effect and notes a
+// change of window in the status bar.
+func (m *Model) refreshSchedule() {
+	prev := m.schedule
+	m.schedule = m.tracker.ScheduleStatus()
+	if m.schedule.Active == prev.Active && m.schedule.Window == prev.Window {
+		return
+	}
+	switch {
+	case m.schedule.Active:
+		m.notice = m.scheduleText() + " started"
+	case prev.Active:
+		m.notice = prev.Window.Name + " ended"
+	}
+}
+
+// scheduleText is the status bar note of the window in effect, e.g.
+// "quiet hours until 08:00"; "" outside every window.
+func (m Model) scheduleText() string {
+	if !m.schedule.Active {
+		return ""
+	}
+	return m.schedule.Window.Name + " until " + m.times.untilClock(m.schedule.Until, time.Now())
+}
+
+// silent reports whether the window in effect turns announcements off.
+func (m Model) silent() bool {
+	return m.schedule.Active && m.schedule.Window.Silent
+}
+
+// untilClock formats an upcoming time of day to the minute, with the
+// weekday when it is a day or more away.
+func (f timeFormatter) untilClock(t, now time.Time) string {
+	layout := "15:04"
+	if f.hour12 {
+		layout = "3:04 PM"
+	}
+	if t.Sub(now) >= 24*time.Hour {
+		layout = "Mon " + layout
+	}
+	return t.Format(layout)
+}
+
+// scheduleLog lists the latest schedule transitions for the D view, most
+// recent first; "" before the first one.
+func (m Model) scheduleLog(now time.Time) string {
+	const shown = 6
+	events := m.tracker.ScheduleEvents()
+	if len(events) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := len(events) - 1; i >= 0 && len(parts) < shown; i-- {
+		e := events[i]
+		verb := "ended"
+		if e.Started {
+			verb = "started"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", e.Window, verb, m.times.format(e.Time, now)))
+	}
+	return "  schedule: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sessionVersion is bumped whenever Session changes incompatibly. Files with
+// another version are ignored rather than half-applied.
+const sessionVersion = 1
+
+// Session is the UI state saved on quit and restored on the next start.
+type Session struct {
+	Version       int       `json:"version"`
+	Filter        string    `json:"filter,omitempty"`
+	SortField     SortField `json:"sort_field"`
+	SortAsc       bool      `json:"sort_asc"`
+	GroupSort     SortField `json:"group_sort,omitempty"`
+	GroupSortDesc bool      `json:"group_sort_desc,omitempty"` // desc rather than asc, so older files sort groups as before
+	ShowShare     bool      `json:"show_share,omitempty"`
+	CompactPorts  bool      `json:"compact_ports,omitempty"`
+	AbsoluteTimes bool      `json:"absolute_times,omitempty"`
+	Paused        bool      `json:"paused,omitempty"`
+	Selected      string    `json:"selected,omitempty"` // connection key under the cursor
+}
+
+// Session captures the current UI state.
+func (m Model) Session() Session {
+	s := Session{
+		Version:       sessionVersion,
+		Filter:        m.filter,
+		SortField:     m.sortField,
+		SortAsc:       m.sortAsc,
+		GroupSort:     m.groupSort,
+		GroupSortDesc: !m.groupSortAsc,
+		ShowShare:     m.showShare,
+		CompactPorts:  m.compactPort,
+		AbsoluteTimes: m.times.absolute,
+		Paused:        m.paused,
+	}
+	if m.cursor < len(m.connections) {
+		s.Selected = m.connections[m.cursor].Key()
+	}
+	return s
+}
+
+// RestoreSession applies a saved UI state. The selected connection is looked
+// up on the first refresh; if it no longer exists the cursor stays on the top row.
+func (m *Model) RestoreSession(s Session) {
+	m.filter = s.Filter
+	if s.SortField >= SortApp && s.SortField <= SortScore {
+		m.sortField = s.SortField
+	}
+	m.sortAsc = s.SortAsc
+	if groupSortFields[s.GroupSort] {
+		m.groupSort = s.GroupSort
+	}
+	m.groupSortAsc = !s.GroupSortDesc
+	m.showShare = s.ShowShare
+	m.compactPort = s.CompactPorts
+	m.times.absolute = s.AbsoluteTimes
+	m.paused = s.Paused
+	m.pendingSelect = s.Selected
+}
+
+// LoadSession reads a session file. Files from another version are rejected.
+func LoadSession(path string) (Session, error) {
+	var s Session
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Session{}, err
+	}
+	if s.Version != sessionVersion {
+		return Session{}, fmt.Errorf("session file version %d not supported (want %d)", s.Version, sessionVersion)
+	}
+	return s, nil
+}
+
+// SaveSession writes a session file atomically.
+func SaveSession(path string, s Session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	want := Session{
+		Version:       sessionVersion,
+		Filter:        "firefox state:established",
+		SortField:     SortPing,
+		SortAsc:       false,
+		GroupSort:     SortScore,
+		GroupSortDesc: true,
+		ShowShare:     true,
+		CompactPorts:  true,
+		AbsoluteTimes: true,
+		Paused:        true,
+		Selected:      "42:tcp:10.0.0.2:40443->192.0.2.1:443",
+	}
+	if err := SaveSession(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	// Through a model and back.
+	m := newTestModel()
+	m.RestoreSession(got)
+	back := m.Session()
+	back.Selected = got.Selected // only known once a refresh finds it
+	if back != want {
+		t.Fatalf("model round trip: got %+v\nwant %+v", back, want)
+	}
+}
+
+func TestLoadSessionBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content, err string
+	}{
+		{"corrupt", `{"version":1,"filter":"fire`, "unexpected end"},
+		{"not json", "filter=firefox", "invalid character"},
+		{"newer version", `{"version":99,"filter":"x"}`, "version 99"},
+		{"no version", `{"filter":"x"}`, "version 0"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".json")
+		os.WriteFile(path, []byte(tt.content), 0o600)
+		s, err := LoadSession(path)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+		}
+		if s != (Session{}) {
+			t.Errorf("%s: half-loaded %+v", tt.name, s)
+		}
+	}
+	if _, err := LoadSession(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestLoadSessionPartial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	os.WriteFile(path, []byte(`{"version":1,"filter":"ssh","sort_field":999,"group_sort":-3,"unknown":true}`), 0o600)
+	s, err := LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestModel()
+	m.RestoreSession(s)
+	if m.filter != "ssh" || m.sortField != SortApp || m.groupSort != SortApp || !m.groupSortAsc {
+		t.Fatalf("filter %q, sort %d, group sort %d asc %v", m.filter, m.sortField, m.groupSort, m.groupSortAsc)
+	}
+}
+
+func TestRestoreSelection(t *testing.T) {
+	conns := []tracker.Connection{
+		testConn("a", 1, "192.0.2.1", 443),
+		testConn("b", 2, "192.0.2.2", 443),
+		testConn("c", 3, "192.0.2.3", 443),
+	}
+	m := newTestModelWith(t, conns...)
+	m.RestoreSession(Session{Version: sessionVersion, SortAsc: true, Selected: conns[2].Key()})
+	m.refresh()
+	if m.cursor != 2 {
+		t.Fatalf("cursor %d, want 2", m.cursor)
+	}
+
+	m = newTestModelWith(t, conns...)
+	m.RestoreSession(Session{Version: sessionVersion, SortAsc: true, Selected: "gone"})
+	m.refresh()
+	if m.cursor != 0 || m.pendingSelect != "" {
+		t.Fatalf("cursor %d (pending %q) for a vanished connection", m.cursor, m.pendingSelect)
+	}
+}
@@ -0,0 +1,183 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ping-tracker/snippet"
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// toggleMark marks or unmarks the selected row for F8 and moves down.
+func (m *Model) toggleMark() {
+	if m.listingGroups() || m.cursor >= len(m.connections) {
+		return
+	}
+	c := m.connections[m.cursor]
+	if c.Closing != nil || c.PortShare != nil {
+		return // a summary row stands for several sockets
+	}
+	if m.marked == nil {
+		m.marked = make(map[string]bool)
+	}
+	if key := c.Key(); m.marked[key] {
+		delete(m.marked, key)
+	} else {
+		m.marked[key] = true
+	}
+	if m.cursor < m.rowCount()-1 {
+		m.cursor++
+		if m.cursor >= m.offset+m.visibleRows() {
+			m.offset = m.cursor - m.visibleRows() + 1
+		}
+	}
+}
+
+// pruneMarks forgets the marks of connections that closed.
+func (m *Model) pruneMarks(all []*tracker.Connection) {
+	if len(m.marked) == 0 {
+		return
+	}
+	open := make(map[string]bool, len(all))
+	for _, c := range all {
+		open[c.Key()] = true
+	}
+	for key := range m.marked {
+		if !open[key] {
+			delete(m.marked, key)
+		}
+	}
+}
+
+// openSnippet opens the F8 overlay for the marked rows, filtered out or
+// not, or else the selected one.
+func (m Model) openSnippet() (tea.Model, tea.Cmd) {
+	if m.anon != nil {
+		m.notice = "Snippets show real addresses: turn off anonymizing (F9) first"
+		return m, nil
+	}
+	var conns []*tracker.Connection
+	for _, c := range m.deltaPrev {
+		if m.marked[c.Key()] {
+			conns = append(conns, c)
+		}
+	}
+	if len(conns) == 0 && !m.listingGroups() && m.cursor < len(m.connections) {
+		conns = []*tracker.Connection{m.connections[m.cursor]}
+	}
+	conns = cloneConns(conns) // the overlay outlives the snapshot buffer
+	if len(conns) == 0 {
+		return m, nil
+	}
+	sm := &snippetMode{conns: conns}
+	sm.generate()
+	m.pushMode(sm)
+	return m, nil
+}
+
+// snippetMode is the F8 overlay: a capture filter or firewall rules for
+// the connections it was opened on, shown as plain text to copy.
+type snippetMode struct {
+	conns  []*tracker.Connection
+	target int // index into snippet.Targets
+	text   string
+	err    error
+	saved  string // the file saved to, or why saving failed
+	offset int    // first line shown
+}
+
+func (sm *snippetMode) generate() {
+	sm.text, sm.err = snippet.Generate(snippet.Targets()[sm.target], sm.conns)
+	sm.saved, sm.offset = "", 0
+}
+
+func (sm *snippetMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	n := len(snippet.Targets())
+	switch k := msg.String(); k {
+	case "f8":
+		m.cancelMode(sm)
+	case "tab", "right", "l":
+		sm.target = (sm.target + 1) % n
+		sm.generate()
+	case "shift+tab", "left", "h":
+		sm.target = (sm.target + n - 1) % n
+		sm.generate()
+	case "1", "2", "3", "4":
+		sm.target = int(k[0] - '1')
+		sm.generate()
+	case "up", "k":
+		sm.offset = max(0, sm.offset-1)
+	case "down", "j":
+		sm.offset++
+	case "s":
+		if sm.err == nil {
+			var path string
+			sm.saved, path = saveSnippet(snippet.Targets()[sm.target], sm.text)
+			m.noteWritten(path)
+		}
+	}
+	return m, nil, true
+}
+
+func (sm *snippetMode) cancel(m *Model) {}
+
+func (sm *snippetMode) view(m Model) string { return m.renderSnippet(sm) }
+
+// saveSnippet writes text to snippet-<target>-<timestamp>.txt in the
+// working directory. It says where it went, and returns the file's name,
+// or "" when saving failed.
+func saveSnippet(target snippet.Target, text string) (string, string) {
+	name := "snippet-" + string(target) + "-" + time.Now().Format("20060102-150405") + ".txt"
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Sprintf("Save failed: %v", err), ""
+	}
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Sprintf("Save failed: %v", err), ""
+	}
+	return "Saved to " + name, name
+}
+
+// renderSnippet draws the F8 overlay. The snippet itself is unstyled and
+// uncut, so selecting it in the terminal copies it as it is.
+func (m Model) renderSnippet(sm *snippetMode) string {
+	target := snippet.Targets()[sm.target]
+	var tabs []string
+	for i, t := range snippet.Targets() {
+		label := fmt.Sprintf("%d %s", i+1, t)
+		if i == sm.target {
+			label = m.st(styleSelection).Render(label)
+		}
+		tabs = append(tabs, label)
+	}
+	head := []string{
+		m.st(styleTitle).Render(truncate(fmt.Sprintf("%s for %d connection%s", target.Describe(), len(sm.conns), plural(len(sm.conns))), m.width-1)),
+		" " + strings.Join(tabs, "  "),
+		m.st(styleStale).Render(truncate(" Nothing is run: copy it from here or save it with s", m.width)),
+		"",
+	}
+	var body []string
+	if sm.err != nil {
+		body = []string{" " + sm.err.Error()}
+	} else {
+		body = strings.Split(strings.TrimSuffix(sm.text, "\n"), "\n")
+	}
+	rows := max(1, m.height-len(head)-3)
+	start := min(sm.offset, max(0, len(body)-rows))
+	lines := append(head, body[start:min(start+rows, len(body))]...)
+	for i := len(lines); i < m.height-2; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, sm.saved)
+	help := "Tab/1-4: target  j/k: scroll  s: save  F8/Esc: close"
+	lines = append(lines, m.st(styleStatus).Render(help))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSnippetOverlay(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m := newTestModelWith(t,
+		testConn("a", 100, "198.51.100.10", 443), testConn("b", 200, "198.51.100.20", 443), testConn("c", 300, "192.0.2.1", 22))
+	m.width, m.height = 160, 30
+
+	// Nothing marked: the selected row.
+	m, _ = press(t, m, "f8")
+	sm, _ := findMode[*snippetMode](m)
+	if sm == nil || len(sm.conns) != 1 || sm.conns[0].AppName != "a" {
+		t.Fatalf("overlay on %v", sm)
+	}
+	if v := m.View(); !strings.Contains(v, "tcp and host 10.0.0.2 and port 40443 and host 198.51.100.10 and port 443") {
+		t.Errorf("view:\n%s", v)
+	}
+	m, _ = press(t, m, "f8")
+
+	// Two marked rows: the marks, coalesced into one prefix.
+	m, _ = press(t, m, " ", " ", "f8")
+	sm, _ = findMode[*snippetMode](m)
+	if sm == nil || len(sm.conns) != 2 {
+		t.Fatalf("overlay on %v", sm)
+	}
+	if !strings.Contains(sm.text, "net 198.51.100.0/27") {
+		t.Errorf("tcpdump %q", sm.text)
+	}
+	m, _ = press(t, m, "tab", "tab")
+	if !strings.HasPrefix(sm.text, "iptables -A OUTPUT -p tcp -d 198.51.100.0/27 --dport 443 -j DROP") {
+		t.Errorf("iptables %q", sm.text)
+	}
+	m, _ = press(t, m, "4")
+	if !strings.Contains(sm.text, "netsh advfirewall") {
+		t.Errorf("netsh %q", sm.text)
+	}
+
+	m, _ = press(t, m, "s")
+	if !strings.HasPrefix(sm.saved, "Saved to snippet-netsh-") {
+		t.Fatalf("saved %q", sm.saved)
+	}
+	name := strings.TrimPrefix(sm.saved, "Saved to ")
+	if data, err := os.ReadFile(name); err != nil || string(data) != sm.text {
+		t.Errorf("file %q: %v", data, err)
+	}
+	if w := m.WrittenFiles(); len(w) != 1 || w[0] != name {
+		t.Errorf("written %v", w)
+	}
+	m, _ = press(t, m, "esc")
+	if _, ok := findMode[*snippetMode](m); ok {
+		t.Error("Esc did not close the overlay")
+	}
+}
+
+func TestSnippetRefusedAnonymized(t *testing.T) {
+	m := newTestModelWith(t, testConn("a", 100, "198.51.100.10", 443))
+	m, _ = press(t, m, "f9", "f8")
+	if _, ok := findMode[*snippetMode](m); ok || !strings.Contains(m.notice, "turn off anonymizing") {
+		t.Errorf("opened while anonymizing; notice %q", m.notice)
+	}
+}
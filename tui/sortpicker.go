@@ -0,0 +1,250 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sortKey is one order the table can be sorted by: a field, and for
+// SortDerived the index of the derived column.
+type sortKey struct {
+	field   SortField
+	derived int
+}
+
+// sortLevel is a sort key with its direction.
+type sortLevel struct {
+	key sortKey
+	asc bool
+}
+
+// sortKeyName is the name of k in the status bar and the picker.
+func (m Model) sortKeyName(k sortKey) string {
+	if k.field != SortDerived {
+		return tr(sortKeys[k.field])
+	}
+	if k.derived < len(m.derived) {
+		return m.derived[k.derived].Name
+	}
+	return "derived"
+}
+
+// sortableKeys are the keys of the columns shown, in column order: the
+// group table's while it lists groups, the connection table's otherwise.
+func (m Model) sortableKeys() []sortKey {
+	cols := m.tableLayout().columns()
+	if m.listingGroups() {
+		cols = m.groupColumns()
+	}
+	var keys []sortKey
+	for _, col := range cols {
+		keys = append(keys, col.sorts...)
+	}
+	return keys
+}
+
+// fixSort falls back when a column sorted by in the picker is hidden: the
+// sort field to ping ascending, the secondary key to none. The hotkey
+// fields always have their column, or none at all, and derived columns
+// are handled by refreshDerived.
+func (m *Model) fixSort() {
+	if m.sortField <= SortDerived && (m.sortThen == nil || m.sortThen.key.field <= SortDerived) {
+		return
+	}
+	keys := m.sortableKeys()
+	if m.sortField > SortDerived && !slices.Contains(keys, sortKey{field: m.sortField}) {
+		m.sortField, m.sortAsc = SortPing, true
+	}
+	if m.sortThen != nil && m.sortThen.key.field > SortDerived && !slices.Contains(keys, m.sortThen.key) {
+		m.sortThen = nil
+	}
+}
+
+// sortPickerMode is the F4 picker: every column shown, to sort by and
+// then by. Enter sorts by the entry under the cursor, ascending, or flips
+// its direction when it already sorts; the table follows each change. F4
+// closes the picker keeping the sort, Esc puts back the sort it opened on.
+// Over the group list it sets the group sort, which has no "then by".
+type sortPickerMode struct {
+	groups bool // opened over the group list
+	then   bool // the cursor is in the "then by" list
+	cursor int
+
+	// The sort the picker opened on
+	field        SortField
+	derived      int
+	asc          bool
+	sortThen     *sortLevel
+	groupSort    SortField
+	groupSortAsc bool
+}
+
+// openSortPicker opens the picker with the cursor on the current sort.
+func (m *Model) openSortPicker() {
+	p := &sortPickerMode{groups: m.listingGroups(), field: m.sortField, derived: m.sortDerived, asc: m.sortAsc, sortThen: m.sortThen,
+		groupSort: m.groupSort, groupSortAsc: m.groupSortAsc}
+	p.cursor = p.current(*m)
+	m.pushMode(p)
+}
+
+// primary is the key the "sort by" list sorts by now.
+func (p *sortPickerMode) primary(m Model) sortKey {
+	if p.groups {
+		return sortKey{field: m.groupSort}
+	}
+	return sortKey{field: m.sortField, derived: m.sortDerived}
+}
+
+// primaryAsc reports whether the "sort by" list sorts ascending.
+func (p *sortPickerMode) primaryAsc(m Model) bool {
+	if p.groups {
+		return m.groupSortAsc
+	}
+	return m.sortAsc
+}
+
+// keyName is the name of k in the picker; groups sort by their key where
+// rows sort by app.
+func (p *sortPickerMode) keyName(m Model, k sortKey) string {
+	if p.groups && k.field == SortApp {
+		return tr("sort.group_key")
+	}
+	return m.sortKeyName(k)
+}
+
+// entries lists the keys of the section the cursor is in; the "then by"
+// list starts with none.
+func (p *sortPickerMode) entries(m Model) []*sortKey {
+	var out []*sortKey
+	if p.then {
+		out = append(out, nil)
+	}
+	for _, k := range m.sortableKeys() {
+		out = append(out, &k)
+	}
+	return out
+}
+
+// current is the index of the entry the section sorts by now.
+func (p *sortPickerMode) current(m Model) int {
+	for i, k := range p.entries(m) {
+		switch {
+		case !p.then && *k == p.primary(m):
+			return i
+		case p.then && k == nil && m.sortThen == nil,
+			p.then && k != nil && m.sortThen != nil && *k == m.sortThen.key:
+			return i
+		}
+	}
+	return 0
+}
+
+func (p *sortPickerMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	entries := p.entries(m)
+	p.cursor = min(p.cursor, len(entries)-1)
+	switch msg.String() {
+	case "f4":
+		m.endMode(p)
+	case "j", "down":
+		p.cursor = min(p.cursor+1, len(entries)-1)
+	case "k", "up":
+		p.cursor = max(p.cursor-1, 0)
+	case "tab", "shift+tab":
+		if !p.groups {
+			p.then = !p.then
+			p.cursor = p.current(m)
+		}
+	case "enter":
+		k := entries[p.cursor]
+		if p.groups {
+			m.toggleGroupSort(k.field)
+			break
+		}
+		switch {
+		case p.then && k == nil:
+			m.sortThen = nil
+		case p.then && m.sortThen != nil && m.sortThen.key == *k:
+			m.sortThen = &sortLevel{key: *k, asc: !m.sortThen.asc}
+		case p.then:
+			m.sortThen = &sortLevel{key: *k, asc: true}
+		case m.sortField == k.field && m.sortDerived == k.derived:
+			m.sortAsc = !m.sortAsc
+		default:
+			m.sortField, m.sortDerived, m.sortAsc = k.field, k.derived, true
+		}
+		if m.sortThen != nil && m.sortThen.key == (sortKey{field: m.sortField, derived: m.sortDerived}) {
+			m.sortThen = nil
+		}
+		m.sortConnections()
+		m.sortGroups()
+		m.rows.reset()
+	}
+	return m, nil, true
+}
+
+func (p *sortPickerMode) cancel(m *Model) {
+	m.sortField, m.sortDerived, m.sortAsc, m.sortThen = p.field, p.derived, p.asc, p.sortThen
+	m.groupSort, m.groupSortAsc = p.groupSort, p.groupSortAsc
+	m.sortConnections()
+	m.sortGroups()
+	m.rows.reset()
+}
+
+func (p *sortPickerMode) view(m Model) string { return m.renderSortPicker(p) }
+
+// renderSortPicker draws the picker: the sort in effect, then the list of
+// the section the cursor is in, scrolled to keep the cursor shown.
+func (m Model) renderSortPicker(p *sortPickerMode) string {
+	dir := func(asc bool) string {
+		if asc {
+			return "▲"
+		}
+		return "▼"
+	}
+	primary := p.keyName(m, p.primary(m)) + " " + dir(p.primaryAsc(m))
+	then := "none"
+	if m.sortThen != nil {
+		then = m.sortKeyName(m.sortThen.key) + " " + dir(m.sortThen.asc)
+	}
+	sortTab, thenTab := m.st(styleHeader).Render("[Sort by: "+primary+"]"), "   Then by: "+then
+	switch {
+	case p.groups:
+		sortTab, thenTab = m.st(styleHeader).Render("[Sort groups by: "+primary+"]"), ""
+	case p.then:
+		sortTab, thenTab = "Sort by: "+primary, "   "+m.st(styleHeader).Render("[Then by: "+then+"]")
+	}
+	lines := []string{m.st(styleTitle).Render("Sort"), "", " " + sortTab + thenTab, ""}
+
+	entries := p.entries(m)
+	cur := p.current(m)
+	room := max(1, m.height-len(lines)-2)
+	first := min(max(0, p.cursor-room/2), max(0, len(entries)-room))
+	for i := first; i < min(len(entries), first+room); i++ {
+		name, mark := "none", "  "
+		if k := entries[i]; k != nil {
+			name = p.keyName(m, *k)
+		}
+		if i == cur {
+			mark = dir(p.primaryAsc(m)) + " "
+			if p.then {
+				mark = "• "
+				if m.sortThen != nil {
+					mark = dir(m.sortThen.asc) + " "
+				}
+			}
+		}
+		line := "  " + mark + padRight(name, 24)
+		if i == p.cursor {
+			line = m.st(styleSearch).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	hint := "j/k: move  Enter: sort by, again to reverse  Tab: sort by / then by  F4: done  Esc: undo"
+	if p.groups {
+		hint = "j/k: move  Enter: sort by, again to reverse  F4: done  Esc: undo"
+	}
+	lines = append(lines, "", m.st(styleStatus).Render(hint))
+	return strings.Join(lines, "\n")
+}
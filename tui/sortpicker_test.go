@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"ping-tracker/tracker"
+)
+
+// pickerTo moves the open picker's cursor to the entry named name.
+func pickerTo(t *testing.T, m Model, name string) Model {
+	t.Helper()
+	p, ok := findMode[*sortPickerMode](m)
+	if !ok {
+		t.Fatal("no sort picker")
+	}
+	var names []string
+	for _, k := range p.entries(m) {
+		n := "none"
+		if k != nil {
+			n = p.keyName(m, *k)
+		}
+		names = append(names, n)
+	}
+	i := slices.Index(names, name)
+	if i < 0 {
+		t.Fatalf("no %q in the picker: %q", name, names)
+	}
+	for p.cursor < i {
+		m, _ = press(t, m, "j")
+	}
+	for p.cursor > i {
+		m, _ = press(t, m, "k")
+	}
+	return m
+}
+
+func pickerModel(t *testing.T) Model {
+	t.Helper()
+	a, b, c := testConn("b", 2, "198.51.100.1", 443), testConn("a", 1, "198.51.100.2", 80), testConn("a", 3, "198.51.100.3", 22)
+	a.Protocol = "udp"
+	m := newTestModelWith(t, a, b, c)
+	m.width, m.height = 200, 40
+	return m
+}
+
+func pids(m Model) []int {
+	var out []int
+	for _, c := range m.connections {
+		out = append(out, c.PID)
+	}
+	return out
+}
+
+func TestSortPicker(t *testing.T) {
+	m := pickerModel(t)
+	m, _ = press(t, m, "f4")
+	if v := m.View(); !strings.Contains(v, "[Sort by: App ▲]") || !strings.Contains(v, "Then by: none") {
+		t.Fatalf("picker view:\n%s", v)
+	}
+
+	// A column without a hotkey, then reversed.
+	m = pickerTo(t, m, "PID")
+	m, _ = press(t, m, "enter")
+	if m.sortField != SortPID || !m.sortAsc || !slices.Equal(pids(m), []int{1, 2, 3}) {
+		t.Errorf("by PID: %v asc=%v %v", m.sortField, m.sortAsc, pids(m))
+	}
+	m, _ = press(t, m, "enter")
+	if m.sortField != SortPID || m.sortAsc || !slices.Equal(pids(m), []int{3, 2, 1}) {
+		t.Errorf("by PID reversed: asc=%v %v", m.sortAsc, pids(m))
+	}
+
+	// App, then by remote descending for the two "a" rows.
+	m = pickerTo(t, m, "App")
+	m, _ = press(t, m, "enter", "tab")
+	m = pickerTo(t, m, "Remote")
+	m, _ = press(t, m, "enter", "enter")
+	want := sortLevel{key: sortKey{field: SortRemote}, asc: false}
+	if m.sortField != SortApp || m.sortThen == nil || *m.sortThen != want {
+		t.Fatalf("by app then remote: %v %+v", m.sortField, m.sortThen)
+	}
+	if !slices.Equal(pids(m), []int{3, 1, 2}) {
+		t.Errorf("rows %v", pids(m))
+	}
+	// A secondary key equal to the primary one is dropped.
+	m = pickerTo(t, m, "App")
+	m, _ = press(t, m, "enter")
+	if m.sortThen != nil {
+		t.Errorf("then by the sort key: %+v", m.sortThen)
+	}
+	m = pickerTo(t, m, "none")
+	m, _ = press(t, m, "enter", "f4")
+	if _, ok := findMode[*sortPickerMode](m); ok {
+		t.Fatal("F4 did not close the picker")
+	}
+	if m.sortField != SortApp || m.sortThen != nil {
+		t.Errorf("kept %v %+v", m.sortField, m.sortThen)
+	}
+}
+
+func TestSortPickerEscRestores(t *testing.T) {
+	m := pickerModel(t)
+	m, _ = press(t, m, "4", "4") // TX descending
+	m, _ = press(t, m, "f4")
+	m = pickerTo(t, m, "Proto")
+	m, _ = press(t, m, "enter", "tab")
+	m = pickerTo(t, m, "PID")
+	m, _ = press(t, m, "enter")
+	if m.sortField != SortProto || m.sortThen == nil {
+		t.Fatalf("picked %v %+v", m.sortField, m.sortThen)
+	}
+	m, _ = press(t, m, "esc")
+	if m.sortField != SortTxRate || m.sortAsc || m.sortThen != nil {
+		t.Errorf("after Esc: %v asc=%v %+v", m.sortField, m.sortAsc, m.sortThen)
+	}
+}
+
+// TestSortPickerHiddenColumn checks the fallback when a column sorted by
+// is hidden: ping ascending for the sort, none for the secondary key.
+func TestSortPickerHiddenColumn(t *testing.T) {
+	m := pickerModel(t)
+	m, _ = press(t, m, "s", "f4") // the Share column
+	m = pickerTo(t, m, "Share")
+	m, _ = press(t, m, "enter", "f4")
+	if m.sortField != SortShare {
+		t.Fatalf("by %v", m.sortField)
+	}
+	m, _ = press(t, m, "s")
+	m.refresh()
+	if m.sortField != SortPing || !m.sortAsc {
+		t.Errorf("hidden sort column: %v asc=%v", m.sortField, m.sortAsc)
+	}
+
+	m, _ = press(t, m, "s", "f4", "tab")
+	m = pickerTo(t, m, "Share")
+	m, _ = press(t, m, "enter", "f4", "s")
+	m.refresh()
+	if m.sortThen != nil || m.sortField != SortPing {
+		t.Errorf("hidden secondary column: %v %+v", m.sortField, m.sortThen)
+	}
+	// The picker opens on a spec it can show.
+	m, _ = press(t, m, "f4")
+	if v := m.View(); !strings.Contains(v, "[Sort by: Ping ▲]") {
+		t.Errorf("picker view:\n%s", v)
+	}
+}
+
+// TestSortPickerGroups checks that over the group list the picker lists
+// the group table's columns, socket memory included where reported.
+func TestSortPickerGroups(t *testing.T) {
+	big, small := testConn("big", 1, "198.51.100.1", 443), testConn("small", 2, "198.51.100.2", 443)
+	big.SockMem, big.SockMemInfo = 1<<20, &tracker.SockMemInfo{}
+	small.SockMem, small.SockMemInfo = 4096, &tracker.SockMemInfo{}
+	m := newTestModelWith(t, big, small)
+	m.width, m.height = 200, 40
+	m, _ = press(t, m, "b", "f4")
+	p, _ := findMode[*sortPickerMode](m)
+	var names []string
+	for _, k := range p.entries(m) {
+		names = append(names, p.keyName(m, *k))
+	}
+	if got := strings.Join(names, ","); got != "Key,Ping,Health score,TX,RX,Sock mem" {
+		t.Errorf("group entries %s", got)
+	}
+	if v := m.View(); !strings.Contains(v, "[Sort groups by: Key ▲]") || strings.Contains(v, "Then by") {
+		t.Errorf("picker view:\n%s", v)
+	}
+
+	m = pickerTo(t, m, "Sock mem")
+	m, _ = press(t, m, "enter", "enter", "tab")
+	if m.groupSort != SortSockMem || m.groupSortAsc || m.groups[0].Key != "big" {
+		t.Errorf("by socket memory: %v asc=%v first %s", m.groupSort, m.groupSortAsc, m.groups[0].Key)
+	}
+	if p.then {
+		t.Error("Tab opened a then-by list for groups")
+	}
+	m, _ = press(t, m, "esc")
+	if m.groupSort != SortApp || !m.groupSortAsc || m.groups[0].Key != "big" {
+		t.Errorf("after Esc: %v asc=%v", m.groupSort, m.groupSortAsc)
+	}
+}
@@ -0,0 +1,106 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+// Verbosity levels for accessible mode: each level includes the ones below.
+const (
+	VerbosityConnections = 1 // new and closed connections
+	VerbosityStates      = 2 // + state changes
+	VerbosityPing        = 3 // + significant ping changes
+)
+
+// speakChange turns a change into a sentence, or "" if the verbosity level
+// excludes it.
+func speakChange(ch tracker.Change, verbosity int) string {
+	c := ch.Conn
+	switch ch.Kind {
+	case tracker.ChangeNew:
+		return fmt.Sprintf("new connection: %s to %s", c.AppName, speakRemote(c))
+	case tracker.ChangeClosed:
+		return fmt.Sprintf("closed: %s to %s", c.AppName, speakRemote(c))
+	case tracker.ChangeState:
+		if verbosity < VerbosityStates {
+			return ""
+		}
+		return fmt.Sprintf("%s to %s is now %s", c.AppName, speakRemote(c), speakState(c.State))
+	case tracker.ChangePing:
+		if verbosity < VerbosityPing {
+			return ""
+		}
+		verb := "increased"
+		if c.Ping < ch.OldPing {
+			verb = "decreased"
+		}
+		return fmt.Sprintf("%s to %s ping %s to %s", c.AppName, speakRemote(c), verb, speakDuration(c.Ping))
+	}
+	return ""
+}
+
+// speakConnection describes a single connection as a sentence.
+func speakConnection(c *tracker.Connection) string {
+	if c.Closing != nil {
+		return speakClosing(c)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, process %d, %s %s to %s, %s", c.AppName, c.PID,
+		speakDirection(c.Direction), c.DisplayProtocol(), speakRemote(c), speakState(c.State))
+	if c.Ping > 0 {
+		fmt.Fprintf(&b, ", ping %s", speakDuration(c.Ping))
+	}
+	if c.PingCount > 0 {
+		fmt.Fprintf(&b, ", loss %.0f percent", c.Loss)
+	}
+	fmt.Fprintf(&b, ", sending %s, receiving %s", tracker.FormatBytes(c.TxRate), tracker.FormatBytes(c.RxRate))
+	return b.String()
+}
+
+// speakClosing reads a summary row of closing-state sockets.
+func speakClosing(c *tracker.Connection) string {
+	s := c.Closing
+	who := c.AppName
+	if s.By == tracker.ClosingByPort {
+		who = fmt.Sprintf("local port %d", c.LocalPort)
+	}
+	line := fmt.Sprintf("%s, %d closing sockets, mostly %s", who, s.Count, speakState(c.State))
+	if s.HasRate {
+		line += fmt.Sprintf(", %.0f new per minute", s.PerMinute)
+	}
+	return line
+}
+
+// speakSummary is the first announcement after startup.
+func speakSummary(conns []*tracker.Connection) string {
+	return fmt.Sprintf("tracking %d connections. j and k read connections, q quits.", len(conns))
+}
+
+func speakRemote(c *tracker.Connection) string {
+	if c.RemotePort == 0 {
+		return fmt.Sprintf("%s, local port %d", c.RemoteAddr, c.LocalPort)
+	}
+	return fmt.Sprintf("%s port %d", c.RemoteAddr, c.RemotePort)
+}
+
+func speakDirection(d tracker.Direction) string {
+	if d == tracker.Inbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+func speakState(s tracker.ConnState) string {
+	return strings.ToLower(strings.ReplaceAll(string(s), "_", " "))
+}
+
+func speakDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms == 1 {
+		return "1 millisecond"
+	}
+	return fmt.Sprintf("%d milliseconds", ms)
+}
@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func speechConn(app string, port int, state tracker.ConnState, ping time.Duration) *tracker.Connection {
+	return &tracker.Connection{
+		AppName: app, PID: 100, Protocol: "tcp", Direction: tracker.Outbound,
+		LocalAddr: "10.0.0.2", LocalPort: 50000,
+		RemoteAddr: "192.0.2.1", RemotePort: port,
+		State: state, Ping: ping,
+	}
+}
+
+func TestSpeakChangeGolden(t *testing.T) {
+	web := speechConn("web", 443, tracker.StateEstablished, 100*time.Millisecond)
+	gone := speechConn("mail", 993, tracker.StateEstablished, 0)
+	webNow := *web
+	webNow.State = tracker.StateCloseWait
+	webNow.Ping = 300 * time.Millisecond
+	ssh := speechConn("ssh", 22, tracker.StateEstablished, 0)
+
+	changes := tracker.DiffSnapshots(
+		[]*tracker.Connection{web, gone},
+		[]*tracker.Connection{&webNow, ssh},
+		tracker.DefaultDiffOptions)
+
+	want := map[int][]string{
+		VerbosityConnections: {
+			"new connection: ssh to 192.0.2.1 port 22",
+			"closed: mail to 192.0.2.1 port 993",
+		},
+		VerbosityStates: {
+			"new connection: ssh to 192.0.2.1 port 22",
+			"closed: mail to 192.0.2.1 port 993",
+			"web to 192.0.2.1 port 443 is now close wait",
+		},
+		VerbosityPing: {
+			"new connection: ssh to 192.0.2.1 port 22",
+			"closed: mail to 192.0.2.1 port 993",
+			"web to 192.0.2.1 port 443 is now close wait",
+			"web to 192.0.2.1 port 443 ping increased to 300 milliseconds",
+		},
+	}
+	for verbosity, lines := range want {
+		var got []string
+		for _, ch := range changes {
+			if s := speakChange(ch, verbosity); s != "" {
+				got = append(got, s)
+			}
+		}
+		if len(got) != len(lines) {
+			t.Fatalf("verbosity %d: got %q, want %q", verbosity, got, lines)
+		}
+		for i := range lines {
+			if got[i] != lines[i] {
+				t.Errorf("verbosity %d line %d: got %q, want %q", verbosity, i, got[i], lines[i])
+			}
+		}
+	}
+}
+
+func TestSpeakPingDecrease(t *testing.T) {
+	c := speechConn("web", 443, tracker.StateEstablished, time.Millisecond)
+	got := speakChange(tracker.Change{Kind: tracker.ChangePing, Conn: c, OldPing: 80 * time.Millisecond}, VerbosityPing)
+	if want := "web to 192.0.2.1 port 443 ping decreased to 1 millisecond"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSpeakConnectionGolden(t *testing.T) {
+	c := speechConn("web", 443, tracker.StateEstablished, 42*time.Millisecond)
+	c.PingCount = 10
+	c.Loss = 10
+	c.TxRate = 2048
+	want := "web, process 100, outbound tcp to 192.0.2.1 port 443, established, ping 42 milliseconds, loss 10 percent, sending " +
+		tracker.FormatBytes(2048) + ", receiving " + tracker.FormatBytes(0)
+	if got := speakConnection(c); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	listen := speechConn("nginx", 0, tracker.ConnState("LISTEN"), 0)
+	listen.Direction = tracker.Inbound
+	listen.RemoteAddr = "*"
+	listen.LocalPort = 80
+	want = "nginx, process 100, inbound tcp to *, local port 80, listen, sending " +
+		tracker.FormatBytes(0) + ", receiving " + tracker.FormatBytes(0)
+	if got := speakConnection(listen); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestSpeakClosingGolden(t *testing.T) {
+	c := &tracker.Connection{
+		AppName: "nginx", LocalPort: 8080, State: tracker.StateCloseWait,
+		Closing: &tracker.ClosingSummary{By: tracker.ClosingByPort, Count: 12, PerMinute: 3.4, HasRate: true},
+	}
+	if got, want := speakConnection(c), "local port 8080, 12 closing sockets, mostly close wait, 3 new per minute"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.Closing = &tracker.ClosingSummary{By: tracker.ClosingByApp, Count: 2}
+	if got, want := speakConnection(c), "nginx, 2 closing sockets, mostly close wait"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,551 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// tableLayout holds the width of every connection table column. Optional
+// columns are 0 when hidden.
+type tableLayout struct {
+	host, netns               int
+	pid, app, ping, loss, dir int
+	score                     int
+	proto, enc, local, remote int
+	state, tx, rx             int
+	share, stall, qos, cc     int
+	sendq, recvq              int
+	derived                   string // derived column names, derivedSep-separated
+	derivedW                  int
+}
+
+// Color grades of the Ping and Loss cells: good below the warn level, bad
+// from the bad level on. Scores grade the other way round: good from
+// scoreWarn on, bad below scoreBad.
+const (
+	pingWarnMs, pingBadMs   = 50, 150
+	lossWarnPct, lossBadPct = 1, 10
+	scoreWarn, scoreBad     = 80, 50
+)
+
+// Columns of the numeric cells' notes: what follows a value, such as the
+// correction marker, the colorblind symbol, the loss trend arrow or the
+// probe interval of a tier. Values are right-aligned in front of them.
+const (
+	pingNoteW  = 7
+	lossNoteW  = 4
+	scoreNoteW = 2
+)
+
+// tableLayout returns the column widths for the current column toggles.
+func (m Model) tableLayout() tableLayout {
+	l := tableLayout{
+		pid: 7, app: 18, ping: 17, loss: 8, score: 8, dir: 4, proto: 6, enc: 3,
+		local: 22, remote: 22, state: 16, tx: 10, rx: 10,
+	}
+	if m.remotes != nil {
+		l.host = 16
+	}
+	if m.showNetns {
+		l.netns = 12
+	}
+	if m.showShare {
+		l.share = 11
+	}
+	if m.showStall {
+		l.stall = 9
+	}
+	if m.showQoS {
+		l.qos = 8
+	}
+	if m.showCC {
+		l.cc = 8
+	}
+	if m.showQueues {
+		l.sendq, l.recvq = 9, 9
+	}
+	l.derived, l.derivedW = derivedLayout(m.derived)
+	return l
+}
+
+// tableColumn is one column of the layout: its header, which names the
+// hotkey sort keys in brackets, its width, the width of the right-aligned
+// values of a numeric column (0 for a text column), and the orders it can
+// be sorted by, for the F4 picker.
+type tableColumn struct {
+	header string
+	width  int
+	value  int
+	sorts  []sortKey
+}
+
+// columns lists the columns shown, in order.
+func (l tableLayout) columns() []tableColumn {
+	by := func(fields ...SortField) []sortKey {
+		keys := make([]sortKey, len(fields))
+		for i, f := range fields {
+			keys[i] = sortKey{field: f}
+		}
+		return keys
+	}
+	var cols []tableColumn
+	if l.host > 0 {
+		cols = append(cols, tableColumn{tr("col.host"), l.host, 0, by(SortHost)})
+	}
+	if l.netns > 0 {
+		cols = append(cols, tableColumn{tr("col.netns"), l.netns, 0, by(SortNetns)})
+	}
+	cols = append(cols,
+		tableColumn{tr("col.pid"), l.pid, l.pid, by(SortPID)}, tableColumn{"[1]" + tr("col.app"), l.app, 0, by(SortApp)},
+		tableColumn{"[2]" + tr("col.ping"), l.ping, l.ping - pingNoteW, by(SortPing)},
+		tableColumn{"[3/7]" + tr("col.loss"), l.loss, l.loss - lossNoteW, by(SortLoss, SortLossTrend)},
+		tableColumn{"[0]" + tr("col.score"), l.score, l.score - scoreNoteW, by(SortScore)},
+		tableColumn{tr("col.dir"), l.dir, 0, by(SortDir)}, tableColumn{tr("col.proto"), l.proto, 0, by(SortProto)},
+		tableColumn{tr("col.enc"), l.enc, 0, by(SortEnc)},
+		tableColumn{tr("col.local"), l.local, 0, by(SortLocal)}, tableColumn{tr("col.remote"), l.remote, 0, by(SortRemote)},
+		tableColumn{"[6/9]" + tr("col.state"), l.state, 0, by(SortState, SortStateTime)},
+		tableColumn{"[4]" + tr("col.tx"), l.tx, l.tx, by(SortTxRate)},
+		tableColumn{"[5]" + tr("col.rx"), l.rx, l.rx, by(SortRxRate)})
+	if l.share > 0 {
+		cols = append(cols, tableColumn{tr("col.share"), l.share, 0, by(SortShare)})
+	}
+	if l.stall > 0 {
+		cols = append(cols, tableColumn{tr("col.stall"), l.stall, 0, by(SortStall)})
+	}
+	if l.qos > 0 {
+		cols = append(cols, tableColumn{tr("col.qos"), l.qos, 0, by(SortQoS)})
+	}
+	if l.cc > 0 {
+		cols = append(cols, tableColumn{tr("col.cc"), l.cc, 0, by(SortCC)})
+	}
+	if l.sendq > 0 {
+		cols = append(cols, tableColumn{tr("col.sendq"), l.sendq, l.sendq, by(SortSendQ)},
+			tableColumn{tr("col.recvq"), l.recvq, l.recvq, by(SortRecvQ)})
+	}
+	for i, name := range l.derivedNames() {
+		cols = append(cols, tableColumn{"[x]" + name, l.derivedW, l.derivedW, []sortKey{{field: SortDerived, derived: i}}})
+	}
+	return cols
+}
+
+// header is the unstyled header line. Its cells are padded like the
+// rows' cells, so the two line up: a numeric column's header ends where
+// its values do, unless it is wider than them.
+func (l tableLayout) header() string {
+	cols := l.columns()
+	cells := make([]string, 0, len(cols))
+	for _, c := range cols {
+		h := c.header
+		if c.value > 0 {
+			h = padLeft(h, max(c.value, ansi.StringWidth(h)))
+		}
+		cells = append(cells, padRight(h, c.width))
+	}
+	return strings.Join(cells, " ")
+}
+
+// tableView is what the connection table shows: rows conns[offset:] up to
+// height lines, with the row at cursor selected. preview, when set, is the
+// alert rule whose matches are highlighted (the threshold editor's draft).
+type tableView struct {
+	conns   []*tracker.Connection
+	layout  tableLayout
+	cursor  int
+	offset  int
+	height  int
+	width   int
+	preview *tracker.AlertRule
+}
+
+// renderTable returns the header line followed by exactly v.height row
+// lines, each cut to v.width columns. Rows whose fields did not change
+// since the last frame come from the row cache.
+func (m Model) renderTable(v tableView) []string {
+	lines := make([]string, 0, v.height+1)
+	lines = append(lines, m.st(styleHeader).Render(truncate(v.layout.header(), v.width)))
+
+	sectioned := m.sectioned()
+	for i := v.offset; i < len(v.conns) && len(lines) < v.height+1; i++ {
+		c := v.conns[i]
+		if sectioned && (i == v.offset || c.Origin != v.conns[i-1].Origin) {
+			lines = append(lines, m.sectionHeader(c.Origin, v.width))
+			if len(lines) == v.height+1 {
+				break
+			}
+		}
+		look := m.rowLook(c, i == v.cursor, v.preview)
+		key := c.Key()
+		fields := m.rowFieldsOf(c, look, v.layout, v.width)
+		out, ok := m.rows.get(key, fields)
+		if !ok {
+			out = m.styleRow(m.renderRow(c, v.layout), look, v.width)
+			m.rows.put(key, fields, out)
+		}
+		lines = append(lines, out)
+	}
+	m.rows.endFrame()
+
+	for len(lines) < v.height+1 {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// rowLook decides how a row is highlighted: selection first, then an F8
+// mark, alert level under preview, an unacknowledged listener, then a
+// stale source.
+func (m Model) rowLook(c *tracker.Connection, selected bool, preview *tracker.AlertRule) rowLook {
+	level := tracker.AlertNone
+	if preview != nil {
+		level = preview.Level(c)
+	}
+	switch {
+	case selected:
+		return lookSelected
+	case m.marked[c.Key()]:
+		return lookMarked
+	case level == tracker.AlertCrit:
+		return lookCrit
+	case level == tracker.AlertWarn:
+		return lookWarn
+	case c.NewListener:
+		return lookNewListener
+	case c.Host != "" && !m.remotes.Healthy(c.Host):
+		return lookStale
+	}
+	return lookNormal
+}
+
+// styleRow applies the row style for look and cuts the row to width. Rows
+// with a background (selected, marked, alerting, new listener) drop their cells' own colors first:
+// each colored cell ends in a reset, which would otherwise cut the
+// background short after the first colored cell.
+func (m Model) styleRow(row string, look rowLook, width int) string {
+	var out string
+	switch look {
+	case lookSelected:
+		out = m.st(styleSelection).Render(ansi.Strip(row))
+	case lookCrit:
+		out = m.st(styleRowCrit).Render(ansi.Strip(row))
+	case lookWarn:
+		out = m.st(styleRowWarn).Render(ansi.Strip(row))
+	case lookNewListener:
+		out = m.st(styleNewListener).Render(ansi.Strip(row))
+	case lookMarked:
+		out = m.st(styleMarked).Render(ansi.Strip(row))
+	case lookStale:
+		out = m.st(styleStale).Render(row)
+	default:
+		out = m.st(styleRow).Render(row)
+	}
+	return ansi.Truncate(out, width, "")
+}
+
+// renderRow renders the cells of c laid out by l, with colored cells.
+func (m Model) renderRow(c *tracker.Connection, l tableLayout) string {
+	if c.Closing != nil {
+		return m.renderClosingRow(c, l)
+	}
+
+	// Format local/remote
+	local := fmt.Sprintf("%s:%d", m.addr(c.LocalAddr), c.LocalPort)
+	remote := fmt.Sprintf("%s:%d", m.addr(c.RemoteAddr), c.RemotePort)
+
+	// Format plain text for direction
+	dirPlain := string(c.Direction)
+	var dirStyle lipgloss.Style
+	if c.Direction == tracker.Inbound {
+		dirPlain = "IN"
+		dirStyle = m.st(styleDirIn)
+	} else {
+		dirPlain = "OUT"
+		dirStyle = m.st(styleDirOut)
+	}
+
+	// Format plain text for ping, and its note: the correction marker and
+	// the colorblind symbol
+	pingPlain, pingNote := "-", ""
+	var pingStyle lipgloss.Style
+	if c.NoProbe != tracker.AddrProbeable {
+		pingPlain, pingStyle = "n/a", m.st(styleStale)
+	} else if down := c.UnreachableFor(time.Now()); down > 0 {
+		pingPlain, pingNote, pingStyle = m.downCell(down)
+	} else if c.Ping > 0 {
+		ms := float64(c.Ping.Microseconds()) / 1000.0
+		level := metricGood
+		switch {
+		case ms >= pingBadMs:
+			level = metricBad
+		case ms >= pingWarnMs:
+			level = metricWarn
+		}
+		var symbol string
+		pingStyle, symbol = m.metric(level)
+		pingPlain = locale.Number(fmt.Sprintf("%.1fms", ms))
+		pingNote = c.PingCorrection.Marker() + symbol
+	}
+
+	// Format plain text for loss
+	lossPlain, lossNote := "-", ""
+	var lossStyle lipgloss.Style
+	if c.NoProbe != tracker.AddrProbeable {
+		lossPlain, lossStyle = "n/a", m.st(styleStale)
+	} else if c.PingCount > 0 {
+		level := metricGood
+		switch {
+		case c.Loss >= lossBadPct:
+			level = metricBad
+		case c.Loss >= lossWarnPct:
+			level = metricWarn
+		}
+		var symbol string
+		lossStyle, symbol = m.metric(level)
+		lossPlain, lossNote = fmt.Sprintf("%.0f%%", c.Loss), symbol
+		if arrow := c.LossTrend.Arrow(); arrow != "" {
+			lossNote += " " + arrow
+		}
+	}
+
+	scorePlain, scoreNote := "-", ""
+	var scoreStyle lipgloss.Style
+	if c.HasScore {
+		level := metricGood
+		switch {
+		case c.Score < scoreBad:
+			level = metricBad
+		case c.Score < scoreWarn:
+			level = metricWarn
+		}
+		var symbol string
+		scoreStyle, symbol = m.metric(level)
+		scorePlain, scoreNote = fmt.Sprintf("%d", c.Score), symbol
+	}
+
+	encPlain := "?"
+	var encStyle lipgloss.Style
+	switch c.Encryption {
+	case tracker.EncEncrypted:
+		encPlain = "\U0001F512"
+	case tracker.EncPlaintext:
+		encPlain = "\U0001F513"
+		encStyle = m.st(styleBad)
+	}
+
+	// Build each cell as padded plain text, then apply color to content only.
+	// This avoids ANSI escape codes breaking fmt.Sprintf alignment.
+	// Numeric cells are right-aligned, their notes after the values.
+	pidCell := padLeft(fmt.Sprintf("%d", c.PID), l.pid)
+	switch c.Origin {
+	case tracker.OriginForwarded:
+		pidCell = styledPadLeft("fwd", m.st(styleStale), l.pid)
+	case tracker.OriginBridged:
+		pidCell = styledPadLeft("bridge", m.st(styleStale), l.pid)
+	}
+	appName := m.appName(c)
+	if c.PortShare != nil {
+		pidCell = padLeft(fmt.Sprintf("%d PIDs", c.PortShare.Processes()), l.pid)
+		appName = m.portShareApp(c.PortShare)
+	}
+	appCell := padRight(truncStr(appName, l.app), l.app)
+	if c.IsNewRemote(time.Now()) {
+		appCell = m.st(styleBadgeNew).Render("NEW") + " " + padRight(truncStr(appName, l.app-4), l.app-4)
+	}
+	if badge, style := m.auditBadge(c); badge != "" {
+		w := l.app - len(badge) - 1
+		appCell = style.Render(badge) + " " + padRight(truncStr(appName, w), w)
+	}
+	pingNote = styleNote(pingNote, pingStyle)
+	if c.Host == "" && c.PingTier != tracker.TierFocused && c.State == tracker.StateEstablished && c.NoProbe == tracker.AddrProbeable {
+		// Show the effective probe interval for connections probed less often
+		pingNote += m.st(styleStale).Render("/" + fmtDur(m.tracker.ProbeInterval(c.PingTier)))
+	}
+	pingCell := numCell(pingPlain, pingStyle, pingNote, l.ping, pingNoteW)
+	lossCell := numCell(lossPlain, lossStyle, styleNote(lossNote, lossStyle), l.loss, lossNoteW)
+	scoreCell := numCell(scorePlain, scoreStyle, styleNote(scoreNote, scoreStyle), l.score, scoreNoteW)
+	dirCell := styledPadRight(dirPlain, dirStyle, l.dir)
+	protoCell := padRight(c.ProtocolHint(), l.proto)
+	encCell := styledPadRight(encPlain, encStyle, l.enc)
+	localCell := padRight(truncStr(local, l.local), l.local)
+	if m.compactPort {
+		localCell = m.compactLocal(c, l.local)
+	}
+	remoteCell := padRight(truncStr(remote, l.remote), l.remote)
+	if c.PortShare != nil {
+		badge, style := m.portShareBadge(c.PortShare)
+		remoteCell = styledPadRight(badge, style, l.remote)
+	}
+	stateCell := m.padState(c, l.state)
+	txCell := padLeft("-", l.tx)
+	rxCell := padLeft("-", l.rx)
+	if c.HasByteCounts {
+		txCell = padLeft(locale.Number(tracker.FormatBytes(c.TxRate)), l.tx)
+		rxCell = padLeft(locale.Number(tracker.FormatBytes(c.RxRate)), l.rx)
+	}
+
+	shareCell := ""
+	if l.share > 0 {
+		shareCell = " " + padShare(m.shares, c.Key(), l.share)
+	}
+
+	stallCell := ""
+	if l.stall > 0 {
+		stallCell = " " + m.padStall(c, l.stall)
+	}
+
+	qosCell := ""
+	if l.qos > 0 {
+		qosCell = " " + padRight(qosText(c), l.qos)
+	}
+
+	ccCell := ""
+	if l.cc > 0 {
+		ccCell = " " + padRight(truncStr(cmp.Or(c.CongestionAlgo, "-"), l.cc), l.cc)
+	}
+
+	queueCells := ""
+	if l.sendq > 0 {
+		queueCells = " " + m.padQueue(c, c.SendQ, c.SendQHigh > 0, l.sendq) + " " + m.padQueue(c, c.RecvQ, false, l.recvq)
+	}
+
+	hostCell := ""
+	if l.host > 0 {
+		host := m.hostName(c.Host)
+		hostCell = padRight(truncStr(host, l.host), l.host) + " "
+	}
+	if l.netns > 0 {
+		ns := c.Namespace
+		if ns == "" {
+			ns = "host"
+		}
+		hostCell += padRight(truncStr(ns, l.netns), l.netns) + " "
+	}
+
+	return hostCell + pidCell + " " + appCell + " " + pingCell + " " + lossCell + " " + scoreCell + " " +
+		dirCell + " " + protoCell + " " + encCell + " " + localCell + " " + remoteCell + " " +
+		stateCell + " " + txCell + " " + rxCell + shareCell + stallCell + qosCell + ccCell + queueCells + derivedCells(c, l)
+}
+
+// numCell lays out a numeric cell: value right-aligned in its style, then
+// note, already styled, left-aligned in the last noteW columns, so that a
+// column's values line up whatever their notes. A value too wide for its
+// part pushes the note along rather than being cut.
+func numCell(value string, style lipgloss.Style, note string, width, noteW int) string {
+	valueW := max(width-noteW, lipgloss.Width(value))
+	if valueW >= width {
+		return styledPadRight(value, style, width)
+	}
+	return styledPadLeft(value, style, valueW) + padRight(note, width-valueW)
+}
+
+// styleNote styles a numeric cell's note; "" stays "".
+func styleNote(note string, style lipgloss.Style) string {
+	if note == "" {
+		return ""
+	}
+	return style.Render(note)
+}
+
+// padStall renders the Stall column: "0win 12s" for a zero window, "buf 12s"
+// for a full send buffer, blank when stalls cannot be observed.
+func (m Model) padStall(c *tracker.Connection, width int) string {
+	if c.TCPInfo == nil {
+		return padRight("", width)
+	}
+	if c.StallSince.IsZero() {
+		return padRight("-", width)
+	}
+	tag := "buf"
+	if c.StallReason == "zero window" {
+		tag = "0win"
+	}
+	return styledPadRight(tag+" "+fmtDur(c.StallDuration()), m.st(styleBad), width)
+}
+
+// downCell is the Ping cell of an unreachable remote, "down 4m", and its
+// colorblind symbol, styled more urgently the longer the outage lasts.
+func (m Model) downCell(d time.Duration) (string, string, lipgloss.Style) {
+	level := metricWarn
+	if d >= time.Minute {
+		level = metricBad
+	}
+	style, symbol := m.metric(level)
+	if d >= 10*time.Minute {
+		style = style.Reverse(true)
+	}
+	return "down " + downAge(d), symbol, style
+}
+
+// downAge is an outage's length in its largest unit.
+func downAge(d time.Duration) string {
+	age, _, _ := strings.Cut(compactDuration(d), " ")
+	return age
+}
+
+// padState renders the State column, with the time in state appended
+// once the connection is stuck: "CLOSE_WAIT 48m", or "CLOSE_WAIT ≥48m"
+// when it was already in that state when tracking started. A suspected
+// half-open connection is marked "ESTABLISHED ½" in the bad style.
+func (m Model) padState(c *tracker.Connection, width int) string {
+	if c.HalfOpen {
+		return styledPadRight(string(c.State)+" \u00bd", m.st(styleBad), width)
+	}
+	if !c.Stuck {
+		return padRight(string(c.State), width)
+	}
+	return styledPadRight(string(c.State)+" "+stateAge(c), m.st(styleWarn), width)
+}
+
+// stateAge is the time in state in its largest unit, "≥" marking a lower bound.
+func stateAge(c *tracker.Connection) string {
+	age, _, _ := strings.Cut(compactDuration(c.TimeInState()), " ")
+	if !c.StateSinceExact {
+		age = "\u2265" + age
+	}
+	return age
+}
+
+// padQueue renders a SendQ or RecvQ cell: the bytes waiting in the socket
+// buffer, in the warning style while the send queue is above the alert
+// threshold, and "-" where the scanner cannot read queues.
+func (m Model) padQueue(c *tracker.Connection, n uint64, high bool, width int) string {
+	if !c.HasQueues {
+		return padLeft("-", width)
+	}
+	style := lipgloss.Style{}
+	if high {
+		style = m.st(styleWarn)
+	}
+	return styledPadLeft(locale.Number(tracker.FormatBytesTotal(n)), style, width)
+}
+
+// qosText is the QoS column text: the DSCP class and, when set, the socket
+// priority ("EF/6"); "-" when the marking cannot be read.
+func qosText(c *tracker.Connection) string {
+	if c.QoS == nil {
+		return "-"
+	}
+	s := c.QoS.Class()
+	if c.QoS.HasPriority && c.QoS.Priority != 0 {
+		s += fmt.Sprintf("/%d", c.QoS.Priority)
+	}
+	return s
+}
+
+// padShare renders a connection's throughput share as a small bar plus percentage.
+func padShare(shares map[string]float64, key string, width int) string {
+	pct, ok := shares[key]
+	if !ok {
+		return padRight("-", width)
+	}
+	const barLen = 5
+	filled := int(pct/100*barLen + 0.5)
+	bar := strings.Repeat("\u2588", filled) + strings.Repeat("\u00b7", barLen-filled)
+	return styledPadRight(fmt.Sprintf("%s %3.0f%%", bar, pct), lipgloss.Style{}, width)
+}
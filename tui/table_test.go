@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestPadShare(t *testing.T) {
+	shares := map[string]float64{"a": 75, "b": 0, "c": 100}
+	tests := []struct {
+		key, want string
+	}{
+		{"a", "████· " + " 75%"},
+		{"b", "····· " + "  0%"},
+		{"c", "█████ " + "100%"},
+		{"missing", "-"},
+	}
+	for _, tt := range tests {
+		got := padShare(shares, tt.key, 12)
+		if strings.TrimRight(got, " ") != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if got := padShare(nil, "a", 12); strings.TrimSpace(got) != "-" {
+		t.Errorf("no shares: got %q", got)
+	}
+}
+
+func TestCompactLocal(t *testing.T) {
+	m := newTestModel()
+	eph := tracker.EphemeralRange().Low
+	tests := []struct {
+		port int
+		want string
+	}{
+		{eph, "10.0.0.2:*"},
+		{5432, "10.0.0.2:5432 postgres"},
+		{8081, "10.0.0.2:8081"},
+	}
+	for _, tt := range tests {
+		c := &tracker.Connection{LocalAddr: "10.0.0.2", LocalPort: tt.port}
+		if got := strings.TrimRight(ansi.Strip(m.compactLocal(c, 30)), " "); got != tt.want {
+			t.Errorf("port %d: got %q, want %q", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestQueueColumns(t *testing.T) {
+	withColor(t)
+	m := newTestModel()
+	if strings.Contains(m.tableLayout().header(), "SendQ") {
+		t.Fatal("queue columns shown by default")
+	}
+	m, _ = press(t, m, "u")
+	l := m.tableLayout()
+	if h := l.header(); !strings.Contains(h, "SendQ") || !strings.Contains(h, "RecvQ") {
+		t.Fatalf("header %q", h)
+	}
+
+	tests := []struct {
+		name        string
+		c           tracker.Connection
+		send, recv  string
+		highlighted bool
+	}{
+		{"no queues", tracker.Connection{}, "-", "-", false},
+		{"empty", tracker.Connection{HasQueues: true}, "0 B", "0 B", false},
+		{"sizes", tracker.Connection{HasQueues: true, SendQ: 1536, RecvQ: 3 << 20}, "1.5 KB", "3.0 MB", false},
+		{"stuck", tracker.Connection{HasQueues: true, SendQ: 5 << 20, SendQHigh: 2}, "5.0 MB", "0 B", true},
+	}
+	warn := m.st(styleWarn).Render("x")
+	warnOn := warn[:strings.Index(warn, "x")]
+	for _, tt := range tests {
+		send := m.padQueue(&tt.c, tt.c.SendQ, tt.c.SendQHigh > 0, l.sendq)
+		recv := m.padQueue(&tt.c, tt.c.RecvQ, false, l.recvq)
+		if ansi.StringWidth(send) != l.sendq || ansi.StringWidth(recv) != l.recvq {
+			t.Errorf("%s: cells %q %q not padded to the column", tt.name, send, recv)
+		}
+		if got := strings.TrimSpace(ansi.Strip(send)); got != tt.send {
+			t.Errorf("%s: SendQ %q, want %q", tt.name, got, tt.send)
+		}
+		if got := strings.TrimSpace(ansi.Strip(recv)); got != tt.recv {
+			t.Errorf("%s: RecvQ %q, want %q", tt.name, got, tt.recv)
+		}
+		if strings.Contains(send, warnOn) != tt.highlighted || strings.Contains(recv, "\x1b[") {
+			t.Errorf("%s: styles %q %q", tt.name, send, recv)
+		}
+	}
+}
+
+func TestStateCell(t *testing.T) {
+	withColor(t)
+	m := newTestModel()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	warn := m.st(styleWarn).Render("x")
+	warnOn := warn[:strings.Index(warn, "x")]
+	tests := []struct {
+		c    tracker.Connection
+		want string
+	}{
+		{tracker.Connection{State: tracker.StateEstablished, StateSince: t0, LastUpdated: t0.Add(time.Hour), StateSinceExact: true}, "ESTABLISHED"},
+		{tracker.Connection{State: tracker.StateCloseWait, StateSince: t0, LastUpdated: t0.Add(48 * time.Minute), StateSinceExact: true, Stuck: true}, "CLOSE_WAIT 48m"},
+		{tracker.Connection{State: tracker.StateCloseWait, StateSince: t0, LastUpdated: t0.Add(3 * time.Hour), Stuck: true}, "CLOSE_WAIT ≥3h"},
+		{tracker.Connection{State: tracker.StateSynSent, StateSince: t0, LastUpdated: t0.Add(42 * time.Second), StateSinceExact: true, Stuck: true}, "SYN_SENT 42s"},
+	}
+	for _, tt := range tests {
+		cell := m.padState(&tt.c, 16)
+		if got := strings.TrimRight(ansi.Strip(cell), " "); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.c.State, got, tt.want)
+		}
+		if ansi.StringWidth(cell) != 16 {
+			t.Errorf("%s: cell is %d columns", tt.c.State, ansi.StringWidth(cell))
+		}
+		if strings.Contains(cell, warnOn) != tt.c.Stuck {
+			t.Errorf("%s: highlighted %q", tt.c.State, cell)
+		}
+	}
+}
+
+func TestHalfOpenCell(t *testing.T) {
+	withColor(t)
+	m := newTestModel()
+	bad := m.st(styleBad).Render("x")
+	c := tracker.Connection{State: tracker.StateEstablished, HalfOpen: true}
+	cell := m.padState(&c, 16)
+	if got := strings.TrimRight(ansi.Strip(cell), " "); got != "ESTABLISHED ½" {
+		t.Errorf("cell %q", got)
+	}
+	if !strings.Contains(cell, bad[:strings.Index(bad, "x")]) || ansi.StringWidth(cell) != 16 {
+		t.Errorf("cell %q", cell)
+	}
+
+	now := time.Now()
+	c = testConn("game", 100, "203.0.113.5", 27015)
+	c.HalfOpen, c.HalfOpenSince, c.HalfOpenReason = true, now.Add(-2*time.Minute), "no data for 5m, peer unreachable for 3m"
+	want := "suspected for 2m 0s: no data for 5m, peer unreachable for 3m"
+	if detail := m.renderDetail(&c); !strings.Contains(detail, want) {
+		t.Errorf("no %q in\n%s", want, detail)
+	}
+}
+
+// TestDownCell checks an outage reads in its largest unit and is styled
+// more urgently as it grows: warn, then bad past a minute, then reversed
+// past ten.
+func TestDownCell(t *testing.T) {
+	m := newTestModel()
+	m.pal.symbols = true
+	tests := []struct {
+		d       time.Duration
+		want    string
+		symbol  string
+		reverse bool
+	}{
+		{20 * time.Second, "down 20s", "!", false},
+		{4*time.Minute + 32*time.Second, "down 4m", "!!", false},
+		{10 * time.Minute, "down 10m", "!!", true},
+		{3*time.Hour + 5*time.Minute, "down 3h", "!!", true},
+	}
+	for _, tt := range tests {
+		text, symbol, style := m.downCell(tt.d)
+		if text != tt.want || symbol != tt.symbol || style.GetReverse() != tt.reverse {
+			t.Errorf("%s: %q %q reverse %v", tt.d, text, symbol, style.GetReverse())
+		}
+	}
+}
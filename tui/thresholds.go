@@ -0,0 +1,219 @@
+package tui
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// thresholdField describes one editable alert threshold. Values are edited
+// in display units (ms, %, KB/s); 0 or empty means off. label is a catalog
+// key.
+type thresholdField struct {
+	label string
+	unit  string
+	step  float64
+}
+
+var thresholdFields = []thresholdField{
+	{"thresholds.ping_warn", "ms", 10},
+	{"thresholds.ping_crit", "ms", 10},
+	{"thresholds.loss_warn", "%", 1},
+	{"thresholds.loss_crit", "%", 1},
+	{"thresholds.bandwidth", "KB/s", 100},
+}
+
+// thresholdEditor is the state of the F2 overlay.
+type thresholdEditor struct {
+	base   tracker.AlertRule // rule being edited; fields without an editor row are kept
+	values []string
+	focus  int
+	fresh  bool // the next typed digit replaces the focused value
+	err    string
+}
+
+// newThresholdEditor starts an editor holding the rule currently in effect.
+func newThresholdEditor(r tracker.AlertRule) *thresholdEditor {
+	nums := []float64{
+		float64(r.PingWarn) / float64(time.Millisecond),
+		float64(r.PingThreshold) / float64(time.Millisecond),
+		r.LossWarn,
+		r.LossThreshold,
+		r.RateThreshold / 1024,
+	}
+	e := &thresholdEditor{base: r, fresh: true}
+	for _, n := range nums {
+		e.values = append(e.values, formatThreshold(n))
+	}
+	return e
+}
+
+func formatThreshold(v float64) string {
+	if v <= 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// rule parses the edited values into a validated AlertRule.
+func (e *thresholdEditor) rule() (tracker.AlertRule, error) {
+	nums := make([]float64, len(e.values))
+	for i, v := range e.values {
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return tracker.AlertRule{}, errors.New(trf("thresholds.not_number", tr(thresholdFields[i].label), v))
+		}
+		nums[i] = n
+	}
+	r := e.base
+	r.PingWarn = time.Duration(nums[0] * float64(time.Millisecond))
+	r.PingThreshold = time.Duration(nums[1] * float64(time.Millisecond))
+	r.LossWarn = nums[2]
+	r.LossThreshold = nums[3]
+	r.RateThreshold = nums[4] * 1024
+	return r, r.Validate()
+}
+
+// key applies one keypress. It returns true when the edit is confirmed and
+// the rule is valid; the caller closes the editor on Esc itself.
+func (e *thresholdEditor) key(k string) bool {
+	switch k {
+	case "up", "shift+tab":
+		e.focus = (e.focus + len(e.values) - 1) % len(e.values)
+		e.fresh = true
+	case "down", "tab":
+		e.focus = (e.focus + 1) % len(e.values)
+		e.fresh = true
+	case "left", "right":
+		n, _ := strconv.ParseFloat(e.values[e.focus], 64)
+		step := thresholdFields[e.focus].step
+		if k == "left" {
+			n = max(0, n-step)
+		} else {
+			n += step
+		}
+		e.values[e.focus] = formatThreshold(n)
+		e.fresh = false
+	case "backspace":
+		v := e.values[e.focus]
+		if len(v) > 0 {
+			e.values[e.focus] = v[:len(v)-1]
+		}
+		e.fresh = false
+	case "enter":
+		_, err := e.rule()
+		if err != nil {
+			e.err = err.Error()
+			return false
+		}
+		return true
+	default:
+		if len(k) == 1 && (k[0] >= '0' && k[0] <= '9' || k == ".") {
+			if e.fresh {
+				e.values[e.focus] = ""
+				e.fresh = false
+			}
+			e.values[e.focus] += k
+		}
+	}
+	e.err = ""
+	if _, err := e.rule(); err != nil {
+		e.err = err.Error()
+	}
+	return false
+}
+
+// thresholdMode is the open F2 editor. Enter applies the rule; F2 or Esc
+// closes the editor and leaves the rule in effect as it was.
+type thresholdMode struct{}
+
+// openThresholds opens the editor on the rule in effect.
+func (m *Model) openThresholds() {
+	m.thresholds = newThresholdEditor(m.tracker.AlertRule())
+	m.pushMode(&thresholdMode{})
+}
+
+func (t *thresholdMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	if msg.String() == "f2" {
+		m.cancelMode(t)
+		return m, nil, true
+	}
+	if !m.thresholds.key(msg.String()) {
+		return m, nil, true
+	}
+	r, _ := m.thresholds.rule()
+	m.tracker.SetAlertRule(r)
+	m.thresholds = nil
+	m.endMode(t)
+	m.notice = "Alert thresholds applied"
+	if m.saveThresholds != nil {
+		if err := m.saveThresholds(r); err != nil {
+			m.notice = "Alert thresholds applied, but not saved: " + err.Error()
+		} else {
+			m.notice = "Alert thresholds applied and saved to the config file"
+		}
+	}
+	return m, nil, true
+}
+
+func (t *thresholdMode) cancel(m *Model) {
+	m.thresholds = nil
+}
+
+func (t *thresholdMode) typing() {}
+
+// previewRule is the candidate rule while editing, falling back to the rule
+// in effect when the edited values don't parse.
+func (m Model) previewRule() tracker.AlertRule {
+	if r, err := m.thresholds.rule(); err == nil {
+		return r
+	}
+	return m.tracker.AlertRule()
+}
+
+// thresholdPanelHeight is the number of lines renderThresholds produces.
+func thresholdPanelHeight() int {
+	return len(thresholdFields) + 3
+}
+
+// renderThresholds draws the editor panel shown below the table.
+func (m Model) renderThresholds(preview tracker.AlertRule) string {
+	e := m.thresholds
+	warn, crit := 0, 0
+	for _, c := range m.connections {
+		switch preview.Level(c) {
+		case tracker.AlertWarn:
+			warn++
+		case tracker.AlertCrit:
+			crit++
+		}
+	}
+
+	lines := []string{m.st(styleHeader).Render(truncate(" "+trf("thresholds.title", warn, crit), m.width))}
+	for i, f := range thresholdFields {
+		v := e.values[i]
+		if i == e.focus {
+			v += "█"
+		}
+		line := "  " + padRight(tr(f.label), 16) + " " + padRight(v, 10) + " " + f.unit
+		if i == e.focus {
+			line = m.st(styleSearch).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if e.err != "" {
+		lines = append(lines, m.st(styleBad).Render("  "+e.err))
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.st(styleStatus).Render(tr("thresholds.keys")))
+	return strings.Join(lines, "\n")
+}
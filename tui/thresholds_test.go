@@ -0,0 +1,154 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+)
+
+func TestThresholdEditorKeys(t *testing.T) {
+	e := newThresholdEditor(tracker.AlertRule{PingWarn: 100 * time.Millisecond, PingThreshold: 200 * time.Millisecond})
+	if got := strings.Join(e.values, " "); got != "100 200 0 0 0" {
+		t.Fatalf("initial values %q", got)
+	}
+
+	// The first digit replaces the value, the next ones append.
+	for _, k := range []string{"1", "5", "0"} {
+		e.key(k)
+	}
+	if e.values[0] != "150" {
+		t.Fatalf("typed %q", e.values[0])
+	}
+	e.key("backspace")
+	e.key("right")
+	if e.values[0] != "25" {
+		t.Fatalf("after backspace and a step: %q", e.values[0])
+	}
+	e.key("left")
+	e.key("left")
+	e.key("left")
+	if e.values[0] != "0" {
+		t.Fatalf("stepped below zero: %q", e.values[0])
+	}
+
+	// Focus wraps both ways.
+	e.key("up")
+	if e.focus != len(thresholdFields)-1 {
+		t.Fatalf("focus %d after up from the top", e.focus)
+	}
+	e.key("tab")
+	e.key("down")
+	if e.focus != 1 {
+		t.Fatalf("focus %d", e.focus)
+	}
+	// Moving focus makes the next digit replace again.
+	e.key("3")
+	if e.values[1] != "3" {
+		t.Fatalf("crit %q", e.values[1])
+	}
+	e.key("x") // ignored
+	if e.values[1] != "3" {
+		t.Fatalf("letter typed: %q", e.values[1])
+	}
+}
+
+func TestThresholdEditorValidation(t *testing.T) {
+	e := newThresholdEditor(tracker.AlertRule{})
+	e.values = []string{"200", "100", "0", "0", "0"}
+	if e.key("enter") {
+		t.Fatal("warn above crit confirmed")
+	}
+	if !strings.Contains(e.err, "below crit") {
+		t.Fatalf("error %q", e.err)
+	}
+
+	e.values = []string{"1.2.3", "0", "0", "0", "0"}
+	if e.key("enter") || e.err == "" {
+		t.Fatal("a bad number confirmed")
+	}
+
+	e.values = []string{"0", "0", "0", "101", "0"}
+	if e.key("enter") {
+		t.Fatal("loss above 100% confirmed")
+	}
+
+	e.values = []string{"80", "150", "2", "5", "1024"}
+	if !e.key("enter") {
+		t.Fatalf("valid rule rejected: %s", e.err)
+	}
+	r, _ := e.rule()
+	if r.PingWarn != 80*time.Millisecond || r.PingThreshold != 150*time.Millisecond ||
+		r.LossWarn != 2 || r.LossThreshold != 5 || r.RateThreshold != 1024*1024 {
+		t.Fatalf("rule %+v", r)
+	}
+}
+
+func TestThresholdEditorKeepsOtherFields(t *testing.T) {
+	e := newThresholdEditor(tracker.AlertRule{StallTime: time.Minute, ScoreThreshold: 40})
+	r, err := e.rule()
+	if err != nil || r.StallTime != time.Minute || r.ScoreThreshold != 40 {
+		t.Fatalf("rule %+v, %v", r, err)
+	}
+}
+
+func TestThresholdModeApply(t *testing.T) {
+	m := newTestModel()
+	var saved *tracker.AlertRule
+	m.SetThresholdSaver(func(r tracker.AlertRule) error {
+		saved = &r
+		return nil
+	})
+
+	m, _ = press(t, m, "f2")
+	if _, ok := findMode[*thresholdMode](m); !ok || m.thresholds == nil {
+		t.Fatal("F2 did not open the editor")
+	}
+	m, _ = press(t, m, "tab", "3", "0", "0", "enter")
+	if _, ok := findMode[*thresholdMode](m); ok {
+		t.Fatal("editor still open after a valid enter")
+	}
+	if got := m.tracker.AlertRule().PingThreshold; got != 300*time.Millisecond {
+		t.Fatalf("crit in effect %v", got)
+	}
+	if saved == nil || saved.PingThreshold != 300*time.Millisecond {
+		t.Fatal("rule not saved")
+	}
+
+	// F2 again closes without applying.
+	m, _ = press(t, m, "f2", "tab", "9", "f2")
+	if m.thresholds != nil || m.tracker.AlertRule().PingThreshold != 300*time.Millisecond {
+		t.Fatal("cancelled edit applied")
+	}
+}
+
+func TestThresholdPreview(t *testing.T) {
+	m := newTestModel()
+	m.tracker.SetAlertRule(tracker.AlertRule{PingThreshold: time.Second})
+	m, _ = press(t, m, "f2", "5", "0", "tab", "1", "0", "0")
+
+	preview := m.previewRule()
+	for _, tt := range []struct {
+		ping time.Duration
+		want tracker.AlertLevel
+	}{
+		{20 * time.Millisecond, tracker.AlertNone},
+		{60 * time.Millisecond, tracker.AlertWarn},
+		{150 * time.Millisecond, tracker.AlertCrit},
+	} {
+		if got := preview.Level(&tracker.Connection{Ping: tt.ping}); got != tt.want {
+			t.Errorf("ping %v: level %v, want %v", tt.ping, got, tt.want)
+		}
+	}
+	// The rule in effect is untouched while previewing.
+	if m.tracker.AlertRule().PingThreshold != time.Second {
+		t.Fatal("preview applied to the tracker")
+	}
+
+	// An invalid candidate previews the rule in effect.
+	m.thresholds.values[0] = "500"
+	if got := m.previewRule().PingThreshold; got != time.Second {
+		t.Fatalf("invalid candidate previewed: crit %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeFormatter renders every time shown in the UI, either relative to now
+// ("3m ago") or as wall-clock time ("14:32:07"). Toggled with T.
+type timeFormatter struct {
+	absolute bool
+	hour12   bool
+}
+
+// format renders t relative to now, or as an absolute time. Zero times render as "-".
+func (f timeFormatter) format(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	if f.absolute {
+		return f.clock(t, now)
+	}
+	return relative(t, now)
+}
+
+// clock formats t as a time of day, adding the date when t is not today.
+func (f timeFormatter) clock(t, now time.Time) string {
+	layout := "15:04:05"
+	if f.hour12 {
+		layout = "3:04:05 PM"
+	}
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := now.Date()
+	if y1 != y2 || m1 != m2 || d1 != d2 {
+		layout = "2006-01-02 " + layout
+	}
+	return t.Format(layout)
+}
+
+// relative formats the distance between t and now, e.g. "3m ago" or "in 5s".
+func relative(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 {
+		return "in " + compactDuration(-d)
+	}
+	if d < time.Second {
+		return "just now"
+	}
+	return compactDuration(d) + " ago"
+}
+
+// compactDuration renders d with at most two units: "45s", "3m 20s", "2h 5m", "3d 4h".
+func compactDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		days := int(d.Hours()) / 24
+		return fmt.Sprintf("%dd %dh", days, int(d.Hours())%24)
+	}
+}
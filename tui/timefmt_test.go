@@ -0,0 +1,68 @@
+package tui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeFormatter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 14, 32, 7, 0, time.Local)
+	tests := []struct {
+		name            string
+		t               time.Time
+		rel, abs, abs12 string
+	}{
+		{"zero", time.Time{}, "-", "-", "-"},
+		{"sub-second", now.Add(-300 * time.Millisecond), "just now", "14:32:06", "2:32:06 PM"},
+		{"seconds", now.Add(-45 * time.Second), "45s ago", "14:31:22", "2:31:22 PM"},
+		{"minutes", now.Add(-(3*time.Minute + 20*time.Second)), "3m 20s ago", "14:28:47", "2:28:47 PM"},
+		{"hours", now.Add(-(2*time.Hour + 5*time.Minute)), "2h 5m ago", "12:27:07", "12:27:07 PM"},
+		{"yesterday", now.Add(-15 * time.Hour), "15h 0m ago", "2026-02-28 23:32:07", "2026-02-28 11:32:07 PM"},
+		{"days", now.Add(-(3*24*time.Hour + 4*time.Hour)), "3d 4h ago", "2026-02-26 10:32:07", "2026-02-26 10:32:07 AM"},
+		{"future", now.Add(5 * time.Second), "in 5s", "14:32:12", "2:32:12 PM"},
+	}
+	for _, tt := range tests {
+		if got := (timeFormatter{}).format(tt.t, now); got != tt.rel {
+			t.Errorf("%s relative: got %q, want %q", tt.name, got, tt.rel)
+		}
+		if got := (timeFormatter{absolute: true}).format(tt.t, now); got != tt.abs {
+			t.Errorf("%s absolute: got %q, want %q", tt.name, got, tt.abs)
+		}
+		if got := (timeFormatter{absolute: true, hour12: true}).format(tt.t, now); got != tt.abs12 {
+			t.Errorf("%s 12-hour: got %q, want %q", tt.name, got, tt.abs12)
+		}
+	}
+}
+
+func TestCompactDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0ms"},
+		{999 * time.Millisecond, "999ms"},
+		{time.Second, "1s"},
+		{59*time.Second + 900*time.Millisecond, "59s"},
+		{time.Hour - time.Second, "59m 59s"},
+		{24*time.Hour - time.Minute, "23h 59m"},
+		{24 * time.Hour, "1d 0h"},
+		{400 * 24 * time.Hour, "400d 0h"},
+	}
+	for _, tt := range tests {
+		if got := compactDuration(tt.d); got != tt.want {
+			t.Errorf("compactDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTimeToggleIsImmediate(t *testing.T) {
+	m := newTestModel()
+	m, _ = press(t, m, "T")
+	if !m.times.absolute {
+		t.Fatal("T did not switch to absolute times")
+	}
+	m, _ = press(t, m, "T")
+	if m.times.absolute {
+		t.Fatal("T did not switch back")
+	}
+}
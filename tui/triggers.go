@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ping-tracker/policy"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openTriggers shows the R overlay, or says how to add rules.
+func (m *Model) openTriggers() {
+	if len(m.tracker.Triggers()) == 0 {
+		m.notice = "No trigger rules; add them to triggers in the config file"
+		return
+	}
+	m.pushMode(&triggersMode{})
+}
+
+// triggersMode is the R overlay: the trigger rules, each enabled or
+// disabled with Space.
+type triggersMode struct {
+	selected int
+}
+
+func (tm *triggersMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	rules := m.tracker.Triggers()
+	switch msg.String() {
+	case "R":
+		m.cancelMode(tm)
+	case "up", "k":
+		if tm.selected > 0 {
+			tm.selected--
+		}
+	case "down", "j":
+		if tm.selected < len(rules)-1 {
+			tm.selected++
+		}
+	case " ", "enter":
+		if tm.selected < len(rules) {
+			r := rules[tm.selected]
+			m.tracker.SetTriggerEnabled(r.Name, !r.Enabled)
+		}
+	}
+	return m, nil, true
+}
+
+func (tm *triggersMode) cancel(m *Model) {}
+
+func (tm *triggersMode) view(m Model) string { return m.renderTriggers(tm) }
+
+// renderTriggers lists the trigger rules: whether each is enabled, when it
+// runs, its command, and what it did this session.
+func (m Model) renderTriggers(tm *triggersMode) string {
+	rules := m.tracker.Triggers()
+	tm.selected = max(0, min(tm.selected, len(rules)-1))
+	now := time.Now()
+	lines := []string{m.st(styleTitle).Render(fmt.Sprintf("Trigger rules (%d)", len(rules))), ""}
+	switch m.policy.Check(policy.Triggers) {
+	case policy.Deny:
+		lines = append(lines, m.st(styleWarn).Render("  Read-only: no trigger command runs"), "")
+	case policy.Simulate:
+		lines = append(lines, m.st(styleWarn).Render("  Dry run: commands are logged, not run"), "")
+	}
+	lines = append(lines, m.st(styleHeader).Render(fmt.Sprintf("  %-3s %-18s %-12s %-24s %5s %5s %5s  %s", "", "Rule", "On", "Filter", "Runs", "Fail", "Skip", "Last")))
+	for i, r := range rules {
+		box := "[ ]"
+		if r.Enabled {
+			box = "[x]"
+		}
+		filter := r.Filter
+		if filter == "" {
+			filter = "(any)"
+		}
+		last := "-"
+		if !r.Last.IsZero() {
+			last = m.times.format(r.Last, now)
+		}
+		if r.Running > 0 {
+			last += " running"
+		}
+		line := fmt.Sprintf("  %-3s %-18s %-12s %-24s %5d %5d %5d  %s", box, truncStr(r.Name, 18), r.On, truncStr(filter, 24),
+			r.Runs, r.Failures, r.Skipped, last)
+		if i == tm.selected {
+			line = m.st(styleSelection).Render(padRight(line, m.width))
+		} else if r.Failures > 0 {
+			line = m.st(styleWarn).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if tm.selected < len(rules) {
+		r := rules[tm.selected]
+		lines = append(lines, "",
+			fmt.Sprintf("  Command:  %s", policy.Argv(r.Argv)),
+			fmt.Sprintf("  Limits:   at most once per %s, killed after %s", r.MinInterval, r.Timeout))
+		if r.Result != "" {
+			lines = append(lines, fmt.Sprintf("  Result:   %s", truncStr(r.Result, max(20, m.width-14))))
+		}
+	}
+	lines = append(lines, "", m.st(styleStatus).Render("Space: enable/disable (until restart)  R/Esc: close"))
+	return strings.Join(lines, "\n")
+}
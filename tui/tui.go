@@ -1,53 +1,29 @@
 package tui
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	"ping-tracker/agent"
+	"ping-tracker/policy"
 	"ping-tracker/tracker"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
-// Styles
-var (
-	titleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("170")).
-			PaddingLeft(1)
-
-	headerStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("39")).
-			Background(lipgloss.Color("236"))
-
-	rowStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252"))
-
-	selectedStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("229")).
-			Background(lipgloss.Color("57"))
-
-	searchStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("213")).
-			Bold(true)
-
-	statusBarStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241")).
-			PaddingLeft(1)
+type tickMsg time.Time
 
-	goodPing = lipgloss.NewStyle().Foreground(lipgloss.Color("46"))  // green
-	okPing   = lipgloss.NewStyle().Foreground(lipgloss.Color("226")) // yellow
-	badPing  = lipgloss.NewStyle().Foreground(lipgloss.Color("196")) // red
+// quitExpiredMsg clears an unconfirmed quit prompt.
+type quitExpiredMsg struct{}
 
-	dirIn  = lipgloss.NewStyle().Foreground(lipgloss.Color("87"))
-	dirOut = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
-)
-
-type tickMsg time.Time
+// quitConfirmWindow is how long a quit prompt waits for confirmation.
+const quitConfirmWindow = 2 * time.Second
 
 // SortField defines which column to sort by.
 type SortField int
@@ -59,22 +35,189 @@ const (
 	SortTxRate
 	SortRxRate
 	SortState
+	SortLossTrend
+	SortAudit
+	SortStateTime
+	SortScore
+	SortDerived // the derived column at Model.sortDerived
+
+	// Only in the F4 sort picker, for the columns without a hotkey
+	SortPID
+	SortDir
+	SortProto
+	SortEnc
+	SortLocal
+	SortRemote
+	SortShare
+	SortStall
+	SortQoS
+	SortSendQ
+	SortRecvQ
+	SortHost
+	SortNetns
+	SortCC
+
+	// Groups only, with U
+	SortSockMem
 )
 
 // Model is the bubbletea model for the TUI.
 type Model struct {
 	tracker     *tracker.Tracker
+	remotes     *agent.Multi // nil unless -connect was given
 	connections []*tracker.Connection
 	filter      string
-	searching   bool
 	cursor      int
 	offset      int // scroll offset for viewport
 	width       int
 	height      int
 	sortField   SortField
 	sortAsc     bool
-	paused      bool
-	showHelp    bool
+
+	groupSort    SortField // order of group rows (shift+number); sortField orders the rows in a group
+	groupSortAsc bool
+	paused       bool
+	showShare    bool
+	showStall    bool
+	showQoS      bool
+	showCC       bool
+
+	policy      policy.Mode // what the keys of keyActions may do (-read-only, -dry-run)
+	showQueues  bool
+	showNetns   bool
+	groupBy     groupMode
+	groups      []tracker.Group
+	drillGroup  string // key of the group shown as connections
+	deltaOffset int
+	deltaLog    []deltaEntry
+	deltaPrev   []*tracker.Connection // unfiltered snapshot of the previous refresh
+	deltaOpts   tracker.DiffOptions
+	clientSort  int // listener client list order in the detail view
+	times       timeFormatter
+	anon        *anonymizer // non-nil while anonymization is on
+	compactPort bool        // abbreviate ephemeral local ports as :*
+	openCmd     []string    // argv template run by o; nil for the default
+	pal         *palette    // colors of every styled element (C cycles)
+
+	pendingSelect string // connection key to select on the next refresh (session restore)
+
+	pathView    *pathProbeView                 // non-nil while the Q overlay is open
+	pathResults map[string]tracker.PathQuality // path probe results by remote address, for the session
+
+	refs    []tracker.Reference // snapshots pinned with F5, oldest first
+	refSeq  int                 // number of the last pinned reference
+	compare *compareView        // non-nil while the F6 overlay is open
+
+	reloadConfig ConfigReloader
+
+	thresholds     *thresholdEditor // non-nil while the F2 editor is open
+	saveThresholds func(tracker.AlertRule) error
+	notice         string // one-off status message, cleared by the next key
+
+	confirmQuit bool
+	shares      map[string]float64 // percent of visible throughput, by connection key
+	totalTx     float64
+	totalRx     float64
+
+	rows *rowCache // styled rows of the last frame, shared by Model copies
+
+	// Skipping unchanged ticks: the tracker generation the rows were built
+	// from, whether a message since may have changed them, and the frame
+	// revision (see frameKey)
+	gen   uint64
+	stale bool
+	rev   uint64
+	frame *frameCache
+	snaps *snapBuffers
+
+	// Rate sort hysteresis: the relative change needed to reorder rows
+	// sorted by TX or RX, and the order of the previous refresh
+	sortHysteresis float64
+	prevOrder      *rateOrder
+
+	lag        string // stale data warning from the last refresh; empty while scans keep up
+	notifyWarn string // alert notifications failing lately; empty otherwise
+
+	// Accessible mode: linear, speakable output instead of the table
+	a11y      bool
+	verbosity int
+	announced []*tracker.Connection // snapshot the last announcement was diffed against
+
+	// First-run introduction: the page shown (1-3, 0 when hidden) and how
+	// its dismissal is recorded
+	onboardingPage int
+	saveOnboarding func() error
+
+	// F10 diagnostics: the capture, its CPU sampling time and whether one
+	// is running
+	profile    func() ([]string, error)
+	profileFor time.Duration
+	profiling  bool
+
+	ports *portDistView // non-nil while the P overlay is open
+
+	// Forwarded traffic (-conntrack): the O view, the totals of the origins
+	// shown and whether the last snapshot held any forwarded flow
+	originView originView
+	origins    map[tracker.Origin]tracker.OriginSummary
+	forwarding bool
+
+	overflow tracker.Overflow // sockets beyond -max-connections in the last scan
+
+	// User-defined derived columns, and which one x sorts by
+	derived     []tracker.DerivedColumn
+	sortDerived int
+
+	// The order among rows the sort field ties, set in the F4 picker; nil
+	// for none
+	sortThen *sortLevel
+
+	schedule tracker.ScheduleStatus // the schedule window in effect, e.g. quiet hours
+
+	probeUsage tracker.ProbeUsage // probe traffic and the -probe-budget state
+
+	// Load throttle state, and the time of the last transition added to
+	// the delta log
+	load     tracker.LoadStatus
+	loadSeen time.Time
+
+	// The time of the last outage event added to the delta log
+	outageSeen time.Time
+
+	// Closing-state sockets: how they are shown (H), and how many of the
+	// rows' sockets are in one and in none
+	closingMode closingMode
+	closing     int
+	active      int
+
+	clockSeen time.Time // the last suspend or clock step noted
+
+	// F3 panel: public addresses from STUN, looked up when it opens
+	netView     *netContextView // non-nil while the panel is open
+	netCtx      *tracker.NetContext
+	stunServer  string
+	stunServer2 string
+
+	// -inject perturbations in effect, for the watermark
+	injections     []tracker.Injection
+	injectedRemote bool // a remote agent's rows are injected
+
+	modes []mode // overlays, prompts and editors open over the table, bottom first
+
+	// F7 deep-dive probe rate and duration; zero for the defaults
+	deepDiveRate int
+	deepDiveFor  time.Duration
+
+	// F focus loop cadence, zero for the default, and the arming whose
+	// updates are awaited
+	focusEvery time.Duration
+	focusGen   int
+
+	marked map[string]bool // rows marked with Space for F8, by key
+
+	written []string // files saved from the UI, for the session summary
+
+	sandbox tracker.Sandbox // the container the tracker runs in, if any
 }
 
 // NewModel creates a new TUI model.
@@ -83,11 +226,68 @@ func NewModel(t *tracker.Tracker) Model {
 		tracker:   t,
 		sortField: SortApp,
 		sortAsc:   true,
-		width:     120,
-		height:    30,
+
+		groupSort:    SortApp,
+		groupSortAsc: true,
+		deltaOpts:    defaultDeltaOptions,
+		rows:         newRowCache(),
+		frame:        &frameCache{},
+		snaps:        &snapBuffers{},
+		pal:          palettes[0],
+		width:        120,
+		pathResults:  make(map[string]tracker.PathQuality),
+		height:       30,
+
+		sortHysteresis: DefaultSortHysteresis,
 	}
 }
 
+// SetRemotes merges connections from remote agents into the view.
+func (m *Model) SetRemotes(r *agent.Multi) {
+	m.remotes = r
+}
+
+// SetAccessible switches to linear, screen-reader friendly output. Each
+// refresh announces changes allowed by the verbosity level.
+func (m *Model) SetAccessible(verbosity int) {
+	m.a11y = true
+	m.verbosity = verbosity
+}
+
+// SetConfirmQuit requires q to be pressed twice (or q then y) to quit.
+func (m *Model) SetConfirmQuit(on bool) {
+	m.confirmQuit = on
+}
+
+// SetTimeDisplay sets whether times start out absolute and whether clocks use 12-hour format.
+func (m *Model) SetTimeDisplay(absolute, hour12 bool) {
+	m.times = timeFormatter{absolute: absolute, hour12: hour12}
+}
+
+// SetAnonymize turns on masking of addresses, app names and hosts.
+func (m *Model) SetAnonymize(on bool) {
+	m.anon = nil
+	if on {
+		m.anon = newAnonymizer()
+	}
+}
+
+// SetCompactPorts abbreviates ephemeral local ports and annotates service ports.
+func (m *Model) SetCompactPorts(on bool) {
+	m.compactPort = on
+}
+
+// SetThresholdSaver sets how thresholds confirmed in the F2 editor are persisted.
+func (m *Model) SetThresholdSaver(save func(tracker.AlertRule) error) {
+	m.saveThresholds = save
+}
+
+// SetNamespaceColumn shows the network namespace of each connection
+// (-all-netns).
+func (m *Model) SetNamespaceColumn(on bool) {
+	m.showNetns = on
+}
+
 // SetFilter sets the initial app name filter.
 func (m *Model) SetFilter(f string) {
 	m.filter = f
@@ -104,19 +304,61 @@ func (m Model) Init() tea.Cmd {
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(tickMsg); !ok {
+		m.stale = true
+		m.rev++
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		return m.handleKey(msg)
 
 	case tickMsg:
+		reloaded := m.checkConfig(false)
+		if !m.paused && !reloaded && !m.a11y && !m.needsRebuild() {
+			// Same connections as the last tick: only the status can
+			// have moved, and View reuses the frame if it did not.
+			m.refreshStatus()
+			return m, tickCmd()
+		}
 		if !m.paused {
 			m.refresh()
+			if m.a11y && m.silent() {
+				m.announced = cloneConns(m.connections) // nothing piles up for the end of the window
+			} else if m.a11y {
+				return m, tea.Batch(tickCmd(), m.announceChanges())
+			}
 		}
 		return m, tickCmd()
 
+	case pathProbeMsg:
+		return m.handlePathProbeMsg(msg)
+
+	case netContextMsg:
+		return m.handleNetContextMsg(msg)
+
+	case deepDiveTickMsg:
+		return m.handleDeepDiveTick()
+
+	case profileDoneMsg:
+		return m.handleProfileDone(msg)
+
+	case focusUpdateMsg:
+		return m.handleFocusUpdate(msg)
+
+	case openResultMsg:
+		m.notice = fmt.Sprintf("%s failed: %v", msg.name, msg.err)
+		return m, nil
+
+	case quitExpiredMsg:
+		if q, ok := findMode[*quitMode](m); ok && time.Since(q.at) >= quitConfirmWindow {
+			m.endMode(q)
+		}
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.rows.reset()
 		return m, nil
 	}
 
@@ -124,25 +366,111 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) refresh() {
-	if m.filter != "" {
-		m.connections = m.tracker.Search(m.filter)
-	} else {
-		m.connections = m.tracker.Snapshot()
+	m.tracker.SetFocusQuery(m.filter)
+	m.gen, m.stale = m.tracker.Generation(), false
+	m.rev++
+	var remote []*tracker.Connection
+	if m.remotes != nil {
+		remote = m.remotes.Snapshot()
 	}
+	all := m.snaps.fill(m.tracker, remote)
+	m.recordDelta(all)
+	m.pruneMarks(all)
+	m.refreshStatus()
+	m.refreshInjections(all)
+	m.connections = tracker.FilterConnections(all, m.filter)
+	m.filterOrigin(all)
+	m.applyGrouping()
+	m.origins = tracker.SummarizeOrigins(m.connections)
+	m.computeTotals()
+	m.collapseClosing()
+	m.collapseShares()
 	m.sortConnections()
+	m.groupOrigins()
+
+	if m.pendingSelect != "" {
+		for i, c := range m.connections {
+			if c.Key() == m.pendingSelect {
+				m.cursor = i
+				if m.cursor >= m.visibleRows() {
+					m.offset = m.cursor - m.visibleRows() + 1
+				}
+				break
+			}
+		}
+		m.pendingSelect = ""
+	}
+	// Rows that closed under the cursor leave it on the last one.
+	if n := m.rowCount(); m.cursor >= n {
+		m.cursor = max(0, n-1)
+		m.offset = min(m.offset, m.cursor)
+	}
+}
+
+// refreshStatus picks up what the status lines show from the tracker,
+// which can change while its connections do not.
+func (m *Model) refreshStatus() {
+	h := m.tracker.Health()
+	m.lag = lagWarning(h, time.Now())
+	m.notifyWarn = notifyWarning(h, time.Now())
+	m.overflow = m.tracker.Overflow()
+	m.refreshDerived()
+	m.refreshSchedule()
+	m.probeUsage = m.tracker.ProbeUsage()
+	m.refreshLoad()
+	m.refreshOutages()
+	m.refreshClock()
+}
+
+// computeTotals recomputes throughput shares and footer totals over the
+// filtered set, before any display sorting.
+func (m *Model) computeTotals() {
+	m.shares, _ = tracker.ComputeShares(m.connections)
+	m.totalTx, m.totalRx = 0, 0
+	for _, c := range m.connections {
+		m.totalTx += c.TxRate
+		m.totalRx += c.RxRate
+	}
 }
 
+// handleKey gives a key to the open modes, top first, and then to the
+// table. Ctrl+C always quits and Esc always closes the top mode.
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if m.searching {
-		return m.handleSearchKey(msg)
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+	if !m.typing() {
+		m.notice = ""
+		if msg.String() == "ctrl+r" {
+			m.checkConfig(true)
+			return m, nil
+		}
+	}
+	if top := m.topMode(); top != nil && msg.String() == "esc" {
+		m.cancelMode(top)
+		return m, nil
+	}
+	m, cmd, handled := m.handleModeKey(msg)
+	if handled {
+		return m, cmd
+	}
+	if m.gate(keyActions, msg.String()) {
+		return m, nil
+	}
+	if m.a11y {
+		return m.handleAccessibleKey(msg)
 	}
 
 	switch msg.String() {
-	case "q", "ctrl+c":
-		return m, tea.Quit
+	case "q":
+		return m.requestQuit()
 
 	case "/":
-		m.searching = true
+		m.openSearch()
+		return m, nil
+
+	case "'", ":":
+		m.pushMode(&gotoMode{})
 		return m, nil
 
 	case "up", "k":
@@ -154,7 +482,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case "down", "j":
-		if m.cursor < len(m.connections)-1 {
+		if m.cursor < m.rowCount()-1 {
 			m.cursor++
 			maxVisible := m.visibleRows()
 			if m.cursor >= m.offset+maxVisible {
@@ -166,8 +494,14 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.cursor = 0
 		m.offset = 0
 
+	case "]":
+		m.jumpApp(1)
+
+	case "[":
+		m.jumpApp(-1)
+
 	case "end", "G":
-		m.cursor = maxInt(0, len(m.connections)-1)
+		m.cursor = maxInt(0, m.rowCount()-1)
 		maxVisible := m.visibleRows()
 		if m.cursor >= maxVisible {
 			m.offset = m.cursor - maxVisible + 1
@@ -185,9 +519,39 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.toggleSort(SortRxRate)
 	case "6":
 		m.toggleSort(SortState)
+	case "7":
+		m.toggleSort(SortLossTrend)
+	case "8":
+		m.toggleSort(SortAudit)
+	case "9":
+		m.toggleSort(SortStateTime)
+	case "0":
+		m.toggleSort(SortScore)
+	case "x":
+		m.cycleDerivedSort()
+	case "!", "@", "#", "$", "%", "^", "&", "*", "(", ")":
+		m.toggleGroupSort(shiftedDigits[msg.String()])
+
+	case "U":
+		m.toggleGroupSort(SortSockMem)
 
 	case "p":
-		m.paused = !m.paused
+		m.togglePause()
+
+	case "s":
+		m.showShare = !m.showShare
+
+	case "w":
+		m.showStall = !m.showStall
+
+	case "t":
+		m.showQoS = !m.showQoS
+
+	case "K":
+		m.showCC = !m.showCC
+
+	case "u":
+		m.showQueues = !m.showQueues
 
 	case "r":
 		m.refresh()
@@ -196,38 +560,242 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.filter = ""
 		m.cursor = 0
 		m.offset = 0
+		m.rows.reset()
 		m.refresh()
 
+	case "enter":
+		if m.listingGroups() && m.groupBy == groupApp {
+			m.openPortDist()
+		} else if m.listingGroups() {
+			if m.cursor < len(m.groups) {
+				m.drillInto(m.groups[m.cursor].Key)
+			}
+		} else if m.cursor < len(m.connections) && m.connections[m.cursor].Closing != nil {
+			m.notice = "Press H to list closing sockets one per row"
+		} else if m.cursor < len(m.connections) {
+			m.pushMode(&detailMode{})
+		}
+
+	case "b":
+		m.cycleGrouping()
+
+	case "H":
+		m.cycleClosing()
+
+	case "O":
+		m.cycleOrigin()
+
+	case "D":
+		m.pushMode(&perfMode{})
+
+	case "L":
+		if m.sandboxBanner() != "" {
+			m.pushMode(&sandboxMode{})
+		}
+
+	case "v":
+		m.openDualStack()
+
+	case "W":
+		m.openHeatmap()
+
+	case "R":
+		m.openTriggers()
+
+	case "z":
+		m.pushMode(&deltaMode{})
+		m.deltaOffset = 0
+
+	case "T":
+		m.times.absolute = !m.times.absolute
+
+	case "f9":
+		m.SetAnonymize(m.anon == nil)
+
+	case "e":
+		m.compactPort = !m.compactPort
+
+	case "a":
+		m.ackListener()
+
+	case "Q":
+		return m.openPathProbe()
+
+	case "P":
+		m.openPortDist()
+
+	case "M":
+		m.logMarker()
+
+	case "o":
+		return m.openSelected()
+
+	case "C":
+		m.cyclePalette()
+
+	case "f5":
+		m.pinReference()
+
+	case "f6":
+		m.openCompare()
+
+	case "f2":
+		m.openThresholds()
+
+	case "f4":
+		m.openSortPicker()
+
+	case "f3":
+		return m.openNetContext()
+
+	case "f7":
+		return m.openDeepDive()
+
+	case "f10":
+		return m.startProfile()
+
+	case " ":
+		m.toggleMark()
+
+	case "f8":
+		return m.openSnippet()
+
+	case "F":
+		return m.toggleFocus()
+
 	case "?":
-		m.showHelp = !m.showHelp
+		m.pushMode(&helpMode{})
 	}
 
 	return m, nil
 }
 
-func (m Model) handleSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+// requestQuit quits immediately, or with confirm-quit enabled arms a prompt
+// that a second q or y within quitConfirmWindow confirms.
+func (m Model) requestQuit() (tea.Model, tea.Cmd) {
+	if !m.confirmQuit {
+		return m, tea.Quit
+	}
+	m.pushMode(&quitMode{at: time.Now()})
+	return m, tea.Tick(quitConfirmWindow, func(time.Time) tea.Msg {
+		return quitExpiredMsg{}
+	})
+}
+
+// handleAccessibleKey moves the cursor and reads the selected connection aloud.
+func (m Model) handleAccessibleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
-	case "enter":
-		m.searching = false
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.connections)-1 {
+			m.cursor++
+		}
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = maxInt(0, len(m.connections)-1)
+	case "/":
+		m.openSearch()
+		return m, nil
+	case "c":
+		m.filter = ""
 		m.cursor = 0
-		m.offset = 0
 		m.refresh()
+	case "p":
+		m.togglePause()
+		if m.paused {
+			return m, tea.Println("paused")
+		}
+		return m, tea.Println("resumed")
+	default:
+		return m, nil
+	}
+	if m.cursor >= len(m.connections) {
+		return m, tea.Println("no connections")
+	}
+	return m, tea.Println(fmt.Sprintf("%d of %d: %s", m.cursor+1, len(m.connections), speakConnection(m.connections[m.cursor])))
+}
 
-	case "esc":
-		m.searching = false
+// announceChanges prints one line per change since the last announcement.
+func (m *Model) announceChanges() tea.Cmd {
+	prev := m.announced
+	m.announced = cloneConns(m.connections)
+	if prev == nil {
+		return tea.Println(speakSummary(m.connections))
+	}
 
-	case "backspace":
-		if len(m.filter) > 0 {
-			m.filter = m.filter[:len(m.filter)-1]
+	var cmds []tea.Cmd
+	for _, ch := range tracker.DiffSnapshots(prev, m.connections, tracker.DefaultDiffOptions) {
+		if line := speakChange(ch, m.verbosity); line != "" {
+			cmds = append(cmds, tea.Println(line))
 		}
+	}
+	return tea.Sequence(cmds...)
+}
+
+// searchMode is the / prompt. The table filters as the query is typed;
+// Enter keeps the new filter, Esc puts back the one from before.
+type searchMode struct {
+	filter         string
+	cursor, offset int
+}
+
+// openSearch opens the search prompt on the current filter.
+func (m *Model) openSearch() {
+	m.pushMode(&searchMode{filter: m.filter, cursor: m.cursor, offset: m.offset})
+}
+
+func (s *searchMode) key(m Model, msg tea.KeyMsg) (Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter":
+		m.endMode(s)
+		m.cursor = 0
+		m.offset = 0
+		m.rows.reset()
+		m.refresh()
 
 	default:
-		if len(msg.String()) == 1 {
-			m.filter += msg.String()
-		}
+		m.filter = editInput(m.filter, msg)
 	}
 
-	return m, nil
+	return m, nil, true
+}
+
+func (s *searchMode) cancel(m *Model) {
+	m.filter = s.filter
+	m.rows.reset()
+	m.refresh()
+	m.offset = s.offset
+	m.moveCursor(minInt(s.cursor, maxInt(0, m.rowCount()-1)))
+}
+
+func (s *searchMode) typing() {}
+
+// editInput applies a key to a one-line prompt: printable text (including
+// pastes) is appended, backspace deletes a character, ctrl+w the last word
+// and ctrl+u the whole line. Other keys leave it unchanged.
+func editInput(s string, msg tea.KeyMsg) string {
+	switch msg.Type {
+	case tea.KeyRunes:
+		return s + string(msg.Runes)
+	case tea.KeySpace:
+		return s + " "
+	case tea.KeyBackspace:
+		if r := []rune(s); len(r) > 0 {
+			return string(r[:len(r)-1])
+		}
+	case tea.KeyCtrlW:
+		trimmed := strings.TrimRight(s, " ")
+		return trimmed[:strings.LastIndex(trimmed, " ")+1]
+	case tea.KeyCtrlU:
+		return ""
+	}
+	return s
 }
 
 func (m *Model) toggleSort(field SortField) {
@@ -238,28 +806,21 @@ func (m *Model) toggleSort(field SortField) {
 		m.sortAsc = true
 	}
 	m.sortConnections()
+	m.sortGroups()
+	m.rows.reset()
 }
 
 func (m *Model) sortConnections() {
+	m.fixSort()
+	primary := sortKey{field: m.sortField, derived: m.sortDerived}
 	sort.SliceStable(m.connections, func(i, j int) bool {
 		a, b := m.connections[i], m.connections[j]
+		if less, ok := m.compareClosing(a, b); ok {
+			return less
+		}
 
 		// Primary sort by selected field
-		cmp := 0
-		switch m.sortField {
-		case SortApp:
-			cmp = strings.Compare(strings.ToLower(a.AppName), strings.ToLower(b.AppName))
-		case SortPing:
-			cmp = compareDuration(a.Ping, b.Ping)
-		case SortLoss:
-			cmp = compareFloat(a.Loss, b.Loss)
-		case SortTxRate:
-			cmp = compareFloat(a.TxRate, b.TxRate)
-		case SortRxRate:
-			cmp = compareFloat(a.RxRate, b.RxRate)
-		case SortState:
-			cmp = strings.Compare(string(a.State), string(b.State))
-		}
+		cmp := m.compareBy(primary, a, b)
 		if !m.sortAsc {
 			cmp = -cmp
 		}
@@ -267,13 +828,108 @@ func (m *Model) sortConnections() {
 			return cmp < 0
 		}
 
-		// Secondary: OUT before IN
+		// Then by the picker's secondary key
+		if then := m.sortThen; then != nil {
+			cmp = m.compareBy(then.key, a, b)
+			if !then.asc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		// Last: OUT before IN
 		if a.Direction != b.Direction {
 			return a.Direction == tracker.Outbound
 		}
 
 		return false
 	})
+	m.applyHysteresis()
+}
+
+// compareBy orders a and b ascending by k.
+func (m Model) compareBy(k sortKey, a, b *tracker.Connection) int {
+	switch k.field {
+	case SortApp:
+		return strings.Compare(strings.ToLower(a.AppName), strings.ToLower(b.AppName))
+	case SortPing:
+		return compareDuration(a.Ping, b.Ping)
+	case SortLoss:
+		return compareFloat(a.Loss, b.Loss)
+	case SortTxRate:
+		return compareFloat(a.TxRate, b.TxRate)
+	case SortRxRate:
+		return compareFloat(a.RxRate, b.RxRate)
+	case SortState:
+		return strings.Compare(string(a.State), string(b.State))
+	case SortLossTrend:
+		return compareFloat(a.LossTrend.Delta, b.LossTrend.Delta)
+	case SortAudit:
+		return a.Audit.Score - b.Audit.Score
+	case SortStateTime:
+		return compareDuration(a.TimeInState(), b.TimeInState())
+	case SortScore:
+		return scoreKey(a) - scoreKey(b)
+	case SortDerived:
+		return m.compareDerived(k.derived, a, b)
+	case SortPID:
+		return a.PID - b.PID
+	case SortDir:
+		return strings.Compare(string(a.Direction), string(b.Direction))
+	case SortProto:
+		return strings.Compare(a.Protocol, b.Protocol)
+	case SortEnc:
+		return strings.Compare(string(a.Encryption), string(b.Encryption))
+	case SortLocal:
+		return cmp.Or(strings.Compare(a.LocalAddr, b.LocalAddr), a.LocalPort-b.LocalPort)
+	case SortRemote:
+		return cmp.Or(strings.Compare(a.RemoteAddr, b.RemoteAddr), a.RemotePort-b.RemotePort)
+	case SortShare:
+		return compareFloat(m.shares[a.Key()], m.shares[b.Key()])
+	case SortStall:
+		return compareDuration(stallKey(a), stallKey(b))
+	case SortQoS:
+		return qosKey(a) - qosKey(b)
+	case SortSendQ:
+		return cmp.Compare(a.SendQ, b.SendQ)
+	case SortRecvQ:
+		return cmp.Compare(a.RecvQ, b.RecvQ)
+	case SortHost:
+		return strings.Compare(a.Host, b.Host)
+	case SortNetns:
+		return strings.Compare(a.Namespace, b.Namespace)
+	case SortCC:
+		return strings.Compare(a.CongestionAlgo, b.CongestionAlgo)
+	}
+	return 0
+}
+
+// stallKey orders connections by how long they have stalled, the ones not
+// stalled first.
+func stallKey(c *tracker.Connection) time.Duration {
+	if c.StallSince.IsZero() {
+		return 0
+	}
+	return c.StallDuration()
+}
+
+// qosKey orders connections by DSCP, the ones without QoS data first.
+func qosKey(c *tracker.Connection) int {
+	if c.QoS == nil {
+		return -1
+	}
+	return c.QoS.DSCP()
+}
+
+// scoreKey orders connections by health score, worst first ascending, with
+// unscored ones after perfect ones.
+func scoreKey(c *tracker.Connection) int {
+	if !c.HasScore {
+		return 101
+	}
+	return c.Score
 }
 
 func compareDuration(a, b time.Duration) int {
@@ -298,170 +954,249 @@ func compareFloat(a, b float64) int {
 
 func (m Model) visibleRows() int {
 	// height minus: title(1) + header(1) + status(2) + search(1) + padding(1)
-	return maxInt(1, m.height-6)
+	rows := m.height - 6
+	if m.remotes != nil {
+		rows-- // source health banner
+	}
+	if m.lag != "" {
+		rows-- // stale data banner
+	}
+	if m.notifyWarn != "" {
+		rows-- // failing notifications banner
+	}
+	if m.probeUsage.Exceeded {
+		rows-- // probe budget banner
+	}
+	if m.injecting() {
+		rows-- // injection watermark
+	}
+	if m.sandboxBanner() != "" {
+		rows-- // sandbox banner
+	}
+	if m.thresholds != nil {
+		rows -= thresholdPanelHeight() - 1 // the panel replaces the status bar
+	}
+	rows -= m.sectionLines()
+	if m.overflow.Conns > 0 {
+		rows-- // overflow footer
+	}
+	return maxInt(1, rows)
 }
 
 func (m Model) View() string {
-	if m.showHelp {
-		return m.renderHelp()
+	if m.a11y {
+		if _, ok := findMode[*searchMode](m); ok {
+			return "search: " + m.filter
+		}
+		return ""
+	}
+	now := time.Now()
+	key := m.frameKey()
+	if s, ok := m.frame.get(key, now); ok {
+		return s
 	}
+	s := m.render()
+	m.frame.put(key, now, s)
+	return s
+}
 
-	var b strings.Builder
+// render draws the frame.
+func (m Model) render() string {
+	if s := m.modeView(); s != "" {
+		return s
+	}
 
-	// Title
-	pauseStr := ""
-	if m.paused {
-		pauseStr = " [PAUSED]"
+	var b strings.Builder
+	b.WriteString(renderTitle(m.pal, m.titleText(), m.width) + "\n")
+	b.WriteString(m.renderSearchBar() + "\n")
+	if m.remotes != nil {
+		b.WriteString(m.renderSources() + "\n")
+	}
+	if m.lag != "" {
+		b.WriteString(m.st(styleWarn).Render(truncate(" "+m.lag, m.width)) + "\n")
+	}
+	if m.notifyWarn != "" {
+		b.WriteString(m.st(styleWarn).Render(truncate(" "+m.notifyWarn, m.width)) + "\n")
+	}
+	if s := m.budgetBanner(); s != "" {
+		b.WriteString(m.st(styleWarn).Render(truncate(" "+s, m.width)) + "\n")
+	}
+	if s := m.injectBanner(); s != "" {
+		b.WriteString(m.st(styleRowCrit).Render(truncate(" "+s, m.width)) + "\n")
+	}
+	if s := m.sandboxBanner(); s != "" {
+		b.WriteString(m.st(styleWarn).Render(truncate(" "+s, m.width)) + "\n")
 	}
-	title := titleStyle.Render(fmt.Sprintf("Ping Tracker - %d connections%s", len(m.connections), pauseStr))
-	b.WriteString(title + "\n")
 
-	// Search bar
-	if m.searching {
-		b.WriteString(searchStyle.Render("Search: ") + m.filter + "\u2588\n")
-	} else if m.filter != "" {
-		b.WriteString(searchStyle.Render("Filter: ") + m.filter + "\n")
+	var preview *tracker.AlertRule
+	if m.thresholds != nil {
+		r := m.previewRule()
+		preview = &r
+	}
+	if m.listingGroups() {
+		m.renderGroupRows(&b)
 	} else {
-		b.WriteString("\n")
-	}
-
-	// Column widths
-	colPID := 7
-	colApp := 18
-	colPing := 10
-	colLoss := 7
-	colDir := 4
-	colProto := 6
-	colLocal := 22
-	colRemote := 22
-	colState := 12
-	colTx := 10
-	colRx := 10
-
-	// Header - use padRight for consistency with row rendering
-	header := padRight("PID", colPID) + " " + padRight("[1]App", colApp) + " " +
-		padRight("[2]Ping", colPing) + " " + padRight("[3]Loss", colLoss) + " " +
-		padRight("Dir", colDir) + " " + padRight("Proto", colProto) + " " +
-		padRight("Local", colLocal) + " " + padRight("Remote", colRemote) + " " +
-		padRight("[6]State", colState) + " " + padRight("[4]TX", colTx) + " " +
-		padRight("[5]RX", colRx)
-	b.WriteString(headerStyle.Render(truncate(header, m.width)) + "\n")
-
-	// Rows
-	maxRows := m.visibleRows()
-	end := minInt(m.offset+maxRows, len(m.connections))
-
-	for i := m.offset; i < end; i++ {
-		c := m.connections[i]
-		row := m.renderRow(c, colPID, colApp, colPing, colLoss, colDir, colProto, colLocal, colRemote, colState, colTx, colRx)
-
-		if i == m.cursor {
-			b.WriteString(selectedStyle.Render(row) + "\n")
-		} else {
-			b.WriteString(rowStyle.Render(row) + "\n")
-		}
+		lines := m.renderTable(tableView{
+			conns:   m.connections,
+			layout:  m.tableLayout(),
+			cursor:  m.cursor,
+			offset:  m.offset,
+			height:  m.visibleRows() + m.sectionLines(),
+			width:   m.width,
+			preview: preview,
+		})
+		b.WriteString(strings.Join(lines, "\n") + "\n")
 	}
 
-	// Pad empty rows
-	for i := end - m.offset; i < maxRows; i++ {
-		b.WriteString("\n")
+	if m.overflow.Conns > 0 {
+		b.WriteString(m.st(styleStale).Render(truncate(m.overflowText(), m.width)) + "\n")
 	}
 
-	// Status bar
-	sortNames := []string{"App", "Ping", "Loss", "TX", "RX", "State"}
-	sortDir := "asc"
-	if !m.sortAsc {
-		sortDir = "desc"
+	if preview != nil {
+		b.WriteString(m.renderThresholds(*preview))
+		return b.String()
 	}
-	status := fmt.Sprintf(" Sort: %s (%s) | /:search  c:clear  p:pause  r:refresh  1-6:sort  ?:help  q:quit",
-		sortNames[m.sortField], sortDir)
-	b.WriteString(statusBarStyle.Render(truncate(status, m.width)))
-
+	b.WriteString(renderStatusBar(m.pal, m.statusText(), m.width))
 	return b.String()
 }
 
-func (m Model) renderRow(c *tracker.Connection, colPID, colApp, colPing, colLoss, colDir, colProto, colLocal, colRemote, colState, colTx, colRx int) string {
-	// Format local/remote
-	local := fmt.Sprintf("%s:%d", c.LocalAddr, c.LocalPort)
-	remote := fmt.Sprintf("%s:%d", c.RemoteAddr, c.RemotePort)
-
-	// Format plain text for direction
-	dirPlain := string(c.Direction)
-	var dirStyle lipgloss.Style
-	if c.Direction == tracker.Inbound {
-		dirPlain = "IN"
-		dirStyle = dirIn
-	} else {
-		dirPlain = "OUT"
-		dirStyle = dirOut
-	}
-
-	// Format plain text for ping
-	pingPlain := "-"
-	var pingStyle lipgloss.Style
-	if c.Ping > 0 {
-		ms := float64(c.Ping.Microseconds()) / 1000.0
-		pingPlain = fmt.Sprintf("%.1fms", ms)
-		switch {
-		case ms < 50:
-			pingStyle = goodPing
-		case ms < 150:
-			pingStyle = okPing
-		default:
-			pingStyle = badPing
+// titleText is the title line: the connection count and mode tags.
+func (m Model) titleText() string {
+	tags := ""
+	if m.paused {
+		tags = " [PAUSED]"
+	}
+	if m.tracker.RecordingIncident() {
+		tags += " [recording incident\u2026]"
+	}
+	if m.anon != nil {
+		tags += " [ANONYMIZED]"
+	}
+	if m.injecting() {
+		tags = " [INJECTION ACTIVE]" + tags
+	}
+	if n := m.newListeners(); n > 0 {
+		tags += fmt.Sprintf(" [%d new listener%s, a: acknowledge]", n, plural(n))
+	}
+	if m.originView != originBoth {
+		tags += " [" + originViewNames[m.originView] + "]"
+	}
+	if m.groupBy != groupNone {
+		tags += fmt.Sprintf(" [by %s: %s groups]", groupModeNames[m.groupBy], locale.Int(len(m.groups)))
+		if m.drillGroup != "" {
+			tags = fmt.Sprintf(" [%s %s, Esc: back]", groupModeNames[m.groupBy], m.drillGroup)
 		}
 	}
+	if m.overflow.Conns > 0 {
+		tags = fmt.Sprintf(" [+%s over -max-connections]", locale.Int(m.overflow.Conns)) + tags
+	}
+	if m.closing > 0 {
+		return fmt.Sprintf("Ping Tracker - %s active + %s closing%s", locale.Int(m.active), shortCount(m.closing), tags)
+	}
+	return fmt.Sprintf("Ping Tracker - %s connections%s", locale.Int(len(m.connections)), tags)
+}
+
+// renderTitle styles the title line, cut to width.
+func renderTitle(p *palette, text string, width int) string {
+	return p.styles[styleTitle].Render(truncate(text, width-1)) // -1 for the style's left padding
+}
+
+// renderSearchBar is the line under the title: the search or goto prompt
+// while typing, the active filter, or blank.
+func (m Model) renderSearchBar() string {
+	if g, ok := m.topMode().(*gotoMode); ok {
+		return m.st(styleSearch).Render("Go to: ") + g.query + "\u2588  (row number, app or address)"
+	}
+	_, searching := m.topMode().(*searchMode)
+	switch {
+	case searching:
+		return m.st(styleSearch).Render("Search: ") + m.filter + "\u2588"
+	case m.filter != "":
+		return m.st(styleSearch).Render("Filter: ") + m.filter
+	}
+	return ""
+}
 
-	// Format plain text for loss
-	lossPlain := "-"
-	var lossStyle lipgloss.Style
-	if c.PingCount > 0 {
-		lossPlain = fmt.Sprintf("%.0f%%", c.Loss)
-		switch {
-		case c.Loss < 1:
-			lossStyle = goodPing
-		case c.Loss < 10:
-			lossStyle = okPing
-		default:
-			lossStyle = badPing
+// statusText is the status bar content: a pending prompt, a notice, or the
+// sort, totals and key hints.
+func (m Model) statusText() string {
+	if p := m.promptText(); p != "" {
+		return p
+	}
+	if m.notice != "" {
+		return " " + m.notice
+	}
+	sortName := m.sortKeyName(sortKey{field: m.sortField, derived: m.sortDerived})
+	sortDir := tr("status.asc")
+	if !m.sortAsc {
+		sortDir = tr("status.desc")
+	}
+	if then := m.sortThen; then != nil {
+		thenDir := tr("status.asc")
+		if !then.asc {
+			thenDir = tr("status.desc")
 		}
+		sortDir += ", " + m.sortKeyName(then.key) + " " + thenDir
+	}
+	if m.groupBy != groupNone {
+		sortDir += "; " + trf("status.groups", m.groupSortName())
 	}
+	schedule := ""
+	if s := m.scheduleText(); s != "" {
+		schedule = " " + s + " |"
+	}
+	if s := m.loadText(); s != "" {
+		schedule += " " + s + " |"
+	}
+	if m.profiling {
+		schedule += " " + tr("status.profiling") + " |"
+	}
+	if s := m.policyText(); s != "" {
+		schedule += " " + s + " |"
+	}
+	if s := m.focusText(); s != "" {
+		schedule += " " + s + " |"
+	}
+	return fmt.Sprintf("%s|%s %s | %s | %s", m.perfSummary(), schedule, trf("status.sort", sortName, sortDir),
+		trf("status.totals", locale.Number(tracker.FormatBytes(m.totalTx)), locale.Number(tracker.FormatBytes(m.totalRx))),
+		tr("status.keys"))
+}
 
-	// Build each cell as padded plain text, then apply color to content only.
-	// This avoids ANSI escape codes breaking fmt.Sprintf alignment.
-	pidCell := padRight(fmt.Sprintf("%d", c.PID), colPID)
-	appCell := padRight(truncStr(c.AppName, colApp), colApp)
-	pingCell := styledPadRight(pingPlain, pingStyle, colPing)
-	lossCell := styledPadRight(lossPlain, lossStyle, colLoss)
-	dirCell := styledPadRight(dirPlain, dirStyle, colDir)
-	protoCell := padRight(c.Protocol, colProto)
-	localCell := padRight(truncStr(local, colLocal), colLocal)
-	remoteCell := padRight(truncStr(remote, colRemote), colRemote)
-	stateCell := padRight(string(c.State), colState)
-	txCell := padRight(tracker.FormatBytes(c.TxRate), colTx)
-	rxCell := padRight(tracker.FormatBytes(c.RxRate), colRx)
+// sortKeys are the catalog keys of the sort field names, by SortField.
+// SortDerived has none: it is named by its column.
+var sortKeys = [...]string{
+	SortApp: "sort.app", SortPing: "sort.ping", SortLoss: "sort.loss", SortTxRate: "sort.tx", SortRxRate: "sort.rx",
+	SortState: "sort.state", SortLossTrend: "sort.loss_trend", SortAudit: "sort.audit", SortStateTime: "sort.state_time",
+	SortScore: "sort.health", SortDerived: "",
+	SortPID: "col.pid", SortDir: "col.dir", SortProto: "col.proto", SortEnc: "col.enc", SortLocal: "col.local",
+	SortRemote: "col.remote", SortShare: "col.share", SortStall: "col.stall", SortQoS: "col.qos",
+	SortSendQ: "col.sendq", SortRecvQ: "col.recvq", SortHost: "col.host", SortNetns: "col.netns", SortCC: "col.cc",
+	SortSockMem: "col.sockmem",
+}
 
-	return pidCell + " " + appCell + " " + pingCell + " " + lossCell + " " +
-		dirCell + " " + protoCell + " " + localCell + " " + remoteCell + " " +
-		stateCell + " " + txCell + " " + rxCell
+// renderStatusBar styles the status bar, cut to width.
+func renderStatusBar(p *palette, text string, width int) string {
+	return p.styles[styleStatus].Render(truncate(text, width-1)) // -1 for the style's left padding
 }
 
-// padRight pads a plain string to the given width with spaces.
+// padRight pads a string to the given display width with spaces, cutting it
+// if it is wider. Wide characters (CJK, emoji) count as two columns.
 func padRight(s string, width int) string {
-	if len(s) >= width {
-		return s[:width]
+	w := ansi.StringWidth(s)
+	if w >= width {
+		return ansi.Truncate(s, width, "")
 	}
-	return s + strings.Repeat(" ", width-len(s))
+	return s + strings.Repeat(" ", width-w)
 }
 
 // styledPadRight applies a lipgloss style to the text content, then pads
 // with plain spaces so the visible width is exactly `width` characters.
 // If the style is zero-value (no styling), it falls back to plain padding.
 func styledPadRight(text string, style lipgloss.Style, width int) string {
-	visLen := len(text)
-	if visLen >= width {
-		text = text[:width]
-		visLen = width
+	visLen := lipgloss.Width(text)
+	if visLen > width {
+		text = ansi.Truncate(text, width, "")
+		visLen = lipgloss.Width(text)
 	}
 	styled := style.Render(text)
 	if visLen < width {
@@ -470,64 +1205,258 @@ func styledPadRight(text string, style lipgloss.Style, width int) string {
 	return styled
 }
 
-func (m Model) renderHelp() string {
-	help := `
-  Ping Tracker - Help
-  ====================
+// padLeft is padRight's counterpart for right-aligned cells: it pads s on
+// the left to the given display width, cutting it if it is wider.
+func padLeft(s string, width int) string {
+	w := ansi.StringWidth(s)
+	if w >= width {
+		return ansi.Truncate(s, width, "")
+	}
+	return strings.Repeat(" ", width-w) + s
+}
+
+// styledPadLeft is styledPadRight's counterpart for right-aligned cells:
+// the style covers the text only, the plain spaces go before it.
+func styledPadLeft(text string, style lipgloss.Style, width int) string {
+	visLen := lipgloss.Width(text)
+	if visLen > width {
+		text = ansi.Truncate(text, width, "")
+		visLen = lipgloss.Width(text)
+	}
+	styled := style.Render(text)
+	if visLen < width {
+		styled = strings.Repeat(" ", width-visLen) + styled
+	}
+	return styled
+}
+
+// perfSummary is the compact scan timing readout for the status bar.
+func (m Model) perfSummary() string {
+	stats := m.tracker.PerfStats()
+	if len(stats) == 0 {
+		return " "
+	}
+	last := stats[len(stats)-1]
+	s := fmt.Sprintf(" scan %s, ping %s, %s conns ", fmtDur(last.Enumerate+last.Diff), fmtDur(last.Ping), locale.Int(last.Conns))
+	if h := m.tracker.Health(); h.Overrunning() {
+		s += fmt.Sprintf("| every %s (set %s) ", fmtDur(h.EffectiveInterval), fmtDur(h.Interval))
+	}
+	return s
+}
+
+// lagWarning is the stale data banner: set once the last completed scan
+// is more than two intervals old, saying whether scans keep overrunning
+// the interval or the current one is just slow.
+func lagWarning(h tracker.Health, now time.Time) string {
+	age := h.Age(now)
+	if h.Interval <= 0 || age <= 2*h.Interval {
+		return ""
+	}
+	if h.Overrunning() {
+		return fmt.Sprintf("Data is %s old: scans are overrunning, one every %s instead of every %s",
+			fmtDur(age), fmtDur(h.EffectiveInterval), fmtDur(h.Interval))
+	}
+	return fmt.Sprintf("Data is %s old: the current scan is taking longer than the %s interval", fmtDur(age), fmtDur(h.Interval))
+}
+
+// notifyFailureShown is how long the banner stays after a notification
+// failed.
+const notifyFailureShown = 10 * time.Minute
 
-  Navigation:
-    j/k or Up/Down   Move cursor
-    g / G             Jump to top / bottom
+// notifyWarning is the banner of failing alert notifications: set while
+// the last failure is recent, with the session's count and the error.
+func notifyWarning(h tracker.Health, now time.Time) string {
+	if h.NotifyFailures == 0 || now.Sub(h.NotifyLastFailure) > notifyFailureShown {
+		return ""
+	}
+	return fmt.Sprintf("Notifications failing (%d this session): %s", h.NotifyFailures, h.NotifyLastError)
+}
 
-  Search:
-    /                 Start search (filters by app name)
-    Enter             Confirm search
-    Esc               Cancel search
-    c                 Clear filter
+// renderPerf shows the scan timing history.
+func (m Model) renderPerf() string {
+	stats := m.tracker.PerfStats()
+	now := time.Now()
+	lines := []string{m.st(styleTitle).Render(fmt.Sprintf("Scan performance (last %d scans)", len(stats))), ""}
+
+	if len(stats) > 0 {
+		var sum, worst tracker.ScanStats
+		for _, s := range stats {
+			sum.Enumerate += s.Enumerate
+			sum.Resolve += s.Resolve
+			sum.Diff += s.Diff
+			sum.Ping += s.Ping
+			sum.Total += s.Total
+			sum.Allocs += s.Allocs
+			if s.Total > worst.Total {
+				worst = s
+			}
+		}
+		n := time.Duration(len(stats))
+		lines = append(lines,
+			fmt.Sprintf("  avg: enumerate %s (resolve %s)  diff %s  ping %s  total %s  allocs %d",
+				fmtDur(sum.Enumerate/n), fmtDur(sum.Resolve/n), fmtDur(sum.Diff/n), fmtDur(sum.Ping/n),
+				fmtDur(sum.Total/n), sum.Allocs/uint64(len(stats))),
+			fmt.Sprintf("  max: total %s at %s", fmtDur(worst.Total), m.times.format(worst.Start, now)),
+			"",
+		)
+	}
 
-  Sorting:
-    1                 Sort by App name
-    2                 Sort by Ping latency
-    3                 Sort by Packet loss
-    4                 Sort by TX bandwidth
-    5                 Sort by RX bandwidth
-    6                 Sort by State
+	lines = append(lines, m.memSummary(), m.probeTrafficSummary())
+	if n := tracker.RejectedRows(); n > 0 {
+		lines = append(lines, fmt.Sprintf("  rejected socket table rows: %d (impossible state, PID or port)", n))
+	}
+	if s := procNameSummary(stats); s != "" {
+		lines = append(lines, s)
+	}
+	lines = append(lines, "")
+	if s := m.scheduleLog(now); s != "" {
+		lines = append(lines, s, "")
+	}
+	if s := m.loadLog(now); s != "" {
+		lines = append(lines, s, "")
+	}
 
-  Controls:
-    p                 Pause/resume auto-refresh
-    r                 Manual refresh
-    ?                 Toggle this help
-    q / Ctrl+C        Quit
+	lines = append(lines, m.st(styleHeader).Render(fmt.Sprintf("  %-19s %9s %9s %9s %9s %9s %6s %8s",
+		"Time", "Enum", "Resolve", "Diff", "Ping", "Total", "Conns", "Allocs")))
+	first := maxInt(0, len(stats)-maxInt(1, m.height-12))
+	for i := len(stats) - 1; i >= first; i-- {
+		s := stats[i]
+		lines = append(lines, fmt.Sprintf("  %-19s %9s %9s %9s %9s %9s %6d %8d",
+			m.times.format(s.Start, now), fmtDur(s.Enumerate), fmtDur(s.Resolve), fmtDur(s.Diff),
+			fmtDur(s.Ping), fmtDur(s.Total), s.Conns, s.Allocs))
+		if s.Gap != 0 && i > first {
+			lines = append(lines, m.gapRow(s.Gap))
+		}
+	}
 
-  Press any key to close this help.
-`
-	return lipgloss.NewStyle().Padding(1, 2).Render(help)
+	lines = append(lines, "", m.st(styleStatus).Render("D/Esc: back"))
+	return strings.Join(lines, "\n")
 }
 
-func truncate(s string, maxLen int) string {
-	if maxLen <= 0 {
+// procNameSummary describes the Windows process name cache: processes
+// opened per scan, names cached and PIDs still waiting. It is empty where
+// names need no opening.
+func procNameSummary(stats []tracker.ScanStats) string {
+	ns := tracker.NameLookupStats()
+	if ns.Opens+ns.Modules == 0 && ns.Cached == 0 {
 		return ""
 	}
-	if len(s) <= maxLen {
-		return s
+	sum, most := 0, 0
+	for _, s := range stats {
+		sum += s.Opens
+		most = maxInt(most, s.Opens)
 	}
-	if maxLen < 4 {
-		return s[:maxLen]
+	avg := 0.0
+	if len(stats) > 0 {
+		avg = float64(sum) / float64(len(stats))
 	}
-	return s[:maxLen-3] + "..."
+	return fmt.Sprintf("  process names: %s opens/scan avg, %d max (cap %d), %d cached, %d waiting, %d from owner modules",
+		locale.Number(fmt.Sprintf("%.1f", avg)), most, ns.PerScan, ns.Cached, ns.Pending, ns.Modules)
 }
 
-func truncStr(s string, maxLen int) string {
+// memSummary lists the entry counts of the tracker's and the UI's caches,
+// as "name count/cap", plus the Go heap size.
+func (m Model) memSummary() string {
+	entries := append(m.tracker.MemStats(),
+		tracker.MemEntry{Name: "delta log", Count: len(m.deltaLog), Cap: maxDeltaEntries},
+		tracker.MemEntry{Name: "path probes", Count: len(m.pathResults), Cap: maxPathResults})
+	parts := []string{"heap " + locale.Number(tracker.FormatBytesTotal(tracker.HeapBytes()))}
+	for _, e := range entries {
+		if e.Cap > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d/%d", e.Name, e.Count, e.Cap))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %d", e.Name, e.Count))
+		}
+	}
+	return "  memory: " + strings.Join(parts, ", ")
+}
+
+// fmtDur formats a duration compactly with a precision suited to its size,
+// with the locale's decimal separator.
+func fmtDur(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return locale.Number(fmt.Sprintf("%.1fs", d.Seconds()))
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	default:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+}
+
+// compactLocal renders the local endpoint in compact port mode: ephemeral
+// ports become a dimmed ":*", service ports get their name appended.
+func (m Model) compactLocal(c *tracker.Connection, width int) string {
+	addr := m.addr(c.LocalAddr)
+	if tracker.IsEphemeralPort(c.LocalPort) {
+		return styledPadRight(truncStr(addr+":*", width), m.st(styleStale), width)
+	}
+	local := fmt.Sprintf("%s:%d", addr, c.LocalPort)
+	if svc := tracker.ServiceName(c.LocalPort); svc != "" {
+		local += " " + svc
+	}
+	return padRight(truncStr(local, width), width)
+}
+
+// appName returns the app name to display, masked when anonymizing.
+func (m Model) appName(c *tracker.Connection) string {
+	if m.anon != nil {
+		return m.anon.app(c.AppName)
+	}
+	return c.AppName
+}
+
+// addr returns an IP address to display, masked when anonymizing.
+func (m Model) addr(a string) string {
+	if m.anon != nil {
+		return m.anon.addr(a)
+	}
+	return a
+}
+
+// hostName returns the agent name to display; "local" for this machine.
+func (m Model) hostName(h string) string {
+	if h == "" {
+		return "local"
+	}
+	if m.anon != nil {
+		return m.anon.host(h)
+	}
+	return h
+}
+
+// renderSources renders a one-line health summary of the remote agents.
+func (m Model) renderSources() string {
+	parts := []string{"Sources: local ok"}
+	for _, s := range m.remotes.Status() {
+		if s.Healthy {
+			parts = append(parts, fmt.Sprintf("%s ok (%d)", m.hostName(s.Host), s.Count))
+		} else if s.LastOK.IsZero() {
+			parts = append(parts, m.st(styleBad).Render(m.hostName(s.Host)+" unreachable"))
+		} else {
+			parts = append(parts, m.st(styleBad).Render(fmt.Sprintf("%s down since %s", m.hostName(s.Host), m.times.format(s.LastOK, time.Now()))))
+		}
+	}
+	return " " + strings.Join(parts, "  |  ")
+}
+
+// truncate cuts s to maxLen display columns, ending in "..." when cut.
+func truncate(s string, maxLen int) string {
 	if maxLen <= 0 {
 		return ""
 	}
-	if len(s) <= maxLen {
+	if ansi.StringWidth(s) <= maxLen {
 		return s
 	}
 	if maxLen < 4 {
-		return s[:maxLen]
+		return ansi.Truncate(s, maxLen, "")
 	}
-	return s[:maxLen-3] + "..."
+	return ansi.Truncate(s, maxLen, "...")
+}
+
+// truncStr is truncate for cell contents.
+func truncStr(s string, maxLen int) string {
+	return truncate(s, maxLen)
 }
 
 func maxInt(a, b int) int {
@@ -543,3 +1472,17 @@ func minInt(a, b int) int {
 	}
 	return b
 }
+
+// noteWritten adds path to the files written this session, for the
+// summary at exit; "" is ignored.
+func (m *Model) noteWritten(path string) {
+	if path != "" {
+		m.written = append(m.written, path)
+	}
+}
+
+// WrittenFiles returns the files saved from the UI this session, oldest
+// first: deep-dive samples, snippets and profiles.
+func (m Model) WrittenFiles() []string {
+	return slices.Clone(m.written)
+}
@@ -0,0 +1,223 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ping-tracker/tracker"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// newTestModel is a model over a tracker that is never started.
+func newTestModel() Model {
+	return NewModel(tracker.NewTracker(time.Hour, false))
+}
+
+// staticSource serves a fixed socket table to the tracker.
+type staticSource []tracker.Connection
+
+func (s staticSource) Scan() ([]*tracker.Connection, error) {
+	out := make([]*tracker.Connection, len(s))
+	for i := range s {
+		c := s[i]
+		out[i] = &c
+	}
+	return out, nil
+}
+
+func (s staticSource) Ping(addr string, port int) (time.Duration, float64) {
+	return 10 * time.Millisecond, 0
+}
+
+// newTestModelWith is a model over a tracker that has scanned conns once.
+func newTestModelWith(t *testing.T, conns ...tracker.Connection) Model {
+	t.Helper()
+	tr := tracker.NewTracker(time.Hour, false)
+	tr.SetSource(staticSource(conns))
+	tr.Start()
+	t.Cleanup(tr.Stop)
+	m := NewModel(tr)
+	m.refresh()
+	return m
+}
+
+// testConn is an established outbound connection from app to remote.
+func testConn(app string, pid int, remote string, port int) tracker.Connection {
+	return tracker.Connection{
+		AppName: app, PID: pid, Protocol: "tcp", State: tracker.StateEstablished, Direction: tracker.Outbound,
+		LocalAddr: "10.0.0.2", LocalPort: 40000 + port, RemoteAddr: remote, RemotePort: port,
+	}
+}
+
+// fKeys are the function keys by name.
+var fKeys = map[string]tea.KeyType{
+	"f1": tea.KeyF1, "f2": tea.KeyF2, "f3": tea.KeyF3, "f4": tea.KeyF4, "f5": tea.KeyF5,
+	"f6": tea.KeyF6, "f7": tea.KeyF7, "f8": tea.KeyF8, "f9": tea.KeyF9, "f10": tea.KeyF10,
+}
+
+// keyMsg builds the key message for a key as tea names it: "enter",
+// "esc", "ctrl+c", "f9" or a single character.
+func keyMsg(k string) tea.KeyMsg {
+	if f, ok := fKeys[k]; ok {
+		return tea.KeyMsg{Type: f}
+	}
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case "backspace":
+		return tea.KeyMsg{Type: tea.KeyBackspace}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	case "ctrl+c":
+		return tea.KeyMsg{Type: tea.KeyCtrlC}
+	case "ctrl+r":
+		return tea.KeyMsg{Type: tea.KeyCtrlR}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+// press sends keys to m through Update and returns the model and the
+// command of the last one.
+func press(t *testing.T, m Model, keys ...string) (Model, tea.Cmd) {
+	t.Helper()
+	var cmd tea.Cmd
+	for _, k := range keys {
+		var next tea.Model
+		next, cmd = m.Update(keyMsg(k))
+		m = next.(Model)
+	}
+	return m, cmd
+}
+
+// isQuit reports whether cmd is tea.Quit. It does not run cmd, which may
+// be a timer.
+func isQuit(cmd tea.Cmd) bool {
+	return cmd != nil && reflect.ValueOf(cmd).Pointer() == reflect.ValueOf(tea.Quit).Pointer()
+}
+
+func TestQuitWithoutConfirm(t *testing.T) {
+	if _, cmd := press(t, newTestModel(), "q"); !isQuit(cmd) {
+		t.Fatal("q did not quit")
+	}
+}
+
+func TestConfirmQuit(t *testing.T) {
+	for _, second := range []string{"q", "y"} {
+		m := newTestModel()
+		m.SetConfirmQuit(true)
+		m, cmd := press(t, m, "q")
+		if _, ok := findMode[*quitMode](m); !ok {
+			t.Fatal("no prompt after the first q")
+		}
+		if cmd == nil {
+			t.Fatal("no expiry timer")
+		}
+		if _, cmd = press(t, m, second); !isQuit(cmd) {
+			t.Errorf("q then %s did not quit", second)
+		}
+	}
+}
+
+func TestConfirmQuitCancel(t *testing.T) {
+	m := newTestModel()
+	m.SetConfirmQuit(true)
+	m, _ = press(t, m, "q", "j")
+	if _, ok := findMode[*quitMode](m); ok {
+		t.Fatal("prompt still open after another key")
+	}
+	// Back at the table, q asks again instead of quitting.
+	m, cmd := press(t, m, "q")
+	if isQuit(cmd) {
+		t.Fatal("quit without confirming")
+	}
+	if _, ok := findMode[*quitMode](m); !ok {
+		t.Fatal("no prompt")
+	}
+}
+
+func TestConfirmQuitExpires(t *testing.T) {
+	m := newTestModel()
+	m.SetConfirmQuit(true)
+	m, _ = press(t, m, "q")
+	q, _ := findMode[*quitMode](m)
+
+	// An early timer (from an earlier prompt) leaves it open.
+	next, _ := m.Update(quitExpiredMsg{})
+	m = next.(Model)
+	if _, ok := findMode[*quitMode](m); !ok {
+		t.Fatal("prompt closed before its window")
+	}
+
+	q.at = time.Now().Add(-quitConfirmWindow - time.Second)
+	next, _ = m.Update(quitExpiredMsg{})
+	m = next.(Model)
+	if _, ok := findMode[*quitMode](m); ok {
+		t.Fatal("prompt still open after its window")
+	}
+
+	// A late second q confirms nothing.
+	m.pushMode(&quitMode{at: time.Now().Add(-quitConfirmWindow - time.Second)})
+	if _, cmd := press(t, m, "y"); isQuit(cmd) {
+		t.Fatal("quit after the window")
+	}
+}
+
+func TestPadLeft(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"42", 6, "    42"},
+		{"1,200.0ms", 9, "1,200.0ms"},
+		{"98.7 MB/s", 6, "98.7 M"},
+		{"ゲーム", 8, "  ゲーム"},
+		{"", 3, "   "},
+	} {
+		if got := padLeft(tt.in, tt.width); got != tt.want {
+			t.Errorf("padLeft(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+
+	// The padding goes outside the style, and counts visible columns only.
+	withColor(t)
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	got := styledPadLeft("9.8ms", style, 8)
+	if ansi.StringWidth(got) != 8 || !strings.HasPrefix(got, "   \x1b[") || ansi.Strip(got) != "   9.8ms" {
+		t.Errorf("styledPadLeft %q", got)
+	}
+	if got := ansi.Strip(styledPadLeft("1,200.0ms", style, 6)); got != "1,200." {
+		t.Errorf("styledPadLeft cut to %q", got)
+	}
+}
+
+// TestTitleGrouped checks that the title's counts take the locale's
+// thousands separator.
+func TestTitleGrouped(t *testing.T) {
+	c := testConn("curl", 100, "192.0.2.1", 443)
+	conns := make([]*tracker.Connection, 12345)
+	for i := range conns {
+		conns[i] = &c
+	}
+	for _, lang := range []struct{ lang, want string }{{"en", "12,345"}, {"de", "12.345"}, {"fr", "12\u202f345"}} {
+		withLocale(t, lang.lang)
+		m := newTestModel()
+		m.connections = conns
+		m.overflow.Conns = 2000
+		title := m.titleText()
+		if !strings.Contains(title, lang.want) || !strings.Contains(title, "+"+locale.Int(2000)+" ") {
+			t.Errorf("%s: %q", lang.lang, title)
+		}
+	}
+}